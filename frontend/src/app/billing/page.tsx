@@ -49,6 +49,10 @@ export default function BillingPage() {
           name: 'Free',
           description: 'Perfect for personal use',
           price_per_month: 0,
+          price_per_year: 0,
+          yearly_price_per_month: 0,
+          yearly_saving_per_month: 0,
+          yearly_saving_percent: 0,
           quota_bytes: 5 * 1024 * 1024 * 1024, // 5GB
           features: [
             '5GB Storage',
@@ -57,6 +61,7 @@ export default function BillingPage() {
             'Standard security'
           ],
           is_popular: false,
+          per_seat: false,
           created_at: new Date().toISOString(),
           updated_at: new Date().toISOString()
         },
@@ -65,6 +70,10 @@ export default function BillingPage() {
           name: 'Pro',
           description: 'Best for professionals and small teams',
           price_per_month: 9.99,
+          price_per_year: 99.9,
+          yearly_price_per_month: 8.33,
+          yearly_saving_per_month: 1.66,
+          yearly_saving_percent: 17,
           quota_bytes: 100 * 1024 * 1024 * 1024, // 100GB
           features: [
             '100GB Storage',
@@ -75,6 +84,7 @@ export default function BillingPage() {
             'API access'
           ],
           is_popular: true,
+          per_seat: false,
           created_at: new Date().toISOString(),
           updated_at: new Date().toISOString()
         },
@@ -83,6 +93,10 @@ export default function BillingPage() {
           name: 'Enterprise',
           description: 'For large organizations',
           price_per_month: 29.99,
+          price_per_year: 299.9,
+          yearly_price_per_month: 24.99,
+          yearly_saving_per_month: 5,
+          yearly_saving_percent: 17,
           quota_bytes: 1000 * 1024 * 1024 * 1024, // 1TB
           features: [
             '1TB Storage',
@@ -94,6 +108,7 @@ export default function BillingPage() {
             'SSO integration'
           ],
           is_popular: false,
+          per_seat: false,
           created_at: new Date().toISOString(),
           updated_at: new Date().toISOString()
         }
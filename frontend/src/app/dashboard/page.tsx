@@ -140,16 +140,6 @@ export default function DashboardPage() {
     }
   }, [router])
 
-  const loadFavoriteStatus = async (fileIds: string[]) => {
-    if (!user || fileIds.length === 0) return
-    try {
-      const status = await fileService.checkFavoriteStatus(fileIds)
-      setFavoriteStatus(prev => ({ ...prev, ...status }))
-    } catch (error) {
-      console.error('Failed to load favorite status:', error)
-    }
-  }
-
   const loadFiles = useCallback(async () => {
     if (!user) return
     console.log('Loading files for user:', user.userId)
@@ -162,9 +152,12 @@ export default function DashboardPage() {
       setFiles(myFiles.files)
       setSharedFiles(shared.files)
       
-      // Load favorite status for all files
-      const allFileIds = [...myFiles.files.map(f => f.file_id), ...shared.files.map(f => f.file_id)]
-      await loadFavoriteStatus(allFileIds)
+      // The listings say which files are favorites
+      const status: { [fileId: string]: boolean } = {}
+      for (const f of [...myFiles.files, ...shared.files]) {
+        status[f.file_id] = f.is_favorite || false
+      }
+      setFavoriteStatus(prev => ({ ...prev, ...status }))
       
       setServiceStatus(prev => ({ ...prev, fileService: true }))
     } catch (error) {
@@ -176,7 +169,7 @@ export default function DashboardPage() {
     } finally {
       setLoading(false)
     }
-  }, [user, loadFavoriteStatus])
+  }, [user])
 
   const loadNotifications = useCallback(async () => {
     if (!user) return
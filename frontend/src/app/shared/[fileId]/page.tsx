@@ -1,11 +1,12 @@
 'use client'
 
-import { useEffect, useState } from 'react'
+import React, { useEffect, useState } from 'react'
 import { useParams, useRouter } from 'next/navigation'
-import { Download, File, Clock, User, AlertCircle, CheckCircle, Eye, Calendar } from 'lucide-react'
+import { Download, File, Clock, User, AlertCircle, CheckCircle, Eye, Calendar, Lock } from 'lucide-react'
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card'
 import { Button } from '@/components/ui/button'
 import { Badge } from '@/components/ui/badge'
+import { Input } from '@/components/ui/input'
 import { Progress } from '@/components/ui/progress'
 import { useToast } from '@/components/ui/use-toast'
 
@@ -20,8 +21,14 @@ interface SharedFileData {
   permission: string
   is_expired: boolean
   is_valid: boolean
+  has_password: boolean
+  download_url: string
+  preview_url?: string
+  link_expires_at: string
 }
 
+const apiGatewayUrl = process.env.NEXT_PUBLIC_API_GATEWAY_URL || 'http://localhost:8080'
+
 export default function SharedFilePage() {
   const params = useParams()
   const router = useRouter()
@@ -33,6 +40,8 @@ export default function SharedFilePage() {
   const [downloading, setDownloading] = useState(false)
   const [downloadProgress, setDownloadProgress] = useState(0)
   const [error, setError] = useState<string | null>(null)
+  const [passwordRequired, setPasswordRequired] = useState(false)
+  const [password, setPassword] = useState('')
 
   useEffect(() => {
     if (fileId) {
@@ -40,34 +49,77 @@ export default function SharedFilePage() {
     }
   }, [fileId])
 
-  const loadSharedFile = async () => {
+  // The landing endpoint is public; shares with a password need it on every load, as
+  // it also renews the download link
+  const loadSharedFile = async (sharePassword = password): Promise<SharedFileData | null> => {
     try {
-      setLoading(true)
+      // Renewing the link of a loaded page keeps it on screen
+      if (!fileData) {
+        setLoading(true)
+      }
       setError(null)
-      
-      const apiGatewayUrl = process.env.NEXT_PUBLIC_API_GATEWAY_URL || 'http://localhost:8080';
-      const response = await fetch(`${apiGatewayUrl}/api/v1/files/${fileId}/public`, {
+
+      const headers: Record<string, string> = {}
+      if (sharePassword) {
+        headers['X-Share-Password'] = sharePassword
+      }
+      const response = await fetch(`${apiGatewayUrl}/api/v1/shared/${fileId}`, {
         method: 'GET',
-        headers: {
-          'Content-Type': 'application/json',
-        },
+        headers,
       })
 
       if (!response.ok) {
         const errorData = await response.json()
+        if (response.status === 401 && errorData.details?.password_required) {
+          setPasswordRequired(true)
+          return null
+        }
+        if (response.status === 403 && passwordRequired) {
+          toast({
+            title: 'Incorrect Password',
+            description: errorData.message || 'The password is incorrect.',
+            variant: 'destructive',
+          })
+          return null
+        }
         throw new Error(errorData.message || 'Failed to load shared file')
       }
 
-      const data = await response.json()
+      const data: SharedFileData = await response.json()
+      setPasswordRequired(false)
       setFileData(data)
+      return data
     } catch (err: any) {
       console.error('Failed to load shared file:', err)
       setError(err.message || 'Failed to load shared file')
+      return null
     } finally {
       setLoading(false)
     }
   }
 
+  const handlePasswordSubmit = (e: React.FormEvent) => {
+    e.preventDefault()
+    if (password) {
+      loadSharedFile(password)
+    }
+  }
+
+  // Download links are short-lived; an expired one is renewed before it is used
+  const currentFileData = async () => {
+    if (fileData && new Date(fileData.link_expires_at).getTime() > Date.now()) {
+      return fileData
+    }
+    return loadSharedFile()
+  }
+
+  const handlePreview = async () => {
+    const data = await currentFileData()
+    if (data?.preview_url) {
+      window.open(`${apiGatewayUrl}${data.preview_url}`, '_blank', 'noopener,noreferrer')
+    }
+  }
+
   const handleDownload = async () => {
     if (!fileData) return
 
@@ -75,8 +127,11 @@ export default function SharedFilePage() {
       setDownloading(true)
       setDownloadProgress(0)
 
-      const apiGatewayUrl = process.env.NEXT_PUBLIC_API_GATEWAY_URL || 'http://localhost:8080';
-      const response = await fetch(`${apiGatewayUrl}/api/v1/files/${fileId}/public/download`, {
+      const data = await currentFileData()
+      if (!data) {
+        throw new Error('The download link could not be renewed')
+      }
+      const response = await fetch(`${apiGatewayUrl}${data.download_url}`, {
         method: 'GET',
       })
 
@@ -190,6 +245,38 @@ export default function SharedFilePage() {
     )
   }
 
+  if (passwordRequired && !fileData) {
+    return (
+      <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center">
+        <Card className="w-full max-w-md">
+          <CardHeader>
+            <div className="flex items-center space-x-2 text-blue-600">
+              <Lock className="w-5 h-5" />
+              <CardTitle>Password Required</CardTitle>
+            </div>
+            <CardDescription>
+              This shared file is protected by a password.
+            </CardDescription>
+          </CardHeader>
+          <CardContent>
+            <form onSubmit={handlePasswordSubmit} className="space-y-4">
+              <Input
+                type="password"
+                placeholder="Enter password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                autoFocus
+              />
+              <Button type="submit" className="w-full" disabled={!password}>
+                Unlock
+              </Button>
+            </form>
+          </CardContent>
+        </Card>
+      </div>
+    )
+  }
+
   if (error || !fileData) {
     return (
       <div className="min-h-screen bg-gradient-to-br from-red-50 to-pink-100 flex items-center justify-center">
@@ -254,9 +341,11 @@ export default function SharedFilePage() {
             </div>
             <div>
               <CardTitle className="text-xl">{fileData.name}</CardTitle>
-              <CardDescription>
-                Shared by {fileData.owner_name}
-              </CardDescription>
+              {fileData.owner_name && (
+                <CardDescription>
+                  Shared by {fileData.owner_name}
+                </CardDescription>
+              )}
             </div>
           </div>
         </CardHeader>
@@ -269,10 +358,12 @@ export default function SharedFilePage() {
                 <File className="w-4 h-4" />
                 <span>Size: {formatFileSize(fileData.size)}</span>
               </div>
-              <div className="flex items-center space-x-2 text-sm text-gray-600">
-                <User className="w-4 h-4" />
-                <span>Owner: {fileData.owner_name}</span>
-              </div>
+              {fileData.owner_name && (
+                <div className="flex items-center space-x-2 text-sm text-gray-600">
+                  <User className="w-4 h-4" />
+                  <span>Owner: {fileData.owner_name}</span>
+                </div>
+              )}
               <div className="flex items-center space-x-2 text-sm text-gray-600">
                 <Calendar className="w-4 h-4" />
                 <span>Created: {formatDate(fileData.created_at)}</span>
@@ -325,6 +416,18 @@ export default function SharedFilePage() {
               <Download className="w-4 h-4 mr-2" />
               {downloading ? 'Downloading...' : 'Download File'}
             </Button>
+
+            {fileData.preview_url && (
+              <Button
+                onClick={handlePreview}
+                variant="outline"
+                className="w-full mt-2"
+                size="lg"
+              >
+                <Eye className="w-4 h-4 mr-2" />
+                Preview
+              </Button>
+            )}
             
             {fileData.permission === 'READ' && (
               <p className="text-sm text-gray-500 mt-2 text-center">
@@ -8,28 +8,69 @@ export interface Plan {
   name: string;
   quota_bytes: number;
   price_per_month: number;
+  price_per_year: number;
+  // Effective monthly price when billed yearly, and the saving over monthly billing
+  yearly_price_per_month: number;
+  yearly_saving_per_month: number;
+  yearly_saving_percent: number;
   description: string;
   features: string[];
   is_popular: boolean;
+  per_seat: boolean; // priced per seat of an organization's team subscription
+  trial_days: number; // free trial of new Stripe subscribers, 0 for none
+  // Prices in each currency the plan can be bought in, by lower case code such as 'eur'.
+  // The prices above are in USD.
+  prices: Record<string, PricePoint>;
+  currencies: string[];
+  // API calls a month made with API keys, 0 for no API access, and the USD price of every
+  // 1,000 calls over them
+  api_calls_included: number;
+  api_overage_per_1000: number;
   created_at: string;
   updated_at: string;
 }
 
+export interface PricePoint {
+  price_per_month: number;
+  price_per_year: number;
+  api_overage_per_1000: number;
+}
+
+export type BillingInterval = 'month' | 'year';
+
 export interface Subscription {
   id: string;
   user_id: string;
   plan_id: string;
   plan?: Plan;
-  status: 'active' | 'expired' | 'cancelled' | 'pending';
+  status: 'active' | 'expired' | 'cancelled' | 'pending' | 'trialing';
   payment_status: 'pending' | 'paid' | 'failed' | 'refunded';
   start_date: string;
   end_date: string;
   transaction_id?: string;
   payment_method: string;
+  billing_interval: BillingInterval;
+  currency: string; // billed in, such as 'usd'
+  renews_at?: string;
+  trial_end?: string; // set while trialing, when the first payment is charged
+  org_id?: string; // set on team subscriptions
+  seats?: number;
+  dunning?: Dunning; // set while a failed renewal payment is in its grace period
+  billing_details?: BillingDetails;
   created_at: string;
   updated_at: string;
 }
 
+// A subscription whose renewal payment failed keeps its plan until grace_period_end,
+// while the payment is retried, and is downgraded to the Free plan after that
+export interface Dunning {
+  failed_at: string;
+  grace_period_end: string;
+  retries: number;
+  next_retry_at: string;
+  payment_url?: string; // pays the renewal with another payment method
+}
+
 export interface Usage {
   user_id: string;
   plan_name: string;
@@ -40,12 +81,43 @@ export interface Usage {
   percent_used: number;
   upgrade_available: boolean;
   quota_exceeded: boolean;
+  // Price of the plan for each billing_interval, formatted in the currency it's billed in
+  currency: string;
+  plan_price: string;
+  billing_interval: BillingInterval;
+  org_id?: string; // set when the quota is shared with a team
+  seats?: number;
 }
 
 export interface CreateSubscriptionRequest {
   user_id: string;
   plan_id: string;
   payment_method: 'stripe' | 'razorpay';
+  billing_interval?: BillingInterval; // defaults to 'month'
+  // Defaults to the currency of the browser's locale if the plan is priced in it, or USD
+  currency?: string;
+  org_id?: string; // required for per-seat plans
+  seats?: number;
+  billing_details?: BillingDetails;
+}
+
+// Where a customer is billed, which decides the tax on their invoices. Businesses
+// abroad who give a VAT or GST ID are charged without tax, under the reverse charge.
+export interface BillingDetails {
+  country: string; // two-letter code, such as 'DE'
+  region?: string; // state or province, for countries taxed by region such as 'CA'
+  tax_id?: string;
+  business_name?: string;
+}
+
+// Options for opening Razorpay Checkout on the subscription's order
+export interface RazorpayCheckout {
+  key_id: string;
+  order_id: string;
+  amount: number; // in the smallest unit of currency, such as paise
+  currency: string;
+  name: string;
+  description: string;
 }
 
 export interface CreateSubscriptionResponse {
@@ -53,6 +125,7 @@ export interface CreateSubscriptionResponse {
   payment_url: string;
   client_secret: string;
   session_id: string;
+  razorpay_checkout?: RazorpayCheckout;
 }
 
 export interface CancelSubscriptionRequest {
@@ -65,15 +138,170 @@ export interface CancelSubscriptionResponse {
   message: string;
 }
 
+// Invoice amounts are in the smallest unit of the currency, such as cents
+export interface InvoiceLineItem {
+  description: string;
+  quantity: number;
+  unit_amount: number;
+  amount: number;
+}
+
+export interface Invoice {
+  id: string;
+  number: string;
+  subscription_id: string;
+  plan_id: string;
+  plan_name: string;
+  status: 'paid' | 'partially_refunded' | 'refunded';
+  payment_method: string;
+  transaction_id: string;
+  currency: string;
+  line_items: InvoiceLineItem[];
+  subtotal: number;
+  tax_rate: number;
+  tax: number;
+  tax_lines: InvoiceTaxLine[];
+  reverse_charge: boolean; // no tax charged, the customer accounts for it
+  bill_to?: BillingDetails;
+  total: number;
+  period_start: string;
+  period_end: string;
+  issued_at: string;
+  amount_refunded: number;
+  refunds: InvoiceRefund[];
+}
+
+export interface InvoiceTaxLine {
+  name: string; // such as 'VAT' or 'GST'
+  rate: number; // percent
+  amount: number;
+}
+
+// A refund of part or all of an invoice's payment, in the invoice currency's smallest unit
+export interface InvoiceRefund {
+  id: string;
+  amount: number;
+  reason: string;
+  created_at: string;
+}
+
+export interface ListInvoicesResponse {
+  invoices: Invoice[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+// Price of changing the seats of a team subscription. Amounts are in the smallest unit
+// of currency, such as cents.
+export interface SeatQuote {
+  currency: string;
+  current_seats: number;
+  seats: number;
+  prorated: number; // negative when seats are removed
+  credit_applied: number;
+  amount_due: number;
+  credit_earned: number;
+  period_end: string;
+}
+
+export interface TeamSubscription {
+  subscription: Subscription;
+  members: number;
+  // Quota shared by the members, and their combined usage
+  quota_bytes: number;
+  used_bytes: number;
+  seat_credit: number; // in the smallest unit of the subscription's currency
+}
+
+// Removed seats take effect right away. Added seats with an amount due are added once
+// paid at payment_url, or in Razorpay Checkout.
+export interface UpdateSeatsResponse {
+  subscription: Subscription;
+  quote: SeatQuote;
+  payment_url?: string;
+  session_id?: string;
+  razorpay_checkout?: RazorpayCheckout;
+}
+
+// An API key lets programs call the file endpoints as the user with the X-API-Key
+// header. The key itself is only returned when it is created.
+export interface APIKey {
+  id: string;
+  name: string;
+  prefix: string; // start of the key, to recognize it by
+  revoked: boolean;
+  created_at: string;
+  last_used_at?: string;
+  revoked_at?: string;
+}
+
+export interface CreateAPIKeyResponse {
+  api_key: APIKey;
+  key: string;
+}
+
+// API usage this month. Prices are formatted in currency, and calls over the included
+// calls are billed with the next payment.
+export interface APIUsage {
+  user_id: string;
+  plan_name: string;
+  api_access: boolean;
+  month: string; // such as '2026-10'
+  included_calls: number;
+  calls: number;
+  overage_calls: number;
+  currency: string;
+  overage_price: string; // per 1,000 calls
+  estimated_overage: string;
+  keys: (APIKey & { calls: number })[];
+  // Overage of past months that is yet to be invoiced
+  unbilled: { month: string; overage_calls: number; amount: string }[];
+}
+
 export interface GetUserSubscriptionResponse {
   subscription?: Subscription;
   has_active_subscription: boolean;
 }
 
+// The gateway serves billing responses as proto JSON: enums are named after the proto
+// values (SUBSCRIPTION_STATUS_ACTIVE) and 64-bit integers are strings
+const enumValue = (value: string, prefix: string) =>
+  value && value.startsWith(prefix) ? value.slice(prefix.length).toLowerCase() : value;
+
+const normalizePlan = (plan: Plan): Plan => ({
+  ...plan,
+  quota_bytes: Number(plan.quota_bytes),
+  api_calls_included: Number(plan.api_calls_included || 0),
+  prices: plan.prices || {},
+  currencies: plan.currencies || Object.keys(plan.prices || {}),
+});
+
+const normalizeSubscription = (subscription: Subscription): Subscription => ({
+  ...subscription,
+  plan: subscription.plan ? normalizePlan(subscription.plan) : undefined,
+  status: enumValue(subscription.status, 'SUBSCRIPTION_STATUS_') as Subscription['status'],
+  payment_status: enumValue(subscription.payment_status, 'PAYMENT_STATUS_') as Subscription['payment_status'],
+});
+
+const normalizeUsage = (usage: Usage): Usage => ({
+  ...usage,
+  quota_bytes: Number(usage.quota_bytes),
+  used_bytes: Number(usage.used_bytes),
+});
+
+const normalizeSeatQuote = (quote: SeatQuote): SeatQuote => ({
+  ...quote,
+  prorated: Number(quote.prorated || 0),
+  credit_applied: Number(quote.credit_applied || 0),
+  amount_due: Number(quote.amount_due || 0),
+  credit_earned: Number(quote.credit_earned || 0),
+});
+
 // API Client
 export const billingService = {
-  // Get all available plans
-  async getPlans(): Promise<{ plans: Plan[] }> {
+  // Get all available plans, and the currency of the browser's locale to show them in
+  async getPlans(): Promise<{ plans: Plan[]; currency: string }> {
     const response = await fetch(`${billingApiUrl}/plans`, {
       method: 'GET',
       headers: {
@@ -86,7 +314,8 @@ export const billingService = {
       throw new Error(`Failed to fetch plans: ${response.statusText}`);
     }
 
-    return response.json();
+    const data = await response.json();
+    return { plans: (data.plans || []).map(normalizePlan), currency: data.currency || 'usd' };
   },
 
   // Get a specific plan
@@ -103,7 +332,8 @@ export const billingService = {
       throw new Error(`Failed to fetch plan: ${response.statusText}`);
     }
 
-    return response.json();
+    const data = await response.json();
+    return { plan: normalizePlan(data.plan) };
   },
 
   // Get user's current subscription
@@ -120,7 +350,11 @@ export const billingService = {
       throw new Error(`Failed to fetch subscription: ${response.statusText}`);
     }
 
-    return response.json();
+    const data = await response.json();
+    return {
+      ...data,
+      subscription: data.subscription ? normalizeSubscription(data.subscription) : undefined,
+    };
   },
 
   // Create a new subscription
@@ -138,7 +372,14 @@ export const billingService = {
       throw new Error(`Failed to create subscription: ${response.statusText}`);
     }
 
-    return response.json();
+    const result = await response.json();
+    return {
+      ...result,
+      subscription: normalizeSubscription(result.subscription),
+      razorpay_checkout: result.razorpay_checkout
+        ? { ...result.razorpay_checkout, amount: Number(result.razorpay_checkout.amount) }
+        : undefined,
+    };
   },
 
   // Cancel a subscription
@@ -205,6 +446,175 @@ export const billingService = {
       throw new Error(`Failed to fetch usage: ${response.statusText}`);
     }
 
+    const data = await response.json();
+    return { usage: normalizeUsage(data.usage) };
+  },
+
+  // List the user's invoices, newest first
+  async listInvoices(limit = 20, offset = 0): Promise<ListInvoicesResponse> {
+    const response = await fetch(`${billingApiUrl}/invoices?limit=${limit}&offset=${offset}`, {
+      method: 'GET',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${localStorage.getItem('access_token')}`,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to fetch invoices: ${response.statusText}`);
+    }
+
+    return response.json();
+  },
+
+  // Download an invoice as a PDF
+  async downloadInvoice(invoiceId: string): Promise<Blob> {
+    const response = await fetch(`${billingApiUrl}/invoices/${invoiceId}/pdf`, {
+      method: 'GET',
+      headers: {
+        'Authorization': `Bearer ${localStorage.getItem('access_token')}`,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to download invoice: ${response.statusText}`);
+    }
+
+    return response.blob();
+  },
+
+  // List the user's API keys, including revoked ones
+  async listAPIKeys(): Promise<{ api_keys: APIKey[] }> {
+    const response = await fetch(`${billingApiUrl}/api-keys`, {
+      method: 'GET',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${localStorage.getItem('access_token')}`,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to fetch API keys: ${response.statusText}`);
+    }
+
+    return response.json();
+  },
+
+  // Create an API key. The key is only shown in this response.
+  async createAPIKey(name: string): Promise<CreateAPIKeyResponse> {
+    const response = await fetch(`${billingApiUrl}/api-keys`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${localStorage.getItem('access_token')}`,
+      },
+      body: JSON.stringify({ name }),
+    });
+
+    if (!response.ok) {
+      const error = await response.json().catch(() => ({}));
+      throw new Error(error.message || `Failed to create API key: ${response.statusText}`);
+    }
+
     return response.json();
   },
-};
\ No newline at end of file
+
+  // Revoke an API key
+  async revokeAPIKey(keyId: string): Promise<void> {
+    const response = await fetch(`${billingApiUrl}/api-keys/${keyId}`, {
+      method: 'DELETE',
+      headers: {
+        'Authorization': `Bearer ${localStorage.getItem('access_token')}`,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to revoke API key: ${response.statusText}`);
+    }
+  },
+
+  // Get this month's API usage and overage
+  async getAPIUsage(): Promise<{ api_usage: APIUsage }> {
+    const response = await fetch(`${billingApiUrl}/api-usage`, {
+      method: 'GET',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${localStorage.getItem('access_token')}`,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to fetch API usage: ${response.statusText}`);
+    }
+
+    return response.json();
+  },
+
+  // Get an organization's team subscription
+  async getTeamSubscription(orgId: string): Promise<TeamSubscription> {
+    const response = await fetch(`${billingApiUrl}/organizations/${orgId}/subscription`, {
+      method: 'GET',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${localStorage.getItem('access_token')}`,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to fetch team subscription: ${response.statusText}`);
+    }
+
+    const data = await response.json();
+    return {
+      ...data,
+      subscription: normalizeSubscription(data.subscription),
+      quota_bytes: Number(data.quota_bytes),
+      used_bytes: Number(data.used_bytes || 0),
+      seat_credit: Number(data.seat_credit || 0),
+    };
+  },
+
+  // Price changing a team subscription to the given number of seats
+  async quoteSeats(orgId: string, seats: number): Promise<{ quote: SeatQuote }> {
+    const response = await fetch(`${billingApiUrl}/organizations/${orgId}/seats/quote?seats=${seats}`, {
+      method: 'GET',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${localStorage.getItem('access_token')}`,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to quote seats: ${response.statusText}`);
+    }
+
+    const data = await response.json();
+    return { quote: normalizeSeatQuote(data.quote) };
+  },
+
+  // Change the number of seats of a team subscription
+  async updateSeats(orgId: string, seats: number): Promise<UpdateSeatsResponse> {
+    const response = await fetch(`${billingApiUrl}/organizations/${orgId}/seats`, {
+      method: 'PUT',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${localStorage.getItem('access_token')}`,
+      },
+      body: JSON.stringify({ seats }),
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to update seats: ${response.statusText}`);
+    }
+
+    const result = await response.json();
+    return {
+      ...result,
+      subscription: normalizeSubscription(result.subscription),
+      quote: normalizeSeatQuote(result.quote),
+      razorpay_checkout: result.razorpay_checkout
+        ? { ...result.razorpay_checkout, amount: Number(result.razorpay_checkout.amount) }
+        : undefined,
+    };
+  },
+};
@@ -44,6 +44,8 @@ export interface FileMetadata {
   updated_at: string;
   is_private?: boolean;
   shared_with?: string[];
+  // Set in file listings
+  is_favorite?: boolean;
 }
 
 export interface UploadFileRequest {
@@ -65,6 +67,16 @@ export interface FileShare {
   is_active: boolean;
   created_at: string;
   updated_at: string;
+  shared_with_id?: string;
+  has_password?: boolean;
+}
+
+export interface UpdateShareRequest {
+  permission?: string;
+  expiry_time?: string;
+  clear_expiry?: boolean;
+  password?: string;
+  clear_password?: boolean;
 }
 
 export const fileService = {
@@ -161,6 +173,31 @@ export const fileService = {
     return response.data;
   },
 
+  // Lists the shares of one of the user's files, or of all of them without fileId
+  async listShares(fileId?: string, page = 1, limit = 20): Promise<{ shares: FileShare[]; total: number; page: number; limit: number }> {
+    const response = await fileApi.get(fileId ? `/${fileId}/shares` : '/shares', {
+      params: {
+        page,
+        limit
+      },
+    });
+    return response.data;
+  },
+
+  async updateShare(fileId: string, shareId: string, update: UpdateShareRequest): Promise<{ share: FileShare; message: string }> {
+    const response = await fileApi.patch(`/${fileId}/share/${shareId}`, {
+      ...update,
+      // The enum name, such as PERMISSION_READ for "read"
+      permission: update.permission && `PERMISSION_${update.permission.toUpperCase().replace(/^PERMISSION_/, '')}`,
+    });
+    return response.data;
+  },
+
+  async setShareActive(fileId: string, shareId: string, active: boolean): Promise<{ share: FileShare; message: string }> {
+    const response = await fileApi.post(`/${fileId}/share/${shareId}/${active ? 'reactivate' : 'deactivate'}`);
+    return response.data;
+  },
+
   async listSharedFiles(page = 1, limit = 20): Promise<{ files: FileMetadata[]; total: number; page: number; limit: number }> {
     console.log('listSharedFiles - page:', page, 'limit:', limit);
 
@@ -193,30 +230,6 @@ export const fileService = {
     return response.data;
   },
 
-  async checkFavoriteStatus(fileIds: string[]): Promise<{ [fileId: string]: boolean }> {
-    // For now, we'll get all favorites and check which ones match
-    // This could be optimized with a dedicated endpoint later
-    try {
-      const response = await this.listFavorites(1, 100); // Get all favorites (capped at 100)
-      const favoriteFileIds = new Set(response.files.map(f => f.file_id));
-
-      const result: { [fileId: string]: boolean } = {};
-      fileIds.forEach(fileId => {
-        result[fileId] = favoriteFileIds.has(fileId);
-      });
-
-      return result;
-    } catch (error) {
-      console.error('Failed to check favorite status:', error);
-      // Return all false if there's an error
-      const result: { [fileId: string]: boolean } = {};
-      fileIds.forEach(fileId => {
-        result[fileId] = false;
-      });
-      return result;
-    }
-  },
-
   async downloadFile(
     fileId: string,
     fileName: string,
@@ -239,8 +252,8 @@ export const fileService = {
     });
 
     if (!response.ok) {
-      const errorData = await response.json().catch(() => ({ error: 'Download failed' }));
-      throw new Error(errorData.error || `Download failed with status ${response.status}`);
+      const errorData = await response.json().catch(() => ({ message: 'Download failed' }));
+      throw new Error(errorData.message || `Download failed with status ${response.status}`);
     }
 
     const contentLength = response.headers.get('Content-Length');
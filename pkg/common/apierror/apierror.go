@@ -0,0 +1,163 @@
+// Package apierror defines the body of the error responses of the REST APIs, so that
+// clients handle the errors of every service alike:
+//
+//	{"code": "not_found", "message": "File not found", "request_id": "4bf92f35..."}
+//
+// code is machine-readable, one of the Code constants; message is for people and may
+// change. details, when present, carries more about the error, such as the fields that
+// failed validation. request_id is the X-Request-ID of the request, for finding its logs.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// RequestIDHeader carries the ID that correlates the logs of a request across services.
+// It is set on every response, where Abort reads it back.
+const RequestIDHeader = "X-Request-ID"
+
+// The codes of the errors
+const (
+	CodeInvalidArgument    = "invalid_argument"
+	CodeOutOfRange         = "out_of_range"
+	CodeUnauthenticated    = "unauthenticated"
+	CodePermissionDenied   = "permission_denied"
+	CodeNotFound           = "not_found"
+	CodeGone               = "gone"
+	CodeAlreadyExists      = "already_exists"
+	CodeConflict           = "conflict"
+	CodeFailedPrecondition = "failed_precondition"
+	CodeResourceExhausted  = "resource_exhausted"
+	CodeCanceled           = "canceled"
+	CodeDeadlineExceeded   = "deadline_exceeded"
+	CodeUnimplemented      = "unimplemented"
+	CodeUnavailable        = "unavailable"
+	CodeInternal           = "internal"
+)
+
+// Error is the body of an error response
+type Error struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// New returns an error with code and message
+func New(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// WithDetails sets the details of the error
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// CodeForStatus returns the code of the errors responded with an HTTP status
+func CodeForStatus(httpStatus int) string {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return CodeInvalidArgument
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodePermissionDenied
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodeFailedPrecondition
+	case http.StatusRequestedRangeNotSatisfiable:
+		return CodeOutOfRange
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return CodeResourceExhausted
+	case 499:
+		return CodeCanceled
+	case http.StatusNotImplemented:
+		return CodeUnimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeDeadlineExceeded
+	}
+	if httpStatus < http.StatusInternalServerError {
+		return CodeInvalidArgument
+	}
+	return CodeInternal
+}
+
+// grpcCodes maps the gRPC codes to the codes and HTTP statuses of the errors, with the
+// statuses grpc-gateway responds with
+var grpcCodes = map[codes.Code]struct {
+	code       string
+	httpStatus int
+}{
+	codes.Canceled:           {CodeCanceled, 499},
+	codes.Unknown:            {CodeInternal, http.StatusInternalServerError},
+	codes.InvalidArgument:    {CodeInvalidArgument, http.StatusBadRequest},
+	codes.DeadlineExceeded:   {CodeDeadlineExceeded, http.StatusGatewayTimeout},
+	codes.NotFound:           {CodeNotFound, http.StatusNotFound},
+	codes.AlreadyExists:      {CodeAlreadyExists, http.StatusConflict},
+	codes.PermissionDenied:   {CodePermissionDenied, http.StatusForbidden},
+	codes.ResourceExhausted:  {CodeResourceExhausted, http.StatusTooManyRequests},
+	codes.FailedPrecondition: {CodeFailedPrecondition, http.StatusBadRequest},
+	codes.Aborted:            {CodeConflict, http.StatusConflict},
+	codes.OutOfRange:         {CodeOutOfRange, http.StatusBadRequest},
+	codes.Unimplemented:      {CodeUnimplemented, http.StatusNotImplemented},
+	codes.Internal:           {CodeInternal, http.StatusInternalServerError},
+	codes.Unavailable:        {CodeUnavailable, http.StatusServiceUnavailable},
+	codes.DataLoss:           {CodeInternal, http.StatusInternalServerError},
+	codes.Unauthenticated:    {CodeUnauthenticated, http.StatusUnauthorized},
+}
+
+// FromStatus returns the error and HTTP status a gRPC status is responded with. The
+// status' details are the error's details.
+func FromStatus(st *status.Status) (*Error, int) {
+	mapped, ok := grpcCodes[st.Code()]
+	if !ok {
+		mapped.code, mapped.httpStatus = CodeInternal, http.StatusInternalServerError
+	}
+	e := New(mapped.code, st.Message())
+
+	var details []json.RawMessage
+	for _, detail := range st.Details() {
+		message, ok := detail.(proto.Message)
+		if !ok {
+			continue
+		}
+		if b, err := protojson.Marshal(message); err == nil {
+			details = append(details, b)
+		}
+	}
+	if len(details) > 0 {
+		e.Details = details
+	}
+	return e, mapped.httpStatus
+}
+
+// Abort responds to a request with an error of the code httpStatus stands for, and stops
+// its handlers
+func Abort(c *gin.Context, httpStatus int, message string) {
+	AbortWith(c, httpStatus, New(CodeForStatus(httpStatus), message))
+}
+
+// AbortWith responds to a request with e, and stops its handlers
+func AbortWith(c *gin.Context, httpStatus int, e *Error) {
+	e.RequestID = c.Writer.Header().Get(RequestIDHeader)
+	c.AbortWithStatusJSON(httpStatus, e)
+}
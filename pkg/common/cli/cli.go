@@ -0,0 +1,179 @@
+// Package cli builds the command line of a service. One binary serves the service's gRPC
+// and REST APIs and runs its background workers, such as event consumers, relays and
+// cleanup jobs, all together or each in its own process, so that workers scale
+// independently of the API pods. It also applies the service's migrations and probes
+// its health.
+//
+//	serve        serve the APIs and run the workers; the default without a subcommand
+//	serve-grpc   serve the gRPC API
+//	serve-http   serve the REST API
+//	worker       run the background workers
+//	migrate      apply the pending migrations, or list them with "migrate status"
+//	healthcheck  exit non-zero unless the local process reports itself healthy
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+)
+
+// Roles selects the parts of a service a process runs
+type Roles struct {
+	// GRPC serves the gRPC API
+	GRPC bool
+	// HTTP serves the REST API
+	HTTP bool
+	// Worker runs the background workers
+	Worker bool
+}
+
+// All is every part of a service
+var All = Roles{GRPC: true, HTTP: true, Worker: true}
+
+// Process is what a process of a service was started to do
+type Process struct {
+	Roles
+	// Migrating applies or lists the migrations with MigrateArgs instead of serving
+	Migrating   bool
+	MigrateArgs []string
+}
+
+// Logger is satisfied by both the standard library's and logrus' loggers
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Service describes the command line of a service
+type Service struct {
+	// Name is the service's name, such as file-service
+	Name string
+	// Run runs a process of the service, returning once it has shut down
+	Run func(process Process)
+	// Workers is set for services with background workers, which the worker subcommand
+	// runs on their own
+	Workers bool
+	// HealthURL returns the URL the healthcheck subcommand probes, such as
+	// http://localhost:8082/health. The environment is loaded before it is called.
+	HealthURL func() string
+}
+
+// Execute runs the command line of a service and exits if it fails
+func Execute(service Service) {
+	root := &cobra.Command{
+		Use:   service.Name,
+		Short: fmt.Sprintf("Run the %s", service.Name),
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			service.Run(Process{Roles: All})
+		},
+		SilenceUsage: true,
+	}
+
+	root.AddCommand(
+		serveCommand(service, "serve", "Serve the APIs and run the background workers", All),
+		serveCommand(service, "serve-grpc", "Serve the gRPC API", Roles{GRPC: true}),
+		serveCommand(service, "serve-http", "Serve the REST API", Roles{HTTP: true}),
+	)
+	if service.Workers {
+		root.AddCommand(serveCommand(service, "worker", "Run the background workers", Roles{Worker: true}))
+	}
+	root.AddCommand(&cobra.Command{
+		Use:   "migrate [up|status]",
+		Short: "Apply the pending migrations, or list the migrations and when they were applied",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			service.Run(Process{Migrating: true, MigrateArgs: args})
+		},
+	})
+	root.AddCommand(healthcheckCommand(service))
+
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// serveCommand runs the parts of a service roles selects
+func serveCommand(service Service, use, short string, roles Roles) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			service.Run(Process{Roles: roles})
+		},
+	}
+}
+
+// healthcheckCommand probes the health endpoint of the local process, for container
+// health checks and exec probes
+func healthcheckCommand(service Service) *cobra.Command {
+	var url string
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "healthcheck",
+		Short: "Exit non-zero unless the local process reports itself healthy",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if url == "" {
+				if err := env.Load(); err != nil {
+					return fmt.Errorf("failed to load environment file: %w", err)
+				}
+				url = service.HealthURL()
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			return probe(ctx, url)
+		},
+	}
+	cmd.Flags().StringVar(&url, "url", "", "health endpoint to probe (default the service's own)")
+	cmd.Flags().DurationVar(&timeout, "timeout", 3*time.Second, "time limit of the probe")
+	return cmd
+}
+
+// probe requests a health endpoint and fails unless it responds with 200
+func probe(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check failed: %s responded with status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// ProbeServer serves the health probes and metrics on port until it is shut down. It is
+// for the processes that don't serve the REST API, whose server serves them otherwise.
+func ProbeServer(port string, healthHandler *health.Handler, logger Logger) *http.Server {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	healthHandler.Register(router)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           router,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		logger.Printf("Health probes and metrics served on port %s", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Printf("Probe server stopped: %v", err)
+		}
+	}()
+	return server
+}
@@ -0,0 +1,155 @@
+// Package env reads service configuration from environment variables, optionally
+// seeded from dotenv files.
+package env
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Load sets the variables defined in the given dotenv files, or in ".env" if none are
+// given. Variables already set in the environment are not overridden, and files that
+// don't exist are skipped. ENV_FILE names an additional file, read first.
+func Load(files ...string) error {
+	if len(files) == 0 {
+		files = []string{".env"}
+	}
+	if file := os.Getenv("ENV_FILE"); file != "" {
+		files = append([]string{file}, files...)
+	}
+
+	for _, file := range files {
+		if err := loadFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFile sets the variables in a file of KEY=VALUE lines. Blank lines and lines
+// starting with # are ignored, and values may be quoted.
+func loadFile(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNumber)
+		}
+		value = unquote(strings.TrimSpace(value))
+
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// unquote removes the quotes around a value. Double-quoted values may contain escapes;
+// unquoted values end at a " #" comment.
+func unquote(value string) string {
+	if len(value) >= 2 {
+		switch {
+		case value[0] == '"' && value[len(value)-1] == '"':
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				return unquoted
+			}
+			return value[1 : len(value)-1]
+		case value[0] == '\'' && value[len(value)-1] == '\'':
+			return value[1 : len(value)-1]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// String returns the value of key, or defaultValue if it is unset or empty
+func String(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Int returns the value of key as an int, or defaultValue if it is unset or invalid
+func Int(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// Int64 returns the value of key as an int64, or defaultValue if it is unset or invalid
+func Int64(key string, defaultValue int64) int64 {
+	if value, err := strconv.ParseInt(strings.TrimSpace(os.Getenv(key)), 10, 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// Float returns the value of key as a float64, or defaultValue if it is unset or invalid
+func Float(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(strings.TrimSpace(os.Getenv(key)), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// Bool returns the value of key as a bool, or defaultValue if it is unset or invalid.
+// Values are parsed with strconv.ParseBool.
+func Bool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// Duration returns the value of key as a duration such as "30s", or defaultValue if it
+// is unset or invalid
+func Duration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// List returns the value of key as a comma-separated list, with entries trimmed and
+// empty ones skipped, or defaultValue if it is unset or has no entries
+func List(key string, defaultValue []string) []string {
+	var entries []string
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return defaultValue
+	}
+	return entries
+}
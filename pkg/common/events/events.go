@@ -0,0 +1,178 @@
+// Package events defines the contract of the file events the file-service publishes to
+// Kafka and the other services consume. Events are JSON documents that carry the
+// version of the schema they were written with: Encode validates an event before it is
+// published, and Decode validates an event when it is consumed, upgrading events written
+// with an older schema.
+//
+// Consumers must be able to decode a schema version before producers start writing it,
+// so new versions are rolled out to consumers first.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the version of the file event schema written by Encode. Version 1
+// events, which carry no version, were written before the schema was shared.
+const SchemaVersion = 2
+
+// File event types
+const (
+	TypeFileUploaded       = "file.uploaded"
+	TypeFileDeleted        = "file.deleted"
+	TypeFileDownloaded     = "file.downloaded"
+	TypeFileVersioned      = "file.versioned"
+	TypeFileShared         = "file.shared"
+	TypeFilePrivacyChanged = "file.privacy_changed"
+)
+
+var knownTypes = map[string]bool{
+	TypeFileUploaded:       true,
+	TypeFileDeleted:        true,
+	TypeFileDownloaded:     true,
+	TypeFileVersioned:      true,
+	TypeFileShared:         true,
+	TypeFilePrivacyChanged: true,
+}
+
+var (
+	// ErrInvalidEvent is returned for events that can't be decoded or break the schema
+	ErrInvalidEvent = errors.New("invalid file event")
+	// ErrUnsupportedVersion is returned for events written with a newer schema than this
+	// one, which the consumer must be upgraded to read
+	ErrUnsupportedVersion = errors.New("unsupported file event schema version")
+)
+
+// FileEvent is an event about a file, such as its upload or its sharing
+type FileEvent struct {
+	SchemaVersion int `json:"schema_version"`
+	// EventID identifies the event so consumers can skip redeliveries. Version 1 events
+	// may have none, and are identified by their position in the topic instead.
+	EventID  string `json:"event_id"`
+	Type     string `json:"type"`
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name,omitempty"`
+	// UserID is the user who acted: the downloader for downloads, and the owner for
+	// everything else
+	UserID string `json:"user_id"`
+	// OwnerID is the file's owner, whose storage usage the file counts towards. Version 1
+	// download events don't carry it.
+	OwnerID     string    `json:"owner_id,omitempty"`
+	Success     bool      `json:"success"`
+	ErrorReason string    `json:"error_reason,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+
+	// FileSize is the size of an uploaded or new version's content, or the storage a
+	// deletion freed
+	FileSize    int64  `json:"file_size,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Version     int    `json:"version,omitempty"`
+	StoragePath string `json:"storage_path,omitempty"`
+	Checksum    string `json:"checksum,omitempty"`
+	// IsPrivate is whether a privacy change moved the file into its owner's private folder
+	IsPrivate *bool `json:"is_private,omitempty"`
+
+	// SharedWith is the email address a file was shared with, and SharedWithID the
+	// recipient's user ID if they have an account
+	SharedWith   string `json:"shared_with,omitempty"`
+	SharedWithID string `json:"shared_with_id,omitempty"`
+	Permission   string `json:"permission,omitempty"`
+
+	// TenantID is the tenant the file belongs to, empty for the default tenant
+	TenantID string `json:"tenant_id,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Validate checks that an event follows the current schema
+func (e *FileEvent) Validate() error {
+	if e.SchemaVersion != SchemaVersion {
+		return fmt.Errorf("%w: schema version %d, want %d", ErrInvalidEvent, e.SchemaVersion, SchemaVersion)
+	}
+	if e.EventID == "" {
+		return fmt.Errorf("%w: event ID is required", ErrInvalidEvent)
+	}
+	if e.OwnerID == "" {
+		return fmt.Errorf("%w: owner ID is required", ErrInvalidEvent)
+	}
+	return e.validate()
+}
+
+// validate checks the fields version 1 events share with the current schema
+func (e *FileEvent) validate() error {
+	if !knownTypes[e.Type] {
+		return fmt.Errorf("%w: unknown event type %q", ErrInvalidEvent, e.Type)
+	}
+	if e.FileID == "" {
+		return fmt.Errorf("%w: file ID is required", ErrInvalidEvent)
+	}
+	if e.UserID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidEvent)
+	}
+	if e.Timestamp.IsZero() {
+		return fmt.Errorf("%w: timestamp is required", ErrInvalidEvent)
+	}
+	if e.FileSize < 0 {
+		return fmt.Errorf("%w: negative file size", ErrInvalidEvent)
+	}
+
+	switch e.Type {
+	case TypeFileVersioned:
+		if e.Version < 1 {
+			return fmt.Errorf("%w: version is required", ErrInvalidEvent)
+		}
+	case TypeFileShared:
+		if e.SharedWith == "" && e.SharedWithID == "" {
+			return fmt.Errorf("%w: share recipient is required", ErrInvalidEvent)
+		}
+		if e.Permission == "" {
+			return fmt.Errorf("%w: permission is required", ErrInvalidEvent)
+		}
+	case TypeFilePrivacyChanged:
+		if e.IsPrivate == nil {
+			return fmt.Errorf("%w: privacy is required", ErrInvalidEvent)
+		}
+	}
+	return nil
+}
+
+// Encode validates an event and encodes it for publishing
+func Encode(e *FileEvent) ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// Decode decodes and validates a consumed event. Events written with an older schema
+// are upgraded to the current one; those written with a newer one are rejected with
+// ErrUnsupportedVersion.
+func Decode(data []byte) (*FileEvent, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	switch {
+	case header.SchemaVersion == 0 || header.SchemaVersion == 1:
+		return decodeV1(data)
+	case header.SchemaVersion > SchemaVersion:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header.SchemaVersion)
+	case header.SchemaVersion != SchemaVersion:
+		return nil, fmt.Errorf("%w: schema version %d", ErrInvalidEvent, header.SchemaVersion)
+	}
+
+	var event FileEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
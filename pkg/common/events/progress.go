@@ -0,0 +1,27 @@
+package events
+
+import "time"
+
+// UploadProgressChannel is the Redis pub/sub channel the file-service publishes the
+// progress of the uploads it receives on, and the notification-service relays to the
+// uploader's WebSocket connections. Progress is ephemeral, so it isn't published to
+// Kafka: updates published while no replica is subscribed are lost.
+const UploadProgressChannel = "upload_progress"
+
+// UploadProgress is an update of the progress of an upload session
+type UploadProgress struct {
+	// UploadID is the upload session, the ID of the file UploadFile created
+	UploadID string `json:"upload_id"`
+	FileName string `json:"file_name,omitempty"`
+	// UserID is the uploader, whose connections are sent the update
+	UserID           string  `json:"user_id"`
+	BytesTransferred int64   `json:"bytes_transferred"`
+	TotalBytes       int64   `json:"total_bytes"`
+	Percent          float64 `json:"percent"`
+	// Done is set on the last update of an upload, with Error if it failed
+	Done      bool      `json:"done"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// TenantID is the tenant of the uploader, empty for the default tenant
+	TenantID string `json:"tenant_id,omitempty"`
+}
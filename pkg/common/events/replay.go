@@ -0,0 +1,30 @@
+package events
+
+// Replays re-publish the events of a topic, from an offset or a time, for one consumer
+// group to process again, such as to rebuild notifications or storage usage after a bug.
+// They are published to the group's replay topic, which only that group's services
+// consume, with headers naming the replay and where each event was first published.
+const (
+	// ReplayIDHeader identifies the replay that published an event
+	ReplayIDHeader = "replay-id"
+	// ReplayTopicHeader is the topic a replayed event was first published to
+	ReplayTopicHeader = "replay-topic"
+	// ReplayPartitionHeader and ReplayOffsetHeader are the partition and offset a
+	// replayed event was first published at
+	ReplayPartitionHeader = "replay-partition"
+	ReplayOffsetHeader    = "replay-offset"
+)
+
+// ReplayTopic names the topic events are replayed to for a consumer group. Services
+// consume it with a group of the same name, so that a replay topic that doesn't exist
+// yet doesn't hold up the partitions of the group's other topics.
+func ReplayTopic(group string) string {
+	return group + ".replay"
+}
+
+// ReplayEventID identifies a replayed event for deduplication. It differs from the ID of
+// the event, so that the event is processed again even though it was processed when it
+// was first published, but not twice for the same replay.
+func ReplayEventID(replayID, eventID string) string {
+	return "replay:" + replayID + ":" + eventID
+}
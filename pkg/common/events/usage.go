@@ -0,0 +1,17 @@
+package events
+
+import "time"
+
+// StorageUsageChannel is the Redis pub/sub channel the file-service publishes the storage
+// usage of users on as it changes, and the notification-service relays to their WebSocket
+// connections. Like the progress of uploads, updates aren't published to Kafka.
+const StorageUsageChannel = "storage_usage"
+
+// StorageUsage is the storage usage of a user after it changed
+type StorageUsage struct {
+	UserID     string    `json:"user_id"`
+	UsedBytes  int64     `json:"used_bytes"`
+	QuotaBytes int64     `json:"quota_bytes"`
+	FileCount  int64     `json:"file_count"`
+	Timestamp  time.Time `json:"timestamp"`
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// UserEventsTopic is the Kafka topic the auth-service publishes user events to
+const UserEventsTopic = "user-events"
+
+// UserSchemaVersion is the version of the user event schema written by EncodeUser
+const UserSchemaVersion = 1
+
+// User event types
+const (
+	// TypeUserRegistered is published when an account is created, by sign-up, invitation
+	// or provisioning
+	TypeUserRegistered = "user.registered"
+	// TypeUserEmailVerified is published when a user proves they own their email address
+	TypeUserEmailVerified = "user.email_verified"
+)
+
+// ErrInvalidUserEvent is returned for user events that can't be decoded or break the
+// schema
+var ErrInvalidUserEvent = errors.New("invalid user event")
+
+// UserEvent is an event about an account
+type UserEvent struct {
+	SchemaVersion int `json:"schema_version"`
+	// EventID identifies the event so consumers can skip redeliveries
+	EventID string `json:"event_id"`
+	Type    string `json:"type"`
+	UserID  string `json:"user_id"`
+	Email   string `json:"email"`
+	// EmailVerified is whether the user proved they own Email. Accounts that sign up
+	// verify it later, with a TypeUserEmailVerified event.
+	EmailVerified bool      `json:"email_verified"`
+	Timestamp     time.Time `json:"timestamp"`
+	// TenantID is the tenant the user belongs to, empty for the default tenant
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+// Validate checks that a user event follows the current schema
+func (e *UserEvent) Validate() error {
+	if e.SchemaVersion != UserSchemaVersion {
+		return fmt.Errorf("%w: schema version %d, want %d", ErrInvalidUserEvent, e.SchemaVersion, UserSchemaVersion)
+	}
+	if e.EventID == "" {
+		return fmt.Errorf("%w: event ID is required", ErrInvalidUserEvent)
+	}
+	switch e.Type {
+	case TypeUserRegistered, TypeUserEmailVerified:
+	default:
+		return fmt.Errorf("%w: unknown event type %q", ErrInvalidUserEvent, e.Type)
+	}
+	if e.UserID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidUserEvent)
+	}
+	if e.Email == "" {
+		return fmt.Errorf("%w: email is required", ErrInvalidUserEvent)
+	}
+	if e.Timestamp.IsZero() {
+		return fmt.Errorf("%w: timestamp is required", ErrInvalidUserEvent)
+	}
+	if e.Type == TypeUserEmailVerified && !e.EmailVerified {
+		return fmt.Errorf("%w: email verified events must have the email verified", ErrInvalidUserEvent)
+	}
+	return nil
+}
+
+// EncodeUser validates a user event and encodes it for publishing
+func EncodeUser(e *UserEvent) ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// DecodeUser decodes and validates a consumed user event. Events written with a newer
+// schema are rejected with ErrUnsupportedVersion.
+func DecodeUser(data []byte) (*UserEvent, error) {
+	var event UserEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserEvent, err)
+	}
+	if event.SchemaVersion > UserSchemaVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, event.SchemaVersion)
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
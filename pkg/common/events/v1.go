@@ -0,0 +1,144 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// v1Actions maps the action of version 1 upload, deletion, download, version and
+// privacy change events, which carried no type, to event types
+var v1Actions = map[string]string{
+	"upload":          TypeFileUploaded,
+	"delete":          TypeFileDeleted,
+	"download":        TypeFileDownloaded,
+	"version_created": TypeFileVersioned,
+	"privacy_change":  TypeFilePrivacyChanged,
+}
+
+// fileEventV1 is a version 1 file event. Share events carried their type and owner, with
+// metadata as an object holding the recipient and permission; the other events carried
+// an action, user and status, with metadata as a JSON string.
+type fileEventV1 struct {
+	EventID   string          `json:"event_id"`
+	Type      string          `json:"type"`
+	Action    string          `json:"action"`
+	FileID    string          `json:"file_id"`
+	FileName  string          `json:"file_name"`
+	OwnerID   string          `json:"owner_id"`
+	UserID    string          `json:"user_id"`
+	Status    string          `json:"status"`
+	Success   *bool           `json:"success"`
+	Error     string          `json:"error_reason"`
+	Timestamp string          `json:"timestamp"`
+	Metadata  json.RawMessage `json:"metadata"`
+
+	FileSize    int64  `json:"file_size"`
+	ContentType string `json:"content_type"`
+	Version     int    `json:"version"`
+	StoragePath string `json:"storage_path"`
+	Checksum    string `json:"checksum"`
+	IsPrivate   *bool  `json:"is_private"`
+}
+
+// decodeV1 decodes a version 1 event and upgrades it to the current schema
+func decodeV1(data []byte) (*FileEvent, error) {
+	var old fileEventV1
+	if err := json.Unmarshal(data, &old); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	event := &FileEvent{
+		SchemaVersion: SchemaVersion,
+		EventID:       old.EventID,
+		Type:          old.Type,
+		FileID:        old.FileID,
+		FileName:      old.FileName,
+		UserID:        old.UserID,
+		OwnerID:       old.OwnerID,
+		Success:       old.Status == "" || old.Status == "success",
+		ErrorReason:   old.Error,
+		FileSize:      old.FileSize,
+		ContentType:   old.ContentType,
+		Version:       old.Version,
+		StoragePath:   old.StoragePath,
+		Checksum:      old.Checksum,
+		IsPrivate:     old.IsPrivate,
+	}
+	if event.Type == "" {
+		event.Type = v1Actions[old.Action]
+	}
+	if old.Success != nil {
+		event.Success = *old.Success
+	}
+	// Only downloads were made by someone other than the owner
+	if event.UserID == "" {
+		event.UserID = old.OwnerID
+	}
+	if event.OwnerID == "" && event.Type != TypeFileDownloaded {
+		event.OwnerID = event.UserID
+	}
+
+	if old.Timestamp != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, old.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("%w: timestamp: %v", ErrInvalidEvent, err)
+		}
+		event.Timestamp = timestamp
+	}
+
+	metadata, err := v1Metadata(old.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if event.Type == TypeFileShared {
+		event.SharedWith = metadata["shared_with"]
+		event.SharedWithID = metadata["shared_with_id"]
+		event.Permission = metadata["permission"]
+		delete(metadata, "shared_with")
+		delete(metadata, "shared_with_id")
+		delete(metadata, "permission")
+	}
+	if len(metadata) > 0 {
+		event.Metadata = metadata
+	}
+
+	if err := event.validate(); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// v1Metadata returns version 1 metadata, an object or a JSON string holding one, as
+// strings. Values that aren't strings are kept JSON-encoded.
+func v1Metadata(raw json.RawMessage) (map[string]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		if text == "" {
+			return nil, nil
+		}
+		raw = json.RawMessage(text)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidEvent, err)
+	}
+
+	metadata := make(map[string]string, len(fields))
+	for key, value := range fields {
+		switch v := value.(type) {
+		case string:
+			metadata[key] = v
+		case nil:
+		default:
+			encoded, _ := json.Marshal(v)
+			metadata[key] = string(encoded)
+		}
+	}
+	return metadata, nil
+}
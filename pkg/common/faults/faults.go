@@ -0,0 +1,99 @@
+// Package faults injects faults for resilience testing: latency in requests, failed
+// Kafka publishes, MinIO errors and MongoDB timeouts, so that circuit breakers, retries
+// and dead-letter paths can be exercised deliberately. It is off unless FAULTS_ENABLED
+// is set; a nil *Injector injects nothing.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+)
+
+// ErrInjected is wrapped by the errors of injected faults
+var ErrInjected = errors.New("injected fault")
+
+// Config sets how often each fault is injected. Rates are probabilities from 0 to 1.
+type Config struct {
+	// LatencyRate of requests are delayed by up to MaxLatency
+	LatencyRate float64
+	MaxLatency  time.Duration
+	// KafkaDropRate of Kafka publishes fail
+	KafkaDropRate float64
+	// MinIOErrorRate of MinIO requests get a 500 response
+	MinIOErrorRate float64
+	// MongoTimeoutRate of MongoDB commands stall until their deadline, or for
+	// MongoStall if they have none
+	MongoTimeoutRate float64
+	MongoStall       time.Duration
+}
+
+// Injector injects faults at the configured rates
+type Injector struct {
+	cfg Config
+}
+
+// New creates an injector
+func New(cfg Config) *Injector {
+	return &Injector{cfg: cfg}
+}
+
+// FromEnv creates an injector from the FAULT_* variables, or returns nil unless
+// FAULTS_ENABLED is set
+func FromEnv() *Injector {
+	if !env.Bool("FAULTS_ENABLED", false) {
+		return nil
+	}
+	return New(Config{
+		LatencyRate:      env.Float("FAULT_LATENCY_RATE", 0),
+		MaxLatency:       env.Duration("FAULT_LATENCY_MAX", 500*time.Millisecond),
+		KafkaDropRate:    env.Float("FAULT_KAFKA_DROP_RATE", 0),
+		MinIOErrorRate:   env.Float("FAULT_MINIO_ERROR_RATE", 0),
+		MongoTimeoutRate: env.Float("FAULT_MONGO_TIMEOUT_RATE", 0),
+		MongoStall:       env.Duration("FAULT_MONGO_STALL", 10*time.Second),
+	})
+}
+
+// String describes the configured faults, for logging at startup
+func (i *Injector) String() string {
+	if i == nil {
+		return "disabled"
+	}
+	return fmt.Sprintf("latency %.2f up to %s, kafka drops %.2f, minio errors %.2f, mongo timeouts %.2f",
+		i.cfg.LatencyRate, i.cfg.MaxLatency, i.cfg.KafkaDropRate, i.cfg.MinIOErrorRate, i.cfg.MongoTimeoutRate)
+}
+
+// Delay waits for a random latency at the latency rate. It returns early with the
+// context's error if ctx is done.
+func (i *Injector) Delay(ctx context.Context) error {
+	if i == nil || i.cfg.MaxLatency <= 0 || !hit(i.cfg.LatencyRate) {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(i.cfg.MaxLatency))))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DropPublish returns an error, at the Kafka drop rate, for a publisher to fail the
+// publish with instead of writing it
+func (i *Injector) DropPublish() error {
+	if i == nil || !hit(i.cfg.KafkaDropRate) {
+		return nil
+	}
+	return fmt.Errorf("%w: kafka publish dropped", ErrInjected)
+}
+
+// hit reports whether a fault injected at rate happens this time
+func hit(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
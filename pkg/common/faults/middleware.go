@@ -0,0 +1,40 @@
+package faults
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Gin returns a middleware that delays requests at the latency rate
+func (i *Injector) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := i.Delay(c.Request.Context()); err != nil {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Unary returns an interceptor that delays calls at the latency rate
+func (i *Injector) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := i.Delay(ctx); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream is Unary for streaming calls
+func (i *Injector) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := i.Delay(ss.Context()); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		return handler(srv, ss)
+	}
+}
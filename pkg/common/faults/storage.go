@@ -0,0 +1,81 @@
+package faults
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// minioErrorBody is the S3 error MinIO responds with when it fails internally
+const minioErrorBody = `<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>InternalError</Code><Message>We encountered an internal error, please try again. (injected fault)</Message></Error>`
+
+// Transport wraps the transport of a MinIO client, or http.DefaultTransport if base is
+// nil, to answer requests with 500 InternalError at the MinIO error rate. A nil injector
+// returns base as is.
+func (i *Injector) Transport(base http.RoundTripper) http.RoundTripper {
+	if i == nil || i.cfg.MinIOErrorRate <= 0 {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{injector: i, base: base}
+}
+
+type transport struct {
+	injector *Injector
+	base     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !hit(t.injector.cfg.MinIOErrorRate) {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/xml")
+	return &http.Response{
+		Status:        "500 Internal Server Error",
+		StatusCode:    http.StatusInternalServerError,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(minioErrorBody)),
+		ContentLength: int64(len(minioErrorBody)),
+		Request:       req,
+	}, nil
+}
+
+// MongoOptions returns the client options that stall MongoDB commands at the MongoDB
+// timeout rate. A stalled command with a deadline fails with a timeout once it passes;
+// one without a deadline is delayed by the stall.
+func (i *Injector) MongoOptions() *options.ClientOptions {
+	opts := options.Client()
+	if i == nil || i.cfg.MongoTimeoutRate <= 0 {
+		return opts
+	}
+
+	return opts.SetMonitor(&event.CommandMonitor{
+		Started: func(ctx context.Context, _ *event.CommandStartedEvent) {
+			if !hit(i.cfg.MongoTimeoutRate) {
+				return
+			}
+			timer := time.NewTimer(i.cfg.MongoStall)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+		},
+	})
+}
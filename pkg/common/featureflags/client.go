@@ -0,0 +1,92 @@
+package featureflags
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRefreshInterval is how often a client reloads the flags by default
+const DefaultRefreshInterval = 30 * time.Second
+
+// Client evaluates feature flags from a copy of the store refreshed in the background,
+// so checking a flag never waits on the store. Flags that don't exist, or haven't been
+// loaded, take the default the service gave them.
+type Client struct {
+	store    Store
+	refresh  time.Duration
+	defaults map[string]bool
+	logger   *logrus.Logger
+
+	mu    sync.RWMutex
+	flags map[string]*Flag
+}
+
+// NewClient creates a client of the flags in store, reloaded every refresh. defaults
+// holds the value of each flag the service checks while it doesn't exist.
+func NewClient(store Store, refresh time.Duration, defaults map[string]bool, logger *logrus.Logger) *Client {
+	if refresh <= 0 {
+		refresh = DefaultRefreshInterval
+	}
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	return &Client{
+		store:    store,
+		refresh:  refresh,
+		defaults: defaults,
+		logger:   logger,
+		flags:    make(map[string]*Flag),
+	}
+}
+
+// Enabled reports whether a flag is on for a user; userID may be empty for checks that
+// aren't made for a user
+func (c *Client) Enabled(key, userID string) bool {
+	c.mu.RLock()
+	flag, ok := c.flags[key]
+	c.mu.RUnlock()
+
+	if !ok {
+		return c.defaults[key]
+	}
+	return flag.EnabledFor(userID)
+}
+
+// Refresh reloads the flags. The flags loaded before are kept if it fails.
+func (c *Client) Refresh(ctx context.Context) error {
+	flags, err := c.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]*Flag, len(flags))
+	for _, flag := range flags {
+		loaded[flag.Key] = flag
+	}
+
+	c.mu.Lock()
+	c.flags = loaded
+	c.mu.Unlock()
+	return nil
+}
+
+// Run reloads the flags every refresh interval until ctx is cancelled
+func (c *Client) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil && ctx.Err() == nil {
+				c.logger.WithError(err).Warn("Failed to refresh feature flags, keeping the previous ones")
+			}
+		}
+	}
+}
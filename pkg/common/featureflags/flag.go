@@ -0,0 +1,74 @@
+// Package featureflags lets the services enable capabilities gradually without a
+// redeploy. Flags are kept in MongoDB, shared by every service, and are on for a
+// percentage of users and for users they are overridden for.
+package featureflags
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a flag does not exist
+	ErrNotFound = errors.New("feature flag not found")
+	// ErrInvalidFlag is returned when a flag is malformed
+	ErrInvalidFlag = errors.New("invalid feature flag")
+)
+
+var keyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// Flag is a feature flag
+type Flag struct {
+	// Key names the flag, such as "file.dedupe"
+	Key         string `bson:"_id" json:"key"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	// Enabled turns the flag on for Rollout percent of users; a disabled flag is off for
+	// everyone but the users it is overridden for
+	Enabled bool `bson:"enabled" json:"enabled"`
+	Rollout int  `bson:"rollout" json:"rollout"`
+	// Overrides turns the flag on or off for users regardless of the rollout
+	Overrides map[string]bool `bson:"overrides,omitempty" json:"overrides,omitempty"`
+	UpdatedAt time.Time       `bson:"updated_at" json:"updated_at"`
+}
+
+// Validate checks that a flag is well formed
+func (f *Flag) Validate() error {
+	if !keyPattern.MatchString(f.Key) {
+		return fmt.Errorf("%w: key must be lowercase letters, digits, '_', '.' or '-'", ErrInvalidFlag)
+	}
+	if f.Rollout < 0 || f.Rollout > 100 {
+		return fmt.Errorf("%w: rollout must be between 0 and 100", ErrInvalidFlag)
+	}
+	return nil
+}
+
+// EnabledFor reports whether the flag is on for a user. Users are placed in the rollout
+// by a hash of the flag and their ID, so raising the rollout keeps the users it was on
+// for. Without a user, the flag is only on once rolled out to everyone.
+func (f *Flag) EnabledFor(userID string) bool {
+	if enabled, ok := f.Overrides[userID]; ok && userID != "" {
+		return enabled
+	}
+	if !f.Enabled {
+		return false
+	}
+	if f.Rollout >= 100 {
+		return true
+	}
+	if userID == "" || f.Rollout <= 0 {
+		return false
+	}
+	return bucket(f.Key, userID) < f.Rollout
+}
+
+// bucket places a user in one of 100 buckets for a flag
+func bucket(key, userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(userID))
+	return int(h.Sum32() % 100)
+}
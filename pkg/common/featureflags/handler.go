@@ -0,0 +1,123 @@
+package featureflags
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+)
+
+// Handler serves the API operators manage feature flags with
+type Handler struct {
+	store Store
+}
+
+// NewHandler creates a handler managing the flags in store
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+// RegisterRoutes registers the feature flag routes under /feature-flags. The caller is
+// responsible for restricting them to operators.
+func (h *Handler) RegisterRoutes(router gin.IRouter) {
+	flags := router.Group("/feature-flags")
+	{
+		flags.GET("", h.list)
+		flags.GET("/:key", h.get)
+		flags.PUT("/:key", h.put)
+		flags.DELETE("/:key", h.delete)
+		flags.GET("/:key/evaluate", h.evaluate)
+	}
+}
+
+// list returns every flag
+// GET /feature-flags
+func (h *Handler) list(c *gin.Context) {
+	flags, err := h.store.List(c.Request.Context())
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to list feature flags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flags": flags})
+}
+
+// get returns a flag
+// GET /feature-flags/:key
+func (h *Handler) get(c *gin.Context) {
+	flag, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// put creates or replaces a flag
+// PUT /feature-flags/:key
+func (h *Handler) put(c *gin.Context) {
+	var flag Flag
+	if err := c.ShouldBindJSON(&flag); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	flag.Key = c.Param("key")
+
+	if err := h.store.Put(c.Request.Context(), &flag); err != nil {
+		if errors.Is(err, ErrInvalidFlag) {
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to save feature flag")
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// delete removes a flag, so services fall back to their default
+// DELETE /feature-flags/:key
+func (h *Handler) delete(c *gin.Context) {
+	if err := h.store.Delete(c.Request.Context(), c.Param("key")); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "Feature flag not found")
+			return
+		}
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to delete feature flag")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// evaluate reports whether a flag is on for the user_id query parameter, as the services
+// will see it once they refresh
+// GET /feature-flags/:key/evaluate?user_id=
+func (h *Handler) evaluate(c *gin.Context) {
+	flag, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	userID := c.Query("user_id")
+	c.JSON(http.StatusOK, gin.H{
+		"key":     flag.Key,
+		"user_id": userID,
+		"enabled": flag.EnabledFor(userID),
+	})
+}
+
+// find loads the flag named in the path, responding with the error if it can't
+func (h *Handler) find(c *gin.Context) (*Flag, bool) {
+	flag, err := h.store.Get(c.Request.Context(), c.Param("key"))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "Feature flag not found")
+			return nil, false
+		}
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to load feature flag")
+		return nil, false
+	}
+	return flag, true
+}
@@ -0,0 +1,96 @@
+package featureflags
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection is the MongoDB collection flags are kept in
+const Collection = "feature_flags"
+
+// Store keeps feature flags
+type Store interface {
+	List(ctx context.Context) ([]*Flag, error)
+	Get(ctx context.Context, key string) (*Flag, error)
+	Put(ctx context.Context, flag *Flag) error
+	Delete(ctx context.Context, key string) error
+}
+
+// MongoStore keeps feature flags in MongoDB
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore creates a store of the flags in db. Services sharing a database share
+// their flags.
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{collection: db.Collection(Collection)}
+}
+
+// List returns every flag, by key
+func (s *MongoStore) List(ctx context.Context) ([]*Flag, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	flags := []*Flag{}
+	if err := cursor.All(ctx, &flags); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// Get returns a flag, or ErrNotFound
+func (s *MongoStore) Get(ctx context.Context, key string) (*Flag, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var flag Flag
+	err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&flag)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// Put creates or replaces a flag
+func (s *MongoStore) Put(ctx context.Context, flag *Flag) error {
+	if err := flag.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	flag.UpdatedAt = time.Now()
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": flag.Key}, flag, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Delete removes a flag, or returns ErrNotFound
+func (s *MongoStore) Delete(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": key})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package ginmw holds the gin middlewares shared by the services.
+package ginmw
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig configures the CORS middleware
+type CORSConfig struct {
+	// AllowOrigins lists the allowed origins; "*" allows any
+	AllowOrigins []string
+	AllowMethods []string
+	// AllowHeaders lists the allowed request headers; "*" allows any the browser asks for
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response; zero leaves it to them
+	MaxAge time.Duration
+}
+
+// DefaultCORSConfig allows any origin to call the API with a bearer token
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{
+			"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization",
+			"Accept", "Origin", "Cache-Control", "X-Requested-With",
+		},
+		AllowCredentials: true,
+	}
+}
+
+// CORS returns a middleware that sets the CORS headers of responses to allowed origins
+// and answers preflight requests
+func CORS(config CORSConfig) gin.HandlerFunc {
+	anyOrigin := false
+	origins := make(map[string]bool, len(config.AllowOrigins))
+	for _, origin := range config.AllowOrigins {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "*" {
+			anyOrigin = true
+		}
+		origins[origin] = true
+	}
+	anyHeader := false
+	for _, header := range config.AllowHeaders {
+		if header == "*" {
+			anyHeader = true
+		}
+	}
+
+	methods := strings.Join(config.AllowMethods, ", ")
+	headers := strings.Join(config.AllowHeaders, ", ")
+	exposed := strings.Join(config.ExposeHeaders, ", ")
+	maxAge := ""
+	if config.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !(anyOrigin || origins[origin]) {
+			if c.Request.Method == http.MethodOptions && origin != "" {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		// Browsers reject a wildcard origin on credentialed requests, so the origin is
+		// echoed back instead
+		if anyOrigin && !config.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+		}
+		if config.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if exposed != "" {
+			header.Set("Access-Control-Expose-Headers", exposed)
+		}
+
+		if c.Request.Method != http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", methods)
+		if requested := c.GetHeader("Access-Control-Request-Headers"); anyHeader && requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		} else if headers != "" {
+			header.Set("Access-Control-Allow-Headers", headers)
+		}
+		if maxAge != "" {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
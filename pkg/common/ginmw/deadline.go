@@ -0,0 +1,75 @@
+package ginmw
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+)
+
+// TimeoutHeader carries the time a request has left, such as "2.5s", from the gateway to
+// the REST APIs of the services, as grpc-timeout does for gRPC calls
+const TimeoutHeader = "X-Request-Timeout"
+
+// Deadline returns a middleware giving each request a deadline: the budget of its route,
+// shortened to the time the caller has left if it sent TimeoutHeader. Requests whose
+// caller has no time left are rejected with 504. A nil budget, or a zero one, such as
+// for streams, leaves requests with only the caller's deadline.
+func Deadline(budget func(c *gin.Context) time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var timeout time.Duration
+		if budget != nil {
+			timeout = budget(c)
+		}
+		if left, ok := RequestTimeout(c.Request); ok {
+			if left <= 0 {
+				apierror.Abort(c, http.StatusGatewayTimeout, "deadline exceeded")
+				return
+			}
+			if timeout <= 0 || left < timeout {
+				timeout = left
+			}
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// RequestTimeout returns the time left the caller sent in TimeoutHeader, if it sent a
+// valid one
+func RequestTimeout(r *http.Request) (time.Duration, bool) {
+	value := r.Header.Get(TimeoutHeader)
+	if value == "" {
+		return 0, false
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false
+	}
+	return timeout, true
+}
+
+// SetTimeoutHeader sets TimeoutHeader on a request to another service to the time left
+// before ctx's deadline, replacing the one the caller sent. Requests without a deadline
+// are sent without the header.
+func SetTimeoutHeader(ctx context.Context, req *http.Request) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		req.Header.Del(TimeoutHeader)
+		return
+	}
+	left := time.Until(deadline).Truncate(time.Millisecond)
+	if left < 0 {
+		left = 0
+	}
+	req.Header.Set(TimeoutHeader, left.String())
+}
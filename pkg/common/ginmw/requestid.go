@@ -0,0 +1,25 @@
+package ginmw
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/grpcmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/reqctx"
+)
+
+// RequestID returns a middleware giving each request an ID: the one the caller sent in
+// apierror.RequestIDHeader, if valid, or a new one. The ID is set on the request and its
+// context, so that the requests proxied to other services carry it, and on the response,
+// where error responses include it.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(apierror.RequestIDHeader)
+		if !grpcmw.ValidRequestID(requestID) {
+			requestID = grpcmw.NewRequestID()
+		}
+		c.Request.Header.Set(apierror.RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(reqctx.WithRequestID(c.Request.Context(), requestID))
+		c.Header(apierror.RequestIDHeader, requestID)
+		c.Next()
+	}
+}
@@ -0,0 +1,23 @@
+package ginmw
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+)
+
+// BearerToken returns a middleware that rejects requests without token as their bearer
+// token, for operator APIs guarded by a shared secret
+func BearerToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package grpcmw
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryDeadline returns an interceptor that rejects calls whose deadline has already
+// passed, and gives calls without a deadline defaultTimeout, if it isn't zero, so that
+// abandoned calls don't hold resources indefinitely
+func UnaryDeadline(defaultTimeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		deadline, ok := ctx.Deadline()
+		if ok && !time.Now().Before(deadline) {
+			return nil, status.Error(codes.DeadlineExceeded, "deadline exceeded before the call started")
+		}
+		if !ok && defaultTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+			defer cancel()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamDeadline rejects streams whose deadline has already passed. Streams without a
+// deadline are left without one, as subscriptions are meant to stay open.
+func StreamDeadline() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if deadline, ok := ss.Context().Deadline(); ok && !time.Now().Before(deadline) {
+			return status.Error(codes.DeadlineExceeded, "deadline exceeded before the call started")
+		}
+		return handler(srv, ss)
+	}
+}
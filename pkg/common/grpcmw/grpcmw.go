@@ -0,0 +1,133 @@
+// Package grpcmw holds the gRPC server interceptors shared by the services, and the
+// standard chain every server installs.
+package grpcmw
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/faults"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Logger is satisfied by both the standard library's and logrus' loggers
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Authenticator authorizes calls, such as the service token interceptors
+type Authenticator interface {
+	Unary() grpc.UnaryServerInterceptor
+	Stream() grpc.StreamServerInterceptor
+}
+
+// Options configures the standard interceptor chain
+type Options struct {
+	// Service names the server in metrics
+	Service string
+	Logger  Logger
+	// Auth authorizes calls; nil accepts every call
+	Auth Authenticator
+	// DefaultTimeout is the deadline given to unary calls that arrive without one; zero
+	// leaves them without a deadline
+	DefaultTimeout time.Duration
+	// Faults delays calls for resilience testing; nil delays none
+	Faults *faults.Injector
+}
+
+// ServerOptions returns the server options installing the standard chain. Calls go
+// through panic recovery, request ID and tenant propagation, logging, metrics, deadline
+// enforcement, injected faults and authorization, in that order, so that rejected calls
+// are logged and counted too.
+func ServerOptions(opts Options) []grpc.ServerOption {
+	unary := []grpc.UnaryServerInterceptor{
+		UnaryRecovery(opts.Logger),
+		UnaryRequestID(),
+		tenant.Unary(),
+		UnaryLogging(opts.Logger),
+		UnaryMetrics(opts.Service),
+		UnaryDeadline(opts.DefaultTimeout),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		StreamRecovery(opts.Logger),
+		StreamRequestID(),
+		tenant.Stream(),
+		StreamLogging(opts.Logger),
+		StreamMetrics(opts.Service),
+		StreamDeadline(),
+	}
+	if opts.Faults != nil {
+		unary = append(unary, opts.Faults.Unary())
+		stream = append(stream, opts.Faults.Stream())
+	}
+	if opts.Auth != nil {
+		unary = append(unary, opts.Auth.Unary())
+		stream = append(stream, opts.Auth.Stream())
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
+
+// UnaryRecovery returns an interceptor that turns a panicking call into an Internal
+// error, logging the panic, instead of crashing the server
+func UnaryRecovery(logger Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Printf("panic in %s: %v\n%s", info.FullMethod, r, debug.Stack())
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecovery is UnaryRecovery for streaming calls
+func StreamRecovery(logger Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Printf("panic in %s: %v\n%s", info.FullMethod, r, debug.Stack())
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// UnaryLogging returns an interceptor that logs each call with its request ID, status
+// code and duration
+func UnaryLogging(logger Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(logger, ctx, info.FullMethod, err, time.Since(start))
+		return resp, err
+	}
+}
+
+// StreamLogging is UnaryLogging for streaming calls, logged when they end
+func StreamLogging(logger Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(logger, ss.Context(), info.FullMethod, err, time.Since(start))
+		return err
+	}
+}
+
+func logCall(logger Logger, ctx context.Context, method string, err error, duration time.Duration) {
+	code := status.Code(err)
+	if code == codes.OK {
+		logger.Printf("gRPC %s %s %s request_id=%s", method, code, duration, RequestIDFromContext(ctx))
+		return
+	}
+	logger.Printf("gRPC %s %s %s request_id=%s error=%q", method, code, duration, RequestIDFromContext(ctx), status.Convert(err).Message())
+}
@@ -0,0 +1,75 @@
+package grpcmw
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	callsStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_started_total",
+		Help: "Total number of gRPC calls started on the server",
+	}, []string{"service", "grpc_service", "grpc_method", "grpc_type"})
+	callsHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Total number of gRPC calls completed on the server, by status code",
+	}, []string{"service", "grpc_service", "grpc_method", "grpc_type", "grpc_code"})
+	callDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Duration of gRPC calls handled by the server",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "grpc_service", "grpc_method", "grpc_type"})
+)
+
+// UnaryMetrics returns an interceptor that records each call in the Prometheus metrics,
+// labelled with service
+func UnaryMetrics(service string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		grpcService, method := splitMethod(info.FullMethod)
+		callsStarted.WithLabelValues(service, grpcService, method, "unary").Inc()
+
+		resp, err := handler(ctx, req)
+
+		callsHandled.WithLabelValues(service, grpcService, method, "unary", status.Code(err).String()).Inc()
+		callDuration.WithLabelValues(service, grpcService, method, "unary").Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+}
+
+// StreamMetrics is UnaryMetrics for streaming calls
+func StreamMetrics(service string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		grpcService, method := splitMethod(info.FullMethod)
+		callType := "bidi_stream"
+		switch {
+		case info.IsServerStream && !info.IsClientStream:
+			callType = "server_stream"
+		case info.IsClientStream && !info.IsServerStream:
+			callType = "client_stream"
+		}
+		callsStarted.WithLabelValues(service, grpcService, method, callType).Inc()
+
+		err := handler(srv, ss)
+
+		callsHandled.WithLabelValues(service, grpcService, method, callType, status.Code(err).String()).Inc()
+		callDuration.WithLabelValues(service, grpcService, method, callType).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// splitMethod splits "/package.Service/Method" into its service and method names
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
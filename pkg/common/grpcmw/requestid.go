@@ -0,0 +1,94 @@
+package grpcmw
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/reqctx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDKey is the metadata key carrying the ID that correlates the logs of a request
+// across services. It is also returned in the response headers.
+const RequestIDKey = "x-request-id"
+
+// legacyRequestIDKey is the key clients used before RequestIDKey
+const legacyRequestIDKey = "request_id"
+
+// maxRequestIDLength bounds the request IDs accepted from callers
+const maxRequestIDLength = 128
+
+// RequestIDFromContext returns the ID of the request being served, or "" outside the
+// interceptor chain
+func RequestIDFromContext(ctx context.Context) string {
+	return reqctx.RequestID(ctx)
+}
+
+// UnaryRequestID returns an interceptor that gives each call the request ID sent by the
+// caller, or a new one if it sent none or an invalid one
+func UnaryRequestID() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(withRequestID(ctx), req)
+	}
+}
+
+// StreamRequestID is UnaryRequestID for streaming calls
+func StreamRequestID() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &wrappedStream{ServerStream: ss, ctx: withRequestID(ss.Context())})
+	}
+}
+
+// withRequestID stores the call's request ID in ctx, in the outgoing metadata so that
+// calls to other services carry it, and in the response headers
+func withRequestID(ctx context.Context) context.Context {
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range []string{RequestIDKey, legacyRequestIDKey} {
+			if values := md.Get(key); len(values) > 0 && ValidRequestID(values[0]) {
+				requestID = values[0]
+				break
+			}
+		}
+	}
+	if requestID == "" {
+		requestID = NewRequestID()
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, requestID))
+	ctx = metadata.AppendToOutgoingContext(ctx, RequestIDKey, requestID)
+	return reqctx.WithRequestID(ctx, requestID)
+}
+
+// ValidRequestID reports whether a caller's request ID is short printable ASCII, so that
+// it can't forge log lines
+func ValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// wrappedStream replaces the context of a stream
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *wrappedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,27 @@
+package grpcmw
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// GracefulStop stops server from accepting calls and waits for the calls in progress,
+// such as uploads, to finish. When ctx is done first, such as with long-lived streams
+// still open, the remaining calls are cancelled. It reports whether every call finished.
+func GracefulStop(ctx context.Context, server *grpc.Server) bool {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return true
+	case <-ctx.Done():
+		server.Stop()
+		<-stopped
+		return false
+	}
+}
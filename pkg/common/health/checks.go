@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// ErrNotConfigured is reported for a dependency the service started without
+var ErrNotConfigured = errors.New("not configured")
+
+// GRPC checks that a client connection to another service is, or can be, established
+func GRPC(conn *grpc.ClientConn) Check {
+	return func(ctx context.Context) error {
+		if conn == nil {
+			return ErrNotConfigured
+		}
+		for {
+			state := conn.GetState()
+			switch state {
+			case connectivity.Ready:
+				return nil
+			case connectivity.Idle:
+				conn.Connect()
+			case connectivity.Shutdown:
+				return errors.New("connection closed")
+			}
+			if !conn.WaitForStateChange(ctx, state) {
+				return fmt.Errorf("connection %s", state)
+			}
+		}
+	}
+}
+
+// TCP checks that at least one of addrs, such as the Kafka brokers, accepts connections
+func TCP(addrs ...string) Check {
+	return func(ctx context.Context) error {
+		if len(addrs) == 0 {
+			return ErrNotConfigured
+		}
+
+		var dialer net.Dialer
+		var err error
+		for _, addr := range addrs {
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				conn.Close()
+				return nil
+			}
+		}
+		return err
+	}
+}
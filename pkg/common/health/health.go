@@ -0,0 +1,180 @@
+// Package health serves the health, liveness and readiness endpoints of the services.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkTimeout bounds each dependency check
+const checkTimeout = 3 * time.Second
+
+// Dependency statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check reports whether a dependency of the service is usable
+type Check func(ctx context.Context) error
+
+// dependency is a checked dependency, and whether the service can serve without it
+type dependency struct {
+	check    Check
+	critical bool
+}
+
+// DependencyStatus is the outcome of a dependency check
+type DependencyStatus struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	// LatencyMs is how long the check took
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Handler reports the health of a service. The service is unhealthy, and not ready, with
+// a 503 response, if a critical dependency is down; it is degraded, and still ready, if
+// only optional ones are.
+type Handler struct {
+	service      string
+	version      string
+	dependencies map[string]dependency
+	details      map[string]func() interface{}
+	draining     atomic.Bool
+}
+
+// New creates a health handler for a service
+func New(service, version string) *Handler {
+	return &Handler{
+		service:      service,
+		version:      version,
+		dependencies: make(map[string]dependency),
+		details:      make(map[string]func() interface{}),
+	}
+}
+
+// AddCheck adds a check of a dependency the service can't serve without, reported
+// under name
+func (h *Handler) AddCheck(name string, check Check) *Handler {
+	h.dependencies[name] = dependency{check: check, critical: true}
+	return h
+}
+
+// AddOptionalCheck adds a check of a dependency the service degrades without, such as
+// a cache, reported under name
+func (h *Handler) AddOptionalCheck(name string, check Check) *Handler {
+	h.dependencies[name] = dependency{check: check}
+	return h
+}
+
+// AddDetail adds a value computed on each request to the response, such as a count of
+// connections
+func (h *Handler) AddDetail(name string, detail func() interface{}) *Handler {
+	h.details[name] = detail
+	return h
+}
+
+// SetDraining fails the readiness probe from now on, so that load balancers stop sending
+// requests to a service shutting down while it finishes the ones in progress
+func (h *Handler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Register serves the health report at /health, the liveness probe at /live and the
+// readiness probe at /ready
+func (h *Handler) Register(router gin.IRoutes) {
+	router.GET("/health", h.Handle)
+	router.GET("/live", h.Live)
+	router.GET("/ready", h.Ready)
+}
+
+// Handle serves the health report, with the status of each dependency
+func (h *Handler) Handle(c *gin.Context) {
+	h.Ready(c)
+}
+
+// Live serves the liveness probe. It only reports that the process serves requests, so
+// that an outage of a dependency doesn't get the service restarted.
+func (h *Handler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, h.response("alive"))
+}
+
+// Ready serves the readiness probe, failing while a critical dependency is down or the
+// service is draining
+func (h *Handler) Ready(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, h.response("draining"))
+		return
+	}
+
+	response := h.response("healthy")
+	for name, detail := range h.details {
+		response[name] = detail()
+	}
+
+	code := http.StatusOK
+	if len(h.dependencies) > 0 {
+		results := h.runChecks(c.Request.Context())
+		for name, result := range results {
+			if result.Status == StatusUp {
+				continue
+			}
+			if h.dependencies[name].critical {
+				response["status"] = "unhealthy"
+				code = http.StatusServiceUnavailable
+			} else if code == http.StatusOK {
+				response["status"] = "degraded"
+			}
+		}
+		response["checks"] = results
+	}
+
+	c.JSON(code, response)
+}
+
+// response is the body common to the endpoints
+func (h *Handler) response(status string) gin.H {
+	response := gin.H{
+		"status":  status,
+		"service": h.service,
+		"time":    time.Now().UTC().Format(time.RFC3339),
+	}
+	if h.version != "" {
+		response["version"] = h.version
+	}
+	return response
+}
+
+// runChecks runs the checks concurrently and returns the status of each dependency
+func (h *Handler) runChecks(ctx context.Context) map[string]DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]DependencyStatus, len(h.dependencies))
+	for name, dep := range h.dependencies {
+		wg.Add(1)
+		go func(name string, dep dependency) {
+			defer wg.Done()
+			start := time.Now()
+			result := DependencyStatus{Status: StatusUp, Critical: dep.critical}
+			if err := dep.check(ctx); err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+			result.LatencyMs = time.Since(start).Milliseconds()
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, dep)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,49 @@
+// Package jwtauth validates the HMAC-signed tokens issued by the auth-service.
+package jwtauth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrExpiredToken    = errors.New("token has expired")
+	ErrInvalidAudience = errors.New("invalid token audience")
+	ErrRevokedToken    = errors.New("token has been revoked")
+)
+
+// BearerToken returns the token of an Authorization header value, with or without the
+// "Bearer " prefix
+func BearerToken(header string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(header), "Bearer "))
+}
+
+// Parse validates a token signed with secret using an HMAC method, and decodes its
+// claims into claims. It returns ErrExpiredToken, ErrInvalidAudience or ErrInvalidToken
+// if the token is rejected.
+func Parse(tokenString string, secret []byte, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	tokenString = BearerToken(tokenString)
+	if tokenString == "" {
+		return ErrInvalidToken
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return secret, nil
+	}, opts...)
+
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrExpiredToken
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrInvalidAudience
+	case err != nil || !token.Valid:
+		return ErrInvalidToken
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func signUserToken(t *testing.T, claims *UserClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestValidatorValidateToken(t *testing.T) {
+	expiresAt := jwt.NewNumericDate(time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		claims  *UserClaims
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			claims: &UserClaims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: expiresAt}},
+		},
+		{
+			name:    "missing user",
+			claims:  &UserClaims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: expiresAt}},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "missing expiry",
+			claims:  &UserClaims{UserID: "user-1"},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "expired",
+			claims: &UserClaims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			}},
+			wantErr: ErrExpiredToken,
+		},
+	}
+
+	validator := NewValidator(testSecret)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := validator.ValidateToken("Bearer " + signUserToken(t, tt.claims))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && claims.UserID != tt.claims.UserID {
+				t.Errorf("ValidateToken() user = %q, want %q", claims.UserID, tt.claims.UserID)
+			}
+		})
+	}
+}
+
+func TestUserClaimsIsEmailVerified(t *testing.T) {
+	verified, unverified := true, false
+
+	if !(&UserClaims{}).IsEmailVerified() {
+		t.Error("tokens without the claim should count as verified")
+	}
+	if !(&UserClaims{EmailVerified: &verified}).IsEmailVerified() {
+		t.Error("verified tokens should count as verified")
+	}
+	if (&UserClaims{EmailVerified: &unverified}).IsEmailVerified() {
+		t.Error("unverified tokens should not count as verified")
+	}
+}
+
+func TestCheckRevocation(t *testing.T) {
+	issuedAt := time.Now().Truncate(time.Second)
+	claims := &UserClaims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(issuedAt)}}
+
+	tests := []struct {
+		name      string
+		revokedAt time.Time
+		wantErr   error
+	}{
+		{name: "never revoked"},
+		{name: "revoked before issue", revokedAt: issuedAt.Add(-time.Minute)},
+		{name: "revoked in the second of issue", revokedAt: issuedAt.Add(500 * time.Millisecond)},
+		{name: "revoked after issue", revokedAt: issuedAt.Add(time.Second), wantErr: ErrRevokedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := func(ctx context.Context, userID string) (time.Time, error) {
+				if userID != claims.UserID {
+					t.Errorf("lookup of user %q, want %q", userID, claims.UserID)
+				}
+				return tt.revokedAt, nil
+			}
+			if err := CheckRevocation(context.Background(), claims, lookup); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckRevocation() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Package kafkametrics exposes the stats of the services' Kafka readers and writers as
+// Prometheus metrics: the consumers' lag, messages, errors and rebalances, and the
+// producers' messages, errors, retries and write latency.
+package kafkametrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/segmentio/kafka-go"
+)
+
+// statsInterval is how often the stats are read into the metrics
+const statsInterval = 15 * time.Second
+
+var (
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "Number of messages the consumer is behind the end of its topic",
+	}, []string{"service", "topic", "group"})
+	consumerMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_messages_total",
+		Help: "Total number of messages read by the consumer",
+	}, []string{"service", "topic", "group"})
+	consumerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_errors_total",
+		Help: "Total number of errors of the consumer's reads and commits",
+	}, []string{"service", "topic", "group"})
+	consumerRebalances = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_rebalances_total",
+		Help: "Total number of rebalances of the consumer's group the consumer took part in",
+	}, []string{"service", "topic", "group"})
+
+	producerMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_producer_messages_total",
+		Help: "Total number of messages written by the producer",
+	}, []string{"service", "topic"})
+	producerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_producer_errors_total",
+		Help: "Total number of the producer's writes that failed",
+	}, []string{"service", "topic"})
+	producerRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_producer_retries_total",
+		Help: "Total number of the producer's writes that were retried",
+	}, []string{"service", "topic"})
+	producerWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_producer_writes_total",
+		Help: "Total number of batches written by the producer",
+	}, []string{"service", "topic"})
+	producerWriteSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_producer_write_seconds_total",
+		Help: "Total time the producer spent writing batches; divided by kafka_producer_writes_total, the average write latency",
+	}, []string{"service", "topic"})
+)
+
+// WatchReader records the stats of a consumer's reader in the metrics, labelled with
+// service, until ctx is done. Reading the stats resets the reader's counters, so a reader
+// is only watched once.
+func WatchReader(ctx context.Context, service string, reader *kafka.Reader) {
+	config := reader.Config()
+	topic := config.Topic
+	if topic == "" {
+		topic = strings.Join(config.GroupTopics, ",")
+	}
+	labels := []string{service, topic, config.GroupID}
+
+	watch(ctx, func() {
+		stats := reader.Stats()
+		consumerLag.WithLabelValues(labels...).Set(float64(stats.Lag))
+		consumerMessages.WithLabelValues(labels...).Add(float64(stats.Messages))
+		consumerErrors.WithLabelValues(labels...).Add(float64(stats.Errors))
+		consumerRebalances.WithLabelValues(labels...).Add(float64(stats.Rebalances))
+	})
+}
+
+// WatchWriter records the stats of a producer's writer in the metrics, labelled with
+// service, until ctx is done. Reading the stats resets the writer's counters, so a writer
+// is only watched once.
+func WatchWriter(ctx context.Context, service string, writer *kafka.Writer) {
+	labels := []string{service, writer.Topic}
+
+	watch(ctx, func() {
+		stats := writer.Stats()
+		producerMessages.WithLabelValues(labels...).Add(float64(stats.Messages))
+		producerErrors.WithLabelValues(labels...).Add(float64(stats.Errors))
+		producerRetries.WithLabelValues(labels...).Add(float64(stats.Retries))
+		producerWrites.WithLabelValues(labels...).Add(float64(stats.WriteTime.Count))
+		producerWriteSeconds.WithLabelValues(labels...).Add(stats.WriteTime.Sum.Seconds())
+	})
+}
+
+// watch records the stats every statsInterval until ctx is done, and once more then so
+// that the last ones are not lost
+func watch(ctx context.Context, record func()) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			record()
+			return
+		case <-ticker.C:
+			record()
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Package migrate applies versioned MongoDB migrations, such as index builds, schema
+// changes and data backfills, once per database. Each service lists its migrations in
+// version order and runs them on startup, or with its migrate subcommand.
+//
+// Applied migrations are recorded in the schema_migrations collection, per service,
+// since the services share a database. Replicas starting together take turns: a lease in
+// schema_migration_locks lets one of them migrate while the others wait for it.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultTimeout bounds the migrations a service applies on startup
+	DefaultTimeout = 10 * time.Minute
+
+	// MigrationsCollection records the applied migrations
+	MigrationsCollection = "schema_migrations"
+	// LocksCollection holds the lease of the replica migrating each service
+	LocksCollection = "schema_migration_locks"
+
+	// leaseDuration is how long a lease lasts unless it is renewed. A replica that dies
+	// while migrating holds up the others for at most this long.
+	leaseDuration = time.Minute
+	// lockRetryInterval is how often a replica waiting for the lease tries to take it
+	lockRetryInterval = 2 * time.Second
+)
+
+// Migration is a change to the database. Up must be safe to run again after it failed
+// part way, since the migration is only recorded once Up succeeds.
+type Migration struct {
+	// Version orders the migrations of a service; versions are never reused
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// Status is a migration and when it was applied, if it was
+type Status struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+// record is an applied migration
+type record struct {
+	Service     string    `bson:"service"`
+	Version     int       `bson:"version"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+	DurationMS  int64     `bson:"duration_ms"`
+}
+
+// Runner applies the migrations of a service
+type Runner struct {
+	db         *mongo.Database
+	service    string
+	migrations []Migration
+	owner      string
+	logger     *logrus.Logger
+}
+
+// New creates a runner of a service's migrations. It panics if two migrations share a
+// version, which is a programming error.
+func New(db *mongo.Database, service string, migrations []Migration, logger *logrus.Logger) *Runner {
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			panic(fmt.Sprintf("migrate: %s has two migrations with version %d", service, sorted[i].Version))
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	return &Runner{
+		db:         db,
+		service:    service,
+		migrations: sorted,
+		owner:      fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano()),
+		logger:     logger,
+	}
+}
+
+// Run applies the migrations that weren't applied yet, in version order, and returns how
+// many it applied. It waits for other replicas migrating the service to finish first.
+func (r *Runner) Run(ctx context.Context) (int, error) {
+	if err := r.ensureIndexes(ctx); err != nil {
+		return 0, err
+	}
+	if err := r.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.unlock()
+	leaseCtx, stopRenewing := context.WithCancel(ctx)
+	defer stopRenewing()
+	go r.keepLease(leaseCtx)
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range r.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		logger := r.logger.WithFields(logrus.Fields{
+			"service":     r.service,
+			"version":     migration.Version,
+			"description": migration.Description,
+		})
+		logger.Info("Applying migration")
+
+		start := time.Now()
+		if err := migration.Up(ctx, r.db); err != nil {
+			return count, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Description, err)
+		}
+		_, err := r.db.Collection(MigrationsCollection).InsertOne(ctx, record{
+			Service:     r.service,
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().UTC(),
+			DurationMS:  time.Since(start).Milliseconds(),
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+		logger.WithField("duration", time.Since(start)).Info("Migration applied")
+		count++
+	}
+	return count, nil
+}
+
+// Status returns the migrations of the service and when they were applied
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(r.migrations))
+	for _, migration := range r.migrations {
+		status := Status{Version: migration.Version, Description: migration.Description}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Command runs a service's migrate subcommand: "up", the default, applies the pending
+// migrations, and "status" lists the migrations and when they were applied
+func (r *Runner) Command(ctx context.Context, args []string, out io.Writer) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		count, err := r.Run(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Applied %d migrations of %s\n", count, r.service)
+		return nil
+	case "status":
+		statuses, err := r.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%4d  %-28s  %s\n", status.Version, applied, status.Description)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up or status", command)
+	}
+}
+
+// applied returns when each applied migration of the service was applied, by version
+func (r *Runner) applied(ctx context.Context) (map[int]time.Time, error) {
+	cursor, err := r.db.Collection(MigrationsCollection).Find(ctx, bson.M{"service": r.service})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	applied := make(map[int]time.Time, len(records))
+	for _, record := range records {
+		applied[record.Version] = record.AppliedAt
+	}
+	return applied, nil
+}
+
+// ensureIndexes creates the index that keeps a migration from being recorded twice
+func (r *Runner) ensureIndexes(ctx context.Context) error {
+	_, err := r.db.Collection(MigrationsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "service", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create migration indexes: %w", err)
+	}
+	return nil
+}
+
+// lock takes the service's lease, waiting until ctx is done for a replica holding it to
+// release it or let it expire
+func (r *Runner) lock(ctx context.Context) error {
+	for {
+		err := r.renew(ctx)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		r.logger.WithField("service", r.service).Info("Waiting for another replica to finish migrating")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the migration lock: %w", ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// renew takes or extends the lease. It fails with a duplicate key error while another
+// replica holds an unexpired lease.
+func (r *Runner) renew(ctx context.Context) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id": r.service,
+		"$or": bson.A{
+			bson.M{"owner": r.owner},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": r.owner, "expires_at": now.Add(leaseDuration)}}
+	_, err := r.db.Collection(LocksCollection).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	return err
+}
+
+// keepLease renews the lease until ctx is done, so that it doesn't expire during a long
+// migration
+func (r *Runner) keepLease(ctx context.Context) {
+	ticker := time.NewTicker(leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.renew(ctx); err != nil && ctx.Err() == nil {
+				r.logger.WithError(err).WithField("service", r.service).Warn("Failed to renew the migration lock")
+			}
+		}
+	}
+}
+
+// unlock releases the lease
+func (r *Runner) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection(LocksCollection).DeleteOne(ctx, bson.M{"_id": r.service, "owner": r.owner})
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		r.logger.WithError(err).WithField("service", r.service).Warn("Failed to release the migration lock")
+	}
+}
@@ -0,0 +1,106 @@
+// Package poolmetrics exposes the connections the services hold to their dependencies as
+// Prometheus metrics: the MongoDB driver's connection pools and the state of the gRPC
+// client connections, so that exhausted pools and unreachable services show on the
+// dashboards.
+package poolmetrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+var (
+	mongoConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_pool_connections",
+		Help: "Number of connections in the MongoDB driver's pool of each server, open or checked out",
+	}, []string{"service", "address", "state"})
+	mongoCheckouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_pool_checkouts_total",
+		Help: "Total number of connection checkouts from the MongoDB driver's pool, by result",
+	}, []string{"service", "result"})
+	mongoCheckoutsWaiting = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_pool_checkouts_waiting",
+		Help: "Number of operations waiting to check a connection out of the MongoDB driver's pool",
+	}, []string{"service"})
+	mongoPoolCleared = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_pool_cleared_total",
+		Help: "Total number of times the MongoDB driver cleared the pool of a server after a network error",
+	}, []string{"service", "address"})
+
+	clientConnectionState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "grpc_client_connection_state",
+		Help: "State of the gRPC client connection to each target: 1 for its current state, 0 for the others",
+	}, []string{"target", "state"})
+	clientConnectionTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_connection_transitions_total",
+		Help: "Total number of times the gRPC client connection to each target entered each state",
+	}, []string{"target", "state"})
+)
+
+// MongoOptions returns the client options recording the MongoDB driver's connection pools
+// in the metrics, labelled with service. They are applied with the other options, such as
+// injected faults, when connecting.
+func MongoOptions(service string) *options.ClientOptions {
+	return options.Client().SetPoolMonitor(&event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				mongoConnections.WithLabelValues(service, e.Address, "open").Inc()
+			case event.ConnectionClosed:
+				mongoConnections.WithLabelValues(service, e.Address, "open").Dec()
+			case event.GetStarted:
+				mongoCheckoutsWaiting.WithLabelValues(service).Inc()
+			case event.GetSucceeded:
+				mongoCheckoutsWaiting.WithLabelValues(service).Dec()
+				mongoConnections.WithLabelValues(service, e.Address, "in_use").Inc()
+				mongoCheckouts.WithLabelValues(service, "succeeded").Inc()
+			case event.GetFailed:
+				// The reason is timeout, connectionError or poolClosed
+				mongoCheckoutsWaiting.WithLabelValues(service).Dec()
+				mongoCheckouts.WithLabelValues(service, e.Reason).Inc()
+			case event.ConnectionReturned:
+				mongoConnections.WithLabelValues(service, e.Address, "in_use").Dec()
+			case event.PoolCleared:
+				mongoPoolCleared.WithLabelValues(service, e.Address).Inc()
+			}
+		},
+	})
+}
+
+// connectivityStates are the states a gRPC client connection goes through
+var connectivityStates = []connectivity.State{
+	connectivity.Idle,
+	connectivity.Connecting,
+	connectivity.Ready,
+	connectivity.TransientFailure,
+	connectivity.Shutdown,
+}
+
+// WatchClientConn records the state of a gRPC client connection in the metrics as it
+// changes, until the connection is closed. target names the service it connects to, such
+// as auth-service.
+func WatchClientConn(target string, conn *grpc.ClientConn) {
+	go func() {
+		for {
+			state := conn.GetState()
+			for _, s := range connectivityStates {
+				value := 0.0
+				if s == state {
+					value = 1
+				}
+				clientConnectionState.WithLabelValues(target, s.String()).Set(value)
+			}
+			clientConnectionTransitions.WithLabelValues(target, state.String()).Inc()
+			if state == connectivity.Shutdown {
+				return
+			}
+			conn.WaitForStateChange(context.Background(), state)
+		}
+	}()
+}
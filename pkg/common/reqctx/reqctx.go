@@ -0,0 +1,81 @@
+// Package reqctx carries what a request is served for in its context, under typed keys:
+// the caller's user ID, organization and roles, the request ID and the tenant. The
+// middlewares that decide them store them once, and the code below reads them from the
+// context.Context it is given, without depending on the framework the request came
+// through.
+package reqctx
+
+import "context"
+
+type key int
+
+const (
+	userIDKey key = iota
+	orgIDKey
+	rolesKey
+	requestIDKey
+	tenantIDKey
+)
+
+// WithUserID returns a context served for user userID
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserID returns the user ctx is served for, or "" for anonymous requests
+func UserID(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey).(string)
+	return userID
+}
+
+// WithOrg returns a context served for a caller acting in organization orgID, with roles
+// in it
+func WithOrg(ctx context.Context, orgID string, roles ...string) context.Context {
+	ctx = context.WithValue(ctx, orgIDKey, orgID)
+	return context.WithValue(ctx, rolesKey, roles)
+}
+
+// OrgID returns the organization the caller acts in, or "" outside of one
+func OrgID(ctx context.Context) string {
+	orgID, _ := ctx.Value(orgIDKey).(string)
+	return orgID
+}
+
+// Roles returns the caller's roles in the organization it acts in
+func Roles(ctx context.Context) []string {
+	roles, _ := ctx.Value(rolesKey).([]string)
+	return roles
+}
+
+// HasRole reports whether the caller has role in the organization it acts in
+func HasRole(ctx context.Context, role string) bool {
+	for _, r := range Roles(ctx) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRequestID returns a context of the request with ID requestID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside of a request
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithTenantID returns a context served for tenant tenantID. Services use tenant.WithID,
+// which also passes the tenant on to the services they call.
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDKey, tenantID)
+}
+
+// TenantID returns the tenant ctx is served for. ok is false outside of a request.
+func TenantID(ctx context.Context) (tenantID string, ok bool) {
+	tenantID, ok = ctx.Value(tenantIDKey).(string)
+	return tenantID, ok
+}
@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mask replaces secret values in logs
+const Mask = "[REDACTED]"
+
+// minMaskedLength is the length below which values are not masked, so that flags and
+// placeholders in variables named like secrets don't garble unrelated log lines
+const minMaskedLength = 6
+
+// sensitiveSuffixes name the variables whose values are masked in logs even if they
+// don't refer to a secret
+var sensitiveSuffixes = []string{"SECRET", "PASSWORD", "TOKEN", "_KEY"}
+
+var (
+	registryMu sync.RWMutex
+	registered = make(map[string]struct{})
+	replacer   = strings.NewReplacer()
+)
+
+// Register adds values to the secrets masked in logs
+func Register(values ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	added := false
+	for _, value := range values {
+		if len(value) < minMaskedLength {
+			continue
+		}
+		if _, ok := registered[value]; !ok {
+			registered[value] = struct{}{}
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// Longer values go first so that a secret containing another is masked whole
+	all := make([]string, 0, len(registered))
+	for value := range registered {
+		all = append(all, value)
+	}
+	sort.Slice(all, func(i, j int) bool { return len(all[i]) > len(all[j]) })
+	pairs := make([]string, 0, 2*len(all))
+	for _, value := range all {
+		pairs = append(pairs, value, Mask)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact masks the registered secrets in s
+func Redact(s string) string {
+	registryMu.RLock()
+	r := replacer
+	registryMu.RUnlock()
+	return r.Replace(s)
+}
+
+// sensitive reports whether a variable is named like a secret
+func sensitive(name string) bool {
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hook masks the registered secrets in the messages and fields of logrus entries
+type Hook struct{}
+
+func (Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = Redact(entry.Message)
+	for key, value := range entry.Data {
+		switch value := value.(type) {
+		case string:
+			entry.Data[key] = Redact(value)
+		case error:
+			if message := value.Error(); Redact(message) != message {
+				entry.Data[key] = Redact(message)
+			}
+		}
+	}
+	return nil
+}
+
+// Writer masks the registered secrets in what is written to w. Each write is masked on
+// its own, so it suits writers receiving whole lines, such as the standard logger's.
+func Writer(w io.Writer) io.Writer {
+	return &redactingWriter{w: w}
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	masked := Redact(string(p))
+	if masked == string(p) {
+		return r.w.Write(p)
+	}
+	if _, err := io.WriteString(r.w, masked); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
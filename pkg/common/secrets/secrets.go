@@ -0,0 +1,217 @@
+// Package secrets reads the secrets of a service, such as the JWT secret and the SMTP and
+// payment provider keys, from a secret store. A variable whose value is "secret:<ref>"
+// is resolved at startup by the provider SECRETS_PROVIDER names: "env" (the default)
+// reads ref as another variable, "vault" reads a HashiCorp Vault KV v2 secret and "aws"
+// an AWS Secrets Manager secret. Secret values are masked in logs.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+)
+
+// refPrefix marks the variables whose value refers to a secret
+const refPrefix = "secret:"
+
+// retryInterval is how long a cached secret is kept before fetching it again after a
+// failed refresh
+const retryInterval = 30 * time.Second
+
+// ErrNotFound is returned for secrets the store does not have
+var ErrNotFound = errors.New("secret not found")
+
+// Provider fetches secrets from a secret store
+type Provider interface {
+	// Name returns the provider name used in logs
+	Name() string
+	// Fetch returns the current value of the secret ref refers to
+	Fetch(ctx context.Context, ref string) (string, error)
+}
+
+// Manager fetches secrets from a provider and caches them. A secret older than the TTL
+// is fetched again on its next use, so rotated values are picked up lazily; if that
+// fails, the cached value is used until a fetch succeeds.
+type Manager struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+	// refs are the references of the variables resolved by Load, by variable name
+	refs map[string]string
+}
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// NewManager creates a manager caching the secrets of provider for ttl, or until the
+// process exits if ttl is 0
+func NewManager(provider Provider, ttl time.Duration) *Manager {
+	return &Manager{
+		provider: provider,
+		ttl:      ttl,
+		cache:    make(map[string]cachedSecret),
+		refs:     make(map[string]string),
+	}
+}
+
+// Load creates a manager from the SECRETS_* variables and replaces the value of every
+// variable referring to a secret with the secret. It masks the resolved values, and
+// those of variables named like secrets, in logs, including the standard logger's.
+func Load(ctx context.Context) (*Manager, error) {
+	provider, err := providerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	m := NewManager(provider, env.Duration("SECRETS_TTL", 5*time.Minute))
+
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		ref, ok := strings.CutPrefix(value, refPrefix)
+		if !ok {
+			if sensitive(name) {
+				Register(value)
+			}
+			continue
+		}
+
+		resolved, err := m.Get(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+		}
+		if err := os.Setenv(name, resolved); err != nil {
+			return nil, err
+		}
+		m.refs[name] = ref
+	}
+
+	log.SetOutput(Writer(log.Writer()))
+	return m, nil
+}
+
+// Provider returns the name of the manager's provider
+func (m *Manager) Provider() string {
+	return m.provider.Name()
+}
+
+// Get returns the value of the secret ref refers to, fetching it if it is not cached or
+// older than the TTL
+func (m *Manager) Get(ctx context.Context, ref string) (string, error) {
+	now := time.Now()
+	m.mu.Lock()
+	entry, ok := m.cache[ref]
+	m.mu.Unlock()
+	if ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+		return entry.value, nil
+	}
+
+	value, err := m.provider.Fetch(ctx, ref)
+	if err != nil {
+		if !ok {
+			return "", fmt.Errorf("failed to fetch secret %q from %s: %w", ref, m.provider.Name(), err)
+		}
+		// Keep the value that was last fetched rather than failing its users
+		log.Printf("Warning: failed to refresh secret %q from %s, using the cached value: %v", ref, m.provider.Name(), err)
+		entry.expires = now.Add(retryInterval)
+	} else {
+		Register(value)
+		entry = cachedSecret{value: value}
+		if m.ttl > 0 {
+			entry.expires = now.Add(m.ttl)
+		}
+	}
+
+	m.mu.Lock()
+	m.cache[ref] = entry
+	m.mu.Unlock()
+	return entry.value, nil
+}
+
+// Lookup returns the secret the variable name referred to when Load resolved it, or nil
+// if it did not refer to a secret. A nil manager returns nil.
+func (m *Manager) Lookup(name string) *Secret {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ref, ok := m.refs[name]
+	if !ok {
+		return nil
+	}
+	return &Secret{manager: m, ref: ref}
+}
+
+// Secret is a secret kept in a secret store, for the users of a secret that may be
+// rotated while the service runs
+type Secret struct {
+	manager *Manager
+	ref     string
+}
+
+// Value returns the current value of the secret
+func (s *Secret) Value(ctx context.Context) (string, error) {
+	return s.manager.Get(ctx, s.ref)
+}
+
+// providerFromEnv creates the provider SECRETS_PROVIDER names
+func providerFromEnv() (Provider, error) {
+	switch name := env.String("SECRETS_PROVIDER", "env"); name {
+	case "env":
+		return Env{}, nil
+	case "vault":
+		return NewVault(VaultConfig{
+			Address:   env.String("VAULT_ADDR", "http://localhost:8200"),
+			Token:     env.String("VAULT_TOKEN", ""),
+			Namespace: env.String("VAULT_NAMESPACE", ""),
+			Mount:     env.String("VAULT_MOUNT", "secret"),
+		})
+	case "aws":
+		return NewAWS(AWSConfig{
+			Region:          env.String("AWS_REGION", ""),
+			AccessKeyID:     env.String("AWS_ACCESS_KEY_ID", ""),
+			SecretAccessKey: env.String("AWS_SECRET_ACCESS_KEY", ""),
+			SessionToken:    env.String("AWS_SESSION_TOKEN", ""),
+			Endpoint:        env.String("AWS_SECRETS_MANAGER_ENDPOINT", ""),
+		})
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q", name)
+	}
+}
+
+// Env reads secrets from environment variables, the reference being the variable name
+type Env struct{}
+
+// Name returns the provider name
+func (Env) Name() string {
+	return "env"
+}
+
+// Fetch returns the value of the variable ref
+func (Env) Fetch(_ context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// splitRef splits a "name#key" reference into the name of a secret and the key of the
+// value within it, which is defaultKey if the reference has none
+func splitRef(ref, defaultKey string) (string, string) {
+	name, key, ok := strings.Cut(ref, "#")
+	if !ok || key == "" {
+		key = defaultKey
+	}
+	return name, key
+}
@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultConfig configures the HashiCorp Vault provider
+type VaultConfig struct {
+	// Address is the URL of the Vault server
+	Address string
+	Token   string
+	// Namespace is the Vault Enterprise namespace, if any
+	Namespace string
+	// Mount is the path the KV v2 secrets engine is mounted at
+	Mount string
+}
+
+// Vault reads secrets from a HashiCorp Vault KV v2 secrets engine. References are
+// "path#key", the key of the value within the secret at path defaulting to "value".
+type Vault struct {
+	cfg        VaultConfig
+	httpClient *http.Client
+}
+
+// NewVault creates a Vault provider
+func NewVault(cfg VaultConfig) (*Vault, error) {
+	if cfg.Address == "" || cfg.Token == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN are required for the vault secrets provider")
+	}
+	return &Vault{
+		cfg: cfg,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+// Name returns the provider name
+func (v *Vault) Name() string {
+	return "vault"
+}
+
+// Fetch reads the latest version of a secret
+func (v *Vault) Fetch(ctx context.Context, ref string) (string, error) {
+	path, key := splitRef(ref, "value")
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(v.cfg.Address, "/"),
+		strings.Trim(v.cfg.Mount, "/"), strings.TrimLeft(path, "/"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.cfg.Token)
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrNotFound
+	default:
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		return "", fmt.Errorf("vault request failed with status %d: %s", resp.StatusCode, strings.Join(errResp.Errors, "; "))
+	}
+
+	var result struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse vault response: %w", err)
+	}
+
+	value, ok := result.Data.Data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: no key %q in %s", ErrNotFound, key, path)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("key %q in %s is not a string", key, path)
+	}
+	return s, nil
+}
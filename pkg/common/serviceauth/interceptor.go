@@ -0,0 +1,104 @@
+package serviceauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Interceptor rejects gRPC calls that do not carry a valid service token
+type Interceptor struct {
+	validator *Validator
+	exempt    map[string]bool
+	optional  map[string]bool
+}
+
+// NewInterceptor creates an interceptor; exemptMethods are full gRPC method names
+// that may be called without a service token
+func NewInterceptor(validator *Validator, exemptMethods ...string) *Interceptor {
+	exempt := make(map[string]bool, len(exemptMethods))
+	for _, method := range exemptMethods {
+		exempt[method] = true
+	}
+
+	return &Interceptor{
+		validator: validator,
+		exempt:    exempt,
+		optional:  make(map[string]bool),
+	}
+}
+
+// SetOptional lets methods be called without a service token. A token that is sent is
+// still validated, so handlers can tell services from callers they authenticate another
+// way.
+func (i *Interceptor) SetOptional(methods ...string) {
+	for _, method := range methods {
+		i.optional[method] = true
+	}
+}
+
+// Unary returns a unary server interceptor enforcing service authentication
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := i.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns a stream server interceptor enforcing service authentication
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (i *Interceptor) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if i.exempt[fullMethod] || strings.HasPrefix(fullMethod, "/grpc.reflection.") || strings.HasPrefix(fullMethod, "/grpc.health.") {
+		return ctx, nil
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing service token")
+	}
+
+	values := md.Get(MetadataKey)
+	if len(values) == 0 || values[0] == "" {
+		if i.optional[fullMethod] {
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, "missing service token")
+	}
+
+	claims, err := i.validator.ValidateToken(strings.TrimPrefix(values[0], "Bearer "))
+	if err != nil {
+		if errors.Is(err, ErrExpiredToken) {
+			return nil, status.Error(codes.Unauthenticated, "service token has expired")
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid service token")
+	}
+
+	return WithCaller(ctx, claims.ClientID), nil
+}
+
+// authorizedStream carries the context holding the caller to stream handlers
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
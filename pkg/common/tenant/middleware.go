@@ -0,0 +1,80 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Gin returns a middleware serving each request for the tenant of its X-Tenant-ID
+// header. Requests without the header are left outside of a tenant, like internal
+// calls; the API gateway always sets it. Invalid IDs are rejected with 400.
+func Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		values, ok := c.Request.Header[http.CanonicalHeaderKey(Header)]
+		if !ok || len(values) == 0 {
+			c.Next()
+			return
+		}
+		if !Valid(values[0]) {
+			apierror.Abort(c, http.StatusBadRequest, "invalid tenant ID")
+			return
+		}
+		c.Request = c.Request.WithContext(WithID(c.Request.Context(), values[0]))
+		c.Next()
+	}
+}
+
+// Unary returns an interceptor serving each call for the tenant of its x-tenant-id
+// metadata. Calls without it are left outside of a tenant.
+func Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := fromIncoming(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream is Unary for streaming calls
+func Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := fromIncoming(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &tenantStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func fromIncoming(ctx context.Context) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	values := md.Get(MetadataKey)
+	if len(values) == 0 {
+		return ctx, nil
+	}
+	if !Valid(values[0]) {
+		return nil, status.Error(codes.InvalidArgument, "invalid tenant ID")
+	}
+	return WithID(ctx, values[0]), nil
+}
+
+// tenantStream replaces the context of a stream
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,99 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		header     []string
+		wantStatus int
+		wantID     string
+		wantOK     bool
+	}{
+		{"no header", nil, http.StatusOK, "", false},
+		{"default tenant", []string{""}, http.StatusOK, "", true},
+		{"tenant", []string{"acme"}, http.StatusOK, "acme", true},
+		{"invalid tenant", []string{"Acme"}, http.StatusBadRequest, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotID string
+			var gotOK, served bool
+			router := gin.New()
+			router.Use(Gin())
+			router.GET("/", func(c *gin.Context) {
+				served = true
+				gotID, gotOK = FromContext(c.Request.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != nil {
+				req.Header[http.CanonicalHeaderKey(Header)] = tt.header
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if served != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("handler served = %v", served)
+			}
+			if gotID != tt.wantID || gotOK != tt.wantOK {
+				t.Errorf("tenant = %q, %v, want %q, %v", gotID, gotOK, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestUnary(t *testing.T) {
+	tests := []struct {
+		name     string
+		md       metadata.MD
+		wantCode codes.Code
+		wantID   string
+		wantOK   bool
+	}{
+		{"no metadata", nil, codes.OK, "", false},
+		{"no tenant", metadata.Pairs("user_id", "u1"), codes.OK, "", false},
+		{"default tenant", metadata.Pairs(MetadataKey, ""), codes.OK, "", true},
+		{"tenant", metadata.Pairs(MetadataKey, "acme"), codes.OK, "acme", true},
+		{"invalid tenant", metadata.Pairs(MetadataKey, "acme corp"), codes.InvalidArgument, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+
+			var gotID string
+			var gotOK bool
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				gotID, gotOK = FromContext(ctx)
+				return nil, nil
+			}
+			_, err := Unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, handler)
+
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %v, want %v", code, tt.wantCode)
+			}
+			if gotID != tt.wantID || gotOK != tt.wantOK {
+				t.Errorf("tenant = %q, %v, want %q, %v", gotID, gotOK, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Package tenant carries the tenant a request is served for across the services, so that
+// one deployment can serve isolated organizations. The API gateway decides the tenant of
+// each request, from the caller's token or API key, and passes it on in the x-tenant-id
+// header and gRPC metadata; services keep it in the request context, store it in the
+// documents they create and scope their queries to it. Clients only name their tenant
+// themselves when signing in or registering.
+//
+// The empty ID is the default tenant, which single-tenant deployments and data written
+// before tenants existed belong to. Its documents have no tenant_id field.
+package tenant
+
+import (
+	"context"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/reqctx"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Header is the HTTP header carrying the tenant ID
+	Header = "X-Tenant-ID"
+	// MetadataKey is the gRPC metadata key carrying the tenant ID
+	MetadataKey = "x-tenant-id"
+	// Field is the field of MongoDB documents holding the tenant ID
+	Field = "tenant_id"
+)
+
+// maxIDLength bounds tenant IDs
+const maxIDLength = 63
+
+// WithID returns a context serving tenant id. The ID is also added to the outgoing gRPC
+// metadata, so that calls to other services are served for the same tenant.
+func WithID(ctx context.Context, id string) context.Context {
+	ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, id)
+	return reqctx.WithTenantID(ctx, id)
+}
+
+// FromContext returns the tenant ctx is served for. ok is false outside of a request,
+// such as in background jobs, which work across tenants.
+func FromContext(ctx context.Context) (id string, ok bool) {
+	return reqctx.TenantID(ctx)
+}
+
+// ID returns the tenant ctx is served for, or the default tenant outside of a request
+func ID(ctx context.Context) string {
+	id, _ := FromContext(ctx)
+	return id
+}
+
+// Valid reports whether id is a valid tenant ID: the default tenant, or up to 63
+// lowercase letters, digits and hyphens
+func Valid(id string) bool {
+	if len(id) > maxIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Scope restricts a MongoDB filter to the documents of the tenant ctx is served for,
+// and returns it. Outside of a request the filter is left as is, for background jobs and
+// internal calls; requests through the API gateway always carry a tenant, the default
+// one included.
+func Scope(ctx context.Context, filter bson.M) bson.M {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return filter
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter[Field] = Match(id)
+	return filter
+}
+
+// Match returns the value of the tenant field matching the documents of tenant id.
+// Documents of the default tenant have no tenant field.
+func Match(id string) interface{} {
+	if id == "" {
+		return nil
+	}
+	return id
+}
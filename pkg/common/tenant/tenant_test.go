@@ -0,0 +1,126 @@
+package tenant
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"default tenant", "", true},
+		{"letters, digits and hyphens", "acme-42", true},
+		{"longest", strings.Repeat("a", maxIDLength), true},
+		{"too long", strings.Repeat("a", maxIDLength+1), false},
+		{"uppercase", "Acme", false},
+		{"underscore", "acme_corp", false},
+		{"space", "acme corp", false},
+		{"operator", "$ne", false},
+		{"non-ASCII", "acmé", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Valid(tt.id); got != tt.want {
+				t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want interface{}
+	}{
+		{"default tenant matches documents without the field", "", nil},
+		{"tenant matches its ID", "acme", "acme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.id); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		filter bson.M
+		want   bson.M
+	}{
+		{
+			name:   "outside of a request",
+			ctx:    context.Background(),
+			filter: bson.M{"email": "a@example.com"},
+			want:   bson.M{"email": "a@example.com"},
+		},
+		{
+			name:   "outside of a request with a nil filter",
+			ctx:    context.Background(),
+			filter: nil,
+			want:   nil,
+		},
+		{
+			name:   "default tenant",
+			ctx:    WithID(context.Background(), ""),
+			filter: bson.M{"email": "a@example.com"},
+			want:   bson.M{"email": "a@example.com", Field: nil},
+		},
+		{
+			name:   "tenant",
+			ctx:    WithID(context.Background(), "acme"),
+			filter: bson.M{"email": "a@example.com"},
+			want:   bson.M{"email": "a@example.com", Field: "acme"},
+		},
+		{
+			name:   "tenant with a nil filter",
+			ctx:    WithID(context.Background(), "acme"),
+			filter: nil,
+			want:   bson.M{Field: "acme"},
+		},
+		{
+			name:   "tenant replaces one in the filter",
+			ctx:    WithID(context.Background(), "acme"),
+			filter: bson.M{Field: "other"},
+			want:   bson.M{Field: "acme"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Scope(tt.ctx, tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithID(t *testing.T) {
+	ctx := WithID(context.Background(), "acme")
+
+	if id, ok := FromContext(ctx); !ok || id != "acme" {
+		t.Errorf("FromContext() = %q, %v, want %q, true", id, ok, "acme")
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if got := md.Get(MetadataKey); !reflect.DeepEqual(got, []string{"acme"}) {
+		t.Errorf("outgoing %s = %v, want [acme]", MetadataKey, got)
+	}
+
+	if id, ok := FromContext(context.Background()); ok || id != "" {
+		t.Errorf("FromContext(Background) = %q, %v, want \"\", false", id, ok)
+	}
+	if id := ID(context.Background()); id != "" {
+		t.Errorf("ID(Background) = %q, want the default tenant", id)
+	}
+}
@@ -12,17 +12,17 @@ echo "Building Docker images with tag: $TAG"
 
 # Build Auth Service
 echo "Building Auth Service..."
-docker build -t $REGISTRY/auth-service:$TAG ./services/auth-service
+docker build -t $REGISTRY/auth-service:$TAG -f services/auth-service/Dockerfile .
 docker push $REGISTRY/auth-service:$TAG
 
 # Build File Service
 echo "Building File Service..."
-docker build -t $REGISTRY/file-service:$TAG ./services/file-service
+docker build -t $REGISTRY/file-service:$TAG -f services/file-service/Dockerfile .
 docker push $REGISTRY/file-service:$TAG
 
 # Build Notification Service
 echo "Building Notification Service..."
-docker build -t $REGISTRY/notification-service:$TAG ./services/notification-service
+docker build -t $REGISTRY/notification-service:$TAG -f services/notification-service/Dockerfile .
 docker push $REGISTRY/notification-service:$TAG
 
 # Build Frontend
@@ -4,7 +4,11 @@ Write-Host "Generating gRPC code from proto files..." -ForegroundColor Cyan
 
 # Create output directories
 New-Item -ItemType Directory -Force -Path "..\services\auth-service\pkg\pb\auth\v1" | Out-Null
+New-Item -ItemType Directory -Force -Path "..\services\auth-service\pkg\pb\notification\v1" | Out-Null
+New-Item -ItemType Directory -Force -Path "..\services\auth-service\pkg\pb\file\v1" | Out-Null
+New-Item -ItemType Directory -Force -Path "..\services\notification-service\pkg\pb\auth\v1" | Out-Null
 New-Item -ItemType Directory -Force -Path "..\services\file-service\pkg\pb\file\v1" | Out-Null
+New-Item -ItemType Directory -Force -Path "..\services\file-service\pkg\pb\auth\v1" | Out-Null
 New-Item -ItemType Directory -Force -Path "..\services\notification-service\pkg\pb\notification\v1" | Out-Null
 New-Item -ItemType Directory -Force -Path "..\services\billing-service\pkg\pb\billing\v1" | Out-Null
 
@@ -66,6 +70,46 @@ Write-Host "Generating Notification Service proto..."
   --grpc-gateway_opt=generate_unbound_methods=true `
   ..\proto\notification\v1\notification.proto
 
+# Generate Notification client for Auth Service (password reset and verification emails)
+Write-Host "Generating Notification client for Auth Service..."
+& $ProtocPath -I ..\proto `
+  -I ..\third_party\googleapis `
+  --go_out=..\services\auth-service\pkg\pb `
+  --go_opt=paths=source_relative `
+  --go-grpc_out=..\services\auth-service\pkg\pb `
+  --go-grpc_opt=paths=source_relative `
+  ..\proto\notification\v1\notification.proto
+
+# Generate File client for Auth Service (uploaded avatars)
+Write-Host "Generating File client for Auth Service..."
+& $ProtocPath -I ..\proto `
+  -I ..\third_party\googleapis `
+  --go_out=..\services\auth-service\pkg\pb `
+  --go_opt=paths=source_relative `
+  --go-grpc_out=..\services\auth-service\pkg\pb `
+  --go-grpc_opt=paths=source_relative `
+  ..\proto\file\v1\file.proto
+
+# Generate Auth client for Notification Service (user profiles for templates)
+Write-Host "Generating Auth client for Notification Service..."
+& $ProtocPath -I ..\proto `
+  -I ..\third_party\googleapis `
+  --go_out=..\services\notification-service\pkg\pb `
+  --go_opt=paths=source_relative `
+  --go-grpc_out=..\services\notification-service\pkg\pb `
+  --go-grpc_opt=paths=source_relative `
+  ..\proto\auth\v1\auth.proto
+
+# Generate Auth client for File Service (share recipient lookup)
+Write-Host "Generating Auth client for File Service..."
+& $ProtocPath -I ..\proto `
+  -I ..\third_party\googleapis `
+  --go_out=..\services\file-service\pkg\pb `
+  --go_opt=paths=source_relative `
+  --go-grpc_out=..\services\file-service\pkg\pb `
+  --go-grpc_opt=paths=source_relative `
+  ..\proto\auth\v1\auth.proto
+
 # Generate Billing Service proto
 Write-Host "Generating Billing Service proto..."
 & $ProtocPath -I ..\proto `
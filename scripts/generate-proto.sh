@@ -8,8 +8,16 @@ echo "Generating gRPC code from proto files..."
 
 # Create output directories
 mkdir -p services/auth-service/pkg/pb/auth/v1
+mkdir -p services/auth-service/pkg/pb/notification/v1
+mkdir -p services/auth-service/pkg/pb/file/v1
 mkdir -p services/file-service/pkg/pb/file/v1
+mkdir -p services/file-service/pkg/pb/auth/v1
 mkdir -p services/notification-service/pkg/pb/notification/v1
+mkdir -p services/notification-service/pkg/pb/auth/v1
+mkdir -p services/billing-service/pkg/pb/billing/v1
+mkdir -p services/billing-service/pkg/pb/auth/v1
+mkdir -p services/billing-service/pkg/pb/notification/v1
+mkdir -p services/api-gateway/pkg/pb/billing/v1
 
 # Install required tools if not present
 echo "Checking for required tools..."
@@ -54,5 +62,81 @@ protoc -I proto \
   --grpc-gateway_opt=generate_unbound_methods=true \
   proto/notification/v1/notification.proto
 
+# Generate Billing Service proto
+echo "Generating Billing Service proto..."
+protoc -I proto \
+  -I third_party/googleapis \
+  --go_out=services/billing-service/pkg/pb \
+  --go_opt=paths=source_relative \
+  --go-grpc_out=services/billing-service/pkg/pb \
+  --go-grpc_opt=paths=source_relative \
+  --grpc-gateway_out=services/billing-service/pkg/pb \
+  --grpc-gateway_opt=paths=source_relative \
+  --grpc-gateway_opt=generate_unbound_methods=true \
+  proto/billing/v1/billing.proto
+
+# Generate Auth and Notification clients for Billing Service (invoice emails)
+echo "Generating Auth and Notification clients for Billing Service..."
+protoc -I proto \
+  -I third_party/googleapis \
+  --go_out=services/billing-service/pkg/pb \
+  --go_opt=paths=source_relative \
+  --go-grpc_out=services/billing-service/pkg/pb \
+  --go-grpc_opt=paths=source_relative \
+  proto/auth/v1/auth.proto \
+  proto/notification/v1/notification.proto
+
+# Generate Billing gateway for API Gateway
+echo "Generating Billing gateway for API Gateway..."
+protoc -I proto \
+  -I third_party/googleapis \
+  --go_out=services/api-gateway/pkg/pb \
+  --go_opt=paths=source_relative \
+  --go-grpc_out=services/api-gateway/pkg/pb \
+  --go-grpc_opt=paths=source_relative \
+  --grpc-gateway_out=services/api-gateway/pkg/pb \
+  --grpc-gateway_opt=paths=source_relative \
+  proto/billing/v1/billing.proto
+
+# Generate Notification client for Auth Service (password reset and verification emails)
+echo "Generating Notification client for Auth Service..."
+protoc -I proto \
+  -I third_party/googleapis \
+  --go_out=services/auth-service/pkg/pb \
+  --go_opt=paths=source_relative \
+  --go-grpc_out=services/auth-service/pkg/pb \
+  --go-grpc_opt=paths=source_relative \
+  proto/notification/v1/notification.proto
+
+# Generate File client for Auth Service (uploaded avatars)
+echo "Generating File client for Auth Service..."
+protoc -I proto \
+  -I third_party/googleapis \
+  --go_out=services/auth-service/pkg/pb \
+  --go_opt=paths=source_relative \
+  --go-grpc_out=services/auth-service/pkg/pb \
+  --go-grpc_opt=paths=source_relative \
+  proto/file/v1/file.proto
+
+# Generate Auth client for Notification Service (user profiles for templates)
+echo "Generating Auth client for Notification Service..."
+protoc -I proto \
+  -I third_party/googleapis \
+  --go_out=services/notification-service/pkg/pb \
+  --go_opt=paths=source_relative \
+  --go-grpc_out=services/notification-service/pkg/pb \
+  --go-grpc_opt=paths=source_relative \
+  proto/auth/v1/auth.proto
+
+# Generate Auth client for File Service (share recipient lookup)
+echo "Generating Auth client for File Service..."
+protoc -I proto \
+  -I third_party/googleapis \
+  --go_out=services/file-service/pkg/pb \
+  --go_opt=paths=source_relative \
+  --go-grpc_out=services/file-service/pkg/pb \
+  --go-grpc_opt=paths=source_relative \
+  proto/auth/v1/auth.proto
+
 echo "Proto generation complete!"
 
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,19 +17,34 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
-
-	// billingv1 "github.com/yourusername/distributed-file-sharing/services/api-gateway/pkg/pb/billing/v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/grpcmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/reqctx"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/secrets"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/serviceauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+	"github.com/yourusername/distributed-file-sharing/services/api-gateway/internal/analytics"
 	"github.com/yourusername/distributed-file-sharing/services/api-gateway/internal/config"
 	"github.com/yourusername/distributed-file-sharing/services/api-gateway/internal/middleware"
 	authv1 "github.com/yourusername/distributed-file-sharing/services/api-gateway/pkg/pb/auth/v1"
+	billingv1 "github.com/yourusername/distributed-file-sharing/services/api-gateway/pkg/pb/billing/v1"
 	filev1 "github.com/yourusername/distributed-file-sharing/services/api-gateway/pkg/pb/file/v1"
 	notificationv1 "github.com/yourusername/distributed-file-sharing/services/api-gateway/pkg/pb/notification/v1"
 )
@@ -44,6 +62,7 @@ type FileResponse struct {
 	Status      string `json:"status"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
+	IsFavorite  bool   `json:"is_favorite"`
 }
 
 // convertProtoFileToResponse converts a protobuf file to FileResponse with RFC3339 timestamps
@@ -81,11 +100,13 @@ func convertProtoFileToResponse(protoFile *filev1.File) FileResponse {
 		Status:      status,
 		CreatedAt:   createdAt,
 		UpdatedAt:   updatedAt,
+		IsFavorite:  protoFile.IsFavorite,
 	}
 }
 
-// proxyToBillingService proxies requests to the billing service
-func proxyToBillingService(c *gin.Context, cfg *config.Config) {
+// proxyToBillingREST proxies requests to the billing service REST API, for endpoints
+// the gRPC gateway can't serve: raw payment webhooks, invoice PDFs and plan management
+func proxyToBillingREST(c *gin.Context, cfg *config.Config) {
 	// Get the path after /api/v1/billing
 	path := c.Param("path")
 
@@ -103,10 +124,10 @@ func proxyToBillingService(c *gin.Context, cfg *config.Config) {
 
 	log.Printf("Proxying billing request to: %s", targetURL)
 
-	// Create a new request
-	req, err := http.NewRequest(c.Request.Method, targetURL, c.Request.Body)
+	// Create a new request, passing on the request's deadline
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to create request")
 		return
 	}
 
@@ -116,13 +137,15 @@ func proxyToBillingService(c *gin.Context, cfg *config.Config) {
 			req.Header.Add(key, value)
 		}
 	}
+	ginmw.SetTimeoutHeader(req.Context(), req)
 
-	// Make the request
+	// Make the request. Webhook bodies are forwarded untouched, since billing service
+	// verifies the provider's signature over them.
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Failed to reach billing service: %v", err)
-		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reach billing service"})
+		writeProxyError(c, http.StatusBadGateway, "Failed to reach billing service", err)
 		return
 	}
 	defer resp.Body.Close()
@@ -172,10 +195,10 @@ func proxyToFileService(c *gin.Context, cfg *config.Config) {
 
 	log.Printf("Proxying file service request to: %s", targetURL)
 
-	// Create a new request
-	req, err := http.NewRequest(c.Request.Method, targetURL, c.Request.Body)
+	// Create a new request, passing on the request's deadline
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to create request")
 		return
 	}
 
@@ -185,13 +208,14 @@ func proxyToFileService(c *gin.Context, cfg *config.Config) {
 			req.Header.Add(key, value)
 		}
 	}
+	ginmw.SetTimeoutHeader(req.Context(), req)
 
 	// Make the request
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Failed to reach file service: %v", err)
-		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reach file service"})
+		writeProxyError(c, http.StatusBadGateway, "Failed to reach file service", err)
 		return
 	}
 	defer resp.Body.Close()
@@ -223,7 +247,7 @@ func proxyToFileService(c *gin.Context, cfg *config.Config) {
 }
 
 // handleListFiles handles the ListFiles API endpoint with proper query parameter parsing
-func handleListFiles(c *gin.Context, cfg *config.Config) {
+func handleListFiles(c *gin.Context, cfg *config.Config, tokenSource *serviceauth.TokenSource) {
 	// Extract query parameters
 	pageStr := c.Query("page")
 	limitStr := c.Query("limit")
@@ -246,16 +270,10 @@ func handleListFiles(c *gin.Context, cfg *config.Config) {
 		}
 	}
 
-	// Get user_id from context (set by auth middleware)
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user_id not found in context"})
-		return
-	}
-
-	userIDStr, ok := userID.(string)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id in context"})
+	// Get user_id from the request context (set by auth middleware)
+	userIDStr := reqctx.UserID(c.Request.Context())
+	if userIDStr == "" {
+		apierror.Abort(c, http.StatusUnauthorized, "user_id not found in context")
 		return
 	}
 
@@ -267,9 +285,10 @@ func handleListFiles(c *gin.Context, cfg *config.Config) {
 	}
 
 	// Create gRPC connection to file service
-	conn, err := grpc.Dial(cfg.FileServiceGRPC, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	dialOpts := serviceDialOptions([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, tokenSource, "file-service")
+	conn, err := grpc.Dial(cfg.FileServiceGRPC, dialOpts...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to connect to file service"})
+		apierror.Abort(c, http.StatusInternalServerError, "failed to connect to file service")
 		return
 	}
 	defer conn.Close()
@@ -277,16 +296,26 @@ func handleListFiles(c *gin.Context, cfg *config.Config) {
 	// Create gRPC client
 	client := filev1.NewFileServiceClient(conn)
 
-	// Create context with metadata
-	ctx := context.Background()
+	// Create context with metadata, keeping the request's deadline
+	ctx := c.Request.Context()
+	tenantID, _ := reqctx.TenantID(ctx)
 	md := metadata.New(nil)
 	md.Set("user_id", userIDStr)
+	md.Set(tenant.MetadataKey, tenantID)
+	if orgID := reqctx.OrgID(ctx); orgID != "" {
+		md.Set("org_id", orgID)
+		md.Set("org_role", strings.Join(reqctx.Roles(ctx), ","))
+	}
 	ctx = metadata.NewOutgoingContext(ctx, md)
 
 	// Call gRPC service
 	resp, err := client.ListFiles(ctx, req)
+	if status.Code(err) == codes.DeadlineExceeded {
+		apierror.Abort(c, http.StatusGatewayTimeout, "deadline exceeded")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("gRPC call failed: %s", err.Error())})
+		apierror.Abort(c, http.StatusInternalServerError, fmt.Sprintf("gRPC call failed: %s", err.Error()))
 		return
 	}
 
@@ -307,6 +336,12 @@ func handleListFiles(c *gin.Context, cfg *config.Config) {
 
 func main() {
 	// Load configuration
+	if err := env.Load(); err != nil {
+		log.Fatalf("Failed to load environment file: %v", err)
+	}
+	if _, err := secrets.Load(context.Background()); err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
 	cfg := config.Load()
 
 	// Create gRPC-Gateway mux with custom metadata annotator
@@ -333,11 +368,61 @@ func main() {
 	// Use background context for gRPC connections to keep them alive
 	ctx := context.Background()
 
+	// Internal services only accept calls carrying a service token issued by the auth-service
+	var tokenSource *serviceauth.TokenSource
+	if cfg.ServiceAuthEnabled {
+		var err error
+		tokenSource, err = newServiceTokenSource(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize service token source: %v", err)
+		}
+		log.Printf("Service-to-service authentication enabled (client: %s)", cfg.ServiceClientID)
+	}
+
+	// Requests made with impersonation tokens are audited by the auth-service
+	impersonationRecorder, err := newImpersonationRecorder(cfg, tokenSource)
+	if err != nil {
+		log.Fatalf("Failed to initialize impersonation recorder: %v", err)
+	}
+	middleware.SetImpersonationRecorder(impersonationRecorder)
+
+	// File endpoints also accept the API keys of plans with API access, whose calls are
+	// metered by the billing service
+	apiKeyVerifier, apiUsageReporter, err := newAPIKeyClients(cfg, tokenSource)
+	if err != nil {
+		log.Fatalf("Failed to initialize API keys: %v", err)
+	}
+	middleware.SetAPIKeys(apiKeyVerifier, apiUsageReporter)
+	apiUsageCtx, stopAPIUsage := context.WithCancel(context.Background())
+	defer stopAPIUsage()
+	go middleware.RunAPIUsageReporter(apiUsageCtx, time.Duration(cfg.APIUsageReportInterval)*time.Second)
+
+	// API keys are held to request rate and monthly transfer quotas, counted in Redis
+	var redisClient *redis.Client
+	var apiKeyQuotas *middleware.APIKeyQuotas
+	if cfg.RedisEnabled {
+		redisClient, err = newRedisClient(cfg)
+		if err != nil {
+			log.Printf("Warning: failed to connect to Redis, API key quotas are disabled: %v", err)
+		} else {
+			defer redisClient.Close()
+			apiKeyQuotas = middleware.NewAPIKeyQuotas(redisClient, cfg.APIKeyRateLimit, cfg.APIKeyMonthlyTransfer, cfg.APIKeySuspension)
+			middleware.SetAPIKeyQuotas(apiKeyQuotas)
+		}
+	}
+
+	// Tokens of users who signed out everywhere or reset their password are rejected
+	revocationLookup, err := newRevocationLookup(cfg, tokenSource)
+	if err != nil {
+		log.Fatalf("Failed to initialize token revocation checks: %v", err)
+	}
+	middleware.SetTokenRevocations(middleware.NewTokenRevocations(redisClient, revocationLookup, cfg.TokenRevocationCacheTTL))
+
 	// Register Auth Service with retry logic
 	log.Printf("Connecting to Auth Service at %s", cfg.AuthServiceGRPC)
 	var authErr error
 	for i := 0; i < 3; i++ {
-		authErr = authv1.RegisterAuthServiceHandlerFromEndpoint(ctx, gwmux, cfg.AuthServiceGRPC, opts)
+		authErr = authv1.RegisterAuthServiceHandlerFromEndpoint(ctx, gwmux, cfg.AuthServiceGRPC, serviceDialOptions(opts, tokenSource, "auth-service"))
 		if authErr == nil {
 			log.Printf("Successfully connected to Auth Service")
 			break
@@ -353,7 +438,7 @@ func main() {
 	log.Printf("Connecting to File Service at %s", cfg.FileServiceGRPC)
 	var fileErr error
 	for i := 0; i < 3; i++ {
-		fileErr = filev1.RegisterFileServiceHandlerFromEndpoint(ctx, gwmux, cfg.FileServiceGRPC, opts)
+		fileErr = filev1.RegisterFileServiceHandlerFromEndpoint(ctx, gwmux, cfg.FileServiceGRPC, serviceDialOptions(opts, tokenSource, "file-service"))
 		if fileErr == nil {
 			log.Printf("Successfully connected to File Service")
 			break
@@ -369,7 +454,7 @@ func main() {
 	log.Printf("Connecting to Notification Service at %s", cfg.NotificationServiceGRPC)
 	var notifErr error
 	for i := 0; i < 3; i++ {
-		notifErr = notificationv1.RegisterNotificationServiceHandlerFromEndpoint(ctx, gwmux, cfg.NotificationServiceGRPC, opts)
+		notifErr = notificationv1.RegisterNotificationServiceHandlerFromEndpoint(ctx, gwmux, cfg.NotificationServiceGRPC, serviceDialOptions(opts, tokenSource, "notification-service"))
 		if notifErr == nil {
 			log.Printf("Successfully connected to Notification Service")
 			break
@@ -381,17 +466,39 @@ func main() {
 		log.Printf("Warning: Could not connect to Notification Service after 3 attempts: %v", notifErr)
 	}
 
-	// Register Billing Service (temporarily disabled for Docker build)
-	// log.Printf("Connecting to Billing Service at %s", cfg.BillingServiceGRPC)
-	// if err := billingv1.RegisterBillingServiceHandlerFromEndpoint(ctx, gwmux, cfg.BillingServiceGRPC, opts); err != nil {
-	// 	log.Fatalf("Failed to register billing service: %v", err)
-	// }
+	// Billing responses keep the proto field names, which the frontend's billing client
+	// expects
+	billingMux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(customMatcher),
+		runtime.WithErrorHandler(customErrorHandler),
+		runtime.WithMetadata(metadataAnnotator),
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+	)
+
+	// Register Billing Service with retry logic
+	log.Printf("Connecting to Billing Service at %s", cfg.BillingServiceGRPC)
+	var billingErr error
+	for i := 0; i < 3; i++ {
+		billingErr = billingv1.RegisterBillingServiceHandlerFromEndpoint(ctx, billingMux, cfg.BillingServiceGRPC, serviceDialOptions(opts, tokenSource, "billing-service"))
+		if billingErr == nil {
+			log.Printf("Successfully connected to Billing Service")
+			break
+		}
+		log.Printf("Failed to connect to Billing Service (attempt %d/3): %v", i+1, billingErr)
+		time.Sleep(2 * time.Second)
+	}
+	if billingErr != nil {
+		log.Printf("Warning: Could not connect to Billing Service after 3 attempts: %v", billingErr)
+	}
 
 	// Create Gin router
 	router := gin.Default()
 
 	// Setup CORS
-	router.Use(cors.New(cors.Config{
+	router.Use(ginmw.CORS(ginmw.CORSConfig{
 		AllowOrigins:     []string{"*"}, // Allow all origins for development
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD"},
 		AllowHeaders:     []string{"*"}, // Allow all headers
@@ -400,33 +507,69 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
-	// Health check endpoint
-	router.GET("/health", healthCheckHandler)
+	// Every request has an ID, passed on to the services and returned in the error
+	// responses
+	router.Use(ginmw.RequestID())
+
+	// Every request has its route's time budget, or less if the caller asked, to complete;
+	// the deadline is passed on to the services through gRPC and the REST proxies
+	router.Use(ginmw.Deadline(func(c *gin.Context) time.Duration {
+		return cfg.RouteTimeout(c.FullPath())
+	}))
+
+	// Every request is served for the tenant of the caller
+	router.Use(middleware.TenantMiddleware(cfg.JWTSecret))
+
+	// Health, liveness and readiness probes. The backends are reported but optional, so
+	// that an outage of one doesn't take the gateway out of service for the others. The
+	// state of their connections is exposed in the metrics.
+	healthHandler := health.New("api-gateway", "")
+	for _, backend := range []struct{ name, addr string }{
+		{"auth-service", cfg.AuthServiceGRPC},
+		{"file-service", cfg.FileServiceGRPC},
+		{"notification-service", cfg.NotificationServiceGRPC},
+		{"billing-service", cfg.BillingServiceGRPC},
+	} {
+		conn, err := grpc.Dial(backend.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Printf("Warning: Could not create health check connection to %s: %v", backend.name, err)
+			continue
+		}
+		defer conn.Close()
+		poolmetrics.WatchClientConn(backend.name, conn)
+		healthHandler.AddOptionalCheck(backend.name, health.GRPC(conn))
+	}
+	if redisClient != nil {
+		healthHandler.AddOptionalCheck("redis", func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		})
+	}
+	healthHandler.Register(router)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	router.GET("/", rootHandler)
 
 	// API versioning
 	router.GET("/api/versions", versionsHandler)
 
-	// Create a custom handler that extracts user_id from Gin context
+	// The file service endpoints are served by the gRPC-Gateway, whose metadataAnnotator
+	// passes on the caller the middlewares stored in the request context
 	fileServiceHandler := func(c *gin.Context) {
-		// Store the Gin context in the request context so metadataAnnotator can access it
-		ctx := context.WithValue(c.Request.Context(), "gin_context", c)
-		c.Request = c.Request.WithContext(ctx)
 		gwmux.ServeHTTP(c.Writer, c.Request)
 	}
 
-	// Apply auth middleware to file service endpoints
+	// Apply auth middleware to file service endpoints, which programs can call with an
+	// API key instead of a token
 	fileServiceGroup := router.Group("/api")
-	fileServiceGroup.Use(middleware.AuthMiddleware())
+	fileServiceGroup.Use(middleware.APIKeyMiddleware())
 
 	// Custom handler for ListFiles to handle query parameters properly
 	// Handle both /v1/files and /v1/files/ routes
 	fileServiceGroup.GET("/v1/files", func(c *gin.Context) {
-		handleListFiles(c, cfg)
+		handleListFiles(c, cfg, tokenSource)
 	})
 
 	fileServiceGroup.GET("/v1/files/", func(c *gin.Context) {
-		handleListFiles(c, cfg)
+		handleListFiles(c, cfg, tokenSource)
 	})
 
 	// Handle storage usage route (must come before :id route)
@@ -442,6 +585,7 @@ func main() {
 	// Handle other file service routes
 	fileServiceGroup.Any("/v1/files/upload", fileServiceHandler)
 	fileServiceGroup.Any("/v1/files/shared", fileServiceHandler)
+	fileServiceGroup.Any("/v1/files/shares", fileServiceHandler)
 	fileServiceGroup.Any("/v1/files/favorites", fileServiceHandler)
 	fileServiceGroup.Any("/v1/files/trash", fileServiceHandler)
 	fileServiceGroup.Any("/v1/files/:id/complete", fileServiceHandler)
@@ -459,10 +603,10 @@ func main() {
 		
 		log.Printf("Proxying file download to: %s", targetURL)
 		
-		// Create proxy request
-		req, err := http.NewRequest("GET", targetURL, nil)
+		// Create proxy request, passing on the request's deadline
+		req, err := http.NewRequestWithContext(c.Request.Context(), "GET", targetURL, nil)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to create request")
 			return
 		}
 		
@@ -472,13 +616,14 @@ func main() {
 				req.Header.Add(key, value)
 			}
 		}
+		ginmw.SetTimeoutHeader(req.Context(), req)
 		
 		// Send request to file service
 		client := &http.Client{Timeout: 60 * time.Second}
 		resp, err := client.Do(req)
 		if err != nil {
 			log.Printf("Failed to proxy download request: %v", err)
-			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reach file service"})
+			writeProxyError(c, http.StatusBadGateway, "Failed to reach file service", err)
 			return
 		}
 		defer resp.Body.Close()
@@ -507,8 +652,59 @@ func main() {
 		}
 		log.Printf("Streamed %d bytes to client", written)
 	})
+
+	// Upload content sent through the gateway rather than to the presigned URL is streamed
+	// to the file service REST API, which publishes its progress to the uploader
+	fileServiceGroup.PUT("/v1/files/:id/content", func(c *gin.Context) {
+		targetURL := fmt.Sprintf("%s/api/v1/files/%s/content", cfg.FileServiceREST, c.Param("id"))
+
+		// The upload may take longer to arrive than the server's read timeout, within the
+		// route's deadline
+		if deadline, ok := c.Request.Context().Deadline(); ok {
+			if err := http.NewResponseController(c.Writer).SetReadDeadline(deadline); err != nil {
+				log.Printf("Failed to extend the read deadline of an upload: %v", err)
+			}
+		}
+
+		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPut, targetURL, c.Request.Body)
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to create request")
+			return
+		}
+		req.ContentLength = c.Request.ContentLength
+		for key, values := range c.Request.Header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+		ginmw.SetTimeoutHeader(req.Context(), req)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			log.Printf("Failed to proxy upload content: %v", err)
+			writeProxyError(c, http.StatusBadGateway, "Failed to reach file service", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		for key, values := range resp.Header {
+			if isCORSHeader(key) {
+				continue
+			}
+			for _, value := range values {
+				c.Writer.Header().Add(key, value)
+			}
+		}
+		c.Writer.WriteHeader(resp.StatusCode)
+		if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+			log.Printf("Error streaming upload response: %v", err)
+		}
+	})
 	
 	fileServiceGroup.Any("/v1/files/:id/share", fileServiceHandler)
+	fileServiceGroup.Any("/v1/files/:id/shares", fileServiceHandler)
+	fileServiceGroup.Any("/v1/files/:id/share/:share_id", fileServiceHandler)
+	fileServiceGroup.Any("/v1/files/:id/share/:share_id/:action", fileServiceHandler)
 	fileServiceGroup.Any("/v1/files/:id/favorite", fileServiceHandler)
 	fileServiceGroup.Any("/v1/files/:id/restore", fileServiceHandler)
 	fileServiceGroup.Any("/v1/files/:id/permanent", fileServiceHandler)
@@ -517,8 +713,88 @@ func main() {
 	// Private folder routes (proxy directly to file service)
 	fileServiceGroup.Any("/v1/private-folder/*path", fileServiceHandler)
 
+	// The landing page of link shares is public: visitors without an account get the
+	// metadata of the shared file and download it through the signed links it returns.
+	// Single-use download links are public too, and redirect to the file's storage. Only
+	// the headers the file service reads are passed on, never the caller's credentials,
+	// and redirects are passed back for the client to follow.
+	publicFileClient := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	sharedFileHandler := func(c *gin.Context) {
+		targetURL := cfg.FileServiceREST + c.Request.URL.EscapedPath()
+		if c.Request.URL.RawQuery != "" {
+			targetURL += "?" + c.Request.URL.RawQuery
+		}
+
+		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, targetURL, nil)
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to create request")
+			return
+		}
+		for _, key := range []string{"X-Share-Password", "Range", apierror.RequestIDHeader, tenant.Header} {
+			if value := c.GetHeader(key); value != "" {
+				req.Header.Set(key, value)
+			}
+		}
+		ginmw.SetTimeoutHeader(req.Context(), req)
+
+		resp, err := publicFileClient.Do(req)
+		if err != nil {
+			log.Printf("Failed to proxy shared file request: %v", err)
+			writeProxyError(c, http.StatusBadGateway, "Failed to reach file service", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		for key, values := range resp.Header {
+			if isCORSHeader(key) {
+				continue
+			}
+			for _, value := range values {
+				c.Writer.Header().Add(key, value)
+			}
+		}
+		c.Writer.WriteHeader(resp.StatusCode)
+		if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+			log.Printf("Error streaming shared file response: %v", err)
+		}
+	}
+	router.GET("/api/v1/shared/:file_id", sharedFileHandler)
+	router.GET("/api/v1/shared/:file_id/download", sharedFileHandler)
+	router.GET("/api/v1/downloads/:token", sharedFileHandler)
+
 	// Mount other services without auth middleware
-	router.Any("/api/v1/auth/*path", gin.WrapF(gwmux.ServeHTTP))
+	router.Any("/api/v1/auth/*path", func(c *gin.Context) {
+		// Service tokens are only issued to internal callers, never through the public gateway
+		if c.Param("path") == "/service-token" {
+			apierror.Abort(c, http.StatusNotFound, "not found")
+			return
+		}
+
+		// User search and organization management are only available to signed-in users,
+		// and always act as the caller rather than a user_id supplied by the client
+		if isCallerScopedAuthPath(c.Param("path")) && c.Request.Method != http.MethodOptions {
+			middleware.AuthMiddleware()(c)
+			if c.IsAborted() {
+				return
+			}
+			// Impersonators act only within the user's current organization and cannot
+			// start impersonations of their own
+			if c.GetString("impersonator_id") != "" && isImpersonationRestrictedAuthPath(c.Param("path")) {
+				apierror.Abort(c, http.StatusForbidden, "not available while impersonating a user")
+				return
+			}
+			if err := setCallerUserID(c); err != nil {
+				apierror.Abort(c, http.StatusBadRequest, "invalid request body")
+				return
+			}
+		}
+
+		gwmux.ServeHTTP(c.Writer, c.Request)
+	})
 
 	// Proxy notification service requests directly to notification service REST API
 	// This bypasses gRPC and uses the notification service's REST endpoints
@@ -536,18 +812,17 @@ func main() {
 		// Extract user ID from JWT token
 		userID := ""
 		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
-			log.Printf("API Gateway - Authorization header found: %s", authHeader[:50]+"...")
 			// Extract user ID from JWT token
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(os.Getenv("JWT_SECRET")), nil
-			})
-			if err == nil && token.Valid {
-				if claims, ok := token.Claims.(*jwt.MapClaims); ok {
-					if uid, ok := (*claims)["user_id"].(string); ok {
-						userID = uid
-						log.Printf("API Gateway - User ID extracted from token: %s", userID)
-					}
+			if claims, err := jwtauth.NewValidator(cfg.JWTSecret).ValidateToken(authHeader); err == nil {
+				// Valid tokens go through the auth middleware, so that revoked tokens are
+				// rejected and requests made while impersonating are audited
+				middleware.AuthMiddleware()(c)
+				if c.IsAborted() {
+					return
+				}
+				if claims.UserID != "" {
+					userID = claims.UserID
+					log.Printf("API Gateway - User ID extracted from token: %s", userID)
 				}
 			}
 		}
@@ -570,11 +845,11 @@ func main() {
 
 		log.Printf("API Gateway - Proxying notification request to: %s", targetURL)
 
-		// Create proxy request
-		proxyReq, err := http.NewRequest(c.Request.Method, targetURL, c.Request.Body)
+		// Create proxy request, passing on the request's deadline
+		proxyReq, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, c.Request.Body)
 		if err != nil {
 			log.Printf("API Gateway - Failed to create proxy request: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to proxy request"})
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to proxy request")
 			return
 		}
 
@@ -584,6 +859,7 @@ func main() {
 				proxyReq.Header.Add(key, value)
 			}
 		}
+		ginmw.SetTimeoutHeader(proxyReq.Context(), proxyReq)
 
 		// Add X-User-ID header for notification service
 		if userID != "" {
@@ -598,7 +874,7 @@ func main() {
 		resp, err := client.Do(proxyReq)
 		if err != nil {
 			log.Printf("API Gateway - Failed to proxy request: %v", err)
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Notification service unavailable"})
+			writeProxyError(c, http.StatusServiceUnavailable, "Notification service unavailable", err)
 			return
 		}
 		defer resp.Body.Close()
@@ -617,37 +893,71 @@ func main() {
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			log.Printf("API Gateway - Failed to read response body: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read response"})
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to read response")
 			return
 		}
 
 		c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
 	})
 
-	// Mount billing service - proxy directly to billing service
-	// All billing endpoints go through the same proxy
-	// Auth middleware will be applied selectively based on the path
+	// API key owners see the usage of their keys against the quotas they are held to
+	if apiKeyQuotas != nil {
+		router.GET("/api/v1/api-key-quotas", middleware.AuthMiddleware(), apiKeyQuotas.GetUsage)
+	}
+
+	// Mount billing service through the gRPC gateway. Plans are public; every other
+	// endpoint acts as the signed-in caller rather than a user_id supplied by the client.
+	// Payment webhooks go to billing service's REST API with their raw body, which the
+	// provider's signature covers, and so do invoices, which are downloaded as PDFs, API
+	// keys and their usage, and the plan catalog, refund management and audit log of
+	// billing administrators.
 	router.Any("/api/v1/billing/*path", func(c *gin.Context) {
-		// Skip auth for public endpoints
-		path := c.Param("path")
-		if path == "/plans" {
-			// Public endpoint - no auth required
-			proxyToBillingService(c, cfg)
+		// Handle OPTIONS for CORS
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
-		// Handle OPTIONS for CORS
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		path := c.Param("path")
+		if strings.HasPrefix(path, "/webhooks/") {
+			proxyToBillingREST(c, cfg)
 			return
 		}
-
-		// All other endpoints require auth
-		middleware.AuthMiddleware()(c)
-		if c.IsAborted() {
+		if path == "/invoices" || strings.HasPrefix(path, "/invoices/") ||
+			path == "/api-keys" || strings.HasPrefix(path, "/api-keys/") || path == "/api-usage" {
+			middleware.AuthMiddleware()(c)
+			if c.IsAborted() {
+				return
+			}
+			proxyToBillingREST(c, cfg)
 			return
 		}
-		proxyToBillingService(c, cfg)
+		if strings.HasPrefix(path, "/admin/") {
+			middleware.AuthMiddleware()(c)
+			if c.IsAborted() {
+				return
+			}
+			// Billing administration is not available to impersonators
+			if c.GetString("impersonator_id") != "" {
+				apierror.Abort(c, http.StatusForbidden, "not available while impersonating a user")
+				return
+			}
+			proxyToBillingREST(c, cfg)
+			return
+		}
+
+		if !isPublicBillingPath(path) {
+			middleware.AuthMiddleware()(c)
+			if c.IsAborted() {
+				return
+			}
+			if err := setCallerUserID(c); err != nil {
+				apierror.Abort(c, http.StatusBadRequest, "invalid request body")
+				return
+			}
+		}
+
+		billingMux.ServeHTTP(c.Writer, c.Request)
 	})
 
 	// Mount file service private folder endpoints - proxy directly to file service
@@ -666,6 +976,20 @@ func main() {
 		proxyToFileService(c, cfg)
 	})
 
+	// Admin analytics for dashboards, for operators holding the analytics API token
+	if cfg.AnalyticsAPIToken != "" {
+		analyticsHandler := analytics.NewHandler(
+			analytics.Source{Name: "users", URL: cfg.AuthServiceREST + "/api/v1/admin/stats", Token: cfg.AnalyticsAPIToken},
+			analytics.Source{Name: "storage", URL: cfg.FileServiceREST + "/api/v1/admin/stats", Token: cfg.AnalyticsAPIToken},
+			analytics.Source{Name: "activity", URL: cfg.ShareTrackerREST + "/api/v1/stats/daily", Token: cfg.ShareTrackerAPIToken},
+			analytics.Source{Name: "notifications", URL: cfg.NotificationServiceREST + "/api/v1/analytics/delivery?interval=day", Token: cfg.AnalyticsAPIToken},
+			analytics.Source{Name: "revenue", URL: cfg.BillingServiceREST + "/api/v1/admin/stats", Token: cfg.AnalyticsAPIToken},
+		)
+		router.GET("/api/v1/admin/analytics", ginmw.BearerToken(cfg.AnalyticsAPIToken), analyticsHandler.GetAnalytics)
+	} else {
+		log.Println("ANALYTICS_API_TOKEN is not set, the admin analytics are disabled")
+	}
+
 	// Create HTTP server
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%s", cfg.Port),
@@ -699,66 +1023,316 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Report the API calls counted since the last report
+	stopAPIUsage()
+	middleware.FlushAPIUsage(shutdownCtx)
+
 	log.Println("API Gateway stopped")
 }
 
+// newServiceTokenSource creates a token source that exchanges the gateway's client
+// credentials for service tokens via the auth-service
+func newServiceTokenSource(cfg *config.Config) (*serviceauth.TokenSource, error) {
+	conn, err := grpc.Dial(cfg.AuthServiceGRPC, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
+	}
+
+	client := authv1.NewAuthServiceClient(conn)
+	return serviceauth.NewTokenSource(func(ctx context.Context, audience string) (string, int64, error) {
+		resp, err := client.IssueServiceToken(ctx, &authv1.IssueServiceTokenRequest{
+			ClientId:     cfg.ServiceClientID,
+			ClientSecret: cfg.ServiceClientSecret,
+			Audience:     audience,
+		})
+		if err != nil {
+			return "", 0, err
+		}
+		return resp.AccessToken, resp.ExpiresIn, nil
+	}), nil
+}
+
+// newImpersonationRecorder records requests made with impersonation tokens in the
+// auth-service audit log, which also reports whether the session is still active
+func newImpersonationRecorder(cfg *config.Config, tokenSource *serviceauth.TokenSource) (middleware.ImpersonationRecorder, error) {
+	dialOpts := serviceDialOptions([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, tokenSource, "auth-service")
+	conn, err := grpc.Dial(cfg.AuthServiceGRPC, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
+	}
+
+	client := authv1.NewAuthServiceClient(conn)
+	return func(ctx context.Context, claims *jwtauth.UserClaims, method, path, clientIP, userAgent string) error {
+		_, err := client.RecordImpersonationAction(ctx, &authv1.RecordImpersonationActionRequest{
+			ImpersonationId: claims.ImpersonationID,
+			UserId:          claims.UserID,
+			ImpersonatorId:  claims.ImpersonatorID,
+			Method:          method,
+			Path:            path,
+			IpAddress:       clientIP,
+			UserAgent:       userAgent,
+		})
+		return err
+	}, nil
+}
+
+// newRevocationLookup looks up when the tokens of users were last revoked in the auth
+// service
+func newRevocationLookup(cfg *config.Config, tokenSource *serviceauth.TokenSource) (jwtauth.RevocationLookup, error) {
+	dialOpts := serviceDialOptions([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, tokenSource, "auth-service")
+	conn, err := grpc.Dial(cfg.AuthServiceGRPC, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
+	}
+
+	client := authv1.NewAuthServiceClient(conn)
+	return func(ctx context.Context, userID string) (time.Time, error) {
+		resp, err := client.GetTokenRevocation(ctx, &authv1.GetTokenRevocationRequest{UserId: userID})
+		if err != nil {
+			return time.Time{}, err
+		}
+		if resp.RevokedAt == nil {
+			return time.Time{}, nil
+		}
+		return resp.RevokedAt.AsTime(), nil
+	}, nil
+}
+
+// newAPIKeyClients verifies API keys and reports the calls made with them through the
+// billing service
+func newAPIKeyClients(cfg *config.Config, tokenSource *serviceauth.TokenSource) (middleware.APIKeyVerifier, middleware.APIUsageReporter, error) {
+	dialOpts := serviceDialOptions([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, tokenSource, "billing-service")
+	conn, err := grpc.Dial(cfg.BillingServiceGRPC, dialOpts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to billing service: %w", err)
+	}
+
+	client := billingv1.NewBillingServiceClient(conn)
+	verifier := func(ctx context.Context, key string) (middleware.APIKey, error) {
+		resp, err := client.AuthenticateAPIKey(ctx, &billingv1.AuthenticateAPIKeyRequest{ApiKey: key})
+		switch status.Code(err) {
+		case codes.OK:
+			return middleware.APIKey{
+				ID:              resp.KeyId,
+				UserID:          resp.UserId,
+				RateLimit:       resp.RateLimit,
+				MonthlyTransfer: resp.MonthlyTransfer,
+				TenantID:        resp.TenantId,
+			}, nil
+		case codes.Unauthenticated, codes.InvalidArgument:
+			return middleware.APIKey{}, middleware.ErrInvalidAPIKey
+		case codes.PermissionDenied:
+			return middleware.APIKey{}, middleware.ErrAPIAccessDenied
+		default:
+			return middleware.APIKey{}, err
+		}
+	}
+	reporter := func(ctx context.Context, calls map[string]int64) ([]string, error) {
+		resp, err := client.RecordAPIUsage(ctx, &billingv1.RecordAPIUsageRequest{Calls: calls})
+		if err != nil {
+			return nil, err
+		}
+		return resp.FailedKeyIds, nil
+	}
+	return verifier, reporter, nil
+}
+
+// newRedisClient connects to the Redis the API key quotas are counted in
+func newRedisClient(cfg *config.Config) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         cfg.RedisAddr,
+		Password:     cfg.RedisPassword,
+		DB:           cfg.RedisDB,
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping Redis: %w", err)
+	}
+	return client, nil
+}
+
+// serviceDialOptions returns opts plus per-RPC service token credentials for audience
+func serviceDialOptions(opts []grpc.DialOption, tokenSource *serviceauth.TokenSource, audience string) []grpc.DialOption {
+	if tokenSource == nil {
+		return opts
+	}
+
+	withCreds := make([]grpc.DialOption, 0, len(opts)+1)
+	withCreds = append(withCreds, opts...)
+	return append(withCreds, grpc.WithPerRPCCredentials(tokenSource.Credentials(audience)))
+}
+
 // customMatcher matches all headers including Authorization
 func customMatcher(key string) (string, bool) {
 	switch key {
 	case "Authorization":
 		return key, true
+	case "Grpc-Metadata-" + http.CanonicalHeaderKey(tenant.MetadataKey):
+		// The tenant is decided by TenantMiddleware, never by the client
+		return "", false
+	case "Grpc-Metadata-" + http.CanonicalHeaderKey(grpcmw.RequestIDKey):
+		// The request ID is the one RequestID gave the request
+		return "", false
 	default:
 		return runtime.DefaultHeaderMatcher(key)
 	}
 }
 
-// customErrorHandler handles gRPC errors
+// writeProxyError responds to a request a service failed to answer, with 504 if the
+// request ran out of time
+func writeProxyError(c *gin.Context, code int, message string, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		apierror.Abort(c, http.StatusGatewayTimeout, "deadline exceeded")
+		return
+	}
+	apierror.Abort(c, code, message)
+}
+
+// customErrorHandler responds to the errors of the gRPC calls, and the mux's own such as
+// unknown routes, with the error envelope of the REST APIs
 func customErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
-	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+	st := status.Convert(err)
+	apiErr, httpStatus := apierror.FromStatus(st)
+	var httpErr *runtime.HTTPStatusError
+	if errors.As(err, &httpErr) {
+		httpStatus = httpErr.HTTPStatus
+		apiErr.Code = apierror.CodeForStatus(httpStatus)
+	}
+	apiErr.RequestID = w.Header().Get(apierror.RequestIDHeader)
+
+	// Pass on the headers the service set, such as its x-request-id
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for key, values := range md.HeaderMD {
+			for _, value := range values {
+				w.Header().Add(runtime.MetadataHeaderPrefix+key, value)
+			}
+		}
+	}
+	if st.Code() == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", st.Message())
+	}
+
+	body, marshalErr := json.Marshal(apiErr)
+	if marshalErr != nil {
+		log.Printf("API Gateway - Failed to marshal error response: %v", marshalErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_, _ = w.Write(body)
 }
 
-// metadataAnnotator extracts user_id from Gin context and adds it to gRPC metadata
+// isCallerScopedAuthPath reports whether an auth-service path acts on behalf of the
+// signed-in caller. Invitees look up and accept invitations before they have an account.
+func isCallerScopedAuthPath(path string) bool {
+	if path == "/invitations/lookup" || path == "/invitations/accept" {
+		return false
+	}
+	return path == "/users/search" ||
+		path == "/logins" ||
+		path == "/switch-org" ||
+		path == "/orgs" ||
+		strings.HasPrefix(path, "/orgs/") ||
+		path == "/invitations" ||
+		strings.HasPrefix(path, "/invitations/") ||
+		path == "/audit-events" ||
+		path == "/impersonations" ||
+		strings.HasPrefix(path, "/impersonations/") ||
+		strings.HasPrefix(path, "/admin/")
+}
+
+// isImpersonationRestrictedAuthPath reports whether an auth-service path is unavailable to
+// impersonation tokens
+func isImpersonationRestrictedAuthPath(path string) bool {
+	return path == "/switch-org" ||
+		path == "/impersonations" ||
+		strings.HasPrefix(path, "/impersonations/") ||
+		strings.HasPrefix(path, "/admin/")
+}
+
+// isPublicBillingPath reports whether a billing-service path is available without signing
+// in: the plan catalog
+func isPublicBillingPath(path string) bool {
+	return path == "/plans" || strings.HasPrefix(path, "/plans/")
+}
+
+// setCallerUserID overrides the request's user_id with the authenticated caller. Body-less
+// requests carry it as a query parameter, the others in their JSON body.
+func setCallerUserID(c *gin.Context) error {
+	userID := c.GetString("user_id")
+
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodDelete {
+		query := c.Request.URL.Query()
+		query.Set("user_id", userID)
+		c.Request.URL.RawQuery = query.Encode()
+		return nil
+	}
+
+	body := map[string]interface{}{}
+	raw, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(raw, &body); err != nil {
+			return err
+		}
+	}
+	body["user_id"] = userID
+
+	raw, err = json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+	c.Request.ContentLength = int64(len(raw))
+	c.Request.Header.Set("Content-Length", strconv.Itoa(len(raw)))
+	return nil
+}
+
+// metadataAnnotator adds the caller, tenant and request ID of a request to the gRPC
+// metadata of its calls
 func metadataAnnotator(ctx context.Context, r *http.Request) metadata.MD {
 	md := metadata.New(nil)
 
-	// Extract user_id from Gin context if available
-	if ginCtx, ok := ctx.Value("gin_context").(*gin.Context); ok {
-		if userID, exists := ginCtx.Get("user_id"); exists {
-			if userIDStr, ok := userID.(string); ok {
-				md.Set("user_id", userIDStr)
-				fmt.Printf("API Gateway - User ID extracted from Gin context: %s\n", userIDStr)
-			}
-		}
+	// Forward the tenant TenantMiddleware decided for the request
+	tenantID, _ := reqctx.TenantID(ctx)
+	md.Set(tenant.MetadataKey, tenantID)
+
+	// Forward the request ID, so that the services log the call under it
+	md.Set(grpcmw.RequestIDKey, reqctx.RequestID(ctx))
+
+	// Forward the caller the auth middlewares stored in the request context
+	if userID := reqctx.UserID(ctx); userID != "" {
+		md.Set("user_id", userID)
+	}
+	// Forward the organization the caller's token was issued for
+	if orgID := reqctx.OrgID(ctx); orgID != "" {
+		md.Set("org_id", orgID)
+		md.Set("org_role", strings.Join(reqctx.Roles(ctx), ","))
 	}
 
 	// Extract Authorization header and add to metadata
 	if auth := r.Header.Get("Authorization"); auth != "" {
 		md.Set("authorization", auth)
-		fmt.Printf("API Gateway - Authorization header found: %s\n", auth[:int(math.Min(50, float64(len(auth))))])
 	}
 
 	// Fallback: Extract user_id from query parameters for file service
 	if userID := r.URL.Query().Get("user_id"); userID != "" {
 		md.Set("user_id", userID)
-		fmt.Printf("API Gateway - User ID extracted from query param: %s\n", userID)
 	}
 
-	// Debug: Print all query parameters
-	fmt.Printf("API Gateway - Query parameters: %v\n", r.URL.Query())
-	fmt.Printf("API Gateway - Request URL: %s\n", r.URL.String())
-
 	return md
 }
 
-// healthCheckHandler returns service health status
-func healthCheckHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "healthy",
-		"service": "api-gateway",
-		"time":    time.Now().UTC().Format(time.RFC3339),
-	})
-}
-
 // rootHandler returns API information
 func rootHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,161 @@
+// Package analytics serves the admin analytics: the platform KPIs reported by each
+// service, gathered into one JSON document for dashboards such as Grafana or an admin UI.
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+)
+
+const (
+	// defaultDays is the number of days the analytics cover by default
+	defaultDays = 30
+	// maxDays bounds the number of days the analytics cover
+	maxDays = 366
+	// sourceTimeout bounds each call to a service
+	sourceTimeout = 10 * time.Second
+	// maxResponseBytes bounds the statistics read from a service
+	maxResponseBytes = 4 << 20
+)
+
+// Source is a service endpoint reporting statistics. The range of the analytics is added
+// to URL as the from and to query parameters, in RFC 3339.
+type Source struct {
+	// Name is the key of the statistics in the analytics document
+	Name  string
+	URL   string
+	Token string
+}
+
+// Handler serves the statistics of its sources
+type Handler struct {
+	sources []Source
+	client  *http.Client
+}
+
+// NewHandler creates a handler gathering the statistics of sources
+func NewHandler(sources ...Source) *Handler {
+	return &Handler{
+		sources: sources,
+		client:  &http.Client{Timeout: sourceTimeout},
+	}
+}
+
+// result is the statistics of a source, or why they couldn't be read
+type result struct {
+	name  string
+	stats json.RawMessage
+	err   error
+}
+
+// GetAnalytics handles GET /api/v1/admin/analytics. It covers the last days (30 by
+// default) up to now, and every tenant, or only tenant_id if the query sets it. Services
+// that fail are reported in errors, next to the statistics of the others.
+func (h *Handler) GetAnalytics(c *gin.Context) {
+	days := defaultDays
+	if value := c.Query("days"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days < 1 || days > maxDays {
+			apierror.Abort(c, http.StatusBadRequest, fmt.Sprintf("days must be between 1 and %d", maxDays))
+			return
+		}
+	}
+	tenantID, byTenant := c.GetQuery("tenant_id")
+	if byTenant && !tenant.Valid(tenantID) {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid tenant ID")
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -days)
+
+	results := make(chan result, len(h.sources))
+	var wg sync.WaitGroup
+	for _, source := range h.sources {
+		wg.Add(1)
+		go func(source Source) {
+			defer wg.Done()
+			stats, err := h.fetch(c.Request.Context(), source, from, to, tenantID, byTenant)
+			results <- result{name: source.Name, stats: stats, err: err}
+		}(source)
+	}
+	wg.Wait()
+	close(results)
+
+	body := gin.H{
+		"from":         from,
+		"to":           to,
+		"generated_at": time.Now().UTC(),
+	}
+	if byTenant {
+		body["tenant_id"] = tenantID
+	}
+	failures := gin.H{}
+	for result := range results {
+		if result.err != nil {
+			failures[result.name] = result.err.Error()
+			continue
+		}
+		body[result.name] = result.stats
+	}
+	if len(failures) > 0 {
+		body["errors"] = failures
+	}
+
+	c.JSON(http.StatusOK, body)
+}
+
+// fetch reads the statistics of a source over [from, to), of tenantID only if byTenant
+// is set
+func (h *Handler) fetch(ctx context.Context, source Source, from, to time.Time, tenantID string, byTenant bool) (json.RawMessage, error) {
+	target, err := url.Parse(source.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	query := target.Query()
+	query.Set("from", from.Format(time.RFC3339))
+	query.Set("to", to.Format(time.RFC3339))
+	target.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if source.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+source.Token)
+	}
+	if byTenant {
+		req.Header.Set(tenant.Header, tenantID)
+	}
+	ginmw.SetTimeoutHeader(ctx, req)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("service unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("service responded with status %d", resp.StatusCode)
+	}
+	stats, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read statistics: %w", err)
+	}
+	if !json.Valid(stats) {
+		return nil, fmt.Errorf("service responded with invalid JSON")
+	}
+	return stats, nil
+}
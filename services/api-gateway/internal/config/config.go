@@ -1,10 +1,11 @@
 package config
 
 import (
-	"fmt"
 	"log"
-	"os"
 	"strings"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
 )
 
 type Config struct {
@@ -20,22 +21,82 @@ type Config struct {
 	RateLimitEnabled        bool
 	RateLimitRequests       int
 	RateLimitDuration       int
+	ServiceAuthEnabled      bool
+	ServiceClientID         string
+	ServiceClientSecret     string
+	// APIUsageReportInterval is how often, in seconds, the calls made with API keys are
+	// reported to the billing service
+	APIUsageReportInterval int
+	// RequestTimeout is the time requests have to complete, unless RouteTimeouts gives
+	// their route, such as /api/v1/files/:id/download, another. Callers can ask for less
+	// with the X-Request-Timeout header. The deadline is passed on to the services.
+	RequestTimeout time.Duration
+	RouteTimeouts  map[string]time.Duration
+
+	// API keys are held to APIKeyRateLimit requests per minute and APIKeyMonthlyTransfer
+	// bytes per month, or lower quotas set by their owner, counted in the Redis at
+	// RedisAddr. Keys exceeding twice their rate limit are suspended for
+	// APIKeySuspension. Zero quotas are unlimited, and API keys have no quotas with
+	// Redis disabled.
+	RedisEnabled          bool
+	RedisAddr             string
+	RedisPassword         string
+	RedisDB               int
+	APIKeyRateLimit       int64
+	APIKeyMonthlyTransfer int64
+	APIKeySuspension      time.Duration
+
+	// Access tokens are rejected once their user's tokens are revoked, which the gateway
+	// asks the auth service about and caches in Redis for TokenRevocationCacheTTL
+	TokenRevocationCacheTTL time.Duration
+
+	// The admin analytics are served to AnalyticsAPIToken bearers if it is set. They are
+	// gathered from the REST APIs of the services, which accept the same token, and from
+	// the share tracker, which accepts ShareTrackerAPIToken.
+	AnalyticsAPIToken       string
+	AuthServiceREST         string
+	FileServiceREST         string
+	NotificationServiceREST string
+	BillingServiceREST      string
+	ShareTrackerREST        string
+	ShareTrackerAPIToken    string
 }
 
 func Load() *Config {
 	cfg := &Config{
-		Port:                    getEnv("GATEWAY_PORT", "8080"),
-		Environment:             getEnv("ENVIRONMENT", "development"),
-		LogLevel:                getEnv("LOG_LEVEL", "info"),
-		JWTSecret:               getEnv("JWT_SECRET", "your-super-secret-key-change-in-production"),
-		AuthServiceGRPC:         getEnv("AUTH_SERVICE_GRPC", "localhost:50051"),
-		FileServiceGRPC:         getEnv("FILE_SERVICE_GRPC", "localhost:50052"),
-		NotificationServiceGRPC: getEnv("NOTIFICATION_SERVICE_GRPC", "localhost:50054"),
-		BillingServiceGRPC:      getEnv("BILLING_SERVICE_GRPC", "localhost:50054"),
-		CORSAllowedOrigins:      getCORSOrigins(),
-		RateLimitEnabled:        getEnv("RATE_LIMIT_ENABLED", "true") == "true",
-		RateLimitRequests:       getEnvAsInt("RATE_LIMIT_REQUESTS", 100),
-		RateLimitDuration:       getEnvAsInt("RATE_LIMIT_DURATION", 60),
+		Port:                    env.String("GATEWAY_PORT", "8080"),
+		Environment:             env.String("ENVIRONMENT", "development"),
+		LogLevel:                env.String("LOG_LEVEL", "info"),
+		JWTSecret:               env.String("JWT_SECRET", "your-super-secret-key-change-in-production"),
+		AuthServiceGRPC:         env.String("AUTH_SERVICE_GRPC", "localhost:50051"),
+		FileServiceGRPC:         env.String("FILE_SERVICE_GRPC", "localhost:50052"),
+		NotificationServiceGRPC: env.String("NOTIFICATION_SERVICE_GRPC", "localhost:50054"),
+		BillingServiceGRPC:      env.String("BILLING_SERVICE_GRPC", "localhost:50054"),
+		CORSAllowedOrigins:      env.List("CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000", "http://localhost:8080"}),
+		RateLimitEnabled:        env.Bool("RATE_LIMIT_ENABLED", true),
+		RateLimitRequests:       env.Int("RATE_LIMIT_REQUESTS", 100),
+		RateLimitDuration:       env.Int("RATE_LIMIT_DURATION", 60),
+		ServiceAuthEnabled:      env.Bool("SERVICE_AUTH_ENABLED", false),
+		ServiceClientID:         env.String("SERVICE_CLIENT_ID", "api-gateway"),
+		ServiceClientSecret:     env.String("SERVICE_CLIENT_SECRET", ""),
+		APIUsageReportInterval:  env.Int("API_USAGE_REPORT_INTERVAL", 60),
+		RequestTimeout:          env.Duration("REQUEST_TIMEOUT", 30*time.Second),
+		RouteTimeouts:           routeTimeouts(),
+		RedisEnabled:            env.Bool("REDIS_ENABLED", true),
+		RedisAddr:               env.String("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:           env.String("REDIS_PASSWORD", ""),
+		RedisDB:                 env.Int("REDIS_DB", 0),
+		APIKeyRateLimit:         env.Int64("API_KEY_RATE_LIMIT", 600),
+		APIKeyMonthlyTransfer:   env.Int64("API_KEY_MONTHLY_TRANSFER", 100<<30),
+		APIKeySuspension:        env.Duration("API_KEY_SUSPENSION", 15*time.Minute),
+		TokenRevocationCacheTTL: env.Duration("TOKEN_REVOCATION_CACHE_TTL", 30*time.Second),
+		AnalyticsAPIToken:       env.String("ANALYTICS_API_TOKEN", ""),
+		AuthServiceREST:         env.String("AUTH_SERVICE_REST_URL", "http://localhost:8081"),
+		FileServiceREST:         env.String("FILE_SERVICE_REST_URL", "http://localhost:8082"),
+		NotificationServiceREST: env.String("NOTIFICATION_SERVICE_REST_URL", "http://localhost:8084"),
+		BillingServiceREST:      env.String("BILLING_SERVICE_REST_URL", "http://localhost:8086"),
+		ShareTrackerREST:        env.String("SHARE_TRACKER_REST_URL", "http://localhost:8087"),
+		ShareTrackerAPIToken:    env.String("SHARE_TRACKER_API_TOKEN", ""),
 	}
 
 	log.Printf("Configuration loaded:")
@@ -46,30 +107,37 @@ func Load() *Config {
 	log.Printf("  Notification Service: %s", cfg.NotificationServiceGRPC)
 	log.Printf("  Billing Service: %s", cfg.BillingServiceGRPC)
 	log.Printf("  CORS Origins: %v", cfg.CORSAllowedOrigins)
+	log.Printf("  Service Auth Enabled: %v", cfg.ServiceAuthEnabled)
+	log.Printf("  Request Timeout: %s, by route: %v", cfg.RequestTimeout, cfg.RouteTimeouts)
+	log.Printf("  API Key Quotas: %d requests/min, %d bytes/month (Redis enabled: %v)", cfg.APIKeyRateLimit, cfg.APIKeyMonthlyTransfer, cfg.RedisEnabled)
 
 	return cfg
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// RouteTimeout returns the time the requests of a route have to complete
+func (c *Config) RouteTimeout(route string) time.Duration {
+	if timeout, ok := c.RouteTimeouts[route]; ok {
+		return timeout
 	}
-	return defaultValue
+	return c.RequestTimeout
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := getEnv(key, "")
-	if valueStr == "" {
-		return defaultValue
+// routeTimeouts reads the timeouts of the routes that differ from REQUEST_TIMEOUT from
+// ROUTE_TIMEOUTS, a comma-separated list of route=duration pairs. Downloads stream for as
+// long as the server's write timeout by default, and upload content for 30 minutes.
+func routeTimeouts() map[string]time.Duration {
+	timeouts := map[string]time.Duration{
+		"/api/v1/files/:id/download":       60 * time.Second,
+		"/api/v1/shared/:file_id/download": 60 * time.Second,
+		"/api/v1/files/:id/content":        30 * time.Minute,
 	}
-	var value int
-	if _, err := fmt.Sscanf(valueStr, "%d", &value); err != nil {
-		return defaultValue
+	for _, entry := range env.List("ROUTE_TIMEOUTS", nil) {
+		route, value, ok := strings.Cut(entry, "=")
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || err != nil || timeout < 0 {
+			log.Fatalf("Invalid ROUTE_TIMEOUTS entry %q, expected route=duration", entry)
+		}
+		timeouts[strings.TrimSpace(route)] = timeout
 	}
-	return value
-}
-
-func getCORSOrigins() []string {
-	origins := getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:8080")
-	return strings.Split(origins, ",")
+	return timeouts
 }
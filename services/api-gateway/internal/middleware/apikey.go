@@ -0,0 +1,247 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/reqctx"
+)
+
+// APIKeyHeader carries the API key of requests made by programs rather than signed-in
+// users
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyCacheTTL is how long a verified API key is trusted before it is verified again,
+// and so how long a revoked key keeps working
+const apiKeyCacheTTL = time.Minute
+
+var (
+	// ErrInvalidAPIKey is returned by an APIKeyVerifier for unknown or revoked keys
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIAccessDenied is returned by an APIKeyVerifier for keys of users whose plan
+	// doesn't include API access
+	ErrAPIAccessDenied = errors.New("your plan doesn't include API access")
+)
+
+// APIKey is a verified API key
+type APIKey struct {
+	ID     string
+	UserID string
+	// TenantID is the tenant of the key's owner, empty for the default tenant
+	TenantID string
+	// RateLimit and MonthlyTransfer are the quotas the key's owner set, in requests per
+	// minute and bytes per month, zero for the gateway's
+	RateLimit       int64
+	MonthlyTransfer int64
+}
+
+// APIKeyVerifier returns the API key a key string belongs to
+type APIKeyVerifier func(ctx context.Context, key string) (APIKey, error)
+
+// APIUsageReporter records the calls made with each API key, by key ID. It returns the
+// IDs of the keys whose calls weren't recorded.
+type APIUsageReporter func(ctx context.Context, calls map[string]int64) ([]string, error)
+
+// apiKeys verifies API keys, holds them to their quotas and counts the calls made with
+// them until they are reported
+var apiKeys struct {
+	verifier APIKeyVerifier
+	reporter APIUsageReporter
+	quotas   *APIKeyQuotas
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]verifiedAPIKey
+	calls    map[string]int64
+}
+
+// verifiedAPIKey is the result of verifying an API key, cached until expires
+type verifiedAPIKey struct {
+	key     APIKey
+	err     error
+	expires time.Time
+}
+
+// SetAPIKeys sets how APIKeyMiddleware verifies API keys and reports their calls. API
+// keys are rejected until they are set.
+func SetAPIKeys(verifier APIKeyVerifier, reporter APIUsageReporter) {
+	apiKeys.mu.Lock()
+	defer apiKeys.mu.Unlock()
+
+	apiKeys.verifier = verifier
+	apiKeys.reporter = reporter
+	apiKeys.verified = make(map[[sha256.Size]byte]verifiedAPIKey)
+	apiKeys.calls = make(map[string]int64)
+}
+
+// SetAPIKeyQuotas sets the quotas APIKeyMiddleware holds API keys to. Keys have no
+// quotas until they are set.
+func SetAPIKeyQuotas(quotas *APIKeyQuotas) {
+	apiKeys.mu.Lock()
+	defer apiKeys.mu.Unlock()
+
+	apiKeys.quotas = quotas
+}
+
+// APIKeyMiddleware authenticates requests made with an API key as the key's user, serves
+// them for the user's tenant, holds the key to its quotas and counts the requests for
+// billing. Requests without one go
+// through AuthMiddleware.
+func APIKeyMiddleware() gin.HandlerFunc {
+	auth := AuthMiddleware()
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			auth(c)
+			return
+		}
+
+		apiKey, err := verifyAPIKey(c.Request.Context(), key)
+		switch {
+		case errors.Is(err, ErrInvalidAPIKey):
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid API key")
+			return
+		case errors.Is(err, ErrAPIAccessDenied):
+			apierror.Abort(c, http.StatusForbidden, err.Error())
+			return
+		case err != nil:
+			log.Printf("Failed to verify API key: %v", err)
+			apierror.Abort(c, http.StatusServiceUnavailable, "Failed to verify API key")
+			return
+		}
+
+		apiKeys.mu.Lock()
+		quotas := apiKeys.quotas
+		apiKeys.mu.Unlock()
+
+		if quotas != nil && !quotas.admit(c, apiKey) {
+			return
+		}
+
+		countAPICalls(map[string]int64{apiKey.ID: 1})
+
+		// Set user information in context
+		c.Set("user_id", apiKey.UserID)
+		c.Set("api_key_id", apiKey.ID)
+		c.Request = c.Request.WithContext(reqctx.WithUserID(c.Request.Context(), apiKey.UserID))
+		setTenant(c, apiKey.TenantID)
+
+		c.Next()
+
+		if quotas != nil {
+			quotas.recordTransfer(c, apiKey)
+		}
+	}
+}
+
+// verifyAPIKey returns the API key a key string belongs to, from the cache while it is
+// fresh.
+// Rejected keys are cached as well, so that they don't reach the billing service on
+// every request.
+func verifyAPIKey(ctx context.Context, key string) (APIKey, error) {
+	hash := sha256.Sum256([]byte(key))
+	now := time.Now()
+
+	apiKeys.mu.Lock()
+	verifier := apiKeys.verifier
+	cached, ok := apiKeys.verified[hash]
+	apiKeys.mu.Unlock()
+
+	if verifier == nil {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	if ok && now.Before(cached.expires) {
+		return cached.key, cached.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	apiKey, err := verifier(ctx, key)
+	if err != nil && !errors.Is(err, ErrInvalidAPIKey) && !errors.Is(err, ErrAPIAccessDenied) {
+		return APIKey{}, err
+	}
+
+	apiKeys.mu.Lock()
+	// Drop expired entries now and then, so that the cache doesn't grow with every key
+	// ever presented
+	if len(apiKeys.verified) >= 10000 {
+		for h, entry := range apiKeys.verified {
+			if !now.Before(entry.expires) {
+				delete(apiKeys.verified, h)
+			}
+		}
+	}
+	apiKeys.verified[hash] = verifiedAPIKey{key: apiKey, err: err, expires: now.Add(apiKeyCacheTTL)}
+	apiKeys.mu.Unlock()
+
+	return apiKey, err
+}
+
+// countAPICalls adds calls, by key ID, to the calls to report
+func countAPICalls(calls map[string]int64) {
+	apiKeys.mu.Lock()
+	defer apiKeys.mu.Unlock()
+
+	if apiKeys.calls == nil {
+		return
+	}
+	for keyID, count := range calls {
+		apiKeys.calls[keyID] += count
+	}
+}
+
+// RunAPIUsageReporter reports the counted API calls every interval until ctx is done
+func RunAPIUsageReporter(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			FlushAPIUsage(ctx)
+		}
+	}
+}
+
+// FlushAPIUsage reports the API calls counted since the last report. Calls that
+// couldn't be recorded are counted again for the next report.
+func FlushAPIUsage(ctx context.Context) {
+	apiKeys.mu.Lock()
+	reporter := apiKeys.reporter
+	calls := apiKeys.calls
+	if len(calls) > 0 {
+		apiKeys.calls = make(map[string]int64)
+	}
+	apiKeys.mu.Unlock()
+
+	if reporter == nil || len(calls) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	failed, err := reporter(ctx, calls)
+	if err != nil {
+		log.Printf("Failed to report API usage: %v", err)
+		countAPICalls(calls)
+		return
+	}
+	if len(failed) > 0 {
+		log.Printf("Failed to record API usage of %d keys, retrying later", len(failed))
+		retry := make(map[string]int64, len(failed))
+		for _, keyID := range failed {
+			retry[keyID] = calls[keyID]
+		}
+		countAPICalls(retry)
+	}
+}
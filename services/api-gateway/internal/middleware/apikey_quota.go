@@ -0,0 +1,315 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+)
+
+const (
+	// apiKeyQuotaPrefix prefixes the Redis keys the usage of API keys is counted under
+	apiKeyQuotaPrefix = "gateway:apikey:"
+	// apiKeyRateWindow is the window the requests of API keys are counted in
+	apiKeyRateWindow = time.Minute
+	// apiKeyUsageRetention is how long the usage of an API key is kept after its last
+	// request, long enough to show the previous month
+	apiKeyUsageRetention = 62 * 24 * time.Hour
+	// apiKeyQuotaTimeout bounds the Redis calls made for a request, which is let through
+	// when they fail
+	apiKeyQuotaTimeout = time.Second
+)
+
+// Reasons API keys are suspended for
+const (
+	suspendedForRate     = "rate limit repeatedly exceeded"
+	suspendedForTransfer = "monthly transfer quota exceeded"
+)
+
+// APIKeyQuotas holds API keys to a request rate and a monthly transfer quota, counted in
+// Redis so that they hold across the gateway's replicas. Keys get the gateway's quotas,
+// or lower ones their owner set.
+//
+// The quotas are soft. Requests over the rate limit are rejected, and a key making twice
+// as many within a minute is suspended for a while. The transfer of a request is only
+// known once it is served, so the request crossing the monthly quota completes and the
+// key is suspended from then until the end of the month, or until its quota is raised.
+// Requests are let through while Redis fails.
+//
+// Only the bodies the gateway proxies count toward the transfer quota. Content moved
+// between the client and MinIO through presigned URLs never passes the gateway, and
+// isn't counted.
+type APIKeyQuotas struct {
+	client          *redis.Client
+	rateLimit       int64
+	monthlyTransfer int64
+	suspension      time.Duration
+}
+
+// NewAPIKeyQuotas creates API key quotas of rateLimit requests per minute and
+// monthlyTransfer bytes, uploaded and downloaded, per calendar month, zero for no limit.
+// Keys exceeding twice their rate limit are suspended for suspension, never if it is
+// zero.
+func NewAPIKeyQuotas(client *redis.Client, rateLimit, monthlyTransfer int64, suspension time.Duration) *APIKeyQuotas {
+	return &APIKeyQuotas{
+		client:          client,
+		rateLimit:       rateLimit,
+		monthlyTransfer: monthlyTransfer,
+		suspension:      suspension,
+	}
+}
+
+// APIKeyUsage is the usage of an API key against its quotas. Limits of zero are
+// unlimited.
+type APIKeyUsage struct {
+	KeyID string `json:"key_id"`
+	// Requests are the requests made in the current minute
+	Requests  int64 `json:"requests"`
+	RateLimit int64 `json:"rate_limit"`
+	// Transfer is the bytes transferred in the current month
+	Transfer         int64      `json:"transfer"`
+	MonthlyTransfer  int64      `json:"monthly_transfer"`
+	Suspended        bool       `json:"suspended"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+	SuspendedUntil   *time.Time `json:"suspended_until,omitempty"`
+}
+
+// admit reports whether a request made with key is within its quotas, responding with
+// the error if it isn't. It counts the request against the rate limit.
+func (q *APIKeyQuotas) admit(c *gin.Context, key APIKey) bool {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), apiKeyQuotaTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	rateLimit := effectiveQuota(key.RateLimit, q.rateLimit)
+	monthlyTransfer := effectiveQuota(key.MonthlyTransfer, q.monthlyTransfer)
+
+	pipe := q.client.TxPipeline()
+	reason := pipe.Get(ctx, suspendedKey(key.ID))
+	suspendedFor := pipe.PTTL(ctx, suspendedKey(key.ID))
+	transfer := pipe.Get(ctx, transferKey(key.ID, now))
+	requests := pipe.Incr(ctx, requestsKey(key.ID))
+	pipe.ExpireNX(ctx, requestsKey(key.ID), apiKeyRateWindow)
+	window := pipe.PTTL(ctx, requestsKey(key.ID))
+	// The quotas and keys of each user are kept for owners to see their usage
+	pipe.HSet(ctx, quotaKey(key.ID), "user_id", key.UserID, "rate_limit", rateLimit, "monthly_transfer", monthlyTransfer)
+	pipe.Expire(ctx, quotaKey(key.ID), apiKeyUsageRetention)
+	pipe.SAdd(ctx, userKeysKey(key.UserID), key.ID)
+	pipe.Expire(ctx, userKeysKey(key.UserID), apiKeyUsageRetention)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("Failed to check the quotas of API key %s, letting the request through: %v", key.ID, err)
+		return true
+	}
+
+	if reason.Val() != "" {
+		// Keys suspended for their transfer work again as soon as their quota is raised
+		// above it
+		transferred, _ := transfer.Int64()
+		if reason.Val() == suspendedForTransfer && (monthlyTransfer == 0 || transferred < monthlyTransfer) {
+			q.lift(ctx, key)
+		} else {
+			until := now.Add(max(suspendedFor.Val(), 0))
+			c.Header("Retry-After", retryAfter(suspendedFor.Val()))
+			apierror.AbortWith(c, http.StatusForbidden,
+				apierror.New(apierror.CodeForStatus(http.StatusForbidden), "API key suspended: "+reason.Val()).
+					WithDetails(gin.H{"reason": reason.Val(), "suspended_until": until}))
+			return false
+		}
+	}
+
+	if rateLimit == 0 {
+		return true
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.FormatInt(rateLimit, 10))
+	c.Header("X-RateLimit-Remaining", strconv.FormatInt(max(rateLimit-requests.Val(), 0), 10))
+	if requests.Val() <= rateLimit {
+		return true
+	}
+
+	if requests.Val() > 2*rateLimit {
+		q.suspend(ctx, key, suspendedForRate, q.suspension)
+	}
+	c.Header("Retry-After", retryAfter(window.Val()))
+	apierror.Abort(c, http.StatusTooManyRequests, fmt.Sprintf("API key rate limit of %d requests per minute exceeded", rateLimit))
+	return false
+}
+
+// recordTransfer adds the bytes a request made with key uploaded and downloaded through
+// the gateway to the key's transfer this month, and suspends the key until the end of the month once it is
+// over its quota
+func (q *APIKeyQuotas) recordTransfer(c *gin.Context, key APIKey) {
+	var transferred int64
+	if c.Request.ContentLength > 0 {
+		transferred += c.Request.ContentLength
+	}
+	if size := c.Writer.Size(); size > 0 {
+		transferred += int64(size)
+	}
+	if transferred == 0 {
+		return
+	}
+
+	// The transfer of requests the client gave up on counts as well
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), apiKeyQuotaTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	pipe := q.client.TxPipeline()
+	total := pipe.IncrBy(ctx, transferKey(key.ID, now), transferred)
+	pipe.ExpireNX(ctx, transferKey(key.ID, now), apiKeyUsageRetention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record the transfer of API key %s: %v", key.ID, err)
+		return
+	}
+
+	monthlyTransfer := effectiveQuota(key.MonthlyTransfer, q.monthlyTransfer)
+	if monthlyTransfer > 0 && total.Val() >= monthlyTransfer {
+		q.suspend(ctx, key, suspendedForTransfer, startOfNextMonth(now).Sub(now))
+	}
+}
+
+// suspend suspends key for d, unless it already is
+func (q *APIKeyQuotas) suspend(ctx context.Context, key APIKey, reason string, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	suspended, err := q.client.SetNX(ctx, suspendedKey(key.ID), reason, d).Result()
+	if err != nil {
+		log.Printf("Failed to suspend API key %s: %v", key.ID, err)
+		return
+	}
+	if suspended {
+		log.Printf("API key %s of user %s suspended for %s: %s", key.ID, key.UserID, d.Round(time.Second), reason)
+	}
+}
+
+// lift lifts the suspension of key
+func (q *APIKeyQuotas) lift(ctx context.Context, key APIKey) {
+	if err := q.client.Del(ctx, suspendedKey(key.ID)).Err(); err != nil {
+		log.Printf("Failed to lift the suspension of API key %s: %v", key.ID, err)
+		return
+	}
+	log.Printf("Suspension of API key %s of user %s lifted, its transfer quota was raised", key.ID, key.UserID)
+}
+
+// Usage returns the usage against their quotas of the API keys of a user used within
+// the last two months, including keys revoked since
+func (q *APIKeyQuotas) Usage(ctx context.Context, userID string) ([]APIKeyUsage, error) {
+	keyIDs, err := q.client.SMembers(ctx, userKeysKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	sort.Strings(keyIDs)
+
+	type keyUsage struct {
+		quotas       *redis.MapStringStringCmd
+		requests     *redis.StringCmd
+		transfer     *redis.StringCmd
+		reason       *redis.StringCmd
+		suspendedFor *redis.DurationCmd
+	}
+
+	now := time.Now().UTC()
+	pipe := q.client.Pipeline()
+	cmds := make([]keyUsage, len(keyIDs))
+	for i, keyID := range keyIDs {
+		cmds[i] = keyUsage{
+			quotas:       pipe.HGetAll(ctx, quotaKey(keyID)),
+			requests:     pipe.Get(ctx, requestsKey(keyID)),
+			transfer:     pipe.Get(ctx, transferKey(keyID, now)),
+			reason:       pipe.Get(ctx, suspendedKey(keyID)),
+			suspendedFor: pipe.PTTL(ctx, suspendedKey(keyID)),
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to get API key usage: %w", err)
+	}
+
+	usage := make([]APIKeyUsage, 0, len(keyIDs))
+	for i, keyID := range keyIDs {
+		quotas := cmds[i].quotas.Val()
+		// Keys are only shown to the user they were used by
+		if quotas["user_id"] != userID {
+			continue
+		}
+
+		entry := APIKeyUsage{KeyID: keyID}
+		entry.RateLimit, _ = strconv.ParseInt(quotas["rate_limit"], 10, 64)
+		entry.MonthlyTransfer, _ = strconv.ParseInt(quotas["monthly_transfer"], 10, 64)
+		entry.Requests, _ = cmds[i].requests.Int64()
+		entry.Transfer, _ = cmds[i].transfer.Int64()
+		if reason := cmds[i].reason.Val(); reason != "" {
+			until := now.Add(max(cmds[i].suspendedFor.Val(), 0))
+			entry.Suspended = true
+			entry.SuspensionReason = reason
+			entry.SuspendedUntil = &until
+		}
+		usage = append(usage, entry)
+	}
+	return usage, nil
+}
+
+// GetUsage returns the usage of the caller's API keys against their quotas
+// GET /api/v1/api-key-quotas
+func (q *APIKeyQuotas) GetUsage(c *gin.Context) {
+	usage, err := q.Usage(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		log.Printf("Failed to get API key usage: %v", err)
+		apierror.Abort(c, http.StatusServiceUnavailable, "Failed to get API key usage")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"month": time.Now().UTC().Format("2006-01"),
+		"keys":  usage,
+	})
+}
+
+// effectiveQuota returns the quota of a key: the one its owner set, unless it is zero or
+// above the gateway's
+func effectiveQuota(keyQuota, gatewayQuota int64) int64 {
+	if keyQuota > 0 && (gatewayQuota == 0 || keyQuota < gatewayQuota) {
+		return keyQuota
+	}
+	return gatewayQuota
+}
+
+// retryAfter formats d as a Retry-After header, in whole seconds
+func retryAfter(d time.Duration) string {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	return strconv.FormatInt(max(seconds, 1), 10)
+}
+
+// startOfNextMonth returns the start of the month after the one t is in
+func startOfNextMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+}
+
+func requestsKey(keyID string) string {
+	return apiKeyQuotaPrefix + keyID + ":requests"
+}
+
+func transferKey(keyID string, t time.Time) string {
+	return apiKeyQuotaPrefix + keyID + ":transfer:" + t.Format("2006-01")
+}
+
+func suspendedKey(keyID string) string {
+	return apiKeyQuotaPrefix + keyID + ":suspended"
+}
+
+func quotaKey(keyID string) string {
+	return apiKeyQuotaPrefix + keyID + ":quotas"
+}
+
+func userKeysKey(userID string) string {
+	return "gateway:apikeys:" + userID
+}
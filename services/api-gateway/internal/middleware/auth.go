@@ -1,42 +1,31 @@
 package middleware
 
 import (
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/reqctx"
 )
 
-// JWT Claims structure
-type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	jwt.RegisteredClaims
-}
-
 // AuthMiddleware validates JWT tokens and extracts user information
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Authorization header is required",
-			})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, "Authorization header is required")
 			return
 		}
 
 		// Check if header has Bearer prefix
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid authorization header format",
-			})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid authorization header format")
 			return
 		}
 
@@ -49,54 +38,53 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Parse and validate the token
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(jwtSecret), nil
-		})
-
+		claims, err := jwtauth.NewValidator(jwtSecret).ValidateToken(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token",
-			})
-			c.Abort()
-			return
-		}
-
-		// Check if token is valid
-		if !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token",
-			})
-			c.Abort()
+			message := "Invalid token"
+			if err == jwtauth.ErrExpiredToken {
+				message = "Token expired"
+			}
+			apierror.Abort(c, http.StatusUnauthorized, message)
 			return
 		}
 
-		// Extract claims
-		claims, ok := token.Claims.(*Claims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token claims",
-			})
-			c.Abort()
+		// Tokens issued before the user signed out everywhere or reset their password are
+		// rejected
+		if err := checkRevocation(c, claims); err != nil {
+			if errors.Is(err, jwtauth.ErrRevokedToken) {
+				apierror.Abort(c, http.StatusUnauthorized, "Token has been revoked")
+				return
+			}
+			log.Printf("Failed to check token revocation: %v", err)
+			apierror.Abort(c, http.StatusServiceUnavailable, "Failed to verify token")
 			return
 		}
 
-		// Check token expiration
-		if claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(time.Now()) {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Token expired",
-			})
-			c.Abort()
-			return
+		// Every request made while impersonating a user is audited, and rejected once the
+		// impersonation session has ended
+		if claims.ImpersonationID != "" {
+			if err := recordImpersonation(c, claims); err != nil {
+				apierror.Abort(c, http.StatusUnauthorized, "Impersonation session is not active")
+				return
+			}
+			c.Set("impersonator_id", claims.ImpersonatorID)
 		}
 
 		// Set user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
 		c.Set("token", tokenString)
+		if claims.OrgID != "" {
+			c.Set("org_id", claims.OrgID)
+			c.Set("org_role", claims.OrgRole)
+		}
+
+		// and in the request context, for the calls to the services
+		ctx := reqctx.WithUserID(c.Request.Context(), claims.UserID)
+		if claims.OrgID != "" {
+			ctx = reqctx.WithOrg(ctx, claims.OrgID, claims.OrgRole)
+		}
+		c.Request = c.Request.WithContext(ctx)
 
 		c.Next()
 	}
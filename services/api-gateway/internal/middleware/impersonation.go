@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+)
+
+// ImpersonationRecorder audits a request made with an impersonation token. It returns an
+// error when the impersonation session is no longer active.
+type ImpersonationRecorder func(ctx context.Context, claims *jwtauth.UserClaims, method, path, clientIP, userAgent string) error
+
+var impersonationRecorder ImpersonationRecorder
+
+// SetImpersonationRecorder sets the recorder used by AuthMiddleware. Impersonation tokens
+// are rejected until one is set.
+func SetImpersonationRecorder(recorder ImpersonationRecorder) {
+	impersonationRecorder = recorder
+}
+
+// recordImpersonation audits a request made with an impersonation token before it is
+// handled
+func recordImpersonation(c *gin.Context, claims *jwtauth.UserClaims) error {
+	if impersonationRecorder == nil {
+		return errors.New("impersonation tokens are not accepted")
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	return impersonationRecorder(ctx, claims, c.Request.Method, c.Request.URL.Path, c.ClientIP(), c.Request.UserAgent())
+}
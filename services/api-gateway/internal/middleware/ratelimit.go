@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
 )
 
 // Simple in-memory rate limiter
@@ -41,10 +42,7 @@ func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 		clientIP := c.ClientIP()
 
 		if !rl.allow(clientIP) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded. Please try again later.",
-			})
-			c.Abort()
+			apierror.Abort(c, http.StatusTooManyRequests, "Rate limit exceeded. Please try again later.")
 			return
 		}
 
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+)
+
+const (
+	// tokenRevocationPrefix prefixes the Redis keys the revocation times of users are
+	// cached under
+	tokenRevocationPrefix = "gateway:revoked:"
+	// tokenRevocationTimeout bounds the cache and lookup calls made for a request
+	tokenRevocationTimeout = 5 * time.Second
+)
+
+// TokenRevocations looks up when the tokens of users were last revoked, and caches the
+// answer in Redis for a short time, so that signed out sessions stop working at the
+// gateway within the cache's TTL. Without Redis every request is looked up.
+type TokenRevocations struct {
+	client *redis.Client
+	lookup jwtauth.RevocationLookup
+	ttl    time.Duration
+}
+
+// NewTokenRevocations creates revocation checks answered by lookup and cached in client
+// for ttl. client may be nil.
+func NewTokenRevocations(client *redis.Client, lookup jwtauth.RevocationLookup, ttl time.Duration) *TokenRevocations {
+	return &TokenRevocations{
+		client: client,
+		lookup: lookup,
+		ttl:    ttl,
+	}
+}
+
+var tokenRevocations *TokenRevocations
+
+// SetTokenRevocations sets the revocation checks used by AuthMiddleware. Tokens are not
+// checked for revocation until they are set.
+func SetTokenRevocations(revocations *TokenRevocations) {
+	tokenRevocations = revocations
+}
+
+// checkRevocation returns jwtauth.ErrRevokedToken if the token of claims has been revoked
+func checkRevocation(c *gin.Context, claims *jwtauth.UserClaims) error {
+	if tokenRevocations == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), tokenRevocationTimeout)
+	defer cancel()
+
+	return jwtauth.CheckRevocation(ctx, claims, tokenRevocations.revokedAt)
+}
+
+// revokedAt returns when the tokens of a user were last revoked, from the cache if it
+// has the answer. Cache failures fall back to the lookup.
+func (r *TokenRevocations) revokedAt(ctx context.Context, userID string) (time.Time, error) {
+	if r.client == nil {
+		return r.lookup(ctx, userID)
+	}
+
+	key := tokenRevocationPrefix + userID
+	cached, err := r.client.Get(ctx, key).Int64()
+	switch {
+	case err == nil:
+		if cached == 0 {
+			return time.Time{}, nil
+		}
+		return time.Unix(0, cached), nil
+	case !errors.Is(err, redis.Nil):
+		log.Printf("Failed to read token revocation of user %s from cache: %v", userID, err)
+	}
+
+	revokedAt, err := r.lookup(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var value int64
+	if !revokedAt.IsZero() {
+		value = revokedAt.UnixNano()
+	}
+	if err := r.client.Set(ctx, key, strconv.FormatInt(value, 10), r.ttl).Err(); err != nil {
+		log.Printf("Failed to cache token revocation of user %s: %v", userID, err)
+	}
+	return revokedAt, nil
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/reqctx"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+)
+
+// tenantSignInPaths are the routes on which callers who aren't signed in yet name their
+// tenant in X-Tenant-ID: signing in, registering and recovering an account, which all
+// look the user up by email within the tenant
+var tenantSignInPaths = map[string]bool{
+	"/api/v1/auth/login":               true,
+	"/api/v1/auth/register":            true,
+	"/api/v1/auth/forgot-password":     true,
+	"/api/v1/auth/resend-verification": true,
+}
+
+// TenantMiddleware decides the tenant each request is served for and passes it on in the
+// X-Tenant-ID header, replacing the one the client sent. Callers with a valid token are
+// served for the tenant of their token, and callers with an API key for the tenant of the
+// key's owner, which APIKeyMiddleware sets. X-Tenant-ID is only taken from the client on
+// the sign-in and registration routes; every other request is served for the default
+// tenant.
+func TenantMiddleware(jwtSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantID := ""
+		if tenantSignInPaths[c.Request.URL.Path] {
+			tenantID = c.GetHeader(tenant.Header)
+		}
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			if claims, err := jwtauth.NewValidator(jwtSecret).ValidateToken(authHeader); err == nil {
+				tenantID = claims.TenantID
+			}
+		}
+		if !tenant.Valid(tenantID) {
+			apierror.Abort(c, http.StatusBadRequest, "Invalid tenant ID")
+			return
+		}
+
+		setTenant(c, tenantID)
+		c.Next()
+	}
+}
+
+// setTenant serves the request for a tenant
+func setTenant(c *gin.Context, tenantID string) {
+	c.Request.Header.Set(tenant.Header, tenantID)
+	c.Set("tenant_id", tenantID)
+	c.Request = c.Request.WithContext(reqctx.WithTenantID(c.Request.Context(), tenantID))
+}
@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/reqctx"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+)
+
+const testJWTSecret = "test-secret"
+
+func testToken(t *testing.T, secret, tenantID string) string {
+	t.Helper()
+	claims := &jwtauth.UserClaims{
+		UserID:   "user-1",
+		TenantID: tenantID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// servedTenant records the tenant a request reached the handler with
+type servedTenant struct {
+	served  bool
+	header  string
+	ginKey  string
+	context string
+}
+
+func tenantRouter(served *servedTenant, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware...)
+	router.Any("/*path", func(c *gin.Context) {
+		served.served = true
+		served.header = c.Request.Header.Get(tenant.Header)
+		served.ginKey = c.GetString("tenant_id")
+		served.context, _ = reqctx.TenantID(c.Request.Context())
+	})
+	return router
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		tokenSecret  string
+		tokenTenant  string
+		tenantHeader string
+		wantStatus   int
+		wantTenant   string
+	}{
+		{
+			name:       "no token is served for the default tenant",
+			path:       "/api/v1/files",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "no token ignores the client's tenant",
+			path:         "/api/v1/files",
+			tenantHeader: "acme",
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "no token ignores an invalid client tenant",
+			path:         "/api/v1/shared/abc",
+			tenantHeader: "Not Valid",
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:        "token tenant",
+			path:        "/api/v1/files",
+			tokenSecret: testJWTSecret,
+			tokenTenant: "acme",
+			wantStatus:  http.StatusOK,
+			wantTenant:  "acme",
+		},
+		{
+			name:         "token tenant overrides the client's",
+			path:         "/api/v1/files",
+			tokenSecret:  testJWTSecret,
+			tokenTenant:  "acme",
+			tenantHeader: "other",
+			wantStatus:   http.StatusOK,
+			wantTenant:   "acme",
+		},
+		{
+			name:         "token of the default tenant overrides the client's",
+			path:         "/api/v1/files",
+			tokenSecret:  testJWTSecret,
+			tenantHeader: "other",
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "token with another secret is ignored",
+			path:         "/api/v1/files",
+			tokenSecret:  "another-secret",
+			tokenTenant:  "acme",
+			tenantHeader: "other",
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "sign in names the tenant",
+			path:         "/api/v1/auth/login",
+			tenantHeader: "acme",
+			wantStatus:   http.StatusOK,
+			wantTenant:   "acme",
+		},
+		{
+			name:         "registration names the tenant",
+			path:         "/api/v1/auth/register",
+			tenantHeader: "acme",
+			wantStatus:   http.StatusOK,
+			wantTenant:   "acme",
+		},
+		{
+			name:       "sign in without a tenant",
+			path:       "/api/v1/auth/login",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "sign in with an invalid tenant",
+			path:         "/api/v1/auth/login",
+			tenantHeader: "acme_corp",
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "sign in with a token uses the token's tenant",
+			path:         "/api/v1/auth/login",
+			tokenSecret:  testJWTSecret,
+			tokenTenant:  "acme",
+			tenantHeader: "other",
+			wantStatus:   http.StatusOK,
+			wantTenant:   "acme",
+		},
+		{
+			name:         "other auth routes ignore the client's tenant",
+			path:         "/api/v1/auth/orgs",
+			tenantHeader: "acme",
+			wantStatus:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var served servedTenant
+			router := tenantRouter(&served, TenantMiddleware(testJWTSecret))
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.tokenSecret != "" {
+				req.Header.Set("Authorization", testToken(t, tt.tokenSecret, tt.tokenTenant))
+			}
+			if tt.tenantHeader != "" {
+				req.Header.Set(tenant.Header, tt.tenantHeader)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if served.served {
+					t.Fatal("rejected request reached the handler")
+				}
+				return
+			}
+			if served.header != tt.wantTenant || served.ginKey != tt.wantTenant || served.context != tt.wantTenant {
+				t.Errorf("tenant = header %q, gin %q, context %q, want %q", served.header, served.ginKey, served.context, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestAPIKeyMiddlewareTenant(t *testing.T) {
+	keys := map[string]APIKey{
+		"dfs_acme":    {ID: "key-1", UserID: "user-1", TenantID: "acme"},
+		"dfs_default": {ID: "key-2", UserID: "user-2"},
+	}
+	SetAPIKeys(func(ctx context.Context, key string) (APIKey, error) {
+		apiKey, ok := keys[key]
+		if !ok {
+			return APIKey{}, ErrInvalidAPIKey
+		}
+		return apiKey, nil
+	}, nil)
+	t.Cleanup(func() { SetAPIKeys(nil, nil) })
+
+	tests := []struct {
+		name         string
+		apiKey       string
+		tenantHeader string
+		wantStatus   int
+		wantTenant   string
+	}{
+		{"key of a tenant", "dfs_acme", "", http.StatusOK, "acme"},
+		{"key tenant overrides the client's", "dfs_acme", "other", http.StatusOK, "acme"},
+		{"key of the default tenant overrides the client's", "dfs_default", "acme", http.StatusOK, ""},
+		{"unknown key", "dfs_unknown", "acme", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var served servedTenant
+			router := tenantRouter(&served, TenantMiddleware(testJWTSecret), APIKeyMiddleware())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
+			req.Header.Set(APIKeyHeader, tt.apiKey)
+			if tt.tenantHeader != "" {
+				req.Header.Set(tenant.Header, tt.tenantHeader)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if served.served {
+					t.Fatal("rejected request reached the handler")
+				}
+				return
+			}
+			if served.header != tt.wantTenant || served.ginKey != tt.wantTenant || served.context != tt.wantTenant {
+				t.Errorf("tenant = header %q, gin %q, context %q, want %q", served.header, served.ginKey, served.context, tt.wantTenant)
+			}
+		})
+	}
+}
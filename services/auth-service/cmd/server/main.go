@@ -8,16 +8,35 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	// Embedded zone data so user timezones validate in minimal containers
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/cli"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/faults"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/grpcmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/migrate"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/secrets"
 	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/config"
 	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/database"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/files"
 	grpcHandler "github.com/yourusername/distributed-file-sharing/services/auth-service/internal/grpc"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/migrations"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/notification"
 	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/scim"
 	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/userevents"
 	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -25,49 +44,237 @@ import (
 )
 
 func main() {
+	cli.Execute(cli.Service{
+		Name: "auth-service",
+		Run:  run,
+		HealthURL: func() string {
+			return "http://localhost:" + env.String("AUTH_SERVICE_PORT", "8081") + "/health"
+		},
+	})
+}
+
+// run runs the parts of the auth service the process was started for: the gRPC API and
+// the REST gateway in front of it
+func run(process cli.Process) {
 	// Load configuration
+	if err := env.Load(); err != nil {
+		log.Fatalf("Failed to load environment file: %v", err)
+	}
+	if _, err := secrets.Load(context.Background()); err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
 	cfg := config.Load()
 
-	// Initialize MongoDB
-	mongodb, err := database.NewMongoDB(cfg.MongoURI, cfg.MongoDatabase, cfg.MongoTimeout)
+	// Inject faults for resilience testing when enabled
+	faultInjector := faults.FromEnv()
+	if faultInjector != nil {
+		log.Printf("Fault injection enabled: %s", faultInjector)
+	}
+
+	// Initialize MongoDB, exposing the driver's connection pool in the metrics
+	mongodb, err := database.NewMongoDB(cfg.MongoURI, cfg.MongoDatabase, cfg.MongoTimeout, faultInjector.MongoOptions(), poolmetrics.MongoOptions("auth-service"))
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
 	defer mongodb.Close(context.Background())
 
+	// Apply the pending MongoDB migrations, or manage them with the migrate subcommand
+	migrator := migrate.New(mongodb.Database, "auth-service", migrations.All(cfg), nil)
+	if process.Migrating {
+		migrateCtx, migrateCancel := context.WithTimeout(context.Background(), migrate.DefaultTimeout)
+		defer migrateCancel()
+		if err := migrator.Command(migrateCtx, process.MigrateArgs, os.Stdout); err != nil {
+			log.Printf("Migration failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if cfg.MigrateOnStartup {
+		migrateCtx, migrateCancel := context.WithTimeout(context.Background(), migrate.DefaultTimeout)
+		applied, err := migrator.Run(migrateCtx)
+		migrateCancel()
+		if err != nil {
+			log.Fatalf("Failed to apply MongoDB migrations: %v", err)
+		}
+		log.Printf("Applied %d MongoDB migrations", applied)
+	}
+
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(mongodb.Database)
+	passwordResetRepo := repository.NewPasswordResetRepository(mongodb.Database)
+	emailVerificationRepo := repository.NewEmailVerificationRepository(mongodb.Database)
+	loginEventRepo := repository.NewLoginEventRepository(mongodb.Database)
+	groupRepo := repository.NewGroupRepository(mongodb.Database)
+	orgRepo := repository.NewOrganizationRepository(mongodb.Database)
+	invitationRepo := repository.NewInvitationRepository(mongodb.Database)
+	auditRepo := repository.NewAuditEventRepository(mongodb.Database)
+	impersonationRepo := repository.NewImpersonationRepository(mongodb.Database)
+	signupDomainRepo := repository.NewSignupDomainRepository(mongodb.Database)
 
 	// Initialize services
 	jwtService := service.NewJWTService(cfg.JWTSecret, cfg.JWTExpiry, cfg.JWTRefreshExpiry)
 	passwordService := service.NewPasswordService()
+	passwordPolicy := service.NewPasswordPolicyService(models.PasswordPolicy{
+		MinLength:        cfg.PasswordMinLength,
+		RequireUppercase: cfg.PasswordRequireUppercase,
+		RequireLowercase: cfg.PasswordRequireLowercase,
+		RequireDigit:     cfg.PasswordRequireDigit,
+		RequireSymbol:    cfg.PasswordRequireSymbol,
+		DenyCommon:       cfg.PasswordDenyCommon,
+		CheckBreached:    cfg.PasswordBreachCheck,
+	}, service.NewBreachChecker(cfg.PasswordBreachAPIURL, time.Duration(cfg.PasswordBreachTimeout)*time.Second))
+	serviceTokenService := service.NewServiceTokenService(cfg.ServiceTokenSecret, cfg.ServiceTokenExpiry, cfg.ServiceClients)
+
+	// Report the state of the dependencies for the health, liveness and readiness probes
+	healthHandler := health.New("auth-service", "1.0.0").AddCheck("mongodb", func(ctx context.Context) error {
+		return mongodb.Client.Ping(ctx, nil)
+	})
+
+	// Initialize login protection and endpoint rate limits (counters live in Redis)
+	var loginProtection *service.LoginProtectionService
+	var rateLimiter *service.RateLimitService
+	if cfg.RedisEnabled {
+		redisClient, err := database.NewRedis(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, 5*time.Second)
+		if err != nil {
+			log.Printf("Warning: failed to connect to Redis, account lockout and rate limiting are disabled: %v", err)
+		} else {
+			defer redisClient.Close()
+			database.RegisterPoolMetrics(redisClient)
+			healthHandler.AddOptionalCheck("redis", func(ctx context.Context) error {
+				return redisClient.Ping(ctx).Err()
+			})
+			loginProtection = service.NewLoginProtectionService(
+				redisClient,
+				cfg.LoginMaxAccountFailures,
+				cfg.LoginMaxIPFailures,
+				cfg.LoginDelayAfterFailures,
+				time.Duration(cfg.LoginFailureWindow)*time.Second,
+				time.Duration(cfg.LoginLockoutDuration)*time.Second,
+				time.Duration(cfg.LoginMaxDelay)*time.Second,
+			)
+			log.Printf("Login protection enabled (lockout after %d failed attempts per account, %d per IP)", cfg.LoginMaxAccountFailures, cfg.LoginMaxIPFailures)
+
+			rateLimiter = service.NewRateLimitService(redisClient, time.Duration(cfg.RateLimitWindow)*time.Second, map[string]service.RateLimit{
+				service.RateLimitLogin:         {PerIP: cfg.LoginRateLimitPerIP, PerAccount: cfg.LoginRateLimitPerAccount},
+				service.RateLimitRegister:      {PerIP: cfg.RegisterRateLimitPerIP, PerAccount: cfg.RegisterRateLimitPerAccount},
+				service.RateLimitPasswordReset: {PerIP: cfg.PasswordResetRateLimitPerIP, PerAccount: cfg.PasswordResetRateLimitPerAccount},
+				// Verification emails are limited by address rather than account, so that
+				// the limit doesn't reveal which addresses are registered
+				service.RateLimitVerificationResend: {PerAccount: int64(cfg.VerificationResendPerHour), Window: time.Hour},
+				// Searches are limited per user, so that the directory can't be enumerated
+				service.RateLimitUserSearch: {PerAccount: int64(cfg.UserSearchPerMinute), Window: time.Minute},
+				// Invitations are limited per inviter, so that they can't be used to spam
+				service.RateLimitInvitation: {PerAccount: int64(cfg.InvitationsPerHour), Window: time.Hour},
+			})
+		}
+	}
+
+	// CAPTCHA verification is only enabled when a provider is configured
+	var captchaVerifier *service.CaptchaVerifier
+	if cfg.CaptchaProvider != "" {
+		captchaVerifier, err = service.NewCaptchaVerifier(cfg.CaptchaProvider, cfg.CaptchaSecret, cfg.CaptchaVerifyURL, time.Duration(cfg.CaptchaTimeout)*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid CAPTCHA configuration: %v", err)
+		}
+		log.Printf("CAPTCHA verification enabled with %s", cfg.CaptchaProvider)
+	}
+
+	// Signup restrictions from the configuration; administrators can add rules at runtime
+	signupDomains, err := newSignupDomainPolicy(cfg)
+	if err != nil {
+		log.Fatalf("Invalid signup domain configuration: %v", err)
+	}
+
+	// Initialize notification client for account emails and security alerts
+	var notificationOpts []grpc.DialOption
+	if cfg.ServiceAuthEnabled {
+		notificationOpts = append(notificationOpts, grpc.WithPerRPCCredentials(grpcHandler.NewServiceTokenCredentials(serviceTokenService, cfg.ServiceName, "notification-service")))
+	}
+	notificationClient, err := notification.NewClient(cfg.NotificationServiceGRPC, notificationOpts...)
+	if err != nil {
+		log.Fatalf("Failed to create notification client: %v", err)
+	}
+	defer notificationClient.Close()
+
+	// Initialize file-service client for uploaded avatars and linking invitees' shared files
+	var fileOpts []grpc.DialOption
+	if cfg.ServiceAuthEnabled {
+		fileOpts = append(fileOpts, grpc.WithPerRPCCredentials(grpcHandler.NewServiceTokenCredentials(serviceTokenService, cfg.ServiceName, "file-service")))
+	}
+	fileClient, err := files.NewClient(cfg.FileServiceGRPC, fileOpts...)
+	if err != nil {
+		log.Fatalf("Failed to create file service client: %v", err)
+	}
+	defer fileClient.Close()
+	healthHandler.AddOptionalCheck("notification-service", notificationClient.HealthCheck).
+		AddOptionalCheck("file-service", fileClient.HealthCheck)
 
 	// Initialize gRPC handler
-	authHandler := grpcHandler.NewAuthHandler(userRepo, jwtService, passwordService)
+	authHandler := grpcHandler.NewAuthHandler(userRepo, passwordResetRepo, emailVerificationRepo, loginEventRepo, orgRepo, invitationRepo, auditRepo, impersonationRepo, signupDomainRepo, jwtService, passwordService, passwordPolicy, signupDomains, serviceTokenService, loginProtection, rateLimiter, captchaVerifier, notificationClient, fileClient, cfg)
+
+	// Publish user events, for the file-service to link the files shared with new users' emails
+	var userEvents *userevents.Publisher
+	if len(cfg.KafkaBrokers) > 0 {
+		userEvents = userevents.NewPublisher(cfg.KafkaBrokers)
+		defer userEvents.Close()
+		authHandler.SetUserEvents(userEvents)
+		log.Printf("Publishing user events to %v", cfg.KafkaBrokers)
+	} else {
+		log.Println("KAFKA_BROKERS is not set, user events will not be published")
+	}
 
 	// Start gRPC server
-	grpcServer := grpc.NewServer()
+	grpcOpts := grpcmw.Options{
+		Service:        cfg.ServiceName,
+		Logger:         log.Default(),
+		DefaultTimeout: cfg.GRPCDefaultTimeout,
+		Faults:         faultInjector,
+	}
+	if cfg.ServiceAuthEnabled {
+		// Token issuance is the only call a service can make before it holds a token
+		grpcOpts.Auth = grpcHandler.NewServiceAuthInterceptor(serviceTokenService, cfg.ServiceName, "/auth.v1.AuthService/IssueServiceToken")
+		log.Printf("Service-to-service authentication enabled (%d registered clients)", len(cfg.ServiceClients))
+	}
+
+	grpcServer := grpc.NewServer(grpcmw.ServerOptions(grpcOpts)...)
 	authv1.RegisterAuthServiceServer(grpcServer, authHandler)
 	reflection.Register(grpcServer)
 
-	grpcListener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", cfg.ServiceHost, cfg.GRPCPort))
-	if err != nil {
-		log.Fatalf("Failed to listen on gRPC port: %v", err)
+	if process.GRPC {
+		grpcListener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", cfg.ServiceHost, cfg.GRPCPort))
+		if err != nil {
+			log.Fatalf("Failed to listen on gRPC port: %v", err)
+		}
+
+		go func() {
+			log.Printf("Auth Service gRPC server listening on :%s", cfg.GRPCPort)
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				log.Fatalf("Failed to serve gRPC: %v", err)
+			}
+		}()
 	}
 
-	go func() {
-		log.Printf("Auth Service gRPC server listening on :%s", cfg.GRPCPort)
-		if err := grpcServer.Serve(grpcListener); err != nil {
-			log.Fatalf("Failed to serve gRPC: %v", err)
+	// SCIM provisioning is only exposed when a bearer token is configured
+	var scimHandler *scim.Handler
+	if cfg.SCIMBearerToken != "" {
+		scimHandler = scim.NewHandler(userRepo, groupRepo, orgRepo, auditRepo, cfg)
+		if userEvents != nil {
+			scimHandler.SetUserEvents(userEvents)
 		}
-	}()
+		log.Println("SCIM provisioning enabled at /scim/v2")
+	}
 
-	// Start gRPC Gateway (REST API)
-	go func() {
-		if err := startGRPCGateway(cfg); err != nil {
-			log.Fatalf("Failed to start gRPC Gateway: %v", err)
-		}
-	}()
+	// Start gRPC Gateway (REST API), or only serve the health probes and metrics
+	if process.HTTP {
+		go func() {
+			if err := startGRPCGateway(cfg, serviceTokenService, authHandler, scimHandler, healthHandler); err != nil {
+				log.Fatalf("Failed to start gRPC Gateway: %v", err)
+			}
+		}()
+	} else {
+		probeServer := cli.ProbeServer(cfg.ServicePort, healthHandler, log.Default())
+		defer probeServer.Close()
+	}
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
@@ -81,42 +288,67 @@ func main() {
 	log.Println("Auth Service stopped")
 }
 
-func startGRPCGateway(cfg *config.Config) error {
+func startGRPCGateway(cfg *config.Config, serviceTokenService *service.ServiceTokenService, authHandler *grpcHandler.AuthHandler, scimHandler *scim.Handler, healthHandler *health.Handler) error {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	// Create gRPC-Gateway mux
-	mux := runtime.NewServeMux()
+	// Create gRPC-Gateway mux. The geo country header set by the CDN is forwarded as-is
+	// for login anomaly detection.
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+		if cfg.GeoCountryHeader != "" && strings.EqualFold(key, cfg.GeoCountryHeader) {
+			return cfg.GeoCountryHeader, true
+		}
+		return runtime.DefaultHeaderMatcher(key)
+	}))
 
-	// Setup gRPC connection to local gRPC server
+	// Setup gRPC connection to the gRPC server, which is local unless the REST API is
+	// served on its own
 	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
-	grpcEndpoint := fmt.Sprintf("localhost:%s", cfg.GRPCPort)
+	if cfg.ServiceAuthEnabled {
+		opts = append(opts, grpc.WithPerRPCCredentials(grpcHandler.NewServiceTokenCredentials(serviceTokenService, cfg.ServiceName, cfg.ServiceName)))
+	}
 
 	// Register Auth Service handler
-	err := authv1.RegisterAuthServiceHandlerFromEndpoint(ctx, mux, grpcEndpoint, opts)
+	err := authv1.RegisterAuthServiceHandlerFromEndpoint(ctx, mux, cfg.GRPCEndpoint, opts)
 	if err != nil {
 		return fmt.Errorf("failed to register auth service handler: %w", err)
 	}
 
+	// Avatars are served as redirects rather than through gRPC
+	if err := mux.HandlePath(http.MethodGet, "/api/v1/auth/user/{user_id}/avatar", authHandler.ServeAvatar); err != nil {
+		return fmt.Errorf("failed to register avatar handler: %w", err)
+	}
+
+	// RFC 7662 token introspection for registered service clients. It is served by the
+	// auth-service only and not routed through the public gateway.
+	if err := mux.HandlePath(http.MethodPost, "/api/v1/auth/introspect", authHandler.ServeIntrospection); err != nil {
+		return fmt.Errorf("failed to register introspection handler: %w", err)
+	}
+
+	// User statistics of the admin analytics, for operators holding the analytics API
+	// token. They are not routed through the public gateway.
+	if err := mux.HandlePath(http.MethodGet, "/api/v1/admin/stats", authHandler.ServeStats); err != nil {
+		return fmt.Errorf("failed to register stats handler: %w", err)
+	}
+
 	// Create Gin router for additional middleware and features
 	router := gin.Default()
 
 	// CORS middleware
-	router.Use(corsMiddleware())
+	router.Use(ginmw.CORS(ginmw.DefaultCORSConfig()))
 
 	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"service": "auth-service",
-			"version": "1.0.0",
-		})
-	})
+	healthHandler.Register(router)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// Mount gRPC-Gateway
 	router.Any("/api/*path", gin.WrapH(mux))
 
+	if scimHandler != nil {
+		scimHandler.RegisterRoutes(router.Group("/scim/v2"))
+	}
+
 	// Start HTTP server
 	httpAddr := fmt.Sprintf("%s:%s", cfg.ServiceHost, cfg.ServicePort)
 	log.Printf("Auth Service REST API (gRPC-Gateway) listening on %s", httpAddr)
@@ -132,18 +364,27 @@ func startGRPCGateway(cfg *config.Config) error {
 	return server.ListenAndServe()
 }
 
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+// newSignupDomainPolicy creates the signup domain policy from the configured domain lists
+func newSignupDomainPolicy(cfg *config.Config) (*service.SignupDomainPolicy, error) {
+	normalize := func(domains []string) ([]string, error) {
+		normalized := make([]string, 0, len(domains))
+		for _, domain := range domains {
+			d, err := service.NormalizeDomain(domain)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q", err, domain)
+			}
+			normalized = append(normalized, d)
 		}
+		return normalized, nil
+	}
 
-		c.Next()
+	allowed, err := normalize(cfg.SignupAllowedDomains)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := normalize(cfg.SignupBlockedDomains)
+	if err != nil {
+		return nil, err
 	}
+	return service.NewSignupDomainPolicy(allowed, blocked, cfg.SignupBlockDisposableDomains), nil
 }
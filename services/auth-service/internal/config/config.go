@@ -1,9 +1,10 @@
 package config
 
 import (
-	"os"
-	"strconv"
+	"strings"
 	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
 )
 
 type Config struct {
@@ -18,30 +19,309 @@ type Config struct {
 	JWTRefreshExpiry int64
 	Environment      string
 	LogLevel         string
+
+	// GRPCEndpoint is the gRPC server the REST gateway forwards to. A serve-http process
+	// reaches the serve-grpc processes through it.
+	GRPCEndpoint string
+
+	// GRPCDefaultTimeout is the deadline given to gRPC calls that arrive without one
+	GRPCDefaultTimeout time.Duration
+
+	// Service-to-service authentication
+	ServiceAuthEnabled bool
+	ServiceName        string
+	ServiceTokenSecret string
+	ServiceTokenExpiry int64
+	ServiceClients     map[string]string
+
+	// Account emails (password reset, email verification)
+	NotificationServiceGRPC   string
+	PasswordResetExpiry       int64
+	EmailVerificationExpiry   int64
+	VerificationResendPerHour int
+	FrontendURL               string
+
+	// Profile
+	FileServiceGRPC string
+	PublicURL       string
+	AvatarMaxSize   int64
+
+	// KafkaBrokers receive the user events other services act on, such as linking the
+	// files shared with an email address to the account registered for it. Events aren't
+	// published when it's empty.
+	KafkaBrokers []string
+
+	// User search for sharing
+	UserSearchPerMinute int
+
+	// Password policy, which organizations can tighten for their members
+	PasswordMinLength        int
+	PasswordRequireUppercase bool
+	PasswordRequireLowercase bool
+	PasswordRequireDigit     bool
+	PasswordRequireSymbol    bool
+	PasswordDenyCommon       bool
+	PasswordBreachCheck      bool
+	PasswordBreachAPIURL     string
+	PasswordBreachTimeout    int64
+
+	// CAPTCHA, disabled when no provider is set
+	CaptchaProvider           string
+	CaptchaSiteKey            string
+	CaptchaSecret             string
+	CaptchaVerifyURL          string
+	CaptchaTimeout            int64
+	CaptchaOnRegister         bool
+	CaptchaAfterLoginFailures int
+
+	// Invitations
+	InvitationExpiry   int64
+	InvitationsPerHour int
+
+	// SCIM provisioning, disabled when no bearer token is set
+	SCIMBearerToken string
+
+	// User statistics of the admin analytics, disabled when no bearer token is set
+	AnalyticsAPIToken string
+
+	// Pending MongoDB migrations are applied on startup if MigrateOnStartup is set, and
+	// otherwise only by the migrate subcommand
+	MigrateOnStartup bool
+
+	// AdminEmails lists the service administrators, in lower case. Their accounts must
+	// have a verified email.
+	AdminEmails []string
+
+	// Signup restrictions by email domain, in addition to the rules managed by admins
+	SignupAllowedDomains         []string
+	SignupBlockedDomains         []string
+	SignupBlockDisposableDomains bool
+
+	// Redis
+	RedisEnabled  bool
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	// Login protection
+	LoginMaxAccountFailures int64
+	LoginMaxIPFailures      int64
+	LoginDelayAfterFailures int64
+	LoginFailureWindow      int64
+	LoginLockoutDuration    int64
+	LoginMaxDelay           int64
+	SecurityAlertEmail      string
+
+	// Rate limits on login, registration and password reset, per window. Zero disables a limit.
+	RateLimitWindow                  int64
+	LoginRateLimitPerIP              int64
+	LoginRateLimitPerAccount         int64
+	RegisterRateLimitPerIP           int64
+	RegisterRateLimitPerAccount      int64
+	PasswordResetRateLimitPerIP      int64
+	PasswordResetRateLimitPerAccount int64
+
+	// Login anomaly detection
+	LoginAnomalyEnabled   bool
+	LoginHistoryRetention int64
+	LoginReportExpiry     int64
+	GeoCountryHeader      string
+
+	// Audit log
+	AuditLogRetention int64
+
+	// Impersonation
+	ImpersonationRequestExpiry   int64
+	ImpersonationSessionDuration int64
 }
 
 func Load() *Config {
-	jwtExpiry, _ := strconv.ParseInt(getEnv("JWT_EXPIRY", "3600"), 10, 64)
-	jwtRefreshExpiry, _ := strconv.ParseInt(getEnv("JWT_REFRESH_EXPIRY", "604800"), 10, 64)
+	jwtExpiry := env.Int64("JWT_EXPIRY", 3600)
+	jwtRefreshExpiry := env.Int64("JWT_REFRESH_EXPIRY", 604800)
+	serviceTokenExpiry := env.Int64("SERVICE_TOKEN_EXPIRY", 300)
+	passwordResetExpiry := env.Int64("PASSWORD_RESET_EXPIRY", 1800)
+	emailVerificationExpiry := env.Int64("EMAIL_VERIFICATION_EXPIRY", 86400)
+	verificationResendPerHour := env.Int("VERIFICATION_RESEND_PER_HOUR", 5)
+	if verificationResendPerHour <= 0 {
+		verificationResendPerHour = 5
+	}
+	redisDB := env.Int("REDIS_DB", 0)
+	loginMaxAccountFailures := env.Int64("LOGIN_MAX_ACCOUNT_FAILURES", 5)
+	loginMaxIPFailures := env.Int64("LOGIN_MAX_IP_FAILURES", 50)
+	loginDelayAfterFailures := env.Int64("LOGIN_DELAY_AFTER_FAILURES", 3)
+	loginFailureWindow := env.Int64("LOGIN_FAILURE_WINDOW", 900)
+	loginLockoutDuration := env.Int64("LOGIN_LOCKOUT_DURATION", 900)
+	loginMaxDelay := env.Int64("LOGIN_MAX_DELAY", 30)
+	rateLimitWindow := env.Int64("AUTH_RATE_LIMIT_WINDOW", 60)
+	if rateLimitWindow <= 0 {
+		rateLimitWindow = 60
+	}
+	loginRateLimitPerIP := env.Int64("LOGIN_RATE_LIMIT_PER_IP", 30)
+	loginRateLimitPerAccount := env.Int64("LOGIN_RATE_LIMIT_PER_ACCOUNT", 10)
+	registerRateLimitPerIP := env.Int64("REGISTER_RATE_LIMIT_PER_IP", 5)
+	registerRateLimitPerAccount := env.Int64("REGISTER_RATE_LIMIT_PER_ACCOUNT", 3)
+	passwordResetRateLimitPerIP := env.Int64("PASSWORD_RESET_RATE_LIMIT_PER_IP", 10)
+	passwordResetRateLimitPerAccount := env.Int64("PASSWORD_RESET_RATE_LIMIT_PER_ACCOUNT", 3)
+	userSearchPerMinute := env.Int("USER_SEARCH_PER_MINUTE", 30)
+	if userSearchPerMinute <= 0 {
+		userSearchPerMinute = 30
+	}
+	passwordMinLength := env.Int("PASSWORD_MIN_LENGTH", 8)
+	passwordBreachTimeout := env.Int64("PASSWORD_BREACH_TIMEOUT", 3)
+	if passwordBreachTimeout <= 0 {
+		passwordBreachTimeout = 3
+	}
+	captchaTimeout := env.Int64("CAPTCHA_TIMEOUT", 5)
+	if captchaTimeout <= 0 {
+		captchaTimeout = 5
+	}
+	captchaAfterLoginFailures := env.Int("CAPTCHA_AFTER_LOGIN_FAILURES", 3)
+	if captchaAfterLoginFailures < 0 {
+		captchaAfterLoginFailures = 0
+	}
+	invitationExpiry := env.Int64("INVITATION_EXPIRY", 604800)
+	invitationsPerHour := env.Int("INVITATIONS_PER_HOUR", 20)
+	if invitationsPerHour <= 0 {
+		invitationsPerHour = 20
+	}
+	avatarMaxSize := env.Int64("AVATAR_MAX_SIZE", 5242880)
+	loginHistoryRetention := env.Int64("LOGIN_HISTORY_RETENTION", 7776000)
+	loginReportExpiry := env.Int64("LOGIN_REPORT_EXPIRY", 604800)
+	auditLogRetention := env.Int64("AUDIT_LOG_RETENTION", 31536000)
+	if auditLogRetention < 0 {
+		auditLogRetention = 0
+	}
+	impersonationRequestExpiry := env.Int64("IMPERSONATION_REQUEST_EXPIRY", 86400)
+	if impersonationRequestExpiry <= 0 {
+		impersonationRequestExpiry = 86400
+	}
+	impersonationSessionDuration := env.Int64("IMPERSONATION_SESSION_DURATION", 1800)
+	if impersonationSessionDuration <= 0 {
+		impersonationSessionDuration = 1800
+	}
 
 	return &Config{
-		ServicePort:      getEnv("AUTH_SERVICE_PORT", "8081"),
-		GRPCPort:         getEnv("AUTH_GRPC_PORT", "50051"),
-		ServiceHost:      getEnv("AUTH_SERVICE_HOST", "0.0.0.0"),
-		MongoURI:         getEnv("MONGO_URI", "mongodb://localhost:27017"),
-		MongoDatabase:    getEnv("MONGO_DATABASE", "file_sharing"),
+		ServicePort:      env.String("AUTH_SERVICE_PORT", "8081"),
+		GRPCPort:         env.String("AUTH_GRPC_PORT", "50051"),
+		ServiceHost:      env.String("AUTH_SERVICE_HOST", "0.0.0.0"),
+		GRPCEndpoint:     env.String("AUTH_GRPC_ENDPOINT", "localhost:"+env.String("AUTH_GRPC_PORT", "50051")),
+		MongoURI:         env.String("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDatabase:    env.String("MONGO_DATABASE", "file_sharing"),
 		MongoTimeout:     10 * time.Second,
-		JWTSecret:        getEnv("JWT_SECRET", "your-super-secret-key-change-in-production"),
+		JWTSecret:        env.String("JWT_SECRET", "your-super-secret-key-change-in-production"),
 		JWTExpiry:        jwtExpiry,
 		JWTRefreshExpiry: jwtRefreshExpiry,
-		Environment:      getEnv("ENVIRONMENT", "development"),
-		LogLevel:         getEnv("LOG_LEVEL", "info"),
+		Environment:      env.String("ENVIRONMENT", "development"),
+		LogLevel:         env.String("LOG_LEVEL", "info"),
+
+		GRPCDefaultTimeout: env.Duration("GRPC_DEFAULT_TIMEOUT", 60*time.Second),
+
+		ServiceAuthEnabled: env.Bool("SERVICE_AUTH_ENABLED", false),
+		ServiceName:        env.String("SERVICE_NAME", "auth-service"),
+		ServiceTokenSecret: env.String("SERVICE_TOKEN_SECRET", "your-service-token-secret-change-in-production"),
+		ServiceTokenExpiry: serviceTokenExpiry,
+		ServiceClients:     parseServiceClients(env.String("SERVICE_CLIENTS", "")),
+
+		NotificationServiceGRPC:   env.String("NOTIFICATION_SERVICE_GRPC", "localhost:50054"),
+		PasswordResetExpiry:       passwordResetExpiry,
+		EmailVerificationExpiry:   emailVerificationExpiry,
+		VerificationResendPerHour: verificationResendPerHour,
+		FrontendURL:               strings.TrimRight(env.String("FRONTEND_URL", "http://localhost:3000"), "/"),
+
+		FileServiceGRPC: env.String("FILE_SERVICE_GRPC", "localhost:50052"),
+		PublicURL:       strings.TrimRight(env.String("AUTH_PUBLIC_URL", "http://localhost:8081"), "/"),
+		AvatarMaxSize:   avatarMaxSize,
+
+		KafkaBrokers: env.List("KAFKA_BROKERS", nil),
+
+		UserSearchPerMinute: userSearchPerMinute,
+
+		PasswordMinLength:        passwordMinLength,
+		PasswordRequireUppercase: env.Bool("PASSWORD_REQUIRE_UPPERCASE", false),
+		PasswordRequireLowercase: env.Bool("PASSWORD_REQUIRE_LOWERCASE", false),
+		PasswordRequireDigit:     env.Bool("PASSWORD_REQUIRE_DIGIT", false),
+		PasswordRequireSymbol:    env.Bool("PASSWORD_REQUIRE_SYMBOL", false),
+		PasswordDenyCommon:       env.Bool("PASSWORD_DENY_COMMON", true),
+		PasswordBreachCheck:      env.Bool("PASSWORD_BREACH_CHECK", false),
+		PasswordBreachAPIURL:     env.String("PASSWORD_BREACH_API_URL", "https://api.pwnedpasswords.com"),
+		PasswordBreachTimeout:    passwordBreachTimeout,
+
+		CaptchaProvider:           strings.ToLower(env.String("CAPTCHA_PROVIDER", "")),
+		CaptchaSiteKey:            env.String("CAPTCHA_SITE_KEY", ""),
+		CaptchaSecret:             env.String("CAPTCHA_SECRET", ""),
+		CaptchaVerifyURL:          env.String("CAPTCHA_VERIFY_URL", ""),
+		CaptchaTimeout:            captchaTimeout,
+		CaptchaOnRegister:         env.Bool("CAPTCHA_ON_REGISTER", true),
+		CaptchaAfterLoginFailures: captchaAfterLoginFailures,
+
+		InvitationExpiry:   invitationExpiry,
+		InvitationsPerHour: invitationsPerHour,
+
+		SCIMBearerToken: env.String("SCIM_BEARER_TOKEN", ""),
+
+		AnalyticsAPIToken: env.String("ANALYTICS_API_TOKEN", ""),
+
+		MigrateOnStartup: env.Bool("MIGRATE_ON_STARTUP", true),
+
+		AdminEmails: parseList(env.String("ADMIN_EMAILS", "")),
+
+		SignupAllowedDomains:         parseList(env.String("SIGNUP_ALLOWED_DOMAINS", "")),
+		SignupBlockedDomains:         parseList(env.String("SIGNUP_BLOCKED_DOMAINS", "")),
+		SignupBlockDisposableDomains: env.Bool("SIGNUP_BLOCK_DISPOSABLE_DOMAINS", false),
+
+		RedisEnabled:  env.Bool("REDIS_ENABLED", true),
+		RedisAddr:     env.String("REDIS_ADDR", "localhost:6379"),
+		RedisPassword: env.String("REDIS_PASSWORD", ""),
+		RedisDB:       redisDB,
+
+		LoginMaxAccountFailures: loginMaxAccountFailures,
+		LoginMaxIPFailures:      loginMaxIPFailures,
+		LoginDelayAfterFailures: loginDelayAfterFailures,
+		LoginFailureWindow:      loginFailureWindow,
+		LoginLockoutDuration:    loginLockoutDuration,
+		LoginMaxDelay:           loginMaxDelay,
+		SecurityAlertEmail:      env.String("SECURITY_ALERT_EMAIL", ""),
+
+		RateLimitWindow:                  rateLimitWindow,
+		LoginRateLimitPerIP:              loginRateLimitPerIP,
+		LoginRateLimitPerAccount:         loginRateLimitPerAccount,
+		RegisterRateLimitPerIP:           registerRateLimitPerIP,
+		RegisterRateLimitPerAccount:      registerRateLimitPerAccount,
+		PasswordResetRateLimitPerIP:      passwordResetRateLimitPerIP,
+		PasswordResetRateLimitPerAccount: passwordResetRateLimitPerAccount,
+
+		LoginAnomalyEnabled:   env.Bool("LOGIN_ANOMALY_ENABLED", true),
+		LoginHistoryRetention: loginHistoryRetention,
+		LoginReportExpiry:     loginReportExpiry,
+		GeoCountryHeader:      strings.ToLower(env.String("GEO_COUNTRY_HEADER", "cf-ipcountry")),
+
+		AuditLogRetention: auditLogRetention,
+
+		ImpersonationRequestExpiry:   impersonationRequestExpiry,
+		ImpersonationSessionDuration: impersonationSessionDuration,
+	}
+}
+
+// parseList parses a comma-separated list into lower-case entries, skipping empty ones
+func parseList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			entries = append(entries, entry)
+		}
 	}
+	return entries
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// parseServiceClients parses "client-id:secret,client-id:secret" into a credential map
+func parseServiceClients(value string) map[string]string {
+	clients := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		clients[parts[0]] = parts[1]
 	}
-	return defaultValue
+	return clients
 }
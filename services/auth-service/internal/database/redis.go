@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+func NewRedis(addr, password string, db int, timeout time.Duration) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		Password:     password,
+		DB:           db,
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  3 * time.Second,
+		WriteTimeout: 3 * time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping Redis: %w", err)
+	}
+
+	return client, nil
+}
+
+// RegisterPoolMetrics exposes the connection pool of a client in the metrics: the
+// connections in the pool, and the lookups that found an idle connection (hit), had to
+// dial one (miss) or timed out waiting for one (timeout)
+func RegisterPoolMetrics(client *redis.Client) {
+	connections := map[string]func(*redis.PoolStats) uint32{
+		"total": func(stats *redis.PoolStats) uint32 { return stats.TotalConns },
+		"idle":  func(stats *redis.PoolStats) uint32 { return stats.IdleConns },
+		"stale": func(stats *redis.PoolStats) uint32 { return stats.StaleConns },
+	}
+	for state, value := range connections {
+		value := value
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "redis_pool_connections",
+			Help:        "Number of connections in the Redis pool",
+			ConstLabels: prometheus.Labels{"state": state},
+		}, func() float64 { return float64(value(client.PoolStats())) })
+	}
+
+	lookups := map[string]func(*redis.PoolStats) uint32{
+		"hit":     func(stats *redis.PoolStats) uint32 { return stats.Hits },
+		"miss":    func(stats *redis.PoolStats) uint32 { return stats.Misses },
+		"timeout": func(stats *redis.PoolStats) uint32 { return stats.Timeouts },
+	}
+	for event, value := range lookups {
+		value := value
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "redis_pool_events_total",
+			Help:        "Total number of Redis pool lookups that found an idle connection (hit), had to dial one (miss) or timed out waiting for one (timeout)",
+			ConstLabels: prometheus.Labels{"event": event},
+		}, func() float64 { return float64(value(client.PoolStats())) })
+	}
+}
@@ -0,0 +1,89 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	filev1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/file/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// callTimeout bounds how long a single file-service call may take
+const callTimeout = 10 * time.Second
+
+// Client looks up user files, such as avatars, in the file-service
+type Client struct {
+	conn   *grpc.ClientConn
+	client filev1.FileServiceClient
+}
+
+// NewClient dials the file-service gRPC endpoint
+func NewClient(addr string, opts ...grpc.DialOption) (*Client, error) {
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to file service: %w", err)
+	}
+	poolmetrics.WatchClientConn("file-service", conn)
+
+	return &Client{
+		conn:   conn,
+		client: filev1.NewFileServiceClient(conn),
+	}, nil
+}
+
+// GetFile returns a file's metadata as seen by userID
+func (c *Client) GetFile(ctx context.Context, userID, fileID string) (*filev1.File, error) {
+	ctx, cancel := context.WithTimeout(metadata.AppendToOutgoingContext(ctx, "user_id", userID), callTimeout)
+	defer cancel()
+
+	resp, err := c.client.GetFile(ctx, &filev1.GetFileRequest{FileId: fileID, UserId: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.File, nil
+}
+
+// GetDownloadURL returns a short-lived download URL for a file owned by or shared with userID
+func (c *Client) GetDownloadURL(ctx context.Context, userID, fileID string) (string, int64, error) {
+	ctx, cancel := context.WithTimeout(metadata.AppendToOutgoingContext(ctx, "user_id", userID), callTimeout)
+	defer cancel()
+
+	resp, err := c.client.GetDownloadURL(ctx, &filev1.GetDownloadURLRequest{FileId: fileID, UserId: userID})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return resp.DownloadUrl, resp.ExpiresIn, nil
+}
+
+// ClaimPendingShares links the shares made to email before it had an account to userID
+// and returns how many were linked
+func (c *Client) ClaimPendingShares(ctx context.Context, userID, email string) (int32, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	resp, err := c.client.ClaimPendingShares(ctx, &filev1.ClaimPendingSharesRequest{UserId: userID, Email: email})
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.LinkedCount, nil
+}
+
+// HealthCheck checks that the file-service can be reached
+func (c *Client) HealthCheck(ctx context.Context) error {
+	return health.GRPC(c.conn)(ctx)
+}
+
+// Close closes the underlying connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
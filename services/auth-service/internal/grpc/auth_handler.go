@@ -3,33 +3,112 @@ package grpc
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/config"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/files"
 	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/notification"
 	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
 	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/userevents"
 	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"golang.org/x/text/language"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// forgotPasswordMessage is returned whether or not the account exists so the
+// endpoint cannot be used to discover registered emails
+const forgotPasswordMessage = "If an account with that email exists, a password reset link has been sent"
+
 type AuthHandler struct {
 	authv1.UnimplementedAuthServiceServer
-	userRepo        *repository.UserRepository
-	jwtService      *service.JWTService
-	passwordService *service.PasswordService
+	userRepo              *repository.UserRepository
+	passwordResetRepo     *repository.PasswordResetRepository
+	emailVerificationRepo *repository.EmailVerificationRepository
+	loginEventRepo        *repository.LoginEventRepository
+	orgRepo               *repository.OrganizationRepository
+	invitationRepo        *repository.InvitationRepository
+	auditRepo             *repository.AuditEventRepository
+	impersonationRepo     *repository.ImpersonationRepository
+	signupDomainRepo      *repository.SignupDomainRepository
+	jwtService            *service.JWTService
+	passwordService       *service.PasswordService
+	passwordPolicy        *service.PasswordPolicyService
+	signupDomains         *service.SignupDomainPolicy
+	serviceTokenService   *service.ServiceTokenService
+	loginProtection       *service.LoginProtectionService
+	rateLimiter           *service.RateLimitService
+	captcha               *service.CaptchaVerifier
+	notificationClient    *notification.Client
+	fileClient            *files.Client
+	userEvents            *userevents.Publisher
+	cfg                   *config.Config
 }
 
 func NewAuthHandler(
 	userRepo *repository.UserRepository,
+	passwordResetRepo *repository.PasswordResetRepository,
+	emailVerificationRepo *repository.EmailVerificationRepository,
+	loginEventRepo *repository.LoginEventRepository,
+	orgRepo *repository.OrganizationRepository,
+	invitationRepo *repository.InvitationRepository,
+	auditRepo *repository.AuditEventRepository,
+	impersonationRepo *repository.ImpersonationRepository,
+	signupDomainRepo *repository.SignupDomainRepository,
 	jwtService *service.JWTService,
 	passwordService *service.PasswordService,
+	passwordPolicy *service.PasswordPolicyService,
+	signupDomains *service.SignupDomainPolicy,
+	serviceTokenService *service.ServiceTokenService,
+	loginProtection *service.LoginProtectionService,
+	rateLimiter *service.RateLimitService,
+	captcha *service.CaptchaVerifier,
+	notificationClient *notification.Client,
+	fileClient *files.Client,
+	cfg *config.Config,
 ) *AuthHandler {
 	return &AuthHandler{
-		userRepo:        userRepo,
-		jwtService:      jwtService,
-		passwordService: passwordService,
+		userRepo:              userRepo,
+		passwordResetRepo:     passwordResetRepo,
+		emailVerificationRepo: emailVerificationRepo,
+		loginEventRepo:        loginEventRepo,
+		orgRepo:               orgRepo,
+		invitationRepo:        invitationRepo,
+		auditRepo:             auditRepo,
+		impersonationRepo:     impersonationRepo,
+		signupDomainRepo:      signupDomainRepo,
+		jwtService:            jwtService,
+		passwordService:       passwordService,
+		passwordPolicy:        passwordPolicy,
+		signupDomains:         signupDomains,
+		serviceTokenService:   serviceTokenService,
+		loginProtection:       loginProtection,
+		rateLimiter:           rateLimiter,
+		captcha:               captcha,
+		notificationClient:    notificationClient,
+		fileClient:            fileClient,
+		cfg:                   cfg,
+	}
+}
+
+// SetUserEvents publishes the registrations and email verifications of users, for the
+// file-service to link the files shared with their email address to them
+func (h *AuthHandler) SetUserEvents(publisher *userevents.Publisher) {
+	h.userEvents = publisher
+}
+
+// publishRegistered publishes that user's account was created, if user events are enabled
+func (h *AuthHandler) publishRegistered(user *models.User) {
+	if h.userEvents != nil {
+		h.userEvents.UserRegistered(user)
 	}
 }
 
@@ -39,6 +118,25 @@ func (h *AuthHandler) Register(ctx context.Context, req *authv1.RegisterRequest)
 		return nil, status.Error(codes.InvalidArgument, "email, password, and full_name are required")
 	}
 
+	if err := h.checkRateLimit(ctx, service.RateLimitRegister, req.Email); err != nil {
+		return nil, err
+	}
+
+	if h.captcha != nil && h.cfg.CaptchaOnRegister {
+		if err := h.verifyCaptcha(ctx, req.CaptchaToken); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := h.checkSignupDomain(ctx, req.Email); err != nil {
+		return nil, err
+	}
+
+	// New accounts belong to no organization yet, so the service-wide policy applies
+	if err := h.validateNewPassword(ctx, req.Password, h.passwordPolicy.DefaultPolicy(), req.Email, req.FullName); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := h.passwordService.HashPassword(req.Password)
 	if err != nil {
@@ -59,16 +157,14 @@ func (h *AuthHandler) Register(ctx context.Context, req *authv1.RegisterRequest)
 		return nil, status.Error(codes.Internal, "failed to create user")
 	}
 
+	h.recordAudit(ctx, models.AuditEventUserRegistered, user, nil)
+	h.publishRegistered(user)
+
+	go h.sendVerificationEmail(user)
+
 	return &authv1.RegisterResponse{
-		User: &authv1.User{
-			UserId:    user.ID.Hex(),
-			Email:     user.Email,
-			FullName:  user.FullName,
-			AvatarUrl: user.AvatarURL,
-			CreatedAt: timestamppb.New(user.CreatedAt),
-			UpdatedAt: timestamppb.New(user.UpdatedAt),
-		},
-		Message: "User registered successfully",
+		User:    userToProto(user),
+		Message: "User registered successfully. Please check your email to verify your account",
 	}, nil
 }
 
@@ -78,10 +174,27 @@ func (h *AuthHandler) Login(ctx context.Context, req *authv1.LoginRequest) (*aut
 		return nil, status.Error(codes.InvalidArgument, "email and password are required")
 	}
 
+	if err := h.checkRateLimit(ctx, service.RateLimitLogin, req.Email); err != nil {
+		return nil, err
+	}
+
+	// Reject attempts from locked accounts and blocked addresses before checking credentials
+	clientIP := clientIPFromContext(ctx)
+	if err := h.checkLoginAllowed(ctx, req.Email, clientIP); err != nil {
+		h.recordLoginFailed(ctx, req.Email, nil, "blocked")
+		return nil, err
+	}
+
+	if err := h.checkLoginCaptcha(ctx, req.Email, req.CaptchaToken); err != nil {
+		return nil, err
+	}
+
 	// Find user
 	user, err := h.userRepo.FindByEmail(ctx, req.Email)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
+			h.recordLoginFailure(ctx, req.Email, clientIP, nil)
+			h.recordLoginFailed(ctx, req.Email, nil, "unknown_email")
 			return nil, status.Error(codes.Unauthenticated, "invalid email or password")
 		}
 		return nil, status.Error(codes.Internal, "failed to find user")
@@ -89,11 +202,22 @@ func (h *AuthHandler) Login(ctx context.Context, req *authv1.LoginRequest) (*aut
 
 	// Check password
 	if !h.passwordService.CheckPassword(req.Password, user.PasswordHash) {
+		h.recordLoginFailure(ctx, req.Email, clientIP, user)
+		h.recordLoginFailed(ctx, req.Email, user, "invalid_password")
 		return nil, status.Error(codes.Unauthenticated, "invalid email or password")
 	}
 
+	if user.Disabled {
+		h.recordLoginFailed(ctx, req.Email, user, "account_disabled")
+		return nil, status.Error(codes.PermissionDenied, "this account has been deactivated")
+	}
+
+	h.recordLoginSuccess(ctx, req.Email)
+	h.recordAudit(ctx, models.AuditEventLoginSucceeded, user, nil)
+	go h.trackLogin(user, h.loginClientFromContext(ctx, clientIP))
+
 	// Generate tokens
-	accessToken, expiresIn, err := h.jwtService.GenerateAccessToken(user.ID.Hex(), user.Email)
+	accessToken, expiresIn, err := h.generateAccessToken(ctx, user)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to generate access token")
 	}
@@ -107,14 +231,7 @@ func (h *AuthHandler) Login(ctx context.Context, req *authv1.LoginRequest) (*aut
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		ExpiresIn:    expiresIn,
-		User: &authv1.User{
-			UserId:    user.ID.Hex(),
-			Email:     user.Email,
-			FullName:  user.FullName,
-			AvatarUrl: user.AvatarURL,
-			CreatedAt: timestamppb.New(user.CreatedAt),
-			UpdatedAt: timestamppb.New(user.UpdatedAt),
-		},
+		User:         userToProto(user),
 	}, nil
 }
 
@@ -137,11 +254,40 @@ func (h *AuthHandler) ValidateToken(ctx context.Context, req *authv1.ValidateTok
 		}, nil
 	}
 
-	return &authv1.ValidateTokenResponse{
-		Valid:  true,
-		UserId: claims.UserID,
-		Email:  claims.Email,
-	}, nil
+	user, revoked, err := h.tokenUser(ctx, claims)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to validate token")
+	}
+	if revoked {
+		return &authv1.ValidateTokenResponse{
+			Valid:   false,
+			Message: "token has been revoked",
+		}, nil
+	}
+
+	resp := &authv1.ValidateTokenResponse{
+		Valid:          true,
+		UserId:         claims.UserID,
+		Email:          claims.Email,
+		EmailVerified:  user.EmailVerified,
+		FullName:       user.FullName,
+		Timezone:       user.Timezone,
+		Locale:         user.Locale,
+		ImpersonatorId: claims.ImpersonatorID,
+	}
+
+	// Report the token's organization only while the user is still a member, with
+	// their current role
+	membership, err := h.claimsMembership(ctx, claims)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to validate token")
+	}
+	if membership != nil {
+		resp.OrgId = membership.OrgID.Hex()
+		resp.OrgRole = orgRoleToProto(membership.Role)
+	}
+
+	return resp, nil
 }
 
 func (h *AuthHandler) GetUser(ctx context.Context, req *authv1.GetUserRequest) (*authv1.GetUserResponse, error) {
@@ -158,14 +304,7 @@ func (h *AuthHandler) GetUser(ctx context.Context, req *authv1.GetUserRequest) (
 	}
 
 	return &authv1.GetUserResponse{
-		User: &authv1.User{
-			UserId:    user.ID.Hex(),
-			Email:     user.Email,
-			FullName:  user.FullName,
-			AvatarUrl: user.AvatarURL,
-			CreatedAt: timestamppb.New(user.CreatedAt),
-			UpdatedAt: timestamppb.New(user.UpdatedAt),
-		},
+		User: userToProto(user),
 	}, nil
 }
 
@@ -178,9 +317,21 @@ func (h *AuthHandler) RefreshToken(ctx context.Context, req *authv1.RefreshToken
 	if err != nil {
 		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
 	}
+	// Impersonation sessions are time-boxed and cannot be extended
+	if claims.ImpersonationID != "" {
+		return nil, status.Error(codes.Unauthenticated, "impersonation tokens cannot be refreshed")
+	}
 
-	// Generate new access token
-	accessToken, expiresIn, err := h.jwtService.GenerateAccessToken(claims.UserID, claims.Email)
+	user, revoked, err := h.tokenUser(ctx, claims)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to validate refresh token")
+	}
+	if revoked {
+		return nil, status.Error(codes.Unauthenticated, "refresh token has been revoked")
+	}
+
+	// Generate new access token with the current verification state and organization
+	accessToken, expiresIn, err := h.generateAccessToken(ctx, user)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to generate access token")
 	}
@@ -206,10 +357,42 @@ func (h *AuthHandler) UpdateProfile(ctx context.Context, req *authv1.UpdateProfi
 
 	// Update fields
 	if req.FullName != "" {
-		user.FullName = req.FullName
+		fullName := strings.TrimSpace(req.FullName)
+		if fullName == "" || utf8.RuneCountInString(fullName) > maxFullNameLength {
+			return nil, status.Errorf(codes.InvalidArgument, "full_name must be between 1 and %d characters", maxFullNameLength)
+		}
+		user.FullName = fullName
 	}
-	if req.AvatarUrl != "" {
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			return nil, status.Error(codes.InvalidArgument, "timezone must be an IANA time zone name such as Europe/Berlin")
+		}
+		user.Timezone = req.Timezone
+	}
+	if req.Locale != "" {
+		tag, err := language.Parse(req.Locale)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "locale must be a BCP 47 language tag such as en-US")
+		}
+		user.Locale = tag.String()
+	}
+	if req.Discoverable != nil {
+		user.Discoverable = *req.Discoverable
+	}
+
+	switch {
+	case req.RemoveAvatar:
+		user.AvatarURL = ""
+		user.AvatarFileID = ""
+	case req.AvatarFileId != "":
+		if err := h.checkAvatarFile(ctx, user.ID.Hex(), req.AvatarFileId); err != nil {
+			return nil, err
+		}
+		user.AvatarFileID = req.AvatarFileId
+		user.AvatarURL = h.avatarURL(user.ID.Hex(), req.AvatarFileId)
+	case req.AvatarUrl != "":
 		user.AvatarURL = req.AvatarUrl
+		user.AvatarFileID = ""
 	}
 
 	if err := h.userRepo.Update(ctx, user); err != nil {
@@ -217,14 +400,7 @@ func (h *AuthHandler) UpdateProfile(ctx context.Context, req *authv1.UpdateProfi
 	}
 
 	return &authv1.UpdateProfileResponse{
-		User: &authv1.User{
-			UserId:    user.ID.Hex(),
-			Email:     user.Email,
-			FullName:  user.FullName,
-			AvatarUrl: user.AvatarURL,
-			CreatedAt: timestamppb.New(user.CreatedAt),
-			UpdatedAt: timestamppb.New(user.UpdatedAt),
-		},
+		User:    userToProto(user),
 		Message: "Profile updated successfully",
 	}, nil
 }
@@ -235,11 +411,6 @@ func (h *AuthHandler) ChangePassword(ctx context.Context, req *authv1.ChangePass
 		return nil, status.Error(codes.InvalidArgument, "user_id, current_password, and new_password are required")
 	}
 
-	// Validate new password length
-	if len(req.NewPassword) < 8 {
-		return nil, status.Error(codes.InvalidArgument, "new password must be at least 8 characters long")
-	}
-
 	// Find user
 	user, err := h.userRepo.FindByID(ctx, req.UserId)
 	if err != nil {
@@ -254,6 +425,15 @@ func (h *AuthHandler) ChangePassword(ctx context.Context, req *authv1.ChangePass
 		return nil, status.Error(codes.Unauthenticated, "current password is incorrect")
 	}
 
+	// Validate new password against the policies of the user's organizations
+	policy, err := h.passwordPolicyForUser(ctx, user.ID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to load password policy")
+	}
+	if err := h.validateNewPassword(ctx, req.NewPassword, policy, user.Email, user.FullName); err != nil {
+		return nil, err
+	}
+
 	// Hash new password
 	hashedPassword, err := h.passwordService.HashPassword(req.NewPassword)
 	if err != nil {
@@ -268,7 +448,242 @@ func (h *AuthHandler) ChangePassword(ctx context.Context, req *authv1.ChangePass
 		return nil, status.Error(codes.Internal, "failed to update password")
 	}
 
+	h.recordAudit(ctx, models.AuditEventPasswordChanged, user, nil)
+
 	return &authv1.ChangePasswordResponse{
 		Message: "Password changed successfully",
 	}, nil
 }
+
+func (h *AuthHandler) ForgotPassword(ctx context.Context, req *authv1.ForgotPasswordRequest) (*authv1.ForgotPasswordResponse, error) {
+	if req.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	// Count the email whether or not it is registered so the limit does not reveal which emails exist
+	if err := h.checkRateLimit(ctx, service.RateLimitPasswordReset, req.Email); err != nil {
+		return nil, err
+	}
+
+	user, err := h.userRepo.FindByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return &authv1.ForgotPasswordResponse{Message: forgotPasswordMessage}, nil
+		}
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	// Send in the background so response time does not reveal whether the account exists
+	go h.sendPasswordResetEmail(user)
+
+	return &authv1.ForgotPasswordResponse{Message: forgotPasswordMessage}, nil
+}
+
+func (h *AuthHandler) ResetPassword(ctx context.Context, req *authv1.ResetPasswordRequest) (*authv1.ResetPasswordResponse, error) {
+	if req.Token == "" || req.NewPassword == "" {
+		return nil, status.Error(codes.InvalidArgument, "token and new_password are required")
+	}
+
+	// Reset tokens are unguessable, so only the caller's address is limited
+	if err := h.checkRateLimit(ctx, service.RateLimitPasswordReset, ""); err != nil {
+		return nil, err
+	}
+
+	tokenHash := service.HashOneTimeToken(req.Token)
+
+	// Look the token up without consuming it so a rejected password can be retried
+	resetToken, err := h.passwordResetRepo.FindValid(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrResetTokenInvalid) {
+			return nil, status.Error(codes.InvalidArgument, "reset token is invalid or has expired")
+		}
+		return nil, status.Error(codes.Internal, "failed to verify reset token")
+	}
+
+	user, err := h.userRepo.FindByID(ctx, resetToken.UserID.Hex())
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.InvalidArgument, "reset token is invalid or has expired")
+		}
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	policy, err := h.passwordPolicyForUser(ctx, user.ID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to load password policy")
+	}
+	if err := h.validateNewPassword(ctx, req.NewPassword, policy, user.Email, user.FullName); err != nil {
+		return nil, err
+	}
+
+	// Consume the token before changing the password so it cannot be replayed concurrently
+	if _, err := h.passwordResetRepo.Consume(ctx, tokenHash); err != nil {
+		if errors.Is(err, repository.ErrResetTokenInvalid) {
+			return nil, status.Error(codes.InvalidArgument, "reset token is invalid or has expired")
+		}
+		return nil, status.Error(codes.Internal, "failed to verify reset token")
+	}
+
+	hashedPassword, err := h.passwordService.HashPassword(req.NewPassword)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to hash new password")
+	}
+
+	user.PasswordHash = hashedPassword
+	user.UpdatedAt = time.Now()
+
+	if err := h.userRepo.UpdatePassword(ctx, user); err != nil {
+		return nil, status.Error(codes.Internal, "failed to update password")
+	}
+
+	h.recordAudit(ctx, models.AuditEventPasswordReset, user, nil)
+
+	// Sign out every existing session
+	if err := h.userRepo.RevokeTokens(ctx, user.ID); err != nil {
+		return nil, status.Error(codes.Internal, "failed to revoke existing sessions")
+	}
+	h.recordAudit(ctx, models.AuditEventTokensRevoked, user, map[string]string{"reason": "password_reset"})
+
+	// The owner proved control of the mailbox, so lift any login lockout
+	h.unlockLogin(ctx, user.Email)
+
+	return &authv1.ResetPasswordResponse{
+		Message: "Password reset successfully",
+	}, nil
+}
+
+func (h *AuthHandler) IssueServiceToken(ctx context.Context, req *authv1.IssueServiceTokenRequest) (*authv1.IssueServiceTokenResponse, error) {
+	if req.ClientId == "" || req.ClientSecret == "" || req.Audience == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_id, client_secret, and audience are required")
+	}
+
+	token, expiresIn, err := h.serviceTokenService.IssueToken(req.ClientId, req.ClientSecret, req.Audience)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidClientCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "invalid client credentials")
+		}
+		return nil, status.Error(codes.Internal, "failed to issue service token")
+	}
+
+	return &authv1.IssueServiceTokenResponse{
+		AccessToken: token,
+		TokenType:   service.ServiceTokenType,
+		ExpiresIn:   expiresIn,
+	}, nil
+}
+
+// sendPasswordResetEmail replaces any outstanding reset tokens of the user with a new
+// one and emails the reset link
+func (h *AuthHandler) sendPasswordResetEmail(user *models.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := h.passwordResetRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		log.Printf("Failed to invalidate password reset tokens for user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	token, tokenHash, err := service.GenerateOneTimeToken()
+	if err != nil {
+		log.Printf("Failed to generate password reset token for user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	expiry := time.Duration(h.cfg.PasswordResetExpiry) * time.Second
+	resetToken := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(expiry),
+	}
+
+	if err := h.passwordResetRepo.Create(ctx, resetToken); err != nil {
+		log.Printf("Failed to store password reset token for user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/auth/reset-password?token=%s", h.cfg.FrontendURL, url.QueryEscape(token))
+	message := fmt.Sprintf(
+		"Hi %s,\n\nWe received a request to reset your password. Use the link below to choose a new one:\n\n%s\n\n"+
+			"This link expires in %d minutes and can only be used once. If you did not request a password reset, you can ignore this email.",
+		user.FullName, link, int(expiry.Minutes()),
+	)
+
+	if err := h.notificationClient.SendSecurityEmail(ctx, user.ID.Hex(), user.Email, "Reset your password", message, map[string]string{
+		"kind": "password_reset",
+	}); err != nil {
+		log.Printf("Failed to send password reset email to user %s: %v", user.ID.Hex(), err)
+	}
+}
+
+// tokenUser loads the token's user and reports whether the token was issued before the
+// user's sessions were revoked. A deleted or deactivated user revokes all of their tokens.
+func (h *AuthHandler) tokenUser(ctx context.Context, claims *service.JWTClaims) (*models.User, bool, error) {
+	user, err := h.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, true, nil
+		}
+		return nil, false, err
+	}
+
+	if user.Disabled {
+		return user, true, nil
+	}
+
+	// Impersonation tokens stop working when their session ends
+	active, err := h.claimsImpersonationActive(ctx, claims)
+	if err != nil {
+		return nil, false, err
+	}
+	if !active {
+		return user, true, nil
+	}
+
+	if user.TokensRevokedAt == nil || claims.IssuedAt == nil {
+		return user, false, nil
+	}
+
+	// JWT timestamps have second precision
+	return user, claims.IssuedAt.Time.Before(user.TokensRevokedAt.Truncate(time.Second)), nil
+}
+
+// GetTokenRevocation returns when the tokens of a user were last revoked. The gateway
+// checks every access token it accepts against it.
+func (h *AuthHandler) GetTokenRevocation(ctx context.Context, req *authv1.GetTokenRevocationRequest) (*authv1.GetTokenRevocationResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	user, err := h.userRepo.FindByID(ctx, req.UserId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return &authv1.GetTokenRevocationResponse{RevokedAt: timestamppb.Now()}, nil
+		}
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	resp := &authv1.GetTokenRevocationResponse{}
+	switch {
+	case user.Disabled:
+		resp.RevokedAt = timestamppb.Now()
+	case user.TokensRevokedAt != nil:
+		resp.RevokedAt = timestamppb.New(*user.TokensRevokedAt)
+	}
+	return resp, nil
+}
+
+// userToProto converts a user to its API representation
+func userToProto(user *models.User) *authv1.User {
+	return &authv1.User{
+		UserId:        user.ID.Hex(),
+		Email:         user.Email,
+		FullName:      user.FullName,
+		AvatarUrl:     user.AvatarURL,
+		CreatedAt:     timestamppb.New(user.CreatedAt),
+		UpdatedAt:     timestamppb.New(user.UpdatedAt),
+		EmailVerified: user.EmailVerified,
+		Timezone:      user.Timezone,
+		Locale:        user.Locale,
+		Discoverable:  user.Discoverable,
+	}
+}
@@ -0,0 +1,78 @@
+package grpc
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+)
+
+// defaultAnalyticsRange is the range user statistics cover when the request sets none
+const defaultAnalyticsRange = 30 * 24 * time.Hour
+
+// ServeStats serves the user statistics of the admin analytics: the numbers of users and
+// the signups per day between the from and to query parameters (RFC 3339, by default the
+// last 30 days). It counts every tenant, or the tenant in X-Tenant-ID. Callers present
+// the analytics API token as a bearer token.
+func (h *AuthHandler) ServeStats(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if h.cfg.AnalyticsAPIToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.AnalyticsAPIToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"error": "invalid token"})
+		return
+	}
+
+	ctx := r.Context()
+	if values, ok := r.Header[http.CanonicalHeaderKey(tenant.Header)]; ok && len(values) > 0 {
+		if !tenant.Valid(values[0]) {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid tenant ID"})
+			return
+		}
+		ctx = tenant.WithID(ctx, values[0])
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-defaultAnalyticsRange)
+	var err error
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "to must be an RFC 3339 time"})
+			return
+		}
+		from = to.Add(-defaultAnalyticsRange)
+	}
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "from must be an RFC 3339 time"})
+			return
+		}
+	}
+	if to.Before(from) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "to must not be before from"})
+		return
+	}
+
+	counts, err := h.userRepo.CountUsers(ctx)
+	if err != nil {
+		log.Printf("Failed to count users: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "failed to count users"})
+		return
+	}
+	signups, err := h.userRepo.CountSignupsByDay(ctx, from, to)
+	if err != nil {
+		log.Printf("Failed to count signups: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "failed to count signups"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"users":   counts,
+		"signups": signups,
+		"from":    from,
+		"to":      to,
+	})
+}
@@ -0,0 +1,213 @@
+package grpc
+
+import (
+	"context"
+	"log"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+var auditEventTypes = map[models.AuditEventType]authv1.AuditEventType{
+	models.AuditEventUserRegistered:  authv1.AuditEventType_AUDIT_EVENT_TYPE_USER_REGISTERED,
+	models.AuditEventLoginSucceeded:  authv1.AuditEventType_AUDIT_EVENT_TYPE_LOGIN_SUCCEEDED,
+	models.AuditEventLoginFailed:     authv1.AuditEventType_AUDIT_EVENT_TYPE_LOGIN_FAILED,
+	models.AuditEventAccountLocked:   authv1.AuditEventType_AUDIT_EVENT_TYPE_ACCOUNT_LOCKED,
+	models.AuditEventPasswordChanged: authv1.AuditEventType_AUDIT_EVENT_TYPE_PASSWORD_CHANGED,
+	models.AuditEventPasswordReset:   authv1.AuditEventType_AUDIT_EVENT_TYPE_PASSWORD_RESET,
+	models.AuditEventTokensRevoked:   authv1.AuditEventType_AUDIT_EVENT_TYPE_TOKENS_REVOKED,
+
+	models.AuditEventImpersonationRequested: authv1.AuditEventType_AUDIT_EVENT_TYPE_IMPERSONATION_REQUESTED,
+	models.AuditEventImpersonationApproved:  authv1.AuditEventType_AUDIT_EVENT_TYPE_IMPERSONATION_APPROVED,
+	models.AuditEventImpersonationDenied:    authv1.AuditEventType_AUDIT_EVENT_TYPE_IMPERSONATION_DENIED,
+	models.AuditEventImpersonationStarted:   authv1.AuditEventType_AUDIT_EVENT_TYPE_IMPERSONATION_STARTED,
+	models.AuditEventImpersonationEnded:     authv1.AuditEventType_AUDIT_EVENT_TYPE_IMPERSONATION_ENDED,
+	models.AuditEventImpersonationAction:    authv1.AuditEventType_AUDIT_EVENT_TYPE_IMPERSONATION_ACTION,
+
+	models.AuditEventSignupDomainRuleSet:     authv1.AuditEventType_AUDIT_EVENT_TYPE_SIGNUP_DOMAIN_RULE_SET,
+	models.AuditEventSignupDomainRuleDeleted: authv1.AuditEventType_AUDIT_EVENT_TYPE_SIGNUP_DOMAIN_RULE_DELETED,
+}
+
+// ListAuditEvents returns the caller's own audit events or, with org_id, the events of
+// the members of an organization the caller administers
+func (h *AuthHandler) ListAuditEvents(ctx context.Context, req *authv1.ListAuditEventsRequest) (*authv1.ListAuditEventsResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var subjectID primitive.ObjectID
+	if req.SubjectUserId != "" {
+		subjectID, err = primitive.ObjectIDFromHex(req.SubjectUserId)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid subject_user_id")
+		}
+	}
+
+	filter := repository.AuditEventFilter{
+		Limit: int64(req.PageSize),
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+
+	if req.OrgId != "" {
+		org, membership, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+		if err != nil {
+			return nil, err
+		}
+		if !canManageOrg(membership.Role) {
+			return nil, status.Error(codes.PermissionDenied, "only owners and admins can view the organization's audit log")
+		}
+
+		members, err := h.orgRepo.ListMembers(ctx, org.ID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to list audit events")
+		}
+
+		filter.UserIDs = make([]primitive.ObjectID, 0, len(members))
+		for _, member := range members {
+			if subjectID.IsZero() || member.UserID == subjectID {
+				filter.UserIDs = append(filter.UserIDs, member.UserID)
+			}
+		}
+		if len(filter.UserIDs) == 0 {
+			return nil, status.Error(codes.NotFound, "user is not a member of the organization")
+		}
+	} else {
+		if !subjectID.IsZero() && subjectID != userID {
+			return nil, status.Error(codes.PermissionDenied, "org_id is required to view other users' events")
+		}
+		filter.UserIDs = []primitive.ObjectID{userID}
+	}
+
+	for _, eventType := range req.EventTypes {
+		t, err := auditEventTypeFromProto(eventType)
+		if err != nil {
+			return nil, err
+		}
+		filter.Types = append(filter.Types, t)
+	}
+
+	if req.StartTime != nil {
+		filter.Start = req.StartTime.AsTime()
+	}
+	if req.EndTime != nil {
+		filter.End = req.EndTime.AsTime()
+	}
+	if !filter.Start.IsZero() && !filter.End.IsZero() && !filter.End.After(filter.Start) {
+		return nil, status.Error(codes.InvalidArgument, "end_time must be after start_time")
+	}
+
+	if req.PageToken != "" {
+		filter.Before, err = primitive.ObjectIDFromHex(req.PageToken)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+	}
+
+	events, err := h.auditRepo.List(ctx, filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list audit events")
+	}
+
+	resp := &authv1.ListAuditEventsResponse{
+		Events: make([]*authv1.AuditEvent, 0, len(events)),
+	}
+	for _, event := range events {
+		resp.Events = append(resp.Events, auditEventToProto(event))
+	}
+	if int64(len(events)) == filter.Limit {
+		resp.NextPageToken = events[len(events)-1].ID.Hex()
+	}
+
+	return resp, nil
+}
+
+// recordAudit adds an event about user to the audit log with the caller's address and user
+// agent. Failures are logged rather than failing the request being audited.
+func (h *AuthHandler) recordAudit(ctx context.Context, eventType models.AuditEventType, user *models.User, details map[string]string) {
+	event := &models.AuditEvent{
+		Type:    eventType,
+		Details: details,
+	}
+	if user != nil {
+		event.UserID = user.ID
+		event.Email = user.Email
+	}
+	h.recordAuditEvent(ctx, event)
+}
+
+// recordLoginFailed audits a rejected sign-in. user is nil when the email is not registered.
+func (h *AuthHandler) recordLoginFailed(ctx context.Context, email string, user *models.User, reason string) {
+	h.recordAuditEvent(ctx, &models.AuditEvent{
+		Type:    models.AuditEventLoginFailed,
+		UserID:  auditUserID(user),
+		Email:   email,
+		Details: map[string]string{"reason": reason},
+	})
+}
+
+// recordAuditEvent stores event, filling in the caller's address and user agent unless
+// the event already has them
+func (h *AuthHandler) recordAuditEvent(ctx context.Context, event *models.AuditEvent) {
+	if event.IPAddress == "" && event.UserAgent == "" {
+		client := h.loginClientFromContext(ctx, clientIPFromContext(ctx))
+		event.IPAddress = client.IP
+		event.UserAgent = client.UserAgent
+	}
+
+	// Record the event even if the caller has already gone away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.cfg.MongoTimeout)
+	defer cancel()
+
+	if err := h.auditRepo.Create(ctx, event); err != nil {
+		log.Printf("Failed to record %s audit event for %s: %v", event.Type, event.Email, err)
+	}
+}
+
+func auditEventTypeFromProto(eventType authv1.AuditEventType) (models.AuditEventType, error) {
+	for t, p := range auditEventTypes {
+		if p == eventType {
+			return t, nil
+		}
+	}
+	return "", status.Errorf(codes.InvalidArgument, "unknown event type %s", eventType)
+}
+
+func auditEventToProto(event *models.AuditEvent) *authv1.AuditEvent {
+	pb := &authv1.AuditEvent{
+		Id:        event.ID.Hex(),
+		EventType: auditEventTypes[event.Type],
+		Email:     event.Email,
+		Actor:     event.Actor,
+		IpAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+		Details:   event.Details,
+		CreatedAt: timestamppb.New(event.CreatedAt),
+	}
+	if !event.UserID.IsZero() {
+		pb.UserId = event.UserID.Hex()
+	}
+	return pb
+}
+
+func auditUserID(user *models.User) primitive.ObjectID {
+	if user == nil {
+		return primitive.NilObjectID
+	}
+	return user.ID
+}
@@ -0,0 +1,68 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (h *AuthHandler) GetCaptchaConfig(ctx context.Context, req *authv1.GetCaptchaConfigRequest) (*authv1.GetCaptchaConfigResponse, error) {
+	if h.captcha == nil {
+		return &authv1.GetCaptchaConfigResponse{}, nil
+	}
+
+	resp := &authv1.GetCaptchaConfigResponse{
+		Provider:           h.captcha.Provider(),
+		SiteKey:            h.cfg.CaptchaSiteKey,
+		RequiredOnRegister: h.cfg.CaptchaOnRegister,
+	}
+	// Failed logins are counted by login protection, which needs Redis
+	if h.loginProtection != nil {
+		resp.LoginFailuresBeforeCaptcha = int32(h.cfg.CaptchaAfterLoginFailures)
+	}
+	return resp, nil
+}
+
+// checkLoginCaptcha requires a valid CAPTCHA once the account has failed to sign in
+// CaptchaAfterLoginFailures times. Redis failures do not require one.
+func (h *AuthHandler) checkLoginCaptcha(ctx context.Context, email, token string) error {
+	if h.captcha == nil || h.loginProtection == nil || h.cfg.CaptchaAfterLoginFailures <= 0 {
+		return nil
+	}
+
+	failures, err := h.loginProtection.AccountFailures(ctx, email)
+	if err != nil {
+		log.Printf("Failed to load failed login count, not requiring captcha: %v", err)
+		return nil
+	}
+	if failures < int64(h.cfg.CaptchaAfterLoginFailures) {
+		return nil
+	}
+
+	return h.verifyCaptcha(ctx, token)
+}
+
+// verifyCaptcha checks the CAPTCHA token with the provider. Requests are rejected while the
+// provider cannot be reached.
+func (h *AuthHandler) verifyCaptcha(ctx context.Context, token string) error {
+	if token == "" {
+		return status.Error(codes.FailedPrecondition, "captcha verification required")
+	}
+
+	err := h.captcha.Verify(ctx, token, clientIPFromContext(ctx))
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, service.ErrCaptchaInvalid) {
+		return status.Error(codes.InvalidArgument, "captcha verification failed, please try again")
+	}
+
+	log.Printf("Captcha verification failed: %v", err)
+	return status.Error(codes.Unavailable, "captcha verification is temporarily unavailable, please try again later")
+}
@@ -0,0 +1,509 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const maxImpersonationReasonLength = 500
+
+// RequestImpersonation asks a member for consent to be impersonated by an owner or admin
+// of their organization. Only owners can impersonate other owners.
+func (h *AuthHandler) RequestImpersonation(ctx context.Context, req *authv1.RequestImpersonationRequest) (*authv1.RequestImpersonationResponse, error) {
+	org, membership, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageOrg(membership.Role) {
+		return nil, status.Error(codes.PermissionDenied, "only owners and admins can impersonate members")
+	}
+
+	targetID, err := primitive.ObjectIDFromHex(req.TargetUserId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid target_user_id")
+	}
+	if targetID == membership.UserID {
+		return nil, status.Error(codes.InvalidArgument, "you cannot impersonate yourself")
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "reason is required")
+	}
+	if utf8.RuneCountInString(reason) > maxImpersonationReasonLength {
+		return nil, status.Errorf(codes.InvalidArgument, "reason must be at most %d characters", maxImpersonationReasonLength)
+	}
+
+	if err := h.checkImpersonationAllowed(ctx, org.ID, membership, targetID); err != nil {
+		return nil, err
+	}
+
+	impersonator, user, err := h.impersonationParties(ctx, membership.UserID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, status.Error(codes.FailedPrecondition, "user account is disabled")
+	}
+
+	impersonation := &models.Impersonation{
+		OrgID:          org.ID,
+		ImpersonatorID: impersonator.ID,
+		UserID:         user.ID,
+		Reason:         reason,
+		ExpiresAt:      time.Now().Add(time.Duration(h.cfg.ImpersonationRequestExpiry) * time.Second),
+	}
+	if err := h.impersonationRepo.Create(ctx, impersonation); err != nil {
+		return nil, status.Error(codes.Internal, "failed to create impersonation request")
+	}
+
+	h.recordImpersonationAudit(ctx, models.AuditEventImpersonationRequested, impersonation, user, impersonator.ID, map[string]string{
+		"reason": reason,
+	})
+
+	go h.sendImpersonationEmail(user, impersonation,
+		fmt.Sprintf("%s wants to access your account", impersonator.FullName),
+		fmt.Sprintf(
+			"Hi %s,\n\n%s (%s), an administrator of %s, has asked to sign in as you.\n\nReason given:\n\n%s\n\n"+
+				"Nothing happens unless you approve. Review the request at %s/settings/impersonations before it expires in %d hours. "+
+				"If you approve, they can act as you for up to %d minutes and everything they do is recorded in your audit log.",
+			user.FullName, impersonator.FullName, impersonator.Email, org.Name, reason, h.cfg.FrontendURL,
+			int(impersonation.ExpiresAt.Sub(impersonation.CreatedAt).Hours()), h.cfg.ImpersonationSessionDuration/60,
+		),
+	)
+
+	return &authv1.RequestImpersonationResponse{
+		Impersonation: impersonationToProto(impersonation, impersonator, user, time.Now()),
+	}, nil
+}
+
+// ListImpersonations returns the impersonations the caller requested or was asked to
+// consent to
+func (h *AuthHandler) ListImpersonations(ctx context.Context, req *authv1.ListImpersonationsRequest) (*authv1.ListImpersonationsResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	impersonations, err := h.impersonationRepo.ListByParticipant(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list impersonations")
+	}
+
+	var userIDs []primitive.ObjectID
+	for _, impersonation := range impersonations {
+		userIDs = append(userIDs, impersonation.ImpersonatorID, impersonation.UserID)
+	}
+	users := make(map[primitive.ObjectID]*models.User)
+	if len(userIDs) > 0 {
+		found, err := h.userRepo.FindByIDs(ctx, userIDs)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to list impersonations")
+		}
+		for _, user := range found {
+			users[user.ID] = user
+		}
+	}
+
+	now := time.Now()
+	resp := &authv1.ListImpersonationsResponse{
+		Impersonations: make([]*authv1.Impersonation, 0, len(impersonations)),
+	}
+	for _, impersonation := range impersonations {
+		resp.Impersonations = append(resp.Impersonations, impersonationToProto(impersonation, users[impersonation.ImpersonatorID], users[impersonation.UserID], now))
+	}
+
+	return resp, nil
+}
+
+// RespondToImpersonation records the impersonated user's decision on a pending request
+func (h *AuthHandler) RespondToImpersonation(ctx context.Context, req *authv1.RespondToImpersonationRequest) (*authv1.RespondToImpersonationResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	impersonation, err := h.findImpersonation(ctx, req.ImpersonationId, userID)
+	if err != nil {
+		return nil, err
+	}
+	if impersonation.UserID != userID {
+		return nil, status.Error(codes.PermissionDenied, "only the impersonated user can respond to the request")
+	}
+
+	impersonator, user, err := h.impersonationParties(ctx, impersonation.ImpersonatorID, impersonation.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	eventType := models.AuditEventImpersonationDenied
+	if req.Approve {
+		eventType = models.AuditEventImpersonationApproved
+		impersonation, err = h.impersonationRepo.Approve(ctx, impersonation.ID)
+	} else {
+		impersonation, err = h.impersonationRepo.Deny(ctx, impersonation.ID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrImpersonationInvalid) {
+			return nil, status.Error(codes.FailedPrecondition, "impersonation request is no longer pending")
+		}
+		return nil, status.Error(codes.Internal, "failed to update impersonation request")
+	}
+
+	h.recordImpersonationAudit(ctx, eventType, impersonation, user, primitive.NilObjectID, nil)
+
+	decision := "denied"
+	if req.Approve {
+		decision = "approved"
+	}
+	go h.sendImpersonationEmail(impersonator, impersonation,
+		fmt.Sprintf("%s %s your impersonation request", user.FullName, decision),
+		fmt.Sprintf("Hi %s,\n\n%s (%s) has %s your request to sign in as them.", impersonator.FullName, user.FullName, user.Email, decision),
+	)
+
+	return &authv1.RespondToImpersonationResponse{
+		Impersonation: impersonationToProto(impersonation, impersonator, user, time.Now()),
+	}, nil
+}
+
+// StartImpersonation issues the impersonation token for an approved request. The
+// impersonator must still administer the organization and the user must still belong
+// to it.
+func (h *AuthHandler) StartImpersonation(ctx context.Context, req *authv1.StartImpersonationRequest) (*authv1.StartImpersonationResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	impersonation, err := h.findImpersonation(ctx, req.ImpersonationId, userID)
+	if err != nil {
+		return nil, err
+	}
+	if impersonation.ImpersonatorID != userID {
+		return nil, status.Error(codes.PermissionDenied, "only the requester can start the impersonation")
+	}
+	if !impersonation.CanStart(time.Now()) {
+		return nil, status.Error(codes.FailedPrecondition, "impersonation request has not been approved, has expired or was already used")
+	}
+
+	membership, err := h.orgRepo.FindMembership(ctx, impersonation.OrgID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMembershipNotFound) {
+			return nil, status.Error(codes.PermissionDenied, "you are no longer a member of the organization")
+		}
+		return nil, status.Error(codes.Internal, "failed to start impersonation")
+	}
+	if !canManageOrg(membership.Role) {
+		return nil, status.Error(codes.PermissionDenied, "only owners and admins can impersonate members")
+	}
+	if err := h.checkImpersonationAllowed(ctx, impersonation.OrgID, membership, impersonation.UserID); err != nil {
+		return nil, err
+	}
+	targetMembership, err := h.orgRepo.FindMembership(ctx, impersonation.OrgID, impersonation.UserID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to start impersonation")
+	}
+
+	impersonator, user, err := h.impersonationParties(ctx, impersonation.ImpersonatorID, impersonation.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, status.Error(codes.FailedPrecondition, "user account is disabled")
+	}
+
+	sessionExpiresAt := time.Now().Add(time.Duration(h.cfg.ImpersonationSessionDuration) * time.Second)
+	impersonation, err = h.impersonationRepo.Start(ctx, impersonation.ID, sessionExpiresAt)
+	if err != nil {
+		if errors.Is(err, repository.ErrImpersonationInvalid) {
+			return nil, status.Error(codes.FailedPrecondition, "impersonation request has not been approved, has expired or was already used")
+		}
+		return nil, status.Error(codes.Internal, "failed to start impersonation")
+	}
+
+	// The token is scoped to the organization the request was made in, with the user's role
+	accessToken, expiresIn, err := h.jwtService.GenerateImpersonationToken(
+		user.ID.Hex(), user.Email, user.EmailVerified, user.TenantID,
+		impersonation.OrgID.Hex(), string(targetMembership.Role),
+		impersonator.ID.Hex(), impersonation.ID.Hex(), *impersonation.SessionExpiresAt,
+	)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate access token")
+	}
+
+	h.recordImpersonationAudit(ctx, models.AuditEventImpersonationStarted, impersonation, user, impersonator.ID, nil)
+
+	go h.sendImpersonationEmail(user, impersonation,
+		fmt.Sprintf("%s is now signed in as you", impersonator.FullName),
+		fmt.Sprintf(
+			"Hi %s,\n\n%s (%s) has started the impersonation session you approved. It ends by %s UTC at the latest.\n\n"+
+				"You can end it early at %s/settings/impersonations and review what was done in your audit log.",
+			user.FullName, impersonator.FullName, impersonator.Email,
+			impersonation.SessionExpiresAt.UTC().Format("2006-01-02 15:04"), h.cfg.FrontendURL,
+		),
+	)
+
+	return &authv1.StartImpersonationResponse{
+		AccessToken:   accessToken,
+		ExpiresIn:     expiresIn,
+		Impersonation: impersonationToProto(impersonation, impersonator, user, time.Now()),
+	}, nil
+}
+
+// EndImpersonation ends a session, or withdraws a request that has not started, on behalf
+// of either party. Tokens of an ended session are rejected from then on.
+func (h *AuthHandler) EndImpersonation(ctx context.Context, req *authv1.EndImpersonationRequest) (*authv1.EndImpersonationResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	impersonation, err := h.findImpersonation(ctx, req.ImpersonationId, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	impersonator, user, err := h.impersonationParties(ctx, impersonation.ImpersonatorID, impersonation.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	impersonation, err = h.impersonationRepo.End(ctx, impersonation.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrImpersonationInvalid) {
+			return nil, status.Error(codes.FailedPrecondition, "impersonation has already ended")
+		}
+		return nil, status.Error(codes.Internal, "failed to end impersonation")
+	}
+
+	actor := primitive.NilObjectID
+	if userID != impersonation.UserID {
+		actor = userID
+	}
+	h.recordImpersonationAudit(ctx, models.AuditEventImpersonationEnded, impersonation, user, actor, nil)
+
+	return &authv1.EndImpersonationResponse{
+		Impersonation: impersonationToProto(impersonation, impersonator, user, time.Now()),
+	}, nil
+}
+
+// RecordImpersonationAction audits a request made with an impersonation token. It fails
+// with FailedPrecondition when the session is not active so the caller rejects the request.
+func (h *AuthHandler) RecordImpersonationAction(ctx context.Context, req *authv1.RecordImpersonationActionRequest) (*authv1.RecordImpersonationActionResponse, error) {
+	if req.ImpersonationId == "" || req.UserId == "" || req.ImpersonatorId == "" {
+		return nil, status.Error(codes.InvalidArgument, "impersonation_id, user_id, and impersonator_id are required")
+	}
+
+	active, err := h.impersonationActive(ctx, req.ImpersonationId, req.UserId, req.ImpersonatorId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to find impersonation")
+	}
+	if !active {
+		return nil, status.Error(codes.FailedPrecondition, "impersonation session is not active")
+	}
+
+	userID, _ := primitive.ObjectIDFromHex(req.UserId)
+	h.recordAuditEvent(ctx, &models.AuditEvent{
+		Type:      models.AuditEventImpersonationAction,
+		UserID:    userID,
+		Actor:     req.ImpersonatorId,
+		IPAddress: req.IpAddress,
+		UserAgent: req.UserAgent,
+		Details: map[string]string{
+			"impersonation_id": req.ImpersonationId,
+			"method":           req.Method,
+			"path":             req.Path,
+		},
+	})
+
+	return &authv1.RecordImpersonationActionResponse{}, nil
+}
+
+// impersonationActive reports whether an impersonation token's session is still active
+// and was issued for the same impersonator and user
+func (h *AuthHandler) impersonationActive(ctx context.Context, impersonationIDHex, userIDHex, impersonatorIDHex string) (bool, error) {
+	impersonationID, err := primitive.ObjectIDFromHex(impersonationIDHex)
+	if err != nil {
+		return false, nil
+	}
+
+	impersonation, err := h.impersonationRepo.FindByID(ctx, impersonationID)
+	if err != nil {
+		if errors.Is(err, repository.ErrImpersonationNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return impersonation.IsActive(time.Now()) &&
+		impersonation.UserID.Hex() == userIDHex &&
+		impersonation.ImpersonatorID.Hex() == impersonatorIDHex, nil
+}
+
+// claimsImpersonationActive reports whether a token is usable as far as impersonation is
+// concerned: regular tokens always are, impersonation tokens only during their session
+func (h *AuthHandler) claimsImpersonationActive(ctx context.Context, claims *service.JWTClaims) (bool, error) {
+	if claims.ImpersonationID == "" {
+		return true, nil
+	}
+	return h.impersonationActive(ctx, claims.ImpersonationID, claims.UserID, claims.ImpersonatorID)
+}
+
+// checkImpersonationAllowed requires the target to be a member of the organization and,
+// if they are an owner, the impersonator to be one too
+func (h *AuthHandler) checkImpersonationAllowed(ctx context.Context, orgID primitive.ObjectID, impersonator *models.OrganizationMember, targetID primitive.ObjectID) error {
+	target, err := h.orgRepo.FindMembership(ctx, orgID, targetID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMembershipNotFound) {
+			return status.Error(codes.NotFound, "user is not a member of the organization")
+		}
+		return status.Error(codes.Internal, "failed to find member")
+	}
+	if target.Role == models.OrgRoleOwner && impersonator.Role != models.OrgRoleOwner {
+		return status.Error(codes.PermissionDenied, "only owners can impersonate other owners")
+	}
+	return nil
+}
+
+// findImpersonation loads an impersonation the user takes part in. Others get NotFound so
+// impersonation IDs cannot be probed.
+func (h *AuthHandler) findImpersonation(ctx context.Context, impersonationIDHex string, userID primitive.ObjectID) (*models.Impersonation, error) {
+	impersonationID, err := primitive.ObjectIDFromHex(impersonationIDHex)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "impersonation not found")
+	}
+
+	impersonation, err := h.impersonationRepo.FindByID(ctx, impersonationID)
+	if err != nil {
+		if errors.Is(err, repository.ErrImpersonationNotFound) {
+			return nil, status.Error(codes.NotFound, "impersonation not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to find impersonation")
+	}
+	if impersonation.ImpersonatorID != userID && impersonation.UserID != userID {
+		return nil, status.Error(codes.NotFound, "impersonation not found")
+	}
+
+	return impersonation, nil
+}
+
+// impersonationParties loads the impersonator and the impersonated user
+func (h *AuthHandler) impersonationParties(ctx context.Context, impersonatorID, userID primitive.ObjectID) (*models.User, *models.User, error) {
+	users, err := h.userRepo.FindByIDs(ctx, []primitive.ObjectID{impersonatorID, userID})
+	if err != nil {
+		return nil, nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	var impersonator, user *models.User
+	for _, u := range users {
+		switch u.ID {
+		case impersonatorID:
+			impersonator = u
+		case userID:
+			user = u
+		}
+	}
+	if impersonator == nil || user == nil {
+		return nil, nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	return impersonator, user, nil
+}
+
+// recordImpersonationAudit adds an impersonation event to the impersonated user's audit
+// log. actor is zero when the user caused the event.
+func (h *AuthHandler) recordImpersonationAudit(ctx context.Context, eventType models.AuditEventType, impersonation *models.Impersonation, user *models.User, actor primitive.ObjectID, details map[string]string) {
+	if details == nil {
+		details = make(map[string]string)
+	}
+	details["impersonation_id"] = impersonation.ID.Hex()
+	details["impersonator_id"] = impersonation.ImpersonatorID.Hex()
+	details["org_id"] = impersonation.OrgID.Hex()
+
+	event := &models.AuditEvent{
+		Type:    eventType,
+		UserID:  user.ID,
+		Email:   user.Email,
+		Details: details,
+	}
+	if !actor.IsZero() {
+		event.Actor = actor.Hex()
+	}
+	h.recordAuditEvent(ctx, event)
+}
+
+func (h *AuthHandler) sendImpersonationEmail(recipient *models.User, impersonation *models.Impersonation, title, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := h.notificationClient.SendSecurityEmail(ctx, recipient.ID.Hex(), recipient.Email, title, message, map[string]string{
+		"kind":             "impersonation",
+		"impersonation_id": impersonation.ID.Hex(),
+		"org_id":           impersonation.OrgID.Hex(),
+	}); err != nil {
+		log.Printf("Failed to send impersonation email for %s to user %s: %v", impersonation.ID.Hex(), recipient.ID.Hex(), err)
+	}
+}
+
+func impersonationStatus(impersonation *models.Impersonation, now time.Time) authv1.ImpersonationStatus {
+	switch {
+	case impersonation.DeniedAt != nil:
+		return authv1.ImpersonationStatus_IMPERSONATION_STATUS_DENIED
+	case impersonation.EndedAt != nil:
+		return authv1.ImpersonationStatus_IMPERSONATION_STATUS_ENDED
+	case impersonation.IsActive(now):
+		return authv1.ImpersonationStatus_IMPERSONATION_STATUS_ACTIVE
+	case impersonation.StartedAt != nil:
+		// The session token ran out
+		return authv1.ImpersonationStatus_IMPERSONATION_STATUS_ENDED
+	case !now.Before(impersonation.ExpiresAt):
+		return authv1.ImpersonationStatus_IMPERSONATION_STATUS_EXPIRED
+	case impersonation.ApprovedAt != nil:
+		return authv1.ImpersonationStatus_IMPERSONATION_STATUS_APPROVED
+	default:
+		return authv1.ImpersonationStatus_IMPERSONATION_STATUS_PENDING
+	}
+}
+
+func impersonationToProto(impersonation *models.Impersonation, impersonator, user *models.User, now time.Time) *authv1.Impersonation {
+	resp := &authv1.Impersonation{
+		ImpersonationId: impersonation.ID.Hex(),
+		OrgId:           impersonation.OrgID.Hex(),
+		ImpersonatorId:  impersonation.ImpersonatorID.Hex(),
+		UserId:          impersonation.UserID.Hex(),
+		Reason:          impersonation.Reason,
+		Status:          impersonationStatus(impersonation, now),
+		ExpiresAt:       timestamppb.New(impersonation.ExpiresAt),
+		CreatedAt:       timestamppb.New(impersonation.CreatedAt),
+	}
+	if impersonator != nil {
+		resp.ImpersonatorName = impersonator.FullName
+	}
+	if user != nil {
+		resp.UserName = user.FullName
+	}
+	if impersonation.StartedAt != nil {
+		resp.StartedAt = timestamppb.New(*impersonation.StartedAt)
+	}
+	if impersonation.SessionExpiresAt != nil {
+		resp.SessionExpiresAt = timestamppb.New(*impersonation.SessionExpiresAt)
+	}
+	if impersonation.EndedAt != nil {
+		resp.EndedAt = timestamppb.New(*impersonation.EndedAt)
+	}
+	return resp
+}
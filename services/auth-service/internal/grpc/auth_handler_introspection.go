@@ -0,0 +1,219 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Token uses reported by introspection
+const (
+	tokenUseUser    = "user"
+	tokenUseService = "service"
+)
+
+// introspection describes an active token
+type introspection struct {
+	TokenUse      string
+	Subject       string
+	ClientID      string
+	Email         string
+	EmailVerified bool
+	// ImpersonatorID is set for impersonation tokens
+	ImpersonatorID string
+	OrgID          string
+	OrgRole        models.OrgRole
+	Audience       []string
+	ExpiresAt      int64
+	IssuedAt       int64
+	NotBefore      int64
+}
+
+func (h *AuthHandler) IntrospectToken(ctx context.Context, req *authv1.IntrospectTokenRequest) (*authv1.IntrospectTokenResponse, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	result, err := h.introspect(ctx, req.Token)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to introspect token")
+	}
+	if result == nil {
+		return &authv1.IntrospectTokenResponse{Active: false}, nil
+	}
+
+	resp := &authv1.IntrospectTokenResponse{
+		Active:         true,
+		TokenUse:       result.TokenUse,
+		Sub:            result.Subject,
+		ClientId:       result.ClientID,
+		Username:       result.Email,
+		EmailVerified:  result.EmailVerified,
+		OrgId:          result.OrgID,
+		Aud:            result.Audience,
+		TokenType:      service.ServiceTokenType,
+		Exp:            result.ExpiresAt,
+		Iat:            result.IssuedAt,
+		Nbf:            result.NotBefore,
+		ImpersonatorId: result.ImpersonatorID,
+	}
+	if result.OrgRole != "" {
+		resp.OrgRole = orgRoleToProto(result.OrgRole)
+	}
+	return resp, nil
+}
+
+// ServeIntrospection implements the RFC 7662 introspection endpoint. Callers authenticate
+// as a registered service client, with HTTP Basic client credentials or a service token
+// issued for this service, and post the token as a form parameter.
+func (h *AuthHandler) ServeIntrospection(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if !h.authenticateIntrospectionClient(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="auth-service"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"error": "invalid_client"})
+		return
+	}
+
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("token") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":             "invalid_request",
+			"error_description": "token is required",
+		})
+		return
+	}
+
+	result, err := h.introspect(r.Context(), r.PostForm.Get("token"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "server_error"})
+		return
+	}
+	if result == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+
+	body := map[string]interface{}{
+		"active":     true,
+		"token_use":  result.TokenUse,
+		"token_type": service.ServiceTokenType,
+		"sub":        result.Subject,
+		"exp":        result.ExpiresAt,
+		"iat":        result.IssuedAt,
+		"nbf":        result.NotBefore,
+	}
+	if result.ClientID != "" {
+		body["client_id"] = result.ClientID
+	}
+	if result.Email != "" {
+		body["username"] = result.Email
+		body["email_verified"] = result.EmailVerified
+	}
+	if result.OrgID != "" {
+		body["org_id"] = result.OrgID
+		body["org_role"] = string(result.OrgRole)
+	}
+	if len(result.Audience) > 0 {
+		body["aud"] = result.Audience
+	}
+	// RFC 8693 actor claim naming who is acting as the subject
+	if result.ImpersonatorID != "" {
+		body["act"] = map[string]interface{}{"sub": result.ImpersonatorID}
+	}
+
+	writeJSON(w, http.StatusOK, body)
+}
+
+// introspect describes token, or returns nil if it is not an active user or service token.
+// User tokens of deleted or disabled accounts and tokens issued before the user's last
+// revocation are inactive.
+func (h *AuthHandler) introspect(ctx context.Context, token string) (*introspection, error) {
+	if claims, err := h.jwtService.ValidateToken(token); err == nil && claims.UserID != "" {
+		user, revoked, err := h.tokenUser(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, nil
+		}
+
+		result := &introspection{
+			TokenUse:       tokenUseUser,
+			Subject:        claims.UserID,
+			Email:          user.Email,
+			EmailVerified:  user.EmailVerified,
+			ImpersonatorID: claims.ImpersonatorID,
+		}
+		setRegisteredClaims(result, claims.RegisteredClaims)
+
+		// Report the token's organization only while the user is still a member
+		membership, err := h.claimsMembership(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if membership != nil {
+			result.OrgID = membership.OrgID.Hex()
+			result.OrgRole = membership.Role
+		}
+
+		return result, nil
+	}
+
+	if claims, err := h.serviceTokenService.ParseToken(token); err == nil {
+		result := &introspection{
+			TokenUse: tokenUseService,
+			Subject:  claims.ClientID,
+			ClientID: claims.ClientID,
+			Audience: claims.Audience,
+		}
+		setRegisteredClaims(result, claims.RegisteredClaims)
+		return result, nil
+	}
+
+	return nil, nil
+}
+
+// authenticateIntrospectionClient reports whether the request comes from a registered
+// service client
+func (h *AuthHandler) authenticateIntrospectionClient(r *http.Request) bool {
+	if clientID, secret, ok := r.BasicAuth(); ok {
+		return h.serviceTokenService.AuthenticateClient(clientID, secret) == nil
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		_, err := h.serviceTokenService.ValidateToken(token, h.cfg.ServiceName)
+		return err == nil
+	}
+
+	return false
+}
+
+func setRegisteredClaims(result *introspection, claims jwt.RegisteredClaims) {
+	result.ExpiresAt = unixTime(claims.ExpiresAt)
+	result.IssuedAt = unixTime(claims.IssuedAt)
+	result.NotBefore = unixTime(claims.NotBefore)
+}
+
+func unixTime(date *jwt.NumericDate) int64 {
+	if date == nil {
+		return 0
+	}
+	return date.Unix()
+}
+
+func writeJSON(w http.ResponseWriter, code int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,509 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxInvitationMessageLength = 500
+	// invitationRecipientPrefix prefixes the notification recipient ID of invitation
+	// emails, since the invitee has no user ID yet
+	invitationRecipientPrefix = "invitation:"
+)
+
+// CreateInvitation invites an email address without an account. Re-inviting the same
+// address replaces the earlier link. Invitations are rate limited per inviter.
+func (h *AuthHandler) CreateInvitation(ctx context.Context, req *authv1.CreateInvitationRequest) (*authv1.CreateInvitationResponse, error) {
+	inviterID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return nil, status.Error(codes.InvalidArgument, "invalid email address")
+	}
+
+	note := strings.TrimSpace(req.Message)
+	if utf8.RuneCountInString(note) > maxInvitationMessageLength {
+		return nil, status.Errorf(codes.InvalidArgument, "message must be at most %d characters", maxInvitationMessageLength)
+	}
+
+	inviter, err := h.userRepo.FindByID(ctx, req.UserId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+	if !inviter.EmailVerified {
+		return nil, status.Error(codes.FailedPrecondition, "verify your email address before inviting others")
+	}
+
+	invitation := &models.Invitation{
+		Email:     email,
+		InvitedBy: inviterID,
+		ExpiresAt: time.Now().Add(time.Duration(h.cfg.InvitationExpiry) * time.Second),
+	}
+
+	var org *models.Organization
+	if req.OrgId != "" {
+		var membership *models.OrganizationMember
+		if org, membership, err = h.requireMembership(ctx, req.UserId, req.OrgId); err != nil {
+			return nil, err
+		}
+		if !canManageOrg(membership.Role) {
+			return nil, status.Error(codes.PermissionDenied, "only owners and admins can invite people to the organization")
+		}
+
+		role := models.OrgRoleMember
+		if req.Role != authv1.OrgRole_ORG_ROLE_UNSPECIFIED {
+			if role, err = orgRoleFromProto(req.Role); err != nil {
+				return nil, err
+			}
+		}
+		if role == models.OrgRoleOwner && membership.Role != models.OrgRoleOwner {
+			return nil, status.Error(codes.PermissionDenied, "only owners can invite owners")
+		}
+
+		invitation.OrgID = org.ID
+		invitation.OrgRole = role
+	}
+
+	if _, err := h.userRepo.FindByEmail(ctx, email); err == nil {
+		if org != nil {
+			return nil, status.Error(codes.AlreadyExists, "this person already has an account, add them to the organization instead")
+		}
+		return nil, status.Error(codes.AlreadyExists, "this person already has an account")
+	} else if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	if err := h.checkSignupDomain(ctx, email); err != nil {
+		return nil, err
+	}
+
+	if err := h.checkRateLimit(ctx, service.RateLimitInvitation, req.UserId); err != nil {
+		return nil, err
+	}
+
+	if err := h.invitationRepo.RevokePending(ctx, email, inviterID, invitation.OrgID); err != nil {
+		return nil, status.Error(codes.Internal, "failed to create invitation")
+	}
+
+	token, tokenHash, err := service.GenerateOneTimeToken()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create invitation")
+	}
+	invitation.TokenHash = tokenHash
+
+	if err := h.invitationRepo.Create(ctx, invitation); err != nil {
+		return nil, status.Error(codes.Internal, "failed to create invitation")
+	}
+
+	go h.sendInvitationEmail(inviter, org, invitation, token, note)
+
+	return &authv1.CreateInvitationResponse{
+		Invitation: invitationToProto(invitation, inviter, org),
+	}, nil
+}
+
+// ListInvitations returns the invitations sent by the caller or, with org_id, every
+// invitation into an organization the caller administers
+func (h *AuthHandler) ListInvitations(ctx context.Context, req *authv1.ListInvitationsRequest) (*authv1.ListInvitationsResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitations []*models.Invitation
+	if req.OrgId != "" {
+		org, membership, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+		if err != nil {
+			return nil, err
+		}
+		if !canManageOrg(membership.Role) {
+			return nil, status.Error(codes.PermissionDenied, "only owners and admins can view the organization's invitations")
+		}
+		invitations, err = h.invitationRepo.ListByOrganization(ctx, org.ID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to list invitations")
+		}
+	} else {
+		invitations, err = h.invitationRepo.ListByInviter(ctx, userID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to list invitations")
+		}
+	}
+
+	inviters, orgs, err := h.invitationRelations(ctx, invitations)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list invitations")
+	}
+
+	resp := &authv1.ListInvitationsResponse{
+		Invitations: make([]*authv1.Invitation, 0, len(invitations)),
+	}
+	for _, invitation := range invitations {
+		resp.Invitations = append(resp.Invitations, invitationToProto(invitation, inviters[invitation.InvitedBy], orgs[invitation.OrgID]))
+	}
+
+	return resp, nil
+}
+
+// RevokeInvitation withdraws a pending invitation. The inviter can revoke their own
+// invitations and organization admins any invitation into their organization.
+func (h *AuthHandler) RevokeInvitation(ctx context.Context, req *authv1.RevokeInvitationRequest) (*authv1.RevokeInvitationResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	invitationID, err := primitive.ObjectIDFromHex(req.InvitationId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "invitation not found")
+	}
+
+	invitation, err := h.invitationRepo.FindByID(ctx, invitationID)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvitationNotFound) {
+			return nil, status.Error(codes.NotFound, "invitation not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to find invitation")
+	}
+
+	if invitation.InvitedBy != userID {
+		if invitation.OrgID.IsZero() {
+			return nil, status.Error(codes.NotFound, "invitation not found")
+		}
+		membership, err := h.orgRepo.FindMembership(ctx, invitation.OrgID, userID)
+		if err != nil {
+			if errors.Is(err, repository.ErrMembershipNotFound) {
+				return nil, status.Error(codes.NotFound, "invitation not found")
+			}
+			return nil, status.Error(codes.Internal, "failed to find invitation")
+		}
+		if !canManageOrg(membership.Role) {
+			return nil, status.Error(codes.PermissionDenied, "only owners and admins can revoke the organization's invitations")
+		}
+	}
+
+	if err := h.invitationRepo.Revoke(ctx, invitation.ID); err != nil {
+		if errors.Is(err, repository.ErrInvitationInvalid) {
+			return nil, status.Error(codes.FailedPrecondition, "invitation is no longer pending")
+		}
+		return nil, status.Error(codes.Internal, "failed to revoke invitation")
+	}
+
+	return &authv1.RevokeInvitationResponse{
+		Message: "Invitation revoked",
+	}, nil
+}
+
+// GetInvitation returns a pending invitation so the signup page can show who sent it
+func (h *AuthHandler) GetInvitation(ctx context.Context, req *authv1.GetInvitationRequest) (*authv1.GetInvitationResponse, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	invitation, err := h.invitationRepo.FindPendingByToken(ctx, service.HashOneTimeToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvitationInvalid) {
+			return nil, status.Error(codes.NotFound, "invitation is invalid or has expired")
+		}
+		return nil, status.Error(codes.Internal, "failed to find invitation")
+	}
+
+	inviters, orgs, err := h.invitationRelations(ctx, []*models.Invitation{invitation})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to find invitation")
+	}
+
+	return &authv1.GetInvitationResponse{
+		Invitation: invitationToProto(invitation, inviters[invitation.InvitedBy], orgs[invitation.OrgID]),
+	}, nil
+}
+
+// AcceptInvitation creates the invited account and signs it in. The emailed token proves
+// ownership of the address, so the account starts out verified. Every pending invitation
+// to the address is accepted: the account joins each inviting organization, and files
+// shared with the address before it had an account are linked to it.
+func (h *AuthHandler) AcceptInvitation(ctx context.Context, req *authv1.AcceptInvitationRequest) (*authv1.AcceptInvitationResponse, error) {
+	if req.Token == "" || req.Password == "" || strings.TrimSpace(req.FullName) == "" {
+		return nil, status.Error(codes.InvalidArgument, "token, full_name, and password are required")
+	}
+
+	invitation, err := h.invitationRepo.FindPendingByToken(ctx, service.HashOneTimeToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvitationInvalid) {
+			return nil, status.Error(codes.InvalidArgument, "invitation is invalid or has expired")
+		}
+		return nil, status.Error(codes.Internal, "failed to find invitation")
+	}
+
+	fullName := strings.TrimSpace(req.FullName)
+	if utf8.RuneCountInString(fullName) > maxFullNameLength {
+		return nil, status.Errorf(codes.InvalidArgument, "full_name must be between 1 and %d characters", maxFullNameLength)
+	}
+
+	// The domain rules may have changed since the invitation was sent
+	if err := h.checkSignupDomain(ctx, invitation.Email); err != nil {
+		return nil, err
+	}
+
+	// The account joins the inviting organization, so its password policy applies already
+	var orgIDs []primitive.ObjectID
+	if !invitation.OrgID.IsZero() {
+		orgIDs = append(orgIDs, invitation.OrgID)
+	}
+	policy, err := h.passwordPolicyForOrgs(ctx, orgIDs)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to load password policy")
+	}
+	if err := h.validateNewPassword(ctx, req.Password, policy, invitation.Email, fullName); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := h.passwordService.HashPassword(req.Password)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to hash password")
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Email:           invitation.Email,
+		PasswordHash:    hashedPassword,
+		FullName:        fullName,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	}
+
+	if err := h.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrUserAlreadyExists) {
+			return nil, status.Error(codes.AlreadyExists, "an account with this email already exists, please sign in")
+		}
+		return nil, status.Error(codes.Internal, "failed to create user")
+	}
+
+	h.recordAudit(ctx, models.AuditEventUserRegistered, user, map[string]string{"invitation_id": invitation.ID.Hex()})
+	h.publishRegistered(user)
+
+	org, role := h.acceptPendingInvitations(ctx, user, invitation)
+
+	linked, err := h.fileClient.ClaimPendingShares(ctx, user.ID.Hex(), user.Email)
+	if err != nil {
+		log.Printf("Failed to link shared files to invited user %s: %v", user.ID.Hex(), err)
+	}
+
+	accessToken, expiresIn, err := h.generateAccessToken(ctx, user)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate access token")
+	}
+
+	refreshToken, err := h.jwtService.GenerateRefreshToken(user.ID.Hex(), user.Email)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate refresh token")
+	}
+
+	resp := &authv1.AcceptInvitationResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    expiresIn,
+		User:         userToProto(user),
+		LinkedShares: linked,
+	}
+	if org != nil {
+		resp.Organization = orgToProto(org, role)
+	}
+
+	return resp, nil
+}
+
+// acceptPendingInvitations marks every pending invitation to the user's email as accepted
+// and adds the user to the inviting organizations. The organization of the accepted
+// invitation, or else the first one joined, becomes the user's active organization and
+// is returned with the user's role in it.
+func (h *AuthHandler) acceptPendingInvitations(ctx context.Context, user *models.User, accepted *models.Invitation) (*models.Organization, models.OrgRole) {
+	invitations, err := h.invitationRepo.ListPendingByEmail(ctx, user.Email)
+	if err != nil {
+		log.Printf("Failed to list pending invitations of user %s: %v", user.ID.Hex(), err)
+		invitations = []*models.Invitation{accepted}
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(invitations))
+	for _, invitation := range invitations {
+		ids = append(ids, invitation.ID)
+	}
+	if _, err := h.invitationRepo.MarkAccepted(ctx, ids, user.ID); err != nil {
+		log.Printf("Failed to mark invitations of user %s as accepted: %v", user.ID.Hex(), err)
+	}
+
+	var joined *models.OrganizationMember
+	for _, invitation := range invitations {
+		if invitation.OrgID.IsZero() {
+			continue
+		}
+
+		member := &models.OrganizationMember{
+			OrgID:  invitation.OrgID,
+			UserID: user.ID,
+			Role:   invitation.OrgRole,
+		}
+		if err := h.orgRepo.AddMember(ctx, member); err != nil && !errors.Is(err, repository.ErrAlreadyMember) {
+			log.Printf("Failed to add invited user %s to organization %s: %v", user.ID.Hex(), invitation.OrgID.Hex(), err)
+			continue
+		}
+
+		if joined == nil || invitation.ID == accepted.ID {
+			joined = member
+		}
+	}
+
+	if joined == nil {
+		return nil, ""
+	}
+
+	org, err := h.orgRepo.FindByID(ctx, joined.OrgID)
+	if err != nil {
+		log.Printf("Failed to find organization %s: %v", joined.OrgID.Hex(), err)
+		return nil, ""
+	}
+
+	if err := h.userRepo.SetActiveOrganization(ctx, user.ID, org.ID); err != nil {
+		log.Printf("Failed to set active organization of user %s: %v", user.ID.Hex(), err)
+		return org, joined.Role
+	}
+	user.ActiveOrgID = org.ID
+
+	return org, joined.Role
+}
+
+// invitationRelations loads the inviters and organizations referenced by invitations
+func (h *AuthHandler) invitationRelations(ctx context.Context, invitations []*models.Invitation) (map[primitive.ObjectID]*models.User, map[primitive.ObjectID]*models.Organization, error) {
+	inviters := make(map[primitive.ObjectID]*models.User)
+	orgs := make(map[primitive.ObjectID]*models.Organization)
+	if len(invitations) == 0 {
+		return inviters, orgs, nil
+	}
+
+	var userIDs, orgIDs []primitive.ObjectID
+	for _, invitation := range invitations {
+		userIDs = append(userIDs, invitation.InvitedBy)
+		if !invitation.OrgID.IsZero() {
+			orgIDs = append(orgIDs, invitation.OrgID)
+		}
+	}
+
+	users, err := h.userRepo.FindByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, user := range users {
+		inviters[user.ID] = user
+	}
+
+	if len(orgIDs) > 0 {
+		found, err := h.orgRepo.FindByIDs(ctx, orgIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, org := range found {
+			orgs[org.ID] = org
+		}
+	}
+
+	return inviters, orgs, nil
+}
+
+// sendInvitationEmail emails the invitation link to the invitee
+func (h *AuthHandler) sendInvitationEmail(inviter *models.User, org *models.Organization, invitation *models.Invitation, token, note string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	title := fmt.Sprintf("%s invited you to share files", inviter.FullName)
+	intro := fmt.Sprintf("%s (%s) has invited you to create an account so you can access the files they share with you.", inviter.FullName, inviter.Email)
+	if org != nil {
+		title = fmt.Sprintf("%s invited you to join %s", inviter.FullName, org.Name)
+		intro = fmt.Sprintf("%s (%s) has invited you to join the %s organization.", inviter.FullName, inviter.Email, org.Name)
+	}
+
+	link := fmt.Sprintf("%s/auth/accept-invite?token=%s", h.cfg.FrontendURL, url.QueryEscape(token))
+	message := fmt.Sprintf("Hi,\n\n%s\n\n", intro)
+	if note != "" {
+		message += fmt.Sprintf("They wrote:\n\n%s\n\n", note)
+	}
+	message += fmt.Sprintf(
+		"Open the link below to create your account:\n\n%s\n\nThis invitation expires in %d days. If you were not expecting it, you can ignore this email.",
+		link, int(invitation.ExpiresAt.Sub(invitation.CreatedAt).Hours()/24),
+	)
+
+	metadata := map[string]string{
+		"kind":          "invitation",
+		"invitation_id": invitation.ID.Hex(),
+		"invited_by":    inviter.ID.Hex(),
+	}
+	if org != nil {
+		metadata["org_id"] = org.ID.Hex()
+	}
+
+	if err := h.notificationClient.SendSecurityEmail(ctx, invitationRecipientPrefix+invitation.ID.Hex(), invitation.Email, title, message, metadata); err != nil {
+		log.Printf("Failed to send invitation %s: %v", invitation.ID.Hex(), err)
+	}
+}
+
+func invitationStatus(invitation *models.Invitation, now time.Time) authv1.InvitationStatus {
+	switch {
+	case invitation.AcceptedAt != nil:
+		return authv1.InvitationStatus_INVITATION_STATUS_ACCEPTED
+	case invitation.RevokedAt != nil:
+		return authv1.InvitationStatus_INVITATION_STATUS_REVOKED
+	case !now.Before(invitation.ExpiresAt):
+		return authv1.InvitationStatus_INVITATION_STATUS_EXPIRED
+	default:
+		return authv1.InvitationStatus_INVITATION_STATUS_PENDING
+	}
+}
+
+// invitationToProto converts an invitation to its API representation. inviter and org
+// may be nil if they no longer exist.
+func invitationToProto(invitation *models.Invitation, inviter *models.User, org *models.Organization) *authv1.Invitation {
+	resp := &authv1.Invitation{
+		InvitationId: invitation.ID.Hex(),
+		Email:        invitation.Email,
+		InvitedById:  invitation.InvitedBy.Hex(),
+		Status:       invitationStatus(invitation, time.Now()),
+		ExpiresAt:    timestamppb.New(invitation.ExpiresAt),
+		CreatedAt:    timestamppb.New(invitation.CreatedAt),
+	}
+	if inviter != nil {
+		resp.InvitedByName = inviter.FullName
+	}
+	if !invitation.OrgID.IsZero() {
+		resp.OrgId = invitation.OrgID.Hex()
+		resp.Role = orgRoleToProto(invitation.OrgRole)
+		if org != nil {
+			resp.OrgName = org.Name
+		}
+	}
+	return resp
+}
@@ -0,0 +1,307 @@
+package grpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultLoginHistoryLimit = 20
+	maxLoginHistoryLimit     = 100
+)
+
+// loginClient describes where a sign-in came from
+type loginClient struct {
+	IP        string
+	UserAgent string
+	Country   string
+}
+
+func (h *AuthHandler) GetLoginHistory(ctx context.Context, req *authv1.GetLoginHistoryRequest) (*authv1.GetLoginHistoryResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	userID, err := primitive.ObjectIDFromHex(req.UserId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+
+	// Sign-ins reveal where and on which devices a user works, so only the user may see them
+	callerID, err := h.callerUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if callerID != req.UserId {
+		return nil, status.Error(codes.PermissionDenied, "you can only view your own login history")
+	}
+
+	limit := int64(req.Limit)
+	if limit <= 0 {
+		limit = defaultLoginHistoryLimit
+	}
+	if limit > maxLoginHistoryLimit {
+		limit = maxLoginHistoryLimit
+	}
+
+	events, err := h.loginEventRepo.ListByUser(ctx, userID, limit)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to load login history")
+	}
+
+	logins := make([]*authv1.LoginEvent, 0, len(events))
+	for _, event := range events {
+		logins = append(logins, &authv1.LoginEvent{
+			Id:          event.ID.Hex(),
+			IpAddress:   event.IPAddress,
+			UserAgent:   event.UserAgent,
+			Country:     event.Country,
+			NewDevice:   event.NewDevice,
+			NewLocation: event.NewLocation,
+			Reported:    event.ReportedAt != nil,
+			CreatedAt:   timestamppb.New(event.CreatedAt),
+		})
+	}
+
+	return &authv1.GetLoginHistoryResponse{Logins: logins}, nil
+}
+
+// callerUserID returns the user whose access token the call carries. The gateway forwards
+// the caller's Authorization header with the calls it proxies.
+func (h *AuthHandler) callerUserID(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || values[0] == "" {
+		return "", status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	claims, err := h.jwtService.ValidateToken(strings.TrimPrefix(values[0], "Bearer "))
+	if err != nil || claims.UserID == "" {
+		return "", status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	_, revoked, err := h.tokenUser(ctx, claims)
+	if err != nil {
+		return "", status.Error(codes.Internal, "failed to validate token")
+	}
+	if revoked {
+		return "", status.Error(codes.Unauthenticated, "token has been revoked")
+	}
+
+	return claims.UserID, nil
+}
+
+// ReportSuspiciousLogin signs out every session of the account and sends a password
+// reset link. All sessions are revoked because whoever signed in knows the password and
+// could simply sign in again.
+func (h *AuthHandler) ReportSuspiciousLogin(ctx context.Context, req *authv1.ReportSuspiciousLoginRequest) (*authv1.ReportSuspiciousLoginResponse, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	notBefore := time.Now().Add(-time.Duration(h.cfg.LoginReportExpiry) * time.Second)
+	event, err := h.loginEventRepo.ConsumeReport(ctx, service.HashOneTimeToken(req.Token), notBefore)
+	if err != nil {
+		if errors.Is(err, repository.ErrLoginReportInvalid) {
+			return nil, status.Error(codes.InvalidArgument, "report link is invalid or has expired")
+		}
+		return nil, status.Error(codes.Internal, "failed to verify report token")
+	}
+
+	user, err := h.userRepo.FindByID(ctx, event.UserID.Hex())
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.InvalidArgument, "report link is invalid or has expired")
+		}
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	if err := h.userRepo.RevokeTokens(ctx, user.ID); err != nil {
+		return nil, status.Error(codes.Internal, "failed to revoke existing sessions")
+	}
+	h.recordAudit(ctx, models.AuditEventTokensRevoked, user, map[string]string{
+		"reason":   "suspicious_login_reported",
+		"login_id": event.ID.Hex(),
+	})
+
+	log.Printf("Security alert: user %s reported sign-in %s from %s as suspicious, all sessions revoked", user.ID.Hex(), event.ID.Hex(), event.IPAddress)
+
+	go h.sendPasswordResetEmail(user)
+
+	return &authv1.ReportSuspiciousLoginResponse{
+		Message: "All sessions have been signed out. We have sent you an email to reset your password",
+	}, nil
+}
+
+// loginClientFromContext collects the address, user agent and country of the caller.
+// The country comes from a header set by the CDN or load balancer in front of the service.
+func (h *AuthHandler) loginClientFromContext(ctx context.Context, ip string) loginClient {
+	client := loginClient{IP: ip}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return client
+	}
+
+	// The gRPC-Gateway prefixes forwarded HTTP headers
+	for _, key := range []string{"grpcgateway-user-agent", "user-agent"} {
+		if values := md.Get(key); len(values) > 0 && values[0] != "" {
+			client.UserAgent = values[0]
+			break
+		}
+	}
+
+	if h.cfg.GeoCountryHeader != "" {
+		if values := md.Get(h.cfg.GeoCountryHeader); len(values) > 0 {
+			country := strings.ToUpper(strings.TrimSpace(values[0]))
+			// XX marks an unknown country
+			if len(country) == 2 && country != "XX" {
+				client.Country = country
+			}
+		}
+	}
+
+	return client
+}
+
+// trackLogin records a successful sign-in and, when anomaly detection is enabled, alerts
+// the user if it comes from a new device or an unusual location. The first recorded
+// sign-in of an account never alerts.
+func (h *AuthHandler) trackLogin(user *models.User, client loginClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	event := &models.LoginEvent{
+		UserID:     user.ID,
+		IPAddress:  client.IP,
+		Network:    loginNetwork(client.IP),
+		Country:    client.Country,
+		UserAgent:  client.UserAgent,
+		DeviceHash: deviceHash(client.UserAgent),
+	}
+
+	checkAnomalies := h.cfg.LoginAnomalyEnabled
+	if checkAnomalies {
+		hasHistory, err := h.loginEventRepo.HasHistory(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to load login history for user %s: %v", user.ID.Hex(), err)
+			return
+		}
+		checkAnomalies = hasHistory
+	}
+
+	if checkAnomalies {
+		knownDevice, err := h.loginEventRepo.HasDevice(ctx, user.ID, event.DeviceHash)
+		if err != nil {
+			log.Printf("Failed to check known devices for user %s: %v", user.ID.Hex(), err)
+			return
+		}
+		event.NewDevice = !knownDevice
+
+		if event.Country != "" || event.Network != "" {
+			knownLocation, err := h.loginEventRepo.HasLocation(ctx, user.ID, event.Country, event.Network)
+			if err != nil {
+				log.Printf("Failed to check known locations for user %s: %v", user.ID.Hex(), err)
+				return
+			}
+			event.NewLocation = !knownLocation
+		}
+	}
+
+	var reportToken string
+	if event.NewDevice || event.NewLocation {
+		token, tokenHash, err := service.GenerateOneTimeToken()
+		if err != nil {
+			log.Printf("Failed to generate login report token for user %s: %v", user.ID.Hex(), err)
+			return
+		}
+		reportToken = token
+		event.ReportTokenHash = tokenHash
+	}
+
+	if err := h.loginEventRepo.Create(ctx, event); err != nil {
+		log.Printf("Failed to record login for user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	if reportToken != "" {
+		h.sendNewLoginAlert(ctx, user, event, reportToken)
+	}
+}
+
+// sendNewLoginAlert emails and notifies the user in-app about an unrecognised sign-in
+func (h *AuthHandler) sendNewLoginAlert(ctx context.Context, user *models.User, event *models.LoginEvent, reportToken string) {
+	reason := "a new device"
+	switch {
+	case event.NewDevice && event.NewLocation:
+		reason = "a new device and location"
+	case event.NewLocation:
+		reason = "a new location"
+	}
+
+	location := event.IPAddress
+	if event.Country != "" {
+		location = fmt.Sprintf("%s (%s)", event.IPAddress, event.Country)
+	}
+
+	device := event.UserAgent
+	if device == "" {
+		device = "unknown device"
+	}
+
+	link := fmt.Sprintf("%s/auth/report-login?token=%s", h.cfg.FrontendURL, url.QueryEscape(reportToken))
+	message := fmt.Sprintf(
+		"Hi %s,\n\nYour account was just signed in to from %s.\n\nTime: %s\nAddress: %s\nDevice: %s\n\n"+
+			"If this was you, no action is needed. If this wasn't you, use the link below to sign out every session and reset your password:\n\n%s",
+		user.FullName, reason, event.CreatedAt.UTC().Format("Jan 2, 2006 15:04 MST"), location, device, link,
+	)
+
+	if err := h.notificationClient.SendSecurityAlert(ctx, user.ID.Hex(), user.Email, "New sign-in to your account", message, map[string]string{
+		"kind":         "new_login",
+		"login_id":     event.ID.Hex(),
+		"ip_address":   event.IPAddress,
+		"country":      event.Country,
+		"new_device":   fmt.Sprintf("%t", event.NewDevice),
+		"new_location": fmt.Sprintf("%t", event.NewLocation),
+	}); err != nil {
+		log.Printf("Failed to send new sign-in alert to user %s: %v", user.ID.Hex(), err)
+	}
+}
+
+// loginNetwork returns the /16 (IPv4) or /48 (IPv6) network of ip, a rough stand-in for
+// location when no country is known
+func loginNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(16, 32)), Mask: net.CIDRMask(16, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// deviceHash fingerprints a client by its user agent
+func deviceHash(userAgent string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(userAgent))))
+	return hex.EncodeToString(sum[:])
+}
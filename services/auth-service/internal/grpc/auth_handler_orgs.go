@@ -0,0 +1,590 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxOrgNameLength = 100
+	maxSlugLength    = 48
+	// slugAttempts bounds the retries with a random suffix when a slug is taken
+	slugAttempts = 3
+)
+
+// CreateOrganization creates an organization with the caller as its owner
+func (h *AuthHandler) CreateOrganization(ctx context.Context, req *authv1.CreateOrganizationRequest) (*authv1.CreateOrganizationResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := validateOrgName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	base := slugify(name)
+	org := &models.Organization{
+		Name:      name,
+		Slug:      base,
+		CreatedBy: userID,
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = h.orgRepo.Create(ctx, org)
+		if !errors.Is(err, repository.ErrSlugTaken) || attempt == slugAttempts {
+			break
+		}
+		// The low bytes of a fresh ObjectID make a short, unlikely to collide suffix
+		org.Slug = base + "-" + primitive.NewObjectID().Hex()[18:]
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrSlugTaken) {
+			return nil, status.Error(codes.AlreadyExists, "an organization with this name already exists")
+		}
+		return nil, status.Error(codes.Internal, "failed to create organization")
+	}
+
+	return &authv1.CreateOrganizationResponse{
+		Organization: orgToProto(org, models.OrgRoleOwner),
+	}, nil
+}
+
+// ListOrganizations returns the organizations the caller belongs to, with their role in each
+func (h *AuthHandler) ListOrganizations(ctx context.Context, req *authv1.ListOrganizationsRequest) (*authv1.ListOrganizationsResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := h.orgRepo.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list organizations")
+	}
+	if len(memberships) == 0 {
+		return &authv1.ListOrganizationsResponse{}, nil
+	}
+
+	roles := make(map[primitive.ObjectID]models.OrgRole, len(memberships))
+	orgIDs := make([]primitive.ObjectID, 0, len(memberships))
+	for _, membership := range memberships {
+		roles[membership.OrgID] = membership.Role
+		orgIDs = append(orgIDs, membership.OrgID)
+	}
+
+	orgs, err := h.orgRepo.FindByIDs(ctx, orgIDs)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list organizations")
+	}
+
+	resp := &authv1.ListOrganizationsResponse{
+		Organizations: make([]*authv1.Organization, 0, len(orgs)),
+	}
+	for _, org := range orgs {
+		resp.Organizations = append(resp.Organizations, orgToProto(org, roles[org.ID]))
+	}
+
+	return resp, nil
+}
+
+func (h *AuthHandler) GetOrganization(ctx context.Context, req *authv1.GetOrganizationRequest) (*authv1.GetOrganizationResponse, error) {
+	org, membership, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authv1.GetOrganizationResponse{
+		Organization: orgToProto(org, membership.Role),
+	}, nil
+}
+
+// UpdateOrganization renames an organization. The slug is kept so existing links stay valid.
+func (h *AuthHandler) UpdateOrganization(ctx context.Context, req *authv1.UpdateOrganizationRequest) (*authv1.UpdateOrganizationResponse, error) {
+	org, membership, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageOrg(membership.Role) {
+		return nil, status.Error(codes.PermissionDenied, "only owners and admins can update the organization")
+	}
+
+	name, err := validateOrgName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	org.Name = name
+	if err := h.orgRepo.UpdateName(ctx, org); err != nil {
+		if errors.Is(err, repository.ErrOrganizationNotFound) {
+			return nil, status.Error(codes.NotFound, "organization not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to update organization")
+	}
+
+	return &authv1.UpdateOrganizationResponse{
+		Organization: orgToProto(org, membership.Role),
+	}, nil
+}
+
+func (h *AuthHandler) ListOrganizationMembers(ctx context.Context, req *authv1.ListOrganizationMembersRequest) (*authv1.ListOrganizationMembersResponse, error) {
+	org, _, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := h.orgRepo.ListMembers(ctx, org.ID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list members")
+	}
+
+	userIDs := make([]primitive.ObjectID, 0, len(members))
+	for _, member := range members {
+		userIDs = append(userIDs, member.UserID)
+	}
+
+	users, err := h.userRepo.FindByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list members")
+	}
+
+	usersByID := make(map[primitive.ObjectID]*models.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	resp := &authv1.ListOrganizationMembersResponse{
+		Members: make([]*authv1.OrganizationMember, 0, len(members)),
+	}
+	for _, member := range members {
+		user, ok := usersByID[member.UserID]
+		if !ok {
+			continue
+		}
+		resp.Members = append(resp.Members, memberToProto(member, user))
+	}
+
+	return resp, nil
+}
+
+// AddOrganizationMember adds a registered user by email. Admins can add members and
+// admins; only owners can add other owners.
+func (h *AuthHandler) AddOrganizationMember(ctx context.Context, req *authv1.AddOrganizationMemberRequest) (*authv1.AddOrganizationMemberResponse, error) {
+	org, membership, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageOrg(membership.Role) {
+		return nil, status.Error(codes.PermissionDenied, "only owners and admins can add members")
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	role := models.OrgRoleMember
+	if req.Role != authv1.OrgRole_ORG_ROLE_UNSPECIFIED {
+		if role, err = orgRoleFromProto(req.Role); err != nil {
+			return nil, err
+		}
+	}
+	if role == models.OrgRoleOwner && membership.Role != models.OrgRoleOwner {
+		return nil, status.Error(codes.PermissionDenied, "only owners can add owners")
+	}
+
+	user, err := h.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "no user with this email")
+		}
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	member := &models.OrganizationMember{
+		OrgID:  org.ID,
+		UserID: user.ID,
+		Role:   role,
+	}
+	if err := h.orgRepo.AddMember(ctx, member); err != nil {
+		if errors.Is(err, repository.ErrAlreadyMember) {
+			return nil, status.Error(codes.AlreadyExists, "user is already a member of this organization")
+		}
+		return nil, status.Error(codes.Internal, "failed to add member")
+	}
+
+	return &authv1.AddOrganizationMemberResponse{
+		Member: memberToProto(member, user),
+	}, nil
+}
+
+// UpdateOrganizationMember changes a member's role. Only owners can grant or revoke the
+// owner role, and the last owner cannot be demoted.
+func (h *AuthHandler) UpdateOrganizationMember(ctx context.Context, req *authv1.UpdateOrganizationMemberRequest) (*authv1.UpdateOrganizationMemberResponse, error) {
+	org, membership, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageOrg(membership.Role) {
+		return nil, status.Error(codes.PermissionDenied, "only owners and admins can change roles")
+	}
+
+	role, err := orgRoleFromProto(req.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := h.findMember(ctx, org.ID, req.MemberId)
+	if err != nil {
+		return nil, err
+	}
+
+	if (role == models.OrgRoleOwner || member.Role == models.OrgRoleOwner) && membership.Role != models.OrgRoleOwner {
+		return nil, status.Error(codes.PermissionDenied, "only owners can grant or revoke the owner role")
+	}
+
+	if member.Role == models.OrgRoleOwner && role != models.OrgRoleOwner {
+		if err := h.ensureAnotherOwner(ctx, org.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	member.Role = role
+	if err := h.orgRepo.UpdateMemberRole(ctx, member); err != nil {
+		if errors.Is(err, repository.ErrMembershipNotFound) {
+			return nil, status.Error(codes.NotFound, "member not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to update member")
+	}
+
+	user, err := h.userRepo.FindByID(ctx, member.UserID.Hex())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	return &authv1.UpdateOrganizationMemberResponse{
+		Member: memberToProto(member, user),
+	}, nil
+}
+
+// RemoveOrganizationMember removes a member. Any member can leave; admins can remove
+// members and admins, and only owners can remove owners. The last owner cannot leave.
+func (h *AuthHandler) RemoveOrganizationMember(ctx context.Context, req *authv1.RemoveOrganizationMemberRequest) (*authv1.RemoveOrganizationMemberResponse, error) {
+	org, membership, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := h.findMember(ctx, org.ID, req.MemberId)
+	if err != nil {
+		return nil, err
+	}
+
+	leaving := member.UserID == membership.UserID
+	if !leaving {
+		if !canManageOrg(membership.Role) {
+			return nil, status.Error(codes.PermissionDenied, "only owners and admins can remove members")
+		}
+		if member.Role == models.OrgRoleOwner && membership.Role != models.OrgRoleOwner {
+			return nil, status.Error(codes.PermissionDenied, "only owners can remove owners")
+		}
+	}
+
+	if member.Role == models.OrgRoleOwner {
+		if err := h.ensureAnotherOwner(ctx, org.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := h.orgRepo.RemoveMember(ctx, org.ID, member.UserID); err != nil {
+		if errors.Is(err, repository.ErrMembershipNotFound) {
+			return nil, status.Error(codes.NotFound, "member not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to remove member")
+	}
+
+	// Tokens already issued for the organization stop carrying it once the membership is
+	// gone; this makes the next refresh fall back to the personal workspace
+	if user, err := h.userRepo.FindByID(ctx, member.UserID.Hex()); err == nil && user.ActiveOrgID == org.ID {
+		if err := h.userRepo.SetActiveOrganization(ctx, user.ID, primitive.NilObjectID); err != nil {
+			log.Printf("Failed to reset active organization of user %s: %v", user.ID.Hex(), err)
+		}
+	}
+
+	message := "Member removed"
+	if leaving {
+		message = "You have left the organization"
+	}
+
+	return &authv1.RemoveOrganizationMemberResponse{
+		Message: message,
+	}, nil
+}
+
+// SwitchOrganization makes org_id the caller's active organization and issues an access
+// token for it. Refreshed tokens keep the organization until the user switches again.
+func (h *AuthHandler) SwitchOrganization(ctx context.Context, req *authv1.SwitchOrganizationRequest) (*authv1.SwitchOrganizationResponse, error) {
+	userID, err := parseUserID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	orgID := primitive.NilObjectID
+	var org *models.Organization
+	var membership *models.OrganizationMember
+	if req.OrgId != "" {
+		if org, membership, err = h.requireMembership(ctx, req.UserId, req.OrgId); err != nil {
+			return nil, err
+		}
+		orgID = org.ID
+	}
+
+	if err := h.userRepo.SetActiveOrganization(ctx, userID, orgID); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to switch organization")
+	}
+
+	user, err := h.userRepo.FindByID(ctx, req.UserId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	accessToken, expiresIn, err := h.generateAccessToken(ctx, user)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate access token")
+	}
+
+	resp := &authv1.SwitchOrganizationResponse{
+		AccessToken: accessToken,
+		ExpiresIn:   expiresIn,
+	}
+	if org != nil {
+		resp.Organization = orgToProto(org, membership.Role)
+	}
+
+	return resp, nil
+}
+
+// generateAccessToken issues an access token carrying the user's active organization,
+// provided they are still a member of it
+func (h *AuthHandler) generateAccessToken(ctx context.Context, user *models.User) (string, int64, error) {
+	var orgID, orgRole string
+	if !user.ActiveOrgID.IsZero() {
+		membership, err := h.orgRepo.FindMembership(ctx, user.ActiveOrgID, user.ID)
+		if err != nil && !errors.Is(err, repository.ErrMembershipNotFound) {
+			return "", 0, err
+		}
+		if membership != nil {
+			orgID = membership.OrgID.Hex()
+			orgRole = string(membership.Role)
+		}
+	}
+
+	return h.jwtService.GenerateAccessToken(user.ID.Hex(), user.Email, user.EmailVerified, user.TenantID, orgID, orgRole)
+}
+
+// claimsMembership returns the current membership for the organization a token was
+// issued for, or nil if the token carries none or the user has since left it
+func (h *AuthHandler) claimsMembership(ctx context.Context, claims *service.JWTClaims) (*models.OrganizationMember, error) {
+	if claims.OrgID == "" {
+		return nil, nil
+	}
+
+	orgID, err := primitive.ObjectIDFromHex(claims.OrgID)
+	if err != nil {
+		return nil, nil
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil, nil
+	}
+
+	membership, err := h.orgRepo.FindMembership(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMembershipNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return membership, nil
+}
+
+// requireMembership loads an organization and the caller's membership in it. Non-members
+// get NotFound so organization IDs cannot be probed.
+func (h *AuthHandler) requireMembership(ctx context.Context, userIDHex, orgIDHex string) (*models.Organization, *models.OrganizationMember, error) {
+	userID, err := parseUserID(userIDHex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if orgIDHex == "" {
+		return nil, nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+	orgID, err := primitive.ObjectIDFromHex(orgIDHex)
+	if err != nil {
+		return nil, nil, status.Error(codes.NotFound, "organization not found")
+	}
+
+	membership, err := h.orgRepo.FindMembership(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMembershipNotFound) {
+			return nil, nil, status.Error(codes.NotFound, "organization not found")
+		}
+		return nil, nil, status.Error(codes.Internal, "failed to find organization")
+	}
+
+	org, err := h.orgRepo.FindByID(ctx, orgID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrganizationNotFound) {
+			return nil, nil, status.Error(codes.NotFound, "organization not found")
+		}
+		return nil, nil, status.Error(codes.Internal, "failed to find organization")
+	}
+
+	return org, membership, nil
+}
+
+func (h *AuthHandler) findMember(ctx context.Context, orgID primitive.ObjectID, memberIDHex string) (*models.OrganizationMember, error) {
+	if memberIDHex == "" {
+		return nil, status.Error(codes.InvalidArgument, "member_id is required")
+	}
+	memberID, err := primitive.ObjectIDFromHex(memberIDHex)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "member not found")
+	}
+
+	member, err := h.orgRepo.FindMembership(ctx, orgID, memberID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMembershipNotFound) {
+			return nil, status.Error(codes.NotFound, "member not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to find member")
+	}
+	return member, nil
+}
+
+// ensureAnotherOwner rejects changes that would leave the organization without an owner
+func (h *AuthHandler) ensureAnotherOwner(ctx context.Context, orgID primitive.ObjectID) error {
+	owners, err := h.orgRepo.CountOwners(ctx, orgID)
+	if err != nil {
+		return status.Error(codes.Internal, "failed to count owners")
+	}
+	if owners <= 1 {
+		return status.Error(codes.FailedPrecondition, "an organization must keep at least one owner")
+	}
+	return nil
+}
+
+func parseUserID(userID string) (primitive.ObjectID, error) {
+	if userID == "" {
+		return primitive.NilObjectID, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return primitive.NilObjectID, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	return id, nil
+}
+
+func validateOrgName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, "name is required")
+	}
+	if utf8.RuneCountInString(name) > maxOrgNameLength {
+		return "", status.Errorf(codes.InvalidArgument, "name must be at most %d characters", maxOrgNameLength)
+	}
+	return name, nil
+}
+
+// slugify derives a URL-friendly identifier from an organization name
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+		} else if b.Len() > 0 && !dash {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= maxSlugLength {
+			break
+		}
+	}
+
+	slug := strings.Trim(b.String(), "-")
+	if slug == "" {
+		return "org"
+	}
+	return slug
+}
+
+func canManageOrg(role models.OrgRole) bool {
+	return role == models.OrgRoleOwner || role == models.OrgRoleAdmin
+}
+
+func orgRoleToProto(role models.OrgRole) authv1.OrgRole {
+	switch role {
+	case models.OrgRoleOwner:
+		return authv1.OrgRole_ORG_ROLE_OWNER
+	case models.OrgRoleAdmin:
+		return authv1.OrgRole_ORG_ROLE_ADMIN
+	case models.OrgRoleMember:
+		return authv1.OrgRole_ORG_ROLE_MEMBER
+	default:
+		return authv1.OrgRole_ORG_ROLE_UNSPECIFIED
+	}
+}
+
+func orgRoleFromProto(role authv1.OrgRole) (models.OrgRole, error) {
+	switch role {
+	case authv1.OrgRole_ORG_ROLE_OWNER:
+		return models.OrgRoleOwner, nil
+	case authv1.OrgRole_ORG_ROLE_ADMIN:
+		return models.OrgRoleAdmin, nil
+	case authv1.OrgRole_ORG_ROLE_MEMBER:
+		return models.OrgRoleMember, nil
+	default:
+		return "", status.Error(codes.InvalidArgument, "role must be owner, admin or member")
+	}
+}
+
+// orgToProto converts an organization to its API representation with the caller's role
+func orgToProto(org *models.Organization, role models.OrgRole) *authv1.Organization {
+	return &authv1.Organization{
+		OrgId:     org.ID.Hex(),
+		Name:      org.Name,
+		Slug:      org.Slug,
+		Role:      orgRoleToProto(role),
+		CreatedAt: timestamppb.New(org.CreatedAt),
+		UpdatedAt: timestamppb.New(org.UpdatedAt),
+	}
+}
+
+func memberToProto(member *models.OrganizationMember, user *models.User) *authv1.OrganizationMember {
+	return &authv1.OrganizationMember{
+		UserId:    user.ID.Hex(),
+		Email:     user.Email,
+		FullName:  user.FullName,
+		AvatarUrl: user.AvatarURL,
+		Role:      orgRoleToProto(member.Role),
+		JoinedAt:  timestamppb.New(member.CreatedAt),
+	}
+}
@@ -0,0 +1,162 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (h *AuthHandler) GetPasswordPolicy(ctx context.Context, req *authv1.GetPasswordPolicyRequest) (*authv1.GetPasswordPolicyResponse, error) {
+	return &authv1.GetPasswordPolicyResponse{
+		Policy: passwordPolicyToProto(h.passwordPolicy.DefaultPolicy()),
+	}, nil
+}
+
+// GetOrganizationPasswordPolicy returns an organization's own policy and the policy its
+// members' passwords must satisfy
+func (h *AuthHandler) GetOrganizationPasswordPolicy(ctx context.Context, req *authv1.GetOrganizationPasswordPolicyRequest) (*authv1.OrganizationPasswordPolicyResponse, error) {
+	org, _, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.orgPasswordPolicyResponse(org), nil
+}
+
+// UpdateOrganizationPasswordPolicy sets the organization's password policy. It applies to
+// passwords members choose from now on; existing passwords are not invalidated.
+func (h *AuthHandler) UpdateOrganizationPasswordPolicy(ctx context.Context, req *authv1.UpdateOrganizationPasswordPolicyRequest) (*authv1.OrganizationPasswordPolicyResponse, error) {
+	org, membership, err := h.requireMembership(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	if membership.Role != models.OrgRoleOwner {
+		return nil, status.Error(codes.PermissionDenied, "only owners can change the password policy")
+	}
+
+	policy, err := passwordPolicyFromProto(req.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	org.PasswordPolicy = nil
+	if policy != (models.PasswordPolicy{}) {
+		org.PasswordPolicy = &policy
+	}
+
+	if err := h.orgRepo.UpdatePasswordPolicy(ctx, org); err != nil {
+		if errors.Is(err, repository.ErrOrganizationNotFound) {
+			return nil, status.Error(codes.NotFound, "organization not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to update password policy")
+	}
+
+	return h.orgPasswordPolicyResponse(org), nil
+}
+
+func (h *AuthHandler) orgPasswordPolicyResponse(org *models.Organization) *authv1.OrganizationPasswordPolicyResponse {
+	effective := h.passwordPolicy.DefaultPolicy()
+	resp := &authv1.OrganizationPasswordPolicyResponse{}
+	if org.PasswordPolicy != nil {
+		resp.Policy = passwordPolicyToProto(*org.PasswordPolicy)
+		effective = effective.Merge(*org.PasswordPolicy)
+	}
+	resp.EffectivePolicy = passwordPolicyToProto(effective)
+	return resp
+}
+
+// passwordPolicyForUser returns the policy a user's password must satisfy: the
+// service-wide policy tightened by every organization the user belongs to
+func (h *AuthHandler) passwordPolicyForUser(ctx context.Context, userID primitive.ObjectID) (models.PasswordPolicy, error) {
+	memberships, err := h.orgRepo.ListMemberships(ctx, userID)
+	if err != nil {
+		return models.PasswordPolicy{}, err
+	}
+
+	orgIDs := make([]primitive.ObjectID, 0, len(memberships))
+	for _, membership := range memberships {
+		orgIDs = append(orgIDs, membership.OrgID)
+	}
+
+	return h.passwordPolicyForOrgs(ctx, orgIDs)
+}
+
+// passwordPolicyForOrgs returns the service-wide policy tightened by the organizations
+func (h *AuthHandler) passwordPolicyForOrgs(ctx context.Context, orgIDs []primitive.ObjectID) (models.PasswordPolicy, error) {
+	policy := h.passwordPolicy.DefaultPolicy()
+	if len(orgIDs) == 0 {
+		return policy, nil
+	}
+
+	orgs, err := h.orgRepo.FindByIDs(ctx, orgIDs)
+	if err != nil {
+		return models.PasswordPolicy{}, err
+	}
+
+	for _, org := range orgs {
+		if org.PasswordPolicy != nil {
+			policy = policy.Merge(*org.PasswordPolicy)
+		}
+	}
+	return policy, nil
+}
+
+// validateNewPassword checks a new password against policy and reports violations as an
+// InvalidArgument status
+func (h *AuthHandler) validateNewPassword(ctx context.Context, password string, policy models.PasswordPolicy, userInputs ...string) error {
+	err := h.passwordPolicy.Validate(ctx, password, policy, userInputs...)
+	if err == nil {
+		return nil
+	}
+
+	var policyErr *service.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return status.Error(codes.InvalidArgument, policyErr.Error())
+	}
+	return status.Error(codes.Internal, "failed to validate password")
+}
+
+func passwordPolicyToProto(policy models.PasswordPolicy) *authv1.PasswordPolicy {
+	minLength := policy.MinLength
+	if minLength < service.MinPasswordLength {
+		minLength = service.MinPasswordLength
+	}
+
+	return &authv1.PasswordPolicy{
+		MinLength:              int32(minLength),
+		MaxLength:              service.MaxPasswordLength,
+		RequireUppercase:       policy.RequireUppercase,
+		RequireLowercase:       policy.RequireLowercase,
+		RequireDigit:           policy.RequireDigit,
+		RequireSymbol:          policy.RequireSymbol,
+		DenyCommonPasswords:    policy.DenyCommon,
+		CheckBreachedPasswords: policy.CheckBreached,
+	}
+}
+
+func passwordPolicyFromProto(policy *authv1.PasswordPolicy) (models.PasswordPolicy, error) {
+	if policy == nil {
+		return models.PasswordPolicy{}, nil
+	}
+
+	if policy.MinLength < 0 || policy.MinLength > service.MaxPasswordLength {
+		return models.PasswordPolicy{}, status.Errorf(codes.InvalidArgument, "min_length must be at most %d", service.MaxPasswordLength)
+	}
+
+	return models.PasswordPolicy{
+		MinLength:        int(policy.MinLength),
+		RequireUppercase: policy.RequireUppercase,
+		RequireLowercase: policy.RequireLowercase,
+		RequireDigit:     policy.RequireDigit,
+		RequireSymbol:    policy.RequireSymbol,
+		DenyCommon:       policy.DenyCommonPasswords,
+		CheckBreached:    policy.CheckBreachedPasswords,
+	}, nil
+}
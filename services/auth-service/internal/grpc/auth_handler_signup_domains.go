@@ -0,0 +1,179 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const maxSignupDomainNoteLength = 200
+
+func (h *AuthHandler) ListSignupDomainRules(ctx context.Context, req *authv1.ListSignupDomainRulesRequest) (*authv1.ListSignupDomainRulesResponse, error) {
+	if _, err := h.requireAdmin(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	rules, err := h.signupDomainRepo.List(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list signup domain rules")
+	}
+
+	resp := &authv1.ListSignupDomainRulesResponse{
+		Rules:                    make([]*authv1.SignupDomainRule, 0, len(rules)),
+		ConfiguredAllowedDomains: h.signupDomains.AllowedDomains(),
+		ConfiguredBlockedDomains: h.signupDomains.BlockedDomains(),
+		BlockDisposableDomains:   h.signupDomains.BlocksDisposable(),
+	}
+	for _, rule := range rules {
+		resp.Rules = append(resp.Rules, signupDomainRuleToProto(rule))
+	}
+
+	return resp, nil
+}
+
+// SetSignupDomainRule allows or blocks an email domain. Existing accounts are not affected.
+func (h *AuthHandler) SetSignupDomainRule(ctx context.Context, req *authv1.SetSignupDomainRuleRequest) (*authv1.SetSignupDomainRuleResponse, error) {
+	admin, err := h.requireAdmin(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := service.NormalizeDomain(req.Domain)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "domain must be a valid domain name such as example.com")
+	}
+
+	var action models.SignupDomainAction
+	switch req.Action {
+	case authv1.SignupDomainAction_SIGNUP_DOMAIN_ACTION_ALLOW:
+		action = models.SignupDomainAllow
+	case authv1.SignupDomainAction_SIGNUP_DOMAIN_ACTION_BLOCK:
+		action = models.SignupDomainBlock
+	default:
+		return nil, status.Error(codes.InvalidArgument, "action must be allow or block")
+	}
+
+	note := strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(note) > maxSignupDomainNoteLength {
+		return nil, status.Errorf(codes.InvalidArgument, "note must be at most %d characters", maxSignupDomainNoteLength)
+	}
+
+	rule := &models.SignupDomainRule{
+		Domain:    domain,
+		Action:    action,
+		Note:      note,
+		CreatedBy: admin.ID,
+	}
+	if err := h.signupDomainRepo.Upsert(ctx, rule); err != nil {
+		return nil, status.Error(codes.Internal, "failed to save signup domain rule")
+	}
+
+	h.recordAudit(ctx, models.AuditEventSignupDomainRuleSet, admin, map[string]string{
+		"domain": domain,
+		"action": string(action),
+	})
+
+	return &authv1.SetSignupDomainRuleResponse{
+		Rule: signupDomainRuleToProto(rule),
+	}, nil
+}
+
+func (h *AuthHandler) DeleteSignupDomainRule(ctx context.Context, req *authv1.DeleteSignupDomainRuleRequest) (*authv1.DeleteSignupDomainRuleResponse, error) {
+	admin, err := h.requireAdmin(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := service.NormalizeDomain(req.Domain)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "signup domain rule not found")
+	}
+
+	if err := h.signupDomainRepo.Delete(ctx, domain); err != nil {
+		if errors.Is(err, repository.ErrSignupDomainRuleNotFound) {
+			return nil, status.Error(codes.NotFound, "signup domain rule not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to delete signup domain rule")
+	}
+
+	h.recordAudit(ctx, models.AuditEventSignupDomainRuleDeleted, admin, map[string]string{
+		"domain": domain,
+	})
+
+	return &authv1.DeleteSignupDomainRuleResponse{
+		Message: "Signup domain rule deleted",
+	}, nil
+}
+
+// checkSignupDomain rejects emails whose domain may not sign up. Registrations are rejected
+// while the rules cannot be loaded.
+func (h *AuthHandler) checkSignupDomain(ctx context.Context, email string) error {
+	rules, err := h.signupDomainRepo.List(ctx)
+	if err != nil {
+		return status.Error(codes.Internal, "failed to check email domain")
+	}
+
+	var allowed, blocked []string
+	for _, rule := range rules {
+		switch rule.Action {
+		case models.SignupDomainAllow:
+			allowed = append(allowed, rule.Domain)
+		case models.SignupDomainBlock:
+			blocked = append(blocked, rule.Domain)
+		}
+	}
+
+	if err := h.signupDomains.Check(email, allowed, blocked); err != nil {
+		return status.Error(codes.PermissionDenied, "sign up is not available for this email domain")
+	}
+	return nil
+}
+
+// requireAdmin loads the user and requires them to be a service administrator: their
+// verified email must be listed in ADMIN_EMAILS
+func (h *AuthHandler) requireAdmin(ctx context.Context, userIDHex string) (*models.User, error) {
+	if _, err := parseUserID(userIDHex); err != nil {
+		return nil, err
+	}
+
+	user, err := h.userRepo.FindByID(ctx, userIDHex)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.PermissionDenied, "administrator access required")
+		}
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	if !user.EmailVerified || !slices.Contains(h.cfg.AdminEmails, strings.ToLower(user.Email)) {
+		return nil, status.Error(codes.PermissionDenied, "administrator access required")
+	}
+
+	return user, nil
+}
+
+func signupDomainRuleToProto(rule *models.SignupDomainRule) *authv1.SignupDomainRule {
+	resp := &authv1.SignupDomainRule{
+		Domain:    rule.Domain,
+		Note:      rule.Note,
+		CreatedBy: rule.CreatedBy.Hex(),
+		CreatedAt: timestamppb.New(rule.CreatedAt),
+		UpdatedAt: timestamppb.New(rule.UpdatedAt),
+	}
+	switch rule.Action {
+	case models.SignupDomainAllow:
+		resp.Action = authv1.SignupDomainAction_SIGNUP_DOMAIN_ACTION_ALLOW
+	case models.SignupDomainBlock:
+		resp.Action = authv1.SignupDomainAction_SIGNUP_DOMAIN_ACTION_BLOCK
+	}
+	return resp
+}
@@ -0,0 +1,149 @@
+package grpc
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	minSearchQueryLength   = 2
+	defaultUserSearchLimit = 10
+	maxUserSearchLimit     = 25
+	maxResolveEmails       = 100
+	defaultListUserIDs     = 500
+	maxListUserIDs         = 1000
+)
+
+// SearchUsers finds users for the share dialog. A full email address matches any
+// registered user, since the searcher already knows it; partial text only matches users
+// who opted in to the directory. Searches are rate limited per user to slow down email
+// enumeration.
+func (h *AuthHandler) SearchUsers(ctx context.Context, req *authv1.SearchUsersRequest) (*authv1.SearchUsersResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	requesterID, err := primitive.ObjectIDFromHex(req.UserId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+
+	query := strings.TrimSpace(req.Query)
+	if utf8.RuneCountInString(query) < minSearchQueryLength {
+		return nil, status.Errorf(codes.InvalidArgument, "query must be at least %d characters", minSearchQueryLength)
+	}
+
+	if err := h.checkRateLimit(ctx, service.RateLimitUserSearch, req.UserId); err != nil {
+		return nil, err
+	}
+
+	limit := int64(req.Limit)
+	if limit <= 0 {
+		limit = defaultUserSearchLimit
+	}
+	if limit > maxUserSearchLimit {
+		limit = maxUserSearchLimit
+	}
+
+	var found []*models.User
+	if strings.Contains(query, "@") {
+		if _, err := mail.ParseAddress(query); err != nil {
+			return &authv1.SearchUsersResponse{}, nil
+		}
+		found, err = h.userRepo.FindByEmails(ctx, []string{query})
+	} else {
+		found, err = h.userRepo.SearchDirectory(ctx, query, requesterID, limit)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to search users")
+	}
+
+	users := make([]*authv1.UserSummary, 0, len(found))
+	for _, user := range found {
+		if user.ID == requesterID {
+			continue
+		}
+		users = append(users, userSummary(user))
+	}
+
+	return &authv1.SearchUsersResponse{Users: users}, nil
+}
+
+func (h *AuthHandler) ResolveUsersByEmail(ctx context.Context, req *authv1.ResolveUsersByEmailRequest) (*authv1.ResolveUsersByEmailResponse, error) {
+	if len(req.Emails) == 0 {
+		return &authv1.ResolveUsersByEmailResponse{}, nil
+	}
+	if len(req.Emails) > maxResolveEmails {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d emails can be resolved at once", maxResolveEmails)
+	}
+
+	found, err := h.userRepo.FindByEmails(ctx, req.Emails)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to resolve users")
+	}
+
+	users := make([]*authv1.UserSummary, 0, len(found))
+	for _, user := range found {
+		users = append(users, userSummary(user))
+	}
+
+	return &authv1.ResolveUsersByEmailResponse{Users: users}, nil
+}
+
+// ListUserIDs pages through the IDs of all users or of an organization's members
+func (h *AuthHandler) ListUserIDs(ctx context.Context, req *authv1.ListUserIDsRequest) (*authv1.ListUserIDsResponse, error) {
+	limit := int64(req.Limit)
+	if limit <= 0 {
+		limit = defaultListUserIDs
+	}
+	if limit > maxListUserIDs {
+		limit = maxListUserIDs
+	}
+
+	var after primitive.ObjectID
+	var err error
+	if req.AfterUserId != "" {
+		if after, err = primitive.ObjectIDFromHex(req.AfterUserId); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid after_user_id")
+		}
+	}
+
+	var ids []primitive.ObjectID
+	if req.OrgId != "" {
+		orgID, err := primitive.ObjectIDFromHex(req.OrgId)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid org_id")
+		}
+		if ids, err = h.orgRepo.ListMemberIDs(ctx, orgID, after, limit); err != nil {
+			return nil, status.Error(codes.Internal, "failed to list organization members")
+		}
+	} else if ids, err = h.userRepo.ListIDs(ctx, after, limit); err != nil {
+		return nil, status.Error(codes.Internal, "failed to list users")
+	}
+
+	userIDs := make([]string, len(ids))
+	for i, id := range ids {
+		userIDs[i] = id.Hex()
+	}
+
+	return &authv1.ListUserIDsResponse{UserIds: userIDs}, nil
+}
+
+// userSummary returns the public view of a user
+func userSummary(user *models.User) *authv1.UserSummary {
+	return &authv1.UserSummary{
+		UserId:    user.ID.Hex(),
+		Email:     user.Email,
+		FullName:  user.FullName,
+		AvatarUrl: user.AvatarURL,
+	}
+}
@@ -0,0 +1,122 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/auth/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// resendVerificationMessage is returned whether or not the account exists so the
+// endpoint cannot be used to discover registered emails
+const resendVerificationMessage = "If an unverified account with that email exists, a new verification link has been sent"
+
+func (h *AuthHandler) VerifyEmail(ctx context.Context, req *authv1.VerifyEmailRequest) (*authv1.VerifyEmailResponse, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	verificationToken, err := h.emailVerificationRepo.Consume(ctx, service.HashOneTimeToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrVerificationTokenInvalid) {
+			return nil, status.Error(codes.InvalidArgument, "verification token is invalid or has expired")
+		}
+		return nil, status.Error(codes.Internal, "failed to verify token")
+	}
+
+	if err := h.userRepo.MarkEmailVerified(ctx, verificationToken.UserID); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.InvalidArgument, "verification token is invalid or has expired")
+		}
+		return nil, status.Error(codes.Internal, "failed to verify email")
+	}
+
+	if h.userEvents != nil {
+		user, err := h.userRepo.FindByID(ctx, verificationToken.UserID.Hex())
+		if err != nil {
+			log.Printf("Failed to find user %s to publish their email verification: %v", verificationToken.UserID.Hex(), err)
+		} else {
+			h.userEvents.EmailVerified(user)
+		}
+	}
+
+	return &authv1.VerifyEmailResponse{
+		Message: "Email verified successfully",
+	}, nil
+}
+
+func (h *AuthHandler) ResendVerificationEmail(ctx context.Context, req *authv1.ResendVerificationEmailRequest) (*authv1.ResendVerificationEmailResponse, error) {
+	if req.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if err := h.checkRateLimit(ctx, service.RateLimitVerificationResend, req.Email); err != nil {
+		return nil, err
+	}
+
+	user, err := h.userRepo.FindByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return &authv1.ResendVerificationEmailResponse{Message: resendVerificationMessage}, nil
+		}
+		return nil, status.Error(codes.Internal, "failed to find user")
+	}
+
+	if !user.EmailVerified {
+		go h.sendVerificationEmail(user)
+	}
+
+	return &authv1.ResendVerificationEmailResponse{Message: resendVerificationMessage}, nil
+}
+
+// sendVerificationEmail replaces any outstanding verification tokens of the user with a
+// new one and emails the verification link
+func (h *AuthHandler) sendVerificationEmail(user *models.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := h.emailVerificationRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		log.Printf("Failed to invalidate verification tokens for user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	token, tokenHash, err := service.GenerateOneTimeToken()
+	if err != nil {
+		log.Printf("Failed to generate verification token for user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	expiry := time.Duration(h.cfg.EmailVerificationExpiry) * time.Second
+	verificationToken := &models.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(expiry),
+	}
+
+	if err := h.emailVerificationRepo.Create(ctx, verificationToken); err != nil {
+		log.Printf("Failed to store verification token for user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/auth/verify-email?token=%s", h.cfg.FrontendURL, url.QueryEscape(token))
+	message := fmt.Sprintf(
+		"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"This link expires in %d hours. Until your email is verified, file sharing is disabled and uploads are limited.",
+		user.FullName, link, int(expiry.Hours()),
+	)
+
+	if err := h.notificationClient.SendSecurityEmail(ctx, user.ID.Hex(), user.Email, "Verify your email address", message, map[string]string{
+		"kind": "email_verification",
+	}); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID.Hex(), err)
+	}
+}
@@ -0,0 +1,180 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// securityAlertUserID is the recipient ID used for alerts sent to the security contact
+const securityAlertUserID = "security"
+
+// clientIPFromContext returns the address of the end user. Behind the gRPC-Gateway this is
+// the last X-Forwarded-For entry, which the gateway appends itself and clients cannot forge.
+func clientIPFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-forwarded-for"); len(values) > 0 {
+			hops := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+
+	return ""
+}
+
+// checkLoginAllowed rejects the attempt if the account or address is locked or throttled.
+// Redis failures do not block logins.
+func (h *AuthHandler) checkLoginAllowed(ctx context.Context, email, ip string) error {
+	if h.loginProtection == nil {
+		return nil
+	}
+
+	err := h.loginProtection.Check(ctx, email, ip)
+	if err == nil {
+		return nil
+	}
+
+	var blocked *service.LoginBlockedError
+	if errors.As(err, &blocked) {
+		seconds := int64(math.Ceil(blocked.RetryAfter.Seconds()))
+		return status.Errorf(codes.ResourceExhausted, "%s, please try again in %d seconds", blocked.Reason.Error(), seconds)
+	}
+
+	log.Printf("Login protection check failed, allowing attempt: %v", err)
+	return nil
+}
+
+// checkRateLimit counts a request to a rate-limited endpoint from the caller's address and
+// for account. Redis failures do not block requests.
+func (h *AuthHandler) checkRateLimit(ctx context.Context, endpoint, account string) error {
+	if h.rateLimiter == nil {
+		return nil
+	}
+
+	err := h.rateLimiter.Allow(ctx, endpoint, clientIPFromContext(ctx), account)
+	if err == nil {
+		return nil
+	}
+
+	var limited *service.RateLimitedError
+	if errors.As(err, &limited) {
+		seconds := int64(math.Ceil(limited.RetryAfter.Seconds()))
+		return status.Errorf(codes.ResourceExhausted, "too many requests, please try again in %d seconds", seconds)
+	}
+
+	log.Printf("Rate limit check for %s failed, allowing request: %v", endpoint, err)
+	return nil
+}
+
+// recordLoginFailure counts a failed login and raises security alerts when an account is
+// locked or an address is blocked. user is nil when the email is not registered.
+func (h *AuthHandler) recordLoginFailure(ctx context.Context, email, ip string, user *models.User) {
+	if h.loginProtection == nil {
+		return
+	}
+
+	result, err := h.loginProtection.RecordFailure(ctx, email, ip)
+	if err != nil {
+		log.Printf("Failed to record failed login: %v", err)
+		return
+	}
+
+	if result.AccountLocked {
+		log.Printf("Security alert: account %s locked after repeated failed logins (last attempt from %s)", email, ip)
+		h.recordAuditEvent(ctx, &models.AuditEvent{
+			Type:   models.AuditEventAccountLocked,
+			UserID: auditUserID(user),
+			Email:  email,
+		})
+		if user != nil {
+			go h.sendAccountLockedAlert(user, ip)
+		}
+	}
+
+	if result.IPBlocked {
+		log.Printf("Security alert: address %s blocked after %d failed logins, possible credential stuffing", ip, result.IPFailures)
+		go h.sendIPBlockedAlert(ip, result.IPFailures)
+	}
+}
+
+func (h *AuthHandler) recordLoginSuccess(ctx context.Context, email string) {
+	if h.loginProtection == nil {
+		return
+	}
+
+	if err := h.loginProtection.RecordSuccess(ctx, email); err != nil {
+		log.Printf("Failed to clear failed login history: %v", err)
+	}
+}
+
+func (h *AuthHandler) unlockLogin(ctx context.Context, email string) {
+	if h.loginProtection == nil {
+		return
+	}
+
+	if err := h.loginProtection.Unlock(ctx, email); err != nil {
+		log.Printf("Failed to clear login lockout: %v", err)
+	}
+}
+
+// sendAccountLockedAlert tells the account owner that their account was locked
+func (h *AuthHandler) sendAccountLockedAlert(user *models.User, ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	message := fmt.Sprintf(
+		"Hi %s,\n\nYour account was temporarily locked for %d minutes after several failed sign-in attempts (last attempt from %s).\n\n"+
+			"If this was not you, we recommend resetting your password at %s/auth/forgot-password.",
+		user.FullName, int(h.loginProtection.LockoutDuration().Minutes()), ip, h.cfg.FrontendURL,
+	)
+
+	if err := h.notificationClient.SendSecurityEmail(ctx, user.ID.Hex(), user.Email, "Your account has been temporarily locked", message, map[string]string{
+		"kind":       "account_locked",
+		"ip_address": ip,
+	}); err != nil {
+		log.Printf("Failed to send account locked alert to user %s: %v", user.ID.Hex(), err)
+	}
+}
+
+// sendIPBlockedAlert tells the security contact that an address was blocked
+func (h *AuthHandler) sendIPBlockedAlert(ip string, failures int64) {
+	if h.cfg.SecurityAlertEmail == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	message := fmt.Sprintf(
+		"The address %s was blocked for %d minutes after %d failed sign-in attempts across accounts. This may indicate a credential stuffing attack.",
+		ip, int(h.loginProtection.LockoutDuration().Minutes()), failures,
+	)
+
+	if err := h.notificationClient.SendSecurityEmail(ctx, securityAlertUserID, h.cfg.SecurityAlertEmail, "Login attempts blocked from "+ip, message, map[string]string{
+		"kind":       "ip_blocked",
+		"ip_address": ip,
+	}); err != nil {
+		log.Printf("Failed to send IP blocked alert: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	filev1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/file/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxFullNameLength = 100
+
+// avatarMimeTypes are the image types accepted as avatars. SVG is excluded because it
+// can carry scripts.
+var avatarMimeTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// checkAvatarFile verifies that fileID is an uploaded image owned by userID that fits the
+// avatar size limit
+func (h *AuthHandler) checkAvatarFile(ctx context.Context, userID, fileID string) error {
+	if h.fileClient == nil {
+		return status.Error(codes.FailedPrecondition, "avatar uploads are not available")
+	}
+
+	file, err := h.fileClient.GetFile(ctx, userID, fileID)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound, codes.PermissionDenied, codes.InvalidArgument:
+			return status.Error(codes.InvalidArgument, "avatar file not found")
+		}
+		log.Printf("Failed to look up avatar file %s for user %s: %v", fileID, userID, err)
+		return status.Error(codes.Unavailable, "failed to look up avatar file")
+	}
+
+	if file.OwnerId != userID {
+		return status.Error(codes.InvalidArgument, "avatar file not found")
+	}
+	if file.Status != filev1.FileStatus_FILE_STATUS_AVAILABLE {
+		return status.Error(codes.FailedPrecondition, "avatar file has not finished uploading")
+	}
+	if !avatarMimeTypes[strings.ToLower(file.MimeType)] {
+		return status.Error(codes.InvalidArgument, "avatar must be a PNG, JPEG, GIF or WebP image")
+	}
+	if file.Size > h.cfg.AvatarMaxSize {
+		return status.Errorf(codes.InvalidArgument, "avatar must not be larger than %d bytes", h.cfg.AvatarMaxSize)
+	}
+
+	return nil
+}
+
+// avatarURL returns the stable URL of an uploaded avatar. The file ID is included so
+// clients refetch the image when the avatar changes.
+func (h *AuthHandler) avatarURL(userID, fileID string) string {
+	return fmt.Sprintf("%s/api/v1/auth/user/%s/avatar?v=%s", h.cfg.PublicURL, url.PathEscape(userID), url.QueryEscape(fileID))
+}
+
+// ServeAvatar redirects to a short-lived download URL of the user's uploaded avatar.
+// Avatars are public so other users can see them next to shared files.
+func (h *AuthHandler) ServeAvatar(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	if h.fileClient == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := h.userRepo.FindByID(r.Context(), pathParams["user_id"])
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "failed to find user", http.StatusInternalServerError)
+		return
+	}
+
+	if user.AvatarFileID == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	downloadURL, expiresIn, err := h.fileClient.GetDownloadURL(r.Context(), user.ID.Hex(), user.AvatarFileID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Failed to get avatar download URL for user %s: %v", user.ID.Hex(), err)
+		http.Error(w, "failed to load avatar", http.StatusBadGateway)
+		return
+	}
+
+	// Let clients reuse the redirect for part of the download URL's lifetime
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", expiresIn/2))
+	http.Redirect(w, r, downloadURL, http.StatusFound)
+}
@@ -0,0 +1,132 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceTokenMetadataKey is the gRPC metadata key carrying the caller's service token
+const ServiceTokenMetadataKey = "x-service-token"
+
+type serviceCallerKey struct{}
+
+// ServiceCallerFromContext returns the client ID of the authenticated calling service
+func ServiceCallerFromContext(ctx context.Context) (string, bool) {
+	clientID, ok := ctx.Value(serviceCallerKey{}).(string)
+	return clientID, ok
+}
+
+// ServiceAuthInterceptor rejects gRPC calls that do not carry a valid service token
+type ServiceAuthInterceptor struct {
+	tokens   *service.ServiceTokenService
+	audience string
+	exempt   map[string]bool
+}
+
+func NewServiceAuthInterceptor(tokens *service.ServiceTokenService, audience string, exemptMethods ...string) *ServiceAuthInterceptor {
+	exempt := make(map[string]bool, len(exemptMethods))
+	for _, method := range exemptMethods {
+		exempt[method] = true
+	}
+
+	return &ServiceAuthInterceptor{
+		tokens:   tokens,
+		audience: audience,
+		exempt:   exempt,
+	}
+}
+
+// Unary returns a unary server interceptor enforcing service authentication
+func (i *ServiceAuthInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := i.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns a stream server interceptor enforcing service authentication
+func (i *ServiceAuthInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (i *ServiceAuthInterceptor) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if i.exempt[fullMethod] || strings.HasPrefix(fullMethod, "/grpc.reflection.") || strings.HasPrefix(fullMethod, "/grpc.health.") {
+		return ctx, nil
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing service token")
+	}
+
+	values := md.Get(ServiceTokenMetadataKey)
+	if len(values) == 0 || values[0] == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing service token")
+	}
+
+	claims, err := i.tokens.ValidateToken(strings.TrimPrefix(values[0], "Bearer "), i.audience)
+	if err != nil {
+		if errors.Is(err, service.ErrExpiredToken) {
+			return nil, status.Error(codes.Unauthenticated, "service token has expired")
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid service token")
+	}
+
+	return context.WithValue(ctx, serviceCallerKey{}, claims.ClientID), nil
+}
+
+// authorizedStream carries the context holding the caller to stream handlers
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+// serviceTokenCredentials attaches locally minted service tokens to outgoing calls.
+// The auth-service uses it for its own gRPC-Gateway connection.
+type serviceTokenCredentials struct {
+	tokens   *service.ServiceTokenService
+	clientID string
+	audience string
+}
+
+// NewServiceTokenCredentials returns per-RPC credentials that sign a fresh service token for each call
+func NewServiceTokenCredentials(tokens *service.ServiceTokenService, clientID, audience string) credentials.PerRPCCredentials {
+	return &serviceTokenCredentials{
+		tokens:   tokens,
+		clientID: clientID,
+		audience: audience,
+	}
+}
+
+func (c *serviceTokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, _, err := c.tokens.GenerateToken(c.clientID, c.audience)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{ServiceTokenMetadataKey: token}, nil
+}
+
+func (c *serviceTokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
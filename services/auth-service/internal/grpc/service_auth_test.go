@@ -0,0 +1,44 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// testServerStream is a server stream with a fixed context
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestServiceAuthInterceptorStreamPassesCaller(t *testing.T) {
+	tokens := service.NewServiceTokenService("test-secret", 300, map[string]string{"file-service": "client-secret"})
+	token, _, err := tokens.GenerateToken("file-service", "auth-service")
+	if err != nil {
+		t.Fatalf("failed to generate service token: %v", err)
+	}
+
+	interceptor := NewServiceAuthInterceptor(tokens, "auth-service")
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ServiceTokenMetadataKey, token))
+
+	var caller string
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		caller, _ = ServiceCallerFromContext(stream.Context())
+		return nil
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/auth.v1.AuthService/Stream"}
+	if err := interceptor.Stream()(nil, &testServerStream{ctx: ctx}, info, handler); err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+	if caller != "file-service" {
+		t.Errorf("stream handler saw caller %q, want %q", caller, "file-service")
+	}
+}
@@ -0,0 +1,59 @@
+// Package migrations lists the auth-service's MongoDB migrations, which it applies on
+// startup and with its migrate subcommand. New migrations are appended with the next
+// version; applied ones are never changed.
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/migrate"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/config"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// All returns the auth-service's migrations. The TTL indexes purging sign-ins and audit
+// events are created with the retention cfg sets.
+func All(cfg *config.Config) []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version:     1,
+			Description: "Create token, sign-in, group, organization and audit indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				loginRetention := time.Duration(cfg.LoginHistoryRetention) * time.Second
+				auditRetention := time.Duration(cfg.AuditLogRetention) * time.Second
+
+				steps := []func(ctx context.Context) error{
+					repository.NewPasswordResetRepository(db).EnsureIndexes,
+					repository.NewEmailVerificationRepository(db).EnsureIndexes,
+					func(ctx context.Context) error {
+						return repository.NewLoginEventRepository(db).EnsureIndexes(ctx, loginRetention)
+					},
+					repository.NewGroupRepository(db).EnsureIndexes,
+					repository.NewOrganizationRepository(db).EnsureIndexes,
+					repository.NewInvitationRepository(db).EnsureIndexes,
+					func(ctx context.Context) error {
+						return repository.NewAuditEventRepository(db).EnsureIndexes(ctx, auditRetention)
+					},
+					repository.NewImpersonationRepository(db).EnsureIndexes,
+					repository.NewSignupDomainRepository(db).EnsureIndexes,
+				}
+				for _, step := range steps {
+					if err := step(ctx); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     2,
+			Description: "Mark users created before email verification as verified",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := repository.NewUserRepository(db).MarkLegacyUsersVerified(ctx)
+				return err
+			},
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEventType is the kind of an authentication event
+type AuditEventType string
+
+const (
+	AuditEventUserRegistered  AuditEventType = "user.registered"
+	AuditEventLoginSucceeded  AuditEventType = "login.succeeded"
+	AuditEventLoginFailed     AuditEventType = "login.failed"
+	AuditEventAccountLocked   AuditEventType = "account.locked"
+	AuditEventPasswordChanged AuditEventType = "password.changed"
+	AuditEventPasswordReset   AuditEventType = "password.reset"
+	AuditEventTokensRevoked   AuditEventType = "tokens.revoked"
+
+	AuditEventImpersonationRequested AuditEventType = "impersonation.requested"
+	AuditEventImpersonationApproved  AuditEventType = "impersonation.approved"
+	AuditEventImpersonationDenied    AuditEventType = "impersonation.denied"
+	AuditEventImpersonationStarted   AuditEventType = "impersonation.started"
+	AuditEventImpersonationEnded     AuditEventType = "impersonation.ended"
+	// AuditEventImpersonationAction is a request made with an impersonation token. The
+	// actor is the impersonator.
+	AuditEventImpersonationAction AuditEventType = "impersonation.action"
+
+	AuditEventSignupDomainRuleSet     AuditEventType = "signup_domain_rule.set"
+	AuditEventSignupDomainRuleDeleted AuditEventType = "signup_domain_rule.deleted"
+)
+
+// AuditActorSCIM marks events caused by the identity provider through SCIM provisioning
+const AuditActorSCIM = "scim"
+
+// AuditEvent is an append-only record of an authentication event kept for security
+// reviews. UserID is zero for failed logins with an unregistered email; Actor is set when
+// someone other than the user caused the event.
+type AuditEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type      AuditEventType     `bson:"event_type" json:"event_type"`
+	UserID    primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Email     string             `bson:"email,omitempty" json:"email,omitempty"`
+	Actor     string             `bson:"actor,omitempty" json:"actor,omitempty"`
+	IPAddress string             `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	UserAgent string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Details   map[string]string  `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
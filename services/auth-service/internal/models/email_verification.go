@@ -0,0 +1,4 @@
+package models
+
+// EmailVerificationToken is a single-use, time-limited token emailed at signup
+type EmailVerificationToken = SingleUseToken
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Group is a named set of users, provisioned by an identity provider through SCIM
+type Group struct {
+	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	DisplayName string               `bson:"display_name" json:"display_name"`
+	ExternalID  string               `bson:"external_id,omitempty" json:"external_id,omitempty"`
+	MemberIDs   []primitive.ObjectID `bson:"member_ids" json:"member_ids"`
+	CreatedAt   time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time            `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Impersonation is an organization admin's request to act as one of its members. The
+// member must approve it before the admin can start a session, which issues a short-lived
+// token marked with the impersonator.
+type Impersonation struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrgID          primitive.ObjectID `bson:"org_id" json:"org_id"`
+	ImpersonatorID primitive.ObjectID `bson:"impersonator_id" json:"impersonator_id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Reason         string             `bson:"reason" json:"reason"`
+	// ExpiresAt is when the request lapses if it has not been started
+	ExpiresAt  time.Time  `bson:"expires_at" json:"expires_at"`
+	ApprovedAt *time.Time `bson:"approved_at,omitempty" json:"approved_at,omitempty"`
+	DeniedAt   *time.Time `bson:"denied_at,omitempty" json:"denied_at,omitempty"`
+	StartedAt  *time.Time `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	// SessionExpiresAt is when the impersonation token of a started session expires
+	SessionExpiresAt *time.Time `bson:"session_expires_at,omitempty" json:"session_expires_at,omitempty"`
+	EndedAt          *time.Time `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+	CreatedAt        time.Time  `bson:"created_at" json:"created_at"`
+}
+
+// IsPending reports whether the impersonated user can still respond to the request
+func (i *Impersonation) IsPending(now time.Time) bool {
+	return i.ApprovedAt == nil && i.DeniedAt == nil && i.EndedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// CanStart reports whether the request was approved and the session can be started
+func (i *Impersonation) CanStart(now time.Time) bool {
+	return i.ApprovedAt != nil && i.StartedAt == nil && i.EndedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// IsActive reports whether the session was started and its token is still honoured
+func (i *Impersonation) IsActive(now time.Time) bool {
+	return i.StartedAt != nil && i.EndedAt == nil && i.SessionExpiresAt != nil && now.Before(*i.SessionExpiresAt)
+}
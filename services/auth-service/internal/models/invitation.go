@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invitation invites someone without an account to sign up, optionally into an
+// organization. Only the SHA-256 hash of the emailed token is stored.
+type Invitation struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	// Email is stored in lower case
+	Email     string             `bson:"email" json:"email"`
+	InvitedBy primitive.ObjectID `bson:"invited_by" json:"invited_by"`
+	// OrgID and OrgRole are set for invitations into an organization
+	OrgID      primitive.ObjectID `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	OrgRole    OrgRole            `bson:"org_role,omitempty" json:"org_role,omitempty"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	AcceptedAt *time.Time         `bson:"accepted_at,omitempty" json:"accepted_at,omitempty"`
+	AcceptedBy primitive.ObjectID `bson:"accepted_by,omitempty" json:"accepted_by,omitempty"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// IsPending reports whether the invitation can still be accepted
+func (i *Invitation) IsPending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
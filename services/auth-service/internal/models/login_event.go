@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginEvent records a successful sign-in. DeviceHash fingerprints the client's user
+// agent and Network is the address prefix the sign-in came from, used together with
+// Country to spot unusual locations.
+type LoginEvent struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	IPAddress   string             `bson:"ip_address" json:"ip_address"`
+	Network     string             `bson:"network,omitempty" json:"-"`
+	Country     string             `bson:"country,omitempty" json:"country,omitempty"`
+	UserAgent   string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	DeviceHash  string             `bson:"device_hash" json:"-"`
+	NewDevice   bool               `bson:"new_device" json:"new_device"`
+	NewLocation bool               `bson:"new_location" json:"new_location"`
+	// ReportTokenHash is the SHA-256 hash of the "this wasn't me" token sent in the alert
+	ReportTokenHash string     `bson:"report_token_hash,omitempty" json:"-"`
+	ReportedAt      *time.Time `bson:"reported_at,omitempty" json:"reported_at,omitempty"`
+	CreatedAt       time.Time  `bson:"created_at" json:"created_at"`
+}
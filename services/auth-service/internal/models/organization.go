@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrgRole is a member's role within an organization
+type OrgRole string
+
+const (
+	// OrgRoleOwner can manage the organization and all of its members
+	OrgRoleOwner OrgRole = "owner"
+	// OrgRoleAdmin can manage members other than owners
+	OrgRoleAdmin  OrgRole = "admin"
+	OrgRoleMember OrgRole = "member"
+)
+
+// Organization is a tenant grouping users for shared workspaces, team billing and
+// tenant-scoped administration
+type Organization struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Slug      string             `bson:"slug" json:"slug"`
+	CreatedBy primitive.ObjectID `bson:"created_by" json:"created_by"`
+	// PasswordPolicy tightens the service-wide password policy for members, if set
+	PasswordPolicy *PasswordPolicy `bson:"password_policy,omitempty" json:"password_policy,omitempty"`
+	CreatedAt      time.Time       `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time       `bson:"updated_at" json:"updated_at"`
+}
+
+// OrganizationMember records a user's membership and role in an organization
+type OrganizationMember struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrgID     primitive.ObjectID `bson:"org_id" json:"org_id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Role      OrgRole            `bson:"role" json:"role"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
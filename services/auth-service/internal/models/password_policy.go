@@ -0,0 +1,29 @@
+package models
+
+// PasswordPolicy describes the passwords users may choose. Organizations can tighten the
+// service-wide policy for their members but never loosen it.
+type PasswordPolicy struct {
+	MinLength        int  `bson:"min_length" json:"min_length"`
+	RequireUppercase bool `bson:"require_uppercase" json:"require_uppercase"`
+	RequireLowercase bool `bson:"require_lowercase" json:"require_lowercase"`
+	RequireDigit     bool `bson:"require_digit" json:"require_digit"`
+	RequireSymbol    bool `bson:"require_symbol" json:"require_symbol"`
+	// DenyCommon rejects passwords from the list of most common passwords
+	DenyCommon bool `bson:"deny_common" json:"deny_common"`
+	// CheckBreached rejects passwords found in known data breaches
+	CheckBreached bool `bson:"check_breached" json:"check_breached"`
+}
+
+// Merge returns the stricter combination of both policies
+func (p PasswordPolicy) Merge(other PasswordPolicy) PasswordPolicy {
+	if other.MinLength > p.MinLength {
+		p.MinLength = other.MinLength
+	}
+	p.RequireUppercase = p.RequireUppercase || other.RequireUppercase
+	p.RequireLowercase = p.RequireLowercase || other.RequireLowercase
+	p.RequireDigit = p.RequireDigit || other.RequireDigit
+	p.RequireSymbol = p.RequireSymbol || other.RequireSymbol
+	p.DenyCommon = p.DenyCommon || other.DenyCommon
+	p.CheckBreached = p.CheckBreached || other.CheckBreached
+	return p
+}
@@ -0,0 +1,4 @@
+package models
+
+// PasswordResetToken is a single-use, time-limited password reset token
+type PasswordResetToken = SingleUseToken
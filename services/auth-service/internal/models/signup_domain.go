@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SignupDomainAction is what a signup domain rule does
+type SignupDomainAction string
+
+const (
+	SignupDomainAllow SignupDomainAction = "allow"
+	SignupDomainBlock SignupDomainAction = "block"
+)
+
+// SignupDomainRule allows or blocks registration for an email domain and its subdomains.
+// Rules are managed by administrators at runtime, in addition to the configured lists.
+type SignupDomainRule struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// Domain is stored in lower case
+	Domain    string             `bson:"domain" json:"domain"`
+	Action    SignupDomainAction `bson:"action" json:"action"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedBy primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
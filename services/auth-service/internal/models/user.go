@@ -12,6 +12,28 @@ type User struct {
 	PasswordHash string             `bson:"password_hash" json:"-"`
 	FullName     string             `bson:"full_name" json:"full_name"`
 	AvatarURL    string             `bson:"avatar_url,omitempty" json:"avatar_url,omitempty"`
-	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+	// AvatarFileID is the file-service file backing AvatarURL, if the avatar was uploaded
+	AvatarFileID string `bson:"avatar_file_id,omitempty" json:"avatar_file_id,omitempty"`
+	// Timezone is an IANA zone name and Locale a BCP 47 language tag, used to localise notifications
+	Timezone string `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	Locale   string `bson:"locale,omitempty" json:"locale,omitempty"`
+	// Discoverable users can be found by name in the sharing directory
+	Discoverable bool `bson:"discoverable" json:"discoverable"`
+	// ExternalID is the identity provider's ID of a user provisioned through SCIM
+	ExternalID string `bson:"external_id,omitempty" json:"external_id,omitempty"`
+	// Disabled accounts cannot sign in, e.g. after being deprovisioned by the identity provider
+	Disabled bool `bson:"disabled" json:"disabled"`
+	// ActiveOrgID is the organization the user last switched to and is carried in their
+	// access tokens. It is zero for the personal workspace.
+	ActiveOrgID primitive.ObjectID `bson:"active_org_id,omitempty" json:"active_org_id,omitempty"`
+	// TenantID is the tenant the user belongs to, empty for the default tenant. Email
+	// addresses are unique within a tenant.
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	// Unverified accounts have restricted upload and sharing limits
+	EmailVerified   bool       `bson:"email_verified" json:"email_verified"`
+	EmailVerifiedAt *time.Time `bson:"email_verified_at,omitempty" json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time  `bson:"updated_at" json:"updated_at"`
+	// TokensRevokedAt invalidates every token issued before it
+	TokensRevokedAt *time.Time `bson:"tokens_revoked_at,omitempty" json:"-"`
 }
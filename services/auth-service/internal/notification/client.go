@@ -0,0 +1,90 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	notificationv1 "github.com/yourusername/distributed-file-sharing/services/auth-service/pkg/pb/notification/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// sendTimeout bounds how long a single notification call may take
+const sendTimeout = 10 * time.Second
+
+// Client sends transactional emails through the notification-service
+type Client struct {
+	conn   *grpc.ClientConn
+	client notificationv1.NotificationServiceClient
+}
+
+// NewClient dials the notification-service gRPC endpoint
+func NewClient(addr string, opts ...grpc.DialOption) (*Client, error) {
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to notification service: %w", err)
+	}
+	poolmetrics.WatchClientConn("notification-service", conn)
+
+	return &Client{
+		conn:   conn,
+		client: notificationv1.NewNotificationServiceClient(conn),
+	}, nil
+}
+
+// SendSecurityEmail sends an email that skips batching and quiet hours, such as a
+// password reset link
+func (c *Client) SendSecurityEmail(ctx context.Context, userID, email, title, message string, metadata map[string]string) error {
+	md := map[string]string{"email": email}
+	for key, value := range metadata {
+		md[key] = value
+	}
+
+	return c.send(ctx, userID, notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_EMAIL, title, message, md)
+}
+
+// SendSecurityAlert delivers a security alert both by email and in-app. Both channels
+// are attempted even if one fails.
+func (c *Client) SendSecurityAlert(ctx context.Context, userID, email, title, message string, metadata map[string]string) error {
+	emailErr := c.SendSecurityEmail(ctx, userID, email, title, message, metadata)
+	inAppErr := c.send(ctx, userID, notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_INAPP, title, message, metadata)
+	return errors.Join(emailErr, inAppErr)
+}
+
+func (c *Client) send(ctx context.Context, userID string, channel notificationv1.NotificationChannel, title, message string, metadata map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	_, err := c.client.SendNotification(ctx, &notificationv1.SendNotificationRequest{
+		UserId:           userID,
+		EventType:        notificationv1.EventType_EVENT_TYPE_SECURITY_ALERT,
+		Channel:          channel,
+		Title:            title,
+		Message:          message,
+		Priority:         notificationv1.Priority_PRIORITY_CRITICAL,
+		Metadata:         metadata,
+		BypassBatching:   true,
+		BypassQuietHours: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send %s notification: %w", channel, err)
+	}
+
+	return nil
+}
+
+// HealthCheck checks that the notification-service can be reached
+func (c *Client) HealthCheck(ctx context.Context) error {
+	return health.GRPC(c.conn)(ctx)
+}
+
+// Close closes the underlying connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditEventFilter selects audit events. Zero fields do not filter; a non-nil empty
+// UserIDs matches nothing.
+type AuditEventFilter struct {
+	UserIDs []primitive.ObjectID
+	Types   []models.AuditEventType
+	Start   time.Time
+	End     time.Time
+	// Before continues a listing after the event with this ID
+	Before primitive.ObjectID
+	Limit  int64
+}
+
+// AuditEventRepository stores the audit log. Events are only ever inserted.
+type AuditEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditEventRepository(db *mongo.Database) *AuditEventRepository {
+	return &AuditEventRepository{
+		collection: db.Collection("audit_events"),
+	}
+}
+
+// EnsureIndexes creates the query indexes and, when retention is positive, a TTL index
+// that purges events older than retention
+func (r *AuditEventRepository) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	createdAt := mongo.IndexModel{
+		Keys: bson.D{{Key: "created_at", Value: 1}},
+	}
+	if retention > 0 {
+		createdAt.Options = options.Index().SetExpireAfterSeconds(int32(retention.Seconds()))
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "event_type", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		createdAt,
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func (r *AuditEventRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, event)
+	return err
+}
+
+// List returns the events matching filter, newest first
+func (r *AuditEventRepository) List(ctx context.Context, filter AuditEventFilter) ([]*models.AuditEvent, error) {
+	query := bson.M{}
+	if filter.UserIDs != nil {
+		query["user_id"] = bson.M{"$in": filter.UserIDs}
+	}
+	if len(filter.Types) > 0 {
+		query["event_type"] = bson.M{"$in": filter.Types}
+	}
+
+	createdAt := bson.M{}
+	if !filter.Start.IsZero() {
+		createdAt["$gte"] = filter.Start
+	}
+	if !filter.End.IsZero() {
+		createdAt["$lt"] = filter.End
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	if !filter.Before.IsZero() {
+		query["_id"] = bson.M{"$lt": filter.Before}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(filter.Limit)
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []*models.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
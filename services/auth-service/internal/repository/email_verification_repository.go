@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrVerificationTokenInvalid = errors.New("verification token is invalid or has expired")
+
+// EmailVerificationRepository stores email verification tokens
+type EmailVerificationRepository struct {
+	singleUseTokenStore
+}
+
+func NewEmailVerificationRepository(db *mongo.Database) *EmailVerificationRepository {
+	return &EmailVerificationRepository{
+		singleUseTokenStore: newSingleUseTokenStore(db.Collection("email_verification_tokens"), ErrVerificationTokenInvalid),
+	}
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrGroupNotFound      = errors.New("group not found")
+	ErrGroupAlreadyExists = errors.New("group already exists")
+)
+
+type GroupRepository struct {
+	collection *mongo.Collection
+}
+
+func NewGroupRepository(db *mongo.Database) *GroupRepository {
+	return &GroupRepository{
+		collection: db.Collection("groups"),
+	}
+}
+
+// EnsureIndexes keeps group names unique and indexes membership lookups
+func (r *GroupRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "display_name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "external_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "member_ids", Value: 1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func (r *GroupRepository) Create(ctx context.Context, group *models.Group) error {
+	group.ID = primitive.NewObjectID()
+	group.CreatedAt = time.Now()
+	group.UpdatedAt = group.CreatedAt
+	if group.MemberIDs == nil {
+		group.MemberIDs = []primitive.ObjectID{}
+	}
+
+	_, err := r.collection.InsertOne(ctx, group)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrGroupAlreadyExists
+	}
+	return err
+}
+
+func (r *GroupRepository) FindByID(ctx context.Context, id string) (*models.Group, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrGroupNotFound
+	}
+
+	var group models.Group
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&group)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// List returns a page of groups ordered by creation, optionally filtered by name or
+// external ID, together with the total number of matching groups
+func (r *GroupRepository) List(ctx context.Context, displayName, externalID string, skip, limit int64) ([]*models.Group, int64, error) {
+	filter := bson.M{}
+	if displayName != "" {
+		filter["display_name"] = displayName
+	}
+	if externalID != "" {
+		filter["external_id"] = externalID
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []*models.Group
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+// ListByMembers returns the groups containing any of the users
+func (r *GroupRepository) ListByMembers(ctx context.Context, userIDs []primitive.ObjectID) ([]*models.Group, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"member_ids": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []*models.Group
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Update replaces the name, external ID and members of a group
+func (r *GroupRepository) Update(ctx context.Context, group *models.Group) error {
+	group.UpdatedAt = time.Now()
+	if group.MemberIDs == nil {
+		group.MemberIDs = []primitive.ObjectID{}
+	}
+
+	filter := bson.M{"_id": group.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"display_name": group.DisplayName,
+			"external_id":  group.ExternalID,
+			"member_ids":   group.MemberIDs,
+			"updated_at":   group.UpdatedAt,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrGroupAlreadyExists
+		}
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+func (r *GroupRepository) Delete(ctx context.Context, groupID primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": groupID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+// RemoveMember removes a user from every group, e.g. after the user was deleted
+func (r *GroupRepository) RemoveMember(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"member_ids": userID},
+		bson.M{
+			"$pull": bson.M{"member_ids": userID},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	return err
+}
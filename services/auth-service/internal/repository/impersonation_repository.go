@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrImpersonationNotFound = errors.New("impersonation not found")
+	// ErrImpersonationInvalid is returned when an impersonation is not in the state the
+	// update requires, e.g. approving a request that was already denied
+	ErrImpersonationInvalid = errors.New("impersonation is no longer valid")
+)
+
+// maxListedImpersonations bounds the impersonations returned by a listing
+const maxListedImpersonations = 100
+
+type ImpersonationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewImpersonationRepository(db *mongo.Database) *ImpersonationRepository {
+	return &ImpersonationRepository{
+		collection: db.Collection("impersonations"),
+	}
+}
+
+// EnsureIndexes creates the indexes used to list a user's impersonations. Impersonations
+// are kept after they end so both parties can review them.
+func (r *ImpersonationRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "impersonator_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func (r *ImpersonationRepository) Create(ctx context.Context, impersonation *models.Impersonation) error {
+	impersonation.ID = primitive.NewObjectID()
+	impersonation.CreatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, impersonation)
+	return err
+}
+
+func (r *ImpersonationRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&impersonation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrImpersonationNotFound
+		}
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+// ListByParticipant returns the most recent impersonations a user requested or was asked
+// to consent to
+func (r *ImpersonationRepository) ListByParticipant(ctx context.Context, userID primitive.ObjectID) ([]*models.Impersonation, error) {
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"impersonator_id": userID},
+			bson.M{"user_id": userID},
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(maxListedImpersonations)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var impersonations []*models.Impersonation
+	if err := cursor.All(ctx, &impersonations); err != nil {
+		return nil, err
+	}
+	return impersonations, nil
+}
+
+// Approve records the impersonated user's consent to a pending request
+func (r *ImpersonationRepository) Approve(ctx context.Context, id primitive.ObjectID) (*models.Impersonation, error) {
+	return r.update(ctx, impersonationPendingFilter(id), bson.M{"approved_at": time.Now()})
+}
+
+// Deny records that the impersonated user refused a pending request
+func (r *ImpersonationRepository) Deny(ctx context.Context, id primitive.ObjectID) (*models.Impersonation, error) {
+	return r.update(ctx, impersonationPendingFilter(id), bson.M{"denied_at": time.Now()})
+}
+
+// Start starts the session of an approved request that has not been started or expired.
+// A request can only be started once.
+func (r *ImpersonationRepository) Start(ctx context.Context, id primitive.ObjectID, sessionExpiresAt time.Time) (*models.Impersonation, error) {
+	filter := bson.M{
+		"_id":         id,
+		"approved_at": bson.M{"$exists": true},
+		"started_at":  bson.M{"$exists": false},
+		"ended_at":    bson.M{"$exists": false},
+		"expires_at":  bson.M{"$gt": time.Now()},
+	}
+	return r.update(ctx, filter, bson.M{
+		"started_at":         time.Now(),
+		"session_expires_at": sessionExpiresAt,
+	})
+}
+
+// End ends a session or withdraws a request that has not been denied or ended
+func (r *ImpersonationRepository) End(ctx context.Context, id primitive.ObjectID) (*models.Impersonation, error) {
+	filter := bson.M{
+		"_id":       id,
+		"denied_at": bson.M{"$exists": false},
+		"ended_at":  bson.M{"$exists": false},
+	}
+	return r.update(ctx, filter, bson.M{"ended_at": time.Now()})
+}
+
+func (r *ImpersonationRepository) update(ctx context.Context, filter, set bson.M) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&impersonation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrImpersonationInvalid
+		}
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+func impersonationPendingFilter(id primitive.ObjectID) bson.M {
+	return bson.M{
+		"_id":         id,
+		"approved_at": bson.M{"$exists": false},
+		"denied_at":   bson.M{"$exists": false},
+		"ended_at":    bson.M{"$exists": false},
+		"expires_at":  bson.M{"$gt": time.Now()},
+	}
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationInvalid  = errors.New("invitation is invalid or has expired")
+)
+
+// maxListedInvitations bounds the invitations returned by a listing
+const maxListedInvitations = 200
+
+type InvitationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewInvitationRepository(db *mongo.Database) *InvitationRepository {
+	return &InvitationRepository{
+		collection: db.Collection("invitations"),
+	}
+}
+
+// EnsureIndexes creates the token lookup index and the indexes used to list invitations.
+// Invitations are kept after they expire so inviters can see what happened to them.
+func (r *InvitationRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "invited_by", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func (r *InvitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	invitation.ID = primitive.NewObjectID()
+	invitation.CreatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, invitation)
+	return err
+}
+
+func (r *InvitationRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&invitation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// FindPendingByToken returns the unaccepted, unrevoked and unexpired invitation for a token
+func (r *InvitationRepository) FindPendingByToken(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	filter := pendingFilter()
+	filter["token_hash"] = tokenHash
+
+	var invitation models.Invitation
+	err := r.collection.FindOne(ctx, filter).Decode(&invitation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvitationInvalid
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// ListPendingByEmail returns every pending invitation sent to an email address
+func (r *InvitationRepository) ListPendingByEmail(ctx context.Context, email string) ([]*models.Invitation, error) {
+	filter := pendingFilter()
+	filter["email"] = email
+
+	return r.find(ctx, filter)
+}
+
+// ListByInviter returns the most recent invitations sent by a user
+func (r *InvitationRepository) ListByInviter(ctx context.Context, userID primitive.ObjectID) ([]*models.Invitation, error) {
+	return r.find(ctx, bson.M{"invited_by": userID})
+}
+
+// ListByOrganization returns the most recent invitations into an organization
+func (r *InvitationRepository) ListByOrganization(ctx context.Context, orgID primitive.ObjectID) ([]*models.Invitation, error) {
+	return r.find(ctx, bson.M{"org_id": orgID})
+}
+
+func (r *InvitationRepository) find(ctx context.Context, filter bson.M) ([]*models.Invitation, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(maxListedInvitations)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var invitations []*models.Invitation
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// RevokePending revokes earlier pending invitations of an email into the same
+// organization or, without one, from the same inviter so only the newest link works
+func (r *InvitationRepository) RevokePending(ctx context.Context, email string, invitedBy, orgID primitive.ObjectID) error {
+	filter := pendingFilter()
+	filter["email"] = email
+	if orgID.IsZero() {
+		filter["invited_by"] = invitedBy
+		filter["org_id"] = bson.M{"$exists": false}
+	} else {
+		filter["org_id"] = orgID
+	}
+
+	_, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	return err
+}
+
+// Revoke withdraws a pending invitation
+func (r *InvitationRepository) Revoke(ctx context.Context, id primitive.ObjectID) error {
+	filter := pendingFilter()
+	filter["_id"] = id
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrInvitationInvalid
+	}
+
+	return nil
+}
+
+// MarkAccepted records that the invitations were accepted by the user and returns how many
+// were still pending
+func (r *InvitationRepository) MarkAccepted(ctx context.Context, ids []primitive.ObjectID, userID primitive.ObjectID) (int64, error) {
+	filter := pendingFilter()
+	filter["_id"] = bson.M{"$in": ids}
+	update := bson.M{
+		"$set": bson.M{
+			"accepted_at": time.Now(),
+			"accepted_by": userID,
+		},
+	}
+
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func pendingFilter() bson.M {
+	return bson.M{
+		"accepted_at": bson.M{"$exists": false},
+		"revoked_at":  bson.M{"$exists": false},
+		"expires_at":  bson.M{"$gt": time.Now()},
+	}
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrLoginReportInvalid = errors.New("report link is invalid or has expired")
+
+type LoginEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLoginEventRepository(db *mongo.Database) *LoginEventRepository {
+	return &LoginEventRepository{
+		collection: db.Collection("login_events"),
+	}
+}
+
+// EnsureIndexes creates the history lookup indexes and a TTL index that purges sign-ins
+// older than retention
+func (r *LoginEventRepository) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "device_hash", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "report_token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func (r *LoginEventRepository) Create(ctx context.Context, event *models.LoginEvent) error {
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = time.Now()
+
+	_, err := r.collection.InsertOne(ctx, event)
+	return err
+}
+
+// HasHistory reports whether the user has signed in before
+func (r *LoginEventRepository) HasHistory(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	return r.exists(ctx, bson.M{"user_id": userID})
+}
+
+// HasDevice reports whether the user has signed in from the device before. Sign-ins the
+// owner reported as suspicious do not count.
+func (r *LoginEventRepository) HasDevice(ctx context.Context, userID primitive.ObjectID, deviceHash string) (bool, error) {
+	return r.exists(ctx, bson.M{
+		"user_id":     userID,
+		"device_hash": deviceHash,
+		"reported_at": bson.M{"$exists": false},
+	})
+}
+
+// HasLocation reports whether the user has signed in from the country before, or from
+// the network when the country is unknown. Reported sign-ins do not count.
+func (r *LoginEventRepository) HasLocation(ctx context.Context, userID primitive.ObjectID, country, network string) (bool, error) {
+	filter := bson.M{
+		"user_id":     userID,
+		"reported_at": bson.M{"$exists": false},
+	}
+	if country != "" {
+		filter["country"] = country
+	} else {
+		filter["network"] = network
+	}
+	return r.exists(ctx, filter)
+}
+
+// ListByUser returns the most recent sign-ins of a user, newest first
+func (r *LoginEventRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*models.LoginEvent, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []*models.LoginEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ConsumeReport atomically marks the sign-in matching an unused report token created
+// after notBefore as reported and returns it
+func (r *LoginEventRepository) ConsumeReport(ctx context.Context, tokenHash string, notBefore time.Time) (*models.LoginEvent, error) {
+	now := time.Now()
+	filter := bson.M{
+		"report_token_hash": tokenHash,
+		"reported_at":       bson.M{"$exists": false},
+		"created_at":        bson.M{"$gt": notBefore},
+	}
+	update := bson.M{"$set": bson.M{"reported_at": now}}
+
+	var event models.LoginEvent
+	err := r.collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrLoginReportInvalid
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *LoginEventRepository) exists(ctx context.Context, filter bson.M) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
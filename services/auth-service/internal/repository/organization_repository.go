@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrSlugTaken            = errors.New("organization slug already taken")
+	ErrMembershipNotFound   = errors.New("membership not found")
+	ErrAlreadyMember        = errors.New("user is already a member")
+)
+
+type OrganizationRepository struct {
+	collection *mongo.Collection
+	members    *mongo.Collection
+}
+
+func NewOrganizationRepository(db *mongo.Database) *OrganizationRepository {
+	return &OrganizationRepository{
+		collection: db.Collection("organizations"),
+		members:    db.Collection("organization_members"),
+	}
+}
+
+// EnsureIndexes keeps slugs and memberships unique and indexes a user's memberships
+func (r *OrganizationRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "slug", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.members.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "org_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+	return err
+}
+
+// Create stores the organization and makes its creator the owner
+func (r *OrganizationRepository) Create(ctx context.Context, org *models.Organization) error {
+	org.ID = primitive.NewObjectID()
+	org.CreatedAt = time.Now()
+	org.UpdatedAt = org.CreatedAt
+
+	if _, err := r.collection.InsertOne(ctx, org); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrSlugTaken
+		}
+		return err
+	}
+
+	owner := &models.OrganizationMember{
+		OrgID:  org.ID,
+		UserID: org.CreatedBy,
+		Role:   models.OrgRoleOwner,
+	}
+	if err := r.AddMember(ctx, owner); err != nil {
+		// Without an owner nobody could manage the organization
+		r.collection.DeleteOne(ctx, bson.M{"_id": org.ID})
+		return err
+	}
+
+	return nil
+}
+
+func (r *OrganizationRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Organization, error) {
+	var org models.Organization
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&org)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+// FindByIDs returns the organizations with the given IDs, ordered by name
+func (r *OrganizationRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*models.Organization, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var orgs []*models.Organization
+	if err := cursor.All(ctx, &orgs); err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+func (r *OrganizationRepository) UpdateName(ctx context.Context, org *models.Organization) error {
+	org.UpdatedAt = time.Now()
+
+	filter := bson.M{"_id": org.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"name":       org.Name,
+			"updated_at": org.UpdatedAt,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrOrganizationNotFound
+	}
+
+	return nil
+}
+
+// UpdatePasswordPolicy sets the organization's password policy, or removes it when nil
+func (r *OrganizationRepository) UpdatePasswordPolicy(ctx context.Context, org *models.Organization) error {
+	org.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"password_policy": org.PasswordPolicy,
+			"updated_at":      org.UpdatedAt,
+		},
+	}
+	if org.PasswordPolicy == nil {
+		update = bson.M{
+			"$unset": bson.M{"password_policy": ""},
+			"$set":   bson.M{"updated_at": org.UpdatedAt},
+		}
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": org.ID}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrOrganizationNotFound
+	}
+
+	return nil
+}
+
+func (r *OrganizationRepository) AddMember(ctx context.Context, member *models.OrganizationMember) error {
+	member.ID = primitive.NewObjectID()
+	member.CreatedAt = time.Now()
+	member.UpdatedAt = member.CreatedAt
+
+	_, err := r.members.InsertOne(ctx, member)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyMember
+	}
+	return err
+}
+
+func (r *OrganizationRepository) FindMembership(ctx context.Context, orgID, userID primitive.ObjectID) (*models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	err := r.members.FindOne(ctx, bson.M{"org_id": orgID, "user_id": userID}).Decode(&member)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrMembershipNotFound
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+// ListMemberships returns every membership of the user
+func (r *OrganizationRepository) ListMemberships(ctx context.Context, userID primitive.ObjectID) ([]*models.OrganizationMember, error) {
+	return r.findMembers(ctx, bson.M{"user_id": userID})
+}
+
+// ListMembers returns the members of an organization in the order they joined
+func (r *OrganizationRepository) ListMembers(ctx context.Context, orgID primitive.ObjectID) ([]*models.OrganizationMember, error) {
+	return r.findMembers(ctx, bson.M{"org_id": orgID})
+}
+
+// ListMemberIDs returns up to limit user IDs of an organization's members after the
+// given ID, in ID order. A zero after starts from the first member.
+func (r *OrganizationRepository) ListMemberIDs(ctx context.Context, orgID, after primitive.ObjectID, limit int64) ([]primitive.ObjectID, error) {
+	filter := bson.M{"org_id": orgID}
+	if !after.IsZero() {
+		filter["user_id"] = bson.M{"$gt": after}
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"user_id": 1}).
+		SetSort(bson.D{{Key: "user_id", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.members.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		UserID primitive.ObjectID `bson:"user_id"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(results))
+	for i, result := range results {
+		ids[i] = result.UserID
+	}
+	return ids, nil
+}
+
+func (r *OrganizationRepository) findMembers(ctx context.Context, filter bson.M) ([]*models.OrganizationMember, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.members.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var members []*models.OrganizationMember
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// CountOwners returns the number of owners of an organization
+func (r *OrganizationRepository) CountOwners(ctx context.Context, orgID primitive.ObjectID) (int64, error) {
+	return r.members.CountDocuments(ctx, bson.M{"org_id": orgID, "role": models.OrgRoleOwner})
+}
+
+func (r *OrganizationRepository) UpdateMemberRole(ctx context.Context, member *models.OrganizationMember) error {
+	member.UpdatedAt = time.Now()
+
+	filter := bson.M{"_id": member.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"role":       member.Role,
+			"updated_at": member.UpdatedAt,
+		},
+	}
+
+	result, err := r.members.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrMembershipNotFound
+	}
+
+	return nil
+}
+
+func (r *OrganizationRepository) RemoveMember(ctx context.Context, orgID, userID primitive.ObjectID) error {
+	result, err := r.members.DeleteOne(ctx, bson.M{"org_id": orgID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrMembershipNotFound
+	}
+
+	return nil
+}
+
+// RemoveUser removes a user from every organization, e.g. after the user was deleted
+func (r *OrganizationRepository) RemoveUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.members.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
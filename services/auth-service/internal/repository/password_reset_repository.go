@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrResetTokenInvalid = errors.New("reset token is invalid or has expired")
+
+// PasswordResetRepository stores password reset tokens
+type PasswordResetRepository struct {
+	singleUseTokenStore
+}
+
+func NewPasswordResetRepository(db *mongo.Database) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		singleUseTokenStore: newSingleUseTokenStore(db.Collection("password_reset_tokens"), ErrResetTokenInvalid),
+	}
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrSignupDomainRuleNotFound = errors.New("signup domain rule not found")
+
+type SignupDomainRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSignupDomainRepository(db *mongo.Database) *SignupDomainRepository {
+	return &SignupDomainRepository{
+		collection: db.Collection("signup_domain_rules"),
+	}
+}
+
+// EnsureIndexes creates the unique domain index so each domain has at most one rule
+func (r *SignupDomainRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "domain", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// List returns every rule ordered by domain
+func (r *SignupDomainRepository) List(ctx context.Context) ([]*models.SignupDomainRule, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "domain", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rules []*models.SignupDomainRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Upsert creates the rule for its domain or replaces the existing rule's action and note
+func (r *SignupDomainRepository) Upsert(ctx context.Context, rule *models.SignupDomainRule) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"action":     rule.Action,
+			"note":       rule.Note,
+			"created_by": rule.CreatedBy,
+			"updated_at": now,
+		},
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"created_at": now,
+		},
+	}
+
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"domain": rule.Domain}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(rule)
+	return err
+}
+
+// Delete removes the rule for a domain
+func (r *SignupDomainRepository) Delete(ctx context.Context, domain string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"domain": domain})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrSignupDomainRuleNotFound
+	}
+	return nil
+}
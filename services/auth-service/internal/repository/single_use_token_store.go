@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// singleUseTokenStore stores the single-use tokens of one kind in their own collection.
+// Lookups of tokens that are unknown, used or expired fail with errInvalid.
+type singleUseTokenStore struct {
+	collection *mongo.Collection
+	errInvalid error
+}
+
+func newSingleUseTokenStore(collection *mongo.Collection, errInvalid error) singleUseTokenStore {
+	return singleUseTokenStore{
+		collection: collection,
+		errInvalid: errInvalid,
+	}
+}
+
+// EnsureIndexes creates the token lookup index and a TTL index that purges expired tokens
+func (s singleUseTokenStore) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func (s singleUseTokenStore) Create(ctx context.Context, token *models.SingleUseToken) error {
+	token.ID = primitive.NewObjectID()
+	token.CreatedAt = time.Now()
+
+	_, err := s.collection.InsertOne(ctx, token)
+	return err
+}
+
+// InvalidateForUser marks all outstanding tokens of a user as used
+func (s singleUseTokenStore) InvalidateForUser(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{
+		"user_id": userID,
+		"used_at": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"used_at": time.Now()}}
+
+	_, err := s.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// FindValid returns an unused, unexpired token without consuming it
+func (s singleUseTokenStore) FindValid(ctx context.Context, tokenHash string) (*models.SingleUseToken, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	var token models.SingleUseToken
+	err := s.collection.FindOne(ctx, filter).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, s.errInvalid
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Consume atomically marks an unused, unexpired token as used and returns it
+func (s singleUseTokenStore) Consume(ctx context.Context, tokenHash string) (*models.SingleUseToken, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"used_at": now}}
+
+	var token models.SingleUseToken
+	err := s.collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, s.errInvalid
+		}
+		return nil, err
+	}
+	return &token, nil
+}
@@ -3,12 +3,16 @@ package repository
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
 	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -26,7 +30,12 @@ func NewUserRepository(db *mongo.Database) *UserRepository {
 	}
 }
 
+// Create stores a new user in the tenant ctx is served for
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	if id, ok := tenant.FromContext(ctx); ok {
+		user.TenantID = id
+	}
+
 	// Check if user already exists
 	existingUser, _ := r.FindByEmail(ctx, user.Email)
 	if existingUser != nil {
@@ -41,9 +50,10 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	return err
 }
 
+// FindByEmail finds the user registered under an email in the tenant ctx is served for
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := r.collection.FindOne(ctx, tenant.Scope(ctx, bson.M{"email": email})).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrUserNotFound
@@ -76,9 +86,13 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	filter := bson.M{"_id": user.ID}
 	update := bson.M{
 		"$set": bson.M{
-			"full_name":  user.FullName,
-			"avatar_url": user.AvatarURL,
-			"updated_at": user.UpdatedAt,
+			"full_name":      user.FullName,
+			"avatar_url":     user.AvatarURL,
+			"avatar_file_id": user.AvatarFileID,
+			"timezone":       user.Timezone,
+			"locale":         user.Locale,
+			"discoverable":   user.Discoverable,
+			"updated_at":     user.UpdatedAt,
 		},
 	}
 
@@ -115,4 +129,341 @@ func (r *UserRepository) UpdatePassword(ctx context.Context, user *models.User)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// RevokeTokens invalidates every access and refresh token issued to the user before now
+func (r *UserRepository) RevokeTokens(ctx context.Context, userID primitive.ObjectID) error {
+	now := time.Now()
+
+	filter := bson.M{"_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"tokens_revoked_at": now,
+			"updated_at":        now,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetActiveOrganization records the organization the user switched to. A zero orgID
+// switches back to the personal workspace.
+func (r *UserRepository) SetActiveOrganization(ctx context.Context, userID, orgID primitive.ObjectID) error {
+	update := bson.M{
+		"$set": bson.M{
+			"active_org_id": orgID,
+			"updated_at":    time.Now(),
+		},
+	}
+	if orgID.IsZero() {
+		update = bson.M{
+			"$unset": bson.M{"active_org_id": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		}
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// MarkEmailVerified records that the user has confirmed ownership of their email address
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID primitive.ObjectID) error {
+	now := time.Now()
+
+	filter := bson.M{"_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"email_verified":    true,
+			"email_verified_at": now,
+			"updated_at":        now,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// MarkLegacyUsersVerified treats accounts created before email verification existed as
+// verified so they keep their current limits
+func (r *UserRepository) MarkLegacyUsersVerified(ctx context.Context) (int64, error) {
+	filter := bson.M{"email_verified": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"email_verified": true}}
+
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// FindByEmails returns the users of the tenant ctx is served for registered under any of
+// the emails. Each email is also matched in lower case.
+func (r *UserRepository) FindByEmails(ctx context.Context, emails []string) ([]*models.User, error) {
+	candidates := make([]string, 0, len(emails)*2)
+	for _, email := range emails {
+		candidates = append(candidates, email)
+		if lower := strings.ToLower(email); lower != email {
+			candidates = append(candidates, lower)
+		}
+	}
+
+	cursor, err := r.collection.Find(ctx, tenant.Scope(ctx, bson.M{"email": bson.M{"$in": candidates}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SearchDirectory returns the discoverable users of the tenant ctx is served for whose
+// name or email starts with prefix, ignoring case
+func (r *UserRepository) SearchDirectory(ctx context.Context, prefix string, excludeID primitive.ObjectID, limit int64) ([]*models.User, error) {
+	pattern := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix), Options: "i"}
+	filter := bson.M{
+		"discoverable": true,
+		"_id":          bson.M{"$ne": excludeID},
+		"$or": []bson.M{
+			{"full_name": pattern},
+			{"email": pattern},
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "full_name", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, tenant.Scope(ctx, filter), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ListIDs returns up to limit user IDs after the given ID, in ID order. A zero after
+// starts from the first user.
+func (r *UserRepository) ListIDs(ctx context.Context, after primitive.ObjectID, limit int64) ([]primitive.ObjectID, error) {
+	filter := bson.M{}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids, nil
+}
+
+// FindByIDs returns the users with any of the IDs. Unknown IDs are skipped.
+func (r *UserRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*models.User, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// List returns a page of the users of the tenant ctx is served for ordered by creation,
+// optionally filtered by email or external ID, together with the total number of
+// matching users
+func (r *UserRepository) List(ctx context.Context, email, externalID string, skip, limit int64) ([]*models.User, int64, error) {
+	filter := bson.M{}
+	if email != "" {
+		filter["email"] = bson.M{"$in": []string{email, strings.ToLower(email)}}
+	}
+	if externalID != "" {
+		filter["external_id"] = externalID
+	}
+	filter = tenant.Scope(ctx, filter)
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// UserCounts are the numbers of users, of verified and of disabled accounts
+type UserCounts struct {
+	Total    int64 `bson:"total" json:"total"`
+	Verified int64 `bson:"verified" json:"verified"`
+	Disabled int64 `bson:"disabled" json:"disabled"`
+}
+
+// CountUsers counts the users of the tenant ctx is served for
+func (r *UserRepository) CountUsers(ctx context.Context) (*UserCounts, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: tenant.Scope(ctx, bson.M{})}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      nil,
+			"total":    bson.M{"$sum": 1},
+			"verified": bson.M{"$sum": bson.M{"$cond": bson.A{"$email_verified", 1, 0}}},
+			"disabled": bson.M{"$sum": bson.M{"$cond": bson.A{"$disabled", 1, 0}}},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := &UserCounts{}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(counts); err != nil {
+			return nil, err
+		}
+	}
+	return counts, cursor.Err()
+}
+
+// DailySignups is the number of users who signed up on a day
+type DailySignups struct {
+	Date  time.Time `bson:"_id" json:"date"`
+	Count int64     `bson:"count" json:"count"`
+}
+
+// CountSignupsByDay counts the users of the tenant ctx is served for who signed up
+// between from and to, per UTC day. Days without signups are left out.
+func (r *UserRepository) CountSignupsByDay(ctx context.Context, from, to time.Time) ([]DailySignups, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: tenant.Scope(ctx, bson.M{"created_at": bson.M{"$gte": from, "$lt": to}})}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$dateTrunc": bson.M{"date": "$created_at", "unit": "day", "timezone": "UTC"}},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	days := []DailySignups{}
+	if err := cursor.All(ctx, &days); err != nil {
+		return nil, err
+	}
+	return days, nil
+}
+
+// Provision stores the attributes an identity provider manages. The email address is
+// vouched for by the provider and treated as verified.
+func (r *UserRepository) Provision(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = time.Now()
+	user.EmailVerified = true
+
+	filter := bson.M{"_id": user.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"email":          user.Email,
+			"full_name":      user.FullName,
+			"external_id":    user.ExternalID,
+			"locale":         user.Locale,
+			"timezone":       user.Timezone,
+			"disabled":       user.Disabled,
+			"email_verified": user.EmailVerified,
+			"updated_at":     user.UpdatedAt,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, userID primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
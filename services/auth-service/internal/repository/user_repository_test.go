@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// tenantContexts are the contexts repository queries are made in, and the tenant_id
+// each should match: absent outside of a request, null for the default tenant
+var tenantContexts = []struct {
+	name      string
+	ctx       context.Context
+	wantField bool
+	wantValue interface{}
+}{
+	{"outside of a request", context.Background(), false, nil},
+	{"default tenant", tenant.WithID(context.Background(), ""), true, nil},
+	{"tenant", tenant.WithID(context.Background(), "acme"), true, "acme"},
+}
+
+func TestUserRepositoryFindByEmailScopesToTenant(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	for _, tc := range tenantContexts {
+		mt.Run(tc.name, func(mt *mtest.T) {
+			repo := NewUserRepository(mt.DB)
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, mt.DB.Name()+".users", mtest.FirstBatch))
+
+			if _, err := repo.FindByEmail(tc.ctx, "a@example.com"); err != ErrUserNotFound {
+				mt.Fatalf("FindByEmail() error = %v, want %v", err, ErrUserNotFound)
+			}
+
+			filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+			if email := filter.Lookup("email").StringValue(); email != "a@example.com" {
+				mt.Errorf("filter email = %q, want a@example.com", email)
+			}
+			assertTenantField(mt, filter, tc.wantField, tc.wantValue)
+		})
+	}
+}
+
+func TestUserRepositoryCreateStoresTenant(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	for _, tc := range tenantContexts {
+		mt.Run(tc.name, func(mt *mtest.T) {
+			repo := NewUserRepository(mt.DB)
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, mt.DB.Name()+".users", mtest.FirstBatch),
+				mtest.CreateSuccessResponse(),
+			)
+
+			user := &models.User{Email: "a@example.com"}
+			if err := repo.Create(tc.ctx, user); err != nil {
+				mt.Fatalf("Create() error = %v", err)
+			}
+
+			find := mt.GetStartedEvent()
+			assertTenantField(mt, find.Command.Lookup("filter").Document(), tc.wantField, tc.wantValue)
+
+			insert := mt.GetStartedEvent()
+			if insert.CommandName != "insert" {
+				mt.Fatalf("command = %s, want insert", insert.CommandName)
+			}
+			doc := insert.Command.Lookup("documents").Array().Index(0).Value().Document()
+			stored, ok := doc.Lookup("tenant_id").StringValueOK()
+			wantStored, _ := tc.wantValue.(string)
+			if stored != wantStored || ok != (wantStored != "") {
+				mt.Errorf("stored tenant_id = %q (present %v), want %q", stored, ok, wantStored)
+			}
+		})
+	}
+}
+
+// assertTenantField checks the tenant_id condition of a query filter
+func assertTenantField(mt *mtest.T, filter bson.Raw, wantField bool, wantValue interface{}) {
+	mt.Helper()
+
+	value, err := filter.LookupErr(tenant.Field)
+	if !wantField {
+		if err == nil {
+			mt.Errorf("filter %v has %s, want it unscoped", filter, tenant.Field)
+		}
+		return
+	}
+	if err != nil {
+		mt.Fatalf("filter %v has no %s", filter, tenant.Field)
+	}
+	switch want := wantValue.(type) {
+	case nil:
+		if value.Type != bson.TypeNull {
+			mt.Errorf("filter %s = %v, want null", tenant.Field, value)
+		}
+	case string:
+		if got, ok := value.StringValueOK(); !ok || got != want {
+			mt.Errorf("filter %s = %v, want %q", tenant.Field, value, want)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type groupResource struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []reference `json:"members,omitempty"`
+	Meta        *meta       `json:"meta,omitempty"`
+}
+
+func (h *Handler) listGroups(c *gin.Context) {
+	p, err := parsePage(c)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	var displayName, externalID string
+	if filter := c.Query("filter"); filter != "" {
+		attribute, value, err := parseFilter(filter)
+		if err != nil {
+			h.writeError(c, err)
+			return
+		}
+		switch attribute {
+		case "displayname":
+			displayName = value
+		case "externalid":
+			externalID = value
+		default:
+			h.writeError(c, badRequest("invalidFilter", "filtering groups by %s is not supported", attribute))
+			return
+		}
+		if value == "" {
+			h.writeResource(c, http.StatusOK, listResponse{Schemas: []string{schemaListResponse}, StartIndex: p.startIndex, Resources: []interface{}{}})
+			return
+		}
+	}
+
+	groups, total, err := h.groupRepo.List(c.Request.Context(), displayName, externalID, p.skip(), p.limit())
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if p.count == 0 {
+		groups = nil
+	}
+
+	// Identity providers exclude members when they only check whether a group exists
+	includeMembers := !strings.Contains(strings.ToLower(c.Query("excludedAttributes")), "members")
+
+	resources, err := h.groupResources(c.Request.Context(), groups, includeMembers)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeResource(c, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: total,
+		StartIndex:   p.startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *Handler) getGroup(c *gin.Context) {
+	group, err := h.findGroup(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.respondGroup(c, http.StatusOK, group)
+}
+
+func (h *Handler) createGroup(c *gin.Context) {
+	var resource groupResource
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		h.writeError(c, badRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+
+	displayName := strings.TrimSpace(resource.DisplayName)
+	if displayName == "" {
+		h.writeError(c, badRequest("invalidValue", "displayName is required"))
+		return
+	}
+
+	memberIDs, err := h.resolveMembers(c.Request.Context(), resource.Members)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	group := &models.Group{
+		DisplayName: displayName,
+		ExternalID:  resource.ExternalID,
+		MemberIDs:   memberIDs,
+	}
+
+	if err := h.groupRepo.Create(c.Request.Context(), group); err != nil {
+		if errors.Is(err, repository.ErrGroupAlreadyExists) {
+			h.writeError(c, conflict("a group named %s already exists", displayName))
+			return
+		}
+		h.writeError(c, err)
+		return
+	}
+
+	log.Printf("SCIM provisioned group %s with %d members", group.ID.Hex(), len(group.MemberIDs))
+	h.respondGroup(c, http.StatusCreated, group)
+}
+
+func (h *Handler) replaceGroup(c *gin.Context) {
+	group, err := h.findGroup(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	var resource groupResource
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		h.writeError(c, badRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+
+	displayName := strings.TrimSpace(resource.DisplayName)
+	if displayName == "" {
+		h.writeError(c, badRequest("invalidValue", "displayName is required"))
+		return
+	}
+
+	memberIDs, err := h.resolveMembers(c.Request.Context(), resource.Members)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	group.DisplayName = displayName
+	group.ExternalID = resource.ExternalID
+	group.MemberIDs = memberIDs
+
+	if err := h.saveGroup(c.Request.Context(), group); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.respondGroup(c, http.StatusOK, group)
+}
+
+// patchGroup applies membership and name changes. Identity providers mostly use it to
+// add and remove members without resending the whole group.
+func (h *Handler) patchGroup(c *gin.Context) {
+	group, err := h.findGroup(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	var req patchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.writeError(c, badRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+
+	for _, op := range req.Operations {
+		name := strings.ToLower(op.Op)
+		if name != "add" && name != "replace" && name != "remove" {
+			h.writeError(c, badRequest("invalidSyntax", "unsupported patch operation %q", op.Op))
+			return
+		}
+
+		if op.Path == "" {
+			if name == "remove" {
+				h.writeError(c, badRequest("noTarget", "remove operations require a path"))
+				return
+			}
+			values, ok := op.Value.(map[string]interface{})
+			if !ok {
+				h.writeError(c, badRequest("invalidValue", "operations without a path require an object value"))
+				return
+			}
+			for path, value := range values {
+				if err := h.patchGroupAttribute(c.Request.Context(), group, name, path, value); err != nil {
+					h.writeError(c, err)
+					return
+				}
+			}
+			continue
+		}
+
+		if err := h.patchGroupAttribute(c.Request.Context(), group, name, op.Path, op.Value); err != nil {
+			h.writeError(c, err)
+			return
+		}
+	}
+
+	if err := h.saveGroup(c.Request.Context(), group); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.respondGroup(c, http.StatusOK, group)
+}
+
+func (h *Handler) deleteGroup(c *gin.Context) {
+	group, err := h.findGroup(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if err := h.groupRepo.Delete(c.Request.Context(), group.ID); err != nil {
+		if errors.Is(err, repository.ErrGroupNotFound) {
+			h.writeError(c, notFound("group"))
+			return
+		}
+		h.writeError(c, err)
+		return
+	}
+
+	log.Printf("SCIM deleted group %s", group.ID.Hex())
+	c.Status(http.StatusNoContent)
+}
+
+// patchGroupAttribute applies one operation on path to group. Unsupported attributes
+// are ignored.
+func (h *Handler) patchGroupAttribute(ctx context.Context, group *models.Group, op, path string, value interface{}) error {
+	lower := strings.TrimPrefix(strings.ToLower(path), strings.ToLower(schemaGroup)+":")
+
+	switch {
+	case lower == "displayname":
+		displayName, _ := value.(string)
+		displayName = strings.TrimSpace(displayName)
+		if op == "remove" || displayName == "" {
+			return badRequest("invalidValue", "displayName is required")
+		}
+		group.DisplayName = displayName
+
+	case lower == "externalid":
+		externalID, _ := value.(string)
+		if op == "remove" {
+			externalID = ""
+		}
+		group.ExternalID = externalID
+
+	case lower == "members":
+		refs, err := decodeReferences(value)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case "add":
+			memberIDs, err := h.resolveMembers(ctx, refs)
+			if err != nil {
+				return err
+			}
+			group.MemberIDs = addMembers(group.MemberIDs, memberIDs)
+		case "replace":
+			memberIDs, err := h.resolveMembers(ctx, refs)
+			if err != nil {
+				return err
+			}
+			group.MemberIDs = memberIDs
+		case "remove":
+			// Removing the attribute without a value removes every member
+			if value == nil {
+				group.MemberIDs = nil
+				return nil
+			}
+			group.MemberIDs = removeMembers(group.MemberIDs, parseMemberIDs(refs))
+		}
+
+	case strings.HasPrefix(lower, "members["):
+		// members[value eq "<id>"] addresses a single member
+		if op != "remove" {
+			return badRequest("invalidPath", "only remove is supported on filtered member paths")
+		}
+		filter := path[strings.Index(path, "[")+1 : len(strings.TrimSuffix(path, "]"))]
+		attribute, memberID, err := parseFilter(filter)
+		if err != nil || attribute != "value" {
+			return badRequest("invalidPath", "member paths must filter on value")
+		}
+		group.MemberIDs = removeMembers(group.MemberIDs, parseMemberIDs([]reference{{Value: memberID}}))
+	}
+
+	return nil
+}
+
+func (h *Handler) findGroup(ctx context.Context, id string) (*models.Group, error) {
+	group, err := h.groupRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrGroupNotFound) {
+			return nil, notFound("group")
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+func (h *Handler) saveGroup(ctx context.Context, group *models.Group) error {
+	if err := h.groupRepo.Update(ctx, group); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrGroupNotFound):
+			return notFound("group")
+		case errors.Is(err, repository.ErrGroupAlreadyExists):
+			return conflict("a group named %s already exists", group.DisplayName)
+		}
+		return err
+	}
+	return nil
+}
+
+// resolveMembers returns the user IDs of refs, rejecting users that do not exist
+func (h *Handler) resolveMembers(ctx context.Context, refs []reference) ([]primitive.ObjectID, error) {
+	memberIDs := make([]primitive.ObjectID, 0, len(refs))
+	seen := make(map[primitive.ObjectID]bool, len(refs))
+	for _, ref := range refs {
+		memberID, err := primitive.ObjectIDFromHex(ref.Value)
+		if err != nil {
+			return nil, badRequest("invalidValue", "member %s is not a known user", ref.Value)
+		}
+		if !seen[memberID] {
+			seen[memberID] = true
+			memberIDs = append(memberIDs, memberID)
+		}
+	}
+
+	if len(memberIDs) == 0 {
+		return memberIDs, nil
+	}
+
+	users, err := h.userRepo.FindByIDs(ctx, memberIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) != len(memberIDs) {
+		found := make(map[primitive.ObjectID]bool, len(users))
+		for _, user := range users {
+			found[user.ID] = true
+		}
+		for _, memberID := range memberIDs {
+			if !found[memberID] {
+				return nil, badRequest("invalidValue", "member %s is not a known user", memberID.Hex())
+			}
+		}
+	}
+
+	return memberIDs, nil
+}
+
+func (h *Handler) respondGroup(c *gin.Context, status int, group *models.Group) {
+	resources, err := h.groupResources(c.Request.Context(), []*models.Group{group}, true)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if status == http.StatusCreated {
+		c.Header("Location", h.location("Groups", group.ID.Hex()))
+	}
+	h.writeResource(c, status, resources[0])
+}
+
+// groupResources converts groups to SCIM resources, optionally listing their members
+func (h *Handler) groupResources(ctx context.Context, groups []*models.Group, includeMembers bool) ([]interface{}, error) {
+	resources := make([]interface{}, 0, len(groups))
+
+	users := make(map[primitive.ObjectID]*models.User)
+	if includeMembers {
+		var memberIDs []primitive.ObjectID
+		for _, group := range groups {
+			memberIDs = append(memberIDs, group.MemberIDs...)
+		}
+		if len(memberIDs) > 0 {
+			members, err := h.userRepo.FindByIDs(ctx, memberIDs)
+			if err != nil {
+				return nil, err
+			}
+			for _, member := range members {
+				users[member.ID] = member
+			}
+		}
+	}
+
+	for _, group := range groups {
+		resource := &groupResource{
+			Schemas:     []string{schemaGroup},
+			ID:          group.ID.Hex(),
+			ExternalID:  group.ExternalID,
+			DisplayName: group.DisplayName,
+			Meta: &meta{
+				ResourceType: "Group",
+				Created:      group.CreatedAt.UTC().Format(time.RFC3339),
+				LastModified: group.UpdatedAt.UTC().Format(time.RFC3339),
+				Location:     h.location("Groups", group.ID.Hex()),
+			},
+		}
+		for _, memberID := range group.MemberIDs {
+			member, ok := users[memberID]
+			if !ok {
+				continue
+			}
+			resource.Members = append(resource.Members, reference{
+				Value:   member.ID.Hex(),
+				Display: member.FullName,
+				Ref:     h.location("Users", member.ID.Hex()),
+			})
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources, nil
+}
+
+// decodeReferences reads a patch value holding one or more member references
+func decodeReferences(value interface{}) ([]reference, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []reference
+	if err := json.Unmarshal(data, &refs); err != nil {
+		var ref reference
+		if err := json.Unmarshal(data, &ref); err != nil {
+			return nil, badRequest("invalidValue", "members must be a list of objects with a value")
+		}
+		refs = []reference{ref}
+	}
+	return refs, nil
+}
+
+// parseMemberIDs returns the valid user IDs of refs. Invalid IDs cannot be members, so
+// removing them is a no-op.
+func parseMemberIDs(refs []reference) []primitive.ObjectID {
+	memberIDs := make([]primitive.ObjectID, 0, len(refs))
+	for _, ref := range refs {
+		if memberID, err := primitive.ObjectIDFromHex(ref.Value); err == nil {
+			memberIDs = append(memberIDs, memberID)
+		}
+	}
+	return memberIDs
+}
+
+func addMembers(memberIDs, added []primitive.ObjectID) []primitive.ObjectID {
+	existing := make(map[primitive.ObjectID]bool, len(memberIDs))
+	for _, memberID := range memberIDs {
+		existing[memberID] = true
+	}
+	for _, memberID := range added {
+		if !existing[memberID] {
+			existing[memberID] = true
+			memberIDs = append(memberIDs, memberID)
+		}
+	}
+	return memberIDs
+}
+
+func removeMembers(memberIDs, removed []primitive.ObjectID) []primitive.ObjectID {
+	drop := make(map[primitive.ObjectID]bool, len(removed))
+	for _, memberID := range removed {
+		drop[memberID] = true
+	}
+
+	kept := memberIDs[:0]
+	for _, memberID := range memberIDs {
+		if !drop[memberID] {
+			kept = append(kept, memberID)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,296 @@
+// Package scim implements a SCIM 2.0 (RFC 7643/7644) provisioning endpoint so identity
+// providers can create, update and deprovision users and groups
+package scim
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/config"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/userevents"
+)
+
+const (
+	schemaUser            = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaGroup           = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	schemaListResponse    = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaError           = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaServiceProvider = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	schemaResourceType    = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	contentType = "application/scim+json; charset=utf-8"
+
+	defaultPageSize int64 = 100
+	maxPageSize     int64 = 200
+)
+
+// filterPattern matches the single "attribute eq value" filters identity providers use to
+// look up existing resources
+var filterPattern = regexp.MustCompile(`(?i)^\s*([a-z][\w.]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// Handler serves the SCIM Users and Groups resources
+type Handler struct {
+	userRepo  *repository.UserRepository
+	groupRepo *repository.GroupRepository
+	orgRepo   *repository.OrganizationRepository
+	auditRepo *repository.AuditEventRepository
+	cfg       *config.Config
+	// userEvents publishes the users provisioned, if user events are enabled
+	userEvents *userevents.Publisher
+}
+
+func NewHandler(userRepo *repository.UserRepository, groupRepo *repository.GroupRepository, orgRepo *repository.OrganizationRepository, auditRepo *repository.AuditEventRepository, cfg *config.Config) *Handler {
+	return &Handler{
+		userRepo:  userRepo,
+		groupRepo: groupRepo,
+		orgRepo:   orgRepo,
+		auditRepo: auditRepo,
+		cfg:       cfg,
+	}
+}
+
+// SetUserEvents publishes the users provisioned, for the file-service to link the files
+// shared with their email address to them
+func (h *Handler) SetUserEvents(publisher *userevents.Publisher) {
+	h.userEvents = publisher
+}
+
+// RegisterRoutes mounts the SCIM endpoints on rg. Every request must carry the
+// configured bearer token.
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.Use(h.authenticate)
+
+	rg.GET("/ServiceProviderConfig", h.serviceProviderConfig)
+	rg.GET("/ResourceTypes", h.resourceTypes)
+
+	rg.GET("/Users", h.listUsers)
+	rg.POST("/Users", h.createUser)
+	rg.GET("/Users/:id", h.getUser)
+	rg.PUT("/Users/:id", h.replaceUser)
+	rg.PATCH("/Users/:id", h.patchUser)
+	rg.DELETE("/Users/:id", h.deleteUser)
+
+	rg.GET("/Groups", h.listGroups)
+	rg.POST("/Groups", h.createGroup)
+	rg.GET("/Groups/:id", h.getGroup)
+	rg.PUT("/Groups/:id", h.replaceGroup)
+	rg.PATCH("/Groups/:id", h.patchGroup)
+	rg.DELETE("/Groups/:id", h.deleteGroup)
+}
+
+// scimError is an error reported to the client in the SCIM error format
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimError) Error() string {
+	return e.detail
+}
+
+func badRequest(scimType, format string, args ...interface{}) error {
+	return &scimError{status: http.StatusBadRequest, scimType: scimType, detail: fmt.Sprintf(format, args...)}
+}
+
+func notFound(resource string) error {
+	return &scimError{status: http.StatusNotFound, detail: resource + " not found"}
+}
+
+func conflict(format string, args ...interface{}) error {
+	return &scimError{status: http.StatusConflict, scimType: "uniqueness", detail: fmt.Sprintf(format, args...)}
+}
+
+// meta carries the common resource attributes
+type meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created"`
+	LastModified string `json:"lastModified"`
+	Location     string `json:"location"`
+}
+
+// reference points at another resource, e.g. a group member
+type reference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type listResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int64         `json:"totalResults"`
+	StartIndex   int64         `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// patchRequest is a PATCH body. Operation names are case-insensitive.
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []patchOperation `json:"Operations"`
+}
+
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// page is the requested window of a list, with SCIM's 1-based start index
+type page struct {
+	startIndex int64
+	count      int64
+}
+
+func (p page) skip() int64 {
+	return p.startIndex - 1
+}
+
+// limit returns the number of resources to load. A count of zero only asks for the
+// total, but at least one resource is loaded as a limit of zero means no limit.
+func (p page) limit() int64 {
+	if p.count == 0 {
+		return 1
+	}
+	return p.count
+}
+
+func parsePage(c *gin.Context) (page, error) {
+	p := page{startIndex: 1, count: defaultPageSize}
+
+	if raw := c.Query("startIndex"); raw != "" {
+		startIndex, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return p, badRequest("invalidValue", "startIndex must be a number")
+		}
+		if startIndex > 1 {
+			p.startIndex = startIndex
+		}
+	}
+
+	if raw := c.Query("count"); raw != "" {
+		count, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return p, badRequest("invalidValue", "count must be a number")
+		}
+		switch {
+		case count < 0:
+			p.count = 0
+		case count > maxPageSize:
+			p.count = maxPageSize
+		default:
+			p.count = count
+		}
+	}
+
+	return p, nil
+}
+
+// parseFilter parses an "attribute eq value" filter. The attribute is returned in lower
+// case since SCIM attribute names are case-insensitive.
+func parseFilter(filter string) (string, string, error) {
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", badRequest("invalidFilter", "only filters of the form 'attribute eq \"value\"' are supported")
+	}
+
+	value, err := strconv.Unquote(match[2])
+	if err != nil {
+		return "", "", badRequest("invalidFilter", "invalid filter value")
+	}
+
+	return strings.ToLower(match[1]), value, nil
+}
+
+// authenticate rejects requests without the configured bearer token
+func (h *Handler) authenticate(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.SCIMBearerToken)) != 1 {
+		h.writeError(c, &scimError{status: http.StatusUnauthorized, detail: "invalid or missing bearer token"})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func (h *Handler) writeResource(c *gin.Context, status int, resource interface{}) {
+	c.Header("Content-Type", contentType)
+	c.JSON(status, resource)
+}
+
+// writeError reports err in the SCIM error format. Errors other than scimError are
+// logged and reported as internal errors.
+func (h *Handler) writeError(c *gin.Context, err error) {
+	var scimErr *scimError
+	if !errors.As(err, &scimErr) {
+		log.Printf("SCIM %s %s failed: %v", c.Request.Method, c.Request.URL.Path, err)
+		scimErr = &scimError{status: http.StatusInternalServerError, detail: "internal error"}
+	}
+
+	body := gin.H{
+		"schemas": []string{schemaError},
+		"status":  strconv.Itoa(scimErr.status),
+		"detail":  scimErr.detail,
+	}
+	if scimErr.scimType != "" {
+		body["scimType"] = scimErr.scimType
+	}
+	h.writeResource(c, scimErr.status, body)
+}
+
+func (h *Handler) location(resource, id string) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%s", h.cfg.PublicURL, resource, id)
+}
+
+func (h *Handler) serviceProviderConfig(c *gin.Context) {
+	h.writeResource(c, http.StatusOK, gin.H{
+		"schemas":        []string{schemaServiceProvider},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": maxPageSize},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Authentication with the configured SCIM bearer token",
+			"primary":     true,
+		}},
+	})
+}
+
+func (h *Handler) resourceTypes(c *gin.Context) {
+	resources := []interface{}{
+		gin.H{
+			"schemas":  []string{schemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   schemaUser,
+		},
+		gin.H{
+			"schemas":  []string{schemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   schemaGroup,
+		},
+	}
+
+	h.writeResource(c, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: int64(len(resources)),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
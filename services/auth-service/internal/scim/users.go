@@ -0,0 +1,589 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/language"
+)
+
+const maxFullNameLength = 100
+
+// userAttributes maps the lower-case patch paths of supported user attributes to their
+// location in the resource. Other attributes are accepted and ignored.
+var userAttributes = map[string][]string{
+	"username":        {"userName"},
+	"displayname":     {"displayName"},
+	"externalid":      {"externalId"},
+	"active":          {"active"},
+	"locale":          {"locale"},
+	"timezone":        {"timezone"},
+	"emails":          {"emails"},
+	"name":            {"name"},
+	"name.formatted":  {"name", "formatted"},
+	"name.givenname":  {"name", "givenName"},
+	"name.familyname": {"name", "familyName"},
+}
+
+type userName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type userEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type userResource struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *userName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []userEmail `json:"emails,omitempty"`
+	Locale      string      `json:"locale,omitempty"`
+	Timezone    string      `json:"timezone,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Groups      []reference `json:"groups,omitempty"`
+	Meta        *meta       `json:"meta,omitempty"`
+}
+
+func (h *Handler) listUsers(c *gin.Context) {
+	p, err := parsePage(c)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	var email, externalID string
+	if filter := c.Query("filter"); filter != "" {
+		attribute, value, err := parseFilter(filter)
+		if err != nil {
+			h.writeError(c, err)
+			return
+		}
+		switch attribute {
+		case "username", "emails", "emails.value":
+			email = value
+		case "externalid":
+			externalID = value
+		default:
+			h.writeError(c, badRequest("invalidFilter", "filtering users by %s is not supported", attribute))
+			return
+		}
+		if value == "" {
+			h.writeResource(c, http.StatusOK, listResponse{Schemas: []string{schemaListResponse}, StartIndex: p.startIndex, Resources: []interface{}{}})
+			return
+		}
+	}
+
+	users, total, err := h.userRepo.List(c.Request.Context(), email, externalID, p.skip(), p.limit())
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if p.count == 0 {
+		users = nil
+	}
+
+	resources, err := h.userResources(c.Request.Context(), users)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeResource(c, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: total,
+		StartIndex:   p.startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *Handler) getUser(c *gin.Context) {
+	user, err := h.findUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.respondUser(c, http.StatusOK, user)
+}
+
+// createUser provisions a new account. Provisioned users have no password; they sign in
+// after choosing one through the forgot-password flow.
+func (h *Handler) createUser(c *gin.Context) {
+	var resource userResource
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		h.writeError(c, badRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+
+	user := &models.User{}
+	if err := applyUserResource(user, &resource); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	existing, err := h.userRepo.FindByEmails(c.Request.Context(), []string{user.Email})
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if len(existing) > 0 {
+		h.writeError(c, conflict("a user with userName %s already exists", user.Email))
+		return
+	}
+
+	now := time.Now()
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+
+	if err := h.userRepo.Create(c.Request.Context(), user); err != nil {
+		if errors.Is(err, repository.ErrUserAlreadyExists) {
+			h.writeError(c, conflict("a user with userName %s already exists", user.Email))
+			return
+		}
+		h.writeError(c, err)
+		return
+	}
+
+	log.Printf("SCIM provisioned user %s", user.ID.Hex())
+	h.recordAudit(c.Request.Context(), models.AuditEventUserRegistered, user, nil)
+	if h.userEvents != nil {
+		h.userEvents.UserRegistered(user)
+	}
+	h.respondUser(c, http.StatusCreated, user)
+}
+
+func (h *Handler) replaceUser(c *gin.Context) {
+	user, err := h.findUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	var resource userResource
+	if err := c.ShouldBindJSON(&resource); err != nil {
+		h.writeError(c, badRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+
+	previous := *user
+	if err := applyUserResource(user, &resource); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if err := h.saveUser(c.Request.Context(), user, &previous); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.respondUser(c, http.StatusOK, user)
+}
+
+// patchUser applies the operations to the user's current representation and stores the
+// result like a replace
+func (h *Handler) patchUser(c *gin.Context) {
+	user, err := h.findUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	var req patchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.writeError(c, badRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+
+	doc, err := toDocument(h.toUserResource(user, nil))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	touched := make(map[string]bool)
+	for _, op := range req.Operations {
+		if err := patchUserDocument(doc, op, touched); err != nil {
+			h.writeError(c, err)
+			return
+		}
+	}
+
+	// The stored name is a single string, so a patched given or family name replaces
+	// it unless the display name was patched as well
+	if (touched["name.givenname"] || touched["name.familyname"]) && !touched["displayname"] && !touched["name.formatted"] {
+		delete(doc, "displayName")
+		if name, ok := doc["name"].(map[string]interface{}); ok {
+			delete(name, "formatted")
+		}
+	}
+
+	var resource userResource
+	if err := fromDocument(doc, &resource); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	previous := *user
+	if err := applyUserResource(user, &resource); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if err := h.saveUser(c.Request.Context(), user, &previous); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.respondUser(c, http.StatusOK, user)
+}
+
+// deleteUser removes the account and its group and organization memberships. Its tokens stop validating
+// as soon as the account is gone.
+func (h *Handler) deleteUser(c *gin.Context) {
+	user, err := h.findUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if err := h.groupRepo.RemoveMember(c.Request.Context(), user.ID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if err := h.orgRepo.RemoveUser(c.Request.Context(), user.ID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if err := h.userRepo.Delete(c.Request.Context(), user.ID); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			h.writeError(c, notFound("user"))
+			return
+		}
+		h.writeError(c, err)
+		return
+	}
+
+	log.Printf("SCIM deleted user %s", user.ID.Hex())
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) findUser(ctx context.Context, id string) (*models.User, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, notFound("user")
+	}
+
+	user, err := h.userRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, notFound("user")
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// saveUser stores the provisioned attributes of user. Deactivating a user or changing
+// their email address signs out every session.
+func (h *Handler) saveUser(ctx context.Context, user, previous *models.User) error {
+	emailChanged := !strings.EqualFold(user.Email, previous.Email)
+	if emailChanged {
+		existing, err := h.userRepo.FindByEmails(ctx, []string{user.Email})
+		if err != nil {
+			return err
+		}
+		for _, other := range existing {
+			if other.ID != user.ID {
+				return conflict("a user with userName %s already exists", user.Email)
+			}
+		}
+	}
+
+	if err := h.userRepo.Provision(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return notFound("user")
+		}
+		return err
+	}
+
+	if (user.Disabled && !previous.Disabled) || emailChanged {
+		if err := h.userRepo.RevokeTokens(ctx, user.ID); err != nil {
+			return err
+		}
+
+		reason := "deactivated"
+		if emailChanged {
+			reason = "email_changed"
+		}
+		h.recordAudit(ctx, models.AuditEventTokensRevoked, user, map[string]string{"reason": reason})
+	}
+
+	switch {
+	case user.Disabled && !previous.Disabled:
+		log.Printf("SCIM deactivated user %s", user.ID.Hex())
+	case !user.Disabled && previous.Disabled:
+		log.Printf("SCIM reactivated user %s", user.ID.Hex())
+	}
+
+	return nil
+}
+
+// recordAudit adds an event caused by the identity provider to the audit log. Failures are
+// logged rather than failing the provisioning request.
+func (h *Handler) recordAudit(ctx context.Context, eventType models.AuditEventType, user *models.User, details map[string]string) {
+	event := &models.AuditEvent{
+		Type:    eventType,
+		UserID:  user.ID,
+		Email:   user.Email,
+		Actor:   models.AuditActorSCIM,
+		Details: details,
+	}
+	if err := h.auditRepo.Create(ctx, event); err != nil {
+		log.Printf("Failed to record SCIM %s audit event for user %s: %v", eventType, user.ID.Hex(), err)
+	}
+}
+
+func (h *Handler) respondUser(c *gin.Context, status int, user *models.User) {
+	resources, err := h.userResources(c.Request.Context(), []*models.User{user})
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if status == http.StatusCreated {
+		c.Header("Location", h.location("Users", user.ID.Hex()))
+	}
+	h.writeResource(c, status, resources[0])
+}
+
+// userResources converts users to SCIM resources including their group memberships
+func (h *Handler) userResources(ctx context.Context, users []*models.User) ([]interface{}, error) {
+	resources := make([]interface{}, 0, len(users))
+	if len(users) == 0 {
+		return resources, nil
+	}
+
+	userIDs := make([]primitive.ObjectID, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	groups, err := h.groupRepo.ListByMembers(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships := make(map[primitive.ObjectID][]reference)
+	for _, group := range groups {
+		ref := reference{
+			Value:   group.ID.Hex(),
+			Display: group.DisplayName,
+			Ref:     h.location("Groups", group.ID.Hex()),
+		}
+		for _, memberID := range group.MemberIDs {
+			memberships[memberID] = append(memberships[memberID], ref)
+		}
+	}
+
+	for _, user := range users {
+		resources = append(resources, h.toUserResource(user, memberships[user.ID]))
+	}
+	return resources, nil
+}
+
+func (h *Handler) toUserResource(user *models.User, groups []reference) *userResource {
+	active := !user.Disabled
+	return &userResource{
+		Schemas:     []string{schemaUser},
+		ID:          user.ID.Hex(),
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		Name:        &userName{Formatted: user.FullName},
+		DisplayName: user.FullName,
+		Emails:      []userEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Locale:      user.Locale,
+		Timezone:    user.Timezone,
+		Active:      &active,
+		Groups:      groups,
+		Meta: &meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt.UTC().Format(time.RFC3339),
+			LastModified: user.UpdatedAt.UTC().Format(time.RFC3339),
+			Location:     h.location("Users", user.ID.Hex()),
+		},
+	}
+}
+
+// applyUserResource copies the provisioned attributes of resource onto user. The email
+// address is the userName, or the primary email when the userName is not an address.
+// Locale and timezone are only replaced when given, so users keep their own settings.
+func applyUserResource(user *models.User, resource *userResource) error {
+	email := strings.TrimSpace(resource.UserName)
+	if !strings.Contains(email, "@") {
+		email = ""
+		for _, candidate := range resource.Emails {
+			if email == "" || candidate.Primary {
+				email = strings.TrimSpace(candidate.Value)
+			}
+		}
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return badRequest("invalidValue", "userName or a primary email must be a valid email address")
+	}
+
+	fullName := strings.TrimSpace(resource.DisplayName)
+	if fullName == "" && resource.Name != nil {
+		fullName = strings.TrimSpace(resource.Name.Formatted)
+		if fullName == "" {
+			fullName = strings.TrimSpace(resource.Name.GivenName + " " + resource.Name.FamilyName)
+		}
+	}
+	if fullName == "" {
+		fullName = email[:strings.Index(email, "@")]
+	}
+	if utf8.RuneCountInString(fullName) > maxFullNameLength {
+		return badRequest("invalidValue", "displayName must not be longer than %d characters", maxFullNameLength)
+	}
+
+	if resource.Timezone != "" {
+		if _, err := time.LoadLocation(resource.Timezone); err != nil || resource.Timezone == "Local" {
+			return badRequest("invalidValue", "timezone must be an IANA time zone name")
+		}
+		user.Timezone = resource.Timezone
+	}
+	if resource.Locale != "" {
+		tag, err := language.Parse(resource.Locale)
+		if err != nil {
+			return badRequest("invalidValue", "locale must be a BCP 47 language tag")
+		}
+		user.Locale = tag.String()
+	}
+
+	user.Email = email
+	user.FullName = fullName
+	user.ExternalID = resource.ExternalID
+	user.Disabled = resource.Active != nil && !*resource.Active
+	return nil
+}
+
+// patchUserDocument applies a patch operation to the JSON representation of a user and
+// records the lower-case paths it touched
+func patchUserDocument(doc map[string]interface{}, op patchOperation, touched map[string]bool) error {
+	name := strings.ToLower(op.Op)
+	if name != "add" && name != "replace" && name != "remove" {
+		return badRequest("invalidSyntax", "unsupported patch operation %q", op.Op)
+	}
+
+	if op.Path == "" {
+		if name == "remove" {
+			return badRequest("noTarget", "remove operations require a path")
+		}
+		values, ok := op.Value.(map[string]interface{})
+		if !ok {
+			return badRequest("invalidValue", "operations without a path require an object value")
+		}
+		for path, value := range values {
+			if err := setUserAttribute(doc, path, value, false, touched); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return setUserAttribute(doc, op.Path, op.Value, name == "remove", touched)
+}
+
+func setUserAttribute(doc map[string]interface{}, path string, value interface{}, remove bool, touched map[string]bool) error {
+	path = strings.TrimPrefix(strings.ToLower(path), strings.ToLower(schemaUser)+":")
+
+	// Filtered paths such as emails[type eq "work"].value address the single email
+	if strings.HasPrefix(path, "emails") {
+		if email, ok := value.(string); ok {
+			value = []interface{}{map[string]interface{}{"value": email, "primary": true}}
+		}
+		path = "emails"
+	}
+
+	keys, ok := userAttributes[path]
+	if !ok {
+		return nil
+	}
+
+	// Some identity providers send booleans as strings
+	if raw, ok := value.(string); ok && path == "active" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			return badRequest("invalidValue", "active must be a boolean")
+		}
+		value = active
+	}
+
+	touched[path] = true
+
+	target := doc
+	for _, key := range keys[:len(keys)-1] {
+		next, _ := target[key].(map[string]interface{})
+		if next == nil {
+			next = make(map[string]interface{})
+			target[key] = next
+		}
+		target = next
+	}
+
+	last := keys[len(keys)-1]
+	if remove {
+		delete(target, last)
+	} else {
+		target[last] = value
+	}
+	return nil
+}
+
+// toDocument converts a resource to its generic JSON representation
+func toDocument(resource interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// fromDocument converts a patched JSON representation back into a resource
+func fromDocument(doc map[string]interface{}, resource interface{}) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, resource); err != nil {
+		return badRequest("invalidValue", "patched resource is invalid: %v", err)
+	}
+	return nil
+}
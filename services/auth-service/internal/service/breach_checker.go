@@ -0,0 +1,65 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BreachChecker looks up passwords in the Have I Been Pwned range API. Only the first five
+// characters of the password's SHA-1 hash leave the service (k-anonymity), and responses
+// are padded so their size does not reveal the prefix.
+type BreachChecker struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewBreachChecker(baseURL string, timeout time.Duration) *BreachChecker {
+	return &BreachChecker{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// IsBreached reports whether the password appears in a known data breach
+func (c *BreachChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "distributed-file-sharing-auth-service")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("breach lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("breach lookup returned status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding entries have a count of zero
+		if ok && candidate == suffix && count != "0" {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breach lookup response: %w", err)
+	}
+
+	return false, nil
+}
@@ -1,20 +1,31 @@
 package service
 
 import (
-	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrExpiredToken = errors.New("token has expired")
+	ErrInvalidToken = jwtauth.ErrInvalidToken
+	ErrExpiredToken = jwtauth.ErrExpiredToken
 )
 
 type JWTClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID        string `json:"user_id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	// TenantID is the tenant the user belongs to, empty for the default tenant
+	TenantID string `json:"tenant_id,omitempty"`
+	// OrgID and OrgRole identify the organization the access token was issued for.
+	// Both are empty for the personal workspace.
+	OrgID   string `json:"org_id,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// ImpersonatorID and ImpersonationID are set on impersonation tokens, which an
+	// organization admin uses to act as the user with their consent
+	ImpersonatorID  string `json:"impersonator_id,omitempty"`
+	ImpersonationID string `json:"impersonation_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -32,22 +43,17 @@ func NewJWTService(secret string, accessExpiry, refreshExpiry int64) *JWTService
 	}
 }
 
-func (s *JWTService) GenerateAccessToken(userID, email string) (string, int64, error) {
-	now := time.Now()
-	expiresAt := now.Add(s.accessExpiry)
-
+func (s *JWTService) GenerateAccessToken(userID, email string, emailVerified bool, tenantID, orgID, orgRole string) (string, int64, error) {
 	claims := &JWTClaims{
-		UserID: userID,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(now),
-			NotBefore: jwt.NewNumericDate(now),
-		},
+		UserID:        userID,
+		Email:         email,
+		EmailVerified: emailVerified,
+		TenantID:      tenantID,
+		OrgID:         orgID,
+		OrgRole:       orgRole,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.secretKey)
+	tokenString, err := s.signAccessToken(claims, time.Now(), s.accessExpiry)
 	if err != nil {
 		return "", 0, err
 	}
@@ -55,6 +61,41 @@ func (s *JWTService) GenerateAccessToken(userID, email string) (string, int64, e
 	return tokenString, int64(s.accessExpiry.Seconds()), nil
 }
 
+// GenerateImpersonationToken issues an access token for userID on behalf of an
+// impersonator. It expires at expiresAt and has no refresh token.
+func (s *JWTService) GenerateImpersonationToken(userID, email string, emailVerified bool, tenantID, orgID, orgRole, impersonatorID, impersonationID string, expiresAt time.Time) (string, int64, error) {
+	claims := &JWTClaims{
+		UserID:          userID,
+		Email:           email,
+		EmailVerified:   emailVerified,
+		TenantID:        tenantID,
+		OrgID:           orgID,
+		OrgRole:         orgRole,
+		ImpersonatorID:  impersonatorID,
+		ImpersonationID: impersonationID,
+	}
+
+	now := time.Now()
+	expiry := expiresAt.Sub(now)
+	tokenString, err := s.signAccessToken(claims, now, expiry)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return tokenString, int64(expiry.Seconds()), nil
+}
+
+func (s *JWTService) signAccessToken(claims *JWTClaims, now time.Time, expiry time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(s.secretKey)
+}
+
 func (s *JWTService) GenerateRefreshToken(userID, email string) (string, error) {
 	now := time.Now()
 	expiresAt := now.Add(s.refreshExpiry)
@@ -74,28 +115,9 @@ func (s *JWTService) GenerateRefreshToken(userID, email string) (string, error)
 }
 
 func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return s.secretKey, nil
-	})
-
-	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrExpiredToken
-		}
-		return nil, ErrInvalidToken
-	}
-
-	if !token.Valid {
-		return nil, ErrInvalidToken
-	}
-
-	claims, ok := token.Claims.(*JWTClaims)
-	if !ok {
-		return nil, ErrInvalidToken
+	claims := &JWTClaims{}
+	if err := jwtauth.Parse(tokenString, s.secretKey, claims); err != nil {
+		return nil, err
 	}
-
 	return claims, nil
 }
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrAccountLocked  = errors.New("account is temporarily locked due to too many failed login attempts")
+	ErrIPBlocked      = errors.New("too many failed login attempts from this address")
+	ErrLoginThrottled = errors.New("too many failed login attempts")
+)
+
+// loginBaseDelay is the wait imposed after the first throttled failure; it doubles with
+// every further failure
+const loginBaseDelay = time.Second
+
+const loginKeyPrefix = "auth:login:"
+
+// LoginBlockedError is returned when a login attempt is rejected before credentials are checked
+type LoginBlockedError struct {
+	Reason     error
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	return e.Reason.Error()
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return e.Reason
+}
+
+// LoginFailureResult describes the thresholds crossed by a failed login
+type LoginFailureResult struct {
+	AccountFailures int64
+	IPFailures      int64
+	Delay           time.Duration
+	AccountLocked   bool
+	IPBlocked       bool
+}
+
+// LoginProtectionService tracks failed logins per account and per client IP in Redis,
+// applying progressive delays and temporary lockouts against brute force and
+// credential stuffing
+type LoginProtectionService struct {
+	client             *redis.Client
+	maxAccountFailures int64
+	maxIPFailures      int64
+	delayAfter         int64
+	maxDelay           time.Duration
+	window             time.Duration
+	lockout            time.Duration
+}
+
+func NewLoginProtectionService(client *redis.Client, maxAccountFailures, maxIPFailures, delayAfter int64, window, lockout, maxDelay time.Duration) *LoginProtectionService {
+	return &LoginProtectionService{
+		client:             client,
+		maxAccountFailures: maxAccountFailures,
+		maxIPFailures:      maxIPFailures,
+		delayAfter:         delayAfter,
+		maxDelay:           maxDelay,
+		window:             window,
+		lockout:            lockout,
+	}
+}
+
+// Check rejects the attempt with a *LoginBlockedError if the IP is blocked, the account
+// is locked or the account is still inside its progressive delay
+func (s *LoginProtectionService) Check(ctx context.Context, email, ip string) error {
+	account := normalizeLoginEmail(email)
+
+	pipe := s.client.Pipeline()
+	var ipLock *redis.DurationCmd
+	if ip != "" {
+		ipLock = pipe.PTTL(ctx, s.key("lock:ip:", ip))
+	}
+	accountLock := pipe.PTTL(ctx, s.key("lock:account:", account))
+	accountDelay := pipe.PTTL(ctx, s.key("delay:account:", account))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	// PTTL reports negative values for missing keys
+	if ipLock != nil && ipLock.Val() > 0 {
+		return &LoginBlockedError{Reason: ErrIPBlocked, RetryAfter: ipLock.Val()}
+	}
+	if accountLock.Val() > 0 {
+		return &LoginBlockedError{Reason: ErrAccountLocked, RetryAfter: accountLock.Val()}
+	}
+	if accountDelay.Val() > 0 {
+		return &LoginBlockedError{Reason: ErrLoginThrottled, RetryAfter: accountDelay.Val()}
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed login and applies delays or lockouts when thresholds
+// are reached. Failures are counted for unknown accounts too so lockouts do not reveal
+// which emails are registered.
+func (s *LoginProtectionService) RecordFailure(ctx context.Context, email, ip string) (*LoginFailureResult, error) {
+	account := normalizeLoginEmail(email)
+	accountKey := s.key("fail:account:", account)
+	ipKey := s.key("fail:ip:", ip)
+
+	pipe := s.client.TxPipeline()
+	accountCount := pipe.Incr(ctx, accountKey)
+	pipe.ExpireNX(ctx, accountKey, s.window)
+	var ipCount *redis.IntCmd
+	if ip != "" {
+		ipCount = pipe.Incr(ctx, ipKey)
+		pipe.ExpireNX(ctx, ipKey, s.window)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	result := &LoginFailureResult{AccountFailures: accountCount.Val()}
+	if ipCount != nil {
+		result.IPFailures = ipCount.Val()
+	}
+
+	pipe = s.client.TxPipeline()
+	switch {
+	case result.AccountFailures >= s.maxAccountFailures:
+		// The counter restarts once the lock expires
+		pipe.Set(ctx, s.key("lock:account:", account), 1, s.lockout)
+		pipe.Del(ctx, accountKey, s.key("delay:account:", account))
+		result.AccountLocked = true
+	case result.AccountFailures >= s.delayAfter:
+		result.Delay = s.delayFor(result.AccountFailures)
+		pipe.Set(ctx, s.key("delay:account:", account), 1, result.Delay)
+	}
+
+	if ip != "" && result.IPFailures >= s.maxIPFailures {
+		pipe.Set(ctx, s.key("lock:ip:", ip), 1, s.lockout)
+		pipe.Del(ctx, ipKey)
+		result.IPBlocked = true
+	}
+
+	if pipe.Len() > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// RecordSuccess clears the account's failure history after a successful login. The IP
+// counter is kept so a stuffing run cannot reset itself with one valid credential.
+func (s *LoginProtectionService) RecordSuccess(ctx context.Context, email string) error {
+	account := normalizeLoginEmail(email)
+	return s.client.Del(ctx, s.key("fail:account:", account), s.key("delay:account:", account)).Err()
+}
+
+// Unlock removes any lockout, delay and failure history of an account, for example
+// after the owner resets their password
+func (s *LoginProtectionService) Unlock(ctx context.Context, email string) error {
+	account := normalizeLoginEmail(email)
+	return s.client.Del(ctx,
+		s.key("fail:account:", account),
+		s.key("delay:account:", account),
+		s.key("lock:account:", account),
+	).Err()
+}
+
+// AccountFailures returns the number of recent failed logins of an account
+func (s *LoginProtectionService) AccountFailures(ctx context.Context, email string) (int64, error) {
+	failures, err := s.client.Get(ctx, s.key("fail:account:", normalizeLoginEmail(email))).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return failures, err
+}
+
+// LockoutDuration returns how long accounts and IPs stay locked
+func (s *LoginProtectionService) LockoutDuration() time.Duration {
+	return s.lockout
+}
+
+func (s *LoginProtectionService) delayFor(failures int64) time.Duration {
+	delay := loginBaseDelay
+	for i := s.delayAfter; i < failures && delay < s.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.maxDelay {
+		delay = s.maxDelay
+	}
+	return delay
+}
+
+func (s *LoginProtectionService) key(kind, value string) string {
+	return loginKeyPrefix + kind + value
+}
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
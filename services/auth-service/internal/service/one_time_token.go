@@ -0,0 +1,26 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// GenerateOneTimeToken returns a random URL-safe token for emailed links and the hash
+// to store for it. Used for password reset and email verification.
+func GenerateOneTimeToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", errors.New("failed to generate token")
+	}
+
+	token := hex.EncodeToString(buf)
+	return token, HashOneTimeToken(token), nil
+}
+
+// HashOneTimeToken hashes a one-time token for storage and lookup
+func HashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords is the set of most common passwords, in lower case
+var commonPasswords = loadCommonPasswords(commonPasswordList)
+
+// minUserInputLength is the shortest name or email part a password may not contain
+const minUserInputLength = 4
+
+// PasswordPolicyError lists every rule a password violates
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return strings.Join(e.Violations, "; ")
+}
+
+// PasswordPolicyService checks passwords against a password policy
+type PasswordPolicyService struct {
+	defaultPolicy models.PasswordPolicy
+	breachChecker *BreachChecker
+}
+
+// NewPasswordPolicyService creates a policy service. breachChecker may be nil, in which
+// case breached password checks are skipped.
+func NewPasswordPolicyService(defaultPolicy models.PasswordPolicy, breachChecker *BreachChecker) *PasswordPolicyService {
+	return &PasswordPolicyService{
+		defaultPolicy: defaultPolicy,
+		breachChecker: breachChecker,
+	}
+}
+
+// DefaultPolicy returns the service-wide policy
+func (s *PasswordPolicyService) DefaultPolicy() models.PasswordPolicy {
+	return s.defaultPolicy
+}
+
+// Validate checks password against policy and returns a *PasswordPolicyError listing the
+// violated rules. userInputs, such as the user's name and email, must not appear in the
+// password. A failing breach check is logged and does not reject the password.
+func (s *PasswordPolicyService) Validate(ctx context.Context, password string, policy models.PasswordPolicy, userInputs ...string) error {
+	var violations []string
+
+	minLength := policy.MinLength
+	if minLength < MinPasswordLength {
+		minLength = MinPasswordLength
+	}
+	if len([]rune(password)) < minLength {
+		violations = append(violations, fmt.Sprintf("password must be at least %d characters long", minLength))
+	}
+	if len(password) > MaxPasswordLength {
+		violations = append(violations, fmt.Sprintf("password must be at most %d bytes long", MaxPasswordLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if policy.RequireUppercase && !hasUpper {
+		violations = append(violations, "password must contain an uppercase letter")
+	}
+	if policy.RequireLowercase && !hasLower {
+		violations = append(violations, "password must contain a lowercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		violations = append(violations, "password must contain a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		violations = append(violations, "password must contain a symbol")
+	}
+
+	lower := strings.ToLower(password)
+	if policy.DenyCommon && commonPasswords[lower] {
+		violations = append(violations, "password is too common")
+	}
+
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			input = local
+		}
+		if len(input) >= minUserInputLength && strings.Contains(lower, input) {
+			violations = append(violations, "password must not contain your name or email address")
+			break
+		}
+	}
+
+	// Only query the breach service for passwords that pass every local rule
+	if len(violations) == 0 && policy.CheckBreached && s.breachChecker != nil {
+		breached, err := s.breachChecker.IsBreached(ctx, password)
+		if err != nil {
+			log.Printf("Warning: breached password check failed, accepting password: %v", err)
+		} else if breached {
+			violations = append(violations, "password has appeared in a data breach, please choose a different one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func loadCommonPasswords(list string) map[string]bool {
+	passwords := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = true
+	}
+	return passwords
+}
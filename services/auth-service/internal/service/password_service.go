@@ -4,6 +4,13 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// MinPasswordLength is the floor for every password policy
+	MinPasswordLength = 8
+	// bcrypt ignores everything past 72 bytes
+	MaxPasswordLength = 72
+)
+
 type PasswordService struct {
 	cost int
 }
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"strings"
+)
+
+//go:embed disposable_domains.txt
+var disposableDomainList string
+
+// disposableDomains is the set of known disposable email providers
+var disposableDomains = loadDomainList(disposableDomainList)
+
+var (
+	ErrSignupDomainNotAllowed = errors.New("email domain is not allowed to sign up")
+	ErrInvalidDomain          = errors.New("invalid domain")
+)
+
+// maxDomainLength is the longest DNS name
+const maxDomainLength = 253
+
+// SignupDomainPolicy decides which email domains may register. A rule for a domain also
+// covers its subdomains.
+type SignupDomainPolicy struct {
+	allowed         []string
+	blocked         []string
+	blockDisposable bool
+}
+
+// NewSignupDomainPolicy creates a policy from the configured allow and block lists.
+// blockDisposable additionally blocks the built-in list of disposable email providers.
+func NewSignupDomainPolicy(allowed, blocked []string, blockDisposable bool) *SignupDomainPolicy {
+	return &SignupDomainPolicy{
+		allowed:         allowed,
+		blocked:         blocked,
+		blockDisposable: blockDisposable,
+	}
+}
+
+// AllowedDomains returns the configured allow list
+func (p *SignupDomainPolicy) AllowedDomains() []string {
+	return p.allowed
+}
+
+// BlockedDomains returns the configured block list
+func (p *SignupDomainPolicy) BlockedDomains() []string {
+	return p.blocked
+}
+
+// BlocksDisposable reports whether disposable email providers are blocked
+func (p *SignupDomainPolicy) BlocksDisposable() bool {
+	return p.blockDisposable
+}
+
+// Check returns ErrSignupDomainNotAllowed if email may not sign up. allowed and blocked are
+// the rules managed at runtime, which apply in addition to the configured ones. Blocks take
+// precedence over allows, an allow rule exempts a domain from the disposable provider list,
+// and once any allow rule exists only allowed domains can sign up.
+func (p *SignupDomainPolicy) Check(email string, allowed, blocked []string) error {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ErrSignupDomainNotAllowed
+	}
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(email[at+1:]), "."))
+
+	if matchesDomain(domain, p.blocked) || matchesDomain(domain, blocked) {
+		return ErrSignupDomainNotAllowed
+	}
+	if matchesDomain(domain, p.allowed) || matchesDomain(domain, allowed) {
+		return nil
+	}
+	if p.blockDisposable && matchesDomainSet(domain, disposableDomains) {
+		return ErrSignupDomainNotAllowed
+	}
+	if len(p.allowed) > 0 || len(allowed) > 0 {
+		return ErrSignupDomainNotAllowed
+	}
+	return nil
+}
+
+// NormalizeDomain lower-cases a domain for a rule, accepting "@example.com" and
+// "*.example.com" forms, and returns ErrInvalidDomain if it is not a valid DNS name
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "@")
+	domain = strings.TrimPrefix(domain, "*.")
+	domain = strings.TrimSuffix(domain, ".")
+
+	if domain == "" || len(domain) > maxDomainLength || !strings.Contains(domain, ".") {
+		return "", ErrInvalidDomain
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", ErrInvalidDomain
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return "", ErrInvalidDomain
+			}
+		}
+	}
+	return domain, nil
+}
+
+// matchesDomain reports whether domain or one of its parent domains is in rules
+func matchesDomain(domain string, rules []string) bool {
+	for _, rule := range rules {
+		if domain == rule || strings.HasSuffix(domain, "."+rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesDomainSet(domain string, set map[string]bool) bool {
+	for {
+		if set[domain] {
+			return true
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+func loadDomainList(list string) map[string]bool {
+	domains := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[strings.ToLower(line)] = true
+	}
+	return domains
+}
@@ -0,0 +1,105 @@
+package userevents
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/kafkametrics"
+	"github.com/yourusername/distributed-file-sharing/services/auth-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// publishTimeout bounds publishing one event, which never fails the request it is
+// published for
+const publishTimeout = 15 * time.Second
+
+// Publisher publishes user events to Kafka, keyed by user so that the events of a user
+// are consumed in order
+type Publisher struct {
+	writer    *kafka.Writer
+	stopStats context.CancelFunc
+}
+
+// NewPublisher creates a publisher of user events to brokers
+func NewPublisher(brokers []string) *Publisher {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        events.UserEventsTopic,
+		Balancer:     &kafka.Hash{},
+		MaxAttempts:  3,
+		BatchTimeout: 10 * time.Millisecond,
+		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  10 * time.Second,
+		RequiredAcks: kafka.RequireOne,
+	}
+
+	// Expose the writer's stats in the metrics until the publisher is closed
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	go kafkametrics.WatchWriter(statsCtx, "auth-service", writer)
+
+	return &Publisher{writer: writer, stopStats: stopStats}
+}
+
+// UserRegistered publishes that user's account was created
+func (p *Publisher) UserRegistered(user *models.User) {
+	p.publish(newEvent(events.TypeUserRegistered, user))
+}
+
+// EmailVerified publishes that user proved they own their email address
+func (p *Publisher) EmailVerified(user *models.User) {
+	event := newEvent(events.TypeUserEmailVerified, user)
+	event.EmailVerified = true
+	p.publish(event)
+}
+
+// publish publishes an event in the background. Failures are logged only: the account
+// change it reports has already been made.
+func (p *Publisher) publish(event *events.UserEvent) {
+	data, err := events.EncodeUser(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event of user %s: %v", event.Type, event.UserID, err)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+
+		err := p.writer.WriteMessages(ctx, kafka.Message{
+			Key:   []byte(event.UserID),
+			Value: data,
+			Headers: []kafka.Header{
+				{Key: "event_type", Value: []byte(event.Type)},
+			},
+		})
+		if err != nil {
+			log.Printf("Failed to publish %s event of user %s: %v", event.Type, event.UserID, err)
+		}
+	}()
+}
+
+// Close flushes the events being published and closes the connection to the brokers
+func (p *Publisher) Close() error {
+	p.stopStats()
+	if err := p.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close user events writer: %w", err)
+	}
+	return nil
+}
+
+func newEvent(eventType string, user *models.User) *events.UserEvent {
+	return &events.UserEvent{
+		SchemaVersion: events.UserSchemaVersion,
+		EventID:       primitive.NewObjectID().Hex(),
+		Type:          eventType,
+		UserID:        user.ID.Hex(),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Timestamp:     time.Now(),
+		TenantID:      user.TenantID,
+	}
+}
@@ -1,46 +1,127 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/config"
 	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/database"
 	grpcHandler "github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/grpc"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/invoice"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/kafka"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/migrations"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/notification"
 	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/payment"
 	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/rest"
 	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/service"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/users"
+	authv1 "github.com/yourusername/distributed-file-sharing-platform/services/billing-service/pkg/pb/auth/v1"
 	billingv1 "github.com/yourusername/distributed-file-sharing-platform/services/billing-service/pkg/pb/billing/v1"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/cli"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/faults"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/grpcmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/logging"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/migrate"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/secrets"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/serviceauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
 )
 
 func main() {
+	cli.Execute(cli.Service{
+		Name:    "billing-service",
+		Run:     run,
+		Workers: true,
+		HealthURL: func() string {
+			return "http://localhost:" + env.String("BILLING_SERVICE_PORT", "8084") + "/health"
+		},
+	})
+}
+
+// run runs the parts of the billing service the process was started for: the gRPC and
+// REST APIs, and the workers running dunning, trials, API billing and the usage consumer
+func run(process cli.Process) {
 	// Load configuration
+	if err := env.Load(); err != nil {
+		logrus.Fatalf("Failed to load environment file: %v", err)
+	}
+	secretsManager, err := secrets.Load(context.Background())
+	if err != nil {
+		logrus.Fatalf("Failed to load secrets: %v", err)
+	}
 	cfg := config.Load()
 
 	// Setup logger
-	log := logrus.New()
-	log.SetLevel(logrus.InfoLevel)
+	log := logging.New("billing-service", cfg.LogLevel)
+
+	// Inject faults for resilience testing when enabled
+	faultInjector := faults.FromEnv()
+	if faultInjector != nil {
+		log.Warnf("Fault injection enabled: %s", faultInjector)
+	}
 
-	// Connect to MongoDB
-	db, err := database.NewMongoDB(cfg.MongoURI, cfg.MongoDatabase)
+	// Connect to MongoDB, exposing the driver's connection pool in the metrics
+	db, err := database.NewMongoDB(cfg.MongoURI, cfg.MongoDatabase, faultInjector.MongoOptions(), poolmetrics.MongoOptions("billing-service"))
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
 	defer db.Close()
 
+	// Apply the pending MongoDB migrations, or manage them with the migrate subcommand
+	migrator := migrate.New(db.Database, "billing-service", migrations.All(), log)
+	if process.Migrating {
+		migrateCtx, migrateCancel := context.WithTimeout(context.Background(), migrate.DefaultTimeout)
+		defer migrateCancel()
+		if err := migrator.Command(migrateCtx, process.MigrateArgs, os.Stdout); err != nil {
+			log.Errorf("Migration failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if cfg.MigrateOnStartup {
+		migrateCtx, migrateCancel := context.WithTimeout(context.Background(), migrate.DefaultTimeout)
+		applied, err := migrator.Run(migrateCtx)
+		migrateCancel()
+		if err != nil {
+			log.Fatalf("Failed to apply MongoDB migrations: %v", err)
+		}
+		log.Infof("Applied %d MongoDB migrations", applied)
+	}
+
 	// Initialize repositories
 	planRepo := repository.NewPlanRepository(db.Database)
 	subscriptionRepo := repository.NewSubscriptionRepository(db.Database)
 	usageRepo := repository.NewUsageRepository(db.Database)
+	invoiceRepo := repository.NewInvoiceRepository(db.Database)
+	seatChangeRepo := repository.NewSeatChangeRepository(db.Database)
+	auditRepo := repository.NewAuditEventRepository(db.Database)
+	apiKeyRepo := repository.NewAPIKeyRepository(db.Database)
+	apiUsageRepo := repository.NewAPIUsageRepository(db.Database)
+	apiOverageRepo := repository.NewAPIOverageRepository(db.Database)
+
+	// Seed the default plans on first start
+	seedCtx, seedCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := planRepo.InitializeDefaultPlans(seedCtx); err != nil {
+		log.Warnf("Failed to initialize default plans: %v", err)
+	}
+	seedCancel()
 
 	// Initialize payment services
 	stripeService := payment.NewStripeService(
@@ -49,6 +130,7 @@ func main() {
 		"http://localhost:3000/billing/success", // TODO: Make configurable
 		"http://localhost:3000/billing/cancel",
 	)
+	stripeService.SetSecrets(secretsManager.Lookup("STRIPE_SECRET_KEY"), secretsManager.Lookup("STRIPE_WEBHOOK_SECRET"))
 
 	razorpayService := payment.NewRazorpayService(
 		cfg.RazorpayKeyID,
@@ -59,14 +141,111 @@ func main() {
 	// Initialize service layer
 	billingService := service.NewBillingService(planRepo, subscriptionRepo, usageRepo, stripeService, razorpayService)
 
+	// Record every billing-affecting action for dispute resolution and compliance
+	billingService.SetAuditLog(auditRepo)
+
+	// Issue invoices for payments and email them through the notification-service, with
+	// addresses from the auth-service. Prices include the tax of the customer's country.
+	taxPolicy := &service.TaxPolicy{
+		DefaultRate:   cfg.InvoiceTaxRate,
+		Rates:         cfg.TaxRates,
+		SellerCountry: cfg.TaxSellerCountry,
+	}
+	invoiceService := service.NewInvoiceService(invoiceRepo, planRepo, invoice.NewRenderer(cfg.InvoiceCompanyName), taxPolicy, cfg.FrontendURL+"/billing")
+	billingService.SetInvoiceService(invoiceService)
+
+	var authOpts, notificationOpts []grpc.DialOption
+	if cfg.ServiceAuthEnabled {
+		tokenSource, err := newServiceTokenSource(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize service token source: %v", err)
+		}
+		authOpts = append(authOpts, grpc.WithPerRPCCredentials(tokenSource.Credentials("auth-service")))
+		notificationOpts = append(notificationOpts, grpc.WithPerRPCCredentials(tokenSource.Credentials("notification-service")))
+	}
+	userClient, err := users.NewClient(cfg.AuthServiceGRPC, authOpts...)
+	if err != nil {
+		log.Fatalf("Failed to create user client: %v", err)
+	}
+	defer userClient.Close()
+	notificationClient, err := notification.NewClient(cfg.NotificationServiceGRPC, notificationOpts...)
+	if err != nil {
+		log.Fatalf("Failed to create notification client: %v", err)
+	}
+	defer notificationClient.Close()
+	invoiceService.SetMailer(userClient, notificationClient)
+
+	// Organizations in the auth-service buy team plans per seat
+	billingService.SetTeamBilling(seatChangeRepo, userClient)
+
+	// Billing administrators manage the plan catalog and refunds, and query the audit log
+	billingService.SetPlanAdmins(cfg.AdminEmails, userClient)
+
+	// Failed renewal payments get a grace period, in which they are retried and the user
+	// is reminded to pay, before the subscription is downgraded
+	billingService.SetDunning(dunningPolicy(cfg), cfg.FrontendURL+"/billing", userClient, notificationClient)
+
+	// Free trials are charged when they end, after reminding the user, or downgraded
+	// if that fails
+	billingService.SetTrials(time.Duration(cfg.TrialReminderDays)*24*time.Hour, cfg.FrontendURL+"/billing", userClient, notificationClient)
+
+	// Plans with API access meter the calls the api-gateway reports for each API key, and
+	// bill each month's calls over the included calls with the next payment
+	billingService.SetAPIAccess(apiKeyRepo, apiUsageRepo, apiOverageRepo)
+
+	// Background workers run until shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	if process.Worker {
+		go billingService.RunDunning(workerCtx)
+		go billingService.RunTrials(workerCtx)
+		go billingService.RunAPIBilling(workerCtx)
+
+		// Keep storage usage up to date from the file-service's upload and deletion events
+		usageConsumer := kafka.NewUsageConsumer(cfg.KafkaBrokers, cfg.KafkaGroupID, cfg.FileEventsTopic, billingService)
+		go func() {
+			if err := usageConsumer.Start(workerCtx); err != nil {
+				log.WithError(err).Error("Usage consumer stopped")
+			}
+		}()
+	}
+
+	// Alert users as their usage reaches their quota, and send them receipts and
+	// subscription status emails through the notification-service
+	eventProducer := kafka.NewProducer(cfg.KafkaBrokers, cfg.BillingEventsTopic)
+	defer eventProducer.Close()
+	eventProducer.SetFaults(faultInjector)
+	billingService.SetAlertPublisher(eventProducer)
+	billingService.SetEventPublisher(eventProducer)
+
 	// Initialize gRPC handler
 	grpcHandler := grpcHandler.NewBillingHandler(billingService)
 
 	// Start gRPC server
-	go startGRPCServer(cfg, grpcHandler, log)
+	if process.GRPC {
+		go startGRPCServer(cfg, grpcHandler, faultInjector, log)
+	}
 
-	// Start HTTP server
-	startHTTPServer(cfg, log)
+	// Initialize REST handlers
+	restHandlers := rest.NewRestHandlers(billingService, invoiceService, jwtauth.NewValidator(cfg.JWTSecret), log)
+	if cfg.AnalyticsAPIToken != "" {
+		restHandlers.SetAnalyticsToken(cfg.AnalyticsAPIToken)
+	} else {
+		log.Info("ANALYTICS_API_TOKEN is not set, the analytics API is disabled")
+	}
+
+	// Start HTTP server, or only serve the health probes and metrics
+	healthHandler := health.New("billing-service", "").AddCheck("mongodb", func(ctx context.Context) error {
+		return db.Client.Ping(ctx, nil)
+	}).AddOptionalCheck("kafka", health.TCP(cfg.KafkaBrokers...)).
+		AddOptionalCheck("auth-service", userClient.HealthCheck).
+		AddOptionalCheck("notification-service", notificationClient.HealthCheck)
+	if process.HTTP {
+		go startHTTPServer(cfg, restHandlers, healthHandler, faultInjector, log)
+	} else {
+		probeServer := cli.ProbeServer(cfg.Port, healthHandler, log)
+		defer probeServer.Close()
+	}
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
@@ -75,13 +254,57 @@ func main() {
 	log.Info("Shutting down servers...")
 }
 
-func startGRPCServer(cfg *config.Config, handler *grpcHandler.BillingHandler, log *logrus.Logger) {
+// dunningPolicy builds the handling of failed renewal payments from the configuration
+func dunningPolicy(cfg *config.Config) service.DunningPolicy {
+	policy := service.DunningPolicy{
+		GracePeriod: time.Duration(cfg.DunningGracePeriodDays) * 24 * time.Hour,
+	}
+	for _, days := range cfg.DunningRetryDays {
+		policy.RetrySchedule = append(policy.RetrySchedule, time.Duration(days)*24*time.Hour)
+	}
+	return policy
+}
+
+// newServiceTokenSource creates a token source that exchanges the service's client
+// credentials for service tokens via the auth-service
+func newServiceTokenSource(cfg *config.Config) (*serviceauth.TokenSource, error) {
+	conn, err := grpc.Dial(cfg.AuthServiceGRPC, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
+	}
+
+	client := authv1.NewAuthServiceClient(conn)
+	return serviceauth.NewTokenSource(func(ctx context.Context, audience string) (string, int64, error) {
+		resp, err := client.IssueServiceToken(ctx, &authv1.IssueServiceTokenRequest{
+			ClientId:     cfg.ServiceClientID,
+			ClientSecret: cfg.ServiceClientSecret,
+			Audience:     audience,
+		})
+		if err != nil {
+			return "", 0, err
+		}
+		return resp.AccessToken, resp.ExpiresIn, nil
+	}), nil
+}
+
+func startGRPCServer(cfg *config.Config, handler *grpcHandler.BillingHandler, faultInjector *faults.Injector, log *logrus.Logger) {
 	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
 	if err != nil {
 		log.Fatalf("Failed to listen on port %s: %v", cfg.GRPCPort, err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcOpts := grpcmw.Options{
+		Service:        cfg.ServiceName,
+		Logger:         log,
+		DefaultTimeout: cfg.GRPCDefaultTimeout,
+		Faults:         faultInjector,
+	}
+	if cfg.ServiceAuthEnabled {
+		grpcOpts.Auth = serviceauth.NewInterceptor(serviceauth.NewValidator(cfg.ServiceTokenSecret, cfg.ServiceName))
+		log.Info("Service-to-service authentication enabled")
+	}
+
+	grpcServer := grpc.NewServer(grpcmw.ServerOptions(grpcOpts)...)
 	billingv1.RegisterBillingServiceServer(grpcServer, handler)
 
 	log.Infof("gRPC server starting on port %s", cfg.GRPCPort)
@@ -90,163 +313,19 @@ func startGRPCServer(cfg *config.Config, handler *grpcHandler.BillingHandler, lo
 	}
 }
 
-func startHTTPServer(cfg *config.Config, log *logrus.Logger) {
+func startHTTPServer(cfg *config.Config, handlers *rest.RestHandlers, healthHandler *health.Handler, faultInjector *faults.Injector, log *logrus.Logger) {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
+	r.Use(ginmw.RequestID())
 
 	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"service":   "billing-service",
-			"status":    "healthy",
-			"timestamp": time.Now().Unix(),
-		})
-	})
-
-	// Basic API endpoints
-	api := r.Group("/api/v1/billing")
-	{
-		api.GET("/plans", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"plans": []gin.H{
-					{
-						"id":              "free",
-						"name":            "Free",
-						"quota_bytes":     5368709120, // 5GB
-						"price_per_month": 0,
-						"description":     "Free plan with basic features",
-						"features":        []string{"5GB Storage", "Basic Support"},
-						"is_popular":      false,
-						"created_at":      time.Now().Format(time.RFC3339),
-						"updated_at":      time.Now().Format(time.RFC3339),
-					},
-					{
-						"id":              "pro",
-						"name":            "Pro",
-						"quota_bytes":     107374182400, // 100GB
-						"price_per_month": 9.99,
-						"description":     "Pro plan with advanced features",
-						"features":        []string{"100GB Storage", "Priority Support", "Advanced Analytics"},
-						"is_popular":      true,
-						"created_at":      time.Now().Format(time.RFC3339),
-						"updated_at":      time.Now().Format(time.RFC3339),
-					},
-					{
-						"id":              "enterprise",
-						"name":            "Enterprise",
-						"quota_bytes":     1099511627776, // 1TB
-						"price_per_month": 29.99,
-						"description":     "Enterprise plan with all features",
-						"features":        []string{"1TB Storage", "24/7 Support", "Advanced Analytics", "API Access"},
-						"is_popular":      false,
-						"created_at":      time.Now().Format(time.RFC3339),
-						"updated_at":      time.Now().Format(time.RFC3339),
-					},
-				},
-			})
-		})
-
-		// Get user subscription
-		api.GET("/subscription", func(c *gin.Context) {
-			userID := c.Query("user_id")
-			if userID == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-				return
-			}
+	healthHandler.Register(r)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
-			// For now, return a mock subscription (Pro plan)
-			c.JSON(http.StatusOK, gin.H{
-				"subscription": gin.H{
-					"id":             "sub_123",
-					"user_id":        userID,
-					"plan_id":        "pro",
-					"status":         "active",
-					"payment_status": "paid",
-					"start_date":     time.Now().AddDate(0, -1, 0).Format(time.RFC3339),
-					"end_date":       time.Now().AddDate(0, 11, 0).Format(time.RFC3339),
-					"payment_method": "stripe",
-					"created_at":     time.Now().AddDate(0, -1, 0).Format(time.RFC3339),
-					"updated_at":     time.Now().Format(time.RFC3339),
-				},
-				"has_active_subscription": true,
-			})
-		})
-
-		// Get storage usage
-		api.GET("/usage", func(c *gin.Context) {
-			userID := c.Query("user_id")
-			if userID == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-				return
-			}
-
-			// Mock usage data - in real implementation, this would call the file service
-			c.JSON(http.StatusOK, gin.H{
-				"usage": gin.H{
-					"user_id":           userID,
-					"plan_name":         "Pro",
-					"quota_bytes":       107374182400, // 100GB
-					"used_bytes":        0,            // This should be calculated from actual files
-					"quota_gb":          100,
-					"used_gb":           0,
-					"percent_used":      0,
-					"upgrade_available": true,
-					"quota_exceeded":    false,
-				},
-			})
-		})
-
-		// Create subscription
-		api.POST("/subscribe", func(c *gin.Context) {
-			var req struct {
-				UserID        string `json:"user_id"`
-				PlanID        string `json:"plan_id"`
-				PaymentMethod string `json:"payment_method"`
-			}
-
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
-
-			// Mock subscription creation
-			c.JSON(http.StatusOK, gin.H{
-				"subscription": gin.H{
-					"id":             "sub_" + fmt.Sprintf("%d", time.Now().Unix()),
-					"user_id":        req.UserID,
-					"plan_id":        req.PlanID,
-					"status":         "pending",
-					"payment_status": "pending",
-					"start_date":     time.Now().Format(time.RFC3339),
-					"end_date":       time.Now().AddDate(1, 0, 0).Format(time.RFC3339),
-					"payment_method": req.PaymentMethod,
-					"created_at":     time.Now().Format(time.RFC3339),
-					"updated_at":     time.Now().Format(time.RFC3339),
-				},
-				"payment_url":   "https://checkout.stripe.com/pay/mock_session",
-				"client_secret": "pi_mock_client_secret",
-				"session_id":    "cs_mock_session_id",
-			})
-		})
-
-		// Cancel subscription
-		api.POST("/subscription/cancel", func(c *gin.Context) {
-			var req struct {
-				UserID         string `json:"user_id"`
-				SubscriptionID string `json:"subscription_id"`
-			}
-
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
-
-			c.JSON(http.StatusOK, gin.H{
-				"success": true,
-				"message": "Subscription cancelled successfully",
-			})
-		})
-	}
+	r.Use(faultInjector.Gin())
+	r.Use(tenant.Gin())
+	r.Use(ginmw.Deadline(nil))
+	handlers.SetupRoutes(r)
 
 	log.Infof("HTTP server starting on port %s", cfg.Port)
 	if err := r.Run(":" + cfg.Port); err != nil {
@@ -3,8 +3,11 @@ package config
 import (
 	"fmt"
 	"log"
-	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
 )
 
 type Config struct {
@@ -29,30 +32,113 @@ type Config struct {
 
 
 	// Service URLs
-	FileServiceGRPC string
+	FileServiceGRPC         string
+	AuthServiceGRPC         string
+	NotificationServiceGRPC string
+
+	// Kafka: storage usage is kept up to date from the file-service's file events, and
+	// quota alerts are published to the billing events topic
+	KafkaBrokers       []string
+	KafkaGroupID       string
+	FileEventsTopic    string
+	BillingEventsTopic string
+
+	// FrontendURL is the web app invoice emails link to
+	FrontendURL string
+
+	// Invoices
+	InvoiceCompanyName string
+	InvoiceTaxRate     float64 // percent of tax included in charged prices
+	// Tax: TaxRates are the rates, in percent, of countries and of regions such as
+	// "US-CA" that differ from InvoiceTaxRate. Business customers outside
+	// TaxSellerCountry are reverse charged.
+	TaxRates         map[string]float64
+	TaxSellerCountry string
+	taxRatesErr      error
+
+	// Dunning: a subscription whose renewal payment fails keeps its plan for the grace
+	// period, and the payment is retried the given numbers of days after it failed
+	DunningGracePeriodDays int
+	DunningRetryDays       []int
+
+	// TrialReminderDays is how many days before a free trial ends its user is reminded
+	// that it will be charged, 0 for no reminder
+	TrialReminderDays int
+
+	// AdminEmails lists the billing administrators, who manage the plan catalog and
+	// refunds and query the audit log, in lower case. Their accounts must have a
+	// verified email.
+	AdminEmails []string
+
+	// AnalyticsAPIToken bearers are served the revenue statistics of the admin analytics
+	AnalyticsAPIToken string
+
+	// Pending MongoDB migrations are applied on startup if MigrateOnStartup is set, and
+	// otherwise only by the migrate subcommand
+	MigrateOnStartup bool
 
 	// Environment
 	Environment string
 	LogLevel    string
+
+	// GRPCDefaultTimeout is the deadline given to gRPC calls that arrive without one
+	GRPCDefaultTimeout time.Duration
+
+	// Service-to-service authentication
+	ServiceAuthEnabled bool
+	ServiceName        string
+	ServiceTokenSecret string
+	// ServiceClientID and ServiceClientSecret are exchanged for service tokens to call
+	// other services with
+	ServiceClientID     string
+	ServiceClientSecret string
+
+	// JWTSecret validates the user access tokens issued by the auth-service
+	JWTSecret string
 }
 
 func Load() *Config {
 	cfg := &Config{
-		Port:                 getEnv("BILLING_SERVICE_PORT", "8084"),
-		GRPCPort:             getEnv("BILLING_GRPC_PORT", "50054"),
-		MongoURI:             getEnv("MONGO_URI", "mongodb://mongodb:27017"),
-		MongoDatabase:        getEnv("MONGO_DATABASE", "file_sharing"),
-		StripeSecretKey:      getEnv("STRIPE_SECRET_KEY", ""),
-		StripePublishableKey: getEnv("STRIPE_PUBLISHABLE_KEY", ""),
-		StripeWebhookSecret:  getEnv("STRIPE_WEBHOOK_SECRET", ""),
-		RazorpayKeyID:        getEnv("RAZORPAY_KEY_ID", ""),
-		RazorpayKeySecret:    getEnv("RAZORPAY_KEY_SECRET", ""),
-		RazorpayWebhookSecret: getEnv("RAZORPAY_WEBHOOK_SECRET", ""),
-		FileServiceGRPC:      getEnv("FILE_SERVICE_GRPC", "file-service:50052"),
-		Environment:          getEnv("ENVIRONMENT", "development"),
-		LogLevel:             getEnv("LOG_LEVEL", "info"),
+		Port:                 env.String("BILLING_SERVICE_PORT", "8084"),
+		GRPCPort:             env.String("BILLING_GRPC_PORT", "50054"),
+		MongoURI:             env.String("MONGO_URI", "mongodb://mongodb:27017"),
+		MongoDatabase:        env.String("MONGO_DATABASE", "file_sharing"),
+		StripeSecretKey:      env.String("STRIPE_SECRET_KEY", ""),
+		StripePublishableKey: env.String("STRIPE_PUBLISHABLE_KEY", ""),
+		StripeWebhookSecret:  env.String("STRIPE_WEBHOOK_SECRET", ""),
+		RazorpayKeyID:        env.String("RAZORPAY_KEY_ID", ""),
+		RazorpayKeySecret:    env.String("RAZORPAY_KEY_SECRET", ""),
+		RazorpayWebhookSecret: env.String("RAZORPAY_WEBHOOK_SECRET", ""),
+		FileServiceGRPC:      env.String("FILE_SERVICE_GRPC", "file-service:50052"),
+		AuthServiceGRPC:      env.String("AUTH_SERVICE_GRPC", "auth-service:50051"),
+		NotificationServiceGRPC: env.String("NOTIFICATION_SERVICE_GRPC", "notification-service:50054"),
+		KafkaBrokers:         strings.Split(env.String("KAFKA_BROKERS", "localhost:9092"), ","),
+		KafkaGroupID:         env.String("KAFKA_GROUP_ID", "billing-service"),
+		FileEventsTopic:      env.String("KAFKA_FILE_EVENTS_TOPIC", "file-events"),
+		BillingEventsTopic:   env.String("KAFKA_BILLING_EVENTS_TOPIC", "billing-events"),
+		FrontendURL:          strings.TrimRight(env.String("FRONTEND_URL", "http://localhost:3000"), "/"),
+		InvoiceCompanyName:   env.String("INVOICE_COMPANY_NAME", "File Sharing Platform"),
+		InvoiceTaxRate:       env.Float("INVOICE_TAX_RATE", 0),
+		TaxSellerCountry:     strings.ToUpper(env.String("TAX_SELLER_COUNTRY", "")),
+		DunningGracePeriodDays: env.Int("DUNNING_GRACE_PERIOD_DAYS", 7),
+		DunningRetryDays:     getEnvAsIntList("DUNNING_RETRY_DAYS", []int{1, 3, 5}),
+		TrialReminderDays:    env.Int("TRIAL_REMINDER_DAYS", 3),
+		AdminEmails:          parseList(env.String("ADMIN_EMAILS", "")),
+		AnalyticsAPIToken:    env.String("ANALYTICS_API_TOKEN", ""),
+		MigrateOnStartup:     env.Bool("MIGRATE_ON_STARTUP", true),
+		Environment:          env.String("ENVIRONMENT", "development"),
+		LogLevel:             env.String("LOG_LEVEL", "info"),
+		GRPCDefaultTimeout:   env.Duration("GRPC_DEFAULT_TIMEOUT", 60*time.Second),
+		ServiceAuthEnabled:   env.Bool("SERVICE_AUTH_ENABLED", false),
+		ServiceName:          env.String("SERVICE_NAME", "billing-service"),
+		ServiceTokenSecret:   env.String("SERVICE_TOKEN_SECRET", "your-service-token-secret-change-in-production"),
+		ServiceClientID:      env.String("SERVICE_CLIENT_ID", "billing-service"),
+		ServiceClientSecret:  env.String("SERVICE_CLIENT_SECRET", ""),
+		JWTSecret:            env.String("JWT_SECRET", "your-super-secret-key-change-in-production"),
 	}
 
+	cfg.TaxRates, cfg.taxRatesErr = parseRates(env.String("TAX_RATES", ""))
+
 	log.Println("Billing Service Configuration:")
 	log.Printf("  Port: %s", cfg.Port)
 	log.Printf("  gRPC Port: %s", cfg.GRPCPort)
@@ -60,37 +146,84 @@ func Load() *Config {
 	log.Printf("  MongoDB Database: %s", cfg.MongoDatabase)
 	log.Printf("  Environment: %s", cfg.Environment)
 	log.Printf("  Stripe Configured: %v", cfg.StripeSecretKey != "")
+	log.Printf("  Service Auth Enabled: %v", cfg.ServiceAuthEnabled)
 
 	return cfg
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// getEnvAsIntList parses a comma-separated list of integers, such as "1,3,5"
+func getEnvAsIntList(key string, defaultValue []int) []int {
+	valueStr := env.String(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	var values []int
+	for _, part := range strings.Split(valueStr, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return defaultValue
+		}
+		values = append(values, value)
 	}
-	return defaultValue
+	return values
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
+// parseList parses a comma-separated list into lower case entries, skipping empty ones
+func parseList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			entries = append(entries, entry)
+		}
 	}
-	return defaultValue
+	return entries
 }
 
-func getEnvAsBool(key string, defaultValue bool) bool {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.ParseBool(valueStr); err == nil {
-		return value
+// parseRates parses a comma-separated list of rates by upper case code, such as
+// "GB=20,US-CA=7.25"
+func parseRates(value string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		code, rate, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not of the form CODE=RATE", entry)
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("%q is not a valid rate", entry)
+		}
+		rates[strings.ToUpper(strings.TrimSpace(code))] = parsed
 	}
-	return defaultValue
+	return rates, nil
 }
 
 func (c *Config) Validate() error {
 	if c.MongoURI == "" {
 		return fmt.Errorf("MONGO_URI is required")
 	}
+	if c.InvoiceTaxRate < 0 {
+		return fmt.Errorf("INVOICE_TAX_RATE must not be negative")
+	}
+	if c.taxRatesErr != nil {
+		return fmt.Errorf("TAX_RATES is invalid: %w", c.taxRatesErr)
+	}
+	if c.TaxSellerCountry != "" && len(c.TaxSellerCountry) != 2 {
+		return fmt.Errorf("TAX_SELLER_COUNTRY must be a two-letter country code")
+	}
+	if c.DunningGracePeriodDays < 1 {
+		return fmt.Errorf("DUNNING_GRACE_PERIOD_DAYS must be at least 1")
+	}
+	for i, days := range c.DunningRetryDays {
+		if days < 1 || days >= c.DunningGracePeriodDays || (i > 0 && days <= c.DunningRetryDays[i-1]) {
+			return fmt.Errorf("DUNNING_RETRY_DAYS must be increasing days within the grace period")
+		}
+	}
+	if c.TrialReminderDays < 0 {
+		return fmt.Errorf("TRIAL_REMINDER_DAYS must not be negative")
+	}
 	if c.StripeSecretKey == "" && c.Environment == "production" {
 		return fmt.Errorf("STRIPE_SECRET_KEY is required in production")
 	}
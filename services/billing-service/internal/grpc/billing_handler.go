@@ -2,16 +2,23 @@ package grpc
 
 import (
 	"context"
+	"errors"
 
 	"github.com/sirupsen/logrus"
 	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/payment"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
 	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/service"
 	billingv1 "github.com/yourusername/distributed-file-sharing-platform/services/billing-service/pkg/pb/billing/v1"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// maxListSubscriberIDs bounds the page size of ListSubscriberIDs
+const maxListSubscriberIDs = 1000
+
 type BillingHandler struct {
 	billingv1.UnimplementedBillingServiceServer
 	service *service.BillingService
@@ -40,8 +47,14 @@ func (h *BillingHandler) ListPlans(ctx context.Context, req *billingv1.ListPlans
 		pbPlans = append(pbPlans, convertPlanToProto(plan))
 	}
 
+	currency := models.CurrencyForLocale(acceptLanguage(ctx))
+	if currency == "" {
+		currency = models.CurrencyUSD
+	}
+
 	return &billingv1.ListPlansResponse{
-		Plans: pbPlans,
+		Plans:    pbPlans,
+		Currency: currency,
 	}, nil
 }
 
@@ -52,7 +65,7 @@ func (h *BillingHandler) GetPlan(ctx context.Context, req *billingv1.GetPlanRequ
 	plan, err := h.service.GetPlan(ctx, req.PlanId)
 	if err != nil {
 		logrus.Errorf("Failed to get plan: %v", err)
-		return nil, status.Errorf(codes.Internal, "Failed to get plan")
+		return nil, statusFromError(err, "Failed to get plan")
 	}
 
 	return &billingv1.GetPlanResponse{
@@ -67,7 +80,7 @@ func (h *BillingHandler) GetUserSubscription(ctx context.Context, req *billingv1
 	subscription, plan, err := h.service.GetUserSubscription(ctx, req.UserId)
 	if err != nil {
 		logrus.Errorf("Failed to get user subscription: %v", err)
-		return nil, status.Errorf(codes.Internal, "Failed to get user subscription")
+		return nil, statusFromError(err, "Failed to get user subscription")
 	}
 
 	var pbSub *billingv1.Subscription
@@ -84,15 +97,24 @@ func (h *BillingHandler) GetUserSubscription(ctx context.Context, req *billingv1
 // CreateSubscription creates a new subscription
 func (h *BillingHandler) CreateSubscription(ctx context.Context, req *billingv1.CreateSubscriptionRequest) (*billingv1.CreateSubscriptionResponse, error) {
 	logrus.WithFields(logrus.Fields{
-		"user_id":        req.UserId,
-		"plan_id":        req.PlanId,
-		"payment_method": req.PaymentMethod,
+		"user_id":          req.UserId,
+		"plan_id":          req.PlanId,
+		"payment_method":   req.PaymentMethod,
+		"billing_interval": req.BillingInterval,
+		"currency":         req.Currency,
+		"org_id":           req.OrgId,
+		"seats":            req.Seats,
 	}).Info("CreateSubscription called")
 
-	subscription, paymentURL, sessionID, err := h.service.CreateSubscription(ctx, req.UserId, req.PlanId, req.PaymentMethod)
+	locale := req.Locale
+	if locale == "" {
+		locale = acceptLanguage(ctx)
+	}
+
+	subscription, checkout, err := h.service.CreateSubscription(ctx, req.UserId, req.PlanId, req.PaymentMethod, req.BillingInterval, req.Currency, locale, req.OrgId, int(req.Seats), convertBillingDetailsFromProto(req.BillingDetails))
 	if err != nil {
 		logrus.Errorf("Failed to create subscription: %v", err)
-		return nil, status.Errorf(codes.Internal, "Failed to create subscription: %v", err)
+		return nil, statusFromError(err, "Failed to create subscription")
 	}
 
 	// We need the plan to convert subscription to proto, but CreateSubscription returns the subscription object which has PlanID.
@@ -107,10 +129,11 @@ func (h *BillingHandler) CreateSubscription(ctx context.Context, req *billingv1.
 	}
 
 	return &billingv1.CreateSubscriptionResponse{
-		Subscription: convertSubscriptionToProto(subscription, plan),
-		PaymentUrl:   paymentURL,
-		SessionId:    sessionID,
-		ClientSecret: "", // Add if needed
+		Subscription:     convertSubscriptionToProto(subscription, plan),
+		PaymentUrl:       checkout.PaymentURL,
+		SessionId:        checkout.SessionID,
+		ClientSecret:     "", // Add if needed
+		RazorpayCheckout: convertRazorpayCheckoutToProto(checkout.Razorpay),
 	}, nil
 }
 
@@ -124,10 +147,7 @@ func (h *BillingHandler) CancelSubscription(ctx context.Context, req *billingv1.
 	err := h.service.CancelSubscription(ctx, req.UserId, req.SubscriptionId)
 	if err != nil {
 		logrus.Errorf("Failed to cancel subscription: %v", err)
-		return &billingv1.CancelSubscriptionResponse{
-			Success: false,
-			Message: err.Error(),
-		}, nil
+		return nil, statusFromError(err, "Failed to cancel subscription")
 	}
 
 	return &billingv1.CancelSubscriptionResponse{
@@ -136,6 +156,72 @@ func (h *BillingHandler) CancelSubscription(ctx context.Context, req *billingv1.
 	}, nil
 }
 
+// GetTeamSubscription returns an organization's team subscription
+func (h *BillingHandler) GetTeamSubscription(ctx context.Context, req *billingv1.GetTeamSubscriptionRequest) (*billingv1.GetTeamSubscriptionResponse, error) {
+	logrus.WithFields(logrus.Fields{
+		"user_id": req.UserId,
+		"org_id":  req.OrgId,
+	}).Info("GetTeamSubscription called")
+
+	team, err := h.service.GetTeamSubscription(ctx, req.UserId, req.OrgId)
+	if err != nil {
+		logrus.Errorf("Failed to get team subscription: %v", err)
+		return nil, statusFromError(err, "Failed to get team subscription")
+	}
+
+	return &billingv1.GetTeamSubscriptionResponse{
+		Subscription: convertSubscriptionToProto(team.Subscription, team.Plan),
+		Members:      int32(team.Members),
+		QuotaBytes:   team.QuotaBytes,
+		UsedBytes:    team.UsedBytes,
+		SeatCredit:   team.Subscription.SeatCredit,
+	}, nil
+}
+
+// QuoteSeats prices a change of seats
+func (h *BillingHandler) QuoteSeats(ctx context.Context, req *billingv1.QuoteSeatsRequest) (*billingv1.QuoteSeatsResponse, error) {
+	quote, err := h.service.QuoteSeats(ctx, req.UserId, req.OrgId, int(req.Seats))
+	if err != nil {
+		logrus.Errorf("Failed to quote seats: %v", err)
+		return nil, statusFromError(err, "Failed to quote seats")
+	}
+
+	return &billingv1.QuoteSeatsResponse{
+		Quote: convertSeatQuoteToProto(quote),
+	}, nil
+}
+
+// UpdateSeats changes the seats of a team subscription
+func (h *BillingHandler) UpdateSeats(ctx context.Context, req *billingv1.UpdateSeatsRequest) (*billingv1.UpdateSeatsResponse, error) {
+	logrus.WithFields(logrus.Fields{
+		"user_id": req.UserId,
+		"org_id":  req.OrgId,
+		"seats":   req.Seats,
+	}).Info("UpdateSeats called")
+
+	result, err := h.service.UpdateSeats(ctx, req.UserId, req.OrgId, int(req.Seats))
+	if err != nil {
+		logrus.Errorf("Failed to update seats: %v", err)
+		return nil, statusFromError(err, "Failed to update seats")
+	}
+
+	plan, err := h.service.GetPlan(ctx, result.Subscription.PlanID.Hex())
+	if err != nil {
+		logrus.Errorf("Failed to get plan of team subscription: %v", err)
+	}
+
+	resp := &billingv1.UpdateSeatsResponse{
+		Subscription: convertSubscriptionToProto(result.Subscription, plan),
+		Quote:        convertSeatQuoteToProto(result.Quote),
+	}
+	if result.Checkout != nil {
+		resp.PaymentUrl = result.Checkout.PaymentURL
+		resp.SessionId = result.Checkout.SessionID
+		resp.RazorpayCheckout = convertRazorpayCheckoutToProto(result.Checkout.Razorpay)
+	}
+	return resp, nil
+}
+
 // GetUsage returns usage stats
 func (h *BillingHandler) GetUsage(ctx context.Context, req *billingv1.GetUsageRequest) (*billingv1.GetUsageResponse, error) {
 	logrus.WithField("user_id", req.UserId).Info("GetUsage called")
@@ -143,7 +229,7 @@ func (h *BillingHandler) GetUsage(ctx context.Context, req *billingv1.GetUsageRe
 	usage, err := h.service.GetUsage(ctx, req.UserId)
 	if err != nil {
 		logrus.Errorf("Failed to get usage: %v", err)
-		return nil, status.Errorf(codes.Internal, "Failed to get usage")
+		return nil, statusFromError(err, "Failed to get usage")
 	}
 
 	return &billingv1.GetUsageResponse{
@@ -157,6 +243,11 @@ func (h *BillingHandler) GetUsage(ctx context.Context, req *billingv1.GetUsageRe
 			PercentUsed:      usage.PercentUsed,
 			UpgradeAvailable: usage.UpgradeAvailable,
 			QuotaExceeded:    usage.QuotaExceeded,
+			OrgId:            usage.OrgID,
+			Seats:            int32(usage.Seats),
+			Currency:         usage.Currency,
+			PlanPrice:        usage.PlanPrice,
+			BillingInterval:  string(usage.BillingInterval),
 		},
 	}, nil
 }
@@ -194,6 +285,53 @@ func (h *BillingHandler) UpdateUsage(ctx context.Context, req *billingv1.UpdateU
 	}, nil
 }
 
+// ListSubscriberIDs pages through the users subscribed to a plan
+func (h *BillingHandler) ListSubscriberIDs(ctx context.Context, req *billingv1.ListSubscriberIDsRequest) (*billingv1.ListSubscriberIDsResponse, error) {
+	if req.PlanId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "plan_id is required")
+	}
+
+	limit := int64(req.Limit)
+	if limit <= 0 || limit > maxListSubscriberIDs {
+		limit = maxListSubscriberIDs
+	}
+
+	userIDs, err := h.service.ListSubscriberIDs(ctx, req.PlanId, req.AfterUserId, limit)
+	if err != nil {
+		logrus.Errorf("Failed to list subscribers: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to list subscribers")
+	}
+
+	return &billingv1.ListSubscriberIDsResponse{UserIds: userIDs}, nil
+}
+
+// AuthenticateAPIKey returns the key ID, user and tenant of an API key presented to the
+// gateway
+func (h *BillingHandler) AuthenticateAPIKey(ctx context.Context, req *billingv1.AuthenticateAPIKeyRequest) (*billingv1.AuthenticateAPIKeyResponse, error) {
+	if req.ApiKey == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "api_key is required")
+	}
+
+	key, err := h.service.AuthenticateAPIKey(ctx, req.ApiKey)
+	if err != nil {
+		return nil, statusFromError(err, "Failed to authenticate API key")
+	}
+
+	return &billingv1.AuthenticateAPIKeyResponse{
+		KeyId:           key.ID.Hex(),
+		UserId:          key.UserID.Hex(),
+		RateLimit:       key.RateLimit,
+		MonthlyTransfer: key.MonthlyTransfer,
+		TenantId:        key.TenantID,
+	}, nil
+}
+
+// RecordAPIUsage records the API calls the gateway counted for each key
+func (h *BillingHandler) RecordAPIUsage(ctx context.Context, req *billingv1.RecordAPIUsageRequest) (*billingv1.RecordAPIUsageResponse, error) {
+	failed := h.service.RecordAPIUsage(ctx, req.Calls)
+	return &billingv1.RecordAPIUsageResponse{FailedKeyIds: failed}, nil
+}
+
 // HandlePaymentWebhook handles payment webhooks
 func (h *BillingHandler) HandlePaymentWebhook(ctx context.Context, req *billingv1.PaymentWebhookRequest) (*billingv1.PaymentWebhookResponse, error) {
 	logrus.WithFields(logrus.Fields{
@@ -201,7 +339,7 @@ func (h *BillingHandler) HandlePaymentWebhook(ctx context.Context, req *billingv
 		"event_type": req.EventType,
 	}).Info("HandlePaymentWebhook called")
 
-	err := h.service.HandlePaymentWebhook(ctx, req.Provider, req.EventType, req.SessionId, req.TransactionId, req.RawPayload)
+	err := h.service.HandlePaymentWebhook(ctx, req.Provider, req.RawPayload, req.Signature)
 	if err != nil {
 		logrus.Errorf("Failed to handle webhook: %v", err)
 		return &billingv1.PaymentWebhookResponse{
@@ -218,33 +356,163 @@ func (h *BillingHandler) HandlePaymentWebhook(ctx context.Context, req *billingv
 
 // Helper functions
 
+// statusFromError returns the gRPC status matching a billing service error, so the
+// gateway responds with the matching HTTP status
+func statusFromError(err error, message string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidUserID),
+		errors.Is(err, service.ErrInvalidPlanID),
+		errors.Is(err, service.ErrInvalidSubscriptionID),
+		errors.Is(err, service.ErrUnsupportedPaymentMethod),
+		errors.Is(err, service.ErrInvalidBillingInterval),
+		errors.Is(err, service.ErrInvalidOrganizationID),
+		errors.Is(err, service.ErrNotTeamPlan),
+		errors.Is(err, service.ErrInvalidSeatCount),
+		errors.Is(err, service.ErrUnsupportedCurrency),
+		errors.Is(err, service.ErrInvalidBillingDetails):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrPlanArchived):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, repository.ErrPlanNotFound):
+		return status.Error(codes.NotFound, "Plan not found")
+	case errors.Is(err, repository.ErrSubscriptionNotFound):
+		return status.Error(codes.NotFound, "Subscription not found")
+	case errors.Is(err, service.ErrOrganizationNotFound):
+		return status.Error(codes.NotFound, "Organization not found")
+	case errors.Is(err, service.ErrNotOrganizationAdmin),
+		errors.Is(err, service.ErrAPIAccessNotIncluded):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrInvalidAPIKey):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrSeatsInUse):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrSeatCreditChanged):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, service.ErrActiveSubscription):
+		return status.Error(codes.AlreadyExists, "User already has an active subscription")
+	default:
+		return status.Error(codes.Internal, message)
+	}
+}
+
+// acceptLanguage returns the Accept-Language header of a request forwarded by the
+// gRPC-Gateway, which prefixes forwarded HTTP headers
+func acceptLanguage(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get("grpcgateway-accept-language"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func convertRazorpayCheckoutToProto(checkout *payment.RazorpayCheckout) *billingv1.RazorpayCheckout {
+	if checkout == nil {
+		return nil
+	}
+	return &billingv1.RazorpayCheckout{
+		KeyId:       checkout.KeyID,
+		OrderId:     checkout.OrderID,
+		Amount:      checkout.Amount,
+		Currency:    checkout.Currency,
+		Name:        checkout.Name,
+		Description: checkout.Description,
+	}
+}
+
+func convertSeatQuoteToProto(quote *service.SeatQuote) *billingv1.SeatQuote {
+	return &billingv1.SeatQuote{
+		CurrentSeats:  int32(quote.CurrentSeats),
+		Seats:         int32(quote.Seats),
+		Prorated:      quote.Prorated,
+		CreditApplied: quote.CreditApplied,
+		AmountDue:     quote.AmountDue,
+		CreditEarned:  quote.CreditEarned,
+		PeriodEnd:     timestamppb.New(quote.PeriodEnd),
+		Currency:      quote.Currency,
+	}
+}
+
 func convertPlanToProto(plan models.Plan) *billingv1.Plan {
 	return &billingv1.Plan{
-		Id:            plan.ID.Hex(),
-		Name:          plan.Name,
-		QuotaBytes:    plan.QuotaBytes,
-		PricePerMonth: plan.PricePerMonth,
-		Description:   plan.Description,
-		Features:      plan.Features,
-		IsPopular:     plan.IsPopular,
-		CreatedAt:     timestamppb.New(plan.CreatedAt),
-		UpdatedAt:     timestamppb.New(plan.UpdatedAt),
+		Id:                   plan.ID.Hex(),
+		Name:                 plan.Name,
+		QuotaBytes:           plan.QuotaBytes,
+		PricePerMonth:        plan.PricePerMonth,
+		Description:          plan.Description,
+		Features:             plan.Features,
+		IsPopular:            plan.IsPopular,
+		CreatedAt:            timestamppb.New(plan.CreatedAt),
+		UpdatedAt:            timestamppb.New(plan.UpdatedAt),
+		PricePerYear:         plan.Price(models.BillingIntervalYear),
+		YearlyPricePerMonth:  plan.YearlyPricePerMonth(),
+		YearlySavingPerMonth: plan.YearlySavingPerMonth(),
+		YearlySavingPercent:  plan.YearlySavingPercent(),
+		PerSeat:              plan.PerSeat,
+		TrialDays:            int32(plan.TrialDays),
+		Prices:               convertPricesToProto(&plan),
+		ApiCallsIncluded:     plan.APICallsIncluded,
+		ApiOveragePer_1000:   plan.APIOveragePer1000,
+	}
+}
+
+// convertPricesToProto returns a plan's prices in each currency it's priced in
+func convertPricesToProto(plan *models.Plan) map[string]*billingv1.PricePoint {
+	prices := make(map[string]*billingv1.PricePoint)
+	for _, currency := range plan.Currencies() {
+		perMonth, _ := plan.PriceIn(currency, models.BillingIntervalMonth)
+		perYear, _ := plan.PriceIn(currency, models.BillingIntervalYear)
+		overage, _ := plan.APIOveragePriceIn(currency)
+		prices[currency] = &billingv1.PricePoint{PricePerMonth: perMonth, PricePerYear: perYear, ApiOveragePer_1000: overage}
 	}
+	return prices
 }
 
 func convertSubscriptionToProto(sub *models.Subscription, plan *models.Plan) *billingv1.Subscription {
 	pbSub := &billingv1.Subscription{
-		Id:            sub.ID.Hex(),
-		UserId:        sub.UserID.Hex(),
-		PlanId:        sub.PlanID.Hex(),
-		Status:        convertSubscriptionStatus(sub.Status),
-		PaymentStatus: convertPaymentStatus(sub.PaymentStatus),
-		StartDate:     timestamppb.New(sub.StartDate),
-		EndDate:       timestamppb.New(sub.EndDate),
-		TransactionId: sub.TransactionID,
-		PaymentMethod: sub.PaymentMethod,
-		CreatedAt:     timestamppb.New(sub.CreatedAt),
-		UpdatedAt:     timestamppb.New(sub.UpdatedAt),
+		Id:              sub.ID.Hex(),
+		UserId:          sub.UserID.Hex(),
+		PlanId:          sub.PlanID.Hex(),
+		Status:          convertSubscriptionStatus(sub.Status),
+		PaymentStatus:   convertPaymentStatus(sub.PaymentStatus),
+		StartDate:       timestamppb.New(sub.StartDate),
+		EndDate:         timestamppb.New(sub.EndDate),
+		TransactionId:   sub.TransactionID,
+		PaymentMethod:   sub.PaymentMethod,
+		CreatedAt:       timestamppb.New(sub.CreatedAt),
+		UpdatedAt:       timestamppb.New(sub.UpdatedAt),
+		BillingInterval: string(sub.Interval()),
+		Seats:           int32(sub.Seats),
+		Currency:        sub.BillingCurrency(),
+	}
+	if sub.IsTeam() {
+		pbSub.OrgId = sub.OrgID.Hex()
+	}
+	if renewsAt, ok := sub.RenewsAt(); ok {
+		pbSub.RenewsAt = timestamppb.New(renewsAt)
+	}
+	if sub.IsTrialing() {
+		pbSub.TrialEnd = timestamppb.New(sub.TrialEnd)
+	}
+	if sub.Dunning != nil {
+		pbSub.Dunning = &billingv1.Dunning{
+			FailedAt:       timestamppb.New(sub.Dunning.FailedAt),
+			GracePeriodEnd: timestamppb.New(sub.Dunning.GracePeriodEnd),
+			Retries:        int32(sub.Dunning.Retries),
+			NextRetryAt:    timestamppb.New(sub.Dunning.NextRetryAt),
+			PaymentUrl:     sub.Dunning.PaymentURL,
+		}
+	}
+
+	if sub.Billing != nil {
+		pbSub.BillingDetails = &billingv1.BillingDetails{
+			Country:      sub.Billing.Country,
+			Region:       sub.Billing.Region,
+			TaxId:        sub.Billing.TaxID,
+			BusinessName: sub.Billing.BusinessName,
+		}
 	}
 
 	if plan != nil {
@@ -254,6 +522,20 @@ func convertSubscriptionToProto(sub *models.Subscription, plan *models.Plan) *bi
 	return pbSub
 }
 
+// convertBillingDetailsFromProto converts billing details given at checkout, which are
+// nil if none were given
+func convertBillingDetailsFromProto(details *billingv1.BillingDetails) *models.BillingDetails {
+	if details == nil {
+		return nil
+	}
+	return &models.BillingDetails{
+		Country:      details.Country,
+		Region:       details.Region,
+		TaxID:        details.TaxId,
+		BusinessName: details.BusinessName,
+	}
+}
+
 func convertSubscriptionStatus(status models.SubscriptionStatus) billingv1.SubscriptionStatus {
 	switch status {
 	case models.SubscriptionStatusActive:
@@ -264,6 +546,8 @@ func convertSubscriptionStatus(status models.SubscriptionStatus) billingv1.Subsc
 		return billingv1.SubscriptionStatus_SUBSCRIPTION_STATUS_CANCELLED
 	case models.SubscriptionStatusPending:
 		return billingv1.SubscriptionStatus_SUBSCRIPTION_STATUS_PENDING
+	case models.SubscriptionStatusTrialing:
+		return billingv1.SubscriptionStatus_SUBSCRIPTION_STATUS_TRIALING
 	default:
 		return billingv1.SubscriptionStatus_SUBSCRIPTION_STATUS_UNSPECIFIED
 	}
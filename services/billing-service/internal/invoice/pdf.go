@@ -0,0 +1,244 @@
+// Package invoice renders invoices as PDF documents.
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+)
+
+// Page geometry, in points, of an A4 page
+const (
+	pageWidth   = 595
+	pageHeight  = 842
+	marginLeft  = 50
+	marginRight = pageWidth - 50
+)
+
+// courierAdvance is the width of a Courier glyph per point of font size, used to right
+// align amounts without font metrics
+const courierAdvance = 0.6
+
+// Renderer renders invoices issued by a company
+type Renderer struct {
+	companyName string
+}
+
+// NewRenderer creates a renderer for invoices issued by companyName
+func NewRenderer(companyName string) *Renderer {
+	return &Renderer{companyName: companyName}
+}
+
+// Render renders an invoice as a single page PDF
+func (r *Renderer) Render(inv *models.Invoice) []byte {
+	var page content
+
+	page.text("F2", 22, marginLeft, 780, "INVOICE")
+	page.text("F2", 12, marginLeft, 752, r.companyName)
+
+	y := 780.0
+	for _, line := range [][2]string{
+		{"Invoice number", inv.Number},
+		{"Issued", inv.IssuedAt.Format("January 2, 2006")},
+		{"Status", strings.ToUpper(string(inv.Status))},
+	} {
+		page.text("F1", 10, 340, y, line[0])
+		page.text("F2", 10, 430, y, line[1])
+		y -= 16
+	}
+
+	y = 690
+	page.text("F2", 10, marginLeft, y, "Billing period")
+	page.text("F1", 10, 150, y, fmt.Sprintf("%s - %s", inv.PeriodStart.Format("Jan 2, 2006"), inv.PeriodEnd.Format("Jan 2, 2006")))
+	y -= 16
+	page.text("F2", 10, marginLeft, y, "Payment")
+	page.text("F1", 10, 150, y, paymentDescription(inv))
+	if billTo := billToLines(inv.BillTo); len(billTo) > 0 {
+		y -= 16
+		page.text("F2", 10, marginLeft, y, "Bill to")
+		for _, line := range billTo {
+			page.text("F1", 10, 150, y, line)
+			y -= 14
+		}
+		y += 14
+	}
+
+	// Line items
+	y -= 40
+	page.text("F2", 10, marginLeft, y, "Description")
+	page.text("F2", 10, 330, y, "Qty")
+	page.rightText("F2", 10, 450, y, "Unit price")
+	page.rightText("F2", 10, marginRight, y, "Amount")
+	y -= 8
+	page.line(marginLeft, y, marginRight, y)
+	y -= 16
+	for _, item := range inv.LineItems {
+		page.text("F1", 10, marginLeft, y, item.Description)
+		page.text("F1", 10, 330, y, fmt.Sprintf("%d", item.Quantity))
+		page.rightAmount(450, y, FormatAmount(item.UnitAmount, inv.Currency))
+		page.rightAmount(marginRight, y, FormatAmount(item.Amount, inv.Currency))
+		y -= 18
+	}
+	page.line(marginLeft, y+6, marginRight, y+6)
+
+	// Totals
+	y -= 14
+	totals := [][2]string{{"Subtotal", FormatAmount(inv.Subtotal, inv.Currency)}}
+	switch {
+	case inv.ReverseCharge:
+		totals = append(totals, [2]string{fmt.Sprintf("%s (reverse charge)", models.TaxName(inv.BillTo.Country)), FormatAmount(0, inv.Currency)})
+	case len(inv.TaxLines) > 0:
+		for _, line := range inv.TaxLines {
+			totals = append(totals, [2]string{fmt.Sprintf("%s (%g%%)", line.Name, line.Rate), FormatAmount(line.Amount, inv.Currency)})
+		}
+	case inv.TaxRate > 0:
+		// Invoices issued before tax lines have a single tax
+		totals = append(totals, [2]string{fmt.Sprintf("Tax (%g%%)", inv.TaxRate), FormatAmount(inv.Tax, inv.Currency)})
+	}
+	for _, total := range totals {
+		page.text("F1", 10, 330, y, total[0])
+		page.rightAmount(marginRight, y, total[1])
+		y -= 16
+	}
+	page.text("F2", 12, 330, y-4, "Total")
+	page.rightText("F2", 12, marginRight, y-4, FormatAmount(inv.Total, inv.Currency))
+	if inv.AmountRefunded > 0 {
+		y -= 22
+		page.text("F1", 10, 330, y, "Refunded")
+		page.rightAmount(marginRight, y, "-"+FormatAmount(inv.AmountRefunded, inv.Currency))
+	}
+
+	if inv.ReverseCharge {
+		page.text("F1", 9, marginLeft, 76, fmt.Sprintf("Reverse charge: the customer is liable to account for %s on this supply.", models.TaxName(inv.BillTo.Country)))
+	}
+	page.text("F1", 9, marginLeft, 60, fmt.Sprintf("Thank you for your business. Questions about this invoice? Quote %s.", inv.Number))
+
+	return document(page.String())
+}
+
+// billToLines describes the customer an invoice is billed to, if they gave billing
+// details
+func billToLines(details *models.BillingDetails) []string {
+	if details == nil {
+		return nil
+	}
+
+	var lines []string
+	if details.BusinessName != "" {
+		lines = append(lines, details.BusinessName)
+	}
+	location := details.Country
+	if details.Region != "" {
+		location = details.Region + ", " + details.Country
+	}
+	lines = append(lines, location)
+	if details.TaxID != "" {
+		lines = append(lines, fmt.Sprintf("%s ID %s", models.TaxName(details.Country), details.TaxID))
+	}
+	return lines
+}
+
+// paymentDescription describes how an invoice was paid
+func paymentDescription(inv *models.Invoice) string {
+	method := inv.PaymentMethod
+	switch method {
+	case "stripe":
+		method = "Card (Stripe)"
+	case "razorpay":
+		method = "Razorpay"
+	}
+	if inv.TransactionID == "" {
+		return method
+	}
+	return fmt.Sprintf("%s, transaction %s", method, inv.TransactionID)
+}
+
+// FormatAmount formats an amount in the smallest unit of currency, such as cents, in the
+// currency's major unit. The currency is shown by its code, since the PDF fonts lack
+// symbols like the rupee's.
+func FormatAmount(amount int64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%s %s", sign, strings.ToUpper(currency), models.FormatDecimal(amount, currency))
+}
+
+// content builds a PDF page content stream
+type content struct {
+	bytes.Buffer
+}
+
+func (c *content) text(font string, size, x, y float64, s string) {
+	fmt.Fprintf(c, "BT /%s %g Tf %g %g Td (%s) Tj ET\n", font, size, x, y, escape(s))
+}
+
+// rightText draws text ending at x. Widths are estimated from the average Helvetica
+// glyph, which is close enough for short labels.
+func (c *content) rightText(font string, size, x, y float64, s string) {
+	c.text(font, size, x-float64(len(s))*size*0.55, y, s)
+}
+
+// rightAmount draws an amount in Courier ending exactly at x
+func (c *content) rightAmount(x, y float64, s string) {
+	const size = 10
+	c.text("F3", size, x-float64(len(s))*size*courierAdvance, y, s)
+}
+
+func (c *content) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(c, "0.5 w %g %g m %g %g l S\n", x1, y1, x2, y2)
+}
+
+// escape escapes a string for a PDF literal string. The standard fonts only cover
+// Latin-1, so other characters are replaced.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0xff:
+			b.WriteByte('?')
+		case r > 0x7e:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// document wraps a page content stream in a PDF file using the standard Helvetica and
+// Courier fonts, which PDF readers provide without embedding
+func document(stream string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 4 0 R /F2 5 0 R /F3 6 0 R >> >> /Contents 7 0 R >>", pageWidth, pageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(stream), stream),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes()
+}
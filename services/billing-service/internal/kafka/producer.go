@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/service"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/faults"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/kafkametrics"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// billingEvent is an event for the notification-service, in the shape of the file
+// events it consumes. FileSize carries the storage used, which the quota templates show.
+type billingEvent struct {
+	EventID   string            `json:"event_id"`
+	Type      string            `json:"type"`
+	UserID    string            `json:"user_id"`
+	FileSize  int64             `json:"file_size"`
+	Success   bool              `json:"success"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// Producer publishes billing events, such as quota alerts and payment receipts, to the
+// billing events topic
+type Producer struct {
+	writer    *kafka.Writer
+	faults    *faults.Injector
+	stopStats context.CancelFunc
+}
+
+// NewProducer creates a producer of the billing events topic, whose writer's stats are
+// exposed in the metrics until it is closed
+func NewProducer(brokers []string, topic string) *Producer {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		MaxAttempts:  3,
+		BatchTimeout: 10 * time.Millisecond,
+		WriteTimeout: 10 * time.Second,
+		RequiredAcks: kafka.RequireOne,
+	}
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	go kafkametrics.WatchWriter(statsCtx, "billing-service", writer)
+
+	return &Producer{
+		writer:    writer,
+		stopStats: stopStats,
+	}
+}
+
+// SetFaults enables failing publishes at the injected Kafka drop rate
+func (p *Producer) SetFaults(injector *faults.Injector) {
+	p.faults = injector
+}
+
+// PublishQuotaAlert publishes a quota alert, keyed by user so that a user's alerts are
+// delivered in order
+func (p *Producer) PublishQuotaAlert(ctx context.Context, alert service.QuotaAlert) error {
+	var percentUsed int64
+	if alert.QuotaBytes > 0 {
+		percentUsed = alert.UsedBytes * 100 / alert.QuotaBytes
+	}
+
+	event := billingEvent{
+		EventID:  primitive.NewObjectID().Hex(),
+		Type:     alert.Level.EventType(),
+		UserID:   alert.UserID,
+		FileSize: alert.UsedBytes,
+		Success:  true,
+		Metadata: map[string]string{
+			"used_bytes":   strconv.FormatInt(alert.UsedBytes, 10),
+			"quota_bytes":  strconv.FormatInt(alert.QuotaBytes, 10),
+			"percent_used": strconv.FormatInt(percentUsed, 10),
+			"plan_name":    alert.PlanName,
+		},
+		Timestamp: time.Now().UTC(),
+	}
+	if alert.OrgID != "" {
+		event.Metadata["org_id"] = alert.OrgID
+	}
+
+	if err := p.publish(ctx, event); err != nil {
+		return fmt.Errorf("failed to publish quota alert: %w", err)
+	}
+	return nil
+}
+
+// PublishBillingEvent publishes a payment, renewal or cancellation event, keyed by user
+// like quota alerts. Failed payments are published as unsuccessful events.
+func (p *Producer) PublishBillingEvent(ctx context.Context, billing service.BillingEvent) error {
+	event := billingEvent{
+		EventID:   billing.ID,
+		Type:      string(billing.Type),
+		UserID:    billing.UserID,
+		Success:   billing.Type != service.BillingEventPaymentFailed,
+		Metadata:  billing.Metadata,
+		Timestamp: time.Now().UTC(),
+	}
+	if event.EventID == "" {
+		event.EventID = primitive.NewObjectID().Hex()
+	}
+
+	if err := p.publish(ctx, event); err != nil {
+		return fmt.Errorf("failed to publish billing event: %w", err)
+	}
+	return nil
+}
+
+// publish writes an event to the topic, keyed by its user
+func (p *Producer) publish(ctx context.Context, event billingEvent) error {
+	if err := p.faults.DropPublish(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.UserID),
+		Value: value,
+	})
+}
+
+// Close flushes pending events and closes the producer
+func (p *Producer) Close() error {
+	p.stopStats()
+	return p.writer.Close()
+}
@@ -0,0 +1,213 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/service"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/kafkametrics"
+)
+
+const (
+	// minRetryBackoff and maxRetryBackoff bound the wait before retrying an event that
+	// failed to apply
+	minRetryBackoff = time.Second
+	maxRetryBackoff = time.Minute
+)
+
+// UsageRecorder applies file events to storage usage
+type UsageRecorder interface {
+	ApplyFileEvent(ctx context.Context, eventID, userID string, bytesDelta int64) error
+}
+
+// UsageConsumer keeps storage usage up to date from the file-service's file events
+type UsageConsumer struct {
+	reader *kafka.Reader
+	// replayReader consumes the file events replayed to the consumer group
+	replayReader *kafka.Reader
+	usage        UsageRecorder
+}
+
+// NewUsageConsumer creates a consumer of the file events topic, and of the file events
+// replayed to the consumer group. A new consumer group starts from the oldest retained
+// event, since usage is only ever computed from events.
+func NewUsageConsumer(brokers []string, groupID, topic string, usage UsageRecorder) *UsageConsumer {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		GroupID:     groupID,
+		Topic:       topic,
+		MinBytes:    1,
+		MaxBytes:    10e6, // 10MB
+		StartOffset: kafka.FirstOffset,
+	})
+	replayReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:               brokers,
+		GroupID:               events.ReplayTopic(groupID),
+		Topic:                 events.ReplayTopic(groupID),
+		MinBytes:              1,
+		MaxBytes:              10e6, // 10MB
+		StartOffset:           kafka.FirstOffset,
+		WatchPartitionChanges: true,
+	})
+
+	return &UsageConsumer{
+		reader:       reader,
+		replayReader: replayReader,
+		usage:        usage,
+	}
+}
+
+// Start consumes file events until ctx is done. An event's offset is only committed
+// once it is applied, so events published while the billing-service is down, or can't
+// reach its database, are applied when it recovers.
+func (c *UsageConsumer) Start(ctx context.Context) error {
+	logrus.Info("Starting usage consumer...")
+
+	replayDone := make(chan struct{})
+	go func() {
+		defer close(replayDone)
+		c.consume(ctx, c.replayReader)
+	}()
+	c.consume(ctx, c.reader)
+	<-replayDone
+
+	logrus.Info("Stopping usage consumer...")
+	return nil
+}
+
+// consume applies the file events of a reader until ctx is done, and closes it. The
+// reader's stats are exposed in the metrics meanwhile.
+func (c *UsageConsumer) consume(ctx context.Context, reader *kafka.Reader) {
+	defer reader.Close()
+	go kafkametrics.WatchReader(ctx, "billing-service", reader)
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.WithError(err).Error("Failed to fetch file event")
+			continue
+		}
+
+		if !c.apply(ctx, msg) {
+			return
+		}
+
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			// The event is redelivered after a restart, and skipped as a duplicate
+			logrus.WithError(err).Warn("Failed to commit file event")
+		}
+	}
+}
+
+// apply applies a file event to usage, retrying until it is applied. It returns false
+// if ctx is done first. Messages that don't change usage are skipped.
+func (c *UsageConsumer) apply(ctx context.Context, msg kafka.Message) bool {
+	msg, replayID := replayedMessage(msg)
+	event, ok := c.decode(ctx, msg)
+	if !ok {
+		return ctx.Err() == nil
+	}
+
+	var bytesDelta int64
+	switch event.Type {
+	case events.TypeFileUploaded:
+		bytesDelta = event.FileSize
+	case events.TypeFileDeleted:
+		bytesDelta = -event.FileSize
+	}
+	// Downloads, versions and failed operations don't change usage, and deletions
+	// published before they carried the file size can't be applied
+	if !event.Success || bytesDelta == 0 {
+		return true
+	}
+
+	// Events published without an ID are identified by their position
+	eventID := event.EventID
+	if eventID == "" {
+		eventID = fmt.Sprintf("%s:%d:%d", msg.Topic, msg.Partition, msg.Offset)
+	}
+	// Replayed events are applied again, once per replay
+	if replayID != "" {
+		eventID = events.ReplayEventID(replayID, eventID)
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"event_id": eventID,
+		"file_id":  event.FileID,
+		"user_id":  event.OwnerID,
+	})
+
+	backoff := minRetryBackoff
+	for {
+		err := c.usage.ApplyFileEvent(ctx, eventID, event.OwnerID, bytesDelta)
+		if err == nil {
+			return true
+		}
+		if errors.Is(err, service.ErrInvalidUserID) {
+			logger.WithError(err).Warn("Skipping file event of an invalid user")
+			return true
+		}
+
+		logger.WithError(err).WithField("retry_in", backoff).Error("Failed to apply file event to usage")
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// decode decodes a file event. Invalid events are skipped, and it reports false for
+// them. An event written with a newer schema than this service reads can't be skipped
+// without losing the usage it records, so consuming waits on it until ctx is done and
+// the billing-service is upgraded.
+func (c *UsageConsumer) decode(ctx context.Context, msg kafka.Message) (*events.FileEvent, bool) {
+	event, err := events.Decode(msg.Value)
+	if err == nil {
+		return event, true
+	}
+
+	logger := logrus.WithError(err).WithField("offset", msg.Offset)
+	if !errors.Is(err, events.ErrUnsupportedVersion) {
+		logger.Warn("Skipping invalid file event")
+		return nil, false
+	}
+
+	logger.Error("File event was written with a newer schema, waiting for the billing-service to be upgraded")
+	<-ctx.Done()
+	return nil, false
+}
+
+// replayedMessage returns a message of the replay topic as it was first published, and
+// the ID of the replay that published it. Other messages are returned unchanged, with no
+// replay ID.
+func replayedMessage(msg kafka.Message) (kafka.Message, string) {
+	var replayID string
+	for _, header := range msg.Headers {
+		switch header.Key {
+		case events.ReplayIDHeader:
+			replayID = string(header.Value)
+		case events.ReplayTopicHeader:
+			msg.Topic = string(header.Value)
+		case events.ReplayPartitionHeader:
+			if partition, err := strconv.Atoi(string(header.Value)); err == nil {
+				msg.Partition = partition
+			}
+		case events.ReplayOffsetHeader:
+			if offset, err := strconv.ParseInt(string(header.Value), 10, 64); err == nil {
+				msg.Offset = offset
+			}
+		}
+	}
+	return msg, replayID
+}
@@ -0,0 +1,98 @@
+// Package migrations lists the billing-service's MongoDB migrations, which it applies on
+// startup and with its migrate subcommand. New migrations are appended with the next
+// version; applied ones are never changed.
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All returns the billing-service's migrations
+func All() []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version:     1,
+			Description: "Create plan, subscription, usage, invoice, audit and API key indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				if err := createCoreIndexes(ctx, db); err != nil {
+					return err
+				}
+				repos := []struct {
+					name   string
+					create func(ctx context.Context) error
+				}{
+					{"subscription", repository.NewSubscriptionRepository(db).EnsureIndexes},
+					{"invoice", repository.NewInvoiceRepository(db).EnsureIndexes},
+					{"usage", repository.NewUsageRepository(db).EnsureIndexes},
+					{"audit log", repository.NewAuditEventRepository(db).EnsureIndexes},
+					{"API key", repository.NewAPIKeyRepository(db).EnsureIndexes},
+					{"API usage", repository.NewAPIUsageRepository(db).EnsureIndexes},
+					{"API overage", repository.NewAPIOverageRepository(db).EnsureIndexes},
+				}
+				for _, repo := range repos {
+					if err := repo.create(ctx); err != nil {
+						return fmt.Errorf("failed to create %s indexes: %w", repo.name, err)
+					}
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// createCoreIndexes creates the plan, subscription and usage indexes the service created
+// when it connected to MongoDB before it had migrations
+func createCoreIndexes(ctx context.Context, db *mongo.Database) error {
+	// Plans collection indexes
+	plansCollection := db.Collection("plans")
+	_, err := plansCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create plans indexes: %w", err)
+	}
+
+	// Subscriptions collection indexes
+	subscriptionsCollection := db.Collection("subscriptions")
+	_, err = subscriptionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "sessionId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "transactionId", Value: 1}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create subscriptions indexes: %w", err)
+	}
+
+	// Usage collection indexes
+	usageCollection := db.Collection("usage")
+	_, err = usageCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create usage indexes: %w", err)
+	}
+
+	return nil
+}
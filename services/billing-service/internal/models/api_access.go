@@ -0,0 +1,125 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APICallBlock is the number of API calls overage is priced and billed in. Overage is
+// rounded up to whole blocks.
+const APICallBlock = 1000
+
+// APIKey lets a user's programs call the API as the user. Only a hash of the key is
+// stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"userId" json:"userId"`
+	// TenantID is the tenant of the key's owner, which requests made with the key are
+	// served for. Empty for the default tenant.
+	TenantID string `bson:"tenantId,omitempty" json:"-"`
+	Name     string `bson:"name" json:"name"`
+	// Prefix is the start of the key, which identifies it in listings
+	Prefix     string     `bson:"prefix" json:"prefix"`
+	KeyHash    string     `bson:"keyHash" json:"-"`
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+	LastUsedAt *time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	// RateLimit is the requests per minute the API gateway lets through with the key, and
+	// MonthlyTransfer the bytes it may transfer in a calendar month before the gateway
+	// suspends it until the next one. Zero leaves the gateway's limits, which also cap
+	// them.
+	RateLimit       int64 `bson:"rateLimit,omitempty" json:"rateLimit,omitempty"`
+	MonthlyTransfer int64 `bson:"monthlyTransfer,omitempty" json:"monthlyTransfer,omitempty"`
+}
+
+// IsRevoked reports whether the key can no longer be used
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// APIUsage counts the API calls made with a key in a calendar month, as reported by the
+// API gateway
+type APIUsage struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"userId" json:"userId"`
+	KeyID  primitive.ObjectID `bson:"keyId" json:"keyId"`
+	// Month is the start of the month in UTC
+	Month time.Time `bson:"month" json:"month"`
+	Calls int64     `bson:"calls" json:"calls"`
+	// PlanID is the plan of the user when the calls were last counted, whose included
+	// calls and overage price the month is billed by
+	PlanID    primitive.ObjectID `bson:"planId" json:"planId"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// APIOverageStatus represents the status of an API overage
+type APIOverageStatus string
+
+const (
+	APIOverageStatusPending  APIOverageStatus = "pending"
+	APIOverageStatusInvoiced APIOverageStatus = "invoiced"
+)
+
+// APIOverage is a user's API calls over their plan's included calls in a month, which
+// are billed with their next payment. A pending overage is attached to the subscription
+// whose payment will include it, at Amount in the smallest unit of Currency.
+type APIOverage struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID        primitive.ObjectID `bson:"userId" json:"userId"`
+	PlanID        primitive.ObjectID `bson:"planId" json:"planId"`
+	Month         time.Time          `bson:"month" json:"month"`
+	Calls         int64              `bson:"calls" json:"calls"`
+	IncludedCalls int64              `bson:"includedCalls" json:"includedCalls"`
+	Status        APIOverageStatus   `bson:"status" json:"status"`
+
+	SubscriptionID primitive.ObjectID `bson:"subscriptionId,omitempty" json:"subscriptionId,omitempty"`
+	Amount         int64              `bson:"amount,omitempty" json:"amount,omitempty"`
+	Currency       string             `bson:"currency,omitempty" json:"currency,omitempty"`
+	// ProviderItemID is the Stripe invoice item that adds the overage to the next invoice
+	// of a recurring subscription
+	ProviderItemID string             `bson:"providerItemId,omitempty" json:"providerItemId,omitempty"`
+	InvoiceID      primitive.ObjectID `bson:"invoiceId,omitempty" json:"invoiceId,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// OverageCalls returns the number of calls over the included calls
+func (o *APIOverage) OverageCalls() int64 {
+	return o.Calls - o.IncludedCalls
+}
+
+// Blocks returns the number of blocks of APICallBlock calls the overage is billed for
+func (o *APIOverage) Blocks() int64 {
+	return APIOverageBlocks(o.OverageCalls())
+}
+
+// Description describes the overage on invoices
+func (o *APIOverage) Description() string {
+	return fmt.Sprintf("API calls over the %s included in %s (%s calls, per %s)",
+		FormatCount(o.IncludedCalls), o.Month.Format("January 2006"), FormatCount(o.OverageCalls()), FormatCount(APICallBlock))
+}
+
+// APIOverageBlocks returns the number of blocks of APICallBlock calls that overageCalls
+// calls are billed for
+func APIOverageBlocks(overageCalls int64) int64 {
+	if overageCalls <= 0 {
+		return 0
+	}
+	return (overageCalls + APICallBlock - 1) / APICallBlock
+}
+
+// APIUsageMonth returns the start of the calendar month, in UTC, that API calls made at t
+// are counted in
+func APIUsageMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// FormatCount formats a non-negative count with thousands separators, such as "100,000"
+func FormatCount(n int64) string {
+	return strings.TrimSuffix(FormatDecimal(n*100, CurrencyUSD), ".00")
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEventType is the kind of billing-affecting action an audit event records
+type AuditEventType string
+
+const (
+	AuditEventSubscriptionCreated   AuditEventType = "subscription.created"
+	AuditEventSubscriptionCancelled AuditEventType = "subscription.cancelled"
+	AuditEventSeatsChanged          AuditEventType = "seats.changed"
+	AuditEventWebhookReceived       AuditEventType = "webhook.received"
+	AuditEventUsageAdjusted         AuditEventType = "usage.adjusted"
+	AuditEventInvoiceRefunded       AuditEventType = "invoice.refunded"
+	AuditEventPlanCreated           AuditEventType = "plan.created"
+	AuditEventPlanUpdated           AuditEventType = "plan.updated"
+	AuditEventPlanArchived          AuditEventType = "plan.archived"
+	AuditEventPlanUnarchived        AuditEventType = "plan.unarchived"
+	AuditEventPlansReordered        AuditEventType = "plans.reordered"
+)
+
+// AuditEventTypes lists every audit event type
+var AuditEventTypes = []AuditEventType{
+	AuditEventSubscriptionCreated,
+	AuditEventSubscriptionCancelled,
+	AuditEventSeatsChanged,
+	AuditEventWebhookReceived,
+	AuditEventUsageAdjusted,
+	AuditEventInvoiceRefunded,
+	AuditEventPlanCreated,
+	AuditEventPlanUpdated,
+	AuditEventPlanArchived,
+	AuditEventPlanUnarchived,
+	AuditEventPlansReordered,
+}
+
+// AuditSource is who an audited action came from
+type AuditSource string
+
+const (
+	AuditSourceUser     AuditSource = "user"
+	AuditSourceAdmin    AuditSource = "admin"
+	AuditSourceStripe   AuditSource = "stripe"
+	AuditSourceRazorpay AuditSource = "razorpay"
+	// AuditSourceService is another service of the platform, such as the file-service
+	// reporting storage usage
+	AuditSourceService AuditSource = "service"
+)
+
+// AuditEvent is an entry of the billing audit log, which records every action that
+// affects what users are billed or may use. Events are never changed once recorded.
+type AuditEvent struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type   AuditEventType     `bson:"type" json:"type"`
+	Source AuditSource        `bson:"source" json:"source"`
+	// ActorID is the user or admin who acted, unset for payment providers and services
+	ActorID primitive.ObjectID `bson:"actorId,omitempty" json:"actorId,omitempty"`
+
+	// The billing the action affected, as far as it is known
+	UserID         primitive.ObjectID `bson:"userId,omitempty" json:"userId,omitempty"`
+	OrgID          primitive.ObjectID `bson:"orgId,omitempty" json:"orgId,omitempty"`
+	SubscriptionID primitive.ObjectID `bson:"subscriptionId,omitempty" json:"subscriptionId,omitempty"`
+	InvoiceID      primitive.ObjectID `bson:"invoiceId,omitempty" json:"invoiceId,omitempty"`
+	PlanID         primitive.ObjectID `bson:"planId,omitempty" json:"planId,omitempty"`
+
+	Details   map[string]string `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time         `bson:"createdAt" json:"createdAt"`
+}
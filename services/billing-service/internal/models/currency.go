@@ -0,0 +1,128 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Currencies plans can be priced and charged in, as lower case ISO 4217 codes. All of
+// them have two decimal places, so amounts in their smallest unit are hundredths.
+const (
+	CurrencyUSD = "usd"
+	CurrencyEUR = "eur"
+	CurrencyGBP = "gbp"
+	CurrencyINR = "inr"
+)
+
+// currencySymbols are the symbols amounts of each supported currency are shown with
+var currencySymbols = map[string]string{
+	CurrencyUSD: "$",
+	CurrencyEUR: "€",
+	CurrencyGBP: "£",
+	CurrencyINR: "₹",
+}
+
+// regionCurrencies maps the regions of locales to the currency their users pay in
+var regionCurrencies = map[string]string{
+	"US": CurrencyUSD,
+	"GB": CurrencyGBP,
+	"IN": CurrencyINR,
+	"AT": CurrencyEUR, "BE": CurrencyEUR, "CY": CurrencyEUR, "DE": CurrencyEUR,
+	"EE": CurrencyEUR, "ES": CurrencyEUR, "FI": CurrencyEUR, "FR": CurrencyEUR,
+	"GR": CurrencyEUR, "HR": CurrencyEUR, "IE": CurrencyEUR, "IT": CurrencyEUR,
+	"LT": CurrencyEUR, "LU": CurrencyEUR, "LV": CurrencyEUR, "MT": CurrencyEUR,
+	"NL": CurrencyEUR, "PT": CurrencyEUR, "SI": CurrencyEUR, "SK": CurrencyEUR,
+}
+
+// languageCurrencies maps the languages of locales without a region to a currency, for
+// languages mostly spoken where that currency is used
+var languageCurrencies = map[string]string{
+	"de": CurrencyEUR,
+	"fr": CurrencyEUR,
+	"it": CurrencyEUR,
+	"nl": CurrencyEUR,
+	"fi": CurrencyEUR,
+	"el": CurrencyEUR,
+	"hi": CurrencyINR,
+}
+
+// NormalizeCurrency returns a currency code in the lower case plans are priced with
+func NormalizeCurrency(currency string) string {
+	return strings.ToLower(strings.TrimSpace(currency))
+}
+
+// IsSupportedCurrency reports whether plans can be priced in a currency
+func IsSupportedCurrency(currency string) bool {
+	_, ok := currencySymbols[currency]
+	return ok
+}
+
+// CurrencyForLocale returns the currency of a locale, such as "en-IN", or of the first
+// locale of an Accept-Language header. It returns "" for locales without a supported
+// currency.
+func CurrencyForLocale(locale string) string {
+	tag, _, _ := strings.Cut(locale, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+
+	parts := strings.Split(tag, "-")
+	// The region is the last two-letter subtag, after the language and any script
+	for i := len(parts) - 1; i > 0; i-- {
+		if len(parts[i]) == 2 {
+			if currency, ok := regionCurrencies[strings.ToUpper(parts[i])]; ok {
+				return currency
+			}
+			return ""
+		}
+	}
+	return languageCurrencies[strings.ToLower(parts[0])]
+}
+
+// MinorUnits converts a price to the smallest unit of its currency
+func MinorUnits(price float64) int64 {
+	return int64(math.Round(price * 100))
+}
+
+// FormatMoney formats an amount in the smallest unit of a currency for people, such as
+// "$1,234.50" or "₹1,23,450.00". Unsupported currencies are shown by their code.
+func FormatMoney(amount int64, currency string) string {
+	currency = NormalizeCurrency(currency)
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = strings.ToUpper(currency) + " "
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return sign + symbol + FormatDecimal(amount, currency)
+}
+
+// FormatDecimal formats a non-negative amount in the smallest unit of a currency as a
+// decimal with the digit grouping of the currency's users, such as "1,234.50", or
+// "1,23,450.00" for rupees
+func FormatDecimal(amount int64, currency string) string {
+	units := fmt.Sprintf("%d", amount/100)
+
+	// The last three digits form a group, and the rest groups of three, or of two for
+	// the Indian numbering system
+	groupSize := 3
+	if NormalizeCurrency(currency) == CurrencyINR {
+		groupSize = 2
+	}
+	if len(units) > 3 {
+		head, tail := units[:len(units)-3], units[len(units)-3:]
+		var groups []string
+		for len(head) > groupSize {
+			groups = append([]string{head[len(head)-groupSize:]}, groups...)
+			head = head[:len(head)-groupSize]
+		}
+		groups = append([]string{head}, groups...)
+		units = strings.Join(append(groups, tail), ",")
+	}
+
+	return fmt.Sprintf("%s.%02d", units, amount%100)
+}
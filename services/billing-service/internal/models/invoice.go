@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InvoiceStatus represents the status of an invoice
+type InvoiceStatus string
+
+const (
+	InvoiceStatusPaid              InvoiceStatus = "paid"
+	InvoiceStatusPartiallyRefunded InvoiceStatus = "partially_refunded"
+	InvoiceStatusRefunded          InvoiceStatus = "refunded"
+)
+
+// InvoiceLineItem is a charge on an invoice. Amounts are in the smallest unit of the
+// invoice currency.
+type InvoiceLineItem struct {
+	Description string `bson:"description" json:"description"`
+	Quantity    int64  `bson:"quantity" json:"quantity"`
+	UnitAmount  int64  `bson:"unitAmount" json:"unitAmount"`
+	Amount      int64  `bson:"amount" json:"amount"`
+}
+
+// Invoice records a successful charge for a subscription. Amounts are in the smallest
+// unit of Currency, as charged by the payment provider.
+type Invoice struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Number         string             `bson:"number" json:"number"`
+	UserID         primitive.ObjectID `bson:"userId" json:"userId"`
+	SubscriptionID primitive.ObjectID `bson:"subscriptionId" json:"subscriptionId"`
+	PlanID         primitive.ObjectID `bson:"planId" json:"planId"`
+	PlanName       string             `bson:"planName" json:"planName"`
+	Status         InvoiceStatus      `bson:"status" json:"status"`
+	PaymentMethod  string             `bson:"paymentMethod" json:"paymentMethod"`
+	TransactionID  string             `bson:"transactionId" json:"transactionId"`
+	Currency       string             `bson:"currency" json:"currency"`
+	LineItems      []InvoiceLineItem  `bson:"lineItems" json:"lineItems"`
+	Subtotal       int64              `bson:"subtotal" json:"subtotal"`
+	TaxRate        float64            `bson:"taxRate" json:"taxRate"` // percent, included in Total
+	Tax            int64              `bson:"tax" json:"tax"`         // the sum of TaxLines
+	Total          int64              `bson:"total" json:"total"`
+	PeriodStart    time.Time          `bson:"periodStart" json:"periodStart"`
+	PeriodEnd      time.Time          `bson:"periodEnd" json:"periodEnd"`
+	IssuedAt       time.Time          `bson:"issuedAt" json:"issuedAt"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+
+	// TaxLines itemize Tax. ReverseCharge invoices of business customers abroad charge
+	// no tax, which the customer accounts for instead.
+	TaxLines      []InvoiceTaxLine `bson:"taxLines,omitempty" json:"taxLines,omitempty"`
+	ReverseCharge bool             `bson:"reverseCharge,omitempty" json:"reverseCharge,omitempty"`
+	// BillTo are the customer's billing details at the time of the charge, if given
+	BillTo *BillingDetails `bson:"billTo,omitempty" json:"billTo,omitempty"`
+
+	// Refunds of the payment, oldest first, which add up to AmountRefunded
+	Refunds        []InvoiceRefund `bson:"refunds,omitempty" json:"refunds,omitempty"`
+	AmountRefunded int64           `bson:"amountRefunded,omitempty" json:"amountRefunded,omitempty"`
+}
+
+// InvoiceTaxLine is a tax included in an invoice's total, such as "VAT" at 20 percent
+type InvoiceTaxLine struct {
+	Name   string  `bson:"name" json:"name"`
+	Rate   float64 `bson:"rate" json:"rate"` // percent
+	Amount int64   `bson:"amount" json:"amount"`
+}
+
+// InvoiceRefund is a refund of part or all of an invoiced payment, made by a billing
+// administrator. ID is the payment provider's refund ID.
+type InvoiceRefund struct {
+	ID        string             `bson:"id" json:"id"`
+	Amount    int64              `bson:"amount" json:"amount"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	AdminID   primitive.ObjectID `bson:"adminId" json:"adminId"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// RefundableAmount returns the part of the invoiced payment that hasn't been refunded
+func (i *Invoice) RefundableAmount() int64 {
+	return i.Total - i.AmountRefunded
+}
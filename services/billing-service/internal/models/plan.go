@@ -1,6 +1,8 @@
 package models
 
 import (
+	"math"
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,11 +14,40 @@ type Plan struct {
 	Name          string             `bson:"name" json:"name"`
 	QuotaBytes    int64              `bson:"quotaBytes" json:"quotaBytes"`
 	PricePerMonth float64            `bson:"pricePerMonth" json:"pricePerMonth"`
+	PricePerYear  float64            `bson:"pricePerYear" json:"pricePerYear"`
 	Description   string             `bson:"description" json:"description"`
 	Features      []string           `bson:"features" json:"features"`
 	IsPopular     bool               `bson:"isPopular" json:"isPopular"`
 	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt     time.Time          `bson:"updatedAt" json:"updatedAt"`
+
+	// PerSeat plans are bought by organizations for a number of seats. Their prices and
+	// quota are per seat, and members share the quota of all seats.
+	PerSeat bool `bson:"perSeat,omitempty" json:"perSeat,omitempty"`
+
+	// SortOrder is the position of the plan in the plan catalog
+	SortOrder int `bson:"sortOrder" json:"sortOrder"`
+	// Archived plans are no longer offered, but existing subscriptions keep them
+	Archived bool `bson:"archived" json:"archived"`
+	// TrialDays is the length of the free trial of new subscribers, 0 for none
+	TrialDays int `bson:"trialDays,omitempty" json:"trialDays,omitempty"`
+	// Prices are the plan's price points in currencies other than USD, keyed by currency
+	// code. PricePerMonth and PricePerYear are its USD prices.
+	Prices map[string]PricePoint `bson:"prices,omitempty" json:"prices,omitempty"`
+	// APICallsIncluded is the number of API calls a month subscribers can make with API
+	// keys, 0 for plans without API access. Calls over it cost APIOveragePer1000 in USD,
+	// or the overage price of the currency's price point, per APICallBlock calls.
+	APICallsIncluded  int64   `bson:"apiCallsIncluded,omitempty" json:"apiCallsIncluded,omitempty"`
+	APIOveragePer1000 float64 `bson:"apiOveragePer1000,omitempty" json:"apiOveragePer1000,omitempty"`
+}
+
+// PricePoint is the price of a plan in a currency. A PerYear of 0 bills twelve monthly
+// prices a year.
+type PricePoint struct {
+	PerMonth float64 `bson:"perMonth" json:"perMonth"`
+	PerYear  float64 `bson:"perYear,omitempty" json:"perYear,omitempty"`
+	// APIOveragePer1000 is the price of API calls over the included calls
+	APIOveragePer1000 float64 `bson:"apiOveragePer1000,omitempty" json:"apiOveragePer1000,omitempty"`
 }
 
 // PlanName constants
@@ -24,16 +55,19 @@ const (
 	PlanFree       = "Free"
 	PlanPro        = "Pro"
 	PlanEnterprise = "Enterprise"
+	PlanTeam       = "Team"
 )
 
-// Quota constants (in bytes)
+// Quota constants (in bytes). The Team quota is per seat.
 const (
 	QuotaFree       = 5 * 1024 * 1024 * 1024        // 5 GB
 	QuotaPro        = 100 * 1024 * 1024 * 1024      // 100 GB
 	QuotaEnterprise = 1024 * 1024 * 1024 * 1024     // 1 TB
+	QuotaTeam       = 200 * 1024 * 1024 * 1024      // 200 GB
 )
 
-// GetDefaultPlans returns the default subscription plans
+// GetDefaultPlans returns the plans the plan catalog is seeded with. Admins manage the
+// catalog after that.
 func GetDefaultPlans() []Plan {
 	now := time.Now()
 	return []Plan{
@@ -42,6 +76,7 @@ func GetDefaultPlans() []Plan {
 			Name:          PlanFree,
 			QuotaBytes:    QuotaFree,
 			PricePerMonth: 0,
+			PricePerYear:  0,
 			Description:   "Perfect for personal use",
 			Features: []string{
 				"5 GB storage",
@@ -49,6 +84,7 @@ func GetDefaultPlans() []Plan {
 				"Email support",
 			},
 			IsPopular: false,
+			SortOrder: 0,
 			CreatedAt: now,
 			UpdatedAt: now,
 		},
@@ -57,7 +93,13 @@ func GetDefaultPlans() []Plan {
 			Name:          PlanPro,
 			QuotaBytes:    QuotaPro,
 			PricePerMonth: 10.00,
-			Description:   "Great for professionals",
+			PricePerYear:  100.00, // 2 months free
+			Prices: map[string]PricePoint{
+				CurrencyEUR: {PerMonth: 9.00, PerYear: 90.00},
+				CurrencyGBP: {PerMonth: 8.00, PerYear: 80.00},
+				CurrencyINR: {PerMonth: 799.00, PerYear: 7990.00},
+			},
+			Description: "Great for professionals",
 			Features: []string{
 				"100 GB storage",
 				"Advanced file sharing",
@@ -66,6 +108,7 @@ func GetDefaultPlans() []Plan {
 				"Advanced security",
 			},
 			IsPopular: true,
+			SortOrder: 1,
 			CreatedAt: now,
 			UpdatedAt: now,
 		},
@@ -74,7 +117,15 @@ func GetDefaultPlans() []Plan {
 			Name:          PlanEnterprise,
 			QuotaBytes:    QuotaEnterprise,
 			PricePerMonth: 49.00,
-			Description:   "Best for teams and businesses",
+			PricePerYear:  490.00, // 2 months free
+			Prices: map[string]PricePoint{
+				CurrencyEUR: {PerMonth: 45.00, PerYear: 450.00, APIOveragePer1000: 0.45},
+				CurrencyGBP: {PerMonth: 39.00, PerYear: 390.00, APIOveragePer1000: 0.40},
+				CurrencyINR: {PerMonth: 3999.00, PerYear: 39990.00, APIOveragePer1000: 40.00},
+			},
+			APICallsIncluded:  100000,
+			APIOveragePer1000: 0.50,
+			Description:       "Best for teams and businesses",
 			Features: []string{
 				"1 TB storage",
 				"Unlimited file sharing",
@@ -82,9 +133,34 @@ func GetDefaultPlans() []Plan {
 				"Advanced analytics",
 				"Team collaboration",
 				"Custom branding",
-				"API access",
+				"API access with 100,000 calls a month",
 			},
 			IsPopular: false,
+			SortOrder: 2,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		{
+			ID:            primitive.NewObjectID(),
+			Name:          PlanTeam,
+			QuotaBytes:    QuotaTeam,
+			PricePerMonth: 8.00,
+			PricePerYear:  80.00, // 2 months free
+			Prices: map[string]PricePoint{
+				CurrencyEUR: {PerMonth: 7.50, PerYear: 75.00},
+				CurrencyGBP: {PerMonth: 6.50, PerYear: 65.00},
+				CurrencyINR: {PerMonth: 649.00, PerYear: 6490.00},
+			},
+			Description: "Shared storage for your organization, priced per seat",
+			Features: []string{
+				"200 GB storage per seat, shared by the team",
+				"Add or remove seats anytime",
+				"Prorated seat changes",
+				"Priority support",
+			},
+			PerSeat:   true,
+			IsPopular: false,
+			SortOrder: 3,
 			CreatedAt: now,
 			UpdatedAt: now,
 		},
@@ -96,3 +172,90 @@ func (p *Plan) GetQuotaGB() float64 {
 	return float64(p.QuotaBytes) / (1024 * 1024 * 1024)
 }
 
+// Price returns the price of the plan for a billing interval. Plans without a yearly
+// price are billed twelve monthly prices a year.
+func (p *Plan) Price(interval BillingInterval) float64 {
+	if interval == BillingIntervalYear {
+		if p.PricePerYear > 0 {
+			return p.PricePerYear
+		}
+		return p.PricePerMonth * 12
+	}
+	return p.PricePerMonth
+}
+
+// PriceIn returns the price of the plan for a billing interval in a currency, and false
+// if the plan isn't priced in it. Free plans cost nothing in every currency.
+func (p *Plan) PriceIn(currency string, interval BillingInterval) (float64, bool) {
+	if currency == CurrencyUSD || p.IsFree() {
+		return p.Price(interval), true
+	}
+	point, ok := p.Prices[currency]
+	if !ok {
+		return 0, false
+	}
+	if interval == BillingIntervalYear {
+		if point.PerYear > 0 {
+			return point.PerYear, true
+		}
+		return point.PerMonth * 12, true
+	}
+	return point.PerMonth, true
+}
+
+// IsFree reports whether the plan costs nothing
+func (p *Plan) IsFree() bool {
+	return p.PricePerMonth == 0 && p.PricePerYear == 0
+}
+
+// HasAPIAccess reports whether subscribers can call the API with API keys
+func (p *Plan) HasAPIAccess() bool {
+	return p.APICallsIncluded > 0
+}
+
+// APIOveragePriceIn returns the price of APICallBlock API calls over the included calls
+// in a currency, and false if the plan isn't priced in it
+func (p *Plan) APIOveragePriceIn(currency string) (float64, bool) {
+	if currency == CurrencyUSD {
+		return p.APIOveragePer1000, true
+	}
+	point, ok := p.Prices[currency]
+	if !ok {
+		return 0, false
+	}
+	return point.APIOveragePer1000, true
+}
+
+// Currencies returns the currencies the plan is priced in, USD first
+func (p *Plan) Currencies() []string {
+	currencies := make([]string, 0, len(p.Prices)+1)
+	currencies = append(currencies, CurrencyUSD)
+	for currency := range p.Prices {
+		currencies = append(currencies, currency)
+	}
+	slices.Sort(currencies[1:])
+	return currencies
+}
+
+// YearlyPricePerMonth returns the effective monthly price of the plan when billed yearly
+func (p *Plan) YearlyPricePerMonth() float64 {
+	return math.Round(p.Price(BillingIntervalYear)/12*100) / 100
+}
+
+// YearlySavingPerMonth returns how much less a month of the plan costs when billed yearly
+func (p *Plan) YearlySavingPerMonth() float64 {
+	saving := math.Round((p.PricePerMonth-p.YearlyPricePerMonth())*100) / 100
+	if saving < 0 {
+		return 0
+	}
+	return saving
+}
+
+// YearlySavingPercent returns the discount of yearly over monthly billing, as a
+// whole percentage
+func (p *Plan) YearlySavingPercent() float64 {
+	if p.PricePerMonth <= 0 {
+		return 0
+	}
+	return math.Round(p.YearlySavingPerMonth() / p.PricePerMonth * 100)
+}
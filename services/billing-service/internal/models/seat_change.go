@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SeatChangeStatus represents the status of a seat change
+type SeatChangeStatus string
+
+const (
+	SeatChangeStatusPending SeatChangeStatus = "pending"
+	SeatChangeStatusApplied SeatChangeStatus = "applied"
+	SeatChangeStatusFailed  SeatChangeStatus = "failed"
+)
+
+// SeatChange is a purchase of additional seats for a team subscription. The seats are
+// added once the prorated amount has been paid. The seat credit paying for part of them
+// is taken off the subscription when the change is created, and given back if it fails.
+type SeatChange struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SubscriptionID primitive.ObjectID `bson:"subscriptionId" json:"subscriptionId"`
+	OrgID          primitive.ObjectID `bson:"orgId" json:"orgId"`
+	UserID         primitive.ObjectID `bson:"userId" json:"userId"`
+	FromSeats      int                `bson:"fromSeats" json:"fromSeats"`
+	ToSeats        int                `bson:"toSeats" json:"toSeats"`
+	Amount         int64              `bson:"amount" json:"amount"`               // charged, in US cents
+	CreditApplied  int64              `bson:"creditApplied" json:"creditApplied"` // seat credit reserved, in US cents
+	Status         SeatChangeStatus   `bson:"status" json:"status"`
+	SessionID      string             `bson:"sessionId,omitempty" json:"sessionId,omitempty"`
+	TransactionID  string             `bson:"transactionId,omitempty" json:"transactionId,omitempty"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// AddedSeats returns the number of seats the change adds
+func (c *SeatChange) AddedSeats() int {
+	return c.ToSeats - c.FromSeats
+}
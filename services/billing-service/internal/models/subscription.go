@@ -14,6 +14,9 @@ const (
 	SubscriptionStatusExpired   SubscriptionStatus = "expired"
 	SubscriptionStatusCancelled SubscriptionStatus = "cancelled"
 	SubscriptionStatusPending   SubscriptionStatus = "pending"
+	// SubscriptionStatusTrialing subscriptions have the plan's full quota for free until
+	// their trial ends
+	SubscriptionStatusTrialing SubscriptionStatus = "trialing"
 )
 
 // PaymentStatus represents the status of a payment
@@ -26,10 +29,32 @@ const (
 	PaymentStatusRefunded PaymentStatus = "refunded"
 )
 
+// BillingInterval is how often a subscription is paid for
+type BillingInterval string
+
+const (
+	BillingIntervalMonth BillingInterval = "month"
+	BillingIntervalYear  BillingInterval = "year"
+)
+
+// IsValid checks if the interval is a supported billing interval
+func (i BillingInterval) IsValid() bool {
+	return i == BillingIntervalMonth || i == BillingIntervalYear
+}
+
+// PeriodEnd returns the end of a billing period starting at start
+func (i BillingInterval) PeriodEnd(start time.Time) time.Time {
+	if i == BillingIntervalYear {
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
 // Subscription represents a user's subscription to a plan
 type Subscription struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID        primitive.ObjectID `bson:"userId" json:"userId"`
+	TenantID      string             `bson:"tenantId,omitempty" json:"tenantId,omitempty"` // Empty for the default tenant
 	PlanID        primitive.ObjectID `bson:"planId" json:"planId"`
 	Status        SubscriptionStatus `bson:"status" json:"status"`
 	PaymentStatus PaymentStatus      `bson:"paymentStatus" json:"paymentStatus"`
@@ -40,11 +65,125 @@ type Subscription struct {
 	SessionID     string             `bson:"sessionId,omitempty" json:"sessionId,omitempty"`
 	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt     time.Time          `bson:"updatedAt" json:"updatedAt"`
+
+	// ProviderSubscriptionID is the ID of the recurring subscription at the payment
+	// provider, for payments made through one
+	ProviderSubscriptionID string `bson:"providerSubscriptionId,omitempty" json:"providerSubscriptionId,omitempty"`
+
+	// BillingInterval is unset on subscriptions created before yearly billing, which
+	// are all monthly
+	BillingInterval BillingInterval `bson:"billingInterval,omitempty" json:"billingInterval,omitempty"`
+	// Currency is the currency the subscription is charged in. It is unset on
+	// subscriptions created before plans had prices in several currencies.
+	Currency string `bson:"currency,omitempty" json:"currency,omitempty"`
+	// Billing are the billing details given at checkout, which decide the tax charged.
+	// Without them the default tax rate applies.
+	Billing *BillingDetails `bson:"billing,omitempty" json:"billing,omitempty"`
+
+	// OrgID is the organization a subscription to a per-seat plan belongs to, and Seats
+	// the number of seats paid for. UserID is the member who bought it.
+	OrgID primitive.ObjectID `bson:"orgId,omitempty" json:"orgId,omitempty"`
+	Seats int                `bson:"seats,omitempty" json:"seats,omitempty"`
+	// SeatCredit is the unused value of removed seats in the smallest unit of the
+	// subscription's currency, which pays for seats added later in the subscription
+	SeatCredit int64 `bson:"seatCredit,omitempty" json:"seatCredit,omitempty"`
+
+	// Dunning is set while a failed renewal payment is retried. It is stored as null
+	// rather than omitted so that updates clear it.
+	Dunning *Dunning `bson:"dunning" json:"dunning,omitempty"`
+
+	// TrialDays is the length of the free trial the subscription starts with once its
+	// payment method is saved. TrialEnd is when a trialing subscription's first payment
+	// is charged, and TrialReminded whether the user was reminded of it.
+	TrialDays     int       `bson:"trialDays,omitempty" json:"trialDays,omitempty"`
+	TrialEnd      time.Time `bson:"trialEnd,omitempty" json:"trialEnd,omitempty"`
+	TrialReminded bool      `bson:"trialReminded,omitempty" json:"trialReminded,omitempty"`
+}
+
+// Dunning tracks a subscription whose renewal payment failed. The subscription keeps its
+// plan until GracePeriodEnd while the payment is retried and the user is reminded to pay,
+// and is downgraded to the Free plan after that.
+type Dunning struct {
+	FailedAt       time.Time `bson:"failedAt" json:"failedAt"`
+	GracePeriodEnd time.Time `bson:"gracePeriodEnd" json:"gracePeriodEnd"`
+	Retries        int       `bson:"retries" json:"retries"`
+	// NextRetryAt is when the payment is retried next, or GracePeriodEnd once all
+	// retries are used up
+	NextRetryAt time.Time `bson:"nextRetryAt" json:"nextRetryAt"`
+
+	// InvoiceID is the payment provider's invoice whose payment is retried, and
+	// PaymentURL a page where the user can pay it with another payment method. Both are
+	// empty for providers that don't keep payment methods.
+	InvoiceID  string `bson:"invoiceId,omitempty" json:"invoiceId,omitempty"`
+	PaymentURL string `bson:"paymentUrl,omitempty" json:"paymentUrl,omitempty"`
 }
 
-// IsActive checks if the subscription is currently active
+// IsTeam checks if the subscription belongs to an organization
+func (s *Subscription) IsTeam() bool {
+	return !s.OrgID.IsZero()
+}
+
+// BillingCurrency returns the currency the subscription is charged in. Subscriptions
+// from before currencies could be chosen were charged in USD, or in INR by Razorpay.
+func (s *Subscription) BillingCurrency() string {
+	if s.Currency != "" {
+		return s.Currency
+	}
+	if s.PaymentMethod == "razorpay" {
+		return CurrencyINR
+	}
+	return CurrencyUSD
+}
+
+// IsTrialing checks if the subscription is in its free trial
+func (s *Subscription) IsTrialing() bool {
+	return s.Status == SubscriptionStatusTrialing
+}
+
+// IsPastDue checks if the subscription is in the grace period of a failed payment
+func (s *Subscription) IsPastDue() bool {
+	return s.Dunning != nil && s.Status == SubscriptionStatusActive
+}
+
+// Interval returns how often the subscription is paid for
+func (s *Subscription) Interval() BillingInterval {
+	if s.BillingInterval == "" {
+		return BillingIntervalMonth
+	}
+	return s.BillingInterval
+}
+
+// PeriodStart returns the start of the subscription's current billing period, which
+// ends at EndDate. A trial is a period of its own.
+func (s *Subscription) PeriodStart() time.Time {
+	if s.IsTrialing() {
+		return s.StartDate
+	}
+	if s.Interval() == BillingIntervalYear {
+		return s.EndDate.AddDate(-1, 0, 0)
+	}
+	return s.EndDate.AddDate(0, -1, 0)
+}
+
+// RenewsAt returns when the next payment of the subscription is due, which is the end
+// of the trial for trialing subscriptions. Subscriptions that are not active and paid
+// don't renew, and report false.
+func (s *Subscription) RenewsAt() (time.Time, bool) {
+	if s.IsTrialing() {
+		return s.TrialEnd, true
+	}
+	if s.Status != SubscriptionStatusActive || s.PaymentStatus != PaymentStatusPaid {
+		return time.Time{}, false
+	}
+	return s.EndDate, true
+}
+
+// IsActive checks if the subscription is currently active, paid or in its trial
 func (s *Subscription) IsActive() bool {
 	now := time.Now()
+	if s.IsTrialing() {
+		return now.Before(s.TrialEnd)
+	}
 	return s.Status == SubscriptionStatusActive &&
 		s.PaymentStatus == PaymentStatusPaid &&
 		now.After(s.StartDate) &&
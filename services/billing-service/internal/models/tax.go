@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// BillingDetails are where a customer is billed and, for businesses, their tax ID, as
+// given at checkout. They decide the tax on the customer's invoices.
+type BillingDetails struct {
+	// Country is an ISO 3166-1 alpha-2 code and Region a state or province code, such
+	// as "CA" in the US, for countries taxed by region
+	Country string `bson:"country" json:"country"`
+	Region  string `bson:"region,omitempty" json:"region,omitempty"`
+	// TaxID is the VAT or GST number of a business customer
+	TaxID        string `bson:"taxId,omitempty" json:"taxId,omitempty"`
+	BusinessName string `bson:"businessName,omitempty" json:"businessName,omitempty"`
+}
+
+// maxBusinessNameLength bounds the length of business names
+const maxBusinessNameLength = 200
+
+var (
+	countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+	regionCodePattern  = regexp.MustCompile(`^[A-Z0-9]{1,3}$`)
+
+	// taxIDPatterns are the formats of the tax IDs of countries that are checked. EU VAT
+	// numbers start with their country's code, except that Greece's start with EL.
+	taxIDPatterns = map[string]*regexp.Regexp{
+		"GB": regexp.MustCompile(`^GB([0-9]{9}|[0-9]{12}|GD[0-9]{3}|HA[0-9]{3})$`),
+		"IN": regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`),
+		"AU": regexp.MustCompile(`^[0-9]{11}$`),
+	}
+	euVATPattern   = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z]{2,12}$`)
+	otherIDPattern = regexp.MustCompile(`^[0-9A-Z-]{4,20}$`)
+)
+
+// euCountries are the member states of the EU VAT area
+var euCountries = map[string]bool{
+	"AT": true, "BE": true, "BG": true, "CY": true, "CZ": true, "DE": true, "DK": true,
+	"EE": true, "ES": true, "FI": true, "FR": true, "GR": true, "HR": true, "HU": true,
+	"IE": true, "IT": true, "LT": true, "LU": true, "LV": true, "MT": true, "NL": true,
+	"PL": true, "PT": true, "RO": true, "SE": true, "SI": true, "SK": true,
+}
+
+// gstCountries name their consumption tax GST
+var gstCountries = map[string]bool{
+	"AU": true, "IN": true, "NZ": true, "SG": true, "CA": true, "MY": true,
+}
+
+// Normalize upper-cases the details' codes, strips the spaces and dots people type in
+// tax IDs, and checks that they are well-formed. Details without a country are invalid.
+func (d *BillingDetails) Normalize() error {
+	d.Country = strings.ToUpper(strings.TrimSpace(d.Country))
+	d.Region = strings.ToUpper(strings.TrimSpace(d.Region))
+	d.TaxID = strings.ToUpper(strings.NewReplacer(" ", "", ".", "").Replace(d.TaxID))
+	d.BusinessName = strings.TrimSpace(d.BusinessName)
+
+	switch {
+	case !countryCodePattern.MatchString(d.Country):
+		return fmt.Errorf("country must be a two-letter country code")
+	case d.Region != "" && !regionCodePattern.MatchString(d.Region):
+		return fmt.Errorf("region must be a state or province code")
+	case len(d.BusinessName) > maxBusinessNameLength:
+		return fmt.Errorf("business name must be at most %d characters", maxBusinessNameLength)
+	case d.TaxID != "" && !ValidTaxID(d.Country, d.TaxID):
+		return fmt.Errorf("%s is not a valid %s ID for %s", d.TaxID, TaxName(d.Country), d.Country)
+	}
+	return nil
+}
+
+// IsBusiness reports whether the customer is a business with a tax ID
+func (d *BillingDetails) IsBusiness() bool {
+	return d != nil && d.TaxID != ""
+}
+
+// ValidTaxID reports whether a normalized tax ID has the format of the country's tax IDs
+func ValidTaxID(country, taxID string) bool {
+	if pattern, ok := taxIDPatterns[country]; ok {
+		return pattern.MatchString(taxID)
+	}
+	if euCountries[country] {
+		prefix := country
+		if country == "GR" {
+			prefix = "EL"
+		}
+		return strings.HasPrefix(taxID, prefix) && euVATPattern.MatchString(taxID)
+	}
+	return otherIDPattern.MatchString(taxID)
+}
+
+// TaxName returns the name of a country's consumption tax, as shown on invoices
+func TaxName(country string) string {
+	switch {
+	case gstCountries[country]:
+		return "GST"
+	case country == "US":
+		return "Sales tax"
+	default:
+		return "VAT"
+	}
+}
@@ -13,6 +13,51 @@ type Usage struct {
 	UsedBytes int64              `bson:"usedBytes" json:"usedBytes"`
 	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+
+	// AlertLevel is the highest quota alert sent to the user in the billing period
+	// starting at AlertPeriodStart
+	AlertLevel       QuotaAlertLevel `bson:"alertLevel,omitempty" json:"alertLevel,omitempty"`
+	AlertPeriodStart time.Time       `bson:"alertPeriodStart,omitempty" json:"alertPeriodStart,omitempty"`
+}
+
+// QuotaAlertLevel is how much of their quota a user is alerted about using
+type QuotaAlertLevel int
+
+const (
+	QuotaAlertNone QuotaAlertLevel = iota
+	QuotaAlertWarning80
+	QuotaAlertWarning90
+	QuotaAlertExceeded
+)
+
+// QuotaAlertLevelFor returns the alert level of using usedBytes of quotaBytes
+func QuotaAlertLevelFor(usedBytes, quotaBytes int64) QuotaAlertLevel {
+	switch {
+	case quotaBytes <= 0:
+		return QuotaAlertNone
+	case usedBytes >= quotaBytes:
+		return QuotaAlertExceeded
+	case usedBytes*10 >= quotaBytes*9:
+		return QuotaAlertWarning90
+	case usedBytes*10 >= quotaBytes*8:
+		return QuotaAlertWarning80
+	default:
+		return QuotaAlertNone
+	}
+}
+
+// EventType returns the notification event type of an alert level
+func (l QuotaAlertLevel) EventType() string {
+	switch l {
+	case QuotaAlertWarning80:
+		return "quota.warning.80"
+	case QuotaAlertWarning90:
+		return "quota.warning.90"
+	case QuotaAlertExceeded:
+		return "quota.exceeded"
+	default:
+		return ""
+	}
 }
 
 // GetUsedGB returns the used storage in GB
@@ -0,0 +1,136 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	notificationv1 "github.com/yourusername/distributed-file-sharing-platform/services/billing-service/pkg/pb/notification/v1"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// sendTimeout bounds how long a single notification call may take
+const sendTimeout = 10 * time.Second
+
+// Client sends billing emails through the notification-service
+type Client struct {
+	conn   *grpc.ClientConn
+	client notificationv1.NotificationServiceClient
+}
+
+// NewClient dials the notification-service gRPC endpoint
+func NewClient(addr string, opts ...grpc.DialOption) (*Client, error) {
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to notification service: %w", err)
+	}
+	poolmetrics.WatchClientConn("notification-service", conn)
+
+	return &Client{
+		conn:   conn,
+		client: notificationv1.NewNotificationServiceClient(conn),
+	}, nil
+}
+
+// SendInvoiceEmail emails a user that an invoice was issued or refunded. Invoices skip
+// batching and quiet hours like other receipts.
+func (c *Client) SendInvoiceEmail(ctx context.Context, userID, email, title, message string, metadata map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	md := map[string]string{"email": email}
+	for key, value := range metadata {
+		md[key] = value
+	}
+
+	_, err := c.client.SendNotification(ctx, &notificationv1.SendNotificationRequest{
+		UserId:           userID,
+		EventType:        notificationv1.EventType_EVENT_TYPE_INVOICE_ISSUED,
+		Channel:          notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_EMAIL,
+		Title:            title,
+		Message:          message,
+		Priority:         notificationv1.Priority_PRIORITY_NORMAL,
+		Metadata:         md,
+		BypassBatching:   true,
+		BypassQuietHours: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send invoice email: %w", err)
+	}
+
+	return nil
+}
+
+// SendPaymentEmail emails a user about a failed subscription payment: a reminder to pay
+// it, or the downgrade that followed. Like receipts they skip batching and quiet hours.
+func (c *Client) SendPaymentEmail(ctx context.Context, userID, email, title, message string, metadata map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	md := map[string]string{"email": email}
+	for key, value := range metadata {
+		md[key] = value
+	}
+
+	_, err := c.client.SendNotification(ctx, &notificationv1.SendNotificationRequest{
+		UserId:           userID,
+		EventType:        notificationv1.EventType_EVENT_TYPE_PAYMENT_FAILED,
+		Channel:          notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_EMAIL,
+		Title:            title,
+		Message:          message,
+		Priority:         notificationv1.Priority_PRIORITY_HIGH,
+		Metadata:         md,
+		BypassBatching:   true,
+		BypassQuietHours: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send payment email: %w", err)
+	}
+
+	return nil
+}
+
+// SendTrialEmail emails a user about a free trial: a reminder that it is about to be
+// charged, or the downgrade when that failed. Like receipts they skip batching and quiet
+// hours.
+func (c *Client) SendTrialEmail(ctx context.Context, userID, email, title, message string, metadata map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	md := map[string]string{"email": email}
+	for key, value := range metadata {
+		md[key] = value
+	}
+
+	_, err := c.client.SendNotification(ctx, &notificationv1.SendNotificationRequest{
+		UserId:           userID,
+		EventType:        notificationv1.EventType_EVENT_TYPE_TRIAL_ENDING,
+		Channel:          notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_EMAIL,
+		Title:            title,
+		Message:          message,
+		Priority:         notificationv1.Priority_PRIORITY_HIGH,
+		Metadata:         md,
+		BypassBatching:   true,
+		BypassQuietHours: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send trial email: %w", err)
+	}
+
+	return nil
+}
+
+// HealthCheck checks that the notification-service can be reached
+func (c *Client) HealthCheck(ctx context.Context) error {
+	return health.GRPC(c.conn)(ctx)
+}
+
+// Close closes the underlying connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
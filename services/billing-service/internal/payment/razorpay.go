@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/razorpay/razorpay-go"
 	"github.com/sirupsen/logrus"
@@ -14,6 +15,7 @@ import (
 
 type RazorpayService struct {
 	client        *razorpay.Client
+	keyID         string
 	webhookSecret string
 }
 
@@ -21,66 +23,128 @@ func NewRazorpayService(keyID, keySecret, webhookSecret string) *RazorpayService
 	client := razorpay.NewClient(keyID, keySecret)
 	return &RazorpayService{
 		client:        client,
+		keyID:         keyID,
 		webhookSecret: webhookSecret,
 	}
 }
 
-// CreateSubscription creates a Razorpay subscription
-func (s *RazorpayService) CreateSubscription(plan *models.Plan, userID, subscriptionID string) (string, string, error) {
-	// 1. Create a Plan in Razorpay if it doesn't exist (or use a fixed mapping)
-	// For simplicity, we'll assume we create a new plan or use a fixed one.
-	// In a real app, you'd sync plans. Here we'll create a subscription directly if possible,
-	// but Razorpay subscriptions require a Plan ID.
-	// Let's assume we create a "link" or "order" for one-time payment first as per the simple flow,
-	// or if we want recurring, we need a Plan.
-	// Given the "CreateSubscription" name, let's try to create a Subscription.
-
-	// However, creating a plan dynamically for every user is not ideal.
-	// Let's fallback to creating an Order for the first payment, which is common for "subscribe" flows
-	// that start with a payment. But wait, the proto says "CreateSubscription".
-	// Let's assume we use Razorpay Subscriptions.
-	
-	// For this implementation, let's assume we map our internal plan to a Razorpay Plan ID.
-	// Since we don't have that mapping yet, let's create a dummy plan or just use an Order for simplicity
-	// to get the payment flow working.
-	// ACTUALLY, let's use Orders for one-time payments as a start, similar to the Stripe implementation
-	// which uses Checkout Session (often one-time).
-	
-	amountInPaise := int64(plan.PricePerMonth * 100 * 83) // Approx USD to INR conversion if needed, or just assume price is in base currency.
-	// Let's assume PricePerMonth is in USD, and we want to charge in USD or convert.
-	// Razorpay supports international payments.
-	
+// RazorpayCheckout holds the options the frontend opens Razorpay Checkout with to pay
+// for an order
+type RazorpayCheckout struct {
+	KeyID       string
+	OrderID     string
+	Amount      int64 // in the smallest unit of Currency
+	Currency    string
+	Name        string
+	Description string
+}
+
+// CreateSubscription creates a Razorpay order for the first payment of a subscription,
+// covering one billing interval of seats seats at unitAmount each, in the smallest unit
+// of currency, plus extras. The subscription is activated by the payment.captured
+// webhook of the order.
+func (s *RazorpayService) CreateSubscription(plan *models.Plan, interval models.BillingInterval, currency string, unitAmount int64, seats int, userID, subscriptionID string, extras []ExtraCharge) (*RazorpayCheckout, error) {
+	if s.keyID == "" {
+		return nil, fmt.Errorf("razorpay is not configured")
+	}
+
+	amount := unitAmount * int64(seats)
+	for _, extra := range extras {
+		amount += extra.Amount
+	}
+	data := map[string]interface{}{
+		"amount":   amount,
+		"currency": strings.ToUpper(currency),
+		"receipt":  subscriptionID,
+		"notes": map[string]interface{}{
+			"user_id":         userID,
+			"subscription_id": subscriptionID,
+			"plan_id":         plan.ID.Hex(),
+			"interval":        string(interval),
+		},
+	}
+
+	body, err := s.client.Order.Create(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create razorpay order: %w", err)
+	}
+
+	orderID, ok := body["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("failed to get order id from response")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"order_id":        orderID,
+		"user_id":         userID,
+		"subscription_id": subscriptionID,
+		"plan":            plan.Name,
+		"interval":        interval,
+		"currency":        currency,
+	}).Info("Razorpay order created")
+
+	return &RazorpayCheckout{
+		KeyID:       s.keyID,
+		OrderID:     orderID,
+		Amount:      amount,
+		Currency:    strings.ToUpper(currency),
+		Name:        productName(plan, interval),
+		Description: plan.Description,
+	}, nil
+}
+
+// CreateSeatOrder creates a Razorpay order paying the prorated amount, in the smallest
+// unit of currency, for seats added to a team subscription
+func (s *RazorpayService) CreateSeatOrder(plan *models.Plan, currency, userID, subscriptionID, seatChangeID string, addedSeats int, amount int64) (*RazorpayCheckout, error) {
+	if s.keyID == "" {
+		return nil, fmt.Errorf("razorpay is not configured")
+	}
+
 	data := map[string]interface{}{
-		"amount":          amountInPaise,
-		"currency":        "INR", // Using INR for Razorpay default
-		"receipt":         subscriptionID,
+		"amount":   amount,
+		"currency": strings.ToUpper(currency),
+		"receipt":  seatChangeID,
 		"notes": map[string]interface{}{
 			"user_id":         userID,
 			"subscription_id": subscriptionID,
 			"plan_id":         plan.ID.Hex(),
+			"seat_change_id":  seatChangeID,
 		},
 	}
 
 	body, err := s.client.Order.Create(data, nil)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create razorpay order: %w", err)
+		return nil, fmt.Errorf("failed to create razorpay order: %w", err)
 	}
 
 	orderID, ok := body["id"].(string)
 	if !ok {
-		return "", "", fmt.Errorf("failed to get order id from response")
+		return nil, fmt.Errorf("failed to get order id from response")
 	}
 
-	// We don't get a payment URL directly like Stripe Checkout, 
-	// but we return the Order ID which the frontend uses to open the checkout.
-	// The proto expects a payment_url. We can return a dummy URL or handle this in frontend.
-	// For now, let's return the Order ID as the session ID.
-	
-	return "", orderID, nil
+	logrus.WithFields(logrus.Fields{
+		"order_id":        orderID,
+		"user_id":         userID,
+		"subscription_id": subscriptionID,
+		"seat_change_id":  seatChangeID,
+		"added_seats":     addedSeats,
+	}).Info("Razorpay seat order created")
+
+	return &RazorpayCheckout{
+		KeyID:       s.keyID,
+		OrderID:     orderID,
+		Amount:      amount,
+		Currency:    strings.ToUpper(currency),
+		Name:        seatProductName(plan, addedSeats),
+		Description: "Prorated for the rest of the current billing period",
+	}, nil
 }
 
 // VerifyWebhookSignature verifies the Razorpay webhook signature
 func (s *RazorpayService) VerifyWebhookSignature(payload []byte, signature string) error {
+	if s.webhookSecret == "" {
+		return fmt.Errorf("razorpay webhook secret is not configured")
+	}
 	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
 	mac.Write(payload)
 	expectedMAC := hex.EncodeToString(mac.Sum(nil))
@@ -129,14 +193,17 @@ func (s *RazorpayService) HandleWebhookEvent(payload []byte) (*WebhookResult, er
 			logrus.Warn("No notes found in payment entity")
 		}
 
+		amount, _ := entity["amount"].(float64)
 		data := &CheckoutSessionData{
-			TransactionID:  entity["id"].(string),
+			SessionID:      getString(entity, "order_id"),
+			TransactionID:  getString(entity, "id"),
 			PaymentStatus:  "paid",
-			AmountTotal:    int64(entity["amount"].(float64)),
-			Currency:       entity["currency"].(string),
+			AmountTotal:    int64(amount),
+			Currency:       getString(entity, "currency"),
 			UserID:         getString(notes, "user_id"),
 			SubscriptionID: getString(notes, "subscription_id"),
 			PlanID:         getString(notes, "plan_id"),
+			SeatChangeID:   getString(notes, "seat_change_id"),
 		}
 		result.Data = data
 		result.Processed = true
@@ -154,10 +221,12 @@ func (s *RazorpayService) HandleWebhookEvent(payload []byte) (*WebhookResult, er
 		notes, _ := entity["notes"].(map[string]interface{})
 
 		data := &CheckoutSessionData{
-			TransactionID:  entity["id"].(string),
+			SessionID:      getString(entity, "order_id"),
+			TransactionID:  getString(entity, "id"),
 			PaymentStatus:  "failed",
 			UserID:         getString(notes, "user_id"),
 			SubscriptionID: getString(notes, "subscription_id"),
+			SeatChangeID:   getString(notes, "seat_change_id"),
 		}
 		result.Data = data
 		result.Processed = true
@@ -166,6 +235,28 @@ func (s *RazorpayService) HandleWebhookEvent(payload []byte) (*WebhookResult, er
 	return result, nil
 }
 
+// RefundPayment refunds amount, in the smallest unit of the payment's currency, of a
+// captured payment and returns the refund's ID
+func (s *RazorpayService) RefundPayment(paymentID string, amount int64) (string, error) {
+	if s.keyID == "" {
+		return "", fmt.Errorf("razorpay is not configured")
+	}
+
+	ref, err := s.client.Payment.Refund(paymentID, int(amount), nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to refund payment: %w", err)
+	}
+
+	refundID := getString(ref, "id")
+	logrus.WithFields(logrus.Fields{
+		"refund_id":  refundID,
+		"payment_id": paymentID,
+		"amount":     amount,
+	}).Info("Razorpay payment refunded")
+
+	return refundID, nil
+}
+
 func getString(m map[string]interface{}, key string) string {
 	if val, ok := m[key]; ok {
 		if str, ok := val.(string); ok {
@@ -1,14 +1,19 @@
 package payment
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stripe/stripe-go/v76"
-	"github.com/stripe/stripe-go/v76/checkout/session"
+	"github.com/stripe/stripe-go/v76/client"
 	"github.com/stripe/stripe-go/v76/webhook"
 	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/secrets"
 )
 
 type StripeService struct {
@@ -16,6 +21,15 @@ type StripeService struct {
 	webhookSecret string
 	successURL    string
 	cancelURL     string
+
+	// secretKeySource and webhookSecretSource, when set, are the secrets the keys are
+	// read from, so that rotated keys are used without a restart
+	secretKeySource     *secrets.Secret
+	webhookSecretSource *secrets.Secret
+
+	mu        sync.Mutex
+	stripeAPI *client.API
+	apiKey    string
 }
 
 func NewStripeService(secretKey, webhookSecret, successURL, cancelURL string) *StripeService {
@@ -28,19 +42,134 @@ func NewStripeService(secretKey, webhookSecret, successURL, cancelURL string) *S
 	}
 }
 
-// CreateCheckoutSession creates a Stripe checkout session for a subscription
-func (s *StripeService) CreateCheckoutSession(plan *models.Plan, userID, subscriptionID string) (*stripe.CheckoutSession, error) {
+// SetSecrets reads the secret key and webhook secret from secrets that may be rotated.
+// Either may be nil to keep the key given to NewStripeService.
+func (s *StripeService) SetSecrets(secretKey, webhookSecret *secrets.Secret) {
+	s.secretKeySource = secretKey
+	s.webhookSecretSource = webhookSecret
+}
+
+// currentKey returns the current value of a key read from source, or key if there is no
+// source or it can't be read
+func currentKey(source *secrets.Secret, key string) string {
+	if source == nil {
+		return key
+	}
+	value, err := source.Value(context.Background())
+	if err != nil || value == "" {
+		logrus.WithError(err).Warn("Failed to read Stripe key from the secret store, using the configured key")
+		return key
+	}
+	return value
+}
+
+// api returns the Stripe client for the current secret key
+func (s *StripeService) api() *client.API {
+	key := currentKey(s.secretKeySource, s.secretKey)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stripeAPI == nil || s.apiKey != key {
+		s.stripeAPI = client.New(key, nil)
+		s.apiKey = key
+	}
+	return s.stripeAPI
+}
+
+// CreateCheckoutSession creates a Stripe checkout session paying for one billing
+// interval of a subscription at unitAmount per seat, in the smallest unit of currency.
+// seats is the number of seats of a per-seat plan, and 1 otherwise. With trialDays set,
+// the session instead saves the customer's card and starts a recurring subscription with
+// a free trial, and Stripe charges the card for the first billing interval when the
+// trial ends. extras are paid along with the first billing interval, and must be empty
+// for trials.
+func (s *StripeService) CreateCheckoutSession(plan *models.Plan, interval models.BillingInterval, currency string, unitAmount int64, seats, trialDays int, userID, subscriptionID string, extras []ExtraCharge) (*stripe.CheckoutSession, error) {
+	metadata := map[string]string{
+		"user_id":         userID,
+		"subscription_id": subscriptionID,
+		"plan_id":         plan.ID.Hex(),
+		"plan_name":       plan.Name,
+		"interval":        string(interval),
+	}
+
 	params := &stripe.CheckoutSessionParams{
 		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
 		LineItems: []*stripe.CheckoutSessionLineItemParams{
 			{
 				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-					Currency: stripe.String("usd"),
+					Currency: stripe.String(currency),
 					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-						Name:        stripe.String(plan.Name + " Plan"),
+						Name:        stripe.String(productName(plan, interval)),
 						Description: stripe.String(plan.Description),
 					},
-					UnitAmount: stripe.Int64(int64(plan.PricePerMonth * 100)), // Convert to cents
+					UnitAmount: stripe.Int64(unitAmount),
+				},
+				Quantity: stripe.Int64(int64(seats)),
+			},
+		},
+		Mode:              stripe.String(string(stripe.CheckoutSessionModePayment)),
+		SuccessURL:        stripe.String(s.successURL + "?session_id={CHECKOUT_SESSION_ID}"),
+		CancelURL:         stripe.String(s.cancelURL),
+		ClientReferenceID: stripe.String(subscriptionID),
+		Metadata:          metadata,
+	}
+	for _, extra := range extras {
+		params.LineItems = append(params.LineItems, &stripe.CheckoutSessionLineItemParams{
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency: stripe.String(currency),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+					Name: stripe.String(extra.Description),
+				},
+				UnitAmount: stripe.Int64(extra.Amount),
+			},
+			Quantity: stripe.Int64(1),
+		})
+	}
+	if trialDays > 0 {
+		params.Mode = stripe.String(string(stripe.CheckoutSessionModeSubscription))
+		params.LineItems[0].PriceData.Recurring = &stripe.CheckoutSessionLineItemPriceDataRecurringParams{
+			Interval: stripe.String(string(interval)),
+		}
+		params.SubscriptionData = &stripe.CheckoutSessionSubscriptionDataParams{
+			TrialPeriodDays: stripe.Int64(int64(trialDays)),
+			Metadata:        metadata,
+		}
+		params.PaymentMethodCollection = stripe.String(string(stripe.CheckoutSessionPaymentMethodCollectionAlways))
+	}
+
+	sess, err := s.api().CheckoutSessions.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkout session: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"session_id":      sess.ID,
+		"user_id":         userID,
+		"subscription_id": subscriptionID,
+		"plan":            plan.Name,
+		"interval":        interval,
+		"currency":        currency,
+		"trial_days":      trialDays,
+		"extra_charges":   len(extras),
+	}).Info("Stripe checkout session created")
+
+	return sess, nil
+}
+
+// CreateSeatCheckoutSession creates a Stripe checkout session paying the prorated amount,
+// in the smallest unit of currency, for seats added to a team subscription
+func (s *StripeService) CreateSeatCheckoutSession(plan *models.Plan, currency, userID, subscriptionID, seatChangeID string, addedSeats int, amount int64) (*stripe.CheckoutSession, error) {
+	params := &stripe.CheckoutSessionParams{
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+					Currency: stripe.String(currency),
+					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+						Name:        stripe.String(seatProductName(plan, addedSeats)),
+						Description: stripe.String("Prorated for the rest of the current billing period"),
+					},
+					UnitAmount: stripe.Int64(amount),
 				},
 				Quantity: stripe.Int64(1),
 			},
@@ -54,10 +183,11 @@ func (s *StripeService) CreateCheckoutSession(plan *models.Plan, userID, subscri
 			"subscription_id": subscriptionID,
 			"plan_id":         plan.ID.Hex(),
 			"plan_name":       plan.Name,
+			"seat_change_id":  seatChangeID,
 		},
 	}
 
-	sess, err := session.New(params)
+	sess, err := s.api().CheckoutSessions.New(params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create checkout session: %w", err)
 	}
@@ -66,15 +196,20 @@ func (s *StripeService) CreateCheckoutSession(plan *models.Plan, userID, subscri
 		"session_id":      sess.ID,
 		"user_id":         userID,
 		"subscription_id": subscriptionID,
-		"plan":            plan.Name,
-	}).Info("Stripe checkout session created")
+		"seat_change_id":  seatChangeID,
+		"added_seats":     addedSeats,
+	}).Info("Stripe seat checkout session created")
 
 	return sess, nil
 }
 
 // VerifyWebhookSignature verifies the Stripe webhook signature
 func (s *StripeService) VerifyWebhookSignature(payload []byte, signature string) (stripe.Event, error) {
-	event, err := webhook.ConstructEvent(payload, signature, s.webhookSecret)
+	webhookSecret := currentKey(s.webhookSecretSource, s.webhookSecret)
+	if webhookSecret == "" {
+		return stripe.Event{}, fmt.Errorf("stripe webhook secret is not configured")
+	}
+	event, err := webhook.ConstructEvent(payload, signature, webhookSecret)
 	if err != nil {
 		return stripe.Event{}, fmt.Errorf("failed to verify webhook signature: %w", err)
 	}
@@ -98,12 +233,75 @@ func (s *StripeService) ParseCheckoutSessionCompleted(event stripe.Event) (*Chec
 		SubscriptionID: sess.Metadata["subscription_id"],
 		PlanID:         sess.Metadata["plan_id"],
 		PlanName:       sess.Metadata["plan_name"],
+		SeatChangeID:   sess.Metadata["seat_change_id"],
 	}
 
 	// Get payment intent ID as transaction ID
 	if sess.PaymentIntent != nil {
 		data.TransactionID = sess.PaymentIntent.ID
 	}
+	if sess.Subscription != nil {
+		data.ProviderSubscriptionID = sess.Subscription.ID
+	}
+
+	return data, nil
+}
+
+// ParseSubscriptionEvent parses a customer.subscription.* event
+func (s *StripeService) ParseSubscriptionEvent(event stripe.Event) (*SubscriptionEventData, error) {
+	var sub stripe.Subscription
+	if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+		return nil, fmt.Errorf("failed to parse subscription: %w", err)
+	}
+
+	return subscriptionData(&sub), nil
+}
+
+// subscriptionData is the state of a Stripe subscription
+func subscriptionData(sub *stripe.Subscription) *SubscriptionEventData {
+	data := &SubscriptionEventData{
+		ProviderSubscriptionID: sub.ID,
+		SubscriptionID:         sub.Metadata["subscription_id"],
+		Status:                 string(sub.Status),
+	}
+	if sub.CurrentPeriodEnd > 0 {
+		data.CurrentPeriodEnd = time.Unix(sub.CurrentPeriodEnd, 0)
+	}
+	if sub.TrialEnd > 0 {
+		data.TrialEnd = time.Unix(sub.TrialEnd, 0)
+	}
+	return data
+}
+
+// ParseInvoiceEvent parses an invoice.* event of a subscription invoice
+func (s *StripeService) ParseInvoiceEvent(event stripe.Event) (*SubscriptionEventData, error) {
+	var inv stripe.Invoice
+	if err := json.Unmarshal(event.Data.Raw, &inv); err != nil {
+		return nil, fmt.Errorf("failed to parse invoice: %w", err)
+	}
+
+	data := &SubscriptionEventData{
+		InvoiceID:  inv.ID,
+		Status:     string(inv.Status),
+		PaymentURL: inv.HostedInvoiceURL,
+		AmountPaid: inv.AmountPaid,
+		Currency:   string(inv.Currency),
+	}
+	if inv.PaymentIntent != nil {
+		data.TransactionID = inv.PaymentIntent.ID
+	}
+	// The invoice's own period is the one before the one it pays for, so the paid
+	// period is taken from its line
+	if inv.Lines != nil && len(inv.Lines.Data) > 0 && inv.Lines.Data[0].Period != nil {
+		data.PeriodStart = time.Unix(inv.Lines.Data[0].Period.Start, 0)
+		data.CurrentPeriodEnd = time.Unix(inv.Lines.Data[0].Period.End, 0)
+	}
+	if inv.Subscription != nil {
+		data.ProviderSubscriptionID = inv.Subscription.ID
+	}
+	if inv.SubscriptionDetails != nil {
+		data.SubscriptionID = inv.SubscriptionDetails.Metadata["subscription_id"]
+	}
 
 	return data, nil
 }
@@ -120,11 +318,36 @@ type CheckoutSessionData struct {
 	SubscriptionID string
 	PlanID         string
 	PlanName       string
+
+	// ProviderSubscriptionID is set when the checkout created a recurring subscription
+	ProviderSubscriptionID string
+
+	// SeatChangeID is set when the payment is for seats added to a team subscription
+	SeatChangeID string
+}
+
+// SubscriptionEventData represents a parsed Stripe subscription or invoice event
+type SubscriptionEventData struct {
+	ProviderSubscriptionID string
+	SubscriptionID         string // from the Stripe subscription's metadata
+	Status                 string // Stripe subscription or invoice status
+	CurrentPeriodEnd       time.Time
+	InvoiceID              string
+	PaymentURL             string // hosted page to pay the invoice
+	// TrialEnd is when the free trial of the Stripe subscription ends, if it has one
+	TrialEnd time.Time
+
+	// Set for paid invoices: the amount paid in the smallest currency unit, its payment
+	// and the start of the period it pays for, which ends at CurrentPeriodEnd
+	AmountPaid    int64
+	Currency      string
+	TransactionID string
+	PeriodStart   time.Time
 }
 
 // GetSessionDetails retrieves details of a checkout session
 func (s *StripeService) GetSessionDetails(sessionID string) (*stripe.CheckoutSession, error) {
-	sess, err := session.Get(sessionID, nil)
+	sess, err := s.api().CheckoutSessions.Get(sessionID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session details: %w", err)
 	}
@@ -139,16 +362,108 @@ func (s *StripeService) CreateRecurringSubscription(plan *models.Plan, customerI
 	return nil, fmt.Errorf("recurring subscriptions not implemented yet")
 }
 
-// RefundPayment refunds a payment
-func (s *StripeService) RefundPayment(paymentIntentID string, amount int64) error {
-	// Implementation for refunds
-	// Can be added when needed
-	return fmt.Errorf("refunds not implemented yet")
+// GetRecurringSubscription returns the status and current period end of a recurring
+// subscription
+func (s *StripeService) GetRecurringSubscription(providerSubscriptionID string) (*SubscriptionEventData, error) {
+	sub, err := s.api().Subscriptions.Get(providerSubscriptionID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	return subscriptionData(sub), nil
+}
+
+// RetryInvoicePayment attempts to pay an open invoice of a recurring subscription with
+// the customer's payment method. It reports whether the invoice is paid.
+func (s *StripeService) RetryInvoicePayment(invoiceID string) (bool, error) {
+	inv, err := s.api().Invoices.Pay(invoiceID, &stripe.InvoicePayParams{})
+	if err != nil {
+		return false, fmt.Errorf("failed to pay invoice: %w", err)
+	}
+	return inv.Status == stripe.InvoiceStatusPaid, nil
+}
+
+// AddSubscriptionCharge adds a one-off charge of amount, in the smallest unit of currency,
+// to the next invoice of a recurring subscription, and returns the ID of its invoice
+// item. Retries with the same idempotency key add the charge once.
+func (s *StripeService) AddSubscriptionCharge(providerSubscriptionID, currency string, amount int64, description, idempotencyKey string) (string, error) {
+	sub, err := s.api().Subscriptions.Get(providerSubscriptionID, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if sub.Customer == nil {
+		return "", fmt.Errorf("subscription %s has no customer", providerSubscriptionID)
+	}
+
+	params := &stripe.InvoiceItemParams{
+		Customer:     stripe.String(sub.Customer.ID),
+		Subscription: stripe.String(providerSubscriptionID),
+		Amount:       stripe.Int64(amount),
+		Currency:     stripe.String(currency),
+		Description:  stripe.String(description),
+	}
+	params.SetIdempotencyKey(idempotencyKey)
+
+	item, err := s.api().InvoiceItems.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create invoice item: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"invoice_item_id":          item.ID,
+		"provider_subscription_id": providerSubscriptionID,
+		"amount":                   amount,
+		"currency":                 currency,
+	}).Info("Stripe invoice item created")
+
+	return item.ID, nil
+}
+
+// CancelRecurringSubscription cancels a recurring subscription right away, so that the
+// customer is not charged again
+func (s *StripeService) CancelRecurringSubscription(providerSubscriptionID string) error {
+	if _, err := s.api().Subscriptions.Cancel(providerSubscriptionID, nil); err != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+	return nil
+}
+
+// RefundPayment refunds amount, in the smallest currency unit, of a payment and returns
+// the refund's ID. Payments recorded by the ID of the Stripe invoice they paid are
+// refunded through the invoice's payment intent.
+func (s *StripeService) RefundPayment(transactionID string, amount int64) (string, error) {
+	paymentIntentID := transactionID
+	if strings.HasPrefix(transactionID, "in_") {
+		inv, err := s.api().Invoices.Get(transactionID, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to get invoice: %w", err)
+		}
+		if inv.PaymentIntent == nil {
+			return "", fmt.Errorf("invoice %s has no payment to refund", transactionID)
+		}
+		paymentIntentID = inv.PaymentIntent.ID
+	}
+
+	ref, err := s.api().Refunds.New(&stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentIntentID),
+		Amount:        stripe.Int64(amount),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to refund payment: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"refund_id":         ref.ID,
+		"payment_intent_id": paymentIntentID,
+		"amount":            amount,
+	}).Info("Stripe payment refunded")
+
+	return ref.ID, nil
 }
 
 // HandleWebhookEvent handles different types of Stripe webhook events
 func (s *StripeService) HandleWebhookEvent(event stripe.Event) (*WebhookResult, error) {
 	result := &WebhookResult{
+		EventID:   event.ID,
 		EventType: string(event.Type),
 		Processed: false,
 	}
@@ -176,6 +491,7 @@ func (s *StripeService) HandleWebhookEvent(event stripe.Event) (*WebhookResult,
 			SessionID:      sess.ID,
 			SubscriptionID: sess.Metadata["subscription_id"],
 			UserID:         sess.Metadata["user_id"],
+			SeatChangeID:   sess.Metadata["seat_change_id"],
 		}
 		result.Processed = true
 		logrus.WithFields(logrus.Fields{
@@ -183,6 +499,46 @@ func (s *StripeService) HandleWebhookEvent(event stripe.Event) (*WebhookResult,
 			"session_id": sess.ID,
 		}).Info("Checkout session expired")
 
+	case "customer.subscription.updated", "customer.subscription.deleted":
+		data, err := s.ParseSubscriptionEvent(event)
+		if err != nil {
+			return nil, err
+		}
+		result.Data = data
+		result.Processed = true
+		logrus.WithFields(logrus.Fields{
+			"event_type":               event.Type,
+			"provider_subscription_id": data.ProviderSubscriptionID,
+			"status":                   data.Status,
+		}).Info("Subscription changed")
+
+	case "invoice.paid":
+		data, err := s.ParseInvoiceEvent(event)
+		if err != nil {
+			return nil, err
+		}
+		result.Data = data
+		result.Processed = true
+		logrus.WithFields(logrus.Fields{
+			"event_type":               event.Type,
+			"invoice_id":               data.InvoiceID,
+			"provider_subscription_id": data.ProviderSubscriptionID,
+			"amount_paid":              data.AmountPaid,
+		}).Info("Invoice paid")
+
+	case "invoice.payment_failed":
+		data, err := s.ParseInvoiceEvent(event)
+		if err != nil {
+			return nil, err
+		}
+		result.Data = data
+		result.Processed = true
+		logrus.WithFields(logrus.Fields{
+			"event_type":               event.Type,
+			"invoice_id":               data.InvoiceID,
+			"provider_subscription_id": data.ProviderSubscriptionID,
+		}).Warn("Invoice payment failed")
+
 	case "payment_intent.succeeded":
 		logrus.WithField("event_type", event.Type).Info("Payment intent succeeded")
 		result.Processed = true
@@ -200,7 +556,31 @@ func (s *StripeService) HandleWebhookEvent(event stripe.Event) (*WebhookResult,
 
 // WebhookResult represents the result of processing a webhook
 type WebhookResult struct {
+	EventID   string // unset for Razorpay, whose payloads don't identify the event
 	EventType string
 	Processed bool
 	Data      interface{}
 }
+
+// ExtraCharge is a one-off charge paid with the checkout of a subscription, such as API
+// overage, in the smallest unit of the checkout's currency
+type ExtraCharge struct {
+	Description string
+	Amount      int64
+}
+
+// productName names what the customer pays for on the checkout page
+func productName(plan *models.Plan, interval models.BillingInterval) string {
+	if interval == models.BillingIntervalYear {
+		return plan.Name + " Plan (yearly)"
+	}
+	return plan.Name + " Plan"
+}
+
+// seatProductName names the seats added to a team subscription on the checkout page
+func seatProductName(plan *models.Plan, addedSeats int) string {
+	if addedSeats == 1 {
+		return fmt.Sprintf("1 additional seat, %s Plan", plan.Name)
+	}
+	return fmt.Sprintf("%d additional seats, %s Plan", addedSeats, plan.Name)
+}
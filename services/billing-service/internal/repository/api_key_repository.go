@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAPIKeyNotFound is returned when an API key does not exist
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+type APIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIKeyRepository(db *mongo.Database) *APIKeyRepository {
+	return &APIKeyRepository{
+		collection: db.Collection("api_keys"),
+	}
+}
+
+// Create creates a new API key for a user of the tenant ctx is served for
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	key.ID = primitive.NewObjectID()
+	key.CreatedAt = time.Now()
+	if id, ok := tenant.FromContext(ctx); ok {
+		key.TenantID = id
+	}
+
+	if _, err := r.collection.InsertOne(ctx, key); err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// FindByID finds an API key by ID
+func (r *APIKeyRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.APIKey, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+// FindByHash finds an API key by the hash of the key
+func (r *APIKeyRepository) FindByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	return r.findOne(ctx, bson.M{"keyHash": keyHash})
+}
+
+func (r *APIKeyRepository) findOne(ctx context.Context, filter bson.M) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.collection.FindOne(ctx, filter).Decode(&key); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to find API key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListByUserID returns a user's API keys, including revoked ones, newest first
+func (r *APIKeyRepository) ListByUserID(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var keys []models.APIKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// CountActive counts a user's API keys that haven't been revoked
+func (r *APIKeyRepository) CountActive(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count API keys: %w", err)
+	}
+	return count, nil
+}
+
+// Revoke revokes one of a user's API keys. Keys of other users and keys that are
+// already revoked are reported as not found.
+func (r *APIKeyRepository) Revoke(ctx context.Context, id, userID primitive.ObjectID) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// SetQuotas changes the rate limit and monthly transfer quota of one of a user's API
+// keys. Keys of other users and revoked keys are reported as not found.
+func (r *APIKeyRepository) SetQuotas(ctx context.Context, id, userID primitive.ObjectID, rateLimit, monthlyTransfer int64) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"rateLimit": rateLimit, "monthlyTransfer": monthlyTransfer}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update API key quotas: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// SetLastUsed records when an API key was last used
+func (r *APIKeyRepository) SetLastUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"lastUsedAt": at}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	return nil
+}
+
+// EnsureIndexes creates necessary indexes
+func (r *APIKeyRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "keyHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAPIKeyRepositoryCreateStoresTenant(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		wantTenant string
+	}{
+		{"outside of a request", context.Background(), ""},
+		{"default tenant", tenant.WithID(context.Background(), ""), ""},
+		{"tenant", tenant.WithID(context.Background(), "acme"), "acme"},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			repo := NewAPIKeyRepository(mt.DB)
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+			key := &models.APIKey{UserID: primitive.NewObjectID(), Name: "ci"}
+			if err := repo.Create(tt.ctx, key); err != nil {
+				mt.Fatalf("Create() error = %v", err)
+			}
+			if key.TenantID != tt.wantTenant {
+				mt.Errorf("TenantID = %q, want %q", key.TenantID, tt.wantTenant)
+			}
+
+			doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+			stored, ok := doc.Lookup("tenantId").StringValueOK()
+			if stored != tt.wantTenant || ok != (tt.wantTenant != "") {
+				mt.Errorf("stored tenantId = %q (present %v), want %q", stored, ok, tt.wantTenant)
+			}
+		})
+	}
+}
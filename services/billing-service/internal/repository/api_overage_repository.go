@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIOverageRepository stores users' monthly API calls over their plan's included calls
+// until they are invoiced
+type APIOverageRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIOverageRepository(db *mongo.Database) *APIOverageRepository {
+	return &APIOverageRepository{
+		collection: db.Collection("api_overages"),
+	}
+}
+
+// Create records a user's overage in a month. It reports false if the month's overage
+// was already recorded, so that each month is billed once.
+func (r *APIOverageRepository) Create(ctx context.Context, overage *models.APIOverage) (bool, error) {
+	overage.ID = primitive.NewObjectID()
+	overage.Status = models.APIOverageStatusPending
+	overage.CreatedAt = time.Now()
+	overage.UpdatedAt = time.Now()
+
+	if _, err := r.collection.InsertOne(ctx, overage); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create API overage: %w", err)
+	}
+	return true, nil
+}
+
+// ListPendingByUser returns a user's overages that haven't been invoiced, oldest first
+func (r *APIOverageRepository) ListPendingByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIOverage, error) {
+	return r.find(ctx, bson.M{"userId": userID, "status": models.APIOverageStatusPending}, options.Find().SetSort(bson.D{{Key: "month", Value: 1}}))
+}
+
+// ListUnscheduled returns up to limit pending overages after the given ID, in ID order,
+// that no Stripe invoice item charges yet
+func (r *APIOverageRepository) ListUnscheduled(ctx context.Context, after primitive.ObjectID, limit int64) ([]models.APIOverage, error) {
+	filter := bson.M{
+		"status":         models.APIOverageStatusPending,
+		"providerItemId": bson.M{"$exists": false},
+	}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	return r.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit))
+}
+
+// ListAttached returns the pending overages the next payment of a subscription includes
+func (r *APIOverageRepository) ListAttached(ctx context.Context, subscriptionID primitive.ObjectID) ([]models.APIOverage, error) {
+	return r.find(ctx, bson.M{"subscriptionId": subscriptionID, "status": models.APIOverageStatusPending}, options.Find().SetSort(bson.D{{Key: "month", Value: 1}}))
+}
+
+func (r *APIOverageRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.APIOverage, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API overages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var overages []models.APIOverage
+	if err := cursor.All(ctx, &overages); err != nil {
+		return nil, fmt.Errorf("failed to decode API overages: %w", err)
+	}
+	return overages, nil
+}
+
+// Attach has the next payment of a subscription include a pending overage, at amount in
+// the smallest unit of currency. providerItemID is the Stripe invoice item charging it
+// with a recurring subscription's next invoice, or empty for a checkout. Overages that
+// Stripe already charges are not attached to anything else; false is reported for them.
+func (r *APIOverageRepository) Attach(ctx context.Context, id, subscriptionID primitive.ObjectID, amount int64, currency, providerItemID string) (bool, error) {
+	set := bson.M{
+		"subscriptionId": subscriptionID,
+		"amount":         amount,
+		"currency":       currency,
+		"updatedAt":      time.Now(),
+	}
+	if providerItemID != "" {
+		set["providerItemId"] = providerItemID
+	}
+
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"_id":            id,
+			"status":         models.APIOverageStatusPending,
+			"providerItemId": bson.M{"$exists": false},
+		},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to attach API overage: %w", err)
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// MarkInvoiced records that pending overages were invoiced on an invoice
+func (r *APIOverageRepository) MarkInvoiced(ctx context.Context, ids []primitive.ObjectID, invoiceID primitive.ObjectID) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "status": models.APIOverageStatusPending},
+		bson.M{"$set": bson.M{
+			"status":    models.APIOverageStatusInvoiced,
+			"invoiceId": invoiceID,
+			"updatedAt": time.Now(),
+		}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark API overages invoiced: %w", err)
+	}
+	return nil
+}
+
+// EnsureIndexes creates necessary indexes
+func (r *APIOverageRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "month", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "status", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
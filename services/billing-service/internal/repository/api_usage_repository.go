@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIUsageTotal is the number of API calls a user made with all their keys in a month,
+// and the plan the month is billed by
+type APIUsageTotal struct {
+	UserID primitive.ObjectID `bson:"_id"`
+	PlanID primitive.ObjectID `bson:"planId"`
+	Calls  int64              `bson:"calls"`
+}
+
+// APIUsageRepository stores the monthly API call counts of API keys
+type APIUsageRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIUsageRepository(db *mongo.Database) *APIUsageRepository {
+	return &APIUsageRepository{
+		collection: db.Collection("api_usage"),
+	}
+}
+
+// Add adds calls to the count of an API key in the month starting at month, creating it
+// if needed, and records planID as the plan the month is billed by
+func (r *APIUsageRepository) Add(ctx context.Context, userID, keyID, planID primitive.ObjectID, month time.Time, calls int64) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"keyId": keyID, "month": month},
+		bson.M{
+			"$inc": bson.M{"calls": calls},
+			"$set": bson.M{"userId": userID, "planId": planID, "updatedAt": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add API usage: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns the counts of a user's keys in the month starting at month
+func (r *APIUsageRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, month time.Time) ([]models.APIUsage, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": userID, "month": month})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API usage: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var usage []models.APIUsage
+	if err := cursor.All(ctx, &usage); err != nil {
+		return nil, fmt.Errorf("failed to decode API usage: %w", err)
+	}
+	return usage, nil
+}
+
+// ListMonthTotals returns up to limit users' total calls in the month starting at month,
+// after the given user ID in ID order. The plan of each total is the one its calls were
+// last counted with.
+func (r *APIUsageRepository) ListMonthTotals(ctx context.Context, month time.Time, after primitive.ObjectID, limit int64) ([]APIUsageTotal, error) {
+	match := bson.M{"month": month}
+	if !after.IsZero() {
+		match["userId"] = bson.M{"$gt": after}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "updatedAt", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$userId",
+			"calls":  bson.M{"$sum": "$calls"},
+			"planId": bson.M{"$last": "$planId"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum API usage: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var totals []APIUsageTotal
+	if err := cursor.All(ctx, &totals); err != nil {
+		return nil, fmt.Errorf("failed to decode API usage totals: %w", err)
+	}
+	return totals, nil
+}
+
+// EnsureIndexes creates necessary indexes
+func (r *APIUsageRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "keyId", Value: 1}, {Key: "month", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "month", Value: 1}, {Key: "userId", Value: 1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditEventFilter selects audit events. Zero fields do not filter.
+type AuditEventFilter struct {
+	UserID         primitive.ObjectID
+	OrgID          primitive.ObjectID
+	SubscriptionID primitive.ObjectID
+	InvoiceID      primitive.ObjectID
+	PlanID         primitive.ObjectID
+	ActorID        primitive.ObjectID
+	Types          []models.AuditEventType
+	Start          time.Time
+	End            time.Time
+	// Before continues a listing after the event with this ID
+	Before primitive.ObjectID
+	Limit  int64
+}
+
+// AuditEventRepository stores the billing audit log. Events are only ever inserted.
+type AuditEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditEventRepository(db *mongo.Database) *AuditEventRepository {
+	return &AuditEventRepository{
+		collection: db.Collection("billing_audit_events"),
+	}
+}
+
+// Create records an audit event
+func (r *AuditEventRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = time.Now()
+
+	if _, err := r.collection.InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+	return nil
+}
+
+// List returns the events matching filter, newest first
+func (r *AuditEventRepository) List(ctx context.Context, filter AuditEventFilter) ([]models.AuditEvent, error) {
+	query := bson.M{}
+	for field, id := range map[string]primitive.ObjectID{
+		"userId":         filter.UserID,
+		"orgId":          filter.OrgID,
+		"subscriptionId": filter.SubscriptionID,
+		"invoiceId":      filter.InvoiceID,
+		"planId":         filter.PlanID,
+		"actorId":        filter.ActorID,
+	} {
+		if !id.IsZero() {
+			query[field] = id
+		}
+	}
+	if len(filter.Types) > 0 {
+		query["type"] = bson.M{"$in": filter.Types}
+	}
+
+	createdAt := bson.M{}
+	if !filter.Start.IsZero() {
+		createdAt["$gte"] = filter.Start
+	}
+	if !filter.End.IsZero() {
+		createdAt["$lt"] = filter.End
+	}
+	if len(createdAt) > 0 {
+		query["createdAt"] = createdAt
+	}
+
+	if !filter.Before.IsZero() {
+		query["_id"] = bson.M{"$lt": filter.Before}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(filter.Limit)
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []models.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode audit events: %w", err)
+	}
+	return events, nil
+}
+
+// EnsureIndexes creates necessary indexes
+func (r *AuditEventRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "orgId", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "invoiceId", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "planId", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "type", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "createdAt", Value: 1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrInvoiceNotFound is returned when an invoice does not exist
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	// ErrInvoiceExists is returned when a transaction has already been invoiced
+	ErrInvoiceExists = errors.New("invoice already exists for transaction")
+)
+
+// invoiceCounterID identifies the invoice number sequence in the counters collection
+const invoiceCounterID = "invoice_number"
+
+type InvoiceRepository struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+func NewInvoiceRepository(db *mongo.Database) *InvoiceRepository {
+	return &InvoiceRepository{
+		collection: db.Collection("invoices"),
+		counters:   db.Collection("counters"),
+	}
+}
+
+// Create stores a new invoice and assigns it the next invoice number. Each transaction
+// is invoiced once; creating a second invoice for it returns ErrInvoiceExists.
+func (r *InvoiceRepository) Create(ctx context.Context, invoice *models.Invoice) error {
+	seq, err := r.nextNumber(ctx)
+	if err != nil {
+		return err
+	}
+
+	invoice.ID = primitive.NewObjectID()
+	invoice.Number = fmt.Sprintf("INV-%06d", seq)
+	invoice.CreatedAt = time.Now()
+
+	if _, err := r.collection.InsertOne(ctx, invoice); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrInvoiceExists
+		}
+		return fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	return nil
+}
+
+// nextNumber returns the next value of the invoice number sequence
+func (r *InvoiceRepository) nextNumber(ctx context.Context) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := r.counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": invoiceCounterID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		opts,
+	).Decode(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get next invoice number: %w", err)
+	}
+	return counter.Seq, nil
+}
+
+// FindByID finds an invoice by ID
+func (r *InvoiceRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&invoice)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, fmt.Errorf("failed to find invoice: %w", err)
+	}
+	return &invoice, nil
+}
+
+// AddRefund records a refund of an invoice's payment, marking the invoice refunded once
+// its whole total is, and returns the updated invoice
+func (r *InvoiceRepository) AddRefund(ctx context.Context, id primitive.ObjectID, refund models.InvoiceRefund) (*models.Invoice, error) {
+	// The refund is added in a pipeline so that the status follows from the refunded
+	// amount, however many refunds are recorded at once
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"refunds": bson.M{"$concatArrays": bson.A{
+				bson.M{"$ifNull": bson.A{"$refunds", bson.A{}}},
+				bson.A{bson.M{"$literal": refund}},
+			}},
+			"amountRefunded": bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$amountRefunded", 0}},
+				refund.Amount,
+			}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"status": bson.M{"$cond": bson.A{
+				bson.M{"$gte": bson.A{"$amountRefunded", "$total"}},
+				models.InvoiceStatusRefunded,
+				models.InvoiceStatusPartiallyRefunded,
+			}},
+		}}},
+	}
+
+	var invoice models.Invoice
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&invoice)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, fmt.Errorf("failed to record refund: %w", err)
+	}
+	return &invoice, nil
+}
+
+// ListByUserID returns a user's invoices, newest first, and their total count
+func (r *InvoiceRepository) ListByUserID(ctx context.Context, userID primitive.ObjectID, limit, offset int64) ([]models.Invoice, int64, error) {
+	filter := bson.M{"userId": userID}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count invoices: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "issuedAt", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list invoices: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	invoices := []models.Invoice{}
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode invoices: %w", err)
+	}
+
+	return invoices, total, nil
+}
+
+// EnsureIndexes creates necessary indexes
+func (r *InvoiceRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "userId", Value: 1},
+				{Key: "issuedAt", Value: -1},
+			},
+		},
+		{
+			Keys:    bson.D{{Key: "transactionId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "number", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,8 +10,12 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrPlanNotFound is returned when a plan does not exist
+var ErrPlanNotFound = errors.New("plan not found")
+
 type PlanRepository struct {
 	collection *mongo.Collection
 }
@@ -35,9 +40,21 @@ func (r *PlanRepository) Create(ctx context.Context, plan *models.Plan) error {
 	return nil
 }
 
-// FindAll returns all plans
+// catalogOrder sorts plans in the order of the plan catalog
+var catalogOrder = bson.D{{Key: "sortOrder", Value: 1}, {Key: "pricePerMonth", Value: 1}, {Key: "_id", Value: 1}}
+
+// FindAll returns all plans, including archived ones, in catalog order
 func (r *PlanRepository) FindAll(ctx context.Context) ([]models.Plan, error) {
-	cursor, err := r.collection.Find(ctx, bson.M{})
+	return r.find(ctx, bson.M{})
+}
+
+// FindAvailable returns the plans that are offered, in catalog order
+func (r *PlanRepository) FindAvailable(ctx context.Context) ([]models.Plan, error) {
+	return r.find(ctx, bson.M{"archived": bson.M{"$ne": true}})
+}
+
+func (r *PlanRepository) find(ctx context.Context, filter bson.M) ([]models.Plan, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(catalogOrder))
 	if err != nil {
 		return nil, fmt.Errorf("failed to find plans: %w", err)
 	}
@@ -57,7 +74,7 @@ func (r *PlanRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*
 	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&plan)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("plan not found")
+			return nil, ErrPlanNotFound
 		}
 		return nil, fmt.Errorf("failed to find plan: %w", err)
 	}
@@ -71,7 +88,7 @@ func (r *PlanRepository) FindByName(ctx context.Context, name string) (*models.P
 	err := r.collection.FindOne(ctx, bson.M{"name": name}).Decode(&plan)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("plan not found")
+			return nil, ErrPlanNotFound
 		}
 		return nil, fmt.Errorf("failed to find plan: %w", err)
 	}
@@ -85,6 +102,23 @@ func (r *PlanRepository) Update(ctx context.Context, plan *models.Plan) error {
 
 	filter := bson.M{"_id": plan.ID}
 	update := bson.M{"$set": plan}
+	// Fields left out of the plan's document when empty are removed by unsetting them
+	unset := bson.M{}
+	if plan.TrialDays == 0 {
+		unset["trialDays"] = ""
+	}
+	if len(plan.Prices) == 0 {
+		unset["prices"] = ""
+	}
+	if plan.APICallsIncluded == 0 {
+		unset["apiCallsIncluded"] = ""
+	}
+	if plan.APIOveragePer1000 == 0 {
+		unset["apiOveragePer1000"] = ""
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
@@ -92,12 +126,60 @@ func (r *PlanRepository) Update(ctx context.Context, plan *models.Plan) error {
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("plan not found")
+		return ErrPlanNotFound
 	}
 
 	return nil
 }
 
+// SetArchived archives a plan, or offers an archived plan again
+func (r *PlanRepository) SetArchived(ctx context.Context, id primitive.ObjectID, archived bool) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"archived": archived, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to archive plan: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrPlanNotFound
+	}
+
+	return nil
+}
+
+// ClearPopular unmarks every plan but the one with ID except as popular
+func (r *PlanRepository) ClearPopular(ctx context.Context, except primitive.ObjectID) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$ne": except}, "isPopular": true},
+		bson.M{"$set": bson.M{"isPopular": false, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to unmark popular plans: %w", err)
+	}
+	return nil
+}
+
+// Reorder places plans in the catalog in the order of ids
+func (r *PlanRepository) Reorder(ctx context.Context, ids []primitive.ObjectID) error {
+	now := time.Now()
+	writes := make([]mongo.WriteModel, 0, len(ids))
+	for i, id := range ids {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$set": bson.M{"sortOrder": i, "updatedAt": now}}))
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+
+	if _, err := r.collection.BulkWrite(ctx, writes); err != nil {
+		return fmt.Errorf("failed to reorder plans: %w", err)
+	}
+	return nil
+}
+
 // Delete deletes a plan
 func (r *PlanRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
 	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
@@ -106,7 +188,7 @@ func (r *PlanRepository) Delete(ctx context.Context, id primitive.ObjectID) erro
 	}
 
 	if result.DeletedCount == 0 {
-		return fmt.Errorf("plan not found")
+		return ErrPlanNotFound
 	}
 
 	return nil
@@ -121,7 +203,8 @@ func (r *PlanRepository) InitializeDefaultPlans(ctx context.Context) error {
 	}
 
 	if count > 0 {
-		return nil // Plans already exist
+		// Plans already exist, but may predate yearly prices and newer default plans
+		return r.backfillDefaultPlans(ctx)
 	}
 
 	// Create default plans
@@ -135,3 +218,77 @@ func (r *PlanRepository) InitializeDefaultPlans(ctx context.Context) error {
 	return nil
 }
 
+// backfillDefaultPlans creates default plans added since the plans were seeded, and sets
+// the yearly price, catalog position, prices in other currencies and API access of
+// default plans stored before plans had them.
+// Custom plans are left to be billed twelve monthly prices a year. Archived default plans
+// still exist, so they are not created again.
+func (r *PlanRepository) backfillDefaultPlans(ctx context.Context) error {
+	defaultPlans := models.GetDefaultPlans()
+	for i := range defaultPlans {
+		plan := &defaultPlans[i]
+		count, err := r.collection.CountDocuments(ctx, bson.M{"name": plan.Name})
+		if err != nil {
+			return fmt.Errorf("failed to count plans: %w", err)
+		}
+		if count == 0 {
+			if err := r.Create(ctx, plan); err != nil {
+				return fmt.Errorf("failed to create default plan %s: %w", plan.Name, err)
+			}
+			continue
+		}
+
+		filter := bson.M{"name": plan.Name, "pricePerYear": bson.M{"$exists": false}}
+		update := bson.M{"$set": bson.M{"pricePerYear": plan.PricePerYear, "updatedAt": time.Now()}}
+		if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+			return fmt.Errorf("failed to backfill yearly price of plan %s: %w", plan.Name, err)
+		}
+
+		filter = bson.M{"name": plan.Name, "sortOrder": bson.M{"$exists": false}}
+		update = bson.M{"$set": bson.M{"sortOrder": plan.SortOrder}}
+		if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+			return fmt.Errorf("failed to backfill catalog position of plan %s: %w", plan.Name, err)
+		}
+
+		if len(plan.Prices) > 0 {
+			filter = bson.M{"name": plan.Name, "prices": bson.M{"$exists": false}}
+			update = bson.M{"$set": bson.M{"prices": plan.Prices, "updatedAt": time.Now()}}
+			if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+				return fmt.Errorf("failed to backfill currency prices of plan %s: %w", plan.Name, err)
+			}
+		}
+
+		if plan.HasAPIAccess() {
+			if err := r.backfillAPIAccess(ctx, plan); err != nil {
+				return fmt.Errorf("failed to backfill API access of plan %s: %w", plan.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// backfillAPIAccess sets the included API calls and overage prices of a default plan
+// stored before plans had API access. Overage prices are only set in the currencies the
+// stored plan is priced in, and before the included calls that mark it backfilled.
+func (r *PlanRepository) backfillAPIAccess(ctx context.Context, plan *models.Plan) error {
+	for currency, price := range plan.Prices {
+		filter := bson.M{
+			"name":               plan.Name,
+			"apiCallsIncluded":   bson.M{"$exists": false},
+			"prices." + currency: bson.M{"$exists": true},
+		}
+		update := bson.M{"$set": bson.M{"prices." + currency + ".apiOveragePer1000": price.APIOveragePer1000}}
+		if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+			return err
+		}
+	}
+
+	filter := bson.M{"name": plan.Name, "apiCallsIncluded": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{
+		"apiCallsIncluded":  plan.APICallsIncluded,
+		"apiOveragePer1000": plan.APIOveragePer1000,
+		"updatedAt":         time.Now(),
+	}}
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
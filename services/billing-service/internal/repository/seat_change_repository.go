@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrSeatChangeNotFound is returned when a seat change does not exist
+var ErrSeatChangeNotFound = errors.New("seat change not found")
+
+type SeatChangeRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSeatChangeRepository(db *mongo.Database) *SeatChangeRepository {
+	return &SeatChangeRepository{
+		collection: db.Collection("seat_changes"),
+	}
+}
+
+// Create creates a new seat change
+func (r *SeatChangeRepository) Create(ctx context.Context, change *models.SeatChange) error {
+	change.ID = primitive.NewObjectID()
+	change.CreatedAt = time.Now()
+	change.UpdatedAt = time.Now()
+
+	if _, err := r.collection.InsertOne(ctx, change); err != nil {
+		return fmt.Errorf("failed to create seat change: %w", err)
+	}
+	return nil
+}
+
+// FindByID finds a seat change by ID
+func (r *SeatChangeRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.SeatChange, error) {
+	var change models.SeatChange
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&change)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSeatChangeNotFound
+		}
+		return nil, fmt.Errorf("failed to find seat change: %w", err)
+	}
+	return &change, nil
+}
+
+// SetSessionID records the payment session or order a seat change is paid through
+func (r *SeatChangeRepository) SetSessionID(ctx context.Context, id primitive.ObjectID, sessionID string) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"sessionId": sessionID, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update seat change: %w", err)
+	}
+	return nil
+}
+
+// Resolve moves a pending seat change to status, reporting false if it was no longer
+// pending. Only one of several concurrent deliveries of a payment event applies it.
+func (r *SeatChangeRepository) Resolve(ctx context.Context, id primitive.ObjectID, status models.SeatChangeStatus, transactionID string) (bool, error) {
+	set := bson.M{"status": status, "updatedAt": time.Now()}
+	if transactionID != "" {
+		set["transactionId"] = transactionID
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.SeatChangeStatusPending},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update seat change: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// Reopen moves a seat change resolved to status back to pending, for when resolving it
+// failed halfway and the payment event will be delivered again
+func (r *SeatChangeRepository) Reopen(ctx context.Context, id primitive.ObjectID, status models.SeatChangeStatus) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": status},
+		bson.M{
+			"$set":   bson.M{"status": models.SeatChangeStatusPending, "updatedAt": time.Now()},
+			"$unset": bson.M{"transactionId": ""},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reopen seat change: %w", err)
+	}
+	return nil
+}
@@ -2,15 +2,29 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrSubscriptionNotFound is returned when a subscription does not exist
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// ErrInsufficientSeatCredit is returned when a seat change spends more seat credit than
+// the subscription has left
+var ErrInsufficientSeatCredit = errors.New("insufficient seat credit")
+
+// currentStatus matches the subscriptions that give their users their plan: active ones
+// and ones in their free trial
+var currentStatus = bson.M{"$in": bson.A{models.SubscriptionStatusActive, models.SubscriptionStatusTrialing}}
+
 type SubscriptionRepository struct {
 	collection *mongo.Collection
 }
@@ -21,8 +35,11 @@ func NewSubscriptionRepository(db *mongo.Database) *SubscriptionRepository {
 	}
 }
 
-// Create creates a new subscription
+// Create creates a new subscription in the tenant ctx is served for
 func (r *SubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
+	if id, ok := tenant.FromContext(ctx); ok {
+		subscription.TenantID = id
+	}
 	subscription.CreatedAt = time.Now()
 	subscription.UpdatedAt = time.Now()
 
@@ -61,7 +78,22 @@ func (r *SubscriptionRepository) FindBySessionID(ctx context.Context, sessionID
 	err := r.collection.FindOne(ctx, bson.M{"sessionId": sessionID}).Decode(&subscription)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("subscription not found")
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("failed to find subscription: %w", err)
+	}
+
+	return &subscription, nil
+}
+
+// FindByProviderSubscriptionID finds a subscription by the ID of its recurring subscription
+// at the payment provider
+func (r *SubscriptionRepository) FindByProviderSubscriptionID(ctx context.Context, providerSubscriptionID string) (*models.Subscription, error) {
+	var subscription models.Subscription
+	err := r.collection.FindOne(ctx, bson.M{"providerSubscriptionId": providerSubscriptionID}).Decode(&subscription)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSubscriptionNotFound
 		}
 		return nil, fmt.Errorf("failed to find subscription: %w", err)
 	}
@@ -82,7 +114,7 @@ func (r *SubscriptionRepository) Update(ctx context.Context, subscription *model
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("subscription not found")
+		return ErrSubscriptionNotFound
 	}
 
 	return nil
@@ -104,7 +136,7 @@ func (r *SubscriptionRepository) UpdateStatus(ctx context.Context, subscriptionI
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("subscription not found")
+		return ErrSubscriptionNotFound
 	}
 
 	return nil
@@ -147,24 +179,52 @@ func (r *SubscriptionRepository) EnsureIndexes(ctx context.Context) error {
 				{Key: "status", Value: 1},
 			},
 		},
+		{
+			Keys: bson.D{
+				{Key: "planId", Value: 1},
+				{Key: "status", Value: 1},
+				{Key: "userId", Value: 1},
+			},
+		},
 		{
 			Keys: bson.D{{Key: "sessionId", Value: 1}},
 		},
 		{
 			Keys: bson.D{{Key: "transactionId", Value: 1}},
 		},
+		{
+			Keys:    bson.D{{Key: "providerSubscriptionId", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "orgId", Value: 1},
+				{Key: "status", Value: 1},
+			},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "dunning.nextRetryAt", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "trialEnd", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
 	}
 
 	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
 	return err
 }
 
-// FindActiveByUserID finds the active subscription for a user
+// FindActiveByUserID finds the active personal subscription for a user. Team
+// subscriptions the user bought for an organization are not theirs.
 func (r *SubscriptionRepository) FindActiveByUserID(ctx context.Context, userID primitive.ObjectID) (*models.Subscription, error) {
 	var subscription models.Subscription
 	err := r.collection.FindOne(ctx, bson.M{
 		"userId": userID,
-		"status": models.SubscriptionStatusActive,
+		"orgId":  bson.M{"$exists": false},
+		"status": currentStatus,
 	}).Decode(&subscription)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -175,6 +235,88 @@ func (r *SubscriptionRepository) FindActiveByUserID(ctx context.Context, userID
 	return &subscription, nil
 }
 
+// ListActiveUserIDsByPlan returns up to limit IDs of users with an active subscription
+// to a plan after the given user ID, in ID order
+func (r *SubscriptionRepository) ListActiveUserIDsByPlan(ctx context.Context, planID, after primitive.ObjectID, limit int64) ([]primitive.ObjectID, error) {
+	filter := bson.M{
+		"planId": planID,
+		"status": currentStatus,
+	}
+	if !after.IsZero() {
+		filter["userId"] = bson.M{"$gt": after}
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"userId": 1}).
+		SetSort(bson.D{{Key: "userId", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscribers: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		UserID primitive.ObjectID `bson:"userId"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode subscribers: %w", err)
+	}
+
+	ids := make([]primitive.ObjectID, len(results))
+	for i, result := range results {
+		ids[i] = result.UserID
+	}
+	return ids, nil
+}
+
+// SubscriptionGroup counts the current subscriptions to a plan with a status, billing
+// interval and currency, and the seats they pay for
+type SubscriptionGroup struct {
+	PlanID          primitive.ObjectID        `bson:"planId"`
+	Status          models.SubscriptionStatus `bson:"status"`
+	BillingInterval models.BillingInterval    `bson:"billingInterval"`
+	Currency        string                    `bson:"currency"`
+	Subscriptions   int64                     `bson:"subscriptions"`
+	Seats           int64                     `bson:"seats"`
+}
+
+// GroupCurrent counts the current subscriptions of the tenant ctx is served for by plan,
+// status, billing interval and currency
+func (r *SubscriptionRepository) GroupCurrent(ctx context.Context) ([]SubscriptionGroup, error) {
+	match := bson.M{"status": currentStatus}
+	if id, ok := tenant.FromContext(ctx); ok {
+		match["tenantId"] = tenant.Match(id)
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"planId":          "$planId",
+				"status":          "$status",
+				"billingInterval": "$billingInterval",
+				"currency":        "$currency",
+			},
+			"subscriptions": bson.M{"$sum": 1},
+			"seats":         bson.M{"$sum": "$seats"},
+		}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": bson.M{"$mergeObjects": bson.A{"$_id", "$$ROOT"}}}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to group subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var groups []SubscriptionGroup
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode subscription groups: %w", err)
+	}
+	return groups, nil
+}
+
 // FindByID finds a subscription by ID
 func (r *SubscriptionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Subscription, error) {
 	var subscription models.Subscription
@@ -195,6 +337,7 @@ func (r *SubscriptionRepository) Cancel(ctx context.Context, id primitive.Object
 		bson.M{
 			"$set": bson.M{
 				"status":    models.SubscriptionStatusCancelled,
+				"dunning":   nil,
 				"updatedAt": time.Now(),
 			},
 		},
@@ -204,3 +347,189 @@ func (r *SubscriptionRepository) Cancel(ctx context.Context, id primitive.Object
 	}
 	return nil
 }
+
+// ListDunningDue returns up to limit active subscriptions with a failed payment whose
+// next dunning step is due, oldest first
+func (r *SubscriptionRepository) ListDunningDue(ctx context.Context, now time.Time, limit int64) ([]models.Subscription, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "dunning.nextRetryAt", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"status":              models.SubscriptionStatusActive,
+		"dunning.nextRetryAt": bson.M{"$lte": now},
+	}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list past due subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subscriptions []models.Subscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to decode past due subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// ClaimDunningStep postpones the due dunning step of a subscription to until, so that
+// only one instance processes it. It reports false if the step was already claimed or
+// the subscription has left dunning.
+func (r *SubscriptionRepository) ClaimDunningStep(ctx context.Context, id primitive.ObjectID, due, until time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"_id":                 id,
+			"status":              models.SubscriptionStatusActive,
+			"dunning.nextRetryAt": due,
+		},
+		bson.M{"$set": bson.M{"dunning.nextRetryAt": until}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim dunning step: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// HasTrialed reports whether a user has started a free trial before
+func (r *SubscriptionRepository) HasTrialed(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{
+		"userId":   userID,
+		"trialEnd": bson.M{"$exists": true},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to check previous trials: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ListTrialsEndingBefore returns up to limit trialing subscriptions whose trial ends
+// before the given time, soonest first. Only those whose user wasn't reminded yet are
+// returned if unreminded is set.
+func (r *SubscriptionRepository) ListTrialsEndingBefore(ctx context.Context, before time.Time, unreminded bool, limit int64) ([]models.Subscription, error) {
+	filter := bson.M{
+		"status":   models.SubscriptionStatusTrialing,
+		"trialEnd": bson.M{"$lte": before},
+	}
+	if unreminded {
+		filter["trialReminded"] = bson.M{"$ne": true}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "trialEnd", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trials: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subscriptions []models.Subscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to decode trials: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// ClaimTrialReminder marks the user of a trialing subscription as reminded of the end of
+// the trial. It reports false if they already were, so that only one instance sends it.
+func (r *SubscriptionRepository) ClaimTrialReminder(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"_id":           id,
+			"status":        models.SubscriptionStatusTrialing,
+			"trialReminded": bson.M{"$ne": true},
+		},
+		bson.M{"$set": bson.M{"trialReminded": true, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim trial reminder: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// ExpireTrial expires a trialing subscription that wasn't converted to a paid one. It
+// reports false if the subscription has left its trial in the meantime.
+func (r *SubscriptionRepository) ExpireTrial(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	now := time.Now()
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"_id":    id,
+			"status": models.SubscriptionStatusTrialing,
+		},
+		bson.M{"$set": bson.M{
+			"status":        models.SubscriptionStatusExpired,
+			"paymentStatus": models.PaymentStatusFailed,
+			"endDate":       now,
+			"updatedAt":     now,
+		}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to expire trial: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// FindActiveByOrgIDs finds the active team subscriptions of organizations
+func (r *SubscriptionRepository) FindActiveByOrgIDs(ctx context.Context, orgIDs []primitive.ObjectID) ([]models.Subscription, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"orgId":  bson.M{"$in": orgIDs},
+		"status": currentStatus,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find team subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subscriptions []models.Subscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to decode team subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// FindActiveByOrgID finds the active team subscription of an organization
+func (r *SubscriptionRepository) FindActiveByOrgID(ctx context.Context, orgID primitive.ObjectID) (*models.Subscription, error) {
+	var subscription models.Subscription
+	err := r.collection.FindOne(ctx, bson.M{
+		"orgId":  orgID,
+		"status": currentStatus,
+	}).Decode(&subscription)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // No active subscription
+		}
+		return nil, fmt.Errorf("failed to find team subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// ChangeSeats adds seatsDelta seats and creditDelta US cents of seat credit to a team
+// subscription. Seats and credit are changed atomically so concurrent changes add up,
+// and credit is only spent while it lasts: a negative creditDelta larger than the credit
+// left fails with ErrInsufficientSeatCredit.
+func (r *SubscriptionRepository) ChangeSeats(ctx context.Context, id primitive.ObjectID, seatsDelta int, creditDelta int64) (*models.Subscription, error) {
+	filter := bson.M{"_id": id}
+	if creditDelta < 0 {
+		filter["seatCredit"] = bson.M{"$gte": -creditDelta}
+	}
+
+	var subscription models.Subscription
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx,
+		filter,
+		bson.M{
+			"$inc": bson.M{"seats": seatsDelta, "seatCredit": creditDelta},
+			"$set": bson.M{"updatedAt": time.Now()},
+		},
+		opts,
+	).Decode(&subscription)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			if creditDelta < 0 {
+				return nil, ErrInsufficientSeatCredit
+			}
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("failed to change seats: %w", err)
+	}
+	return &subscription, nil
+}
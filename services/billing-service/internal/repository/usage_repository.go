@@ -12,13 +12,20 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// usageEventRetention is how long applied usage events are remembered, which bounds how
+// late a redelivered event is still recognized
+const usageEventRetention = 30 * 24 * time.Hour
+
 type UsageRepository struct {
 	collection *mongo.Collection
+	// events records the file events applied to usage, by event ID
+	events *mongo.Collection
 }
 
 func NewUsageRepository(db *mongo.Database) *UsageRepository {
 	return &UsageRepository{
 		collection: db.Collection("usage"),
+		events:     db.Collection("usage_events"),
 	}
 }
 
@@ -99,7 +106,14 @@ func (r *UsageRepository) EnsureIndexes(ctx context.Context) error {
 		},
 	}
 
-	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	_, err := r.events.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "appliedAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(usageEventRetention.Seconds())),
+	})
 	return err
 }
 
@@ -156,4 +170,88 @@ func (r *UsageRepository) DecrementUsage(ctx context.Context, userID primitive.O
 		return fmt.Errorf("failed to decrement usage: %w", err)
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// SumUsedBytes returns the storage used by a group of users together
+func (r *UsageRepository) SumUsedBytes(ctx context.Context, userIDs []primitive.ObjectID) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": bson.M{"$in": userIDs}}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "usedBytes": bson.M{"$sum": "$usedBytes"}}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum usage: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		UsedBytes int64 `bson:"usedBytes"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, fmt.Errorf("failed to decode usage sum: %w", err)
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0].UsedBytes, nil
+}
+
+// ApplyEvent adds bytesDelta to a user's usage for the file event eventID, creating the
+// usage record if needed. Usage doesn't drop below zero. Each event is applied once, and
+// false is reported for events that were already applied.
+func (r *UsageRepository) ApplyEvent(ctx context.Context, eventID string, userID primitive.ObjectID, bytesDelta int64) (bool, error) {
+	now := time.Now()
+	_, err := r.events.InsertOne(ctx, bson.M{
+		"_id":        eventID,
+		"userId":     userID,
+		"bytesDelta": bytesDelta,
+		"appliedAt":  now,
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to record usage event: %w", err)
+	}
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"usedBytes": bson.M{"$max": bson.A{0, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$usedBytes", 0}}, bytesDelta}}}},
+			"createdAt": bson.M{"$ifNull": bson.A{"$createdAt", now}},
+			"updatedAt": now,
+		}}},
+	}
+	_, err = r.collection.UpdateOne(ctx, bson.M{"userId": userID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		// Forget the event so that its redelivery is applied
+		if _, delErr := r.events.DeleteOne(ctx, bson.M{"_id": eventID}); delErr != nil {
+			return false, fmt.Errorf("failed to apply usage event: %w (and failed to forget it: %v)", err, delErr)
+		}
+		return false, fmt.Errorf("failed to apply usage event: %w", err)
+	}
+
+	return true, nil
+}
+
+// ClaimQuotaAlert records that a user is alerted at level in the billing period starting
+// at periodStart. It reports false if the user was already alerted at that level or a
+// higher one in the period, so that each alert is sent once per period.
+func (r *UsageRepository) ClaimQuotaAlert(ctx context.Context, userID primitive.ObjectID, level models.QuotaAlertLevel, periodStart time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"userId": userID,
+			"$or": bson.A{
+				bson.M{"alertPeriodStart": bson.M{"$ne": periodStart}},
+				bson.M{"alertLevel": bson.M{"$lt": level}},
+			},
+		},
+		bson.M{"$set": bson.M{
+			"alertLevel":       level,
+			"alertPeriodStart": periodStart,
+		}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim quota alert: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,1153 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/payment"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/service"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// userIDKey is the gin context key of the authenticated user's ID
+	userIDKey = "user_id"
+	// maxWebhookBodyBytes bounds the size of payment webhook bodies
+	maxWebhookBodyBytes = 1 << 20
+
+	defaultInvoicePageSize = 20
+	maxInvoicePageSize     = 100
+)
+
+// RestHandlers handles REST API endpoints
+type RestHandlers struct {
+	billingSvc *service.BillingService
+	invoiceSvc *service.InvoiceService
+	validator  *jwtauth.Validator
+	logger     *logrus.Logger
+
+	analyticsToken string
+}
+
+// NewRestHandlers creates new REST handlers
+func NewRestHandlers(billingSvc *service.BillingService, invoiceSvc *service.InvoiceService, validator *jwtauth.Validator, logger *logrus.Logger) *RestHandlers {
+	return &RestHandlers{
+		billingSvc: billingSvc,
+		invoiceSvc: invoiceSvc,
+		validator:  validator,
+		logger:     logger,
+	}
+}
+
+// SetAnalyticsToken serves the revenue statistics of the admin analytics to operators
+// holding token. Without it they aren't served.
+func (h *RestHandlers) SetAnalyticsToken(token string) {
+	h.analyticsToken = token
+}
+
+// ListPlans handles GET /api/v1/billing/plans. The currency of the user's locale is
+// suggested for showing prices in.
+func (h *RestHandlers) ListPlans(c *gin.Context) {
+	plans, err := h.billingSvc.ListPlans(c.Request.Context())
+	if err != nil {
+		h.writeError(c, err, "Failed to get plans")
+		return
+	}
+
+	currency := models.CurrencyForLocale(c.GetHeader("Accept-Language"))
+	if currency == "" {
+		currency = models.CurrencyUSD
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plans": plansResponse(plans), "currency": currency})
+}
+
+// GetPlan handles GET /api/v1/billing/plans/:id
+func (h *RestHandlers) GetPlan(c *gin.Context) {
+	plan, err := h.billingSvc.GetPlan(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "Failed to get plan")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plan": planResponse(plan)})
+}
+
+// GetSubscription handles GET /api/v1/billing/subscription
+func (h *RestHandlers) GetSubscription(c *gin.Context) {
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	subscription, plan, err := h.billingSvc.GetUserSubscription(c.Request.Context(), userID)
+	if err != nil {
+		h.writeError(c, err, "Failed to get subscription")
+		return
+	}
+
+	response := gin.H{
+		"has_active_subscription": subscription != nil,
+		"plan":                    planResponse(plan),
+	}
+	if subscription != nil {
+		response["subscription"] = subscriptionResponse(subscription, plan)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetUsage handles GET /api/v1/billing/usage
+func (h *RestHandlers) GetUsage(c *gin.Context) {
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	usage, err := h.billingSvc.GetUsage(c.Request.Context(), userID)
+	if err != nil {
+		h.writeError(c, err, "Failed to get usage")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"usage": gin.H{
+			"user_id":           usage.UserID,
+			"plan_name":         usage.PlanName,
+			"quota_bytes":       usage.QuotaBytes,
+			"used_bytes":        usage.UsedBytes,
+			"quota_gb":          usage.QuotaGB,
+			"used_gb":           usage.UsedGB,
+			"percent_used":      usage.PercentUsed,
+			"upgrade_available": usage.UpgradeAvailable,
+			"quota_exceeded":    usage.QuotaExceeded,
+			"currency":          usage.Currency,
+			"billing_interval":  usage.BillingInterval,
+			"plan_price":        usage.PlanPrice,
+			"org_id":            usage.OrgID,
+			"seats":             usage.Seats,
+		},
+	})
+}
+
+// Subscribe handles POST /api/v1/billing/subscribe. Without a currency the user is
+// billed in the currency of their Accept-Language locale, if the plan is priced in it.
+// Businesses give their VAT or GST ID in the billing details.
+func (h *RestHandlers) Subscribe(c *gin.Context) {
+	var req struct {
+		UserID          string                 `json:"user_id"`
+		PlanID          string                 `json:"plan_id" binding:"required"`
+		PaymentMethod   string                 `json:"payment_method" binding:"required"`
+		BillingInterval string                 `json:"billing_interval"`
+		Currency        string                 `json:"currency"`
+		OrgID           string                 `json:"org_id"`
+		Seats           int                    `json:"seats"`
+		BillingDetails  *billingDetailsPayload `json:"billing_details"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "plan_id and payment_method are required")
+		return
+	}
+
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	subscription, checkout, err := h.billingSvc.CreateSubscription(c.Request.Context(), userID, req.PlanID, req.PaymentMethod, req.BillingInterval, req.Currency, c.GetHeader("Accept-Language"), req.OrgID, req.Seats, req.BillingDetails.toModel())
+	if err != nil {
+		h.writeError(c, err, "Failed to create subscription")
+		return
+	}
+
+	plan, err := h.billingSvc.GetPlan(c.Request.Context(), req.PlanID)
+	if err != nil {
+		h.logger.WithError(err).WithField("plan_id", req.PlanID).Warn("Failed to get plan of new subscription")
+	}
+
+	response := gin.H{
+		"subscription":  subscriptionResponse(subscription, plan),
+		"payment_url":   checkout.PaymentURL,
+		"session_id":    checkout.SessionID,
+		"client_secret": "",
+	}
+	if checkout.Razorpay != nil {
+		response["razorpay_checkout"] = razorpayCheckoutResponse(checkout.Razorpay)
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// CancelSubscription handles POST /api/v1/billing/subscription/cancel
+func (h *RestHandlers) CancelSubscription(c *gin.Context) {
+	var req struct {
+		UserID         string `json:"user_id"`
+		SubscriptionID string `json:"subscription_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "subscription_id is required")
+		return
+	}
+
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	if err := h.billingSvc.CancelSubscription(c.Request.Context(), userID, req.SubscriptionID); err != nil {
+		h.writeError(c, err, "Failed to cancel subscription")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Subscription cancelled successfully",
+	})
+}
+
+// GetTeamSubscription handles GET /api/v1/billing/organizations/:org_id/subscription
+func (h *RestHandlers) GetTeamSubscription(c *gin.Context) {
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	team, err := h.billingSvc.GetTeamSubscription(c.Request.Context(), userID, c.Param("org_id"))
+	if err != nil {
+		h.writeError(c, err, "Failed to get team subscription")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subscription": subscriptionResponse(team.Subscription, team.Plan),
+		"members":      team.Members,
+		"quota_bytes":  team.QuotaBytes,
+		"used_bytes":   team.UsedBytes,
+		"seat_credit":  team.Subscription.SeatCredit,
+	})
+}
+
+// QuoteSeats handles GET /api/v1/billing/organizations/:org_id/seats/quote
+func (h *RestHandlers) QuoteSeats(c *gin.Context) {
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	seats, err := strconv.Atoi(c.Query("seats"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "seats is required")
+		return
+	}
+
+	quote, err := h.billingSvc.QuoteSeats(c.Request.Context(), userID, c.Param("org_id"), seats)
+	if err != nil {
+		h.writeError(c, err, "Failed to quote seats")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"quote": seatQuoteResponse(quote)})
+}
+
+// UpdateSeats handles PUT /api/v1/billing/organizations/:org_id/seats
+func (h *RestHandlers) UpdateSeats(c *gin.Context) {
+	var req struct {
+		UserID string `json:"user_id"`
+		Seats  int    `json:"seats" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "seats is required")
+		return
+	}
+
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	result, err := h.billingSvc.UpdateSeats(c.Request.Context(), userID, c.Param("org_id"), req.Seats)
+	if err != nil {
+		h.writeError(c, err, "Failed to update seats")
+		return
+	}
+
+	plan, err := h.billingSvc.GetPlan(c.Request.Context(), result.Subscription.PlanID.Hex())
+	if err != nil {
+		h.logger.WithError(err).WithField("plan_id", result.Subscription.PlanID.Hex()).Warn("Failed to get plan of team subscription")
+	}
+
+	response := gin.H{
+		"subscription": subscriptionResponse(result.Subscription, plan),
+		"quote":        seatQuoteResponse(result.Quote),
+	}
+	if result.Checkout != nil {
+		response["payment_url"] = result.Checkout.PaymentURL
+		response["session_id"] = result.Checkout.SessionID
+		if result.Checkout.Razorpay != nil {
+			response["razorpay_checkout"] = razorpayCheckoutResponse(result.Checkout.Razorpay)
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListInvoices handles GET /api/v1/billing/invoices
+func (h *RestHandlers) ListInvoices(c *gin.Context) {
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultInvoicePageSize)), 10, 64)
+	if err != nil || limit < 1 || limit > maxInvoicePageSize {
+		apierror.Abort(c, http.StatusBadRequest, "limit must be between 1 and 100")
+		return
+	}
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	if err != nil || offset < 0 {
+		apierror.Abort(c, http.StatusBadRequest, "offset must not be negative")
+		return
+	}
+
+	invoices, total, err := h.invoiceSvc.ListInvoices(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		h.writeError(c, err, "Failed to list invoices")
+		return
+	}
+
+	response := make([]gin.H, 0, len(invoices))
+	for i := range invoices {
+		response = append(response, invoiceResponse(&invoices[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invoices": response,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// GetInvoice handles GET /api/v1/billing/invoices/:id
+func (h *RestHandlers) GetInvoice(c *gin.Context) {
+	inv, err := h.invoiceSvc.GetInvoice(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "Failed to get invoice")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invoice": invoiceResponse(inv)})
+}
+
+// DownloadInvoice handles GET /api/v1/billing/invoices/:id/pdf
+func (h *RestHandlers) DownloadInvoice(c *gin.Context) {
+	inv, pdf, err := h.invoiceSvc.RenderInvoicePDF(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "Failed to render invoice")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", inv.Number+".pdf"))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// ListAPIKeys handles GET /api/v1/billing/api-keys
+func (h *RestHandlers) ListAPIKeys(c *gin.Context) {
+	keys, err := h.billingSvc.ListAPIKeys(c.Request.Context(), c.GetString(userIDKey))
+	if err != nil {
+		h.writeError(c, err, "Failed to list API keys")
+		return
+	}
+
+	response := make([]gin.H, 0, len(keys))
+	for i := range keys {
+		response = append(response, apiKeyResponse(&keys[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": response})
+}
+
+// CreateAPIKey handles POST /api/v1/billing/api-keys. The key is only in this response.
+func (h *RestHandlers) CreateAPIKey(c *gin.Context) {
+	var req struct {
+		Name            string `json:"name" binding:"required"`
+		RateLimit       int64  `json:"rate_limit"`
+		MonthlyTransfer int64  `json:"monthly_transfer"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	quotas := service.APIKeyQuotas{RateLimit: req.RateLimit, MonthlyTransfer: req.MonthlyTransfer}
+	key, rawKey, err := h.billingSvc.CreateAPIKey(c.Request.Context(), c.GetString(userIDKey), req.Name, quotas)
+	if err != nil {
+		h.writeError(c, err, "Failed to create API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": apiKeyResponse(key),
+		"key":     rawKey,
+	})
+}
+
+// RevokeAPIKey handles DELETE /api/v1/billing/api-keys/:id
+func (h *RestHandlers) RevokeAPIKey(c *gin.Context) {
+	if err := h.billingSvc.RevokeAPIKey(c.Request.Context(), c.GetString(userIDKey), c.Param("id")); err != nil {
+		h.writeError(c, err, "Failed to revoke API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// UpdateAPIKeyQuotas handles PATCH /api/v1/billing/api-keys/:id, setting the key's
+// request rate limit and monthly transfer quota. Zero leaves the gateway's limits.
+func (h *RestHandlers) UpdateAPIKeyQuotas(c *gin.Context) {
+	var req struct {
+		RateLimit       int64 `json:"rate_limit"`
+		MonthlyTransfer int64 `json:"monthly_transfer"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	quotas := service.APIKeyQuotas{RateLimit: req.RateLimit, MonthlyTransfer: req.MonthlyTransfer}
+	if err := h.billingSvc.SetAPIKeyQuotas(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), quotas); err != nil {
+		h.writeError(c, err, "Failed to update API key quotas")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key quotas updated"})
+}
+
+// GetAPIUsage handles GET /api/v1/billing/api-usage
+func (h *RestHandlers) GetAPIUsage(c *gin.Context) {
+	usage, err := h.billingSvc.GetAPIUsage(c.Request.Context(), c.GetString(userIDKey))
+	if err != nil {
+		h.writeError(c, err, "Failed to get API usage")
+		return
+	}
+
+	keys := make([]gin.H, 0, len(usage.Keys))
+	for i := range usage.Keys {
+		key := apiKeyResponse(&usage.Keys[i].Key)
+		key["calls"] = usage.Keys[i].Calls
+		keys = append(keys, key)
+	}
+	unbilled := make([]gin.H, 0, len(usage.Unbilled))
+	for _, overage := range usage.Unbilled {
+		unbilled = append(unbilled, gin.H{
+			"month":         overage.Month.Format("2006-01"),
+			"overage_calls": overage.OverageCalls,
+			"amount":        overage.Amount,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_usage": gin.H{
+			"user_id":           usage.UserID,
+			"plan_name":         usage.PlanName,
+			"api_access":        usage.APIAccess,
+			"month":             usage.Month.Format("2006-01"),
+			"included_calls":    usage.IncludedCalls,
+			"calls":             usage.Calls,
+			"overage_calls":     usage.OverageCalls,
+			"currency":          usage.Currency,
+			"overage_price":     usage.OveragePrice,
+			"estimated_overage": usage.EstimatedOverage,
+			"keys":              keys,
+			"unbilled":          unbilled,
+		},
+	})
+}
+
+// planRequest is a plan as created or updated by an admin. Prices are in USD, and in
+// other currencies by their code.
+type planRequest struct {
+	Name          string                  `json:"name" binding:"required"`
+	QuotaBytes    int64                   `json:"quota_bytes" binding:"required"`
+	PricePerMonth float64                 `json:"price_per_month"`
+	PricePerYear  float64                 `json:"price_per_year"`
+	Prices        map[string]pricePayload `json:"prices"`
+	Description   string                  `json:"description"`
+	Features      []string                `json:"features"`
+	IsPopular     bool                    `json:"is_popular"`
+	PerSeat       bool                    `json:"per_seat"`
+	TrialDays     int                     `json:"trial_days"`
+
+	APICallsIncluded  int64   `json:"api_calls_included"`
+	APIOveragePer1000 float64 `json:"api_overage_per_1000"`
+}
+
+// pricePayload is the price of a plan in a currency
+type pricePayload struct {
+	PricePerMonth     float64 `json:"price_per_month"`
+	PricePerYear      float64 `json:"price_per_year"`
+	APIOveragePer1000 float64 `json:"api_overage_per_1000"`
+}
+
+func (r *planRequest) input() service.PlanInput {
+	var prices map[string]models.PricePoint
+	if len(r.Prices) > 0 {
+		prices = make(map[string]models.PricePoint, len(r.Prices))
+		for currency, price := range r.Prices {
+			prices[currency] = models.PricePoint{PerMonth: price.PricePerMonth, PerYear: price.PricePerYear, APIOveragePer1000: price.APIOveragePer1000}
+		}
+	}
+
+	return service.PlanInput{
+		Name:          r.Name,
+		QuotaBytes:    r.QuotaBytes,
+		PricePerMonth: r.PricePerMonth,
+		PricePerYear:  r.PricePerYear,
+		Prices:        prices,
+		Description:   r.Description,
+		Features:      r.Features,
+		IsPopular:     r.IsPopular,
+		PerSeat:       r.PerSeat,
+		TrialDays:     r.TrialDays,
+
+		APICallsIncluded:  r.APICallsIncluded,
+		APIOveragePer1000: r.APIOveragePer1000,
+	}
+}
+
+// AdminListPlans handles GET /api/v1/billing/admin/plans
+func (h *RestHandlers) AdminListPlans(c *gin.Context) {
+	plans, err := h.billingSvc.ListAllPlans(c.Request.Context())
+	if err != nil {
+		h.writeError(c, err, "Failed to get plans")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plans": plansResponse(plans)})
+}
+
+// CreatePlan handles POST /api/v1/billing/admin/plans
+func (h *RestHandlers) CreatePlan(c *gin.Context) {
+	var req planRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "name and quota_bytes are required")
+		return
+	}
+
+	plan, err := h.billingSvc.CreatePlan(c.Request.Context(), c.GetString(userIDKey), req.input())
+	if err != nil {
+		h.writeError(c, err, "Failed to create plan")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"plan": planResponse(plan)})
+}
+
+// UpdatePlan handles PUT /api/v1/billing/admin/plans/:id
+func (h *RestHandlers) UpdatePlan(c *gin.Context) {
+	var req planRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "name and quota_bytes are required")
+		return
+	}
+
+	plan, err := h.billingSvc.UpdatePlan(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), req.input())
+	if err != nil {
+		h.writeError(c, err, "Failed to update plan")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plan": planResponse(plan)})
+}
+
+// ArchivePlan handles POST /api/v1/billing/admin/plans/:id/archive
+func (h *RestHandlers) ArchivePlan(c *gin.Context) {
+	h.setPlanArchived(c, true)
+}
+
+// UnarchivePlan handles POST /api/v1/billing/admin/plans/:id/unarchive
+func (h *RestHandlers) UnarchivePlan(c *gin.Context) {
+	h.setPlanArchived(c, false)
+}
+
+func (h *RestHandlers) setPlanArchived(c *gin.Context, archived bool) {
+	plan, err := h.billingSvc.SetPlanArchived(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), archived)
+	if err != nil {
+		h.writeError(c, err, "Failed to archive plan")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plan": planResponse(plan)})
+}
+
+// ReorderPlans handles PUT /api/v1/billing/admin/plans/order
+func (h *RestHandlers) ReorderPlans(c *gin.Context) {
+	var req struct {
+		PlanIDs []string `json:"plan_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "plan_ids is required")
+		return
+	}
+
+	plans, err := h.billingSvc.ReorderPlans(c.Request.Context(), c.GetString(userIDKey), req.PlanIDs)
+	if err != nil {
+		h.writeError(c, err, "Failed to reorder plans")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plans": plansResponse(plans)})
+}
+
+// RefundInvoice handles POST /api/v1/billing/admin/invoices/:id/refunds
+func (h *RestHandlers) RefundInvoice(c *gin.Context) {
+	var req struct {
+		Amount       int64  `json:"amount"`
+		Reason       string `json:"reason"`
+		AdjustPeriod bool   `json:"adjust_period"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid refund request")
+		return
+	}
+
+	inv, err := h.billingSvc.RefundInvoice(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), service.RefundInput{
+		Amount:       req.Amount,
+		Reason:       req.Reason,
+		AdjustPeriod: req.AdjustPeriod,
+	})
+	if err != nil {
+		h.writeError(c, err, "Failed to refund invoice")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invoice": invoiceResponse(inv)})
+}
+
+// ListAuditEvents handles GET /api/v1/billing/admin/audit-events. Events can be filtered
+// by user_id, org_id, subscription_id, invoice_id, plan_id, actor_id, comma-separated
+// types and an RFC 3339 start and end time, and are paged with page_size and page_token.
+func (h *RestHandlers) ListAuditEvents(c *gin.Context) {
+	query := service.AuditQuery{
+		UserID:         c.Query("user_id"),
+		OrgID:          c.Query("org_id"),
+		SubscriptionID: c.Query("subscription_id"),
+		InvoiceID:      c.Query("invoice_id"),
+		PlanID:         c.Query("plan_id"),
+		ActorID:        c.Query("actor_id"),
+		PageToken:      c.Query("page_token"),
+	}
+	if types := c.Query("types"); types != "" {
+		query.Types = strings.Split(types, ",")
+	}
+
+	var err error
+	if pageSize := c.Query("page_size"); pageSize != "" {
+		if query.PageSize, err = strconv.Atoi(pageSize); err != nil || query.PageSize < 1 {
+			apierror.Abort(c, http.StatusBadRequest, "page_size must be a positive number")
+			return
+		}
+	}
+	for param, t := range map[string]*time.Time{"start": &query.Start, "end": &query.End} {
+		if value := c.Query(param); value != "" {
+			if *t, err = time.Parse(time.RFC3339, value); err != nil {
+				apierror.Abort(c, http.StatusBadRequest, param+" must be an RFC 3339 time")
+				return
+			}
+		}
+	}
+
+	events, nextPageToken, err := h.billingSvc.ListAuditEvents(c.Request.Context(), query)
+	if err != nil {
+		h.writeError(c, err, "Failed to list audit events")
+		return
+	}
+
+	response := make([]gin.H, 0, len(events))
+	for i := range events {
+		response = append(response, auditEventResponse(&events[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":          response,
+		"next_page_token": nextPageToken,
+	})
+}
+
+// StripeWebhook handles POST /api/v1/billing/webhooks/stripe
+func (h *RestHandlers) StripeWebhook(c *gin.Context) {
+	h.handlePaymentWebhook(c, "stripe", "Stripe-Signature")
+}
+
+// RazorpayWebhook handles POST /api/v1/billing/webhooks/razorpay
+func (h *RestHandlers) RazorpayWebhook(c *gin.Context) {
+	h.handlePaymentWebhook(c, "razorpay", "X-Razorpay-Signature")
+}
+
+// handlePaymentWebhook passes the raw body of a provider webhook and its signature header
+// to the billing service. The body must not be re-encoded, or the signature won't match.
+func (h *RestHandlers) handlePaymentWebhook(c *gin.Context, provider, signatureHeader string) {
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodyBytes))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Failed to read webhook body")
+		return
+	}
+
+	err = h.billingSvc.HandlePaymentWebhook(c.Request.Context(), provider, payload, c.GetHeader(signatureHeader))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidWebhookSignature) {
+			h.logger.WithError(err).WithField("provider", provider).Warn("Rejected payment webhook")
+			apierror.Abort(c, http.StatusBadRequest, "Invalid webhook signature")
+			return
+		}
+		if errors.Is(err, repository.ErrSubscriptionNotFound) || errors.Is(err, repository.ErrSeatChangeNotFound) {
+			// Retrying won't make the subscription appear, so the event is acknowledged
+			h.logger.WithError(err).WithField("provider", provider).Warn("Ignoring payment webhook for unknown subscription")
+			c.JSON(http.StatusOK, gin.H{"success": true})
+			return
+		}
+		// Providers retry webhooks answered with an error
+		h.logger.WithError(err).WithField("provider", provider).Error("Failed to process payment webhook")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to process webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// authenticate rejects requests without a valid user access token and stores the
+// user's ID in the context. The request is served for the tenant of the token, whatever
+// X-Tenant-ID says.
+func (h *RestHandlers) authenticate(c *gin.Context) {
+	claims, err := h.validator.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		message := "Invalid token"
+		if errors.Is(err, jwtauth.ErrExpiredToken) {
+			message = "Token expired"
+		}
+		apierror.Abort(c, http.StatusUnauthorized, message)
+		return
+	}
+
+	c.Set(userIDKey, claims.UserID)
+	c.Request = c.Request.WithContext(tenant.WithID(c.Request.Context(), claims.TenantID))
+	c.Next()
+}
+
+// GetRevenueStats handles GET /api/v1/admin/stats, the monthly recurring revenue and
+// current subscriptions of every tenant, or of the tenant in X-Tenant-ID
+func (h *RestHandlers) GetRevenueStats(c *gin.Context) {
+	stats, err := h.billingSvc.RevenueStats(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to compute revenue stats")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to compute revenue stats")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// authorizeAdmin rejects requests from users who aren't billing administrators
+func (h *RestHandlers) authorizeAdmin(c *gin.Context) {
+	if err := h.billingSvc.AuthorizePlanAdmin(c.Request.Context(), c.GetString(userIDKey)); err != nil {
+		h.writeError(c, err, "Failed to check administrator access")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// requestUserID returns the authenticated user's ID. Requests naming another user are
+// rejected, so clients that still send user_id keep working.
+func requestUserID(c *gin.Context, requested string) (string, bool) {
+	userID := c.GetString(userIDKey)
+	if requested != "" && requested != userID {
+		apierror.Abort(c, http.StatusForbidden, "Cannot access another user's billing")
+		return "", false
+	}
+	return userID, true
+}
+
+// writeError responds with the status matching a billing service error
+func (h *RestHandlers) writeError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidUserID),
+		errors.Is(err, service.ErrInvalidPlanID),
+		errors.Is(err, service.ErrInvalidSubscriptionID),
+		errors.Is(err, service.ErrUnsupportedPaymentMethod),
+		errors.Is(err, service.ErrInvalidBillingInterval),
+		errors.Is(err, service.ErrInvalidInvoiceID),
+		errors.Is(err, service.ErrInvalidOrganizationID),
+		errors.Is(err, service.ErrNotTeamPlan),
+		errors.Is(err, service.ErrInvalidSeatCount),
+		errors.Is(err, service.ErrInvalidPlan),
+		errors.Is(err, service.ErrInvalidOrdering),
+		errors.Is(err, service.ErrInvalidRefund),
+		errors.Is(err, service.ErrUnsupportedCurrency),
+		errors.Is(err, service.ErrInvalidBillingDetails),
+		errors.Is(err, service.ErrInvalidAuditQuery),
+		errors.Is(err, service.ErrInvalidAPIKeyID),
+		errors.Is(err, service.ErrInvalidAPIKeyName),
+		errors.Is(err, service.ErrInvalidAPIKeyQuota):
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrOrganizationNotFound):
+		apierror.Abort(c, http.StatusNotFound, "Organization not found")
+	case errors.Is(err, service.ErrNotOrganizationAdmin):
+		apierror.Abort(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrNotPlanAdmin),
+		errors.Is(err, service.ErrAPIAccessNotIncluded):
+		apierror.Abort(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrSeatsInUse),
+		errors.Is(err, service.ErrSeatCreditChanged),
+		errors.Is(err, service.ErrPlanNameTaken),
+		errors.Is(err, service.ErrPlanArchived),
+		errors.Is(err, service.ErrProtectedPlan),
+		errors.Is(err, service.ErrInvoiceRefunded),
+		errors.Is(err, service.ErrTooManyAPIKeys):
+		apierror.Abort(c, http.StatusConflict, err.Error())
+	case errors.Is(err, repository.ErrPlanNotFound):
+		apierror.Abort(c, http.StatusNotFound, "Plan not found")
+	case errors.Is(err, repository.ErrSubscriptionNotFound):
+		apierror.Abort(c, http.StatusNotFound, "Subscription not found")
+	case errors.Is(err, repository.ErrInvoiceNotFound):
+		apierror.Abort(c, http.StatusNotFound, "Invoice not found")
+	case errors.Is(err, repository.ErrAPIKeyNotFound):
+		apierror.Abort(c, http.StatusNotFound, "API key not found")
+	case errors.Is(err, service.ErrActiveSubscription):
+		apierror.Abort(c, http.StatusConflict, "You already have an active subscription")
+	default:
+		h.logger.WithError(err).Error(message)
+		apierror.Abort(c, http.StatusInternalServerError, message)
+	}
+}
+
+// SetupRoutes sets up all REST API routes
+func (h *RestHandlers) SetupRoutes(r *gin.Engine) {
+	billing := r.Group("/api/v1/billing")
+	{
+		// Public
+		billing.GET("/plans", h.ListPlans)
+		billing.GET("/plans/:id", h.GetPlan)
+
+		// Payment providers, authenticated by the webhook signature
+		billing.POST("/webhooks/stripe", h.StripeWebhook)
+		billing.POST("/webhooks/razorpay", h.RazorpayWebhook)
+
+		// Authenticated users
+		user := billing.Group("", h.authenticate)
+		{
+			user.GET("/subscription", h.GetSubscription)
+			user.GET("/usage", h.GetUsage)
+			user.POST("/subscribe", h.Subscribe)
+			user.POST("/subscription/cancel", h.CancelSubscription)
+			user.GET("/organizations/:org_id/subscription", h.GetTeamSubscription)
+			user.GET("/organizations/:org_id/seats/quote", h.QuoteSeats)
+			user.PUT("/organizations/:org_id/seats", h.UpdateSeats)
+			user.GET("/invoices", h.ListInvoices)
+			user.GET("/invoices/:id", h.GetInvoice)
+			user.GET("/invoices/:id/pdf", h.DownloadInvoice)
+			user.GET("/api-keys", h.ListAPIKeys)
+			user.POST("/api-keys", h.CreateAPIKey)
+			user.PATCH("/api-keys/:id", h.UpdateAPIKeyQuotas)
+			user.DELETE("/api-keys/:id", h.RevokeAPIKey)
+			user.GET("/api-usage", h.GetAPIUsage)
+		}
+
+		// Billing administrators
+		admin := billing.Group("/admin", h.authenticate, h.authorizeAdmin)
+		{
+			admin.GET("/plans", h.AdminListPlans)
+			admin.POST("/plans", h.CreatePlan)
+			admin.PUT("/plans/order", h.ReorderPlans)
+			admin.PUT("/plans/:id", h.UpdatePlan)
+			admin.POST("/plans/:id/archive", h.ArchivePlan)
+			admin.POST("/plans/:id/unarchive", h.UnarchivePlan)
+			admin.POST("/invoices/:id/refunds", h.RefundInvoice)
+			admin.GET("/audit-events", h.ListAuditEvents)
+		}
+	}
+
+	// Admin analytics, for operators
+	if h.analyticsToken != "" {
+		r.GET("/api/v1/admin/stats", ginmw.BearerToken(h.analyticsToken), h.GetRevenueStats)
+	}
+}
+
+// planResponse is the JSON representation of a plan
+func planResponse(plan *models.Plan) gin.H {
+	if plan == nil {
+		return nil
+	}
+	return gin.H{
+		"id":                      plan.ID.Hex(),
+		"name":                    plan.Name,
+		"quota_bytes":             plan.QuotaBytes,
+		"price_per_month":         plan.PricePerMonth,
+		"price_per_year":          plan.Price(models.BillingIntervalYear),
+		"yearly_price_per_month":  plan.YearlyPricePerMonth(),
+		"yearly_saving_per_month": plan.YearlySavingPerMonth(),
+		"yearly_saving_percent":   plan.YearlySavingPercent(),
+		"prices":                  pricesResponse(plan),
+		"currencies":              plan.Currencies(),
+		"description":             plan.Description,
+		"features":                plan.Features,
+		"is_popular":              plan.IsPopular,
+		"per_seat":                plan.PerSeat,
+		"sort_order":              plan.SortOrder,
+		"archived":                plan.Archived,
+		"trial_days":              plan.TrialDays,
+		"api_calls_included":      plan.APICallsIncluded,
+		"api_overage_per_1000":    plan.APIOveragePer1000,
+		"created_at":              plan.CreatedAt.Format(time.RFC3339),
+		"updated_at":              plan.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// pricesResponse is the JSON representation of a plan's prices in each currency, by code
+func pricesResponse(plan *models.Plan) gin.H {
+	response := gin.H{}
+	for _, currency := range plan.Currencies() {
+		perMonth, _ := plan.PriceIn(currency, models.BillingIntervalMonth)
+		perYear, _ := plan.PriceIn(currency, models.BillingIntervalYear)
+		overage, _ := plan.APIOveragePriceIn(currency)
+		response[currency] = gin.H{
+			"price_per_month":      perMonth,
+			"price_per_year":       perYear,
+			"api_overage_per_1000": overage,
+		}
+	}
+	return response
+}
+
+// plansResponse is the JSON representation of a list of plans
+func plansResponse(plans []models.Plan) []gin.H {
+	response := make([]gin.H, 0, len(plans))
+	for i := range plans {
+		response = append(response, planResponse(&plans[i]))
+	}
+	return response
+}
+
+// subscriptionResponse is the JSON representation of a subscription and its plan
+func subscriptionResponse(subscription *models.Subscription, plan *models.Plan) gin.H {
+	response := gin.H{
+		"id":               subscription.ID.Hex(),
+		"user_id":          subscription.UserID.Hex(),
+		"plan_id":          subscription.PlanID.Hex(),
+		"status":           subscription.Status,
+		"payment_status":   subscription.PaymentStatus,
+		"start_date":       subscription.StartDate.Format(time.RFC3339),
+		"end_date":         subscription.EndDate.Format(time.RFC3339),
+		"payment_method":   subscription.PaymentMethod,
+		"billing_interval": subscription.Interval(),
+		"currency":         subscription.BillingCurrency(),
+		"created_at":       subscription.CreatedAt.Format(time.RFC3339),
+		"updated_at":       subscription.UpdatedAt.Format(time.RFC3339),
+	}
+	if subscription.TransactionID != "" {
+		response["transaction_id"] = subscription.TransactionID
+	}
+	if renewsAt, ok := subscription.RenewsAt(); ok {
+		response["renews_at"] = renewsAt.Format(time.RFC3339)
+	}
+	if subscription.IsTrialing() {
+		response["trial_end"] = subscription.TrialEnd.Format(time.RFC3339)
+	}
+	if dunning := subscription.Dunning; dunning != nil {
+		response["dunning"] = gin.H{
+			"failed_at":        dunning.FailedAt.Format(time.RFC3339),
+			"grace_period_end": dunning.GracePeriodEnd.Format(time.RFC3339),
+			"retries":          dunning.Retries,
+			"next_retry_at":    dunning.NextRetryAt.Format(time.RFC3339),
+			"payment_url":      dunning.PaymentURL,
+		}
+	}
+	if subscription.IsTeam() {
+		response["org_id"] = subscription.OrgID.Hex()
+		response["seats"] = subscription.Seats
+	}
+	if subscription.Billing != nil {
+		response["billing_details"] = billingDetailsResponse(subscription.Billing)
+	}
+	if plan != nil {
+		response["plan"] = planResponse(plan)
+	}
+	return response
+}
+
+// billingDetailsPayload is the JSON body of the billing details given at checkout
+type billingDetailsPayload struct {
+	Country      string `json:"country"`
+	Region       string `json:"region"`
+	TaxID        string `json:"tax_id"`
+	BusinessName string `json:"business_name"`
+}
+
+// toModel converts the payload, which is nil if no billing details were given
+func (p *billingDetailsPayload) toModel() *models.BillingDetails {
+	if p == nil {
+		return nil
+	}
+	return &models.BillingDetails{
+		Country:      p.Country,
+		Region:       p.Region,
+		TaxID:        p.TaxID,
+		BusinessName: p.BusinessName,
+	}
+}
+
+// billingDetailsResponse is the JSON representation of billing details
+func billingDetailsResponse(details *models.BillingDetails) gin.H {
+	return gin.H{
+		"country":       details.Country,
+		"region":        details.Region,
+		"tax_id":        details.TaxID,
+		"business_name": details.BusinessName,
+	}
+}
+
+// seatQuoteResponse is the JSON representation of a seat quote
+func seatQuoteResponse(quote *service.SeatQuote) gin.H {
+	return gin.H{
+		"currency":       quote.Currency,
+		"current_seats":  quote.CurrentSeats,
+		"seats":          quote.Seats,
+		"prorated":       quote.Prorated,
+		"credit_applied": quote.CreditApplied,
+		"amount_due":     quote.AmountDue,
+		"credit_earned":  quote.CreditEarned,
+		"period_end":     quote.PeriodEnd.Format(time.RFC3339),
+	}
+}
+
+// razorpayCheckoutResponse is the JSON representation of Razorpay Checkout options
+func razorpayCheckoutResponse(checkout *payment.RazorpayCheckout) gin.H {
+	return gin.H{
+		"key_id":      checkout.KeyID,
+		"order_id":    checkout.OrderID,
+		"amount":      checkout.Amount,
+		"currency":    checkout.Currency,
+		"name":        checkout.Name,
+		"description": checkout.Description,
+	}
+}
+
+// invoiceResponse is the JSON representation of an invoice
+func invoiceResponse(inv *models.Invoice) gin.H {
+	lineItems := make([]gin.H, 0, len(inv.LineItems))
+	for _, item := range inv.LineItems {
+		lineItems = append(lineItems, gin.H{
+			"description": item.Description,
+			"quantity":    item.Quantity,
+			"unit_amount": item.UnitAmount,
+			"amount":      item.Amount,
+		})
+	}
+
+	refunds := make([]gin.H, 0, len(inv.Refunds))
+	for _, refund := range inv.Refunds {
+		refunds = append(refunds, gin.H{
+			"id":         refund.ID,
+			"amount":     refund.Amount,
+			"reason":     refund.Reason,
+			"created_at": refund.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	taxLines := make([]gin.H, 0, len(inv.TaxLines))
+	for _, line := range inv.TaxLines {
+		taxLines = append(taxLines, gin.H{
+			"name":   line.Name,
+			"rate":   line.Rate,
+			"amount": line.Amount,
+		})
+	}
+
+	response := gin.H{
+		"id":              inv.ID.Hex(),
+		"number":          inv.Number,
+		"subscription_id": inv.SubscriptionID.Hex(),
+		"plan_id":         inv.PlanID.Hex(),
+		"plan_name":       inv.PlanName,
+		"status":          inv.Status,
+		"payment_method":  inv.PaymentMethod,
+		"transaction_id":  inv.TransactionID,
+		"currency":        inv.Currency,
+		"line_items":      lineItems,
+		"subtotal":        inv.Subtotal,
+		"tax_rate":        inv.TaxRate,
+		"tax":             inv.Tax,
+		"tax_lines":       taxLines,
+		"reverse_charge":  inv.ReverseCharge,
+		"total":           inv.Total,
+		"period_start":    inv.PeriodStart.Format(time.RFC3339),
+		"period_end":      inv.PeriodEnd.Format(time.RFC3339),
+		"issued_at":       inv.IssuedAt.Format(time.RFC3339),
+		"amount_refunded": inv.AmountRefunded,
+		"refunds":         refunds,
+	}
+	if inv.BillTo != nil {
+		response["bill_to"] = billingDetailsResponse(inv.BillTo)
+	}
+	return response
+}
+
+// auditEventResponse is the JSON representation of an audit event. IDs of what the event
+// doesn't refer to are left out.
+func auditEventResponse(event *models.AuditEvent) gin.H {
+	response := gin.H{
+		"id":         event.ID.Hex(),
+		"type":       event.Type,
+		"source":     event.Source,
+		"details":    event.Details,
+		"created_at": event.CreatedAt.Format(time.RFC3339),
+	}
+	for field, id := range map[string]primitive.ObjectID{
+		"actor_id":        event.ActorID,
+		"user_id":         event.UserID,
+		"org_id":          event.OrgID,
+		"subscription_id": event.SubscriptionID,
+		"invoice_id":      event.InvoiceID,
+		"plan_id":         event.PlanID,
+	} {
+		if !id.IsZero() {
+			response[field] = id.Hex()
+		}
+	}
+	return response
+}
+
+// apiKeyResponse is the JSON representation of an API key, without the key itself
+func apiKeyResponse(key *models.APIKey) gin.H {
+	response := gin.H{
+		"id":         key.ID.Hex(),
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"revoked":    key.IsRevoked(),
+		"created_at": key.CreatedAt.Format(time.RFC3339),
+	}
+	if key.LastUsedAt != nil {
+		response["last_used_at"] = key.LastUsedAt.Format(time.RFC3339)
+	}
+	if key.RevokedAt != nil {
+		response["revoked_at"] = key.RevokedAt.Format(time.RFC3339)
+	}
+	if key.RateLimit > 0 {
+		response["rate_limit"] = key.RateLimit
+	}
+	if key.MonthlyTransfer > 0 {
+		response["monthly_transfer"] = key.MonthlyTransfer
+	}
+	return response
+}
@@ -0,0 +1,647 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/payment"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrAPIAccessNotIncluded = errors.New("your plan doesn't include API access")
+	ErrInvalidAPIKey        = errors.New("invalid API key")
+	ErrInvalidAPIKeyID      = errors.New("invalid API key ID")
+	ErrInvalidAPIKeyName    = errors.New("invalid API key name")
+	ErrInvalidAPIKeyQuota   = errors.New("invalid API key quota")
+	ErrTooManyAPIKeys       = errors.New("too many API keys")
+)
+
+const (
+	// apiKeyPrefix starts every API key, so that leaked keys are recognizable
+	apiKeyPrefix = "dfs_"
+	// apiKeyPrefixLength is how much of a key identifies it in listings
+	apiKeyPrefixLength = len(apiKeyPrefix) + 8
+	// maxAPIKeys bounds the API keys a user can have at once
+	maxAPIKeys = 10
+	// maxAPIKeyNameLength bounds the length of API key names
+	maxAPIKeyNameLength = 100
+)
+
+// apiBillingCheckInterval is how often past months' API usage is billed
+const apiBillingCheckInterval = time.Hour
+
+// apiBillingBatchSize bounds the users or overages processed in one query
+const apiBillingBatchSize = 100
+
+// APIKeyQuotas are the limits the API gateway holds a key to: RateLimit requests per
+// minute, and MonthlyTransfer bytes per calendar month. Zero leaves the gateway's limits.
+type APIKeyQuotas struct {
+	RateLimit       int64
+	MonthlyTransfer int64
+}
+
+// validate checks that quotas are zero or positive
+func (q APIKeyQuotas) validate() error {
+	if q.RateLimit < 0 || q.MonthlyTransfer < 0 {
+		return fmt.Errorf("%w: quotas can't be negative", ErrInvalidAPIKeyQuota)
+	}
+	return nil
+}
+
+// APIKeyUsage is the number of calls made with an API key in a month
+type APIKeyUsage struct {
+	Key   models.APIKey
+	Calls int64
+}
+
+// APIUsageInfo is a user's API usage in the current month, and what it costs. Prices
+// are formatted in Currency.
+type APIUsageInfo struct {
+	UserID        string
+	PlanName      string
+	APIAccess     bool
+	Month         time.Time
+	IncludedCalls int64
+	Calls         int64
+	OverageCalls  int64
+	Currency      string
+	// OveragePrice is the price of models.APICallBlock calls over the included calls,
+	// and EstimatedOverage the price of the month's overage so far
+	OveragePrice     string
+	EstimatedOverage string
+	Keys             []APIKeyUsage
+	// Unbilled are overages of past months that will be charged with the next payment
+	Unbilled []UnbilledAPIOverage
+}
+
+// UnbilledAPIOverage is an overage of a past month that hasn't been invoiced yet
+type UnbilledAPIOverage struct {
+	Month        time.Time
+	OverageCalls int64
+	Amount       string
+}
+
+// SetAPIAccess lets subscribers of plans with API access create API keys, meters the
+// calls the API gateway counts for each key, and bills calls over the plan's included
+// calls with the user's next payment. Without it API keys are not accepted.
+func (s *BillingService) SetAPIAccess(keyRepo *repository.APIKeyRepository, usageRepo *repository.APIUsageRepository, overageRepo *repository.APIOverageRepository) {
+	s.apiKeyRepo = keyRepo
+	s.apiUsageRepo = usageRepo
+	s.apiOverageRepo = overageRepo
+}
+
+// CreateAPIKey creates an API key for a user whose plan includes API access, held to
+// quotas. The key is returned once; only its hash is stored.
+func (s *BillingService) CreateAPIKey(ctx context.Context, userID, name string, quotas APIKeyQuotas) (*models.APIKey, string, error) {
+	if s.apiKeyRepo == nil {
+		return nil, "", ErrAPIAccessNotIncluded
+	}
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalidAPIKeyName)
+	case len(name) > maxAPIKeyNameLength:
+		return nil, "", fmt.Errorf("%w: name must be at most %d characters", ErrInvalidAPIKeyName, maxAPIKeyNameLength)
+	}
+	if err := quotas.validate(); err != nil {
+		return nil, "", err
+	}
+
+	_, plan, err := s.GetUserSubscription(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !plan.HasAPIAccess() {
+		return nil, "", ErrAPIAccessNotIncluded
+	}
+
+	count, err := s.apiKeyRepo.CountActive(ctx, uid)
+	if err != nil {
+		return nil, "", err
+	}
+	if count >= maxAPIKeys {
+		return nil, "", fmt.Errorf("%w: revoke a key before creating another, up to %d are allowed", ErrTooManyAPIKeys, maxAPIKeys)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	rawKey := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := &models.APIKey{
+		UserID:          uid,
+		Name:            name,
+		Prefix:          rawKey[:apiKeyPrefixLength],
+		KeyHash:         hashAPIKey(rawKey),
+		RateLimit:       quotas.RateLimit,
+		MonthlyTransfer: quotas.MonthlyTransfer,
+	}
+	if err := s.apiKeyRepo.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"user_id": userID,
+		"key_id":  key.ID.Hex(),
+	}).Info("API key created")
+
+	return key, rawKey, nil
+}
+
+// ListAPIKeys returns a user's API keys, including revoked ones, newest first
+func (s *BillingService) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+	if s.apiKeyRepo == nil {
+		return nil, nil
+	}
+	return s.apiKeyRepo.ListByUserID(ctx, uid)
+}
+
+// RevokeAPIKey revokes one of a user's API keys. Calls already made with it are still
+// billed.
+func (s *BillingService) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+	id, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAPIKeyID, err)
+	}
+	if s.apiKeyRepo == nil {
+		return repository.ErrAPIKeyNotFound
+	}
+
+	if err := s.apiKeyRepo.Revoke(ctx, id, uid); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"user_id": userID,
+		"key_id":  keyID,
+	}).Info("API key revoked")
+	return nil
+}
+
+// SetAPIKeyQuotas changes the quotas of one of a user's API keys. The API gateway applies
+// them once it verifies the key again, within a minute.
+func (s *BillingService) SetAPIKeyQuotas(ctx context.Context, userID, keyID string, quotas APIKeyQuotas) error {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+	id, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAPIKeyID, err)
+	}
+	if err := quotas.validate(); err != nil {
+		return err
+	}
+	if s.apiKeyRepo == nil {
+		return repository.ErrAPIKeyNotFound
+	}
+
+	if err := s.apiKeyRepo.SetQuotas(ctx, id, uid, quotas.RateLimit, quotas.MonthlyTransfer); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"user_id":          userID,
+		"key_id":           keyID,
+		"rate_limit":       quotas.RateLimit,
+		"monthly_transfer": quotas.MonthlyTransfer,
+	}).Info("API key quotas changed")
+	return nil
+}
+
+// AuthenticateAPIKey returns the API key a client presented, for the API gateway. Keys
+// stop working when they are revoked or their user's plan no longer includes API access.
+func (s *BillingService) AuthenticateAPIKey(ctx context.Context, rawKey string) (*models.APIKey, error) {
+	if s.apiKeyRepo == nil || !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.FindByHash(ctx, hashAPIKey(rawKey))
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if key.IsRevoked() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	_, plan, err := s.GetUserSubscription(ctx, key.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if !plan.HasAPIAccess() {
+		return nil, ErrAPIAccessNotIncluded
+	}
+	return key, nil
+}
+
+// RecordAPIUsage adds the calls the API gateway counted for each API key, by key ID, to
+// the current month's usage. It returns the IDs of the keys whose calls couldn't be
+// recorded, which the gateway reports again later; calls of unknown keys are dropped.
+func (s *BillingService) RecordAPIUsage(ctx context.Context, calls map[string]int64) []string {
+	if s.apiUsageRepo == nil {
+		return nil
+	}
+
+	now := time.Now()
+	month := models.APIUsageMonth(now)
+	var failed []string
+	for keyID, count := range calls {
+		if count <= 0 {
+			continue
+		}
+		logger := logrus.WithFields(logrus.Fields{
+			"key_id": keyID,
+			"calls":  count,
+		})
+
+		id, err := primitive.ObjectIDFromHex(keyID)
+		if err != nil {
+			logger.Warn("Dropping API usage of an invalid key ID")
+			continue
+		}
+		key, err := s.apiKeyRepo.FindByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, repository.ErrAPIKeyNotFound) {
+				logger.Warn("Dropping API usage of an unknown key")
+				continue
+			}
+			logger.WithError(err).Error("Failed to find API key")
+			failed = append(failed, keyID)
+			continue
+		}
+
+		// The month is billed by the plan its calls were last counted with
+		_, plan, err := s.GetUserSubscription(ctx, key.UserID.Hex())
+		if err != nil {
+			logger.WithError(err).Error("Failed to get plan for API usage")
+			failed = append(failed, keyID)
+			continue
+		}
+		if err := s.apiUsageRepo.Add(ctx, key.UserID, key.ID, plan.ID, month, count); err != nil {
+			logger.WithError(err).Error("Failed to record API usage")
+			failed = append(failed, keyID)
+			continue
+		}
+
+		if err := s.apiKeyRepo.SetLastUsed(ctx, key.ID, now); err != nil {
+			logger.WithError(err).Warn("Failed to record when API key was last used")
+		}
+	}
+	return failed
+}
+
+// GetAPIUsage returns a user's API usage this month, by key, and their overage that is
+// yet to be billed
+func (s *BillingService) GetAPIUsage(ctx context.Context, userID string) (*APIUsageInfo, error) {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+
+	subscription, plan, err := s.GetUserSubscription(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prices are shown in the currency the user is billed in
+	currency := models.CurrencyUSD
+	var billing *models.BillingDetails
+	if subscription != nil {
+		currency, billing = subscription.BillingCurrency(), subscription.Billing
+	}
+
+	month := models.APIUsageMonth(time.Now())
+	info := &APIUsageInfo{
+		UserID:        userID,
+		PlanName:      plan.Name,
+		APIAccess:     plan.HasAPIAccess(),
+		Month:         month,
+		IncludedCalls: plan.APICallsIncluded,
+		Currency:      currency,
+	}
+	if s.apiKeyRepo == nil {
+		return info, nil
+	}
+
+	keys, err := s.apiKeyRepo.ListByUserID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.apiUsageRepo.ListByUser(ctx, uid, month)
+	if err != nil {
+		return nil, err
+	}
+	callsByKey := make(map[primitive.ObjectID]int64, len(usage))
+	for _, u := range usage {
+		callsByKey[u.KeyID] = u.Calls
+		info.Calls += u.Calls
+	}
+	for _, key := range keys {
+		info.Keys = append(info.Keys, APIKeyUsage{Key: key, Calls: callsByKey[key.ID]})
+	}
+
+	if plan.HasAPIAccess() {
+		info.OverageCalls = max(info.Calls-plan.APICallsIncluded, 0)
+		if price, ok := plan.APIOveragePriceIn(currency); ok {
+			unitAmount := models.MinorUnits(s.tax.chargedPrice(billing, price))
+			info.OveragePrice = models.FormatMoney(unitAmount, currency)
+			info.EstimatedOverage = models.FormatMoney(unitAmount*models.APIOverageBlocks(info.OverageCalls), currency)
+		}
+	}
+
+	overages, err := s.apiOverageRepo.ListPendingByUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	for i := range overages {
+		overage := &overages[i]
+		unbilled := UnbilledAPIOverage{Month: overage.Month, OverageCalls: overage.OverageCalls()}
+		if overage.Currency != "" {
+			unbilled.Amount = models.FormatMoney(overage.Amount, overage.Currency)
+		} else if amount, ok := s.apiOverageAmount(ctx, overage, currency, billing); ok {
+			unbilled.Amount = models.FormatMoney(amount, currency)
+		}
+		info.Unbilled = append(info.Unbilled, unbilled)
+	}
+
+	return info, nil
+}
+
+// RunAPIBilling records the overage of each month as it ends and adds it to the next
+// invoice of users with a recurring Stripe subscription, until ctx is done. Other users
+// pay it with their next checkout.
+func (s *BillingService) RunAPIBilling(ctx context.Context) {
+	if s.apiOverageRepo == nil {
+		return
+	}
+
+	ticker := time.NewTicker(apiBillingCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.processAPIBilling(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processAPIBilling records the overage of the month before now and schedules the
+// pending overages of recurring subscriptions. API usage is counted in the month it is
+// reported in, so a month's usage is final once it has ended.
+func (s *BillingService) processAPIBilling(ctx context.Context, now time.Time) {
+	lastMonth := models.APIUsageMonth(models.APIUsageMonth(now).AddDate(0, 0, -1))
+	if err := s.recordAPIOverages(ctx, lastMonth); err != nil {
+		logrus.WithError(err).WithField("month", lastMonth).Error("Failed to record API overage")
+	}
+	if err := s.scheduleAPIOverages(ctx); err != nil {
+		logrus.WithError(err).Error("Failed to schedule API overage")
+	}
+}
+
+// recordAPIOverages records the overage of each user who made more calls in month than
+// their plan includes. Months are recorded once, however often they are processed.
+func (s *BillingService) recordAPIOverages(ctx context.Context, month time.Time) error {
+	plans := map[primitive.ObjectID]*models.Plan{}
+	var after primitive.ObjectID
+	for {
+		totals, err := s.apiUsageRepo.ListMonthTotals(ctx, month, after, apiBillingBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(totals) == 0 {
+			return nil
+		}
+
+		for _, total := range totals {
+			after = total.UserID
+
+			plan, ok := plans[total.PlanID]
+			if !ok {
+				if plan, err = s.planRepo.FindByID(ctx, total.PlanID); err != nil {
+					return fmt.Errorf("failed to get plan: %w", err)
+				}
+				plans[total.PlanID] = plan
+			}
+			if !plan.HasAPIAccess() || plan.APIOveragePer1000 == 0 || total.Calls <= plan.APICallsIncluded {
+				continue
+			}
+
+			overage := &models.APIOverage{
+				UserID:        total.UserID,
+				PlanID:        plan.ID,
+				Month:         month,
+				Calls:         total.Calls,
+				IncludedCalls: plan.APICallsIncluded,
+			}
+			created, err := s.apiOverageRepo.Create(ctx, overage)
+			if err != nil {
+				return err
+			}
+			if created {
+				logrus.WithFields(logrus.Fields{
+					"user_id":       total.UserID.Hex(),
+					"month":         month.Format("2006-01"),
+					"overage_calls": overage.OverageCalls(),
+				}).Info("API overage recorded")
+			}
+		}
+	}
+}
+
+// scheduleAPIOverages adds the pending overages of users with a recurring Stripe
+// subscription to its next invoice. The others wait for the user's next checkout.
+func (s *BillingService) scheduleAPIOverages(ctx context.Context) error {
+	var after primitive.ObjectID
+	for {
+		overages, err := s.apiOverageRepo.ListUnscheduled(ctx, after, apiBillingBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(overages) == 0 {
+			return nil
+		}
+
+		for i := range overages {
+			overage := &overages[i]
+			after = overage.ID
+			if err := s.scheduleAPIOverage(ctx, overage); err != nil {
+				logrus.WithError(err).WithField("overage_id", overage.ID.Hex()).Error("Failed to schedule API overage")
+			}
+		}
+	}
+}
+
+// scheduleAPIOverage adds an overage to the next invoice of its user's recurring Stripe
+// subscription, if they have one
+func (s *BillingService) scheduleAPIOverage(ctx context.Context, overage *models.APIOverage) error {
+	subscription, err := s.subscriptionRepo.FindActiveByUserID(ctx, overage.UserID)
+	if err != nil {
+		return err
+	}
+	if subscription == nil || subscription.ProviderSubscriptionID == "" || subscription.PaymentMethod != "stripe" {
+		return nil
+	}
+
+	// Overages attached to the subscription's checkout are paid with it
+	if overage.SubscriptionID == subscription.ID {
+		return nil
+	}
+
+	currency := subscription.BillingCurrency()
+	amount, ok := s.apiOverageAmount(ctx, overage, currency, subscription.Billing)
+	if !ok {
+		return fmt.Errorf("plan has no API overage price in %s", currency)
+	}
+
+	itemID, err := s.stripeService.AddSubscriptionCharge(subscription.ProviderSubscriptionID, currency, amount, overage.Description(), "api-overage-"+overage.ID.Hex())
+	if err != nil {
+		return err
+	}
+	if _, err := s.apiOverageRepo.Attach(ctx, overage.ID, subscription.ID, amount, currency, itemID); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"overage_id":      overage.ID.Hex(),
+		"subscription_id": subscription.ID.Hex(),
+		"amount":          amount,
+		"currency":        currency,
+	}).Info("API overage added to next invoice")
+	return nil
+}
+
+// attachAPIOverages has the checkout of a new subscription pay the user's pending
+// overages, and returns them as extra charges. Overages that can't be priced in the
+// checkout's currency wait for a later payment.
+func (s *BillingService) attachAPIOverages(ctx context.Context, subscription *models.Subscription) []payment.ExtraCharge {
+	if s.apiOverageRepo == nil {
+		return nil
+	}
+
+	logger := logrus.WithField("subscription_id", subscription.ID.Hex())
+	overages, err := s.apiOverageRepo.ListPendingByUser(ctx, subscription.UserID)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to list API overage for checkout")
+		return nil
+	}
+
+	var extras []payment.ExtraCharge
+	for i := range overages {
+		overage := &overages[i]
+		if overage.ProviderItemID != "" {
+			continue
+		}
+		amount, ok := s.apiOverageAmount(ctx, overage, subscription.Currency, subscription.Billing)
+		if !ok || amount == 0 {
+			continue
+		}
+		attached, err := s.apiOverageRepo.Attach(ctx, overage.ID, subscription.ID, amount, subscription.Currency, "")
+		if err != nil {
+			logger.WithError(err).Warn("Failed to attach API overage to checkout")
+			continue
+		}
+		if attached {
+			extras = append(extras, payment.ExtraCharge{Description: overage.Description(), Amount: amount})
+		}
+	}
+	return extras
+}
+
+// paidAPIOverages returns the overages a payment of amount for a subscription paid,
+// which are itemized on its invoice. If they add up to more than was paid, the payment
+// didn't include them and they wait for a later one.
+func (s *BillingService) paidAPIOverages(ctx context.Context, subscription *models.Subscription, amount int64) []models.APIOverage {
+	if s.apiOverageRepo == nil {
+		return nil
+	}
+
+	overages, err := s.apiOverageRepo.ListAttached(ctx, subscription.ID)
+	if err != nil {
+		logrus.WithError(err).WithField("subscription_id", subscription.ID.Hex()).Warn("Failed to list API overage for invoice")
+		return nil
+	}
+
+	var total int64
+	for _, overage := range overages {
+		total += overage.Amount
+	}
+	if total > amount {
+		logrus.WithFields(logrus.Fields{
+			"subscription_id": subscription.ID.Hex(),
+			"overage":         total,
+			"amount":          amount,
+		}).Warn("Payment doesn't cover attached API overage")
+		return nil
+	}
+	return overages
+}
+
+// markAPIOveragesInvoiced records that overages were invoiced, so that no other payment
+// includes them
+func (s *BillingService) markAPIOveragesInvoiced(ctx context.Context, overages []models.APIOverage, inv *models.Invoice) {
+	if len(overages) == 0 {
+		return
+	}
+
+	ids := make([]primitive.ObjectID, len(overages))
+	for i, overage := range overages {
+		ids[i] = overage.ID
+	}
+	if err := s.apiOverageRepo.MarkInvoiced(ctx, ids, inv.ID); err != nil {
+		logrus.WithError(err).WithField("invoice_id", inv.ID.Hex()).Error("Failed to mark API overage invoiced")
+	}
+}
+
+// apiOverageAmount returns the charge for an overage in a currency, in its smallest
+// unit, at the overage price of the plan the calls were made on. It reports false if the
+// plan isn't priced in the currency.
+func (s *BillingService) apiOverageAmount(ctx context.Context, overage *models.APIOverage, currency string, billing *models.BillingDetails) (int64, bool) {
+	plan, err := s.planRepo.FindByID(ctx, overage.PlanID)
+	if err != nil {
+		logrus.WithError(err).WithField("plan_id", overage.PlanID.Hex()).Warn("Failed to get plan of API overage")
+		return 0, false
+	}
+	price, ok := plan.APIOveragePriceIn(currency)
+	if !ok {
+		return 0, false
+	}
+	return models.MinorUnits(s.tax.chargedPrice(billing, price)) * overage.Blocks(), true
+}
+
+// hashAPIKey returns the hash an API key is stored and looked up by
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
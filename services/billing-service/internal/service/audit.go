@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/payment"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidAuditQuery is returned for audit log queries with invalid filters
+var ErrInvalidAuditQuery = errors.New("invalid audit log query")
+
+// auditWriteTimeout bounds recording an audit event
+const auditWriteTimeout = 5 * time.Second
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// AuditQuery selects the audit events an admin lists. Empty fields do not filter.
+type AuditQuery struct {
+	UserID         string
+	OrgID          string
+	SubscriptionID string
+	InvoiceID      string
+	PlanID         string
+	ActorID        string
+	Types          []string
+	Start          time.Time
+	End            time.Time
+	// PageToken continues a listing where the previous page ended
+	PageToken string
+	PageSize  int
+}
+
+// SetAuditLog records every billing-affecting action in an append-only audit log.
+// Without it nothing is recorded.
+func (s *BillingService) SetAuditLog(auditRepo *repository.AuditEventRepository) {
+	s.auditRepo = auditRepo
+}
+
+// ListAuditEvents returns the audit events matching query, newest first, and the page
+// token of the next page, which is empty on the last page
+func (s *BillingService) ListAuditEvents(ctx context.Context, query AuditQuery) ([]models.AuditEvent, string, error) {
+	if s.auditRepo == nil {
+		return nil, "", fmt.Errorf("the audit log is not enabled")
+	}
+
+	filter := repository.AuditEventFilter{
+		Start: query.Start,
+		End:   query.End,
+		Limit: int64(query.PageSize),
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+	if !filter.Start.IsZero() && !filter.End.IsZero() && !filter.End.After(filter.Start) {
+		return nil, "", fmt.Errorf("%w: end must be after start", ErrInvalidAuditQuery)
+	}
+
+	for name, field := range map[string]struct {
+		hex string
+		id  *primitive.ObjectID
+	}{
+		"user_id":         {query.UserID, &filter.UserID},
+		"org_id":          {query.OrgID, &filter.OrgID},
+		"subscription_id": {query.SubscriptionID, &filter.SubscriptionID},
+		"invoice_id":      {query.InvoiceID, &filter.InvoiceID},
+		"plan_id":         {query.PlanID, &filter.PlanID},
+		"actor_id":        {query.ActorID, &filter.ActorID},
+		"page_token":      {query.PageToken, &filter.Before},
+	} {
+		if field.hex == "" {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(field.hex)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: invalid %s", ErrInvalidAuditQuery, name)
+		}
+		*field.id = id
+	}
+
+	for _, eventType := range query.Types {
+		t := models.AuditEventType(eventType)
+		if !slices.Contains(models.AuditEventTypes, t) {
+			return nil, "", fmt.Errorf("%w: unknown event type %s", ErrInvalidAuditQuery, eventType)
+		}
+		filter.Types = append(filter.Types, t)
+	}
+
+	events, err := s.auditRepo.List(ctx, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextPageToken := ""
+	if int64(len(events)) == filter.Limit {
+		nextPageToken = events[len(events)-1].ID.Hex()
+	}
+	return events, nextPageToken, nil
+}
+
+// recordAudit adds an event to the audit log. The action it records has already
+// happened, so failures are logged rather than returned.
+func (s *BillingService) recordAudit(ctx context.Context, event *models.AuditEvent) {
+	if s.auditRepo == nil {
+		return
+	}
+
+	// Record the event even if the caller has already gone away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditWriteTimeout)
+	defer cancel()
+
+	if err := s.auditRepo.Create(ctx, event); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    event.UserID.Hex(),
+		}).Error("Failed to record billing audit event")
+	}
+}
+
+// recordSubscriptionAudit records an action on a subscription by a user
+func (s *BillingService) recordSubscriptionAudit(ctx context.Context, eventType models.AuditEventType, actorID string, subscription *models.Subscription, details map[string]string) {
+	s.recordAudit(ctx, &models.AuditEvent{
+		Type:           eventType,
+		Source:         models.AuditSourceUser,
+		ActorID:        auditObjectID(actorID),
+		UserID:         subscription.UserID,
+		OrgID:          subscription.OrgID,
+		SubscriptionID: subscription.ID,
+		PlanID:         subscription.PlanID,
+		Details:        details,
+	})
+}
+
+// recordPlanAudit records a change of the plan catalog by an admin
+func (s *BillingService) recordPlanAudit(ctx context.Context, eventType models.AuditEventType, adminID string, plan *models.Plan) {
+	event := &models.AuditEvent{
+		Type:    eventType,
+		Source:  models.AuditSourceAdmin,
+		ActorID: auditObjectID(adminID),
+	}
+	if plan != nil {
+		event.PlanID = plan.ID
+		event.Details = map[string]string{
+			"name":            plan.Name,
+			"price_per_month": strconv.FormatFloat(plan.PricePerMonth, 'f', -1, 64),
+			"price_per_year":  strconv.FormatFloat(plan.Price(models.BillingIntervalYear), 'f', -1, 64),
+			"quota_bytes":     strconv.FormatInt(plan.QuotaBytes, 10),
+			"archived":        strconv.FormatBool(plan.Archived),
+		}
+		if plan.HasAPIAccess() {
+			event.Details["api_calls_included"] = strconv.FormatInt(plan.APICallsIncluded, 10)
+			event.Details["api_overage_per_1000"] = strconv.FormatFloat(plan.APIOveragePer1000, 'f', -1, 64)
+		}
+	}
+	s.recordAudit(ctx, event)
+}
+
+// recordWebhookAudit records a payment provider event that was applied, or failed to be
+// applied with handleErr
+func (s *BillingService) recordWebhookAudit(ctx context.Context, source models.AuditSource, result *payment.WebhookResult, handleErr error) {
+	event := &models.AuditEvent{
+		Type:    models.AuditEventWebhookReceived,
+		Source:  source,
+		Details: map[string]string{"event_type": result.EventType},
+	}
+	if result.EventID != "" {
+		event.Details["event_id"] = result.EventID
+	}
+
+	switch data := result.Data.(type) {
+	case *payment.CheckoutSessionData:
+		event.UserID = auditObjectID(data.UserID)
+		event.SubscriptionID = auditObjectID(data.SubscriptionID)
+		event.PlanID = auditObjectID(data.PlanID)
+		event.Details["session_id"] = data.SessionID
+		event.Details["transaction_id"] = data.TransactionID
+		event.Details["amount"] = strconv.FormatInt(data.AmountTotal, 10)
+		event.Details["currency"] = data.Currency
+		if data.SeatChangeID != "" {
+			event.Details["seat_change_id"] = data.SeatChangeID
+		}
+	case *payment.SubscriptionEventData:
+		event.SubscriptionID = auditObjectID(data.SubscriptionID)
+		event.Details["provider_subscription_id"] = data.ProviderSubscriptionID
+		event.Details["status"] = data.Status
+		if data.InvoiceID != "" {
+			event.Details["invoice_id"] = data.InvoiceID
+			event.Details["amount"] = strconv.FormatInt(data.AmountPaid, 10)
+			event.Details["currency"] = data.Currency
+		}
+	}
+	if handleErr != nil {
+		event.Details["error"] = handleErr.Error()
+	}
+
+	s.recordAudit(ctx, event)
+}
+
+// recordUsageAudit records a change of a user's storage usage reported by another
+// service
+func (s *BillingService) recordUsageAudit(ctx context.Context, uid primitive.ObjectID, bytesDelta int64, details map[string]string) {
+	details["bytes_delta"] = strconv.FormatInt(bytesDelta, 10)
+	s.recordAudit(ctx, &models.AuditEvent{
+		Type:    models.AuditEventUsageAdjusted,
+		Source:  models.AuditSourceService,
+		UserID:  uid,
+		Details: details,
+	})
+}
+
+// auditObjectID parses the ID of something an audit event refers to, which is left
+// unset when it isn't a valid ID
+func auditObjectID(hex string) primitive.ObjectID {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return primitive.NilObjectID
+	}
+	return id
+}
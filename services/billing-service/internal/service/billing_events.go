@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+)
+
+// billingEventTimeout bounds publishing a billing event
+const billingEventTimeout = 10 * time.Second
+
+// BillingEventType is a change of a subscription's payments or status that the user is
+// told about
+type BillingEventType string
+
+const (
+	BillingEventPaymentSucceeded      BillingEventType = "payment.succeeded"
+	BillingEventPaymentFailed         BillingEventType = "payment.failed"
+	BillingEventSubscriptionRenewed   BillingEventType = "subscription.renewed"
+	BillingEventSubscriptionCancelled BillingEventType = "subscription.cancelled"
+)
+
+// BillingEvent tells a user about a payment or a change of their subscription. ID is
+// the same for every delivery of the webhook it came from, so that the notification-
+// service notifies the user once when the payment provider retries.
+type BillingEvent struct {
+	ID     string
+	Type   BillingEventType
+	UserID string
+	// Metadata holds what the notification templates show, such as the plan name and
+	// the formatted amount
+	Metadata map[string]string
+}
+
+// EventPublisher publishes billing events for the notification-service to deliver
+type EventPublisher interface {
+	PublishBillingEvent(ctx context.Context, event BillingEvent) error
+}
+
+// SetEventPublisher tells users about payments, renewals and cancellations with billing
+// events, which the notification-service sends receipts and status emails for. The
+// invoices of those payments and the failed payment email that starts a grace period
+// are then not emailed separately.
+func (s *BillingService) SetEventPublisher(publisher EventPublisher) {
+	s.events = publisher
+}
+
+// recordPayment invoices a successful payment for a subscription and tells the user
+// about it with a billing event of eventType, which is their receipt. A payment that has
+// already been invoiced was already announced. An error makes the provider retry the
+// webhook.
+func (s *BillingService) recordPayment(ctx context.Context, eventType BillingEventType, charge Charge) error {
+	if charge.TransactionID == "" {
+		return nil
+	}
+
+	var inv *models.Invoice
+	if s.invoiceService != nil {
+		charge.Receipted = s.events != nil
+		issued, err := s.invoiceService.IssueInvoice(ctx, charge)
+		if errors.Is(err, repository.ErrInvoiceExists) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to issue invoice: %w", err)
+		}
+		inv = issued
+		s.markAPIOveragesInvoiced(ctx, charge.Overages, inv)
+	}
+
+	subscription := charge.Subscription
+	metadata := map[string]string{
+		"amount":         models.FormatMoney(charge.Amount, charge.Currency),
+		"transaction_id": charge.TransactionID,
+		"period_end":     subscription.EndDate.Format("Jan 2, 2006"),
+	}
+	if inv != nil {
+		metadata["invoice_id"] = inv.ID.Hex()
+		metadata["invoice_number"] = inv.Number
+	}
+	s.publishBillingEvent(ctx, eventType, charge.TransactionID, subscription, metadata)
+	return nil
+}
+
+// notifyPaymentFailed tells the user that the payment of a subscription failed and it
+// entered its grace period
+func (s *BillingService) notifyPaymentFailed(ctx context.Context, subscription *models.Subscription) {
+	if s.events == nil {
+		go s.emailPaymentFailed(*subscription)
+		return
+	}
+
+	dunning := subscription.Dunning
+	link := s.billingURL
+	if dunning.PaymentURL != "" {
+		link = dunning.PaymentURL
+	}
+	s.publishBillingEvent(ctx, BillingEventPaymentFailed, fmt.Sprintf("%s:%d", subscription.ID.Hex(), dunning.FailedAt.Unix()), subscription, map[string]string{
+		"grace_period_end": dunning.GracePeriodEnd.Format("Jan 2, 2006"),
+		"payment_url":      link,
+	})
+}
+
+// publishBillingEvent publishes a billing event about a subscription, identified by its
+// type and key. The change it announces has already happened, so failures are logged
+// rather than returned.
+func (s *BillingService) publishBillingEvent(ctx context.Context, eventType BillingEventType, key string, subscription *models.Subscription, metadata map[string]string) {
+	if s.events == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), billingEventTimeout)
+	defer cancel()
+
+	logger := logrus.WithFields(logrus.Fields{
+		"event_type":      eventType,
+		"subscription_id": subscription.ID.Hex(),
+		"user_id":         subscription.UserID.Hex(),
+	})
+
+	metadata["subscription_id"] = subscription.ID.Hex()
+	metadata["billing_interval"] = string(subscription.Interval())
+	metadata["currency"] = subscription.BillingCurrency()
+	if s.billingURL != "" {
+		metadata["billing_url"] = s.billingURL
+	}
+	if plan, err := s.planRepo.FindByID(ctx, subscription.PlanID); err == nil {
+		metadata["plan_name"] = plan.Name
+	} else {
+		logger.WithError(err).Warn("Failed to get plan for billing event")
+	}
+
+	event := BillingEvent{
+		ID:       string(eventType) + ":" + key,
+		Type:     eventType,
+		UserID:   subscription.UserID.Hex(),
+		Metadata: metadata,
+	}
+	if err := s.events.PublishBillingEvent(ctx, event); err != nil {
+		logger.WithError(err).Warn("Failed to publish billing event")
+		return
+	}
+	logger.Info("Billing event published")
+}
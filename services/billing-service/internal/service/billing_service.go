@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -12,12 +14,48 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrInvalidUserID            = errors.New("invalid user ID")
+	ErrInvalidPlanID            = errors.New("invalid plan ID")
+	ErrInvalidSubscriptionID    = errors.New("invalid subscription ID")
+	ErrActiveSubscription       = errors.New("user already has an active subscription")
+	ErrUnsupportedPaymentMethod = errors.New("unsupported payment method")
+	ErrInvalidBillingInterval   = errors.New("invalid billing interval")
+	ErrInvalidWebhookSignature  = errors.New("invalid webhook signature")
+	ErrUnsupportedCurrency      = errors.New("plan is not priced in this currency")
+)
+
 type BillingService struct {
 	planRepo         *repository.PlanRepository
 	subscriptionRepo *repository.SubscriptionRepository
 	usageRepo        *repository.UsageRepository
 	stripeService    *payment.StripeService
 	razorpayService  *payment.RazorpayService
+	invoiceService   *InvoiceService
+	seatChangeRepo   *repository.SeatChangeRepository
+	orgs             OrganizationDirectory
+
+	dunning       *DunningPolicy
+	billingURL    string
+	emails        EmailDirectory
+	paymentMailer PaymentMailer
+
+	trialReminderLead time.Duration
+	trialMailer       TrialMailer
+
+	alerts AlertPublisher
+	events EventPublisher
+
+	planAdmins     []string
+	adminDirectory AdminDirectory
+
+	auditRepo *repository.AuditEventRepository
+
+	tax *TaxPolicy
+
+	apiKeyRepo     *repository.APIKeyRepository
+	apiUsageRepo   *repository.APIUsageRepository
+	apiOverageRepo *repository.APIOverageRepository
 }
 
 func NewBillingService(
@@ -36,9 +74,16 @@ func NewBillingService(
 	}
 }
 
-// ListPlans returns all available plans
+// SetInvoiceService issues invoices for successful payments, and charges the tax of its
+// tax policy
+func (s *BillingService) SetInvoiceService(invoiceService *InvoiceService) {
+	s.invoiceService = invoiceService
+	s.tax = invoiceService.tax
+}
+
+// ListPlans returns the plans that are offered, in catalog order
 func (s *BillingService) ListPlans(ctx context.Context) ([]models.Plan, error) {
-	plans, err := s.planRepo.FindAll(ctx)
+	plans, err := s.planRepo.FindAvailable(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list plans: %w", err)
 	}
@@ -49,7 +94,7 @@ func (s *BillingService) ListPlans(ctx context.Context) ([]models.Plan, error) {
 func (s *BillingService) GetPlan(ctx context.Context, planID string) (*models.Plan, error) {
 	id, err := primitive.ObjectIDFromHex(planID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid plan ID: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlanID, err)
 	}
 
 	plan, err := s.planRepo.FindByID(ctx, id)
@@ -60,11 +105,38 @@ func (s *BillingService) GetPlan(ctx context.Context, planID string) (*models.Pl
 	return plan, nil
 }
 
+// ListSubscriberIDs returns up to limit IDs of users with an active subscription to a
+// plan after the given user ID, in ID order
+func (s *BillingService) ListSubscriberIDs(ctx context.Context, planID, afterUserID string, limit int64) ([]string, error) {
+	planObjID, err := primitive.ObjectIDFromHex(planID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlanID, err)
+	}
+
+	var after primitive.ObjectID
+	if afterUserID != "" {
+		if after, err = primitive.ObjectIDFromHex(afterUserID); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+		}
+	}
+
+	ids, err := s.subscriptionRepo.ListActiveUserIDsByPlan(ctx, planObjID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, len(ids))
+	for i, id := range ids {
+		userIDs[i] = id.Hex()
+	}
+	return userIDs, nil
+}
+
 // GetUserSubscription returns the user's current subscription
 func (s *BillingService) GetUserSubscription(ctx context.Context, userID string) (*models.Subscription, *models.Plan, error) {
 	uid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("invalid user ID: %w", err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
 	}
 
 	subscription, err := s.subscriptionRepo.FindActiveByUserID(ctx, uid)
@@ -90,81 +162,162 @@ func (s *BillingService) GetUserSubscription(ctx context.Context, userID string)
 	return subscription, plan, nil
 }
 
-// CreateSubscription creates a new subscription and payment session
-func (s *BillingService) CreateSubscription(ctx context.Context, userID, planID, paymentMethod string) (*models.Subscription, string, string, error) {
+// Checkout is how the user pays for a new subscription. Stripe subscriptions are paid
+// on PaymentURL, Razorpay ones by opening Razorpay Checkout with the Razorpay options.
+type Checkout struct {
+	PaymentURL string
+	SessionID  string
+	Razorpay   *payment.RazorpayCheckout
+}
+
+// CreateSubscription creates a new subscription and payment session. The subscription
+// is billed monthly unless billingInterval is "year", in currency, or else in the
+// currency of the user's locale if the plan is priced in it, or else in USD. Per-seat
+// plans are bought for seats seats of the organization orgID, which other plans must
+// leave empty. billing, which may be nil, decides the tax charged.
+func (s *BillingService) CreateSubscription(ctx context.Context, userID, planID, paymentMethod, billingInterval, currency, locale, orgID string, seats int, billing *models.BillingDetails) (*models.Subscription, *Checkout, error) {
 	uid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("invalid user ID: %w", err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
 	}
 
 	pid, err := primitive.ObjectIDFromHex(planID)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("invalid plan ID: %w", err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPlanID, err)
+	}
+
+	if paymentMethod != "stripe" && paymentMethod != "razorpay" {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedPaymentMethod, paymentMethod)
+	}
+
+	if billing != nil {
+		if err := billing.Normalize(); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidBillingDetails, err)
+		}
+	}
+
+	interval := models.BillingIntervalMonth
+	if billingInterval != "" {
+		interval = models.BillingInterval(billingInterval)
+		if !interval.IsValid() {
+			return nil, nil, fmt.Errorf("%w: %s", ErrInvalidBillingInterval, billingInterval)
+		}
 	}
 
 	// Get plan details
 	plan, err := s.planRepo.FindByID(ctx, pid)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to get plan: %w", err)
+		return nil, nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	if plan.Archived {
+		return nil, nil, ErrPlanArchived
+	}
+	if currency, err = chooseCurrency(plan, currency, locale); err != nil {
+		return nil, nil, err
 	}
 
-	// Check if user already has an active subscription
-	existingSub, err := s.subscriptionRepo.FindActiveByUserID(ctx, uid)
+	// Check if the user, or the organization for team plans, already has an active
+	// subscription
+	var org primitive.ObjectID
+	var existingSub *models.Subscription
+	if plan.PerSeat {
+		if org, err = s.authorizeTeamBilling(ctx, userID, orgID); err != nil {
+			return nil, nil, err
+		}
+		if err := s.checkSeatCount(ctx, orgID, userID, seats); err != nil {
+			return nil, nil, err
+		}
+		existingSub, err = s.subscriptionRepo.FindActiveByOrgID(ctx, org)
+	} else {
+		if orgID != "" {
+			return nil, nil, ErrNotTeamPlan
+		}
+		seats = 1
+		existingSub, err = s.subscriptionRepo.FindActiveByUserID(ctx, uid)
+	}
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to check existing subscription: %w", err)
+		return nil, nil, fmt.Errorf("failed to check existing subscription: %w", err)
 	}
 
 	if existingSub != nil {
-		return nil, "", "", fmt.Errorf("user already has an active subscription")
+		return nil, nil, ErrActiveSubscription
+	}
+
+	trialDays, err := s.trialDays(ctx, uid, plan, paymentMethod)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Create subscription record
+	now := time.Now()
 	subscription := &models.Subscription{
-		UserID:        uid,
-		PlanID:        pid,
-		Status:        models.SubscriptionStatusPending,
-		PaymentStatus: models.PaymentStatusPending,
-		StartDate:     time.Now(),
-		EndDate:       time.Now().AddDate(0, 1, 0), // 1 month from now
-		PaymentMethod: paymentMethod,
+		UserID:          uid,
+		PlanID:          pid,
+		Status:          models.SubscriptionStatusPending,
+		PaymentStatus:   models.PaymentStatusPending,
+		StartDate:       now,
+		EndDate:         interval.PeriodEnd(now),
+		PaymentMethod:   paymentMethod,
+		BillingInterval: interval,
+		Currency:        currency,
+		Billing:         billing,
+		OrgID:           org,
+		TrialDays:       trialDays,
+	}
+	if plan.PerSeat {
+		subscription.Seats = seats
 	}
 
 	if err := s.subscriptionRepo.Create(ctx, subscription); err != nil {
-		return nil, "", "", fmt.Errorf("failed to create subscription: %w", err)
+		return nil, nil, fmt.Errorf("failed to create subscription: %w", err)
+	}
+
+	// Business customers abroad are charged without tax
+	price, _ := plan.PriceIn(currency, interval)
+	unitAmount := models.MinorUnits(s.tax.chargedPrice(billing, price))
+
+	// A first payment also pays the API overage the user still owes. Trials and team
+	// plans are paid later or by an organization, so the overage waits for another payment.
+	var extras []payment.ExtraCharge
+	if trialDays == 0 && !plan.PerSeat {
+		extras = s.attachAPIOverages(ctx, subscription)
 	}
 
 	// Create payment session based on payment method
-	var paymentURL, sessionID string
+	checkout := &Checkout{}
 
 	switch paymentMethod {
 	case "stripe":
-		session, err := s.stripeService.CreateCheckoutSession(plan, userID, subscription.ID.Hex())
+		session, err := s.stripeService.CreateCheckoutSession(plan, interval, currency, unitAmount, seats, trialDays, userID, subscription.ID.Hex(), extras)
 		if err != nil {
-			return nil, "", "", fmt.Errorf("failed to create Stripe session: %w", err)
+			return nil, nil, fmt.Errorf("failed to create Stripe session: %w", err)
 		}
-		paymentURL = session.URL
-		sessionID = session.ID
+		checkout.PaymentURL = session.URL
+		checkout.SessionID = session.ID
 
 		// Update subscription with session ID
-		subscription.SessionID = sessionID
+		subscription.SessionID = session.ID
 		if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
 			logrus.WithError(err).Error("Failed to update subscription with session ID")
 		}
 
 	case "razorpay":
-		paymentURL, sessionID, err = s.razorpayService.CreateSubscription(plan, userID, subscription.ID.Hex())
+		razorpayCheckout, err := s.razorpayService.CreateSubscription(plan, interval, currency, unitAmount, seats, userID, subscription.ID.Hex(), extras)
 		if err != nil {
-			return nil, "", "", fmt.Errorf("failed to create Razorpay order: %w", err)
+			return nil, nil, fmt.Errorf("failed to create Razorpay order: %w", err)
 		}
 
+		checkout.SessionID = razorpayCheckout.OrderID
+		checkout.Razorpay = razorpayCheckout
+
 		// Update subscription with session ID (Order ID for Razorpay)
-		subscription.SessionID = sessionID
+		subscription.SessionID = razorpayCheckout.OrderID
 		if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
 			logrus.WithError(err).Error("Failed to update subscription with session ID")
 		}
 
 	default:
-		return nil, "", "", fmt.Errorf("unsupported payment method: %s", paymentMethod)
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedPaymentMethod, paymentMethod)
 	}
 
 	logrus.WithFields(logrus.Fields{
@@ -172,21 +325,61 @@ func (s *BillingService) CreateSubscription(ctx context.Context, userID, planID,
 		"subscription_id": subscription.ID.Hex(),
 		"plan":            plan.Name,
 		"payment_method":  paymentMethod,
+		"interval":        interval,
+		"currency":        currency,
+		"org_id":          orgID,
+		"seats":           seats,
+		"trial_days":      trialDays,
 	}).Info("Subscription created")
 
-	return subscription, paymentURL, sessionID, nil
+	details := map[string]string{
+		"plan":           plan.Name,
+		"payment_method": paymentMethod,
+		"interval":       string(interval),
+		"currency":       currency,
+		"seats":          strconv.Itoa(subscription.Seats),
+		"trial_days":     strconv.Itoa(trialDays),
+		"session_id":     checkout.SessionID,
+	}
+	if billing != nil {
+		details["billing_country"] = billing.Country
+		details["tax_id"] = billing.TaxID
+		details["reverse_charge"] = strconv.FormatBool(s.tax.treatment(billing).ReverseCharge)
+	}
+	s.recordSubscriptionAudit(ctx, models.AuditEventSubscriptionCreated, userID, subscription, details)
+
+	return subscription, checkout, nil
+}
+
+// chooseCurrency returns the currency a plan is bought in: the requested currency, or
+// else the currency of the user's locale if the plan is priced in it, or else USD
+func chooseCurrency(plan *models.Plan, requested, locale string) (string, error) {
+	if requested != "" {
+		currency := models.NormalizeCurrency(requested)
+		if _, ok := plan.PriceIn(currency, models.BillingIntervalMonth); !ok || !models.IsSupportedCurrency(currency) {
+			return "", fmt.Errorf("%w: %s", ErrUnsupportedCurrency, requested)
+		}
+		return currency, nil
+	}
+
+	if currency := models.CurrencyForLocale(locale); currency != "" {
+		if _, ok := plan.PriceIn(currency, models.BillingIntervalMonth); ok {
+			return currency, nil
+		}
+	}
+	return models.CurrencyUSD, nil
 }
 
 // CancelSubscription cancels a user's subscription
 func (s *BillingService) CancelSubscription(ctx context.Context, userID, subscriptionID string) error {
 	uid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return fmt.Errorf("invalid user ID: %w", err)
+		return fmt.Errorf("%w: %v", ErrInvalidUserID, err)
 	}
 
 	sid, err := primitive.ObjectIDFromHex(subscriptionID)
 	if err != nil {
-		return fmt.Errorf("invalid subscription ID: %w", err)
+		return fmt.Errorf("%w: %v", ErrInvalidSubscriptionID, err)
 	}
 
 	// Get subscription
@@ -195,9 +388,17 @@ func (s *BillingService) CancelSubscription(ctx context.Context, userID, subscri
 		return fmt.Errorf("failed to get subscription: %w", err)
 	}
 
-	// Verify ownership
-	if subscription.UserID != uid {
-		return fmt.Errorf("subscription does not belong to user")
+	// Verify ownership. Other users' subscriptions are reported as missing, and team
+	// subscriptions are managed by any owner or admin of the organization.
+	if subscription == nil {
+		return repository.ErrSubscriptionNotFound
+	}
+	if subscription.IsTeam() {
+		if _, err := s.authorizeTeamBilling(ctx, userID, subscription.OrgID.Hex()); err != nil {
+			return err
+		}
+	} else if subscription.UserID != uid {
+		return repository.ErrSubscriptionNotFound
 	}
 
 	// Cancel subscription
@@ -205,11 +406,24 @@ func (s *BillingService) CancelSubscription(ctx context.Context, userID, subscri
 		return fmt.Errorf("failed to cancel subscription: %w", err)
 	}
 
+	// Stripe charges recurring subscriptions, such as ones in their trial, until they
+	// are cancelled there too
+	if subscription.ProviderSubscriptionID != "" && subscription.PaymentMethod == "stripe" {
+		if err := s.stripeService.CancelRecurringSubscription(subscription.ProviderSubscriptionID); err != nil {
+			return fmt.Errorf("failed to cancel Stripe subscription: %w", err)
+		}
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"user_id":         userID,
 		"subscription_id": subscriptionID,
 	}).Info("Subscription cancelled")
 
+	s.recordSubscriptionAudit(ctx, models.AuditEventSubscriptionCancelled, userID, subscription, map[string]string{
+		"previous_status": string(subscription.Status),
+	})
+	s.publishBillingEvent(ctx, BillingEventSubscriptionCancelled, subscription.ID.Hex(), subscription, map[string]string{})
+
 	return nil
 }
 
@@ -217,31 +431,39 @@ func (s *BillingService) CancelSubscription(ctx context.Context, userID, subscri
 func (s *BillingService) GetUsage(ctx context.Context, userID string) (*UsageInfo, error) {
 	uid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
 	}
 
-	// Get user's plan
-	_, plan, err := s.GetUserSubscription(ctx, userID)
+	quota, err := s.storageQuota(ctx, userID, uid)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user subscription: %w", err)
+		return nil, err
 	}
+	plan, usage := quota.plan, quota.usage
 
-	// Get usage
-	usage, err := s.usageRepo.FindOrCreate(ctx, uid)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get usage: %w", err)
+	// The price is shown in the currency and for the interval the user is billed in
+	currency, interval := models.CurrencyUSD, models.BillingIntervalMonth
+	if billed := quota.billed(); billed != nil {
+		currency, interval = billed.BillingCurrency(), billed.Interval()
 	}
+	price, _ := plan.PriceIn(currency, interval)
 
 	usageInfo := &UsageInfo{
 		UserID:           userID,
 		PlanName:         plan.Name,
-		QuotaBytes:       plan.QuotaBytes,
+		Currency:         currency,
+		BillingInterval:  interval,
+		PlanPrice:        models.FormatMoney(models.MinorUnits(price), currency),
+		QuotaBytes:       quota.quotaBytes,
 		UsedBytes:        usage.UsedBytes,
-		QuotaGB:          plan.GetQuotaGB(),
+		QuotaGB:          float64(quota.quotaBytes) / (1024 * 1024 * 1024),
 		UsedGB:           usage.GetUsedGB(),
-		PercentUsed:      usage.GetPercentUsed(plan.QuotaBytes),
-		UpgradeAvailable: plan.Name != models.PlanEnterprise,
-		QuotaExceeded:    usage.UsedBytes >= plan.QuotaBytes,
+		PercentUsed:      usage.GetPercentUsed(quota.quotaBytes),
+		UpgradeAvailable: s.upgradeAvailable(ctx, plan),
+		QuotaExceeded:    usage.UsedBytes >= quota.quotaBytes,
+	}
+	if quota.team != nil {
+		usageInfo.OrgID = quota.team.OrgID.Hex()
+		usageInfo.Seats = quota.team.Seats
 	}
 
 	return usageInfo, nil
@@ -258,42 +480,50 @@ type UsageInfo struct {
 	PercentUsed      float64
 	UpgradeAvailable bool
 	QuotaExceeded    bool
+
+	// PlanPrice is the formatted price of the plan for each BillingInterval in Currency,
+	// per seat for team plans
+	Currency        string
+	BillingInterval models.BillingInterval
+	PlanPrice       string
+
+	// OrgID and Seats are set when the user shares the quota of a team subscription
+	OrgID string
+	Seats int
 }
 
 // CheckQuota checks if a user can upload a file of given size
 func (s *BillingService) CheckQuota(ctx context.Context, userID string, fileSizeBytes int64) (bool, string, int64, error) {
 	uid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return false, "Invalid user ID", 0, fmt.Errorf("invalid user ID: %w", err)
+		return false, "Invalid user ID", 0, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
 	}
 
-	// Get user's plan
-	_, plan, err := s.GetUserSubscription(ctx, userID)
+	// Get the user's quota and current usage
+	quota, err := s.storageQuota(ctx, userID, uid)
 	if err != nil {
-		return false, "Failed to get subscription", 0, fmt.Errorf("failed to get subscription: %w", err)
-	}
-
-	// Get current usage
-	usage, err := s.usageRepo.FindOrCreate(ctx, uid)
-	if err != nil {
-		return false, "Failed to get usage", 0, fmt.Errorf("failed to get usage: %w", err)
+		return false, "Failed to get usage", 0, err
 	}
+	usage := quota.usage
 
 	// Check if upload would exceed quota
-	if !usage.CanUpload(fileSizeBytes, plan.QuotaBytes) {
-		availableBytes := usage.GetAvailableBytes(plan.QuotaBytes)
+	if !usage.CanUpload(fileSizeBytes, quota.quotaBytes) {
+		availableBytes := usage.GetAvailableBytes(quota.quotaBytes)
 		message := fmt.Sprintf("Storage limit reached. You have %d bytes available, but need %d bytes. Please upgrade your plan.", availableBytes, fileSizeBytes)
+		if quota.team != nil {
+			message = fmt.Sprintf("Your team's storage limit is reached. It has %d bytes available, but you need %d bytes. Ask an organization admin to add seats.", availableBytes, fileSizeBytes)
+		}
 		return false, message, availableBytes, nil
 	}
 
-	return true, "Upload allowed", usage.GetAvailableBytes(plan.QuotaBytes), nil
+	return true, "Upload allowed", usage.GetAvailableBytes(quota.quotaBytes), nil
 }
 
 // UpdateUsage updates the user's storage usage
 func (s *BillingService) UpdateUsage(ctx context.Context, userID string, bytesDelta int64, operation string) (int64, error) {
 	uid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return 0, fmt.Errorf("invalid user ID: %w", err)
+		return 0, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
 	}
 
 	var usage *models.Usage
@@ -314,6 +544,11 @@ func (s *BillingService) UpdateUsage(ctx context.Context, userID string, bytesDe
 			"bytes":     bytesDelta,
 			"new_total": usage.UsedBytes,
 		}).Info("Usage incremented")
+		s.recordUsageAudit(ctx, uid, bytesDelta, map[string]string{
+			"operation": operation,
+			"new_total": strconv.FormatInt(usage.UsedBytes, 10),
+		})
+		s.checkQuotaAlert(ctx, userID, uid)
 
 	case "delete":
 		err = s.usageRepo.DecrementUsage(ctx, uid, bytesDelta)
@@ -330,6 +565,10 @@ func (s *BillingService) UpdateUsage(ctx context.Context, userID string, bytesDe
 			"bytes":     bytesDelta,
 			"new_total": usage.UsedBytes,
 		}).Info("Usage decremented")
+		s.recordUsageAudit(ctx, uid, -bytesDelta, map[string]string{
+			"operation": operation,
+			"new_total": strconv.FormatInt(usage.UsedBytes, 10),
+		})
 
 	default:
 		return 0, fmt.Errorf("invalid operation: %s", operation)
@@ -338,47 +577,219 @@ func (s *BillingService) UpdateUsage(ctx context.Context, userID string, bytesDe
 	return usage.UsedBytes, nil
 }
 
-// HandlePaymentWebhook processes payment webhook events
-func (s *BillingService) HandlePaymentWebhook(ctx context.Context, provider, eventType, sessionID, transactionID string, rawPayload []byte) error {
+// ApplyFileEvent updates a user's storage usage for a file-service file event.
+// bytesDelta is positive for uploads and negative for deletions. Each event is applied
+// once, so redelivered events leave usage unchanged.
+func (s *BillingService) ApplyFileEvent(ctx context.Context, eventID, userID string, bytesDelta int64) error {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+
+	applied, err := s.usageRepo.ApplyEvent(ctx, eventID, uid, bytesDelta)
+	if err != nil {
+		return err
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"event_id": eventID,
+		"user_id":  userID,
+		"bytes":    bytesDelta,
+	})
+	if !applied {
+		logger.Debug("Skipping usage event that was already applied")
+		return nil
+	}
+	logger.Info("Usage updated from file event")
+	s.recordUsageAudit(ctx, uid, bytesDelta, map[string]string{"event_id": eventID})
+
+	if bytesDelta > 0 {
+		s.checkQuotaAlert(ctx, userID, uid)
+	}
+
+	return nil
+}
+
+// HandlePaymentWebhook verifies the signature of a payment provider webhook and applies
+// the event it carries. Nothing but the signed payload is trusted.
+func (s *BillingService) HandlePaymentWebhook(ctx context.Context, provider string, payload []byte, signature string) error {
 	switch provider {
 	case "stripe":
-		return s.handleStripeWebhook(ctx, eventType, sessionID, transactionID)
+		event, err := s.stripeService.VerifyWebhookSignature(payload, signature)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidWebhookSignature, err)
+		}
+
+		result, err := s.stripeService.HandleWebhookEvent(event)
+		if err != nil {
+			return fmt.Errorf("failed to handle stripe webhook: %w", err)
+		}
+
+		if !result.Processed {
+			return nil // Event ignored
+		}
+
+		switch data := result.Data.(type) {
+		case *payment.CheckoutSessionData:
+			if data.SeatChangeID != "" {
+				err = s.handleSeatChangePayment(ctx, result.EventType, data)
+			} else {
+				err = s.handleStripeCheckout(ctx, result.EventType, data)
+			}
+		case *payment.SubscriptionEventData:
+			err = s.handleStripeSubscriptionEvent(ctx, result.EventType, data)
+		}
+		s.recordWebhookAudit(ctx, models.AuditSourceStripe, result, err)
+		return err
 	case "razorpay":
-		result, err := s.razorpayService.HandleWebhookEvent(rawPayload)
+		if err := s.razorpayService.VerifyWebhookSignature(payload, signature); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidWebhookSignature, err)
+		}
+
+		result, err := s.razorpayService.HandleWebhookEvent(payload)
 		if err != nil {
 			return fmt.Errorf("failed to handle razorpay webhook: %w", err)
 		}
-		
-		if !result.Processed {
+
+		data, ok := result.Data.(*payment.CheckoutSessionData)
+		if !result.Processed || !ok {
 			return nil // Event ignored
 		}
-		
-		data := result.Data.(*payment.CheckoutSessionData)
-		// Use data to update subscription
-		// Note: Razorpay might not send subscription ID in all events, so we might need to look it up via Order ID (which we stored as SessionID)
-		// But our implementation puts it in notes.
-		
-		return s.handleStripeWebhook(ctx, "checkout.session.completed", data.SubscriptionID, data.TransactionID) 
-		// Reusing handleStripeWebhook logic for now as it just updates subscription status. 
-		// Ideally rename handleStripeWebhook to handleSubscriptionUpdate or similar.
+
+		if data.SeatChangeID != "" {
+			err = s.handleSeatChangePayment(ctx, result.EventType, data)
+		} else {
+			err = s.handleRazorpayPayment(ctx, result.EventType, data)
+		}
+		s.recordWebhookAudit(ctx, models.AuditSourceRazorpay, result, err)
+		return err
 	default:
 		return fmt.Errorf("unsupported payment provider: %s", provider)
 	}
 }
 
-func (s *BillingService) handleStripeWebhook(ctx context.Context, eventType, sessionID, transactionID string) error {
+// handleRazorpayPayment applies a payment event to the subscription of its order.
+// Razorpay retries webhooks, so replayed events leave a paid subscription unchanged.
+func (s *BillingService) handleRazorpayPayment(ctx context.Context, eventType string, data *payment.CheckoutSessionData) error {
+	subscription, err := s.findRazorpaySubscription(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	switch eventType {
+	case "payment.captured":
+		if subscription.PaymentStatus == models.PaymentStatusPaid {
+			// A retried event still invoices the payment if that failed the first time
+			if subscription.TransactionID == data.TransactionID {
+				return s.issueInvoice(ctx, subscription, data)
+			}
+			return nil
+		}
+
+		subscription.Status = models.SubscriptionStatusActive
+		subscription.PaymentStatus = models.PaymentStatusPaid
+		subscription.TransactionID = data.TransactionID
+		startBillingPeriod(subscription)
+
+		if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"subscription_id": subscription.ID.Hex(),
+			"user_id":         subscription.UserID.Hex(),
+			"transaction_id":  data.TransactionID,
+		}).Info("Subscription activated via Razorpay webhook")
+
+		return s.issueInvoice(ctx, subscription, data)
+
+	case "payment.failed":
+		// A failed attempt can be retried from the same checkout, so the subscription
+		// stays pending
+		if subscription.PaymentStatus == models.PaymentStatusPaid {
+			return nil
+		}
+
+		subscription.PaymentStatus = models.PaymentStatusFailed
+		if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"subscription_id": subscription.ID.Hex(),
+			"user_id":         subscription.UserID.Hex(),
+			"transaction_id":  data.TransactionID,
+		}).Warn("Razorpay payment failed")
+
+		s.publishBillingEvent(ctx, BillingEventPaymentFailed, data.TransactionID, subscription, map[string]string{
+			"amount":      models.FormatMoney(data.AmountTotal, data.Currency),
+			"payment_url": s.billingURL,
+		})
+
+	default:
+		logrus.WithField("event_type", eventType).Debug("Unhandled webhook event type")
+	}
+
+	return nil
+}
+
+// findRazorpaySubscription finds the subscription a Razorpay payment is for by its order
+// ID, falling back to the subscription ID in the order notes
+func (s *BillingService) findRazorpaySubscription(ctx context.Context, data *payment.CheckoutSessionData) (*models.Subscription, error) {
+	if data.SessionID != "" {
+		subscription, err := s.subscriptionRepo.FindBySessionID(ctx, data.SessionID)
+		if err == nil {
+			return subscription, nil
+		}
+		if !errors.Is(err, repository.ErrSubscriptionNotFound) {
+			return nil, fmt.Errorf("failed to find subscription: %w", err)
+		}
+	}
+
+	id, err := primitive.ObjectIDFromHex(data.SubscriptionID)
+	if err != nil {
+		return nil, repository.ErrSubscriptionNotFound
+	}
+	subscription, err := s.subscriptionRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscription: %w", err)
+	}
+	if subscription == nil {
+		return nil, repository.ErrSubscriptionNotFound
+	}
+	return subscription, nil
+}
+
+// handleStripeCheckout applies a checkout session event to the subscription it was
+// created for
+func (s *BillingService) handleStripeCheckout(ctx context.Context, eventType string, data *payment.CheckoutSessionData) error {
 	// Find subscription by session ID
-	subscription, err := s.subscriptionRepo.FindBySessionID(ctx, sessionID)
+	subscription, err := s.subscriptionRepo.FindBySessionID(ctx, data.SessionID)
 	if err != nil {
 		return fmt.Errorf("failed to find subscription: %w", err)
 	}
 
 	switch eventType {
 	case "checkout.session.completed":
+		// Delayed payment methods complete the session before the payment succeeds
+		if data.PaymentStatus == "unpaid" {
+			logrus.WithField("subscription_id", subscription.ID.Hex()).Info("Checkout completed, awaiting payment")
+			return nil
+		}
+
+		// Trials are paid for when they end
+		if subscription.TrialDays > 0 {
+			return s.startTrial(ctx, subscription, data)
+		}
+
 		// Update subscription to active and paid
 		subscription.Status = models.SubscriptionStatusActive
 		subscription.PaymentStatus = models.PaymentStatusPaid
-		subscription.TransactionID = transactionID
+		subscription.TransactionID = data.TransactionID
+		startBillingPeriod(subscription)
+		if data.ProviderSubscriptionID != "" {
+			subscription.ProviderSubscriptionID = data.ProviderSubscriptionID
+		}
 
 		if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
 			return fmt.Errorf("failed to update subscription: %w", err)
@@ -387,10 +798,17 @@ func (s *BillingService) handleStripeWebhook(ctx context.Context, eventType, ses
 		logrus.WithFields(logrus.Fields{
 			"subscription_id": subscription.ID.Hex(),
 			"user_id":         subscription.UserID.Hex(),
-			"transaction_id":  transactionID,
+			"transaction_id":  data.TransactionID,
 		}).Info("Subscription activated via webhook")
 
+		return s.issueInvoice(ctx, subscription, data)
+
 	case "checkout.session.expired":
+		// A paid or trialing subscription is unaffected by its session expiring
+		if subscription.PaymentStatus == models.PaymentStatusPaid || subscription.IsTrialing() {
+			return nil
+		}
+
 		// Mark subscription as failed
 		subscription.Status = models.SubscriptionStatusCancelled
 		subscription.PaymentStatus = models.PaymentStatusFailed
@@ -410,3 +828,141 @@ func (s *BillingService) handleStripeWebhook(ctx context.Context, eventType, ses
 
 	return nil
 }
+
+// startBillingPeriod starts the first billing period of a subscription when it is paid
+// for, since checkout may complete well after the subscription was created
+func startBillingPeriod(subscription *models.Subscription) {
+	subscription.StartDate = time.Now()
+	subscription.EndDate = subscription.Interval().PeriodEnd(subscription.StartDate)
+}
+
+// issueInvoice invoices the payment that paid for a subscription and sends the user a
+// receipt. An error makes the provider retry the webhook, which doesn't invoice a
+// payment twice.
+func (s *BillingService) issueInvoice(ctx context.Context, subscription *models.Subscription, data *payment.CheckoutSessionData) error {
+	return s.recordPayment(ctx, BillingEventPaymentSucceeded, Charge{
+		Subscription:  subscription,
+		TransactionID: data.TransactionID,
+		Amount:        data.AmountTotal,
+		Currency:      data.Currency,
+		Quantity:      subscription.Seats,
+		Overages:      s.paidAPIOverages(ctx, subscription, data.AmountTotal),
+	})
+}
+
+// handleStripeSubscriptionEvent applies a change of a recurring Stripe subscription or
+// one of its invoices to the matching subscription
+func (s *BillingService) handleStripeSubscriptionEvent(ctx context.Context, eventType string, data *payment.SubscriptionEventData) error {
+	subscription, err := s.findStripeSubscription(ctx, data)
+	if err != nil {
+		return err
+	}
+	if subscription.IsTrialing() {
+		return s.handleTrialEvent(ctx, eventType, subscription, data)
+	}
+
+	// A failed renewal starts the subscription's grace period. A subscription downgraded
+	// at the end of its grace period stays expired when Stripe reports it cancelled.
+	var startedDunning bool
+	wasActive := subscription.Status == models.SubscriptionStatusActive
+
+	switch eventType {
+	case "invoice.paid":
+		// Renewals of cancelled or expired subscriptions aren't applied
+		if data.AmountPaid == 0 || subscription.Status != models.SubscriptionStatusActive {
+			return nil
+		}
+		return s.applyPaidInvoice(ctx, subscription, BillingEventSubscriptionRenewed, data)
+
+	case "invoice.payment_failed":
+		subscription.PaymentStatus = models.PaymentStatusFailed
+		startedDunning = s.startDunning(subscription, data.InvoiceID, data.PaymentURL)
+
+	case "customer.subscription.updated":
+		switch data.Status {
+		case "active":
+			subscription.Status = models.SubscriptionStatusActive
+			subscription.PaymentStatus = models.PaymentStatusPaid
+			subscription.Dunning = nil
+			if !data.CurrentPeriodEnd.IsZero() {
+				subscription.EndDate = data.CurrentPeriodEnd
+			}
+		case "past_due", "unpaid":
+			subscription.PaymentStatus = models.PaymentStatusFailed
+			startedDunning = s.startDunning(subscription, "", "")
+		case "canceled":
+			if subscription.Status != models.SubscriptionStatusExpired {
+				subscription.Status = models.SubscriptionStatusCancelled
+			}
+			subscription.Dunning = nil
+		case "incomplete_expired":
+			subscription.Status = models.SubscriptionStatusExpired
+			subscription.PaymentStatus = models.PaymentStatusFailed
+			subscription.Dunning = nil
+		default:
+			logrus.WithField("status", data.Status).Debug("Ignoring Stripe subscription status")
+			return nil
+		}
+
+	case "customer.subscription.deleted":
+		if subscription.Status != models.SubscriptionStatusExpired {
+			subscription.Status = models.SubscriptionStatusCancelled
+		}
+		subscription.Dunning = nil
+
+	default:
+		logrus.WithField("event_type", eventType).Debug("Unhandled webhook event type")
+		return nil
+	}
+
+	if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"subscription_id": subscription.ID.Hex(),
+		"user_id":         subscription.UserID.Hex(),
+		"event_type":      eventType,
+		"status":          subscription.Status,
+		"payment_status":  subscription.PaymentStatus,
+	}).Info("Subscription updated via Stripe webhook")
+
+	if startedDunning {
+		s.notifyPaymentFailed(ctx, subscription)
+	}
+	if wasActive && subscription.Status == models.SubscriptionStatusCancelled {
+		s.publishBillingEvent(ctx, BillingEventSubscriptionCancelled, subscription.ID.Hex(), subscription, map[string]string{})
+	}
+
+	return nil
+}
+
+// findStripeSubscription finds the subscription of a Stripe subscription event by the
+// Stripe subscription ID, falling back to the subscription ID in its metadata
+func (s *BillingService) findStripeSubscription(ctx context.Context, data *payment.SubscriptionEventData) (*models.Subscription, error) {
+	if data.ProviderSubscriptionID != "" {
+		subscription, err := s.subscriptionRepo.FindByProviderSubscriptionID(ctx, data.ProviderSubscriptionID)
+		if err == nil {
+			return subscription, nil
+		}
+		if !errors.Is(err, repository.ErrSubscriptionNotFound) {
+			return nil, fmt.Errorf("failed to find subscription: %w", err)
+		}
+	}
+
+	id, err := primitive.ObjectIDFromHex(data.SubscriptionID)
+	if err != nil {
+		return nil, repository.ErrSubscriptionNotFound
+	}
+	subscription, err := s.subscriptionRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscription: %w", err)
+	}
+	if subscription == nil {
+		return nil, repository.ErrSubscriptionNotFound
+	}
+	if subscription.ProviderSubscriptionID == "" {
+		subscription.ProviderSubscriptionID = data.ProviderSubscriptionID
+	}
+	return subscription, nil
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+)
+
+// dunningCheckInterval is how often subscriptions with a failed payment are checked for
+// due retries and ended grace periods
+const dunningCheckInterval = time.Hour
+
+// dunningBatchSize bounds the subscriptions processed in one check
+const dunningBatchSize = 100
+
+// paymentEmailTimeout bounds emailing a user about a failed payment
+const paymentEmailTimeout = 30 * time.Second
+
+// DunningPolicy is how failed renewal payments are handled. A subscription keeps its
+// plan for GracePeriod after its payment failed, and the payment is retried at each
+// delay of RetrySchedule, counted from the failure.
+type DunningPolicy struct {
+	GracePeriod   time.Duration
+	RetrySchedule []time.Duration
+}
+
+// nextStep returns when the next dunning step of a subscription is due: its next retry,
+// or the end of its grace period once the retries are used up
+func (p *DunningPolicy) nextStep(dunning *models.Dunning) time.Time {
+	if dunning.Retries < len(p.RetrySchedule) {
+		if at := dunning.FailedAt.Add(p.RetrySchedule[dunning.Retries]); at.Before(dunning.GracePeriodEnd) {
+			return at
+		}
+	}
+	return dunning.GracePeriodEnd
+}
+
+// PaymentMailer sends failed payment emails through the notification-service
+type PaymentMailer interface {
+	SendPaymentEmail(ctx context.Context, userID, email, title, message string, metadata map[string]string) error
+}
+
+// SetDunning gives subscriptions whose renewal payment fails a grace period, in which the
+// payment is retried and the user is reminded by email to pay, before they are
+// downgraded to the Free plan. billingURL is the page the emails link to. Without it a
+// failed payment only marks the subscription's payment as failed.
+func (s *BillingService) SetDunning(policy DunningPolicy, billingURL string, directory EmailDirectory, mailer PaymentMailer) {
+	s.dunning = &policy
+	s.billingURL = billingURL
+	s.emails = directory
+	s.paymentMailer = mailer
+}
+
+// startDunning starts the grace period of an active subscription whose payment failed.
+// It reports whether the subscription entered its grace period; one already in it only
+// has the invoice to retry updated.
+func (s *BillingService) startDunning(subscription *models.Subscription, invoiceID, paymentURL string) bool {
+	if s.dunning == nil || subscription.Status != models.SubscriptionStatusActive {
+		return false
+	}
+
+	if subscription.Dunning != nil {
+		if invoiceID != "" {
+			subscription.Dunning.InvoiceID = invoiceID
+			subscription.Dunning.PaymentURL = paymentURL
+		}
+		return false
+	}
+
+	now := time.Now()
+	subscription.Dunning = &models.Dunning{
+		FailedAt:       now,
+		GracePeriodEnd: now.Add(s.dunning.GracePeriod),
+		InvoiceID:      invoiceID,
+		PaymentURL:     paymentURL,
+	}
+	subscription.Dunning.NextRetryAt = s.dunning.nextStep(subscription.Dunning)
+	return true
+}
+
+// RunDunning retries failed payments and ends grace periods as they come due, until ctx
+// is done
+func (s *BillingService) RunDunning(ctx context.Context) {
+	if s.dunning == nil {
+		return
+	}
+
+	ticker := time.NewTicker(dunningCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.processDunning(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processDunning takes the due dunning step of each past due subscription
+func (s *BillingService) processDunning(ctx context.Context) {
+	now := time.Now()
+	subscriptions, err := s.subscriptionRepo.ListDunningDue(ctx, now, dunningBatchSize)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list past due subscriptions")
+		return
+	}
+
+	for i := range subscriptions {
+		if err := s.dunningStep(ctx, &subscriptions[i], now); err != nil {
+			logrus.WithError(err).WithField("subscription_id", subscriptions[i].ID.Hex()).Error("Failed to process past due subscription")
+		}
+	}
+}
+
+// dunningStep retries the payment of a past due subscription, and reminds the user to
+// pay if that fails. Once the grace period is over the subscription is downgraded.
+func (s *BillingService) dunningStep(ctx context.Context, subscription *models.Subscription, now time.Time) error {
+	dunning := subscription.Dunning
+
+	// Claim the step until the next check, so that other instances skip it
+	claimed, err := s.subscriptionRepo.ClaimDunningStep(ctx, subscription.ID, dunning.NextRetryAt, now.Add(dunningCheckInterval))
+	if err != nil || !claimed {
+		return err
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"subscription_id": subscription.ID.Hex(),
+		"user_id":         subscription.UserID.Hex(),
+	})
+
+	if !now.Before(dunning.GracePeriodEnd) {
+		return s.endGracePeriod(ctx, subscription)
+	}
+
+	if s.retryPayment(subscription) {
+		// The provider's webhook for the paid invoice extends the billing period
+		subscription.PaymentStatus = models.PaymentStatusPaid
+		subscription.Dunning = nil
+		if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+		logger.Info("Failed payment recovered on retry")
+		return nil
+	}
+
+	dunning.Retries++
+	dunning.NextRetryAt = s.dunning.nextStep(dunning)
+	if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+	logger.WithFields(logrus.Fields{
+		"retries":       dunning.Retries,
+		"next_retry_at": dunning.NextRetryAt,
+	}).Warn("Payment retry failed")
+
+	go s.emailPaymentReminder(*subscription)
+	return nil
+}
+
+// retryPayment charges the failed invoice of a past due subscription again. Only Stripe
+// keeps the payment method of recurring subscriptions, so other payments can't be
+// retried and the user is just reminded to pay.
+func (s *BillingService) retryPayment(subscription *models.Subscription) bool {
+	if subscription.PaymentMethod != "stripe" || subscription.Dunning.InvoiceID == "" {
+		return false
+	}
+
+	paid, err := s.stripeService.RetryInvoicePayment(subscription.Dunning.InvoiceID)
+	if err != nil {
+		logrus.WithError(err).WithField("subscription_id", subscription.ID.Hex()).Warn("Failed to retry invoice payment")
+		return false
+	}
+	return paid
+}
+
+// endGracePeriod expires a subscription whose payment was not made in its grace period,
+// which moves its user, or the members of its organization, to the Free plan and its
+// smaller quota
+func (s *BillingService) endGracePeriod(ctx context.Context, subscription *models.Subscription) error {
+	if subscription.ProviderSubscriptionID != "" && subscription.PaymentMethod == "stripe" {
+		if err := s.stripeService.CancelRecurringSubscription(subscription.ProviderSubscriptionID); err != nil {
+			logrus.WithError(err).WithField("subscription_id", subscription.ID.Hex()).Warn("Failed to cancel Stripe subscription")
+		}
+	}
+
+	subscription.Status = models.SubscriptionStatusExpired
+	subscription.PaymentStatus = models.PaymentStatusFailed
+	subscription.EndDate = time.Now()
+	subscription.Dunning = nil
+	if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"subscription_id": subscription.ID.Hex(),
+		"user_id":         subscription.UserID.Hex(),
+	}).Warn("Grace period ended, subscription downgraded to Free")
+
+	go s.emailDowngrade(*subscription)
+	return nil
+}
+
+// emailPaymentFailed tells the user that a payment failed and how long the plan is kept
+func (s *BillingService) emailPaymentFailed(subscription models.Subscription) {
+	s.emailPayment(subscription, func(ctx context.Context, plan *models.Plan) (string, string) {
+		return fmt.Sprintf("Payment failed for your %s plan", plan.Name),
+			fmt.Sprintf("We couldn't collect the payment for your %s plan. Your plan stays active until %s while we retry the payment, or you can pay now with another payment method. If it isn't paid by then, you'll be moved to the Free plan.",
+				plan.Name, subscription.Dunning.GracePeriodEnd.Format("Jan 2, 2006"))
+	})
+}
+
+// emailPaymentReminder reminds the user of a payment that is still failing
+func (s *BillingService) emailPaymentReminder(subscription models.Subscription) {
+	s.emailPayment(subscription, func(ctx context.Context, plan *models.Plan) (string, string) {
+		return fmt.Sprintf("Your %s plan payment is still due", plan.Name),
+			fmt.Sprintf("The payment for your %s plan is still outstanding. Please pay it by %s to keep your plan, or you'll be moved to the Free plan.",
+				plan.Name, subscription.Dunning.GracePeriodEnd.Format("Jan 2, 2006"))
+	})
+}
+
+// emailDowngrade tells the user that a subscription ended at the end of its grace period
+func (s *BillingService) emailDowngrade(subscription models.Subscription) {
+	s.emailPayment(subscription, func(ctx context.Context, plan *models.Plan) (string, string) {
+		return fmt.Sprintf("Your %s plan has ended", plan.Name),
+			fmt.Sprintf("We couldn't collect the payment for your %s plan, so it has ended and you're now on the Free plan with %s. Your files are kept, but uploads are paused while you use more than that. Subscribe again from your billing page to restore your storage.",
+				plan.Name, s.freeQuotaText(ctx))
+	})
+}
+
+// freeQuotaText describes the storage of the Free plan, which downgraded users are on
+func (s *BillingService) freeQuotaText(ctx context.Context) string {
+	free, err := s.planRepo.FindByName(ctx, models.PlanFree)
+	if err != nil {
+		return "the Free plan's storage"
+	}
+	return fmt.Sprintf("%.0f GB of storage", float64(free.QuotaBytes)/(1024*1024*1024))
+}
+
+// emailPayment emails the user who bought a subscription about its payment, with a link
+// to pay it
+func (s *BillingService) emailPayment(subscription models.Subscription, compose func(ctx context.Context, plan *models.Plan) (string, string)) {
+	if s.paymentMailer == nil {
+		return
+	}
+	s.emailSubscriber(subscription, s.paymentMailer.SendPaymentEmail, compose)
+}
+
+// emailSubscriber emails the user who bought a subscription with send, linking to the
+// subscription's payment page or else the billing page
+func (s *BillingService) emailSubscriber(subscription models.Subscription, send func(ctx context.Context, userID, email, title, message string, metadata map[string]string) error, compose func(ctx context.Context, plan *models.Plan) (string, string)) {
+	ctx, cancel := context.WithTimeout(context.Background(), paymentEmailTimeout)
+	defer cancel()
+
+	logger := logrus.WithFields(logrus.Fields{
+		"subscription_id": subscription.ID.Hex(),
+		"user_id":         subscription.UserID.Hex(),
+	})
+
+	plan, err := s.planRepo.FindByID(ctx, subscription.PlanID)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get plan for billing email")
+		return
+	}
+
+	userID := subscription.UserID.Hex()
+	email, err := s.emails.GetEmail(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get email address for billing email")
+		return
+	}
+
+	link := s.billingURL
+	if subscription.Dunning != nil && subscription.Dunning.PaymentURL != "" {
+		link = subscription.Dunning.PaymentURL
+	}
+	metadata := map[string]string{
+		"subscription_id": subscription.ID.Hex(),
+		"link":            link,
+	}
+
+	title, message := compose(ctx, plan)
+	if err := send(ctx, userID, email, title, message, metadata); err != nil {
+		logger.WithError(err).Warn("Failed to send billing email")
+	}
+}
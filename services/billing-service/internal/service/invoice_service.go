@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/invoice"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidInvoiceID is returned for malformed invoice IDs
+var ErrInvalidInvoiceID = errors.New("invalid invoice ID")
+
+// invoiceEmailTimeout bounds emailing an invoice, which happens after the payment that
+// issued it has been processed
+const invoiceEmailTimeout = 30 * time.Second
+
+// EmailDirectory looks up the email addresses of users
+type EmailDirectory interface {
+	GetEmail(ctx context.Context, userID string) (string, error)
+}
+
+// InvoiceMailer sends invoice emails through the notification-service
+type InvoiceMailer interface {
+	SendInvoiceEmail(ctx context.Context, userID, email, title, message string, metadata map[string]string) error
+}
+
+// Charge is a successful payment for a subscription period. Amount is in the smallest
+// unit of Currency.
+type Charge struct {
+	Subscription  *models.Subscription
+	TransactionID string
+	Amount        int64
+	Currency      string
+
+	// Quantity is the number of seats paid for, 1 if unset. Description and PeriodStart
+	// override the plan and subscription period on the invoice, for charges such as
+	// added seats that pay for part of a period.
+	Quantity    int
+	Description string
+	PeriodStart time.Time
+
+	// Overages are API overages the charge paid for besides the plan. They are itemized
+	// separately and included in Amount.
+	Overages []models.APIOverage
+
+	// Receipted is set when the user gets a receipt for the charge from a billing event,
+	// so that the invoice isn't emailed as well
+	Receipted bool
+}
+
+// InvoiceService issues invoices for charges and renders them
+type InvoiceService struct {
+	invoiceRepo *repository.InvoiceRepository
+	planRepo    *repository.PlanRepository
+	renderer    *invoice.Renderer
+	tax         *TaxPolicy
+	invoiceURL  string
+
+	directory EmailDirectory
+	mailer    InvoiceMailer
+}
+
+// NewInvoiceService creates an invoice service. tax decides the tax included in charged
+// amounts, and invoiceURL is the page the invoice emails link to.
+func NewInvoiceService(invoiceRepo *repository.InvoiceRepository, planRepo *repository.PlanRepository, renderer *invoice.Renderer, tax *TaxPolicy, invoiceURL string) *InvoiceService {
+	return &InvoiceService{
+		invoiceRepo: invoiceRepo,
+		planRepo:    planRepo,
+		renderer:    renderer,
+		tax:         tax,
+		invoiceURL:  invoiceURL,
+	}
+}
+
+// SetMailer emails issued invoices to their users. Without it invoices are only
+// available through the API.
+func (s *InvoiceService) SetMailer(directory EmailDirectory, mailer InvoiceMailer) {
+	s.directory = directory
+	s.mailer = mailer
+}
+
+// IssueInvoice records an invoice for a charge and emails it to the user, unless they
+// get a receipt otherwise. A charge that has already been invoiced is not invoiced again.
+func (s *InvoiceService) IssueInvoice(ctx context.Context, charge Charge) (*models.Invoice, error) {
+	subscription := charge.Subscription
+	plan, err := s.planRepo.FindByID(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	quantity := int64(charge.Quantity)
+	if quantity < 1 {
+		quantity = 1
+	}
+	periodStart := subscription.StartDate
+	if !charge.PeriodStart.IsZero() {
+		periodStart = charge.PeriodStart
+	}
+	description := charge.Description
+	if description == "" {
+		description = fmt.Sprintf("%s plan (%s - %s)", plan.Name, periodStart.Format("Jan 2, 2006"), subscription.EndDate.Format("Jan 2, 2006"))
+	}
+
+	// Charged amounts include tax, unless the customer is reverse charged
+	treatment := s.tax.treatment(subscription.Billing)
+	subtotal, tax := treatment.split(charge.Amount)
+
+	// Overage lines are itemized at their share of the subtotal, and the plan gets the rest
+	var overageLines []models.InvoiceLineItem
+	planSubtotal := subtotal
+	for _, overage := range charge.Overages {
+		amount, _ := treatment.split(overage.Amount)
+		planSubtotal -= amount
+		overageLines = append(overageLines, models.InvoiceLineItem{
+			Description: overage.Description(),
+			Quantity:    overage.Blocks(),
+			UnitAmount:  amount / max(overage.Blocks(), 1),
+			Amount:      amount,
+		})
+	}
+
+	inv := &models.Invoice{
+		UserID:         subscription.UserID,
+		SubscriptionID: subscription.ID,
+		PlanID:         plan.ID,
+		PlanName:       plan.Name,
+		Status:         models.InvoiceStatusPaid,
+		PaymentMethod:  subscription.PaymentMethod,
+		TransactionID:  charge.TransactionID,
+		Currency:       strings.ToUpper(charge.Currency),
+		LineItems: append([]models.InvoiceLineItem{{
+			Description: description,
+			Quantity:    quantity,
+			UnitAmount:  planSubtotal / quantity,
+			Amount:      planSubtotal,
+		}}, overageLines...),
+		Subtotal:      subtotal,
+		TaxRate:       treatment.Rate,
+		Tax:           tax,
+		Total:         charge.Amount,
+		ReverseCharge: treatment.ReverseCharge,
+		BillTo:        subscription.Billing,
+		PeriodStart:   periodStart,
+		PeriodEnd:     subscription.EndDate,
+		IssuedAt:      time.Now(),
+	}
+	if treatment.ReverseCharge {
+		inv.TaxRate = 0
+	} else if treatment.Rate > 0 {
+		inv.TaxLines = []models.InvoiceTaxLine{{Name: treatment.Name, Rate: treatment.Rate, Amount: tax}}
+	}
+
+	if err := s.invoiceRepo.Create(ctx, inv); err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"invoice_id":      inv.ID.Hex(),
+		"number":          inv.Number,
+		"subscription_id": subscription.ID.Hex(),
+		"total":           inv.Total,
+		"currency":        inv.Currency,
+	}).Info("Invoice issued")
+
+	if !charge.Receipted {
+		go s.emailInvoice(inv)
+	}
+
+	return inv, nil
+}
+
+// emailInvoice tells the user about a new invoice, with a link to download it
+func (s *InvoiceService) emailInvoice(inv *models.Invoice) {
+	if s.mailer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), invoiceEmailTimeout)
+	defer cancel()
+
+	logger := logrus.WithFields(logrus.Fields{
+		"invoice_id": inv.ID.Hex(),
+		"user_id":    inv.UserID.Hex(),
+	})
+
+	userID := inv.UserID.Hex()
+	email, err := s.directory.GetEmail(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get email address for invoice")
+		return
+	}
+
+	title := fmt.Sprintf("Your invoice %s", inv.Number)
+	message := fmt.Sprintf("Thanks for your payment of %s for the %s plan. Your invoice %s covers %s to %s and is available to download from your billing page.",
+		models.FormatMoney(inv.Total, inv.Currency), inv.PlanName, inv.Number,
+		inv.PeriodStart.Format("Jan 2, 2006"), inv.PeriodEnd.Format("Jan 2, 2006"))
+	metadata := map[string]string{
+		"invoice_id":     inv.ID.Hex(),
+		"invoice_number": inv.Number,
+		"link":           s.invoiceURL,
+	}
+
+	if err := s.mailer.SendInvoiceEmail(ctx, userID, email, title, message, metadata); err != nil {
+		logger.WithError(err).Warn("Failed to email invoice")
+	}
+}
+
+// RecordRefund records a refund of an invoice's payment and emails the user about it
+func (s *InvoiceService) RecordRefund(ctx context.Context, inv *models.Invoice, refund models.InvoiceRefund) (*models.Invoice, error) {
+	updated, err := s.invoiceRepo.AddRefund(ctx, inv.ID, refund)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.emailRefund(updated, refund)
+
+	return updated, nil
+}
+
+// emailRefund tells the user about a refund of an invoice
+func (s *InvoiceService) emailRefund(inv *models.Invoice, refund models.InvoiceRefund) {
+	if s.mailer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), invoiceEmailTimeout)
+	defer cancel()
+
+	logger := logrus.WithFields(logrus.Fields{
+		"invoice_id": inv.ID.Hex(),
+		"user_id":    inv.UserID.Hex(),
+		"refund_id":  refund.ID,
+	})
+
+	userID := inv.UserID.Hex()
+	email, err := s.directory.GetEmail(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get email address for refund")
+		return
+	}
+
+	title := fmt.Sprintf("Refund for invoice %s", inv.Number)
+	message := fmt.Sprintf("We've refunded %s of your payment for invoice %s. It should reach your original payment method within 5 to 10 business days.",
+		models.FormatMoney(refund.Amount, inv.Currency), inv.Number)
+	if refund.Reason != "" {
+		message += " Reason: " + refund.Reason
+	}
+	metadata := map[string]string{
+		"invoice_id":     inv.ID.Hex(),
+		"invoice_number": inv.Number,
+		"refund_id":      refund.ID,
+		"link":           s.invoiceURL,
+	}
+
+	if err := s.mailer.SendInvoiceEmail(ctx, userID, email, title, message, metadata); err != nil {
+		logger.WithError(err).Warn("Failed to email refund")
+	}
+}
+
+// FindInvoice returns any user's invoice, for billing administrators
+func (s *InvoiceService) FindInvoice(ctx context.Context, invoiceID string) (*models.Invoice, error) {
+	id, err := primitive.ObjectIDFromHex(invoiceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInvoiceID, err)
+	}
+	return s.invoiceRepo.FindByID(ctx, id)
+}
+
+// ListInvoices returns a user's invoices, newest first, and their total count
+func (s *InvoiceService) ListInvoices(ctx context.Context, userID string, limit, offset int64) ([]models.Invoice, int64, error) {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+	return s.invoiceRepo.ListByUserID(ctx, uid, limit, offset)
+}
+
+// GetInvoice returns one of a user's invoices. Invoices of other users are reported as
+// not found.
+func (s *InvoiceService) GetInvoice(ctx context.Context, userID, invoiceID string) (*models.Invoice, error) {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+	id, err := primitive.ObjectIDFromHex(invoiceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInvoiceID, err)
+	}
+
+	inv, err := s.invoiceRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if inv.UserID != uid {
+		return nil, repository.ErrInvoiceNotFound
+	}
+	return inv, nil
+}
+
+// RenderInvoicePDF renders one of a user's invoices as a PDF
+func (s *InvoiceService) RenderInvoicePDF(ctx context.Context, userID, invoiceID string) (*models.Invoice, []byte, error) {
+	inv, err := s.GetInvoice(ctx, userID, invoiceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inv, s.renderer.Render(inv), nil
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotPlanAdmin    = errors.New("administrator access required")
+	ErrInvalidPlan     = errors.New("invalid plan")
+	ErrPlanNameTaken   = errors.New("a plan with this name already exists")
+	ErrPlanArchived    = errors.New("plan is no longer offered")
+	ErrProtectedPlan   = errors.New("default plans can't be renamed and the Free plan can't be archived")
+	ErrInvalidOrdering = errors.New("plan order must list every plan once")
+)
+
+// maxPlanNameLength bounds the length of plan names
+const maxPlanNameLength = 50
+
+// AdminDirectory looks up the accounts of billing administrators in the auth-service
+type AdminDirectory interface {
+	GetVerifiedEmail(ctx context.Context, userID string) (string, bool, error)
+}
+
+// PlanInput is a plan as created or updated by an admin. A PricePerYear of 0 bills
+// twelve monthly prices a year, and a TrialDays of 0 offers no free trial. The prices
+// are in USD, and Prices in the other currencies the plan can be bought in. An
+// APICallsIncluded of 0 offers no API access, and an APIOveragePer1000 of 0 doesn't bill
+// calls over the included calls.
+type PlanInput struct {
+	Name          string
+	QuotaBytes    int64
+	PricePerMonth float64
+	PricePerYear  float64
+	Prices        map[string]models.PricePoint
+	Description   string
+	Features      []string
+	IsPopular     bool
+	PerSeat       bool
+	TrialDays     int
+
+	APICallsIncluded  int64
+	APIOveragePer1000 float64
+}
+
+// SetPlanAdmins lets the users with the given email addresses, in lower case, manage the
+// plan catalog. Their accounts must have a verified email. Without it nobody can.
+func (s *BillingService) SetPlanAdmins(emails []string, directory AdminDirectory) {
+	s.planAdmins = emails
+	s.adminDirectory = directory
+}
+
+// AuthorizePlanAdmin checks that a user is a billing administrator, who may manage the
+// plan catalog, refund payments and query the audit log
+func (s *BillingService) AuthorizePlanAdmin(ctx context.Context, userID string) error {
+	if s.adminDirectory == nil || len(s.planAdmins) == 0 {
+		return ErrNotPlanAdmin
+	}
+
+	email, verified, err := s.adminDirectory.GetVerifiedEmail(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !verified || !slices.Contains(s.planAdmins, strings.ToLower(email)) {
+		return ErrNotPlanAdmin
+	}
+	return nil
+}
+
+// ListAllPlans returns every plan, including archived ones, in catalog order
+func (s *BillingService) ListAllPlans(ctx context.Context) ([]models.Plan, error) {
+	plans, err := s.planRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plans: %w", err)
+	}
+	return plans, nil
+}
+
+// CreatePlan adds a plan to the end of the catalog
+func (s *BillingService) CreatePlan(ctx context.Context, adminID string, input PlanInput) (*models.Plan, error) {
+	input, err := normalizePlanInput(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPlanName(ctx, input.Name, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+
+	plans, err := s.planRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plans: %w", err)
+	}
+
+	plan := &models.Plan{}
+	if n := len(plans); n > 0 {
+		plan.SortOrder = plans[n-1].SortOrder + 1
+	}
+	applyPlanInput(plan, input)
+
+	if err := s.planRepo.Create(ctx, plan); err != nil {
+		return nil, err
+	}
+	if err := s.keepOnlyPopular(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"admin_id": adminID,
+		"plan_id":  plan.ID.Hex(),
+		"name":     plan.Name,
+	}).Info("Plan created")
+	s.recordPlanAudit(ctx, models.AuditEventPlanCreated, adminID, plan)
+
+	return plan, nil
+}
+
+// UpdatePlan replaces the details of a plan. Existing subscriptions keep the price they
+// were bought at until they renew. Whether a plan is per seat can't be changed, since
+// its subscriptions are billed for organizations or users accordingly.
+func (s *BillingService) UpdatePlan(ctx context.Context, adminID, planID string, input PlanInput) (*models.Plan, error) {
+	id, err := primitive.ObjectIDFromHex(planID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlanID, err)
+	}
+
+	input, err = normalizePlanInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.planRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if input.PerSeat != plan.PerSeat {
+		return nil, fmt.Errorf("%w: per_seat can't be changed", ErrInvalidPlan)
+	}
+	if input.Name != plan.Name {
+		if isDefaultPlanName(plan.Name) {
+			return nil, ErrProtectedPlan
+		}
+		if err := s.checkPlanName(ctx, input.Name, plan.ID); err != nil {
+			return nil, err
+		}
+	}
+	if plan.Name == models.PlanFree && (input.PricePerMonth != 0 || input.PricePerYear != 0) {
+		return nil, fmt.Errorf("%w: the Free plan must be free", ErrInvalidPlan)
+	}
+
+	applyPlanInput(plan, input)
+	if err := s.planRepo.Update(ctx, plan); err != nil {
+		return nil, err
+	}
+	if err := s.keepOnlyPopular(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"admin_id": adminID,
+		"plan_id":  plan.ID.Hex(),
+		"name":     plan.Name,
+	}).Info("Plan updated")
+	s.recordPlanAudit(ctx, models.AuditEventPlanUpdated, adminID, plan)
+
+	return plan, nil
+}
+
+// SetPlanArchived archives a plan, which removes it from the catalog, or offers an
+// archived plan again. Subscriptions to an archived plan keep it until they end. The
+// Free plan is where users without a subscription are, so it can't be archived.
+func (s *BillingService) SetPlanArchived(ctx context.Context, adminID, planID string, archived bool) (*models.Plan, error) {
+	id, err := primitive.ObjectIDFromHex(planID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlanID, err)
+	}
+
+	plan, err := s.planRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if archived && plan.Name == models.PlanFree {
+		return nil, ErrProtectedPlan
+	}
+
+	if err := s.planRepo.SetArchived(ctx, id, archived); err != nil {
+		return nil, err
+	}
+	plan.Archived = archived
+
+	logrus.WithFields(logrus.Fields{
+		"admin_id": adminID,
+		"plan_id":  plan.ID.Hex(),
+		"archived": archived,
+	}).Info("Plan archive state changed")
+	eventType := models.AuditEventPlanUnarchived
+	if archived {
+		eventType = models.AuditEventPlanArchived
+	}
+	s.recordPlanAudit(ctx, eventType, adminID, plan)
+
+	return plan, nil
+}
+
+// ReorderPlans orders the catalog as planIDs, which must list every plan once
+func (s *BillingService) ReorderPlans(ctx context.Context, adminID string, planIDs []string) ([]models.Plan, error) {
+	plans, err := s.planRepo.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plans: %w", err)
+	}
+	if len(planIDs) != len(plans) {
+		return nil, ErrInvalidOrdering
+	}
+
+	known := make(map[primitive.ObjectID]bool, len(plans))
+	for _, plan := range plans {
+		known[plan.ID] = true
+	}
+	ids := make([]primitive.ObjectID, 0, len(planIDs))
+	for _, planID := range planIDs {
+		id, err := primitive.ObjectIDFromHex(planID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPlanID, err)
+		}
+		if !known[id] {
+			return nil, ErrInvalidOrdering
+		}
+		// Each plan may only be listed once
+		delete(known, id)
+		ids = append(ids, id)
+	}
+
+	if err := s.planRepo.Reorder(ctx, ids); err != nil {
+		return nil, err
+	}
+
+	logrus.WithField("admin_id", adminID).Info("Plans reordered")
+	s.recordAudit(ctx, &models.AuditEvent{
+		Type:    models.AuditEventPlansReordered,
+		Source:  models.AuditSourceAdmin,
+		ActorID: auditObjectID(adminID),
+		Details: map[string]string{"plan_ids": strings.Join(planIDs, ",")},
+	})
+
+	return s.ListAllPlans(ctx)
+}
+
+// checkPlanName checks that no plan other than the one with ID except has a name
+func (s *BillingService) checkPlanName(ctx context.Context, name string, except primitive.ObjectID) error {
+	existing, err := s.planRepo.FindByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			return nil
+		}
+		return err
+	}
+	if existing.ID != except {
+		return ErrPlanNameTaken
+	}
+	return nil
+}
+
+// keepOnlyPopular unmarks the other plans when a plan is marked popular, since the
+// catalog highlights a single plan
+func (s *BillingService) keepOnlyPopular(ctx context.Context, plan *models.Plan) error {
+	if !plan.IsPopular {
+		return nil
+	}
+	return s.planRepo.ClearPopular(ctx, plan.ID)
+}
+
+// upgradeAvailable reports whether the catalog offers a plan with more storage than plan
+func (s *BillingService) upgradeAvailable(ctx context.Context, plan *models.Plan) bool {
+	plans, err := s.planRepo.FindAvailable(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to list plans for upgrades")
+		return false
+	}
+	for _, other := range plans {
+		if other.PerSeat == plan.PerSeat && other.QuotaBytes > plan.QuotaBytes {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePlanInput trims a plan's text, normalizes its currency codes and checks that
+// its quota, prices and trial are valid
+func normalizePlanInput(input PlanInput) (PlanInput, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Description = strings.TrimSpace(input.Description)
+
+	features := make([]string, 0, len(input.Features))
+	for _, feature := range input.Features {
+		if feature = strings.TrimSpace(feature); feature != "" {
+			features = append(features, feature)
+		}
+	}
+	input.Features = features
+
+	prices := make(map[string]models.PricePoint, len(input.Prices))
+	for currency, price := range input.Prices {
+		currency = models.NormalizeCurrency(currency)
+		switch {
+		case currency == models.CurrencyUSD:
+			return input, fmt.Errorf("%w: USD prices are price_per_month and price_per_year", ErrInvalidPlan)
+		case !models.IsSupportedCurrency(currency):
+			return input, fmt.Errorf("%w: unsupported currency %q", ErrInvalidPlan, currency)
+		case price.PerMonth <= 0 || price.PerYear < 0 || price.APIOveragePer1000 < 0:
+			return input, fmt.Errorf("%w: %s prices must be positive", ErrInvalidPlan, strings.ToUpper(currency))
+		case input.APIOveragePer1000 > 0 && price.APIOveragePer1000 == 0:
+			return input, fmt.Errorf("%w: %s prices need an API overage price", ErrInvalidPlan, strings.ToUpper(currency))
+		case input.APIOveragePer1000 == 0 && price.APIOveragePer1000 > 0:
+			return input, fmt.Errorf("%w: %s API overage needs a USD price", ErrInvalidPlan, strings.ToUpper(currency))
+		}
+		prices[currency] = price
+	}
+	input.Prices = prices
+
+	switch {
+	case input.Name == "":
+		return input, fmt.Errorf("%w: name is required", ErrInvalidPlan)
+	case len(input.Name) > maxPlanNameLength:
+		return input, fmt.Errorf("%w: name must be at most %d characters", ErrInvalidPlan, maxPlanNameLength)
+	case input.QuotaBytes <= 0:
+		return input, fmt.Errorf("%w: quota_bytes must be positive", ErrInvalidPlan)
+	case input.PricePerMonth < 0 || input.PricePerYear < 0:
+		return input, fmt.Errorf("%w: prices must not be negative", ErrInvalidPlan)
+	case input.TrialDays < 0 || input.TrialDays > maxTrialDays:
+		return input, fmt.Errorf("%w: trial_days must be between 0 and %d", ErrInvalidPlan, maxTrialDays)
+	case input.TrialDays > 0 && (input.PerSeat || input.PricePerMonth == 0):
+		return input, fmt.Errorf("%w: only paid individual plans can have a free trial", ErrInvalidPlan)
+	case input.PricePerMonth == 0 && len(input.Prices) > 0:
+		return input, fmt.Errorf("%w: free plans can't have prices in other currencies", ErrInvalidPlan)
+	case input.APICallsIncluded < 0 || input.APIOveragePer1000 < 0:
+		return input, fmt.Errorf("%w: API calls and overage prices must not be negative", ErrInvalidPlan)
+	case input.APIOveragePer1000 > 0 && input.APICallsIncluded == 0:
+		return input, fmt.Errorf("%w: API overage needs included API calls", ErrInvalidPlan)
+	case input.APIOveragePer1000 > 0 && (input.PerSeat || input.PricePerMonth == 0):
+		return input, fmt.Errorf("%w: only paid individual plans can bill API overage", ErrInvalidPlan)
+	}
+	return input, nil
+}
+
+func applyPlanInput(plan *models.Plan, input PlanInput) {
+	plan.Name = input.Name
+	plan.QuotaBytes = input.QuotaBytes
+	plan.PricePerMonth = input.PricePerMonth
+	plan.PricePerYear = input.PricePerYear
+	plan.Prices = input.Prices
+	plan.Description = input.Description
+	plan.Features = input.Features
+	plan.IsPopular = input.IsPopular
+	plan.PerSeat = input.PerSeat
+	plan.TrialDays = input.TrialDays
+	plan.APICallsIncluded = input.APICallsIncluded
+	plan.APIOveragePer1000 = input.APIOveragePer1000
+}
+
+// isDefaultPlanName reports whether a plan is one the catalog was seeded with. Default
+// plans are found by name when seeding newer defaults, so they keep their names.
+func isDefaultPlanName(name string) bool {
+	for _, plan := range models.GetDefaultPlans() {
+		if plan.Name == name {
+			return true
+		}
+	}
+	return false
+}
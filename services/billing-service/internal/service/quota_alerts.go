@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// QuotaAlert tells a user that their storage usage crossed a threshold of their quota
+type QuotaAlert struct {
+	UserID     string
+	Level      models.QuotaAlertLevel
+	UsedBytes  int64
+	QuotaBytes int64
+	PlanName   string
+	// OrgID is set when the quota is shared by the members of a team subscription
+	OrgID string
+}
+
+// AlertPublisher publishes quota alerts for the notification-service to deliver
+type AlertPublisher interface {
+	PublishQuotaAlert(ctx context.Context, alert QuotaAlert) error
+}
+
+// SetAlertPublisher alerts users whose usage reaches 80% and 90% of their quota, or
+// exceeds it. Without it no quota alerts are sent.
+func (s *BillingService) SetAlertPublisher(publisher AlertPublisher) {
+	s.alerts = publisher
+}
+
+// checkQuotaAlert alerts a user whose usage grew past a quota threshold. Each alert is
+// sent once per billing period. Failures are logged rather than failing the usage update.
+func (s *BillingService) checkQuotaAlert(ctx context.Context, userID string, uid primitive.ObjectID) {
+	if s.alerts == nil {
+		return
+	}
+
+	logger := logrus.WithField("user_id", userID)
+
+	quota, err := s.storageQuota(ctx, userID, uid)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get quota for quota alert")
+		return
+	}
+
+	level := models.QuotaAlertLevelFor(quota.usage.UsedBytes, quota.quotaBytes)
+	if level == models.QuotaAlertNone {
+		return
+	}
+
+	claimed, err := s.usageRepo.ClaimQuotaAlert(ctx, uid, level, quota.periodStart)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to record quota alert")
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	alert := QuotaAlert{
+		UserID:     userID,
+		Level:      level,
+		UsedBytes:  quota.usage.UsedBytes,
+		QuotaBytes: quota.quotaBytes,
+		PlanName:   quota.plan.Name,
+	}
+	if quota.team != nil {
+		alert.OrgID = quota.team.OrgID.Hex()
+	}
+
+	if err := s.alerts.PublishQuotaAlert(ctx, alert); err != nil {
+		logger.WithError(err).Warn("Failed to publish quota alert")
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"alert":       level.EventType(),
+		"used_bytes":  alert.UsedBytes,
+		"quota_bytes": alert.QuotaBytes,
+	}).Info("Quota alert published")
+}
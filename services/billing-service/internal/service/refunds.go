@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidRefund   = errors.New("invalid refund")
+	ErrInvoiceRefunded = errors.New("invoice is already fully refunded")
+)
+
+// maxRefundReasonLength bounds the length of refund reasons
+const maxRefundReasonLength = 500
+
+// RefundInput is a refund of an invoice's payment requested by an admin. Amount is in
+// the smallest unit of the invoice currency, and 0 refunds all that is left.
+type RefundInput struct {
+	Amount int64
+	Reason string
+	// AdjustPeriod shortens the subscription by the refunded share of the invoiced
+	// period, or ends it once the whole invoice is refunded
+	AdjustPeriod bool
+}
+
+// RefundInvoice refunds all or part of the payment of an invoice with its payment
+// provider and records the refund on the invoice. The user is emailed about it.
+func (s *BillingService) RefundInvoice(ctx context.Context, adminID, invoiceID string, input RefundInput) (*models.Invoice, error) {
+	admin, err := primitive.ObjectIDFromHex(adminID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+	if s.invoiceService == nil {
+		return nil, fmt.Errorf("invoices are not enabled")
+	}
+
+	inv, err := s.invoiceService.FindInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	refundable := inv.RefundableAmount()
+	if refundable <= 0 {
+		return nil, ErrInvoiceRefunded
+	}
+	amount := input.Amount
+	if amount == 0 {
+		amount = refundable
+	}
+	reason := strings.TrimSpace(input.Reason)
+	switch {
+	case amount < 0 || amount > refundable:
+		return nil, fmt.Errorf("%w: amount must be between 1 and %d", ErrInvalidRefund, refundable)
+	case len(reason) > maxRefundReasonLength:
+		return nil, fmt.Errorf("%w: reason must be at most %d characters", ErrInvalidRefund, maxRefundReasonLength)
+	case inv.TransactionID == "":
+		return nil, fmt.Errorf("%w: the invoice has no payment to refund", ErrInvalidRefund)
+	}
+
+	var refundID string
+	switch inv.PaymentMethod {
+	case "stripe":
+		refundID, err = s.stripeService.RefundPayment(inv.TransactionID, amount)
+	case "razorpay":
+		refundID, err = s.razorpayService.RefundPayment(inv.TransactionID, amount)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPaymentMethod, inv.PaymentMethod)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund payment: %w", err)
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"admin_id":   adminID,
+		"invoice_id": inv.ID.Hex(),
+		"user_id":    inv.UserID.Hex(),
+		"refund_id":  refundID,
+		"amount":     amount,
+		"currency":   inv.Currency,
+	})
+
+	inv, err = s.invoiceService.RecordRefund(ctx, inv, models.InvoiceRefund{
+		ID:        refundID,
+		Amount:    amount,
+		Reason:    reason,
+		AdminID:   admin,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		// The money was returned, so the refund must be recorded by hand
+		logger.WithError(err).Error("Payment refunded but the refund could not be recorded")
+		return nil, err
+	}
+	logger.Info("Invoice refunded")
+
+	s.recordAudit(ctx, &models.AuditEvent{
+		Type:           models.AuditEventInvoiceRefunded,
+		Source:         models.AuditSourceAdmin,
+		ActorID:        admin,
+		UserID:         inv.UserID,
+		SubscriptionID: inv.SubscriptionID,
+		InvoiceID:      inv.ID,
+		PlanID:         inv.PlanID,
+		Details: map[string]string{
+			"refund_id":      refundID,
+			"amount":         strconv.FormatInt(amount, 10),
+			"currency":       inv.Currency,
+			"reason":         reason,
+			"adjust_period":  strconv.FormatBool(input.AdjustPeriod),
+			"invoice_status": string(inv.Status),
+		},
+	})
+
+	if input.AdjustPeriod {
+		if err := s.adjustRefundedPeriod(ctx, inv, amount); err != nil {
+			return nil, fmt.Errorf("refund recorded but the subscription was not adjusted: %w", err)
+		}
+	}
+
+	return inv, nil
+}
+
+// adjustRefundedPeriod takes the refunded share of an invoice's period off the
+// subscription it paid for, ending the subscription when nothing of the invoice is left
+// paid or its period would already be over. Subscriptions that have ended are left as
+// they are.
+func (s *BillingService) adjustRefundedPeriod(ctx context.Context, inv *models.Invoice, amount int64) error {
+	subscription, err := s.subscriptionRepo.FindByID(ctx, inv.SubscriptionID)
+	if err != nil {
+		return fmt.Errorf("failed to get subscription: %w", err)
+	}
+	now := time.Now()
+	if subscription == nil || !subscription.EndDate.After(now) ||
+		(subscription.Status != models.SubscriptionStatusActive && !subscription.IsTrialing()) {
+		return nil
+	}
+
+	period := inv.PeriodEnd.Sub(inv.PeriodStart)
+	end := subscription.EndDate.Add(-time.Duration(float64(period) * float64(amount) / float64(inv.Total)))
+
+	if inv.Status == models.InvoiceStatusRefunded || !end.After(now) {
+		if subscription.ProviderSubscriptionID != "" && subscription.PaymentMethod == "stripe" {
+			if err := s.stripeService.CancelRecurringSubscription(subscription.ProviderSubscriptionID); err != nil {
+				return err
+			}
+		}
+		subscription.Status = models.SubscriptionStatusCancelled
+		subscription.PaymentStatus = models.PaymentStatusRefunded
+		subscription.Dunning = nil
+		end = now
+	}
+	subscription.EndDate = end
+
+	if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"subscription_id": subscription.ID.Hex(),
+		"invoice_id":      inv.ID.Hex(),
+		"status":          subscription.Status,
+		"end_date":        subscription.EndDate,
+	}).Info("Subscription period adjusted for refund")
+
+	return nil
+}
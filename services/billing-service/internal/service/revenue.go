@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+)
+
+// RevenueStats are the monthly recurring revenue and the current subscriptions, for the
+// admin analytics
+type RevenueStats struct {
+	// MRR is the monthly recurring revenue of the active subscriptions per currency,
+	// before tax. Yearly subscriptions count for a twelfth of their price.
+	MRR                   map[string]float64 `json:"mrr"`
+	ActiveSubscriptions   int64              `json:"active_subscriptions"`
+	TrialingSubscriptions int64              `json:"trialing_subscriptions"`
+	Plans                 []PlanRevenue      `json:"plans"`
+}
+
+// PlanRevenue are the revenue and subscriptions of a plan. Seats are counted for
+// per-seat plans only.
+type PlanRevenue struct {
+	PlanID                string             `json:"plan_id"`
+	Name                  string             `json:"name"`
+	MRR                   map[string]float64 `json:"mrr"`
+	ActiveSubscriptions   int64              `json:"active_subscriptions"`
+	TrialingSubscriptions int64              `json:"trialing_subscriptions"`
+	Seats                 int64              `json:"seats,omitempty"`
+}
+
+// RevenueStats computes the monthly recurring revenue and counts the current
+// subscriptions of the tenant ctx is served for, or of every tenant outside of a request
+func (s *BillingService) RevenueStats(ctx context.Context) (*RevenueStats, error) {
+	groups, err := s.subscriptionRepo.GroupCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plans, err := s.planRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	planByID := make(map[string]*models.Plan, len(plans))
+	for i := range plans {
+		planByID[plans[i].ID.Hex()] = &plans[i]
+	}
+
+	stats := &RevenueStats{MRR: map[string]float64{}, Plans: []PlanRevenue{}}
+	byPlan := make(map[string]*PlanRevenue)
+	for _, group := range groups {
+		planID := group.PlanID.Hex()
+		planStats, ok := byPlan[planID]
+		if !ok {
+			planStats = &PlanRevenue{PlanID: planID, MRR: map[string]float64{}}
+			if plan := planByID[planID]; plan != nil {
+				planStats.Name = plan.Name
+			}
+			byPlan[planID] = planStats
+		}
+
+		plan := planByID[planID]
+		if plan != nil && plan.PerSeat {
+			planStats.Seats += group.Seats
+		}
+		if group.Status == models.SubscriptionStatusTrialing {
+			planStats.TrialingSubscriptions += group.Subscriptions
+			stats.TrialingSubscriptions += group.Subscriptions
+			continue
+		}
+		planStats.ActiveSubscriptions += group.Subscriptions
+		stats.ActiveSubscriptions += group.Subscriptions
+
+		if plan == nil || plan.IsFree() {
+			continue
+		}
+		mrr, currency, ok := monthlyRevenue(plan, group)
+		if !ok {
+			continue
+		}
+		planStats.MRR[currency] += mrr
+		stats.MRR[currency] += mrr
+	}
+
+	for _, planStats := range byPlan {
+		roundAmounts(planStats.MRR)
+		stats.Plans = append(stats.Plans, *planStats)
+	}
+	roundAmounts(stats.MRR)
+	sort.Slice(stats.Plans, func(i, j int) bool {
+		return stats.Plans[i].ActiveSubscriptions > stats.Plans[j].ActiveSubscriptions
+	})
+	return stats, nil
+}
+
+// monthlyRevenue returns the monthly revenue of a group of active subscriptions to a
+// paid plan and its currency, and false if the plan isn't priced in it. Subscriptions
+// created before yearly billing or before other currencies are monthly and in USD.
+func monthlyRevenue(plan *models.Plan, group repository.SubscriptionGroup) (float64, string, bool) {
+	interval := group.BillingInterval
+	if !interval.IsValid() {
+		interval = models.BillingIntervalMonth
+	}
+	currency := group.Currency
+	if currency == "" {
+		currency = models.CurrencyUSD
+	}
+
+	price, ok := plan.PriceIn(currency, interval)
+	if !ok {
+		return 0, "", false
+	}
+	if interval == models.BillingIntervalYear {
+		price /= 12
+	}
+
+	units := group.Subscriptions
+	if plan.PerSeat && group.Seats > 0 {
+		units = group.Seats
+	}
+	return price * float64(units), currency, true
+}
+
+// roundAmounts rounds amounts to cents
+func roundAmounts(amounts map[string]float64) {
+	for currency, amount := range amounts {
+		amounts[currency] = math.Round(amount*100) / 100
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"math"
+
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+)
+
+// ErrInvalidBillingDetails is returned for malformed billing countries and tax IDs
+var ErrInvalidBillingDetails = errors.New("invalid billing details")
+
+// TaxPolicy decides the tax on charges. Plan prices include the tax of the customer's
+// country, except for business customers abroad, who account for the tax themselves
+// under the reverse charge and are charged the price without it.
+type TaxPolicy struct {
+	// DefaultRate is the tax rate, in percent, of countries without their own rate and
+	// of customers who gave no billing country
+	DefaultRate float64
+	// Rates are tax rates in percent by country code, or by country and region code
+	// joined with a dash, such as "US-CA", for countries taxed by region
+	Rates map[string]float64
+	// SellerCountry is the country the platform is established in. Business customers
+	// elsewhere are reverse charged. Without it nobody is.
+	SellerCountry string
+}
+
+// taxTreatment is the tax of a customer's charges
+type taxTreatment struct {
+	Name string
+	// Rate is the percentage of tax included in charges. It is the rate the customer
+	// would otherwise pay for reverse-charged customers, who are charged without tax.
+	Rate          float64
+	ReverseCharge bool
+}
+
+// treatment returns the tax of the charges of a customer with the given billing
+// details, which are nil if the customer gave none
+func (p *TaxPolicy) treatment(details *models.BillingDetails) taxTreatment {
+	if p == nil {
+		return taxTreatment{Name: "Tax"}
+	}
+	if details == nil {
+		return taxTreatment{Name: "Tax", Rate: p.DefaultRate}
+	}
+
+	rate, ok := p.Rates[details.Country]
+	if details.Region != "" {
+		if regional, found := p.Rates[details.Country+"-"+details.Region]; found {
+			rate, ok = regional, true
+		}
+	}
+	if !ok {
+		rate = p.DefaultRate
+	}
+
+	return taxTreatment{
+		Name:          models.TaxName(details.Country),
+		Rate:          rate,
+		ReverseCharge: details.IsBusiness() && p.SellerCountry != "" && details.Country != p.SellerCountry,
+	}
+}
+
+// chargedPrice returns what a customer is charged for a price, which includes tax
+func (p *TaxPolicy) chargedPrice(details *models.BillingDetails, price float64) float64 {
+	treatment := p.treatment(details)
+	if !treatment.ReverseCharge {
+		return price
+	}
+	return price / (1 + treatment.Rate/100)
+}
+
+// split divides a charged amount, in the smallest unit of its currency, into the amount
+// before tax and the tax it includes
+func (t taxTreatment) split(amount int64) (subtotal, tax int64) {
+	if t.ReverseCharge {
+		return amount, 0
+	}
+	subtotal = int64(math.Round(float64(amount) / (1 + t.Rate/100)))
+	return subtotal, amount - subtotal
+}
@@ -0,0 +1,631 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/payment"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidOrganizationID = errors.New("invalid organization ID")
+	ErrOrganizationNotFound  = errors.New("organization not found")
+	ErrNotOrganizationAdmin  = errors.New("only organization owners and admins can manage team billing")
+	ErrNotTeamPlan           = errors.New("only per-seat plans can be bought for an organization")
+	ErrInvalidSeatCount      = errors.New("invalid seat count")
+	ErrSeatsInUse            = errors.New("an organization needs a seat for every member")
+	ErrSeatCreditChanged     = errors.New("the seat credit changed since the quote, please try again")
+)
+
+// maxSeats bounds the seats of a team subscription
+const maxSeats = 1000
+
+// minSeatCharge is the smallest prorated amount, in US cents, that is charged for added
+// seats. Payment providers reject smaller charges, so seats that cost less are added
+// free of charge.
+const minSeatCharge = 50
+
+// OrganizationDirectory looks up organizations and their members in the auth-service.
+// OrganizationRole returns "owner", "admin" or "member", or "" for non-members.
+type OrganizationDirectory interface {
+	OrganizationRole(ctx context.Context, userID, orgID string) (string, error)
+	ListOrganizationIDs(ctx context.Context, userID string) ([]string, error)
+	ListMemberIDs(ctx context.Context, orgID, asUserID string) ([]string, error)
+}
+
+// SetTeamBilling enables per-seat plans, which organizations buy for their members.
+// Without it per-seat plans can't be bought.
+func (s *BillingService) SetTeamBilling(seatChangeRepo *repository.SeatChangeRepository, orgs OrganizationDirectory) {
+	s.seatChangeRepo = seatChangeRepo
+	s.orgs = orgs
+}
+
+// TeamSubscription is an organization's team subscription and the use of its seats and
+// shared quota
+type TeamSubscription struct {
+	Subscription *models.Subscription
+	Plan         *models.Plan
+	Members      int
+	QuotaBytes   int64
+	UsedBytes    int64
+}
+
+// SeatQuote is the price of changing the seats of a team subscription for the rest of
+// its current period. Amounts are in the smallest unit of Currency, the subscription's.
+type SeatQuote struct {
+	Currency     string
+	CurrentSeats int
+	Seats        int
+	// Prorated is the price of the change, negative when seats are removed
+	Prorated int64
+	// CreditApplied is the seat credit paying for part of added seats, and AmountDue
+	// what is left to pay
+	CreditApplied int64
+	AmountDue     int64
+	// CreditEarned is the unused value of removed seats, kept as seat credit
+	CreditEarned int64
+	PeriodEnd    time.Time
+}
+
+// SeatChangeResult is the outcome of changing the seats of a team subscription. Removed
+// seats, and added seats that cost nothing, are changed right away; other added seats
+// are added once paid through Checkout.
+type SeatChangeResult struct {
+	Subscription *models.Subscription
+	Quote        *SeatQuote
+	Checkout     *Checkout
+}
+
+// GetTeamSubscription returns the active team subscription of an organization the user
+// is a member of
+func (s *BillingService) GetTeamSubscription(ctx context.Context, userID, orgID string) (*TeamSubscription, error) {
+	org, role, err := s.organizationRole(ctx, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrOrganizationNotFound
+	}
+
+	subscription, plan, err := s.findTeamSubscription(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIDs, usedBytes, err := s.teamUsage(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TeamSubscription{
+		Subscription: subscription,
+		Plan:         plan,
+		Members:      len(memberIDs),
+		QuotaBytes:   plan.QuotaBytes * int64(subscription.Seats),
+		UsedBytes:    usedBytes,
+	}, nil
+}
+
+// QuoteSeats prices changing the seats of an organization's team subscription
+func (s *BillingService) QuoteSeats(ctx context.Context, userID, orgID string, seats int) (*SeatQuote, error) {
+	_, quote, _, err := s.quoteSeats(ctx, userID, orgID, seats)
+	return quote, err
+}
+
+func (s *BillingService) quoteSeats(ctx context.Context, userID, orgID string, seats int) (*models.Subscription, *SeatQuote, *models.Plan, error) {
+	org, err := s.authorizeTeamBilling(ctx, userID, orgID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := s.checkSeatCount(ctx, orgID, userID, seats); err != nil {
+		return nil, nil, nil, err
+	}
+
+	subscription, plan, err := s.findTeamSubscription(ctx, org)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	currency := subscription.BillingCurrency()
+	seatPrice, ok := plan.PriceIn(currency, subscription.Interval())
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
+
+	// Business customers abroad are charged without tax
+	seatPrice = s.tax.chargedPrice(subscription.Billing, seatPrice)
+
+	quote := &SeatQuote{
+		Currency:     currency,
+		CurrentSeats: subscription.Seats,
+		Seats:        seats,
+		Prorated:     prorateSeats(subscription, seatPrice, seats, time.Now()),
+		PeriodEnd:    subscription.EndDate,
+	}
+	if quote.Prorated > 0 {
+		quote.CreditApplied = min(subscription.SeatCredit, quote.Prorated)
+		quote.AmountDue = quote.Prorated - quote.CreditApplied
+		if quote.AmountDue < minSeatCharge {
+			quote.AmountDue = 0
+		}
+	} else {
+		quote.CreditEarned = -quote.Prorated
+	}
+
+	return subscription, quote, plan, nil
+}
+
+// UpdateSeats changes the seats of an organization's team subscription. Removed seats
+// are credited for the rest of the period; added seats cost their prorated price, less
+// any credit, and are added once paid. The credit is reserved for the change right away,
+// so that concurrent changes can't spend it twice.
+func (s *BillingService) UpdateSeats(ctx context.Context, userID, orgID string, seats int) (*SeatChangeResult, error) {
+	subscription, quote, plan, err := s.quoteSeats(ctx, userID, orgID, seats)
+	if err != nil {
+		return nil, err
+	}
+	result := &SeatChangeResult{Subscription: subscription, Quote: quote}
+
+	delta := seats - subscription.Seats
+	switch {
+	case delta == 0:
+		return result, nil
+
+	case delta < 0 || quote.AmountDue == 0:
+		updated, err := s.subscriptionRepo.ChangeSeats(ctx, subscription.ID, delta, quote.CreditEarned-quote.CreditApplied)
+		if err != nil {
+			return nil, seatCreditError(err)
+		}
+		result.Subscription = updated
+
+		logrus.WithFields(logrus.Fields{
+			"subscription_id": subscription.ID.Hex(),
+			"org_id":          orgID,
+			"user_id":         userID,
+			"seats":           updated.Seats,
+			"credit":          updated.SeatCredit,
+		}).Info("Team seats changed")
+
+		s.recordSubscriptionAudit(ctx, models.AuditEventSeatsChanged, userID, updated, map[string]string{
+			"from_seats":     strconv.Itoa(subscription.Seats),
+			"to_seats":       strconv.Itoa(updated.Seats),
+			"credit_applied": strconv.FormatInt(quote.CreditApplied, 10),
+			"credit_earned":  strconv.FormatInt(quote.CreditEarned, 10),
+			"status":         string(models.SeatChangeStatusApplied),
+		})
+
+		return result, nil
+	}
+
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+
+	change := &models.SeatChange{
+		SubscriptionID: subscription.ID,
+		OrgID:          subscription.OrgID,
+		UserID:         uid,
+		FromSeats:      subscription.Seats,
+		ToSeats:        seats,
+		Amount:         quote.AmountDue,
+		CreditApplied:  quote.CreditApplied,
+		Status:         models.SeatChangeStatusPending,
+	}
+	if change.CreditApplied > 0 {
+		if _, err := s.subscriptionRepo.ChangeSeats(ctx, subscription.ID, 0, -change.CreditApplied); err != nil {
+			return nil, seatCreditError(err)
+		}
+	}
+	if err := s.seatChangeRepo.Create(ctx, change); err != nil {
+		s.releaseSeatCredit(ctx, change)
+		return nil, err
+	}
+
+	checkout, err := s.seatCheckout(plan, quote, userID, subscription, change)
+	if err != nil {
+		if _, resolveErr := s.seatChangeRepo.Resolve(ctx, change.ID, models.SeatChangeStatusFailed, ""); resolveErr != nil {
+			logrus.WithError(resolveErr).Error("Failed to fail seat change without a checkout")
+		} else {
+			s.releaseSeatCredit(ctx, change)
+		}
+		return nil, err
+	}
+
+	if err := s.seatChangeRepo.SetSessionID(ctx, change.ID, checkout.SessionID); err != nil {
+		logrus.WithError(err).Error("Failed to update seat change with session ID")
+	}
+	result.Checkout = checkout
+
+	logrus.WithFields(logrus.Fields{
+		"subscription_id": subscription.ID.Hex(),
+		"seat_change_id":  change.ID.Hex(),
+		"org_id":          orgID,
+		"user_id":         userID,
+		"from_seats":      change.FromSeats,
+		"to_seats":        change.ToSeats,
+		"amount":          change.Amount,
+	}).Info("Seat change awaiting payment")
+
+	s.recordSubscriptionAudit(ctx, models.AuditEventSeatsChanged, userID, subscription, map[string]string{
+		"seat_change_id": change.ID.Hex(),
+		"from_seats":     strconv.Itoa(change.FromSeats),
+		"to_seats":       strconv.Itoa(change.ToSeats),
+		"amount":         strconv.FormatInt(change.Amount, 10),
+		"currency":       quote.Currency,
+		"status":         string(models.SeatChangeStatusPending),
+	})
+
+	return result, nil
+}
+
+// seatCheckout creates the checkout paying for the seats added by a seat change
+func (s *BillingService) seatCheckout(plan *models.Plan, quote *SeatQuote, userID string, subscription *models.Subscription, change *models.SeatChange) (*Checkout, error) {
+	checkout := &Checkout{}
+	switch subscription.PaymentMethod {
+	case "stripe":
+		session, err := s.stripeService.CreateSeatCheckoutSession(plan, quote.Currency, userID, subscription.ID.Hex(), change.ID.Hex(), change.AddedSeats(), quote.AmountDue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Stripe session: %w", err)
+		}
+		checkout.PaymentURL = session.URL
+		checkout.SessionID = session.ID
+
+	case "razorpay":
+		razorpayCheckout, err := s.razorpayService.CreateSeatOrder(plan, quote.Currency, userID, subscription.ID.Hex(), change.ID.Hex(), change.AddedSeats(), quote.AmountDue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Razorpay order: %w", err)
+		}
+		checkout.SessionID = razorpayCheckout.OrderID
+		checkout.Razorpay = razorpayCheckout
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPaymentMethod, subscription.PaymentMethod)
+	}
+	return checkout, nil
+}
+
+// releaseSeatCredit gives the seat credit reserved for a seat change that failed back to
+// its subscription
+func (s *BillingService) releaseSeatCredit(ctx context.Context, change *models.SeatChange) error {
+	if change.CreditApplied <= 0 {
+		return nil
+	}
+	if _, err := s.subscriptionRepo.ChangeSeats(ctx, change.SubscriptionID, 0, change.CreditApplied); err != nil {
+		logrus.WithError(err).WithField("seat_change_id", change.ID.Hex()).Error("Failed to release seat credit")
+		return err
+	}
+	return nil
+}
+
+// seatCreditError returns ErrSeatCreditChanged when a seat change spent more credit than
+// was left, because another change spent it since the quote
+func seatCreditError(err error) error {
+	if errors.Is(err, repository.ErrInsufficientSeatCredit) {
+		return ErrSeatCreditChanged
+	}
+	return err
+}
+
+// prorateSeats returns the price, in the smallest unit of the subscription's currency, of
+// changing a team subscription to seats seats for the rest of its current period.
+// seatPrice is the price of a seat for the whole period.
+func prorateSeats(subscription *models.Subscription, seatPrice float64, seats int, now time.Time) int64 {
+	period := subscription.EndDate.Sub(subscription.StartDate)
+	remaining := subscription.EndDate.Sub(now)
+	if period <= 0 || remaining <= 0 {
+		return 0
+	}
+
+	return int64(math.Round(float64(seats-subscription.Seats) * seatPrice * 100 * float64(remaining) / float64(period)))
+}
+
+// handleSeatChangePayment adds the seats of a seat change once its payment succeeds.
+// Providers retry webhooks, so a seat change is only applied once.
+func (s *BillingService) handleSeatChangePayment(ctx context.Context, eventType string, data *payment.CheckoutSessionData) error {
+	if s.seatChangeRepo == nil {
+		return fmt.Errorf("team billing is not configured")
+	}
+
+	id, err := primitive.ObjectIDFromHex(data.SeatChangeID)
+	if err != nil {
+		return repository.ErrSeatChangeNotFound
+	}
+	change, err := s.seatChangeRepo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"seat_change_id":  change.ID.Hex(),
+		"subscription_id": change.SubscriptionID.Hex(),
+		"transaction_id":  data.TransactionID,
+	})
+
+	switch eventType {
+	case "checkout.session.completed", "payment.captured":
+		if data.PaymentStatus == "unpaid" {
+			logger.Info("Seat checkout completed, awaiting payment")
+			return nil
+		}
+
+		applied, err := s.seatChangeRepo.Resolve(ctx, change.ID, models.SeatChangeStatusApplied, data.TransactionID)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			// A retried event still invoices the payment if that failed the first time
+			if change.Status == models.SeatChangeStatusApplied && change.TransactionID == data.TransactionID {
+				return s.issueSeatInvoice(ctx, change, data)
+			}
+			return nil
+		}
+
+		// The credit was taken off when the change was created
+		if _, err := s.subscriptionRepo.ChangeSeats(ctx, change.SubscriptionID, change.AddedSeats(), 0); err != nil {
+			// Let the provider's retry apply the seats
+			if reopenErr := s.seatChangeRepo.Reopen(ctx, change.ID, models.SeatChangeStatusApplied); reopenErr != nil {
+				logger.WithError(reopenErr).Error("Failed to reopen seat change")
+			}
+			return err
+		}
+		logger.WithField("added_seats", change.AddedSeats()).Info("Team seats added")
+
+		return s.issueSeatInvoice(ctx, change, data)
+
+	case "checkout.session.expired":
+		failed, err := s.seatChangeRepo.Resolve(ctx, change.ID, models.SeatChangeStatusFailed, "")
+		if err != nil || !failed {
+			return err
+		}
+		if err := s.releaseSeatCredit(ctx, change); err != nil {
+			// Let the provider's retry release the credit
+			if reopenErr := s.seatChangeRepo.Reopen(ctx, change.ID, models.SeatChangeStatusFailed); reopenErr != nil {
+				logger.WithError(reopenErr).Error("Failed to reopen seat change")
+			}
+			return err
+		}
+		logger.WithField("credit_released", change.CreditApplied).Warn("Seat checkout expired")
+
+	case "payment.failed":
+		// The payment can be retried from the same checkout
+		logger.Warn("Seat payment failed")
+
+	default:
+		logrus.WithField("event_type", eventType).Debug("Unhandled webhook event type")
+	}
+
+	return nil
+}
+
+// issueSeatInvoice invoices the payment for added seats and sends the user a receipt
+func (s *BillingService) issueSeatInvoice(ctx context.Context, change *models.SeatChange, data *payment.CheckoutSessionData) error {
+	if data.TransactionID == "" {
+		return nil
+	}
+
+	subscription, err := s.subscriptionRepo.FindByID(ctx, change.SubscriptionID)
+	if err != nil {
+		return fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if subscription == nil {
+		return repository.ErrSubscriptionNotFound
+	}
+
+	paidAt := time.Now()
+	return s.recordPayment(ctx, BillingEventPaymentSucceeded, Charge{
+		Subscription:  subscription,
+		TransactionID: data.TransactionID,
+		Amount:        data.AmountTotal,
+		Currency:      data.Currency,
+		Quantity:      change.AddedSeats(),
+		Description: fmt.Sprintf("Additional seats, prorated (%s - %s)",
+			paidAt.Format("Jan 2, 2006"), subscription.EndDate.Format("Jan 2, 2006")),
+		PeriodStart: paidAt,
+	})
+}
+
+// storageQuota is the storage a user may use and how much of it is used. Members of an
+// organization with a team subscription share its quota, unless they have a personal
+// subscription.
+type storageQuota struct {
+	plan       *models.Plan
+	quotaBytes int64
+	usage      *models.Usage
+	team       *models.Subscription
+	// subscription is the user's own subscription, nil on the Free plan
+	subscription *models.Subscription
+	// periodStart is the start of the billing period, which is the calendar month for
+	// the Free plan
+	periodStart time.Time
+}
+
+// billed returns the subscription the quota is paid by, or nil on the Free plan
+func (q *storageQuota) billed() *models.Subscription {
+	if q.team != nil {
+		return q.team
+	}
+	return q.subscription
+}
+
+func (s *BillingService) storageQuota(ctx context.Context, userID string, uid primitive.ObjectID) (*storageQuota, error) {
+	subscription, plan, err := s.GetUserSubscription(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user subscription: %w", err)
+	}
+
+	if subscription == nil && s.orgs != nil {
+		quota, err := s.teamQuota(ctx, userID)
+		if err == nil && quota != nil {
+			return quota, nil
+		}
+		if err != nil {
+			// Fall back to the user's own quota rather than blocking uploads
+			logrus.WithError(err).WithField("user_id", userID).Warn("Failed to get team quota")
+		}
+	}
+
+	usage, err := s.usageRepo.FindOrCreate(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	quota := &storageQuota{plan: plan, quotaBytes: plan.QuotaBytes, usage: usage, subscription: subscription}
+	if subscription != nil {
+		quota.periodStart = subscription.PeriodStart()
+	} else {
+		now := time.Now().UTC()
+		quota.periodStart = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return quota, nil
+}
+
+// teamQuota returns the shared quota of the first organization of the user with an
+// active team subscription, or nil if none has one
+func (s *BillingService) teamQuota(ctx context.Context, userID string) (*storageQuota, error) {
+	orgIDs, err := s.orgs.ListOrganizationIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orgIDs) == 0 {
+		return nil, nil
+	}
+
+	orgs := make([]primitive.ObjectID, 0, len(orgIDs))
+	for _, orgID := range orgIDs {
+		if org, err := primitive.ObjectIDFromHex(orgID); err == nil {
+			orgs = append(orgs, org)
+		}
+	}
+	subscriptions, err := s.subscriptionRepo.FindActiveByOrgIDs(ctx, orgs)
+	if err != nil {
+		return nil, err
+	}
+	if len(subscriptions) == 0 {
+		return nil, nil
+	}
+
+	team := &subscriptions[0]
+	plan, err := s.planRepo.FindByID(ctx, team.PlanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	_, usedBytes, err := s.teamUsage(ctx, team.OrgID.Hex(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storageQuota{
+		plan:        plan,
+		quotaBytes:  plan.QuotaBytes * int64(team.Seats),
+		usage:       &models.Usage{UserID: team.OrgID, UsedBytes: usedBytes},
+		team:        team,
+		periodStart: team.PeriodStart(),
+	}, nil
+}
+
+// teamUsage returns the members of an organization, as seen by the member asUserID, and
+// the storage they use together
+func (s *BillingService) teamUsage(ctx context.Context, orgID, asUserID string) ([]string, int64, error) {
+	memberIDs, err := s.orgs.ListMemberIDs(ctx, orgID, asUserID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	members := make([]primitive.ObjectID, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		if member, err := primitive.ObjectIDFromHex(memberID); err == nil {
+			members = append(members, member)
+		}
+	}
+	usedBytes, err := s.usageRepo.SumUsedBytes(ctx, members)
+	if err != nil {
+		return nil, 0, err
+	}
+	return memberIDs, usedBytes, nil
+}
+
+// findTeamSubscription returns the active team subscription of an organization and its
+// plan
+func (s *BillingService) findTeamSubscription(ctx context.Context, org primitive.ObjectID) (*models.Subscription, *models.Plan, error) {
+	subscription, err := s.subscriptionRepo.FindActiveByOrgID(ctx, org)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subscription == nil {
+		return nil, nil, repository.ErrSubscriptionNotFound
+	}
+
+	plan, err := s.planRepo.FindByID(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	return subscription, plan, nil
+}
+
+// organizationRole returns the user's role in an organization, "" for non-members
+func (s *BillingService) organizationRole(ctx context.Context, userID, orgID string) (primitive.ObjectID, string, error) {
+	if s.orgs == nil {
+		return primitive.NilObjectID, "", fmt.Errorf("team billing is not configured")
+	}
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		return primitive.NilObjectID, "", fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+	if orgID == "" {
+		return primitive.NilObjectID, "", fmt.Errorf("%w: org_id is required", ErrInvalidOrganizationID)
+	}
+	org, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return primitive.NilObjectID, "", fmt.Errorf("%w: %v", ErrInvalidOrganizationID, err)
+	}
+
+	role, err := s.orgs.OrganizationRole(ctx, userID, orgID)
+	if err != nil {
+		return primitive.NilObjectID, "", fmt.Errorf("failed to get organization role: %w", err)
+	}
+	return org, role, nil
+}
+
+// authorizeTeamBilling checks that the user is an owner or admin of an organization,
+// who manage its billing
+func (s *BillingService) authorizeTeamBilling(ctx context.Context, userID, orgID string) (primitive.ObjectID, error) {
+	org, role, err := s.organizationRole(ctx, userID, orgID)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	switch role {
+	case "owner", "admin":
+		return org, nil
+	case "":
+		return primitive.NilObjectID, ErrOrganizationNotFound
+	default:
+		return primitive.NilObjectID, ErrNotOrganizationAdmin
+	}
+}
+
+// checkSeatCount checks that an organization may have seats seats, which must cover its
+// current members
+func (s *BillingService) checkSeatCount(ctx context.Context, orgID, asUserID string, seats int) error {
+	if seats < 1 || seats > maxSeats {
+		return fmt.Errorf("%w: seats must be between 1 and %d", ErrInvalidSeatCount, maxSeats)
+	}
+
+	memberIDs, err := s.orgs.ListMemberIDs(ctx, orgID, asUserID)
+	if err != nil {
+		return fmt.Errorf("failed to list organization members: %w", err)
+	}
+	if seats < len(memberIDs) {
+		return fmt.Errorf("%w: the organization has %d members", ErrSeatsInUse, len(memberIDs))
+	}
+	return nil
+}
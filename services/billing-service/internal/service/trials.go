@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing-platform/services/billing-service/internal/payment"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// trialCheckInterval is how often trials are checked for due reminders and ended trials
+const trialCheckInterval = time.Hour
+
+// trialBatchSize bounds the trials processed in one check
+const trialBatchSize = 100
+
+// trialConversionGrace is how long after a trial ends its first payment is awaited from
+// Stripe's webhooks before Stripe is asked how it went
+const trialConversionGrace = 24 * time.Hour
+
+// maxTrialDays bounds the free trials plans may offer
+const maxTrialDays = 90
+
+// TrialMailer sends free trial emails through the notification-service
+type TrialMailer interface {
+	SendTrialEmail(ctx context.Context, userID, email, title, message string, metadata map[string]string) error
+}
+
+// SetTrials emails the users of trialing subscriptions reminderLead before their trial
+// ends, and about the downgrade when their first payment fails. billingURL is the page
+// the emails link to. Without it trials still convert, but nobody is reminded.
+func (s *BillingService) SetTrials(reminderLead time.Duration, billingURL string, directory EmailDirectory, mailer TrialMailer) {
+	s.trialReminderLead = reminderLead
+	s.billingURL = billingURL
+	s.emails = directory
+	s.trialMailer = mailer
+}
+
+// trialDays returns the length of the free trial a new subscription starts with. Trials
+// are for individual plans paid with Stripe, which keeps the card that is charged when
+// the trial ends, and each user gets one.
+func (s *BillingService) trialDays(ctx context.Context, userID primitive.ObjectID, plan *models.Plan, paymentMethod string) (int, error) {
+	if plan.TrialDays <= 0 || plan.PerSeat || paymentMethod != "stripe" {
+		return 0, nil
+	}
+
+	trialed, err := s.subscriptionRepo.HasTrialed(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if trialed {
+		return 0, nil
+	}
+	return plan.TrialDays, nil
+}
+
+// startTrial starts the free trial of a subscription whose checkout saved the user's
+// card. Stripe charges it for the first billing period when the trial ends. Replayed
+// webhooks leave a started trial unchanged.
+func (s *BillingService) startTrial(ctx context.Context, subscription *models.Subscription, data *payment.CheckoutSessionData) error {
+	if subscription.Status != models.SubscriptionStatusPending {
+		return nil
+	}
+
+	now := time.Now()
+	subscription.Status = models.SubscriptionStatusTrialing
+	subscription.StartDate = now
+	subscription.TrialEnd = now.AddDate(0, 0, subscription.TrialDays)
+	subscription.EndDate = subscription.TrialEnd
+	subscription.ProviderSubscriptionID = data.ProviderSubscriptionID
+
+	if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"subscription_id": subscription.ID.Hex(),
+		"user_id":         subscription.UserID.Hex(),
+		"trial_end":       subscription.TrialEnd,
+	}).Info("Subscription trial started via webhook")
+
+	return nil
+}
+
+// handleTrialEvent applies a Stripe event to a trialing subscription. The trial converts
+// to a paid subscription when its first invoice is paid, and ends with a downgrade when
+// that payment fails or the Stripe subscription ends.
+func (s *BillingService) handleTrialEvent(ctx context.Context, eventType string, subscription *models.Subscription, data *payment.SubscriptionEventData) error {
+	switch eventType {
+	case "invoice.paid":
+		// The trial itself is invoiced at nothing
+		if data.AmountPaid == 0 {
+			return nil
+		}
+		return s.applyPaidInvoice(ctx, subscription, BillingEventPaymentSucceeded, data)
+
+	case "invoice.payment_failed", "customer.subscription.deleted":
+		return s.endTrial(ctx, subscription)
+
+	case "customer.subscription.updated":
+		switch data.Status {
+		case "trialing":
+			// The trial may have been extended from the Stripe dashboard
+			if data.TrialEnd.IsZero() || data.TrialEnd.Equal(subscription.TrialEnd) {
+				return nil
+			}
+			subscription.TrialEnd = data.TrialEnd
+			subscription.EndDate = data.TrialEnd
+			subscription.TrialReminded = false
+			if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+				return fmt.Errorf("failed to update subscription: %w", err)
+			}
+		case "past_due", "unpaid", "canceled", "incomplete_expired":
+			return s.endTrial(ctx, subscription)
+		}
+		// An active subscription converts once its first invoice is paid
+	}
+
+	return nil
+}
+
+// applyPaidInvoice starts the billing period a paid invoice of a recurring subscription
+// pays for, and invoices the payment. The user's receipt is a billing event of
+// eventType.
+func (s *BillingService) applyPaidInvoice(ctx context.Context, subscription *models.Subscription, eventType BillingEventType, data *payment.SubscriptionEventData) error {
+	transactionID := data.TransactionID
+	if transactionID == "" {
+		transactionID = data.InvoiceID
+	}
+
+	subscription.Status = models.SubscriptionStatusActive
+	subscription.PaymentStatus = models.PaymentStatusPaid
+	subscription.TransactionID = transactionID
+	subscription.Dunning = nil
+	if !data.CurrentPeriodEnd.IsZero() {
+		subscription.EndDate = data.CurrentPeriodEnd
+	}
+
+	if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"subscription_id": subscription.ID.Hex(),
+		"user_id":         subscription.UserID.Hex(),
+		"transaction_id":  transactionID,
+		"end_date":        subscription.EndDate,
+	}).Info("Subscription invoice paid via Stripe webhook")
+
+	return s.recordPayment(ctx, eventType, Charge{
+		Subscription:  subscription,
+		TransactionID: transactionID,
+		Amount:        data.AmountPaid,
+		Currency:      data.Currency,
+		Quantity:      subscription.Seats,
+		PeriodStart:   data.PeriodStart,
+		Overages:      s.paidAPIOverages(ctx, subscription, data.AmountPaid),
+	})
+}
+
+// endTrial downgrades a trialing subscription whose first payment failed to the Free
+// plan, and cancels its Stripe subscription so that the card isn't charged later
+func (s *BillingService) endTrial(ctx context.Context, subscription *models.Subscription) error {
+	expired, err := s.subscriptionRepo.ExpireTrial(ctx, subscription.ID)
+	if err != nil || !expired {
+		return err
+	}
+
+	if subscription.ProviderSubscriptionID != "" {
+		if err := s.stripeService.CancelRecurringSubscription(subscription.ProviderSubscriptionID); err != nil {
+			logrus.WithError(err).WithField("subscription_id", subscription.ID.Hex()).Warn("Failed to cancel Stripe subscription")
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"subscription_id": subscription.ID.Hex(),
+		"user_id":         subscription.UserID.Hex(),
+	}).Warn("Trial ended without payment, subscription downgraded to Free")
+
+	go s.emailTrialEnded(*subscription)
+	return nil
+}
+
+// RunTrials reminds users of trials about to end and settles trials whose end went
+// unreported by Stripe, until ctx is done
+func (s *BillingService) RunTrials(ctx context.Context) {
+	ticker := time.NewTicker(trialCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.remindTrials(ctx)
+		s.settleTrials(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// remindTrials emails the users of trials ending within the reminder lead time, once
+func (s *BillingService) remindTrials(ctx context.Context) {
+	if s.trialMailer == nil || s.trialReminderLead <= 0 {
+		return
+	}
+
+	subscriptions, err := s.subscriptionRepo.ListTrialsEndingBefore(ctx, time.Now().Add(s.trialReminderLead), true, trialBatchSize)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list ending trials")
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		claimed, err := s.subscriptionRepo.ClaimTrialReminder(ctx, subscription.ID)
+		if err != nil {
+			logrus.WithError(err).WithField("subscription_id", subscription.ID.Hex()).Error("Failed to claim trial reminder")
+			continue
+		}
+		if claimed {
+			go s.emailTrialReminder(subscription)
+		}
+	}
+}
+
+// settleTrials checks with Stripe on trials that ended a while ago without their first
+// payment being reported, converting paid ones and downgrading the others
+func (s *BillingService) settleTrials(ctx context.Context) {
+	subscriptions, err := s.subscriptionRepo.ListTrialsEndingBefore(ctx, time.Now().Add(-trialConversionGrace), false, trialBatchSize)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list ended trials")
+		return
+	}
+
+	for i := range subscriptions {
+		if err := s.settleTrial(ctx, &subscriptions[i]); err != nil {
+			logrus.WithError(err).WithField("subscription_id", subscriptions[i].ID.Hex()).Error("Failed to settle ended trial")
+		}
+	}
+}
+
+// settleTrial applies the state of an ended trial's Stripe subscription
+func (s *BillingService) settleTrial(ctx context.Context, subscription *models.Subscription) error {
+	if subscription.ProviderSubscriptionID == "" {
+		return s.endTrial(ctx, subscription)
+	}
+
+	data, err := s.stripeService.GetRecurringSubscription(subscription.ProviderSubscriptionID)
+	if err != nil {
+		return err
+	}
+
+	switch data.Status {
+	case "active":
+		subscription.Status = models.SubscriptionStatusActive
+		subscription.PaymentStatus = models.PaymentStatusPaid
+		if !data.CurrentPeriodEnd.IsZero() {
+			subscription.EndDate = data.CurrentPeriodEnd
+		}
+		if err := s.subscriptionRepo.Update(ctx, subscription); err != nil {
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+		logrus.WithField("subscription_id", subscription.ID.Hex()).Info("Ended trial converted")
+		return nil
+	case "trialing":
+		return s.handleTrialEvent(ctx, "customer.subscription.updated", subscription, data)
+	default:
+		return s.endTrial(ctx, subscription)
+	}
+}
+
+// emailTrialReminder tells the user when a trial ends and what they'll then be charged
+func (s *BillingService) emailTrialReminder(subscription models.Subscription) {
+	s.emailSubscriber(subscription, s.trialMailer.SendTrialEmail, func(ctx context.Context, plan *models.Plan) (string, string) {
+		interval, currency := subscription.Interval(), subscription.BillingCurrency()
+		price, _ := plan.PriceIn(currency, interval)
+		price = s.tax.chargedPrice(subscription.Billing, price)
+		return fmt.Sprintf("Your %s trial ends on %s", plan.Name, subscription.TrialEnd.Format("Jan 2, 2006")),
+			fmt.Sprintf("Your free trial of the %s plan ends on %s. Your card will then be charged %s for the first %s, unless you cancel from your billing page before then.",
+				plan.Name, subscription.TrialEnd.Format("Jan 2, 2006"), models.FormatMoney(models.MinorUnits(price), currency), interval)
+	})
+}
+
+// emailTrialEnded tells the user that a trial ended because its first payment failed
+func (s *BillingService) emailTrialEnded(subscription models.Subscription) {
+	if s.trialMailer == nil {
+		return
+	}
+	s.emailSubscriber(subscription, s.trialMailer.SendTrialEmail, func(ctx context.Context, plan *models.Plan) (string, string) {
+		return fmt.Sprintf("Your %s trial has ended", plan.Name),
+			fmt.Sprintf("We couldn't collect the first payment for your %s plan when its free trial ended, so you're now on the Free plan with %s. Your files are kept, but uploads are paused while you use more than that. Subscribe from your billing page to restore your storage.",
+				plan.Name, s.freeQuotaText(ctx))
+	})
+}
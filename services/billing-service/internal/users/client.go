@@ -0,0 +1,147 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	authv1 "github.com/yourusername/distributed-file-sharing-platform/services/billing-service/pkg/pb/auth/v1"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// callTimeout bounds how long a single auth-service call may take
+const callTimeout = 5 * time.Second
+
+// Client looks up billed users and their organizations in the auth-service
+type Client struct {
+	conn   *grpc.ClientConn
+	client authv1.AuthServiceClient
+}
+
+// NewClient dials the auth-service gRPC endpoint
+func NewClient(addr string, opts ...grpc.DialOption) (*Client, error) {
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
+	}
+	poolmetrics.WatchClientConn("auth-service", conn)
+
+	return &Client{
+		conn:   conn,
+		client: authv1.NewAuthServiceClient(conn),
+	}, nil
+}
+
+// GetEmail returns the email address of a user
+func (c *Client) GetEmail(ctx context.Context, userID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	resp, err := c.client.GetUser(ctx, &authv1.GetUserRequest{UserId: userID})
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	if resp.User == nil || resp.User.Email == "" {
+		return "", fmt.Errorf("user %s has no email address", userID)
+	}
+
+	return resp.User.Email, nil
+}
+
+// GetVerifiedEmail returns the email address of a user and whether it is verified
+func (c *Client) GetVerifiedEmail(ctx context.Context, userID string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	resp, err := c.client.GetUser(ctx, &authv1.GetUserRequest{UserId: userID})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get user: %w", err)
+	}
+	if resp.User == nil {
+		return "", false, fmt.Errorf("user %s not found", userID)
+	}
+
+	return resp.User.Email, resp.User.EmailVerified, nil
+}
+
+// OrganizationRole returns a user's role in an organization, "owner", "admin" or
+// "member", or "" if the user is not a member
+func (c *Client) OrganizationRole(ctx context.Context, userID, orgID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	resp, err := c.client.GetOrganization(ctx, &authv1.GetOrganizationRequest{UserId: userID, OrgId: orgID})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return roleName(resp.Organization.GetRole()), nil
+}
+
+// ListOrganizationIDs returns the IDs of the organizations a user belongs to
+func (c *Client) ListOrganizationIDs(ctx context.Context, userID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	resp, err := c.client.ListOrganizations(ctx, &authv1.ListOrganizationsRequest{UserId: userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	orgIDs := make([]string, 0, len(resp.Organizations))
+	for _, org := range resp.Organizations {
+		orgIDs = append(orgIDs, org.OrgId)
+	}
+	return orgIDs, nil
+}
+
+// ListMemberIDs returns the user IDs of an organization's members, as seen by the member
+// asUserID
+func (c *Client) ListMemberIDs(ctx context.Context, orgID, asUserID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	resp, err := c.client.ListOrganizationMembers(ctx, &authv1.ListOrganizationMembersRequest{UserId: asUserID, OrgId: orgID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+
+	memberIDs := make([]string, 0, len(resp.Members))
+	for _, member := range resp.Members {
+		memberIDs = append(memberIDs, member.UserId)
+	}
+	return memberIDs, nil
+}
+
+func roleName(role authv1.OrgRole) string {
+	switch role {
+	case authv1.OrgRole_ORG_ROLE_OWNER:
+		return "owner"
+	case authv1.OrgRole_ORG_ROLE_ADMIN:
+		return "admin"
+	case authv1.OrgRole_ORG_ROLE_MEMBER:
+		return "member"
+	default:
+		return ""
+	}
+}
+
+// HealthCheck checks that the auth-service can be reached
+func (c *Client) HealthCheck(ctx context.Context) error {
+	return health.GRPC(c.conn)(ctx)
+}
+
+// Close closes the underlying connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
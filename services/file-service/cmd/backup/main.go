@@ -0,0 +1,221 @@
+// Command backup snapshots the platform's MongoDB metadata and MinIO objects into a backup
+// bucket, and restores them. It reads the file service's environment.
+//
+//	backup create                       take a snapshot
+//	backup list                         list the complete snapshots
+//	backup restore [-id ID | -at TIME]  restore a snapshot, by default the latest
+//	backup verify [-id ID | -at TIME]   restore a snapshot into a scratch database and check it
+//	backup prune [-keep N]              remove all but the latest snapshots
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/logging"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/secrets"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/backup"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/database"
+)
+
+const usage = `Usage: backup <command> [flags]
+
+Commands:
+  create    take a snapshot of the metadata and the objects
+  list      list the complete snapshots
+  restore   restore a snapshot over the live data
+  verify    restore a snapshot into a scratch database and check it
+  prune     remove all but the latest snapshots
+
+Run backup <command> -h for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := env.Load(); err != nil {
+		fatal("Failed to load environment file: %v", err)
+	}
+	if _, err := secrets.Load(context.Background()); err != nil {
+		fatal("Failed to load secrets: %v", err)
+	}
+	log := logging.New("file-backup", env.String("LOG_LEVEL", "info"))
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "create", "list", "restore", "verify", "prune":
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	id := flags.String("id", "", "snapshot ID")
+	at := flags.String("at", "", "restore the latest snapshot taken at or before this RFC 3339 time")
+	keep := flags.Int("keep", env.Int("BACKUP_KEEP", 14), "number of snapshots prune keeps")
+	collections := flags.String("collections", "", "comma-separated collections to restore (default all)")
+	skipObjects := flags.Bool("skip-objects", false, "restore the metadata only")
+	dryRun := flags.Bool("dry-run", false, "report what restore would write without writing")
+	yes := flags.Bool("yes", false, "confirm the restore, which replaces the live data")
+	timeout := flags.Duration("timeout", env.Duration("BACKUP_TIMEOUT", 2*time.Hour), "time limit of the command")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	manager, closeManager, err := newManager(log)
+	if err != nil {
+		fatal("%v", err)
+	}
+	defer closeManager()
+
+	switch command {
+	case "create":
+		manifest, err := manager.Create(ctx)
+		if err != nil {
+			fatal("Failed to create snapshot: %v", err)
+		}
+		log.WithFields(logrus.Fields{
+			"snapshot":       manifest.ID,
+			"objects":        manifest.Objects,
+			"copied_objects": manifest.CopiedObjects,
+		}).Info("Snapshot created")
+		printJSON(manifest)
+
+	case "list":
+		manifests, err := manager.List(ctx)
+		if err != nil {
+			fatal("Failed to list snapshots: %v", err)
+		}
+		for _, manifest := range manifests {
+			var documents int64
+			for _, count := range manifest.Collections {
+				documents += count
+			}
+			fmt.Printf("%s  %s  %d documents  %d objects  %d bytes\n",
+				manifest.ID, manifest.CreatedAt.Format(time.RFC3339), documents, manifest.Objects, manifest.ObjectBytes)
+		}
+
+	case "restore", "verify":
+		manifest, err := findSnapshot(ctx, manager, *id, *at)
+		if err != nil {
+			fatal("%v", err)
+		}
+		if command == "verify" {
+			if err := manager.Verify(ctx, manifest); err != nil {
+				fatal("Snapshot %s failed verification: %v", manifest.ID, err)
+			}
+			log.WithField("snapshot", manifest.ID).Info("Snapshot verified")
+			return
+		}
+
+		if !*dryRun && !*yes {
+			fatal("Restoring snapshot %s replaces the live data; run with -yes to confirm, or -dry-run", manifest.ID)
+		}
+		opts := backup.RestoreOptions{SkipObjects: *skipObjects, DryRun: *dryRun}
+		if *collections != "" {
+			for _, name := range strings.Split(*collections, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					opts.Collections = append(opts.Collections, name)
+				}
+			}
+		}
+		result, err := manager.Restore(ctx, manifest, opts)
+		if err != nil {
+			fatal("Failed to restore snapshot %s: %v", manifest.ID, err)
+		}
+		printJSON(result)
+
+	case "prune":
+		removed, err := manager.Prune(ctx, *keep)
+		if err != nil {
+			fatal("Failed to prune snapshots: %v", err)
+		}
+		log.WithFields(logrus.Fields{"removed": len(removed), "kept": *keep}).Info("Snapshots pruned")
+	}
+}
+
+// newManager connects to MongoDB and MinIO and returns a backup manager, and a function
+// closing the connections
+func newManager(log *logrus.Logger) (*backup.Manager, func(), error) {
+	mongoURI := env.String("MONGO_URI", "")
+	if mongoURI == "" {
+		return nil, nil, fmt.Errorf("MONGO_URI is required")
+	}
+	mongodb, err := database.NewMongoDB(mongoURI, env.String("MONGO_DATABASE", "file_sharing"), 30*time.Second)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	storage, err := minio.New(env.String("MINIO_ENDPOINT", "minio:9000"), &minio.Options{
+		Creds:  credentials.NewStaticV4(env.String("MINIO_ACCESS_KEY", ""), env.String("MINIO_SECRET_KEY", ""), ""),
+		Secure: env.Bool("MINIO_USE_SSL", false),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		mongodb.Close(context.Background())
+		return nil, nil, fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+
+	manager := backup.NewManager(
+		mongodb.Database,
+		storage,
+		env.String("MINIO_BUCKET", "file-sharing"),
+		env.String("BACKUP_BUCKET", "file-sharing-backups"),
+		env.List("BACKUP_COLLECTIONS", backup.DefaultCollections),
+		log,
+	)
+	return manager, func() {
+		if err := mongodb.Close(context.Background()); err != nil {
+			log.Errorf("Error closing MongoDB: %v", err)
+		}
+	}, nil
+}
+
+// findSnapshot selects a snapshot by ID, or the latest taken at or before at, or the
+// latest
+func findSnapshot(ctx context.Context, manager *backup.Manager, id, at string) (*backup.Manifest, error) {
+	if id != "" && at != "" {
+		return nil, fmt.Errorf("-id and -at are exclusive")
+	}
+	var atTime time.Time
+	if at != "" {
+		var err error
+		if atTime, err = time.Parse(time.RFC3339, at); err != nil {
+			return nil, fmt.Errorf("-at must be an RFC 3339 time: %w", err)
+		}
+	}
+	manifest, err := manager.Find(ctx, id, atTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find snapshot: %w", err)
+	}
+	return manifest, nil
+}
+
+func printJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// fatal reports an error and exits; deferred calls don't run, but the process holds
+// nothing that must be released
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -11,37 +11,81 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/cli"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/faults"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/featureflags"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/grpcmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/logging"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/migrate"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/secrets"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/serviceauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/cache"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/cassandra"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/config"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/database"
 	grpchandler "github.com/yourusername/distributed-file-sharing/services/file-service/internal/grpc"
-	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/jwt"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/kafka"
-	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/logger"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/migrations"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/rest"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/service"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/storage"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/users"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/file-service/pkg/pb/auth/v1"
 	filev1 "github.com/yourusername/distributed-file-sharing/services/file-service/pkg/pb/file/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
 )
 
 func main() {
+	cli.Execute(cli.Service{
+		Name:    "file-service",
+		Run:     run,
+		Workers: true,
+		HealthURL: func() string {
+			return "http://localhost:" + env.String("FILE_SERVICE_PORT", "8082") + "/health"
+		},
+	})
+}
+
+// run runs the parts of the file service the process was started for: the gRPC and REST
+// APIs, and the workers running the outbox relay, deletion saga, reconciliation and
+// stale upload cleanups
+func run(process cli.Process) {
 	// Load configuration
+	if err := env.Load(); err != nil {
+		panic(fmt.Sprintf("Failed to load environment file: %v", err))
+	}
+	if _, err := secrets.Load(context.Background()); err != nil {
+		panic(fmt.Sprintf("Failed to load secrets: %v", err))
+	}
 	cfg, err := config.Load()
 	if err != nil {
 		panic(fmt.Sprintf("Failed to load config: %v", err))
 	}
 
 	// Initialize logger
-	log := logger.NewLogger(cfg.LogLevel)
+	log := logging.New("file-service", cfg.LogLevel)
+
+	// Inject faults for resilience testing when enabled
+	faultInjector := faults.FromEnv()
+	if faultInjector != nil {
+		log.Warnf("Fault injection enabled: %s", faultInjector)
+	}
 
-	// Connect to MongoDB
-	mongodb, err := database.NewMongoDB(cfg.MongoURI, cfg.MongoDatabase, cfg.OperationTimeout)
+	// Connect to MongoDB, exposing the driver's connection pool in the metrics
+	mongodb, err := database.NewMongoDB(cfg.MongoURI, cfg.MongoDatabase, cfg.OperationTimeout, faultInjector.MongoOptions(), poolmetrics.MongoOptions("file-service"))
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
@@ -52,38 +96,73 @@ func main() {
 	}()
 	log.Info("MongoDB connected successfully")
 
+	// Apply the pending MongoDB migrations, or manage them with the migrate subcommand
+	migrator := migrate.New(mongodb.Database, "file-service", migrations.All(), log)
+	if process.Migrating {
+		migrateCtx, migrateCancel := context.WithTimeout(context.Background(), migrate.DefaultTimeout)
+		defer migrateCancel()
+		if err := migrator.Command(migrateCtx, process.MigrateArgs, os.Stdout); err != nil {
+			log.Errorf("Migration failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if cfg.MigrateOnStartup {
+		migrateCtx, migrateCancel := context.WithTimeout(context.Background(), migrate.DefaultTimeout)
+		applied, err := migrator.Run(migrateCtx)
+		migrateCancel()
+		if err != nil {
+			log.Fatalf("Failed to apply MongoDB migrations: %v", err)
+		}
+		log.Infof("Applied %d MongoDB migrations", applied)
+	}
+
 	// Initialize repositories
 	fileRepo := repository.NewFileRepository(mongodb.Database)
 	storageRepo := repository.NewStorageRepository(mongodb.Database)
+	outboxRepo := repository.NewOutboxRepository(mongodb.Database)
+	deletionRepo := repository.NewDeletionSagaRepository(mongodb.Database)
+	downloadGrantRepo := repository.NewDownloadGrantRepository(mongodb.Database)
 
-	// Ensure MongoDB indexes
-	log.Info("Creating MongoDB indexes...")
-	if err := fileRepo.EnsureIndexes(context.Background()); err != nil {
-		log.Fatalf("Failed to create MongoDB indexes: %v", err)
+	// File changes and their events are written atomically when MongoDB supports transactions
+	transactions, err := outboxRepo.DetectTransactions(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to check MongoDB transaction support: %v", err)
+	}
+	if !transactions {
+		log.Warn("MongoDB is not a replica set; file changes and their events are not written atomically")
 	}
-	log.Info("MongoDB indexes created successfully")
 
-	// Initialize Redis cache
+	// Initialize Redis cache; files are served from MongoDB while Redis is unavailable
 	var redisCache *cache.RedisCache
 	if cfg.RedisEnabled {
 		redisCache, err = cache.NewRedisCache(
-			cfg.RedisAddr,
-			cfg.RedisPassword,
-			cfg.RedisDB,
+			cache.RedisOptions{
+				Mode:             cfg.RedisMode,
+				Addrs:            cfg.RedisAddrs,
+				MasterName:       cfg.RedisMasterName,
+				SentinelPassword: cfg.RedisSentinelPassword,
+				Password:         cfg.RedisPassword,
+				DB:               cfg.RedisDB,
+				MaxRetries:       cfg.RedisMaxRetries,
+				PoolSize:         cfg.RedisPoolSize,
+				MinIdleConns:     cfg.RedisMinIdleConns,
+			},
 			cfg.RedisCacheTTL,
-			cfg.RedisMaxRetries,
-			cfg.RedisPoolSize,
-			cfg.RedisMinIdleConns,
 			log,
 			true,
 		)
 		if err != nil {
-			log.Fatalf("Failed to connect to Redis: %v", err)
+			log.Fatalf("Failed to create Redis cache: %v", err)
 		}
-		log.Info("Redis connected successfully")
 	} else {
 		log.Warn("Redis caching is disabled")
-		redisCache, _ = cache.NewRedisCache("", "", 0, 0, 0, 0, 0, log, false)
+		redisCache, _ = cache.NewRedisCache(cache.RedisOptions{}, 0, log, false)
+	}
+
+	// Clients are told of changes of their storage usage over the notification WebSocket
+	if redisCache.IsEnabled() {
+		storageRepo.SetUsagePublisher(redisCache)
 	}
 
 	// Initialize Cassandra
@@ -120,8 +199,21 @@ func main() {
 
 	producer := kafka.NewProducer(cfg.KafkaBrokers, "file-events", cfg.UploadRetries, log)
 	defer producer.Close()
+	producer.SetFaults(faultInjector)
 	log.Info("Kafka producer initialized successfully")
 
+	// Publish the events recorded in the outbox
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	if process.Worker {
+		go func() {
+			defer close(relayDone)
+			kafka.NewOutboxRelay(outboxRepo, producer, cfg.OutboxPollInterval, cfg.OutboxBatchSize, log).Run(relayCtx)
+		}()
+	} else {
+		close(relayDone)
+	}
+
 	// Kafka consumer is disabled for now
 	log.Info("Kafka consumer is disabled for this simplified version")
 
@@ -131,7 +223,7 @@ func main() {
 
 	// Try to connect to MinIO with retries
 	for i := 0; i < 3; i++ {
-		minioStorage, minioErr = storage.NewMinioStorage(cfg.MinioEndpoint, cfg.MinioExternalEndpoint, cfg.MinioAccessKey, cfg.MinioSecretKey, cfg.MinioBucket, cfg.MinioUseSSL)
+		minioStorage, minioErr = storage.NewMinioStorage(cfg.MinioEndpoint, cfg.MinioExternalEndpoint, cfg.MinioAccessKey, cfg.MinioSecretKey, cfg.MinioBucket, cfg.MinioUseSSL, faultInjector.Transport(nil))
 		if minioErr == nil {
 			log.Info("MinIO storage initialized successfully")
 			break
@@ -150,89 +242,227 @@ func main() {
 		minioStorage = nil
 	}
 
+	// Delete files through a saga, resuming failed and interrupted deletions in the background
+	var objectStore service.ObjectStore
+	if minioStorage != nil {
+		objectStore = minioStorage
+	}
+	deletionService := service.NewDeletionSagaService(deletionRepo, fileRepo, storageRepo, outboxRepo, objectStore, cfg.DeletionMaxAttempts, log)
+	deletionCtx, stopDeletions := context.WithCancel(context.Background())
+	deletionDone := make(chan struct{})
+	if process.Worker {
+		go func() {
+			defer close(deletionDone)
+			deletionService.Run(deletionCtx, cfg.DeletionPollInterval)
+		}()
+	} else {
+		close(deletionDone)
+	}
+
+	// Reconcile storage usage and object storage with the file records
+	reconciler := service.NewReconciler(fileRepo, storageRepo, deletionRepo, objectStore, cfg.ReconcileRepair, cfg.ReconcileOrphanGrace, log)
+	if process.Worker {
+		if cfg.ReconcileDaily {
+			go reconciler.RunDaily(deletionCtx, cfg.ReconcileAt)
+		} else if cfg.ReconcileInterval > 0 {
+			go reconciler.Run(deletionCtx, cfg.ReconcileInterval)
+		} else {
+			log.Warn("Periodic reconciliation is disabled")
+		}
+	}
+
+	// Claim the shares made to the email addresses of new accounts, from the auth-service's
+	// user events
+	claimsCtx, stopClaims := context.WithCancel(context.Background())
+	claimsDone := make(chan struct{})
+	if process.Worker {
+		shareClaims := service.NewShareClaimService(fileRepo, outboxRepo, log)
+		userEvents := kafka.NewUserEventsConsumer(cfg.KafkaBrokers, cfg.ShareClaimsGroup, shareClaims, log)
+		go func() {
+			defer close(claimsDone)
+			userEvents.Run(claimsCtx)
+		}()
+	} else {
+		close(claimsDone)
+	}
+
 	// Initialize private folder repository
 	privateFolderRepo := repository.NewPrivateFolderRepository(mongodb.Database)
 
 	// Initialize private folder service
 	privateFolderService := service.NewPrivateFolderService(privateFolderRepo, fileRepo, storageRepo)
+	privateFolderService.SetEventOutbox(outboxRepo)
+
+	// Resolve email share recipients to accounts via the auth-service
+	var userClientOpts []grpc.DialOption
+	if cfg.ServiceAuthEnabled {
+		tokenSource, err := newServiceTokenSource(cfg)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to initialize service token source")
+		}
+		userClientOpts = append(userClientOpts, grpc.WithPerRPCCredentials(tokenSource.Credentials("auth-service")))
+	}
+	userClient, err := users.NewClient(cfg.AuthServiceGRPC, userClientOpts...)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create user client")
+	}
+	defer userClient.Close()
 
 	// Initialize gRPC handlers
-	fileHandler := grpchandler.NewFileHandler(fileRepo, storageRepo, minioStorage, producer, cfg, log, redisCache, nil)
+	fileHandler := grpchandler.NewFileHandler(fileRepo, storageRepo, minioStorage, outboxRepo, downloadGrantRepo, deletionService, cfg, log, redisCache, nil, userClient)
+	if process.Worker {
+		if err := fileHandler.ResumeStaleUploadCleanups(context.Background()); err != nil {
+			log.WithError(err).Warn("Failed to resume stale upload cleanups")
+		}
+	}
 
 	// Start gRPC server
-	grpcServer := grpc.NewServer()
+	grpcOpts := grpcmw.Options{
+		Service:        cfg.ServiceName,
+		Logger:         log,
+		DefaultTimeout: cfg.GRPCDefaultTimeout,
+		Faults:         faultInjector,
+	}
+	if cfg.ServiceAuthEnabled {
+		grpcOpts.Auth = serviceauth.NewInterceptor(serviceauth.NewValidator(cfg.ServiceTokenSecret, cfg.ServiceName))
+		log.Info("Service-to-service authentication enabled")
+	}
+
+	grpcServer := grpc.NewServer(grpcmw.ServerOptions(grpcOpts)...)
 	filev1.RegisterFileServiceServer(grpcServer, fileHandler)
 
 	// Enable reflection for debugging
 	reflection.Register(grpcServer)
 
 	// Start gRPC server in goroutine
-	go func() {
-		lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
-		if err != nil {
-			log.Fatalf("Failed to listen on gRPC port %s: %v", cfg.GRPCPort, err)
-		}
-		log.Infof("gRPC server starting on port %s", cfg.GRPCPort)
-		if err := grpcServer.Serve(lis); err != nil {
-			log.Fatalf("Failed to serve gRPC: %v", err)
-		}
-	}()
+	if process.GRPC {
+		go func() {
+			lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+			if err != nil {
+				log.Fatalf("Failed to listen on gRPC port %s: %v", cfg.GRPCPort, err)
+			}
+			log.Infof("gRPC server starting on port %s", cfg.GRPCPort)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatalf("Failed to serve gRPC: %v", err)
+			}
+		}()
+	}
 
-	// Start gRPC Gateway (REST API) in goroutine
-	httpServer := &http.Server{}
-	go func() {
-		if err := startGRPCGateway(cfg, log, redisCache, httpServer, fileHandler, storageRepo, cassandraRepo, fileRepo, minioStorage, privateFolderService); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start gRPC Gateway: %v", err)
+	// Start gRPC Gateway (REST API) in goroutine, or only serve the health probes and metrics
+	var httpServer *http.Server
+	healthHandler := health.New("file-service", "1.0.0").AddCheck("mongodb", func(ctx context.Context) error {
+		return mongodb.Client.Ping(ctx, nil)
+	}).AddCheck("minio", func(ctx context.Context) error {
+		if minioStorage == nil {
+			return health.ErrNotConfigured
 		}
-	}()
+		return minioStorage.HealthCheck(ctx)
+	}).AddOptionalCheck("kafka", health.TCP(cfg.KafkaBrokers...)).
+		AddOptionalCheck("auth-service", userClient.HealthCheck)
+	if redisCache != nil {
+		healthHandler.AddOptionalCheck("redis", redisCache.HealthCheck)
+	}
+	if cassandraRepo != nil {
+		healthHandler.AddOptionalCheck("cassandra", cassandraRepo.HealthCheck)
+	}
+	if process.HTTP {
+		httpServer = &http.Server{}
+		go func() {
+			if err := startGRPCGateway(cfg, log, redisCache, httpServer, healthHandler, fileHandler, storageRepo, cassandraRepo, fileRepo, minioStorage, privateFolderService, reconciler, featureflags.NewMongoStore(mongodb.Database), faultInjector, userClient, downloadGrantRepo); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start gRPC Gateway: %v", err)
+			}
+		}()
+	} else {
+		httpServer = cli.ProbeServer(cfg.ServicePort, healthHandler, log)
+	}
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	// Fail the readiness probe and keep serving until load balancers stop sending requests
+	log.Info("Draining File Service...")
+	healthHandler.SetDraining()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
 	log.Info("Shutting down File Service...")
 
 	// Graceful shutdown with timeout
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
-	// Shutdown gRPC server
-	log.Info("Shutting down gRPC server...")
-	grpcServer.GracefulStop()
-
-	// Shutdown HTTP server
+	// Shutdown HTTP server, finishing the requests in progress
 	log.Info("Shutting down HTTP server...")
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		log.Errorf("Error shutting down HTTP server: %v", err)
 	}
 
+	// Shutdown gRPC server, waiting for the uploads in progress
+	log.Info("Shutting down gRPC server...")
+	if !grpcmw.GracefulStop(shutdownCtx, grpcServer) {
+		log.Warn("gRPC calls cancelled at shutdown timeout")
+	}
+
+	// Stop the stale upload cleanups, which are resumed after a restart, and finish the
+	// access log writes
+	if err := fileHandler.Drain(shutdownCtx); err != nil {
+		log.WithError(err).Warn("Stale upload cleanups did not finish")
+	}
+	if err := privateFolderService.Drain(shutdownCtx); err != nil {
+		log.WithError(err).Warn("Access log writes did not finish")
+	}
+
+	// Stop resuming deletions; those in progress are resumed after a restart
+	stopDeletions()
+	<-deletionDone
+
+	// Stop claiming shares; the user events left are consumed after a restart
+	stopClaims()
+	<-claimsDone
+
+	// Stop the outbox relay before the producer closes; unpublished events stay in the outbox
+	stopRelay()
+	<-relayDone
+
+	// Flush the producer
+	if err := producer.Close(); err != nil {
+		log.WithError(err).Error("Error closing Kafka producer")
+	}
+
+	if err := redisCache.Close(); err != nil {
+		log.WithError(err).Error("Error closing Redis connection")
+	}
+
 	log.Info("File Service stopped successfully")
 }
 
-func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.RedisCache, httpServer *http.Server, fileHandler interface{}, storageRepo *repository.StorageRepository, cassandraRepo *cassandra.Repository, fileRepo *repository.FileRepository, minioStorage interface{}, privateFolderService *service.PrivateFolderService) error {
+func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.RedisCache, httpServer *http.Server, healthHandler *health.Handler, fileHandler interface{}, storageRepo *repository.StorageRepository, cassandraRepo *cassandra.Repository, fileRepo *repository.FileRepository, minioStorage interface{}, privateFolderService *service.PrivateFolderService, reconciler *service.Reconciler, flagStore featureflags.Store, faultInjector *faults.Injector, owners rest.OwnerDirectory, downloadGrants *repository.DownloadGrantRepository) error {
 	// Create Gin router for REST API
 	router := gin.Default()
 
 	// CORS middleware
-	router.Use(corsMiddleware())
+	router.Use(ginmw.CORS(ginmw.DefaultCORSConfig()))
+
+	// Request ID, returned in the error responses
+	router.Use(ginmw.RequestID())
 
 	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"service": "file-service",
-			"version": "1.0.0",
-			"time":    time.Now().Format(time.RFC3339),
-		})
-	})
+	healthHandler.Register(router)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Delay the API requests at the injected latency rate, and serve them for the tenant
+	// and within the deadline the gateway decided
+	router.Use(faultInjector.Gin())
+	router.Use(tenant.Gin())
+	router.Use(ginmw.Deadline(nil))
 
 	// Storage usage endpoint
 	router.GET("/api/v1/files/storage/usage", func(c *gin.Context) {
 		// Get user ID from JWT token
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			apierror.Abort(c, http.StatusUnauthorized, "Authorization header required")
 			return
 		}
 
@@ -241,18 +471,18 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 			token = token[7:]
 		}
 
-		jwtValidator := jwt.NewJWTValidator(cfg.JWTSecret)
+		jwtValidator := jwtauth.NewValidator(cfg.JWTSecret)
 		userID, err := jwtValidator.ExtractUserID(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid token")
 			return
 		}
 
-		// Get storage stats by calculating from actual files
-		stats, err := storageRepo.CalculateUsageFromFiles(c.Request.Context(), userID, fileRepo)
+		// Get storage stats, kept up to date as files are uploaded and deleted
+		stats, err := storageRepo.GetUsage(c.Request.Context(), userID, fileRepo)
 		if err != nil {
 			log.WithError(err).Error("Failed to calculate storage stats")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get storage usage"})
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to get storage usage")
 			return
 		}
 
@@ -275,18 +505,14 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 	router.GET("/api/v1/test-private", func(c *gin.Context) {
 		// Test if private folder service is initialized
 		if privateFolderService == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Private folder service is nil",
-			})
+			apierror.Abort(c, http.StatusInternalServerError, "Private folder service is nil")
 			return
 		}
 
 		// Test basic functionality
 		err := privateFolderService.SetPIN(c.Request.Context(), "test-user", "1234")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			apierror.Abort(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 
@@ -309,10 +535,8 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 
 		if err := c.ShouldBindJSON(&req); err != nil {
 			log.WithError(err).Error("JSON binding error")
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":    "JSON binding error: " + err.Error(),
-				"raw_body": string(body),
-			})
+			apierror.AbortWith(c, http.StatusBadRequest, apierror.New(apierror.CodeInvalidArgument, "JSON binding error: "+err.Error()).
+				WithDetails(gin.H{"raw_body": string(body)}))
 			return
 		}
 
@@ -332,9 +556,7 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 		resp, err := privateFolderService.ValidatePIN(c.Request.Context(), pinReq)
 		if err != nil {
 			log.WithError(err).Error("Service error")
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Service error: " + err.Error(),
-			})
+			apierror.Abort(c, http.StatusInternalServerError, "Service error: "+err.Error())
 			return
 		}
 
@@ -351,12 +573,56 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 	privateFolderHandlers := rest.NewPrivateFolderHandlers(privateFolderService, log)
 	privateFolderHandlers.RegisterRoutes(apiV1)
 
+	// Reconciliation reports, for operators
+	if cfg.ReconcileAPIToken != "" {
+		rest.NewReconciliationHandlers(reconciler, cfg.ReconcileAPIToken).RegisterRoutes(apiV1)
+	} else {
+		log.Info("RECONCILE_API_TOKEN is not set, the reconciliation API is disabled")
+	}
+
+	// Feature flags shared by the services, for operators
+	if cfg.FeatureFlagsAPIToken != "" {
+		admin := apiV1.Group("/admin", ginmw.BearerToken(cfg.FeatureFlagsAPIToken))
+		featureflags.NewHandler(flagStore).RegisterRoutes(admin)
+	} else {
+		log.Info("FEATURE_FLAGS_API_TOKEN is not set, the feature flags API is disabled")
+	}
+
+	// Storage and sharing statistics of the admin analytics, for operators
+	if cfg.AnalyticsAPIToken != "" {
+		rest.NewAnalyticsHandlers(fileRepo, cfg.AnalyticsAPIToken, log).RegisterRoutes(apiV1)
+	} else {
+		log.Info("ANALYTICS_API_TOKEN is not set, the analytics API is disabled")
+	}
+
+	// Upload content received through the service rather than the presigned URL, with
+	// its progress published to the uploader
+	var uploader rest.ObjectUploader
+	if s, ok := minioStorage.(*storage.MinioStorage); ok && s != nil {
+		uploader = s
+	}
+	rest.NewUploadHandlers(fileRepo, uploader, redisCache, cfg.JWTSecret, log).RegisterRoutes(apiV1)
+
+	// Landing page of link shares, served to visitors without an account
+	var objectReader rest.ObjectReader
+	if s, ok := minioStorage.(*storage.MinioStorage); ok && s != nil {
+		objectReader = s
+	}
+	rest.NewPublicShareHandlers(fileRepo, objectReader, owners, redisCache, cfg.JWTSecret, cfg.PresignedURLExpiry, log).RegisterRoutes(apiV1)
+
+	// Single-use download links, redeemed once for a presigned URL
+	var presigner rest.URLPresigner
+	if s, ok := minioStorage.(*storage.MinioStorage); ok && s != nil {
+		presigner = s
+	}
+	rest.NewDownloadGrantHandlers(downloadGrants, fileRepo, presigner, log).RegisterRoutes(apiV1)
+
 	// File download endpoint - streams file content directly
 	router.GET("/api/v1/files/:id/download", func(c *gin.Context) {
 		fileID := c.Param("id")
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			apierror.Abort(c, http.StatusUnauthorized, "Authorization header required")
 			return
 		}
 
@@ -365,17 +631,17 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 			token = token[7:]
 		}
 
-		jwtValidator := jwt.NewJWTValidator(cfg.JWTSecret)
+		jwtValidator := jwtauth.NewValidator(cfg.JWTSecret)
 		userID, err := jwtValidator.ExtractUserID(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid token")
 			return
 		}
 
 		// Get file metadata
 		file, err := fileRepo.FindByID(c.Request.Context(), fileID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			apierror.Abort(c, http.StatusNotFound, "File not found")
 			return
 		}
 
@@ -383,32 +649,32 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 		hasPermission, err := fileRepo.CheckDownloadPermission(c.Request.Context(), fileID, userID)
 		if err != nil {
 			log.WithError(err).Error("Failed to check download permission")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to check permissions")
 			return
 		}
 
 		if !hasPermission {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to download this file"})
+			apierror.Abort(c, http.StatusForbidden, "You don't have permission to download this file")
 			return
 		}
 
 		// Check if MinIO storage is available
 		if minioStorage == nil {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Storage service is temporarily unavailable"})
+			apierror.Abort(c, http.StatusServiceUnavailable, "Storage service is temporarily unavailable")
 			return
 		}
 
 		// Get file from MinIO
 		minioStorageTyped, ok := minioStorage.(*storage.MinioStorage)
 		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Storage service error"})
+			apierror.Abort(c, http.StatusInternalServerError, "Storage service error")
 			return
 		}
 
 		object, err := minioStorageTyped.GetObject(c.Request.Context(), file.StoragePath)
 		if err != nil {
 			log.WithError(err).Error("Failed to get object from MinIO")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve file"})
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to retrieve file")
 			return
 		}
 		defer object.Close()
@@ -417,7 +683,7 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 		stat, err := object.Stat()
 		if err != nil {
 			log.WithError(err).WithField("storage_path", file.StoragePath).Error("Failed to stat object in MinIO - File might be missing")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "File content not found in storage"})
+			apierror.Abort(c, http.StatusInternalServerError, "File content not found in storage")
 			return
 		}
 
@@ -451,7 +717,7 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 		fileID := c.Param("id")
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			apierror.Abort(c, http.StatusUnauthorized, "Authorization header required")
 			return
 		}
 
@@ -460,10 +726,10 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 			token = token[7:]
 		}
 
-		jwtValidator := jwt.NewJWTValidator(cfg.JWTSecret)
+		jwtValidator := jwtauth.NewValidator(cfg.JWTSecret)
 		userID, err := jwtValidator.ExtractUserID(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid token")
 			return
 		}
 
@@ -472,25 +738,25 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 			SharedWith []string `json:"shared_with"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
 			return
 		}
 
 		file, err := fileRepo.FindByID(c.Request.Context(), fileID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			apierror.Abort(c, http.StatusNotFound, "File not found")
 			return
 		}
 
 		if file.OwnerID != userID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Only the file owner can change privacy settings"})
+			apierror.Abort(c, http.StatusForbidden, "Only the file owner can change privacy settings")
 			return
 		}
 
 		err = fileRepo.UpdateFilePrivacy(c.Request.Context(), fileID, userID, req.IsPrivate, req.SharedWith)
 		if err != nil {
 			log.WithError(err).Error("Failed to update file privacy")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to update privacy settings")
 			return
 		}
 
@@ -506,7 +772,7 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 		fileID := c.Param("id")
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			apierror.Abort(c, http.StatusUnauthorized, "Authorization header required")
 			return
 		}
 
@@ -515,10 +781,16 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 			token = token[7:]
 		}
 
-		jwtValidator := jwt.NewJWTValidator(cfg.JWTSecret)
-		userID, err := jwtValidator.ExtractUserID(token)
+		jwtValidator := jwtauth.NewValidator(cfg.JWTSecret)
+		claims, err := jwtValidator.ValidateToken(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		userID := claims.UserID
+
+		if !claims.IsEmailVerified() {
+			apierror.Abort(c, http.StatusForbidden, "Verify your email address to share files")
 			return
 		}
 
@@ -527,30 +799,30 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 			Action  string   `json:"action"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
 			return
 		}
 
 		if req.Action != "add" && req.Action != "remove" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Action must be 'add' or 'remove'"})
+			apierror.Abort(c, http.StatusBadRequest, "Action must be 'add' or 'remove'")
 			return
 		}
 
 		file, err := fileRepo.FindByID(c.Request.Context(), fileID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			apierror.Abort(c, http.StatusNotFound, "File not found")
 			return
 		}
 
 		if file.OwnerID != userID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Only the file owner can manage private access"})
+			apierror.Abort(c, http.StatusForbidden, "Only the file owner can manage private access")
 			return
 		}
 
 		err = fileRepo.ManagePrivateAccess(c.Request.Context(), fileID, userID, req.UserIDs, req.Action)
 		if err != nil {
 			log.WithError(err).Error("Failed to manage private access")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			apierror.Abort(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 
@@ -565,7 +837,7 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 	router.GET("/v1/files/private", func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			apierror.Abort(c, http.StatusUnauthorized, "Authorization header required")
 			return
 		}
 
@@ -574,10 +846,10 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 			token = token[7:]
 		}
 
-		jwtValidator := jwt.NewJWTValidator(cfg.JWTSecret)
+		jwtValidator := jwtauth.NewValidator(cfg.JWTSecret)
 		userID, err := jwtValidator.ExtractUserID(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid token")
 			return
 		}
 
@@ -588,7 +860,7 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 		files, total, err := fileRepo.ListPrivateFiles(c.Request.Context(), userID, page, limit)
 		if err != nil {
 			log.WithError(err).Error("Failed to list private files")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list private files"})
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to list private files")
 			return
 		}
 
@@ -616,18 +888,24 @@ func startGRPCGateway(cfg *config.Config, log *logrus.Logger, redisCache *cache.
 	return httpServer.ListenAndServe()
 }
 
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+// newServiceTokenSource creates a token source that exchanges the service's client
+// credentials for service tokens via the auth-service
+func newServiceTokenSource(cfg *config.Config) (*serviceauth.TokenSource, error) {
+	conn, err := grpc.Dial(cfg.AuthServiceGRPC, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
+	}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	client := authv1.NewAuthServiceClient(conn)
+	return serviceauth.NewTokenSource(func(ctx context.Context, audience string) (string, int64, error) {
+		resp, err := client.IssueServiceToken(ctx, &authv1.IssueServiceTokenRequest{
+			ClientId:     cfg.ServiceClientID,
+			ClientSecret: cfg.ServiceClientSecret,
+			Audience:     audience,
+		})
+		if err != nil {
+			return "", 0, err
 		}
-
-		c.Next()
-	}
+		return resp.AccessToken, resp.ExpiresIn, nil
+	}), nil
 }
@@ -0,0 +1,450 @@
+// Package backup snapshots the platform's metadata in MongoDB and the file objects in
+// MinIO into a backup bucket, and restores them.
+//
+// A snapshot is stored under snapshots/<id>/ in the backup bucket: a gzipped file of
+// canonical extended JSON documents per collection, an index of the file objects and,
+// written last, manifest.json, so that only complete snapshots are listed. Snapshot IDs
+// are the UTC times they were taken at, and sort in that order. File objects are copied
+// into objects/<key>/<etag> once and shared by every snapshot that lists them, so each
+// snapshot only copies the objects uploaded or changed since the previous one.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	snapshotsPrefix = "snapshots/"
+	objectsPrefix   = "objects/"
+	manifestName    = "manifest.json"
+	objectIndexName = "objects.jsonl.gz"
+	// idLayout formats snapshot IDs
+	idLayout = "20060102T150405Z"
+	// insertBatchSize is the number of documents restored per insert
+	insertBatchSize = 500
+)
+
+// DefaultCollections are the collections snapshotted by default: the files, their shares,
+// the files shared with each user and private folders, the users and organizations, and
+// the subscriptions and billing records
+var DefaultCollections = []string{
+	"files", "file_shares", "shared_with", "favorites", "private_folder_files", "storage_stats",
+	"users", "organizations", "organization_members", "groups",
+	"subscriptions", "plans", "invoices", "api_keys",
+}
+
+// ErrSnapshotNotFound is returned when no snapshot matches a selection
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Manifest describes a complete snapshot
+type Manifest struct {
+	ID           string           `json:"id"`
+	CreatedAt    time.Time        `json:"created_at"`
+	Database     string           `json:"database"`
+	SourceBucket string           `json:"source_bucket"`
+	Collections  map[string]int64 `json:"collections"`
+	Objects      int64            `json:"objects"`
+	ObjectBytes  int64            `json:"object_bytes"`
+	// CopiedObjects are the objects copied into the backup bucket by this snapshot
+	CopiedObjects int64 `json:"copied_objects"`
+}
+
+// objectEntry is a file object listed by a snapshot
+type objectEntry struct {
+	Key  string `json:"key"`
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+// backupKey is the key of the copy of an object in the backup bucket
+func (e *objectEntry) backupKey() string {
+	return objectsPrefix + e.Key + "/" + e.ETag
+}
+
+// Manager takes and restores snapshots
+type Manager struct {
+	db           *mongo.Database
+	storage      *minio.Client
+	sourceBucket string
+	backupBucket string
+	collections  []string
+	logger       *logrus.Logger
+}
+
+// NewManager creates a manager snapshotting collections of db and the objects of
+// sourceBucket into backupBucket
+func NewManager(db *mongo.Database, storage *minio.Client, sourceBucket, backupBucket string, collections []string, logger *logrus.Logger) *Manager {
+	return &Manager{
+		db:           db,
+		storage:      storage,
+		sourceBucket: sourceBucket,
+		backupBucket: backupBucket,
+		collections:  collections,
+		logger:       logger,
+	}
+}
+
+// Create takes a snapshot. The collections are dumped first and the objects listed after,
+// so that every file recorded in the snapshot has its object.
+func (m *Manager) Create(ctx context.Context) (*Manifest, error) {
+	if err := m.ensureBucket(ctx); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	manifest := &Manifest{
+		ID:           now.Format(idLayout),
+		CreatedAt:    now,
+		Database:     m.db.Name(),
+		SourceBucket: m.sourceBucket,
+		Collections:  make(map[string]int64, len(m.collections)),
+	}
+	if _, err := m.readManifest(ctx, manifest.ID); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", manifest.ID)
+	}
+
+	for _, name := range m.collections {
+		count, err := m.dumpCollection(ctx, manifest.ID, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump %s: %w", name, err)
+		}
+		manifest.Collections[name] = count
+		m.logger.WithFields(logrus.Fields{"collection": name, "documents": count}).Info("Collection dumped")
+	}
+
+	if err := m.mirrorObjects(ctx, manifest); err != nil {
+		return nil, fmt.Errorf("failed to back up objects: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := m.putBytes(ctx, manifestKey(manifest.ID), data, "application/json"); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// List returns the complete snapshots, oldest first
+func (m *Manager) List(ctx context.Context) ([]*Manifest, error) {
+	var manifests []*Manifest
+	for object := range m.storage.ListObjects(ctx, m.backupBucket, minio.ListObjectsOptions{Prefix: snapshotsPrefix}) {
+		if object.Err != nil {
+			if minio.ToErrorResponse(object.Err).Code == "NoSuchBucket" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to list snapshots: %w", object.Err)
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(object.Key, snapshotsPrefix), "/")
+		manifest, err := m.readManifest(ctx, id)
+		if err != nil {
+			// Snapshots without a manifest were interrupted
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].ID < manifests[j].ID })
+	return manifests, nil
+}
+
+// Find returns the snapshot with an ID, or without one the latest snapshot taken at or
+// before at, or the latest snapshot if at is zero
+func (m *Manager) Find(ctx context.Context, id string, at time.Time) (*Manifest, error) {
+	if id != "" {
+		manifest, err := m.readManifest(ctx, id)
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrSnapshotNotFound
+		}
+		return manifest, err
+	}
+
+	manifests, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(manifests) - 1; i >= 0; i-- {
+		if at.IsZero() || !manifests[i].CreatedAt.After(at) {
+			return manifests[i], nil
+		}
+	}
+	return nil, ErrSnapshotNotFound
+}
+
+// Prune removes all but the keep latest snapshots, and the copies of objects none of the
+// remaining snapshots lists. It returns the IDs of the removed snapshots.
+func (m *Manager) Prune(ctx context.Context, keep int) ([]string, error) {
+	if keep < 1 {
+		return nil, errors.New("at least one snapshot must be kept")
+	}
+	manifests, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifests) <= keep {
+		return nil, nil
+	}
+
+	var removed []string
+	for _, manifest := range manifests[:len(manifests)-keep] {
+		// The manifest goes first, so that a partly removed snapshot is no longer listed
+		if err := m.storage.RemoveObject(ctx, m.backupBucket, manifestKey(manifest.ID), minio.RemoveObjectOptions{}); err != nil {
+			return removed, fmt.Errorf("failed to remove snapshot %s: %w", manifest.ID, err)
+		}
+		if err := m.removePrefix(ctx, snapshotsPrefix+manifest.ID+"/", nil); err != nil {
+			return removed, fmt.Errorf("failed to remove snapshot %s: %w", manifest.ID, err)
+		}
+		removed = append(removed, manifest.ID)
+	}
+
+	referenced := make(map[string]bool)
+	for _, manifest := range manifests[len(manifests)-keep:] {
+		err := m.readObjectIndex(ctx, manifest.ID, func(entry *objectEntry) error {
+			referenced[entry.backupKey()] = true
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+	}
+	if err := m.removePrefix(ctx, objectsPrefix, referenced); err != nil {
+		return removed, fmt.Errorf("failed to remove unreferenced objects: %w", err)
+	}
+	return removed, nil
+}
+
+// dumpCollection writes the documents of a collection to the snapshot and returns how
+// many there were
+func (m *Manager) dumpCollection(ctx context.Context, id, name string) (int64, error) {
+	cursor, err := m.db.Collection(name).Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var count int64
+	err = m.putGzip(ctx, collectionKey(id, name), func(w io.Writer) error {
+		for cursor.Next(ctx) {
+			line, err := bson.MarshalExtJSON(cursor.Current, true, false)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return err
+			}
+			count++
+		}
+		return cursor.Err()
+	})
+	return count, err
+}
+
+// mirrorObjects lists the objects of the source bucket in the snapshot, copying those the
+// previous snapshot didn't list into the backup bucket
+func (m *Manager) mirrorObjects(ctx context.Context, manifest *Manifest) error {
+	backedUp := make(map[string]bool)
+	previous, err := m.Find(ctx, "", time.Time{})
+	if err != nil && !errors.Is(err, ErrSnapshotNotFound) {
+		return err
+	}
+	if previous != nil {
+		err := m.readObjectIndex(ctx, previous.ID, func(entry *objectEntry) error {
+			backedUp[entry.backupKey()] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.putGzip(ctx, objectIndexKey(manifest.ID), func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for object := range m.storage.ListObjects(ctx, m.sourceBucket, minio.ListObjectsOptions{Recursive: true}) {
+			if object.Err != nil {
+				return object.Err
+			}
+			entry := objectEntry{Key: object.Key, ETag: strings.Trim(object.ETag, `"`), Size: object.Size}
+			if !backedUp[entry.backupKey()] {
+				_, err := m.storage.CopyObject(ctx,
+					minio.CopyDestOptions{Bucket: m.backupBucket, Object: entry.backupKey()},
+					minio.CopySrcOptions{Bucket: m.sourceBucket, Object: entry.Key, MatchETag: entry.ETag})
+				if err != nil {
+					if code := minio.ToErrorResponse(err).Code; code == "NoSuchKey" || code == "PreconditionFailed" {
+						// Deleted or replaced since it was listed; its file is no
+						// longer in the snapshot either
+						continue
+					}
+					return fmt.Errorf("failed to copy %s: %w", entry.Key, err)
+				}
+				manifest.CopiedObjects++
+			}
+			if err := encoder.Encode(&entry); err != nil {
+				return err
+			}
+			manifest.Objects++
+			manifest.ObjectBytes += entry.Size
+		}
+		return nil
+	})
+}
+
+// readObjectIndex calls fn with each object listed by a snapshot
+func (m *Manager) readObjectIndex(ctx context.Context, id string, fn func(entry *objectEntry) error) error {
+	return m.readLines(ctx, objectIndexKey(id), func(line []byte) error {
+		var entry objectEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("invalid object index of snapshot %s: %w", id, err)
+		}
+		return fn(&entry)
+	})
+}
+
+// readManifest reads the manifest of a snapshot
+func (m *Manager) readManifest(ctx context.Context, id string) (*Manifest, error) {
+	object, err := m.storage.GetObject(ctx, m.backupBucket, manifestKey(id), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(object).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// readLines calls fn with each line of a gzipped object of the backup bucket
+func (m *Manager) readLines(ctx context.Context, key string, fn func(line []byte) error) error {
+	object, err := m.storage.GetObject(ctx, m.backupBucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	reader, err := gzip.NewReader(object)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 32*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return nil
+}
+
+// putGzip stores what write writes, gzipped, at key in the backup bucket. It is staged
+// in a temporary file, so that large collections aren't held in memory.
+func (m *Manager) putGzip(ctx context.Context, key string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp("", "backup-*.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	buffered := bufio.NewWriter(writer)
+	if err := write(buffered); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	_, err = m.storage.FPutObject(ctx, m.backupBucket, key, file.Name(), minio.PutObjectOptions{ContentType: "application/gzip"})
+	return err
+}
+
+// putBytes stores data at key in the backup bucket
+func (m *Manager) putBytes(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := m.storage.PutObject(ctx, m.backupBucket, key, strings.NewReader(string(data)), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// removePrefix removes the objects of the backup bucket under prefix, except those in keep
+func (m *Manager) removePrefix(ctx context.Context, prefix string, keep map[string]bool) error {
+	objects := make(chan minio.ObjectInfo)
+	listErr := make(chan error, 1)
+	go func() {
+		defer close(objects)
+		for object := range m.storage.ListObjects(ctx, m.backupBucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if object.Err != nil {
+				listErr <- object.Err
+				return
+			}
+			if !keep[object.Key] {
+				objects <- object
+			}
+		}
+		listErr <- nil
+	}()
+
+	for result := range m.storage.RemoveObjects(ctx, m.backupBucket, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			return fmt.Errorf("failed to remove %s: %w", result.ObjectName, result.Err)
+		}
+	}
+	return <-listErr
+}
+
+// ensureBucket creates the backup bucket if needed
+func (m *Manager) ensureBucket(ctx context.Context) error {
+	exists, err := m.storage.BucketExists(ctx, m.backupBucket)
+	if err != nil {
+		return fmt.Errorf("failed to check backup bucket: %w", err)
+	}
+	if exists {
+		return nil
+	}
+	if err := m.storage.MakeBucket(ctx, m.backupBucket, minio.MakeBucketOptions{}); err != nil {
+		return fmt.Errorf("failed to create backup bucket: %w", err)
+	}
+	return nil
+}
+
+func manifestKey(id string) string {
+	return path.Join(snapshotsPrefix, id, manifestName)
+}
+
+func objectIndexKey(id string) string {
+	return path.Join(snapshotsPrefix, id, objectIndexName)
+}
+
+func collectionKey(id, name string) string {
+	return path.Join(snapshotsPrefix, id, "collections", name+".jsonl.gz")
+}
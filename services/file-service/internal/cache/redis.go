@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/metrics"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
 )
 
@@ -23,17 +27,91 @@ const (
 	PresignedURLPrefix = "file:presigned:"
 	UserFilesPrefix    = "user:files:"
 	SharedFilesPrefix  = "user:shared:"
+	AttemptsPrefix     = "file:attempts:"
 )
 
+// Redis modes
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// healthCheckInterval is how often the cache checks that Redis is available
+const healthCheckInterval = 5 * time.Second
+
+// RedisOptions configure the connection to Redis
+type RedisOptions struct {
+	// Mode is ModeStandalone, ModeSentinel or ModeCluster
+	Mode string
+	// Addrs is the server in standalone mode, the sentinels in sentinel mode and the
+	// seed nodes in cluster mode
+	Addrs []string
+	// MasterName is the master the sentinels serve
+	MasterName       string
+	SentinelPassword string
+	Password         string
+	// DB is ignored in cluster mode, which only has database 0
+	DB           int
+	MaxRetries   int
+	PoolSize     int
+	MinIdleConns int
+}
+
+// newClient creates the client of the options' mode
+func (o RedisOptions) newClient() (redis.UniversalClient, error) {
+	if len(o.Addrs) == 0 {
+		return nil, errors.New("no Redis address")
+	}
+	universal := &redis.UniversalOptions{
+		Addrs:            o.Addrs,
+		MasterName:       o.MasterName,
+		SentinelPassword: o.SentinelPassword,
+		Password:         o.Password,
+		DB:               o.DB,
+		MaxRetries:       o.MaxRetries,
+		PoolSize:         o.PoolSize,
+		MinIdleConns:     o.MinIdleConns,
+		DialTimeout:      5 * time.Second,
+		ReadTimeout:      3 * time.Second,
+		WriteTimeout:     3 * time.Second,
+	}
+
+	switch o.Mode {
+	case ModeStandalone, "":
+		return redis.NewClient(universal.Simple()), nil
+	case ModeSentinel:
+		if o.MasterName == "" {
+			return nil, errors.New("sentinel mode needs the master name")
+		}
+		return redis.NewFailoverClient(universal.Failover()), nil
+	case ModeCluster:
+		return redis.NewClusterClient(universal.Cluster()), nil
+	default:
+		return nil, fmt.Errorf("unknown Redis mode %q", o.Mode)
+	}
+}
+
+// RedisCache caches file metadata and listings in Redis. The cache degrades gracefully:
+// while Redis is unavailable IsEnabled reports false, so callers go to the database
+// instead of waiting on Redis, and the cache is cleared when Redis is back, since the
+// invalidations made meanwhile were lost.
 type RedisCache struct {
-	client  *redis.Client
-	enabled bool
-	ttl     time.Duration
-	logger  *logrus.Logger
+	client    redis.UniversalClient
+	enabled   bool
+	available atomic.Bool
+	ttl       time.Duration
+	logger    *logrus.Logger
+
+	stopMonitor chan struct{}
+	monitorDone chan struct{}
+	// lastPoolStats is the pool stats the metrics were last updated from
+	lastPoolStats redis.PoolStats
 }
 
-// NewRedisCache creates a new Redis cache instance
-func NewRedisCache(addr, password string, db int, ttl time.Duration, maxRetries, poolSize, minIdleConns int, logger *logrus.Logger, enabled bool) (*RedisCache, error) {
+// NewRedisCache creates a new Redis cache instance. Redis being unavailable doesn't fail
+// it; the cache is used once Redis is available.
+func NewRedisCache(opts RedisOptions, ttl time.Duration, logger *logrus.Logger, enabled bool) (*RedisCache, error) {
 	if !enabled {
 		logger.Info("Redis cache is disabled")
 		return &RedisCache{
@@ -43,56 +121,178 @@ func NewRedisCache(addr, password string, db int, ttl time.Duration, maxRetries,
 		}, nil
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Addr:         addr,
-		Password:     password,
-		DB:           db,
-		MaxRetries:   maxRetries,
-		PoolSize:     poolSize,
-		MinIdleConns: minIdleConns,
-		DialTimeout:  5 * time.Second,
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 3 * time.Second,
-	})
+	client, err := opts.newClient()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis configuration: %w", err)
+	}
+
+	c := &RedisCache{
+		client:      client,
+		enabled:     true,
+		ttl:         ttl,
+		logger:      logger,
+		stopMonitor: make(chan struct{}),
+		monitorDone: make(chan struct{}),
+	}
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	fields := logrus.Fields{
+		"mode":  opts.Mode,
+		"addrs": opts.Addrs,
+		"db":    opts.DB,
+		"ttl":   ttl,
+	}
 	if err := client.Ping(ctx).Err(); err != nil {
-		logger.WithError(err).Error("Failed to connect to Redis")
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+		logger.WithError(err).WithFields(fields).Warn("Redis is unavailable; caching is suspended until it is back")
+		metrics.RedisUp.Set(0)
+	} else {
+		c.available.Store(true)
+		metrics.RedisUp.Set(1)
+		logger.WithFields(fields).Info("Redis cache connected successfully")
 	}
 
-	logger.WithFields(logrus.Fields{
-		"addr": addr,
-		"db":   db,
-		"ttl":  ttl,
-	}).Info("Redis cache connected successfully")
-
-	return &RedisCache{
-		client:  client,
-		enabled: true,
-		ttl:     ttl,
-		logger:  logger,
-	}, nil
+	go c.monitor()
+	return c, nil
 }
 
-// IsEnabled returns whether cache is enabled
+// IsEnabled returns whether cache is enabled and Redis is available
 func (c *RedisCache) IsEnabled() bool {
-	return c.enabled
+	return c.enabled && c.available.Load()
 }
 
-// Close closes the Redis connection
+// Close stops the health checks and closes the Redis connection
 func (c *RedisCache) Close() error {
 	if !c.enabled || c.client == nil {
 		return nil
 	}
 
+	close(c.stopMonitor)
+	<-c.monitorDone
+
 	c.logger.Info("Closing Redis connection")
 	return c.client.Close()
 }
 
+// monitor checks that Redis is available until the cache is closed, and updates the
+// Redis metrics
+func (c *RedisCache) monitor() {
+	defer close(c.monitorDone)
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopMonitor:
+			return
+		case <-ticker.C:
+			c.checkHealth()
+		}
+	}
+}
+
+// checkHealth pings Redis and records whether it is available
+func (c *RedisCache) checkHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := c.client.Ping(ctx).Err()
+	c.recordPoolStats()
+	if err != nil {
+		metrics.RedisUp.Set(0)
+		if c.available.CompareAndSwap(true, false) {
+			metrics.RedisAvailabilityChangesTotal.WithLabelValues("down").Inc()
+			c.logger.WithError(err).Warn("Redis is unavailable; serving from the database until it is back")
+		}
+		return
+	}
+
+	metrics.RedisUp.Set(1)
+	if c.available.Load() {
+		return
+	}
+
+	// Entries cached before Redis went away may have missed invalidations since; the
+	// cache is used again once they are cleared
+	if err := c.clear(ctx); err != nil {
+		c.logger.WithError(err).Warn("Redis is back but the cache could not be cleared; retrying")
+		return
+	}
+	c.available.Store(true)
+	metrics.RedisAvailabilityChangesTotal.WithLabelValues("up").Inc()
+	c.logger.Info("Redis is available again; caching resumed")
+}
+
+// recordPoolStats updates the pool metrics from the pool's stats
+func (c *RedisCache) recordPoolStats() {
+	stats := c.client.PoolStats()
+	metrics.RedisPoolConnections.WithLabelValues("total").Set(float64(stats.TotalConns))
+	metrics.RedisPoolConnections.WithLabelValues("idle").Set(float64(stats.IdleConns))
+	metrics.RedisPoolConnections.WithLabelValues("stale").Set(float64(stats.StaleConns))
+
+	// The pool counts since it was created; the counters only take what was added since
+	// the last update
+	last := c.lastPoolStats
+	if stats.Hits >= last.Hits {
+		metrics.RedisPoolEventsTotal.WithLabelValues("hit").Add(float64(stats.Hits - last.Hits))
+	}
+	if stats.Misses >= last.Misses {
+		metrics.RedisPoolEventsTotal.WithLabelValues("miss").Add(float64(stats.Misses - last.Misses))
+	}
+	if stats.Timeouts >= last.Timeouts {
+		metrics.RedisPoolEventsTotal.WithLabelValues("timeout").Add(float64(stats.Timeouts - last.Timeouts))
+	}
+	c.lastPoolStats = *stats
+}
+
+// clear removes all the entries of the cache
+func (c *RedisCache) clear(ctx context.Context) error {
+	for _, prefix := range []string{FileMetadataPrefix, PresignedURLPrefix, UserFilesPrefix, SharedFilesPrefix} {
+		if _, err := c.deleteMatching(ctx, prefix+"*"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMatching deletes the keys matching a pattern and returns how many it deleted. In
+// cluster mode the keys are spread over the masters, which are each scanned.
+func (c *RedisCache) deleteMatching(ctx context.Context, pattern string) (int, error) {
+	cluster, ok := c.client.(*redis.ClusterClient)
+	if !ok {
+		return c.deleteMatchingOn(ctx, c.client, pattern)
+	}
+
+	var mu sync.Mutex
+	deleted := 0
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		count, err := c.deleteMatchingOn(ctx, master, pattern)
+		mu.Lock()
+		deleted += count
+		mu.Unlock()
+		return err
+	})
+	return deleted, err
+}
+
+// deleteMatchingOn deletes the keys matching a pattern on one server
+func (c *RedisCache) deleteMatchingOn(ctx context.Context, client redis.Cmdable, pattern string) (int, error) {
+	iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+	deleted := 0
+
+	for iter.Next(ctx) {
+		if err := client.Del(ctx, iter.Val()).Err(); err != nil {
+			c.logger.WithError(err).WithField("key", iter.Val()).Error("Failed to delete cache key")
+		} else {
+			deleted++
+		}
+	}
+	return deleted, iter.Err()
+}
+
 // GetFileMetadata retrieves cached file metadata
 func (c *RedisCache) GetFileMetadata(ctx context.Context, fileID string) (*models.File, error) {
 	if !c.enabled {
@@ -264,20 +464,8 @@ func (c *RedisCache) InvalidateUserFilesList(ctx context.Context, userID string)
 	}
 
 	// Delete all keys matching the pattern
-	pattern := UserFilesPrefix + userID + ":*"
-
-	iter := c.client.Scan(ctx, 0, pattern, 100).Iterator()
-	deletedCount := 0
-
-	for iter.Next(ctx) {
-		if err := c.client.Del(ctx, iter.Val()).Err(); err != nil {
-			c.logger.WithError(err).WithField("key", iter.Val()).Error("Failed to delete cache key")
-		} else {
-			deletedCount++
-		}
-	}
-
-	if err := iter.Err(); err != nil {
+	deletedCount, err := c.deleteMatching(ctx, UserFilesPrefix+userID+":*")
+	if err != nil {
 		c.logger.WithError(err).WithField("user_id", userID).Error("Failed to scan user files cache")
 		return err
 	}
@@ -296,20 +484,8 @@ func (c *RedisCache) InvalidateSharedFilesList(ctx context.Context, userID strin
 		return ErrCacheDisabled
 	}
 
-	pattern := SharedFilesPrefix + userID + ":*"
-
-	iter := c.client.Scan(ctx, 0, pattern, 100).Iterator()
-	deletedCount := 0
-
-	for iter.Next(ctx) {
-		if err := c.client.Del(ctx, iter.Val()).Err(); err != nil {
-			c.logger.WithError(err).WithField("key", iter.Val()).Error("Failed to delete cache key")
-		} else {
-			deletedCount++
-		}
-	}
-
-	if err := iter.Err(); err != nil {
+	deletedCount, err := c.deleteMatching(ctx, SharedFilesPrefix+userID+":*")
+	if err != nil {
 		c.logger.WithError(err).WithField("user_id", userID).Error("Failed to scan shared files cache")
 		return err
 	}
@@ -363,6 +539,7 @@ func (c *RedisCache) GetStats(ctx context.Context) (map[string]interface{}, erro
 
 	return map[string]interface{}{
 		"enabled":     true,
+		"available":   c.available.Load(),
 		"hits":        stats.Hits,
 		"misses":      stats.Misses,
 		"timeouts":    stats.Timeouts,
@@ -380,3 +557,49 @@ func (c *RedisCache) HealthCheck(ctx context.Context) error {
 
 	return c.client.Ping(ctx).Err()
 }
+
+// PublishUploadProgress publishes the progress of an upload, for the notification-service
+// to relay to the uploader's WebSocket connections
+func (c *RedisCache) PublishUploadProgress(ctx context.Context, progress *events.UploadProgress) error {
+	if !c.enabled {
+		return ErrCacheDisabled
+	}
+
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, events.UploadProgressChannel, data).Err()
+}
+
+// PublishStorageUsage publishes the storage usage of a user after it changed, for the
+// notification-service to relay to the user's WebSocket connections
+func (c *RedisCache) PublishStorageUsage(ctx context.Context, usage *events.StorageUsage) error {
+	if !c.enabled {
+		return ErrCacheDisabled
+	}
+
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, events.StorageUsageChannel, data).Err()
+}
+
+// CountAttempt counts an attempt against key in a fixed window starting with the first
+// attempt, and returns the number of attempts made in the window and the time left in it
+func (c *RedisCache) CountAttempt(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	if !c.IsEnabled() {
+		return 0, 0, ErrCacheDisabled
+	}
+
+	key = AttemptsPrefix + key
+	pipe := c.client.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	ttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, err
+	}
+	return count.Val(), ttl.Val(), nil
+}
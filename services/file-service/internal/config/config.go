@@ -3,9 +3,10 @@ package config
 import (
 	"errors"
 	"os"
-	"strconv"
 	"strings"
 	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
 )
 
 // Service configuration constants
@@ -18,16 +19,26 @@ const (
 	DefaultMaxPageSize           = 100
 	DefaultOperationTimeout      = 30 * time.Second
 	DefaultQueryTimeout          = 5 * time.Second
-	DefaultShutdownTimeout       = 10 * time.Second
+	DefaultShutdownTimeout       = 30 * time.Second
+	DefaultShutdownDrainDelay    = 5 * time.Second
 	DefaultUploadRatePerMinute   = 10
 	DefaultUploadRateBurst       = 10
 	DefaultCircuitBreakerMaxReq  = 3
 	DefaultCircuitBreakerTimeout = 30 * time.Second
+	DefaultOutboxPollInterval    = time.Second
+	DefaultOutboxBatchSize       = 100
+	DefaultDeletionMaxAttempts   = 5
+	DefaultDeletionPollInterval  = 10 * time.Second
+	DefaultReconcileInterval     = time.Hour
+	DefaultReconcileOrphanGrace  = 24 * time.Hour
 	// Redis defaults
 	DefaultRedisCacheTTL     = 5 * time.Minute
 	DefaultRedisMaxRetries   = 3
 	DefaultRedisPoolSize     = 10
 	DefaultRedisMinIdleConns = 5
+	// Limits for accounts that have not verified their email
+	DefaultUnverifiedMaxFileSize  = 10 * 1024 * 1024  // 10MB
+	DefaultUnverifiedStorageQuota = 100 * 1024 * 1024 // 100MB
 )
 
 type Config struct {
@@ -44,6 +55,37 @@ type Config struct {
 	MinioBucket           string
 	MinioUseSSL           bool
 	KafkaBrokers          []string
+	// The outbox relay publishes up to OutboxBatchSize recorded events every
+	// OutboxPollInterval
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	// ShareClaimsGroup is the consumer group of the user events that claim the shares
+	// made to the email addresses of new accounts
+	ShareClaimsGroup string
+	// A file deletion step that fails DeletionMaxAttempts times before the deleted
+	// event is recorded undoes the deletion. Failed deletions are resumed every
+	// DeletionPollInterval.
+	DeletionMaxAttempts  int
+	DeletionPollInterval time.Duration
+	// Storage usage and object storage are reconciled with the file records every
+	// ReconcileInterval, or never if it is 0, or with ReconcileDaily set once a day at
+	// ReconcileAt past midnight UTC instead. With ReconcileRepair set, drifted usage is
+	// recomputed and objects no file is stored at for ReconcileOrphanGrace are removed.
+	// The latest report is served to ReconcileAPIToken bearers if it is set.
+	ReconcileInterval    time.Duration
+	ReconcileDaily       bool
+	ReconcileAt          time.Duration
+	ReconcileRepair      bool
+	ReconcileOrphanGrace time.Duration
+	ReconcileAPIToken    string
+	// The feature flags shared by the services are managed by FeatureFlagsAPIToken
+	// bearers if it is set
+	FeatureFlagsAPIToken string
+	// Storage and sharing statistics are served to AnalyticsAPIToken bearers if it is set
+	AnalyticsAPIToken string
+	// Pending MongoDB migrations are applied on startup if MigrateOnStartup is set, and
+	// otherwise only by the migrate subcommand
+	MigrateOnStartup      bool
 	AuthServiceGRPC       string
 	BillingServiceGRPC    string
 	JWTSecret             string
@@ -72,7 +114,13 @@ type Config struct {
 	RedisMaxRetries   int
 	RedisPoolSize     int
 	RedisMinIdleConns int
-	FrontendURL       string
+	// RedisMode is standalone, sentinel or cluster. In sentinel mode RedisAddrs are the
+	// sentinels serving RedisMasterName, and in cluster mode the seed nodes.
+	RedisMode             string
+	RedisAddrs            []string
+	RedisMasterName       string
+	RedisSentinelPassword string
+	FrontendURL           string
 	// Cassandra Configuration
 	CassandraHosts       []string
 	CassandraPort        int
@@ -83,126 +131,175 @@ type Config struct {
 	CassandraTimeout     time.Duration
 	CassandraNumConns    int
 	CassandraEnableTLS   bool
+
+	// GRPCDefaultTimeout is the deadline given to gRPC calls that arrive without one
+	GRPCDefaultTimeout time.Duration
+
+	// ShutdownDrainDelay is how long the service keeps serving after failing its
+	// readiness probe at shutdown, for load balancers to stop sending it requests,
+	// before draining the work in progress within ShutdownTimeout
+	ShutdownDrainDelay time.Duration
+
+	// Service-to-service authentication
+	ServiceAuthEnabled bool
+	ServiceName        string
+	ServiceTokenSecret string
+	// Client credentials exchanged for service tokens when calling other services
+	ServiceClientID     string
+	ServiceClientSecret string
+	// Unverified account limits
+	UnverifiedMaxFileSize  int64
+	UnverifiedStorageQuota int64
 }
 
 func Load() (*Config, error) {
 	// Validate required credentials
-	minioAccessKey := getEnv("MINIO_ACCESS_KEY", "")
-	minioSecretKey := getEnv("MINIO_SECRET_KEY", "")
+	minioAccessKey := env.String("MINIO_ACCESS_KEY", "")
+	minioSecretKey := env.String("MINIO_SECRET_KEY", "")
 
 	if minioAccessKey == "" || minioSecretKey == "" {
 		return nil, errors.New("MINIO_ACCESS_KEY and MINIO_SECRET_KEY are required environment variables")
 	}
 
-	mongoURI := getEnv("MONGO_URI", "")
+	mongoURI := env.String("MONGO_URI", "")
 	if mongoURI == "" {
 		return nil, errors.New("MONGO_URI is required environment variable")
 	}
 
-	kafkaBrokers := getEnv("KAFKA_BROKERS", "")
+	kafkaBrokers := env.String("KAFKA_BROKERS", "")
 	if kafkaBrokers == "" {
 		return nil, errors.New("KAFKA_BROKERS is required environment variable")
 	}
 
 	// Parse optional configuration with defaults
-	maxFileSize := getEnvInt64("MAX_FILE_SIZE", DefaultMaxFileSize)
-	minFileSize := getEnvInt64("MIN_FILE_SIZE", DefaultMinFileSize)
-	presignedURLExpiry := getEnvDuration("PRESIGNED_URL_EXPIRY", DefaultPresignedURLExpiry)
-	uploadRetries := getEnvInt("UPLOAD_RETRIES", DefaultUploadRetries)
-	operationTimeout := getEnvDuration("OPERATION_TIMEOUT", DefaultOperationTimeout)
-	queryTimeout := getEnvDuration("QUERY_TIMEOUT", DefaultQueryTimeout)
-	shutdownTimeout := getEnvDuration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout)
+	maxFileSize := env.Int64("MAX_FILE_SIZE", DefaultMaxFileSize)
+	minFileSize := env.Int64("MIN_FILE_SIZE", DefaultMinFileSize)
+	presignedURLExpiry := env.Duration("PRESIGNED_URL_EXPIRY", DefaultPresignedURLExpiry)
+	uploadRetries := env.Int("UPLOAD_RETRIES", DefaultUploadRetries)
+	operationTimeout := env.Duration("OPERATION_TIMEOUT", DefaultOperationTimeout)
+	queryTimeout := env.Duration("QUERY_TIMEOUT", DefaultQueryTimeout)
+	shutdownTimeout := env.Duration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout)
+
+	outboxPollInterval := env.Duration("OUTBOX_POLL_INTERVAL", DefaultOutboxPollInterval)
+	outboxBatchSize := env.Int("OUTBOX_BATCH_SIZE", DefaultOutboxBatchSize)
+	if outboxPollInterval <= 0 || outboxBatchSize <= 0 {
+		return nil, errors.New("OUTBOX_POLL_INTERVAL and OUTBOX_BATCH_SIZE must be positive")
+	}
+
+	deletionMaxAttempts := env.Int("DELETION_MAX_ATTEMPTS", DefaultDeletionMaxAttempts)
+	deletionPollInterval := env.Duration("DELETION_POLL_INTERVAL", DefaultDeletionPollInterval)
+	if deletionMaxAttempts <= 0 || deletionPollInterval <= 0 {
+		return nil, errors.New("DELETION_MAX_ATTEMPTS and DELETION_POLL_INTERVAL must be positive")
+	}
+	reconcileInterval := env.Duration("RECONCILE_INTERVAL", DefaultReconcileInterval)
+	if reconcileInterval < 0 {
+		return nil, errors.New("RECONCILE_INTERVAL must not be negative")
+	}
+	var reconcileAt time.Duration
+	reconcileAtValue := env.String("RECONCILE_AT", "")
+	reconcileDaily := reconcileAtValue != ""
+	if reconcileDaily {
+		at, err := time.Parse("15:04", reconcileAtValue)
+		if err != nil {
+			return nil, errors.New("RECONCILE_AT must be a time of day such as 03:00")
+		}
+		reconcileAt = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	}
+	redisAddr := env.String("REDIS_ADDR", "localhost:6379")
+	redisMode := env.String("REDIS_MODE", "standalone")
+	switch redisMode {
+	case "standalone", "sentinel", "cluster":
+	default:
+		return nil, errors.New("REDIS_MODE must be standalone, sentinel or cluster")
+	}
 
 	return &Config{
-		ServicePort:           getEnv("FILE_SERVICE_PORT", "8082"),
-		GRPCPort:              getEnv("FILE_GRPC_PORT", "50052"),
-		ServiceHost:           getEnv("FILE_SERVICE_HOST", "0.0.0.0"),
+		ServicePort:           env.String("FILE_SERVICE_PORT", "8082"),
+		GRPCPort:              env.String("FILE_GRPC_PORT", "50052"),
+		ServiceHost:           env.String("FILE_SERVICE_HOST", "0.0.0.0"),
 		MongoURI:              mongoURI,
-		MongoDatabase:         getEnv("MONGO_DATABASE", "file_sharing"),
-		StorageType:           getEnv("STORAGE_TYPE", "minio"),
-		MinioEndpoint:         getEnv("MINIO_ENDPOINT", "minio:9000"),
-		MinioExternalEndpoint: getEnv("MINIO_EXTERNAL_ENDPOINT", "localhost:9000"),
+		MongoDatabase:         env.String("MONGO_DATABASE", "file_sharing"),
+		StorageType:           env.String("STORAGE_TYPE", "minio"),
+		MinioEndpoint:         env.String("MINIO_ENDPOINT", "minio:9000"),
+		MinioExternalEndpoint: env.String("MINIO_EXTERNAL_ENDPOINT", "localhost:9000"),
 		MinioAccessKey:        minioAccessKey,
 		MinioSecretKey:        minioSecretKey,
-		MinioBucket:           getEnv("MINIO_BUCKET", "file-sharing"),
-		MinioUseSSL:           getEnv("MINIO_USE_SSL", "false") == "true",
+		MinioBucket:           env.String("MINIO_BUCKET", "file-sharing"),
+		MinioUseSSL:           env.Bool("MINIO_USE_SSL", false),
 		KafkaBrokers:          strings.Split(kafkaBrokers, ","),
-		AuthServiceGRPC:       getEnv("AUTH_SERVICE_GRPC", "localhost:50051"),
-		BillingServiceGRPC:    getEnv("BILLING_SERVICE_GRPC", ""),
-		JWTSecret:             getEnv("JWT_SECRET", "your-super-secret-key-change-in-production"),
-		Environment:           getEnv("ENVIRONMENT", "development"),
-		LogLevel:              getEnv("LOG_LEVEL", "info"),
+		OutboxPollInterval:    outboxPollInterval,
+		OutboxBatchSize:       outboxBatchSize,
+		ShareClaimsGroup:      env.String("SHARE_CLAIMS_GROUP", "file-service-share-claims"),
+		DeletionMaxAttempts:   deletionMaxAttempts,
+		DeletionPollInterval:  deletionPollInterval,
+		ReconcileInterval:     reconcileInterval,
+		ReconcileDaily:        reconcileDaily,
+		ReconcileAt:           reconcileAt,
+		ReconcileRepair:       env.Bool("RECONCILE_REPAIR", true),
+		ReconcileOrphanGrace:  env.Duration("RECONCILE_ORPHAN_GRACE", DefaultReconcileOrphanGrace),
+		ReconcileAPIToken:     env.String("RECONCILE_API_TOKEN", ""),
+		FeatureFlagsAPIToken:  env.String("FEATURE_FLAGS_API_TOKEN", ""),
+		AnalyticsAPIToken:     env.String("ANALYTICS_API_TOKEN", ""),
+		MigrateOnStartup:      env.Bool("MIGRATE_ON_STARTUP", true),
+		AuthServiceGRPC:       env.String("AUTH_SERVICE_GRPC", "localhost:50051"),
+		BillingServiceGRPC:    env.String("BILLING_SERVICE_GRPC", ""),
+		JWTSecret:             env.String("JWT_SECRET", "your-super-secret-key-change-in-production"),
+		Environment:           env.String("ENVIRONMENT", "development"),
+		LogLevel:              env.String("LOG_LEVEL", "info"),
 		MaxFileSize:           maxFileSize,
 		MinFileSize:           minFileSize,
 		PresignedURLExpiry:    presignedURLExpiry,
 		UploadRetries:         uploadRetries,
-		DefaultPageSize:       int32(getEnvInt("DEFAULT_PAGE_SIZE", int(DefaultPageSize))),
-		MaxPageSize:           int32(getEnvInt("MAX_PAGE_SIZE", int(DefaultMaxPageSize))),
+		DefaultPageSize:       int32(env.Int("DEFAULT_PAGE_SIZE", int(DefaultPageSize))),
+		MaxPageSize:           int32(env.Int("MAX_PAGE_SIZE", int(DefaultMaxPageSize))),
 		OperationTimeout:      operationTimeout,
 		QueryTimeout:          queryTimeout,
 		ShutdownTimeout:       shutdownTimeout,
-		UploadRatePerMinute:   getEnvInt("UPLOAD_RATE_PER_MINUTE", DefaultUploadRatePerMinute),
-		UploadRateBurst:       getEnvInt("UPLOAD_RATE_BURST", DefaultUploadRateBurst),
-		CircuitBreakerMaxReq:  uint32(getEnvInt("CIRCUIT_BREAKER_MAX_REQ", int(DefaultCircuitBreakerMaxReq))),
-		CircuitBreakerTimeout: getEnvDuration("CIRCUIT_BREAKER_TIMEOUT", DefaultCircuitBreakerTimeout),
+		UploadRatePerMinute:   env.Int("UPLOAD_RATE_PER_MINUTE", DefaultUploadRatePerMinute),
+		UploadRateBurst:       env.Int("UPLOAD_RATE_BURST", DefaultUploadRateBurst),
+		CircuitBreakerMaxReq:  uint32(env.Int("CIRCUIT_BREAKER_MAX_REQ", int(DefaultCircuitBreakerMaxReq))),
+		CircuitBreakerTimeout: env.Duration("CIRCUIT_BREAKER_TIMEOUT", DefaultCircuitBreakerTimeout),
 		AllowedMimeTypes:      getAllowedMimeTypes(),
 		// Redis Configuration
-		RedisEnabled:      getEnv("REDIS_ENABLED", "true") == "true",
-		RedisAddr:         getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisPassword:     getEnv("REDIS_PASSWORD", ""),
-		RedisDB:           getEnvInt("REDIS_DB", 0),
-		RedisCacheTTL:     getEnvDuration("REDIS_CACHE_TTL", DefaultRedisCacheTTL),
-		RedisMaxRetries:   getEnvInt("REDIS_MAX_RETRIES", DefaultRedisMaxRetries),
-		RedisPoolSize:     getEnvInt("REDIS_POOL_SIZE", DefaultRedisPoolSize),
-		RedisMinIdleConns: getEnvInt("REDIS_MIN_IDLE_CONNS", DefaultRedisMinIdleConns),
-		FrontendURL:       getEnv("FRONTEND_URL", "http://localhost:3000"),
+		RedisEnabled:      env.Bool("REDIS_ENABLED", true),
+		RedisAddr:         redisAddr,
+		RedisPassword:     env.String("REDIS_PASSWORD", ""),
+		RedisDB:           env.Int("REDIS_DB", 0),
+		RedisCacheTTL:     env.Duration("REDIS_CACHE_TTL", DefaultRedisCacheTTL),
+		RedisMaxRetries:   env.Int("REDIS_MAX_RETRIES", DefaultRedisMaxRetries),
+		RedisPoolSize:     env.Int("REDIS_POOL_SIZE", DefaultRedisPoolSize),
+		RedisMinIdleConns: env.Int("REDIS_MIN_IDLE_CONNS", DefaultRedisMinIdleConns),
+		RedisMode:         redisMode,
+		RedisAddrs:        env.List("REDIS_ADDRS", []string{redisAddr}),
+		RedisMasterName:   env.String("REDIS_SENTINEL_MASTER", "mymaster"),
+		// The sentinels' own password, if they require one
+		RedisSentinelPassword: env.String("REDIS_SENTINEL_PASSWORD", ""),
+		FrontendURL:           env.String("FRONTEND_URL", "http://localhost:3000"),
 		// Cassandra Configuration
-		CassandraHosts:       strings.Split(getEnv("CASSANDRA_HOSTS", "localhost"), ","),
-		CassandraPort:        getEnvInt("CASSANDRA_PORT", 9042),
-		CassandraKeyspace:    getEnv("CASSANDRA_KEYSPACE", "file_service"),
-		CassandraUsername:    getEnv("CASSANDRA_USER", ""),
-		CassandraPassword:    getEnv("CASSANDRA_PASSWORD", ""),
-		CassandraConsistency: getEnv("CASSANDRA_CONSISTENCY", "LOCAL_QUORUM"),
-		CassandraTimeout:     getEnvDuration("CASSANDRA_TIMEOUT", 10*time.Second),
-		CassandraNumConns:    getEnvInt("CASSANDRA_NUM_CONNS", 2),
-		CassandraEnableTLS:   getEnv("CASSANDRA_TLS_ENABLED", "false") == "true",
+		CassandraHosts:       strings.Split(env.String("CASSANDRA_HOSTS", "localhost"), ","),
+		CassandraPort:        env.Int("CASSANDRA_PORT", 9042),
+		CassandraKeyspace:    env.String("CASSANDRA_KEYSPACE", "file_service"),
+		CassandraUsername:    env.String("CASSANDRA_USER", ""),
+		CassandraPassword:    env.String("CASSANDRA_PASSWORD", ""),
+		CassandraConsistency: env.String("CASSANDRA_CONSISTENCY", "LOCAL_QUORUM"),
+		CassandraTimeout:     env.Duration("CASSANDRA_TIMEOUT", 10*time.Second),
+		CassandraNumConns:    env.Int("CASSANDRA_NUM_CONNS", 2),
+		CassandraEnableTLS:   env.Bool("CASSANDRA_TLS_ENABLED", false),
+		GRPCDefaultTimeout:   env.Duration("GRPC_DEFAULT_TIMEOUT", 60*time.Second),
+		ShutdownDrainDelay:   env.Duration("SHUTDOWN_DRAIN_DELAY", DefaultShutdownDrainDelay),
+		// Service-to-service authentication
+		ServiceAuthEnabled: env.Bool("SERVICE_AUTH_ENABLED", false),
+		ServiceName:        env.String("SERVICE_NAME", "file-service"),
+		ServiceTokenSecret: env.String("SERVICE_TOKEN_SECRET", "your-service-token-secret-change-in-production"),
+		// Client credentials exchanged for service tokens when calling other services
+		ServiceClientID:     env.String("SERVICE_CLIENT_ID", "file-service"),
+		ServiceClientSecret: env.String("SERVICE_CLIENT_SECRET", ""),
+		// Unverified account limits
+		UnverifiedMaxFileSize:  env.Int64("UNVERIFIED_MAX_FILE_SIZE", DefaultUnverifiedMaxFileSize),
+		UnverifiedStorageQuota: env.Int64("UNVERIFIED_STORAGE_QUOTA", DefaultUnverifiedStorageQuota),
 	}, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return intVal
-		}
-	}
-	return defaultValue
-}
-
-func getEnvInt64(key string, defaultValue int64) int64 {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
-			return intVal
-		}
-	}
-	return defaultValue
-}
-
-func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
-		}
-	}
-	return defaultValue
-}
-
 func getAllowedMimeTypes() map[string]bool {
 	// Default allowed MIME types (whitelist)
 	defaults := map[string]bool{
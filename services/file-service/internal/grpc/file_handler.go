@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"sync"
@@ -11,11 +12,15 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/sony/gobreaker"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/grpcmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/serviceauth"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/cache"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/config"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/kafka"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/service"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/storage"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/validation"
 	filev1 "github.com/yourusername/distributed-file-sharing/services/file-service/pkg/pb/file/v1"
@@ -26,62 +31,66 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// BillingClient interface for billing service communication
+// BillingClient interface for billing service communication. The billing-service keeps
+// usage up to date from the file events, so only quota checks are synchronous.
 type BillingClient interface {
-	UpdateUsage(ctx context.Context, userID string, usedBytes int64, fileCount int64, operation string) error
 	CheckQuota(ctx context.Context, userID string, fileSizeBytes int64) (bool, string, int64, error)
 }
 
+// staleUploadGrace is how long after its upload URL expires an upload that never
+// completed is marked failed
+const staleUploadGrace = 5 * time.Minute
+
+// UserResolver looks up the accounts behind share recipients' email addresses
+type UserResolver interface {
+	ResolveEmails(ctx context.Context, emails []string) (map[string]string, error)
+}
+
 type FileHandler struct {
 	filev1.UnimplementedFileServiceServer
 	fileRepo       *repository.FileRepository
 	storageRepo    *repository.StorageRepository
 	storage        *storage.MinioStorage
-	producer       *kafka.Producer
+	outbox         *repository.OutboxRepository
+	downloadGrants *repository.DownloadGrantRepository
+	deletions      *service.DeletionSagaService
+	shareClaims    *service.ShareClaimService
 	config         *config.Config
 	logger         *logrus.Logger
-	kafkaBreaker   *gobreaker.CircuitBreaker
 	minioBreaker   *gobreaker.CircuitBreaker
 	uploadLimiters map[string]*rate.Limiter
 	limiterMu      sync.RWMutex
 	cache          *cache.RedisCache
 	billingClient  BillingClient
+	userResolver   UserResolver
+	// cleanups tracks the stale upload cleanups, which return when stopping is closed
+	cleanups sync.WaitGroup
+	stopping chan struct{}
 }
 
 func NewFileHandler(
 	fileRepo *repository.FileRepository,
 	storageRepo *repository.StorageRepository,
 	storage *storage.MinioStorage,
-	producer *kafka.Producer,
+	outbox *repository.OutboxRepository,
+	downloadGrants *repository.DownloadGrantRepository,
+	deletions *service.DeletionSagaService,
 	cfg *config.Config,
 	logger *logrus.Logger,
 	redisCache *cache.RedisCache,
 	billingClient BillingClient,
+	userResolver UserResolver,
 ) *FileHandler {
 	return &FileHandler{
-		fileRepo:    fileRepo,
-		storageRepo: storageRepo,
-		storage:     storage,
-		producer:    producer,
-		config:      cfg,
-		logger:      logger,
-		kafkaBreaker: gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:        "kafka",
-			MaxRequests: cfg.CircuitBreakerMaxReq,
-			Interval:    time.Minute,
-			Timeout:     cfg.CircuitBreakerTimeout,
-			ReadyToTrip: func(counts gobreaker.Counts) bool {
-				failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
-				return counts.Requests >= 3 && failureRatio >= 0.6
-			},
-			OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-				logger.WithFields(logrus.Fields{
-					"circuit_breaker": name,
-					"from_state":      from.String(),
-					"to_state":        to.String(),
-				}).Warn("Circuit breaker state changed")
-			},
-		}),
+		fileRepo:       fileRepo,
+		storageRepo:    storageRepo,
+		storage:        storage,
+		outbox:         outbox,
+		downloadGrants: downloadGrants,
+		deletions:      deletions,
+		shareClaims:    service.NewShareClaimService(fileRepo, outbox, logger),
+		config:         cfg,
+		logger:         logger,
 		minioBreaker: gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:        "minio",
 			MaxRequests: cfg.CircuitBreakerMaxReq,
@@ -102,6 +111,47 @@ func NewFileHandler(
 		uploadLimiters: make(map[string]*rate.Limiter),
 		cache:          redisCache,
 		billingClient:  billingClient,
+		userResolver:   userResolver,
+		stopping:       make(chan struct{}),
+	}
+}
+
+// ResumeStaleUploadCleanups schedules the cleanup of the uploads in progress, whose
+// cleanups were dropped when the service last stopped
+func (h *FileHandler) ResumeStaleUploadCleanups(ctx context.Context) error {
+	files, err := h.fileRepo.FindByStatus(ctx, models.FileStatusUploading)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		expiresAt := file.CreatedAt.Add(h.config.PresignedURLExpiry)
+		if value, ok := file.Metadata["upload_url_expires_at"]; ok {
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				expiresAt = t
+			}
+		}
+		h.scheduleStaleUploadCleanup(file.ID.Hex(), max(time.Until(expiresAt.Add(staleUploadGrace)), 0))
+	}
+	return nil
+}
+
+// Drain stops the pending stale upload cleanups, which are resumed after a restart, and
+// waits for those in progress to finish. Call it once no more uploads can start.
+func (h *FileHandler) Drain(ctx context.Context) error {
+	close(h.stopping)
+
+	done := make(chan struct{})
+	go func() {
+		h.cleanups.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -125,8 +175,50 @@ func (h *FileHandler) getUserIDFromContext(ctx context.Context) (string, error)
 	return userID, nil
 }
 
+// isEmailVerified reports whether the caller's forwarded access token belongs to a verified
+// account. Calls without a user token are only unrestricted when they are authenticated
+// with a service token; any other call without one counts as unverified.
+func (h *FileHandler) isEmailVerified(ctx context.Context) (bool, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens := md.Get("authorization")
+	if len(tokens) == 0 || tokens[0] == "" {
+		_, isService := serviceauth.CallerFromContext(ctx)
+		return isService, nil
+	}
+
+	claims, err := jwtauth.NewValidator(h.config.JWTSecret).ValidateToken(tokens[0])
+	if err != nil {
+		return false, status.Error(codes.Unauthenticated, "invalid access token")
+	}
+
+	return claims.IsEmailVerified(), nil
+}
+
+// checkUnverifiedLimits enforces the reduced upload limits of accounts that have not
+// verified their email
+func (h *FileHandler) checkUnverifiedLimits(ctx context.Context, userID string, fileSize int64) error {
+	if fileSize > h.config.UnverifiedMaxFileSize {
+		return status.Errorf(codes.FailedPrecondition, "verify your email address to upload files larger than %d bytes", h.config.UnverifiedMaxFileSize)
+	}
+
+	stats, err := h.storageRepo.GetUsage(ctx, userID, h.fileRepo)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get storage usage for unverified account")
+		return status.Error(codes.Internal, "unable to process request")
+	}
+
+	if stats.UsedBytes+fileSize > h.config.UnverifiedStorageQuota {
+		return status.Errorf(codes.FailedPrecondition, "verify your email address to store more than %d bytes", h.config.UnverifiedStorageQuota)
+	}
+
+	return nil
+}
+
 // getRequestID extracts or generates request ID for tracing
 func (h *FileHandler) getRequestID(ctx context.Context) string {
+	if requestID := grpcmw.RequestIDFromContext(ctx); requestID != "" {
+		return requestID
+	}
 	md, ok := metadata.FromIncomingContext(ctx)
 	if ok {
 		if reqIDs := md.Get("request_id"); len(reqIDs) > 0 {
@@ -205,6 +297,19 @@ func (h *FileHandler) UploadFile(ctx context.Context, req *filev1.UploadFileRequ
 		return nil, status.Errorf(codes.InvalidArgument, "file size must be between %d bytes and %d bytes", h.config.MinFileSize, h.config.MaxFileSize)
 	}
 
+	// Unverified accounts get reduced upload limits
+	verified, err := h.isEmailVerified(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read email verification state")
+		return nil, err
+	}
+	if !verified {
+		if err := h.checkUnverifiedLimits(ctx, userID, req.Size); err != nil {
+			logger.WithError(err).Warn("Upload blocked for unverified account")
+			return nil, err
+		}
+	}
+
 	// TODO: Re-enable storage quota checking after billing integration is restored
 
 	// Validate MIME type
@@ -266,7 +371,7 @@ func (h *FileHandler) UploadFile(ctx context.Context, req *filev1.UploadFileRequ
 	}
 
 	// Start goroutine to cleanup stale uploads
-	go h.cleanupStaleUpload(file.ID.Hex(), h.config.PresignedURLExpiry+5*time.Minute)
+	h.scheduleStaleUploadCleanup(file.ID.Hex(), h.config.PresignedURLExpiry+staleUploadGrace)
 
 	logger.Info("File upload initiated successfully")
 
@@ -349,51 +454,15 @@ func (h *FileHandler) CompleteUpload(ctx context.Context, req *filev1.CompleteUp
 		file.ContentHash = req.Checksum
 	}
 
-	if err := h.fileRepo.Update(ctx, file); err != nil {
-		logger.WithError(err).Error("Failed to update file status")
-		return nil, status.Error(codes.Internal, "unable to process request")
-	}
-
-	// Update storage usage in local storage repository
-	if err := h.storageRepo.AddUsage(ctx, userID, file.Size); err != nil {
-		logger.WithError(err).Warn("Failed to update local storage usage")
-		// Don't fail the request if storage update fails
-	} else {
-		logger.WithFields(logrus.Fields{
-			"user_id":   userID,
-			"file_size": file.Size,
-		}).Info("Storage usage updated successfully")
-	}
-
-	// Also update billing service if available
-	if h.billingClient != nil {
-		err = h.billingClient.UpdateUsage(ctx, userID, file.Size, 1, "ADD")
-		if err != nil {
-			logger.WithError(err).Warn("Failed to update billing service usage")
-			// Don't fail the request if billing update fails
-		}
-	}
-
-	// Publish file uploaded event with circuit breaker
+	// Record the upload and version events with the status change, for the outbox relay
+	// to publish
 	uploadEvent := kafka.NewFileUploadedEvent(
 		file.ID.Hex(),
 		file.OwnerID,
 		file.Name,
 		file.MimeType,
 		file.Size,
-		"{}", // Empty metadata for now
 	)
-
-	_, err = h.kafkaBreaker.Execute(func() (interface{}, error) {
-		return nil, h.producer.PublishFileUploadedEvent(ctx, uploadEvent)
-	})
-
-	if err != nil {
-		logger.WithError(err).Warn("Failed to publish file upload event (circuit breaker may be open)")
-		// Don't fail the request if event publishing fails
-	}
-
-	// Also publish file version event for version tracking
 	versionEvent := kafka.NewFileVersionedEvent(
 		file.ID.Hex(),
 		file.OwnerID,
@@ -401,18 +470,38 @@ func (h *FileHandler) CompleteUpload(ctx context.Context, req *filev1.CompleteUp
 		file.MimeType,
 		file.StoragePath,
 		file.Checksum,
-		"{}", // Empty metadata for now
 		file.Size,
 		1, // First version
 	)
+	uploadEvent.TenantID = file.TenantID
+	versionEvent.TenantID = file.TenantID
 
-	_, err = h.kafkaBreaker.Execute(func() (interface{}, error) {
-		return nil, h.producer.PublishFileVersionedEvent(ctx, versionEvent)
+	err = h.outbox.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := h.fileRepo.Update(ctx, file); err != nil {
+			return err
+		}
+		if err := h.outbox.Enqueue(ctx, uploadEvent); err != nil {
+			return fmt.Errorf("failed to record file upload event: %w", err)
+		}
+		if err := h.outbox.Enqueue(ctx, versionEvent); err != nil {
+			return fmt.Errorf("failed to record file version event: %w", err)
+		}
+		return nil
 	})
-
 	if err != nil {
-		logger.WithError(err).Warn("Failed to publish file version event (circuit breaker may be open)")
-		// Don't fail the request if event publishing fails
+		logger.WithError(err).Error("Failed to update file status")
+		return nil, status.Error(codes.Internal, "unable to process request")
+	}
+
+	// Update storage usage in local storage repository
+	if err := h.storageRepo.AddUsage(ctx, userID, file.Size); err != nil {
+		logger.WithError(err).Warn("Failed to update local storage usage")
+		// Don't fail the request if storage update fails
+	} else {
+		logger.WithFields(logrus.Fields{
+			"user_id":   userID,
+			"file_size": file.Size,
+		}).Info("Storage usage updated successfully")
 	}
 
 	logger.Info("File upload completed successfully")
@@ -508,9 +597,10 @@ func (h *FileHandler) ListFiles(ctx context.Context, req *filev1.ListFilesReques
 		return nil, status.Error(codes.Internal, "unable to process request")
 	}
 
-	protoFiles := make([]*filev1.File, 0, len(files))
-	for _, file := range files {
-		protoFiles = append(protoFiles, h.modelToProto(file))
+	protoFiles, err := h.listedFiles(ctx, userID, files)
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up favorite files")
+		return nil, status.Error(codes.Internal, "unable to process request")
 	}
 
 	logger.WithFields(logrus.Fields{
@@ -574,41 +664,66 @@ func (h *FileHandler) GetDownloadURL(ctx context.Context, req *filev1.GetDownloa
 		}
 	}
 
-	// Generate download URL with circuit breaker
+	// Every download URL issued is recorded, with who it was issued to and until when it works
+	now := time.Now()
+	grant := &models.DownloadGrant{
+		FileID:    file.ID.Hex(),
+		OwnerID:   file.OwnerID,
+		UserID:    userID,
+		TenantID:  file.TenantID,
+		RequestID: requestID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(h.config.PresignedURLExpiry),
+	}
+
 	var downloadURL string
-	_, err = h.minioBreaker.Execute(func() (interface{}, error) {
-		var urlErr error
-		downloadURL, urlErr = h.storage.GeneratePresignedDownloadURL(ctx, file.StoragePath, h.config.PresignedURLExpiry)
-		return downloadURL, urlErr
-	})
+	if req.SingleUse {
+		// The presigned URL is only generated when the link is redeemed
+		token, err := h.downloadGrants.CreateSingleUse(ctx, grant)
+		if err != nil {
+			logger.WithError(err).Error("Failed to record single-use download link")
+			return nil, status.Error(codes.Internal, "unable to generate download URL")
+		}
+		downloadURL = "/api/v1/downloads/" + token
+	} else {
+		// Generate download URL with circuit breaker
+		_, err = h.minioBreaker.Execute(func() (interface{}, error) {
+			var urlErr error
+			downloadURL, urlErr = h.storage.GeneratePresignedDownloadURL(ctx, file.StoragePath, h.config.PresignedURLExpiry)
+			return downloadURL, urlErr
+		})
 
-	if err != nil {
-		logger.WithError(err).Error("Failed to generate download URL")
-		return nil, status.Error(codes.Internal, "unable to generate download URL")
+		if err != nil {
+			logger.WithError(err).Error("Failed to generate download URL")
+			return nil, status.Error(codes.Internal, "unable to generate download URL")
+		}
+
+		if err := h.downloadGrants.Create(ctx, grant); err != nil {
+			logger.WithError(err).Error("Failed to record download URL")
+			return nil, status.Error(codes.Internal, "unable to generate download URL")
+		}
 	}
 
-	// Publish file download event
+	// Record file download event
 	downloadEvent := kafka.NewFileDownloadedEvent(
 		file.ID.Hex(),
 		userID,
+		file.OwnerID,
 		file.Name,
-		"{}", // Empty metadata for now
 	)
+	downloadEvent.TenantID = file.TenantID
 
-	_, err = h.kafkaBreaker.Execute(func() (interface{}, error) {
-		return nil, h.producer.PublishFileDownloadedEvent(ctx, downloadEvent)
-	})
-
-	if err != nil {
-		logger.WithError(err).Warn("Failed to publish file download event")
-		// Don't fail the request if event publishing fails
+	if err := h.outbox.Enqueue(ctx, downloadEvent); err != nil {
+		logger.WithError(err).Warn("Failed to record file download event")
+		// Don't fail the request if event recording fails
 	}
 
-	logger.Info("Download URL generated successfully")
+	logger.WithField("single_use", req.SingleUse).Info("Download URL generated successfully")
 
 	return &filev1.GetDownloadURLResponse{
 		DownloadUrl: downloadURL,
 		ExpiresIn:   int64(h.config.PresignedURLExpiry.Seconds()),
+		SingleUse:   req.SingleUse,
 	}, nil
 }
 
@@ -651,49 +766,36 @@ func (h *FileHandler) DeleteFile(ctx context.Context, req *filev1.DeleteFileRequ
 		return nil, status.Error(codes.PermissionDenied, "access denied")
 	}
 
-	// Permanently delete from database (no trash functionality)
-	if err := h.fileRepo.PermanentDeleteDirect(ctx, req.FileId); err != nil {
-		logger.WithError(err).Error("Failed to permanently delete file")
+	// Permanently delete the file (no trash functionality). The record, storage usage,
+	// deleted event and object are handled by the deletion saga, which finishes the
+	// deletion in the background if a step fails.
+	saga, err := h.deletions.Delete(ctx, file)
+	if err != nil {
+		if errors.Is(err, repository.ErrDeletionInProgress) {
+			return &filev1.DeleteFileResponse{
+				Message: "File is being deleted",
+			}, nil
+		}
+		logger.WithError(err).Error("Failed to start file deletion")
 		return nil, status.Error(codes.Internal, "unable to delete file")
 	}
 
-	// Decrease storage usage
-	if err := h.storageRepo.RemoveUsage(ctx, userID, file.Size); err != nil {
-		logger.WithError(err).Warn("Failed to update storage usage")
-	}
-
-	logger.WithFields(logrus.Fields{
-		"file_id":   req.FileId,
-		"user_id":   userID,
-		"file_size": file.Size,
-	}).Info("File permanently deleted - storage usage decreased")
-
-	// Delete from MinIO storage
-	_, err = h.minioBreaker.Execute(func() (interface{}, error) {
-		return nil, h.storage.DeleteFile(ctx, file.StoragePath)
-	})
-	if err != nil {
-		logger.WithError(err).Warn("Failed to delete file from storage")
-		// Don't fail the request if storage deletion fails
+	if saga.Status == models.DeletionStatusCompensated {
+		logger.WithField("saga_id", saga.ID.Hex()).Error("File deletion failed and was undone")
+		return nil, status.Error(codes.Internal, "unable to delete file")
 	}
-
-	// Publish file deleted event
-	deleteEvent := kafka.NewFileDeletedEvent(
-		file.ID.Hex(),
-		file.OwnerID,
-		file.Name,
-		"{}", // Empty metadata for now
-	)
-
-	_, err = h.kafkaBreaker.Execute(func() (interface{}, error) {
-		return nil, h.producer.PublishFileDeletedEvent(ctx, deleteEvent)
-	})
-
-	if err != nil {
-		logger.WithError(err).Warn("Failed to publish file deletion event")
+	if saga.Status != models.DeletionStatusCompleted {
+		logger.WithFields(logrus.Fields{
+			"saga_id":    saga.ID.Hex(),
+			"status":     saga.Status,
+			"last_error": saga.LastError,
+		}).Warn("File deletion will be finished in the background")
+		return &filev1.DeleteFileResponse{
+			Message: "File is being deleted",
+		}, nil
 	}
 
-	logger.Info("File permanently deleted successfully")
+	logger.WithField("file_size", file.Size).Info("File permanently deleted successfully")
 
 	return &filev1.DeleteFileResponse{
 		Message: "File permanently deleted",
@@ -724,6 +826,17 @@ func (h *FileHandler) ShareFile(ctx context.Context, req *filev1.ShareFileReques
 		return nil, status.Error(codes.InvalidArgument, "file_id is required")
 	}
 
+	// Unverified accounts cannot share files
+	verified, err := h.isEmailVerified(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read email verification state")
+		return nil, err
+	}
+	if !verified {
+		logger.Warn("Share blocked for unverified account")
+		return nil, status.Error(codes.FailedPrecondition, "verify your email address to share files")
+	}
+
 	// Allow sharing with no emails (link-only sharing)
 	if len(req.SharedWithEmails) == 0 && req.ExpiryTime == "" {
 		return nil, status.Error(codes.InvalidArgument, "either shared_with_emails or expiry_time must be provided")
@@ -805,6 +918,8 @@ func (h *FileHandler) ShareFile(ctx context.Context, req *filev1.ShareFileReques
 		})
 		shareLinkGenerated = true
 	} else {
+		recipientIDs := h.resolveRecipients(ctx, logger, req.SharedWithEmails)
+
 		// Create shares for each email
 		for _, email := range req.SharedWithEmails {
 			// Validate email
@@ -813,9 +928,16 @@ func (h *FileHandler) ShareFile(ctx context.Context, req *filev1.ShareFileReques
 				continue
 			}
 
+			recipientID := recipientIDs[strings.ToLower(email)]
+			if recipientID == userID {
+				logger.Warn("Skipping share with the file owner")
+				continue
+			}
+
 			share := &models.FileShare{
 				FileID:          req.FileId,
 				OwnerID:         userID,
+				SharedWithID:    recipientID,
 				SharedWithEmail: email,
 				Permission:      models.Permission(req.Permission.String()),
 				ExpiryTime:      expiryTime,
@@ -825,7 +947,20 @@ func (h *FileHandler) ShareFile(ctx context.Context, req *filev1.ShareFileReques
 				UpdatedAt:       time.Now(),
 			}
 
-			if err := h.fileRepo.CreateShare(ctx, share); err != nil {
+			// Record the file shared event with the share
+			event := kafka.NewFileSharedEvent(file.ID.Hex(), file.OwnerID, file.Name, email, recipientID, req.Permission.String())
+			event.TenantID = file.TenantID
+
+			err := h.outbox.RunInTransaction(ctx, func(ctx context.Context) error {
+				if err := h.fileRepo.CreateShare(ctx, share); err != nil {
+					return err
+				}
+				if err := h.outbox.Enqueue(ctx, event); err != nil {
+					return fmt.Errorf("failed to record file shared event: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
 				logger.WithError(err).WithField("email", email).Error("Failed to create share")
 				continue
 			}
@@ -839,6 +974,7 @@ func (h *FileHandler) ShareFile(ctx context.Context, req *filev1.ShareFileReques
 				ShareId:         share.ID.Hex(),
 				FileId:          share.FileID,
 				OwnerId:         share.OwnerID,
+				SharedWithId:    share.SharedWithID,
 				SharedWithEmail: share.SharedWithEmail,
 				Permission:      req.Permission,
 				ExpiryTime:      expiryTimestamp,
@@ -847,24 +983,6 @@ func (h *FileHandler) ShareFile(ctx context.Context, req *filev1.ShareFileReques
 				CreatedAt:       timestamppb.New(share.CreatedAt),
 				UpdatedAt:       timestamppb.New(share.UpdatedAt),
 			})
-
-			// Publish file shared event
-			event := kafka.FileEvent{
-				Type:      kafka.EventFileShared,
-				FileID:    file.ID.Hex(),
-				FileName:  file.Name,
-				OwnerID:   file.OwnerID,
-				Metadata:  map[string]string{"shared_with": email, "permission": req.Permission.String()},
-				Timestamp: time.Now().Format(time.RFC3339),
-			}
-
-			_, err := h.kafkaBreaker.Execute(func() (interface{}, error) {
-				return nil, h.producer.PublishFileEvent(ctx, event)
-			})
-
-			if err != nil {
-				logger.WithError(err).Warn("Failed to publish Kafka event")
-			}
 		}
 		shareLinkGenerated = true
 	}
@@ -886,6 +1004,21 @@ func (h *FileHandler) ShareFile(ctx context.Context, req *filev1.ShareFileReques
 	return response, nil
 }
 
+// resolveRecipients maps the lowercased share emails of registered users to their user
+// IDs. A failed lookup is not fatal: the shares are still created by email only.
+func (h *FileHandler) resolveRecipients(ctx context.Context, logger *logrus.Entry, emails []string) map[string]string {
+	if h.userResolver == nil {
+		return nil
+	}
+
+	recipientIDs, err := h.userResolver.ResolveEmails(ctx, emails)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to resolve share recipients")
+		return nil
+	}
+	return recipientIDs
+}
+
 func (h *FileHandler) UnshareFile(ctx context.Context, req *filev1.UnshareFileRequest) (*filev1.UnshareFileResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, h.config.OperationTimeout)
 	defer cancel()
@@ -969,9 +1102,10 @@ func (h *FileHandler) ListSharedFiles(ctx context.Context, req *filev1.ListShare
 		return nil, status.Error(codes.Internal, "unable to process request")
 	}
 
-	protoFiles := make([]*filev1.File, 0, len(files))
-	for _, file := range files {
-		protoFiles = append(protoFiles, h.modelToProto(file))
+	protoFiles, err := h.listedFiles(ctx, userID, files)
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up favorite files")
+		return nil, status.Error(codes.Internal, "unable to process request")
 	}
 
 	logger.WithFields(logrus.Fields{
@@ -1076,11 +1210,11 @@ func (h *FileHandler) GetStorageUsage(ctx context.Context, req *filev1.GetStorag
 
 	logger = logger.WithField("user_id", userID)
 
-	// Get or calculate storage usage
-	stats, err := h.storageRepo.CalculateUsageFromFiles(ctx, userID, h.fileRepo)
+	// Get storage usage, kept up to date as files are uploaded and deleted
+	stats, err := h.storageRepo.GetUsage(ctx, userID, h.fileRepo)
 	if err != nil {
-		logger.WithError(err).Error("Failed to calculate storage usage")
-		return nil, status.Error(codes.Internal, "unable to calculate storage usage")
+		logger.WithError(err).Error("Failed to get storage usage")
+		return nil, status.Error(codes.Internal, "unable to get storage usage")
 	}
 
 	logger.WithFields(logrus.Fields{
@@ -1115,10 +1249,10 @@ func (h *FileHandler) checkStorageQuota(ctx context.Context, userID string, file
 		}
 	}
 
-	// Fallback to local storage calculation
-	stats, err := h.storageRepo.CalculateUsageFromFiles(ctx, userID, h.fileRepo)
+	// Fallback to local storage usage
+	stats, err := h.storageRepo.GetUsage(ctx, userID, h.fileRepo)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to calculate storage usage for quota check")
+		h.logger.WithError(err).Error("Failed to get storage usage for quota check")
 		return fmt.Errorf("unable to check storage quota")
 	}
 
@@ -1132,8 +1266,22 @@ func (h *FileHandler) checkStorageQuota(ctx context.Context, userID string, file
 }
 
 // cleanupStaleUpload marks files as error if upload not completed in time
+// scheduleStaleUploadCleanup marks an upload failed if it hasn't completed after timeout
+func (h *FileHandler) scheduleStaleUploadCleanup(fileID string, timeout time.Duration) {
+	h.cleanups.Add(1)
+	go h.cleanupStaleUpload(fileID, timeout)
+}
+
 func (h *FileHandler) cleanupStaleUpload(fileID string, timeout time.Duration) {
-	time.Sleep(timeout)
+	defer h.cleanups.Done()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-h.stopping:
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -1300,6 +1448,26 @@ func (h *FileHandler) RemoveFromFavorites(ctx context.Context, req *filev1.Favor
 	}, nil
 }
 
+// listedFiles converts a page of listed files, marking those in userID's favorites
+func (h *FileHandler) listedFiles(ctx context.Context, userID string, files []*models.File) ([]*filev1.File, error) {
+	fileIDs := make([]string, len(files))
+	for i, file := range files {
+		fileIDs[i] = file.ID.Hex()
+	}
+	favorites, err := h.fileRepo.FavoriteFileIDs(ctx, userID, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	protoFiles := make([]*filev1.File, 0, len(files))
+	for _, file := range files {
+		protoFile := h.modelToProto(file)
+		protoFile.IsFavorite = favorites[protoFile.FileId]
+		protoFiles = append(protoFiles, protoFile)
+	}
+	return protoFiles, nil
+}
+
 // ListFavorites lists user's favorite files
 func (h *FileHandler) ListFavorites(ctx context.Context, req *filev1.ListFavoritesRequest) (*filev1.ListFilesResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, h.config.QueryTimeout)
@@ -1334,7 +1502,9 @@ func (h *FileHandler) ListFavorites(ctx context.Context, req *filev1.ListFavorit
 
 	protoFiles := make([]*filev1.File, 0, len(files))
 	for _, file := range files {
-		protoFiles = append(protoFiles, h.modelToProto(file))
+		protoFile := h.modelToProto(file)
+		protoFile.IsFavorite = true
+		protoFiles = append(protoFiles, protoFile)
 	}
 
 	logger.WithFields(logrus.Fields{
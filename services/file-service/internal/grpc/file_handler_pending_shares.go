@@ -0,0 +1,45 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/validation"
+	filev1 "github.com/yourusername/distributed-file-sharing/services/file-service/pkg/pb/file/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClaimPendingShares links the shares made to an invited email address to the account
+// created for it. The auth-service calls this once the invitee proved they own the
+// address, so the shared files show up as soon as they sign in. The invitee is notified
+// of each file shared with them.
+func (h *FileHandler) ClaimPendingShares(ctx context.Context, req *filev1.ClaimPendingSharesRequest) (*filev1.ClaimPendingSharesResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.config.QueryTimeout)
+	defer cancel()
+
+	requestID := h.getRequestID(ctx)
+	logger := h.logger.WithFields(logrus.Fields{
+		"request_id": requestID,
+		"method":     "ClaimPendingShares",
+		"user_id":    req.UserId,
+	})
+
+	if _, err := primitive.ObjectIDFromHex(req.UserId); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if err := validation.ValidateEmail(req.Email); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid email")
+	}
+
+	linked, err := h.shareClaims.ClaimPendingShares(ctx, req.UserId, req.Email)
+	if err != nil {
+		logger.WithError(err).Error("Failed to claim pending shares")
+		return nil, status.Error(codes.Internal, "unable to process request")
+	}
+
+	return &filev1.ClaimPendingSharesResponse{
+		LinkedCount: int32(linked),
+	}, nil
+}
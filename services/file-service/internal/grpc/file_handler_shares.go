@@ -0,0 +1,310 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/validation"
+	filev1 "github.com/yourusername/distributed-file-sharing/services/file-service/pkg/pb/file/v1"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Bounds of the passwords of link shares; bcrypt ignores everything past 72 bytes
+const (
+	minSharePasswordLength = 6
+	maxSharePasswordLength = 72
+)
+
+// ListShares lists the shares of one of the caller's files, or of all of them, newest
+// first. Link shares and deactivated shares are included.
+func (h *FileHandler) ListShares(ctx context.Context, req *filev1.ListSharesRequest) (*filev1.ListSharesResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.config.QueryTimeout)
+	defer cancel()
+
+	requestID := h.getRequestID(ctx)
+	logger := h.logger.WithFields(logrus.Fields{
+		"request_id": requestID,
+		"method":     "ListShares",
+		"file_id":    req.FileId,
+	})
+
+	// Get authenticated user ID
+	userID, err := h.getUserIDFromContext(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Authentication failed")
+		return nil, err
+	}
+
+	logger = logger.WithField("user_id", userID)
+
+	// Validate pagination
+	page, limit, err := validation.ValidatePagination(req.Page, req.Limit, h.config.MaxPageSize)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if req.FileId != "" {
+		if _, err := h.ownedFile(ctx, logger, req.FileId, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	shares, total, err := h.fileRepo.FindSharesByOwner(ctx, userID, req.FileId, page, limit)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list shares")
+		return nil, status.Error(codes.Internal, "unable to process request")
+	}
+
+	protoShares := make([]*filev1.FileShare, 0, len(shares))
+	for _, share := range shares {
+		protoShares = append(protoShares, shareToProto(share))
+	}
+
+	logger.WithFields(logrus.Fields{
+		"count": len(shares),
+		"total": total,
+		"page":  page,
+	}).Info("Shares listed successfully")
+
+	return &filev1.ListSharesResponse{
+		Shares: protoShares,
+		Total:  total,
+		Page:   page,
+		Limit:  limit,
+	}, nil
+}
+
+// UpdateShare changes the permission, expiry or password of a share of the caller's file
+func (h *FileHandler) UpdateShare(ctx context.Context, req *filev1.UpdateShareRequest) (*filev1.UpdateShareResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.config.OperationTimeout)
+	defer cancel()
+
+	requestID := h.getRequestID(ctx)
+	logger := h.logger.WithFields(logrus.Fields{
+		"request_id": requestID,
+		"method":     "UpdateShare",
+		"file_id":    req.FileId,
+		"share_id":   req.ShareId,
+	})
+
+	// Get authenticated user ID
+	userID, err := h.getUserIDFromContext(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Authentication failed")
+		return nil, err
+	}
+
+	logger = logger.WithField("user_id", userID)
+
+	if req.Permission == filev1.Permission_PERMISSION_UNSPECIFIED && req.ExpiryTime == "" && !req.ClearExpiry &&
+		req.Password == "" && !req.ClearPassword {
+		return nil, status.Error(codes.InvalidArgument, "nothing to update")
+	}
+
+	file, share, err := h.ownedShare(ctx, logger, req.FileId, req.ShareId, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Permission != filev1.Permission_PERMISSION_UNSPECIFIED {
+		share.Permission = models.Permission(req.Permission.String())
+	}
+
+	if req.ClearExpiry {
+		share.ExpiryTime = nil
+	} else if req.ExpiryTime != "" {
+		expiryTime, err := time.Parse(time.RFC3339, req.ExpiryTime)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid expiry_time format, expected RFC3339")
+		}
+		if !expiryTime.After(time.Now()) {
+			return nil, status.Error(codes.InvalidArgument, "expiry_time must be in the future")
+		}
+		share.ExpiryTime = &expiryTime
+	}
+
+	if req.ClearPassword {
+		share.PasswordHash = ""
+	} else if req.Password != "" {
+		if share.SharedWithID != "" || share.SharedWithEmail != "" {
+			return nil, status.Error(codes.InvalidArgument, "only link shares can have a password")
+		}
+		if len(req.Password) < minSharePasswordLength || len(req.Password) > maxSharePasswordLength {
+			return nil, status.Errorf(codes.InvalidArgument, "password must be %d to %d characters long", minSharePasswordLength, maxSharePasswordLength)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			logger.WithError(err).Error("Failed to hash share password")
+			return nil, status.Error(codes.Internal, "unable to process request")
+		}
+		share.PasswordHash = string(hash)
+	}
+
+	if err := h.saveShare(ctx, logger, file, share); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Share updated successfully")
+
+	return &filev1.UpdateShareResponse{
+		Share:   shareToProto(share),
+		Message: "Share updated successfully",
+	}, nil
+}
+
+// DeactivateShare suspends a share of the caller's file: it no longer grants access, and
+// the file leaves the recipient's shared files until it is reactivated
+func (h *FileHandler) DeactivateShare(ctx context.Context, req *filev1.ShareStateRequest) (*filev1.UpdateShareResponse, error) {
+	return h.setShareActive(ctx, req, false)
+}
+
+// ReactivateShare resumes a deactivated share of the caller's file
+func (h *FileHandler) ReactivateShare(ctx context.Context, req *filev1.ShareStateRequest) (*filev1.UpdateShareResponse, error) {
+	return h.setShareActive(ctx, req, true)
+}
+
+func (h *FileHandler) setShareActive(ctx context.Context, req *filev1.ShareStateRequest, active bool) (*filev1.UpdateShareResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.config.OperationTimeout)
+	defer cancel()
+
+	method := "DeactivateShare"
+	if active {
+		method = "ReactivateShare"
+	}
+
+	requestID := h.getRequestID(ctx)
+	logger := h.logger.WithFields(logrus.Fields{
+		"request_id": requestID,
+		"method":     method,
+		"file_id":    req.FileId,
+		"share_id":   req.ShareId,
+	})
+
+	// Get authenticated user ID
+	userID, err := h.getUserIDFromContext(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Authentication failed")
+		return nil, err
+	}
+
+	logger = logger.WithField("user_id", userID)
+
+	file, share, err := h.ownedShare(ctx, logger, req.FileId, req.ShareId, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "Share deactivated"
+	if active {
+		message = "Share reactivated"
+	}
+
+	if share.IsActive != active {
+		share.IsActive = active
+		if err := h.saveShare(ctx, logger, file, share); err != nil {
+			return nil, err
+		}
+		logger.Info(message)
+	}
+
+	return &filev1.UpdateShareResponse{
+		Share:   shareToProto(share),
+		Message: message,
+	}, nil
+}
+
+// ownedFile returns the file with ID fileID if userID owns it
+func (h *FileHandler) ownedFile(ctx context.Context, logger *logrus.Entry, fileID, userID string) (*models.File, error) {
+	file, err := h.fileRepo.FindByID(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, repository.ErrFileNotFound) {
+			return nil, status.Error(codes.NotFound, "file not found")
+		}
+		logger.WithError(err).Error("Failed to find file")
+		return nil, status.Error(codes.Internal, "unable to process request")
+	}
+
+	if file.OwnerID != userID {
+		logger.Warn("Unauthorized share management attempt")
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+	return file, nil
+}
+
+// ownedShare returns the share with ID shareID of the file with ID fileID, if userID
+// owns the file
+func (h *FileHandler) ownedShare(ctx context.Context, logger *logrus.Entry, fileID, shareID, userID string) (*models.File, *models.FileShare, error) {
+	if fileID == "" || shareID == "" {
+		return nil, nil, status.Error(codes.InvalidArgument, "file_id and share_id are required")
+	}
+
+	file, err := h.ownedFile(ctx, logger, fileID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	share, err := h.fileRepo.FindShareByID(ctx, shareID)
+	if err != nil {
+		if errors.Is(err, repository.ErrShareNotFound) {
+			return nil, nil, status.Error(codes.NotFound, "share not found")
+		}
+		logger.WithError(err).Error("Failed to find share")
+		return nil, nil, status.Error(codes.Internal, "unable to process request")
+	}
+	if share.FileID != fileID {
+		return nil, nil, status.Error(codes.NotFound, "share not found")
+	}
+	return file, share, nil
+}
+
+// saveShare saves a changed share, dropping the cached download URLs of its file that
+// may have been issued under the previous terms
+func (h *FileHandler) saveShare(ctx context.Context, logger *logrus.Entry, file *models.File, share *models.FileShare) error {
+	if err := h.fileRepo.UpdateShare(ctx, share); err != nil {
+		if errors.Is(err, repository.ErrShareNotFound) {
+			return status.Error(codes.NotFound, "share not found")
+		}
+		logger.WithError(err).Error("Failed to update share")
+		return status.Error(codes.Internal, "unable to process request")
+	}
+
+	h.invalidateFileCache(ctx, file.ID.Hex(), file.OwnerID)
+	return nil
+}
+
+// shareToProto converts a share. Permissions are stored as the enum names ShareFile
+// receives, or as models.Permission values.
+func shareToProto(share *models.FileShare) *filev1.FileShare {
+	permission, ok := filev1.Permission_value[string(share.Permission)]
+	if !ok {
+		permission = filev1.Permission_value["PERMISSION_"+strings.ToUpper(string(share.Permission))]
+	}
+
+	var expiryTimestamp *timestamppb.Timestamp
+	if share.ExpiryTime != nil {
+		expiryTimestamp = timestamppb.New(*share.ExpiryTime)
+	}
+
+	return &filev1.FileShare{
+		ShareId:         share.ID.Hex(),
+		FileId:          share.FileID,
+		OwnerId:         share.OwnerID,
+		SharedWithId:    share.SharedWithID,
+		SharedWithEmail: share.SharedWithEmail,
+		Permission:      filev1.Permission(permission),
+		ExpiryTime:      expiryTimestamp,
+		ShareLink:       share.ShareLink,
+		IsActive:        share.IsActive,
+		CreatedAt:       timestamppb.New(share.CreatedAt),
+		UpdatedAt:       timestamppb.New(share.UpdatedAt),
+		HasPassword:     share.PasswordHash != "",
+	}
+}
@@ -4,122 +4,70 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
 )
 
-// FileUploadedEvent represents a file upload event for Cassandra integration
-type FileUploadedEvent struct {
-	EventID     string    `json:"event_id"` // UUID for idempotency
-	FileID      string    `json:"file_id"`
-	UserID      string    `json:"user_id"`
-	FileName    string    `json:"file_name"`
-	FileSize    int64     `json:"file_size"`
-	ContentType string    `json:"content_type"`
-	Action      string    `json:"action"` // "upload"
-	Status      string    `json:"status"` // "success"
-	Timestamp   time.Time `json:"timestamp"`
-	Metadata    string    `json:"metadata"` // JSON string
-}
-
-// FileDeletedEvent represents a file deletion event
-type FileDeletedEvent struct {
-	EventID   string    `json:"event_id"`
-	FileID    string    `json:"file_id"`
-	UserID    string    `json:"user_id"`
-	FileName  string    `json:"file_name"`
-	Action    string    `json:"action"` // "delete"
-	Status    string    `json:"status"` // "success"
-	Timestamp time.Time `json:"timestamp"`
-	Metadata  string    `json:"metadata"`
+// newFileEvent creates a successful file event of the current schema
+func newFileEvent(eventType, fileID, userID, ownerID, fileName string) *events.FileEvent {
+	return &events.FileEvent{
+		SchemaVersion: events.SchemaVersion,
+		EventID:       uuid.New().String(),
+		Type:          eventType,
+		FileID:        fileID,
+		FileName:      fileName,
+		UserID:        userID,
+		OwnerID:       ownerID,
+		Success:       true,
+		Timestamp:     time.Now(),
+	}
 }
 
-// FileDownloadedEvent represents a file download event
-type FileDownloadedEvent struct {
-	EventID   string    `json:"event_id"`
-	FileID    string    `json:"file_id"`
-	UserID    string    `json:"user_id"`
-	FileName  string    `json:"file_name"`
-	Action    string    `json:"action"` // "download"
-	Status    string    `json:"status"` // "success"
-	Timestamp time.Time `json:"timestamp"`
-	Metadata  string    `json:"metadata"`
+// NewFileUploadedEvent creates a new file upload event
+func NewFileUploadedEvent(fileID, ownerID, fileName, contentType string, fileSize int64) *events.FileEvent {
+	event := newFileEvent(events.TypeFileUploaded, fileID, ownerID, ownerID, fileName)
+	event.FileSize = fileSize
+	event.ContentType = contentType
+	return event
 }
 
-// FileVersionedEvent represents a file version creation event
-type FileVersionedEvent struct {
-	EventID     string    `json:"event_id"`
-	FileID      string    `json:"file_id"`
-	UserID      string    `json:"user_id"`
-	Version     int       `json:"version"`
-	FileName    string    `json:"file_name"`
-	FileSize    int64     `json:"file_size"`
-	ContentType string    `json:"content_type"`
-	StoragePath string    `json:"storage_path"`
-	Checksum    string    `json:"checksum"`
-	Action      string    `json:"action"` // "version_created"
-	Status      string    `json:"status"` // "success"
-	Timestamp   time.Time `json:"timestamp"`
-	Metadata    string    `json:"metadata"`
+// NewFileDeletedEvent creates a new file deletion event. fileSize is the storage the
+// deletion freed, which the billing-service subtracts from the owner's usage.
+func NewFileDeletedEvent(fileID, ownerID, fileName string, fileSize int64) *events.FileEvent {
+	event := newFileEvent(events.TypeFileDeleted, fileID, ownerID, ownerID, fileName)
+	event.FileSize = fileSize
+	return event
 }
 
-// NewFileUploadedEvent creates a new file upload event
-func NewFileUploadedEvent(fileID, userID, fileName, contentType string, fileSize int64, metadata string) *FileUploadedEvent {
-	return &FileUploadedEvent{
-		EventID:     uuid.New().String(),
-		FileID:      fileID,
-		UserID:      userID,
-		FileName:    fileName,
-		FileSize:    fileSize,
-		ContentType: contentType,
-		Action:      "upload",
-		Status:      "success",
-		Timestamp:   time.Now(),
-		Metadata:    metadata,
-	}
+// NewFileDownloadedEvent creates a new file download event for a download by userID
+func NewFileDownloadedEvent(fileID, userID, ownerID, fileName string) *events.FileEvent {
+	return newFileEvent(events.TypeFileDownloaded, fileID, userID, ownerID, fileName)
 }
 
-// NewFileDeletedEvent creates a new file deletion event
-func NewFileDeletedEvent(fileID, userID, fileName, metadata string) *FileDeletedEvent {
-	return &FileDeletedEvent{
-		EventID:   uuid.New().String(),
-		FileID:    fileID,
-		UserID:    userID,
-		FileName:  fileName,
-		Action:    "delete",
-		Status:    "success",
-		Timestamp: time.Now(),
-		Metadata:  metadata,
-	}
+// NewFileVersionedEvent creates a new file version event
+func NewFileVersionedEvent(fileID, ownerID, fileName, contentType, storagePath, checksum string, fileSize int64, version int) *events.FileEvent {
+	event := newFileEvent(events.TypeFileVersioned, fileID, ownerID, ownerID, fileName)
+	event.Version = version
+	event.FileSize = fileSize
+	event.ContentType = contentType
+	event.StoragePath = storagePath
+	event.Checksum = checksum
+	return event
 }
 
-// NewFileDownloadedEvent creates a new file download event
-func NewFileDownloadedEvent(fileID, userID, fileName, metadata string) *FileDownloadedEvent {
-	return &FileDownloadedEvent{
-		EventID:   uuid.New().String(),
-		FileID:    fileID,
-		UserID:    userID,
-		FileName:  fileName,
-		Action:    "download",
-		Status:    "success",
-		Timestamp: time.Now(),
-		Metadata:  metadata,
-	}
+// NewFileSharedEvent creates a new file share event. sharedWithID is empty if the
+// recipient has no account.
+func NewFileSharedEvent(fileID, ownerID, fileName, sharedWith, sharedWithID, permission string) *events.FileEvent {
+	event := newFileEvent(events.TypeFileShared, fileID, ownerID, ownerID, fileName)
+	event.SharedWith = sharedWith
+	event.SharedWithID = sharedWithID
+	event.Permission = permission
+	return event
 }
 
-// NewFileVersionedEvent creates a new file version event
-func NewFileVersionedEvent(fileID, userID, fileName, contentType, storagePath, checksum, metadata string, fileSize int64, version int) *FileVersionedEvent {
-	return &FileVersionedEvent{
-		EventID:     uuid.New().String(),
-		FileID:      fileID,
-		UserID:      userID,
-		Version:     version,
-		FileName:    fileName,
-		FileSize:    fileSize,
-		ContentType: contentType,
-		StoragePath: storagePath,
-		Checksum:    checksum,
-		Action:      "version_created",
-		Status:      "success",
-		Timestamp:   time.Now(),
-		Metadata:    metadata,
-	}
+// NewFilePrivacyChangedEvent creates a new event for a file being moved into or out of
+// its owner's private folder
+func NewFilePrivacyChangedEvent(fileID, ownerID, fileName string, isPrivate bool) *events.FileEvent {
+	event := newFileEvent(events.TypeFilePrivacyChanged, fileID, ownerID, ownerID, fileName)
+	event.IsPrivate = &isPrivate
+	return event
 }
@@ -0,0 +1,136 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// outboxLease is how long a relay holds an event it claimed before another may claim
+	// it, comfortably longer than outboxPublishTimeout
+	outboxLease = 2 * time.Minute
+	// outboxPublishTimeout bounds the producer's retries for one event
+	outboxPublishTimeout = time.Minute
+	// outboxMaxBackoff caps the delay between attempts to publish an event
+	outboxMaxBackoff = 5 * time.Minute
+)
+
+// OutboxStore holds the events waiting to be published
+type OutboxStore interface {
+	ClaimNext(ctx context.Context, lease time.Duration) (*models.OutboxEvent, error)
+	MarkPublished(ctx context.Context, id primitive.ObjectID) error
+	MarkFailed(ctx context.Context, id primitive.ObjectID, reason string, nextAttempt time.Time) error
+}
+
+// OutboxRelay publishes the events recorded in the outbox. An event stays in the outbox
+// until Kafka accepts it, so events are delivered at least once: consumers skip
+// redeliveries by event ID.
+type OutboxRelay struct {
+	store     OutboxStore
+	producer  *Producer
+	interval  time.Duration
+	batchSize int
+	logger    *logrus.Logger
+}
+
+func NewOutboxRelay(store OutboxStore, producer *Producer, interval time.Duration, batchSize int, logger *logrus.Logger) *OutboxRelay {
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	return &OutboxRelay{
+		store:     store,
+		producer:  producer,
+		interval:  interval,
+		batchSize: batchSize,
+		logger:    logger,
+	}
+}
+
+// Run publishes pending events every interval until ctx is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.logger.WithFields(logrus.Fields{
+		"interval":   r.interval,
+		"batch_size": r.batchSize,
+	}).Info("Outbox relay started")
+
+	for {
+		// Drain a backlog without waiting between full batches
+		if r.relayBatch(ctx) == r.batchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch publishes up to a batch of pending events, oldest first, and returns how
+// many it published. It stops at the first failure, which most likely means Kafka is
+// unavailable, and leaves the rest for the next tick.
+func (r *OutboxRelay) relayBatch(ctx context.Context) int {
+	for published := 0; published < r.batchSize; published++ {
+		event, err := r.store.ClaimNext(ctx, outboxLease)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.WithError(err).Error("Failed to claim outbox event")
+			}
+			return published
+		}
+		if event == nil {
+			return published
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, outboxPublishTimeout)
+		err = r.producer.PublishMessage(publishCtx, event.EventType, event.Key, []byte(event.Payload))
+		cancel()
+		if err != nil {
+			r.fail(event, err)
+			return published
+		}
+
+		if err := r.store.MarkPublished(ctx, event.ID); err != nil {
+			// The event will be published again once its lease expires
+			r.logger.WithError(err).WithField("outbox_id", event.ID.Hex()).Error("Failed to mark outbox event published")
+		}
+	}
+
+	return r.batchSize
+}
+
+// fail schedules the next attempt to publish an event, backing off exponentially
+func (r *OutboxRelay) fail(event *models.OutboxEvent, publishErr error) {
+	backoff := outboxMaxBackoff
+	if event.Attempts < 9 {
+		backoff = time.Second << event.Attempts
+		if backoff > outboxMaxBackoff {
+			backoff = outboxMaxBackoff
+		}
+	}
+
+	r.logger.WithError(publishErr).WithFields(logrus.Fields{
+		"outbox_id":  event.ID.Hex(),
+		"event_type": event.EventType,
+		"key":        event.Key,
+		"attempts":   event.Attempts + 1,
+		"retry_in":   backoff,
+	}).Warn("Failed to publish outbox event")
+
+	// The relay may be shutting down, so record the failure without its context
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.store.MarkFailed(ctx, event.ID, publishErr.Error(), time.Now().Add(backoff)); err != nil {
+		r.logger.WithError(err).WithField("outbox_id", event.ID.Hex()).Error("Failed to record outbox publish failure")
+	}
+}
@@ -2,38 +2,25 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/faults"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/kafkametrics"
 )
 
-type EventType string
-
-const (
-	EventFileUploaded EventType = "file.uploaded"
-	EventFileShared   EventType = "file.shared"
-	EventFileDeleted  EventType = "file.deleted"
-)
-
-type FileEvent struct {
-	Type      EventType         `json:"type"`
-	FileID    string            `json:"file_id"`
-	FileName  string            `json:"file_name"`
-	OwnerID   string            `json:"owner_id"`
-	Metadata  map[string]string `json:"metadata,omitempty"`
-	Timestamp string            `json:"timestamp"`
-}
-
 type Producer struct {
 	writer     *kafka.Writer
 	mu         sync.RWMutex
 	closed     bool
 	maxRetries int
 	logger     *logrus.Logger
+	faults     *faults.Injector
+	stopStats  context.CancelFunc
 }
 
 func NewProducer(brokers []string, topic string, maxRetries int, logger *logrus.Logger) *Producer {
@@ -41,45 +28,48 @@ func NewProducer(brokers []string, topic string, maxRetries int, logger *logrus.
 		logger = logrus.New()
 	}
 
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.LeastBytes{},
+		MaxAttempts:  3,
+		BatchTimeout: 10 * time.Millisecond,
+		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  10 * time.Second,
+		RequiredAcks: kafka.RequireOne,
+	}
+
+	// Expose the writer's stats in the metrics until the producer is closed
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	go kafkametrics.WatchWriter(statsCtx, "file-service", writer)
+
 	return &Producer{
-		writer: &kafka.Writer{
-			Addr:         kafka.TCP(brokers...),
-			Topic:        topic,
-			Balancer:     &kafka.LeastBytes{},
-			MaxAttempts:  3,
-			BatchTimeout: 10 * time.Millisecond,
-			WriteTimeout: 10 * time.Second,
-			ReadTimeout:  10 * time.Second,
-			RequiredAcks: kafka.RequireOne,
-		},
+		writer:     writer,
 		maxRetries: maxRetries,
 		logger:     logger,
 		closed:     false,
+		stopStats:  stopStats,
 	}
 }
 
-// PublishFileUploadedEvent publishes a file upload event
-func (p *Producer) PublishFileUploadedEvent(ctx context.Context, event *FileUploadedEvent) error {
-	return p.publishEvent(ctx, "file.uploaded", event.FileID, event)
+// SetFaults enables failing publish attempts at the injected Kafka drop rate
+func (p *Producer) SetFaults(injector *faults.Injector) {
+	p.faults = injector
 }
 
-// PublishFileDeletedEvent publishes a file deletion event
-func (p *Producer) PublishFileDeletedEvent(ctx context.Context, event *FileDeletedEvent) error {
-	return p.publishEvent(ctx, "file.deleted", event.FileID, event)
-}
-
-// PublishFileDownloadedEvent publishes a file download event
-func (p *Producer) PublishFileDownloadedEvent(ctx context.Context, event *FileDownloadedEvent) error {
-	return p.publishEvent(ctx, "file.downloaded", event.FileID, event)
-}
+// PublishEvent validates and publishes a file event, keyed by its file
+func (p *Producer) PublishEvent(ctx context.Context, event *events.FileEvent) error {
+	data, err := events.Encode(event)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to encode Kafka event")
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
 
-// PublishFileVersionedEvent publishes a file version event
-func (p *Producer) PublishFileVersionedEvent(ctx context.Context, event *FileVersionedEvent) error {
-	return p.publishEvent(ctx, "file.versioned", event.FileID, event)
+	return p.PublishMessage(ctx, event.Type, event.FileID, data)
 }
 
-// publishEvent is a generic method to publish events to Kafka
-func (p *Producer) publishEvent(ctx context.Context, eventType, key string, event interface{}) error {
+// PublishMessage publishes an already encoded event, such as one from the outbox
+func (p *Producer) PublishMessage(ctx context.Context, eventType, key string, data []byte) error {
 	// Check if producer is closed
 	p.mu.RLock()
 	if p.closed {
@@ -88,13 +78,6 @@ func (p *Producer) publishEvent(ctx context.Context, eventType, key string, even
 	}
 	p.mu.RUnlock()
 
-	// Marshal event data
-	data, err := json.Marshal(event)
-	if err != nil {
-		p.logger.WithError(err).Error("Failed to marshal Kafka event")
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
 	// Retry logic with exponential backoff
 	var lastErr error
 	for attempt := 0; attempt < p.maxRetries; attempt++ {
@@ -114,11 +97,14 @@ func (p *Producer) publishEvent(ctx context.Context, eventType, key string, even
 		p.mu.RUnlock()
 
 		// Attempt to publish
-		err = p.writer.WriteMessages(ctx, kafka.Message{
-			Key:   []byte(key),
-			Value: data,
-			Time:  time.Now(),
-		})
+		err := p.faults.DropPublish()
+		if err == nil {
+			err = p.writer.WriteMessages(ctx, kafka.Message{
+				Key:   []byte(key),
+				Value: data,
+				Time:  time.Now(),
+			})
+		}
 
 		if err == nil {
 			p.logger.WithFields(logrus.Fields{
@@ -159,87 +145,6 @@ func (p *Producer) publishEvent(ctx context.Context, eventType, key string, even
 	return fmt.Errorf("failed to publish event after %d retries: %w", p.maxRetries, lastErr)
 }
 
-// PublishFileEvent publishes a legacy file event (for backward compatibility)
-func (p *Producer) PublishFileEvent(ctx context.Context, event FileEvent) error {
-	// Check if producer is closed
-	p.mu.RLock()
-	if p.closed {
-		p.mu.RUnlock()
-		return fmt.Errorf("producer is closed")
-	}
-	p.mu.RUnlock()
-
-	// Marshal event data
-	data, err := json.Marshal(event)
-	if err != nil {
-		p.logger.WithError(err).Error("Failed to marshal Kafka event")
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	// Retry logic with exponential backoff
-	var lastErr error
-	for attempt := 0; attempt < p.maxRetries; attempt++ {
-		// Check context cancellation
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		// Check if producer was closed during retries
-		p.mu.RLock()
-		if p.closed {
-			p.mu.RUnlock()
-			return fmt.Errorf("producer closed during publish")
-		}
-		p.mu.RUnlock()
-
-		// Attempt to publish
-		err = p.writer.WriteMessages(ctx, kafka.Message{
-			Key:   []byte(event.FileID),
-			Value: data,
-			Time:  time.Now(),
-		})
-
-		if err == nil {
-			p.logger.WithFields(logrus.Fields{
-				"event_type": event.Type,
-				"file_id":    event.FileID,
-				"attempt":    attempt + 1,
-			}).Debug("Successfully published Kafka event")
-			return nil
-		}
-
-		lastErr = err
-		p.logger.WithFields(logrus.Fields{
-			"attempt":     attempt + 1,
-			"max_retries": p.maxRetries,
-			"error":       err.Error(),
-			"event_type":  event.Type,
-			"file_id":     event.FileID,
-		}).Warn("Failed to publish Kafka message, retrying...")
-
-		// Exponential backoff
-		if attempt < p.maxRetries-1 {
-			backoff := time.Duration(attempt+1) * time.Second
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(backoff):
-			}
-		}
-	}
-
-	p.logger.WithFields(logrus.Fields{
-		"event_type":  event.Type,
-		"file_id":     event.FileID,
-		"max_retries": p.maxRetries,
-		"error":       lastErr.Error(),
-	}).Error("Failed to publish Kafka event after all retries")
-
-	return fmt.Errorf("failed to publish event after %d retries: %w", p.maxRetries, lastErr)
-}
-
 func (p *Producer) Close() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -250,6 +155,7 @@ func (p *Producer) Close() error {
 
 	p.closed = true
 	p.logger.Info("Closing Kafka producer")
+	p.stopStats()
 
 	if err := p.writer.Close(); err != nil {
 		p.logger.WithError(err).Error("Error closing Kafka writer")
@@ -0,0 +1,232 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+)
+
+// replayBatchSize is the number of events published to the replay topic at once
+const replayBatchSize = 100
+
+// ReplayOptions select the events a replay re-publishes
+type ReplayOptions struct {
+	// ID names the replay. Consumers process each event once per replay, so running a
+	// replay that was interrupted again under its ID doesn't process events twice.
+	ID    string
+	Topic string
+	// Group is the consumer group the events are replayed to
+	Group string
+	// Partition restricts the replay to one partition; all of them if negative
+	Partition int
+	// FromOffset is the offset replaying starts at in each partition, or the oldest
+	// retained if negative. It is ignored when From is set.
+	FromOffset int64
+	// From and To bound the times the events were published at; To is open-ended if zero
+	From time.Time
+	To   time.Time
+	// Types restricts the replay to events of these types, such as file.uploaded
+	Types []string
+	// Limit bounds the number of events replayed if positive
+	Limit int64
+	// DryRun counts the events that would be replayed without publishing them
+	DryRun bool
+}
+
+// ReplayResult counts the events a replay read and re-published, or would have with
+// DryRun set
+type ReplayResult struct {
+	ID          string           `json:"id"`
+	Topic       string           `json:"topic"`
+	ReplayTopic string           `json:"replay_topic"`
+	Read        int64            `json:"read"`
+	Replayed    int64            `json:"replayed"`
+	ByType      map[string]int64 `json:"by_type"`
+	DryRun      bool             `json:"dry_run"`
+}
+
+// Replay re-reads the events of a topic from an offset or a time up to the end of each
+// partition when the replay starts, and re-publishes those matching the options to the
+// replay topic of the consumer group, which only that group's services consume.
+func Replay(ctx context.Context, brokers []string, opts ReplayOptions, logger *logrus.Logger) (*ReplayResult, error) {
+	if opts.ID == "" || opts.Topic == "" || opts.Group == "" {
+		return nil, errors.New("a replay needs an ID, a topic and a consumer group")
+	}
+
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Kafka: %w", err)
+	}
+	partitions, err := conn.ReadPartitions(opts.Topic)
+	conn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partitions of %s: %w", opts.Topic, err)
+	}
+
+	types := make(map[string]bool, len(opts.Types))
+	for _, eventType := range opts.Types {
+		types[eventType] = true
+	}
+
+	result := &ReplayResult{
+		ID:          opts.ID,
+		Topic:       opts.Topic,
+		ReplayTopic: events.ReplayTopic(opts.Group),
+		ByType:      map[string]int64{},
+		DryRun:      opts.DryRun,
+	}
+
+	var writer *kafka.Writer
+	if !opts.DryRun {
+		writer = &kafka.Writer{
+			Addr:  kafka.TCP(brokers...),
+			Topic: result.ReplayTopic,
+			// Events keep their keys, and so the order they were published in per key
+			Balancer:               &kafka.Hash{},
+			MaxAttempts:            5,
+			BatchSize:              replayBatchSize,
+			WriteTimeout:           10 * time.Second,
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		}
+		defer writer.Close()
+	}
+
+	for _, partition := range partitions {
+		if opts.Partition >= 0 && partition.ID != opts.Partition {
+			continue
+		}
+		if opts.Limit > 0 && result.Replayed >= opts.Limit {
+			break
+		}
+		if err := replayPartition(ctx, brokers, partition.ID, opts, types, writer, result); err != nil {
+			return result, fmt.Errorf("failed to replay partition %d: %w", partition.ID, err)
+		}
+		logger.WithFields(logrus.Fields{
+			"topic":     opts.Topic,
+			"partition": partition.ID,
+			"read":      result.Read,
+			"replayed":  result.Replayed,
+		}).Info("Partition replayed")
+	}
+	return result, nil
+}
+
+// replayPartition replays the events of a partition
+func replayPartition(ctx context.Context, brokers []string, partition int, opts ReplayOptions, types map[string]bool, writer *kafka.Writer, result *ReplayResult) error {
+	leader, err := kafka.DialLeader(ctx, "tcp", brokers[0], opts.Topic, partition)
+	if err != nil {
+		return err
+	}
+	first, last, err := leader.ReadOffsets()
+	leader.Close()
+	if err != nil {
+		return err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     opts.Topic,
+		Partition: partition,
+		MinBytes:  1,
+		MaxBytes:  10e6, // 10MB
+	})
+	defer reader.Close()
+
+	start := first
+	if !opts.From.IsZero() {
+		if err := reader.SetOffsetAt(ctx, opts.From); err != nil {
+			return err
+		}
+		// No event was published at or after From
+		if start = reader.Offset(); start < 0 {
+			return nil
+		}
+	} else if opts.FromOffset > first {
+		start = opts.FromOffset
+		if err := reader.SetOffset(start); err != nil {
+			return err
+		}
+	}
+
+	batch := make([]kafka.Message, 0, replayBatchSize)
+	flush := func() error {
+		if len(batch) == 0 || writer == nil {
+			batch = batch[:0]
+			return nil
+		}
+		if err := writer.WriteMessages(ctx, batch...); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	// Events published after the replay started aren't replayed
+	for offset := start; offset < last; {
+		if opts.Limit > 0 && result.Replayed >= opts.Limit {
+			break
+		}
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+		offset = msg.Offset + 1
+		if !opts.To.IsZero() && msg.Time.After(opts.To) {
+			break
+		}
+		result.Read++
+
+		eventType, ok := replayable(msg, types)
+		if !ok {
+			continue
+		}
+		result.Replayed++
+		result.ByType[eventType]++
+
+		batch = append(batch, kafka.Message{
+			Key:   msg.Key,
+			Value: msg.Value,
+			Headers: append(append([]kafka.Header(nil), msg.Headers...),
+				kafka.Header{Key: events.ReplayIDHeader, Value: []byte(opts.ID)},
+				kafka.Header{Key: events.ReplayTopicHeader, Value: []byte(msg.Topic)},
+				kafka.Header{Key: events.ReplayPartitionHeader, Value: []byte(strconv.Itoa(msg.Partition))},
+				kafka.Header{Key: events.ReplayOffsetHeader, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+			),
+		})
+		if len(batch) == replayBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// replayable returns the type of an event and whether it is replayed. Events that were
+// themselves replayed aren't replayed again.
+func replayable(msg kafka.Message, types map[string]bool) (string, bool) {
+	for _, header := range msg.Headers {
+		if header.Key == events.ReplayIDHeader {
+			return "", false
+		}
+	}
+
+	var event struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		return "", false
+	}
+	if len(types) > 0 && !types[event.Type] {
+		return "", false
+	}
+	return event.Type, true
+}
@@ -0,0 +1,155 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/kafkametrics"
+)
+
+const (
+	// minClaimBackoff and maxClaimBackoff bound the wait before retrying a user event
+	// whose shares failed to be claimed
+	minClaimBackoff = time.Second
+	maxClaimBackoff = time.Minute
+)
+
+// ErrUnclaimable is wrapped by the errors of share claims that fail the same way however
+// often they are retried
+var ErrUnclaimable = errors.New("shares can't be claimed")
+
+// ShareClaimer links the shares made to an email address to the account that owns it.
+// Errors that retrying won't fix wrap ErrUnclaimable.
+type ShareClaimer interface {
+	ClaimPendingShares(ctx context.Context, userID, email string) (int, error)
+}
+
+// UserEventsConsumer claims the shares made to email addresses without an account once
+// an account proves it owns one, from the auth-service's user events: when a user
+// registers with a verified email, by invitation or provisioning, or verifies it later
+type UserEventsConsumer struct {
+	reader *kafka.Reader
+	claims ShareClaimer
+	logger *logrus.Logger
+}
+
+// NewUserEventsConsumer creates a consumer of the user events topic. A new consumer
+// group starts from the oldest retained event, so the accounts created before it was
+// deployed claim their shares too.
+func NewUserEventsConsumer(brokers []string, groupID string, claims ShareClaimer, logger *logrus.Logger) *UserEventsConsumer {
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		GroupID:     groupID,
+		Topic:       events.UserEventsTopic,
+		MinBytes:    1,
+		MaxBytes:    10e6, // 10MB
+		StartOffset: kafka.FirstOffset,
+	})
+
+	return &UserEventsConsumer{
+		reader: reader,
+		claims: claims,
+		logger: logger,
+	}
+}
+
+// Run consumes user events until ctx is done, and closes the reader. An event's offset
+// is only committed once its shares are claimed, so users who register while the
+// file-service is down, or can't reach its database, claim them when it recovers.
+func (c *UserEventsConsumer) Run(ctx context.Context) {
+	c.logger.Info("Starting user events consumer")
+	defer c.reader.Close()
+	go kafkametrics.WatchReader(ctx, "file-service", c.reader)
+
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				c.logger.Info("Stopping user events consumer")
+				return
+			}
+			c.logger.WithError(err).Error("Failed to fetch user event")
+			continue
+		}
+
+		if !c.apply(ctx, msg) {
+			c.logger.Info("Stopping user events consumer")
+			return
+		}
+
+		if err := c.reader.CommitMessages(ctx, msg); err != nil {
+			// The event is redelivered after a restart, and claims nothing the second time
+			c.logger.WithError(err).Warn("Failed to commit user event")
+		}
+	}
+}
+
+// apply claims the shares of the user of an event, retrying until they are claimed. It
+// returns false if ctx is done first. Users whose email isn't verified yet claim nothing:
+// they could have signed up with someone else's address. Events whose shares can't be
+// claimed are skipped, so that they don't hold up the events after them; the user can
+// still claim their shares through ClaimPendingShares.
+func (c *UserEventsConsumer) apply(ctx context.Context, msg kafka.Message) bool {
+	event, ok := c.decode(ctx, msg)
+	if !ok {
+		return ctx.Err() == nil
+	}
+	if !event.EmailVerified {
+		return true
+	}
+
+	logger := c.logger.WithFields(logrus.Fields{
+		"event_id":   event.EventID,
+		"event_type": event.Type,
+		"user_id":    event.UserID,
+	})
+
+	backoff := minClaimBackoff
+	for {
+		_, err := c.claims.ClaimPendingShares(ctx, event.UserID, event.Email)
+		if err == nil {
+			return true
+		}
+		if errors.Is(err, ErrUnclaimable) {
+			logger.WithError(err).WithField("offset", msg.Offset).Error("Skipping user event whose shares can't be claimed")
+			return true
+		}
+
+		logger.WithError(err).WithField("retry_in", backoff).Error("Failed to claim the shares of a user")
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxClaimBackoff)
+	}
+}
+
+// decode decodes a user event. Invalid events are skipped, and it reports false for
+// them. An event written with a newer schema than this service reads waits until ctx is
+// done and the file-service is upgraded, rather than leaving the user's shares unclaimed.
+func (c *UserEventsConsumer) decode(ctx context.Context, msg kafka.Message) (*events.UserEvent, bool) {
+	event, err := events.DecodeUser(msg.Value)
+	if err == nil {
+		return event, true
+	}
+
+	logger := c.logger.WithError(err).WithField("offset", msg.Offset)
+	if !errors.Is(err, events.ErrUnsupportedVersion) {
+		logger.Warn("Skipping invalid user event")
+		return nil, false
+	}
+
+	logger.Error("User event was written with a newer schema, waiting for the file-service to be upgraded")
+	<-ctx.Done()
+	return nil, false
+}
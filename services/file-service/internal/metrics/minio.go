@@ -0,0 +1,18 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// MinIO request duration metrics, recorded by the storage client's transport
+	MinioRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "minio_request_duration_seconds",
+			Help:    "Duration of the requests to MinIO until their response arrived, by HTTP method and status code, or error",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "status"},
+	)
+)
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// Redis availability, as seen by the cache's health checks
+	RedisUp = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "redis_up",
+			Help: "Whether Redis answered the last health check (1) or not (0)",
+		},
+	)
+
+	// Redis connection pool metrics
+	RedisPoolConnections = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "redis_pool_connections",
+			Help: "Number of connections in the Redis pool",
+		},
+		[]string{"state"},
+	)
+
+	RedisPoolEventsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redis_pool_events_total",
+			Help: "Total number of Redis pool lookups that found an idle connection (hit), had to dial one (miss) or timed out waiting for one (timeout)",
+		},
+		[]string{"event"},
+	)
+
+	// Redis availability changes
+	RedisAvailabilityChangesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redis_availability_changes_total",
+			Help: "Total number of times Redis became unavailable (down) or available again (up)",
+		},
+		[]string{"to"},
+	)
+)
@@ -0,0 +1,63 @@
+// Package migrations lists the file-service's MongoDB migrations, which it applies on
+// startup and with its migrate subcommand. New migrations are appended with the next
+// version; applied ones are never changed.
+package migrations
+
+import (
+	"context"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/migrate"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// All returns the file-service's migrations
+func All() []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version:     1,
+			Description: "Create file, share, favorite, outbox and deletion saga indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				if err := repository.NewFileRepository(db).EnsureIndexes(ctx); err != nil {
+					return err
+				}
+				if err := repository.NewOutboxRepository(db).EnsureIndexes(ctx); err != nil {
+					return err
+				}
+				return repository.NewDeletionSagaRepository(db).EnsureIndexes(ctx)
+			},
+		},
+		{
+			Version:     2,
+			Description: "Create storage statistics indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return repository.NewStorageRepository(db).EnsureIndexes(ctx)
+			},
+		},
+		{
+			Version:     3,
+			Description: "Create the shared_with collection from the file shares",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				repo := repository.NewFileRepository(db)
+				if err := repo.EnsureSharedWithIndexes(ctx); err != nil {
+					return err
+				}
+				return repo.BuildSharedWith(ctx)
+			},
+		},
+		{
+			Version:     4,
+			Description: "Index file shares by owner",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return repository.NewFileRepository(db).EnsureIndexes(ctx)
+			},
+		},
+		{
+			Version:     5,
+			Description: "Create download grant indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return repository.NewDownloadGrantRepository(db).EnsureIndexes(ctx)
+			},
+		},
+	}
+}
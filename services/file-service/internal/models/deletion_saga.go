@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeletionSaga statuses
+const (
+	DeletionStatusRunning      = "running"
+	DeletionStatusCompensating = "compensating"
+	DeletionStatusCompleted    = "completed"
+	DeletionStatusCompensated  = "compensated"
+)
+
+// Deletion saga steps, in the order they run. Recording the event is the point of no
+// return: the steps before it are undone if they keep failing, and the step after it is
+// retried until it succeeds.
+const (
+	DeletionStepRemoveFile   = "remove_file"
+	DeletionStepReleaseUsage = "release_usage"
+	DeletionStepRecordEvent  = "record_event"
+	DeletionStepDeleteObject = "delete_object"
+)
+
+// DeletionSaga tracks the deletion of a file across its record, the owner's storage
+// usage, the billing-service (through the file deleted event) and object storage, so
+// that a deletion interrupted by a failure or a restart is finished or undone
+type DeletionSaga struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FileID string             `bson:"file_id" json:"file_id"`
+	// File is the file as it was, to restore it if the deletion is undone
+	File File `bson:"file" json:"file"`
+	// Event is the JSON-encoded file deleted event, built once so that it keeps its ID
+	// however often it is recorded
+	Event  string `bson:"event" json:"-"`
+	Status string `bson:"status" json:"status"`
+	// Active is set until the saga completes or is compensated, and allows one active
+	// saga per file
+	Active bool `bson:"active" json:"active"`
+	// Completed lists the steps made, and not undone
+	Completed []string `bson:"completed" json:"completed"`
+	// Attempts counts the failed attempts of the current step
+	Attempts      int       `bson:"attempts" json:"attempts"`
+	LastError     string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at"`
+	// LockedUntil keeps other runners from resuming the saga while one runs it
+	LockedUntil time.Time  `bson:"locked_until" json:"-"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+	FinishedAt  *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// HasCompleted reports whether a step was made, and not undone
+func (s *DeletionSaga) HasCompleted(step string) bool {
+	for _, completed := range s.Completed {
+		if completed == step {
+			return true
+		}
+	}
+	return false
+}
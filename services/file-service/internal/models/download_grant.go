@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DownloadGrant records a download URL issued for a file: who it was issued to, and until
+// when it works. Single-use grants are handed out as a link that is redeemed for a
+// presigned URL once, rather than as the presigned URL itself.
+type DownloadGrant struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FileID   string             `bson:"file_id" json:"file_id"`
+	OwnerID  string             `bson:"owner_id" json:"owner_id"`
+	UserID   string             `bson:"user_id" json:"user_id"`
+	TenantID string             `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	// SingleUse grants are redeemed once, with the token whose SHA-256 hash TokenHash is
+	SingleUse bool      `bson:"single_use" json:"single_use"`
+	TokenHash string    `bson:"token_hash,omitempty" json:"-"`
+	RequestID string    `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	IssuedAt  time.Time `bson:"issued_at" json:"issued_at"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+	// RedeemedAt and RedeemedFrom record when and from which address a single-use grant
+	// was redeemed
+	RedeemedAt   *time.Time `bson:"redeemed_at,omitempty" json:"redeemed_at,omitempty"`
+	RedeemedFrom string     `bson:"redeemed_from,omitempty" json:"redeemed_from,omitempty"`
+}
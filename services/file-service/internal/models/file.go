@@ -30,6 +30,7 @@ type File struct {
 	Size        int64              `bson:"size" json:"size"`
 	MimeType    string             `bson:"mime_type" json:"mime_type"`
 	OwnerID     string             `bson:"owner_id" json:"owner_id"`
+	TenantID    string             `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"` // Empty for the default tenant
 	StoragePath string             `bson:"storage_path" json:"storage_path"`
 	Checksum    string             `bson:"checksum,omitempty" json:"checksum,omitempty"`
 	ContentHash string             `bson:"content_hash,omitempty" json:"content_hash,omitempty"` // For deduplication
@@ -52,6 +53,8 @@ type FileShare struct {
 	ExpiryTime      *time.Time         `bson:"expiry_time,omitempty" json:"expiry_time,omitempty"`
 	ShareLink       string             `bson:"share_link,omitempty" json:"share_link,omitempty"`
 	IsActive        bool               `bson:"is_active" json:"is_active"`
-	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+	// PasswordHash is the bcrypt hash of the password a link share asks for, if any
+	PasswordHash string    `bson:"password_hash,omitempty" json:"-"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxEvent statuses
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusPublished = "published"
+)
+
+// OutboxEvent is a Kafka event recorded alongside the change it describes, and published
+// by the outbox relay until Kafka accepts it
+type OutboxEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	EventType string             `bson:"event_type" json:"event_type"`
+	// Key is the Kafka message key, the ID of the file the event is about
+	Key     string `bson:"key" json:"key"`
+	Payload string `bson:"payload" json:"payload"` // JSON-encoded event
+	Status  string `bson:"status" json:"status"`
+	// Attempts counts the failed publish attempts, which delay the next one
+	Attempts      int       `bson:"attempts" json:"attempts"`
+	LastError     string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at"`
+	// LockedUntil keeps other relays from publishing the event while one holds it
+	LockedUntil time.Time  `bson:"locked_until" json:"locked_until"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	PublishedAt *time.Time `bson:"published_at,omitempty" json:"published_at,omitempty"`
+}
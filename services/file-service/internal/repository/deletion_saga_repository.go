@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// deletionRetention is how long finished deletions are kept, for troubleshooting and
+// the reconciliation report, before MongoDB expires them
+const deletionRetention = 30 * 24 * time.Hour
+
+// ErrDeletionInProgress is returned when a file is already being deleted
+var ErrDeletionInProgress = errors.New("file deletion already in progress")
+
+// DeletionSagaRepository stores the progress of file deletions
+type DeletionSagaRepository struct {
+	collection *mongo.Collection
+}
+
+func NewDeletionSagaRepository(db *mongo.Database) *DeletionSagaRepository {
+	return &DeletionSagaRepository{
+		collection: db.Collection("file_deletions"),
+	}
+}
+
+// EnsureIndexes creates the indexes the runner polls with, allows one active deletion
+// per file, and expires finished deletions
+func (r *DeletionSagaRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "file_id", Value: 1}},
+			Options: options.Index().
+				SetName("active_file_idx").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"active": true}),
+		},
+		{
+			Keys: bson.D{
+				{Key: "active", Value: 1},
+				{Key: "next_attempt_at", Value: 1},
+			},
+			Options: options.Index().SetName("active_next_attempt_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "finished_at", Value: 1}},
+			Options: options.Index().SetName("finished_ttl_idx").SetExpireAfterSeconds(int32(deletionRetention.Seconds())),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Create records a new deletion, claimed by its creator for lease. It returns
+// ErrDeletionInProgress if the file is already being deleted.
+func (r *DeletionSagaRepository) Create(ctx context.Context, saga *models.DeletionSaga, lease time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	saga.ID = primitive.NewObjectID()
+	saga.Status = models.DeletionStatusRunning
+	saga.Active = true
+	saga.Completed = []string{}
+	saga.NextAttemptAt = now
+	saga.LockedUntil = now.Add(lease)
+	saga.CreatedAt = now
+	saga.UpdatedAt = now
+
+	_, err := r.collection.InsertOne(ctx, saga)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDeletionInProgress
+	}
+	return err
+}
+
+// ClaimNext locks the oldest active deletion due to be resumed for lease, and returns
+// nil if there is none
+func (r *DeletionSagaRepository) ClaimNext(ctx context.Context, lease time.Duration) (*models.DeletionSaga, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"active":          true,
+		"next_attempt_at": bson.M{"$lte": now},
+		"locked_until":    bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var saga models.DeletionSaga
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&saga)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &saga, nil
+}
+
+// CompleteStep records that a step was made
+func (r *DeletionSagaRepository) CompleteStep(ctx context.Context, id primitive.ObjectID, step string) error {
+	return r.update(ctx, id, bson.M{
+		"$addToSet": bson.M{"completed": step},
+		"$set":      bson.M{"attempts": 0, "last_error": "", "updated_at": time.Now()},
+	})
+}
+
+// UndoStep records that a step was undone
+func (r *DeletionSagaRepository) UndoStep(ctx context.Context, id primitive.ObjectID, step string) error {
+	return r.update(ctx, id, bson.M{
+		"$pull": bson.M{"completed": step},
+		"$set":  bson.M{"attempts": 0, "last_error": "", "updated_at": time.Now()},
+	})
+}
+
+// StartCompensating records that a deletion is being undone
+func (r *DeletionSagaRepository) StartCompensating(ctx context.Context, id primitive.ObjectID) error {
+	return r.update(ctx, id, bson.M{
+		"$set": bson.M{
+			"status":     models.DeletionStatusCompensating,
+			"attempts":   0,
+			"updated_at": time.Now(),
+		},
+	})
+}
+
+// Finish records that a deletion completed or was compensated, and releases it
+func (r *DeletionSagaRepository) Finish(ctx context.Context, id primitive.ObjectID, status string) error {
+	now := time.Now()
+	return r.update(ctx, id, bson.M{
+		"$set": bson.M{
+			"status":       status,
+			"active":       false,
+			"locked_until": now,
+			"updated_at":   now,
+			"finished_at":  now,
+		},
+	})
+}
+
+// MarkFailed records a failed attempt at a step and when to make the next one, and
+// releases the deletion
+func (r *DeletionSagaRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, reason string, nextAttempt time.Time) error {
+	now := time.Now()
+	return r.update(ctx, id, bson.M{
+		"$inc": bson.M{"attempts": 1},
+		"$set": bson.M{
+			"last_error":      reason,
+			"next_attempt_at": nextAttempt,
+			"locked_until":    now,
+			"updated_at":      now,
+		},
+	})
+}
+
+// FindStalled returns up to limit active deletions that have failed at least once or
+// started before since, oldest first
+func (r *DeletionSagaRepository) FindStalled(ctx context.Context, since time.Time, limit int64) ([]*models.DeletionSaga, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"active": true,
+		"$or": []bson.M{
+			{"attempts": bson.M{"$gt": 0}},
+			{"created_at": bson.M{"$lt": since}},
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sagas []*models.DeletionSaga
+	if err := cursor.All(ctx, &sagas); err != nil {
+		return nil, err
+	}
+	return sagas, nil
+}
+
+// CountCompensatedSince counts the deletions undone since a time
+func (r *DeletionSagaRepository) CountCompensatedSince(ctx context.Context, since time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return r.collection.CountDocuments(ctx, bson.M{
+		"status":      models.DeletionStatusCompensated,
+		"finished_at": bson.M{"$gte": since},
+	})
+}
+
+// ActiveStoragePaths returns the storage paths of the files being deleted, whose
+// objects the deletions will remove or keep
+func (r *DeletionSagaRepository) ActiveStoragePaths(ctx context.Context) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"file.storage_path": 1})
+	cursor, err := r.collection.Find(ctx, bson.M{"active": true}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	paths := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var saga models.DeletionSaga
+		if err := cursor.Decode(&saga); err != nil {
+			return nil, err
+		}
+		paths[saga.File.StoragePath] = true
+	}
+	return paths, cursor.Err()
+}
+
+func (r *DeletionSagaRepository) update(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateByID(ctx, id, update)
+	return err
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// downloadGrantRetention is how long the record of a download URL is kept after it
+// expires before MongoDB removes it
+const downloadGrantRetention = 90 * 24 * time.Hour
+
+// ErrDownloadGrantInvalid is returned for single-use download links that don't exist,
+// have expired or were already redeemed
+var ErrDownloadGrantInvalid = errors.New("download link is invalid, expired or already used")
+
+// DownloadGrantRepository stores the audit trail of the download URLs issued for files,
+// and redeems the single-use ones
+type DownloadGrantRepository struct {
+	collection *mongo.Collection
+}
+
+func NewDownloadGrantRepository(db *mongo.Database) *DownloadGrantRepository {
+	return &DownloadGrantRepository{
+		collection: db.Collection("download_grants"),
+	}
+}
+
+// EnsureIndexes creates the indexes single-use links are redeemed and a file's downloads
+// are audited with, and expires old grants
+func (r *DownloadGrantRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetName("token_hash_idx").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"token_hash": bson.M{"$type": "string"}}),
+		},
+		{
+			Keys: bson.D{
+				{Key: "file_id", Value: 1},
+				{Key: "issued_at", Value: -1},
+			},
+			Options: options.Index().SetName("file_issued_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_ttl_idx").SetExpireAfterSeconds(int32(downloadGrantRetention.Seconds())),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Create records an issued download URL
+func (r *DownloadGrantRepository) Create(ctx context.Context, grant *models.DownloadGrant) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	grant.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, grant)
+	return err
+}
+
+// CreateSingleUse records a single-use grant, and returns the token it is redeemed with.
+// Only the token's hash is stored.
+func (r *DownloadGrantRepository) CreateSingleUse(ctx context.Context, grant *models.DownloadGrant) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate download token: %w", err)
+	}
+	token := hex.EncodeToString(bytes)
+
+	grant.SingleUse = true
+	grant.TokenHash = hashDownloadToken(token)
+	if err := r.Create(ctx, grant); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Redeem marks the single-use grant of token as redeemed from address, and returns it.
+// Only the first redemption before the grant expires succeeds; others get
+// ErrDownloadGrantInvalid.
+func (r *DownloadGrantRepository) Redeem(ctx context.Context, token, address string) (*models.DownloadGrant, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tokenHash := hashDownloadToken(token)
+
+	now := time.Now()
+	filter := bson.M{
+		"token_hash":  tokenHash,
+		"single_use":  true,
+		"redeemed_at": bson.M{"$exists": false},
+		"expires_at":  bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"redeemed_at": now, "redeemed_from": address}}
+
+	var grant models.DownloadGrant
+	err := r.collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&grant)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDownloadGrantInvalid
+		}
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// Release undoes the redemption of grant, for when it couldn't be served, so that the link
+// can be redeemed again. Grants redeemed again since are left alone.
+func (r *DownloadGrantRepository) Release(ctx context.Context, grant *models.DownloadGrant) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": grant.ID, "redeemed_at": grant.RedeemedAt}
+	update := bson.M{"$unset": bson.M{"redeemed_at": "", "redeemed_from": ""}}
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func hashDownloadToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -22,16 +24,29 @@ type FileRepository struct {
 	collection         *mongo.Collection
 	shareCollection    *mongo.Collection
 	favoriteCollection *mongo.Collection
+	// sharedWithCollection lists the files shared with each user, see sharedWith
+	sharedWithCollection *mongo.Collection
 }
 
 func NewFileRepository(db *mongo.Database) *FileRepository {
 	return &FileRepository{
-		collection:         db.Collection("files"),
-		shareCollection:    db.Collection("file_shares"),
-		favoriteCollection: db.Collection("favorites"),
+		collection:           db.Collection("files"),
+		shareCollection:      db.Collection("file_shares"),
+		favoriteCollection:   db.Collection("favorites"),
+		sharedWithCollection: db.Collection("shared_with"),
 	}
 }
 
+// joinedTenantFilter matches the documents whose file, joined into field, belongs to the
+// tenant ctx is served for. Outside of a request it matches every document.
+func joinedTenantFilter(ctx context.Context, field string) bson.M {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return bson.M{}
+	}
+	return bson.M{field + "." + tenant.Field: tenant.Match(id)}
+}
+
 // EnsureIndexes creates necessary database indexes for performance
 func (r *FileRepository) EnsureIndexes(ctx context.Context) error {
 	// Files collection indexes
@@ -61,6 +76,10 @@ func (r *FileRepository) EnsureIndexes(ctx context.Context) error {
 			},
 			Options: options.Index().SetName("owner_hash_idx").SetSparse(true),
 		},
+		{
+			Keys:    bson.D{{Key: "storage_path", Value: 1}},
+			Options: options.Index().SetName("storage_path_idx"),
+		},
 	}
 
 	_, err := r.collection.Indexes().CreateMany(ctx, fileIndexes)
@@ -89,6 +108,13 @@ func (r *FileRepository) EnsureIndexes(ctx context.Context) error {
 			},
 			Options: options.Index().SetName("file_user_share_idx").SetUnique(true),
 		},
+		{
+			Keys: bson.D{
+				{Key: "owner_id", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+			Options: options.Index().SetName("owner_created_idx"),
+		},
 	}
 
 	_, err = r.shareCollection.Indexes().CreateMany(ctx, shareIndexes)
@@ -119,10 +145,15 @@ func (r *FileRepository) EnsureIndexes(ctx context.Context) error {
 	return err
 }
 
+// Create stores a new file in the tenant ctx is served for
 func (r *FileRepository) Create(ctx context.Context, file *models.File) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	if id, ok := tenant.FromContext(ctx); ok {
+		file.TenantID = id
+	}
+
 	file.ID = primitive.NewObjectID()
 	file.CreatedAt = time.Now()
 	file.UpdatedAt = time.Now()
@@ -140,6 +171,29 @@ func (r *FileRepository) FindByID(ctx context.Context, id string) (*models.File,
 		return nil, err
 	}
 
+	var file models.File
+	err = r.collection.FindOne(ctx, tenant.Scope(ctx, bson.M{"_id": objectID})).Decode(&file)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// FindByIDInAnyTenant finds the file with ID id in whichever tenant it belongs to,
+// ignoring the tenant of ctx. It is for callers that aren't served for a tenant, such as
+// visitors of link shares.
+func (r *FileRepository) FindByIDInAnyTenant(ctx context.Context, id string) (*models.File, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
 	var file models.File
 	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&file)
 	if err != nil {
@@ -156,10 +210,11 @@ func (r *FileRepository) FindByOwner(ctx context.Context, ownerID string, page,
 	defer cancel()
 
 	skip := (page - 1) * limit
+	filter := tenant.Scope(ctx, bson.M{"owner_id": ownerID})
 
 	cursor, err := r.collection.Find(
 		ctx,
-		bson.M{"owner_id": ownerID},
+		filter,
 		options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.M{"created_at": -1}),
 	)
 	if err != nil {
@@ -172,7 +227,7 @@ func (r *FileRepository) FindByOwner(ctx context.Context, ownerID string, page,
 		return nil, 0, err
 	}
 
-	total, err := r.collection.CountDocuments(ctx, bson.M{"owner_id": ownerID})
+	total, err := r.collection.CountDocuments(ctx, filter)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -219,10 +274,10 @@ func (r *FileRepository) FindByContentHash(ctx context.Context, ownerID, hash st
 	defer cancel()
 
 	var file models.File
-	err := r.collection.FindOne(ctx, bson.M{
+	err := r.collection.FindOne(ctx, tenant.Scope(ctx, bson.M{
 		"owner_id":     ownerID,
 		"content_hash": hash,
-	}).Decode(&file)
+	})).Decode(&file)
 
 	if err == mongo.ErrNoDocuments {
 		return nil, nil // Not a duplicate
@@ -242,8 +297,10 @@ func (r *FileRepository) CreateShare(ctx context.Context, share *models.FileShar
 	share.ID = primitive.NewObjectID()
 	share.CreatedAt = time.Now()
 
-	_, err := r.shareCollection.InsertOne(ctx, share)
-	return err
+	if _, err := r.shareCollection.InsertOne(ctx, share); err != nil {
+		return err
+	}
+	return r.addSharedWith(ctx, share.SharedWithID, share.FileID, share.CreatedAt)
 }
 
 func (r *FileRepository) FindSharesByFileID(ctx context.Context, fileID string) ([]*models.FileShare, error) {
@@ -264,104 +321,216 @@ func (r *FileRepository) FindSharesByFileID(ctx context.Context, fileID string)
 	return shares, nil
 }
 
-// FindSharedWithUser uses aggregation pipeline for efficient query
-func (r *FileRepository) FindSharedWithUser(ctx context.Context, userID string, page, limit int32) ([]*models.File, int64, error) {
+// ClaimPendingShares assigns shares made to an email address without an account to the
+// user now owning that address, and returns the shares it assigned. Emails are matched
+// case-insensitively. A file can only be shared with a user once, so shares of files the
+// user already has a share of are deleted rather than assigned.
+func (r *FileRepository) ClaimPendingShares(ctx context.Context, email, userID string) ([]*models.FileShare, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	skip := (page - 1) * limit
+	cursor, err := r.shareCollection.Find(ctx, bson.M{
+		"shared_with_email": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(email) + "$", Options: "i"},
+		"shared_with_id":    "",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var shares []*models.FileShare
+	if err = cursor.All(ctx, &shares); err != nil {
+		return nil, err
+	}
 
-	// Use aggregation pipeline for efficiency
-	pipeline := mongo.Pipeline{
-		// Match shares for user
-		{{Key: "$match", Value: bson.M{"shared_with_id": userID}}},
+	now := time.Now()
+	claimed := make([]*models.FileShare, 0, len(shares))
+	for _, share := range shares {
+		assigned, err := r.claimShare(ctx, share, userID, now)
+		if err != nil {
+			return claimed, err
+		}
+		if !assigned {
+			continue
+		}
+		share.SharedWithID = userID
+		share.UpdatedAt = now
+		claimed = append(claimed, share)
 
-		// Convert file_id string to ObjectID
-		{{Key: "$addFields", Value: bson.M{
-			"file_oid": bson.M{"$toObjectId": "$file_id"},
-		}}},
+		if !share.IsActive {
+			continue
+		}
+		if err := r.addSharedWith(ctx, userID, share.FileID, share.CreatedAt); err != nil {
+			return claimed, err
+		}
+	}
 
-		// Join with files collection
-		{{Key: "$lookup", Value: bson.M{
-			"from":         "files",
-			"localField":   "file_oid",
-			"foreignField": "_id",
-			"as":           "file",
-		}}},
+	return claimed, nil
+}
 
-		// Unwind file array
-		{{Key: "$unwind", Value: "$file"}},
+// claimShare assigns a pending share to userID, reporting false if it was claimed
+// concurrently or the user already has a share of the file, in which case it is deleted
+func (r *FileRepository) claimShare(ctx context.Context, share *models.FileShare, userID string, now time.Time) (bool, error) {
+	existing, err := r.shareCollection.CountDocuments(ctx,
+		bson.M{"file_id": share.FileID, "shared_with_id": userID},
+		options.Count().SetLimit(1),
+	)
+	if err != nil {
+		return false, err
+	}
 
-		// Sort by file creation date
-		{{Key: "$sort", Value: bson.M{"file.created_at": -1}}},
+	if existing == 0 {
+		// Shares claimed concurrently keep the user they were claimed by
+		result, err := r.shareCollection.UpdateOne(ctx,
+			bson.M{"_id": share.ID, "shared_with_id": ""},
+			bson.M{"$set": bson.M{"shared_with_id": userID, "updated_at": now}},
+		)
+		if err == nil {
+			return result.ModifiedCount == 1, nil
+		}
+		// The file was shared with the user since it was checked
+		if !mongo.IsDuplicateKeyError(err) {
+			return false, err
+		}
+	}
 
-		// Pagination
-		{{Key: "$skip", Value: skip}},
-		{{Key: "$limit", Value: limit}},
+	if _, err := r.shareCollection.DeleteOne(ctx, bson.M{"_id": share.ID, "shared_with_id": ""}); err != nil {
+		return false, err
+	}
+	return false, nil
+}
 
-		// Project only file
-		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$file"}}},
+// IsTransient reports whether a database error can pass by itself, such as the database
+// being unreachable or electing a new primary, so that the operation is worth retrying
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, mongo.ErrClientDisconnected) ||
+		mongo.IsTimeout(err) || mongo.IsNetworkError(err) {
+		return true
 	}
 
-	cursor, err := r.shareCollection.Aggregate(ctx, pipeline)
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) &&
+		(serverErr.HasErrorLabel("TransientTransactionError") || serverErr.HasErrorLabel("RetryableWriteError"))
+}
+
+func (r *FileRepository) DeleteShare(ctx context.Context, shareID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(shareID)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
-	defer cursor.Close(ctx)
 
-	var files []*models.File
-	if err = cursor.All(ctx, &files); err != nil {
-		return nil, 0, err
+	var share models.FileShare
+	err = r.shareCollection.FindOneAndDelete(ctx, bson.M{"_id": objectID}).Decode(&share)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrShareNotFound
+		}
+		return err
+	}
+
+	return r.removeSharedWith(ctx, share.SharedWithID, share.FileID)
+}
+
+// FindShareByID returns a share
+func (r *FileRepository) FindShareByID(ctx context.Context, shareID string) (*models.FileShare, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(shareID)
+	if err != nil {
+		return nil, ErrShareNotFound
+	}
+
+	var share models.FileShare
+	err = r.shareCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&share)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrShareNotFound
+		}
+		return nil, err
 	}
+	return &share, nil
+}
 
-	// Count total shared files
-	countPipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{"shared_with_id": userID}}},
-		{{Key: "$count", Value: "total"}},
+// FindSharesByOwner returns a page of the shares of ownerID's files, or of the file with
+// ID fileID if it isn't empty, newest first, and how many there are
+func (r *FileRepository) FindSharesByOwner(ctx context.Context, ownerID, fileID string, page, limit int32) ([]*models.FileShare, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"owner_id": ownerID}
+	if fileID != "" {
+		filter["file_id"] = fileID
 	}
 
-	countCursor, err := r.shareCollection.Aggregate(ctx, countPipeline)
+	skip := (page - 1) * limit
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+
+	cursor, err := r.shareCollection.Find(ctx, filter, opts)
 	if err != nil {
-		return files, 0, nil // Return files even if count fails
+		return nil, 0, err
 	}
-	defer countCursor.Close(ctx)
+	defer cursor.Close(ctx)
 
-	var countResult []bson.M
-	if err = countCursor.All(ctx, &countResult); err != nil {
-		return files, 0, nil
+	var shares []*models.FileShare
+	if err = cursor.All(ctx, &shares); err != nil {
+		return nil, 0, err
 	}
 
-	total := int64(0)
-	if len(countResult) > 0 {
-		if totalVal, ok := countResult[0]["total"].(int32); ok {
-			total = int64(totalVal)
-		} else if totalVal, ok := countResult[0]["total"].(int64); ok {
-			total = totalVal
-		}
+	total, err := r.shareCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return files, total, nil
+	return shares, total, nil
 }
 
-func (r *FileRepository) DeleteShare(ctx context.Context, shareID string) error {
+// UpdateShare saves the permission, expiry, password and state of a share. The file is
+// added to or removed from the recipient's shared files as the share is reactivated or
+// deactivated.
+func (r *FileRepository) UpdateShare(ctx context.Context, share *models.FileShare) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	objectID, err := primitive.ObjectIDFromHex(shareID)
-	if err != nil {
-		return err
+	share.UpdatedAt = time.Now()
+	set := bson.M{
+		"permission": share.Permission,
+		"is_active":  share.IsActive,
+		"updated_at": share.UpdatedAt,
+	}
+	unset := bson.M{}
+	if share.ExpiryTime != nil {
+		set["expiry_time"] = share.ExpiryTime
+	} else {
+		unset["expiry_time"] = ""
+	}
+	if share.PasswordHash != "" {
+		set["password_hash"] = share.PasswordHash
+	} else {
+		unset["password_hash"] = ""
 	}
 
-	result, err := r.shareCollection.DeleteOne(ctx, bson.M{"_id": objectID})
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := r.shareCollection.UpdateOne(ctx, bson.M{"_id": share.ID}, update)
 	if err != nil {
 		return err
 	}
-
-	if result.DeletedCount == 0 {
+	if result.MatchedCount == 0 {
 		return ErrShareNotFound
 	}
 
-	return nil
+	if share.IsActive {
+		return r.addSharedWith(ctx, share.SharedWithID, share.FileID, share.CreatedAt)
+	}
+	return r.removeSharedWith(ctx, share.SharedWithID, share.FileID)
 }
 
 // CheckShareAccess checks if a user has access to a file via sharing
@@ -459,7 +628,7 @@ func (r *FileRepository) PermanentDelete(ctx context.Context, id string) error {
 		return ErrFileNotFound
 	}
 
-	return nil
+	return r.removeFileSharedWith(ctx, objectID)
 }
 
 // PermanentDeleteDirect permanently deletes a file directly from database (any status)
@@ -483,7 +652,272 @@ func (r *FileRepository) PermanentDeleteDirect(ctx context.Context, id string) e
 		return ErrFileNotFound
 	}
 
-	return nil
+	return r.removeFileSharedWith(ctx, objectID)
+}
+
+// Restore recreates a deleted file with its original ID, shared with the users its shares
+// are made with again. Files that exist are left as they are.
+func (r *FileRepository) Restore(ctx context.Context, file *models.File) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, file)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.restoreSharedWith(ctx, file)
+}
+
+// FindByStatus returns the files in a status, such as the uploads in progress
+func (r *FileRepository) FindByStatus(ctx context.Context, status models.FileStatus) ([]*models.File, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"status": status})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var files []*models.File
+	if err = cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// CountByStoragePath counts the files stored at an object storage path
+func (r *FileRepository) CountByStoragePath(ctx context.Context, storagePath string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return r.collection.CountDocuments(ctx, bson.M{"storage_path": storagePath})
+}
+
+// FindStoragePaths returns which of the given object storage paths files are stored at
+func (r *FileRepository) FindStoragePaths(ctx context.Context, storagePaths []string) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	values, err := r.collection.Distinct(ctx, "storage_path", bson.M{"storage_path": bson.M{"$in": storagePaths}})
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(values))
+	for _, value := range values {
+		if path, ok := value.(string); ok {
+			found[path] = true
+		}
+	}
+	return found, nil
+}
+
+// OwnerUsage is the storage a user's available files take up
+type OwnerUsage struct {
+	UsedBytes int64 `bson:"used_bytes"`
+	FileCount int64 `bson:"file_count"`
+}
+
+// UsageByOwner computes the storage each user's available files take up, counted the
+// way storage usage is
+func (r *FileRepository) UsageByOwner(ctx context.Context) (map[string]OwnerUsage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"status": models.FileStatusAvailable}},
+		{"$group": bson.M{
+			"_id":        "$owner_id",
+			"used_bytes": bson.M{"$sum": "$size"},
+			"file_count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	usage := make(map[string]OwnerUsage)
+	for cursor.Next(ctx) {
+		var result struct {
+			OwnerID    string `bson:"_id"`
+			OwnerUsage `bson:",inline"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		usage[result.OwnerID] = result.OwnerUsage
+	}
+	return usage, cursor.Err()
+}
+
+// UsageOfOwner computes the storage a user's available files take up, counted the way
+// storage usage is
+func (r *FileRepository) UsageOfOwner(ctx context.Context, ownerID string) (OwnerUsage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"owner_id": ownerID, "status": models.FileStatusAvailable}},
+		{"$group": bson.M{
+			"_id":        nil,
+			"used_bytes": bson.M{"$sum": "$size"},
+			"file_count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return OwnerUsage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var usage OwnerUsage
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&usage); err != nil {
+			return OwnerUsage{}, err
+		}
+	}
+	return usage, cursor.Err()
+}
+
+// ForEachAvailableFile calls fn with the ID, owner, storage path and size of each
+// available file last updated before updatedBefore, stopping at the first error. The scan
+// is bounded by ctx only.
+func (r *FileRepository) ForEachAvailableFile(ctx context.Context, updatedBefore time.Time, fn func(file *models.File) error) error {
+	filter := bson.M{
+		"status":     models.FileStatusAvailable,
+		"updated_at": bson.M{"$lt": updatedBefore},
+	}
+	opts := options.Find().SetProjection(bson.M{"owner_id": 1, "storage_path": 1, "size": 1})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var file models.File
+		if err := cursor.Decode(&file); err != nil {
+			return err
+		}
+		if err := fn(&file); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// StorageTotals is the storage the available files take up
+type StorageTotals struct {
+	UsedBytes int64 `bson:"used_bytes" json:"used_bytes"`
+	FileCount int64 `bson:"file_count" json:"file_count"`
+}
+
+// StorageTotals sums the storage the available files of the tenant ctx is served for take
+// up, counted the way storage usage is
+func (r *FileRepository) StorageTotals(ctx context.Context) (*StorageTotals, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	pipeline := []bson.M{
+		{"$match": tenant.Scope(ctx, bson.M{"status": models.FileStatusAvailable})},
+		{"$group": bson.M{
+			"_id":        nil,
+			"used_bytes": bson.M{"$sum": "$size"},
+			"file_count": bson.M{"$sum": 1},
+		}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := &StorageTotals{}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(totals); err != nil {
+			return nil, err
+		}
+	}
+	return totals, cursor.Err()
+}
+
+// ShareCounts are the active, unexpired shares of files
+type ShareCounts struct {
+	// Users counts the shares with users and email addresses, Links the link-only shares
+	Users int64 `json:"users"`
+	Links int64 `json:"links"`
+}
+
+// CountActiveShares counts the active, unexpired shares of the files of the tenant ctx is
+// served for
+func (r *FileRepository) CountActiveShares(ctx context.Context) (*ShareCounts, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"is_active": true,
+			"$or": []bson.M{
+				{"expiry_time": bson.M{"$exists": false}},
+				{"expiry_time": nil},
+				{"expiry_time": bson.M{"$gt": time.Now()}},
+			},
+		}}},
+	}
+	if _, ok := tenant.FromContext(ctx); ok {
+		// Shares belong to the tenant of their file
+		pipeline = append(pipeline,
+			bson.D{{Key: "$addFields", Value: bson.M{"file_oid": bson.M{"$toObjectId": "$file_id"}}}},
+			bson.D{{Key: "$lookup", Value: bson.M{
+				"from":         "files",
+				"localField":   "file_oid",
+				"foreignField": "_id",
+				"as":           "file",
+			}}},
+			bson.D{{Key: "$unwind", Value: "$file"}},
+			bson.D{{Key: "$match", Value: joinedTenantFilter(ctx, "file")}},
+		)
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.M{
+		"_id": bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{"$shared_with_id", ""}},
+			bson.M{"$eq": bson.A{"$shared_with_email", ""}},
+		}},
+		"count": bson.M{"$sum": 1},
+	}}})
+
+	cursor, err := r.shareCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := &ShareCounts{}
+	for cursor.Next(ctx) {
+		var result struct {
+			LinkOnly bool  `bson:"_id"`
+			Count    int64 `bson:"count"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		if result.LinkOnly {
+			counts.Links = result.Count
+		} else {
+			counts.Users = result.Count
+		}
+	}
+	return counts, cursor.Err()
 }
 
 // IsErrFileNotFound checks if an error is ErrFileNotFound
@@ -543,6 +977,36 @@ func (r *FileRepository) IsFavorite(ctx context.Context, userID, fileID string)
 	return count > 0, nil
 }
 
+// FavoriteFileIDs returns which of the files with IDs fileIDs are in user's favorites,
+// with one query for a page of files
+func (r *FileRepository) FavoriteFileIDs(ctx context.Context, userID string, fileIDs []string) (map[string]bool, error) {
+	favorites := make(map[string]bool)
+	if len(fileIDs) == 0 {
+		return favorites, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.favoriteCollection.Find(ctx, bson.M{
+		"user_id": userID,
+		"file_id": bson.M{"$in": fileIDs},
+	}, options.Find().SetProjection(bson.M{"file_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var favorite models.Favorite
+		if err := cursor.Decode(&favorite); err != nil {
+			return nil, err
+		}
+		favorites[favorite.FileID] = true
+	}
+	return favorites, cursor.Err()
+}
+
 // FindFavoritesByUser returns user's favorite files with pagination
 func (r *FileRepository) FindFavoritesByUser(ctx context.Context, userID string, page, limit int32) ([]*models.File, int64, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
@@ -571,6 +1035,9 @@ func (r *FileRepository) FindFavoritesByUser(ctx context.Context, userID string,
 		// Unwind file array
 		{"$unwind": "$file"},
 
+		// Keep the files of the tenant the request is served for
+		{"$match": joinedTenantFilter(ctx, "file")},
+
 		// Sort by favorite creation date (most recent first)
 		{"$sort": bson.M{"created_at": -1}},
 
@@ -769,6 +1236,7 @@ func (r *FileRepository) ListPrivateFiles(ctx context.Context, userID string, pa
 			{"shared_with": userID},
 		},
 	}
+	filter = tenant.Scope(ctx, filter)
 
 	// Get total count
 	total, err := r.collection.CountDocuments(ctx, filter)
@@ -840,7 +1308,7 @@ func (r *FileRepository) GetPublicShare(ctx context.Context, fileID string) (*mo
 	err := r.shareCollection.FindOne(ctx, filter).Decode(&share)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("no active public share found for file")
+			return nil, ErrShareNotFound
 		}
 		return nil, fmt.Errorf("failed to get public share: %w", err)
 	}
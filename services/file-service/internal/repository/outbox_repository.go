@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxRetention is how long published events are kept, for troubleshooting, before
+// MongoDB expires them
+const outboxRetention = 7 * 24 * time.Hour
+
+// OutboxRepository stores the Kafka events waiting to be published. Events are written
+// in the same transaction as the file changes they describe, so a change is never made
+// without its event being published eventually.
+type OutboxRepository struct {
+	client       *mongo.Client
+	collection   *mongo.Collection
+	transactions bool
+}
+
+func NewOutboxRepository(db *mongo.Database) *OutboxRepository {
+	return &OutboxRepository{
+		client:     db.Client(),
+		collection: db.Collection("event_outbox"),
+	}
+}
+
+// EnsureIndexes creates the indexes the relay polls with, and expires published events
+func (r *OutboxRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "created_at", Value: 1},
+			},
+			Options: options.Index().SetName("status_created_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "published_at", Value: 1}},
+			Options: options.Index().SetName("published_ttl_idx").SetExpireAfterSeconds(int32(outboxRetention.Seconds())),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// DetectTransactions checks whether the MongoDB deployment supports multi-document
+// transactions, which require a replica set or a sharded cluster. Without them, changes
+// and their events are written one after the other instead of atomically.
+func (r *OutboxRepository) DetectTransactions(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := r.client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, err
+	}
+
+	r.transactions = hello.SetName != "" || hello.Msg == "isdbgrid"
+	return r.transactions, nil
+}
+
+// RunInTransaction runs fn in a MongoDB transaction if the deployment supports them, so
+// that the writes fn makes with the context it is given, including Enqueue, are applied
+// together or not at all. fn may be retried on transient errors.
+func (r *OutboxRepository) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !r.transactions {
+		return fn(ctx)
+	}
+
+	session, err := r.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// Enqueue validates a file event and records it to be published to Kafka, keyed by its
+// file
+func (r *OutboxRepository) Enqueue(ctx context.Context, event *events.FileEvent) error {
+	payload, err := events.Encode(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	_, err = r.collection.InsertOne(ctx, &models.OutboxEvent{
+		ID:            primitive.NewObjectID(),
+		EventType:     event.Type,
+		Key:           event.FileID,
+		Payload:       string(payload),
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: now,
+		LockedUntil:   now,
+		CreatedAt:     now,
+	})
+	return err
+}
+
+// ClaimNext locks the oldest event due for publishing for lease, and returns nil if
+// there is none. Events whose lease expires, because their relay stopped, are claimed
+// again.
+func (r *OutboxRepository) ClaimNext(ctx context.Context, lease time.Duration) (*models.OutboxEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"status":          models.OutboxStatusPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"locked_until":    bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var event models.OutboxEvent
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// MarkPublished records that Kafka accepted an event
+func (r *OutboxRepository) MarkPublished(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{
+			"status":       models.OutboxStatusPublished,
+			"published_at": time.Now(),
+		},
+	})
+	return err
+}
+
+// MarkFailed records a failed publish attempt and when to make the next one
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, reason string, nextAttempt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateByID(ctx, id, bson.M{
+		"$inc": bson.M{"attempts": 1},
+		"$set": bson.M{
+			"last_error":      reason,
+			"next_attempt_at": nextAttempt,
+			"locked_until":    time.Now(),
+		},
+	})
+	return err
+}
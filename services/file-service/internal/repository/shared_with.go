@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sharedWith is a file shared with a user by an active share. The shared_with collection
+// holds one per user and file, with the file's tenant and creation time copied from it,
+// so that the shared files page is an indexed query rather than a join of the shares with
+// the files. It is kept up to date as shares are made, claimed, deactivated and deleted
+// and as files are deleted, and can be rebuilt from the shares with BuildSharedWith.
+type sharedWith struct {
+	UserID        string             `bson:"user_id"`
+	FileID        primitive.ObjectID `bson:"file_id"`
+	TenantID      string             `bson:"tenant_id,omitempty"`
+	FileCreatedAt time.Time          `bson:"file_created_at"`
+	SharedAt      time.Time          `bson:"shared_at"`
+}
+
+// EnsureSharedWithIndexes creates the indexes of the shared_with collection: one entry
+// per user and file, and the order the shared files page lists them in
+func (r *FileRepository) EnsureSharedWithIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "file_id", Value: 1},
+			},
+			Options: options.Index().SetName("user_file_idx").SetUnique(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "tenant_id", Value: 1},
+				{Key: "file_created_at", Value: -1},
+			},
+			Options: options.Index().SetName("user_tenant_created_idx"),
+		},
+		{
+			Keys:    bson.D{{Key: "file_id", Value: 1}},
+			Options: options.Index().SetName("file_id_idx"),
+		},
+	}
+
+	_, err := r.sharedWithCollection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// BuildSharedWith adds the files shared with users that the shared_with collection is
+// missing, from the shares. Entries already there are kept.
+func (r *FileRepository) BuildSharedWith(ctx context.Context) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"shared_with_id": bson.M{"$nin": bson.A{"", nil}},
+			"is_active":      true,
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"file_oid": bson.M{"$convert": bson.M{
+				"input": "$file_id", "to": "objectId", "onError": nil, "onNull": nil,
+			}},
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "files",
+			"localField":   "file_oid",
+			"foreignField": "_id",
+			"as":           "file",
+		}}},
+		{{Key: "$unwind", Value: "$file"}},
+		{{Key: "$project", Value: bson.M{
+			"_id":             0,
+			"user_id":         "$shared_with_id",
+			"file_id":         "$file._id",
+			"tenant_id":       "$file.tenant_id",
+			"file_created_at": "$file.created_at",
+			"shared_at":       "$created_at",
+		}}},
+		{{Key: "$merge", Value: bson.M{
+			"into":           r.sharedWithCollection.Name(),
+			"on":             bson.A{"user_id", "file_id"},
+			"whenMatched":    "keepExisting",
+			"whenNotMatched": "insert",
+		}}},
+	}
+
+	cursor, err := r.shareCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.Close(ctx)
+}
+
+// addSharedWith records that the file with ID fileID is shared with userID. Shares made
+// to an email address without an account have no user yet, and are recorded when it is
+// claimed.
+func (r *FileRepository) addSharedWith(ctx context.Context, userID, fileID string, sharedAt time.Time) error {
+	if userID == "" {
+		return nil
+	}
+	objectID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return err
+	}
+
+	var file models.File
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID},
+		options.FindOne().SetProjection(bson.M{"tenant_id": 1, "created_at": 1}),
+	).Decode(&file)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	entry := sharedWith{
+		UserID:        userID,
+		FileID:        objectID,
+		TenantID:      file.TenantID,
+		FileCreatedAt: file.CreatedAt,
+		SharedAt:      sharedAt,
+	}
+	_, err = r.sharedWithCollection.UpdateOne(ctx,
+		bson.M{"user_id": userID, "file_id": objectID},
+		bson.M{"$setOnInsert": entry},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record file shared with user: %w", err)
+	}
+	return nil
+}
+
+// removeSharedWith records that the file with ID fileID is no longer shared with userID
+func (r *FileRepository) removeSharedWith(ctx context.Context, userID, fileID string) error {
+	if userID == "" {
+		return nil
+	}
+	objectID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.sharedWithCollection.DeleteOne(ctx, bson.M{"user_id": userID, "file_id": objectID})
+	return err
+}
+
+// removeFileSharedWith removes a deleted file from the shared files of every user
+func (r *FileRepository) removeFileSharedWith(ctx context.Context, fileID primitive.ObjectID) error {
+	_, err := r.sharedWithCollection.DeleteMany(ctx, bson.M{"file_id": fileID})
+	return err
+}
+
+// restoreSharedWith adds a restored file back to the shared files of the users its active
+// shares are made with
+func (r *FileRepository) restoreSharedWith(ctx context.Context, file *models.File) error {
+	cursor, err := r.shareCollection.Find(ctx, bson.M{
+		"file_id":        file.ID.Hex(),
+		"shared_with_id": bson.M{"$nin": bson.A{"", nil}},
+		"is_active":      true,
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var shares []*models.FileShare
+	if err = cursor.All(ctx, &shares); err != nil {
+		return err
+	}
+	for _, share := range shares {
+		if err := r.addSharedWith(ctx, share.SharedWithID, share.FileID, share.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindSharedWithUser returns a page of the files shared with userID, newest first, from
+// the shared_with collection, and how many there are
+func (r *FileRepository) FindSharedWithUser(ctx context.Context, userID string, page, limit int32) ([]*models.File, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	skip := (page - 1) * limit
+	filter := tenant.Scope(ctx, bson.M{"user_id": userID})
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "file_created_at", Value: -1}, {Key: "file_id", Value: -1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"file_id": 1})
+
+	cursor, err := r.sharedWithCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []sharedWith
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := r.sharedWithCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(entries) == 0 {
+		return []*models.File{}, total, nil
+	}
+
+	fileIDs := make([]primitive.ObjectID, len(entries))
+	for i, entry := range entries {
+		fileIDs[i] = entry.FileID
+	}
+
+	fileCursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": fileIDs}})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer fileCursor.Close(ctx)
+
+	var found []*models.File
+	if err = fileCursor.All(ctx, &found); err != nil {
+		return nil, 0, err
+	}
+
+	// Keep the order of the page
+	byID := make(map[primitive.ObjectID]*models.File, len(found))
+	for _, file := range found {
+		byID[file.ID] = file
+	}
+	files := make([]*models.File, 0, len(found))
+	for _, id := range fileIDs {
+		if file, ok := byID[id]; ok {
+			files = append(files, file)
+		}
+	}
+
+	return files, total, nil
+}
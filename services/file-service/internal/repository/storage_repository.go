@@ -6,6 +6,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -17,8 +18,18 @@ var (
 	ErrStorageStatsNotFound = errors.New("storage stats not found")
 )
 
+// usagePublishTimeout bounds publishing a change of a user's usage, which never fails the
+// change
+const usagePublishTimeout = 2 * time.Second
+
 type StorageRepository struct {
 	collection *mongo.Collection
+	publisher  UsagePublisher
+}
+
+// UsagePublisher publishes the storage usage of users as it changes
+type UsagePublisher interface {
+	PublishStorageUsage(ctx context.Context, usage *events.StorageUsage) error
 }
 
 func NewStorageRepository(db *mongo.Database) *StorageRepository {
@@ -27,6 +38,12 @@ func NewStorageRepository(db *mongo.Database) *StorageRepository {
 	}
 }
 
+// SetUsagePublisher enables publishing the usage of users after uploads, deletions,
+// reconciliation and quota changes change it, so that their clients don't poll for it
+func (r *StorageRepository) SetUsagePublisher(publisher UsagePublisher) {
+	r.publisher = publisher
+}
+
 // EnsureIndexes creates necessary database indexes for storage stats
 func (r *StorageRepository) EnsureIndexes(ctx context.Context) error {
 	indexes := []mongo.IndexModel{
@@ -93,8 +110,11 @@ func (r *StorageRepository) UpdateUsage(ctx context.Context, userID string, used
 		},
 	}
 
-	_, err := r.collection.UpdateOne(ctx, filter, update)
-	return err
+	if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	r.usageChanged(ctx, userID)
+	return nil
 }
 
 // AddUsage adds to storage usage for a user
@@ -119,8 +139,11 @@ func (r *StorageRepository) AddUsage(ctx context.Context, userID string, additio
 	}
 
 	opts := options.Update().SetUpsert(true)
-	_, err := r.collection.UpdateOne(ctx, filter, update, opts)
-	return err
+	if _, err := r.collection.UpdateOne(ctx, filter, update, opts); err != nil {
+		return err
+	}
+	r.usageChanged(ctx, userID)
+	return nil
 }
 
 // RemoveUsage removes from storage usage for a user
@@ -145,8 +168,29 @@ func (r *StorageRepository) RemoveUsage(ctx context.Context, userID string, remo
 	}
 
 	opts := options.Update().SetUpsert(true)
-	_, err := r.collection.UpdateOne(ctx, filter, update, opts)
-	return err
+	if _, err := r.collection.UpdateOne(ctx, filter, update, opts); err != nil {
+		return err
+	}
+	r.usageChanged(ctx, userID)
+	return nil
+}
+
+// ListAll returns the storage stats of every user
+func (r *StorageRepository) ListAll(ctx context.Context) ([]*models.StorageStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var stats []*models.StorageStats
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
 }
 
 // SetQuota sets storage quota for a user
@@ -162,37 +206,92 @@ func (r *StorageRepository) SetQuota(ctx context.Context, userID string, quotaBy
 		},
 	}
 
-	_, err := r.collection.UpdateOne(ctx, filter, update)
-	return err
+	if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+		return err
+	}
+	r.usageChanged(ctx, userID)
+	return nil
 }
 
-// CalculateUsageFromFiles calculates storage usage from actual files in the database
-func (r *StorageRepository) CalculateUsageFromFiles(ctx context.Context, userID string, fileRepo *FileRepository) (*models.StorageStats, error) {
+// usageChanged publishes a user's usage after it changed. Failures are logged only: the
+// usage is still served by GetUsage.
+func (r *StorageRepository) usageChanged(ctx context.Context, userID string) {
+	if r.publisher == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), usagePublishTimeout)
+	defer cancel()
+
+	var stats models.StorageStats
+	if err := r.collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&stats); err != nil {
+		log.Printf("Error reading storage usage of user %s to publish: %v", userID, err)
+		return
+	}
+	err := r.publisher.PublishStorageUsage(ctx, &events.StorageUsage{
+		UserID:     userID,
+		UsedBytes:  stats.UsedBytes,
+		QuotaBytes: stats.QuotaBytes,
+		FileCount:  stats.FileCount,
+		Timestamp:  time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error publishing storage usage of user %s: %v", userID, err)
+	}
+}
+
+// GetUsage returns a user's storage stats, kept up to date as files are uploaded and
+// deleted, for requests to read instead of computing them from the files. The stats of
+// users without any yet are computed from their files once.
+func (r *StorageRepository) GetUsage(ctx context.Context, userID string, fileRepo *FileRepository) (*models.StorageStats, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	// Get all files for the user
-	files, _, err := fileRepo.FindByOwner(ctx, userID, 1, 10000) // Get up to 10k files
+	var stats models.StorageStats
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&stats)
+	if err == nil {
+		return &stats, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	usage, err := fileRepo.UsageOfOwner(ctx, userID)
 	if err != nil {
-		log.Printf("Error finding files for user %s: %v", userID, err)
 		return nil, err
 	}
 
-	log.Printf("Found %d files for user %s", len(files), userID)
+	// Usage recorded meanwhile by an upload or deletion is kept: it was counted from the
+	// files as well
+	now := time.Now()
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"user_id":     userID,
+			"used_bytes":  usage.UsedBytes,
+			"file_count":  usage.FileCount,
+			"quota_bytes": 100 * 1024 * 1024 * 1024, // 100GB default quota
+			"created_at":  now,
+			"updated_at":  now,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"user_id": userID}, update, opts).Decode(&stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
 
-	var totalBytes int64
-	var fileCount int64
+// CalculateUsageFromFiles recomputes a user's storage usage from their available files
+// and records it
+func (r *StorageRepository) CalculateUsageFromFiles(ctx context.Context, userID string, fileRepo *FileRepository) (*models.StorageStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-	for _, file := range files {
-		log.Printf("File: %s, Size: %d, Status: %s", file.Name, file.Size, file.Status)
-		if file.Status == models.FileStatusAvailable {
-			totalBytes += file.Size
-			fileCount++
-		}
+	usage, err := fileRepo.UsageOfOwner(ctx, userID)
+	if err != nil {
+		log.Printf("Error calculating storage usage of user %s: %v", userID, err)
+		return nil, err
 	}
 
-	log.Printf("Calculated storage for user %s: %d bytes, %d files", userID, totalBytes, fileCount)
-
 	// Get or create storage stats
 	stats, err := r.GetOrCreate(ctx, userID)
 	if err != nil {
@@ -201,8 +300,8 @@ func (r *StorageRepository) CalculateUsageFromFiles(ctx context.Context, userID
 	}
 
 	// Update with calculated values
-	stats.UsedBytes = totalBytes
-	stats.FileCount = fileCount
+	stats.UsedBytes = usage.UsedBytes
+	stats.FileCount = usage.FileCount
 	stats.UpdatedAt = time.Now()
 
 	// Save updated stats
@@ -219,6 +318,7 @@ func (r *StorageRepository) CalculateUsageFromFiles(ctx context.Context, userID
 	if err != nil {
 		return nil, err
 	}
+	r.usageChanged(ctx, userID)
 
 	return stats, nil
 }
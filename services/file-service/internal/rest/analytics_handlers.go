@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+)
+
+// AnalyticsHandlers handles the storage and sharing statistics of the admin analytics,
+// for operators holding the analytics API token
+type AnalyticsHandlers struct {
+	fileRepo *repository.FileRepository
+	token    string
+	logger   *logrus.Logger
+}
+
+// NewAnalyticsHandlers creates new analytics handlers
+func NewAnalyticsHandlers(fileRepo *repository.FileRepository, token string, logger *logrus.Logger) *AnalyticsHandlers {
+	return &AnalyticsHandlers{
+		fileRepo: fileRepo,
+		token:    token,
+		logger:   logger,
+	}
+}
+
+// GetStats returns the storage used and the active shares, of every tenant or of the
+// tenant in X-Tenant-ID
+// GET /api/v1/admin/stats
+func (h *AnalyticsHandlers) GetStats(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	storage, err := h.fileRepo.StorageTotals(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to compute storage totals")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to compute storage totals")
+		return
+	}
+	shares, err := h.fileRepo.CountActiveShares(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to count active shares")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to count active shares")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"storage_used_bytes": storage.UsedBytes,
+		"files":              storage.FileCount,
+		"active_shares":      shares,
+		"generated_at":       time.Now().UTC(),
+	})
+}
+
+// RegisterRoutes registers all analytics routes
+func (h *AnalyticsHandlers) RegisterRoutes(router *gin.RouterGroup) {
+	admin := router.Group("/admin", ginmw.BearerToken(h.token))
+	{
+		admin.GET("/stats", h.GetStats)
+	}
+}
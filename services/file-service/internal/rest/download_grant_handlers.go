@@ -0,0 +1,144 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+)
+
+// redeemedURLExpiry is how long the presigned URL a single-use link redirects to works:
+// long enough for the browser to follow the redirect, too short to be worth passing on
+const redeemedURLExpiry = time.Minute
+
+// URLPresigner issues presigned URLs for the content of files
+type URLPresigner interface {
+	GeneratePresignedDownloadURL(ctx context.Context, objectName string, expiry time.Duration) (string, error)
+}
+
+// DownloadGrantHandlers redeems the single-use download links GetDownloadURL issues.
+// A link works once: whoever redeems it first is redirected to a presigned URL of the
+// file, and anyone who gets hold of it afterwards is turned away.
+type DownloadGrantHandlers struct {
+	grants    *repository.DownloadGrantRepository
+	fileRepo  *repository.FileRepository
+	presigner URLPresigner
+	logger    *logrus.Logger
+}
+
+// NewDownloadGrantHandlers creates new download grant handlers. A nil presigner, while
+// MinIO is unavailable, rejects redemptions with 503 without using up the link.
+func NewDownloadGrantHandlers(grants *repository.DownloadGrantRepository, fileRepo *repository.FileRepository, presigner URLPresigner, logger *logrus.Logger) *DownloadGrantHandlers {
+	return &DownloadGrantHandlers{
+		grants:    grants,
+		fileRepo:  fileRepo,
+		presigner: presigner,
+		logger:    logger,
+	}
+}
+
+// RedeemDownload redeems a single-use download link, redirecting to a presigned URL of
+// the file that expires within a minute. The link needs no authentication, but the user
+// it was issued to must still have access to the file. Links that fail to be served for
+// reasons of the service's own are released, so that they can be retried.
+// GET /api/v1/downloads/:token
+func (h *DownloadGrantHandlers) RedeemDownload(c *gin.Context) {
+	if h.presigner == nil {
+		apierror.Abort(c, http.StatusServiceUnavailable, "Storage service is temporarily unavailable")
+		return
+	}
+
+	grant, err := h.grants.Redeem(c.Request.Context(), c.Param("token"), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, repository.ErrDownloadGrantInvalid) {
+			apierror.Abort(c, http.StatusGone, "The download link is invalid, expired or was already used")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to redeem download link")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to redeem download link")
+		return
+	}
+
+	logger := h.logger.WithFields(logrus.Fields{
+		"grant_id": grant.ID.Hex(),
+		"file_id":  grant.FileID,
+		"user_id":  grant.UserID,
+	})
+
+	// The file is looked up in the tenant the link was issued in
+	ctx := tenant.WithID(c.Request.Context(), grant.TenantID)
+
+	file, ok := h.redeemableFile(ctx, c, logger, grant)
+	if !ok {
+		return
+	}
+
+	url, err := h.presigner.GeneratePresignedDownloadURL(ctx, file.StoragePath, redeemedURLExpiry)
+	if err != nil {
+		logger.WithError(err).Error("Failed to generate download URL for redeemed link")
+		h.release(c, logger, grant)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to generate download URL")
+		return
+	}
+
+	logger.Info("Single-use download link redeemed")
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Redirect(http.StatusFound, url)
+}
+
+// redeemableFile returns the file of a redeemed grant, responding with the error if it
+// was deleted since, or the user it was issued to lost access to it
+func (h *DownloadGrantHandlers) redeemableFile(ctx context.Context, c *gin.Context, logger *logrus.Entry, grant *models.DownloadGrant) (*models.File, bool) {
+	file, err := h.fileRepo.FindByID(ctx, grant.FileID)
+	if err != nil {
+		if errors.Is(err, repository.ErrFileNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "File not found")
+			return nil, false
+		}
+		logger.WithError(err).Error("Failed to find file of download link")
+		h.release(c, logger, grant)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return nil, false
+	}
+	if file.DeletedAt != nil || file.Status != models.FileStatusAvailable {
+		apierror.Abort(c, http.StatusNotFound, "File not found")
+		return nil, false
+	}
+
+	hasPermission, err := h.fileRepo.CheckDownloadPermission(ctx, grant.FileID, grant.UserID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to check download permission")
+		h.release(c, logger, grant)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to check permissions")
+		return nil, false
+	}
+	if !hasPermission {
+		logger.Warn("Download link redeemed after access to the file was revoked")
+		apierror.Abort(c, http.StatusForbidden, "You no longer have access to this file")
+		return nil, false
+	}
+	return file, true
+}
+
+// release undoes the redemption of grant after a failure to serve it. It outlives the
+// request, since the client may have given up on it by now.
+func (h *DownloadGrantHandlers) release(c *gin.Context, logger *logrus.Entry, grant *models.DownloadGrant) {
+	if err := h.grants.Release(context.WithoutCancel(c.Request.Context()), grant); err != nil {
+		logger.WithError(err).Error("Failed to release download link")
+	}
+}
+
+// RegisterRoutes registers the download link routes, which require no authentication
+func (h *DownloadGrantHandlers) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/downloads/:token", h.RedeemDownload)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
 
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/service"
@@ -34,17 +35,14 @@ func (h *PrivateFolderHandlers) SetPIN(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	err := h.service.SetPIN(c.Request.Context(), req.UserID, req.PIN)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to set PIN")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
+		apierror.Abort(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -63,7 +61,7 @@ func (h *PrivateFolderHandlers) ValidatePIN(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -77,10 +75,7 @@ func (h *PrivateFolderHandlers) ValidatePIN(c *gin.Context) {
 	resp, err := h.service.ValidatePIN(c.Request.Context(), pinReq)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to validate PIN")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Internal server error",
-		})
+		apierror.Abort(c, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -107,7 +102,7 @@ func (h *PrivateFolderHandlers) MakeFilePrivate(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -120,10 +115,7 @@ func (h *PrivateFolderHandlers) MakeFilePrivate(c *gin.Context) {
 	resp, err := h.service.MakeFilePrivate(c.Request.Context(), makePrivateReq)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to make file private")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Internal server error",
-		})
+		apierror.Abort(c, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -149,17 +141,14 @@ func (h *PrivateFolderHandlers) RemoveFileFromPrivate(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	resp, err := h.service.RemoveFileFromPrivate(c.Request.Context(), req.UserID, req.FileID, req.PIN)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to remove file from private folder")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Internal server error",
-		})
+		apierror.Abort(c, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -180,7 +169,7 @@ func (h *PrivateFolderHandlers) RemoveFileFromPrivate(c *gin.Context) {
 func (h *PrivateFolderHandlers) GetPrivateFiles(c *gin.Context) {
 	userID := c.Query("user_id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		apierror.Abort(c, http.StatusBadRequest, "user_id is required")
 		return
 	}
 
@@ -189,23 +178,20 @@ func (h *PrivateFolderHandlers) GetPrivateFiles(c *gin.Context) {
 
 	limit, err := strconv.ParseInt(limitStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit parameter"})
+		apierror.Abort(c, http.StatusBadRequest, "invalid limit parameter")
 		return
 	}
 
 	offset, err := strconv.ParseInt(offsetStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset parameter"})
+		apierror.Abort(c, http.StatusBadRequest, "invalid offset parameter")
 		return
 	}
 
 	resp, err := h.service.GetPrivateFiles(c.Request.Context(), userID, limit, offset)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get private files")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Internal server error",
-		})
+		apierror.Abort(c, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -222,24 +208,21 @@ func (h *PrivateFolderHandlers) GetPrivateFiles(c *gin.Context) {
 func (h *PrivateFolderHandlers) GetAccessLogs(c *gin.Context) {
 	userID := c.Query("user_id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		apierror.Abort(c, http.StatusBadRequest, "user_id is required")
 		return
 	}
 
 	limitStr := c.DefaultQuery("limit", "50")
 	limit, err := strconv.ParseInt(limitStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit parameter"})
+		apierror.Abort(c, http.StatusBadRequest, "invalid limit parameter")
 		return
 	}
 
 	logs, err := h.service.GetAccessLogs(c.Request.Context(), userID, limit)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get access logs")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Internal server error",
-		})
+		apierror.Abort(c, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -257,17 +240,14 @@ func (h *PrivateFolderHandlers) CheckFileAccess(c *gin.Context) {
 	fileID := c.Query("file_id")
 
 	if userID == "" || fileID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id and file_id are required"})
+		apierror.Abort(c, http.StatusBadRequest, "user_id and file_id are required")
 		return
 	}
 
 	hasAccess, err := h.service.CheckFileAccess(c.Request.Context(), userID, fileID)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to check file access")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"has_access": false,
-			"message":    "Internal server error",
-		})
+		apierror.Abort(c, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -0,0 +1,360 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/cache"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+)
+
+const (
+	// sharePasswordHeader carries the password of a link share that has one
+	sharePasswordHeader = "X-Share-Password"
+	// ownerLookupTimeout bounds looking up the owner's name, which the landing page is
+	// served without
+	ownerLookupTimeout = 2 * time.Second
+	// sharePasswordAttempts is the number of password attempts allowed for a share from
+	// one client IP per sharePasswordWindow
+	sharePasswordAttempts = 10
+	sharePasswordWindow   = 15 * time.Minute
+)
+
+// previewTypes are the content types the browser is let render inline. Anything that can
+// run script, such as HTML and SVG, is downloaded instead.
+var previewTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// ObjectReader reads the content of files
+type ObjectReader interface {
+	GetObject(ctx context.Context, objectName string) (*minio.Object, error)
+}
+
+// AttemptCounter counts attempts in fixed windows
+type AttemptCounter interface {
+	CountAttempt(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+}
+
+// OwnerDirectory looks up the names shown for the owners of shared files
+type OwnerDirectory interface {
+	DisplayName(ctx context.Context, userID string) (string, error)
+}
+
+// PublicShareHandlers serves the landing page of link shares to visitors without an
+// account: the metadata of the shared file, and its content through short-lived download
+// links signed for the share, so that the link stops working as soon as the share is
+// deactivated, deleted or expires
+type PublicShareHandlers struct {
+	fileRepo *repository.FileRepository
+	objects  ObjectReader
+	owners   OwnerDirectory
+	attempts AttemptCounter
+	secret   []byte
+	linkTTL  time.Duration
+	logger   *logrus.Logger
+}
+
+// NewPublicShareHandlers creates new public share handlers. Download links are signed
+// with secret and valid for linkTTL. A nil objects, while MinIO is unavailable, rejects
+// downloads with 503; a nil owners leaves the owner's name out. Password attempts are
+// throttled through attempts while Redis is available.
+func NewPublicShareHandlers(fileRepo *repository.FileRepository, objects ObjectReader, owners OwnerDirectory, attempts AttemptCounter, secret string, linkTTL time.Duration, logger *logrus.Logger) *PublicShareHandlers {
+	return &PublicShareHandlers{
+		fileRepo: fileRepo,
+		objects:  objects,
+		owners:   owners,
+		attempts: attempts,
+		secret:   []byte(secret),
+		linkTTL:  linkTTL,
+		logger:   logger,
+	}
+}
+
+// GetSharedFile returns the metadata of a file shared by link and the links to download
+// and preview it. Shares with a password require it in the X-Share-Password header, and
+// the attempts at it are limited per client IP.
+// GET /api/v1/shared/:file_id
+func (h *PublicShareHandlers) GetSharedFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	fileID := c.Param("file_id")
+
+	share, file, ok := h.sharedFile(c, fileID)
+	if !ok {
+		return
+	}
+
+	if share.PasswordHash != "" {
+		password := c.GetHeader(sharePasswordHeader)
+		if password == "" {
+			apierror.AbortWith(c, http.StatusUnauthorized,
+				apierror.New(apierror.CodeForStatus(http.StatusUnauthorized), "This share is protected by a password").
+					WithDetails(gin.H{"password_required": true}))
+			return
+		}
+		if !h.allowPasswordAttempt(c, share.ID.Hex()) {
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil {
+			apierror.Abort(c, http.StatusForbidden, "Incorrect password")
+			return
+		}
+	}
+
+	expiresAt := time.Now().Add(h.linkTTL)
+	token := h.signDownload(fileID, share.ID.Hex(), expiresAt)
+	downloadURL := fmt.Sprintf("/api/v1/shared/%s/download?token=%s", url.PathEscape(fileID), url.QueryEscape(token))
+
+	response := gin.H{
+		"file_id":         fileID,
+		"name":            file.Name,
+		"size":            file.Size,
+		"mime_type":       file.MimeType,
+		"owner_name":      h.ownerName(ctx, file.OwnerID),
+		"created_at":      file.CreatedAt,
+		"permission":      strings.TrimPrefix(string(share.Permission), "PERMISSION_"),
+		"has_password":    share.PasswordHash != "",
+		"is_valid":        true,
+		"is_expired":      false,
+		"download_url":    downloadURL,
+		"link_expires_at": expiresAt,
+	}
+	if share.ExpiryTime != nil {
+		response["expiry_time"] = share.ExpiryTime
+	}
+	if isPreviewable(file.MimeType) {
+		response["preview_url"] = downloadURL + "&inline=1"
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadSharedFile streams the content of a file shared by link, with a token from
+// GetSharedFile. With inline=1, previewable types are served for the browser to render.
+// GET /api/v1/shared/:file_id/download
+func (h *PublicShareHandlers) DownloadSharedFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	fileID := c.Param("file_id")
+
+	shareID, ok := h.verifyDownload(fileID, c.Query("token"))
+	if !ok {
+		apierror.Abort(c, http.StatusForbidden, "The download link is invalid or has expired")
+		return
+	}
+
+	// The share the link was issued for must still be in force
+	share, err := h.fileRepo.FindShareByID(ctx, shareID)
+	if err != nil && !errors.Is(err, repository.ErrShareNotFound) {
+		h.logger.WithError(err).WithField("share_id", shareID).Error("Failed to find public share")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find share")
+		return
+	}
+	if err != nil || !isPublicShareOf(share, fileID) {
+		apierror.Abort(c, http.StatusForbidden, "The download link is invalid or has expired")
+		return
+	}
+
+	file, ok := h.availableFile(c, fileID)
+	if !ok {
+		return
+	}
+
+	if h.objects == nil {
+		apierror.Abort(c, http.StatusServiceUnavailable, "Storage service is temporarily unavailable")
+		return
+	}
+
+	object, err := h.objects.GetObject(ctx, file.StoragePath)
+	if err != nil {
+		h.logger.WithError(err).WithField("file_id", fileID).Error("Failed to get shared object from MinIO")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to retrieve file")
+		return
+	}
+	defer object.Close()
+
+	stat, err := object.Stat()
+	if err != nil {
+		h.logger.WithError(err).WithField("storage_path", file.StoragePath).Error("Failed to stat shared object in MinIO")
+		apierror.Abort(c, http.StatusInternalServerError, "File content not found in storage")
+		return
+	}
+
+	disposition := "attachment"
+	if c.Query("inline") == "1" && isPreviewable(file.MimeType) {
+		disposition = "inline"
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, no-store")
+	c.DataFromReader(http.StatusOK, stat.Size, file.MimeType, object, nil)
+
+	h.logger.WithFields(logrus.Fields{
+		"file_id":  fileID,
+		"share_id": shareID,
+		"inline":   disposition == "inline",
+	}).Info("Shared file download stream initiated")
+}
+
+// sharedFile returns the active link share of the file with ID fileID and the file,
+// responding with the error if there is none or the file can't be served
+func (h *PublicShareHandlers) sharedFile(c *gin.Context, fileID string) (*models.FileShare, *models.File, bool) {
+	share, err := h.fileRepo.GetPublicShare(c.Request.Context(), fileID)
+	if err != nil {
+		if errors.Is(err, repository.ErrShareNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "This link is invalid, expired or no longer shared")
+			return nil, nil, false
+		}
+		h.logger.WithError(err).WithField("file_id", fileID).Error("Failed to find public share")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find share")
+		return nil, nil, false
+	}
+
+	file, ok := h.availableFile(c, fileID)
+	if !ok {
+		return nil, nil, false
+	}
+	return share, file, true
+}
+
+// allowPasswordAttempt counts an attempt at the password of the share with ID shareID
+// from the client's IP, responding with 429 if it exceeds the limit. Attempts aren't
+// limited while Redis is unavailable.
+func (h *PublicShareHandlers) allowPasswordAttempt(c *gin.Context, shareID string) bool {
+	if h.attempts == nil {
+		return true
+	}
+
+	count, retryAfter, err := h.attempts.CountAttempt(c.Request.Context(), "share-password:"+shareID+":"+c.ClientIP(), sharePasswordWindow)
+	if err != nil {
+		if !errors.Is(err, cache.ErrCacheDisabled) {
+			h.logger.WithError(err).WithField("share_id", shareID).Warn("Failed to count share password attempt")
+		}
+		return true
+	}
+	if count > sharePasswordAttempts {
+		seconds := int64((retryAfter + time.Second - 1) / time.Second)
+		c.Header("Retry-After", strconv.FormatInt(max(seconds, 1), 10))
+		apierror.Abort(c, http.StatusTooManyRequests, "Too many password attempts. Please try again later.")
+		return false
+	}
+	return true
+}
+
+// availableFile returns the file with ID fileID, responding with the error if it can't
+// be served: trashed files and unfinished uploads are not found. Visitors aren't served
+// for a tenant, as the link share decides what they can see, so the file is looked up in
+// whichever tenant it belongs to.
+func (h *PublicShareHandlers) availableFile(c *gin.Context, fileID string) (*models.File, bool) {
+	file, err := h.fileRepo.FindByIDInAnyTenant(c.Request.Context(), fileID)
+	if err != nil {
+		if errors.Is(err, repository.ErrFileNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "This link is invalid, expired or no longer shared")
+			return nil, false
+		}
+		h.logger.WithError(err).WithField("file_id", fileID).Error("Failed to find shared file")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return nil, false
+	}
+	if file.DeletedAt != nil || file.Status != models.FileStatusAvailable {
+		apierror.Abort(c, http.StatusNotFound, "This link is invalid, expired or no longer shared")
+		return nil, false
+	}
+	return file, true
+}
+
+// isPublicShareOf reports whether share is an active, unexpired link share of the file
+// with ID fileID
+func isPublicShareOf(share *models.FileShare, fileID string) bool {
+	if share.FileID != fileID || !share.IsActive || share.SharedWithID != "" || share.SharedWithEmail != "" {
+		return false
+	}
+	return share.ExpiryTime == nil || share.ExpiryTime.After(time.Now())
+}
+
+// ownerName returns the name shown for the owner of a shared file, empty if it can't be
+// looked up in time
+func (h *PublicShareHandlers) ownerName(ctx context.Context, ownerID string) string {
+	if h.owners == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, ownerLookupTimeout)
+	defer cancel()
+
+	name, err := h.owners.DisplayName(ctx, ownerID)
+	if err != nil {
+		h.logger.WithError(err).WithField("owner_id", ownerID).Debug("Failed to look up the owner of a shared file")
+		return ""
+	}
+	return name
+}
+
+// signDownload returns a token allowing the download of the file with ID fileID through
+// the share with ID shareID until expiresAt: "<share ID>.<expiry>.<signature>"
+func (h *PublicShareHandlers) signDownload(fileID, shareID string, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return shareID + "." + expiry + "." + h.signature(fileID, shareID, expiry)
+}
+
+// verifyDownload returns the share a download token of the file with ID fileID was
+// issued for, if it is authentic and hasn't expired
+func (h *PublicShareHandlers) verifyDownload(fileID, token string) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	shareID, expiry, signature := parts[0], parts[1], parts[2]
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(h.signature(fileID, shareID, expiry))) {
+		return "", false
+	}
+	return shareID, true
+}
+
+func (h *PublicShareHandlers) signature(fileID, shareID, expiry string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte("shared-download:" + fileID + ":" + shareID + ":" + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// isPreviewable reports whether files of mimeType can be rendered inline
+func isPreviewable(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	return previewTypes[mediaType] || strings.HasPrefix(mediaType, "video/") || strings.HasPrefix(mediaType, "audio/")
+}
+
+// RegisterRoutes registers the public share routes, which require no authentication
+func (h *PublicShareHandlers) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/shared/:file_id", h.GetSharedFile)
+	router.GET("/shared/:file_id/download", h.DownloadSharedFile)
+}
@@ -0,0 +1,53 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/service"
+)
+
+// ReconciliationHandlers handles the reconciliation REST endpoints, for operators
+// holding the reconciliation API token
+type ReconciliationHandlers struct {
+	reconciler *service.Reconciler
+	token      string
+}
+
+// NewReconciliationHandlers creates new reconciliation handlers
+func NewReconciliationHandlers(reconciler *service.Reconciler, token string) *ReconciliationHandlers {
+	return &ReconciliationHandlers{
+		reconciler: reconciler,
+		token:      token,
+	}
+}
+
+// GetReport returns the latest reconciliation report
+// GET /api/v1/admin/reconciliation
+func (h *ReconciliationHandlers) GetReport(c *gin.Context) {
+	report := h.reconciler.LastReport()
+	if report == nil {
+		apierror.Abort(c, http.StatusNotFound, "No reconciliation has run yet")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Reconcile runs a reconciliation and returns its report
+// POST /api/v1/admin/reconciliation
+func (h *ReconciliationHandlers) Reconcile(c *gin.Context) {
+	c.JSON(http.StatusOK, h.reconciler.Reconcile(c.Request.Context()))
+}
+
+// RegisterRoutes registers all reconciliation routes
+func (h *ReconciliationHandlers) RegisterRoutes(router *gin.RouterGroup) {
+	admin := router.Group("/admin", ginmw.BearerToken(h.token))
+	{
+		admin.GET("/reconciliation", h.GetReport)
+		admin.POST("/reconciliation", h.Reconcile)
+	}
+}
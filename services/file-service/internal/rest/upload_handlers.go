@@ -0,0 +1,238 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+)
+
+const (
+	// progressInterval is how often the progress of an upload is published
+	progressInterval = 500 * time.Millisecond
+	// progressPublishTimeout bounds publishing an update, which never fails the upload
+	progressPublishTimeout = 2 * time.Second
+	// maxUploadDuration bounds receiving the content of requests without a deadline
+	maxUploadDuration = 30 * time.Minute
+)
+
+// ObjectUploader stores the content of uploads
+type ObjectUploader interface {
+	UploadFile(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+}
+
+// ProgressPublisher publishes the progress of uploads
+type ProgressPublisher interface {
+	PublishUploadProgress(ctx context.Context, progress *events.UploadProgress) error
+}
+
+// UploadHandlers receives the content of uploads through the file-service, for clients
+// that don't upload to the presigned URL directly, and publishes their progress as it
+// arrives so that the uploader sees it over the notification WebSocket
+type UploadHandlers struct {
+	fileRepo  *repository.FileRepository
+	storage   ObjectUploader
+	progress  ProgressPublisher
+	jwtSecret string
+	logger    *logrus.Logger
+}
+
+// NewUploadHandlers creates new upload handlers. A nil storage, while MinIO is
+// unavailable, rejects uploads with 503.
+func NewUploadHandlers(fileRepo *repository.FileRepository, storage ObjectUploader, progress ProgressPublisher, jwtSecret string, logger *logrus.Logger) *UploadHandlers {
+	return &UploadHandlers{
+		fileRepo:  fileRepo,
+		storage:   storage,
+		progress:  progress,
+		jwtSecret: jwtSecret,
+		logger:    logger,
+	}
+}
+
+// UploadContent receives the content of an upload session, as the request body or as the
+// "file" part of a multipart form, and stores it. The upload is then completed as it is
+// after uploading to the presigned URL.
+// PUT /api/v1/files/:id/content
+func (h *UploadHandlers) UploadContent(c *gin.Context) {
+	ctx := c.Request.Context()
+	fileID := c.Param("id")
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		apierror.Abort(c, http.StatusUnauthorized, "Authorization header required")
+		return
+	}
+	userID, err := jwtauth.NewValidator(h.jwtSecret).ExtractUserID(token)
+	if err != nil {
+		apierror.Abort(c, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+
+	if h.storage == nil {
+		apierror.Abort(c, http.StatusServiceUnavailable, "Storage service is temporarily unavailable")
+		return
+	}
+
+	file, err := h.fileRepo.FindByID(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, repository.ErrFileNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "File not found")
+			return
+		}
+		h.logger.WithError(err).WithField("file_id", fileID).Error("Failed to find file")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return
+	}
+	if file.OwnerID != userID {
+		apierror.Abort(c, http.StatusForbidden, "access denied")
+		return
+	}
+	if file.Status != models.FileStatusUploading {
+		apierror.Abort(c, http.StatusConflict, "The upload of this file is already complete")
+		return
+	}
+
+	body, size, err := uploadBody(c.Request)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if size >= 0 && size != file.Size {
+		apierror.Abort(c, http.StatusBadRequest, "Content length doesn't match the size of the upload")
+		return
+	}
+
+	// Large files take longer to arrive than the server's read timeout allows, so the
+	// request's deadline bounds them instead
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(maxUploadDuration)
+	}
+	if err := http.NewResponseController(c.Writer).SetReadDeadline(deadline); err != nil {
+		h.logger.WithError(err).Debug("Failed to extend the read deadline of an upload")
+	}
+
+	logger := h.logger.WithFields(logrus.Fields{
+		"file_id": fileID,
+		"user_id": userID,
+		"size":    file.Size,
+	})
+	reader := &progressReader{
+		reader: body,
+		progress: events.UploadProgress{
+			UploadID:   fileID,
+			FileName:   file.Name,
+			UserID:     userID,
+			TotalBytes: file.Size,
+			TenantID:   tenant.ID(ctx),
+		},
+		publish: h.publish,
+	}
+
+	if err := h.storage.UploadFile(ctx, file.StoragePath, reader, file.Size, file.MimeType); err != nil {
+		logger.WithError(err).Error("Failed to store upload content")
+		reader.finish("upload failed")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to store file content")
+		return
+	}
+	reader.finish("")
+
+	logger.Info("Upload content received")
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":        fileID,
+		"bytes_received": reader.progress.BytesTransferred,
+		"message":        "Upload received. Complete the upload to finish it.",
+	})
+}
+
+// publish publishes an update of the progress of an upload. Failures are logged only:
+// progress is informational, and Redis may be disabled.
+func (h *UploadHandlers) publish(progress *events.UploadProgress) {
+	if h.progress == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), progressPublishTimeout)
+	defer cancel()
+	if err := h.progress.PublishUploadProgress(ctx, progress); err != nil {
+		h.logger.WithError(err).WithField("file_id", progress.UploadID).Debug("Failed to publish upload progress")
+	}
+}
+
+// uploadBody returns the content of an upload and its size, or -1 if it isn't known
+// before it is read: the "file" part of multipart forms, and the request body otherwise
+func uploadBody(r *http.Request) (io.Reader, int64, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, r.ContentLength, nil
+	}
+
+	form, err := r.MultipartReader()
+	if err != nil {
+		return nil, 0, errors.New("invalid multipart form")
+	}
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			return nil, 0, errors.New("the multipart form has no file part")
+		}
+		if err != nil {
+			return nil, 0, errors.New("invalid multipart form")
+		}
+		if part.FormName() == "file" {
+			return part, -1, nil
+		}
+	}
+}
+
+// progressReader counts the bytes of an upload as they are read, publishing the progress
+// every progressInterval
+type progressReader struct {
+	reader        io.Reader
+	progress      events.UploadProgress
+	publish       func(progress *events.UploadProgress)
+	lastPublished time.Time
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.progress.BytesTransferred += int64(n)
+	if time.Since(r.lastPublished) >= progressInterval {
+		r.send()
+	}
+	return n, err
+}
+
+// finish publishes the last update of the upload, failed with reason if it isn't empty
+func (r *progressReader) finish(reason string) {
+	r.progress.Done = true
+	r.progress.Error = reason
+	r.send()
+}
+
+func (r *progressReader) send() {
+	r.lastPublished = time.Now()
+	r.progress.Timestamp = r.lastPublished
+	if r.progress.TotalBytes > 0 {
+		r.progress.Percent = float64(r.progress.BytesTransferred) * 100 / float64(r.progress.TotalBytes)
+	}
+	progress := r.progress
+	r.publish(&progress)
+}
+
+// RegisterRoutes registers the upload routes
+func (h *UploadHandlers) RegisterRoutes(router *gin.RouterGroup) {
+	router.PUT("/files/:id/content", h.UploadContent)
+}
@@ -0,0 +1,398 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/kafka"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+)
+
+const (
+	// deletionLease is how long a runner holds a deletion before another may resume it,
+	// comfortably longer than deletionTimeout
+	deletionLease = 2 * time.Minute
+	// deletionTimeout bounds one attempt at a deletion resumed in the background
+	deletionTimeout = time.Minute
+	// deletionMaxBackoff caps the delay between attempts at a failing step
+	deletionMaxBackoff = 5 * time.Minute
+)
+
+// ErrObjectStorageUnavailable is returned when the service started without object storage
+var ErrObjectStorageUnavailable = errors.New("object storage is unavailable")
+
+// ObjectStore is the object storage file contents are kept in
+type ObjectStore interface {
+	DeleteFile(ctx context.Context, objectName string) error
+	ListObjects(ctx context.Context) <-chan minio.ObjectInfo
+}
+
+// deletionStep is a step of a file deletion, and how to undo it if it can be undone
+type deletionStep struct {
+	name string
+	do   func(ctx context.Context, saga *models.DeletionSaga) error
+	undo func(ctx context.Context, saga *models.DeletionSaga) error
+	// local steps only write to MongoDB, so they are recorded in the same transaction
+	// where transactions are supported
+	local bool
+}
+
+// DeletionSagaService deletes files as a saga: the file record is removed, the owner's
+// storage usage released and the file deleted event recorded, then the object is
+// removed from storage. Each step is recorded as it is made, so a deletion interrupted
+// by a failure or a restart is resumed by Run. Steps are retried with backoff; if one
+// before the event keeps failing, the steps made are undone and the file restored, and
+// once the event is recorded the object's removal is retried until it succeeds.
+type DeletionSagaService struct {
+	sagas       *repository.DeletionSagaRepository
+	fileRepo    *repository.FileRepository
+	storageRepo *repository.StorageRepository
+	outbox      *repository.OutboxRepository
+	objects     ObjectStore
+	maxAttempts int
+	logger      *logrus.Logger
+	steps       []deletionStep
+}
+
+// NewDeletionSagaService creates a deletion saga service. objects may be nil if object
+// storage is unavailable, in which case objects are removed once it is.
+func NewDeletionSagaService(
+	sagas *repository.DeletionSagaRepository,
+	fileRepo *repository.FileRepository,
+	storageRepo *repository.StorageRepository,
+	outbox *repository.OutboxRepository,
+	objects ObjectStore,
+	maxAttempts int,
+	logger *logrus.Logger,
+) *DeletionSagaService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	s := &DeletionSagaService{
+		sagas:       sagas,
+		fileRepo:    fileRepo,
+		storageRepo: storageRepo,
+		outbox:      outbox,
+		objects:     objects,
+		maxAttempts: maxAttempts,
+		logger:      logger,
+	}
+	s.steps = []deletionStep{
+		{name: models.DeletionStepRemoveFile, do: s.removeFile, undo: s.restoreFile, local: true},
+		{name: models.DeletionStepReleaseUsage, do: s.releaseUsage, undo: s.reclaimUsage, local: true},
+		{name: models.DeletionStepRecordEvent, do: s.recordEvent, local: true},
+		{name: models.DeletionStepDeleteObject, do: s.deleteObject},
+	}
+	return s
+}
+
+// Delete starts deleting a file and runs the deletion as far as it gets. The returned
+// saga is completed unless a step failed, in which case Run resumes it. It returns
+// repository.ErrDeletionInProgress if the file is already being deleted.
+func (s *DeletionSagaService) Delete(ctx context.Context, file *models.File) (*models.DeletionSaga, error) {
+	// Only available files count towards usage, so the others free none
+	var freedBytes int64
+	if file.Status == models.FileStatusAvailable {
+		freedBytes = file.Size
+	}
+	event := kafka.NewFileDeletedEvent(file.ID.Hex(), file.OwnerID, file.Name, freedBytes)
+	event.TenantID = file.TenantID
+	payload, err := events.Encode(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode file deleted event: %w", err)
+	}
+
+	saga := &models.DeletionSaga{
+		FileID: file.ID.Hex(),
+		File:   *file,
+		Event:  string(payload),
+	}
+	if err := s.sagas.Create(ctx, saga, deletionLease); err != nil {
+		return nil, err
+	}
+
+	s.execute(ctx, saga)
+	return saga, nil
+}
+
+// Run resumes failed and interrupted deletions every interval until ctx is cancelled
+func (s *DeletionSagaService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.logger.WithField("interval", interval).Info("Deletion saga runner started")
+
+	for {
+		s.resumeDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Deletion saga runner stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resumeDue resumes the deletions due for another attempt, oldest first
+func (s *DeletionSagaService) resumeDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		saga, err := s.sagas.ClaimNext(ctx, deletionLease)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.logger.WithError(err).Error("Failed to claim file deletion")
+			}
+			return
+		}
+		if saga == nil {
+			return
+		}
+
+		sagaCtx, cancel := context.WithTimeout(ctx, deletionTimeout)
+		s.execute(sagaCtx, saga)
+		cancel()
+	}
+}
+
+// execute runs a deletion's remaining steps, or undoes its steps while it is being
+// compensated, until it finishes or a step fails
+func (s *DeletionSagaService) execute(ctx context.Context, saga *models.DeletionSaga) {
+	for {
+		if saga.Status == models.DeletionStatusCompensating {
+			step := s.nextUndo(saga)
+			if step == nil {
+				s.finish(saga, models.DeletionStatusCompensated)
+				return
+			}
+			if err := s.undoStep(ctx, saga, step); err != nil {
+				s.fail(saga, "undo "+step.name, err)
+				return
+			}
+			continue
+		}
+
+		step := s.nextStep(saga)
+		if step == nil {
+			s.finish(saga, models.DeletionStatusCompleted)
+			return
+		}
+		if err := s.doStep(ctx, saga, step); err != nil {
+			// Until the event is recorded the deletion can be undone, rather than retried
+			// forever
+			if !saga.HasCompleted(models.DeletionStepRecordEvent) && saga.Attempts+1 >= s.maxAttempts {
+				if s.startCompensating(saga, step.name, err) {
+					continue
+				}
+				return
+			}
+			s.fail(saga, step.name, err)
+			return
+		}
+	}
+}
+
+// nextStep returns the first step not made yet, or nil if all were
+func (s *DeletionSagaService) nextStep(saga *models.DeletionSaga) *deletionStep {
+	for i := range s.steps {
+		if !saga.HasCompleted(s.steps[i].name) {
+			return &s.steps[i]
+		}
+	}
+	return nil
+}
+
+// nextUndo returns the last step made, or nil if none is left to undo
+func (s *DeletionSagaService) nextUndo(saga *models.DeletionSaga) *deletionStep {
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		if s.steps[i].undo != nil && saga.HasCompleted(s.steps[i].name) {
+			return &s.steps[i]
+		}
+	}
+	return nil
+}
+
+// doStep makes a step and records it
+func (s *DeletionSagaService) doStep(ctx context.Context, saga *models.DeletionSaga, step *deletionStep) error {
+	var err error
+	if step.local {
+		err = s.outbox.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := step.do(ctx, saga); err != nil {
+				return err
+			}
+			return s.sagas.CompleteStep(ctx, saga.ID, step.name)
+		})
+	} else if err = step.do(ctx, saga); err == nil {
+		err = s.sagas.CompleteStep(ctx, saga.ID, step.name)
+	}
+	if err != nil {
+		return err
+	}
+
+	saga.Completed = append(saga.Completed, step.name)
+	saga.Attempts = 0
+	return nil
+}
+
+// undoStep undoes a step and records it
+func (s *DeletionSagaService) undoStep(ctx context.Context, saga *models.DeletionSaga, step *deletionStep) error {
+	err := s.outbox.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := step.undo(ctx, saga); err != nil {
+			return err
+		}
+		return s.sagas.UndoStep(ctx, saga.ID, step.name)
+	})
+	if err != nil {
+		return err
+	}
+
+	completed := saga.Completed[:0]
+	for _, name := range saga.Completed {
+		if name != step.name {
+			completed = append(completed, name)
+		}
+	}
+	saga.Completed = completed
+	saga.Attempts = 0
+	return nil
+}
+
+// removeFile deletes the file record. A record already gone was removed by an earlier
+// attempt whose progress wasn't recorded.
+func (s *DeletionSagaService) removeFile(ctx context.Context, saga *models.DeletionSaga) error {
+	err := s.fileRepo.PermanentDeleteDirect(ctx, saga.FileID)
+	if errors.Is(err, repository.ErrFileNotFound) {
+		return nil
+	}
+	return err
+}
+
+// restoreFile recreates the file record as it was
+func (s *DeletionSagaService) restoreFile(ctx context.Context, saga *models.DeletionSaga) error {
+	return s.fileRepo.Restore(ctx, &saga.File)
+}
+
+// releaseUsage subtracts an available file from its owner's storage usage
+func (s *DeletionSagaService) releaseUsage(ctx context.Context, saga *models.DeletionSaga) error {
+	if saga.File.Status != models.FileStatusAvailable {
+		return nil
+	}
+	return s.storageRepo.RemoveUsage(ctx, saga.File.OwnerID, saga.File.Size)
+}
+
+// reclaimUsage adds an available file back to its owner's storage usage
+func (s *DeletionSagaService) reclaimUsage(ctx context.Context, saga *models.DeletionSaga) error {
+	if saga.File.Status != models.FileStatusAvailable {
+		return nil
+	}
+	return s.storageRepo.AddUsage(ctx, saga.File.OwnerID, saga.File.Size)
+}
+
+// recordEvent records the file deleted event in the outbox, for the relay to publish
+func (s *DeletionSagaService) recordEvent(ctx context.Context, saga *models.DeletionSaga) error {
+	event, err := events.Decode([]byte(saga.Event))
+	if err != nil {
+		return err
+	}
+	return s.outbox.Enqueue(ctx, event)
+}
+
+// deleteObject removes the file's object from storage, unless another file is stored
+// at the same path
+func (s *DeletionSagaService) deleteObject(ctx context.Context, saga *models.DeletionSaga) error {
+	if s.objects == nil {
+		return ErrObjectStorageUnavailable
+	}
+
+	shared, err := s.fileRepo.CountByStoragePath(ctx, saga.File.StoragePath)
+	if err != nil {
+		return err
+	}
+	if shared > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"file_id":      saga.FileID,
+			"storage_path": saga.File.StoragePath,
+		}).Info("Keeping object stored for another file")
+		return nil
+	}
+
+	return s.objects.DeleteFile(ctx, saga.File.StoragePath)
+}
+
+// startCompensating switches a deletion to undoing its steps after step failed too
+// often, and reports whether it was recorded
+func (s *DeletionSagaService) startCompensating(saga *models.DeletionSaga, step string, stepErr error) bool {
+	s.logger.WithError(stepErr).WithFields(logrus.Fields{
+		"saga_id":  saga.ID.Hex(),
+		"file_id":  saga.FileID,
+		"step":     step,
+		"attempts": saga.Attempts + 1,
+	}).Error("File deletion failed, undoing it")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.sagas.StartCompensating(ctx, saga.ID); err != nil {
+		s.fail(saga, step, stepErr)
+		return false
+	}
+
+	saga.Status = models.DeletionStatusCompensating
+	saga.Attempts = 0
+	return true
+}
+
+// fail schedules the next attempt at a failed step, backing off exponentially
+func (s *DeletionSagaService) fail(saga *models.DeletionSaga, step string, stepErr error) {
+	backoff := deletionMaxBackoff
+	if saga.Attempts < 9 {
+		backoff = time.Second << saga.Attempts
+		if backoff > deletionMaxBackoff {
+			backoff = deletionMaxBackoff
+		}
+	}
+
+	s.logger.WithError(stepErr).WithFields(logrus.Fields{
+		"saga_id":  saga.ID.Hex(),
+		"file_id":  saga.FileID,
+		"step":     step,
+		"attempts": saga.Attempts + 1,
+		"retry_in": backoff,
+	}).Warn("File deletion step failed")
+
+	// The deletion's context may be done, so record the failure without it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.sagas.MarkFailed(ctx, saga.ID, fmt.Sprintf("%s: %v", step, stepErr), time.Now().Add(backoff)); err != nil {
+		s.logger.WithError(err).WithField("saga_id", saga.ID.Hex()).Error("Failed to record file deletion failure")
+	}
+	saga.Attempts++
+	saga.LastError = stepErr.Error()
+}
+
+// finish records that a deletion completed or was compensated
+func (s *DeletionSagaService) finish(saga *models.DeletionSaga, status string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.sagas.Finish(ctx, saga.ID, status); err != nil {
+		// The deletion is resumed once its lease expires, and finishes straight away
+		s.logger.WithError(err).WithField("saga_id", saga.ID.Hex()).Error("Failed to record file deletion outcome")
+	}
+	saga.Status = status
+
+	logger := s.logger.WithFields(logrus.Fields{
+		"saga_id": saga.ID.Hex(),
+		"file_id": saga.FileID,
+	})
+	if status == models.DeletionStatusCompensated {
+		logger.Warn("File deletion undone")
+	} else {
+		logger.Info("File deletion completed")
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/kafka"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
 )
@@ -19,6 +21,9 @@ type PrivateFolderService struct {
 	pinRepo     *repository.PrivateFolderRepository
 	fileRepo    *repository.FileRepository
 	storageRepo *repository.StorageRepository
+	outbox      *repository.OutboxRepository
+	// accessLogs tracks the access log writes in progress
+	accessLogs sync.WaitGroup
 }
 
 // NewPrivateFolderService creates a new private folder service
@@ -34,6 +39,13 @@ func NewPrivateFolderService(
 	}
 }
 
+// SetEventOutbox records privacy changes of files in the outbox, for the relay to publish
+// to the file events topic where the share-tracker archives them. Without it they are
+// only in the access logs.
+func (s *PrivateFolderService) SetEventOutbox(outbox *repository.OutboxRepository) {
+	s.outbox = outbox
+}
+
 // SetPIN sets or updates a user's PIN
 func (s *PrivateFolderService) SetPIN(ctx context.Context, userID, pin string) error {
 	// Validate PIN
@@ -191,7 +203,7 @@ func (s *PrivateFolderService) MakeFilePrivate(ctx context.Context, req *models.
 
 	// Update file metadata
 	file.IsPrivate = true
-	err = s.fileRepo.Update(ctx, file)
+	err = s.updatePrivacy(ctx, file)
 	if err != nil {
 		// Rollback private folder addition
 		s.pinRepo.RemoveFileFromPrivateFolder(ctx, req.UserID, req.FileID)
@@ -241,7 +253,7 @@ func (s *PrivateFolderService) RemoveFileFromPrivate(ctx context.Context, userID
 	}
 
 	file.IsPrivate = false
-	err = s.fileRepo.Update(ctx, file)
+	err = s.updatePrivacy(ctx, file)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update file metadata: %w", err)
 	}
@@ -312,10 +324,44 @@ func (s *PrivateFolderService) logAccess(_ context.Context, userID, fileID, acti
 	}
 
 	// Log asynchronously to avoid blocking the main operation
+	s.accessLogs.Add(1)
 	go func() {
+		defer s.accessLogs.Done()
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		s.pinRepo.LogAccess(ctx, log)
 	}()
 }
 
+// Drain waits for the access log writes in progress to finish
+func (s *PrivateFolderService) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.accessLogs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// updatePrivacy saves a file's privacy, recording the privacy change event with it
+func (s *PrivateFolderService) updatePrivacy(ctx context.Context, file *models.File) error {
+	if s.outbox == nil {
+		return s.fileRepo.Update(ctx, file)
+	}
+
+	event := kafka.NewFilePrivacyChangedEvent(file.ID.Hex(), file.OwnerID, file.Name, file.IsPrivate)
+	event.TenantID = file.TenantID
+	return s.outbox.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.fileRepo.Update(ctx, file); err != nil {
+			return err
+		}
+		return s.outbox.Enqueue(ctx, event)
+	})
+}
+
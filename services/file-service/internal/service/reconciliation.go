@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+)
+
+const (
+	// reconcileBatchSize is how many listed objects are looked up at once
+	reconcileBatchSize = 500
+	// maxReportedOrphans caps the orphaned objects handled by one reconciliation; the
+	// next one picks up the rest
+	maxReportedOrphans = 1000
+	// maxReportedMissing caps the files with missing objects listed in a report
+	maxReportedMissing = 1000
+	// maxReportedDeletions caps the stalled deletions listed in a report
+	maxReportedDeletions = 100
+	// stalledDeletionAge is how long a deletion may run before it is reported as stalled
+	stalledDeletionAge = time.Hour
+)
+
+// UsageDrift is a user whose recorded storage usage differs from their files
+type UsageDrift struct {
+	UserID        string `json:"user_id"`
+	RecordedBytes int64  `json:"recorded_bytes"`
+	ActualBytes   int64  `json:"actual_bytes"`
+	RecordedFiles int64  `json:"recorded_files"`
+	ActualFiles   int64  `json:"actual_files"`
+	Repaired      bool   `json:"repaired"`
+}
+
+// OrphanedObject is an object in storage that no file is stored at
+type OrphanedObject struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	Removed      bool      `json:"removed"`
+}
+
+// MissingObject is an available file whose object is missing from storage, or has
+// another size than the file. They can't be repaired, so they are only reported.
+type MissingObject struct {
+	FileID  string `json:"file_id"`
+	OwnerID string `json:"owner_id"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	// StoredSize is the size of the object, absent if it is missing
+	StoredSize *int64 `json:"stored_size,omitempty"`
+}
+
+// ReconciliationReport is the outcome of a reconciliation
+type ReconciliationReport struct {
+	StartedAt       time.Time        `json:"started_at"`
+	FinishedAt      time.Time        `json:"finished_at"`
+	UsageDrift      []UsageDrift     `json:"usage_drift"`
+	OrphanedObjects []OrphanedObject `json:"orphaned_objects"`
+	MissingObjects  []MissingObject  `json:"missing_objects"`
+	// StalledDeletions are the deletions that failed at least once or have run for
+	// over an hour
+	StalledDeletions []*models.DeletionSaga `json:"stalled_deletions"`
+	// CompensatedDeletions counts the deletions undone in the last day
+	CompensatedDeletions int64    `json:"compensated_deletions"`
+	Errors               []string `json:"errors,omitempty"`
+}
+
+// Reconciler finds where storage usage and object storage drifted from the file
+// records, such as usage released twice by a deletion retried without transactions,
+// objects left behind by deletions made before they were sagas, or files whose object
+// was lost, and repairs what it can. Usage
+// the billing-service computes from file events is not covered.
+type Reconciler struct {
+	fileRepo    *repository.FileRepository
+	storageRepo *repository.StorageRepository
+	sagas       *repository.DeletionSagaRepository
+	objects     ObjectStore
+	repair      bool
+	orphanGrace time.Duration
+	logger      *logrus.Logger
+
+	mu   sync.RWMutex
+	last *ReconciliationReport
+}
+
+// NewReconciler creates a reconciler. With repair set, drifted usage is recomputed from
+// the files and orphaned objects older than orphanGrace are removed; otherwise they are
+// only reported. objects may be nil if object storage is unavailable.
+func NewReconciler(
+	fileRepo *repository.FileRepository,
+	storageRepo *repository.StorageRepository,
+	sagas *repository.DeletionSagaRepository,
+	objects ObjectStore,
+	repair bool,
+	orphanGrace time.Duration,
+	logger *logrus.Logger,
+) *Reconciler {
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	return &Reconciler{
+		fileRepo:    fileRepo,
+		storageRepo: storageRepo,
+		sagas:       sagas,
+		objects:     objects,
+		repair:      repair,
+		orphanGrace: orphanGrace,
+		logger:      logger,
+	}
+}
+
+// Run reconciles every interval until ctx is cancelled
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Reconcile(ctx)
+		}
+	}
+}
+
+// RunDaily reconciles once a day, at offset past midnight UTC, until ctx is cancelled
+func (r *Reconciler) RunDaily(ctx context.Context, offset time.Duration) {
+	for {
+		now := time.Now().UTC()
+		next := now.Truncate(24 * time.Hour).Add(offset)
+		if !next.After(now) {
+			next = next.Add(24 * time.Hour)
+		}
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			r.Reconcile(ctx)
+		}
+	}
+}
+
+// LastReport returns the report of the latest reconciliation, or nil if none ran yet
+func (r *Reconciler) LastReport() *ReconciliationReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.last
+}
+
+// Reconcile compares storage usage and object storage with the file records, repairing
+// the drift if enabled, and reports what it found
+func (r *Reconciler) Reconcile(ctx context.Context) *ReconciliationReport {
+	report := &ReconciliationReport{
+		StartedAt:        time.Now(),
+		UsageDrift:       []UsageDrift{},
+		OrphanedObjects:  []OrphanedObject{},
+		MissingObjects:   []MissingObject{},
+		StalledDeletions: []*models.DeletionSaga{},
+	}
+
+	if err := r.reconcileUsage(ctx, report); err != nil {
+		report.Errors = append(report.Errors, "usage: "+err.Error())
+	}
+	if err := r.reconcileObjects(ctx, report); err != nil {
+		report.Errors = append(report.Errors, "objects: "+err.Error())
+	}
+	if err := r.reportDeletions(ctx, report); err != nil {
+		report.Errors = append(report.Errors, "deletions: "+err.Error())
+	}
+	report.FinishedAt = time.Now()
+
+	fields := logrus.Fields{
+		"usage_drift":           len(report.UsageDrift),
+		"orphaned_objects":      len(report.OrphanedObjects),
+		"missing_objects":       len(report.MissingObjects),
+		"stalled_deletions":     len(report.StalledDeletions),
+		"compensated_deletions": report.CompensatedDeletions,
+		"duration":              report.FinishedAt.Sub(report.StartedAt),
+	}
+	if len(report.Errors) > 0 {
+		r.logger.WithFields(fields).WithField("errors", report.Errors).Error("Reconciliation incomplete")
+	} else if len(report.UsageDrift) > 0 || len(report.OrphanedObjects) > 0 || len(report.MissingObjects) > 0 || len(report.StalledDeletions) > 0 {
+		r.logger.WithFields(fields).Warn("Reconciliation found drift")
+	} else {
+		r.logger.WithFields(fields).Info("Reconciliation found no drift")
+	}
+
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+	return report
+}
+
+// reconcileUsage compares each user's recorded storage usage with their available files.
+// Usage that changed since the reconciliation started is left alone, since the files
+// may have been read before the change.
+func (r *Reconciler) reconcileUsage(ctx context.Context, report *ReconciliationReport) error {
+	actual, err := r.fileRepo.UsageByOwner(ctx)
+	if err != nil {
+		return err
+	}
+	recorded, err := r.storageRepo.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(recorded))
+	for _, stats := range recorded {
+		seen[stats.UserID] = true
+		usage := actual[stats.UserID]
+		if stats.UsedBytes == usage.UsedBytes && stats.FileCount == usage.FileCount {
+			continue
+		}
+		r.reportDrift(ctx, report, stats.UserID, stats.UsedBytes, stats.FileCount, usage, stats.UpdatedAt.Before(report.StartedAt))
+	}
+	for userID, usage := range actual {
+		if !seen[userID] {
+			r.reportDrift(ctx, report, userID, 0, 0, usage, true)
+		}
+	}
+	return nil
+}
+
+// reportDrift reports a user's drifted usage, and repairs it if enabled and settled
+func (r *Reconciler) reportDrift(ctx context.Context, report *ReconciliationReport, userID string, recordedBytes, recordedFiles int64, usage repository.OwnerUsage, settled bool) {
+	drift := UsageDrift{
+		UserID:        userID,
+		RecordedBytes: recordedBytes,
+		ActualBytes:   usage.UsedBytes,
+		RecordedFiles: recordedFiles,
+		ActualFiles:   usage.FileCount,
+	}
+
+	if r.repair && settled {
+		if _, err := r.storageRepo.GetOrCreate(ctx, userID); err != nil {
+			report.Errors = append(report.Errors, "repair usage of "+userID+": "+err.Error())
+		} else if err := r.storageRepo.UpdateUsage(ctx, userID, usage.UsedBytes, usage.FileCount); err != nil {
+			report.Errors = append(report.Errors, "repair usage of "+userID+": "+err.Error())
+		} else {
+			drift.Repaired = true
+		}
+	}
+
+	report.UsageDrift = append(report.UsageDrift, drift)
+}
+
+// reconcileObjects looks for objects no file is stored at and no deletion will remove,
+// and for available files whose object is missing. Every object's key and size is kept
+// in memory while the files are compared with them.
+func (r *Reconciler) reconcileObjects(ctx context.Context, report *ReconciliationReport) error {
+	if r.objects == nil {
+		return ErrObjectStorageUnavailable
+	}
+
+	deleting, err := r.sagas.ActiveStoragePaths(ctx)
+	if err != nil {
+		return err
+	}
+
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cutoff := report.StartedAt.Add(-r.orphanGrace)
+	stored := make(map[string]int64)
+	batch := make([]OrphanedObject, 0, reconcileBatchSize)
+	for object := range r.objects.ListObjects(listCtx) {
+		if object.Err != nil {
+			return object.Err
+		}
+		stored[object.Key] = object.Size
+		// Objects are uploaded after their file is created, but may be listed before
+		// the file is read
+		if object.LastModified.After(cutoff) || deleting[object.Key] || len(report.OrphanedObjects) >= maxReportedOrphans {
+			continue
+		}
+
+		batch = append(batch, OrphanedObject{Path: object.Key, Size: object.Size, LastModified: object.LastModified})
+		if len(batch) == reconcileBatchSize {
+			if err := r.reportOrphans(ctx, report, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := r.reportOrphans(ctx, report, batch); err != nil {
+		return err
+	}
+	return r.reportMissing(ctx, report, stored)
+}
+
+// reportMissing reports the available files whose object isn't among the stored ones, or
+// has another size. Files completed since the objects started being listed are skipped,
+// since their object may have been listed before it was uploaded.
+func (r *Reconciler) reportMissing(ctx context.Context, report *ReconciliationReport, stored map[string]int64) error {
+	return r.fileRepo.ForEachAvailableFile(ctx, report.StartedAt, func(file *models.File) error {
+		size, ok := stored[file.StoragePath]
+		if ok && size == file.Size {
+			return nil
+		}
+		if len(report.MissingObjects) >= maxReportedMissing {
+			return nil
+		}
+
+		missing := MissingObject{
+			FileID:  file.ID.Hex(),
+			OwnerID: file.OwnerID,
+			Path:    file.StoragePath,
+			Size:    file.Size,
+		}
+		if ok {
+			missing.StoredSize = &size
+		}
+		report.MissingObjects = append(report.MissingObjects, missing)
+		return nil
+	})
+}
+
+// reportOrphans reports the objects of a batch no file is stored at, and removes them if
+// enabled
+func (r *Reconciler) reportOrphans(ctx context.Context, report *ReconciliationReport, batch []OrphanedObject) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	paths := make([]string, len(batch))
+	for i, object := range batch {
+		paths[i] = object.Path
+	}
+	stored, err := r.fileRepo.FindStoragePaths(ctx, paths)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range batch {
+		if stored[object.Path] || len(report.OrphanedObjects) >= maxReportedOrphans {
+			continue
+		}
+		if r.repair {
+			if err := r.objects.DeleteFile(ctx, object.Path); err != nil {
+				report.Errors = append(report.Errors, "remove "+object.Path+": "+err.Error())
+			} else {
+				object.Removed = true
+			}
+		}
+		report.OrphanedObjects = append(report.OrphanedObjects, object)
+	}
+	return nil
+}
+
+// reportDeletions reports the deletions that stalled or were undone
+func (r *Reconciler) reportDeletions(ctx context.Context, report *ReconciliationReport) error {
+	stalled, err := r.sagas.FindStalled(ctx, report.StartedAt.Add(-stalledDeletionAge), maxReportedDeletions)
+	if err != nil {
+		return err
+	}
+	if stalled != nil {
+		report.StalledDeletions = stalled
+	}
+
+	report.CompensatedDeletions, err = r.sagas.CountCompensatedSince(ctx, report.StartedAt.Add(-24*time.Hour))
+	return err
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/kafka"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/repository"
+)
+
+// ShareClaimService links the shares made to an email address before it had an account
+// to the user who now owns it. Recipients are told of the files already shared with them
+// through a file shared event per claimed share, recorded in the outbox with the claim.
+type ShareClaimService struct {
+	fileRepo *repository.FileRepository
+	outbox   *repository.OutboxRepository
+	logger   *logrus.Logger
+}
+
+// NewShareClaimService creates a new share claim service
+func NewShareClaimService(fileRepo *repository.FileRepository, outbox *repository.OutboxRepository, logger *logrus.Logger) *ShareClaimService {
+	return &ShareClaimService{
+		fileRepo: fileRepo,
+		outbox:   outbox,
+		logger:   logger,
+	}
+}
+
+// ClaimPendingShares assigns the shares made to email without an account to userID, who
+// must have proved they own it, and returns how many it assigned. Shares already claimed
+// are left alone, so claiming again is harmless. Failures that retrying won't fix wrap
+// kafka.ErrUnclaimable.
+func (s *ShareClaimService) ClaimPendingShares(ctx context.Context, userID, email string) (int, error) {
+	var claimed []*models.FileShare
+	err := s.outbox.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		claimed, err = s.fileRepo.ClaimPendingShares(ctx, email, userID)
+		if err != nil {
+			return err
+		}
+
+		for _, share := range claimed {
+			// Deactivated shares grant nothing until they are reactivated
+			if !share.IsActive {
+				continue
+			}
+			if err := s.recordShared(ctx, share); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if !repository.IsTransient(err) {
+			return 0, fmt.Errorf("%w: %v", kafka.ErrUnclaimable, err)
+		}
+		return 0, err
+	}
+
+	if len(claimed) > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"user_id":     userID,
+			"claim_count": len(claimed),
+		}).Info("Pending shares claimed")
+	}
+	return len(claimed), nil
+}
+
+// recordShared records the file shared event of a claimed share, for the recipient to be
+// notified. Shares of files that were deleted are claimed without one.
+func (s *ShareClaimService) recordShared(ctx context.Context, share *models.FileShare) error {
+	file, err := s.fileRepo.FindByID(ctx, share.FileID)
+	if err != nil {
+		if errors.Is(err, repository.ErrFileNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to find shared file: %w", err)
+	}
+	if file.DeletedAt != nil || file.Status != models.FileStatusAvailable {
+		return nil
+	}
+
+	event := kafka.NewFileSharedEvent(file.ID.Hex(), file.OwnerID, file.Name, share.SharedWithEmail, share.SharedWithID, string(share.Permission))
+	event.TenantID = file.TenantID
+	event.Metadata = map[string]string{"claimed": "true"}
+
+	if err := s.outbox.Enqueue(ctx, event); err != nil {
+		return fmt.Errorf("failed to record file shared event: %w", err)
+	}
+	return nil
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/yourusername/distributed-file-sharing/services/file-service/internal/metrics"
 )
 
 type MinioStorage struct {
@@ -18,12 +21,24 @@ type MinioStorage struct {
 	externalEndpoint string
 }
 
-func NewMinioStorage(endpoint, externalEndpoint, accessKey, secretKey, bucket string, useSSL bool) (*MinioStorage, error) {
+// NewMinioStorage creates the MinIO storage, creating its bucket if needed. The requests
+// of the internal client go through transport, such as one injecting faults, unless it
+// is nil, and their durations are recorded in the metrics.
+func NewMinioStorage(endpoint, externalEndpoint, accessKey, secretKey, bucket string, useSSL bool, transport http.RoundTripper) (*MinioStorage, error) {
+	if transport == nil {
+		defaultTransport, err := minio.DefaultTransport(useSSL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create minio transport: %w", err)
+		}
+		transport = defaultTransport
+	}
+
 	// Internal client for operations (uses internal endpoint)
 	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: useSSL,
-		Region: "us-east-1", // MinIO requires a region
+		Creds:     credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure:    useSSL,
+		Region:    "us-east-1", // MinIO requires a region
+		Transport: timedTransport{next: transport},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create minio client: %w", err)
@@ -126,6 +141,12 @@ func (s *MinioStorage) DeleteFile(ctx context.Context, objectName string) error
 	return nil
 }
 
+// ListObjects lists every object in the bucket. The channel is closed once all objects
+// are listed or ctx is done; listing errors are sent as objects with Err set.
+func (s *MinioStorage) ListObjects(ctx context.Context) <-chan minio.ObjectInfo {
+	return s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true})
+}
+
 func (s *MinioStorage) GetFileInfo(ctx context.Context, objectName string) (*minio.ObjectInfo, error) {
 	info, err := s.client.StatObject(ctx, s.bucket, objectName, minio.StatObjectOptions{})
 	if err != nil {
@@ -142,3 +163,32 @@ func (s *MinioStorage) GetObject(ctx context.Context, objectName string) (*minio
 	}
 	return object, nil
 }
+
+// HealthCheck checks that MinIO is reachable and the bucket exists
+func (s *MinioStorage) HealthCheck(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
+// timedTransport records the duration of the requests to MinIO in the metrics
+type timedTransport struct {
+	next http.RoundTripper
+}
+
+func (t timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.MinioRequestDuration.WithLabelValues(req.Method, status).Observe(time.Since(start).Seconds())
+	return resp, err
+}
@@ -0,0 +1,82 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/file-service/pkg/pb/auth/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// callTimeout bounds how long a single auth-service call may take
+const callTimeout = 5 * time.Second
+
+// Client resolves share recipients against the auth-service user directory
+type Client struct {
+	conn   *grpc.ClientConn
+	client authv1.AuthServiceClient
+}
+
+// NewClient dials the auth-service gRPC endpoint
+func NewClient(addr string, opts ...grpc.DialOption) (*Client, error) {
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
+	}
+	poolmetrics.WatchClientConn("auth-service", conn)
+
+	return &Client{
+		conn:   conn,
+		client: authv1.NewAuthServiceClient(conn),
+	}, nil
+}
+
+// ResolveEmails maps the lowercased emails of registered users to their user IDs.
+// Emails without an account are left out.
+func (c *Client) ResolveEmails(ctx context.Context, emails []string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	resp, err := c.client.ResolveUsersByEmail(ctx, &authv1.ResolveUsersByEmailRequest{Emails: emails})
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make(map[string]string, len(resp.Users))
+	for _, user := range resp.Users {
+		userIDs[strings.ToLower(user.Email)] = user.UserId
+	}
+
+	return userIDs, nil
+}
+
+// DisplayName returns the full name of the user with ID userID, empty if they haven't
+// given one. Their email isn't a fallback, as the name is shown to anyone.
+func (c *Client) DisplayName(ctx context.Context, userID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	resp, err := c.client.GetUser(ctx, &authv1.GetUserRequest{UserId: userID})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(resp.User.GetFullName()), nil
+}
+
+// HealthCheck checks that the auth-service can be reached
+func (c *Client) HealthCheck(ctx context.Context) error {
+	return health.GRPC(c.conn)(ctx)
+}
+
+// Close closes the underlying connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -8,34 +8,75 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/cli"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/faults"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/featureflags"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/grpcmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/logging"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/migrate"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/secrets"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/serviceauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/config"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/database"
 	grpchandler "github.com/yourusername/distributed-file-sharing/services/notification-service/internal/grpc"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/handlers"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/kafka"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/migrations"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/rest"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/services"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/unsubscribe"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/users"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/websocket"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/notification-service/pkg/pb/auth/v1"
 	notificationv1 "github.com/yourusername/distributed-file-sharing/services/notification-service/pkg/pb/notification/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
+	cli.Execute(cli.Service{
+		Name:    "notification-service",
+		Run:     run,
+		Workers: true,
+		HealthURL: func() string {
+			return "http://localhost:" + env.String("NOTIFICATION_METRICS_PORT", "9094") + "/health"
+		},
+	})
+}
+
+// run runs the parts of the notification service the process was started for: the gRPC
+// API, the REST and WebSocket APIs, and the workers running the Kafka consumer, batch,
+// retry and DLQ processors, the scheduler and announcement delivery. The health probes
+// and metrics are served by every process.
+func run(process cli.Process) {
 	// Load configuration
+	if err := env.Load(); err != nil {
+		log.Fatalf("Failed to load environment file: %v", err)
+	}
+	secretsManager, err := secrets.Load(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
 	cfg := config.Load()
 
 	// Initialize logger
-	logger := logrus.New()
-	logger.SetLevel(logrus.InfoLevel)
+	logger := logging.New("notification-service", cfg.LogLevel)
 	if cfg.IsDevelopment() {
 		logger.SetLevel(logrus.DebugLevel)
 	}
@@ -43,24 +84,58 @@ func main() {
 	// Initialize metrics
 	metricsInstance := metrics.NewMetrics()
 
-	// Initialize MongoDB
-	mongodb, err := database.NewMongoDB(cfg.GetMongoURI(), cfg.MongoDatabase, 10*time.Second)
+	// Inject faults for resilience testing when enabled
+	faultInjector := faults.FromEnv()
+	if faultInjector != nil {
+		logger.Warnf("Fault injection enabled: %s", faultInjector)
+	}
+
+	// Initialize MongoDB, exposing the driver's connection pool in the metrics
+	mongodb, err := database.NewMongoDB(cfg.GetMongoURI(), cfg.MongoDatabase, 10*time.Second, faultInjector.MongoOptions(), poolmetrics.MongoOptions("notification-service"))
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
 	defer mongodb.Close(context.Background())
 
+	// Apply the pending MongoDB migrations, or manage them with the migrate subcommand
+	migrator := migrate.New(mongodb.Database, "notification-service", migrations.All(), logger)
+	if process.Migrating {
+		migrateCtx, migrateCancel := context.WithTimeout(context.Background(), migrate.DefaultTimeout)
+		defer migrateCancel()
+		if err := migrator.Command(migrateCtx, process.MigrateArgs, os.Stdout); err != nil {
+			logger.WithError(err).Error("Migration failed")
+			os.Exit(1)
+		}
+		return
+	}
+	if cfg.MigrateOnStartup {
+		migrateCtx, migrateCancel := context.WithTimeout(context.Background(), migrate.DefaultTimeout)
+		applied, err := migrator.Run(migrateCtx)
+		migrateCancel()
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to apply MongoDB migrations")
+		}
+		logger.WithField("applied", applied).Info("MongoDB migrations applied")
+	}
+
 	// Initialize Redis
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     cfg.GetRedisURI(),
-		Password: cfg.RedisPassword,
-		DB:       cfg.RedisDB,
+	redisClient, err := database.NewRedis(database.RedisOptions{
+		Mode:             cfg.RedisMode,
+		Addrs:            cfg.RedisAddrs,
+		MasterName:       cfg.RedisMasterName,
+		SentinelPassword: cfg.RedisSentinelPassword,
+		Password:         cfg.RedisPassword,
+		DB:               cfg.RedisDB,
 	})
+	if err != nil {
+		log.Fatalf("Invalid Redis configuration: %v", err)
+	}
 	defer redisClient.Close()
 
-	// Test Redis connection
+	// Test Redis connection; without Redis notifications are sent unbatched, unthrottled
+	// and possibly twice, until it is back
 	if err := redisClient.Ping(context.Background()).Err(); err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		logger.WithError(err).Warn("Redis is unavailable; running degraded until it is back")
 	}
 
 	// Initialize repositories
@@ -69,9 +144,9 @@ func main() {
 	templateRepo := repository.NewTemplateRepository(mongodb.Database)
 	batchRepo := repository.NewBatchRepository(mongodb.Database)
 	dlqRepo := repository.NewDLQRepository(mongodb.Database)
-
-	// Create indexes
-	createIndexes(context.Background(), notifRepo, preferencesRepo, templateRepo, batchRepo, dlqRepo)
+	webhookRepo := repository.NewWebhookRepository(mongodb.Database)
+	scheduledRepo := repository.NewScheduledNotificationRepository(mongodb.Database)
+	announcementRepo := repository.NewAnnouncementRepository(mongodb.Database)
 
 	// Initialize services
 	preferenceSvc := services.NewPreferenceService(preferencesRepo, logger)
@@ -116,11 +191,100 @@ func main() {
 		FallbackChannels: []models.NotificationChannel{models.ChannelEmail, models.ChannelSMS},
 	}
 	notifSvc := services.NewNotificationService(notifRepo, preferenceSvc, templateSvc, batchSvc, dlqSvc, retrySvc, serviceConfig, logger)
+	batchSvc.SetSender(notifSvc)
+
+	// Resolve recipient names, locales and timezones from the auth-service
+	var directoryOpts []grpc.DialOption
+	var tokenSource *serviceauth.TokenSource
+	if cfg.ServiceAuthEnabled {
+		tokenSource, err = newServiceTokenSource(cfg)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to initialize service token source")
+		}
+		directoryOpts = append(directoryOpts, grpc.WithPerRPCCredentials(tokenSource.Credentials("auth-service")))
+	}
+	userDirectory, err := users.NewDirectory(cfg.AuthServiceGRPC, cfg.ProfileCacheTTL, directoryOpts...)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create user directory")
+	}
+	defer userDirectory.Close()
+	notifSvc.SetUserDirectory(userDirectory)
+	preferenceSvc.SetUserDirectory(userDirectory)
+
+	// Limit how many notifications of each event type a user receives per hour
+	rateLimits := make(map[models.EventType]int, len(cfg.NotificationRateLimits))
+	for eventType, limit := range cfg.NotificationRateLimits {
+		rateLimits[models.EventType(eventType)] = limit
+	}
+	notifSvc.SetThrottler(services.NewThrottleService(redisClient, rateLimits, logger))
+
+	// Record metrics from the delivery pipeline
+	notifSvc.SetMetrics(metricsInstance)
+	batchSvc.SetMetrics(metricsInstance)
+	dlqSvc.SetMetrics(metricsInstance)
+	retrySvc.SetMetrics(metricsInstance)
+	preferenceSvc.SetMetrics(metricsInstance)
+
+	// Roll out features such as batching with the feature flags shared by the services
+	flags := featureflags.NewClient(featureflags.NewMongoStore(mongodb.Database), cfg.FeatureFlagsRefresh, map[string]bool{
+		services.FlagBatching: true,
+	}, logger)
+	if err := flags.Refresh(context.Background()); err != nil {
+		logger.WithError(err).Warn("Failed to load feature flags, using their defaults")
+	}
+	notifSvc.SetFeatureFlags(flags)
 
 	// Initialize handlers
-	emailHandler := handlers.NewEmailHandler(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFromEmail, cfg.SMTPFromName, cfg.SMTPTLS, logger)
-	smsHandler := handlers.NewMockSMSHandler(true, logger)   // Use mock for testing
-	pushHandler := handlers.NewMockPushHandler(true, logger) // Use mock for testing
+	emailProviders, err := newEmailFailover(cfg, secretsManager, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize email providers")
+	}
+	emailProviders.SetMetrics(metricsInstance)
+	emailHandler := handlers.NewEmailHandler(emailProviders, cfg.SMTPFromEmail, cfg.SMTPFromName, logger)
+	emailHandler.SetSuppressionStore(preferencesRepo)
+	if cfg.EmailLogoPath != "" {
+		logo, err := os.ReadFile(cfg.EmailLogoPath)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to read email logo")
+		}
+		if err := emailHandler.SetLogo(logo); err != nil {
+			logger.WithError(err).Fatal("Invalid email logo")
+		}
+	}
+	var unsubscribeSigner *unsubscribe.Signer
+	if cfg.UnsubscribeTokenSecret != "" {
+		unsubscribeSigner = unsubscribe.NewSigner(cfg.UnsubscribeTokenSecret, cfg.UnsubscribeTokenTTL, cfg.NotificationPublicURL, cfg.FrontendURL)
+		emailHandler.SetUnsubscribeLinks(unsubscribeSigner)
+	}
+	// Use mock SMS until an SMS provider is configured
+	mockSMSHandler := handlers.NewMockSMSHandler(true, logger)
+	var smsHandler services.NotificationHandler = mockSMSHandler
+	var smsSender services.TextSender = mockSMSHandler
+	var smsCallbacks rest.SMSStatusCallbackParser
+	smsProvider, err := newSMSProvider(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize SMS provider")
+	}
+	if smsProvider != nil {
+		smsRoutes, err := handlers.NewSMSRoutes(cfg.TwilioPhoneNumber, cfg.SMSSenders, cfg.SMSSegmentPrices)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid SMS sender configuration")
+		}
+		providerSMSHandler := handlers.NewSMSHandler(smsProvider, smsRoutes, preferencesRepo, cfg.SMSStatusCallbackURL, logger)
+		providerSMSHandler.SetMetrics(metricsInstance)
+		smsHandler = providerSMSHandler
+		smsSender = providerSMSHandler
+		smsCallbacks = providerSMSHandler
+	}
+	// Use mock push until FCM is configured
+	var pushHandler services.NotificationHandler = handlers.NewMockPushHandler(true, logger)
+	if credentialsFile, projectID := cfg.GetFCMConfig(); credentialsFile != "" {
+		fcmHandler, err := handlers.NewPushHandler(credentialsFile, projectID, preferencesRepo, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to initialize FCM push handler")
+		}
+		pushHandler = fcmHandler
+	}
 	inAppHandler := handlers.NewInAppHandler(true, logger)
 	wsHandler := handlers.NewWebSocketHandler(true, logger)
 
@@ -130,35 +294,131 @@ func main() {
 	notifSvc.RegisterHandler(models.ChannelPush, pushHandler)
 	notifSvc.RegisterHandler(models.ChannelInApp, inAppHandler)
 	notifSvc.RegisterHandler(models.ChannelWebSocket, wsHandler)
+	for _, channel := range []models.NotificationChannel{models.ChannelSlack, models.ChannelDiscord, models.ChannelTeams} {
+		notifSvc.RegisterHandler(channel, handlers.NewChatWebhookHandler(channel, preferencesRepo, logger))
+	}
+	notifSvc.RegisterHandler(models.ChannelWebhook, handlers.NewWebhookHandler(webhookRepo, &handlers.WebhookConfig{
+		MaxAttempts:          cfg.WebhookMaxAttempts,
+		BaseDelay:            cfg.WebhookRetryBaseDelay,
+		MaxDelay:             cfg.WebhookRetryMaxDelay,
+		Timeout:              cfg.WebhookTimeout,
+		AllowPrivateNetworks: cfg.WebhookAllowInsecure,
+	}, logger))
 
 	// Initialize WebSocket server
-	wsServer := websocket.NewServer(wsHandler, logger)
+	wsServer := websocket.NewServer(wsHandler, jwtauth.NewValidator(cfg.JWTSecret), logger)
+	wsServer.SetMetrics(metricsInstance)
+	wsHandler.SetHub(wsServer)
+	wsServer.SetInbox(notifSvc)
+	notifSvc.SetInboxListener(wsServer)
 
-	// Initialize StreamBroker for Kafka
+	// Relay WebSocket messages between replicas through Redis
+	wsBridge := websocket.NewBridge(redisClient, wsServer, logger)
+
+	// Stream sent notifications to gRPC subscribers on every replica
 	streamBroker := kafka.NewStreamBroker()
+	streamBroker.SetRedis(redisClient, logger)
+	notifSvc.SetPublisher(streamBroker)
+	notifSvc.SetActionBaseURL(cfg.GatewayPublicURL)
 
 	// Initialize REST handlers
-	restHandlers := rest.NewRestHandlers(notifSvc, preferenceSvc, templateSvc, batchSvc, dlqSvc, logger)
+	phoneSvc := services.NewPhoneVerificationService(redisClient, preferenceSvc, smsSender, logger)
+	webhookSvc := services.NewWebhookService(webhookRepo, preferenceSvc, cfg.WebhookAllowInsecure, logger)
+	scheduleSvc := services.NewScheduleService(scheduledRepo, notifSvc, cfg.SchedulerPollInterval, logger)
+	notifSvc.SetQuietHoursQueue(scheduleSvc)
+
+	// Send announcements to all users, organizations and, with the billing-service, plans
+	announcementSvc := services.NewAnnouncementService(announcementRepo, notifRepo, notifSvc, userDirectory, cfg.SchedulerPollInterval, logger)
+	if cfg.BillingServiceGRPC != "" {
+		var subscriberOpts []grpc.DialOption
+		if tokenSource != nil {
+			subscriberOpts = append(subscriberOpts, grpc.WithPerRPCCredentials(tokenSource.Credentials("billing-service")))
+		}
+		subscribers, err := users.NewSubscribers(cfg.BillingServiceGRPC, subscriberOpts...)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to create plan subscriber client")
+		}
+		defer subscribers.Close()
+		announcementSvc.SetSubscriberLister(subscribers)
+	}
+
+	restHandlers := rest.NewRestHandlers(notifSvc, preferenceSvc, templateSvc, batchSvc, dlqSvc, phoneSvc, webhookSvc, scheduleSvc, announcementSvc, logger)
+	if smsCallbacks != nil {
+		restHandlers.SetSMSStatusCallbacks(smsCallbacks)
+	}
+	if unsubscribeSigner != nil {
+		restHandlers.SetUnsubscribeTokens(unsubscribeSigner)
+	}
+	emailFeedback := make(map[string]rest.EmailFeedbackParser)
+	if cfg.SendGridWebhookPublicKey != "" {
+		parser, err := handlers.NewSendGridFeedbackParser(cfg.SendGridWebhookPublicKey)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to initialize SendGrid feedback webhook")
+		}
+		emailFeedback["sendgrid"] = parser
+	}
+	if cfg.SESFeedbackTopicARN != "" {
+		emailFeedback["ses"] = handlers.NewSESFeedbackParser(cfg.SESFeedbackTopicARN)
+	}
+	restHandlers.SetEmailFeedbackParsers(emailFeedback)
+	if cfg.AnalyticsAPIToken != "" {
+		restHandlers.SetAnalyticsToken(cfg.AnalyticsAPIToken)
+	}
+	// Announcements, scheduled notifications and the dead letter queue are operated by
+	// administrators and services
+	var adminServiceTokens *serviceauth.Validator
+	if cfg.ServiceAuthEnabled {
+		adminServiceTokens = serviceauth.NewValidator(cfg.ServiceTokenSecret, cfg.ServiceName)
+	}
+	restHandlers.SetAdminAuth(jwtauth.NewValidator(cfg.JWTSecret), adminServiceTokens, cfg.AdminEmails, userDirectory)
 
 	// Initialize Kafka consumer
-	consumer := kafka.NewConsumer(cfg.GetKafkaBrokers(), cfg.KafkaGroupID, cfg.FileEventsTopic, notifRepo, streamBroker, notifSvc)
+	consumer := kafka.NewConsumer(cfg.GetKafkaBrokers(), cfg.KafkaGroupID, []string{cfg.FileEventsTopic, cfg.BillingEventsTopic, cfg.SecurityEventsTopic}, notifRepo, streamBroker, notifSvc)
+	consumer.SetFileEventsTopic(cfg.FileEventsTopic)
+	consumer.SetMetrics(metricsInstance)
+	consumer.SetDeduplicator(kafka.NewEventDeduplicator(redisClient, cfg.EventDedupTTL))
 
 	// Start background processes
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start Kafka consumer
-	go func() {
-		if err := consumer.Start(ctx); err != nil {
-			logger.WithError(err).Error("Kafka consumer stopped")
-		}
-	}()
+	// Reload the feature flags as they change
+	go flags.Run(ctx)
 
-	// Start notification service background processes
-	notifSvc.StartBackgroundProcesses(ctx)
+	// Watch Redis availability and connection pool
+	go database.MonitorRedis(ctx, redisClient, metricsInstance, logger)
 
-	// Start WebSocket cleanup routine
-	go wsServer.StartCleanupRoutine(ctx)
+	// Start Kafka consumer
+	consumerDone := make(chan struct{})
+	if process.Worker {
+		go func() {
+			defer close(consumerDone)
+			if err := consumer.Start(ctx); err != nil {
+				logger.WithError(err).Error("Kafka consumer stopped")
+			}
+		}()
+
+		// Start notification service background processes
+		notifSvc.StartBackgroundProcesses(ctx)
+
+		// Send scheduled notifications when they are due
+		go scheduleSvc.StartScheduler(ctx)
+
+		// Deliver announcements in the background
+		go announcementSvc.StartProcessor(ctx)
+	} else {
+		close(consumerDone)
+	}
+
+	// Start WebSocket cleanup routine and Redis bridge, which deliver the notifications
+	// any process publishes to the WebSocket and stream subscribers of this one
+	if process.HTTP {
+		go wsServer.StartCleanupRoutine(ctx)
+		go wsBridge.Run(ctx)
+	}
+	if process.GRPC {
+		go streamBroker.Run(ctx)
+	}
 
 	// Create default templates
 	if err := templateSvc.CreateDefaultTemplates(ctx); err != nil {
@@ -166,22 +426,64 @@ func main() {
 	}
 
 	// Start servers
-	go startRESTServer(cfg, restHandlers, logger)
-	go startWebSocketServer(cfg, wsServer, logger)
-	go startMetricsServer(cfg, metricsInstance, logger)
-	go startGRPCServer(cfg, notifSvc, logger)
+	// Report the state of the dependencies for the health, liveness and readiness probes
+	healthHandler := health.New("notification-service", "").AddCheck("mongodb", func(ctx context.Context) error {
+		return mongodb.Client.Ping(ctx, nil)
+	}).AddCheck("redis", func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
+	}).AddOptionalCheck("kafka", health.TCP(cfg.KafkaBrokers...)).
+		AddOptionalCheck("auth-service", userDirectory.HealthCheck)
+
+	var restServer, wsHTTPServer *http.Server
+	if process.HTTP {
+		restServer = startRESTServer(cfg, restHandlers, healthHandler, faultInjector, logger)
+		wsHTTPServer = startWebSocketServer(cfg, wsServer, logger)
+	}
+	metricsServer := startMetricsServer(cfg, healthHandler, logger)
+	var grpcServer *grpc.Server
+	if process.GRPC {
+		grpcServer = startGRPCServer(cfg, notifSvc, scheduleSvc, streamBroker, faultInjector, logger)
+	}
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	// Fail the readiness probe and keep serving until load balancers stop sending requests
+	logger.Info("Draining...")
+	healthHandler.SetDraining()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
 	logger.Info("Shutting down servers...")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer shutdownCancel()
+
+	// Stop accepting requests and finish the ones in progress
+	if restServer != nil {
+		if err := restServer.Shutdown(shutdownCtx); err != nil {
+			logger.WithError(err).Error("Error shutting down REST server")
+		}
+		if err := wsHTTPServer.Shutdown(shutdownCtx); err != nil {
+			logger.WithError(err).Error("Error shutting down WebSocket server")
+		}
+	}
+
+	// Stop the background processes; the consumer finishes and commits the message it
+	// is processing, and commits its pending offsets, before it stops
 	cancel()
+	select {
+	case <-consumerDone:
+		logger.Info("Kafka consumer stopped")
+	case <-shutdownCtx.Done():
+		logger.Warn("Kafka consumer stop timeout")
+	}
 
-	// Graceful shutdown
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer shutdownCancel()
+	// Notification subscriptions stay open until their clients leave, so those still
+	// open at the timeout are cancelled
+	if grpcServer != nil && !grpcmw.GracefulStop(shutdownCtx, grpcServer) {
+		logger.Warn("gRPC calls cancelled at shutdown timeout")
+	}
 
 	// Close WebSocket connections with timeout
 	done := make(chan struct{})
@@ -197,17 +499,42 @@ func main() {
 		logger.Warn("WebSocket close timeout")
 	}
 
+	metricsServer.Close()
+
 	logger.Info("Servers stopped")
 }
 
-// createIndexes creates necessary database indexes
-func createIndexes(ctx context.Context, repos ...interface{}) {
-	// This would create indexes for all repositories
-	// Implementation depends on the specific repository interface
+// newServiceTokenSource creates a token source that exchanges the service's client
+// credentials for service tokens via the auth-service
+func newServiceTokenSource(cfg *config.Config) (*serviceauth.TokenSource, error) {
+	conn, err := grpc.Dial(cfg.AuthServiceGRPC, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
+	}
+
+	client := authv1.NewAuthServiceClient(conn)
+	return serviceauth.NewTokenSource(func(ctx context.Context, audience string) (string, int64, error) {
+		resp, err := client.IssueServiceToken(ctx, &authv1.IssueServiceTokenRequest{
+			ClientId:     cfg.ServiceClientID,
+			ClientSecret: cfg.ServiceClientSecret,
+			Audience:     audience,
+		})
+		if err != nil {
+			return "", 0, err
+		}
+		return resp.AccessToken, resp.ExpiresIn, nil
+	}), nil
 }
 
-// startRESTServer starts the REST API server
-func startRESTServer(cfg *config.Config, handlers *rest.RestHandlers, logger *logrus.Logger) {
+// corsConfig lets browsers call the REST and WebSocket servers from any origin
+var corsConfig = ginmw.CORSConfig{
+	AllowOrigins: []string{"*"},
+	AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+	AllowHeaders: []string{"Content-Type", "Authorization", "X-User-ID"},
+}
+
+// startRESTServer starts the REST API server, returning it for shutdown
+func startRESTServer(cfg *config.Config, handlers *rest.RestHandlers, healthHandler *health.Handler, faultInjector *faults.Injector, logger *logrus.Logger) *http.Server {
 	// Set Gin mode
 	if cfg.IsProduction() {
 		gin.SetMode(gin.ReleaseMode)
@@ -219,20 +546,19 @@ func startRESTServer(cfg *config.Config, handlers *rest.RestHandlers, logger *lo
 	router.Use(gin.Recovery())
 
 	// CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	router.Use(ginmw.CORS(corsConfig))
 
-		c.Next()
-	})
+	// Request ID, returned in the error responses
+	router.Use(ginmw.RequestID())
 
-	// Setup routes
+	// Health, liveness and readiness probes
+	healthHandler.Register(router)
+
+	// Setup routes, delayed at the injected latency rate and served for the tenant and
+	// within the deadline the gateway decided
+	router.Use(faultInjector.Gin())
+	router.Use(tenant.Gin())
+	router.Use(ginmw.Deadline(nil))
 	handlers.SetupRoutes(router)
 
 	// Start server
@@ -247,43 +573,34 @@ func startRESTServer(cfg *config.Config, handlers *rest.RestHandlers, logger *lo
 		IdleTimeout:  60 * time.Second,
 	}
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.WithError(err).Fatal("Failed to start REST server")
-	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.WithError(err).Fatal("Failed to start REST server")
+		}
+	}()
+	return server
 }
 
-// startWebSocketServer starts the WebSocket server
-func startWebSocketServer(cfg *config.Config, wsServer *websocket.Server, logger *logrus.Logger) {
+// startWebSocketServer starts the WebSocket server, returning it for shutdown
+func startWebSocketServer(cfg *config.Config, wsServer *websocket.Server, logger *logrus.Logger) *http.Server {
 	// Create Gin router for WebSocket
 	router := gin.New()
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
 	// CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	router.Use(ginmw.CORS(corsConfig))
 
-		c.Next()
-	})
+	// Request ID, returned in the error responses
+	router.Use(ginmw.RequestID())
 
 	// WebSocket endpoint
 	router.GET("/ws", wsServer.HandleWebSocket)
 
 	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":      "healthy",
-			"service":     "websocket",
-			"connections": wsServer.GetConnectionCount(),
-		})
-	})
+	router.GET("/health", health.New("websocket", "").AddDetail("connections", func() interface{} {
+		return wsServer.GetConnectionCount()
+	}).Handle)
 
 	// Start server
 	addr := fmt.Sprintf("%s:%s", cfg.ServiceHost, cfg.WebSocketPort)
@@ -297,31 +614,82 @@ func startWebSocketServer(cfg *config.Config, wsServer *websocket.Server, logger
 		IdleTimeout:  60 * time.Second,
 	}
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.WithError(err).Fatal("Failed to start WebSocket server")
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.WithError(err).Fatal("Failed to start WebSocket server")
+		}
+	}()
+	return server
+}
+
+// newEmailFailover creates the configured email providers in failover order, skipping the
+// ones whose credentials are not set. The SMTP password is read again from the secret
+// store when it is rotated.
+func newEmailFailover(cfg *config.Config, secretsManager *secrets.Manager, logger *logrus.Logger) (*handlers.EmailFailover, error) {
+	failover := handlers.NewEmailFailover(cfg.EmailFailoverThreshold, cfg.EmailFailoverCooldown, logger)
+	for _, name := range cfg.EmailProviders {
+		name = strings.TrimSpace(name)
+
+		var provider handlers.EmailProvider
+		switch name {
+		case "":
+			continue
+		case "smtp":
+			if cfg.SMTPHost == "" || cfg.SMTPUsername == "" || cfg.SMTPPassword == "" {
+				continue
+			}
+			smtpProvider := handlers.NewSMTPProvider(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPTLS)
+			smtpProvider.SetPasswordSource(secretsManager.Lookup("SMTP_PASSWORD"))
+			provider = smtpProvider
+		case "sendgrid":
+			if cfg.SendGridAPIKey == "" {
+				continue
+			}
+			provider = handlers.NewSendGridProvider(cfg.SendGridAPIKey)
+		case "ses":
+			if cfg.SESRegion == "" || cfg.SESAccessKeyID == "" || cfg.SESSecretAccessKey == "" {
+				continue
+			}
+			provider = handlers.NewSESProvider(cfg.SESRegion, cfg.SESAccessKeyID, cfg.SESSecretAccessKey)
+		default:
+			return nil, fmt.Errorf("unknown email provider %q", name)
+		}
+
+		failover.AddProvider(provider, cfg.EmailProviderRateLimits[name])
 	}
+	return failover, nil
 }
 
-// startMetricsServer starts the metrics server
-func startMetricsServer(cfg *config.Config, metricsInstance *metrics.Metrics, logger *logrus.Logger) {
+// newSMSProvider creates the configured SMS provider, or returns nil when its
+// credentials are not set
+func newSMSProvider(cfg *config.Config) (handlers.SMSProvider, error) {
+	switch cfg.SMSProvider {
+	case "twilio":
+		accountSID, authToken, phoneNumber := cfg.GetTwilioConfig()
+		if accountSID == "" || authToken == "" {
+			return nil, nil
+		}
+		if phoneNumber == "" && len(cfg.SMSSenders) == 0 {
+			return nil, fmt.Errorf("TWILIO_PHONE_NUMBER or SMS_SENDERS is required")
+		}
+		return handlers.NewTwilioProvider(accountSID, authToken), nil
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", cfg.SMSProvider)
+	}
+}
+
+// startMetricsServer starts the metrics server, returning it for shutdown
+func startMetricsServer(cfg *config.Config, healthHandler *health.Handler, logger *logrus.Logger) *http.Server {
 	// Create metrics server
 	router := gin.New()
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
 	// Metrics endpoint
-	router.GET("/metrics", func(c *gin.Context) {
-		// This would expose Prometheus metrics
-		c.String(http.StatusOK, "# Metrics endpoint\n# Implementation would go here\n")
-	})
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"service": "metrics",
-		})
-	})
+	// Health, liveness and readiness probes
+	healthHandler.Register(router)
 
 	// Start server
 	addr := fmt.Sprintf("%s:%s", cfg.ServiceHost, cfg.MetricsPort)
@@ -335,15 +703,20 @@ func startMetricsServer(cfg *config.Config, metricsInstance *metrics.Metrics, lo
 		IdleTimeout:  60 * time.Second,
 	}
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.WithError(err).Fatal("Failed to start metrics server")
-	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.WithError(err).Fatal("Failed to start metrics server")
+		}
+	}()
+	return server
 }
 
-// startGRPCServer starts the gRPC server
-func startGRPCServer(cfg *config.Config, notifSvc *services.NotificationService, logger *logrus.Logger) {
+// startGRPCServer starts the gRPC server, returning it for shutdown
+func startGRPCServer(cfg *config.Config, notifSvc *services.NotificationService, scheduleSvc *services.ScheduleService, streamBroker *kafka.StreamBroker, faultInjector *faults.Injector, logger *logrus.Logger) *grpc.Server {
 	// Create gRPC server
-	grpcServer := grpchandler.NewNotificationGRPCServer(notifSvc, logger)
+	grpcServer := grpchandler.NewNotificationGRPCServer(notifSvc, scheduleSvc, logger)
+	grpcServer.SetNotificationStream(streamBroker)
+	grpcServer.SetUserTokens(jwtauth.NewValidator(cfg.JWTSecret), cfg.ServiceAuthEnabled)
 
 	// Create listener
 	addr := fmt.Sprintf("%s:%s", cfg.ServiceHost, cfg.GRPCPort)
@@ -353,11 +726,28 @@ func startGRPCServer(cfg *config.Config, notifSvc *services.NotificationService,
 	}
 
 	// Create gRPC server
-	s := grpc.NewServer()
+	grpcOpts := grpcmw.Options{
+		Service:        cfg.ServiceName,
+		Logger:         logger,
+		DefaultTimeout: cfg.GRPCDefaultTimeout,
+		Faults:         faultInjector,
+	}
+	if cfg.ServiceAuthEnabled {
+		serviceAuth := serviceauth.NewInterceptor(serviceauth.NewValidator(cfg.ServiceTokenSecret, cfg.ServiceName))
+		// Clients subscribe to their own notifications with access tokens instead
+		serviceAuth.SetOptional("/notification.v1.NotificationService/SubscribeNotifications")
+		grpcOpts.Auth = serviceAuth
+		logger.Info("Service-to-service authentication enabled")
+	}
+
+	s := grpc.NewServer(grpcmw.ServerOptions(grpcOpts)...)
 	notificationv1.RegisterNotificationServiceServer(s, grpcServer)
 
 	logger.WithField("address", addr).Info("Starting gRPC server")
-	if err := s.Serve(lis); err != nil {
-		logger.WithError(err).Fatal("Failed to start gRPC server")
-	}
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			logger.WithError(err).Fatal("Failed to start gRPC server")
+		}
+	}()
+	return s
 }
@@ -5,6 +5,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/env"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/featureflags"
 )
 
 // Config holds all configuration for the notification service
@@ -24,12 +27,27 @@ type Config struct {
 	RedisURI        string
 	RedisPassword   string
 	RedisDB         int
+	// RedisMode is standalone, sentinel or cluster. In sentinel mode RedisAddrs are the
+	// sentinels serving RedisMasterName, and in cluster mode the seed nodes.
+	RedisMode             string
+	RedisAddrs            []string
+	RedisMasterName       string
+	RedisSentinelPassword string
+	// Pending MongoDB migrations are applied on startup if MigrateOnStartup is set, and
+	// otherwise only by the migrate subcommand
+	MigrateOnStartup bool
 
 	// Kafka configuration
 	KafkaBrokers    []string
 	KafkaGroupID    string
 	FileEventsTopic string
+	// BillingEventsTopic carries the billing-service's quota alerts
+	BillingEventsTopic string
+	// SecurityEventsTopic carries the share-tracker's security alerts
+	SecurityEventsTopic string
 	DLQTopic        string
+	// How long processed event IDs are remembered to skip redelivered events
+	EventDedupTTL   time.Duration
 
 	// SMTP configuration
 	SMTPHost        string
@@ -39,15 +57,50 @@ type Config struct {
 	SMTPFromEmail   string
 	SMTPFromName    string
 	SMTPTLS         bool
+	// Image shown at the top of emails instead of the built-in logo
+	EmailLogoPath   string
+	// Email providers in failover order: smtp, sendgrid and ses. Providers without
+	// credentials are skipped. Rate limits are emails per second, keyed by provider.
+	EmailProviders          []string
+	EmailProviderRateLimits map[string]int
+	// A provider failing EmailFailoverThreshold times in a row is skipped for
+	// EmailFailoverCooldown
+	EmailFailoverThreshold int
+	EmailFailoverCooldown  time.Duration
+	SendGridAPIKey         string
+	SESRegion              string
+	SESAccessKeyID         string
+	SESSecretAccessKey     string
+	// Bounce and complaint webhooks, enabled per provider when set. SendGrid events are
+	// verified with the Event Webhook's public key, and SES notifications must come from
+	// the SNS topic.
+	SendGridWebhookPublicKey string
+	SESFeedbackTopicARN      string
+	// Unsubscribe links in emails; disabled when the secret is empty. One-click
+	// unsubscribes post to NotificationPublicURL, and footers link to the preference
+	// center at FrontendURL.
+	UnsubscribeTokenSecret string
+	UnsubscribeTokenTTL    time.Duration
+	NotificationPublicURL  string
+	FrontendURL            string
+	// GatewayPublicURL resolves the action paths of notifications, such as the "Open
+	// file" action of shared files
+	GatewayPublicURL string
 
 	// Twilio configuration
 	TwilioAccountSID string
 	TwilioAuthToken  string
 	TwilioPhoneNumber string
 
+	// SMS configuration. Senders and segment prices are keyed by calling code prefix.
+	SMSProvider          string
+	SMSSenders           map[string]string
+	SMSSegmentPrices     map[string]string
+	SMSStatusCallbackURL string
+
 	// FCM configuration
-	FCMServerKey    string
-	FCMProjectID    string
+	FCMCredentialsFile string
+	FCMProjectID       string
 
 	// WebPush configuration
 	WebPushVAPIDPublicKey  string
@@ -65,6 +118,20 @@ type Config struct {
 	RetryMaxDelay      time.Duration
 	RetryMultiplier    float64
 
+	// Webhook configuration. WebhookAllowInsecure permits plain HTTP endpoints and
+	// endpoints on private networks, for development.
+	WebhookMaxAttempts    int
+	WebhookRetryBaseDelay time.Duration
+	WebhookRetryMaxDelay  time.Duration
+	WebhookTimeout        time.Duration
+	WebhookAllowInsecure  bool
+
+	// Hourly notification limits per user, keyed by event type
+	NotificationRateLimits map[string]int
+
+	// How often due scheduled notifications are dispatched
+	SchedulerPollInterval time.Duration
+
 	// DLQ configuration
 	DLQMaxRetries      int
 	DLQRetryInterval   time.Duration
@@ -90,138 +157,224 @@ type Config struct {
 	DefaultTemplatePath string
 	TemplateCacheSize   int
 	TemplateCacheTTL    time.Duration
+
+	// GRPCDefaultTimeout is the deadline given to gRPC calls that arrive without one
+	GRPCDefaultTimeout time.Duration
+
+	// ShutdownDrainDelay is how long the service keeps serving after failing its
+	// readiness probe, for load balancers to stop sending it requests, and
+	// ShutdownTimeout bounds the drain of the work in progress that follows
+	ShutdownDrainDelay time.Duration
+	ShutdownTimeout    time.Duration
+
+	// Service-to-service authentication
+	ServiceAuthEnabled  bool
+	ServiceName         string
+	ServiceTokenSecret  string
+	ServiceClientID     string
+	ServiceClientSecret string
+
+	// Secret the auth-service signs user access tokens with
+	JWTSecret string
+
+	// Delivery analytics are served to AnalyticsAPIToken bearers if it is set
+	AnalyticsAPIToken string
+
+	// AdminEmails lists the administrators, who send announcements and manage scheduled
+	// notifications and the dead letter queue. Their accounts must have a verified email.
+	AdminEmails []string
+
+	// User profiles (names, locales and timezones for templates)
+	AuthServiceGRPC string
+	ProfileCacheTTL time.Duration
+
+	// Plan subscribers for announcements; plan audiences are disabled when empty
+	BillingServiceGRPC string
+
+	// How often the feature flags shared by the services are reloaded
+	FeatureFlagsRefresh time.Duration
 }
 
 // Load loads configuration from environment variables
 func Load() *Config {
 	return &Config{
 		// Service configuration
-		ServicePort:     getEnv("NOTIFICATION_SERVICE_PORT", "8084"),
-		GRPCPort:        getEnv("NOTIFICATION_GRPC_PORT", "50054"),
-		WebSocketPort:   getEnv("NOTIFICATION_WEBSOCKET_PORT", "8085"),
-		MetricsPort:     getEnv("NOTIFICATION_METRICS_PORT", "9094"),
-		ServiceHost:     getEnv("NOTIFICATION_SERVICE_HOST", "0.0.0.0"),
-		Environment:     getEnv("ENVIRONMENT", "development"),
-		LogLevel:        getEnv("LOG_LEVEL", "info"),
+		ServicePort:     env.String("NOTIFICATION_SERVICE_PORT", "8084"),
+		GRPCPort:        env.String("NOTIFICATION_GRPC_PORT", "50054"),
+		WebSocketPort:   env.String("NOTIFICATION_WEBSOCKET_PORT", "8085"),
+		MetricsPort:     env.String("NOTIFICATION_METRICS_PORT", "9094"),
+		ServiceHost:     env.String("NOTIFICATION_SERVICE_HOST", "0.0.0.0"),
+		Environment:     env.String("ENVIRONMENT", "development"),
+		LogLevel:        env.String("LOG_LEVEL", "info"),
 
 		// Database configuration
-		MongoURI:        getEnv("MONGO_URI", "mongodb://localhost:27017"),
-		MongoDatabase:   getEnv("MONGO_DATABASE", "file_sharing"),
-		RedisURI:        getEnv("REDIS_URI", "localhost:6379"),
-		RedisPassword:   getEnv("REDIS_PASSWORD", ""),
-		RedisDB:         getEnvAsInt("REDIS_DB", 0),
+		MongoURI:        env.String("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDatabase:   env.String("MONGO_DATABASE", "file_sharing"),
+		RedisURI:        env.String("REDIS_URI", "localhost:6379"),
+		RedisPassword:   env.String("REDIS_PASSWORD", ""),
+		RedisDB:         env.Int("REDIS_DB", 0),
+		RedisMode:       env.String("REDIS_MODE", "standalone"),
+		RedisAddrs:      env.List("REDIS_ADDRS", []string{env.String("REDIS_URI", "localhost:6379")}),
+		RedisMasterName: env.String("REDIS_SENTINEL_MASTER", "mymaster"),
+		RedisSentinelPassword: env.String("REDIS_SENTINEL_PASSWORD", ""),
+		MigrateOnStartup: env.Bool("MIGRATE_ON_STARTUP", true),
 
 		// Kafka configuration
-		KafkaBrokers:    strings.Split(getEnv("KAFKA_BROKERS", "localhost:9092"), ","),
-		KafkaGroupID:    getEnv("KAFKA_GROUP_ID", "notification-service"),
-		FileEventsTopic: getEnv("KAFKA_FILE_EVENTS_TOPIC", "file-events"),
-		DLQTopic:        getEnv("KAFKA_DLQ_TOPIC", "notification-dlq"),
+		KafkaBrokers:    strings.Split(env.String("KAFKA_BROKERS", "localhost:9092"), ","),
+		KafkaGroupID:    env.String("KAFKA_GROUP_ID", "notification-service"),
+		FileEventsTopic: env.String("KAFKA_FILE_EVENTS_TOPIC", "file-events"),
+		BillingEventsTopic: env.String("KAFKA_BILLING_EVENTS_TOPIC", "billing-events"),
+		SecurityEventsTopic: env.String("KAFKA_SECURITY_EVENTS_TOPIC", "security-events"),
+		DLQTopic:        env.String("KAFKA_DLQ_TOPIC", "notification-dlq"),
+		EventDedupTTL:   env.Duration("KAFKA_EVENT_DEDUP_TTL", 24*time.Hour),
 
 		// SMTP configuration
-		SMTPHost:        getEnv("SMTP_HOST", "localhost"),
-		SMTPPort:        getEnvAsInt("SMTP_PORT", 587),
-		SMTPUsername:    getEnv("SMTP_USERNAME", ""),
-		SMTPPassword:    getEnv("SMTP_PASSWORD", ""),
-		SMTPFromEmail:   getEnv("SMTP_FROM_EMAIL", "noreply@file-sharing.com"),
-		SMTPFromName:    getEnv("SMTP_FROM_NAME", "File Sharing Platform"),
-		SMTPTLS:         getEnvAsBool("SMTP_TLS", true),
+		SMTPHost:        env.String("SMTP_HOST", "localhost"),
+		SMTPPort:        env.Int("SMTP_PORT", 587),
+		SMTPUsername:    env.String("SMTP_USERNAME", ""),
+		SMTPPassword:    env.String("SMTP_PASSWORD", ""),
+		SMTPFromEmail:   env.String("SMTP_FROM_EMAIL", "noreply@file-sharing.com"),
+		SMTPFromName:    env.String("SMTP_FROM_NAME", "File Sharing Platform"),
+		SMTPTLS:         env.Bool("SMTP_TLS", true),
+		EmailLogoPath:   env.String("EMAIL_LOGO_PATH", ""),
+		EmailProviders:          strings.Split(env.String("EMAIL_PROVIDERS", "smtp"), ","),
+		EmailProviderRateLimits: getEnvAsIntMap("EMAIL_PROVIDER_RATE_LIMITS"),
+		EmailFailoverThreshold:  env.Int("EMAIL_FAILOVER_THRESHOLD", 3),
+		EmailFailoverCooldown:   env.Duration("EMAIL_FAILOVER_COOLDOWN", time.Minute),
+		SendGridAPIKey:          env.String("SENDGRID_API_KEY", ""),
+		SESRegion:               env.String("SES_REGION", ""),
+		SESAccessKeyID:          env.String("SES_ACCESS_KEY_ID", ""),
+		SESSecretAccessKey:      env.String("SES_SECRET_ACCESS_KEY", ""),
+		SendGridWebhookPublicKey: env.String("SENDGRID_WEBHOOK_PUBLIC_KEY", ""),
+		SESFeedbackTopicARN:      env.String("SES_FEEDBACK_TOPIC_ARN", ""),
+		UnsubscribeTokenSecret: env.String("UNSUBSCRIBE_TOKEN_SECRET", ""),
+		UnsubscribeTokenTTL:    env.Duration("UNSUBSCRIBE_TOKEN_TTL", 2160*time.Hour),
+		NotificationPublicURL:  env.String("NOTIFICATION_PUBLIC_URL", "http://localhost:8084"),
+		FrontendURL:            env.String("FRONTEND_URL", "http://localhost:3000"),
+		GatewayPublicURL:       env.String("GATEWAY_PUBLIC_URL", "http://localhost:8080"),
 
 		// Twilio configuration
-		TwilioAccountSID:   getEnv("TWILIO_ACCOUNT_SID", ""),
-		TwilioAuthToken:    getEnv("TWILIO_AUTH_TOKEN", ""),
-		TwilioPhoneNumber:  getEnv("TWILIO_PHONE_NUMBER", ""),
+		TwilioAccountSID:   env.String("TWILIO_ACCOUNT_SID", ""),
+		TwilioAuthToken:    env.String("TWILIO_AUTH_TOKEN", ""),
+		TwilioPhoneNumber:  env.String("TWILIO_PHONE_NUMBER", ""),
+
+		// SMS configuration
+		SMSProvider:          env.String("SMS_PROVIDER", "twilio"),
+		SMSSenders:           getEnvAsMap("SMS_SENDERS"),
+		SMSSegmentPrices:     getEnvAsMap("SMS_SEGMENT_PRICES"),
+		SMSStatusCallbackURL: env.String("SMS_STATUS_CALLBACK_URL", ""),
 
 		// FCM configuration
-		FCMServerKey:     getEnv("FCM_SERVER_KEY", ""),
-		FCMProjectID:     getEnv("FCM_PROJECT_ID", ""),
+		FCMCredentialsFile: env.String("FCM_CREDENTIALS_FILE", ""),
+		FCMProjectID:       env.String("FCM_PROJECT_ID", ""),
 
 		// WebPush configuration
-		WebPushVAPIDPublicKey:  getEnv("WEBPUSH_VAPID_PUBLIC_KEY", ""),
-		WebPushVAPIDPrivateKey: getEnv("WEBPUSH_VAPID_PRIVATE_KEY", ""),
-		WebPushSubject:         getEnv("WEBPUSH_SUBJECT", "mailto:admin@file-sharing.com"),
+		WebPushVAPIDPublicKey:  env.String("WEBPUSH_VAPID_PUBLIC_KEY", ""),
+		WebPushVAPIDPrivateKey: env.String("WEBPUSH_VAPID_PRIVATE_KEY", ""),
+		WebPushSubject:         env.String("WEBPUSH_SUBJECT", "mailto:admin@file-sharing.com"),
 
 		// Batch configuration
-		BatchWindowDuration: getEnvAsDuration("BATCH_WINDOW_DURATION", "5m"),
-		BatchMaxSize:        getEnvAsInt("BATCH_MAX_SIZE", 100),
-		BatchFlushInterval:  getEnvAsDuration("BATCH_FLUSH_INTERVAL", "1m"),
+		BatchWindowDuration: env.Duration("BATCH_WINDOW_DURATION", 5*time.Minute),
+		BatchMaxSize:        env.Int("BATCH_MAX_SIZE", 100),
+		BatchFlushInterval:  env.Duration("BATCH_FLUSH_INTERVAL", time.Minute),
 
 		// Retry configuration
-		MaxRetries:      getEnvAsInt("MAX_RETRIES", 3),
-		RetryBaseDelay:  getEnvAsDuration("RETRY_BASE_DELAY", "1s"),
-		RetryMaxDelay:   getEnvAsDuration("RETRY_MAX_DELAY", "5m"),
-		RetryMultiplier: getEnvAsFloat("RETRY_MULTIPLIER", 2.0),
+		MaxRetries:      env.Int("MAX_RETRIES", 3),
+		RetryBaseDelay:  env.Duration("RETRY_BASE_DELAY", time.Second),
+		RetryMaxDelay:   env.Duration("RETRY_MAX_DELAY", 5*time.Minute),
+		RetryMultiplier: env.Float("RETRY_MULTIPLIER", 2.0),
+
+		// Webhook configuration
+		WebhookMaxAttempts:    env.Int("WEBHOOK_MAX_ATTEMPTS", 3),
+		WebhookRetryBaseDelay: env.Duration("WEBHOOK_RETRY_BASE_DELAY", time.Second),
+		WebhookRetryMaxDelay:  env.Duration("WEBHOOK_RETRY_MAX_DELAY", 10*time.Second),
+		WebhookTimeout:        env.Duration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookAllowInsecure:  env.Bool("WEBHOOK_ALLOW_INSECURE", false),
+
+		// Notification rate limits
+		NotificationRateLimits: getEnvAsIntMap("NOTIFICATION_RATE_LIMITS"),
+
+		// Scheduled notifications
+		SchedulerPollInterval: env.Duration("SCHEDULER_POLL_INTERVAL", 15*time.Second),
 
 		// DLQ configuration
-		DLQMaxRetries:      getEnvAsInt("DLQ_MAX_RETRIES", 3),
-		DLQRetryInterval:   getEnvAsDuration("DLQ_RETRY_INTERVAL", "1h"),
-		DLQCleanupInterval: getEnvAsDuration("DLQ_CLEANUP_INTERVAL", "24h"),
+		DLQMaxRetries:      env.Int("DLQ_MAX_RETRIES", 3),
+		DLQRetryInterval:   env.Duration("DLQ_RETRY_INTERVAL", time.Hour),
+		DLQCleanupInterval: env.Duration("DLQ_CLEANUP_INTERVAL", 24*time.Hour),
 
 		// Circuit breaker configuration
-		CircuitBreakerMaxRequests: uint32(getEnvAsInt("CIRCUIT_BREAKER_MAX_REQUESTS", 10)),
-		CircuitBreakerInterval:    getEnvAsDuration("CIRCUIT_BREAKER_INTERVAL", "10s"),
-		CircuitBreakerTimeout:     getEnvAsDuration("CIRCUIT_BREAKER_TIMEOUT", "30s"),
+		CircuitBreakerMaxRequests: uint32(env.Int("CIRCUIT_BREAKER_MAX_REQUESTS", 10)),
+		CircuitBreakerInterval:    env.Duration("CIRCUIT_BREAKER_INTERVAL", 10*time.Second),
+		CircuitBreakerTimeout:     env.Duration("CIRCUIT_BREAKER_TIMEOUT", 30*time.Second),
 
 		// Health check configuration
-		HealthCheckInterval: getEnvAsDuration("HEALTH_CHECK_INTERVAL", "30s"),
-		HealthCheckTimeout:  getEnvAsDuration("HEALTH_CHECK_TIMEOUT", "5s"),
+		HealthCheckInterval: env.Duration("HEALTH_CHECK_INTERVAL", 30*time.Second),
+		HealthCheckTimeout:  env.Duration("HEALTH_CHECK_TIMEOUT", 5*time.Second),
 
 		// WebSocket configuration
-		WebSocketReadBufferSize:  getEnvAsInt("WEBSOCKET_READ_BUFFER_SIZE", 1024),
-		WebSocketWriteBufferSize: getEnvAsInt("WEBSOCKET_WRITE_BUFFER_SIZE", 1024),
-		WebSocketPingPeriod:      getEnvAsDuration("WEBSOCKET_PING_PERIOD", "54s"),
-		WebSocketPongWait:        getEnvAsDuration("WEBSOCKET_PONG_WAIT", "60s"),
-		WebSocketWriteWait:       getEnvAsDuration("WEBSOCKET_WRITE_WAIT", "10s"),
+		WebSocketReadBufferSize:  env.Int("WEBSOCKET_READ_BUFFER_SIZE", 1024),
+		WebSocketWriteBufferSize: env.Int("WEBSOCKET_WRITE_BUFFER_SIZE", 1024),
+		WebSocketPingPeriod:      env.Duration("WEBSOCKET_PING_PERIOD", 54*time.Second),
+		WebSocketPongWait:        env.Duration("WEBSOCKET_PONG_WAIT", 60*time.Second),
+		WebSocketWriteWait:       env.Duration("WEBSOCKET_WRITE_WAIT", 10*time.Second),
 
 		// Template configuration
-		DefaultTemplatePath: getEnv("DEFAULT_TEMPLATE_PATH", "./templates"),
-		TemplateCacheSize:   getEnvAsInt("TEMPLATE_CACHE_SIZE", 1000),
-		TemplateCacheTTL:    getEnvAsDuration("TEMPLATE_CACHE_TTL", "1h"),
-	}
-}
+		DefaultTemplatePath: env.String("DEFAULT_TEMPLATE_PATH", "./templates"),
+		TemplateCacheSize:   env.Int("TEMPLATE_CACHE_SIZE", 1000),
+		TemplateCacheTTL:    env.Duration("TEMPLATE_CACHE_TTL", time.Hour),
 
-// Helper functions
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
+		GRPCDefaultTimeout: env.Duration("GRPC_DEFAULT_TIMEOUT", 60*time.Second),
+		ShutdownDrainDelay: env.Duration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		ShutdownTimeout:    env.Duration("SHUTDOWN_TIMEOUT", 30*time.Second),
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
-}
+		// Service-to-service authentication
+		ServiceAuthEnabled:  env.Bool("SERVICE_AUTH_ENABLED", false),
+		ServiceName:         env.String("SERVICE_NAME", "notification-service"),
+		ServiceTokenSecret:  env.String("SERVICE_TOKEN_SECRET", "your-service-token-secret-change-in-production"),
+		ServiceClientID:     env.String("SERVICE_CLIENT_ID", "notification-service"),
+		ServiceClientSecret: env.String("SERVICE_CLIENT_SECRET", ""),
 
-func getEnvAsBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
-		}
+		// User access tokens
+		JWTSecret: env.String("JWT_SECRET", "your-super-secret-key-change-in-production"),
+
+		// Admin analytics
+		AnalyticsAPIToken: env.String("ANALYTICS_API_TOKEN", ""),
+		AdminEmails:       env.List("ADMIN_EMAILS", nil),
+
+		// User profiles
+		AuthServiceGRPC: env.String("AUTH_SERVICE_GRPC", "localhost:50051"),
+		ProfileCacheTTL: env.Duration("PROFILE_CACHE_TTL", 5*time.Minute),
+
+		// Plan subscribers
+		BillingServiceGRPC: env.String("BILLING_SERVICE_GRPC", ""),
+
+		// Feature flags
+		FeatureFlagsRefresh: env.Duration("FEATURE_FLAGS_REFRESH_INTERVAL", featureflags.DefaultRefreshInterval),
 	}
-	return defaultValue
 }
 
-func getEnvAsFloat(key string, defaultValue float64) float64 {
-	if value := os.Getenv(key); value != "" {
-		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
-			return floatValue
+// getEnvAsMap parses a comma separated list of key=value pairs
+func getEnvAsMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.TrimSpace(name) != "" {
+			result[strings.TrimSpace(name)] = strings.TrimSpace(value)
 		}
 	}
-	return defaultValue
+	return result
 }
 
-func getEnvAsDuration(key string, defaultValue string) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
+// getEnvAsIntMap parses a comma separated list of key=value pairs with integer values,
+// skipping pairs whose value is not a positive integer
+func getEnvAsIntMap(key string) map[string]int {
+	result := make(map[string]int)
+	for name, value := range getEnvAsMap(key) {
+		if intValue, err := strconv.Atoi(value); err == nil && intValue > 0 {
+			result[name] = intValue
 		}
 	}
-	duration, _ := time.ParseDuration(defaultValue)
-	return duration
+	return result
 }
 
 // IsProduction returns true if the environment is production
@@ -270,8 +423,8 @@ func (c *Config) GetTwilioConfig() (accountSID, authToken, phoneNumber string) {
 }
 
 // GetFCMConfig returns FCM configuration
-func (c *Config) GetFCMConfig() (serverKey, projectID string) {
-	return c.FCMServerKey, c.FCMProjectID
+func (c *Config) GetFCMConfig() (credentialsFile, projectID string) {
+	return c.FCMCredentialsFile, c.FCMProjectID
 }
 
 // GetWebPushConfig returns WebPush configuration
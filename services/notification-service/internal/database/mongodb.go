@@ -14,12 +14,13 @@ type MongoDB struct {
 	Database *mongo.Database
 }
 
-func NewMongoDB(uri, database string, timeout time.Duration) (*MongoDB, error) {
+// NewMongoDB connects to MongoDB, applying opts, such as injected faults, after the URI
+func NewMongoDB(uri, database string, timeout time.Duration, opts ...*options.ClientOptions) (*MongoDB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	clientOptions := options.Client().ApplyURI(uri)
-	client, err := mongo.Connect(ctx, clientOptions)
+	client, err := mongo.Connect(ctx, append([]*options.ClientOptions{clientOptions}, opts...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
+)
+
+// redisHealthCheckInterval is how often MonitorRedis checks that Redis is available
+const redisHealthCheckInterval = 10 * time.Second
+
+// RedisOptions configure the connection to Redis
+type RedisOptions struct {
+	// Mode is standalone, sentinel or cluster
+	Mode string
+	// Addrs is the server in standalone mode, the sentinels in sentinel mode and the
+	// seed nodes in cluster mode
+	Addrs []string
+	// MasterName is the master the sentinels serve
+	MasterName       string
+	SentinelPassword string
+	Password         string
+	// DB is ignored in cluster mode, which only has database 0
+	DB int
+}
+
+// NewRedis creates the Redis client of the options' mode. It doesn't connect; commands
+// fail while Redis is unavailable, and succeed again once it is back.
+func NewRedis(opts RedisOptions) (redis.UniversalClient, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New("no Redis address")
+	}
+	universal := &redis.UniversalOptions{
+		Addrs:            opts.Addrs,
+		MasterName:       opts.MasterName,
+		SentinelPassword: opts.SentinelPassword,
+		Password:         opts.Password,
+		DB:               opts.DB,
+		DialTimeout:      5 * time.Second,
+		ReadTimeout:      3 * time.Second,
+		WriteTimeout:     3 * time.Second,
+	}
+
+	switch opts.Mode {
+	case "standalone", "":
+		return redis.NewClient(universal.Simple()), nil
+	case "sentinel":
+		if opts.MasterName == "" {
+			return nil, errors.New("sentinel mode needs the master name")
+		}
+		return redis.NewFailoverClient(universal.Failover()), nil
+	case "cluster":
+		return redis.NewClusterClient(universal.Cluster()), nil
+	default:
+		return nil, fmt.Errorf("unknown Redis mode %q", opts.Mode)
+	}
+}
+
+// ScanKeys returns the keys matching a pattern. In cluster mode the keys are spread over
+// the masters, which are each scanned.
+func ScanKeys(ctx context.Context, client redis.UniversalClient, pattern string) ([]string, error) {
+	cluster, ok := client.(*redis.ClusterClient)
+	if !ok {
+		return scanKeys(ctx, client, pattern)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		found, err := scanKeys(ctx, master, pattern)
+		mu.Lock()
+		keys = append(keys, found...)
+		mu.Unlock()
+		return err
+	})
+	return keys, err
+}
+
+// scanKeys returns the keys matching a pattern on one server
+func scanKeys(ctx context.Context, client redis.Cmdable, pattern string) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// MonitorRedis checks that Redis is available until ctx is done, logging when it goes
+// away and comes back, and records the Redis metrics
+func MonitorRedis(ctx context.Context, client redis.UniversalClient, m *metrics.Metrics, logger *logrus.Logger) {
+	ticker := time.NewTicker(redisHealthCheckInterval)
+	defer ticker.Stop()
+
+	available := true
+	var last redis.PoolStats
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := client.Ping(pingCtx).Err()
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.RecordRedisUp(err == nil)
+		switch {
+		case err != nil && available:
+			logger.WithError(err).Warn("Redis is unavailable; notifications are sent without batching until it is back")
+		case err == nil && !available:
+			logger.Info("Redis is available again")
+		}
+		available = err == nil
+
+		// The pool counts since it was created; the metrics take what was added since the
+		// last check
+		stats := client.PoolStats()
+		m.RecordRedisPool(stats.TotalConns, stats.IdleConns, stats.StaleConns,
+			delta(stats.Hits, last.Hits), delta(stats.Misses, last.Misses), delta(stats.Timeouts, last.Timeouts))
+		last = *stats
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// delta returns how much a counter grew, or zero if it was reset
+func delta(current, previous uint32) uint32 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
@@ -0,0 +1,415 @@
+// Package email renders notification emails from HTML layouts and builds the MIME
+// messages sent over SMTP, with a plain text alternative and inline images.
+package email
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLayout is used by templates that do not name a layout
+	DefaultLayout = "default"
+	// AlertLayout adds a warning banner, for security alerts and critical notifications
+	AlertLayout = "alert"
+
+	logoContentID = "logo@notification-service"
+	// maxPreheaderLength bounds the preview text shown by mail clients next to the subject
+	maxPreheaderLength = 140
+	// maxLogoSize bounds the size of a custom logo, which is sent with every email
+	maxLogoSize = 100 * 1024
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+//go:embed assets/logo.png
+var defaultLogo []byte
+
+// layouts holds each layout parsed over the shared components
+var layouts = parseLayouts()
+
+func parseLayouts() map[string]*template.Template {
+	components := template.Must(template.ParseFS(templateFS, "templates/components.html"))
+
+	paths, err := fs.Glob(templateFS, "templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+
+	parsed := make(map[string]*template.Template, len(paths))
+	for _, p := range paths {
+		name := strings.TrimSuffix(path.Base(p), ".html")
+		if name == "components" {
+			continue
+		}
+		parsed[name] = template.Must(template.Must(components.Clone()).ParseFS(templateFS, p))
+	}
+	return parsed
+}
+
+// HasLayout reports whether a layout with the given name exists
+func HasLayout(name string) bool {
+	_, ok := layouts[name]
+	return ok
+}
+
+// Content is what a notification email says
+type Content struct {
+	// Layout names the layout to use; empty uses DefaultLayout
+	Layout string
+	Title  string
+	// Text is the plain text message. It is sent as the plain text alternative and shown
+	// in the HTML part when HTML is empty.
+	Text string
+	// HTML is the message rendered as HTML, placed inside the layout
+	HTML template.HTML
+	// Actions are shown as buttons below the message. Actions without a web URL are left
+	// out.
+	Actions []Action
+	// Urgent uses the warning color of the layout
+	Urgent bool
+	// PreferencesURL links the footer to a page where the recipient can unsubscribe
+	PreferencesURL string
+}
+
+// Action is a button linking to URL
+type Action struct {
+	Label string
+	URL   string
+	// Style is "primary", "secondary" or "danger"; empty is primary
+	Style string
+}
+
+// InlineAsset is a file sent with an email and referenced from its HTML by Content-ID
+type InlineAsset struct {
+	ContentID   string
+	ContentType string
+	Filename    string
+	Data        []byte
+}
+
+// Message is a rendered email
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+	Assets  []InlineAsset
+}
+
+// layoutData is what layouts are executed against
+type layoutData struct {
+	Title       string
+	Preheader   string
+	Body        template.HTML
+	Actions     []layoutAction
+	Accent      template.CSS
+	LogoCID     string
+	ProductName string
+	// PreferencesURL is empty when the footer has no preferences link
+	PreferencesURL string
+}
+
+// layoutAction is an action button with its background color
+type layoutAction struct {
+	Label string
+	URL   string
+	Color template.CSS
+}
+
+// Renderer renders notification emails
+type Renderer struct {
+	productName string
+	logo        InlineAsset
+}
+
+// NewRenderer creates a renderer that signs emails with productName and shows the
+// built-in logo
+func NewRenderer(productName string) *Renderer {
+	return &Renderer{
+		productName: productName,
+		logo: InlineAsset{
+			ContentID:   logoContentID,
+			ContentType: "image/png",
+			Filename:    "logo.png",
+			Data:        defaultLogo,
+		},
+	}
+}
+
+// SetLogo replaces the built-in logo with a PNG, JPEG or GIF image
+func (r *Renderer) SetLogo(data []byte) error {
+	if len(data) > maxLogoSize {
+		return fmt.Errorf("logo must be at most %d bytes", maxLogoSize)
+	}
+
+	contentType := http.DetectContentType(data)
+	extensions := map[string]string{
+		"image/png":  "png",
+		"image/jpeg": "jpg",
+		"image/gif":  "gif",
+	}
+	extension, ok := extensions[contentType]
+	if !ok {
+		return fmt.Errorf("logo must be a PNG, JPEG or GIF image, got %s", contentType)
+	}
+
+	r.logo = InlineAsset{
+		ContentID:   logoContentID,
+		ContentType: contentType,
+		Filename:    "logo." + extension,
+		Data:        data,
+	}
+	return nil
+}
+
+// Render renders the HTML and plain text parts of an email
+func (r *Renderer) Render(content Content) (*Message, error) {
+	layoutName := content.Layout
+	if layoutName == "" {
+		layoutName = DefaultLayout
+	}
+	layout, ok := layouts[layoutName]
+	if !ok {
+		return nil, fmt.Errorf("unknown email layout %q", layoutName)
+	}
+
+	accent := template.CSS("#007bff")
+	if content.Urgent {
+		accent = "#dc3545"
+	}
+
+	var actions []layoutAction
+	for _, action := range content.Actions {
+		if !isWebURL(action.URL) {
+			continue
+		}
+		label := action.Label
+		if label == "" {
+			label = "View Details"
+		}
+		color := accent
+		switch action.Style {
+		case "secondary":
+			color = "#6c757d"
+		case "danger":
+			color = "#dc3545"
+		}
+		actions = append(actions, layoutAction{Label: label, URL: action.URL, Color: color})
+	}
+
+	body := content.HTML
+	if body == "" {
+		body = textToHTML(content.Text)
+	}
+
+	preferencesURL := content.PreferencesURL
+	if preferencesURL != "" && !isWebURL(preferencesURL) {
+		preferencesURL = ""
+	}
+
+	var html bytes.Buffer
+	err := layout.ExecuteTemplate(&html, "document", layoutData{
+		Title:          content.Title,
+		Preheader:      preheader(content.Text),
+		Body:           body,
+		Actions:        actions,
+		Accent:         accent,
+		LogoCID:        r.logo.ContentID,
+		ProductName:    r.productName,
+		PreferencesURL: preferencesURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render email layout: %w", err)
+	}
+
+	var text strings.Builder
+	text.WriteString(strings.TrimSpace(content.Text))
+	if len(actions) > 0 {
+		text.WriteString("\n")
+		for _, action := range actions {
+			fmt.Fprintf(&text, "\n%s: %s", action.Label, action.URL)
+		}
+	}
+	fmt.Fprintf(&text, "\n\n--\nThis is an automated message from %s.\n", r.productName)
+	if preferencesURL != "" {
+		fmt.Fprintf(&text, "Unsubscribe or manage your notification preferences: %s\n", preferencesURL)
+	} else {
+		text.WriteString("If you no longer wish to receive these notifications, please update your preferences.\n")
+	}
+
+	return &Message{
+		Subject: content.Title,
+		Text:    text.String(),
+		HTML:    html.String(),
+		Assets:  []InlineAsset{r.logo},
+	}, nil
+}
+
+// Bytes encodes the email as a multipart/related message holding the plain text and
+// HTML alternatives and the inline assets. extraHeaders are added after the standard
+// headers, sorted by name.
+func (m *Message) Bytes(from mail.Address, to string, extraHeaders map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	related := multipart.NewWriter(&buf)
+
+	var header bytes.Buffer
+	writeHeader := func(name, value string) {
+		fmt.Fprintf(&header, "%s: %s\r\n", name, value)
+	}
+	writeHeader("From", from.String())
+	writeHeader("To", to)
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", mime.FormatMediaType("multipart/related", map[string]string{
+		"boundary": related.Boundary(),
+		"type":     "multipart/alternative",
+	}))
+	names := make([]string, 0, len(extraHeaders))
+	for name := range extraHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeHeader(name, extraHeaders[name])
+	}
+	header.WriteString("\r\n")
+
+	// The alternatives, plain text first so clients prefer the HTML part
+	var alternatives bytes.Buffer
+	alternative := multipart.NewWriter(&alternatives)
+	if err := writeQuotedPrintable(alternative, "text/plain; charset=UTF-8", m.Text); err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(alternative, "text/html; charset=UTF-8", m.HTML); err != nil {
+		return nil, err
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+
+	part, err := related.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.Boundary()})},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(alternatives.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, asset := range m.Assets {
+		part, err := related.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {asset.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + asset.ContentID + ">"},
+			"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": asset.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, asset.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := related.Close(); err != nil {
+		return nil, err
+	}
+
+	return append(header.Bytes(), buf.Bytes()...), nil
+}
+
+// writeQuotedPrintable writes a quoted-printable encoded part
+func writeQuotedPrintable(w *multipart.Writer, contentType, body string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters
+func writeBase64(w interface{ Write([]byte) (int, error) }, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := 76
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:n]); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// textToHTML escapes plain text for the HTML part, turning blank lines into paragraphs
+// and line breaks into <br>
+func textToHTML(text string) template.HTML {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\r\n", "\n")
+	if text == "" {
+		return ""
+	}
+
+	var html strings.Builder
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		lines := strings.Split(paragraph, "\n")
+		for i, line := range lines {
+			lines[i] = template.HTMLEscapeString(line)
+		}
+		fmt.Fprintf(&html, `<p style="margin:0 0 16px;">%s</p>`, strings.Join(lines, "<br>"))
+	}
+	return template.HTML(html.String())
+}
+
+// preheader returns the first line of a message, shortened to maxPreheaderLength
+func preheader(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		runes := []rune(line)
+		if len(runes) > maxPreheaderLength {
+			return string(runes[:maxPreheaderLength-1]) + "…"
+		}
+		return line
+	}
+	return ""
+}
+
+// isWebURL reports whether a link is an absolute http or https URL
+func isWebURL(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
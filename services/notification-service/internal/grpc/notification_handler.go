@@ -2,30 +2,62 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/serviceauth"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/services"
 	notificationv1 "github.com/yourusername/distributed-file-sharing/services/notification-service/pkg/pb/notification/v1"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // NotificationGRPCServer implements the gRPC server for notification service
 type NotificationGRPCServer struct {
 	notificationv1.UnimplementedNotificationServiceServer
-	notifSvc *services.NotificationService
-	logger   *logrus.Logger
+	notifSvc    *services.NotificationService
+	scheduleSvc *services.ScheduleService
+	stream      NotificationStream
+	userTokens  *jwtauth.Validator
+	// servicesAuthenticated requires subscribers without an access token to be services
+	servicesAuthenticated bool
+	logger                *logrus.Logger
+}
+
+// NotificationStream delivers the notifications sent to a user as they are sent
+type NotificationStream interface {
+	Subscribe(userID string) chan *models.Notification
+	Unsubscribe(userID string, ch chan *models.Notification)
 }
 
 // NewNotificationGRPCServer creates a new NotificationGRPCServer
-func NewNotificationGRPCServer(notifSvc *services.NotificationService, logger *logrus.Logger) *NotificationGRPCServer {
+func NewNotificationGRPCServer(notifSvc *services.NotificationService, scheduleSvc *services.ScheduleService, logger *logrus.Logger) *NotificationGRPCServer {
 	return &NotificationGRPCServer{
-		notifSvc: notifSvc,
-		logger:   logger,
+		notifSvc:    notifSvc,
+		scheduleSvc: scheduleSvc,
+		logger:      logger,
 	}
 }
 
+// SetNotificationStream enables SubscribeNotifications
+func (s *NotificationGRPCServer) SetNotificationStream(stream NotificationStream) {
+	s.stream = stream
+}
+
+// SetUserTokens lets clients subscribe to their own notifications with user access
+// tokens. When servicesAuthenticated, subscribers without an access token must carry a
+// service token.
+func (s *NotificationGRPCServer) SetUserTokens(validator *jwtauth.Validator, servicesAuthenticated bool) {
+	s.userTokens = validator
+	s.servicesAuthenticated = servicesAuthenticated
+}
+
 // SendNotification handles incoming gRPC requests to send a notification
 func (s *NotificationGRPCServer) SendNotification(ctx context.Context, req *notificationv1.SendNotificationRequest) (*notificationv1.SendNotificationResponse, error) {
 	s.logger.WithFields(logrus.Fields{
@@ -35,24 +67,8 @@ func (s *NotificationGRPCServer) SendNotification(ctx context.Context, req *noti
 		"channel":    req.Channel.String(),
 	}).Info("Received gRPC SendNotification request")
 
-	// Convert gRPC request to internal model
-	internalReq := &models.NotificationRequest{
-		UserID:    req.UserId,
-		EventType: models.EventType(req.EventType.String()),
-		Channel:   models.ChannelEmail, // Default to email for now
-		Title:     req.Title,
-		Message:   req.Message,
-		Priority:  models.PriorityNormal, // Default priority
-		Metadata:  make(map[string]interface{}),
-	}
-
-	// Convert metadata
-	for key, value := range req.Metadata {
-		internalReq.Metadata[key] = value
-	}
-
 	// Send notification using the core service
-	resp, err := s.notifSvc.SendNotification(ctx, internalReq)
+	resp, err := s.notifSvc.SendNotification(ctx, notificationRequestFromProto(req))
 	if err != nil {
 		s.logger.WithError(err).Error("Failed to send notification via gRPC")
 		return nil, status.Errorf(codes.Internal, "failed to send notification: %v", err)
@@ -61,15 +77,72 @@ func (s *NotificationGRPCServer) SendNotification(ctx context.Context, req *noti
 	// Convert internal response to gRPC response
 	grpcResp := &notificationv1.SendNotificationResponse{
 		Id:      resp.ID,
-		Status:  notificationv1.NotificationStatus_NOTIFICATION_STATUS_SENT,
-		Channel: req.Channel,
-		Error:   "",
+		Status:  notificationStatusToProto(resp.Status),
+		Channel: channelToProto(resp.Channel, req.Channel),
+		Error:   resp.Error,
 	}
 
 	s.logger.WithField("notification_id", resp.ID).Info("gRPC SendNotification request processed")
 	return grpcResp, nil
 }
 
+// ScheduleNotification handles incoming gRPC requests to send a notification later
+func (s *NotificationGRPCServer) ScheduleNotification(ctx context.Context, req *notificationv1.ScheduleNotificationRequest) (*notificationv1.ScheduledNotificationResponse, error) {
+	if req.Notification == nil {
+		return nil, status.Error(codes.InvalidArgument, "notification is required")
+	}
+	if req.SendAt == nil {
+		return nil, status.Error(codes.InvalidArgument, "send_at is required")
+	}
+
+	scheduled, err := s.scheduleSvc.ScheduleNotification(ctx, notificationRequestFromProto(req.Notification), req.SendAt.AsTime())
+	if err != nil {
+		return nil, s.scheduleError(err, "failed to schedule notification")
+	}
+
+	return &notificationv1.ScheduledNotificationResponse{ScheduledNotification: scheduledNotificationToProto(scheduled)}, nil
+}
+
+// CancelScheduledNotification handles incoming gRPC requests to cancel a scheduled notification
+func (s *NotificationGRPCServer) CancelScheduledNotification(ctx context.Context, req *notificationv1.CancelScheduledNotificationRequest) (*notificationv1.ScheduledNotificationResponse, error) {
+	scheduled, err := s.scheduleSvc.CancelScheduledNotification(ctx, req.Id)
+	if err != nil {
+		return nil, s.scheduleError(err, "failed to cancel scheduled notification")
+	}
+
+	return &notificationv1.ScheduledNotificationResponse{ScheduledNotification: scheduledNotificationToProto(scheduled)}, nil
+}
+
+// RescheduleNotification handles incoming gRPC requests to change when a scheduled
+// notification is sent
+func (s *NotificationGRPCServer) RescheduleNotification(ctx context.Context, req *notificationv1.RescheduleNotificationRequest) (*notificationv1.ScheduledNotificationResponse, error) {
+	if req.SendAt == nil {
+		return nil, status.Error(codes.InvalidArgument, "send_at is required")
+	}
+
+	scheduled, err := s.scheduleSvc.RescheduleNotification(ctx, req.Id, req.SendAt.AsTime())
+	if err != nil {
+		return nil, s.scheduleError(err, "failed to reschedule notification")
+	}
+
+	return &notificationv1.ScheduledNotificationResponse{ScheduledNotification: scheduledNotificationToProto(scheduled)}, nil
+}
+
+// scheduleError maps a schedule service error to a gRPC status
+func (s *NotificationGRPCServer) scheduleError(err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidSchedule):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, repository.ErrScheduledNotificationNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrScheduledNotificationNotPending):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		s.logger.WithError(err).Error("Failed to handle scheduled notification via gRPC")
+		return status.Errorf(codes.Internal, "%s: %v", message, err)
+	}
+}
+
 // GetUnreadCount handles incoming gRPC requests to get unread notification count
 func (s *NotificationGRPCServer) GetUnreadCount(ctx context.Context, req *notificationv1.GetUnreadCountRequest) (*notificationv1.GetUnreadCountResponse, error) {
 	s.logger.WithField("user_id", req.UserId).Info("Received gRPC GetUnreadCount request")
@@ -92,3 +165,324 @@ func (s *NotificationGRPCServer) GetUnreadCount(ctx context.Context, req *notifi
 	}).Info("gRPC GetUnreadCount request processed")
 	return grpcResp, nil
 }
+
+// SubscribeNotifications streams the notifications sent to a user until the caller
+// cancels the call. Notifications sent while the subscriber is too slow to receive them
+// are skipped; GetNotifications returns them.
+func (s *NotificationGRPCServer) SubscribeNotifications(req *notificationv1.SubscribeNotificationsRequest, stream notificationv1.NotificationService_SubscribeNotificationsServer) error {
+	if s.stream == nil {
+		return status.Error(codes.Unavailable, "notification streaming is not enabled")
+	}
+
+	ctx := stream.Context()
+	userID, err := s.subscriber(ctx, req.UserId)
+	if err != nil {
+		return err
+	}
+
+	eventTypes := make(map[models.EventType]bool, len(req.EventTypes))
+	for _, eventType := range req.EventTypes {
+		eventTypes[eventTypeFromProto(eventType)] = true
+	}
+	channels := make(map[models.NotificationChannel]bool, len(req.Channels))
+	for _, channel := range req.Channels {
+		channels[channelFromProto(channel)] = true
+	}
+
+	notifications := s.stream.Subscribe(userID)
+	defer s.stream.Unsubscribe(userID, notifications)
+
+	s.logger.WithField("user_id", userID).Info("gRPC notification subscriber connected")
+	defer s.logger.WithField("user_id", userID).Info("gRPC notification subscriber disconnected")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification, ok := <-notifications:
+			if !ok {
+				return nil
+			}
+			if len(eventTypes) > 0 && !eventTypes[notification.EventType] {
+				continue
+			}
+			if len(channels) > 0 && !channels[notification.Channel] {
+				continue
+			}
+			if err := stream.Send(notificationToProto(notification)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// subscriber returns the user a SubscribeNotifications caller may subscribe to. Clients
+// with an access token subscribe to their own notifications; services subscribe to the
+// notifications of the requested user.
+func (s *NotificationGRPCServer) subscriber(ctx context.Context, requestedUserID string) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if tokens := md.Get("authorization"); len(tokens) > 0 && s.userTokens != nil {
+		claims, err := s.userTokens.ValidateToken(tokens[0])
+		if err != nil {
+			if errors.Is(err, jwtauth.ErrExpiredToken) {
+				return "", status.Error(codes.Unauthenticated, "access token has expired")
+			}
+			return "", status.Error(codes.Unauthenticated, "invalid access token")
+		}
+		if requestedUserID != "" && requestedUserID != claims.UserID {
+			return "", status.Error(codes.PermissionDenied, "cannot subscribe to the notifications of another user")
+		}
+		return claims.UserID, nil
+	}
+
+	if _, ok := serviceauth.CallerFromContext(ctx); !ok && s.servicesAuthenticated {
+		return "", status.Error(codes.Unauthenticated, "missing access token or service token")
+	}
+	if requestedUserID == "" {
+		return "", status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	return requestedUserID, nil
+}
+
+// notificationRequestFromProto converts a gRPC send request to the internal model
+func notificationRequestFromProto(req *notificationv1.SendNotificationRequest) *models.NotificationRequest {
+	internalReq := &models.NotificationRequest{
+		UserID:           req.UserId,
+		EventType:        eventTypeFromProto(req.EventType),
+		Channel:          channelFromProto(req.Channel),
+		Title:            req.Title,
+		Message:          req.Message,
+		Priority:         priorityFromProto(req.Priority),
+		TemplateID:       req.TemplateId,
+		Metadata:         make(map[string]interface{}),
+		BypassBatching:   req.BypassBatching,
+		BypassQuietHours: req.BypassQuietHours,
+	}
+
+	// Convert metadata
+	for key, value := range req.Metadata {
+		internalReq.Metadata[key] = value
+	}
+
+	for _, action := range req.Actions {
+		internalReq.Actions = append(internalReq.Actions, models.NotificationAction{
+			Label:  action.Label,
+			URL:    action.Url,
+			Intent: action.Intent,
+			Style:  models.NotificationActionStyle(action.Style),
+		})
+	}
+
+	return internalReq
+}
+
+// scheduledNotificationToProto converts a scheduled notification to its gRPC message
+func scheduledNotificationToProto(scheduled *models.ScheduledNotification) *notificationv1.ScheduledNotification {
+	return &notificationv1.ScheduledNotification{
+		Id:             scheduled.ID.Hex(),
+		UserId:         scheduled.UserID,
+		SendAt:         timestamppb.New(scheduled.SendAt),
+		Status:         string(scheduled.Status),
+		NotificationId: scheduled.NotificationID,
+		Attempts:       int32(scheduled.Attempts),
+		Error:          scheduled.Error,
+		CreatedAt:      timestamppb.New(scheduled.CreatedAt),
+		UpdatedAt:      timestamppb.New(scheduled.UpdatedAt),
+	}
+}
+
+// notificationToProto converts a notification to its gRPC message
+func notificationToProto(notification *models.Notification) *notificationv1.Notification {
+	msg := &notificationv1.Notification{
+		Id:          notification.ID.Hex(),
+		UserId:      notification.UserID,
+		EventType:   eventTypeToProto(notification.EventType),
+		Channel:     channelToProto(notification.Channel, notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_UNSPECIFIED),
+		Title:       notification.Title,
+		Message:     notification.Message,
+		Status:      notificationStatusToProto(notification.Status),
+		Priority:    priorityToProto(notification.Priority),
+		TemplateId:  notification.TemplateID,
+		Metadata:    make(map[string]string, len(notification.Metadata)),
+		CreatedAt:   timestamppb.New(notification.CreatedAt),
+		UpdatedAt:   timestamppb.New(notification.UpdatedAt),
+		RetryCount:  int32(notification.RetryCount),
+		ErrorReason: notification.ErrorReason,
+	}
+	for key, value := range notification.Metadata {
+		msg.Metadata[key] = fmt.Sprint(value)
+	}
+	for _, action := range notification.Actions {
+		msg.Actions = append(msg.Actions, &notificationv1.NotificationAction{
+			Label:  action.Label,
+			Url:    action.URL,
+			Intent: action.Intent,
+			Style:  string(action.Style),
+		})
+	}
+	if notification.SentAt != nil {
+		msg.SentAt = timestamppb.New(*notification.SentAt)
+	}
+	if notification.ReadAt != nil {
+		msg.ReadAt = timestamppb.New(*notification.ReadAt)
+	}
+	return msg
+}
+
+// eventTypeToProto maps an internal event type to its protobuf event type, unspecified
+// for event types the protobuf enum does not name
+func eventTypeToProto(eventType models.EventType) notificationv1.EventType {
+	switch eventType {
+	case models.EventTypeFileUploaded:
+		return notificationv1.EventType_EVENT_TYPE_FILE_UPLOADED
+	case models.EventTypeFileUploadFailed:
+		return notificationv1.EventType_EVENT_TYPE_FILE_UPLOAD_FAILED
+	case models.EventTypeFileDeleted:
+		return notificationv1.EventType_EVENT_TYPE_FILE_DELETED
+	case models.EventTypeFileShared:
+		return notificationv1.EventType_EVENT_TYPE_FILE_SHARED
+	case models.EventTypeQuotaWarning80:
+		return notificationv1.EventType_EVENT_TYPE_QUOTA_WARNING_80
+	case models.EventTypeQuotaWarning90:
+		return notificationv1.EventType_EVENT_TYPE_QUOTA_WARNING_90
+	case models.EventTypeQuotaExceeded:
+		return notificationv1.EventType_EVENT_TYPE_QUOTA_EXCEEDED
+	case models.EventTypeSecurityAlert:
+		return notificationv1.EventType_EVENT_TYPE_SECURITY_ALERT
+	case models.EventTypeSystemMaintenance:
+		return notificationv1.EventType_EVENT_TYPE_SYSTEM_MAINTENANCE
+	case models.EventTypeInvoiceIssued:
+		return notificationv1.EventType_EVENT_TYPE_INVOICE_ISSUED
+	case models.EventTypePaymentFailed:
+		return notificationv1.EventType_EVENT_TYPE_PAYMENT_FAILED
+	case models.EventTypeTrialEnding:
+		return notificationv1.EventType_EVENT_TYPE_TRIAL_ENDING
+	case models.EventTypePaymentSucceeded:
+		return notificationv1.EventType_EVENT_TYPE_PAYMENT_SUCCEEDED
+	case models.EventTypeSubscriptionRenewed:
+		return notificationv1.EventType_EVENT_TYPE_SUBSCRIPTION_RENEWED
+	case models.EventTypeSubscriptionCancelled:
+		return notificationv1.EventType_EVENT_TYPE_SUBSCRIPTION_CANCELLED
+	default:
+		return notificationv1.EventType_EVENT_TYPE_UNSPECIFIED
+	}
+}
+
+// eventTypeFromProto maps a protobuf event type to the internal event type
+func eventTypeFromProto(eventType notificationv1.EventType) models.EventType {
+	switch eventType {
+	case notificationv1.EventType_EVENT_TYPE_FILE_UPLOADED:
+		return models.EventTypeFileUploaded
+	case notificationv1.EventType_EVENT_TYPE_FILE_UPLOAD_FAILED:
+		return models.EventTypeFileUploadFailed
+	case notificationv1.EventType_EVENT_TYPE_FILE_DELETED:
+		return models.EventTypeFileDeleted
+	case notificationv1.EventType_EVENT_TYPE_FILE_SHARED:
+		return models.EventTypeFileShared
+	case notificationv1.EventType_EVENT_TYPE_QUOTA_WARNING_80:
+		return models.EventTypeQuotaWarning80
+	case notificationv1.EventType_EVENT_TYPE_QUOTA_WARNING_90:
+		return models.EventTypeQuotaWarning90
+	case notificationv1.EventType_EVENT_TYPE_QUOTA_EXCEEDED:
+		return models.EventTypeQuotaExceeded
+	case notificationv1.EventType_EVENT_TYPE_SECURITY_ALERT:
+		return models.EventTypeSecurityAlert
+	case notificationv1.EventType_EVENT_TYPE_SYSTEM_MAINTENANCE:
+		return models.EventTypeSystemMaintenance
+	case notificationv1.EventType_EVENT_TYPE_INVOICE_ISSUED:
+		return models.EventTypeInvoiceIssued
+	case notificationv1.EventType_EVENT_TYPE_PAYMENT_FAILED:
+		return models.EventTypePaymentFailed
+	case notificationv1.EventType_EVENT_TYPE_TRIAL_ENDING:
+		return models.EventTypeTrialEnding
+	case notificationv1.EventType_EVENT_TYPE_PAYMENT_SUCCEEDED:
+		return models.EventTypePaymentSucceeded
+	case notificationv1.EventType_EVENT_TYPE_SUBSCRIPTION_RENEWED:
+		return models.EventTypeSubscriptionRenewed
+	case notificationv1.EventType_EVENT_TYPE_SUBSCRIPTION_CANCELLED:
+		return models.EventTypeSubscriptionCancelled
+	default:
+		return models.EventType(eventType.String())
+	}
+}
+
+// channelFromProto maps a protobuf channel to the internal channel, defaulting to email
+func channelFromProto(channel notificationv1.NotificationChannel) models.NotificationChannel {
+	switch channel {
+	case notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_SMS:
+		return models.ChannelSMS
+	case notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_PUSH:
+		return models.ChannelPush
+	case notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_INAPP:
+		return models.ChannelInApp
+	case notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_WEBSOCKET:
+		return models.ChannelWebSocket
+	default:
+		return models.ChannelEmail
+	}
+}
+
+// channelToProto maps an internal channel to its protobuf channel, keeping fallback for
+// channels the protobuf enum does not name
+func channelToProto(channel models.NotificationChannel, fallback notificationv1.NotificationChannel) notificationv1.NotificationChannel {
+	switch channel {
+	case models.ChannelEmail:
+		return notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_EMAIL
+	case models.ChannelSMS:
+		return notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_SMS
+	case models.ChannelPush:
+		return notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_PUSH
+	case models.ChannelInApp:
+		return notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_INAPP
+	case models.ChannelWebSocket:
+		return notificationv1.NotificationChannel_NOTIFICATION_CHANNEL_WEBSOCKET
+	default:
+		return fallback
+	}
+}
+
+// notificationStatusToProto maps an internal status to its protobuf status
+func notificationStatusToProto(notificationStatus models.NotificationStatus) notificationv1.NotificationStatus {
+	switch notificationStatus {
+	case models.StatusPending:
+		return notificationv1.NotificationStatus_NOTIFICATION_STATUS_PENDING
+	case models.StatusFailed:
+		return notificationv1.NotificationStatus_NOTIFICATION_STATUS_FAILED
+	case models.StatusRead:
+		return notificationv1.NotificationStatus_NOTIFICATION_STATUS_READ
+	case models.StatusDeferred:
+		return notificationv1.NotificationStatus_NOTIFICATION_STATUS_DEFERRED
+	default:
+		return notificationv1.NotificationStatus_NOTIFICATION_STATUS_SENT
+	}
+}
+
+// priorityFromProto maps a protobuf priority to the internal priority, defaulting to normal
+func priorityFromProto(priority notificationv1.Priority) models.Priority {
+	switch priority {
+	case notificationv1.Priority_PRIORITY_LOW:
+		return models.PriorityLow
+	case notificationv1.Priority_PRIORITY_HIGH:
+		return models.PriorityHigh
+	case notificationv1.Priority_PRIORITY_CRITICAL:
+		return models.PriorityCritical
+	default:
+		return models.PriorityNormal
+	}
+}
+
+// priorityToProto maps an internal priority to its protobuf priority
+func priorityToProto(priority models.Priority) notificationv1.Priority {
+	switch priority {
+	case models.PriorityLow:
+		return notificationv1.Priority_PRIORITY_LOW
+	case models.PriorityNormal:
+		return notificationv1.Priority_PRIORITY_NORMAL
+	case models.PriorityHigh:
+		return notificationv1.Priority_PRIORITY_HIGH
+	case models.PriorityCritical:
+		return notificationv1.Priority_PRIORITY_CRITICAL
+	default:
+		return notificationv1.Priority_PRIORITY_UNSPECIFIED
+	}
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+)
+
+// WebhookURLStore looks up the chat webhooks users configured for notifications
+type WebhookURLStore interface {
+	GetWebhookURL(ctx context.Context, userID string, channel models.NotificationChannel) (string, error)
+}
+
+// ChatWebhookHandler posts notifications to the Slack, Discord or Microsoft Teams incoming
+// webhook a user configured in their preferences
+type ChatWebhookHandler struct {
+	channel    models.NotificationChannel
+	webhooks   WebhookURLStore
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewChatWebhookHandler creates a handler for the slack, discord or teams channel
+func NewChatWebhookHandler(channel models.NotificationChannel, webhooks WebhookURLStore, logger *logrus.Logger) *ChatWebhookHandler {
+	return &ChatWebhookHandler{
+		channel:  channel,
+		webhooks: webhooks,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			// Webhook URLs are checked against the chat service hosts when saved, so
+			// redirects elsewhere are not followed
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: logger,
+	}
+}
+
+// Send posts the notification to the user's webhook
+func (h *ChatWebhookHandler) Send(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error) {
+	start := time.Now()
+
+	fail := func(reason string, err error) (*models.NotificationResponse, error) {
+		return &models.NotificationResponse{
+			Status:   models.StatusFailed,
+			Channel:  h.channel,
+			Error:    reason,
+			Duration: time.Since(start).Milliseconds(),
+		}, err
+	}
+
+	// Validate request
+	if err := h.Validate(req); err != nil {
+		return fail(err.Error(), err)
+	}
+
+	webhookURL, err := h.webhooks.GetWebhookURL(ctx, req.UserID, h.channel)
+	if err != nil {
+		return fail("failed to get webhook URL", fmt.Errorf("failed to get %s webhook URL: %w", h.channel, err))
+	}
+	if webhookURL == "" {
+		err := fmt.Errorf("user has no %s webhook configured", h.channel)
+		return fail(err.Error(), err)
+	}
+
+	if err := h.post(ctx, webhookURL, h.createPayload(req)); err != nil {
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"user_id": req.UserID,
+			"channel": h.channel,
+		}).Error("Failed to send chat notification")
+		return fail(err.Error(), err)
+	}
+
+	now := time.Now()
+	h.logger.WithFields(logrus.Fields{
+		"user_id": req.UserID,
+		"channel": h.channel,
+	}).Info("Chat notification sent successfully")
+
+	return &models.NotificationResponse{
+		Status:   models.StatusSent,
+		Channel:  h.channel,
+		SentAt:   &now,
+		Duration: time.Since(start).Milliseconds(),
+	}, nil
+}
+
+// createPayload creates the webhook body in the format of the chat service
+func (h *ChatWebhookHandler) createPayload(req *models.NotificationRequest) interface{} {
+	link, _ := req.Metadata["link"].(string)
+	if !strings.HasPrefix(link, "https://") {
+		link = ""
+	}
+
+	switch h.channel {
+	case models.ChannelSlack:
+		text := "*" + escapeSlackText(req.Title) + "*\n" + escapeSlackText(req.Message)
+		if link != "" {
+			text += "\n<" + link + "|Open>"
+		}
+		return map[string]interface{}{
+			"text": text,
+		}
+
+	case models.ChannelDiscord:
+		embed := map[string]interface{}{
+			"title":       truncate(req.Title, 256),
+			"description": truncate(req.Message, 4096),
+			"color":       discordPriorityColor(req.Priority),
+			"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		}
+		if link != "" {
+			embed["url"] = link
+		}
+		return map[string]interface{}{
+			"embeds": []interface{}{embed},
+			// Never ping anyone mentioned in notification text
+			"allowed_mentions": map[string]interface{}{"parse": []string{}},
+		}
+
+	default:
+		card := map[string]interface{}{
+			"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+			"type":    "AdaptiveCard",
+			"version": "1.4",
+			"body": []interface{}{
+				map[string]interface{}{"type": "TextBlock", "text": req.Title, "weight": "Bolder", "size": "Medium", "wrap": true},
+				map[string]interface{}{"type": "TextBlock", "text": req.Message, "wrap": true},
+			},
+		}
+		if link != "" {
+			card["actions"] = []interface{}{
+				map[string]interface{}{"type": "Action.OpenUrl", "title": "Open", "url": link},
+			}
+		}
+		return map[string]interface{}{
+			"type": "message",
+			"attachments": []interface{}{
+				map[string]interface{}{
+					"contentType": "application/vnd.microsoft.card.adaptive",
+					"content":     card,
+				},
+			},
+		}
+	}
+}
+
+// post sends a JSON body to a webhook
+func (h *ChatWebhookHandler) post(ctx context.Context, webhookURL string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s webhook: %w", h.channel, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s webhook failed with status %d: %s", h.channel, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	return nil
+}
+
+// Validate validates the notification request
+func (h *ChatWebhookHandler) Validate(req *models.NotificationRequest) error {
+	if req.UserID == "" {
+		return fmt.Errorf("user ID is required")
+	}
+
+	if req.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+
+	if req.Message == "" {
+		return fmt.Errorf("message is required")
+	}
+
+	return nil
+}
+
+// GetName returns the handler name
+func (h *ChatWebhookHandler) GetName() string {
+	return string(h.channel)
+}
+
+// IsEnabled checks if the handler is enabled
+func (h *ChatWebhookHandler) IsEnabled() bool {
+	switch h.channel {
+	case models.ChannelSlack, models.ChannelDiscord, models.ChannelTeams:
+		return h.webhooks != nil
+	}
+	return false
+}
+
+// TestConnection has nothing to check, as webhooks are configured per user
+func (h *ChatWebhookHandler) TestConnection(ctx context.Context) error {
+	return nil
+}
+
+// escapeSlackText escapes the characters Slack treats as control sequences
+func escapeSlackText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// discordPriorityColor returns the embed color of a priority
+func discordPriorityColor(priority models.Priority) int {
+	switch priority {
+	case models.PriorityCritical:
+		return 0xED4245
+	case models.PriorityHigh:
+		return 0xFEE75C
+	default:
+		return 0x5865F2
+	}
+}
+
+func truncate(text string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+	return string(runes[:maxRunes-1]) + "…"
+}
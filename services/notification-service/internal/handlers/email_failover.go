@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
+)
+
+// ErrNoEmailProvider is returned when no email provider could send an email, because
+// all of them failed or are at their rate limit
+var ErrNoEmailProvider = errors.New("no email provider available")
+
+// EmailFailover sends emails through the first healthy email provider with capacity, in
+// the configured order. A provider that fails failureThreshold times in a row is skipped
+// for cooldown; when every provider is skipped, they are tried anyway.
+type EmailFailover struct {
+	providers        []*emailProviderState
+	failureThreshold int
+	cooldown         time.Duration
+	mu               sync.Mutex
+	metrics          *metrics.Metrics
+	logger           *logrus.Logger
+}
+
+// emailProviderState is the health and rate limit of a provider, guarded by the
+// failover's mutex
+type emailProviderState struct {
+	provider EmailProvider
+	// rateLimit is the number of emails per second, zero for no limit. Tokens refill
+	// continuously up to one second of emails.
+	rateLimit  float64
+	tokens     float64
+	refilledAt time.Time
+
+	consecutiveFailures int
+	unhealthyUntil      time.Time
+}
+
+// NewEmailFailover creates an email failover without providers
+func NewEmailFailover(failureThreshold int, cooldown time.Duration, logger *logrus.Logger) *EmailFailover {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &EmailFailover{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		logger:           logger,
+	}
+}
+
+// SetMetrics enables recording sends per provider
+func (f *EmailFailover) SetMetrics(m *metrics.Metrics) {
+	f.metrics = m
+}
+
+// AddProvider adds a provider after the ones already added. rateLimit is the number of
+// emails per second sent through it, zero for no limit.
+func (f *EmailFailover) AddProvider(provider EmailProvider, rateLimit int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.providers = append(f.providers, &emailProviderState{
+		provider:   provider,
+		rateLimit:  float64(rateLimit),
+		tokens:     float64(rateLimit),
+		refilledAt: time.Now(),
+	})
+}
+
+// Len returns the number of providers
+func (f *EmailFailover) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.providers)
+}
+
+// Send sends an email and returns the name of the provider that sent it and the message
+// ID it assigned. Emails a provider rejects are not failed over.
+func (f *EmailFailover) Send(ctx context.Context, msg *EmailMessage) (string, string, error) {
+	var errs []error
+	for _, state := range f.candidates() {
+		name := state.provider.Name()
+		if !f.take(state) {
+			f.metrics.RecordEmailProviderSend(name, "rate_limited")
+			errs = append(errs, fmt.Errorf("%s: rate limit reached", name))
+			continue
+		}
+
+		messageID, err := state.provider.Send(ctx, msg)
+		if err == nil {
+			f.recordSuccess(state)
+			f.metrics.RecordEmailProviderSend(name, "sent")
+			return name, messageID, nil
+		}
+		if errors.Is(err, ErrEmailRejected) {
+			f.metrics.RecordEmailProviderSend(name, "rejected")
+			return name, "", err
+		}
+
+		f.recordFailure(state)
+		f.metrics.RecordEmailProviderSend(name, "failed")
+		f.logger.WithError(err).WithField("provider", name).Warn("Email provider failed, trying the next one")
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return "", "", fmt.Errorf("%w: %v", ErrNoEmailProvider, errors.Join(errs...))
+}
+
+// TestConnection succeeds when any provider can be reached
+func (f *EmailFailover) TestConnection(ctx context.Context) error {
+	f.mu.Lock()
+	providers := make([]EmailProvider, len(f.providers))
+	for i, state := range f.providers {
+		providers[i] = state.provider
+	}
+	f.mu.Unlock()
+
+	if len(providers) == 0 {
+		return ErrNoEmailProvider
+	}
+
+	var errs []error
+	for _, provider := range providers {
+		err := provider.TestConnection(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+	return errors.Join(errs...)
+}
+
+// candidates returns the healthy providers in order, followed by the unhealthy ones
+// when no provider is healthy
+func (f *EmailFailover) candidates() []*emailProviderState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]*emailProviderState, 0, len(f.providers))
+	for _, state := range f.providers {
+		if !now.Before(state.unhealthyUntil) {
+			healthy = append(healthy, state)
+		}
+	}
+	if len(healthy) == 0 {
+		return append(healthy, f.providers...)
+	}
+	return healthy
+}
+
+// take takes a token from a provider's rate limit
+func (f *EmailFailover) take(state *emailProviderState) bool {
+	if state.rateLimit <= 0 {
+		return true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	state.tokens = math.Min(state.rateLimit, state.tokens+now.Sub(state.refilledAt).Seconds()*state.rateLimit)
+	state.refilledAt = now
+	if state.tokens < 1 {
+		return false
+	}
+	state.tokens--
+	return true
+}
+
+func (f *EmailFailover) recordSuccess(state *emailProviderState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !state.unhealthyUntil.IsZero() {
+		f.logger.WithField("provider", state.provider.Name()).Info("Email provider recovered")
+	}
+	state.consecutiveFailures = 0
+	state.unhealthyUntil = time.Time{}
+}
+
+func (f *EmailFailover) recordFailure(state *emailProviderState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state.consecutiveFailures++
+	if state.consecutiveFailures >= f.failureThreshold {
+		state.unhealthyUntil = time.Now().Add(f.cooldown)
+		f.logger.WithFields(logrus.Fields{
+			"provider": state.provider.Name(),
+			"failures": state.consecutiveFailures,
+			"until":    state.unhealthyUntil,
+		}).Warn("Email provider marked unhealthy")
+	}
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+)
+
+// maxEmailFeedbackSize bounds the body of a bounce and complaint webhook
+const maxEmailFeedbackSize = 1 << 20
+
+// ErrInvalidEmailFeedback is returned for bounce and complaint webhooks that fail
+// verification
+var ErrInvalidEmailFeedback = errors.New("invalid email feedback")
+
+// snsCertHost matches the hosts Amazon SNS serves its signing certificates from
+var snsCertHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// EmailFeedback is a permanent bounce or a spam complaint reported by an email provider
+type EmailFeedback struct {
+	Address string
+	Reason  models.EmailSuppressionReason
+	Detail  string
+	// UserID is the recipient's user ID, when the provider reports it
+	UserID string
+	// MessageID is the provider's ID of the email that bounced or was complained about
+	MessageID string
+}
+
+// SendGridFeedbackParser parses the signed Event Webhook of SendGrid
+type SendGridFeedbackParser struct {
+	publicKey *ecdsa.PublicKey
+}
+
+type sendGridEvent struct {
+	Email       string `json:"email"`
+	Event       string `json:"event"`
+	Type        string `json:"type"`
+	Reason      string `json:"reason"`
+	SGMessageID string `json:"sg_message_id"`
+	// UserID is the custom argument added to the emails sent through SendGrid
+	UserID string `json:"user_id"`
+}
+
+// NewSendGridFeedbackParser creates a parser for events signed with the key shown in the
+// Event Webhook settings, a base64 encoded ECDSA public key
+func NewSendGridFeedbackParser(publicKey string) (*SendGridFeedbackParser, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SendGrid webhook public key: %w", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SendGrid webhook public key: %w", err)
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("SendGrid webhook public key must be an ECDSA key")
+	}
+
+	return &SendGridFeedbackParser{publicKey: ecdsaKey}, nil
+}
+
+// ParseFeedback verifies the signature of a batch of events and returns its bounces,
+// addresses dropped for earlier bounces and spam reports
+func (p *SendGridFeedbackParser) ParseFeedback(ctx context.Context, r *http.Request) ([]EmailFeedback, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxEmailFeedbackSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmailFeedback, err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Twilio-Email-Event-Webhook-Signature"))
+	if err != nil || len(signature) == 0 {
+		return nil, fmt.Errorf("%w: missing signature", ErrInvalidEmailFeedback)
+	}
+	timestamp := r.Header.Get("X-Twilio-Email-Event-Webhook-Timestamp")
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+	if !ecdsa.VerifyASN1(p.publicKey, digest[:], signature) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidEmailFeedback)
+	}
+
+	var events []sendGridEvent
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmailFeedback, err)
+	}
+
+	var feedback []EmailFeedback
+	for _, event := range events {
+		var reason models.EmailSuppressionReason
+		switch {
+		case event.Event == "bounce" && event.Type != "blocked":
+			reason = models.EmailSuppressionBounce
+		case event.Event == "dropped" && (event.Reason == "Bounced Address" || event.Reason == "Invalid"):
+			reason = models.EmailSuppressionBounce
+		case event.Event == "spamreport", event.Event == "dropped" && event.Reason == "Spam Reporting Address":
+			reason = models.EmailSuppressionComplaint
+		default:
+			continue
+		}
+		if event.Email == "" {
+			continue
+		}
+
+		// sg_message_id is the X-Message-Id returned when sending, followed by a suffix
+		messageID, _, _ := strings.Cut(event.SGMessageID, ".")
+		feedback = append(feedback, EmailFeedback{
+			Address:   event.Email,
+			Reason:    reason,
+			Detail:    event.Reason,
+			UserID:    event.UserID,
+			MessageID: messageID,
+		})
+	}
+
+	return feedback, nil
+}
+
+// SESFeedbackParser parses the bounce and complaint notifications Amazon SES publishes to
+// an SNS topic, delivered to an HTTPS subscription
+type SESFeedbackParser struct {
+	topicARN   string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+type snsMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+}
+
+type sesNotification struct {
+	// NotificationType is set by identity notifications and EventType by configuration
+	// set event publishing
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Bounce           *struct {
+		BounceType        string `json:"bounceType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint *struct {
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+	Mail struct {
+		MessageID string `json:"messageId"`
+		Headers   []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+	} `json:"mail"`
+}
+
+// NewSESFeedbackParser creates a parser for the notifications of one SNS topic
+func NewSESFeedbackParser(topicARN string) *SESFeedbackParser {
+	return &SESFeedbackParser{
+		topicARN: topicARN,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		certs: make(map[string]*x509.Certificate),
+	}
+}
+
+// ParseFeedback verifies the SNS signature of a message and returns the permanent bounces
+// and complaints it holds. Subscription confirmations are confirmed and hold no feedback.
+func (p *SESFeedbackParser) ParseFeedback(ctx context.Context, r *http.Request) ([]EmailFeedback, error) {
+	var msg snsMessage
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxEmailFeedbackSize)).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmailFeedback, err)
+	}
+	if msg.TopicArn != p.topicARN {
+		return nil, fmt.Errorf("%w: unexpected topic %q", ErrInvalidEmailFeedback, msg.TopicArn)
+	}
+	if err := p.verify(ctx, &msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmailFeedback, err)
+	}
+
+	switch msg.Type {
+	case "SubscriptionConfirmation":
+		return nil, p.confirmSubscription(ctx, msg.SubscribeURL)
+	case "Notification":
+	default:
+		return nil, nil
+	}
+
+	var notification sesNotification
+	if err := json.Unmarshal([]byte(msg.Message), &notification); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmailFeedback, err)
+	}
+
+	var userID string
+	for _, header := range notification.Mail.Headers {
+		if strings.EqualFold(header.Name, "X-User-ID") {
+			userID = header.Value
+		}
+	}
+
+	kind := notification.NotificationType
+	if kind == "" {
+		kind = notification.EventType
+	}
+
+	var feedback []EmailFeedback
+	switch {
+	case kind == "Bounce" && notification.Bounce != nil && notification.Bounce.BounceType == "Permanent":
+		for _, recipient := range notification.Bounce.BouncedRecipients {
+			feedback = append(feedback, EmailFeedback{
+				Address:   recipient.EmailAddress,
+				Reason:    models.EmailSuppressionBounce,
+				Detail:    recipient.DiagnosticCode,
+				UserID:    userID,
+				MessageID: notification.Mail.MessageID,
+			})
+		}
+	case kind == "Complaint" && notification.Complaint != nil:
+		for _, recipient := range notification.Complaint.ComplainedRecipients {
+			feedback = append(feedback, EmailFeedback{
+				Address:   recipient.EmailAddress,
+				Reason:    models.EmailSuppressionComplaint,
+				Detail:    notification.Complaint.ComplaintFeedbackType,
+				UserID:    userID,
+				MessageID: notification.Mail.MessageID,
+			})
+		}
+	}
+
+	return feedback, nil
+}
+
+// verify checks the signature of an SNS message against the certificate it names, which
+// must be served by SNS
+func (p *SESFeedbackParser) verify(ctx context.Context, msg *snsMessage) error {
+	fields := []string{"Message", msg.Message, "MessageId", msg.MessageID}
+	switch msg.Type {
+	case "Notification":
+		if msg.Subject != "" {
+			fields = append(fields, "Subject", msg.Subject)
+		}
+		fields = append(fields, "Timestamp", msg.Timestamp, "TopicArn", msg.TopicArn, "Type", msg.Type)
+	case "SubscriptionConfirmation", "UnsubscribeConfirmation":
+		fields = append(fields, "SubscribeURL", msg.SubscribeURL, "Timestamp", msg.Timestamp,
+			"Token", msg.Token, "TopicArn", msg.TopicArn, "Type", msg.Type)
+	default:
+		return fmt.Errorf("unknown message type %q", msg.Type)
+	}
+
+	var stringToSign strings.Builder
+	for _, field := range fields {
+		stringToSign.WriteString(field + "\n")
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	switch msg.SignatureVersion {
+	case "1":
+		sum := sha1.Sum([]byte(stringToSign.String()))
+		hash, digest = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256([]byte(stringToSign.String()))
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return fmt.Errorf("unsupported signature version %q", msg.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+
+	cert, err := p.certificate(ctx, msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signing certificate is not an RSA certificate")
+	}
+
+	if err := rsa.VerifyPKCS1v15(publicKey, hash, digest, signature); err != nil {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// certificate downloads an SNS signing certificate, or returns it from the cache
+func (p *SESFeedbackParser) certificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	if !isSNSURL(certURL) || !strings.HasSuffix(certURL, ".pem") {
+		return nil, fmt.Errorf("signing certificate URL %q is not served by SNS", certURL)
+	}
+
+	p.mu.Lock()
+	cert, ok := p.certs[certURL]
+	p.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download signing certificate: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM encoded")
+	}
+	cert, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing certificate: %w", err)
+	}
+
+	p.mu.Lock()
+	p.certs[certURL] = cert
+	p.mu.Unlock()
+
+	return cert, nil
+}
+
+// confirmSubscription confirms the subscription of the webhook to the topic
+func (p *SESFeedbackParser) confirmSubscription(ctx context.Context, subscribeURL string) error {
+	if !isSNSURL(subscribeURL) {
+		return fmt.Errorf("%w: subscribe URL %q is not served by SNS", ErrInvalidEmailFeedback, subscribeURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, subscribeURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to confirm SNS subscription: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to confirm SNS subscription: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// isSNSURL reports whether a URL is an HTTPS URL of an SNS endpoint
+func isSNSURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme == "https" && snsCertHost.MatchString(u.Host)
+}
@@ -3,40 +3,60 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"net/smtp"
-	"strings"
+	"html/template"
+	"net/mail"
 	"time"
 
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/email"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/unsubscribe"
 	"github.com/sirupsen/logrus"
 )
 
+// EmailSuppressionStore reports whether a user's address is suppressed after a permanent
+// bounce or a spam complaint
+type EmailSuppressionStore interface {
+	IsEmailSuppressed(ctx context.Context, userID, address string) (bool, error)
+}
+
 // EmailHandler handles email notifications
 type EmailHandler struct {
-	host     string
-	port     int
-	username string
-	password string
+	providers *EmailFailover
 	fromEmail string
 	fromName  string
-	tls      bool
+	renderer *email.Renderer
+	unsubscribe *unsubscribe.Signer
+	suppressions EmailSuppressionStore
 	logger   *logrus.Logger
 }
 
-// NewEmailHandler creates a new email handler
-func NewEmailHandler(host string, port int, username, password, fromEmail, fromName string, tls bool, logger *logrus.Logger) *EmailHandler {
+// NewEmailHandler creates a new email handler that sends through providers
+func NewEmailHandler(providers *EmailFailover, fromEmail, fromName string, logger *logrus.Logger) *EmailHandler {
 	return &EmailHandler{
-		host:      host,
-		port:      port,
-		username:  username,
-		password:  password,
+		providers: providers,
 		fromEmail: fromEmail,
 		fromName:  fromName,
-		tls:       tls,
+		renderer:  email.NewRenderer(fromName),
 		logger:    logger,
 	}
 }
 
+// SetLogo replaces the logo shown at the top of emails with a PNG, JPEG or GIF image
+func (h *EmailHandler) SetLogo(data []byte) error {
+	return h.renderer.SetLogo(data)
+}
+
+// SetUnsubscribeLinks adds List-Unsubscribe headers for one-click unsubscribes and a
+// preference center link to the footer of emails
+func (h *EmailHandler) SetUnsubscribeLinks(signer *unsubscribe.Signer) {
+	h.unsubscribe = signer
+}
+
+// SetSuppressionStore stops emails to addresses suppressed after bounces and complaints
+func (h *EmailHandler) SetSuppressionStore(store EmailSuppressionStore) {
+	h.suppressions = store
+}
+
 // Send sends an email notification
 func (h *EmailHandler) Send(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error) {
 	start := time.Now()
@@ -62,11 +82,45 @@ func (h *EmailHandler) Send(ctx context.Context, req *models.NotificationRequest
 		}, fmt.Errorf("user email not found")
 	}
 
+	// Suppressed addresses fail without a retry; a later bounce would only hurt the
+	// sender reputation
+	if h.suppressions != nil {
+		suppressed, err := h.suppressions.IsEmailSuppressed(ctx, req.UserID, email)
+		if err != nil {
+			return &models.NotificationResponse{
+				Status:   models.StatusFailed,
+				Channel:  models.ChannelEmail,
+				Error:    err.Error(),
+				Duration: time.Since(start).Milliseconds(),
+			}, fmt.Errorf("failed to check email suppression: %w", err)
+		}
+		if suppressed {
+			h.logger.WithFields(logrus.Fields{
+				"user_id": req.UserID,
+				"channel": "email",
+			}).Info("Skipping email to suppressed address")
+			return &models.NotificationResponse{
+				Status:   models.StatusFailed,
+				Channel:  models.ChannelEmail,
+				Error:    "email address suppressed",
+				Duration: time.Since(start).Milliseconds(),
+			}, nil
+		}
+	}
+
 	// Create email message
-	message := h.createEmailMessage(req, email)
+	message, err := h.createEmailMessage(req, email)
+	if err != nil {
+		return &models.NotificationResponse{
+			Status:   models.StatusFailed,
+			Channel:  models.ChannelEmail,
+			Error:    err.Error(),
+			Duration: time.Since(start).Milliseconds(),
+		}, err
+	}
 	
 	// Send email
-	err := h.sendEmail(ctx, email, message)
+	provider, messageID, err := h.providers.Send(ctx, message)
 	
 	response := &models.NotificationResponse{
 		Channel:  models.ChannelEmail,
@@ -77,17 +131,20 @@ func (h *EmailHandler) Send(ctx context.Context, req *models.NotificationRequest
 		response.Status = models.StatusFailed
 		response.Error = err.Error()
 		h.logger.WithError(err).WithFields(logrus.Fields{
-			"user_id": req.UserID,
-			"channel": "email",
+			"user_id":  req.UserID,
+			"channel":  "email",
+			"provider": provider,
 		}).Error("Failed to send email notification")
 	} else {
 		response.Status = models.StatusSent
+		response.ProviderMessageID = messageID
 		now := time.Now()
 		response.SentAt = &now
 		h.logger.WithFields(logrus.Fields{
-			"user_id": req.UserID,
-			"channel": "email",
-			"email":   email,
+			"user_id":  req.UserID,
+			"channel":  "email",
+			"email":    email,
+			"provider": provider,
 		}).Info("Email notification sent successfully")
 	}
 
@@ -118,7 +175,7 @@ func (h *EmailHandler) GetName() string {
 
 // IsEnabled checks if the handler is enabled
 func (h *EmailHandler) IsEnabled() bool {
-	return h.host != "" && h.username != "" && h.password != ""
+	return h.providers.Len() > 0
 }
 
 // getUserEmail gets the user's email address
@@ -133,187 +190,66 @@ func (h *EmailHandler) getUserEmail(req *models.NotificationRequest) string {
 	return ""
 }
 
-// createEmailMessage creates the email message
-func (h *EmailHandler) createEmailMessage(req *models.NotificationRequest, toEmail string) []byte {
-	// Create headers
-	headers := make(map[string]string)
-	headers["From"] = fmt.Sprintf("%s <%s>", h.fromName, h.fromEmail)
-	headers["To"] = toEmail
-	headers["Subject"] = req.Title
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=UTF-8"
-	
-	// Add custom headers
-	headers["X-Notification-Type"] = string(req.EventType)
-	headers["X-Notification-Priority"] = string(req.Priority)
-	headers["X-User-ID"] = req.UserID
-
-	// Create message body
-	body := h.createEmailBody(req)
-	
-	// Combine headers and body
-	var message strings.Builder
-	for key, value := range headers {
-		message.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
+// createEmailMessage renders the email in its layout, with a plain text alternative and
+// the inline logo
+func (h *EmailHandler) createEmailMessage(req *models.NotificationRequest, toEmail string) (*EmailMessage, error) {
+	layout, _ := req.Metadata["email_layout"].(string)
+	if layout == "" && (req.Priority == models.PriorityCritical || req.EventType == models.EventTypeSecurityAlert) {
+		layout = email.AlertLayout
 	}
-	message.WriteString("\r\n")
-	message.WriteString(body)
-	
-	return []byte(message.String())
-}
-
-// createEmailBody creates the email body
-func (h *EmailHandler) createEmailBody(req *models.NotificationRequest) string {
-	// Create HTML email body
-	html := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="utf-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>%s</title>
-    <style>
-        body { 
-            font-family: Arial, sans-serif; 
-            line-height: 1.6; 
-            color: #333; 
-            max-width: 600px; 
-            margin: 0 auto; 
-            padding: 20px; 
-        }
-        .header { 
-            background-color: #f8f9fa; 
-            padding: 20px; 
-            border-radius: 8px; 
-            margin-bottom: 20px; 
-            text-align: center;
-        }
-        .content { 
-            padding: 20px 0; 
-        }
-        .button { 
-            display: inline-block; 
-            padding: 12px 24px; 
-            background-color: #007bff; 
-            color: white; 
-            text-decoration: none; 
-            border-radius: 4px; 
-            margin: 20px 0; 
-        }
-        .footer { 
-            margin-top: 30px; 
-            padding-top: 20px; 
-            border-top: 1px solid #eee; 
-            font-size: 12px; 
-            color: #666; 
-            text-align: center;
-        }
-        .priority-high { 
-            border-left: 4px solid #dc3545; 
-            padding-left: 16px; 
-        }
-        .priority-critical { 
-            border-left: 4px solid #dc3545; 
-            padding-left: 16px; 
-            background-color: #f8d7da; 
-        }
-    </style>
-</head>
-<body>
-    <div class="header">
-        <h1>%s</h1>
-    </div>
-    <div class="content %s">
-        <p>%s</p>
-        %s
-    </div>
-    <div class="footer">
-        <p>This is an automated message from File Sharing Platform.</p>
-        <p>If you no longer wish to receive these notifications, please update your preferences.</p>
-    </div>
-</body>
-</html>`,
-		req.Title,
-		req.Title,
-		h.getPriorityClass(req.Priority),
-		h.formatMessage(req.Message),
-		h.createActionButton(req),
-	)
-	
-	return html
-}
-
-// getPriorityClass returns the CSS class for priority
-func (h *EmailHandler) getPriorityClass(priority models.Priority) string {
-	switch priority {
-	case models.PriorityHigh:
-		return "priority-high"
-	case models.PriorityCritical:
-		return "priority-critical"
-	default:
-		return ""
+	// Actions are shown as buttons; the link metadata of older callers becomes one
+	actions := make([]email.Action, 0, len(req.Actions))
+	for _, action := range req.Actions {
+		actions = append(actions, email.Action{Label: action.Label, URL: action.URL, Style: string(action.Style)})
+	}
+	if link, _ := req.Metadata["link"].(string); link != "" && len(actions) == 0 {
+		actions = append(actions, email.Action{URL: link})
 	}
-}
 
-// formatMessage formats the message for HTML
-func (h *EmailHandler) formatMessage(message string) string {
-	// Convert line breaks to HTML
-	message = strings.ReplaceAll(message, "\n", "<br>")
-	return message
-}
+	headers := map[string]string{
+		"X-Notification-Type":     string(req.EventType),
+		"X-Notification-Priority": string(req.Priority),
+		"X-User-ID":               req.UserID,
+	}
 
-// createActionButton creates an action button if there's a link
-func (h *EmailHandler) createActionButton(req *models.NotificationRequest) string {
-	if link, ok := req.Metadata["link"].(string); ok && link != "" {
-		return fmt.Sprintf(`<a href="%s" class="button">View Details</a>`, link)
+	// One-click unsubscribes (RFC 8058) POST to the unsubscribe link
+	var preferencesURL string
+	if h.unsubscribe != nil && req.UserID != "" {
+		unsubscribeURL, prefsURL, err := h.unsubscribe.Links(req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		preferencesURL = prefsURL
+		headers["List-Unsubscribe"] = "<" + unsubscribeURL + ">"
+		headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
 	}
-	return ""
-}
 
-// sendEmail sends the email using SMTP
-func (h *EmailHandler) sendEmail(ctx context.Context, toEmail string, message []byte) error {
-	// Create SMTP address
-	addr := fmt.Sprintf("%s:%d", h.host, h.port)
-	
-	// Create authentication
-	auth := smtp.PlainAuth("", h.username, h.password, h.host)
-	
-	// Send email
-	if h.tls {
-		// Use TLS
-		return h.sendEmailTLS(ctx, addr, auth, h.fromEmail, []string{toEmail}, message)
-	} else {
-		// Use plain SMTP
-		return smtp.SendMail(addr, auth, h.fromEmail, []string{toEmail}, message)
+	rendered, err := h.renderer.Render(email.Content{
+		Layout:         layout,
+		Title:          req.Title,
+		Text:           req.Message,
+		HTML:           template.HTML(req.HTMLMessage),
+		Actions:        actions,
+		Urgent:         req.Priority == models.PriorityHigh || req.Priority == models.PriorityCritical,
+		PreferencesURL: preferencesURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
 	}
-}
 
-// sendEmailTLS sends email with TLS
-func (h *EmailHandler) sendEmailTLS(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, message []byte) error {
-	// This is a simplified implementation
-	// In production, you would use a proper SMTP client with TLS support
-	return smtp.SendMail(addr, auth, from, to, message)
+	return &EmailMessage{
+		From:    mail.Address{Name: h.fromName, Address: h.fromEmail},
+		To:      toEmail,
+		Content: rendered,
+		Headers: headers,
+	}, nil
 }
 
-// TestConnection tests the SMTP connection
+// TestConnection tests that an email provider can be reached
 func (h *EmailHandler) TestConnection(ctx context.Context) error {
 	if !h.IsEnabled() {
 		return fmt.Errorf("email handler is not enabled")
 	}
 
-	// Create a test message
-	testMessage := []byte("To: test@example.com\r\nSubject: Test\r\n\r\nThis is a test message.")
-	
-	// Try to send to a test address (this will fail but we can check the connection)
-	addr := fmt.Sprintf("%s:%d", h.host, h.port)
-	auth := smtp.PlainAuth("", h.username, h.password, h.host)
-	
-	err := smtp.SendMail(addr, auth, h.fromEmail, []string{"test@example.com"}, testMessage)
-	
-	// We expect this to fail, but we can check if it's a connection error
-	if err != nil && !strings.Contains(err.Error(), "test@example.com") {
-		return fmt.Errorf("SMTP connection failed: %w", err)
-	}
-	
-	return nil
+	return h.providers.TestConnection(ctx)
 }
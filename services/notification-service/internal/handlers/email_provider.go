@@ -0,0 +1,530 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/secrets"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/email"
+)
+
+// EmailProvider delivers rendered emails
+type EmailProvider interface {
+	// Name returns the provider name used in logs and metrics
+	Name() string
+	// Send sends an email and returns the provider's message ID, if it assigns one
+	Send(ctx context.Context, msg *EmailMessage) (string, error)
+	TestConnection(ctx context.Context) error
+}
+
+// EmailMessage is a rendered email to one recipient
+type EmailMessage struct {
+	From    mail.Address
+	To      string
+	Content *email.Message
+	// Headers are added to the standard headers, such as List-Unsubscribe
+	Headers map[string]string
+}
+
+// ErrEmailRejected is returned for emails a provider refuses for reasons another
+// provider would not change, such as an invalid recipient. They are not failed over.
+var ErrEmailRejected = errors.New("email rejected")
+
+// smtpTimeout bounds an SMTP session when the context has no deadline
+const smtpTimeout = 30 * time.Second
+
+// SMTPProvider sends emails through an SMTP server
+type SMTPProvider struct {
+	host       string
+	port       int
+	username   string
+	password   string
+	requireTLS bool
+	// passwordSource, when set, is the secret the password is read from, so that a
+	// rotated password is used without a restart
+	passwordSource *secrets.Secret
+}
+
+// NewSMTPProvider creates an SMTP provider. STARTTLS is used whenever the server offers
+// it; requireTLS fails sessions with servers that do not.
+func NewSMTPProvider(host string, port int, username, password string, requireTLS bool) *SMTPProvider {
+	return &SMTPProvider{
+		host:       host,
+		port:       port,
+		username:   username,
+		password:   password,
+		requireTLS: requireTLS,
+	}
+}
+
+// SetPasswordSource reads the password from a secret that may be rotated. The password
+// given to NewSMTPProvider is used while the secret can't be read.
+func (p *SMTPProvider) SetPasswordSource(secret *secrets.Secret) {
+	p.passwordSource = secret
+}
+
+// Name returns the provider name
+func (p *SMTPProvider) Name() string {
+	return "smtp"
+}
+
+// Send sends the email in one SMTP session
+func (p *SMTPProvider) Send(ctx context.Context, msg *EmailMessage) (string, error) {
+	data, err := msg.Content.Bytes(msg.From, msg.To, msg.Headers)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	client, err := p.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	err = p.transfer(client, msg.From.Address, msg.To, data)
+	if err != nil {
+		// Mailbox unavailable, not permitted or syntax errors are about the recipient
+		var smtpErr *textproto.Error
+		if errors.As(err, &smtpErr) && smtpErr.Code >= 550 && smtpErr.Code <= 553 {
+			return "", fmt.Errorf("%w: %v", ErrEmailRejected, err)
+		}
+		return "", fmt.Errorf("failed to send email: %w", err)
+	}
+
+	// The server accepted the email, an error closing the session does not change that
+	client.Quit()
+	return "", nil
+}
+
+func (p *SMTPProvider) transfer(client *smtp.Client, from, to string, data []byte) error {
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// dial opens an authenticated SMTP session
+func (p *SMTPProvider) dial(ctx context.Context) (*smtp.Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(p.host, strconv.Itoa(p.port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, p.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: p.host}); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	} else if p.requireTLS {
+		client.Close()
+		return nil, errors.New("SMTP server does not support STARTTLS")
+	}
+
+	if p.username != "" {
+		password := p.password
+		if p.passwordSource != nil {
+			if value, err := p.passwordSource.Value(ctx); err == nil && value != "" {
+				password = value
+			}
+		}
+		if err := client.Auth(smtp.PlainAuth("", p.username, password, p.host)); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// TestConnection opens and closes an authenticated SMTP session
+func (p *SMTPProvider) TestConnection(ctx context.Context) error {
+	client, err := p.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Quit()
+}
+
+// SendGridProvider sends emails through the SendGrid v3 Mail Send API
+type SendGridProvider struct {
+	apiKey     string
+	apiURL     string
+	httpClient *http.Client
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Type        string `json:"type"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition"`
+	ContentID   string `json:"content_id"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+	// CustomArgs are reported back in the Event Webhook
+	CustomArgs map[string]string `json:"custom_args,omitempty"`
+}
+
+type sendGridMail struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+}
+
+// SendGridErrorResponse represents a SendGrid API error
+type SendGridErrorResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+		Field   string `json:"field,omitempty"`
+	} `json:"errors"`
+}
+
+// NewSendGridProvider creates a SendGrid email provider
+func NewSendGridProvider(apiKey string) *SendGridProvider {
+	return &SendGridProvider{
+		apiKey: apiKey,
+		apiURL: "https://api.sendgrid.com/v3",
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name returns the provider name
+func (p *SendGridProvider) Name() string {
+	return "sendgrid"
+}
+
+// Send sends the email using the SendGrid API, with the inline assets as attachments
+func (p *SendGridProvider) Send(ctx context.Context, msg *EmailMessage) (string, error) {
+	body := sendGridMail{
+		Personalizations: []sendGridPersonalization{
+			{To: []sendGridAddress{{Email: msg.To}}},
+		},
+		From:    sendGridAddress{Email: msg.From.Address, Name: msg.From.Name},
+		Subject: msg.Content.Subject,
+		Content: []sendGridContent{
+			{Type: "text/plain", Value: msg.Content.Text},
+			{Type: "text/html", Value: msg.Content.HTML},
+		},
+		Headers: msg.Headers,
+	}
+	if userID := msg.Headers["X-User-ID"]; userID != "" {
+		body.Personalizations[0].CustomArgs = map[string]string{"user_id": userID}
+	}
+	for _, asset := range msg.Content.Assets {
+		body.Attachments = append(body.Attachments, sendGridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(asset.Data),
+			Type:        asset.ContentType,
+			Filename:    asset.Filename,
+			Disposition: "inline",
+			ContentID:   asset.ContentID,
+		})
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal email: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.apiURL+"/mail/send", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send email: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusOK {
+		return resp.Header.Get("X-Message-Id"), nil
+	}
+
+	var errResp SendGridErrorResponse
+	reason := fmt.Sprintf("status %d", resp.StatusCode)
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && len(errResp.Errors) > 0 {
+		reason = fmt.Sprintf("%s (status %d)", errResp.Errors[0].Message, resp.StatusCode)
+	}
+
+	// Bad requests are about the email; authentication, rate limit and server errors
+	// are about the account or SendGrid
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge {
+		return "", fmt.Errorf("%w: %s", ErrEmailRejected, reason)
+	}
+	return "", fmt.Errorf("SendGrid request failed: %s", reason)
+}
+
+// TestConnection checks the API key
+func (p *SendGridProvider) TestConnection(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+"/scopes", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to test connection: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("connection test failed with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// SESProvider sends emails through the Amazon SES v2 API, as raw MIME messages
+type SESProvider struct {
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	apiURL          string
+	httpClient      *http.Client
+}
+
+// SESErrorResponse represents an SES API error
+type SESErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// NewSESProvider creates an Amazon SES email provider for an AWS region
+func NewSESProvider(region, accessKeyID, secretAccessKey string) *SESProvider {
+	return &SESProvider{
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		apiURL:          fmt.Sprintf("https://email.%s.amazonaws.com", region),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name returns the provider name
+func (p *SESProvider) Name() string {
+	return "ses"
+}
+
+// Send sends the email using the SES SendEmail API
+func (p *SESProvider) Send(ctx context.Context, msg *EmailMessage) (string, error) {
+	data, err := msg.Content.Bytes(msg.From, msg.To, msg.Headers)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	body := map[string]interface{}{
+		"FromEmailAddress": msg.From.Address,
+		"Destination": map[string][]string{
+			"ToAddresses": {msg.To},
+		},
+		"Content": map[string]interface{}{
+			"Raw": map[string][]byte{"Data": data},
+		},
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal email: %w", err)
+	}
+
+	resp, err := p.do(ctx, http.MethodPost, "/v2/email/outbound-emails", payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to send email: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		var result struct {
+			MessageID string `json:"MessageId"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return "", fmt.Errorf("failed to parse response: %w", err)
+		}
+		return result.MessageID, nil
+	}
+
+	var errResp SESErrorResponse
+	_ = json.NewDecoder(resp.Body).Decode(&errResp)
+	errorType := resp.Header.Get("X-Amzn-ErrorType")
+	if i := strings.Index(errorType, ":"); i >= 0 {
+		errorType = errorType[:i]
+	}
+	reason := fmt.Sprintf("%s: %s (status %d)", errorType, errResp.Message, resp.StatusCode)
+
+	// Sending paused, throttling and authentication errors are about the account or
+	// SES; rejected and malformed messages are about the email
+	if errorType == "MessageRejected" || errorType == "BadRequestException" {
+		return "", fmt.Errorf("%w: %s", ErrEmailRejected, reason)
+	}
+	return "", fmt.Errorf("SES request failed: %s", reason)
+}
+
+// TestConnection checks the credentials and that sending is enabled for the account
+func (p *SESProvider) TestConnection(ctx context.Context) error {
+	resp, err := p.do(ctx, http.MethodGet, "/v2/email/account", nil)
+	if err != nil {
+		return fmt.Errorf("failed to test connection: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("connection test failed with status %d", resp.StatusCode)
+	}
+
+	var account struct {
+		SendingEnabled bool `json:"SendingEnabled"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if !account.SendingEnabled {
+		return errors.New("sending is disabled for the SES account")
+	}
+
+	return nil
+}
+
+// do sends a request signed with AWS Signature Version 4
+func (p *SESProvider) do(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.apiURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	p.sign(req, payload, time.Now().UTC())
+
+	return p.httpClient.Do(req)
+}
+
+// sign adds the AWS Signature Version 4 authorization of the ses service to a request
+func (p *SESProvider) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	names := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+		names = append([]string{"content-type"}, names...)
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + p.region + "/ses/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+p.secretAccessKey), date)
+	key = hmacSHA256(key, p.region)
+	key = hmacSHA256(key, "ses")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, data)
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -3,65 +3,167 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/rsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/sirupsen/logrus"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 )
 
-// PushHandler handles push notifications
+const (
+	fcmScope           = "https://www.googleapis.com/auth/firebase.messaging"
+	fcmSendURL         = "https://fcm.googleapis.com/v1/projects/%s/messages:send"
+	fcmDefaultTokenURI = "https://oauth2.googleapis.com/token"
+	fcmAssertionTTL    = time.Hour
+)
+
+// errFCMUnregistered is returned when FCM no longer accepts a registration token, for
+// example after the app was uninstalled
+var errFCMUnregistered = errors.New("FCM registration token is not registered")
+
+// PushDeviceStore looks up and removes the push devices registered by users
+type PushDeviceStore interface {
+	GetPushDevices(ctx context.Context, userID string) ([]models.PushDevice, error)
+	RemovePushToken(ctx context.Context, token string) error
+}
+
+// PushHandler sends push notifications through the Firebase Cloud Messaging HTTP v1 API,
+// authorized with a Google service account
 type PushHandler struct {
-	fcmServerKey string
-	fcmProjectID string
-	apiURL       string
-	httpClient   *http.Client
-	logger       *logrus.Logger
+	projectID   string
+	credentials *fcmCredentials
+	devices     PushDeviceStore
+	sendURL     string
+	httpClient  *http.Client
+	logger      *logrus.Logger
+
+	mu          sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+// fcmCredentials is the part of a service account key used to request access tokens
+type fcmCredentials struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+
+	key *rsa.PrivateKey
 }
 
-// FCMRequest represents FCM notification request
-type FCMRequest struct {
-	To           string                 `json:"to"`
-	Notification FCMNotification        `json:"notification"`
-	Data         map[string]interface{} `json:"data,omitempty"`
-	Priority     string                 `json:"priority,omitempty"`
+// FCMMessage represents an FCM v1 message to a single device
+type FCMMessage struct {
+	Token        string            `json:"token"`
+	Notification *FCMNotification  `json:"notification,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      *FCMAndroidConfig `json:"android,omitempty"`
+	APNS         *FCMAPNSConfig    `json:"apns,omitempty"`
+	Webpush      *FCMWebpushConfig `json:"webpush,omitempty"`
 }
 
-// FCMNotification represents FCM notification payload
+// FCMNotification represents the notification shown on every platform
 type FCMNotification struct {
 	Title string `json:"title"`
 	Body  string `json:"body"`
-	Icon  string `json:"icon,omitempty"`
-	Sound string `json:"sound,omitempty"`
-	Badge string `json:"badge,omitempty"`
 }
 
-// FCMResponse represents FCM response
-type FCMResponse struct {
-	Success int `json:"success"`
-	Failure int `json:"failure"`
-	Results []struct {
-		MessageID string `json:"message_id,omitempty"`
-		Error     string `json:"error,omitempty"`
-	} `json:"results"`
+// FCMAndroidConfig represents Android specific message options
+type FCMAndroidConfig struct {
+	Priority     string                  `json:"priority,omitempty"`
+	Notification *FCMAndroidNotification `json:"notification,omitempty"`
 }
 
-// NewPushHandler creates a new push notification handler
-func NewPushHandler(fcmServerKey, fcmProjectID string, logger *logrus.Logger) *PushHandler {
+// FCMAndroidNotification represents Android specific notification options
+type FCMAndroidNotification struct {
+	Sound       string `json:"sound,omitempty"`
+	ClickAction string `json:"click_action,omitempty"`
+}
+
+// FCMAPNSConfig represents Apple Push Notification service options
+type FCMAPNSConfig struct {
+	Headers map[string]string      `json:"headers,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// FCMWebpushConfig represents Web Push options
+type FCMWebpushConfig struct {
+	Headers    map[string]string  `json:"headers,omitempty"`
+	FCMOptions *FCMWebpushOptions `json:"fcm_options,omitempty"`
+}
+
+// FCMWebpushOptions represents FCM options for Web Push
+type FCMWebpushOptions struct {
+	Link string `json:"link,omitempty"`
+}
+
+// FCMErrorResponse represents an FCM v1 error
+type FCMErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// NewPushHandler creates a push notification handler from a service account key file.
+// projectID defaults to the project of the service account.
+func NewPushHandler(credentialsFile, projectID string, devices PushDeviceStore, logger *logrus.Logger) (*PushHandler, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FCM credentials: %w", err)
+	}
+
+	var credentials fcmCredentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("failed to parse FCM credentials: %w", err)
+	}
+	if credentials.ClientEmail == "" || credentials.PrivateKey == "" {
+		return nil, fmt.Errorf("FCM credentials must be a service account key")
+	}
+	credentials.key, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(credentials.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FCM private key: %w", err)
+	}
+	if credentials.TokenURI == "" {
+		credentials.TokenURI = fcmDefaultTokenURI
+	}
+
+	if projectID == "" {
+		projectID = credentials.ProjectID
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("FCM project ID is required")
+	}
+
 	return &PushHandler{
-		fcmServerKey: fcmServerKey,
-		fcmProjectID: fcmProjectID,
-		apiURL:       "https://fcm.googleapis.com/fcm/send",
+		projectID:   projectID,
+		credentials: &credentials,
+		devices:     devices,
+		sendURL:     fmt.Sprintf(fcmSendURL, projectID),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 		logger: logger,
-	}
+	}, nil
 }
 
-// Send sends a push notification
+// Send sends a push notification to every device the user registered. It succeeds when
+// at least one device accepted the notification. Tokens FCM reports as unregistered are
+// removed.
 func (h *PushHandler) Send(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error) {
 	start := time.Now()
 
@@ -75,46 +177,69 @@ func (h *PushHandler) Send(ctx context.Context, req *models.NotificationRequest)
 		}, err
 	}
 
-	// Get user push token from metadata
-	pushToken := h.getUserPushToken(req)
-	if pushToken == "" {
+	devices, err := h.getUserDevices(ctx, req)
+	if err != nil {
 		return &models.NotificationResponse{
 			Status:   models.StatusFailed,
 			Channel:  models.ChannelPush,
-			Error:    "user push token not found",
+			Error:    "failed to get push devices",
 			Duration: time.Since(start).Milliseconds(),
-		}, fmt.Errorf("user push token not found")
+		}, fmt.Errorf("failed to get push devices: %w", err)
+	}
+	if len(devices) == 0 {
+		return &models.NotificationResponse{
+			Status:   models.StatusFailed,
+			Channel:  models.ChannelPush,
+			Error:    "user has no registered push devices",
+			Duration: time.Since(start).Milliseconds(),
+		}, fmt.Errorf("user has no registered push devices")
 	}
 
-	// Create FCM request
-	fcmReq := h.createFCMRequest(req, pushToken)
+	var sent int
+	var lastErr error
+	for _, device := range devices {
+		err := h.sendFCM(ctx, h.createFCMMessage(req, device))
+		if err == nil {
+			sent++
+			continue
+		}
 
-	// Send push notification
-	err := h.sendFCM(ctx, fcmReq)
+		lastErr = err
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"user_id":  req.UserID,
+			"platform": device.Platform,
+		}).Warn("Failed to send push notification to device")
+
+		if errors.Is(err, errFCMUnregistered) {
+			h.removeDevice(ctx, req.UserID, device.Token)
+		}
+	}
 
 	response := &models.NotificationResponse{
 		Channel:  models.ChannelPush,
 		Duration: time.Since(start).Milliseconds(),
 	}
 
-	if err != nil {
+	if sent == 0 {
 		response.Status = models.StatusFailed
-		response.Error = err.Error()
-		h.logger.WithError(err).WithFields(logrus.Fields{
+		response.Error = lastErr.Error()
+		h.logger.WithError(lastErr).WithFields(logrus.Fields{
 			"user_id": req.UserID,
 			"channel": "push",
 		}).Error("Failed to send push notification")
-	} else {
-		response.Status = models.StatusSent
-		now := time.Now()
-		response.SentAt = &now
-		h.logger.WithFields(logrus.Fields{
-			"user_id": req.UserID,
-			"channel": "push",
-		}).Info("Push notification sent successfully")
+		return response, lastErr
 	}
 
-	return response, err
+	response.Status = models.StatusSent
+	now := time.Now()
+	response.SentAt = &now
+	h.logger.WithFields(logrus.Fields{
+		"user_id": req.UserID,
+		"channel": "push",
+		"devices": sent,
+	}).Info("Push notification sent successfully")
+
+	return response, nil
 }
 
 // Validate validates the notification request
@@ -141,68 +266,148 @@ func (h *PushHandler) GetName() string {
 
 // IsEnabled checks if the handler is enabled
 func (h *PushHandler) IsEnabled() bool {
-	return h.fcmServerKey != "" && h.fcmProjectID != ""
+	return h.credentials != nil && h.projectID != ""
 }
 
-// getUserPushToken gets the user's push token
-func (h *PushHandler) getUserPushToken(req *models.NotificationRequest) string {
-	// Try to get push token from metadata
+// getUserDevices gets the user's registered devices and a token passed in the metadata
+func (h *PushHandler) getUserDevices(ctx context.Context, req *models.NotificationRequest) ([]models.PushDevice, error) {
+	var devices []models.PushDevice
+	if h.devices != nil {
+		stored, err := h.devices.GetPushDevices(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, stored...)
+	}
+
 	if token, ok := req.Metadata["push_token"].(string); ok && token != "" {
-		return token
+		for _, device := range devices {
+			if device.Token == token {
+				return devices, nil
+			}
+		}
+		devices = append(devices, models.PushDevice{Token: token})
 	}
 
-	// Try to get push token from user preferences (would need to be passed in)
-	// For now, return empty string
-	return ""
+	return devices, nil
 }
 
-// createFCMRequest creates the FCM request
-func (h *PushHandler) createFCMRequest(req *models.NotificationRequest, pushToken string) *FCMRequest {
-	fcmReq := &FCMRequest{
-		To: pushToken,
-		Notification: FCMNotification{
+// removeDevice removes a token FCM no longer accepts
+func (h *PushHandler) removeDevice(ctx context.Context, userID, token string) {
+	if h.devices == nil {
+		return
+	}
+
+	if err := h.devices.RemovePushToken(ctx, token); err != nil {
+		h.logger.WithError(err).WithField("user_id", userID).Error("Failed to remove unregistered push device")
+		return
+	}
+	h.logger.WithField("user_id", userID).Info("Removed unregistered push device")
+}
+
+// createFCMMessage creates the FCM message for one device, with the options of the
+// device's platform. Devices of unknown platform get the options of every platform.
+func (h *PushHandler) createFCMMessage(req *models.NotificationRequest, device models.PushDevice) *FCMMessage {
+	msg := &FCMMessage{
+		Token: device.Token,
+		Notification: &FCMNotification{
 			Title: req.Title,
 			Body:  req.Message,
-			Sound: "default",
 		},
-		Data: map[string]interface{}{
+		Data: map[string]string{
 			"event_type": string(req.EventType),
 			"user_id":    req.UserID,
 			"priority":   string(req.Priority),
 		},
-		Priority: "high",
 	}
 
-	// Add metadata to data payload
+	// FCM data values must be strings
 	for key, value := range req.Metadata {
-		fcmReq.Data[key] = value
+		if isReservedFCMDataKey(key) {
+			continue
+		}
+		if s, ok := value.(string); ok {
+			msg.Data[key] = s
+		} else if encoded, err := json.Marshal(value); err == nil {
+			msg.Data[key] = string(encoded)
+		}
+	}
+
+	link, _ := req.Metadata["link"].(string)
+	urgent := req.Priority == models.PriorityHigh || req.Priority == models.PriorityCritical
+
+	if device.Platform == models.PushPlatformAndroid || device.Platform == "" {
+		msg.Android = &FCMAndroidConfig{
+			Priority: "normal",
+			Notification: &FCMAndroidNotification{
+				Sound:       "default",
+				ClickAction: link,
+			},
+		}
+		if urgent {
+			msg.Android.Priority = "high"
+		}
 	}
 
-	// Add link if provided
-	if link, ok := req.Metadata["link"].(string); ok && link != "" {
-		fcmReq.Data["link"] = link
+	if device.Platform == models.PushPlatformIOS || device.Platform == "" {
+		msg.APNS = &FCMAPNSConfig{
+			Headers: map[string]string{"apns-priority": "5"},
+			Payload: map[string]interface{}{
+				"aps": map[string]interface{}{"sound": "default"},
+			},
+		}
+		if urgent {
+			msg.APNS.Headers["apns-priority"] = "10"
+		}
+	}
+
+	if device.Platform == models.PushPlatformWeb || device.Platform == "" {
+		msg.Webpush = &FCMWebpushConfig{
+			Headers: map[string]string{"Urgency": "normal"},
+		}
+		if urgent {
+			msg.Webpush.Headers["Urgency"] = "high"
+		}
+		// FCM only accepts HTTPS links for web notifications
+		if strings.HasPrefix(link, "https://") {
+			msg.Webpush.FCMOptions = &FCMWebpushOptions{Link: link}
+		}
 	}
 
-	return fcmReq
+	return msg
 }
 
-// sendFCM sends the push notification via FCM
-func (h *PushHandler) sendFCM(ctx context.Context, fcmReq *FCMRequest) error {
+// isReservedFCMDataKey reports whether FCM rejects key in the data payload
+func isReservedFCMDataKey(key string) bool {
+	switch key {
+	case "from", "notification", "message_type":
+		return true
+	}
+	return strings.HasPrefix(key, "google") || strings.HasPrefix(key, "gcm")
+}
+
+// sendFCM sends a message via FCM
+func (h *PushHandler) sendFCM(ctx context.Context, msg *FCMMessage) error {
+	accessToken, err := h.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Marshal request to JSON
-	jsonData, err := json.Marshal(fcmReq)
+	jsonData, err := json.Marshal(map[string]interface{}{"message": msg})
 	if err != nil {
 		return fmt.Errorf("failed to marshal FCM request: %w", err)
 	}
 
 	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "POST", h.apiURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.sendURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "key="+h.fcmServerKey)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
 
 	// Send request
 	resp, err := h.httpClient.Do(req)
@@ -211,55 +416,102 @@ func (h *PushHandler) sendFCM(ctx context.Context, fcmReq *FCMRequest) error {
 	}
 	defer resp.Body.Close()
 
-	// Parse response
-	var fcmResp FCMResponse
-	if err := json.NewDecoder(resp.Body).Decode(&fcmResp); err != nil {
-		return fmt.Errorf("failed to parse FCM response: %w", err)
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// Request a new access token next time if this one was rejected
+	if resp.StatusCode == http.StatusUnauthorized {
+		h.mu.Lock()
+		h.accessToken = ""
+		h.mu.Unlock()
+	}
+
+	var fcmErr FCMErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&fcmErr); err != nil {
+		return fmt.Errorf("FCM request failed with status %d", resp.StatusCode)
 	}
 
-	// Check if any notifications were sent successfully
-	if fcmResp.Success == 0 {
-		if len(fcmResp.Results) > 0 {
-			return fmt.Errorf("FCM error: %s", fcmResp.Results[0].Error)
+	for _, detail := range fcmErr.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return fmt.Errorf("%w: %s", errFCMUnregistered, fcmErr.Error.Message)
 		}
-		return fmt.Errorf("FCM request failed")
 	}
 
-	return nil
+	return fmt.Errorf("FCM error %s: %s", fcmErr.Error.Status, fcmErr.Error.Message)
 }
 
-// TestConnection tests the FCM connection
-func (h *PushHandler) TestConnection(ctx context.Context) error {
-	if !h.IsEnabled() {
-		return fmt.Errorf("push handler is not enabled")
+// getAccessToken returns an OAuth2 access token for FCM, requesting a new one with a
+// signed service account assertion when the cached token is about to expire
+func (h *PushHandler) getAccessToken(ctx context.Context) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.accessToken != "" && time.Now().Before(h.tokenExpiry) {
+		return h.accessToken, nil
 	}
 
-	// Test by sending a test notification to a test token
-	testToken := "test_token"
-	fcmReq := &FCMRequest{
-		To: testToken,
-		Notification: FCMNotification{
-			Title: "Test",
-			Body:  "This is a test notification",
-		},
-		Data: map[string]interface{}{
-			"test": true,
-		},
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   h.credentials.ClientEmail,
+		"scope": fcmScope,
+		"aud":   h.credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(fcmAssertionTTL).Unix(),
+	}).SignedString(h.credentials.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM token request: %w", err)
 	}
 
-	err := h.sendFCM(ctx, fcmReq)
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
 
-	// We expect this to fail with invalid token, but we can check if it's a connection error
-	if err != nil && !contains(err.Error(), "InvalidRegistration") {
-		return fmt.Errorf("FCM connection test failed: %w", err)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.credentials.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	return nil
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request FCM access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("FCM access token request failed with status %d", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("failed to parse FCM access token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("FCM access token response has no token")
+	}
+
+	// Refresh a minute early so requests never carry an expired token
+	h.accessToken = tokenResp.AccessToken
+	h.tokenExpiry = now.Add(time.Duration(tokenResp.ExpiresIn)*time.Second - time.Minute)
+
+	return h.accessToken, nil
 }
 
-// contains checks if a string contains a substring
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && s[:len(substr)] == substr
+// TestConnection tests the FCM connection by requesting an access token
+func (h *PushHandler) TestConnection(ctx context.Context) error {
+	if !h.IsEnabled() {
+		return fmt.Errorf("push handler is not enabled")
+	}
+
+	if _, err := h.getAccessToken(ctx); err != nil {
+		return fmt.Errorf("FCM connection test failed: %w", err)
+	}
+
+	return nil
 }
 
 // MockPushHandler is a mock implementation for testing
@@ -2,48 +2,48 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 )
 
-// SMSHandler handles SMS notifications
-type SMSHandler struct {
-	accountSID  string
-	authToken   string
-	phoneNumber string
-	apiURL      string
-	httpClient  *http.Client
-	logger      *logrus.Logger
+// PhoneNumberStore looks up the verified phone numbers of users
+type PhoneNumberStore interface {
+	GetVerifiedPhoneNumber(ctx context.Context, userID string) (string, error)
 }
 
-// TwilioResponse represents Twilio API response
-type TwilioResponse struct {
-	SID          string `json:"sid"`
-	Status       string `json:"status"`
-	ErrorCode    string `json:"error_code,omitempty"`
-	ErrorMessage string `json:"error_message,omitempty"`
+// SMSHandler handles SMS notifications through an SMS provider. Notifications are only
+// sent to verified phone numbers.
+type SMSHandler struct {
+	provider          SMSProvider
+	routes            *SMSRoutes
+	phones            PhoneNumberStore
+	statusCallbackURL string
+	metrics           *metrics.Metrics
+	logger            *logrus.Logger
 }
 
-// NewSMSHandler creates a new SMS handler
-func NewSMSHandler(accountSID, authToken, phoneNumber string, logger *logrus.Logger) *SMSHandler {
+// NewSMSHandler creates a new SMS handler. statusCallbackURL is the public URL of the
+// delivery status webhook, or empty to not request status callbacks.
+func NewSMSHandler(provider SMSProvider, routes *SMSRoutes, phones PhoneNumberStore, statusCallbackURL string, logger *logrus.Logger) *SMSHandler {
 	return &SMSHandler{
-		accountSID:  accountSID,
-		authToken:   authToken,
-		phoneNumber: phoneNumber,
-		apiURL:      "https://api.twilio.com/2010-04-01",
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		logger: logger,
+		provider:          provider,
+		routes:            routes,
+		phones:            phones,
+		statusCallbackURL: statusCallbackURL,
+		logger:            logger,
 	}
 }
 
+// SetMetrics enables recording SMS volume and cost metrics
+func (h *SMSHandler) SetMetrics(m *metrics.Metrics) {
+	h.metrics = m
+}
+
 // Send sends an SMS notification
 func (h *SMSHandler) Send(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error) {
 	start := time.Now()
@@ -58,22 +58,30 @@ func (h *SMSHandler) Send(ctx context.Context, req *models.NotificationRequest)
 		}, err
 	}
 
-	// Get user phone number from metadata
-	phoneNumber := h.getUserPhoneNumber(req)
+	// Get the user's verified phone number
+	phoneNumber, err := h.phones.GetVerifiedPhoneNumber(ctx, req.UserID)
+	if err != nil {
+		return &models.NotificationResponse{
+			Status:   models.StatusFailed,
+			Channel:  models.ChannelSMS,
+			Error:    "failed to get phone number",
+			Duration: time.Since(start).Milliseconds(),
+		}, fmt.Errorf("failed to get phone number: %w", err)
+	}
 	if phoneNumber == "" {
 		return &models.NotificationResponse{
 			Status:   models.StatusFailed,
 			Channel:  models.ChannelSMS,
-			Error:    "user phone number not found",
+			Error:    "user has no verified phone number",
 			Duration: time.Since(start).Milliseconds(),
-		}, fmt.Errorf("user phone number not found")
+		}, fmt.Errorf("user has no verified phone number")
 	}
 
 	// Create SMS message
 	message := h.createSMSMessage(req)
 
 	// Send SMS
-	err := h.sendSMS(ctx, phoneNumber, message)
+	result, err := h.sendSMS(ctx, phoneNumber, message)
 
 	response := &models.NotificationResponse{
 		Channel:  models.ChannelSMS,
@@ -84,23 +92,37 @@ func (h *SMSHandler) Send(ctx context.Context, req *models.NotificationRequest)
 		response.Status = models.StatusFailed
 		response.Error = err.Error()
 		h.logger.WithError(err).WithFields(logrus.Fields{
-			"user_id": req.UserID,
-			"channel": "sms",
+			"user_id":  req.UserID,
+			"channel":  "sms",
+			"provider": h.provider.Name(),
 		}).Error("Failed to send SMS notification")
 	} else {
 		response.Status = models.StatusSent
+		response.ProviderMessageID = result.MessageID
 		now := time.Now()
 		response.SentAt = &now
 		h.logger.WithFields(logrus.Fields{
-			"user_id":      req.UserID,
-			"channel":      "sms",
-			"phone_number": phoneNumber,
+			"user_id":    req.UserID,
+			"channel":    "sms",
+			"provider":   h.provider.Name(),
+			"message_id": result.MessageID,
 		}).Info("SMS notification sent successfully")
 	}
 
 	return response, err
 }
 
+// SendText sends a text message to a phone number, verified or not
+func (h *SMSHandler) SendText(ctx context.Context, phoneNumber, message string) error {
+	_, err := h.sendSMS(ctx, phoneNumber, message)
+	return err
+}
+
+// ParseStatusCallback verifies and parses a delivery status callback from the provider
+func (h *SMSHandler) ParseStatusCallback(r *http.Request) (*SMSStatusUpdate, error) {
+	return h.provider.ParseStatusCallback(r, h.statusCallbackURL)
+}
+
 // Validate validates the notification request
 func (h *SMSHandler) Validate(req *models.NotificationRequest) error {
 	if req.UserID == "" {
@@ -125,19 +147,7 @@ func (h *SMSHandler) GetName() string {
 
 // IsEnabled checks if the handler is enabled
 func (h *SMSHandler) IsEnabled() bool {
-	return h.accountSID != "" && h.authToken != "" && h.phoneNumber != ""
-}
-
-// getUserPhoneNumber gets the user's phone number
-func (h *SMSHandler) getUserPhoneNumber(req *models.NotificationRequest) string {
-	// Try to get phone number from metadata
-	if phone, ok := req.Metadata["phone_number"].(string); ok && phone != "" {
-		return phone
-	}
-
-	// Try to get phone number from user preferences (would need to be passed in)
-	// For now, return empty string
-	return ""
+	return h.provider != nil && h.routes != nil && h.phones != nil
 }
 
 // createSMSMessage creates the SMS message
@@ -170,90 +180,35 @@ func (h *SMSHandler) shortenLink(link string) string {
 	return link
 }
 
-// sendSMS sends the SMS using Twilio API
-func (h *SMSHandler) sendSMS(ctx context.Context, toPhoneNumber, message string) error {
-	// Create request URL
-	url := fmt.Sprintf("%s/Accounts/%s/Messages.json", h.apiURL, h.accountSID)
-
-	// Create form data
-	data := map[string]string{
-		"From": h.phoneNumber,
-		"To":   toPhoneNumber,
-		"Body": message,
-	}
-
-	// Convert to form data
-	formData := make([]string, 0, len(data))
-	for key, value := range data {
-		formData = append(formData, fmt.Sprintf("%s=%s", key, value))
-	}
-
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(strings.Join(formData, "&")))
+// sendSMS sends the message from the sender configured for the destination's country
+// and records the message count, segments and estimated cost
+func (h *SMSHandler) sendSMS(ctx context.Context, toPhoneNumber, message string) (*SMSResult, error) {
+	result, err := h.provider.Send(ctx, &SMSMessage{
+		From:              h.routes.Sender(toPhoneNumber),
+		To:                toPhoneNumber,
+		Body:              message,
+		StatusCallbackURL: h.statusCallbackURL,
+	})
+
+	country := h.routes.Country(toPhoneNumber)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		h.metrics.RecordSMSSent(h.provider.Name(), country, "failed", 0, 0)
+		return nil, err
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.SetBasicAuth(h.accountSID, h.authToken)
+	cost := float64(result.Segments) * h.routes.SegmentPrice(toPhoneNumber)
+	h.metrics.RecordSMSSent(h.provider.Name(), country, "sent", result.Segments, cost)
 
-	// Send request
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send SMS: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusCreated {
-		var twilioResp TwilioResponse
-		if err := json.NewDecoder(resp.Body).Decode(&twilioResp); err != nil {
-			return fmt.Errorf("SMS failed with status %d", resp.StatusCode)
-		}
-		return fmt.Errorf("SMS failed: %s (code: %s)", twilioResp.ErrorMessage, twilioResp.ErrorCode)
-	}
-
-	// Parse response
-	var twilioResp TwilioResponse
-	if err := json.NewDecoder(resp.Body).Decode(&twilioResp); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	if twilioResp.Status != "queued" && twilioResp.Status != "sent" {
-		return fmt.Errorf("SMS not queued: %s", twilioResp.Status)
-	}
-
-	return nil
+	return result, nil
 }
 
-// TestConnection tests the Twilio connection
+// TestConnection tests the SMS provider connection
 func (h *SMSHandler) TestConnection(ctx context.Context) error {
 	if !h.IsEnabled() {
 		return fmt.Errorf("SMS handler is not enabled")
 	}
 
-	// Test by trying to get account info
-	url := fmt.Sprintf("%s/Accounts/%s.json", h.apiURL, h.accountSID)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.SetBasicAuth(h.accountSID, h.authToken)
-
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to test connection: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("connection test failed with status %d", resp.StatusCode)
-	}
-
-	return nil
+	return h.provider.TestConnection(ctx)
 }
 
 // MockSMSHandler is a mock implementation for testing
@@ -309,6 +264,19 @@ func (h *MockSMSHandler) Send(ctx context.Context, req *models.NotificationReque
 	}, nil
 }
 
+// SendText logs a mock text message
+func (h *MockSMSHandler) SendText(ctx context.Context, phoneNumber, message string) error {
+	if !h.enabled {
+		return fmt.Errorf("SMS handler is disabled")
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"phone_number": phoneNumber,
+		"message":      message,
+	}).Info("Mock SMS text sent")
+	return nil
+}
+
 // Validate validates the notification request
 func (h *MockSMSHandler) Validate(req *models.NotificationRequest) error {
 	if req.UserID == "" {
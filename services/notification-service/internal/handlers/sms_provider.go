@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+)
+
+// SMSProvider sends text messages through an SMS gateway
+type SMSProvider interface {
+	// Name returns the provider name used in logs and metrics
+	Name() string
+	Send(ctx context.Context, msg *SMSMessage) (*SMSResult, error)
+	// ParseStatusCallback verifies and parses a delivery status callback. callbackURL is
+	// the public URL the provider posted to.
+	ParseStatusCallback(r *http.Request, callbackURL string) (*SMSStatusUpdate, error)
+	TestConnection(ctx context.Context) error
+}
+
+// SMSMessage is a text message to one phone number
+type SMSMessage struct {
+	From              string
+	To                string
+	Body              string
+	StatusCallbackURL string
+}
+
+// SMSResult describes a message accepted by the provider
+type SMSResult struct {
+	MessageID string
+	Segments  int
+}
+
+// SMSStatusUpdate is a delivery status reported by the provider
+type SMSStatusUpdate struct {
+	MessageID   string
+	Status      models.NotificationStatus
+	ErrorReason string
+}
+
+// ErrInvalidSMSCallback is returned for status callbacks that fail verification
+var ErrInvalidSMSCallback = errors.New("invalid SMS status callback")
+
+// SMSRoutes picks the sender and the price per segment of a destination by the longest
+// calling code prefix that matches it, such as "+1" or "+44"
+type SMSRoutes struct {
+	defaultSender string
+	senders       map[string]string
+	prices        map[string]float64
+}
+
+// NewSMSRoutes creates SMS routes. senders and prices are keyed by calling code prefix,
+// prices are per message segment.
+func NewSMSRoutes(defaultSender string, senders map[string]string, prices map[string]string) (*SMSRoutes, error) {
+	routes := &SMSRoutes{
+		defaultSender: defaultSender,
+		senders:       make(map[string]string),
+		prices:        make(map[string]float64),
+	}
+
+	for prefix, sender := range senders {
+		if !strings.HasPrefix(prefix, "+") || sender == "" {
+			return nil, fmt.Errorf("invalid SMS sender %q=%q", prefix, sender)
+		}
+		routes.senders[prefix] = sender
+	}
+	for prefix, value := range prices {
+		price, err := strconv.ParseFloat(value, 64)
+		if !strings.HasPrefix(prefix, "+") || err != nil || price < 0 {
+			return nil, fmt.Errorf("invalid SMS segment price %q=%q", prefix, value)
+		}
+		routes.prices[prefix] = price
+	}
+
+	return routes, nil
+}
+
+// Sender returns the sender for a phone number
+func (r *SMSRoutes) Sender(phoneNumber string) string {
+	if prefix := longestPrefix(phoneNumber, r.senders); prefix != "" {
+		return r.senders[prefix]
+	}
+	return r.defaultSender
+}
+
+// Country returns the calling code prefix used to label metrics for a phone number, or
+// "other" when no sender or price is configured for it
+func (r *SMSRoutes) Country(phoneNumber string) string {
+	prefix := longestPrefix(phoneNumber, r.senders)
+	if pricePrefix := longestPrefix(phoneNumber, r.prices); len(pricePrefix) > len(prefix) {
+		prefix = pricePrefix
+	}
+	if prefix == "" {
+		return "other"
+	}
+	return prefix
+}
+
+// SegmentPrice returns the configured price of one segment to a phone number
+func (r *SMSRoutes) SegmentPrice(phoneNumber string) float64 {
+	return r.prices[longestPrefix(phoneNumber, r.prices)]
+}
+
+func longestPrefix[V any](phoneNumber string, entries map[string]V) string {
+	var longest string
+	for prefix := range entries {
+		if strings.HasPrefix(phoneNumber, prefix) && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	return longest
+}
+
+// TwilioProvider sends messages through the Twilio Programmable Messaging API
+type TwilioProvider struct {
+	accountSID string
+	authToken  string
+	apiURL     string
+	httpClient *http.Client
+}
+
+// TwilioResponse represents Twilio API response
+type TwilioResponse struct {
+	SID          string `json:"sid"`
+	Status       string `json:"status"`
+	NumSegments  string `json:"num_segments,omitempty"`
+	ErrorCode    int    `json:"code,omitempty"`
+	ErrorMessage string `json:"message,omitempty"`
+}
+
+// NewTwilioProvider creates a Twilio SMS provider
+func NewTwilioProvider(accountSID, authToken string) *TwilioProvider {
+	return &TwilioProvider{
+		accountSID: accountSID,
+		authToken:  authToken,
+		apiURL:     "https://api.twilio.com/2010-04-01",
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name returns the provider name
+func (p *TwilioProvider) Name() string {
+	return "twilio"
+}
+
+// Send sends the message using the Twilio API
+func (p *TwilioProvider) Send(ctx context.Context, msg *SMSMessage) (*SMSResult, error) {
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", p.apiURL, p.accountSID)
+
+	form := url.Values{}
+	form.Set("From", msg.From)
+	form.Set("To", msg.To)
+	form.Set("Body", msg.Body)
+	if msg.StatusCallbackURL != "" {
+		form.Set("StatusCallback", msg.StatusCallbackURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(p.accountSID, p.authToken)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send SMS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var twilioResp TwilioResponse
+	if err := json.NewDecoder(resp.Body).Decode(&twilioResp); err != nil {
+		if resp.StatusCode != http.StatusCreated {
+			return nil, fmt.Errorf("SMS failed with status %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("SMS failed: %s (code: %d)", twilioResp.ErrorMessage, twilioResp.ErrorCode)
+	}
+
+	if twilioResp.Status == "failed" || twilioResp.Status == "undelivered" {
+		return nil, fmt.Errorf("SMS not queued: %s", twilioResp.Status)
+	}
+
+	segments, err := strconv.Atoi(twilioResp.NumSegments)
+	if err != nil || segments < 1 {
+		segments = 1
+	}
+
+	return &SMSResult{
+		MessageID: twilioResp.SID,
+		Segments:  segments,
+	}, nil
+}
+
+// ParseStatusCallback verifies the X-Twilio-Signature of a status callback and maps the
+// Twilio message status to a notification status
+func (p *TwilioProvider) ParseStatusCallback(r *http.Request, callbackURL string) (*SMSStatusUpdate, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSMSCallback, err)
+	}
+
+	if !p.validSignature(callbackURL, r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidSMSCallback)
+	}
+
+	update := &SMSStatusUpdate{MessageID: r.PostForm.Get("MessageSid")}
+	if update.MessageID == "" {
+		return nil, fmt.Errorf("%w: MessageSid is required", ErrInvalidSMSCallback)
+	}
+
+	switch status := r.PostForm.Get("MessageStatus"); status {
+	case "accepted", "scheduled", "queued", "sending", "sent":
+		update.Status = models.StatusSent
+	case "delivered", "read":
+		update.Status = models.StatusDelivered
+	case "undelivered", "failed", "canceled":
+		update.Status = models.StatusFailed
+		update.ErrorReason = "SMS " + status
+		if code := r.PostForm.Get("ErrorCode"); code != "" {
+			update.ErrorReason += " (code: " + code + ")"
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidSMSCallback, status)
+	}
+
+	return update, nil
+}
+
+// validSignature checks a Twilio request signature, the base64 HMAC-SHA1 of the URL
+// followed by the sorted POST parameters, keyed with the auth token
+func (p *TwilioProvider) validSignature(callbackURL string, params url.Values, signature string) bool {
+	if signature == "" {
+		return false
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var data strings.Builder
+	data.WriteString(callbackURL)
+	for _, key := range keys {
+		for _, value := range params[key] {
+			data.WriteString(key)
+			data.WriteString(value)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(p.authToken))
+	mac.Write([]byte(data.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// TestConnection tests the Twilio connection by fetching the account
+func (p *TwilioProvider) TestConnection(ctx context.Context) error {
+	endpoint := fmt.Sprintf("%s/Accounts/%s.json", p.apiURL, p.accountSID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(p.accountSID, p.authToken)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to test connection: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("connection test failed with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
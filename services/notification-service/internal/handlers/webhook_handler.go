@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+)
+
+// WebhookStore loads webhook endpoints and records delivery attempts
+type WebhookStore interface {
+	GetEndpointsByUserID(ctx context.Context, userID string) ([]models.WebhookEndpoint, error)
+	RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+// WebhookConfig contains webhook delivery settings
+type WebhookConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Timeout     time.Duration
+	// AllowPrivateNetworks permits endpoints on loopback and private addresses, for
+	// development
+	AllowPrivateNetworks bool
+}
+
+// WebhookPayload is the JSON body posted to webhook endpoints
+type WebhookPayload struct {
+	Type      models.EventType   `json:"type"`
+	Timestamp time.Time          `json:"timestamp"`
+	Data      WebhookPayloadData `json:"data"`
+}
+
+// WebhookPayloadData is the notification in a webhook payload
+type WebhookPayloadData struct {
+	UserID   string                 `json:"user_id"`
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority models.Priority        `json:"priority"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+var errWebhookAddressNotAllowed = errors.New("webhook address is not allowed")
+
+// WebhookHandler posts notifications to the webhook endpoints users registered. Payloads
+// are signed as described by the Standard Webhooks specification: the webhook-signature
+// header holds "v1," and the base64 HMAC-SHA256 of "{webhook-id}.{webhook-timestamp}.{body}"
+// keyed with the endpoint's secret.
+type WebhookHandler struct {
+	store      WebhookStore
+	config     *WebhookConfig
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewWebhookHandler creates a new webhook notification handler
+func NewWebhookHandler(store WebhookStore, config *WebhookConfig, logger *logrus.Logger) *WebhookHandler {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivateNetworks {
+		dialer.Control = publicAddressOnly
+	}
+
+	return &WebhookHandler{
+		store:  store,
+		config: config,
+		httpClient: &http.Client{
+			Timeout: config.Timeout,
+			Transport: &http.Transport{
+				// Connect directly so the address check applies to the endpoint itself
+				Proxy:               nil,
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: config.Timeout,
+				MaxIdleConnsPerHost: 2,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: logger,
+	}
+}
+
+// Send posts the notification to every endpoint the user registered, retrying failed
+// attempts with exponential backoff. It fails when any endpoint still fails after the
+// last attempt, so the notification goes to the DLQ.
+func (h *WebhookHandler) Send(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error) {
+	start := time.Now()
+
+	fail := func(reason string, err error) (*models.NotificationResponse, error) {
+		return &models.NotificationResponse{
+			Status:   models.StatusFailed,
+			Channel:  models.ChannelWebhook,
+			Error:    reason,
+			Duration: time.Since(start).Milliseconds(),
+		}, err
+	}
+
+	// Validate request
+	if err := h.Validate(req); err != nil {
+		return fail(err.Error(), err)
+	}
+
+	endpoints, err := h.store.GetEndpointsByUserID(ctx, req.UserID)
+	if err != nil {
+		return fail("failed to get webhook endpoints", fmt.Errorf("failed to get webhook endpoints: %w", err))
+	}
+	if len(endpoints) == 0 {
+		err := fmt.Errorf("user has no webhook endpoints")
+		return fail(err.Error(), err)
+	}
+
+	body, err := json.Marshal(&WebhookPayload{
+		Type:      req.EventType,
+		Timestamp: time.Now().UTC(),
+		Data: WebhookPayloadData{
+			UserID:   req.UserID,
+			Title:    req.Title,
+			Message:  req.Message,
+			Priority: req.Priority,
+			Metadata: req.Metadata,
+		},
+	})
+	if err != nil {
+		return fail("failed to marshal payload", fmt.Errorf("failed to marshal webhook payload: %w", err))
+	}
+
+	var failed []string
+	var lastErr error
+	for _, endpoint := range endpoints {
+		if err := h.deliver(ctx, &endpoint, req.EventType, body); err != nil {
+			failed = append(failed, endpoint.ID.Hex())
+			lastErr = err
+		}
+	}
+
+	if len(failed) > 0 {
+		err := fmt.Errorf("webhook delivery failed for %d of %d endpoints (%s): %w",
+			len(failed), len(endpoints), strings.Join(failed, ", "), lastErr)
+		h.logger.WithError(err).WithField("user_id", req.UserID).Error("Failed to send webhook notification")
+		return fail(err.Error(), err)
+	}
+
+	now := time.Now()
+	h.logger.WithFields(logrus.Fields{
+		"user_id":   req.UserID,
+		"endpoints": len(endpoints),
+	}).Info("Webhook notification sent successfully")
+
+	return &models.NotificationResponse{
+		Status:   models.StatusSent,
+		Channel:  models.ChannelWebhook,
+		SentAt:   &now,
+		Duration: time.Since(start).Milliseconds(),
+	}, nil
+}
+
+// deliver posts a payload to one endpoint until it is accepted, the endpoint rejects it
+// or the attempts run out. Every attempt is recorded.
+func (h *WebhookHandler) deliver(ctx context.Context, endpoint *models.WebhookEndpoint, eventType models.EventType, body []byte) error {
+	messageID, err := newWebhookMessageID()
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= h.config.MaxAttempts; attempt++ {
+		start := time.Now()
+		statusCode, retryAfter, err := h.post(ctx, endpoint, messageID, body)
+
+		delivery := &models.WebhookDelivery{
+			EndpointID:  endpoint.ID,
+			UserID:      endpoint.UserID,
+			MessageID:   messageID,
+			EventType:   eventType,
+			Attempt:     attempt,
+			Success:     err == nil,
+			StatusCode:  statusCode,
+			Duration:    time.Since(start).Milliseconds(),
+			AttemptedAt: start,
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if recordErr := h.store.RecordDelivery(ctx, delivery); recordErr != nil {
+			h.logger.WithError(recordErr).WithField("endpoint_id", endpoint.ID.Hex()).Warn("Failed to record webhook delivery")
+		}
+
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		if errors.Is(err, errWebhookAddressNotAllowed) || !retryableWebhookStatus(statusCode) || attempt == h.config.MaxAttempts {
+			break
+		}
+
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"endpoint_id": endpoint.ID.Hex(),
+			"attempt":     attempt,
+		}).Warn("Webhook delivery attempt failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(h.retryDelay(attempt, retryAfter)):
+		}
+	}
+
+	return lastErr
+}
+
+// post sends one signed request and returns the response status, 0 when there was no
+// response, and the delay the endpoint asked for before retrying
+func (h *WebhookHandler) post(ctx context.Context, endpoint *models.WebhookEndpoint, messageID string, body []byte) (int, time.Duration, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature, err := signWebhook(endpoint.Secret, messageID, timestamp, body)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FileShare-Webhooks/1.0")
+	req.Header.Set("webhook-id", messageID)
+	req.Header.Set("webhook-timestamp", timestamp)
+	req.Header.Set("webhook-signature", signature)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return resp.StatusCode, retryAfter, fmt.Errorf("webhook failed with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, 0, nil
+}
+
+// retryDelay returns the exponential backoff before the next attempt, with up to 20%
+// jitter, or the delay the endpoint asked for when it is longer. Delays are capped at
+// MaxDelay.
+func (h *WebhookHandler) retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	delay := h.config.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > h.config.MaxDelay {
+		delay = h.config.MaxDelay
+	}
+	delay += time.Duration(mathrand.Int63n(int64(delay)/5 + 1))
+
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if delay > h.config.MaxDelay {
+		delay = h.config.MaxDelay
+	}
+	return delay
+}
+
+// Validate validates the notification request
+func (h *WebhookHandler) Validate(req *models.NotificationRequest) error {
+	if req.UserID == "" {
+		return fmt.Errorf("user ID is required")
+	}
+
+	if req.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+
+	if req.Message == "" {
+		return fmt.Errorf("message is required")
+	}
+
+	return nil
+}
+
+// GetName returns the handler name
+func (h *WebhookHandler) GetName() string {
+	return "webhook"
+}
+
+// IsEnabled checks if the handler is enabled
+func (h *WebhookHandler) IsEnabled() bool {
+	return h.store != nil && h.config.MaxAttempts > 0
+}
+
+// TestConnection has nothing to check, as endpoints are registered per user
+func (h *WebhookHandler) TestConnection(ctx context.Context) error {
+	return nil
+}
+
+// retryableWebhookStatus reports whether a failed attempt may succeed later. Network
+// errors, timeouts, rate limits and server errors are retried, other client errors are
+// final.
+func retryableWebhookStatus(statusCode int) bool {
+	return statusCode == 0 ||
+		statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode >= 500
+}
+
+// signWebhook returns the webhook-signature header of a payload
+func signWebhook(secret, messageID, timestamp string, body []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, models.WebhookSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook secret: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(messageID + "." + timestamp + "."))
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func newWebhookMessageID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook message ID: %w", err)
+	}
+	return "msg_" + hex.EncodeToString(b), nil
+}
+
+// publicAddressOnly refuses connections to loopback, private, link-local and other
+// non-public addresses, so webhooks cannot reach internal services
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%w: %s", errWebhookAddressNotAllowed, host)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
@@ -16,11 +17,19 @@ import (
 type WebSocketHandler struct {
 	upgrader    websocket.Upgrader
 	connections map[string]*websocket.Conn
+	hub         WebSocketHub
 	mu          sync.RWMutex
 	enabled     bool
 	logger      *logrus.Logger
 }
 
+// WebSocketHub delivers messages to the WebSocket connections of a user
+type WebSocketHub interface {
+	// SendToUser sends a message to every connection of a user. It returns zero when the
+	// user has no connections.
+	SendToUser(userID string, message []byte) int
+}
+
 // WebSocketMessage represents a WebSocket message
 type WebSocketMessage struct {
 	Type      string                 `json:"type"`
@@ -31,14 +40,15 @@ type WebSocketMessage struct {
 
 // WebSocketNotification represents a notification sent via WebSocket
 type WebSocketNotification struct {
-	ID        string                 `json:"id"`
-	UserID    string                 `json:"user_id"`
-	EventType string                 `json:"event_type"`
-	Title     string                 `json:"title"`
-	Message   string                 `json:"message"`
-	Priority  string                 `json:"priority"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
-	Timestamp time.Time              `json:"timestamp"`
+	ID        string                      `json:"id"`
+	UserID    string                      `json:"user_id"`
+	EventType string                      `json:"event_type"`
+	Title     string                      `json:"title"`
+	Message   string                      `json:"message"`
+	Priority  string                      `json:"priority"`
+	Metadata  map[string]interface{}      `json:"metadata,omitempty"`
+	Actions   []models.NotificationAction `json:"actions,omitempty"`
+	Timestamp time.Time                   `json:"timestamp"`
 }
 
 // NewWebSocketHandler creates a new WebSocket notification handler
@@ -58,6 +68,12 @@ func NewWebSocketHandler(enabled bool, logger *logrus.Logger) *WebSocketHandler
 	}
 }
 
+// SetHub delivers notifications through hub, to all of a user's connections, instead of
+// the connections added to the handler
+func (h *WebSocketHandler) SetHub(hub WebSocketHub) {
+	h.hub = hub
+}
+
 // Send sends a WebSocket notification
 func (h *WebSocketHandler) Send(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error) {
 	start := time.Now()
@@ -72,20 +88,6 @@ func (h *WebSocketHandler) Send(ctx context.Context, req *models.NotificationReq
 		}, err
 	}
 
-	// Check if user has an active WebSocket connection
-	h.mu.RLock()
-	conn, exists := h.connections[req.UserID]
-	h.mu.RUnlock()
-
-	if !exists {
-		return &models.NotificationResponse{
-			Status:   models.StatusFailed,
-			Channel:  models.ChannelWebSocket,
-			Error:    "user not connected via WebSocket",
-			Duration: time.Since(start).Milliseconds(),
-		}, fmt.Errorf("user %s not connected via WebSocket", req.UserID)
-	}
-
 	// Create WebSocket notification
 	wsNotification := WebSocketNotification{
 		ID:        fmt.Sprintf("notif_%d", time.Now().UnixNano()),
@@ -95,6 +97,7 @@ func (h *WebSocketHandler) Send(ctx context.Context, req *models.NotificationReq
 		Message:   req.Message,
 		Priority:  string(req.Priority),
 		Metadata:  make(map[string]interface{}),
+		Actions:   req.Actions,
 		Timestamp: time.Now(),
 	}
 
@@ -113,6 +116,19 @@ func (h *WebSocketHandler) Send(ctx context.Context, req *models.NotificationReq
 		},
 	}
 
+	if h.hub != nil {
+		return h.sendThroughHub(req, message, start)
+	}
+
+	// Check if user has an active WebSocket connection
+	h.mu.RLock()
+	conn, exists := h.connections[req.UserID]
+	h.mu.RUnlock()
+
+	if !exists {
+		return h.notConnected(req, start)
+	}
+
 	// Send message
 	if err := h.sendMessage(conn, message); err != nil {
 		// Remove disconnected connection
@@ -139,6 +155,46 @@ func (h *WebSocketHandler) Send(ctx context.Context, req *models.NotificationReq
 	}, nil
 }
 
+// sendThroughHub sends a message to every connection of the recipient through the hub
+func (h *WebSocketHandler) sendThroughHub(req *models.NotificationRequest, message WebSocketMessage, start time.Time) (*models.NotificationResponse, error) {
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return &models.NotificationResponse{
+			Status:   models.StatusFailed,
+			Channel:  models.ChannelWebSocket,
+			Error:    err.Error(),
+			Duration: time.Since(start).Milliseconds(),
+		}, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	connections := h.hub.SendToUser(req.UserID, messageBytes)
+	if connections == 0 {
+		return h.notConnected(req, start)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":     req.UserID,
+		"event_type":  req.EventType,
+		"connections": connections,
+	}).Info("WebSocket notification sent successfully")
+
+	return &models.NotificationResponse{
+		Status:   models.StatusSent,
+		Channel:  models.ChannelWebSocket,
+		Duration: time.Since(start).Milliseconds(),
+	}, nil
+}
+
+// notConnected is the response for a recipient without a WebSocket connection
+func (h *WebSocketHandler) notConnected(req *models.NotificationRequest, start time.Time) (*models.NotificationResponse, error) {
+	return &models.NotificationResponse{
+		Status:   models.StatusFailed,
+		Channel:  models.ChannelWebSocket,
+		Error:    "user not connected via WebSocket",
+		Duration: time.Since(start).Milliseconds(),
+	}, fmt.Errorf("user %s not connected via WebSocket", req.UserID)
+}
+
 // sendMessage sends a message through WebSocket connection
 func (h *WebSocketHandler) sendMessage(conn *websocket.Conn, message WebSocketMessage) error {
 	// Set write deadline
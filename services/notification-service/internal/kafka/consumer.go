@@ -3,17 +3,26 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/kafkametrics"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/services"
 )
 
+// FileEvent is an event of the billing-service's or share-tracker's topics, or a file
+// event converted from the shared file event schema
 type FileEvent struct {
+	EventID     string                 `json:"event_id"`
 	Type        string                 `json:"type"`
 	UserID      string                 `json:"user_id"`
 	FileID      string                 `json:"file_id"`
@@ -23,60 +32,149 @@ type FileEvent struct {
 	ErrorReason string                 `json:"error_reason,omitempty"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
 	Timestamp   time.Time              `json:"timestamp"`
+	// TenantID is the tenant of the user notified, empty for the default tenant
+	TenantID string `json:"tenant_id,omitempty"`
 }
 
 type Consumer struct {
-	reader       *kafka.Reader
-	notifRepo    *repository.NotificationRepository
-	streamBroker *StreamBroker
-	notifSvc     *services.NotificationService
+	reader *kafka.Reader
+	// replayReader consumes the events replayed to the consumer group
+	replayReader    *kafka.Reader
+	fileEventsTopic string
+	notifRepo       *repository.NotificationRepository
+	streamBroker    *StreamBroker
+	notifSvc        *services.NotificationService
+	dedup           *EventDeduplicator
+	metrics         *metrics.Metrics
 }
 
-func NewConsumer(brokers []string, groupID, topic string, notifRepo *repository.NotificationRepository, streamBroker *StreamBroker, notifSvc *services.NotificationService) *Consumer {
+// NewConsumer creates a consumer of the events topics, such as the file-service's file
+// events, the billing-service's quota alerts and the share-tracker's security alerts
+func NewConsumer(brokers []string, groupID string, topics []string, notifRepo *repository.NotificationRepository, streamBroker *StreamBroker, notifSvc *services.NotificationService) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:        brokers,
 		GroupID:        groupID,
-		Topic:          topic,
+		GroupTopics:    topics,
 		MinBytes:       10e3, // 10KB
 		MaxBytes:       10e6, // 10MB
 		CommitInterval: time.Second,
 		StartOffset:    kafka.LastOffset,
 	})
+	replayReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:               brokers,
+		GroupID:               events.ReplayTopic(groupID),
+		Topic:                 events.ReplayTopic(groupID),
+		MinBytes:              1,
+		MaxBytes:              10e6, // 10MB
+		CommitInterval:        time.Second,
+		StartOffset:           kafka.FirstOffset,
+		WatchPartitionChanges: true,
+	})
 
 	return &Consumer{
 		reader:       reader,
+		replayReader: replayReader,
 		notifRepo:    notifRepo,
 		streamBroker: streamBroker,
 		notifSvc:     notifSvc,
 	}
 }
 
+// SetMetrics enables recording consumer error metrics
+func (c *Consumer) SetMetrics(m *metrics.Metrics) {
+	c.metrics = m
+}
+
+// SetFileEventsTopic names the file-service's topic, whose events are decoded with the
+// shared file event schema
+func (c *Consumer) SetFileEventsTopic(topic string) {
+	c.fileEventsTopic = topic
+}
+
+// SetDeduplicator enables skipping events that were already processed
+func (c *Consumer) SetDeduplicator(dedup *EventDeduplicator) {
+	c.dedup = dedup
+}
+
+// Start consumes the topics, and the events replayed to the consumer group, until ctx
+// is done. A message is committed once processed, and one being processed when ctx is
+// done is finished and committed before the reader closes, so that the group resumes
+// after it instead of losing or repeating it.
 func (c *Consumer) Start(ctx context.Context) error {
 	log.Println("Starting Kafka consumer...")
 
+	replayDone := make(chan error, 1)
+	go func() {
+		replayDone <- c.consume(ctx, c.replayReader)
+	}()
+	err := c.consume(ctx, c.reader)
+	if replayErr := <-replayDone; err == nil {
+		err = replayErr
+	}
+	log.Println("Stopping Kafka consumer...")
+	return err
+}
+
+// consume processes the messages of a reader until ctx is done, and closes it. The
+// reader's stats are exposed in the metrics meanwhile.
+func (c *Consumer) consume(ctx context.Context, reader *kafka.Reader) error {
+	go kafkametrics.WatchReader(ctx, "notification-service", reader)
 	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Stopping Kafka consumer...")
-			return c.reader.Close()
-		default:
-			msg, err := c.reader.ReadMessage(ctx)
-			if err != nil {
-				log.Printf("Error reading message: %v", err)
-				continue
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return reader.Close()
 			}
+			log.Printf("Error reading message: %v", err)
+			c.metrics.RecordProcessingError("kafka_consumer", "read")
+			continue
+		}
 
-			if err := c.processMessage(ctx, msg); err != nil {
-				log.Printf("Error processing message: %v", err)
-			}
+		processCtx := context.WithoutCancel(ctx)
+		if err := c.processMessage(processCtx, msg); err != nil {
+			log.Printf("Error processing message: %v", err)
+		}
+		if err := reader.CommitMessages(processCtx, msg); err != nil {
+			log.Printf("Error committing message: %v", err)
+			c.metrics.RecordProcessingError("kafka_consumer", "commit")
 		}
 	}
 }
 
 func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) error {
-	var event FileEvent
-	if err := json.Unmarshal(msg.Value, &event); err != nil {
-		return fmt.Errorf("failed to unmarshal event: %w", err)
+	msg, replayID := replayedMessage(msg)
+	event, err := c.decode(msg)
+	if err != nil {
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			c.metrics.RecordProcessingError("kafka_consumer", "unsupported_version")
+		} else {
+			c.metrics.RecordProcessingError("kafka_consumer", "unmarshal")
+		}
+		return err
+	}
+	if event == nil {
+		return nil
+	}
+
+	// Events published before event IDs were added are identified by their position
+	eventID := event.EventID
+	if eventID == "" {
+		eventID = fmt.Sprintf("%s:%d:%d", msg.Topic, msg.Partition, msg.Offset)
+	}
+	if replayID != "" {
+		eventID = events.ReplayEventID(replayID, eventID)
+	}
+
+	if c.dedup != nil {
+		claimed, err := c.dedup.Claim(ctx, eventID)
+		if err != nil {
+			// Without the dedupe store, a duplicate is better than a lost notification
+			log.Printf("Failed to check event %s for duplicates: %v", eventID, err)
+			c.metrics.RecordProcessingError("kafka_consumer", "dedup")
+		} else if !claimed {
+			log.Printf("Skipping duplicate event %s: %s for file %s", eventID, event.Type, event.FileID)
+			return nil
+		}
 	}
 
 	log.Printf("Processing event: %s for file %s (user: %s)", event.Type, event.FileID, event.UserID)
@@ -94,16 +192,76 @@ func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) error
 		Timestamp:   event.Timestamp,
 	}
 
-	// Process through notification service
-	if err := c.notifSvc.ProcessKafkaEvent(ctx, kafkaEvent); err != nil {
+	// Process through notification service, for the tenant of the event
+	if err := c.notifSvc.ProcessKafkaEvent(tenant.WithID(ctx, event.TenantID), kafkaEvent); err != nil {
 		log.Printf("Failed to process Kafka event: %v", err)
+		c.metrics.RecordProcessingError("kafka_consumer", "process")
+		if c.dedup != nil {
+			if err := c.dedup.Release(ctx, eventID); err != nil {
+				log.Printf("Failed to release event %s: %v", eventID, err)
+			}
+		}
 		return err
 	}
 
+	if c.dedup != nil {
+		if err := c.dedup.Complete(ctx, eventID); err != nil {
+			log.Printf("Failed to mark event %s as processed: %v", eventID, err)
+		}
+	}
+
 	log.Printf("Successfully processed event: %s for user %s", event.Type, event.UserID)
 	return nil
 }
 
+// decode decodes a message. File events are decoded with the shared file event schema,
+// and those of types users aren't notified of are returned as nil.
+func (c *Consumer) decode(msg kafka.Message) (*FileEvent, error) {
+	if msg.Topic != c.fileEventsTopic {
+		var event FileEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+		return &event, nil
+	}
+
+	fileEvent, err := events.Decode(msg.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file event: %w", err)
+	}
+
+	event := &FileEvent{
+		EventID:     fileEvent.EventID,
+		Type:        fileEvent.Type,
+		UserID:      fileEvent.UserID,
+		FileID:      fileEvent.FileID,
+		FileName:    fileEvent.FileName,
+		FileSize:    fileEvent.FileSize,
+		Success:     fileEvent.Success,
+		ErrorReason: fileEvent.ErrorReason,
+		Timestamp:   fileEvent.Timestamp,
+		TenantID:    fileEvent.TenantID,
+	}
+	switch fileEvent.Type {
+	case events.TypeFileUploaded, events.TypeFileDeleted:
+	case events.TypeFileShared:
+		// The recipient is notified, if they have an account
+		if fileEvent.SharedWithID == "" {
+			return nil, nil
+		}
+		event.UserID = fileEvent.SharedWithID
+	default:
+		return nil, nil
+	}
+	if len(fileEvent.Metadata) > 0 {
+		event.Metadata = make(map[string]interface{}, len(fileEvent.Metadata))
+		for key, value := range fileEvent.Metadata {
+			event.Metadata[key] = value
+		}
+	}
+	return event, nil
+}
+
 // createNotificationFromEvent is deprecated - use ProcessKafkaEvent instead
 func (c *Consumer) createNotificationFromEvent(event FileEvent) (*models.Notification, error) {
 	// This method is kept for backward compatibility but should not be used
@@ -112,5 +270,33 @@ func (c *Consumer) createNotificationFromEvent(event FileEvent) (*models.Notific
 }
 
 func (c *Consumer) Close() error {
-	return c.reader.Close()
+	replayErr := c.replayReader.Close()
+	if err := c.reader.Close(); err != nil {
+		return err
+	}
+	return replayErr
+}
+
+// replayedMessage returns a message of the replay topic as it was first published, and
+// the ID of the replay that published it. Other messages are returned unchanged, with no
+// replay ID.
+func replayedMessage(msg kafka.Message) (kafka.Message, string) {
+	var replayID string
+	for _, header := range msg.Headers {
+		switch header.Key {
+		case events.ReplayIDHeader:
+			replayID = string(header.Value)
+		case events.ReplayTopicHeader:
+			msg.Topic = string(header.Value)
+		case events.ReplayPartitionHeader:
+			if partition, err := strconv.Atoi(string(header.Value)); err == nil {
+				msg.Partition = partition
+			}
+		case events.ReplayOffsetHeader:
+			if offset, err := strconv.ParseInt(string(header.Value), 10, 64); err == nil {
+				msg.Offset = offset
+			}
+		}
+	}
+	return msg, replayID
 }
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	eventStateProcessing = "processing"
+	eventStateProcessed  = "processed"
+	// processingClaimTTL bounds how long an event claimed by a consumer that died while
+	// processing it stays blocked
+	processingClaimTTL = 5 * time.Minute
+)
+
+// EventDeduplicator records the events that were processed in Redis so redelivered
+// events are skipped
+type EventDeduplicator struct {
+	redisClient redis.UniversalClient
+	ttl         time.Duration
+	keyPrefix   string
+}
+
+// NewEventDeduplicator creates a deduplicator that remembers processed events for ttl
+func NewEventDeduplicator(redisClient redis.UniversalClient, ttl time.Duration) *EventDeduplicator {
+	return &EventDeduplicator{
+		redisClient: redisClient,
+		ttl:         ttl,
+		keyPrefix:   "notification_event:",
+	}
+}
+
+// Claim marks an event as being processed. It returns false if the event was already
+// processed or is being processed by another consumer.
+func (d *EventDeduplicator) Claim(ctx context.Context, eventID string) (bool, error) {
+	return d.redisClient.SetNX(ctx, d.keyPrefix+eventID, eventStateProcessing, processingClaimTTL).Result()
+}
+
+// Complete marks a claimed event as processed
+func (d *EventDeduplicator) Complete(ctx context.Context, eventID string) error {
+	return d.redisClient.Set(ctx, d.keyPrefix+eventID, eventStateProcessed, d.ttl).Err()
+}
+
+// Release gives up the claim on an event that failed to process so a redelivery is
+// processed again
+func (d *EventDeduplicator) Release(ctx context.Context, eventID string) error {
+	return d.redisClient.Del(ctx, d.keyPrefix+eventID).Err()
+}
@@ -1,15 +1,28 @@
 package kafka
 
 import (
+	"context"
+	"encoding/json"
 	"sync"
+	"time"
 
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 )
 
+const (
+	// streamChannel is the Redis channel notifications are relayed between replicas on
+	streamChannel        = "notification_stream:notifications"
+	streamPublishTimeout = 5 * time.Second
+)
+
 // StreamBroker manages gRPC streaming connections and broadcasts notifications
 type StreamBroker struct {
 	mu          sync.RWMutex
 	subscribers map[string][]chan *models.Notification
+	redisClient redis.UniversalClient
+	logger      *logrus.Logger
 }
 
 func NewStreamBroker() *StreamBroker {
@@ -18,6 +31,14 @@ func NewStreamBroker() *StreamBroker {
 	}
 }
 
+// SetRedis relays published notifications between notification-service replicas through
+// Redis pub/sub, so subscribers on any replica receive them. Run must be started for
+// notifications to be delivered.
+func (sb *StreamBroker) SetRedis(redisClient redis.UniversalClient, logger *logrus.Logger) {
+	sb.redisClient = redisClient
+	sb.logger = logger
+}
+
 // Subscribe creates a new channel for user to receive notifications
 func (sb *StreamBroker) Subscribe(userID string) chan *models.Notification {
 	sb.mu.Lock()
@@ -49,6 +70,55 @@ func (sb *StreamBroker) Unsubscribe(userID string, ch chan *models.Notification)
 	}
 }
 
+// PublishNotification sends a notification to the subscribers of its recipient on every
+// replica. When Redis is unavailable it only reaches this replica's subscribers.
+func (sb *StreamBroker) PublishNotification(ctx context.Context, notification *models.Notification) {
+	if sb.redisClient == nil {
+		sb.Broadcast(notification)
+		return
+	}
+
+	payload, err := json.Marshal(notification)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, streamPublishTimeout)
+		defer cancel()
+		err = sb.redisClient.Publish(ctx, streamChannel, payload).Err()
+	}
+	if err != nil {
+		sb.logger.WithError(err).WithField("user_id", notification.UserID).Warn("Failed to publish notification to stream, delivering locally")
+		sb.Broadcast(notification)
+	}
+}
+
+// Run delivers notifications published by any replica to the subscribers of this one
+// until ctx is done
+func (sb *StreamBroker) Run(ctx context.Context) {
+	if sb.redisClient == nil {
+		return
+	}
+
+	pubsub := sb.redisClient.Subscribe(ctx, streamChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var notification models.Notification
+			if err := json.Unmarshal([]byte(msg.Payload), &notification); err != nil {
+				sb.logger.WithError(err).Warn("Discarding malformed stream notification")
+				continue
+			}
+			sb.Broadcast(&notification)
+		}
+	}
+}
+
 // Broadcast sends notification to all subscribers of a user
 func (sb *StreamBroker) Broadcast(notification *models.Notification) {
 	sb.mu.RLock()
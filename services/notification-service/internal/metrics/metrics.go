@@ -9,7 +9,8 @@ import (
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 )
 
-// Metrics holds all Prometheus metrics
+// Metrics holds all Prometheus metrics. The Record methods do nothing on a nil *Metrics,
+// so services can be used without metrics.
 type Metrics struct {
 	// Notification metrics
 	NotificationsSentTotal              *prometheus.CounterVec
@@ -17,12 +18,21 @@ type Metrics struct {
 	NotificationsRetryTotal             *prometheus.CounterVec
 	NotificationsDLQTotal               *prometheus.CounterVec
 	NotificationsBatchedTotal           prometheus.Counter
+	NotificationsThrottledTotal         *prometheus.CounterVec
 	NotificationPreferencesUpdatedTotal prometheus.Counter
 
 	// Channel metrics
 	ChannelConnectionsTotal *prometheus.GaugeVec
 	ChannelErrorsTotal      *prometheus.CounterVec
 
+	// SMS metrics
+	SMSMessagesTotal *prometheus.CounterVec
+	SMSSegmentsTotal *prometheus.CounterVec
+	SMSCostTotal     *prometheus.CounterVec
+
+	// Email metrics
+	EmailProviderSendsTotal *prometheus.CounterVec
+
 	// Batch metrics
 	BatchSizeHistogram      prometheus.Histogram
 	BatchProcessingDuration prometheus.Histogram
@@ -31,6 +41,12 @@ type Metrics struct {
 	DLQEntriesTotal       prometheus.Gauge
 	DLQRetryAttemptsTotal *prometheus.CounterVec
 
+	// Redis metrics
+	RedisUp              prometheus.Gauge
+	RedisPoolConnections *prometheus.GaugeVec
+	RedisPoolEventsTotal *prometheus.CounterVec
+	RedisFallbacksTotal  *prometheus.CounterVec
+
 	// System metrics
 	ActiveConnections     prometheus.Gauge
 	ProcessingErrorsTotal *prometheus.CounterVec
@@ -69,6 +85,13 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"event_type"},
 		),
+		NotificationsThrottledTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "notifications_throttled_total",
+				Help: "Total number of notifications dropped by rate limits",
+			},
+			[]string{"channel", "event_type"},
+		),
 		NotificationsBatchedTotal: promauto.NewCounter(
 			prometheus.CounterOpts{
 				Name: "notifications_batched_total",
@@ -98,6 +121,38 @@ func NewMetrics() *Metrics {
 			[]string{"channel", "error_type"},
 		),
 
+		// SMS metrics
+		SMSMessagesTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sms_messages_total",
+				Help: "Total number of SMS messages by destination calling code",
+			},
+			[]string{"provider", "country", "status"},
+		),
+		SMSSegmentsTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sms_segments_total",
+				Help: "Total number of billed SMS segments",
+			},
+			[]string{"provider", "country"},
+		),
+		SMSCostTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sms_cost_total",
+				Help: "Estimated SMS cost from the configured segment prices",
+			},
+			[]string{"provider", "country"},
+		),
+
+		// Email metrics
+		EmailProviderSendsTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "email_provider_sends_total",
+				Help: "Total number of email send attempts by provider",
+			},
+			[]string{"provider", "status"},
+		),
+
 		// Batch metrics
 		BatchSizeHistogram: promauto.NewHistogram(
 			prometheus.HistogramOpts{
@@ -129,6 +184,35 @@ func NewMetrics() *Metrics {
 			[]string{"event_type", "status"},
 		),
 
+		// Redis metrics
+		RedisUp: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "redis_up",
+				Help: "Whether Redis answered the last health check (1) or not (0)",
+			},
+		),
+		RedisPoolConnections: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "redis_pool_connections",
+				Help: "Number of connections in the Redis pool",
+			},
+			[]string{"state"},
+		),
+		RedisPoolEventsTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "redis_pool_events_total",
+				Help: "Total number of Redis pool lookups that found an idle connection (hit), had to dial one (miss) or timed out waiting for one (timeout)",
+			},
+			[]string{"event"},
+		),
+		RedisFallbacksTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "redis_fallbacks_total",
+				Help: "Total number of operations that fell back to working without Redis",
+			},
+			[]string{"operation"},
+		),
+
 		// System metrics
 		ActiveConnections: promauto.NewGauge(
 			prometheus.GaugeOpts{
@@ -148,6 +232,9 @@ func NewMetrics() *Metrics {
 
 // RecordNotificationSent records a notification sent
 func (m *Metrics) RecordNotificationSent(channel models.NotificationChannel, eventType models.EventType, status models.NotificationStatus) {
+	if m == nil {
+		return
+	}
 	m.NotificationsSentTotal.WithLabelValues(
 		string(channel),
 		string(eventType),
@@ -157,11 +244,17 @@ func (m *Metrics) RecordNotificationSent(channel models.NotificationChannel, eve
 
 // RecordNotificationDeliveryDuration records notification delivery duration
 func (m *Metrics) RecordNotificationDeliveryDuration(channel models.NotificationChannel, duration time.Duration) {
+	if m == nil {
+		return
+	}
 	m.NotificationsDeliveryDuration.WithLabelValues(string(channel)).Observe(duration.Seconds())
 }
 
 // RecordNotificationRetry records a notification retry
 func (m *Metrics) RecordNotificationRetry(channel models.NotificationChannel, attempt int) {
+	if m == nil {
+		return
+	}
 	m.NotificationsRetryTotal.WithLabelValues(
 		string(channel),
 		fmt.Sprintf("%d", attempt),
@@ -170,55 +263,150 @@ func (m *Metrics) RecordNotificationRetry(channel models.NotificationChannel, at
 
 // RecordNotificationDLQ records a notification sent to DLQ
 func (m *Metrics) RecordNotificationDLQ(eventType models.EventType) {
+	if m == nil {
+		return
+	}
 	m.NotificationsDLQTotal.WithLabelValues(string(eventType)).Inc()
 }
 
 // RecordNotificationBatched records a notification batched
 func (m *Metrics) RecordNotificationBatched() {
+	if m == nil {
+		return
+	}
 	m.NotificationsBatchedTotal.Inc()
 }
 
+// RecordNotificationThrottled records a notification dropped by a rate limit
+func (m *Metrics) RecordNotificationThrottled(channel models.NotificationChannel, eventType models.EventType) {
+	if m == nil {
+		return
+	}
+	m.NotificationsThrottledTotal.WithLabelValues(string(channel), string(eventType)).Inc()
+}
+
 // RecordPreferencesUpdated records a preference update
 func (m *Metrics) RecordPreferencesUpdated() {
+	if m == nil {
+		return
+	}
 	m.NotificationPreferencesUpdatedTotal.Inc()
 }
 
 // RecordChannelConnection records a channel connection
 func (m *Metrics) RecordChannelConnection(channel models.NotificationChannel, count float64) {
+	if m == nil {
+		return
+	}
 	m.ChannelConnectionsTotal.WithLabelValues(string(channel)).Set(count)
 }
 
 // RecordChannelError records a channel error
 func (m *Metrics) RecordChannelError(channel models.NotificationChannel, errorType string) {
+	if m == nil {
+		return
+	}
 	m.ChannelErrorsTotal.WithLabelValues(string(channel), errorType).Inc()
 }
 
+// RecordSMSSent records an SMS message with its billed segments and estimated cost
+func (m *Metrics) RecordSMSSent(provider, country, status string, segments int, cost float64) {
+	if m == nil {
+		return
+	}
+	m.SMSMessagesTotal.WithLabelValues(provider, country, status).Inc()
+	if segments > 0 {
+		m.SMSSegmentsTotal.WithLabelValues(provider, country).Add(float64(segments))
+		m.SMSCostTotal.WithLabelValues(provider, country).Add(cost)
+	}
+}
+
+// RecordEmailProviderSend records an attempt to send an email through a provider
+func (m *Metrics) RecordEmailProviderSend(provider, status string) {
+	if m == nil {
+		return
+	}
+	m.EmailProviderSendsTotal.WithLabelValues(provider, status).Inc()
+}
+
 // RecordBatchSize records batch size
 func (m *Metrics) RecordBatchSize(size int) {
+	if m == nil {
+		return
+	}
 	m.BatchSizeHistogram.Observe(float64(size))
 }
 
 // RecordBatchProcessingDuration records batch processing duration
 func (m *Metrics) RecordBatchProcessingDuration(duration time.Duration) {
+	if m == nil {
+		return
+	}
 	m.BatchProcessingDuration.Observe(duration.Seconds())
 }
 
 // RecordDLQEntries records DLQ entries count
 func (m *Metrics) RecordDLQEntries(count int64) {
+	if m == nil {
+		return
+	}
 	m.DLQEntriesTotal.Set(float64(count))
 }
 
 // RecordDLQRetryAttempt records a DLQ retry attempt
 func (m *Metrics) RecordDLQRetryAttempt(eventType models.EventType, status string) {
+	if m == nil {
+		return
+	}
 	m.DLQRetryAttemptsTotal.WithLabelValues(string(eventType), status).Inc()
 }
 
 // RecordActiveConnections records active connections count
 func (m *Metrics) RecordActiveConnections(count int) {
+	if m == nil {
+		return
+	}
 	m.ActiveConnections.Set(float64(count))
 }
 
 // RecordProcessingError records a processing error
 func (m *Metrics) RecordProcessingError(service, errorType string) {
+	if m == nil {
+		return
+	}
 	m.ProcessingErrorsTotal.WithLabelValues(service, errorType).Inc()
 }
+
+// RecordRedisUp records whether Redis answered a health check
+func (m *Metrics) RecordRedisUp(up bool) {
+	if m == nil {
+		return
+	}
+	if up {
+		m.RedisUp.Set(1)
+	} else {
+		m.RedisUp.Set(0)
+	}
+}
+
+// RecordRedisPool records the connections in the Redis pool, and the pool lookups since
+// the last call
+func (m *Metrics) RecordRedisPool(total, idle, stale, hits, misses, timeouts uint32) {
+	if m == nil {
+		return
+	}
+	m.RedisPoolConnections.WithLabelValues("total").Set(float64(total))
+	m.RedisPoolConnections.WithLabelValues("idle").Set(float64(idle))
+	m.RedisPoolConnections.WithLabelValues("stale").Set(float64(stale))
+	m.RedisPoolEventsTotal.WithLabelValues("hit").Add(float64(hits))
+	m.RedisPoolEventsTotal.WithLabelValues("miss").Add(float64(misses))
+	m.RedisPoolEventsTotal.WithLabelValues("timeout").Add(float64(timeouts))
+}
+
+// RecordRedisFallback records an operation that worked around Redis being unavailable
+func (m *Metrics) RecordRedisFallback(operation string) {
+	if m == nil {
+		return
+	}
+	m.RedisFallbacksTotal.WithLabelValues(operation).Inc()
+}
@@ -0,0 +1,44 @@
+// Package migrations lists the notification-service's MongoDB migrations, which it
+// applies on startup and with its migrate subcommand. New migrations are appended with
+// the next version; applied ones are never changed.
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/migrate"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// All returns the notification-service's migrations
+func All() []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version:     1,
+			Description: "Create notification, preference, template, batch, DLQ, webhook, schedule and announcement indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				repos := []struct {
+					name   string
+					create func(ctx context.Context) error
+				}{
+					{"notifications", repository.NewNotificationRepository(db).CreateIndexes},
+					{"preferences", repository.NewPreferencesRepository(db).CreateIndexes},
+					{"templates", repository.NewTemplateRepository(db).CreateIndexes},
+					{"batches", repository.NewBatchRepository(db).CreateIndexes},
+					{"dead letter queue", repository.NewDLQRepository(db).CreateIndexes},
+					{"webhooks", repository.NewWebhookRepository(db).CreateIndexes},
+					{"scheduled notifications", repository.NewScheduledNotificationRepository(db).CreateIndexes},
+					{"announcements", repository.NewAnnouncementRepository(db).CreateIndexes},
+				}
+				for _, repo := range repos {
+					if err := repo.create(ctx); err != nil {
+						return fmt.Errorf("failed to create %s indexes: %w", repo.name, err)
+					}
+				}
+				return nil
+			},
+		},
+	}
+}
@@ -12,8 +12,13 @@ type NotificationStatus string
 const (
 	StatusPending NotificationStatus = "pending"
 	StatusSent    NotificationStatus = "sent"
+	// StatusDelivered is reported by providers with delivery receipts, such as SMS
+	StatusDelivered NotificationStatus = "delivered"
 	StatusFailed  NotificationStatus = "failed"
 	StatusRead    NotificationStatus = "read"
+	// StatusDeferred is returned for notifications held back until the recipient's
+	// quiet hours end
+	StatusDeferred NotificationStatus = "deferred"
 )
 
 // NotificationChannel represents the delivery channel
@@ -25,6 +30,10 @@ const (
 	ChannelPush    NotificationChannel = "push"
 	ChannelInApp   NotificationChannel = "inapp"
 	ChannelWebSocket NotificationChannel = "websocket"
+	ChannelSlack     NotificationChannel = "slack"
+	ChannelDiscord   NotificationChannel = "discord"
+	ChannelTeams     NotificationChannel = "teams"
+	ChannelWebhook   NotificationChannel = "webhook"
 )
 
 // EventType represents the type of event that triggered the notification
@@ -40,6 +49,26 @@ const (
 	EventTypeQuotaExceeded    EventType = "quota.exceeded"
 	EventTypeSecurityAlert    EventType = "security.alert"
 	EventTypeSystemMaintenance EventType = "system.maintenance"
+	// EventTypeInvoiceIssued is a billing receipt, sent regardless of event subscriptions
+	EventTypeInvoiceIssued EventType = "billing.invoice.issued"
+	// EventTypePaymentFailed reminds a user to pay a failed subscription payment, and is
+	// sent regardless of event subscriptions
+	EventTypePaymentFailed EventType = "billing.payment.failed"
+	// EventTypeTrialEnding reminds a user that a free trial is about to be charged, or
+	// tells them it ended unpaid, and is sent regardless of event subscriptions
+	EventTypeTrialEnding EventType = "billing.trial.ending"
+	// EventTypePaymentSucceeded is the receipt of a subscription payment, published by the
+	// billing-service and sent regardless of event subscriptions
+	EventTypePaymentSucceeded EventType = "billing.payment.succeeded"
+	// EventTypeSubscriptionRenewed is the receipt of a subscription's renewal payment, and
+	// is sent regardless of event subscriptions
+	EventTypeSubscriptionRenewed EventType = "billing.subscription.renewed"
+	// EventTypeSubscriptionCancelled tells a user that their subscription was cancelled,
+	// and is sent regardless of event subscriptions
+	EventTypeSubscriptionCancelled EventType = "billing.subscription.cancelled"
+	// EventTypeAnnouncement is sent to every user in an announcement's audience, regardless
+	// of their event subscriptions
+	EventTypeAnnouncement EventType = "system.announcement"
 )
 
 // Priority represents notification priority
@@ -56,6 +85,7 @@ const (
 type Notification struct {
 	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
 	UserID       string               `bson:"user_id" json:"user_id"`
+	TenantID     string               `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"` // Empty for the default tenant
 	EventType    EventType            `bson:"event_type" json:"event_type"`
 	Channel      NotificationChannel  `bson:"channel" json:"channel"`
 	Title        string               `bson:"title" json:"title"`
@@ -74,9 +104,12 @@ type Notification struct {
 	LastRetryAt  *time.Time           `bson:"last_retry_at,omitempty" json:"last_retry_at,omitempty"`
 	NextRetryAt  *time.Time           `bson:"next_retry_at,omitempty" json:"next_retry_at,omitempty"`
 	ErrorReason  string               `bson:"error_reason,omitempty" json:"error_reason,omitempty"`
+	Actions      []NotificationAction `bson:"actions,omitempty" json:"actions,omitempty"`
 	
 	// Delivery tracking
 	DeliveryAttempts []DeliveryAttempt `bson:"delivery_attempts,omitempty" json:"delivery_attempts,omitempty"`
+	// ProviderMessageID identifies the message at the delivery provider, for status callbacks
+	ProviderMessageID string `bson:"provider_message_id,omitempty" json:"provider_message_id,omitempty"`
 }
 
 // DeliveryAttempt represents a single delivery attempt
@@ -87,14 +120,25 @@ type DeliveryAttempt struct {
 	Duration    int64     `bson:"duration_ms" json:"duration_ms"` // Duration in milliseconds
 }
 
+// DefaultLocale is the locale of templates used when none exists for the user's locale
+const DefaultLocale = "en"
+
 // NotificationTemplate represents a notification template
 type NotificationTemplate struct {
 	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	TemplateID      string             `bson:"template_id" json:"template_id"`
 	EventType       EventType          `bson:"event_type" json:"event_type"`
 	Channel         NotificationChannel `bson:"channel" json:"channel"`
+	// Locale is a lowercase BCP 47 tag such as "en" or "pt-br". Templates saved before
+	// locales were added have none and are used as DefaultLocale.
+	Locale          string             `bson:"locale,omitempty" json:"locale,omitempty"`
 	SubjectTemplate string             `bson:"subject_template" json:"subject_template"`
 	BodyTemplate    string             `bson:"body_template" json:"body_template"`
+	// HTMLTemplate renders the HTML part of emails with html/template; BodyTemplate
+	// renders their plain text alternative. Emails without one show the plain text.
+	HTMLTemplate    string             `bson:"html_template,omitempty" json:"html_template,omitempty"`
+	// Layout names the email layout the HTML is placed in, "default" when empty
+	Layout          string             `bson:"layout,omitempty" json:"layout,omitempty"`
 	IsActive        bool               `bson:"is_active" json:"is_active"`
 	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
@@ -109,16 +153,38 @@ type UserNotificationPreferences struct {
 	PushEnabled       bool               `bson:"push_enabled" json:"push_enabled"`
 	InAppEnabled      bool               `bson:"in_app_enabled" json:"in_app_enabled"`
 	WebSocketEnabled  bool               `bson:"websocket_enabled" json:"websocket_enabled"`
+	SlackEnabled      bool               `bson:"slack_enabled" json:"slack_enabled"`
+	DiscordEnabled    bool               `bson:"discord_enabled" json:"discord_enabled"`
+	TeamsEnabled      bool               `bson:"teams_enabled" json:"teams_enabled"`
+	WebhookEnabled    bool               `bson:"webhook_enabled" json:"webhook_enabled"`
 	
 	// Contact information
 	Email             string             `bson:"email,omitempty" json:"email,omitempty"`
+	// Email addresses that bounced or whose recipient reported an email as spam; they are
+	// no longer emailed. Managed through the bounce and complaint webhooks.
+	SuppressedEmails  []EmailSuppression `bson:"suppressed_emails,omitempty" json:"suppressed_emails,omitempty"`
 	PhoneNumber       string             `bson:"phone_number,omitempty" json:"phone_number,omitempty"`
+	// PhoneVerified is set once the user confirms a code sent to PhoneNumber
+	PhoneVerified     bool               `bson:"phone_verified" json:"phone_verified"`
 	PushToken         string             `bson:"push_token,omitempty" json:"push_token,omitempty"`
+	// Devices registered for push notifications, managed through the device endpoints
+	PushDevices       []PushDevice       `bson:"push_devices,omitempty" json:"push_devices,omitempty"`
+	// Incoming webhooks of the chat channels
+	SlackWebhookURL   string             `bson:"slack_webhook_url,omitempty" json:"slack_webhook_url,omitempty"`
+	DiscordWebhookURL string             `bson:"discord_webhook_url,omitempty" json:"discord_webhook_url,omitempty"`
+	TeamsWebhookURL   string             `bson:"teams_webhook_url,omitempty" json:"teams_webhook_url,omitempty"`
+	
+	// Locale of notification templates. When empty, the locale of the user's account
+	// profile is used.
+	Locale            string             `bson:"locale,omitempty" json:"locale,omitempty"`
 	
 	// Quiet hours (24-hour format)
 	QuietHoursStart   string             `bson:"quiet_hours_start,omitempty" json:"quiet_hours_start,omitempty"` // "22:00"
 	QuietHoursEnd     string             `bson:"quiet_hours_end,omitempty" json:"quiet_hours_end,omitempty"`     // "08:00"
 	QuietHoursEnabled bool               `bson:"quiet_hours_enabled" json:"quiet_hours_enabled"`
+	// IANA time zone quiet hours are evaluated in, such as Europe/Berlin. When empty,
+	// the timezone of the user's account profile is used.
+	Timezone          string             `bson:"timezone,omitempty" json:"timezone,omitempty"`
 	
 	// Event subscriptions
 	EventSubscriptions []EventType       `bson:"event_subscriptions" json:"event_subscriptions"`
@@ -126,10 +192,89 @@ type UserNotificationPreferences struct {
 	// Channel priorities for fallback
 	ChannelPriorities map[EventType][]NotificationChannel `bson:"channel_priorities,omitempty" json:"channel_priorities,omitempty"`
 	
+	// Maximum notifications per hour of an event type on each channel, on top of the
+	// limits set by the service. Zero means no limit of the user's own.
+	EventRateLimits   map[EventType]int  `bson:"event_rate_limits,omitempty" json:"event_rate_limits,omitempty"`
+	
 	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
+// EmailSuppressionReason is why an email address is no longer emailed
+type EmailSuppressionReason string
+
+const (
+	EmailSuppressionBounce    EmailSuppressionReason = "bounce"
+	EmailSuppressionComplaint EmailSuppressionReason = "complaint"
+)
+
+// EmailSuppression is an email address that bounced permanently or whose recipient
+// reported an email as spam
+type EmailSuppression struct {
+	Address      string                 `bson:"address" json:"address"`
+	Reason       EmailSuppressionReason `bson:"reason" json:"reason"`
+	Provider     string                 `bson:"provider" json:"provider"`
+	Detail       string                 `bson:"detail,omitempty" json:"detail,omitempty"`
+	SuppressedAt time.Time              `bson:"suppressed_at" json:"suppressed_at"`
+}
+
+// PreferenceCenter holds the preferences recipients manage from the preference center
+// linked in emails, which they open without logging in
+type PreferenceCenter struct {
+	Channels           map[NotificationChannel]bool `json:"channels"`
+	EventSubscriptions []EventType                  `json:"event_subscriptions"`
+}
+
+// PushPlatform identifies the platform of a push device
+type PushPlatform string
+
+const (
+	PushPlatformAndroid PushPlatform = "android"
+	PushPlatformIOS     PushPlatform = "ios"
+	PushPlatformWeb     PushPlatform = "web"
+)
+
+// PushDevice is a device registered for push notifications through FCM
+type PushDevice struct {
+	Token        string       `bson:"token" json:"token"`
+	Platform     PushPlatform `bson:"platform" json:"platform"`
+	RegisteredAt time.Time    `bson:"registered_at" json:"registered_at"`
+}
+
+// WebhookEndpoint is a URL a user registered to receive notifications as signed POST
+// requests
+type WebhookEndpoint struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      string             `bson:"user_id" json:"user_id"`
+	URL         string             `bson:"url" json:"url"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	// Secret signs the payloads. It is only returned when the endpoint is created or the
+	// secret is rotated.
+	Secret    string    `bson:"secret" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// WebhookSecretPrefix starts webhook signing secrets, which are the base64 encoded
+// signing key after the prefix
+const WebhookSecretPrefix = "whsec_"
+
+// WebhookDelivery records one attempt to deliver a notification to a webhook endpoint
+type WebhookDelivery struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	EndpointID primitive.ObjectID `bson:"endpoint_id" json:"endpoint_id"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	// MessageID is shared by all attempts to deliver the same notification
+	MessageID   string    `bson:"message_id" json:"message_id"`
+	EventType   EventType `bson:"event_type" json:"event_type"`
+	Attempt     int       `bson:"attempt" json:"attempt"`
+	Success     bool      `bson:"success" json:"success"`
+	StatusCode  int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error       string    `bson:"error,omitempty" json:"error,omitempty"`
+	Duration    int64     `bson:"duration_ms" json:"duration_ms"`
+	AttemptedAt time.Time `bson:"attempted_at" json:"attempted_at"`
+}
+
 // DeadLetterQueueEntry represents a failed notification in the DLQ
 type DeadLetterQueueEntry struct {
 	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -207,6 +352,38 @@ type TemplateData struct {
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// UserProfile holds the account details used to address and personalise notifications
+type UserProfile struct {
+	UserID   string `json:"user_id"`
+	Email    string `json:"email"`
+	FullName string `json:"full_name"`
+	Timezone string `json:"timezone,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+}
+
+// MaxNotificationActions bounds the actions of a notification
+const MaxNotificationActions = 3
+
+// NotificationActionStyle is how clients render an action
+type NotificationActionStyle string
+
+const (
+	ActionStylePrimary   NotificationActionStyle = "primary"
+	ActionStyleSecondary NotificationActionStyle = "secondary"
+	ActionStyleDanger    NotificationActionStyle = "danger"
+)
+
+// NotificationAction is a button shown with a notification. URL is an absolute web URL,
+// or a path that is resolved against the API gateway when the notification is sent.
+// Intent names an action native clients handle themselves, such as "open_file"; an
+// action needs a URL, an intent or both.
+type NotificationAction struct {
+	Label  string                  `bson:"label" json:"label"`
+	URL    string                  `bson:"url,omitempty" json:"url,omitempty"`
+	Intent string                  `bson:"intent,omitempty" json:"intent,omitempty"`
+	Style  NotificationActionStyle `bson:"style,omitempty" json:"style,omitempty"`
+}
+
 // NotificationRequest represents a request to send a notification
 type NotificationRequest struct {
 	UserID       string                 `json:"user_id"`
@@ -219,6 +396,11 @@ type NotificationRequest struct {
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 	BypassBatching bool                 `json:"bypass_batching,omitempty"`
 	BypassQuietHours bool               `json:"bypass_quiet_hours,omitempty"`
+	// Actions are buttons shown with the notification, at most MaxNotificationActions
+	Actions []NotificationAction `json:"actions,omitempty"`
+	// HTMLMessage is the message rendered from the HTML template of an email template.
+	// It is set by template rendering only, callers send plain text messages.
+	HTMLMessage string `json:"-"`
 }
 
 // NotificationResponse represents the response after sending a notification
@@ -229,6 +411,12 @@ type NotificationResponse struct {
 	SentAt    *time.Time             `json:"sent_at,omitempty"`
 	Error     string                 `json:"error,omitempty"`
 	Duration  int64                  `json:"duration_ms"`
+	// ProviderMessageID identifies the message at the delivery provider
+	ProviderMessageID string `json:"provider_message_id,omitempty"`
+	// ScheduledID and DeferredUntil are set on notifications held back until the
+	// recipient's quiet hours end
+	ScheduledID   string     `json:"scheduled_id,omitempty"`
+	DeferredUntil *time.Time `json:"deferred_until,omitempty"`
 }
 
 // GetDefaultPreferences returns default user preferences
@@ -264,4 +452,176 @@ func GetDefaultPreferences(userID string) *UserNotificationPreferences {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-}
\ No newline at end of file
+}
+// DLQFailureSummary groups DLQ entries that failed for the same reason
+type DLQFailureSummary struct {
+	FailureReason string      `bson:"_id" json:"failure_reason"`
+	Count         int64       `bson:"count" json:"count"`
+	Pending       int64       `bson:"pending" json:"pending"`
+	EventTypes    []EventType `bson:"event_types" json:"event_types"`
+	OldestAt      time.Time   `bson:"oldest_at" json:"oldest_at"`
+	NewestAt      time.Time   `bson:"newest_at" json:"newest_at"`
+	// Transient reports whether the failure is likely to succeed when retried
+	Transient bool `bson:"-" json:"transient"`
+}
+
+// ScheduledNotificationStatus represents the state of a scheduled notification
+type ScheduledNotificationStatus string
+
+const (
+	ScheduledStatusPending ScheduledNotificationStatus = "pending"
+	// ScheduledStatusDispatching is set while a replica sends the notification
+	ScheduledStatusDispatching ScheduledNotificationStatus = "dispatching"
+	ScheduledStatusSent        ScheduledNotificationStatus = "sent"
+	ScheduledStatusFailed      ScheduledNotificationStatus = "failed"
+	ScheduledStatusCancelled   ScheduledNotificationStatus = "cancelled"
+)
+
+// ScheduledNotification is a notification request that is sent at SendAt
+type ScheduledNotification struct {
+	ID      primitive.ObjectID          `bson:"_id,omitempty" json:"id"`
+	UserID  string                      `bson:"user_id" json:"user_id"`
+	Request NotificationRequest         `bson:"request" json:"request"`
+	SendAt  time.Time                   `bson:"send_at" json:"send_at"`
+	Status  ScheduledNotificationStatus `bson:"status" json:"status"`
+	// NotificationID identifies the notification created when it was sent
+	NotificationID string `bson:"notification_id,omitempty" json:"notification_id,omitempty"`
+	// QuietHours is set on notifications held back until the recipient's quiet hours end
+	QuietHours bool       `bson:"quiet_hours,omitempty" json:"quiet_hours,omitempty"`
+	Attempts   int        `bson:"attempts" json:"attempts"`
+	Error      string     `bson:"error,omitempty" json:"error,omitempty"`
+	ClaimedAt  *time.Time `bson:"claimed_at,omitempty" json:"-"`
+	SentAt     *time.Time `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+// AnnouncementStatus represents the state of an announcement
+type AnnouncementStatus string
+
+const (
+	AnnouncementStatusPending   AnnouncementStatus = "pending"
+	AnnouncementStatusSending   AnnouncementStatus = "sending"
+	AnnouncementStatusCompleted AnnouncementStatus = "completed"
+	AnnouncementStatusCancelled AnnouncementStatus = "cancelled"
+	AnnouncementStatusFailed    AnnouncementStatus = "failed"
+)
+
+// AnnouncementPhase is the delivery step an announcement is in
+type AnnouncementPhase string
+
+const (
+	// AnnouncementPhaseInApp delivers the in-app notification, pushed over WebSocket
+	AnnouncementPhaseInApp AnnouncementPhase = "in_app"
+	// AnnouncementPhaseEmail emails the recipients who did not read the in-app
+	// notification yet
+	AnnouncementPhaseEmail AnnouncementPhase = "email"
+)
+
+// Audience types of announcements
+const (
+	AudienceAll  = "all"
+	AudiencePlan = "plan"
+	AudienceOrg  = "org"
+)
+
+// AnnouncementAudience selects the users an announcement is sent to
+type AnnouncementAudience struct {
+	// Type is AudienceAll, AudiencePlan or AudienceOrg
+	Type string `bson:"type" json:"type"`
+	// ID identifies the billing plan or organization
+	ID string `bson:"id,omitempty" json:"id,omitempty"`
+}
+
+// AnnouncementProgress counts the recipients an announcement was processed for
+type AnnouncementProgress struct {
+	Processed int64 `bson:"processed" json:"processed"`
+	Delivered int64 `bson:"delivered" json:"delivered"`
+	// Skipped counts users who already had the announcement or disabled in-app
+	// notifications
+	Skipped          int64 `bson:"skipped" json:"skipped"`
+	Failed           int64 `bson:"failed" json:"failed"`
+	EmailsSent       int64 `bson:"emails_sent" json:"emails_sent"`
+	EmailsFailed     int64 `bson:"emails_failed" json:"emails_failed"`
+	EmailsSuppressed int64 `bson:"emails_suppressed" json:"emails_suppressed"`
+}
+
+// Announcement is a message an admin sends to all users or a segment of them
+type Announcement struct {
+	ID       primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Title    string               `bson:"title" json:"title"`
+	Message  string               `bson:"message" json:"message"`
+	Priority Priority             `bson:"priority" json:"priority"`
+	Audience AnnouncementAudience `bson:"audience" json:"audience"`
+	// SendEmail emails the announcement to recipients who have not read it
+	// EmailDelaySeconds after the in-app delivery finished
+	SendEmail         bool                 `bson:"send_email" json:"send_email"`
+	EmailDelaySeconds int64                `bson:"email_delay_seconds" json:"email_delay_seconds"`
+	Status            AnnouncementStatus   `bson:"status" json:"status"`
+	Phase             AnnouncementPhase    `bson:"phase" json:"phase"`
+	Progress          AnnouncementProgress `bson:"progress" json:"progress"`
+	Error             string               `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedBy         string               `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	// Cursor is the last user or notification ID the current phase processed, so an
+	// interrupted delivery resumes after it
+	Cursor      string     `bson:"cursor,omitempty" json:"-"`
+	NextRunAt   time.Time  `bson:"next_run_at" json:"-"`
+	ClaimedAt   *time.Time `bson:"claimed_at,omitempty" json:"-"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// AnalyticsInterval is the length of the time buckets of delivery analytics
+type AnalyticsInterval string
+
+const (
+	AnalyticsIntervalHour AnalyticsInterval = "hour"
+	AnalyticsIntervalDay  AnalyticsInterval = "day"
+	AnalyticsIntervalWeek AnalyticsInterval = "week"
+)
+
+// Duration returns the length of the interval, zero for an unknown interval
+func (i AnalyticsInterval) Duration() time.Duration {
+	switch i {
+	case AnalyticsIntervalHour:
+		return time.Hour
+	case AnalyticsIntervalDay:
+		return 24 * time.Hour
+	case AnalyticsIntervalWeek:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// DeliveryStats are the delivery attempts and outcomes of the notifications first
+// attempted in a time bucket. Delivered notifications were accepted or delivered by the
+// channel; failed ones were not, after all their attempts.
+type DeliveryStats struct {
+	Channel   NotificationChannel `bson:"channel" json:"channel"`
+	EventType EventType           `bson:"event_type,omitempty" json:"event_type,omitempty"`
+	// Bucket is the start of the time bucket; zero for totals over the whole range
+	Bucket         *time.Time `bson:"bucket,omitempty" json:"bucket,omitempty"`
+	Attempts       int64      `bson:"attempts" json:"attempts"`
+	FailedAttempts int64      `bson:"failed_attempts" json:"failed_attempts"`
+	Notifications  int64      `bson:"notifications" json:"notifications"`
+	Delivered      int64      `bson:"delivered" json:"delivered"`
+	Failed         int64      `bson:"failed" json:"failed"`
+	Read           int64      `bson:"read" json:"read"`
+	// DeliveryRate and FailureRate are shares of the notifications, ReadRate is the share
+	// of delivered notifications that were read
+	DeliveryRate float64 `bson:"-" json:"delivery_rate"`
+	FailureRate  float64 `bson:"-" json:"failure_rate"`
+	ReadRate     float64 `bson:"-" json:"read_rate"`
+}
+
+// DeliveryAnalytics are the delivery stats per channel and event type over time, and
+// their totals per channel
+type DeliveryAnalytics struct {
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Interval AnalyticsInterval `json:"interval"`
+	Series   []DeliveryStats   `json:"series"`
+	Channels []DeliveryStats   `json:"channels"`
+}
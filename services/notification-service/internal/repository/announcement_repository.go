@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrAnnouncementNotFound = errors.New("announcement not found")
+	ErrAnnouncementFinished = errors.New("announcement already finished")
+)
+
+type AnnouncementRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAnnouncementRepository(database *mongo.Database) *AnnouncementRepository {
+	return &AnnouncementRepository{
+		collection: database.Collection("announcements"),
+	}
+}
+
+// Create creates a pending announcement
+func (r *AnnouncementRepository) Create(ctx context.Context, announcement *models.Announcement) error {
+	now := time.Now()
+	announcement.Status = models.AnnouncementStatusPending
+	announcement.Phase = models.AnnouncementPhaseInApp
+	announcement.NextRunAt = now
+	announcement.CreatedAt = now
+	announcement.UpdatedAt = now
+
+	result, err := r.collection.InsertOne(ctx, announcement)
+	if err != nil {
+		return err
+	}
+
+	announcement.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetByID gets an announcement by ID
+func (r *AnnouncementRepository) GetByID(ctx context.Context, id string) (*models.Announcement, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrAnnouncementNotFound
+	}
+
+	var announcement models.Announcement
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&announcement)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAnnouncementNotFound
+		}
+		return nil, err
+	}
+
+	return &announcement, nil
+}
+
+// List gets announcements, newest first, with pagination
+func (r *AnnouncementRepository) List(ctx context.Context, page, limit int) ([]*models.Announcement, int64, error) {
+	total, err := r.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	announcements := make([]*models.Announcement, 0)
+	if err = cursor.All(ctx, &announcements); err != nil {
+		return nil, 0, err
+	}
+
+	return announcements, total, nil
+}
+
+// ClaimNext claims the next announcement ready to be processed. Claims older than
+// staleBefore, left by a replica that stopped while processing, are claimed again. It
+// returns nil if no announcement is ready.
+func (r *AnnouncementRepository) ClaimNext(ctx context.Context, now, staleBefore time.Time) (*models.Announcement, error) {
+	filter := bson.M{
+		"status":      bson.M{"$in": []models.AnnouncementStatus{models.AnnouncementStatusPending, models.AnnouncementStatusSending}},
+		"next_run_at": bson.M{"$lte": now},
+		"$or": []bson.M{
+			{"claimed_at": bson.M{"$exists": false}},
+			{"claimed_at": bson.M{"$lt": staleBefore}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     models.AnnouncementStatusSending,
+			"claimed_at": now,
+			"updated_at": now,
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var announcement models.Announcement
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&announcement)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &announcement, nil
+}
+
+// SaveProgress adds a processed page to the progress of a claimed announcement, moves
+// its cursor and renews the claim. It returns false if the announcement is no longer
+// being sent, because it was cancelled.
+func (r *AnnouncementRepository) SaveProgress(ctx context.Context, id primitive.ObjectID, cursor string, progress models.AnnouncementProgress) (bool, error) {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"cursor":     cursor,
+			"claimed_at": now,
+			"updated_at": now,
+		},
+		"$inc": bson.M{
+			"progress.processed":         progress.Processed,
+			"progress.delivered":         progress.Delivered,
+			"progress.skipped":           progress.Skipped,
+			"progress.failed":            progress.Failed,
+			"progress.emails_sent":       progress.EmailsSent,
+			"progress.emails_failed":     progress.EmailsFailed,
+			"progress.emails_suppressed": progress.EmailsSuppressed,
+		},
+	}
+
+	return r.updateSending(ctx, id, update)
+}
+
+// StartPhase moves a claimed announcement to a phase that runs at runAt and releases
+// the claim
+func (r *AnnouncementRepository) StartPhase(ctx context.Context, id primitive.ObjectID, phase models.AnnouncementPhase, runAt time.Time) (bool, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"phase":       phase,
+			"cursor":      "",
+			"next_run_at": runAt,
+			"updated_at":  time.Now(),
+		},
+		"$unset": bson.M{"claimed_at": ""},
+	}
+
+	return r.updateSending(ctx, id, update)
+}
+
+// Finish records that a claimed announcement completed or failed
+func (r *AnnouncementRepository) Finish(ctx context.Context, id primitive.ObjectID, status models.AnnouncementStatus, reason string) (bool, error) {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":       status,
+			"error":        reason,
+			"completed_at": now,
+			"updated_at":   now,
+		},
+		"$unset": bson.M{"claimed_at": ""},
+	}
+
+	return r.updateSending(ctx, id, update)
+}
+
+func (r *AnnouncementRepository) updateSending(ctx context.Context, id primitive.ObjectID, update bson.M) (bool, error) {
+	filter := bson.M{"_id": id, "status": models.AnnouncementStatusSending}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// Cancel cancels an announcement that is pending or being sent
+func (r *AnnouncementRepository) Cancel(ctx context.Context, id string) (*models.Announcement, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrAnnouncementNotFound
+	}
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":    objectID,
+		"status": bson.M{"$in": []models.AnnouncementStatus{models.AnnouncementStatusPending, models.AnnouncementStatusSending}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":       models.AnnouncementStatusCancelled,
+			"completed_at": now,
+			"updated_at":   now,
+		},
+		"$unset": bson.M{"claimed_at": ""},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var announcement models.Announcement
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&announcement)
+	if err == nil {
+		return &announcement, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// Tell a missing announcement from one that already finished
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return nil, ErrAnnouncementFinished
+}
+
+// CreateIndexes creates necessary indexes
+func (r *AnnouncementRepository) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_run_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "created_at", Value: -1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
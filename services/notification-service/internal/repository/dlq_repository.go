@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"regexp"
 	"time"
 
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
@@ -354,3 +355,129 @@ func (r *DLQRepository) CreateIndexes(ctx context.Context) error {
 	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
 	return err
 }
+
+// DLQFilter selects DLQ entries for bulk operations. Empty fields match all entries.
+type DLQFilter struct {
+	EventType models.EventType
+	// FailureReason matches entries whose failure reason contains it, ignoring case
+	FailureReason string
+	// FailureReasonPattern matches entries whose failure reason matches the regular
+	// expression, ignoring case
+	FailureReasonPattern string
+	// From and To bound the time entries were added to the DLQ
+	From      *time.Time
+	To        *time.Time
+	Processed *bool
+}
+
+// IsEmpty reports whether the filter matches all entries
+func (f DLQFilter) IsEmpty() bool {
+	return f.EventType == "" && f.FailureReason == "" && f.FailureReasonPattern == "" &&
+		f.From == nil && f.To == nil && f.Processed == nil
+}
+
+func (f DLQFilter) query() bson.M {
+	filter := bson.M{}
+
+	if f.EventType != "" {
+		filter["event_type"] = f.EventType
+	}
+
+	var reasons []bson.M
+	if f.FailureReason != "" {
+		reasons = append(reasons, bson.M{"failure_reason": primitive.Regex{Pattern: regexp.QuoteMeta(f.FailureReason), Options: "i"}})
+	}
+	if f.FailureReasonPattern != "" {
+		reasons = append(reasons, bson.M{"failure_reason": primitive.Regex{Pattern: f.FailureReasonPattern, Options: "i"}})
+	}
+	if len(reasons) == 1 {
+		filter["failure_reason"] = reasons[0]["failure_reason"]
+	} else if len(reasons) > 1 {
+		filter["$and"] = reasons
+	}
+
+	if f.From != nil || f.To != nil {
+		createdAt := bson.M{}
+		if f.From != nil {
+			createdAt["$gte"] = *f.From
+		}
+		if f.To != nil {
+			createdAt["$lte"] = *f.To
+		}
+		filter["created_at"] = createdAt
+	}
+
+	if f.Processed != nil {
+		filter["is_processed"] = *f.Processed
+	}
+
+	return filter
+}
+
+// Find gets up to limit DLQ entries matching the filter, oldest first
+func (r *DLQRepository) Find(ctx context.Context, filter DLQFilter, limit int) ([]*models.DeadLetterQueueEntry, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter.query(), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []*models.DeadLetterQueueEntry
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// DeleteMatching deletes the DLQ entries matching the filter
+func (r *DLQRepository) DeleteMatching(ctx context.Context, filter DLQFilter) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, filter.query())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// GetFailureSummary groups the DLQ entries matching the filter by failure reason, most
+// frequent first
+func (r *DLQRepository) GetFailureSummary(ctx context.Context, filter DLQFilter) ([]*models.DLQFailureSummary, error) {
+	pipeline := []bson.M{
+		{
+			"$match": filter.query(),
+		},
+		{
+			"$group": bson.M{
+				"_id":   "$failure_reason",
+				"count": bson.M{"$sum": 1},
+				"pending": bson.M{
+					"$sum": bson.M{"$cond": bson.A{"$is_processed", 0, 1}},
+				},
+				"event_types": bson.M{"$addToSet": "$event_type"},
+				"oldest_at":   bson.M{"$min": "$created_at"},
+				"newest_at":   bson.M{"$max": "$created_at"},
+			},
+		},
+		{
+			"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}},
+		},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	summary := make([]*models.DLQFailureSummary, 0)
+	if err = cursor.All(ctx, &summary); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/yourusername/distributed-file-sharing/pkg/common/tenant"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -26,13 +27,21 @@ func NewNotificationRepository(database *mongo.Database) *NotificationRepository
 	}
 }
 
-// Create creates a new notification
+// Create creates a new notification in the tenant ctx is served for
 func (r *NotificationRepository) Create(ctx context.Context, notification *models.Notification) error {
+	if id, ok := tenant.FromContext(ctx); ok {
+		notification.TenantID = id
+	}
 	notification.CreatedAt = time.Now()
 	notification.UpdatedAt = time.Now()
 
-	_, err := r.collection.InsertOne(ctx, notification)
-	return err
+	result, err := r.collection.InsertOne(ctx, notification)
+	if err != nil {
+		return err
+	}
+
+	notification.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
 }
 
 // GetByID gets a notification by ID
@@ -54,23 +63,70 @@ func (r *NotificationRepository) GetByID(ctx context.Context, id string) (*model
 	return &notification, nil
 }
 
-// GetByUserID gets notifications for a user with pagination
-func (r *NotificationRepository) GetByUserID(ctx context.Context, userID string, page, limit int, status *models.NotificationStatus, eventType *models.EventType) ([]*models.Notification, int64, error) {
-	// Handle both string and ObjectId user_id
-	userIDs := []interface{}{userID}
-	if objID, err := primitive.ObjectIDFromHex(userID); err == nil {
-		userIDs = append(userIDs, objID)
+// NotificationFilter selects a user's notifications. Empty fields match all notifications.
+type NotificationFilter struct {
+	Status    models.NotificationStatus
+	EventType models.EventType
+	Priority  models.Priority
+	Channel   models.NotificationChannel
+	// Search matches notifications whose title or message contain its words, ignoring
+	// case and word endings
+	Search string
+	// From and To bound the time notifications were created
+	From *time.Time
+	To   *time.Time
+}
+
+func (f NotificationFilter) query(userID string) bson.M {
+	var filter bson.M
+	if f.Search != "" {
+		// A compound text index requires an equality match on user_id, so notifications
+		// stored with ObjectId user IDs are not searched
+		filter = bson.M{
+			"user_id": userID,
+			"$text":   bson.M{"$search": f.Search},
+		}
+	} else {
+		// Handle both string and ObjectId user_id
+		userIDs := []interface{}{userID}
+		if objID, err := primitive.ObjectIDFromHex(userID); err == nil {
+			userIDs = append(userIDs, objID)
+		}
+		filter = bson.M{"user_id": bson.M{"$in": userIDs}}
 	}
-	filter := bson.M{"user_id": bson.M{"$in": userIDs}}
 
-	if status != nil {
-		filter["status"] = *status
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	if f.EventType != "" {
+		filter["event_type"] = f.EventType
+	}
+	if f.Priority != "" {
+		filter["priority"] = f.Priority
+	}
+	if f.Channel != "" {
+		filter["channel"] = f.Channel
 	}
 
-	if eventType != nil {
-		filter["event_type"] = *eventType
+	if f.From != nil || f.To != nil {
+		createdAt := bson.M{}
+		if f.From != nil {
+			createdAt["$gte"] = *f.From
+		}
+		if f.To != nil {
+			createdAt["$lte"] = *f.To
+		}
+		filter["created_at"] = createdAt
 	}
 
+	return filter
+}
+
+// GetByUserID gets the notifications of a user matching the filter, newest first, with
+// pagination
+func (r *NotificationRepository) GetByUserID(ctx context.Context, userID string, page, limit int, notificationFilter NotificationFilter) ([]*models.Notification, int64, error) {
+	filter := notificationFilter.query(userID)
+
 	// Get total count
 	total, err := r.collection.CountDocuments(ctx, filter)
 	if err != nil {
@@ -224,6 +280,53 @@ func (r *NotificationRepository) UpdateStatus(ctx context.Context, id string, st
 	return err
 }
 
+// SetProviderMessageID records the delivery provider's ID for a notification
+func (r *NotificationRepository) SetProviderMessageID(ctx context.Context, id, providerMessageID string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"provider_message_id": providerMessageID,
+			"updated_at":          time.Now(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	return err
+}
+
+// UpdateStatusByProviderMessageID updates the status of the notification with a delivery
+// provider's message ID, unless its status is one of skipStatuses. It reports whether a
+// notification was updated.
+func (r *NotificationRepository) UpdateStatusByProviderMessageID(ctx context.Context, channel models.NotificationChannel, providerMessageID string, status models.NotificationStatus, errorReason string, skipStatuses []models.NotificationStatus) (bool, error) {
+	filter := bson.M{
+		"channel":             channel,
+		"provider_message_id": providerMessageID,
+		"status":              bson.M{"$nin": skipStatuses},
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":     status,
+			"updated_at": time.Now(),
+		},
+	}
+
+	if errorReason != "" {
+		update["$set"].(bson.M)["error_reason"] = errorReason
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
 // AddDeliveryAttempt adds a delivery attempt to a notification
 func (r *NotificationRepository) AddDeliveryAttempt(ctx context.Context, id string, attempt *models.DeliveryAttempt) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -407,6 +510,98 @@ func (r *NotificationRepository) GetNotificationStats(ctx context.Context, userI
 	return stats, nil
 }
 
+// GetDeliveryStats aggregates the delivery attempts made in [from, to) per channel, event
+// type and interval, for the tenant ctx is served for. Each notification is counted in
+// the bucket of its first attempt in the range. Empty channel and eventType match all
+// channels and event types.
+func (r *NotificationRepository) GetDeliveryStats(ctx context.Context, from, to time.Time, interval models.AnalyticsInterval, channel models.NotificationChannel, eventType models.EventType) ([]models.DeliveryStats, error) {
+	attemptedAt := bson.M{"$gte": from, "$lt": to}
+	match := bson.M{"delivery_attempts.attempted_at": attemptedAt}
+	if channel != "" {
+		match["channel"] = channel
+	}
+	if eventType != "" {
+		match["event_type"] = eventType
+	}
+	match = tenant.Scope(ctx, match)
+
+	bucket := bson.M{"date": "$first_attempt", "unit": string(interval), "timezone": "UTC"}
+	if interval == models.AnalyticsIntervalWeek {
+		bucket["startOfWeek"] = "monday"
+	}
+	deliveredStatuses := []models.NotificationStatus{models.StatusSent, models.StatusDelivered, models.StatusRead}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$delivery_attempts"}},
+		{{Key: "$match", Value: bson.M{"delivery_attempts.attempted_at": attemptedAt}}},
+		// One document per notification
+		{{Key: "$group", Value: bson.M{
+			"_id":           "$_id",
+			"channel":       bson.M{"$first": "$channel"},
+			"event_type":    bson.M{"$first": "$event_type"},
+			"status":        bson.M{"$first": "$status"},
+			"read":          bson.M{"$first": bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$read_at", nil}}, nil}}},
+			"first_attempt": bson.M{"$min": "$delivery_attempts.attempted_at"},
+			"attempts":      bson.M{"$sum": 1},
+			"failed_attempts": bson.M{"$sum": bson.M{
+				"$cond": bson.A{"$delivery_attempts.success", 0, 1},
+			}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"channel":    "$channel",
+				"event_type": "$event_type",
+				"bucket":     bson.M{"$dateTrunc": bucket},
+			},
+			"attempts":        bson.M{"$sum": "$attempts"},
+			"failed_attempts": bson.M{"$sum": "$failed_attempts"},
+			"notifications":   bson.M{"$sum": 1},
+			"delivered": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$in": bson.A{"$status", deliveredStatuses}}, 1, 0},
+			}},
+			"failed": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$eq": bson.A{"$status", models.StatusFailed}}, 1, 0},
+			}},
+			"read": bson.M{"$sum": bson.M{"$cond": bson.A{"$read", 1, 0}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{
+			{Key: "_id.bucket", Value: 1},
+			{Key: "_id.channel", Value: 1},
+			{Key: "_id.event_type", Value: 1},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var stats []models.DeliveryStats
+	for cursor.Next(ctx) {
+		var result struct {
+			ID struct {
+				Channel   models.NotificationChannel `bson:"channel"`
+				EventType models.EventType           `bson:"event_type"`
+				Bucket    time.Time                  `bson:"bucket"`
+			} `bson:"_id"`
+			models.DeliveryStats `bson:",inline"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+
+		bucketStart := result.ID.Bucket
+		result.DeliveryStats.Channel = result.ID.Channel
+		result.DeliveryStats.EventType = result.ID.EventType
+		result.DeliveryStats.Bucket = &bucketStart
+		stats = append(stats, result.DeliveryStats)
+	}
+
+	return stats, cursor.Err()
+}
+
 // CreateIndexes creates necessary indexes
 func (r *NotificationRepository) CreateIndexes(ctx context.Context) error {
 	indexes := []mongo.IndexModel{
@@ -416,6 +611,27 @@ func (r *NotificationRepository) CreateIndexes(ctx context.Context) error {
 		{
 			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}},
 		},
+		// Unread notifications of a user
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "read_at", Value: 1}},
+		},
+		// Filters of a user's notification list, sorted by creation time
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "event_type", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "priority", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "channel", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "title", Value: "text"}, {Key: "message", Value: "text"}},
+			Options: options.Index().
+				SetName("user_id_text_search").
+				SetWeights(bson.D{{Key: "title", Value: 2}, {Key: "message", Value: 1}}).
+				SetDefaultLanguage("english"),
+		},
 		{
 			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_retry_at", Value: 1}},
 		},
@@ -428,6 +644,14 @@ func (r *NotificationRepository) CreateIndexes(ctx context.Context) error {
 		{
 			Keys: bson.D{{Key: "created_at", Value: -1}},
 		},
+		{
+			Keys:    bson.D{{Key: "provider_message_id", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		// Delivery analytics
+		{
+			Keys: bson.D{{Key: "delivery_attempts.attempted_at", Value: 1}},
+		},
 	}
 
 	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
@@ -481,3 +705,48 @@ func (r *NotificationRepository) DeleteByIDAndUserID(ctx context.Context, notifi
 
 	return nil
 }
+
+// HasAnnouncement reports whether a user was already sent the in-app notification of an
+// announcement
+func (r *NotificationRepository) HasAnnouncement(ctx context.Context, userID, announcementID string) (bool, error) {
+	filter := bson.M{
+		"user_id":                  userID,
+		"channel":                  models.ChannelInApp,
+		"metadata.announcement_id": announcementID,
+	}
+
+	count, err := r.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetUnreadAnnouncementNotifications gets up to limit unread in-app notifications of an
+// announcement after the given ID, in ID order. A zero after starts from the first one.
+func (r *NotificationRepository) GetUnreadAnnouncementNotifications(ctx context.Context, announcementID string, after primitive.ObjectID, limit int) ([]*models.Notification, error) {
+	filter := bson.M{
+		"channel":                  models.ChannelInApp,
+		"metadata.announcement_id": announcementID,
+		"status":                   bson.M{"$ne": models.StatusRead},
+	}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var notifications []*models.Notification
+	if err = cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
@@ -13,8 +14,15 @@ import (
 
 var (
 	ErrPreferencesNotFound = errors.New("user preferences not found")
+	ErrPushDeviceNotFound  = errors.New("push device not found")
+	// ErrEmailSuppressionNotFound is returned when lifting a suppression of an email
+	// address that is not suppressed
+	ErrEmailSuppressionNotFound = errors.New("email address is not suppressed")
 )
 
+// emailCollation compares email addresses case-insensitively
+var emailCollation = &options.Collation{Locale: "en", Strength: 2}
+
 type PreferencesRepository struct {
 	collection *mongo.Collection
 }
@@ -102,6 +110,276 @@ func (r *PreferencesRepository) Delete(ctx context.Context, userID string) error
 	return nil
 }
 
+// GetPushDevices gets the push devices registered by a user
+func (r *PreferencesRepository) GetPushDevices(ctx context.Context, userID string) ([]models.PushDevice, error) {
+	var preferences models.UserNotificationPreferences
+
+	opts := options.FindOne().SetProjection(bson.M{"push_devices": 1})
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&preferences)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return preferences.PushDevices, nil
+}
+
+// AddPushDevice registers a push device for a user, keeping the newest maxDevices devices,
+// and enables push notifications. A token identifies one app install, so it is first
+// removed from any user that registered it before.
+func (r *PreferencesRepository) AddPushDevice(ctx context.Context, userID string, device models.PushDevice, maxDevices int) error {
+	if err := r.RemovePushToken(ctx, device.Token); err != nil {
+		return err
+	}
+
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$push": bson.M{
+			"push_devices": bson.M{
+				"$each":  []models.PushDevice{device},
+				"$slice": -maxDevices,
+			},
+		},
+		"$set": bson.M{
+			"push_enabled": true,
+			"updated_at":   time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrPreferencesNotFound
+	}
+
+	return nil
+}
+
+// RemovePushDevice removes a push device registered by a user
+func (r *PreferencesRepository) RemovePushDevice(ctx context.Context, userID, token string) error {
+	filter := bson.M{"user_id": userID, "push_devices.token": token}
+	update := bson.M{
+		"$pull": bson.M{"push_devices": bson.M{"token": token}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrPushDeviceNotFound
+	}
+
+	return nil
+}
+
+// RemovePushToken removes a push token from whichever user registered it
+func (r *PreferencesRepository) RemovePushToken(ctx context.Context, token string) error {
+	filter := bson.M{"push_devices.token": token}
+	update := bson.M{
+		"$pull": bson.M{"push_devices": bson.M{"token": token}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// GetVerifiedPhoneNumber gets a user's phone number if it is verified
+func (r *PreferencesRepository) GetVerifiedPhoneNumber(ctx context.Context, userID string) (string, error) {
+	var preferences models.UserNotificationPreferences
+
+	filter := bson.M{"user_id": userID, "phone_verified": true}
+	opts := options.FindOne().SetProjection(bson.M{"phone_number": 1})
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&preferences)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return preferences.PhoneNumber, nil
+}
+
+// FindUserIDsByEmail gets the users whose preferences hold an email address, ignoring case
+func (r *PreferencesRepository) FindUserIDsByEmail(ctx context.Context, address string) ([]string, error) {
+	opts := options.Find().
+		SetCollation(emailCollation).
+		SetProjection(bson.M{"user_id": 1})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"email": address}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var preferences []models.UserNotificationPreferences
+	if err = cursor.All(ctx, &preferences); err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, len(preferences))
+	for i, pref := range preferences {
+		userIDs[i] = pref.UserID
+	}
+	return userIDs, nil
+}
+
+// AddEmailSuppression suppresses an email address of a user. It reports false if the
+// address was already suppressed.
+func (r *PreferencesRepository) AddEmailSuppression(ctx context.Context, userID string, suppression models.EmailSuppression) (bool, error) {
+	filter := bson.M{
+		"user_id":                   userID,
+		"suppressed_emails.address": bson.M{"$ne": suppression.Address},
+	}
+	update := bson.M{
+		"$push": bson.M{"suppressed_emails": suppression},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// RemoveEmailSuppression lifts the suppression of an email address of a user
+func (r *PreferencesRepository) RemoveEmailSuppression(ctx context.Context, userID, address string) error {
+	filter := bson.M{"user_id": userID, "suppressed_emails.address": address}
+	update := bson.M{
+		"$pull": bson.M{"suppressed_emails": bson.M{"address": address}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEmailSuppressionNotFound
+	}
+
+	return nil
+}
+
+// IsEmailSuppressed reports whether an email address of a user is suppressed. Addresses
+// are stored in lower case.
+func (r *PreferencesRepository) IsEmailSuppressed(ctx context.Context, userID, address string) (bool, error) {
+	filter := bson.M{"user_id": userID, "suppressed_emails.address": strings.ToLower(address)}
+
+	count, err := r.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetWebhookURL gets the webhook a user configured for a chat channel
+func (r *PreferencesRepository) GetWebhookURL(ctx context.Context, userID string, channel models.NotificationChannel) (string, error) {
+	var preferences models.UserNotificationPreferences
+
+	opts := options.FindOne().SetProjection(bson.M{
+		"slack_webhook_url":   1,
+		"discord_webhook_url": 1,
+		"teams_webhook_url":   1,
+	})
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&preferences)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	switch channel {
+	case models.ChannelSlack:
+		return preferences.SlackWebhookURL, nil
+	case models.ChannelDiscord:
+		return preferences.DiscordWebhookURL, nil
+	case models.ChannelTeams:
+		return preferences.TeamsWebhookURL, nil
+	}
+	return "", nil
+}
+
+// SetWebhookEnabled enables or disables the webhook channel of a user
+func (r *PreferencesRepository) SetWebhookEnabled(ctx context.Context, userID string, enabled bool) error {
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"webhook_enabled": enabled,
+			"updated_at":      time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrPreferencesNotFound
+	}
+
+	return nil
+}
+
+// SetEmailEnabled enables or disables the email channel of a user
+func (r *PreferencesRepository) SetEmailEnabled(ctx context.Context, userID string, enabled bool) error {
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"email_enabled": enabled,
+			"updated_at":    time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrPreferencesNotFound
+	}
+
+	return nil
+}
+
+// SetPhoneNumber sets a user's phone number and whether it is verified. An empty phone
+// number removes it.
+func (r *PreferencesRepository) SetPhoneNumber(ctx context.Context, userID, phoneNumber string, verified bool) error {
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"phone_number":   phoneNumber,
+			"phone_verified": verified,
+			"updated_at":     time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrPreferencesNotFound
+	}
+
+	return nil
+}
+
 // GetDefaultPreferences returns default user preferences
 func (r *PreferencesRepository) GetDefaultPreferences(userID string) *models.UserNotificationPreferences {
 	return models.GetDefaultPreferences(userID)
@@ -147,6 +425,14 @@ func (r *PreferencesRepository) GetUsersByChannel(ctx context.Context, channel m
 		filter = bson.M{"in_app_enabled": true}
 	case models.ChannelWebSocket:
 		filter = bson.M{"websocket_enabled": true}
+	case models.ChannelSlack:
+		filter = bson.M{"slack_enabled": true}
+	case models.ChannelDiscord:
+		filter = bson.M{"discord_enabled": true}
+	case models.ChannelTeams:
+		filter = bson.M{"teams_enabled": true}
+	case models.ChannelWebhook:
+		filter = bson.M{"webhook_enabled": true}
 	default:
 		return []string{}, nil
 	}
@@ -264,6 +550,14 @@ func (r *PreferencesRepository) IsChannelEnabled(ctx context.Context, userID str
 				return defaultPrefs.InAppEnabled, nil
 			case models.ChannelWebSocket:
 				return defaultPrefs.WebSocketEnabled, nil
+			case models.ChannelSlack:
+				return defaultPrefs.SlackEnabled, nil
+			case models.ChannelDiscord:
+				return defaultPrefs.DiscordEnabled, nil
+			case models.ChannelTeams:
+				return defaultPrefs.TeamsEnabled, nil
+			case models.ChannelWebhook:
+				return defaultPrefs.WebhookEnabled, nil
 			}
 			return false, nil
 		}
@@ -281,6 +575,14 @@ func (r *PreferencesRepository) IsChannelEnabled(ctx context.Context, userID str
 		return preferences.InAppEnabled, nil
 	case models.ChannelWebSocket:
 		return preferences.WebSocketEnabled, nil
+	case models.ChannelSlack:
+		return preferences.SlackEnabled, nil
+	case models.ChannelDiscord:
+		return preferences.DiscordEnabled, nil
+	case models.ChannelTeams:
+		return preferences.TeamsEnabled, nil
+	case models.ChannelWebhook:
+		return preferences.WebhookEnabled, nil
 	}
 
 	return false, nil
@@ -342,6 +644,13 @@ func (r *PreferencesRepository) CreateIndexes(ctx context.Context) error {
 		{
 			Keys: bson.D{{Key: "quiet_hours_enabled", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "push_devices.token", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetCollation(emailCollation).SetSparse(true),
+		},
 	}
 
 	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
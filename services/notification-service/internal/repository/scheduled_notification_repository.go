@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrScheduledNotificationNotFound   = errors.New("scheduled notification not found")
+	ErrScheduledNotificationNotPending = errors.New("scheduled notification is no longer pending")
+)
+
+type ScheduledNotificationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewScheduledNotificationRepository(database *mongo.Database) *ScheduledNotificationRepository {
+	return &ScheduledNotificationRepository{
+		collection: database.Collection("scheduled_notifications"),
+	}
+}
+
+// Create creates a pending scheduled notification
+func (r *ScheduledNotificationRepository) Create(ctx context.Context, scheduled *models.ScheduledNotification) error {
+	scheduled.Status = models.ScheduledStatusPending
+	scheduled.CreatedAt = time.Now()
+	scheduled.UpdatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(ctx, scheduled)
+	if err != nil {
+		return err
+	}
+
+	scheduled.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetByID gets a scheduled notification by ID
+func (r *ScheduledNotificationRepository) GetByID(ctx context.Context, id string) (*models.ScheduledNotification, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrScheduledNotificationNotFound
+	}
+
+	var scheduled models.ScheduledNotification
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&scheduled)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrScheduledNotificationNotFound
+		}
+		return nil, err
+	}
+
+	return &scheduled, nil
+}
+
+// List gets scheduled notifications by send time with pagination. Empty userID and
+// status match all scheduled notifications.
+func (r *ScheduledNotificationRepository) List(ctx context.Context, userID string, status models.ScheduledNotificationStatus, page, limit int) ([]*models.ScheduledNotification, int64, error) {
+	filter := bson.M{}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "send_at", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	scheduled := make([]*models.ScheduledNotification, 0)
+	if err = cursor.All(ctx, &scheduled); err != nil {
+		return nil, 0, err
+	}
+
+	return scheduled, total, nil
+}
+
+// ClaimDue claims the earliest pending notification due at now for sending. Claims
+// older than staleBefore, left by a replica that stopped while sending, are claimed
+// again. It returns nil if no notification is due.
+func (r *ScheduledNotificationRepository) ClaimDue(ctx context.Context, now, staleBefore time.Time) (*models.ScheduledNotification, error) {
+	filter := bson.M{
+		"$or": []bson.M{
+			{"status": models.ScheduledStatusPending, "send_at": bson.M{"$lte": now}},
+			{"status": models.ScheduledStatusDispatching, "claimed_at": bson.M{"$lt": staleBefore}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     models.ScheduledStatusDispatching,
+			"claimed_at": now,
+			"updated_at": now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "send_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var scheduled models.ScheduledNotification
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&scheduled)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &scheduled, nil
+}
+
+// MarkSent records that a claimed notification was sent
+func (r *ScheduledNotificationRepository) MarkSent(ctx context.Context, id primitive.ObjectID, notificationID string) error {
+	now := time.Now()
+	return r.finishDispatch(ctx, id, bson.M{
+		"status":          models.ScheduledStatusSent,
+		"notification_id": notificationID,
+		"sent_at":         now,
+		"updated_at":      now,
+	})
+}
+
+// MarkFailed records that a claimed notification could not be sent
+func (r *ScheduledNotificationRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, reason string) error {
+	return r.finishDispatch(ctx, id, bson.M{
+		"status":     models.ScheduledStatusFailed,
+		"error":      reason,
+		"updated_at": time.Now(),
+	})
+}
+
+// Requeue returns a claimed notification that could not be sent to pending, to be sent
+// at retryAt
+func (r *ScheduledNotificationRepository) Requeue(ctx context.Context, id primitive.ObjectID, retryAt time.Time, reason string) error {
+	return r.finishDispatch(ctx, id, bson.M{
+		"status":     models.ScheduledStatusPending,
+		"send_at":    retryAt,
+		"error":      reason,
+		"updated_at": time.Now(),
+	})
+}
+
+// Postpone returns a claimed notification to pending without counting the attempt, to
+// be sent at sendAt
+func (r *ScheduledNotificationRepository) Postpone(ctx context.Context, id primitive.ObjectID, sendAt time.Time) error {
+	filter := bson.M{"_id": id, "status": models.ScheduledStatusDispatching}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     models.ScheduledStatusPending,
+			"send_at":    sendAt,
+			"updated_at": time.Now(),
+		},
+		"$unset": bson.M{"claimed_at": ""},
+		"$inc":   bson.M{"attempts": -1},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *ScheduledNotificationRepository) finishDispatch(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	filter := bson.M{"_id": id, "status": models.ScheduledStatusDispatching}
+	update := bson.M{
+		"$set":   set,
+		"$unset": bson.M{"claimed_at": ""},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// Cancel cancels a pending scheduled notification
+func (r *ScheduledNotificationRepository) Cancel(ctx context.Context, id string) (*models.ScheduledNotification, error) {
+	return r.updatePending(ctx, id, bson.M{
+		"status":     models.ScheduledStatusCancelled,
+		"updated_at": time.Now(),
+	})
+}
+
+// Reschedule changes when a pending scheduled notification is sent
+func (r *ScheduledNotificationRepository) Reschedule(ctx context.Context, id string, sendAt time.Time) (*models.ScheduledNotification, error) {
+	return r.updatePending(ctx, id, bson.M{
+		"send_at":    sendAt,
+		"updated_at": time.Now(),
+	})
+}
+
+func (r *ScheduledNotificationRepository) updatePending(ctx context.Context, id string, set bson.M) (*models.ScheduledNotification, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrScheduledNotificationNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "status": models.ScheduledStatusPending}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var scheduled models.ScheduledNotification
+	err = r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&scheduled)
+	if err == nil {
+		return &scheduled, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// Tell a missing notification from one that was already sent or cancelled
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return nil, ErrScheduledNotificationNotPending
+}
+
+// CreateIndexes creates necessary indexes
+func (r *ScheduledNotificationRepository) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "send_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "claimed_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "send_at", Value: 1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
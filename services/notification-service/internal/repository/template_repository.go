@@ -88,10 +88,45 @@ func (r *TemplateRepository) GetByEventTypeAndChannel(ctx context.Context, event
 	return &template, nil
 }
 
+// GetByEventTypeChannelAndLocale gets the active template of an event type and channel in
+// a locale. Templates without a locale are matched as the default locale.
+func (r *TemplateRepository) GetByEventTypeChannelAndLocale(ctx context.Context, eventType models.EventType, channel models.NotificationChannel, locale string) (*models.NotificationTemplate, error) {
+	filter := bson.M{
+		"event_type": eventType,
+		"channel":    channel,
+		"locale":     localeFilter(locale),
+		"is_active":  true,
+	}
+
+	var template models.NotificationTemplate
+	err := r.collection.FindOne(ctx, filter).Decode(&template)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// localeFilter matches templates of a locale, including templates without a locale for
+// the default locale
+func localeFilter(locale string) interface{} {
+	if locale == models.DefaultLocale {
+		return bson.M{"$in": bson.A{locale, nil}}
+	}
+	return locale
+}
+
 // GetAll gets all templates with pagination
-func (r *TemplateRepository) GetAll(ctx context.Context, page, limit int, eventType *models.EventType, channel *models.NotificationChannel) ([]*models.NotificationTemplate, int64, error) {
+func (r *TemplateRepository) GetAll(ctx context.Context, page, limit int, eventType *models.EventType, channel *models.NotificationChannel, locale *string) ([]*models.NotificationTemplate, int64, error) {
 	filter := bson.M{}
 	
+	if locale != nil {
+		filter["locale"] = localeFilter(*locale)
+	}
+	
 	if eventType != nil {
 		filter["event_type"] = *eventType
 	}
@@ -224,7 +259,7 @@ func (r *TemplateRepository) CreateIndexes(ctx context.Context) error {
 			Options: options.Index().SetUnique(true),
 		},
 		{
-			Keys: bson.D{{Key: "event_type", Value: 1}, {Key: "channel", Value: 1}},
+			Keys: bson.D{{Key: "event_type", Value: 1}, {Key: "channel", Value: 1}, {Key: "locale", Value: 1}},
 		},
 		{
 			Keys: bson.D{{Key: "is_active", Value: 1}},
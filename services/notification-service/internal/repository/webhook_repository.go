@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+
+// webhookDeliveryRetention is how long delivery attempts are kept
+const webhookDeliveryRetention = 30 * 24 * time.Hour
+
+type WebhookRepository struct {
+	endpoints  *mongo.Collection
+	deliveries *mongo.Collection
+}
+
+func NewWebhookRepository(database *mongo.Database) *WebhookRepository {
+	return &WebhookRepository{
+		endpoints:  database.Collection("webhook_endpoints"),
+		deliveries: database.Collection("webhook_deliveries"),
+	}
+}
+
+// CreateEndpoint creates a webhook endpoint
+func (r *WebhookRepository) CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	endpoint.CreatedAt = time.Now()
+	endpoint.UpdatedAt = time.Now()
+
+	result, err := r.endpoints.InsertOne(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	endpoint.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetEndpointsByUserID gets the webhook endpoints of a user, oldest first
+func (r *WebhookRepository) GetEndpointsByUserID(ctx context.Context, userID string) ([]models.WebhookEndpoint, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.endpoints.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var endpoints []models.WebhookEndpoint
+	if err := cursor.All(ctx, &endpoints); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// CountEndpoints counts the webhook endpoints of a user
+func (r *WebhookRepository) CountEndpoints(ctx context.Context, userID string) (int64, error) {
+	return r.endpoints.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+// UpdateEndpointSecret replaces the signing secret of a user's webhook endpoint
+func (r *WebhookRepository) UpdateEndpointSecret(ctx context.Context, userID, endpointID, secret string) error {
+	objectID, err := primitive.ObjectIDFromHex(endpointID)
+	if err != nil {
+		return ErrWebhookEndpointNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "user_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"secret":     secret,
+			"updated_at": time.Now(),
+		},
+	}
+
+	result, err := r.endpoints.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+
+	return nil
+}
+
+// DeleteEndpoint deletes a user's webhook endpoint and its delivery attempts
+func (r *WebhookRepository) DeleteEndpoint(ctx context.Context, userID, endpointID string) error {
+	objectID, err := primitive.ObjectIDFromHex(endpointID)
+	if err != nil {
+		return ErrWebhookEndpointNotFound
+	}
+
+	result, err := r.endpoints.DeleteOne(ctx, bson.M{"_id": objectID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+
+	_, err = r.deliveries.DeleteMany(ctx, bson.M{"endpoint_id": objectID})
+	return err
+}
+
+// RecordDelivery records a delivery attempt
+func (r *WebhookRepository) RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	result, err := r.deliveries.InsertOne(ctx, delivery)
+	if err != nil {
+		return err
+	}
+
+	delivery.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetDeliveries gets the latest delivery attempts to a user's webhook endpoint
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, userID, endpointID string, limit int) ([]models.WebhookDelivery, error) {
+	objectID, err := primitive.ObjectIDFromHex(endpointID)
+	if err != nil {
+		return nil, ErrWebhookEndpointNotFound
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "attempted_at", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.deliveries.Find(ctx, bson.M{"endpoint_id": objectID, "user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var deliveries []models.WebhookDelivery
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// CreateIndexes creates necessary indexes
+func (r *WebhookRepository) CreateIndexes(ctx context.Context) error {
+	endpointIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+	}
+	if _, err := r.endpoints.Indexes().CreateMany(ctx, endpointIndexes); err != nil {
+		return err
+	}
+
+	deliveryIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "endpoint_id", Value: 1}, {Key: "attempted_at", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "attempted_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(webhookDeliveryRetention.Seconds())),
+		},
+	}
+	_, err := r.deliveries.Indexes().CreateMany(ctx, deliveryIndexes)
+	return err
+}
@@ -0,0 +1,91 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/serviceauth"
+)
+
+// actorKey is the context key of the administrator or service an operator request is
+// made by: a user ID, or "service:" followed by the service's client ID
+const actorKey = "actor"
+
+// AdminDirectory looks up the email addresses of users, to recognize administrators
+type AdminDirectory interface {
+	GetVerifiedEmail(ctx context.Context, userID string) (string, bool, error)
+}
+
+// SetAdminAuth serves the operator endpoints, announcements, scheduled notifications and
+// the dead letter queue, to services presenting a token serviceTokens accepts and to
+// users whose verified email is in adminEmails. serviceTokens is nil when services are
+// not authenticated. Without it the endpoints are refused.
+func (h *RestHandlers) SetAdminAuth(userTokens *jwtauth.Validator, serviceTokens *serviceauth.Validator, adminEmails []string, directory AdminDirectory) {
+	h.userTokens = userTokens
+	h.serviceTokens = serviceTokens
+	h.adminEmails = adminEmails
+	h.adminDirectory = directory
+}
+
+// authorizeAdmin rejects requests made by anyone but an administrator or a service, and
+// stores who made them under actorKey
+func (h *RestHandlers) authorizeAdmin(c *gin.Context) {
+	if token := c.GetHeader(serviceauth.Header); token != "" {
+		if h.serviceTokens == nil {
+			apierror.Abort(c, http.StatusUnauthorized, "Service tokens are not accepted")
+			return
+		}
+		claims, err := h.serviceTokens.ValidateToken(token)
+		if err != nil {
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid service token")
+			return
+		}
+		c.Set(actorKey, "service:"+claims.ClientID)
+		c.Next()
+		return
+	}
+
+	if h.userTokens == nil || h.adminDirectory == nil || len(h.adminEmails) == 0 {
+		apierror.Abort(c, http.StatusForbidden, "Administrator access required")
+		return
+	}
+
+	claims, err := h.userTokens.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		message := "Invalid token"
+		if errors.Is(err, jwtauth.ErrExpiredToken) {
+			message = "Token expired"
+		}
+		apierror.Abort(c, http.StatusUnauthorized, message)
+		return
+	}
+
+	email, verified, err := h.adminDirectory.GetVerifiedEmail(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to check administrator access")
+		apierror.Abort(c, http.StatusServiceUnavailable, "Failed to check administrator access")
+		return
+	}
+	if !verified || !h.isAdminEmail(email) {
+		apierror.Abort(c, http.StatusForbidden, "Administrator access required")
+		return
+	}
+
+	c.Set(actorKey, claims.UserID)
+	c.Next()
+}
+
+// isAdminEmail reports whether email belongs to an administrator
+func (h *RestHandlers) isAdminEmail(email string) bool {
+	for _, admin := range h.adminEmails {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,24 +1,65 @@
 package rest
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/ginmw"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/serviceauth"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/handlers"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/services"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/unsubscribe"
 )
 
 // RestHandlers handles REST API endpoints
 type RestHandlers struct {
-	notifSvc      *services.NotificationService
-	preferenceSvc *services.PreferenceService
-	templateSvc   *services.TemplateService
-	batchSvc      *services.BatchService
-	dlqSvc        *services.DLQService
-	logger        *logrus.Logger
+	notifSvc       *services.NotificationService
+	preferenceSvc  *services.PreferenceService
+	templateSvc    *services.TemplateService
+	batchSvc       *services.BatchService
+	dlqSvc         *services.DLQService
+	phoneSvc       *services.PhoneVerificationService
+	webhookSvc     *services.WebhookService
+	scheduleSvc    *services.ScheduleService
+	announceSvc    *services.AnnouncementService
+	smsCallbacks   SMSStatusCallbackParser
+	emailFeedback  map[string]EmailFeedbackParser
+	unsubscribes   UnsubscribeTokenValidator
+	analyticsToken string
+	userTokens     *jwtauth.Validator
+	serviceTokens  *serviceauth.Validator
+	adminEmails    []string
+	adminDirectory AdminDirectory
+	logger         *logrus.Logger
+}
+
+// SMSStatusCallbackParser verifies and parses SMS delivery status callbacks
+type SMSStatusCallbackParser interface {
+	ParseStatusCallback(r *http.Request) (*handlers.SMSStatusUpdate, error)
+}
+
+// EmailFeedbackParser verifies and parses the bounce and complaint webhooks of an email
+// provider. Events that do not suppress an address, such as deliveries and transient
+// bounces, are left out.
+type EmailFeedbackParser interface {
+	ParseFeedback(ctx context.Context, r *http.Request) ([]handlers.EmailFeedback, error)
+}
+
+// UnsubscribeTokenValidator validates the tokens of the unsubscribe links in emails
+type UnsubscribeTokenValidator interface {
+	Validate(token string) (*unsubscribe.Claims, error)
 }
 
 // NewRestHandlers creates new REST handlers
@@ -28,6 +69,10 @@ func NewRestHandlers(
 	templateSvc *services.TemplateService,
 	batchSvc *services.BatchService,
 	dlqSvc *services.DLQService,
+	phoneSvc *services.PhoneVerificationService,
+	webhookSvc *services.WebhookService,
+	scheduleSvc *services.ScheduleService,
+	announceSvc *services.AnnouncementService,
 	logger *logrus.Logger,
 ) *RestHandlers {
 	return &RestHandlers{
@@ -36,10 +81,37 @@ func NewRestHandlers(
 		templateSvc:   templateSvc,
 		batchSvc:      batchSvc,
 		dlqSvc:        dlqSvc,
+		phoneSvc:      phoneSvc,
+		webhookSvc:    webhookSvc,
+		scheduleSvc:   scheduleSvc,
+		announceSvc:   announceSvc,
 		logger:        logger,
 	}
 }
 
+// SetSMSStatusCallbacks enables the SMS delivery status webhook
+func (h *RestHandlers) SetSMSStatusCallbacks(parser SMSStatusCallbackParser) {
+	h.smsCallbacks = parser
+}
+
+// SetEmailFeedbackParsers enables the bounce and complaint webhooks of email providers,
+// keyed by provider name
+func (h *RestHandlers) SetEmailFeedbackParsers(parsers map[string]EmailFeedbackParser) {
+	h.emailFeedback = parsers
+}
+
+// SetUnsubscribeTokens enables the unsubscribe and preference center endpoints, which
+// authenticate recipients by the tokens of the links in emails
+func (h *RestHandlers) SetUnsubscribeTokens(validator UnsubscribeTokenValidator) {
+	h.unsubscribes = validator
+}
+
+// SetAnalyticsToken serves the delivery analytics of the admin analytics to operators
+// holding token. Without it they aren't served.
+func (h *RestHandlers) SetAnalyticsToken(token string) {
+	h.analyticsToken = token
+}
+
 // HealthCheck handles health check endpoint
 func (h *RestHandlers) HealthCheck(c *gin.Context) {
 	health, err := h.notifSvc.GetServiceHealth(c.Request.Context())
@@ -58,35 +130,25 @@ func (h *RestHandlers) HealthCheck(c *gin.Context) {
 func (h *RestHandlers) GetNotifications(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
-	status := c.Query("status")
-	eventType := c.Query("event_type")
 
-	// Parse status filter
-	var statusFilter *models.NotificationStatus
-	if status != "" {
-		s := models.NotificationStatus(status)
-		statusFilter = &s
-	}
-
-	// Parse event type filter
-	var eventTypeFilter *models.EventType
-	if eventType != "" {
-		e := models.EventType(eventType)
-		eventTypeFilter = &e
+	filter, err := parseNotificationFilter(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	// Get notifications
-	notifications, total, err := h.notifSvc.GetNotifications(c.Request.Context(), userID, page, limit, statusFilter, eventTypeFilter)
+	notifications, total, err := h.notifSvc.GetNotifications(c.Request.Context(), userID, page, limit, filter)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get notifications")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get notifications")
 		return
 	}
 
@@ -105,7 +167,7 @@ func (h *RestHandlers) GetNotifications(c *gin.Context) {
 func (h *RestHandlers) GetNotification(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
@@ -113,11 +175,11 @@ func (h *RestHandlers) GetNotification(c *gin.Context) {
 	notification, err := h.notifSvc.GetNotification(c.Request.Context(), notificationID, userID)
 	if err != nil {
 		if err.Error() == "notification not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			apierror.Abort(c, http.StatusNotFound, "Notification not found")
 			return
 		}
 		h.logger.WithError(err).Error("Failed to get notification")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notification"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get notification")
 		return
 	}
 
@@ -128,7 +190,7 @@ func (h *RestHandlers) GetNotification(c *gin.Context) {
 func (h *RestHandlers) MarkAsRead(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
@@ -136,11 +198,11 @@ func (h *RestHandlers) MarkAsRead(c *gin.Context) {
 	err := h.notifSvc.MarkAsRead(c.Request.Context(), notificationID, userID)
 	if err != nil {
 		if err.Error() == "notification not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			apierror.Abort(c, http.StatusNotFound, "Notification not found")
 			return
 		}
 		h.logger.WithError(err).Error("Failed to mark notification as read")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification as read"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to mark notification as read")
 		return
 	}
 
@@ -151,14 +213,14 @@ func (h *RestHandlers) MarkAsRead(c *gin.Context) {
 func (h *RestHandlers) MarkAllAsRead(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
 	count, err := h.notifSvc.MarkAllAsRead(c.Request.Context(), userID)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to mark all notifications as read")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark all notifications as read"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to mark all notifications as read")
 		return
 	}
 
@@ -172,7 +234,7 @@ func (h *RestHandlers) MarkAllAsRead(c *gin.Context) {
 func (h *RestHandlers) DeleteNotification(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
@@ -180,11 +242,11 @@ func (h *RestHandlers) DeleteNotification(c *gin.Context) {
 	err := h.notifSvc.DeleteNotification(c.Request.Context(), notificationID, userID)
 	if err != nil {
 		if err.Error() == "notification not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			apierror.Abort(c, http.StatusNotFound, "Notification not found")
 			return
 		}
 		h.logger.WithError(err).Error("Failed to delete notification")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to delete notification")
 		return
 	}
 
@@ -195,14 +257,14 @@ func (h *RestHandlers) DeleteNotification(c *gin.Context) {
 func (h *RestHandlers) GetUnreadCount(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
 	count, err := h.notifSvc.GetUnreadCount(c.Request.Context(), userID)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get unread count")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unread count"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get unread count")
 		return
 	}
 
@@ -213,14 +275,14 @@ func (h *RestHandlers) GetUnreadCount(c *gin.Context) {
 func (h *RestHandlers) GetUserPreferences(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
 	preferences, err := h.preferenceSvc.GetUserPreferences(c.Request.Context(), userID)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get user preferences")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user preferences"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get user preferences")
 		return
 	}
 
@@ -231,31 +293,510 @@ func (h *RestHandlers) GetUserPreferences(c *gin.Context) {
 func (h *RestHandlers) UpdateUserPreferences(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
 	var preferences models.UserNotificationPreferences
 	if err := c.ShouldBindJSON(&preferences); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	err := h.preferenceSvc.UpdateUserPreferences(c.Request.Context(), userID, &preferences)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidPreferences) {
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		h.logger.WithError(err).Error("Failed to update user preferences")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user preferences"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to update user preferences")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Preferences updated successfully"})
 }
 
+// ListPushDevices handles GET /v1/notifications/devices
+func (h *RestHandlers) ListPushDevices(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	devices, err := h.preferenceSvc.ListPushDevices(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list push devices")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to list push devices")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+// RegisterPushDevice handles POST /v1/notifications/devices
+func (h *RestHandlers) RegisterPushDevice(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	var req struct {
+		Token    string              `json:"token"`
+		Platform models.PushPlatform `json:"platform"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	device, err := h.preferenceSvc.RegisterPushDevice(c.Request.Context(), userID, req.Token, req.Platform)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPushDevice) {
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.logger.WithError(err).Error("Failed to register push device")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to register push device")
+		return
+	}
+
+	c.JSON(http.StatusCreated, device)
+}
+
+// UnregisterPushDevice handles DELETE /v1/notifications/devices/:token
+func (h *RestHandlers) UnregisterPushDevice(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	err := h.preferenceSvc.UnregisterPushDevice(c.Request.Context(), userID, c.Param("token"))
+	if err != nil {
+		if errors.Is(err, repository.ErrPushDeviceNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "Push device not found")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to unregister push device")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to unregister push device")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Push device unregistered successfully"})
+}
+
+// ClearEmailSuppression handles DELETE /v1/preferences/email-suppressions/:address, which
+// resumes emails to an address suppressed after a bounce or complaint
+func (h *RestHandlers) ClearEmailSuppression(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	err := h.preferenceSvc.ClearEmailSuppression(c.Request.Context(), userID, c.Param("address"))
+	if err != nil {
+		if errors.Is(err, repository.ErrEmailSuppressionNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "Email suppression not found")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to clear email suppression")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to clear email suppression")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email suppression cleared successfully"})
+}
+
+// StartPhoneVerification handles POST /v1/notifications/phone
+func (h *RestHandlers) StartPhoneVerification(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	var req struct {
+		PhoneNumber string `json:"phone_number"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err := h.phoneSvc.StartVerification(c.Request.Context(), userID, req.PhoneNumber)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidPhoneNumber):
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrPhoneVerificationRequestedNow):
+			apierror.Abort(c, http.StatusTooManyRequests, err.Error())
+		default:
+			h.logger.WithError(err).Error("Failed to start phone verification")
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to send verification code")
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Verification code sent",
+		"expires_in": int(h.phoneSvc.CodeTTL().Seconds()),
+	})
+}
+
+// ConfirmPhoneVerification handles POST /v1/notifications/phone/verify
+func (h *RestHandlers) ConfirmPhoneVerification(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	phoneNumber, err := h.phoneSvc.ConfirmVerification(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPhoneVerificationInvalid):
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrPhoneVerificationNotFound), errors.Is(err, services.ErrPhoneVerificationExhausted):
+			apierror.Abort(c, http.StatusGone, err.Error())
+		default:
+			h.logger.WithError(err).Error("Failed to confirm phone verification")
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to verify phone number")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Phone number verified successfully",
+		"phone_number":   phoneNumber,
+		"phone_verified": true,
+	})
+}
+
+// RemovePhoneNumber handles DELETE /v1/notifications/phone
+func (h *RestHandlers) RemovePhoneNumber(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	if err := h.preferenceSvc.RemovePhoneNumber(c.Request.Context(), userID); err != nil {
+		h.logger.WithError(err).Error("Failed to remove phone number")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to remove phone number")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Phone number removed successfully"})
+}
+
+// ListWebhookEndpoints handles GET /v1/notifications/webhooks
+func (h *RestHandlers) ListWebhookEndpoints(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	endpoints, err := h.webhookSvc.ListEndpoints(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list webhook endpoints")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to list webhook endpoints")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"endpoints": endpoints})
+}
+
+// CreateWebhookEndpoint handles POST /v1/notifications/webhooks. The signing secret is
+// only returned here and when it is rotated.
+func (h *RestHandlers) CreateWebhookEndpoint(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	var req struct {
+		URL         string `json:"url" binding:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	endpoint, err := h.webhookSvc.CreateEndpoint(c.Request.Context(), userID, req.URL, req.Description)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidWebhookEndpoint):
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrTooManyWebhookEndpoints):
+			apierror.Abort(c, http.StatusConflict, err.Error())
+		default:
+			h.logger.WithError(err).Error("Failed to create webhook endpoint")
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to create webhook endpoint")
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"endpoint": endpoint,
+		"secret":   endpoint.Secret,
+	})
+}
+
+// DeleteWebhookEndpoint handles DELETE /v1/notifications/webhooks/:id
+func (h *RestHandlers) DeleteWebhookEndpoint(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	err := h.webhookSvc.DeleteEndpoint(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrWebhookEndpointNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "Webhook endpoint not found")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to delete webhook endpoint")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to delete webhook endpoint")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook endpoint deleted successfully"})
+}
+
+// RotateWebhookSecret handles POST /v1/notifications/webhooks/:id/rotate-secret
+func (h *RestHandlers) RotateWebhookSecret(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	secret, err := h.webhookSvc.RotateSecret(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrWebhookEndpointNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "Webhook endpoint not found")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to rotate webhook secret")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to rotate webhook secret")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret})
+}
+
+// ListWebhookDeliveries handles GET /v1/notifications/webhooks/:id/deliveries
+func (h *RestHandlers) ListWebhookDeliveries(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	deliveries, err := h.webhookSvc.ListDeliveries(c.Request.Context(), userID, c.Param("id"), limit)
+	if err != nil {
+		if errors.Is(err, repository.ErrWebhookEndpointNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "Webhook endpoint not found")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to list webhook deliveries")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to list webhook deliveries")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// SMSStatusCallback handles POST /webhooks/sms/status, the delivery status callbacks
+// of the SMS provider
+func (h *RestHandlers) SMSStatusCallback(c *gin.Context) {
+	if h.smsCallbacks == nil {
+		apierror.Abort(c, http.StatusNotFound, "SMS status callbacks are not enabled")
+		return
+	}
+
+	update, err := h.smsCallbacks.ParseStatusCallback(c.Request)
+	if err != nil {
+		h.logger.WithError(err).Warn("Rejected SMS status callback")
+		apierror.Abort(c, http.StatusForbidden, "Invalid status callback")
+		return
+	}
+
+	err = h.notifSvc.UpdateDeliveryStatus(c.Request.Context(), models.ChannelSMS, update.MessageID, update.Status, update.ErrorReason)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to apply SMS status callback")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to update delivery status")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// EmailFeedbackWebhook handles POST /webhooks/email/:provider, the bounce and complaint
+// events of email providers. Addresses that bounced permanently or whose recipients
+// complained are suppressed, and bounced notifications are marked failed.
+func (h *RestHandlers) EmailFeedbackWebhook(c *gin.Context) {
+	provider := c.Param("provider")
+	parser, ok := h.emailFeedback[provider]
+	if !ok {
+		apierror.Abort(c, http.StatusNotFound, "Email feedback webhook is not enabled")
+		return
+	}
+
+	feedback, err := parser.ParseFeedback(c.Request.Context(), c.Request)
+	if err != nil {
+		h.logger.WithError(err).WithField("provider", provider).Warn("Rejected email feedback webhook")
+		apierror.Abort(c, http.StatusForbidden, "Invalid email feedback")
+		return
+	}
+
+	for _, fb := range feedback {
+		err := h.preferenceSvc.SuppressEmail(c.Request.Context(), fb.UserID, models.EmailSuppression{
+			Address:  fb.Address,
+			Reason:   fb.Reason,
+			Provider: provider,
+			Detail:   fb.Detail,
+		})
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to apply email feedback")
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to suppress email address")
+			return
+		}
+
+		if fb.Reason != models.EmailSuppressionBounce || fb.MessageID == "" {
+			continue
+		}
+		reason := "email bounced"
+		if fb.Detail != "" {
+			reason += ": " + fb.Detail
+		}
+		err = h.notifSvc.UpdateDeliveryStatus(c.Request.Context(), models.ChannelEmail, fb.MessageID, models.StatusFailed, reason)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to mark bounced email failed")
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to update delivery status")
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Unsubscribe handles POST /v1/unsubscribe, the link of the List-Unsubscribe header of
+// emails that mail clients post to for one-click unsubscribes (RFC 8058). It turns off
+// email notifications of the recipient.
+func (h *RestHandlers) Unsubscribe(c *gin.Context) {
+	userID, ok := h.unsubscribeUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.preferenceSvc.UnsubscribeFromEmail(c.Request.Context(), userID); err != nil {
+		h.logger.WithError(err).Error("Failed to unsubscribe from email")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to unsubscribe")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed from email notifications"})
+}
+
+// GetPreferenceCenter handles GET /v1/preference-center, the preferences shown by the
+// preference center linked in emails
+func (h *RestHandlers) GetPreferenceCenter(c *gin.Context) {
+	userID, ok := h.unsubscribeUser(c)
+	if !ok {
+		return
+	}
+
+	center, err := h.preferenceSvc.GetPreferenceCenter(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get preference center")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, center)
+}
+
+// UpdatePreferenceCenter handles PUT /v1/preference-center
+func (h *RestHandlers) UpdatePreferenceCenter(c *gin.Context) {
+	userID, ok := h.unsubscribeUser(c)
+	if !ok {
+		return
+	}
+
+	var update models.PreferenceCenter
+	if err := c.ShouldBindJSON(&update); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	center, err := h.preferenceSvc.UpdatePreferenceCenter(c.Request.Context(), userID, &update)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPreferences) {
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.logger.WithError(err).Error("Failed to update preference center")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to update preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, center)
+}
+
+// unsubscribeUser authenticates the recipient of an email by the token of its unsubscribe
+// link, passed as the token query parameter or form field. It writes an error response
+// and returns false if the token is invalid.
+func (h *RestHandlers) unsubscribeUser(c *gin.Context) (string, bool) {
+	if h.unsubscribes == nil {
+		apierror.Abort(c, http.StatusNotFound, "Unsubscribe links are not enabled")
+		return "", false
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		token = c.PostForm("token")
+	}
+	claims, err := h.unsubscribes.Validate(token)
+	if err != nil {
+		if errors.Is(err, unsubscribe.ErrExpiredToken) {
+			apierror.Abort(c, http.StatusUnauthorized, "Link has expired")
+			return "", false
+		}
+		apierror.Abort(c, http.StatusUnauthorized, "Invalid link")
+		return "", false
+	}
+
+	return claims.UserID, true
+}
+
 // SendTestNotification handles POST /v1/preferences/test
 func (h *RestHandlers) SendTestNotification(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
@@ -264,7 +805,7 @@ func (h *RestHandlers) SendTestNotification(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
@@ -283,7 +824,7 @@ func (h *RestHandlers) SendTestNotification(c *gin.Context) {
 	response, err := h.notifSvc.SendNotification(c.Request.Context(), testReq)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to send test notification")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send test notification"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to send test notification")
 		return
 	}
 
@@ -299,6 +840,7 @@ func (h *RestHandlers) GetTemplates(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	eventType := c.Query("event_type")
 	channel := c.Query("channel")
+	locale := c.Query("locale")
 
 	// Parse filters
 	var eventTypeFilter *models.EventType
@@ -313,10 +855,19 @@ func (h *RestHandlers) GetTemplates(c *gin.Context) {
 		channelFilter = &ch
 	}
 
-	templates, total, err := h.templateSvc.GetTemplates(c.Request.Context(), page, limit, eventTypeFilter, channelFilter)
+	var localeFilter *string
+	if locale != "" {
+		localeFilter = &locale
+	}
+
+	templates, total, err := h.templateSvc.GetTemplates(c.Request.Context(), page, limit, eventTypeFilter, channelFilter, localeFilter)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidLocale) {
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		h.logger.WithError(err).Error("Failed to get templates")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get templates"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get templates")
 		return
 	}
 
@@ -335,14 +886,18 @@ func (h *RestHandlers) GetTemplates(c *gin.Context) {
 func (h *RestHandlers) CreateTemplate(c *gin.Context) {
 	var template models.NotificationTemplate
 	if err := c.ShouldBindJSON(&template); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	err := h.templateSvc.CreateTemplate(c.Request.Context(), &template)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidLocale) || errors.Is(err, services.ErrInvalidEmailTemplate) {
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		h.logger.WithError(err).Error("Failed to create template")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create template"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to create template")
 		return
 	}
 
@@ -355,18 +910,22 @@ func (h *RestHandlers) UpdateTemplate(c *gin.Context) {
 
 	var template models.NotificationTemplate
 	if err := c.ShouldBindJSON(&template); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	err := h.templateSvc.UpdateTemplate(c.Request.Context(), templateID, &template)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidEmailTemplate) {
+			apierror.Abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		if err.Error() == "template not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			apierror.Abort(c, http.StatusNotFound, "Template not found")
 			return
 		}
 		h.logger.WithError(err).Error("Failed to update template")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to update template")
 		return
 	}
 
@@ -380,22 +939,54 @@ func (h *RestHandlers) DeleteTemplate(c *gin.Context) {
 	err := h.templateSvc.DeleteTemplate(c.Request.Context(), templateID)
 	if err != nil {
 		if err.Error() == "template not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			apierror.Abort(c, http.StatusNotFound, "Template not found")
 			return
 		}
 		h.logger.WithError(err).Error("Failed to delete template")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to delete template")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
 }
 
+// PreviewTemplate handles POST /v1/templates/:id/preview
+func (h *RestHandlers) PreviewTemplate(c *gin.Context) {
+	templateID := c.Param("id")
+
+	var req struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	preview, err := h.templateSvc.PreviewTemplate(c.Request.Context(), templateID, req.Data)
+	if err != nil {
+		if errors.Is(err, repository.ErrTemplateNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "Template not found")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to preview template")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to preview template")
+		return
+	}
+
+	status := http.StatusOK
+	if !preview.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, preview)
+}
+
 // GetBatchNotifications handles GET /v1/batch
 func (h *RestHandlers) GetBatchNotifications(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
@@ -412,7 +1003,7 @@ func (h *RestHandlers) GetBatchNotifications(c *gin.Context) {
 	batches, total, err := h.batchSvc.GetBatchNotifications(c.Request.Context(), userID, page, limit, statusFilter)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get batch notifications")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get batch notifications"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get batch notifications")
 		return
 	}
 
@@ -442,7 +1033,7 @@ func (h *RestHandlers) GetDLQEntries(c *gin.Context) {
 	entries, total, err := h.dlqSvc.GetDLQEntries(c.Request.Context(), page, limit, processedFilter)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get DLQ entries")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get DLQ entries"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get DLQ entries")
 		return
 	}
 
@@ -464,11 +1055,11 @@ func (h *RestHandlers) RetryDLQEntry(c *gin.Context) {
 	err := h.dlqSvc.RetryDLQEntry(c.Request.Context(), dlqID)
 	if err != nil {
 		if err.Error() == "DLQ entry not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "DLQ entry not found"})
+			apierror.Abort(c, http.StatusNotFound, "DLQ entry not found")
 			return
 		}
 		h.logger.WithError(err).Error("Failed to retry DLQ entry")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry DLQ entry"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to retry DLQ entry")
 		return
 	}
 
@@ -482,22 +1073,421 @@ func (h *RestHandlers) DeleteDLQEntry(c *gin.Context) {
 	err := h.dlqSvc.DeleteDLQEntry(c.Request.Context(), dlqID)
 	if err != nil {
 		if err.Error() == "DLQ entry not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "DLQ entry not found"})
+			apierror.Abort(c, http.StatusNotFound, "DLQ entry not found")
 			return
 		}
 		h.logger.WithError(err).Error("Failed to delete DLQ entry")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete DLQ entry"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to delete DLQ entry")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "DLQ entry deleted successfully"})
 }
 
+// BulkRetryDLQEntries handles POST /v1/dlq/retry
+func (h *RestHandlers) BulkRetryDLQEntries(c *gin.Context) {
+	filter, err := parseDLQFilter(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.dlqSvc.BulkRetry(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptyDLQFilter) {
+			apierror.Abort(c, http.StatusBadRequest, "At least one of event_type, failure_reason, from or to is required")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to bulk retry DLQ entries")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to retry DLQ entries")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RetryTransientDLQEntries handles POST /v1/dlq/retry-transient
+func (h *RestHandlers) RetryTransientDLQEntries(c *gin.Context) {
+	result, err := h.dlqSvc.RetryTransientFailures(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to retry transient DLQ entries")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to retry DLQ entries")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// BulkDeleteDLQEntries handles DELETE /v1/dlq
+func (h *RestHandlers) BulkDeleteDLQEntries(c *gin.Context) {
+	filter, err := parseDLQFilter(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	count, err := h.dlqSvc.BulkDelete(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptyDLQFilter) {
+			apierror.Abort(c, http.StatusBadRequest, "At least one of event_type, failure_reason, from, to or processed is required")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to bulk delete DLQ entries")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to delete DLQ entries")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": count})
+}
+
+// GetDLQSummary handles GET /v1/dlq/summary
+func (h *RestHandlers) GetDLQSummary(c *gin.Context) {
+	filter, err := parseDLQFilter(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	summary, err := h.dlqSvc.GetFailureSummary(c.Request.Context(), filter)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get DLQ summary")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get DLQ summary")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"failure_reasons": summary})
+}
+
+// maxNotificationSearchLength bounds the search query parameter of GET /v1/notifications
+const maxNotificationSearchLength = 200
+
+// parseNotificationFilter reads a notification filter from the status, event_type,
+// priority, channel, q, from and to query parameters. q searches titles and messages;
+// from and to are RFC 3339 timestamps.
+func parseNotificationFilter(c *gin.Context) (repository.NotificationFilter, error) {
+	filter := repository.NotificationFilter{
+		Status:    models.NotificationStatus(c.Query("status")),
+		EventType: models.EventType(c.Query("event_type")),
+		Priority:  models.Priority(c.Query("priority")),
+		Channel:   models.NotificationChannel(c.Query("channel")),
+		Search:    strings.TrimSpace(c.Query("q")),
+	}
+	if len(filter.Search) > maxNotificationSearchLength {
+		return filter, fmt.Errorf("q must be at most %d characters", maxNotificationSearchLength)
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		return filter, err
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return filter, errors.New("to must not be before from")
+	}
+
+	return filter, nil
+}
+
+// parseDLQFilter reads a DLQ filter from the event_type, failure_reason, from, to and
+// processed query parameters. from and to are RFC 3339 timestamps.
+func parseDLQFilter(c *gin.Context) (repository.DLQFilter, error) {
+	filter := repository.DLQFilter{
+		EventType:     models.EventType(c.Query("event_type")),
+		FailureReason: c.Query("failure_reason"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		return filter, err
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return filter, errors.New("to must not be before from")
+	}
+
+	if processed := c.Query("processed"); processed != "" {
+		p := processed == "true"
+		filter.Processed = &p
+	}
+
+	return filter, nil
+}
+
+// parseTimeQuery reads an optional RFC 3339 timestamp query parameter
+func parseTimeQuery(c *gin.Context, param string) (*time.Time, error) {
+	raw := c.Query(param)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+	}
+	return &t, nil
+}
+
+// ScheduleNotification handles POST /v1/scheduled
+func (h *RestHandlers) ScheduleNotification(c *gin.Context) {
+	var req struct {
+		models.NotificationRequest
+		SendAt time.Time `json:"send_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	scheduled, err := h.scheduleSvc.ScheduleNotification(c.Request.Context(), &req.NotificationRequest, req.SendAt)
+	if err != nil {
+		h.handleScheduleError(c, err, "Failed to schedule notification")
+		return
+	}
+
+	c.JSON(http.StatusCreated, scheduled)
+}
+
+// GetScheduledNotifications handles GET /v1/scheduled
+func (h *RestHandlers) GetScheduledNotifications(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	status := models.ScheduledNotificationStatus(c.Query("status"))
+
+	scheduled, total, err := h.scheduleSvc.GetScheduledNotifications(c.Request.Context(), c.Query("user_id"), status, page, limit)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get scheduled notifications")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get scheduled notifications")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scheduled_notifications": scheduled,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetScheduledNotification handles GET /v1/scheduled/:id
+func (h *RestHandlers) GetScheduledNotification(c *gin.Context) {
+	scheduled, err := h.scheduleSvc.GetScheduledNotification(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.handleScheduleError(c, err, "Failed to get scheduled notification")
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+// RescheduleNotification handles PUT /v1/scheduled/:id
+func (h *RestHandlers) RescheduleNotification(c *gin.Context) {
+	var req struct {
+		SendAt time.Time `json:"send_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	scheduled, err := h.scheduleSvc.RescheduleNotification(c.Request.Context(), c.Param("id"), req.SendAt)
+	if err != nil {
+		h.handleScheduleError(c, err, "Failed to reschedule notification")
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+// CancelScheduledNotification handles DELETE /v1/scheduled/:id
+func (h *RestHandlers) CancelScheduledNotification(c *gin.Context) {
+	scheduled, err := h.scheduleSvc.CancelScheduledNotification(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.handleScheduleError(c, err, "Failed to cancel scheduled notification")
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+// handleScheduleError responds with the status matching a schedule service error
+func (h *RestHandlers) handleScheduleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSchedule):
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrScheduledNotificationNotFound):
+		apierror.Abort(c, http.StatusNotFound, "Scheduled notification not found")
+	case errors.Is(err, repository.ErrScheduledNotificationNotPending):
+		apierror.Abort(c, http.StatusConflict, "Scheduled notification was already sent or cancelled")
+	default:
+		h.logger.WithError(err).Error(message)
+		apierror.Abort(c, http.StatusInternalServerError, message)
+	}
+}
+
+// CreateAnnouncement handles POST /v1/announcements
+func (h *RestHandlers) CreateAnnouncement(c *gin.Context) {
+	var req struct {
+		Title             string                      `json:"title"`
+		Message           string                      `json:"message"`
+		Priority          models.Priority             `json:"priority"`
+		Audience          models.AnnouncementAudience `json:"audience"`
+		SendEmail         bool                        `json:"send_email"`
+		EmailDelaySeconds int64                       `json:"email_delay_seconds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	announcement := &models.Announcement{
+		Title:             req.Title,
+		Message:           req.Message,
+		Priority:          req.Priority,
+		Audience:          req.Audience,
+		SendEmail:         req.SendEmail,
+		EmailDelaySeconds: req.EmailDelaySeconds,
+		CreatedBy:         c.GetString(actorKey),
+	}
+	if err := h.announceSvc.CreateAnnouncement(c.Request.Context(), announcement); err != nil {
+		h.handleAnnouncementError(c, err, "Failed to create announcement")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, announcement)
+}
+
+// GetAnnouncements handles GET /v1/announcements
+func (h *RestHandlers) GetAnnouncements(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	announcements, total, err := h.announceSvc.GetAnnouncements(c.Request.Context(), page, limit)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get announcements")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get announcements")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"announcements": announcements,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetAnnouncement handles GET /v1/announcements/:id
+func (h *RestHandlers) GetAnnouncement(c *gin.Context) {
+	announcement, err := h.announceSvc.GetAnnouncement(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.handleAnnouncementError(c, err, "Failed to get announcement")
+		return
+	}
+
+	c.JSON(http.StatusOK, announcement)
+}
+
+// CancelAnnouncement handles POST /v1/announcements/:id/cancel
+func (h *RestHandlers) CancelAnnouncement(c *gin.Context) {
+	announcement, err := h.announceSvc.CancelAnnouncement(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.handleAnnouncementError(c, err, "Failed to cancel announcement")
+		return
+	}
+
+	c.JSON(http.StatusOK, announcement)
+}
+
+// handleAnnouncementError responds with the status matching an announcement service error
+func (h *RestHandlers) handleAnnouncementError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidAnnouncement):
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrAnnouncementNotFound):
+		apierror.Abort(c, http.StatusNotFound, "Announcement not found")
+	case errors.Is(err, repository.ErrAnnouncementFinished):
+		apierror.Abort(c, http.StatusConflict, "Announcement already finished")
+	default:
+		h.logger.WithError(err).Error(message)
+		apierror.Abort(c, http.StatusInternalServerError, message)
+	}
+}
+
+// maxAnalyticsBuckets bounds the number of buckets a delivery analytics range spans
+const maxAnalyticsBuckets = 1000
+
+// GetDeliveryAnalytics handles GET /v1/analytics/delivery
+func (h *RestHandlers) GetDeliveryAnalytics(c *gin.Context) {
+	from, err := parseTimeQuery(c, "from")
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := parseTimeQuery(c, "to")
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if to == nil {
+		now := time.Now().UTC()
+		to = &now
+	}
+	if from == nil {
+		weekAgo := to.AddDate(0, 0, -7)
+		from = &weekAgo
+	}
+	if to.Before(*from) {
+		apierror.Abort(c, http.StatusBadRequest, "to must not be before from")
+		return
+	}
+
+	interval := models.AnalyticsInterval(c.DefaultQuery("interval", string(models.AnalyticsIntervalDay)))
+	if interval.Duration() == 0 {
+		apierror.Abort(c, http.StatusBadRequest, "interval must be hour, day or week")
+		return
+	}
+	if to.Sub(*from)/interval.Duration() > maxAnalyticsBuckets {
+		apierror.Abort(c, http.StatusBadRequest, fmt.Sprintf("Range spans more than %d buckets, use a longer interval", maxAnalyticsBuckets))
+		return
+	}
+
+	analytics, err := h.notifSvc.GetDeliveryAnalytics(c.Request.Context(), *from, *to, interval,
+		models.NotificationChannel(c.Query("channel")), models.EventType(c.Query("event_type")))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get delivery analytics")
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get delivery analytics")
+		return
+	}
+
+	c.JSON(http.StatusOK, analytics)
+}
+
 // GetStats handles GET /v1/stats
 func (h *RestHandlers) GetStats(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
+		apierror.Abort(c, http.StatusBadRequest, "X-User-ID header is required")
 		return
 	}
 
@@ -507,13 +1497,13 @@ func (h *RestHandlers) GetStats(c *gin.Context) {
 
 	startDate, err := time.Parse("2006-01-02", startDateStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format"})
+		apierror.Abort(c, http.StatusBadRequest, "Invalid start_date format")
 		return
 	}
 
 	endDate, err := time.Parse("2006-01-02", endDateStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format"})
+		apierror.Abort(c, http.StatusBadRequest, "Invalid end_date format")
 		return
 	}
 
@@ -521,7 +1511,7 @@ func (h *RestHandlers) GetStats(c *gin.Context) {
 	notifStats, err := h.notifSvc.GetNotificationStats(c.Request.Context(), userID, startDate, endDate)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get notification stats")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notification stats"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get notification stats")
 		return
 	}
 
@@ -529,7 +1519,7 @@ func (h *RestHandlers) GetStats(c *gin.Context) {
 	batchStats, err := h.batchSvc.GetBatchStats(c.Request.Context(), userID, startDate, endDate)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get batch stats")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get batch stats"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get batch stats")
 		return
 	}
 
@@ -537,7 +1527,7 @@ func (h *RestHandlers) GetStats(c *gin.Context) {
 	dlqStats, err := h.dlqSvc.GetDLQStats(c.Request.Context())
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get DLQ stats")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get DLQ stats"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get DLQ stats")
 		return
 	}
 
@@ -568,6 +1558,17 @@ func (h *RestHandlers) SetupRoutes(r *gin.Engine) {
 			notifications.PUT("/read-all", h.MarkAllAsRead)
 			notifications.DELETE("/:id", h.DeleteNotification)
 			notifications.GET("/unread/count", h.GetUnreadCount)
+			notifications.GET("/devices", h.ListPushDevices)
+			notifications.POST("/devices", h.RegisterPushDevice)
+			notifications.DELETE("/devices/:token", h.UnregisterPushDevice)
+			notifications.POST("/phone", h.StartPhoneVerification)
+			notifications.POST("/phone/verify", h.ConfirmPhoneVerification)
+			notifications.DELETE("/phone", h.RemovePhoneNumber)
+			notifications.GET("/webhooks", h.ListWebhookEndpoints)
+			notifications.POST("/webhooks", h.CreateWebhookEndpoint)
+			notifications.DELETE("/webhooks/:id", h.DeleteWebhookEndpoint)
+			notifications.POST("/webhooks/:id/rotate-secret", h.RotateWebhookSecret)
+			notifications.GET("/webhooks/:id/deliveries", h.ListWebhookDeliveries)
 		}
 
 		// User preferences
@@ -576,6 +1577,7 @@ func (h *RestHandlers) SetupRoutes(r *gin.Engine) {
 			preferences.GET("", h.GetUserPreferences)
 			preferences.PUT("", h.UpdateUserPreferences)
 			preferences.POST("/test", h.SendTestNotification)
+			preferences.DELETE("/email-suppressions/:address", h.ClearEmailSuppression)
 		}
 
 		// Templates
@@ -585,6 +1587,7 @@ func (h *RestHandlers) SetupRoutes(r *gin.Engine) {
 			templates.POST("", h.CreateTemplate)
 			templates.PUT("/:id", h.UpdateTemplate)
 			templates.DELETE("/:id", h.DeleteTemplate)
+			templates.POST("/:id/preview", h.PreviewTemplate)
 		}
 
 		// Batch notifications
@@ -593,15 +1596,55 @@ func (h *RestHandlers) SetupRoutes(r *gin.Engine) {
 			batches.GET("", h.GetBatchNotifications)
 		}
 
-		// Dead Letter Queue
-		dlq := v1.Group("/dlq")
+		// Dead Letter Queue, for administrators and services
+		dlq := v1.Group("/dlq", h.authorizeAdmin)
 		{
 			dlq.GET("", h.GetDLQEntries)
+			dlq.DELETE("", h.BulkDeleteDLQEntries)
+			dlq.GET("/summary", h.GetDLQSummary)
+			dlq.POST("/retry", h.BulkRetryDLQEntries)
+			dlq.POST("/retry-transient", h.RetryTransientDLQEntries)
 			dlq.POST("/:id/retry", h.RetryDLQEntry)
 			dlq.DELETE("/:id", h.DeleteDLQEntry)
 		}
 
+		// Scheduled notifications, for administrators and services
+		scheduled := v1.Group("/scheduled", h.authorizeAdmin)
+		{
+			scheduled.GET("", h.GetScheduledNotifications)
+			scheduled.POST("", h.ScheduleNotification)
+			scheduled.GET("/:id", h.GetScheduledNotification)
+			scheduled.PUT("/:id", h.RescheduleNotification)
+			scheduled.DELETE("/:id", h.CancelScheduledNotification)
+		}
+
+		// Announcements, for administrators and services
+		announcements := v1.Group("/announcements", h.authorizeAdmin)
+		{
+			announcements.GET("", h.GetAnnouncements)
+			announcements.POST("", h.CreateAnnouncement)
+			announcements.GET("/:id", h.GetAnnouncement)
+			announcements.POST("/:id/cancel", h.CancelAnnouncement)
+		}
+
 		// Statistics
 		v1.GET("/stats", h.GetStats)
 	}
+
+	// Admin analytics, for operators
+	if h.analyticsToken != "" {
+		r.GET("/api/v1/analytics/delivery", ginmw.BearerToken(h.analyticsToken), h.GetDeliveryAnalytics)
+	}
+
+	// Links in emails, authenticated by the tokens they hold instead of the user's session
+	public := r.Group("/api/v1")
+	{
+		public.POST("/unsubscribe", h.Unsubscribe)
+		public.GET("/preference-center", h.GetPreferenceCenter)
+		public.PUT("/preference-center", h.UpdatePreferenceCenter)
+	}
+
+	// Provider webhooks, authenticated by the provider's request signatures
+	r.POST("/webhooks/sms/status", h.SMSStatusCallback)
+	r.POST("/webhooks/email/:provider", h.EmailFeedbackWebhook)
 }
@@ -0,0 +1,464 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// announcementPageSize is the number of recipients processed between progress saves
+	announcementPageSize = 100
+	// announcementWorkers is the number of recipients of a page processed concurrently
+	announcementWorkers = 10
+	// announcementClaimTimeout bounds how long an announcement claimed by a replica that
+	// stopped while sending it stays blocked
+	announcementClaimTimeout = 5 * time.Minute
+	// maxAnnouncementEmailDelay is the longest wait before emailing unread announcements
+	maxAnnouncementEmailDelay    = 7 * 24 * time.Hour
+	maxAnnouncementTitleLength   = 200
+	maxAnnouncementMessageLength = 5000
+)
+
+var ErrInvalidAnnouncement = errors.New("invalid announcement")
+
+// UserLister lists the IDs of all users or of an organization's members
+type UserLister interface {
+	ListUserIDs(ctx context.Context, orgID, after string, limit int) ([]string, error)
+}
+
+// SubscriberLister lists the IDs of the users subscribed to a billing plan
+type SubscriberLister interface {
+	ListSubscriberIDs(ctx context.Context, planID, after string, limit int) ([]string, error)
+}
+
+// AnnouncementService sends announcements to all users or a segment of them. Delivery
+// runs in the background and records its progress, so it resumes on any replica after
+// a restart.
+type AnnouncementService struct {
+	announcementRepo *repository.AnnouncementRepository
+	notifRepo        *repository.NotificationRepository
+	notifSvc         *NotificationService
+	users            UserLister
+	subscribers      SubscriberLister
+	pollInterval     time.Duration
+	logger           *logrus.Logger
+}
+
+// NewAnnouncementService creates a new announcement service that checks for
+// announcements to send every pollInterval
+func NewAnnouncementService(
+	announcementRepo *repository.AnnouncementRepository,
+	notifRepo *repository.NotificationRepository,
+	notifSvc *NotificationService,
+	users UserLister,
+	pollInterval time.Duration,
+	logger *logrus.Logger,
+) *AnnouncementService {
+	return &AnnouncementService{
+		announcementRepo: announcementRepo,
+		notifRepo:        notifRepo,
+		notifSvc:         notifSvc,
+		users:            users,
+		pollInterval:     pollInterval,
+		logger:           logger,
+	}
+}
+
+// SetSubscriberLister enables announcements to the subscribers of a billing plan
+func (s *AnnouncementService) SetSubscriberLister(subscribers SubscriberLister) {
+	s.subscribers = subscribers
+}
+
+// CreateAnnouncement validates an announcement and queues it for delivery
+func (s *AnnouncementService) CreateAnnouncement(ctx context.Context, announcement *models.Announcement) error {
+	if err := s.validateAnnouncement(announcement); err != nil {
+		return err
+	}
+
+	if err := s.announcementRepo.Create(ctx, announcement); err != nil {
+		return fmt.Errorf("failed to create announcement: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"announcement_id": announcement.ID.Hex(),
+		"audience":        announcement.Audience.Type,
+		"audience_id":     announcement.Audience.ID,
+		"created_by":      announcement.CreatedBy,
+	}).Info("Announcement created")
+
+	return nil
+}
+
+// GetAnnouncement gets an announcement with its delivery progress
+func (s *AnnouncementService) GetAnnouncement(ctx context.Context, id string) (*models.Announcement, error) {
+	return s.announcementRepo.GetByID(ctx, id)
+}
+
+// GetAnnouncements gets announcements, newest first, with pagination
+func (s *AnnouncementService) GetAnnouncements(ctx context.Context, page, limit int) ([]*models.Announcement, int64, error) {
+	return s.announcementRepo.List(ctx, page, limit)
+}
+
+// CancelAnnouncement stops the delivery of an announcement. Recipients who already
+// received it keep their notification.
+func (s *AnnouncementService) CancelAnnouncement(ctx context.Context, id string) (*models.Announcement, error) {
+	announcement, err := s.announcementRepo.Cancel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("announcement_id", id).Info("Announcement cancelled")
+	return announcement, nil
+}
+
+// validateAnnouncement checks an announcement and fills in its defaults
+func (s *AnnouncementService) validateAnnouncement(announcement *models.Announcement) error {
+	announcement.Title = strings.TrimSpace(announcement.Title)
+	announcement.Message = strings.TrimSpace(announcement.Message)
+
+	if announcement.Title == "" || len(announcement.Title) > maxAnnouncementTitleLength {
+		return fmt.Errorf("%w: title must be 1 to %d characters", ErrInvalidAnnouncement, maxAnnouncementTitleLength)
+	}
+	if announcement.Message == "" || len(announcement.Message) > maxAnnouncementMessageLength {
+		return fmt.Errorf("%w: message must be 1 to %d characters", ErrInvalidAnnouncement, maxAnnouncementMessageLength)
+	}
+
+	switch announcement.Priority {
+	case "":
+		announcement.Priority = models.PriorityNormal
+	case models.PriorityLow, models.PriorityNormal, models.PriorityHigh, models.PriorityCritical:
+	default:
+		return fmt.Errorf("%w: unknown priority %q", ErrInvalidAnnouncement, announcement.Priority)
+	}
+
+	switch announcement.Audience.Type {
+	case models.AudienceAll:
+		announcement.Audience.ID = ""
+	case models.AudiencePlan, models.AudienceOrg:
+		if announcement.Audience.Type == models.AudiencePlan && s.subscribers == nil {
+			return fmt.Errorf("%w: plan audiences are not available", ErrInvalidAnnouncement)
+		}
+		if _, err := primitive.ObjectIDFromHex(announcement.Audience.ID); err != nil {
+			return fmt.Errorf("%w: audience id must be a valid %s ID", ErrInvalidAnnouncement, announcement.Audience.Type)
+		}
+	default:
+		return fmt.Errorf("%w: audience type must be %s, %s or %s", ErrInvalidAnnouncement, models.AudienceAll, models.AudiencePlan, models.AudienceOrg)
+	}
+
+	if announcement.EmailDelaySeconds < 0 || time.Duration(announcement.EmailDelaySeconds)*time.Second > maxAnnouncementEmailDelay {
+		return fmt.Errorf("%w: email_delay_seconds must be between 0 and %d", ErrInvalidAnnouncement, int64(maxAnnouncementEmailDelay.Seconds()))
+	}
+
+	return nil
+}
+
+// StartProcessor delivers announcements until ctx is done
+func (s *AnnouncementService) StartProcessor(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("Announcement processor started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Announcement processor stopped")
+			return
+		case <-ticker.C:
+			s.processReady(ctx)
+		}
+	}
+}
+
+// processReady runs the announcement phases that are ready
+func (s *AnnouncementService) processReady(ctx context.Context) {
+	for ctx.Err() == nil {
+		now := time.Now()
+		announcement, err := s.announcementRepo.ClaimNext(ctx, now, now.Add(-announcementClaimTimeout))
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to claim announcement")
+			return
+		}
+		if announcement == nil {
+			return
+		}
+
+		switch announcement.Phase {
+		case models.AnnouncementPhaseEmail:
+			s.runEmailPhase(ctx, announcement)
+		default:
+			s.runInAppPhase(ctx, announcement)
+		}
+	}
+}
+
+// runInAppPhase sends the in-app notification to every recipient who does not have it
+// yet and pushes it to their open connections
+func (s *AnnouncementService) runInAppPhase(ctx context.Context, announcement *models.Announcement) {
+	logger := s.logger.WithField("announcement_id", announcement.ID.Hex())
+	cursor := announcement.Cursor
+
+	for ctx.Err() == nil {
+		userIDs, err := s.listAudience(ctx, announcement.Audience, cursor)
+		if err != nil {
+			logger.WithError(err).Error("Failed to list announcement audience")
+			s.finish(ctx, announcement, models.AnnouncementStatusFailed, err.Error())
+			return
+		}
+		if len(userIDs) == 0 {
+			break
+		}
+
+		progress := s.forEach(userIDs, func(userID string, progress *models.AnnouncementProgress) {
+			s.deliverInApp(ctx, announcement, userID, progress)
+		})
+		cursor = userIDs[len(userIDs)-1]
+
+		sending, err := s.announcementRepo.SaveProgress(ctx, announcement.ID, cursor, progress)
+		if err != nil {
+			logger.WithError(err).Error("Failed to save announcement progress")
+			return
+		}
+		if !sending {
+			logger.Info("Announcement stopped, no longer being sent")
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	if !announcement.SendEmail {
+		s.finish(ctx, announcement, models.AnnouncementStatusCompleted, "")
+		return
+	}
+
+	runAt := time.Now().Add(time.Duration(announcement.EmailDelaySeconds) * time.Second)
+	if _, err := s.announcementRepo.StartPhase(ctx, announcement.ID, models.AnnouncementPhaseEmail, runAt); err != nil {
+		logger.WithError(err).Error("Failed to start announcement email phase")
+		return
+	}
+	logger.WithField("run_at", runAt).Info("Announcement delivered in-app, emails scheduled")
+}
+
+// deliverInApp sends the in-app notification of an announcement to a user
+func (s *AnnouncementService) deliverInApp(ctx context.Context, announcement *models.Announcement, userID string, progress *models.AnnouncementProgress) {
+	progress.Processed++
+	announcementID := announcement.ID.Hex()
+
+	// A resumed page may include users who already received the announcement
+	exists, err := s.notifRepo.HasAnnouncement(ctx, userID, announcementID)
+	if err != nil {
+		progress.Failed++
+		return
+	}
+	if exists {
+		progress.Skipped++
+		return
+	}
+
+	resp, err := s.notifSvc.SendNotification(ctx, &models.NotificationRequest{
+		UserID:           userID,
+		EventType:        models.EventTypeAnnouncement,
+		Channel:          models.ChannelInApp,
+		Title:            announcement.Title,
+		Message:          announcement.Message,
+		Priority:         announcement.Priority,
+		Metadata:         map[string]interface{}{"announcement_id": announcementID},
+		BypassBatching:   true,
+		BypassQuietHours: true,
+	})
+	if err != nil {
+		progress.Failed++
+		return
+	}
+	if resp.ID == "" {
+		progress.Skipped++
+		return
+	}
+	progress.Delivered++
+
+	s.pushLive(ctx, announcement, userID, resp.ID)
+}
+
+// pushLive pushes an announcement to the open WebSocket connections of a user without
+// recording another notification
+func (s *AnnouncementService) pushLive(ctx context.Context, announcement *models.Announcement, userID, notificationID string) {
+	handler, exists := s.notifSvc.handlers[models.ChannelWebSocket]
+	if !exists || !handler.IsEnabled() {
+		return
+	}
+
+	_, _ = handler.Send(ctx, &models.NotificationRequest{
+		UserID:    userID,
+		EventType: models.EventTypeAnnouncement,
+		Channel:   models.ChannelWebSocket,
+		Title:     announcement.Title,
+		Message:   announcement.Message,
+		Priority:  announcement.Priority,
+		Metadata: map[string]interface{}{
+			"announcement_id": announcement.ID.Hex(),
+			"notification_id": notificationID,
+		},
+	})
+}
+
+// runEmailPhase emails the announcement to the recipients who have not read the in-app
+// notification
+func (s *AnnouncementService) runEmailPhase(ctx context.Context, announcement *models.Announcement) {
+	logger := s.logger.WithField("announcement_id", announcement.ID.Hex())
+
+	var after primitive.ObjectID
+	if announcement.Cursor != "" {
+		if id, err := primitive.ObjectIDFromHex(announcement.Cursor); err == nil {
+			after = id
+		}
+	}
+
+	for ctx.Err() == nil {
+		unread, err := s.notifRepo.GetUnreadAnnouncementNotifications(ctx, announcement.ID.Hex(), after, announcementPageSize)
+		if err != nil {
+			logger.WithError(err).Error("Failed to get unread announcement notifications")
+			return
+		}
+		if len(unread) == 0 {
+			break
+		}
+
+		userIDs := make([]string, len(unread))
+		for i, notification := range unread {
+			userIDs[i] = notification.UserID
+		}
+		progress := s.forEach(userIDs, func(userID string, progress *models.AnnouncementProgress) {
+			s.deliverEmail(ctx, announcement, userID, progress)
+		})
+		after = unread[len(unread)-1].ID
+
+		sending, err := s.announcementRepo.SaveProgress(ctx, announcement.ID, after.Hex(), progress)
+		if err != nil {
+			logger.WithError(err).Error("Failed to save announcement progress")
+			return
+		}
+		if !sending {
+			logger.Info("Announcement stopped, no longer being sent")
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Recipients who read the in-app notification before the emails went out
+	current, err := s.announcementRepo.GetByID(ctx, announcement.ID.Hex())
+	if err != nil {
+		logger.WithError(err).Error("Failed to get announcement progress")
+		return
+	}
+	emailed := current.Progress.EmailsSent + current.Progress.EmailsFailed
+	if suppressed := current.Progress.Delivered - emailed - current.Progress.EmailsSuppressed; suppressed > 0 {
+		if _, err := s.announcementRepo.SaveProgress(ctx, announcement.ID, after.Hex(), models.AnnouncementProgress{EmailsSuppressed: suppressed}); err != nil {
+			logger.WithError(err).Error("Failed to save announcement progress")
+			return
+		}
+	}
+
+	s.finish(ctx, announcement, models.AnnouncementStatusCompleted, "")
+}
+
+// deliverEmail emails an announcement to a user
+func (s *AnnouncementService) deliverEmail(ctx context.Context, announcement *models.Announcement, userID string, progress *models.AnnouncementProgress) {
+	resp, err := s.notifSvc.SendNotification(ctx, &models.NotificationRequest{
+		UserID:         userID,
+		EventType:      models.EventTypeAnnouncement,
+		Channel:        models.ChannelEmail,
+		Title:          announcement.Title,
+		Message:        announcement.Message,
+		Priority:       announcement.Priority,
+		Metadata:       map[string]interface{}{"announcement_id": announcement.ID.Hex()},
+		BypassBatching: true,
+	})
+	if err != nil || resp.Status == models.StatusFailed {
+		progress.EmailsFailed++
+		return
+	}
+	progress.EmailsSent++
+}
+
+// forEach runs deliver for every user of a page with announcementWorkers workers and
+// returns the progress they recorded
+func (s *AnnouncementService) forEach(userIDs []string, deliver func(userID string, progress *models.AnnouncementProgress)) models.AnnouncementProgress {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		total    models.AnnouncementProgress
+		userChan = make(chan string)
+	)
+
+	for i := 0; i < announcementWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var progress models.AnnouncementProgress
+			for userID := range userChan {
+				deliver(userID, &progress)
+			}
+
+			mu.Lock()
+			total.Processed += progress.Processed
+			total.Delivered += progress.Delivered
+			total.Skipped += progress.Skipped
+			total.Failed += progress.Failed
+			total.EmailsSent += progress.EmailsSent
+			total.EmailsFailed += progress.EmailsFailed
+			mu.Unlock()
+		}()
+	}
+
+	for _, userID := range userIDs {
+		userChan <- userID
+	}
+	close(userChan)
+	wg.Wait()
+
+	return total
+}
+
+// listAudience lists the next page of an audience's user IDs after the given user ID
+func (s *AnnouncementService) listAudience(ctx context.Context, audience models.AnnouncementAudience, after string) ([]string, error) {
+	switch audience.Type {
+	case models.AudienceAll:
+		return s.users.ListUserIDs(ctx, "", after, announcementPageSize)
+	case models.AudienceOrg:
+		return s.users.ListUserIDs(ctx, audience.ID, after, announcementPageSize)
+	case models.AudiencePlan:
+		if s.subscribers == nil {
+			return nil, errors.New("plan audiences are not available")
+		}
+		return s.subscribers.ListSubscriberIDs(ctx, audience.ID, after, announcementPageSize)
+	default:
+		return nil, fmt.Errorf("unknown audience type %q", audience.Type)
+	}
+}
+
+// finish records that an announcement completed or failed
+func (s *AnnouncementService) finish(ctx context.Context, announcement *models.Announcement, status models.AnnouncementStatus, reason string) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"announcement_id": announcement.ID.Hex(),
+		"status":          status,
+	})
+
+	if _, err := s.announcementRepo.Finish(ctx, announcement.ID, status, reason); err != nil {
+		logger.WithError(err).Error("Failed to finish announcement")
+		return
+	}
+	logger.Info("Announcement finished")
+}
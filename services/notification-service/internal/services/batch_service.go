@@ -8,21 +8,31 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/database"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 )
 
 // BatchService handles batch notification processing
 type BatchService struct {
-	redisClient   *redis.Client
+	redisClient   redis.UniversalClient
 	batchRepo     *repository.BatchRepository
 	notifRepo     *repository.NotificationRepository
 	preferenceSvc *PreferenceService
 	templateSvc   *TemplateService
+	sender        NotificationSender
 	config        *BatchConfig
+	metrics       *metrics.Metrics
 	logger        *logrus.Logger
 }
 
+// NotificationSender sends notifications through the channel handlers, recording them
+// and queueing failed ones for retry
+type NotificationSender interface {
+	SendNotification(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error)
+}
+
 // BatchConfig contains batch service configuration
 type BatchConfig struct {
 	WindowDuration time.Duration
@@ -52,7 +62,7 @@ type BatchKey struct {
 
 // NewBatchService creates a new batch service
 func NewBatchService(
-	redisClient *redis.Client,
+	redisClient redis.UniversalClient,
 	batchRepo *repository.BatchRepository,
 	notifRepo *repository.NotificationRepository,
 	preferenceSvc *PreferenceService,
@@ -71,6 +81,18 @@ func NewBatchService(
 	}
 }
 
+// SetSender sets the sender flushed batches and notifications bypassing batching are
+// delivered through. It is set after construction because the notification service
+// depends on the batch service.
+func (s *BatchService) SetSender(sender NotificationSender) {
+	s.sender = sender
+}
+
+// SetMetrics enables recording batching metrics
+func (s *BatchService) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
 // AddToBatch adds a notification to the batch
 func (s *BatchService) AddToBatch(ctx context.Context, req *models.NotificationRequest) error {
 	// Check if notification should bypass batching
@@ -109,8 +131,14 @@ func (s *BatchService) AddToBatch(ctx context.Context, req *models.NotificationR
 		Timestamp: time.Now(),
 	}
 
-	// Add to Redis batch
-	return s.addToRedisBatch(ctx, item)
+	// Add to Redis batch; while Redis is unavailable notifications are sent right away
+	// rather than lost
+	if err := s.addToRedisBatch(ctx, item); err != nil {
+		s.logger.WithError(err).WithField("user_id", req.UserID).Warn("Failed to batch notification, sending immediately")
+		s.metrics.RecordRedisFallback("batch")
+		return s.sendImmediately(ctx, req)
+	}
+	return nil
 }
 
 // addToRedisBatch adds an item to Redis batch
@@ -144,6 +172,7 @@ func (s *BatchService) addToRedisBatch(ctx context.Context, item BatchItem) erro
 	// Set expiration for the batch key
 	expiration := s.config.WindowDuration + time.Minute // Add buffer
 	s.redisClient.Expire(ctx, key, expiration)
+	s.metrics.RecordNotificationBatched()
 
 	s.logger.WithFields(logrus.Fields{
 		"user_id":    item.UserID,
@@ -157,9 +186,9 @@ func (s *BatchService) addToRedisBatch(ctx context.Context, item BatchItem) erro
 
 // ProcessBatches processes all pending batches
 func (s *BatchService) ProcessBatches(ctx context.Context) error {
-	// Get all batch keys
+	// Get all batch keys, scanning rather than blocking Redis with KEYS
 	pattern := s.config.RedisKeyPrefix + "*"
-	keys, err := s.redisClient.Keys(ctx, pattern).Result()
+	keys, err := database.ScanKeys(ctx, s.redisClient, pattern)
 	if err != nil {
 		return fmt.Errorf("failed to get batch keys: %w", err)
 	}
@@ -176,6 +205,8 @@ func (s *BatchService) ProcessBatches(ctx context.Context) error {
 
 // processBatch processes a single batch
 func (s *BatchService) processBatch(ctx context.Context, key string) error {
+	start := time.Now()
+
 	// Get all items in the batch
 	items, err := s.redisClient.ZRange(ctx, key, 0, -1).Result()
 	if err != nil {
@@ -205,6 +236,8 @@ func (s *BatchService) processBatch(ctx context.Context, key string) error {
 		batchItems = append(batchItems, item)
 	}
 
+	s.metrics.RecordBatchSize(len(batchItems))
+
 	// Create batch notification
 	batchNotification := s.createBatchNotification(batchKey, batchItems)
 
@@ -225,6 +258,7 @@ func (s *BatchService) processBatch(ctx context.Context, key string) error {
 
 	// Remove batch from Redis
 	s.redisClient.Del(ctx, key)
+	s.metrics.RecordBatchProcessingDuration(time.Since(start))
 
 	s.logger.WithFields(logrus.Fields{
 		"user_id":    batchKey.UserID,
@@ -331,16 +365,29 @@ func (s *BatchService) sendBatchNotification(ctx context.Context, batch *models.
 
 // sendImmediately sends a notification immediately without batching
 func (s *BatchService) sendImmediately(ctx context.Context, req *models.NotificationRequest) error {
-	// This would integrate with the main notification service
-	// For now, just log the notification
+	if s.sender == nil {
+		return fmt.Errorf("no notification sender configured")
+	}
+
 	s.logger.WithFields(logrus.Fields{
 		"user_id":    req.UserID,
 		"event_type": req.EventType,
 		"title":      req.Title,
 		"bypass":     req.BypassBatching,
-	}).Info("Sending immediate notification")
+	}).Debug("Sending immediate notification")
+
+	// Mark the request as bypassing batching so the sender does not batch it again
+	unbatched := *req
+	unbatched.BypassBatching = true
+
+	response, err := s.sender.SendNotification(ctx, &unbatched)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	if response != nil && response.Status == models.StatusFailed {
+		return fmt.Errorf("notification not sent: %s", response.Error)
+	}
 
-	// TODO: Integrate with notification service to send immediately
 	return nil
 }
 
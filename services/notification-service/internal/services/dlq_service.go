@@ -2,10 +2,13 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 )
@@ -17,6 +20,7 @@ type DLQService struct {
 	preferenceSvc *PreferenceService
 	templateSvc   *TemplateService
 	config        *DLQConfig
+	metrics       *metrics.Metrics
 	logger        *logrus.Logger
 }
 
@@ -47,6 +51,11 @@ func NewDLQService(
 	}
 }
 
+// SetMetrics enables recording DLQ metrics
+func (s *DLQService) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
 // AddToDLQ adds a failed notification to the Dead Letter Queue
 func (s *DLQService) AddToDLQ(ctx context.Context, notification *models.Notification, originalEvent map[string]interface{}, failureReason string) error {
 	// Create DLQ entry
@@ -66,6 +75,7 @@ func (s *DLQService) AddToDLQ(ctx context.Context, notification *models.Notifica
 	if err := s.dlqRepo.Create(ctx, entry); err != nil {
 		return fmt.Errorf("failed to add notification to DLQ: %w", err)
 	}
+	s.metrics.RecordNotificationDLQ(notification.EventType)
 
 	s.logger.WithFields(logrus.Fields{
 		"notification_id": notification.ID.Hex(),
@@ -86,7 +96,7 @@ func (s *DLQService) ProcessDLQ(ctx context.Context) error {
 	}
 
 	for _, entry := range entries {
-		if err := s.processDLQEntry(ctx, entry); err != nil {
+		if _, err := s.processDLQEntry(ctx, entry); err != nil {
 			s.logger.WithError(err).WithField("dlq_id", entry.ID.Hex()).Error("Failed to process DLQ entry")
 			continue
 		}
@@ -95,8 +105,9 @@ func (s *DLQService) ProcessDLQ(ctx context.Context) error {
 	return nil
 }
 
-// processDLQEntry processes a single DLQ entry
-func (s *DLQService) processDLQEntry(ctx context.Context, entry *models.DeadLetterQueueEntry) error {
+// processDLQEntry processes a single DLQ entry and reports whether the notification was
+// reprocessed successfully
+func (s *DLQService) processDLQEntry(ctx context.Context, entry *models.DeadLetterQueueEntry) (bool, error) {
 	// Check if entry has exceeded max retries
 	if len(entry.RetryHistory) >= entry.MaxRetries {
 		s.logger.WithFields(logrus.Fields{
@@ -107,7 +118,7 @@ func (s *DLQService) processDLQEntry(ctx context.Context, entry *models.DeadLett
 		}).Warn("DLQ entry exceeded max retries, marking as processed")
 
 		// Mark as processed
-		return s.dlqRepo.MarkAsProcessed(ctx, entry.ID.Hex())
+		return false, s.dlqRepo.MarkAsProcessed(ctx, entry.ID.Hex())
 	}
 
 	// Create retry attempt
@@ -123,6 +134,7 @@ func (s *DLQService) processDLQEntry(ctx context.Context, entry *models.DeadLett
 	retryAttempt.Duration = time.Since(start).Milliseconds()
 
 	if success {
+		s.metrics.RecordDLQRetryAttempt(entry.EventType, "success")
 		retryAttempt.Success = true
 		s.logger.WithFields(logrus.Fields{
 			"dlq_id":      entry.ID.Hex(),
@@ -131,8 +143,9 @@ func (s *DLQService) processDLQEntry(ctx context.Context, entry *models.DeadLett
 		}).Info("DLQ entry reprocessed successfully")
 
 		// Mark as processed
-		return s.dlqRepo.MarkAsProcessed(ctx, entry.ID.Hex())
+		return true, s.dlqRepo.MarkAsProcessed(ctx, entry.ID.Hex())
 	} else {
+		s.metrics.RecordDLQRetryAttempt(entry.EventType, "failure")
 		retryAttempt.ErrorReason = errorReason
 		s.logger.WithFields(logrus.Fields{
 			"dlq_id":       entry.ID.Hex(),
@@ -145,10 +158,10 @@ func (s *DLQService) processDLQEntry(ctx context.Context, entry *models.DeadLett
 	// Update retry info
 	nextRetryAt := time.Now().Add(s.config.RetryInterval)
 	if err := s.dlqRepo.UpdateRetryInfo(ctx, entry.ID.Hex(), &retryAttempt, &nextRetryAt); err != nil {
-		return fmt.Errorf("failed to update retry info: %w", err)
+		return false, fmt.Errorf("failed to update retry info: %w", err)
 	}
 
-	return nil
+	return false, nil
 }
 
 // reprocessNotification attempts to reprocess a failed notification
@@ -201,6 +214,20 @@ func (s *DLQService) reprocessNotification(ctx context.Context, entry *models.De
 	return true, ""
 }
 
+// recordDLQEntries updates the gauge of entries still waiting in the DLQ
+func (s *DLQService) recordDLQEntries(ctx context.Context) {
+	if s.metrics == nil {
+		return
+	}
+
+	stats, err := s.dlqRepo.GetStats(ctx)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to get DLQ stats for metrics")
+		return
+	}
+	s.metrics.RecordDLQEntries(stats["pending"])
+}
+
 // GetDLQStats gets DLQ statistics
 func (s *DLQService) GetDLQStats(ctx context.Context) (map[string]int64, error) {
 	return s.dlqRepo.GetStats(ctx)
@@ -225,7 +252,8 @@ func (s *DLQService) RetryDLQEntry(ctx context.Context, dlqID string) error {
 	}
 
 	// Process the entry
-	return s.processDLQEntry(ctx, entry)
+	_, err = s.processDLQEntry(ctx, entry)
+	return err
 }
 
 // DeleteDLQEntry deletes a DLQ entry
@@ -259,6 +287,7 @@ func (s *DLQService) StartDLQProcessor(ctx context.Context) {
 			if err := s.ProcessDLQ(ctx); err != nil {
 				s.logger.WithError(err).Error("Failed to process DLQ")
 			}
+			s.recordDLQEntries(ctx)
 		case <-cleanupTicker.C:
 			if count, err := s.CleanupOldEntries(ctx); err != nil {
 				s.logger.WithError(err).Error("Failed to cleanup old DLQ entries")
@@ -323,3 +352,122 @@ func (s *DLQService) GetDLQHealth(ctx context.Context) (map[string]interface{},
 func (s *DLQService) GetAll(ctx context.Context, page, limit int, processed *bool) ([]*models.DeadLetterQueueEntry, int64, error) {
 	return s.dlqRepo.GetAll(ctx, page, limit, processed)
 }
+
+const (
+	// maxBulkRetryEntries bounds the number of DLQ entries retried by one bulk retry
+	maxBulkRetryEntries = 500
+	// transientFailurePattern matches failure reasons that are likely to succeed when
+	// retried, such as timeouts, connection errors, rate limiting and server errors
+	transientFailurePattern = `timeout|timed out|deadline exceeded|connection refused|connection reset|broken pipe|no such host|temporar|unavailable|too many requests|rate limit|\b429\b|\b50[0234]\b`
+)
+
+var (
+	ErrEmptyDLQFilter = errors.New("DLQ filter must select at least one criterion")
+
+	transientFailureRegexp = regexp.MustCompile(`(?i)` + transientFailurePattern)
+)
+
+// DLQBulkRetryResult summarizes a bulk retry of DLQ entries
+type DLQBulkRetryResult struct {
+	Matched   int `json:"matched"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Errors    int `json:"errors"`
+	// HasMore reports whether more entries matched than were retried
+	HasMore bool `json:"has_more"`
+}
+
+// IsTransientFailure reports whether a failure reason is likely to succeed when retried
+func IsTransientFailure(reason string) bool {
+	return transientFailureRegexp.MatchString(reason)
+}
+
+// BulkRetry retries the pending DLQ entries matching the filter, oldest first
+func (s *DLQService) BulkRetry(ctx context.Context, filter repository.DLQFilter) (*DLQBulkRetryResult, error) {
+	if filter.IsEmpty() {
+		return nil, ErrEmptyDLQFilter
+	}
+	return s.retryMatching(ctx, filter)
+}
+
+// RetryTransientFailures retries the pending DLQ entries whose failure reason is
+// transient, oldest first
+func (s *DLQService) RetryTransientFailures(ctx context.Context) (*DLQBulkRetryResult, error) {
+	return s.retryMatching(ctx, repository.DLQFilter{FailureReasonPattern: transientFailurePattern})
+}
+
+func (s *DLQService) retryMatching(ctx context.Context, filter repository.DLQFilter) (*DLQBulkRetryResult, error) {
+	pending := false
+	filter.Processed = &pending
+
+	entries, err := s.dlqRepo.Find(ctx, filter, maxBulkRetryEntries+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DLQ entries: %w", err)
+	}
+
+	result := &DLQBulkRetryResult{}
+	if len(entries) > maxBulkRetryEntries {
+		entries = entries[:maxBulkRetryEntries]
+		result.HasMore = true
+	}
+	result.Matched = len(entries)
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			result.HasMore = true
+			break
+		}
+		succeeded, err := s.processDLQEntry(ctx, entry)
+		switch {
+		case err != nil:
+			s.logger.WithError(err).WithField("dlq_id", entry.ID.Hex()).Error("Failed to process DLQ entry")
+			result.Errors++
+		case succeeded:
+			result.Succeeded++
+		default:
+			result.Failed++
+		}
+	}
+
+	s.recordDLQEntries(ctx)
+
+	s.logger.WithFields(logrus.Fields{
+		"matched":   result.Matched,
+		"succeeded": result.Succeeded,
+		"failed":    result.Failed,
+		"errors":    result.Errors,
+	}).Info("Bulk retried DLQ entries")
+
+	return result, nil
+}
+
+// BulkDelete deletes the DLQ entries matching the filter
+func (s *DLQService) BulkDelete(ctx context.Context, filter repository.DLQFilter) (int64, error) {
+	if filter.IsEmpty() {
+		return 0, ErrEmptyDLQFilter
+	}
+
+	count, err := s.dlqRepo.DeleteMatching(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete DLQ entries: %w", err)
+	}
+
+	s.recordDLQEntries(ctx)
+	s.logger.WithField("count", count).Info("Bulk deleted DLQ entries")
+
+	return count, nil
+}
+
+// GetFailureSummary groups the DLQ entries matching the filter by failure reason
+func (s *DLQService) GetFailureSummary(ctx context.Context, filter repository.DLQFilter) ([]*models.DLQFailureSummary, error) {
+	summary, err := s.dlqRepo.GetFailureSummary(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DLQ failure summary: %w", err)
+	}
+
+	for _, group := range summary {
+		group.Transient = IsTransientFailure(group.FailureReason)
+	}
+
+	return summary, nil
+}
@@ -3,9 +3,13 @@ package services
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 )
@@ -19,10 +23,49 @@ type NotificationService struct {
 	dlqSvc        *DLQService
 	retrySvc      *RetryService
 	handlers      map[models.NotificationChannel]NotificationHandler
+	userDirectory UserDirectory
+	quietQueue    QuietHoursQueue
+	throttler     *ThrottleService
+	publisher     NotificationPublisher
+	inboxListener InboxListener
+	flags         FeatureFlags
+	// actionBaseURL resolves the action paths of notifications, such as /api/v1/files/:id
+	actionBaseURL string
+	metrics       *metrics.Metrics
 	config        *ServiceConfig
 	logger        *logrus.Logger
 }
 
+// UserDirectory resolves the profile of a notification's recipient
+type UserDirectory interface {
+	GetProfile(ctx context.Context, userID string) (*models.UserProfile, error)
+}
+
+// QuietHoursQueue holds back notifications suppressed by the recipient's quiet hours
+// until they end
+type QuietHoursQueue interface {
+	DeferNotification(ctx context.Context, req *models.NotificationRequest, sendAt time.Time) (*models.ScheduledNotification, error)
+}
+
+// InboxListener is told when a user's unread count may have changed
+type InboxListener interface {
+	UnreadCountChanged(userID string)
+}
+
+// NotificationPublisher streams sent notifications to their recipients' subscribers
+type NotificationPublisher interface {
+	PublishNotification(ctx context.Context, notification *models.Notification)
+}
+
+// FlagBatching is the feature flag rolling out batching to users; it is on while it
+// doesn't exist
+const FlagBatching = "notification.batching"
+
+// FeatureFlags reports whether a feature is enabled for a user
+type FeatureFlags interface {
+	Enabled(key, userID string) bool
+}
+
 // ServiceConfig contains service configuration
 type ServiceConfig struct {
 	EnableBatching   bool
@@ -73,15 +116,59 @@ func (s *NotificationService) RegisterHandler(channel models.NotificationChannel
 	s.logger.WithField("channel", channel).Info("Registered notification handler")
 }
 
+// SetUserDirectory enables filling in recipient details such as the name used by templates
+func (s *NotificationService) SetUserDirectory(directory UserDirectory) {
+	s.userDirectory = directory
+}
+
+// SetQuietHoursQueue enables delivering notifications suppressed by quiet hours once
+// they end, instead of dropping them
+func (s *NotificationService) SetQuietHoursQueue(queue QuietHoursQueue) {
+	s.quietQueue = queue
+}
+
+// SetThrottler enables per-event-type rate limits on notifications sent immediately
+func (s *NotificationService) SetThrottler(throttler *ThrottleService) {
+	s.throttler = throttler
+}
+
+// SetPublisher enables streaming notifications to subscribers as they are sent
+func (s *NotificationService) SetPublisher(publisher NotificationPublisher) {
+	s.publisher = publisher
+}
+
+// SetInboxListener enables telling listener of the changes of users' unread counts, as
+// notifications are created, read and deleted
+func (s *NotificationService) SetInboxListener(listener InboxListener) {
+	s.inboxListener = listener
+}
+
+// SetActionBaseURL resolves the action paths of notifications against the public URL of
+// the API gateway
+func (s *NotificationService) SetActionBaseURL(baseURL string) {
+	s.actionBaseURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetFeatureFlags enables rolling out features such as batching to some users only
+func (s *NotificationService) SetFeatureFlags(flags FeatureFlags) {
+	s.flags = flags
+}
+
+// SetMetrics enables recording delivery metrics
+func (s *NotificationService) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
 // SendNotification sends a notification through the optimal channel
 func (s *NotificationService) SendNotification(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error) {
 	// Validate request
 	if err := s.validateRequest(req); err != nil {
 		return nil, fmt.Errorf("invalid request: %w", err)
 	}
+	s.resolveActions(req)
 
 	// Check if user is subscribed to this event type
-	subscribed, err := s.preferenceSvc.IsEventSubscribed(ctx, req.UserID, req.EventType)
+	subscribed, err := s.isEventSubscribed(ctx, req.UserID, req.EventType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check event subscription: %w", err)
 	}
@@ -112,23 +199,41 @@ func (s *NotificationService) SendNotification(ctx context.Context, req *models.
 		return nil, fmt.Errorf("failed to check channel status: %w", err)
 	}
 	if !channelEnabled {
+		// Fall back to the first enabled channel in the user's priorities for the event type
+		fallback, err := s.preferenceSvc.GetOptimalChannel(ctx, req.UserID, req.EventType)
+		if err != nil {
+			s.logger.WithError(err).WithFields(logrus.Fields{
+				"user_id": req.UserID,
+				"channel": req.Channel,
+			}).Debug("Channel not enabled for user and no fallback channel")
+			return &models.NotificationResponse{
+				Status:  models.StatusFailed,
+				Channel: req.Channel,
+				Error:   "channel not enabled for user",
+			}, nil
+		}
+
 		s.logger.WithFields(logrus.Fields{
-			"user_id": req.UserID,
-			"channel": req.Channel,
-		}).Debug("Channel not enabled for user")
-		return &models.NotificationResponse{
-			Status:  models.StatusFailed,
-			Channel: req.Channel,
-			Error:   "channel not enabled for user",
-		}, nil
+			"user_id":  req.UserID,
+			"channel":  req.Channel,
+			"fallback": fallback,
+		}).Debug("Channel not enabled for user, using fallback channel")
+		if req.Metadata == nil {
+			req.Metadata = make(map[string]interface{})
+		}
+		req.Metadata["requested_channel"] = string(req.Channel)
+		req.Channel = fallback
 	}
 
 	// Check quiet hours (unless bypassed)
 	if !req.BypassQuietHours {
-		inQuietHours, err := s.preferenceSvc.IsInQuietHours(ctx, req.UserID)
+		quietHoursEnd, inQuietHours, err := s.preferenceSvc.QuietHoursEnd(ctx, req.UserID, time.Now())
 		if err != nil {
 			return nil, fmt.Errorf("failed to check quiet hours: %w", err)
 		}
+		if inQuietHours && s.quietQueue != nil {
+			return s.deferNotification(ctx, req, quietHoursEnd)
+		}
 		if inQuietHours {
 			s.logger.WithFields(logrus.Fields{
 				"user_id": req.UserID,
@@ -142,6 +247,9 @@ func (s *NotificationService) SendNotification(ctx context.Context, req *models.
 		}
 	}
 
+	s.applyPreferredLocale(ctx, req)
+	s.applyUserProfile(ctx, req)
+
 	// Apply template if not bypassed
 	if !req.BypassBatching {
 		templateData := s.templateSvc.CreateTemplateData(req, nil)
@@ -152,14 +260,131 @@ func (s *NotificationService) SendNotification(ctx context.Context, req *models.
 	}
 
 	// Check if notification should be batched
-	if s.config.EnableBatching && !req.BypassBatching && !s.shouldBypassBatching(req.EventType) {
+	if s.config.EnableBatching && !req.BypassBatching && !s.shouldBypassBatching(req.EventType) && s.featureEnabled(FlagBatching, req.UserID) {
 		return s.sendBatchedNotification(ctx, req)
 	}
 
+	// Drop notifications beyond the rate limit of the event type
+	if s.isThrottled(ctx, req) {
+		s.logger.WithFields(logrus.Fields{
+			"user_id":    req.UserID,
+			"event_type": req.EventType,
+			"channel":    req.Channel,
+		}).Debug("Notification rate limit exceeded, skipping notification")
+		s.metrics.RecordNotificationThrottled(req.Channel, req.EventType)
+		return &models.NotificationResponse{
+			Status:  models.StatusFailed,
+			Channel: req.Channel,
+			Error:   "notification rate limit exceeded",
+		}, nil
+	}
+
 	// Send immediately
 	return s.sendImmediateNotification(ctx, req)
 }
 
+// deferNotification queues a notification suppressed by quiet hours for delivery when
+// they end
+func (s *NotificationService) deferNotification(ctx context.Context, req *models.NotificationRequest, sendAt time.Time) (*models.NotificationResponse, error) {
+	scheduled, err := s.quietQueue.DeferNotification(ctx, req, sendAt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": req.UserID,
+		"channel": req.Channel,
+		"send_at": scheduled.SendAt,
+	}).Debug("User in quiet hours, deferring notification")
+
+	return &models.NotificationResponse{
+		Status:        models.StatusDeferred,
+		Channel:       req.Channel,
+		ScheduledID:   scheduled.ID.Hex(),
+		DeferredUntil: &scheduled.SendAt,
+	}, nil
+}
+
+// isEventSubscribed reports whether a user is subscribed to an event type. Announcements,
+// invoices, receipts, payment reminders, subscription status and trial reminders cannot
+// be unsubscribed from.
+func (s *NotificationService) isEventSubscribed(ctx context.Context, userID string, eventType models.EventType) (bool, error) {
+	switch eventType {
+	case models.EventTypeAnnouncement, models.EventTypeInvoiceIssued, models.EventTypePaymentFailed, models.EventTypeTrialEnding,
+		models.EventTypePaymentSucceeded, models.EventTypeSubscriptionRenewed, models.EventTypeSubscriptionCancelled:
+		return true, nil
+	}
+	return s.preferenceSvc.IsEventSubscribed(ctx, userID, eventType)
+}
+
+// isThrottled reports whether a notification exceeds the hourly limit for its event type.
+// Critical notifications are never throttled.
+func (s *NotificationService) isThrottled(ctx context.Context, req *models.NotificationRequest) bool {
+	if s.throttler == nil || req.Priority == models.PriorityCritical {
+		return false
+	}
+
+	preferences, err := s.preferenceSvc.GetUserPreferences(ctx, req.UserID)
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", req.UserID).Warn("Failed to get rate limits from preferences")
+	}
+
+	limit := s.throttler.Limit(req.EventType, preferences)
+	return !s.throttler.Allow(ctx, req.UserID, req.EventType, req.Channel, limit)
+}
+
+// applyPreferredLocale adds the locale chosen in the user's notification preferences to
+// the request metadata, ahead of the account profile's locale
+func (s *NotificationService) applyPreferredLocale(ctx context.Context, req *models.NotificationRequest) {
+	if locale, ok := req.Metadata["locale"].(string); ok && locale != "" {
+		return
+	}
+
+	preferences, err := s.preferenceSvc.GetUserPreferences(ctx, req.UserID)
+	if err != nil || preferences.Locale == "" {
+		return
+	}
+
+	if req.Metadata == nil {
+		req.Metadata = make(map[string]interface{})
+	}
+	req.Metadata["locale"] = preferences.Locale
+}
+
+// applyUserProfile adds the recipient's name, email, locale and timezone to the request
+// metadata unless the sender already provided them
+func (s *NotificationService) applyUserProfile(ctx context.Context, req *models.NotificationRequest) {
+	if s.userDirectory == nil {
+		return
+	}
+
+	profile, err := s.userDirectory.GetProfile(ctx, req.UserID)
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", req.UserID).Debug("User profile not available")
+		return
+	}
+
+	if req.Metadata == nil {
+		req.Metadata = make(map[string]interface{})
+	}
+
+	values := map[string]string{
+		"user_name": profile.FullName,
+		"email":     profile.Email,
+		"locale":    profile.Locale,
+		"timezone":  profile.Timezone,
+	}
+	for key, value := range values {
+		if value == "" {
+			continue
+		}
+		if existing, ok := req.Metadata[key].(string); ok && existing != "" {
+			continue
+		}
+		req.Metadata[key] = value
+	}
+}
+
 // sendBatchedNotification sends a notification through batching
 func (s *NotificationService) sendBatchedNotification(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error) {
 	// Add to batch
@@ -196,6 +421,7 @@ func (s *NotificationService) sendImmediateNotification(ctx context.Context, req
 		Status:    models.StatusPending,
 		Priority:  req.Priority,
 		Metadata:  req.Metadata,
+		Actions:   req.Actions,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -204,6 +430,9 @@ func (s *NotificationService) sendImmediateNotification(ctx context.Context, req
 	if err := s.notifRepo.Create(ctx, notification); err != nil {
 		return nil, fmt.Errorf("failed to create notification: %w", err)
 	}
+	// The notification is unread whether or not its delivery succeeds; the count is
+	// pushed after the notification itself
+	defer s.unreadCountChanged(req.UserID)
 
 	// Get handler for channel
 	handler, exists := s.handlers[req.Channel]
@@ -217,8 +446,14 @@ func (s *NotificationService) sendImmediateNotification(ctx context.Context, req
 	}
 
 	// Send notification
+	start := time.Now()
 	response, err := handler.Send(ctx, req)
+	s.metrics.RecordNotificationDeliveryDuration(req.Channel, time.Since(start))
+	s.recordDeliveryAttempt(ctx, notification, start, response, err)
 	if err != nil {
+		s.metrics.RecordNotificationSent(req.Channel, req.EventType, models.StatusFailed)
+		s.metrics.RecordChannelError(req.Channel, "send_failed")
+
 		// Update notification status to failed
 		s.notifRepo.UpdateStatus(ctx, notification.ID.Hex(), models.StatusFailed, err.Error())
 
@@ -239,6 +474,9 @@ func (s *NotificationService) sendImmediateNotification(ctx context.Context, req
 		return response, err
 	}
 
+	s.metrics.RecordNotificationSent(req.Channel, req.EventType, response.Status)
+	response.ID = notification.ID.Hex()
+
 	// Update notification status
 	if response.Status == models.StatusSent {
 		s.notifRepo.UpdateStatus(ctx, notification.ID.Hex(), models.StatusSent, "")
@@ -246,9 +484,54 @@ func (s *NotificationService) sendImmediateNotification(ctx context.Context, req
 		s.notifRepo.UpdateStatus(ctx, notification.ID.Hex(), models.StatusFailed, response.Error)
 	}
 
+	// Keep the provider's message ID so delivery status callbacks can find the notification
+	if response.ProviderMessageID != "" {
+		if err := s.notifRepo.SetProviderMessageID(ctx, notification.ID.Hex(), response.ProviderMessageID); err != nil {
+			s.logger.WithError(err).WithField("notification_id", notification.ID.Hex()).Warn("Failed to save provider message ID")
+		}
+	}
+
+	if s.publisher != nil && response.Status == models.StatusSent {
+		notification.Status = models.StatusSent
+		notification.SentAt = response.SentAt
+		notification.ProviderMessageID = response.ProviderMessageID
+		s.publisher.PublishNotification(ctx, notification)
+	}
+
 	return response, nil
 }
 
+// UpdateDeliveryStatus applies a delivery status reported by a provider to the
+// notification it sent as providerMessageID. Statuses arriving out of order do not move a
+// notification back, so a late "sent" does not overwrite "delivered".
+func (s *NotificationService) UpdateDeliveryStatus(ctx context.Context, channel models.NotificationChannel, providerMessageID string, status models.NotificationStatus, errorReason string) error {
+	var skip []models.NotificationStatus
+	switch status {
+	case models.StatusSent:
+		skip = []models.NotificationStatus{models.StatusDelivered, models.StatusFailed, models.StatusRead}
+	case models.StatusDelivered:
+		skip = []models.NotificationStatus{models.StatusRead}
+	case models.StatusFailed:
+		skip = []models.NotificationStatus{models.StatusDelivered, models.StatusRead}
+	default:
+		return fmt.Errorf("unsupported delivery status: %s", status)
+	}
+
+	updated, err := s.notifRepo.UpdateStatusByProviderMessageID(ctx, channel, providerMessageID, status, errorReason, skip)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery status: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"channel":             channel,
+		"provider_message_id": providerMessageID,
+		"status":              status,
+		"updated":             updated,
+	}).Debug("Delivery status received")
+
+	return nil
+}
+
 // SendWithFallback sends a notification with fallback channels
 func (s *NotificationService) SendWithFallback(ctx context.Context, req *models.NotificationRequest) (*models.NotificationResponse, error) {
 	// Get fallback channels
@@ -314,6 +597,33 @@ func (s *NotificationService) ProcessKafkaEvent(ctx context.Context, event *mode
 			"error_reason": event.ErrorReason,
 		},
 	}
+	if isQuotaEvent(event.Type) || isBillingEvent(event.Type) {
+		// The billing-service's usage figures, such as the quota and percentage used, or
+		// payment details, such as the plan and amount
+		for key, value := range event.Metadata {
+			req.Metadata[key] = value
+		}
+	}
+	if isBillingEvent(event.Type) {
+		// Receipts and subscription status are emailed whatever the hour
+		req.Channel = models.ChannelEmail
+		req.BypassQuietHours = true
+	}
+	if event.Type == "security.alert" {
+		// The rule that fired and what it saw, such as the number of files shared
+		for key, value := range event.Metadata {
+			req.Metadata[key] = value
+		}
+		req.BypassQuietHours = true
+	}
+	if req.EventType == models.EventTypeFileShared && event.FileID != "" {
+		req.Actions = []models.NotificationAction{{
+			Label:  "Open file",
+			URL:    "/api/v1/files/" + url.PathEscape(event.FileID),
+			Intent: "open_file",
+			Style:  models.ActionStylePrimary,
+		}}
+	}
 
 	// Send notification
 	_, err := s.SendNotification(ctx, req)
@@ -334,15 +644,65 @@ func (s *NotificationService) validateRequest(req *models.NotificationRequest) e
 	if req.Message == "" {
 		return fmt.Errorf("message is required")
 	}
+	return validateActions(req.Actions)
+}
+
+// validateActions checks that actions have a label, a URL or intent and a known style
+func validateActions(actions []models.NotificationAction) error {
+	if len(actions) > models.MaxNotificationActions {
+		return fmt.Errorf("at most %d actions are allowed", models.MaxNotificationActions)
+	}
+	for _, action := range actions {
+		if strings.TrimSpace(action.Label) == "" {
+			return fmt.Errorf("action label is required")
+		}
+		if action.URL == "" && action.Intent == "" {
+			return fmt.Errorf("action %q needs a URL or an intent", action.Label)
+		}
+		if action.URL != "" && !isActionPath(action.URL) {
+			u, err := url.Parse(action.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("action %q URL must be a web URL or a path", action.Label)
+			}
+		}
+		switch action.Style {
+		case "", models.ActionStylePrimary, models.ActionStyleSecondary, models.ActionStyleDanger:
+		default:
+			return fmt.Errorf("unknown action style %q", action.Style)
+		}
+	}
 	return nil
 }
 
+// isActionPath reports whether an action URL is a path on the API gateway
+func isActionPath(actionURL string) bool {
+	return strings.HasPrefix(actionURL, "/") && !strings.HasPrefix(actionURL, "//")
+}
+
+// resolveActions makes the action paths of a request absolute URLs on the API gateway
+func (s *NotificationService) resolveActions(req *models.NotificationRequest) {
+	for i, action := range req.Actions {
+		if isActionPath(action.URL) && s.actionBaseURL != "" {
+			req.Actions[i].URL = s.actionBaseURL + action.URL
+		}
+	}
+}
+
+// featureEnabled reports whether a feature flag is on for a user, or true without flags
+func (s *NotificationService) featureEnabled(key, userID string) bool {
+	return s.flags == nil || s.flags.Enabled(key, userID)
+}
+
 // shouldBypassBatching checks if an event type should bypass batching
 func (s *NotificationService) shouldBypassBatching(eventType models.EventType) bool {
 	criticalTypes := []models.EventType{
 		models.EventTypeQuotaExceeded,
 		models.EventTypeSecurityAlert,
 		models.EventTypeSystemMaintenance,
+		models.EventTypePaymentSucceeded,
+		models.EventTypePaymentFailed,
+		models.EventTypeSubscriptionRenewed,
+		models.EventTypeSubscriptionCancelled,
 	}
 
 	for _, criticalType := range criticalTypes {
@@ -367,11 +727,46 @@ func (s *NotificationService) mapEventType(eventType string, success bool) model
 		return models.EventTypeFileDeleted
 	case "file.shared":
 		return models.EventTypeFileShared
+	case "quota.warning.80":
+		return models.EventTypeQuotaWarning80
+	case "quota.warning.90":
+		return models.EventTypeQuotaWarning90
+	case "quota.exceeded":
+		return models.EventTypeQuotaExceeded
+	case "payment.succeeded":
+		return models.EventTypePaymentSucceeded
+	case "payment.failed":
+		return models.EventTypePaymentFailed
+	case "subscription.renewed":
+		return models.EventTypeSubscriptionRenewed
+	case "subscription.cancelled":
+		return models.EventTypeSubscriptionCancelled
+	case "security.alert":
+		return models.EventTypeSecurityAlert
 	default:
 		return models.EventTypeFileUploaded
 	}
 }
 
+// isQuotaEvent reports whether a Kafka event is one of the billing-service's quota alerts
+func isQuotaEvent(eventType string) bool {
+	switch eventType {
+	case "quota.warning.80", "quota.warning.90", "quota.exceeded":
+		return true
+	}
+	return false
+}
+
+// isBillingEvent reports whether a Kafka event is one of the billing-service's payment
+// or subscription events
+func isBillingEvent(eventType string) bool {
+	switch eventType {
+	case "payment.succeeded", "payment.failed", "subscription.renewed", "subscription.cancelled":
+		return true
+	}
+	return false
+}
+
 // getEventTitle gets the title for an event
 func (s *NotificationService) getEventTitle(eventType string, success bool) string {
 	switch eventType {
@@ -385,6 +780,20 @@ func (s *NotificationService) getEventTitle(eventType string, success bool) stri
 		return "File Deleted"
 	case "file.shared":
 		return "File Shared"
+	case "quota.warning.80", "quota.warning.90":
+		return "Storage Quota Warning"
+	case "quota.exceeded":
+		return "Storage Quota Exceeded"
+	case "payment.succeeded":
+		return "Payment Received"
+	case "payment.failed":
+		return "Payment Failed"
+	case "subscription.renewed":
+		return "Subscription Renewed"
+	case "subscription.cancelled":
+		return "Subscription Cancelled"
+	case "security.alert":
+		return "Security Alert"
 	default:
 		return "Notification"
 	}
@@ -403,6 +812,25 @@ func (s *NotificationService) getEventMessage(event *models.KafkaFileEvent) stri
 		return fmt.Sprintf("Your file '%s' has been deleted", event.FileName)
 	case "file.shared":
 		return fmt.Sprintf("A file '%s' has been shared with you", event.FileName)
+	case "quota.warning.80":
+		return "You have used 80% of your storage quota"
+	case "quota.warning.90":
+		return "You have used 90% of your storage quota"
+	case "quota.exceeded":
+		return "You have exceeded your storage quota"
+	case "payment.succeeded":
+		return fmt.Sprintf("We received your payment of %v for the %v plan", event.Metadata["amount"], event.Metadata["plan_name"])
+	case "payment.failed":
+		return fmt.Sprintf("We couldn't collect the payment for your %v plan", event.Metadata["plan_name"])
+	case "subscription.renewed":
+		return fmt.Sprintf("Your %v plan has been renewed until %v", event.Metadata["plan_name"], event.Metadata["period_end"])
+	case "subscription.cancelled":
+		return fmt.Sprintf("Your %v plan has been cancelled", event.Metadata["plan_name"])
+	case "security.alert":
+		if summary, ok := event.Metadata["summary"].(string); ok && summary != "" {
+			return summary
+		}
+		return "A security alert has been triggered for your account"
 	default:
 		return "You have a new notification"
 	}
@@ -421,11 +849,93 @@ func (s *NotificationService) getEventPriority(eventType string, success bool) m
 		return models.PriorityNormal
 	case "file.shared":
 		return models.PriorityNormal
+	case "quota.warning.80":
+		return models.PriorityNormal
+	case "quota.warning.90":
+		return models.PriorityHigh
+	case "quota.exceeded":
+		return models.PriorityCritical
+	case "security.alert":
+		return models.PriorityCritical
 	default:
 		return models.PriorityNormal
 	}
 }
 
+// recordDeliveryAttempt adds the outcome of sending a notification to its delivery
+// attempts, which delivery analytics are aggregated from
+func (s *NotificationService) recordDeliveryAttempt(ctx context.Context, notification *models.Notification, start time.Time, response *models.NotificationResponse, sendErr error) {
+	attempt := models.DeliveryAttempt{
+		AttemptedAt: start,
+		Success:     sendErr == nil && response != nil && response.Status == models.StatusSent,
+		Duration:    time.Since(start).Milliseconds(),
+	}
+	if sendErr != nil {
+		attempt.ErrorReason = sendErr.Error()
+	} else if response != nil && !attempt.Success {
+		attempt.ErrorReason = response.Error
+	}
+
+	if err := s.notifRepo.AddDeliveryAttempt(ctx, notification.ID.Hex(), &attempt); err != nil {
+		s.logger.WithError(err).WithField("notification_id", notification.ID.Hex()).Error("Failed to add delivery attempt")
+	}
+}
+
+// GetDeliveryAnalytics gets the delivery, failure and read rates per channel and event
+// type in buckets of interval between from and to, and their totals per channel
+func (s *NotificationService) GetDeliveryAnalytics(ctx context.Context, from, to time.Time, interval models.AnalyticsInterval, channel models.NotificationChannel, eventType models.EventType) (*models.DeliveryAnalytics, error) {
+	series, err := s.notifRepo.GetDeliveryStats(ctx, from, to, interval, channel, eventType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery stats: %w", err)
+	}
+
+	totals := make(map[models.NotificationChannel]*models.DeliveryStats)
+	var channels []models.NotificationChannel
+	for i := range series {
+		setDeliveryRates(&series[i])
+
+		total, ok := totals[series[i].Channel]
+		if !ok {
+			total = &models.DeliveryStats{Channel: series[i].Channel}
+			totals[series[i].Channel] = total
+			channels = append(channels, series[i].Channel)
+		}
+		total.Attempts += series[i].Attempts
+		total.FailedAttempts += series[i].FailedAttempts
+		total.Notifications += series[i].Notifications
+		total.Delivered += series[i].Delivered
+		total.Failed += series[i].Failed
+		total.Read += series[i].Read
+	}
+
+	analytics := &models.DeliveryAnalytics{
+		From:     from,
+		To:       to,
+		Interval: interval,
+		Series:   make([]models.DeliveryStats, 0, len(series)),
+		Channels: make([]models.DeliveryStats, 0, len(channels)),
+	}
+	analytics.Series = append(analytics.Series, series...)
+	sort.Slice(channels, func(i, j int) bool { return channels[i] < channels[j] })
+	for _, channel := range channels {
+		setDeliveryRates(totals[channel])
+		analytics.Channels = append(analytics.Channels, *totals[channel])
+	}
+
+	return analytics, nil
+}
+
+// setDeliveryRates derives the rates of delivery stats from their counts
+func setDeliveryRates(stats *models.DeliveryStats) {
+	if stats.Notifications > 0 {
+		stats.DeliveryRate = float64(stats.Delivered) / float64(stats.Notifications)
+		stats.FailureRate = float64(stats.Failed) / float64(stats.Notifications)
+	}
+	if stats.Delivered > 0 {
+		stats.ReadRate = float64(stats.Read) / float64(stats.Delivered)
+	}
+}
+
 // GetNotificationStats gets notification statistics
 func (s *NotificationService) GetNotificationStats(ctx context.Context, userID string, startDate, endDate time.Time) (map[string]int64, error) {
 	return s.notifRepo.GetNotificationStats(ctx, userID, startDate, endDate)
@@ -486,8 +996,8 @@ func (s *NotificationService) StartBackgroundProcesses(ctx context.Context) {
 }
 
 // GetNotifications gets notifications for a user with pagination and filtering
-func (s *NotificationService) GetNotifications(ctx context.Context, userID string, page, limit int, statusFilter *models.NotificationStatus, eventTypeFilter *models.EventType) ([]*models.Notification, int64, error) {
-	return s.notifRepo.GetByUserID(ctx, userID, page, limit, statusFilter, eventTypeFilter)
+func (s *NotificationService) GetNotifications(ctx context.Context, userID string, page, limit int, filter repository.NotificationFilter) ([]*models.Notification, int64, error) {
+	return s.notifRepo.GetByUserID(ctx, userID, page, limit, filter)
 }
 
 // GetNotification gets a specific notification by ID
@@ -497,20 +1007,43 @@ func (s *NotificationService) GetNotification(ctx context.Context, notificationI
 
 // MarkAsRead marks a notification as read
 func (s *NotificationService) MarkAsRead(ctx context.Context, notificationID, userID string) error {
-	return s.notifRepo.MarkAsRead(ctx, notificationID, userID)
+	if err := s.notifRepo.MarkAsRead(ctx, notificationID, userID); err != nil {
+		return err
+	}
+	s.unreadCountChanged(userID)
+	return nil
 }
 
 // MarkAllAsRead marks all notifications as read for a user
 func (s *NotificationService) MarkAllAsRead(ctx context.Context, userID string) (int64, error) {
-	return s.notifRepo.MarkAllAsRead(ctx, userID)
+	count, err := s.notifRepo.MarkAllAsRead(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		s.unreadCountChanged(userID)
+	}
+	return count, nil
 }
 
 // DeleteNotification deletes a notification
 func (s *NotificationService) DeleteNotification(ctx context.Context, notificationID, userID string) error {
-	return s.notifRepo.DeleteByIDAndUserID(ctx, notificationID, userID)
+	if err := s.notifRepo.DeleteByIDAndUserID(ctx, notificationID, userID); err != nil {
+		return err
+	}
+	s.unreadCountChanged(userID)
+	return nil
 }
 
 // GetUnreadCount gets the unread notification count for a user
 func (s *NotificationService) GetUnreadCount(ctx context.Context, userID string) (int64, error) {
 	return s.notifRepo.GetUnreadCount(ctx, userID)
 }
+
+// unreadCountChanged tells the inbox listener, if any, that a user's unread count may
+// have changed
+func (s *NotificationService) unreadCountChanged(userID string) {
+	if s.inboxListener != nil {
+		s.inboxListener.UnreadCountChanged(userID)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	phoneVerificationKeyPrefix   = "notification:phone_verification:"
+	phoneVerificationCodeTTL     = 10 * time.Minute
+	phoneVerificationResendAfter = time.Minute
+	phoneVerificationMaxAttempts = 5
+)
+
+var (
+	ErrInvalidPhoneNumber            = errors.New("phone number must be in international format, such as +14155552671")
+	ErrPhoneVerificationNotFound     = errors.New("no pending phone verification, request a new code")
+	ErrPhoneVerificationInvalid      = errors.New("invalid verification code")
+	ErrPhoneVerificationExhausted    = errors.New("too many incorrect codes, request a new code")
+	ErrPhoneVerificationRequestedNow = errors.New("a verification code was sent recently, please wait before requesting another")
+)
+
+// e164Pattern matches phone numbers in E.164 format
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// TextSender sends text messages to phone numbers
+type TextSender interface {
+	SendText(ctx context.Context, phoneNumber, message string) error
+}
+
+// PhoneVerificationService verifies that users own the phone numbers SMS notifications
+// are sent to, with one-time codes kept in Redis
+type PhoneVerificationService struct {
+	redisClient   redis.UniversalClient
+	preferenceSvc *PreferenceService
+	sender        TextSender
+	logger        *logrus.Logger
+}
+
+// NewPhoneVerificationService creates a new phone verification service
+func NewPhoneVerificationService(redisClient redis.UniversalClient, preferenceSvc *PreferenceService, sender TextSender, logger *logrus.Logger) *PhoneVerificationService {
+	return &PhoneVerificationService{
+		redisClient:   redisClient,
+		preferenceSvc: preferenceSvc,
+		sender:        sender,
+		logger:        logger,
+	}
+}
+
+// CodeTTL returns how long verification codes are valid
+func (s *PhoneVerificationService) CodeTTL() time.Duration {
+	return phoneVerificationCodeTTL
+}
+
+// StartVerification sends a verification code to a phone number. The number is saved
+// once the code is confirmed.
+func (s *PhoneVerificationService) StartVerification(ctx context.Context, userID, phoneNumber string) error {
+	phoneNumber = normalizePhoneNumber(phoneNumber)
+	if !e164Pattern.MatchString(phoneNumber) {
+		return ErrInvalidPhoneNumber
+	}
+
+	key := phoneVerificationKeyPrefix + userID
+
+	sentAt, err := s.redisClient.HGet(ctx, key, "sent_at").Int64()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to get phone verification: %w", err)
+	}
+	if err == nil && time.Since(time.Unix(sentAt, 0)) < phoneVerificationResendAfter {
+		return ErrPhoneVerificationRequestedNow
+	}
+
+	code, err := generateVerificationCode()
+	if err != nil {
+		return fmt.Errorf("failed to generate verification code: %w", err)
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key,
+		"phone_number", phoneNumber,
+		"code_hash", hashVerificationCode(userID, code),
+		"attempts", 0,
+		"sent_at", time.Now().Unix(),
+	)
+	pipe.Expire(ctx, key, phoneVerificationCodeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save phone verification: %w", err)
+	}
+
+	message := fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, int(phoneVerificationCodeTTL.Minutes()))
+	if err := s.sender.SendText(ctx, phoneNumber, message); err != nil {
+		s.redisClient.Del(ctx, key)
+		return fmt.Errorf("failed to send verification code: %w", err)
+	}
+
+	s.logger.WithField("user_id", userID).Info("Phone verification code sent")
+	return nil
+}
+
+// ConfirmVerification checks a verification code and saves the verified phone number
+func (s *PhoneVerificationService) ConfirmVerification(ctx context.Context, userID, code string) (string, error) {
+	key := phoneVerificationKeyPrefix + userID
+
+	values, err := s.redisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to get phone verification: %w", err)
+	}
+	if len(values) == 0 {
+		return "", ErrPhoneVerificationNotFound
+	}
+
+	attempts, err := s.redisClient.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to update phone verification: %w", err)
+	}
+	if attempts > phoneVerificationMaxAttempts {
+		s.redisClient.Del(ctx, key)
+		return "", ErrPhoneVerificationExhausted
+	}
+
+	expected := values["code_hash"]
+	actual := hashVerificationCode(userID, strings.TrimSpace(code))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+		return "", ErrPhoneVerificationInvalid
+	}
+
+	phoneNumber := values["phone_number"]
+	if err := s.preferenceSvc.SetVerifiedPhoneNumber(ctx, userID, phoneNumber); err != nil {
+		return "", err
+	}
+	s.redisClient.Del(ctx, key)
+
+	s.logger.WithField("user_id", userID).Info("Phone number verified")
+	return phoneNumber, nil
+}
+
+// normalizePhoneNumber removes the separators people commonly type in phone numbers
+func normalizePhoneNumber(phoneNumber string) string {
+	return strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(strings.TrimSpace(phoneNumber))
+}
+
+// generateVerificationCode returns a random six digit code
+func generateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashVerificationCode(userID, code string) string {
+	sum := sha256.Sum256([]byte(userID + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,18 +2,40 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// maxPushDevices is the number of push devices kept per user, oldest first out
+const maxPushDevices = 10
+
+var (
+	ErrInvalidPushDevice  = errors.New("invalid push device")
+	ErrInvalidPreferences = errors.New("invalid preferences")
+)
+
+// chatWebhookHosts lists the hosts accepted for the webhooks of each chat channel. A
+// leading dot matches any subdomain.
+var chatWebhookHosts = map[models.NotificationChannel][]string{
+	models.ChannelSlack:   {"hooks.slack.com"},
+	models.ChannelDiscord: {"discord.com", "discordapp.com", "ptb.discord.com", "canary.discord.com"},
+	models.ChannelTeams:   {".webhook.office.com", ".logic.azure.com", ".environment.api.powerplatform.com"},
+}
+
 // PreferenceService handles user notification preferences
 type PreferenceService struct {
 	preferencesRepo *repository.PreferencesRepository
+	metrics         *metrics.Metrics
+	userDirectory   UserDirectory
 	logger          *logrus.Logger
 }
 
@@ -25,6 +47,17 @@ func NewPreferenceService(preferencesRepo *repository.PreferencesRepository, log
 	}
 }
 
+// SetMetrics enables recording preference update metrics
+func (s *PreferenceService) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
+// SetUserDirectory enables evaluating quiet hours in the timezone of the user's account
+// profile when the preferences do not set one
+func (s *PreferenceService) SetUserDirectory(directory UserDirectory) {
+	s.userDirectory = directory
+}
+
 // GetUserPreferences gets user notification preferences
 func (s *PreferenceService) GetUserPreferences(ctx context.Context, userID string) (*models.UserNotificationPreferences, error) {
 	preferences, err := s.preferencesRepo.GetByUserID(ctx, userID)
@@ -45,16 +78,39 @@ func (s *PreferenceService) GetUserPreferences(ctx context.Context, userID strin
 func (s *PreferenceService) UpdateUserPreferences(ctx context.Context, userID string, preferences *models.UserNotificationPreferences) error {
 	preferences.UserID = userID
 	preferences.UpdatedAt = time.Now()
+	// Devices are managed through RegisterPushDevice and UnregisterPushDevice
+	preferences.PushDevices = nil
+	// Suppressions are managed through SuppressEmail and ClearEmailSuppression
+	preferences.SuppressedEmails = nil
+
+	// The phone number can only be changed through phone verification
+	preferences.PhoneNumber = ""
+	preferences.PhoneVerified = false
+	existing, err := s.preferencesRepo.GetByUserID(ctx, userID)
+	if err != nil && err != repository.ErrPreferencesNotFound {
+		return fmt.Errorf("failed to get user preferences: %w", err)
+	}
+	if existing != nil {
+		preferences.PhoneNumber = existing.PhoneNumber
+		preferences.PhoneVerified = existing.PhoneVerified
+	}
+
+	locale, err := NormalizeLocale(preferences.Locale)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPreferences, err)
+	}
+	preferences.Locale = locale
 
 	// Validate preferences
 	if err := s.validatePreferences(preferences); err != nil {
-		return fmt.Errorf("invalid preferences: %w", err)
+		return fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
 	}
 
 	// Upsert preferences
 	if err := s.preferencesRepo.Upsert(ctx, preferences); err != nil {
 		return fmt.Errorf("failed to update user preferences: %w", err)
 	}
+	s.metrics.RecordPreferencesUpdated()
 
 	s.logger.WithField("user_id", userID).Info("User preferences updated successfully")
 	return nil
@@ -77,52 +133,87 @@ func (s *PreferenceService) GetChannelPriorities(ctx context.Context, userID str
 
 // IsInQuietHours checks if a user is currently in quiet hours
 func (s *PreferenceService) IsInQuietHours(ctx context.Context, userID string) (bool, error) {
+	_, inQuietHours, err := s.QuietHoursEnd(ctx, userID, time.Now())
+	return inQuietHours, err
+}
+
+// QuietHoursEnd reports whether a user is in quiet hours at now and, if so, when they
+// end. Quiet hours are evaluated in the user's local time.
+func (s *PreferenceService) QuietHoursEnd(ctx context.Context, userID string, now time.Time) (time.Time, bool, error) {
 	preferences, err := s.GetUserPreferences(ctx, userID)
 	if err != nil {
-		return false, err
+		return time.Time{}, false, err
 	}
 
 	if !preferences.QuietHoursEnabled {
-		return false, nil
+		return time.Time{}, false, nil
 	}
 
-	now := time.Now()
-	currentTime := now.Format("15:04")
-
-	// Check if current time is within quiet hours
-	return s.isTimeInQuietHours(currentTime, preferences.QuietHoursStart, preferences.QuietHoursEnd), nil
+	local := now.In(s.userLocation(ctx, preferences))
+	end, inQuietHours := s.quietHoursEnd(local, preferences.QuietHoursStart, preferences.QuietHoursEnd)
+	return end, inQuietHours, nil
 }
 
-// isTimeInQuietHours checks if current time is within quiet hours
-func (s *PreferenceService) isTimeInQuietHours(currentTime, startTime, endTime string) bool {
-	if startTime == "" || endTime == "" {
-		return false
+// userLocation returns the timezone of a user's preferences, else of the user's account
+// profile, else UTC
+func (s *PreferenceService) userLocation(ctx context.Context, preferences *models.UserNotificationPreferences) *time.Location {
+	timezone := preferences.Timezone
+	if timezone == "" && s.userDirectory != nil {
+		if profile, err := s.userDirectory.GetProfile(ctx, preferences.UserID); err == nil {
+			timezone = profile.Timezone
+		}
+	}
+	if timezone == "" {
+		return time.UTC
 	}
 
-	// Parse times
-	current, err := time.Parse("15:04", currentTime)
+	location, err := time.LoadLocation(timezone)
 	if err != nil {
-		return false
+		s.logger.WithError(err).WithField("user_id", preferences.UserID).Warn("Unknown timezone, using UTC for quiet hours")
+		return time.UTC
+	}
+	return location
+}
+
+// quietHoursEnd checks if a local time is within quiet hours, start and end minutes
+// included, and returns the first minute after the quiet hours
+func (s *PreferenceService) quietHoursEnd(local time.Time, startTime, endTime string) (time.Time, bool) {
+	if startTime == "" || endTime == "" {
+		return time.Time{}, false
 	}
 
 	start, err := time.Parse("15:04", startTime)
 	if err != nil {
-		return false
+		return time.Time{}, false
 	}
 
 	end, err := time.Parse("15:04", endTime)
 	if err != nil {
-		return false
+		return time.Time{}, false
 	}
 
-	// Check if quiet hours cross midnight
-	if start.After(end) {
+	current := local.Hour()*60 + local.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	var inQuietHours bool
+	if startMinute > endMinute {
 		// Quiet hours cross midnight (e.g., 22:00 to 08:00)
-		return current.After(start) || current.Before(end) || current.Equal(start) || current.Equal(end)
+		inQuietHours = current >= startMinute || current <= endMinute
 	} else {
-		// Quiet hours don't cross midnight (e.g., 22:00 to 23:00)
-		return (current.After(start) || current.Equal(start)) && (current.Before(end) || current.Equal(end))
+		// Quiet hours don't cross midnight (e.g., 13:00 to 14:00)
+		inQuietHours = current >= startMinute && current <= endMinute
 	}
+	if !inQuietHours {
+		return time.Time{}, false
+	}
+
+	// The next end of the quiet hours, in the user's timezone so DST changes are honored
+	endsAt := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, local.Location()).Add(time.Minute)
+	if !endsAt.After(local) {
+		endsAt = time.Date(local.Year(), local.Month(), local.Day()+1, end.Hour(), end.Minute(), 0, 0, local.Location()).Add(time.Minute)
+	}
+	return endsAt, true
 }
 
 // ShouldSendNotification checks if a notification should be sent based on user preferences
@@ -221,6 +312,251 @@ func (s *PreferenceService) GetFallbackChannels(ctx context.Context, userID stri
 	return fallbackChannels, nil
 }
 
+// ListPushDevices lists the push devices registered by a user
+func (s *PreferenceService) ListPushDevices(ctx context.Context, userID string) ([]models.PushDevice, error) {
+	devices, err := s.preferencesRepo.GetPushDevices(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get push devices: %w", err)
+	}
+	if devices == nil {
+		devices = []models.PushDevice{}
+	}
+	return devices, nil
+}
+
+// RegisterPushDevice registers an FCM registration token for a user and enables push
+// notifications
+func (s *PreferenceService) RegisterPushDevice(ctx context.Context, userID, token string, platform models.PushPlatform) (*models.PushDevice, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, fmt.Errorf("%w: token is required", ErrInvalidPushDevice)
+	}
+	switch platform {
+	case models.PushPlatformAndroid, models.PushPlatformIOS, models.PushPlatformWeb:
+	default:
+		return nil, fmt.Errorf("%w: platform must be android, ios or web", ErrInvalidPushDevice)
+	}
+
+	if err := s.ensurePreferences(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	device := &models.PushDevice{
+		Token:        token,
+		Platform:     platform,
+		RegisteredAt: time.Now(),
+	}
+	if err := s.preferencesRepo.AddPushDevice(ctx, userID, *device, maxPushDevices); err != nil {
+		return nil, fmt.Errorf("failed to register push device: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"platform": platform,
+	}).Info("Push device registered")
+	return device, nil
+}
+
+// UnregisterPushDevice removes a push device registered by a user
+func (s *PreferenceService) UnregisterPushDevice(ctx context.Context, userID, token string) error {
+	if err := s.preferencesRepo.RemovePushDevice(ctx, userID, token); err != nil {
+		return fmt.Errorf("failed to unregister push device: %w", err)
+	}
+
+	s.logger.WithField("user_id", userID).Info("Push device unregistered")
+	return nil
+}
+
+// SetVerifiedPhoneNumber saves a phone number the user has verified
+func (s *PreferenceService) SetVerifiedPhoneNumber(ctx context.Context, userID, phoneNumber string) error {
+	if err := s.ensurePreferences(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.preferencesRepo.SetPhoneNumber(ctx, userID, phoneNumber, true); err != nil {
+		return fmt.Errorf("failed to save phone number: %w", err)
+	}
+	return nil
+}
+
+// RemovePhoneNumber removes a user's phone number
+func (s *PreferenceService) RemovePhoneNumber(ctx context.Context, userID string) error {
+	err := s.preferencesRepo.SetPhoneNumber(ctx, userID, "", false)
+	if err != nil && err != repository.ErrPreferencesNotFound {
+		return fmt.Errorf("failed to remove phone number: %w", err)
+	}
+
+	s.logger.WithField("user_id", userID).Info("Phone number removed")
+	return nil
+}
+
+// SetWebhooksEnabled enables or disables the webhook channel of a user
+func (s *PreferenceService) SetWebhooksEnabled(ctx context.Context, userID string, enabled bool) error {
+	if err := s.ensurePreferences(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.preferencesRepo.SetWebhookEnabled(ctx, userID, enabled); err != nil {
+		return fmt.Errorf("failed to update webhook channel: %w", err)
+	}
+	return nil
+}
+
+// SuppressEmail stops emailing an address that bounced or whose recipient complained. The
+// suppression is recorded for userID, or for every user whose preferences hold the address
+// when userID is empty.
+func (s *PreferenceService) SuppressEmail(ctx context.Context, userID string, suppression models.EmailSuppression) error {
+	suppression.Address = strings.ToLower(strings.TrimSpace(suppression.Address))
+	if suppression.Address == "" {
+		return errors.New("email address is required")
+	}
+	if suppression.SuppressedAt.IsZero() {
+		suppression.SuppressedAt = time.Now()
+	}
+
+	userIDs := []string{userID}
+	if userID == "" {
+		var err error
+		userIDs, err = s.preferencesRepo.FindUserIDsByEmail(ctx, suppression.Address)
+		if err != nil {
+			return fmt.Errorf("failed to find users by email: %w", err)
+		}
+	}
+	if len(userIDs) == 0 {
+		s.logger.WithField("reason", suppression.Reason).Debug("No user found for suppressed email address")
+		return nil
+	}
+
+	for _, id := range userIDs {
+		if err := s.ensurePreferences(ctx, id); err != nil {
+			return err
+		}
+		added, err := s.preferencesRepo.AddEmailSuppression(ctx, id, suppression)
+		if err != nil {
+			return fmt.Errorf("failed to suppress email address: %w", err)
+		}
+		if added {
+			s.logger.WithFields(logrus.Fields{
+				"user_id":  id,
+				"reason":   suppression.Reason,
+				"provider": suppression.Provider,
+			}).Info("Email address suppressed")
+		}
+	}
+	return nil
+}
+
+// ClearEmailSuppression lets a user receive emails at a suppressed address again
+func (s *PreferenceService) ClearEmailSuppression(ctx context.Context, userID, address string) error {
+	err := s.preferencesRepo.RemoveEmailSuppression(ctx, userID, strings.ToLower(strings.TrimSpace(address)))
+	if err != nil {
+		if errors.Is(err, repository.ErrEmailSuppressionNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to clear email suppression: %w", err)
+	}
+
+	s.logger.WithField("user_id", userID).Info("Email suppression cleared")
+	return nil
+}
+
+// UnsubscribeFromEmail turns off email notifications of a user, for one-click
+// unsubscribes from the links in emails
+func (s *PreferenceService) UnsubscribeFromEmail(ctx context.Context, userID string) error {
+	if err := s.ensurePreferences(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.preferencesRepo.SetEmailEnabled(ctx, userID, false); err != nil {
+		return fmt.Errorf("failed to unsubscribe from email: %w", err)
+	}
+	s.metrics.RecordPreferencesUpdated()
+
+	s.logger.WithField("user_id", userID).Info("User unsubscribed from email notifications")
+	return nil
+}
+
+// GetPreferenceCenter gets the preferences a user manages from the preference center
+func (s *PreferenceService) GetPreferenceCenter(ctx context.Context, userID string) (*models.PreferenceCenter, error) {
+	preferences, err := s.GetUserPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return preferenceCenter(preferences), nil
+}
+
+// UpdatePreferenceCenter updates the preferences a user manages from the preference
+// center. Channels left out and nil event subscriptions are not changed.
+func (s *PreferenceService) UpdatePreferenceCenter(ctx context.Context, userID string, update *models.PreferenceCenter) (*models.PreferenceCenter, error) {
+	preferences, err := s.GetUserPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := preferenceCenterChannels(preferences)
+	for channel, enabled := range update.Channels {
+		setting, ok := settings[channel]
+		if !ok {
+			return nil, fmt.Errorf("%w: channel %s cannot be managed from the preference center", ErrInvalidPreferences, channel)
+		}
+		*setting = enabled
+	}
+	if update.EventSubscriptions != nil {
+		preferences.EventSubscriptions = update.EventSubscriptions
+	}
+
+	if err := s.UpdateUserPreferences(ctx, userID, preferences); err != nil {
+		return nil, err
+	}
+	return preferenceCenter(preferences), nil
+}
+
+// preferenceCenterChannels returns the enabled flags of the channels managed from the
+// preference center. Webhooks are managed with their endpoints.
+func preferenceCenterChannels(preferences *models.UserNotificationPreferences) map[models.NotificationChannel]*bool {
+	return map[models.NotificationChannel]*bool{
+		models.ChannelEmail:     &preferences.EmailEnabled,
+		models.ChannelSMS:       &preferences.SMSEnabled,
+		models.ChannelPush:      &preferences.PushEnabled,
+		models.ChannelInApp:     &preferences.InAppEnabled,
+		models.ChannelWebSocket: &preferences.WebSocketEnabled,
+		models.ChannelSlack:     &preferences.SlackEnabled,
+		models.ChannelDiscord:   &preferences.DiscordEnabled,
+		models.ChannelTeams:     &preferences.TeamsEnabled,
+	}
+}
+
+func preferenceCenter(preferences *models.UserNotificationPreferences) *models.PreferenceCenter {
+	center := &models.PreferenceCenter{
+		Channels:           make(map[models.NotificationChannel]bool),
+		EventSubscriptions: preferences.EventSubscriptions,
+	}
+	for channel, enabled := range preferenceCenterChannels(preferences) {
+		center.Channels[channel] = *enabled
+	}
+	if center.EventSubscriptions == nil {
+		center.EventSubscriptions = []models.EventType{}
+	}
+	return center
+}
+
+// ensurePreferences saves the default preferences of a user who has none, so partial
+// updates do not create a document holding only the updated fields
+func (s *PreferenceService) ensurePreferences(ctx context.Context, userID string) error {
+	_, err := s.preferencesRepo.GetByUserID(ctx, userID)
+	if err == nil {
+		return nil
+	}
+	if err != repository.ErrPreferencesNotFound {
+		return fmt.Errorf("failed to get user preferences: %w", err)
+	}
+
+	if err := s.preferencesRepo.Create(ctx, s.preferencesRepo.GetDefaultPreferences(userID)); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to create user preferences: %w", err)
+	}
+	return nil
+}
+
 // validatePreferences validates user preferences
 func (s *PreferenceService) validatePreferences(preferences *models.UserNotificationPreferences) error {
 	// Validate email format if provided
@@ -233,6 +569,25 @@ func (s *PreferenceService) validatePreferences(preferences *models.UserNotifica
 		return fmt.Errorf("invalid phone number format: %s", preferences.PhoneNumber)
 	}
 
+	// Validate chat webhooks, which must be set for their channel to be enabled
+	chatWebhooks := []struct {
+		channel models.NotificationChannel
+		enabled bool
+		url     string
+	}{
+		{models.ChannelSlack, preferences.SlackEnabled, preferences.SlackWebhookURL},
+		{models.ChannelDiscord, preferences.DiscordEnabled, preferences.DiscordWebhookURL},
+		{models.ChannelTeams, preferences.TeamsEnabled, preferences.TeamsWebhookURL},
+	}
+	for _, webhook := range chatWebhooks {
+		if webhook.url != "" && !s.isValidWebhookURL(webhook.channel, webhook.url) {
+			return fmt.Errorf("invalid %s webhook URL", webhook.channel)
+		}
+		if webhook.enabled && webhook.url == "" {
+			return fmt.Errorf("%s notifications require a webhook URL", webhook.channel)
+		}
+	}
+
 	// Validate quiet hours format
 	if preferences.QuietHoursEnabled {
 		if preferences.QuietHoursStart != "" && !s.isValidTimeFormat(preferences.QuietHoursStart) {
@@ -242,6 +597,11 @@ func (s *PreferenceService) validatePreferences(preferences *models.UserNotifica
 			return fmt.Errorf("invalid quiet hours end format: %s", preferences.QuietHoursEnd)
 		}
 	}
+	if preferences.Timezone != "" {
+		if _, err := time.LoadLocation(preferences.Timezone); err != nil || preferences.Timezone == "Local" {
+			return fmt.Errorf("invalid timezone: %s", preferences.Timezone)
+		}
+	}
 
 	// Validate event subscriptions
 	for _, eventType := range preferences.EventSubscriptions {
@@ -250,6 +610,25 @@ func (s *PreferenceService) validatePreferences(preferences *models.UserNotifica
 		}
 	}
 
+	// Validate channel priorities
+	for eventType, channels := range preferences.ChannelPriorities {
+		for _, channel := range channels {
+			if !s.isValidChannel(channel) {
+				return fmt.Errorf("invalid channel for %s: %s", eventType, channel)
+			}
+		}
+	}
+
+	// Validate rate limits
+	for eventType, limit := range preferences.EventRateLimits {
+		if !s.isValidEventType(eventType) {
+			return fmt.Errorf("invalid event type: %s", eventType)
+		}
+		if limit < 0 {
+			return fmt.Errorf("invalid rate limit for %s: %d", eventType, limit)
+		}
+	}
+
 	return nil
 }
 
@@ -278,6 +657,32 @@ func (s *PreferenceService) isValidPhoneNumber(phone string) bool {
 	return len(digits) >= 10 // Minimum 10 digits
 }
 
+// isValidWebhookURL checks that a webhook URL is an HTTPS URL of the chat service
+func (s *PreferenceService) isValidWebhookURL(channel models.NotificationChannel, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range chatWebhookHosts[channel] {
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return channel != models.ChannelDiscord || strings.HasPrefix(u.Path, "/api/webhooks/")
+		}
+	}
+	return false
+}
+
+// isValidChannel validates a notification channel
+func (s *PreferenceService) isValidChannel(channel models.NotificationChannel) bool {
+	switch channel {
+	case models.ChannelEmail, models.ChannelSMS, models.ChannelPush, models.ChannelInApp, models.ChannelWebSocket,
+		models.ChannelSlack, models.ChannelDiscord, models.ChannelTeams, models.ChannelWebhook:
+		return true
+	}
+	return false
+}
+
 // isValidTimeFormat validates time format (HH:MM)
 func (s *PreferenceService) isValidTimeFormat(timeStr string) bool {
 	_, err := time.Parse("15:04", timeStr)
@@ -6,6 +6,7 @@ import (
 	"math"
 	"time"
 
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 	"github.com/sirupsen/logrus"
@@ -16,6 +17,7 @@ type RetryService struct {
 	notifRepo *repository.NotificationRepository
 	dlqSvc    *DLQService
 	config    *RetryConfig
+	metrics   *metrics.Metrics
 	logger    *logrus.Logger
 }
 
@@ -45,6 +47,11 @@ func NewRetryService(
 	}
 }
 
+// SetMetrics enables recording retry metrics
+func (s *RetryService) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
 // RetryNotification retries a failed notification
 func (s *RetryService) RetryNotification(ctx context.Context, notification *models.Notification, retryFunc func(context.Context, *models.Notification) error) error {
 	// Check if notification has exceeded max retries
@@ -73,6 +80,7 @@ func (s *RetryService) RetryNotification(ctx context.Context, notification *mode
 	time.Sleep(delay)
 
 	// Attempt retry
+	s.metrics.RecordNotificationRetry(notification.Channel, notification.RetryCount+1)
 	start := time.Now()
 	err := retryFunc(ctx, notification)
 	duration := time.Since(start)
@@ -280,6 +288,7 @@ func (s *RetryService) RetryNotificationImmediately(ctx context.Context, notific
 	}
 
 	// Attempt retry immediately
+	s.metrics.RecordNotificationRetry(notification.Channel, notification.RetryCount+1)
 	start := time.Now()
 	err := retryFunc(ctx, notification)
 	duration := time.Since(start)
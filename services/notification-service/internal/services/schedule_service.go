@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
+)
+
+const (
+	// maxScheduleAhead is how far in the future a notification can be scheduled
+	maxScheduleAhead = 365 * 24 * time.Hour
+	// maxScheduleAttempts is the number of times sending a scheduled notification is
+	// attempted before it is marked as failed
+	maxScheduleAttempts  = 3
+	scheduleRetryDelay   = time.Minute
+	scheduleClaimTimeout = 5 * time.Minute
+	// maxDispatchPerTick bounds the notifications sent by one scheduler run
+	maxDispatchPerTick = 100
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// ScheduleService sends notifications at a later time. Scheduled notifications are
+// stored in MongoDB, so they survive restarts and are sent once by any replica.
+type ScheduleService struct {
+	scheduledRepo *repository.ScheduledNotificationRepository
+	notifSvc      *NotificationService
+	pollInterval  time.Duration
+	logger        *logrus.Logger
+}
+
+// NewScheduleService creates a new schedule service that checks for due notifications
+// every pollInterval
+func NewScheduleService(scheduledRepo *repository.ScheduledNotificationRepository, notifSvc *NotificationService, pollInterval time.Duration, logger *logrus.Logger) *ScheduleService {
+	return &ScheduleService{
+		scheduledRepo: scheduledRepo,
+		notifSvc:      notifSvc,
+		pollInterval:  pollInterval,
+		logger:        logger,
+	}
+}
+
+// ScheduleNotification schedules a notification to be sent at sendAt
+func (s *ScheduleService) ScheduleNotification(ctx context.Context, req *models.NotificationRequest, sendAt time.Time) (*models.ScheduledNotification, error) {
+	if err := s.notifSvc.validateRequest(req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if err := validateSendAt(sendAt); err != nil {
+		return nil, err
+	}
+
+	scheduled := &models.ScheduledNotification{
+		UserID:  req.UserID,
+		Request: *req,
+		SendAt:  sendAt.UTC(),
+	}
+	if err := s.scheduledRepo.Create(ctx, scheduled); err != nil {
+		return nil, fmt.Errorf("failed to schedule notification: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"scheduled_id": scheduled.ID.Hex(),
+		"user_id":      req.UserID,
+		"event_type":   req.EventType,
+		"send_at":      scheduled.SendAt,
+	}).Info("Notification scheduled")
+
+	return scheduled, nil
+}
+
+// DeferNotification holds back a notification suppressed by the recipient's quiet hours
+// until sendAt, when they end
+func (s *ScheduleService) DeferNotification(ctx context.Context, req *models.NotificationRequest, sendAt time.Time) (*models.ScheduledNotification, error) {
+	scheduled := &models.ScheduledNotification{
+		UserID:     req.UserID,
+		Request:    *req,
+		SendAt:     sendAt.UTC(),
+		QuietHours: true,
+	}
+	if err := s.scheduledRepo.Create(ctx, scheduled); err != nil {
+		return nil, fmt.Errorf("failed to defer notification: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"scheduled_id": scheduled.ID.Hex(),
+		"user_id":      req.UserID,
+		"event_type":   req.EventType,
+		"send_at":      scheduled.SendAt,
+	}).Debug("Notification deferred until quiet hours end")
+
+	return scheduled, nil
+}
+
+// CancelScheduledNotification cancels a notification that was not sent yet
+func (s *ScheduleService) CancelScheduledNotification(ctx context.Context, id string) (*models.ScheduledNotification, error) {
+	scheduled, err := s.scheduledRepo.Cancel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("scheduled_id", id).Info("Scheduled notification cancelled")
+	return scheduled, nil
+}
+
+// RescheduleNotification changes when a notification that was not sent yet is sent
+func (s *ScheduleService) RescheduleNotification(ctx context.Context, id string, sendAt time.Time) (*models.ScheduledNotification, error) {
+	if err := validateSendAt(sendAt); err != nil {
+		return nil, err
+	}
+
+	scheduled, err := s.scheduledRepo.Reschedule(ctx, id, sendAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"scheduled_id": id,
+		"send_at":      scheduled.SendAt,
+	}).Info("Scheduled notification rescheduled")
+	return scheduled, nil
+}
+
+// GetScheduledNotification gets a scheduled notification
+func (s *ScheduleService) GetScheduledNotification(ctx context.Context, id string) (*models.ScheduledNotification, error) {
+	return s.scheduledRepo.GetByID(ctx, id)
+}
+
+// GetScheduledNotifications gets scheduled notifications by send time with pagination.
+// Empty userID and status match all scheduled notifications.
+func (s *ScheduleService) GetScheduledNotifications(ctx context.Context, userID string, status models.ScheduledNotificationStatus, page, limit int) ([]*models.ScheduledNotification, int64, error) {
+	return s.scheduledRepo.List(ctx, userID, status, page, limit)
+}
+
+// StartScheduler sends scheduled notifications when they are due until ctx is done
+func (s *ScheduleService) StartScheduler(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	s.logger.Info("Notification scheduler started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Notification scheduler stopped")
+			return
+		case <-ticker.C:
+			s.dispatchDue(ctx)
+		}
+	}
+}
+
+// dispatchDue sends the scheduled notifications that are due
+func (s *ScheduleService) dispatchDue(ctx context.Context) {
+	for i := 0; i < maxDispatchPerTick && ctx.Err() == nil; i++ {
+		now := time.Now()
+		scheduled, err := s.scheduledRepo.ClaimDue(ctx, now, now.Add(-scheduleClaimTimeout))
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to claim due scheduled notification")
+			return
+		}
+		if scheduled == nil {
+			return
+		}
+		s.dispatch(ctx, scheduled)
+	}
+}
+
+// dispatch sends a claimed scheduled notification
+func (s *ScheduleService) dispatch(ctx context.Context, scheduled *models.ScheduledNotification) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"scheduled_id": scheduled.ID.Hex(),
+		"user_id":      scheduled.UserID,
+		"event_type":   scheduled.Request.EventType,
+		"attempt":      scheduled.Attempts,
+	})
+
+	// Wait for the end of the recipient's quiet hours rather than scheduling another
+	// notification for it
+	if !scheduled.Request.BypassQuietHours {
+		end, inQuietHours, err := s.notifSvc.preferenceSvc.QuietHoursEnd(ctx, scheduled.UserID, time.Now())
+		if err == nil && inQuietHours {
+			if err := s.scheduledRepo.Postpone(ctx, scheduled.ID, end.UTC()); err != nil {
+				logger.WithError(err).Error("Failed to postpone scheduled notification")
+				return
+			}
+			logger.WithField("send_at", end).Debug("Scheduled notification postponed until quiet hours end")
+			return
+		}
+	}
+
+	req := scheduled.Request
+	resp, err := s.notifSvc.SendNotification(ctx, &req)
+	if err == nil && resp.ID == "" && resp.Status == models.StatusFailed {
+		// The user's preferences rule the notification out, retrying would not help
+		logger.WithField("reason", resp.Error).Info("Scheduled notification not sent")
+		if err := s.scheduledRepo.MarkFailed(ctx, scheduled.ID, resp.Error); err != nil {
+			logger.WithError(err).Error("Failed to mark scheduled notification as failed")
+		}
+		return
+	}
+	if err == nil {
+		if err := s.scheduledRepo.MarkSent(ctx, scheduled.ID, resp.ID); err != nil {
+			logger.WithError(err).Error("Failed to mark scheduled notification as sent")
+			return
+		}
+		logger.WithField("notification_id", resp.ID).Info("Scheduled notification sent")
+		return
+	}
+
+	if scheduled.Attempts >= maxScheduleAttempts {
+		logger.WithError(err).Error("Failed to send scheduled notification, giving up")
+		if err := s.scheduledRepo.MarkFailed(ctx, scheduled.ID, err.Error()); err != nil {
+			logger.WithError(err).Error("Failed to mark scheduled notification as failed")
+		}
+		return
+	}
+
+	logger.WithError(err).Warn("Failed to send scheduled notification, will retry")
+	if err := s.scheduledRepo.Requeue(ctx, scheduled.ID, time.Now().Add(scheduleRetryDelay), err.Error()); err != nil {
+		logger.WithError(err).Error("Failed to requeue scheduled notification")
+	}
+}
+
+// validateSendAt checks that a notification is scheduled in the future, within
+// maxScheduleAhead
+func validateSendAt(sendAt time.Time) error {
+	if sendAt.IsZero() {
+		return fmt.Errorf("%w: send_at is required", ErrInvalidSchedule)
+	}
+	now := time.Now()
+	if !sendAt.After(now) {
+		return fmt.Errorf("%w: send_at must be in the future", ErrInvalidSchedule)
+	}
+	if sendAt.After(now.Add(maxScheduleAhead)) {
+		return fmt.Errorf("%w: send_at must be within %d days", ErrInvalidSchedule, int(maxScheduleAhead.Hours()/24))
+	}
+	return nil
+}
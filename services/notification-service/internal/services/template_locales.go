@@ -0,0 +1,200 @@
+package services
+
+import (
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+)
+
+// templateTranslation is the subject and body of a default template in another locale
+type templateTranslation struct {
+	Subject string
+	Body    string
+}
+
+// defaultTemplateTranslations holds the translations of the default templates, by locale
+// and template ID
+var defaultTemplateTranslations = map[string]map[string]templateTranslation{
+	"es": {
+		"file_uploaded_email": {
+			Subject: "✅ Archivo subido: {{.FileName}}",
+			Body:    "Hola {{.UserName}}:\n\nTu archivo '{{.FileName}}' ({{.FileSizeFormatted}}) se ha subido correctamente.\n\nSubido el: {{.Timestamp.Format \"02/01/2006 15:04:05\"}}\n\nSaludos,\nFile Sharing Platform",
+		},
+		"file_uploaded_sms": {
+			Subject: "Archivo subido",
+			Body:    "✅ {{.FileName}} se ha subido correctamente ({{.FileSizeFormatted}})",
+		},
+		"file_uploaded_push": {
+			Subject: "Archivo subido",
+			Body:    "{{.FileName}} se ha subido correctamente",
+		},
+		"file_uploaded_inapp": {
+			Subject: "Archivo subido",
+			Body:    "{{.FileName}} ({{.FileSizeFormatted}}) se ha subido correctamente",
+		},
+		"file_upload_failed_email": {
+			Subject: "❌ Error al subir el archivo: {{.FileName}}",
+			Body:    "Hola {{.UserName}}:\n\nLamentablemente, no se ha podido subir tu archivo '{{.FileName}}'.\n\nError: {{.ErrorMessage}}\n\nVuelve a intentarlo o ponte en contacto con soporte si el problema persiste.\n\nSaludos,\nFile Sharing Platform",
+		},
+		"file_upload_failed_sms": {
+			Subject: "Error al subir el archivo",
+			Body:    "❌ No se pudo subir {{.FileName}}: {{.ErrorMessage}}",
+		},
+		"file_deleted_email": {
+			Subject: "🗑️ Archivo eliminado: {{.FileName}}",
+			Body:    "Hola {{.UserName}}:\n\nTu archivo '{{.FileName}}' se ha eliminado.\n\nEliminado el: {{.Timestamp.Format \"02/01/2006 15:04:05\"}}\n\nSaludos,\nFile Sharing Platform",
+		},
+		"file_shared_email": {
+			Subject: "📁 Archivo compartido: {{.FileName}}",
+			Body:    "Hola {{.UserName}}:\n\nSe ha compartido contigo el archivo '{{.FileName}}'.\n\nCompartido el: {{.Timestamp.Format \"02/01/2006 15:04:05\"}}\n\nSaludos,\nFile Sharing Platform",
+		},
+		"quota_warning_80_email": {
+			Subject: "⚠️ Aviso de cuota de almacenamiento (80 %)",
+			Body:    "Hola {{.UserName}}:\n\nHas usado el 80 % de tu cuota de almacenamiento.\n\nUso actual: {{.FileSizeFormatted}}\n\nPlantéate mejorar tu plan o eliminar los archivos que no uses.\n\nSaludos,\nFile Sharing Platform",
+		},
+		"quota_warning_90_email": {
+			Subject: "⚠️ Aviso de cuota de almacenamiento (90 %)",
+			Body:    "Hola {{.UserName}}:\n\nHas usado el 90 % de tu cuota de almacenamiento.\n\nUso actual: {{.FileSizeFormatted}}\n\nMejora tu plan o elimina los archivos que no uses cuanto antes.\n\nSaludos,\nFile Sharing Platform",
+		},
+		"quota_exceeded_email": {
+			Subject: "🚨 Cuota de almacenamiento superada",
+			Body:    "Hola {{.UserName}}:\n\nHas superado tu cuota de almacenamiento.\n\nUso actual: {{.FileSizeFormatted}}\n\nMejora tu plan de inmediato para seguir usando el servicio.\n\nSaludos,\nFile Sharing Platform",
+		},
+		"security_alert_email": {
+			Subject: "🚨 Alerta de seguridad",
+			Body:    "Hola {{.UserName}}:\n\nSe ha activado una alerta de seguridad en tu cuenta.\n\nRevisa la actividad de tu cuenta y ponte en contacto con soporte si observas algo sospechoso.\n\nSaludos,\nFile Sharing Platform",
+		},
+		"system_maintenance_email": {
+			Subject: "🔧 Mantenimiento programado del sistema",
+			Body:    "Hola {{.UserName}}:\n\nHay un mantenimiento del sistema programado para el {{.Timestamp.Format \"02/01/2006 15:04:05\"}}.\n\nDurante ese tiempo, es posible que el servicio no esté disponible temporalmente.\n\nDisculpa las molestias.\n\nSaludos,\nFile Sharing Platform",
+		},
+	},
+	"fr": {
+		"file_uploaded_email": {
+			Subject: "✅ Fichier importé : {{.FileName}}",
+			Body:    "Bonjour {{.UserName}},\n\nVotre fichier « {{.FileName}} » ({{.FileSizeFormatted}}) a bien été importé.\n\nImporté le : {{.Timestamp.Format \"02/01/2006 15:04:05\"}}\n\nCordialement,\nFile Sharing Platform",
+		},
+		"file_uploaded_sms": {
+			Subject: "Fichier importé",
+			Body:    "✅ {{.FileName}} a bien été importé ({{.FileSizeFormatted}})",
+		},
+		"file_uploaded_push": {
+			Subject: "Fichier importé",
+			Body:    "{{.FileName}} a bien été importé",
+		},
+		"file_uploaded_inapp": {
+			Subject: "Fichier importé",
+			Body:    "{{.FileName}} ({{.FileSizeFormatted}}) a bien été importé",
+		},
+		"file_upload_failed_email": {
+			Subject: "❌ Échec de l'import : {{.FileName}}",
+			Body:    "Bonjour {{.UserName}},\n\nMalheureusement, votre fichier « {{.FileName}} » n'a pas pu être importé.\n\nErreur : {{.ErrorMessage}}\n\nVeuillez réessayer ou contacter le support si le problème persiste.\n\nCordialement,\nFile Sharing Platform",
+		},
+		"file_upload_failed_sms": {
+			Subject: "Échec de l'import",
+			Body:    "❌ Échec de l'import de {{.FileName}} : {{.ErrorMessage}}",
+		},
+		"file_deleted_email": {
+			Subject: "🗑️ Fichier supprimé : {{.FileName}}",
+			Body:    "Bonjour {{.UserName}},\n\nVotre fichier « {{.FileName}} » a été supprimé.\n\nSupprimé le : {{.Timestamp.Format \"02/01/2006 15:04:05\"}}\n\nCordialement,\nFile Sharing Platform",
+		},
+		"file_shared_email": {
+			Subject: "📁 Fichier partagé : {{.FileName}}",
+			Body:    "Bonjour {{.UserName}},\n\nLe fichier « {{.FileName}} » a été partagé avec vous.\n\nPartagé le : {{.Timestamp.Format \"02/01/2006 15:04:05\"}}\n\nCordialement,\nFile Sharing Platform",
+		},
+		"quota_warning_80_email": {
+			Subject: "⚠️ Alerte de quota de stockage (80 %)",
+			Body:    "Bonjour {{.UserName}},\n\nVous avez utilisé 80 % de votre quota de stockage.\n\nUtilisation actuelle : {{.FileSizeFormatted}}\n\nPensez à changer d'offre ou à supprimer les fichiers inutilisés.\n\nCordialement,\nFile Sharing Platform",
+		},
+		"quota_warning_90_email": {
+			Subject: "⚠️ Alerte de quota de stockage (90 %)",
+			Body:    "Bonjour {{.UserName}},\n\nVous avez utilisé 90 % de votre quota de stockage.\n\nUtilisation actuelle : {{.FileSizeFormatted}}\n\nVeuillez changer d'offre ou supprimer les fichiers inutilisés dès maintenant.\n\nCordialement,\nFile Sharing Platform",
+		},
+		"quota_exceeded_email": {
+			Subject: "🚨 Quota de stockage dépassé",
+			Body:    "Bonjour {{.UserName}},\n\nVous avez dépassé votre quota de stockage.\n\nUtilisation actuelle : {{.FileSizeFormatted}}\n\nVeuillez changer d'offre immédiatement pour continuer à utiliser le service.\n\nCordialement,\nFile Sharing Platform",
+		},
+		"security_alert_email": {
+			Subject: "🚨 Alerte de sécurité",
+			Body:    "Bonjour {{.UserName}},\n\nUne alerte de sécurité a été déclenchée sur votre compte.\n\nVérifiez l'activité de votre compte et contactez le support si vous remarquez une activité suspecte.\n\nCordialement,\nFile Sharing Platform",
+		},
+		"system_maintenance_email": {
+			Subject: "🔧 Maintenance du système programmée",
+			Body:    "Bonjour {{.UserName}},\n\nUne maintenance du système est programmée le {{.Timestamp.Format \"02/01/2006 15:04:05\"}}.\n\nPendant cette période, le service peut être temporairement indisponible.\n\nNous vous prions de nous excuser pour la gêne occasionnée.\n\nCordialement,\nFile Sharing Platform",
+		},
+	},
+	"de": {
+		"file_uploaded_email": {
+			Subject: "✅ Datei hochgeladen: {{.FileName}}",
+			Body:    "Hallo {{.UserName}},\n\nIhre Datei „{{.FileName}}“ ({{.FileSizeFormatted}}) wurde erfolgreich hochgeladen.\n\nHochgeladen am: {{.Timestamp.Format \"02.01.2006 15:04:05\"}}\n\nViele Grüße\nFile Sharing Platform",
+		},
+		"file_uploaded_sms": {
+			Subject: "Datei hochgeladen",
+			Body:    "✅ {{.FileName}} wurde erfolgreich hochgeladen ({{.FileSizeFormatted}})",
+		},
+		"file_uploaded_push": {
+			Subject: "Datei hochgeladen",
+			Body:    "{{.FileName}} wurde erfolgreich hochgeladen",
+		},
+		"file_uploaded_inapp": {
+			Subject: "Datei hochgeladen",
+			Body:    "{{.FileName}} ({{.FileSizeFormatted}}) wurde erfolgreich hochgeladen",
+		},
+		"file_upload_failed_email": {
+			Subject: "❌ Hochladen fehlgeschlagen: {{.FileName}}",
+			Body:    "Hallo {{.UserName}},\n\nIhre Datei „{{.FileName}}“ konnte leider nicht hochgeladen werden.\n\nFehler: {{.ErrorMessage}}\n\nBitte versuchen Sie es erneut oder wenden Sie sich an den Support, falls das Problem weiterhin besteht.\n\nViele Grüße\nFile Sharing Platform",
+		},
+		"file_upload_failed_sms": {
+			Subject: "Hochladen fehlgeschlagen",
+			Body:    "❌ {{.FileName}} konnte nicht hochgeladen werden: {{.ErrorMessage}}",
+		},
+		"file_deleted_email": {
+			Subject: "🗑️ Datei gelöscht: {{.FileName}}",
+			Body:    "Hallo {{.UserName}},\n\nIhre Datei „{{.FileName}}“ wurde gelöscht.\n\nGelöscht am: {{.Timestamp.Format \"02.01.2006 15:04:05\"}}\n\nViele Grüße\nFile Sharing Platform",
+		},
+		"file_shared_email": {
+			Subject: "📁 Datei geteilt: {{.FileName}}",
+			Body:    "Hallo {{.UserName}},\n\ndie Datei „{{.FileName}}“ wurde mit Ihnen geteilt.\n\nGeteilt am: {{.Timestamp.Format \"02.01.2006 15:04:05\"}}\n\nViele Grüße\nFile Sharing Platform",
+		},
+		"quota_warning_80_email": {
+			Subject: "⚠️ Speicherplatzwarnung (80 %)",
+			Body:    "Hallo {{.UserName}},\n\nSie haben 80 % Ihres Speicherplatzes belegt.\n\nAktuelle Nutzung: {{.FileSizeFormatted}}\n\nErwägen Sie ein Upgrade Ihres Tarifs oder löschen Sie nicht mehr benötigte Dateien.\n\nViele Grüße\nFile Sharing Platform",
+		},
+		"quota_warning_90_email": {
+			Subject: "⚠️ Speicherplatzwarnung (90 %)",
+			Body:    "Hallo {{.UserName}},\n\nSie haben 90 % Ihres Speicherplatzes belegt.\n\nAktuelle Nutzung: {{.FileSizeFormatted}}\n\nBitte führen Sie umgehend ein Upgrade Ihres Tarifs durch oder löschen Sie nicht mehr benötigte Dateien.\n\nViele Grüße\nFile Sharing Platform",
+		},
+		"quota_exceeded_email": {
+			Subject: "🚨 Speicherplatz überschritten",
+			Body:    "Hallo {{.UserName}},\n\nSie haben Ihren Speicherplatz überschritten.\n\nAktuelle Nutzung: {{.FileSizeFormatted}}\n\nBitte führen Sie umgehend ein Upgrade Ihres Tarifs durch, um den Dienst weiter nutzen zu können.\n\nViele Grüße\nFile Sharing Platform",
+		},
+		"security_alert_email": {
+			Subject: "🚨 Sicherheitswarnung",
+			Body:    "Hallo {{.UserName}},\n\nfür Ihr Konto wurde eine Sicherheitswarnung ausgelöst.\n\nBitte prüfen Sie die Aktivitäten in Ihrem Konto und wenden Sie sich an den Support, wenn Ihnen etwas verdächtig vorkommt.\n\nViele Grüße\nFile Sharing Platform",
+		},
+		"system_maintenance_email": {
+			Subject: "🔧 Geplante Systemwartung",
+			Body:    "Hallo {{.UserName}},\n\nfür den {{.Timestamp.Format \"02.01.2006 15:04:05\"}} ist eine Systemwartung geplant.\n\nWährend dieser Zeit ist der Dienst möglicherweise vorübergehend nicht verfügbar.\n\nWir bitten um Ihr Verständnis.\n\nViele Grüße\nFile Sharing Platform",
+		},
+	},
+}
+
+// localizeDefaultTemplates returns the translations of the default templates. The
+// template IDs of translations end with the locale, such as "file_uploaded_email_es".
+func localizeDefaultTemplates(templates []*models.NotificationTemplate) []*models.NotificationTemplate {
+	var localized []*models.NotificationTemplate
+	for locale, translations := range defaultTemplateTranslations {
+		for _, tmpl := range templates {
+			translation, ok := translations[tmpl.TemplateID]
+			if !ok {
+				continue
+			}
+
+			copied := *tmpl
+			copied.TemplateID = tmpl.TemplateID + "_" + locale
+			copied.Locale = locale
+			copied.SubjectTemplate = translation.Subject
+			copied.BodyTemplate = translation.Body
+			localized = append(localized, &copied)
+		}
+	}
+	return localized
+}
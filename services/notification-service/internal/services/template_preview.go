@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+)
+
+// TemplatePreview is a template rendered against sample data
+type TemplatePreview struct {
+	TemplateID string   `json:"template_id"`
+	Locale     string   `json:"locale,omitempty"`
+	IsActive   bool     `json:"is_active"`
+	Valid      bool     `json:"valid"`
+	Subject    string   `json:"subject,omitempty"`
+	Body       string   `json:"body,omitempty"`
+	HTML       string   `json:"html,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// templateDataType is the type templates are executed against
+var templateDataType = reflect.TypeOf(models.TemplateData{})
+
+// PreviewTemplate renders a stored template, active or not, against sample data. sample
+// holds TemplateData fields as JSON; fields it leaves out get example values. Template
+// syntax errors, references to fields TemplateData does not have and unknown sample
+// fields are reported in the preview's Errors instead of failing.
+func (s *TemplateService) PreviewTemplate(ctx context.Context, templateID string, sample json.RawMessage) (*TemplatePreview, error) {
+	tmpl, err := s.templateRepo.GetByTemplateID(ctx, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &TemplatePreview{
+		TemplateID: tmpl.TemplateID,
+		Locale:     tmpl.Locale,
+		IsActive:   tmpl.IsActive,
+	}
+
+	data, dataErrors := s.sampleTemplateData(sample)
+	preview.Errors = append(preview.Errors, dataErrors...)
+
+	type previewPart struct {
+		name   string
+		source string
+		result *string
+		html   bool
+	}
+	parts := []previewPart{
+		{"subject", tmpl.SubjectTemplate, &preview.Subject, false},
+		{"body", tmpl.BodyTemplate, &preview.Body, false},
+	}
+	if tmpl.HTMLTemplate != "" {
+		parts = append(parts, previewPart{"html", tmpl.HTMLTemplate, &preview.HTML, true})
+	}
+	for _, part := range parts {
+		rendered, errs := renderPreview(part.name, part.source, data, part.html)
+		*part.result = rendered
+		preview.Errors = append(preview.Errors, errs...)
+	}
+
+	preview.Valid = len(preview.Errors) == 0
+	return preview, nil
+}
+
+// sampleTemplateData decodes sample data over example values, reporting fields that
+// TemplateData does not have
+func (s *TemplateService) sampleTemplateData(sample json.RawMessage) (*models.TemplateData, []string) {
+	data := &models.TemplateData{
+		UserName:     "Alex Doe",
+		FileName:     "quarterly-report.pdf",
+		FileSize:     2_621_440,
+		Timestamp:    time.Now(),
+		ErrorMessage: "upload interrupted",
+		Count:        3,
+		Items: []models.BatchItem{
+			{FileName: "notes.txt", FileSize: 2048, Timestamp: time.Now()},
+		},
+		Metadata: map[string]interface{}{},
+	}
+
+	var errs []string
+	if len(bytes.TrimSpace(sample)) > 0 && string(bytes.TrimSpace(sample)) != "null" {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(sample, &fields); err != nil {
+			return data, []string{fmt.Sprintf("data: %v", err)}
+		}
+
+		known := jsonFieldNames(templateDataType)
+		var unknown []string
+		for name := range fields {
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			errs = append(errs, fmt.Sprintf("data: unknown field %q", name))
+		}
+
+		if err := json.Unmarshal(sample, data); err != nil {
+			errs = append(errs, fmt.Sprintf("data: %v", err))
+		}
+	}
+
+	if data.FileSize > 0 && data.FileSizeFormatted == "" {
+		data.FileSizeFormatted = s.FormatFileSize(data.FileSize)
+	}
+
+	return data, errs
+}
+
+// renderPreview parses, checks and executes one template, as HTML if html is set and as
+// plain text otherwise
+func renderPreview(name, source string, data *models.TemplateData, html bool) (string, []string) {
+	var tree *parse.Tree
+	var execute func(io.Writer, interface{}) error
+	if html {
+		tmpl, err := htmltemplate.New(name).Parse(source)
+		if err != nil {
+			return "", []string{fmt.Sprintf("%s: %v", name, err)}
+		}
+		tree, execute = tmpl.Tree, tmpl.Execute
+	} else {
+		tmpl, err := template.New(name).Parse(source)
+		if err != nil {
+			return "", []string{fmt.Sprintf("%s: %v", name, err)}
+		}
+		tree, execute = tmpl.Tree, tmpl.Execute
+	}
+
+	if tree != nil {
+		checker := &templateFieldChecker{root: templateDataType}
+		checker.walk(tree.Root, templateDataType)
+		if len(checker.unknown) > 0 {
+			errs := make([]string, 0, len(checker.unknown))
+			for _, field := range checker.unknown {
+				errs = append(errs, fmt.Sprintf("%s: unknown field %s", name, field))
+			}
+			return "", errs
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := execute(&buf, data); err != nil {
+		return "", []string{fmt.Sprintf("%s: %v", name, err)}
+	}
+	return buf.String(), nil
+}
+
+// templateFieldChecker finds field references that do not exist on the data a template
+// is executed against. Fields of maps and interfaces cannot be checked and are accepted.
+type templateFieldChecker struct {
+	root    reflect.Type
+	unknown []string
+}
+
+func (c *templateFieldChecker) walk(node parse.Node, dot reflect.Type) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.walk(child, dot)
+		}
+	case *parse.ActionNode:
+		c.pipeType(n.Pipe, dot)
+	case *parse.IfNode:
+		c.pipeType(n.Pipe, dot)
+		c.walk(n.List, dot)
+		c.walk(n.ElseList, dot)
+	case *parse.WithNode:
+		c.walk(n.List, c.pipeType(n.Pipe, dot))
+		c.walk(n.ElseList, dot)
+	case *parse.RangeNode:
+		c.walk(n.List, elemType(c.pipeType(n.Pipe, dot)))
+		c.walk(n.ElseList, dot)
+	}
+}
+
+// pipeType checks the fields used in a pipeline and returns the type it evaluates to, or
+// nil when that is not known
+func (c *templateFieldChecker) pipeType(pipe *parse.PipeNode, dot reflect.Type) reflect.Type {
+	if pipe == nil {
+		return nil
+	}
+
+	var result reflect.Type
+	for _, cmd := range pipe.Cmds {
+		result = nil
+		for i, arg := range cmd.Args {
+			var t reflect.Type
+			switch a := arg.(type) {
+			case *parse.FieldNode:
+				t = c.fieldType(dot, a.Ident)
+			case *parse.VariableNode:
+				// $ is the data the template was executed with
+				if len(a.Ident) > 1 && a.Ident[0] == "$" {
+					t = c.fieldType(c.root, a.Ident[1:])
+				}
+			case *parse.ChainNode:
+				if p, ok := a.Node.(*parse.PipeNode); ok {
+					t = c.fieldType(c.pipeType(p, dot), a.Field)
+				}
+			case *parse.PipeNode:
+				t = c.pipeType(a, dot)
+			case *parse.DotNode:
+				t = dot
+			}
+			if i == 0 {
+				result = t
+			}
+		}
+		// Function calls return types that are not tracked
+		if len(cmd.Args) > 1 {
+			result = nil
+		}
+	}
+
+	// Variable declarations do not change what the pipeline evaluates to
+	return result
+}
+
+// fieldType follows a chain of field and method names from t, recording the first name
+// that does not exist
+func (c *templateFieldChecker) fieldType(t reflect.Type, idents []string) reflect.Type {
+	for _, ident := range idents {
+		if t == nil {
+			return nil
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if method, ok := reflect.PointerTo(t).MethodByName(ident); ok {
+			if method.Type.NumOut() == 0 {
+				return nil
+			}
+			t = method.Type.Out(0)
+			continue
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := t.FieldByName(ident)
+			if !ok || !field.IsExported() {
+				c.unknown = append(c.unknown, "."+strings.Join(idents, "."))
+				return nil
+			}
+			t = field.Type
+		case reflect.Map, reflect.Interface:
+			return nil
+		default:
+			c.unknown = append(c.unknown, "."+strings.Join(idents, "."))
+			return nil
+		}
+	}
+	return t
+}
+
+// elemType returns the type range assigns to dot when ranging over t
+func elemType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return t.Elem()
+	}
+	return nil
+}
+
+// jsonFieldNames returns the JSON names of a struct's fields
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
@@ -3,15 +3,28 @@ package services
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"html/template"
+	htmltemplate "html/template"
+	"regexp"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/email"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
 )
 
+var (
+	ErrInvalidLocale        = errors.New("locale must be a BCP 47 language tag, such as en or pt-BR")
+	ErrInvalidEmailTemplate = errors.New("invalid email template")
+)
+
+// localePattern matches normalized BCP 47 language tags
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
 // TemplateService handles notification templates
 type TemplateService struct {
 	templateRepo *repository.TemplateRepository
@@ -30,12 +43,14 @@ func NewTemplateService(templateRepo *repository.TemplateRepository, logger *log
 
 // RenderNotification renders a notification using templates
 func (s *TemplateService) RenderNotification(ctx context.Context, req *models.NotificationRequest, templateData *models.TemplateData) (*models.NotificationRequest, error) {
-	// Get template for event type and channel
-	tmpl, err := s.getTemplate(ctx, req.EventType, req.Channel)
+	// Get template for event type, channel and the recipient's locale
+	locale, _ := req.Metadata["locale"].(string)
+	tmpl, err := s.getTemplate(ctx, req.EventType, req.Channel, locale)
 	if err != nil {
 		s.logger.WithError(err).WithFields(logrus.Fields{
 			"event_type": req.EventType,
 			"channel":    req.Channel,
+			"locale":     locale,
 		}).Warn("Template not found, using default formatting")
 
 		// Use default formatting if template not found
@@ -56,6 +71,22 @@ func (s *TemplateService) RenderNotification(ctx context.Context, req *models.No
 		return req, fmt.Errorf("failed to render body template: %w", err)
 	}
 
+	// Render the HTML part of emails
+	if req.Channel == models.ChannelEmail && tmpl.HTMLTemplate != "" {
+		html, err := s.renderHTMLTemplate(tmpl.HTMLTemplate, templateData)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to render HTML template")
+			return req, fmt.Errorf("failed to render HTML template: %w", err)
+		}
+		req.HTMLMessage = html
+	}
+	if req.Channel == models.ChannelEmail && tmpl.Layout != "" {
+		if req.Metadata == nil {
+			req.Metadata = make(map[string]interface{})
+		}
+		req.Metadata["email_layout"] = tmpl.Layout
+	}
+
 	// Update request with rendered content
 	req.Title = subject
 	req.Message = body
@@ -64,27 +95,70 @@ func (s *TemplateService) RenderNotification(ctx context.Context, req *models.No
 	return req, nil
 }
 
-// getTemplate gets a template for the given event type and channel
-func (s *TemplateService) getTemplate(ctx context.Context, eventType models.EventType, channel models.NotificationChannel) (*models.NotificationTemplate, error) {
+// getTemplate gets a template for the given event type and channel in the closest
+// available locale: the locale itself, its language without region, then the default
+// locale
+func (s *TemplateService) getTemplate(ctx context.Context, eventType models.EventType, channel models.NotificationChannel, locale string) (*models.NotificationTemplate, error) {
+	locale, err := NormalizeLocale(locale)
+	if err != nil || locale == "" {
+		locale = models.DefaultLocale
+	}
+
 	// Check cache first
-	cacheKey := fmt.Sprintf("%s_%s", eventType, channel)
+	cacheKey := fmt.Sprintf("%s_%s_%s", eventType, channel, locale)
 	if tmpl, exists := s.cache[cacheKey]; exists {
 		return tmpl, nil
 	}
 
 	// Get from database
-	tmpl, err := s.templateRepo.GetByEventTypeAndChannel(ctx, eventType, channel)
-	if err != nil {
-		return nil, err
+	for _, candidate := range localeFallbacks(locale) {
+		tmpl, err := s.templateRepo.GetByEventTypeChannelAndLocale(ctx, eventType, channel, candidate)
+		if err == repository.ErrTemplateNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Cache the template
+		s.cache[cacheKey] = tmpl
+		return tmpl, nil
 	}
 
-	// Cache the template
-	s.cache[cacheKey] = tmpl
+	return nil, repository.ErrTemplateNotFound
+}
+
+// NormalizeLocale lowercases a language tag and uses hyphens as separators, so "pt_BR"
+// becomes "pt-br". An empty locale stays empty.
+func NormalizeLocale(locale string) (string, error) {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if locale == "" {
+		return "", nil
+	}
+	if !localePattern.MatchString(locale) {
+		return "", ErrInvalidLocale
+	}
+	return locale, nil
+}
 
-	return tmpl, nil
+// localeFallbacks returns the locales to look templates up in, most specific first
+func localeFallbacks(locale string) []string {
+	var locales []string
+	for {
+		locales = append(locales, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	if locales[len(locales)-1] != models.DefaultLocale {
+		locales = append(locales, models.DefaultLocale)
+	}
+	return locales
 }
 
-// renderTemplate renders a template with the given data
+// renderTemplate renders a plain text template with the given data
 func (s *TemplateService) renderTemplate(templateStr string, data *models.TemplateData) (string, error) {
 	tmpl, err := template.New("notification").Parse(templateStr)
 	if err != nil {
@@ -99,6 +173,42 @@ func (s *TemplateService) renderTemplate(templateStr string, data *models.Templa
 	return buf.String(), nil
 }
 
+// renderHTMLTemplate renders an HTML template with the given data, escaping the values
+// it inserts
+func (s *TemplateService) renderHTMLTemplate(templateStr string, data *models.TemplateData) (string, error) {
+	tmpl, err := htmltemplate.New("notification").Parse(templateStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// validateEmailTemplate checks the HTML template and layout of a template for a channel.
+// Only email templates can have them.
+func validateEmailTemplate(channel models.NotificationChannel, tmpl *models.NotificationTemplate) error {
+	if tmpl.HTMLTemplate == "" && tmpl.Layout == "" {
+		return nil
+	}
+	if channel != models.ChannelEmail {
+		return fmt.Errorf("%w: only email templates have an HTML template or layout", ErrInvalidEmailTemplate)
+	}
+	if tmpl.Layout != "" && !email.HasLayout(tmpl.Layout) {
+		return fmt.Errorf("%w: unknown layout %q", ErrInvalidEmailTemplate, tmpl.Layout)
+	}
+	if tmpl.HTMLTemplate != "" {
+		if _, err := htmltemplate.New("html").Parse(tmpl.HTMLTemplate); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEmailTemplate, err)
+		}
+	}
+	return nil
+}
+
 // applyDefaultFormatting applies default formatting when no template is found
 func (s *TemplateService) applyDefaultFormatting(req *models.NotificationRequest, data *models.TemplateData) *models.NotificationRequest {
 	// Create a copy of the request
@@ -130,6 +240,9 @@ func (s *TemplateService) applyDefaultFormatting(req *models.NotificationRequest
 	case models.EventTypeSecurityAlert:
 		formattedReq.Title = "Security Alert"
 		formattedReq.Message = "A security alert has been triggered"
+		if summary, ok := data.Metadata["summary"].(string); ok && summary != "" {
+			formattedReq.Message = summary
+		}
 	case models.EventTypeSystemMaintenance:
 		formattedReq.Title = "System Maintenance"
 		formattedReq.Message = "System maintenance is scheduled"
@@ -164,8 +277,18 @@ func (s *TemplateService) CreateDefaultTemplates(ctx context.Context) error {
 	return nil
 }
 
-// getDefaultTemplates returns default templates
+// getDefaultTemplates returns default templates in the default locale and their
+// translations
 func (s *TemplateService) getDefaultTemplates() []*models.NotificationTemplate {
+	templates := s.getDefaultLocaleTemplates()
+	for _, tmpl := range templates {
+		tmpl.Locale = models.DefaultLocale
+	}
+	return append(templates, localizeDefaultTemplates(templates)...)
+}
+
+// getDefaultLocaleTemplates returns the default templates in the default locale
+func (s *TemplateService) getDefaultLocaleTemplates() []*models.NotificationTemplate {
 	now := time.Now()
 
 	return []*models.NotificationTemplate{
@@ -296,7 +419,7 @@ func (s *TemplateService) getDefaultTemplates() []*models.NotificationTemplate {
 			EventType:       models.EventTypeSecurityAlert,
 			Channel:         models.ChannelEmail,
 			SubjectTemplate: "🚨 Security Alert",
-			BodyTemplate:    "Hello {{.UserName}},\n\nA security alert has been triggered for your account.\n\nPlease review your account activity and contact support if you notice any suspicious activity.\n\nBest regards,\nFile Sharing Platform",
+			BodyTemplate:    "Hello {{.UserName}},\n\nA security alert has been triggered for your account.\n\n{{with index .Metadata \"summary\"}}{{.}}\n\n{{end}}Please review your account activity and contact support if you notice any suspicious activity.\n\nBest regards,\nFile Sharing Platform",
 			IsActive:        true,
 			CreatedAt:       now,
 			UpdatedAt:       now,
@@ -312,6 +435,50 @@ func (s *TemplateService) getDefaultTemplates() []*models.NotificationTemplate {
 			CreatedAt:       now,
 			UpdatedAt:       now,
 		},
+		// Payment Succeeded - Email, the receipt of a subscription payment
+		{
+			TemplateID:      "payment_succeeded_email",
+			EventType:       models.EventTypePaymentSucceeded,
+			Channel:         models.ChannelEmail,
+			SubjectTemplate: "Receipt for your {{index .Metadata \"plan_name\"}} plan",
+			BodyTemplate:    "Hello {{.UserName}},\n\nThanks for your payment of {{index .Metadata \"amount\"}} for the {{index .Metadata \"plan_name\"}} plan. Your plan is active until {{index .Metadata \"period_end\"}}.\n\n{{with index .Metadata \"invoice_number\"}}Your invoice {{.}} is available to download from your billing page.\n\n{{end}}{{with index .Metadata \"billing_url\"}}Manage your subscription: {{.}}\n\n{{end}}Best regards,\nFile Sharing Platform",
+			IsActive:        true,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		},
+		// Payment Failed - Email
+		{
+			TemplateID:      "payment_failed_email",
+			EventType:       models.EventTypePaymentFailed,
+			Channel:         models.ChannelEmail,
+			SubjectTemplate: "Payment failed for your {{index .Metadata \"plan_name\"}} plan",
+			BodyTemplate:    "Hello {{.UserName}},\n\nWe couldn't collect the payment{{with index .Metadata \"amount\"}} of {{.}}{{end}} for your {{index .Metadata \"plan_name\"}} plan.\n\n{{with index .Metadata \"grace_period_end\"}}Your plan stays active until {{.}} while we retry the payment. If it isn't paid by then, you'll be moved to the Free plan.\n\n{{end}}{{with index .Metadata \"payment_url\"}}Pay now with another payment method: {{.}}\n\n{{end}}Best regards,\nFile Sharing Platform",
+			IsActive:        true,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		},
+		// Subscription Renewed - Email, the receipt of a renewal payment
+		{
+			TemplateID:      "subscription_renewed_email",
+			EventType:       models.EventTypeSubscriptionRenewed,
+			Channel:         models.ChannelEmail,
+			SubjectTemplate: "Your {{index .Metadata \"plan_name\"}} plan has been renewed",
+			BodyTemplate:    "Hello {{.UserName}},\n\nYour {{index .Metadata \"plan_name\"}} plan has been renewed until {{index .Metadata \"period_end\"}}, and we received your payment of {{index .Metadata \"amount\"}}.\n\n{{with index .Metadata \"invoice_number\"}}Your invoice {{.}} is available to download from your billing page.\n\n{{end}}{{with index .Metadata \"billing_url\"}}Manage your subscription: {{.}}\n\n{{end}}Best regards,\nFile Sharing Platform",
+			IsActive:        true,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		},
+		// Subscription Cancelled - Email
+		{
+			TemplateID:      "subscription_cancelled_email",
+			EventType:       models.EventTypeSubscriptionCancelled,
+			Channel:         models.ChannelEmail,
+			SubjectTemplate: "Your {{index .Metadata \"plan_name\"}} plan has been cancelled",
+			BodyTemplate:    "Hello {{.UserName}},\n\nYour {{index .Metadata \"plan_name\"}} plan has been cancelled and you're now on the Free plan. Your files are kept, but uploads are paused while you use more storage than the Free plan includes.\n\n{{with index .Metadata \"billing_url\"}}You can subscribe again at any time: {{.}}\n\n{{end}}Best regards,\nFile Sharing Platform",
+			IsActive:        true,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		},
 	}
 }
 
@@ -402,12 +569,32 @@ func (s *TemplateService) GetCacheSize() int {
 }
 
 // GetTemplates gets templates with pagination and filtering
-func (s *TemplateService) GetTemplates(ctx context.Context, page, limit int, eventTypeFilter *models.EventType, channelFilter *models.NotificationChannel) ([]*models.NotificationTemplate, int64, error) {
-	return s.templateRepo.GetAll(ctx, page, limit, eventTypeFilter, channelFilter)
+func (s *TemplateService) GetTemplates(ctx context.Context, page, limit int, eventTypeFilter *models.EventType, channelFilter *models.NotificationChannel, localeFilter *string) ([]*models.NotificationTemplate, int64, error) {
+	if localeFilter != nil {
+		locale, err := NormalizeLocale(*localeFilter)
+		if err != nil {
+			return nil, 0, err
+		}
+		localeFilter = &locale
+	}
+	return s.templateRepo.GetAll(ctx, page, limit, eventTypeFilter, channelFilter, localeFilter)
 }
 
 // CreateTemplate creates a new template
 func (s *TemplateService) CreateTemplate(ctx context.Context, template *models.NotificationTemplate) error {
+	locale, err := NormalizeLocale(template.Locale)
+	if err != nil {
+		return err
+	}
+	if locale == "" {
+		locale = models.DefaultLocale
+	}
+	template.Locale = locale
+
+	if err := validateEmailTemplate(template.Channel, template); err != nil {
+		return err
+	}
+
 	template.CreatedAt = time.Now()
 	template.UpdatedAt = time.Now()
 
@@ -430,9 +617,15 @@ func (s *TemplateService) UpdateTemplate(ctx context.Context, templateID string,
 		return fmt.Errorf("template not found: %w", err)
 	}
 
+	if err := validateEmailTemplate(existing.Channel, template); err != nil {
+		return err
+	}
+
 	// Update fields
 	existing.SubjectTemplate = template.SubjectTemplate
 	existing.BodyTemplate = template.BodyTemplate
+	existing.HTMLTemplate = template.HTMLTemplate
+	existing.Layout = template.Layout
 	existing.IsActive = template.IsActive
 	existing.UpdatedAt = time.Now()
 
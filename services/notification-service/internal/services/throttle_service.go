@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+)
+
+// throttleWindow is the window notification rate limits apply to
+const throttleWindow = time.Hour
+
+// ThrottleService limits how many notifications of an event type a user receives on a
+// channel per hour. Counters are kept in Redis in fixed hourly windows.
+type ThrottleService struct {
+	redisClient redis.UniversalClient
+	limits      map[models.EventType]int
+	keyPrefix   string
+	logger      *logrus.Logger
+}
+
+// NewThrottleService creates a new throttle service. limits holds the hourly limit of
+// each event type for every user; event types without one are only limited by the
+// user's preferences.
+func NewThrottleService(redisClient redis.UniversalClient, limits map[models.EventType]int, logger *logrus.Logger) *ThrottleService {
+	return &ThrottleService{
+		redisClient: redisClient,
+		limits:      limits,
+		keyPrefix:   "notification_throttle:",
+		logger:      logger,
+	}
+}
+
+// Limit returns the hourly limit for an event type, the lower of the service limit and
+// the user's own. Zero means unlimited.
+func (s *ThrottleService) Limit(eventType models.EventType, preferences *models.UserNotificationPreferences) int {
+	limit := s.limits[eventType]
+	if preferences != nil {
+		if userLimit := preferences.EventRateLimits[eventType]; userLimit > 0 && (limit == 0 || userLimit < limit) {
+			limit = userLimit
+		}
+	}
+	return limit
+}
+
+// Allow counts a notification against the limit of its user, event type and channel and
+// reports whether it may be sent. Notifications are allowed when Redis is unavailable.
+func (s *ThrottleService) Allow(ctx context.Context, userID string, eventType models.EventType, channel models.NotificationChannel, limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	window := time.Now().Truncate(throttleWindow)
+	key := fmt.Sprintf("%s%s:%s:%s:%d", s.keyPrefix, userID, eventType, channel, window.Unix())
+
+	pipe := s.redisClient.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireAt(ctx, key, window.Add(throttleWindow))
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Warn("Failed to check notification rate limit")
+		return true
+	}
+
+	return count.Val() <= int64(limit)
+}
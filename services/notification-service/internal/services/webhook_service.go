@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/repository"
+)
+
+const (
+	// maxWebhookEndpoints is the number of webhook endpoints a user can register
+	maxWebhookEndpoints       = 5
+	maxWebhookDescriptionLen  = 200
+	maxWebhookDeliveriesLimit = 100
+)
+
+var (
+	ErrInvalidWebhookEndpoint  = errors.New("invalid webhook endpoint")
+	ErrTooManyWebhookEndpoints = errors.New("too many webhook endpoints")
+)
+
+// WebhookService manages the webhook endpoints users register for notifications
+type WebhookService struct {
+	webhookRepo   *repository.WebhookRepository
+	preferenceSvc *PreferenceService
+	allowInsecure bool
+	logger        *logrus.Logger
+}
+
+// NewWebhookService creates a new webhook service. allowInsecure permits plain HTTP
+// endpoint URLs, for development.
+func NewWebhookService(webhookRepo *repository.WebhookRepository, preferenceSvc *PreferenceService, allowInsecure bool, logger *logrus.Logger) *WebhookService {
+	return &WebhookService{
+		webhookRepo:   webhookRepo,
+		preferenceSvc: preferenceSvc,
+		allowInsecure: allowInsecure,
+		logger:        logger,
+	}
+}
+
+// ListEndpoints lists the webhook endpoints of a user
+func (s *WebhookService) ListEndpoints(ctx context.Context, userID string) ([]models.WebhookEndpoint, error) {
+	endpoints, err := s.webhookRepo.GetEndpointsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook endpoints: %w", err)
+	}
+	if endpoints == nil {
+		endpoints = []models.WebhookEndpoint{}
+	}
+	return endpoints, nil
+}
+
+// CreateEndpoint registers a webhook endpoint with a new signing secret and enables the
+// webhook channel
+func (s *WebhookService) CreateEndpoint(ctx context.Context, userID, rawURL, description string) (*models.WebhookEndpoint, error) {
+	endpointURL, err := s.validateURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	description = strings.TrimSpace(description)
+	if len(description) > maxWebhookDescriptionLen {
+		return nil, fmt.Errorf("%w: description must be at most %d characters", ErrInvalidWebhookEndpoint, maxWebhookDescriptionLen)
+	}
+
+	count, err := s.webhookRepo.CountEndpoints(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count webhook endpoints: %w", err)
+	}
+	if count >= maxWebhookEndpoints {
+		return nil, fmt.Errorf("%w: at most %d endpoints can be registered", ErrTooManyWebhookEndpoints, maxWebhookEndpoints)
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := &models.WebhookEndpoint{
+		UserID:      userID,
+		URL:         endpointURL,
+		Description: description,
+		Secret:      secret,
+	}
+	if err := s.webhookRepo.CreateEndpoint(ctx, endpoint); err != nil {
+		return nil, fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+
+	if err := s.preferenceSvc.SetWebhooksEnabled(ctx, userID, true); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":     userID,
+		"endpoint_id": endpoint.ID.Hex(),
+	}).Info("Webhook endpoint created")
+	return endpoint, nil
+}
+
+// RotateSecret replaces the signing secret of a webhook endpoint and returns the new one
+func (s *WebhookService) RotateSecret(ctx context.Context, userID, endpointID string) (string, error) {
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.webhookRepo.UpdateEndpointSecret(ctx, userID, endpointID, secret); err != nil {
+		return "", fmt.Errorf("failed to rotate webhook secret: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":     userID,
+		"endpoint_id": endpointID,
+	}).Info("Webhook secret rotated")
+	return secret, nil
+}
+
+// DeleteEndpoint deletes a webhook endpoint. The webhook channel is disabled once the
+// user has no endpoints left.
+func (s *WebhookService) DeleteEndpoint(ctx context.Context, userID, endpointID string) error {
+	if err := s.webhookRepo.DeleteEndpoint(ctx, userID, endpointID); err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", err)
+	}
+
+	count, err := s.webhookRepo.CountEndpoints(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to count webhook endpoints: %w", err)
+	}
+	if count == 0 {
+		if err := s.preferenceSvc.SetWebhooksEnabled(ctx, userID, false); err != nil {
+			return err
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":     userID,
+		"endpoint_id": endpointID,
+	}).Info("Webhook endpoint deleted")
+	return nil
+}
+
+// ListDeliveries lists the latest delivery attempts to a webhook endpoint
+func (s *WebhookService) ListDeliveries(ctx context.Context, userID, endpointID string, limit int) ([]models.WebhookDelivery, error) {
+	if limit <= 0 || limit > maxWebhookDeliveriesLimit {
+		limit = maxWebhookDeliveriesLimit
+	}
+
+	deliveries, err := s.webhookRepo.GetDeliveries(ctx, userID, endpointID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+// validateURL checks that a webhook URL is an absolute HTTPS URL without credentials
+func (s *WebhookService) validateURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("%w: url must be an absolute URL", ErrInvalidWebhookEndpoint)
+	}
+	if u.Scheme != "https" && !(s.allowInsecure && u.Scheme == "http") {
+		return "", fmt.Errorf("%w: url must use https", ErrInvalidWebhookEndpoint)
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("%w: url must not contain credentials", ErrInvalidWebhookEndpoint)
+	}
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+// generateWebhookSecret returns a new signing secret holding a random 32 byte key
+func generateWebhookSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return models.WebhookSecretPrefix + base64.StdEncoding.EncodeToString(key), nil
+}
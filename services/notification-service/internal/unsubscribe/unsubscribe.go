@@ -0,0 +1,99 @@
+// Package unsubscribe signs the tokens of the unsubscribe links in notification emails,
+// which let recipients unsubscribe and manage their notification preferences without
+// logging in.
+package unsubscribe
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
+)
+
+// audience keeps unsubscribe tokens from being accepted as access tokens, and access
+// tokens from being accepted as unsubscribe tokens, should the secrets be shared
+const audience = "notification-preferences"
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims identifies the recipient of an email
+type Claims struct {
+	UserID string `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+// Signer signs and validates unsubscribe tokens and builds the links holding them
+type Signer struct {
+	secretKey   []byte
+	ttl         time.Duration
+	publicURL   string
+	frontendURL string
+}
+
+// NewSigner creates a signer for tokens valid for ttl. Unsubscribe links point at the
+// notification-service's publicURL and preference center links at the frontendURL.
+func NewSigner(secret string, ttl time.Duration, publicURL, frontendURL string) *Signer {
+	return &Signer{
+		secretKey:   []byte(secret),
+		ttl:         ttl,
+		publicURL:   strings.TrimRight(publicURL, "/"),
+		frontendURL: strings.TrimRight(frontendURL, "/"),
+	}
+}
+
+// Sign creates a token for a user
+func (s *Signer) Sign(userID string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign unsubscribe token: %w", err)
+	}
+	return token, nil
+}
+
+// Validate validates a token and returns its claims
+func (s *Signer) Validate(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	switch err := jwtauth.Parse(tokenString, s.secretKey, claims, jwt.WithExpirationRequired(), jwt.WithAudience(audience)); err {
+	case nil:
+	case jwtauth.ErrExpiredToken:
+		return nil, ErrExpiredToken
+	default:
+		return nil, ErrInvalidToken
+	}
+	if claims.UserID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// Links returns the one-click unsubscribe link and the preference center link of a user.
+// Both hold the same token.
+func (s *Signer) Links(userID string) (unsubscribeURL, preferencesURL string, err error) {
+	token, err := s.Sign(userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	query := url.Values{"token": {token}}.Encode()
+	unsubscribeURL = fmt.Sprintf("%s/api/v1/unsubscribe?%s", s.publicURL, query)
+	preferencesURL = fmt.Sprintf("%s/notifications/preferences/manage?%s", s.frontendURL, query)
+	return unsubscribeURL, preferencesURL, nil
+}
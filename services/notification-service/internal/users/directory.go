@@ -0,0 +1,173 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/health"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
+	authv1 "github.com/yourusername/distributed-file-sharing/services/notification-service/pkg/pb/auth/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// ErrUserNotFound is returned for user IDs the auth-service does not know
+var ErrUserNotFound = errors.New("user not found")
+
+const (
+	// lookupTimeout bounds how long a single profile lookup may take
+	lookupTimeout = 5 * time.Second
+	// maxCachedProfiles bounds the memory used by the profile cache
+	maxCachedProfiles = 10000
+)
+
+type cachedProfile struct {
+	profile   *models.UserProfile
+	expiresAt time.Time
+}
+
+// Directory resolves user profiles from the auth-service and caches them for a short
+// time, so templates can greet users by name without a lookup per notification
+type Directory struct {
+	conn   *grpc.ClientConn
+	client authv1.AuthServiceClient
+	ttl    time.Duration
+	mu     sync.Mutex
+	cache  map[string]cachedProfile
+}
+
+// NewDirectory dials the auth-service gRPC endpoint
+func NewDirectory(addr string, ttl time.Duration, opts ...grpc.DialOption) (*Directory, error) {
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
+	}
+	poolmetrics.WatchClientConn("auth-service", conn)
+
+	return &Directory{
+		conn:   conn,
+		client: authv1.NewAuthServiceClient(conn),
+		ttl:    ttl,
+		cache:  make(map[string]cachedProfile),
+	}, nil
+}
+
+// GetProfile returns the profile of a user. Unknown users are cached as well so they do
+// not cause a lookup for every notification.
+func (d *Directory) GetProfile(ctx context.Context, userID string) (*models.UserProfile, error) {
+	// System recipients such as the security contact are not user accounts
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	d.mu.Lock()
+	cached, ok := d.cache[userID]
+	d.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		if cached.profile == nil {
+			return nil, ErrUserNotFound
+		}
+		return cached.profile, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	var profile *models.UserProfile
+	resp, err := d.client.GetUser(ctx, &authv1.GetUserRequest{UserId: userID})
+	if err != nil {
+		if code := status.Code(err); code != codes.NotFound && code != codes.InvalidArgument {
+			return nil, fmt.Errorf("failed to get user profile: %w", err)
+		}
+	} else if resp.User != nil {
+		profile = &models.UserProfile{
+			UserID:   resp.User.UserId,
+			Email:    resp.User.Email,
+			FullName: resp.User.FullName,
+			Timezone: resp.User.Timezone,
+			Locale:   resp.User.Locale,
+		}
+	}
+
+	d.mu.Lock()
+	if len(d.cache) >= maxCachedProfiles {
+		d.pruneLocked()
+	}
+	d.cache[userID] = cachedProfile{profile: profile, expiresAt: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+
+	if profile == nil {
+		return nil, ErrUserNotFound
+	}
+	return profile, nil
+}
+
+// GetVerifiedEmail returns the email address of a user and whether it is verified, which
+// it is not for unknown users. It is not cached, so that administrator access ends as
+// soon as the user's email changes.
+func (d *Directory) GetVerifiedEmail(ctx context.Context, userID string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	resp, err := d.client.GetUser(ctx, &authv1.GetUserRequest{UserId: userID})
+	if err != nil {
+		if code := status.Code(err); code == codes.NotFound || code == codes.InvalidArgument {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to get user: %w", err)
+	}
+	if resp.User == nil {
+		return "", false, nil
+	}
+
+	return resp.User.Email, resp.User.EmailVerified, nil
+}
+
+// ListUserIDs returns up to limit IDs of all users, or of an organization's members if
+// orgID is set, after the given user ID in ID order. An empty page ends the listing.
+func (d *Directory) ListUserIDs(ctx context.Context, orgID, after string, limit int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	resp, err := d.client.ListUserIDs(ctx, &authv1.ListUserIDsRequest{
+		OrgId:       orgID,
+		AfterUserId: after,
+		Limit:       int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return resp.UserIds, nil
+}
+
+// pruneLocked drops expired profiles, or the whole cache if none have expired yet
+func (d *Directory) pruneLocked() {
+	now := time.Now()
+	for userID, cached := range d.cache {
+		if now.After(cached.expiresAt) {
+			delete(d.cache, userID)
+		}
+	}
+	if len(d.cache) >= maxCachedProfiles {
+		d.cache = make(map[string]cachedProfile)
+	}
+}
+
+// HealthCheck checks that the auth-service can be reached
+func (d *Directory) HealthCheck(ctx context.Context) error {
+	return health.GRPC(d.conn)(ctx)
+}
+
+// Close closes the underlying connection
+func (d *Directory) Close() error {
+	return d.conn.Close()
+}
@@ -0,0 +1,55 @@
+package users
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/poolmetrics"
+	billingv1 "github.com/yourusername/distributed-file-sharing/services/notification-service/pkg/pb/billing/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Subscribers lists the users subscribed to billing plans from the billing-service
+type Subscribers struct {
+	conn   *grpc.ClientConn
+	client billingv1.BillingServiceClient
+}
+
+// NewSubscribers dials the billing-service gRPC endpoint
+func NewSubscribers(addr string, opts ...grpc.DialOption) (*Subscribers, error) {
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to billing service: %w", err)
+	}
+	poolmetrics.WatchClientConn("billing-service", conn)
+
+	return &Subscribers{
+		conn:   conn,
+		client: billingv1.NewBillingServiceClient(conn),
+	}, nil
+}
+
+// ListSubscriberIDs returns up to limit IDs of users with an active subscription to a
+// plan, after the given user ID in ID order. An empty page ends the listing.
+func (s *Subscribers) ListSubscriberIDs(ctx context.Context, planID, after string, limit int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	resp, err := s.client.ListSubscriberIDs(ctx, &billingv1.ListSubscriberIDsRequest{
+		PlanId:      planID,
+		AfterUserId: after,
+		Limit:       int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plan subscribers: %w", err)
+	}
+	return resp.UserIds, nil
+}
+
+// Close closes the underlying connection
+func (s *Subscribers) Close() error {
+	return s.conn.Close()
+}
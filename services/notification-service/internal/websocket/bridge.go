@@ -0,0 +1,204 @@
+package websocket
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+)
+
+const (
+	userChannelPrefix = "notification_ws:user:"
+	broadcastChannel  = "notification_ws:broadcast"
+	// bridgeSyncInterval is how often subscriptions that failed to change are retried
+	bridgeSyncInterval = 5 * time.Second
+	publishTimeout     = 5 * time.Second
+)
+
+// Bridge relays WebSocket messages between notification-service replicas through Redis
+// pub/sub, so a message sent on any replica reaches the user's connections on all of
+// them. Each replica subscribes to the channel of every user it holds connections for,
+// and to the progress of uploads and the storage usage of users the file-service
+// publishes.
+type Bridge struct {
+	redisClient redis.UniversalClient
+	server      *Server
+	// users holds the users with connections on this replica
+	users map[string]bool
+	mu    sync.Mutex
+	wake  chan struct{}
+	// subscribed holds the users this replica is subscribed for. Only used by Run.
+	subscribed map[string]bool
+	logger     *logrus.Logger
+}
+
+// NewBridge creates a bridge for the connections of server and makes the server send
+// through it. Run must be started for messages to be delivered.
+func NewBridge(redisClient redis.UniversalClient, server *Server, logger *logrus.Logger) *Bridge {
+	bridge := &Bridge{
+		redisClient: redisClient,
+		server:      server,
+		users:       make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+		subscribed:  make(map[string]bool),
+		logger:      logger,
+	}
+	server.bridge = bridge
+	return bridge
+}
+
+// Run delivers messages published by any replica to the connections of this one until
+// ctx is done
+func (b *Bridge) Run(ctx context.Context) {
+	pubsub := b.redisClient.Subscribe(ctx, broadcastChannel, events.UploadProgressChannel, events.StorageUsageChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	ticker := time.NewTicker(bridgeSyncInterval)
+	defer ticker.Stop()
+
+	b.logger.Info("WebSocket Redis bridge started")
+	b.sync(ctx, pubsub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.logger.Info("WebSocket Redis bridge stopped")
+			return
+		case <-b.wake:
+			b.sync(ctx, pubsub)
+		case <-ticker.C:
+			b.sync(ctx, pubsub)
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			b.deliver(msg)
+		}
+	}
+}
+
+// deliver hands a published message to the connections of this replica
+func (b *Bridge) deliver(msg *redis.Message) {
+	payload := []byte(msg.Payload)
+	switch msg.Channel {
+	case broadcastChannel:
+		b.server.broadcastLocal(payload)
+		return
+	case events.UploadProgressChannel:
+		b.server.sendUploadProgress(payload)
+		return
+	case events.StorageUsageChannel:
+		b.server.sendStorageUsage(payload)
+		return
+	}
+	if userID := strings.TrimPrefix(msg.Channel, userChannelPrefix); userID != msg.Channel {
+		b.server.sendLocal(userID, payload)
+	}
+}
+
+// sync subscribes to the channels of users who connected and unsubscribes from those of
+// users who no longer have connections on this replica
+func (b *Bridge) sync(ctx context.Context, pubsub *redis.PubSub) {
+	b.mu.Lock()
+	var subscribe, unsubscribe []string
+	for userID := range b.users {
+		if !b.subscribed[userID] {
+			subscribe = append(subscribe, userID)
+		}
+	}
+	for userID := range b.subscribed {
+		if !b.users[userID] {
+			unsubscribe = append(unsubscribe, userID)
+		}
+	}
+	b.mu.Unlock()
+
+	if len(subscribe) > 0 {
+		if err := pubsub.Subscribe(ctx, userChannels(subscribe)...); err != nil {
+			b.logger.WithError(err).Warn("Failed to subscribe to WebSocket user channels")
+		} else {
+			for _, userID := range subscribe {
+				b.subscribed[userID] = true
+			}
+		}
+	}
+
+	if len(unsubscribe) > 0 {
+		if err := pubsub.Unsubscribe(ctx, userChannels(unsubscribe)...); err != nil {
+			b.logger.WithError(err).Warn("Failed to unsubscribe from WebSocket user channels")
+		} else {
+			for _, userID := range unsubscribe {
+				delete(b.subscribed, userID)
+			}
+		}
+	}
+}
+
+// sendToUser publishes a message for a user and returns the number of replicas holding
+// connections for the user. When Redis is unavailable the message is only delivered to
+// this replica's connections.
+func (b *Bridge) sendToUser(userID string, message []byte) int {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	receivers, err := b.redisClient.Publish(ctx, userChannelPrefix+userID, message).Result()
+	if err != nil {
+		b.logger.WithError(err).WithField("user_id", userID).Warn("Failed to publish WebSocket message, delivering locally")
+		return b.server.sendLocal(userID, message)
+	}
+	return int(receivers)
+}
+
+// broadcast publishes a message for every connection on every replica
+func (b *Bridge) broadcast(message []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if err := b.redisClient.Publish(ctx, broadcastChannel, message).Err(); err != nil {
+		b.logger.WithError(err).Warn("Failed to publish WebSocket broadcast, delivering locally")
+		b.server.broadcastLocal(message)
+	}
+}
+
+// userConnected records that a user has connections on this replica
+func (b *Bridge) userConnected(userID string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.users[userID] = true
+	b.mu.Unlock()
+	b.signal()
+}
+
+// userDisconnected records that a user has no connections left on this replica
+func (b *Bridge) userDisconnected(userID string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	delete(b.users, userID)
+	b.mu.Unlock()
+	b.signal()
+}
+
+// signal wakes Run to update its subscriptions, without blocking
+func (b *Bridge) signal() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+func userChannels(userIDs []string) []string {
+	channels := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		channels[i] = userChannelPrefix + userID
+	}
+	return channels
+}
@@ -0,0 +1,230 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// clientActionTimeout bounds the work done for one client message
+	clientActionTimeout = 10 * time.Second
+	// maxEventTypesPerMessage is the number of event types a subscribe or unsubscribe
+	// message can name
+	maxEventTypesPerMessage = 50
+)
+
+// Inbox applies the read actions clients send over their connections. The unread count
+// they change is pushed by the inbox, through UnreadCountChanged.
+type Inbox interface {
+	MarkAsRead(ctx context.Context, notificationID, userID string) error
+	MarkAllAsRead(ctx context.Context, userID string) (int64, error)
+	GetUnreadCount(ctx context.Context, userID string) (int64, error)
+}
+
+// ClientMessage is a message sent by a client over its connection. Replies carry the
+// message's request ID in their metadata.
+//
+// Supported types:
+//   - mark_read: marks NotificationID as read
+//   - mark_all_read: marks all of the user's notifications as read
+//   - get_unread_count: replies with the unread count
+//   - subscribe, unsubscribe: start or stop receiving notifications of EventTypes on
+//     this connection; all event types are received by default
+//   - ping: replies with pong and keeps the connection marked as active
+type ClientMessage struct {
+	Type           string   `json:"type"`
+	RequestID      string   `json:"request_id,omitempty"`
+	NotificationID string   `json:"notification_id,omitempty"`
+	EventTypes     []string `json:"event_types,omitempty"`
+}
+
+// SetInbox enables the read actions of client messages
+func (s *Server) SetInbox(inbox Inbox) {
+	s.inbox = inbox
+}
+
+// handleClientMessage applies a message sent by a client
+func (s *Server) handleClientMessage(conn *Connection, data []byte) {
+	var msg ClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		s.replyError(conn, "", "invalid message")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clientActionTimeout)
+	defer cancel()
+
+	switch msg.Type {
+	case "ping":
+		conn.mu.Lock()
+		conn.LastPing = time.Now()
+		conn.mu.Unlock()
+		s.reply(conn, msg.RequestID, "pong", nil)
+
+	case "subscribe", "unsubscribe":
+		if len(msg.EventTypes) == 0 || len(msg.EventTypes) > maxEventTypesPerMessage {
+			s.replyError(conn, msg.RequestID, fmt.Sprintf("event_types must name 1 to %d event types", maxEventTypesPerMessage))
+			return
+		}
+		conn.mu.Lock()
+		for _, eventType := range msg.EventTypes {
+			if msg.Type == "unsubscribe" {
+				conn.mutedEvents[eventType] = true
+			} else {
+				delete(conn.mutedEvents, eventType)
+			}
+		}
+		muted := make([]string, 0, len(conn.mutedEvents))
+		for eventType := range conn.mutedEvents {
+			muted = append(muted, eventType)
+		}
+		conn.mu.Unlock()
+		s.reply(conn, msg.RequestID, "subscriptions", map[string]interface{}{"unsubscribed": muted})
+
+	case "get_unread_count":
+		if s.inbox == nil {
+			s.replyError(conn, msg.RequestID, "unsupported message type")
+			return
+		}
+		count, err := s.inbox.GetUnreadCount(ctx, conn.UserID)
+		if err != nil {
+			s.logger.WithError(err).WithField("user_id", conn.UserID).Error("Failed to get unread count")
+			s.replyError(conn, msg.RequestID, "failed to get unread count")
+			return
+		}
+		s.reply(conn, msg.RequestID, "unread_count", map[string]interface{}{"count": count})
+
+	case "mark_read":
+		if s.inbox == nil {
+			s.replyError(conn, msg.RequestID, "unsupported message type")
+			return
+		}
+		if msg.NotificationID == "" {
+			s.replyError(conn, msg.RequestID, "notification_id is required")
+			return
+		}
+		if err := s.inbox.MarkAsRead(ctx, msg.NotificationID, conn.UserID); err != nil {
+			if err.Error() == "notification not found" {
+				s.replyError(conn, msg.RequestID, "notification not found")
+				return
+			}
+			s.logger.WithError(err).WithField("user_id", conn.UserID).Error("Failed to mark notification as read")
+			s.replyError(conn, msg.RequestID, "failed to mark notification as read")
+			return
+		}
+		s.sendToAllConnections(conn.UserID, "notification_read", map[string]interface{}{
+			"notification_id": msg.NotificationID,
+			"read_at":         time.Now(),
+		})
+
+	case "mark_all_read":
+		if s.inbox == nil {
+			s.replyError(conn, msg.RequestID, "unsupported message type")
+			return
+		}
+		count, err := s.inbox.MarkAllAsRead(ctx, conn.UserID)
+		if err != nil {
+			s.logger.WithError(err).WithField("user_id", conn.UserID).Error("Failed to mark all notifications as read")
+			s.replyError(conn, msg.RequestID, "failed to mark all notifications as read")
+			return
+		}
+		s.sendToAllConnections(conn.UserID, "notifications_read_all", map[string]interface{}{
+			"count":   count,
+			"read_at": time.Now(),
+		})
+
+	default:
+		s.replyError(conn, msg.RequestID, "unsupported message type")
+	}
+}
+
+// pushUnreadCount sends a user's unread count to all of the user's connections
+func (s *Server) pushUnreadCount(ctx context.Context, userID string) {
+	count, err := s.inbox.GetUnreadCount(ctx, userID)
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Warn("Failed to get unread count")
+		return
+	}
+	s.sendToAllConnections(userID, "unread_count", map[string]interface{}{"count": count})
+}
+
+// sendToAllConnections sends a message to every connection of a user, on all replicas
+func (s *Server) sendToAllConnections(userID, messageType string, data interface{}) {
+	messageBytes, err := json.Marshal(Message{
+		Type:      messageType,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to marshal message")
+		return
+	}
+	s.SendToUser(userID, messageBytes)
+}
+
+// reply sends a message to a single connection
+func (s *Server) reply(conn *Connection, requestID, messageType string, data interface{}) {
+	message := Message{
+		Type:      messageType,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	if requestID != "" {
+		message.Metadata = map[string]interface{}{"request_id": requestID}
+	}
+
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to marshal reply")
+		return
+	}
+
+	// Send is closed once the connection is removed, which needs s.mu
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.connections[conn.UserID][conn.ID] != conn {
+		return
+	}
+	select {
+	case conn.Send <- messageBytes:
+	default:
+		s.logger.WithFields(logrus.Fields{
+			"user_id":       conn.UserID,
+			"connection_id": conn.ID,
+		}).Warn("Failed to send reply, channel full")
+	}
+}
+
+// replyError sends an error reply to a single connection
+func (s *Server) replyError(conn *Connection, requestID, message string) {
+	s.reply(conn, requestID, "error", map[string]string{"error": message})
+}
+
+// isMuted reports whether a connection unsubscribed from the event type of a
+// notification message
+func (c *Connection) isMuted(message []byte) bool {
+	c.mu.Lock()
+	muted := len(c.mutedEvents) > 0
+	c.mu.Unlock()
+	if !muted {
+		return false
+	}
+
+	var notification struct {
+		Type string `json:"type"`
+		Data struct {
+			EventType string `json:"event_type"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(message, &notification); err != nil || notification.Type != "notification" {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mutedEvents[notification.Data.EventType]
+}
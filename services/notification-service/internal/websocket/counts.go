@@ -0,0 +1,56 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+)
+
+const (
+	// storageUsageType is the type of the messages carrying a user's storage usage
+	storageUsageType = "storage_usage"
+	// countPushTimeout bounds looking up and sending a user's unread count
+	countPushTimeout = 5 * time.Second
+)
+
+// UnreadCountChanged sends a user's unread count to all of the user's connections, on all
+// replicas, after a notification was created, read or deleted, so that clients don't poll
+// for it. The count is looked up in the background.
+func (s *Server) UnreadCountChanged(userID string) {
+	if s.inbox == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), countPushTimeout)
+		defer cancel()
+		s.pushUnreadCount(ctx, userID)
+	}()
+}
+
+// sendStorageUsage sends a user's storage usage, as the file-service published it after
+// it changed, to the user's connections on this replica. Every replica receives the
+// update, so it isn't published again.
+func (s *Server) sendStorageUsage(payload []byte) {
+	var usage events.StorageUsage
+	if err := json.Unmarshal(payload, &usage); err != nil || usage.UserID == "" {
+		s.logger.WithError(err).Warn("Discarding invalid storage usage")
+		return
+	}
+
+	message, err := json.Marshal(Message{
+		Type:      storageUsageType,
+		Data:      usage,
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"channel": "websocket",
+			"system":  true,
+		},
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to marshal storage usage")
+		return
+	}
+	s.sendLocal(usage.UserID, message)
+}
@@ -2,7 +2,10 @@ package websocket
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -11,27 +14,51 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/apierror"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/jwtauth"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/handlers"
+	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/metrics"
 	"github.com/yourusername/distributed-file-sharing/services/notification-service/internal/models"
 )
 
+const (
+	// authTimeout is how long a client that did not authenticate during the handshake
+	// has to send its auth message
+	authTimeout = 10 * time.Second
+	// clientMessageLimit is the maximum size of a message sent by a client
+	clientMessageLimit = 8192
+	// maxConnectionsPerUser is the number of connections a user can hold, such as one per
+	// tab or device. Opening another closes the user's oldest connection.
+	maxConnectionsPerUser = 10
+)
+
 // Server handles WebSocket connections and real-time notifications
 type Server struct {
-	upgrader    websocket.Upgrader
-	connections map[string]*Connection
+	upgrader websocket.Upgrader
+	// connections holds the connections of each user, keyed by user ID and connection ID
+	connections map[string]map[string]*Connection
 	mu          sync.RWMutex
 	handler     *handlers.WebSocketHandler
-	logger      *logrus.Logger
+	validator   *jwtauth.Validator
+	inbox       Inbox
+	// bridge, when set, relays messages to the connections held by other replicas
+	bridge  *Bridge
+	metrics *metrics.Metrics
+	logger  *logrus.Logger
 }
 
 // Connection represents a WebSocket connection
 type Connection struct {
-	UserID   string
-	Conn     *websocket.Conn
-	Send     chan []byte
-	LastPing time.Time
-	IsActive bool
-	mu       sync.Mutex
+	ID          string
+	UserID      string
+	Conn        *websocket.Conn
+	Send        chan []byte
+	ConnectedAt time.Time
+	LastPing    time.Time
+	IsActive    bool
+	// mutedEvents holds the event types the client unsubscribed from on this connection
+	mutedEvents map[string]bool
+	mu          sync.Mutex
 }
 
 // Message represents a WebSocket message
@@ -54,8 +81,16 @@ type NotificationMessage struct {
 	Timestamp time.Time              `json:"timestamp"`
 }
 
-// NewServer creates a new WebSocket server
-func NewServer(handler *handlers.WebSocketHandler, logger *logrus.Logger) *Server {
+// AuthMessage authenticates a connection whose handshake carried no access token. It
+// must be the first message sent on the connection.
+type AuthMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+// NewServer creates a new WebSocket server. Connections are authenticated with user
+// access tokens checked by validator.
+func NewServer(handler *handlers.WebSocketHandler, validator *jwtauth.Validator, logger *logrus.Logger) *Server {
 	return &Server{
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
@@ -65,23 +100,52 @@ func NewServer(handler *handlers.WebSocketHandler, logger *logrus.Logger) *Serve
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
 		},
-		connections: make(map[string]*Connection),
+		connections: make(map[string]map[string]*Connection),
 		handler:     handler,
+		validator:   validator,
 		logger:      logger,
 	}
 }
 
-// HandleWebSocket handles WebSocket connections
+// SetMetrics enables recording connection metrics
+func (s *Server) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
+// recordConnections updates the connection gauges. Callers must hold s.mu.
+func (s *Server) recordConnections() {
+	count := s.countConnections()
+	s.metrics.RecordActiveConnections(count)
+	s.metrics.RecordChannelConnection(models.ChannelWebSocket, float64(count))
+}
+
+// countConnections returns the number of connections. Callers must hold s.mu.
+func (s *Server) countConnections() int {
+	count := 0
+	for _, userConns := range s.connections {
+		count += len(userConns)
+	}
+	return count
+}
+
+// HandleWebSocket handles WebSocket connections. Clients authenticate with an access
+// token in the token query parameter or the Authorization header, or, if the handshake
+// carries neither, with an AuthMessage sent first. The connection receives the
+// notifications of the user the token was issued to.
 func (s *Server) HandleWebSocket(c *gin.Context) {
-	// Extract user ID from query parameters or headers
-	userID := c.Query("user_id")
-	if userID == "" {
-		userID = c.GetHeader("X-User-ID")
+	token := c.Query("token")
+	if token == "" {
+		token = c.GetHeader("Authorization")
 	}
 
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-		return
+	var userID string
+	if token != "" {
+		claims, err := s.validator.ValidateToken(token)
+		if err != nil {
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+		userID = claims.UserID
 	}
 
 	// Upgrade connection to WebSocket
@@ -91,33 +155,116 @@ func (s *Server) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	if userID == "" {
+		userID, err = s.authenticate(conn)
+		if err != nil {
+			s.logger.WithError(err).Warn("WebSocket authentication failed")
+			conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "authentication failed"),
+				time.Now().Add(time.Second),
+			)
+			conn.Close()
+			return
+		}
+	}
+
+	connectionID, err := newConnectionID()
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to create WebSocket connection ID")
+		conn.Close()
+		return
+	}
+
 	// Create connection object
 	connection := &Connection{
-		UserID:   userID,
-		Conn:     conn,
-		Send:     make(chan []byte, 256),
-		LastPing: time.Now(),
-		IsActive: true,
+		ID:          connectionID,
+		UserID:      userID,
+		Conn:        conn,
+		Send:        make(chan []byte, 256),
+		ConnectedAt: time.Now(),
+		LastPing:    time.Now(),
+		IsActive:    true,
+		mutedEvents: make(map[string]bool),
+	}
+
+	// Confirm the user before any other message; the write pump is not running yet
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := conn.WriteJSON(Message{
+		Type: "authenticated",
+		Data: map[string]string{
+			"user_id":       userID,
+			"connection_id": connectionID,
+		},
+		Timestamp: time.Now(),
+	}); err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Error("Failed to confirm WebSocket authentication")
+		conn.Close()
+		return
 	}
 
 	// Register connection
-	s.registerConnection(userID, connection)
+	s.registerConnection(connection)
 
 	// Start goroutines for handling the connection
 	go s.handleConnection(connection)
 	go s.writePump(connection)
 
-	s.logger.WithField("user_id", userID).Info("WebSocket connection established")
+	s.logger.WithFields(logrus.Fields{
+		"user_id":       userID,
+		"connection_id": connectionID,
+	}).Info("WebSocket connection established")
+
+	if s.inbox != nil {
+		count, err := s.inbox.GetUnreadCount(c.Request.Context(), userID)
+		if err != nil {
+			s.logger.WithError(err).WithField("user_id", userID).Warn("Failed to get unread count")
+			return
+		}
+		s.reply(connection, "", "unread_count", map[string]interface{}{"count": count})
+	}
+}
+
+// authenticate reads the AuthMessage of a connection and returns the user its token was
+// issued to
+func (s *Server) authenticate(conn *websocket.Conn) (string, error) {
+	conn.SetReadLimit(clientMessageLimit)
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+
+	var msg AuthMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		return "", fmt.Errorf("failed to read auth message: %w", err)
+	}
+	if msg.Type != "auth" {
+		return "", errors.New("first message must be an auth message")
+	}
+
+	claims, err := s.validator.ValidateToken(msg.Token)
+	if err != nil {
+		return "", err
+	}
+
+	return claims.UserID, nil
+}
+
+// newConnectionID returns a random connection ID
+func newConnectionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
 }
 
 // handleConnection handles incoming messages from a WebSocket connection
 func (s *Server) handleConnection(conn *Connection) {
 	defer func() {
-		s.unregisterConnection(conn.UserID)
+		s.unregisterConnection(conn)
 		conn.Conn.Close()
 	}()
 
-	// Set read deadline
+	// Set read limit and deadline
+	conn.Conn.SetReadLimit(clientMessageLimit)
 	conn.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	conn.Conn.SetPongHandler(func(string) error {
 		conn.mu.Lock()
@@ -128,13 +275,16 @@ func (s *Server) handleConnection(conn *Connection) {
 	})
 
 	for {
-		_, _, err := conn.Conn.ReadMessage()
+		messageType, data, err := conn.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				s.logger.WithError(err).WithField("user_id", conn.UserID).Error("WebSocket error")
 			}
 			break
 		}
+		if messageType == websocket.TextMessage {
+			s.handleClientMessage(conn, data)
+		}
 	}
 }
 
@@ -170,45 +320,135 @@ func (s *Server) writePump(conn *Connection) {
 	}
 }
 
-// registerConnection registers a new WebSocket connection
-func (s *Server) registerConnection(userID string, conn *Connection) {
+// registerConnection registers a new WebSocket connection, closing the user's oldest
+// connection if the user is at the connection limit
+func (s *Server) registerConnection(conn *Connection) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Close existing connection if any
-	if existingConn, exists := s.connections[userID]; exists {
-		existingConn.IsActive = false
-		close(existingConn.Send)
-		existingConn.Conn.Close()
+	userConns, exists := s.connections[conn.UserID]
+	if !exists {
+		userConns = make(map[string]*Connection)
+		s.connections[conn.UserID] = userConns
+		s.bridge.userConnected(conn.UserID)
 	}
 
-	s.connections[userID] = conn
-	s.logger.WithField("user_id", userID).Debug("WebSocket connection registered")
+	if len(userConns) >= maxConnectionsPerUser {
+		var oldest *Connection
+		for _, existingConn := range userConns {
+			if oldest == nil || existingConn.ConnectedAt.Before(oldest.ConnectedAt) {
+				oldest = existingConn
+			}
+		}
+		s.removeConnection(oldest)
+		s.logger.WithFields(logrus.Fields{
+			"user_id":       oldest.UserID,
+			"connection_id": oldest.ID,
+		}).Info("Closed oldest WebSocket connection of user at connection limit")
+	}
+
+	userConns[conn.ID] = conn
+	s.recordConnections()
+	s.logger.WithFields(logrus.Fields{
+		"user_id":       conn.UserID,
+		"connection_id": conn.ID,
+	}).Debug("WebSocket connection registered")
 }
 
 // unregisterConnection unregisters a WebSocket connection
-func (s *Server) unregisterConnection(userID string) {
+func (s *Server) unregisterConnection(conn *Connection) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if conn, exists := s.connections[userID]; exists {
-		conn.IsActive = false
-		close(conn.Send)
-		delete(s.connections, userID)
-		s.logger.WithField("user_id", userID).Debug("WebSocket connection unregistered")
+	if s.connections[conn.UserID][conn.ID] == conn {
+		s.removeConnection(conn)
+		s.recordConnections()
+		s.logger.WithFields(logrus.Fields{
+			"user_id":       conn.UserID,
+			"connection_id": conn.ID,
+		}).Debug("WebSocket connection unregistered")
 	}
 }
 
-// SendNotification sends a notification to a specific user
-func (s *Server) SendNotification(userID string, notification *models.Notification) error {
+// removeConnection closes a registered connection and removes it. Callers must hold
+// s.mu, and each connection must only be removed once.
+func (s *Server) removeConnection(conn *Connection) {
+	conn.IsActive = false
+	close(conn.Send)
+	conn.Conn.Close()
+
+	userConns := s.connections[conn.UserID]
+	delete(userConns, conn.ID)
+	if len(userConns) == 0 {
+		delete(s.connections, conn.UserID)
+		s.bridge.userDisconnected(conn.UserID)
+	}
+}
+
+// SendToUser sends a message to every connection of a user. It returns the number of
+// connections the message was queued on or, with a bridge, the number of replicas
+// holding connections for the user; zero means the user is not connected.
+func (s *Server) SendToUser(userID string, message []byte) int {
+	if s.bridge != nil {
+		return s.bridge.sendToUser(userID, message)
+	}
+	return s.sendLocal(userID, message)
+}
+
+// sendLocal queues a message on every connection of a user held by this server and
+// returns the number of connections it reached. Connections that unsubscribed from the
+// event type of a notification count as reached without being sent it.
+func (s *Server) sendLocal(userID string, message []byte) int {
 	s.mu.RLock()
-	conn, exists := s.connections[userID]
-	s.mu.RUnlock()
+	defer s.mu.RUnlock()
 
-	if !exists {
-		return fmt.Errorf("user %s not connected", userID)
+	sent := 0
+	for _, conn := range s.connections[userID] {
+		if conn.isMuted(message) {
+			sent++
+			continue
+		}
+		select {
+		case conn.Send <- message:
+			sent++
+		default:
+			s.logger.WithFields(logrus.Fields{
+				"user_id":       userID,
+				"connection_id": conn.ID,
+			}).Warn("Failed to send message, channel full")
+		}
+	}
+	return sent
+}
+
+// broadcast sends a message to every connection
+func (s *Server) broadcast(message []byte) {
+	if s.bridge != nil {
+		s.bridge.broadcast(message)
+		return
 	}
+	s.broadcastLocal(message)
+}
+
+// broadcastLocal queues a message on every connection held by this server
+func (s *Server) broadcastLocal(message []byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	for userID, userConns := range s.connections {
+		for _, conn := range userConns {
+			select {
+			case conn.Send <- message:
+				s.logger.WithField("user_id", userID).Debug("Broadcast message sent")
+			default:
+				s.logger.WithField("user_id", userID).Warn("Failed to send broadcast message, channel full")
+			}
+		}
+	}
+}
+
+// SendNotification sends a notification to every connection of a user
+func (s *Server) SendNotification(userID string, notification *models.Notification) error {
 	// Create notification message
 	notifMsg := NotificationMessage{
 		ID:        notification.ID.Hex(),
@@ -238,23 +478,14 @@ func (s *Server) SendNotification(userID string, notification *models.Notificati
 	}
 
 	// Send message
-	select {
-	case conn.Send <- messageBytes:
-		return nil
-	default:
-		return fmt.Errorf("connection send channel is full")
+	if s.SendToUser(userID, messageBytes) == 0 {
+		return fmt.Errorf("user %s not connected", userID)
 	}
+	return nil
 }
 
 // BroadcastNotification broadcasts a notification to all connected users
 func (s *Server) BroadcastNotification(notification *models.Notification) {
-	s.mu.RLock()
-	connections := make(map[string]*Connection)
-	for userID, conn := range s.connections {
-		connections[userID] = conn
-	}
-	s.mu.RUnlock()
-
 	// Create notification message
 	notifMsg := NotificationMessage{
 		ID:        notification.ID.Hex(),
@@ -285,26 +516,11 @@ func (s *Server) BroadcastNotification(notification *models.Notification) {
 	}
 
 	// Send to all connections
-	for userID, conn := range connections {
-		select {
-		case conn.Send <- messageBytes:
-			s.logger.WithField("user_id", userID).Debug("Broadcast message sent")
-		default:
-			s.logger.WithField("user_id", userID).Warn("Failed to send broadcast message, channel full")
-		}
-	}
+	s.broadcast(messageBytes)
 }
 
-// SendSystemMessage sends a system message to a specific user
+// SendSystemMessage sends a system message to every connection of a user
 func (s *Server) SendSystemMessage(userID string, messageType string, data interface{}) error {
-	s.mu.RLock()
-	conn, exists := s.connections[userID]
-	s.mu.RUnlock()
-
-	if !exists {
-		return fmt.Errorf("user %s not connected", userID)
-	}
-
 	// Create system message
 	message := Message{
 		Type:      messageType,
@@ -323,23 +539,14 @@ func (s *Server) SendSystemMessage(userID string, messageType string, data inter
 	}
 
 	// Send message
-	select {
-	case conn.Send <- messageBytes:
-		return nil
-	default:
-		return fmt.Errorf("connection send channel is full")
+	if s.SendToUser(userID, messageBytes) == 0 {
+		return fmt.Errorf("user %s not connected", userID)
 	}
+	return nil
 }
 
 // BroadcastSystemMessage broadcasts a system message to all connected users
 func (s *Server) BroadcastSystemMessage(messageType string, data interface{}) {
-	s.mu.RLock()
-	connections := make(map[string]*Connection)
-	for userID, conn := range s.connections {
-		connections[userID] = conn
-	}
-	s.mu.RUnlock()
-
 	// Create system message
 	message := Message{
 		Type:      messageType,
@@ -359,21 +566,14 @@ func (s *Server) BroadcastSystemMessage(messageType string, data interface{}) {
 	}
 
 	// Send to all connections
-	for userID, conn := range connections {
-		select {
-		case conn.Send <- messageBytes:
-			s.logger.WithField("user_id", userID).Debug("Broadcast system message sent")
-		default:
-			s.logger.WithField("user_id", userID).Warn("Failed to send broadcast system message, channel full")
-		}
-	}
+	s.broadcast(messageBytes)
 }
 
 // GetConnectionCount returns the number of active connections
 func (s *Server) GetConnectionCount() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return len(s.connections)
+	return s.countConnections()
 }
 
 // GetConnectedUsers returns a list of connected user IDs
@@ -388,27 +588,29 @@ func (s *Server) GetConnectedUsers() []string {
 	return users
 }
 
-// IsUserConnected checks if a user is connected
+// IsUserConnected checks if a user has an active connection
 func (s *Server) IsUserConnected(userID string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	conn, exists := s.connections[userID]
-	return exists && conn.IsActive
+	for _, conn := range s.connections[userID] {
+		if conn.IsActive {
+			return true
+		}
+	}
+	return false
 }
 
-// CloseConnection closes a specific user's connection
+// CloseConnection closes all connections of a user
 func (s *Server) CloseConnection(userID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if conn, exists := s.connections[userID]; exists {
-		conn.IsActive = false
-		close(conn.Send)
-		conn.Conn.Close()
-		delete(s.connections, userID)
-		s.logger.WithField("user_id", userID).Info("WebSocket connection closed")
+	for _, conn := range s.connections[userID] {
+		s.removeConnection(conn)
 	}
+	s.recordConnections()
+	s.logger.WithField("user_id", userID).Info("WebSocket connections closed")
 }
 
 // CloseAllConnections closes all WebSocket connections
@@ -416,14 +618,18 @@ func (s *Server) CloseAllConnections() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for userID, conn := range s.connections {
-		conn.IsActive = false
-		close(conn.Send)
-		conn.Conn.Close()
-		s.logger.WithField("user_id", userID).Debug("WebSocket connection closed")
+	for userID, userConns := range s.connections {
+		for _, conn := range userConns {
+			conn.IsActive = false
+			close(conn.Send)
+			conn.Conn.Close()
+		}
+		s.bridge.userDisconnected(userID)
+		s.logger.WithField("user_id", userID).Debug("WebSocket connections closed")
 	}
 
-	s.connections = make(map[string]*Connection)
+	s.connections = make(map[string]map[string]*Connection)
+	s.recordConnections()
 	s.logger.Info("All WebSocket connections closed")
 }
 
@@ -432,18 +638,15 @@ func (s *Server) GetConnectionStats() map[string]interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	stats := map[string]interface{}{
-		"total_connections": len(s.connections),
-		"connected_users":   make([]string, 0, len(s.connections)),
-	}
-
 	users := make([]string, 0, len(s.connections))
 	for userID := range s.connections {
 		users = append(users, userID)
 	}
-	stats["connected_users"] = users
 
-	return stats
+	return map[string]interface{}{
+		"total_connections": s.countConnections(),
+		"connected_users":   users,
+	}
 }
 
 // StartCleanupRoutine starts a routine to clean up inactive connections
@@ -472,17 +675,20 @@ func (s *Server) cleanupInactiveConnections() {
 	now := time.Now()
 	inactiveThreshold := 5 * time.Minute
 
-	for userID, conn := range s.connections {
-		conn.mu.Lock()
-		lastPing := conn.LastPing
-		conn.mu.Unlock()
-
-		if now.Sub(lastPing) > inactiveThreshold {
-			conn.IsActive = false
-			close(conn.Send)
-			conn.Conn.Close()
-			delete(s.connections, userID)
-			s.logger.WithField("user_id", userID).Info("Removed inactive WebSocket connection")
+	for _, userConns := range s.connections {
+		for _, conn := range userConns {
+			conn.mu.Lock()
+			lastPing := conn.LastPing
+			conn.mu.Unlock()
+
+			if now.Sub(lastPing) > inactiveThreshold {
+				s.removeConnection(conn)
+				s.logger.WithFields(logrus.Fields{
+					"user_id":       conn.UserID,
+					"connection_id": conn.ID,
+				}).Info("Removed inactive WebSocket connection")
+			}
 		}
 	}
+	s.recordConnections()
 }
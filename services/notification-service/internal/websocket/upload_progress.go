@@ -0,0 +1,37 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+)
+
+// uploadProgressType is the type of the messages carrying the progress of an upload
+const uploadProgressType = "upload_progress"
+
+// sendUploadProgress sends an update of the progress of an upload, as the file-service
+// published it, to the uploader's connections on this replica. Every replica receives
+// the update, so it isn't published again.
+func (s *Server) sendUploadProgress(payload []byte) {
+	var progress events.UploadProgress
+	if err := json.Unmarshal(payload, &progress); err != nil || progress.UserID == "" || progress.UploadID == "" {
+		s.logger.WithError(err).Warn("Discarding invalid upload progress")
+		return
+	}
+
+	message, err := json.Marshal(Message{
+		Type:      uploadProgressType,
+		Data:      progress,
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"channel": "websocket",
+			"system":  true,
+		},
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to marshal upload progress")
+		return
+	}
+	s.sendLocal(progress.UserID, message)
+}
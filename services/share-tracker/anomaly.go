@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// EventSecurityAlert is the type of the alerts published for the notification service
+const EventSecurityAlert = "security.alert"
+
+// Alert severities
+const (
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// maxAlertFiles bounds the file IDs recorded in an alert
+const maxAlertFiles = 20
+
+// AnomalyRule flags a user whose matching events within Window reach Threshold
+type AnomalyRule struct {
+	Name      string
+	Severity  string
+	Threshold int
+	Window    time.Duration
+	// Matches selects the events the rule counts
+	Matches func(event *Event) bool
+	// Describe summarizes an alert for the user it is about
+	Describe func(count int, window time.Duration) string
+}
+
+// defaultAnomalyRules returns the rules, with the given thresholds, counted over window.
+// A threshold of 0 disables its rule.
+func defaultAnomalyRules(externalShares, downloads, deletions int, window time.Duration) []AnomalyRule {
+	rules := []AnomalyRule{
+		{
+			Name:      "external_share_burst",
+			Severity:  SeverityHigh,
+			Threshold: externalShares,
+			// Recipients without an account, including share links, are outside the platform
+			Matches: func(event *Event) bool {
+				return event.Type == EventFileShared && event.Details["shared_with_id"] == ""
+			},
+			Describe: func(count int, window time.Duration) string {
+				return fmt.Sprintf("Your account shared files outside the platform %d times in %s", count, window)
+			},
+		},
+		{
+			Name:      "mass_download",
+			Severity:  SeverityMedium,
+			Threshold: downloads,
+			Matches: func(event *Event) bool {
+				return event.Type == EventFileDownloaded
+			},
+			Describe: func(count int, window time.Duration) string {
+				return fmt.Sprintf("%d files were downloaded by your account in %s", count, window)
+			},
+		},
+		{
+			Name:      "mass_deletion",
+			Severity:  SeverityHigh,
+			Threshold: deletions,
+			Matches: func(event *Event) bool {
+				return event.Type == EventFileDeleted
+			},
+			Describe: func(count int, window time.Duration) string {
+				return fmt.Sprintf("%d files were deleted from your account in %s", count, window)
+			},
+		},
+	}
+
+	enabled := rules[:0]
+	for _, rule := range rules {
+		if rule.Threshold > 0 {
+			rule.Window = window
+			enabled = append(enabled, rule)
+		}
+	}
+	return enabled
+}
+
+// Alert is suspicious activity of a user detected by a rule
+type Alert struct {
+	AlertID     string   `json:"alert_id"`
+	Rule        string   `json:"rule"`
+	Severity    string   `json:"severity"`
+	UserID      string   `json:"user_id"`
+	Count       int      `json:"count"`
+	WindowStart string   `json:"window_start"`
+	WindowEnd   string   `json:"window_end"`
+	FileIDs     []string `json:"file_ids"`
+	Summary     string   `json:"summary"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+// AlertQuery selects the alerts returned by the admin report. Empty fields do not filter.
+type AlertQuery struct {
+	UserID   string
+	Rule     string
+	Severity string
+	// From and To bound the alert time; From is inclusive and To exclusive
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+func (q *AlertQuery) matches(alert *Alert) bool {
+	switch {
+	case q.UserID != "" && alert.UserID != q.UserID,
+		q.Rule != "" && alert.Rule != q.Rule,
+		q.Severity != "" && alert.Severity != q.Severity:
+		return false
+	}
+	return inTimeRange(alert.CreatedAt, q.From, q.To)
+}
+
+// windowHit is an event counted by a rule
+type windowHit struct {
+	at     time.Time
+	fileID string
+}
+
+// AnomalyDetector counts each user's recent events against the rules, and raises an
+// alert when a rule's threshold is reached. A rule alerts about a user at most once per
+// window. Alerts are appended to an NDJSON file and published for the notification
+// service.
+type AnomalyDetector struct {
+	rules     []AnomalyRule
+	alertPath string
+	writer    *kafka.Writer
+
+	mu     sync.Mutex
+	hits   map[string][]windowHit
+	muted  map[string]time.Time
+	alerts []Alert
+}
+
+// newAnomalyDetector loads the alerts in alertPath and publishes new ones to topic
+func newAnomalyDetector(rules []AnomalyRule, alertPath string, brokers []string, topic string) (*AnomalyDetector, error) {
+	alerts, err := readAlerts(alertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AnomalyDetector{
+		rules:     rules,
+		alertPath: alertPath,
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Topic:                  topic,
+			Balancer:               &kafka.LeastBytes{},
+			MaxAttempts:            3,
+			BatchTimeout:           10 * time.Millisecond,
+			WriteTimeout:           10 * time.Second,
+			RequiredAcks:           kafka.RequireOne,
+			AllowAutoTopicCreation: true,
+		},
+		hits:   make(map[string][]windowHit),
+		muted:  make(map[string]time.Time),
+		alerts: alerts,
+	}, nil
+}
+
+// readAlerts returns the alerts in an NDJSON file, or none if there is none
+func readAlerts(path string) ([]Alert, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []Alert{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open alerts file: %w", err)
+	}
+	defer file.Close()
+
+	alerts := []Alert{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var alert Alert
+		if err := json.Unmarshal(scanner.Bytes(), &alert); err != nil {
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read alerts file: %w", err)
+	}
+	return alerts, nil
+}
+
+// observe counts a newly archived event against the rules, and raises the alerts it
+// triggers
+func (d *AnomalyDetector) observe(event *Event) {
+	if event.UserID == "" {
+		return
+	}
+	at, err := time.Parse(time.RFC3339Nano, event.Timestamp)
+	if err != nil {
+		at = time.Now()
+	}
+
+	var raised []Alert
+	d.mu.Lock()
+	for i := range d.rules {
+		rule := &d.rules[i]
+		if !rule.Matches(event) {
+			continue
+		}
+
+		key := rule.Name + "|" + event.UserID
+		hits := append(d.hits[key], windowHit{at: at, fileID: event.FileID})
+		// Drop the hits that have left the window
+		start := at.Add(-rule.Window)
+		kept := hits[:0]
+		for _, hit := range hits {
+			if hit.at.After(start) {
+				kept = append(kept, hit)
+			}
+		}
+		d.hits[key] = kept
+
+		if len(kept) < rule.Threshold || at.Before(d.muted[key]) {
+			continue
+		}
+		d.muted[key] = at.Add(rule.Window)
+
+		alert := newAlert(rule, event.UserID, kept)
+		d.alerts = append(d.alerts, alert)
+		raised = append(raised, alert)
+	}
+	d.pruneLocked(at)
+	d.mu.Unlock()
+
+	for _, alert := range raised {
+		d.raise(alert)
+	}
+}
+
+// pruneLocked forgets users whose hits have all left their window, so that the counts
+// don't grow with every user ever seen
+func (d *AnomalyDetector) pruneLocked(now time.Time) {
+	if len(d.hits) < 10000 {
+		return
+	}
+	var longest time.Duration
+	for _, rule := range d.rules {
+		longest = max(longest, rule.Window)
+	}
+	for key, hits := range d.hits {
+		if len(hits) == 0 || !hits[len(hits)-1].at.After(now.Add(-longest)) {
+			delete(d.hits, key)
+		}
+	}
+	for key, until := range d.muted {
+		if !until.After(now) {
+			delete(d.muted, key)
+		}
+	}
+}
+
+func newAlert(rule *AnomalyRule, userID string, hits []windowHit) Alert {
+	seen := map[string]bool{}
+	fileIDs := []string{}
+	for _, hit := range hits {
+		if len(fileIDs) == maxAlertFiles {
+			break
+		}
+		if hit.fileID != "" && !seen[hit.fileID] {
+			seen[hit.fileID] = true
+			fileIDs = append(fileIDs, hit.fileID)
+		}
+	}
+
+	now := time.Now()
+	return Alert{
+		AlertID:     fmt.Sprintf("alert_%s_%s_%d", rule.Name, userID, now.UnixNano()),
+		Rule:        rule.Name,
+		Severity:    rule.Severity,
+		UserID:      userID,
+		Count:       len(hits),
+		WindowStart: hits[0].at.Format(time.RFC3339),
+		WindowEnd:   hits[len(hits)-1].at.Format(time.RFC3339),
+		FileIDs:     fileIDs,
+		Summary:     rule.Describe(len(hits), rule.Window),
+		CreatedAt:   now.Format(time.RFC3339),
+	}
+}
+
+// raise records an alert and publishes it for the notification service. Failures are
+// logged, as the alert is kept for the admin report either way.
+func (d *AnomalyDetector) raise(alert Alert) {
+	securityAlertsTotal.WithLabelValues(alert.Rule, alert.Severity).Inc()
+	log.WithFields(logrus.Fields{
+		"alert_id": alert.AlertID,
+		"rule":     alert.Rule,
+		"user_id":  alert.UserID,
+		"count":    alert.Count,
+	}).Warn("Suspicious activity detected")
+
+	if err := d.appendAlert(alert); err != nil {
+		log.WithError(err).WithField("alert_id", alert.AlertID).Error("Failed to record security alert")
+	}
+
+	// The notification service reads the Kafka events of other services in this shape
+	message, err := json.Marshal(map[string]interface{}{
+		"event_id":  alert.AlertID,
+		"type":      EventSecurityAlert,
+		"user_id":   alert.UserID,
+		"success":   true,
+		"timestamp": time.Now().Format(time.RFC3339),
+		"metadata": map[string]interface{}{
+			"alert_id":     alert.AlertID,
+			"rule":         alert.Rule,
+			"severity":     alert.Severity,
+			"summary":      alert.Summary,
+			"count":        alert.Count,
+			"window_start": alert.WindowStart,
+			"window_end":   alert.WindowEnd,
+			"file_ids":     alert.FileIDs,
+		},
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal security alert")
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := d.writer.WriteMessages(ctx, kafka.Message{Key: []byte(alert.UserID), Value: message})
+		if err != nil {
+			log.WithError(err).WithField("alert_id", alert.AlertID).Error("Failed to publish security alert")
+		}
+	}()
+}
+
+func (d *AnomalyDetector) appendAlert(alert Alert) error {
+	line, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.alertPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(d.alertPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// query returns a page of the alerts matching q, newest first, how many match in total,
+// and how many match by rule
+func (d *AnomalyDetector) query(q AlertQuery) ([]Alert, int, map[string]int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	page := []Alert{}
+	total := 0
+	byRule := map[string]int{}
+	for i := len(d.alerts) - 1; i >= 0; i-- {
+		alert := &d.alerts[i]
+		if !q.matches(alert) {
+			continue
+		}
+		if total >= q.Offset && len(page) < q.Limit {
+			page = append(page, *alert)
+		}
+		total++
+		byRule[alert.Rule]++
+	}
+	return page, total, byRule
+}
+
+// describeRules returns the detector's rules and their thresholds, for the report
+func (d *AnomalyDetector) describeRules() []map[string]interface{} {
+	rules := make([]map[string]interface{}, 0, len(d.rules))
+	for _, rule := range d.rules {
+		rules = append(rules, map[string]interface{}{
+			"name":      rule.Name,
+			"severity":  rule.Severity,
+			"threshold": rule.Threshold,
+			"window":    rule.Window.String(),
+		})
+	}
+	return rules
+}
+
+func (d *AnomalyDetector) Close() error {
+	return d.writer.Close()
+}
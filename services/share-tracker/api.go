@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultQueryLimit = 50
+	maxQueryLimit     = 500
+)
+
+// ShareQuery selects the sharing events returned by the API. Empty fields do not filter.
+type ShareQuery struct {
+	FileID string
+	// User matches events shared by or with the user
+	User       string
+	SharedBy   string
+	SharedWith string
+	Permission string
+	// From and To bound the event time; From is inclusive and To exclusive
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+// matches reports whether an event is selected by the query. Events whose timestamp
+// can't be parsed only match queries without a date range.
+func (q *ShareQuery) matches(event *ShareEvent) bool {
+	switch {
+	case q.FileID != "" && event.FileID != q.FileID,
+		q.User != "" && event.SharedBy != q.User && event.SharedWith != q.User,
+		q.SharedBy != "" && event.SharedBy != q.SharedBy,
+		q.SharedWith != "" && event.SharedWith != q.SharedWith,
+		q.Permission != "" && !strings.EqualFold(event.Permission, q.Permission):
+		return false
+	}
+
+	return inTimeRange(event.Timestamp, q.From, q.To)
+}
+
+// EventQuery selects the file events returned by the API. Empty fields do not filter.
+type EventQuery struct {
+	// Types matches events of any of the types
+	Types  []string
+	FileID string
+	UserID string
+	// From and To bound the event time; From is inclusive and To exclusive
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+// matches reports whether an event is selected by the query, like ShareQuery.matches
+func (q *EventQuery) matches(event *Event) bool {
+	switch {
+	case len(q.Types) > 0 && !slices.Contains(q.Types, event.Type),
+		q.FileID != "" && event.FileID != q.FileID,
+		q.UserID != "" && event.UserID != q.UserID:
+		return false
+	}
+	return inTimeRange(event.Timestamp, q.From, q.To)
+}
+
+// inTimeRange reports whether a timestamp is in the range [from, to). Timestamps that
+// can't be parsed are only in unbounded ranges.
+func inTimeRange(timestamp string, from, to time.Time) bool {
+	if from.IsZero() && to.IsZero() {
+		return true
+	}
+	ts, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return false
+	}
+	return (from.IsZero() || !ts.Before(from)) && (to.IsZero() || ts.Before(to))
+}
+
+// queryShares returns a page of the sharing events matching q, newest first, and how
+// many match in total
+func (el *EventLog) queryShares(q ShareQuery) ([]ShareEvent, int) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	page := []ShareEvent{}
+	total := 0
+	// Events are appended as they are received, so the newest are last
+	for i := len(el.Events) - 1; i >= 0; i-- {
+		if el.Events[i].Type != EventFileShared {
+			continue
+		}
+		event := el.Events[i].shareEvent()
+		if !q.matches(&event) {
+			continue
+		}
+		if total >= q.Offset && len(page) < q.Limit {
+			page = append(page, event)
+		}
+		total++
+	}
+	return page, total
+}
+
+// query returns a page of the events matching q, newest first, and how many match in
+// total
+func (el *EventLog) query(q EventQuery) ([]Event, int) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	page := []Event{}
+	total := 0
+	for i := len(el.Events) - 1; i >= 0; i-- {
+		event := &el.Events[i]
+		if !q.matches(event) {
+			continue
+		}
+		if total >= q.Offset && len(page) < q.Limit {
+			page = append(page, *event)
+		}
+		total++
+	}
+	return page, total
+}
+
+// newAPIServer serves the event history, health check and metrics on addr. With a
+// token, history requests must carry it as a bearer token.
+func newAPIServer(addr, token string, eventLog *EventLog, detector *AnomalyDetector, status *consumerStatus) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", healthHandler(eventLog, status))
+	mux.HandleFunc("GET /ready", healthHandler(eventLog, status))
+	mux.HandleFunc("GET /live", liveHandler)
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.Handle("GET /api/v1/shares", requireToken(token, listSharesHandler(eventLog)))
+	mux.Handle("GET /api/v1/events", requireToken(token, listEventsHandler(eventLog)))
+	mux.Handle("GET /api/v1/alerts", requireToken(token, listAlertsHandler(detector)))
+	mux.Handle("GET /api/v1/stats/daily", requireToken(token, dailyStatsHandler(eventLog)))
+
+	return &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+}
+
+// runAPIServer serves the API until ctx is done
+func runAPIServer(ctx context.Context, server *http.Server) {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.WithError(err).Warn("Failed to shut down API server")
+		}
+	}()
+
+	log.WithField("addr", server.Addr).Info("Event history API listening")
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.WithError(err).Error("API server stopped")
+	}
+}
+
+// liveHandler handles GET /live, the liveness probe, which only reports that the process
+// serves requests so that a Kafka outage doesn't get the tracker restarted
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "alive",
+		"service": "share-tracker",
+		"time":    time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// healthHandler handles GET /health and the readiness probe GET /ready, which fail while
+// reads from Kafka keep failing
+func healthHandler(eventLog *EventLog, status *consumerStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		healthy, details := status.health()
+
+		kafka := map[string]interface{}{"status": "up", "critical": true}
+		if !healthy {
+			kafka["status"] = "down"
+		}
+		if reason, ok := details["kafka_error"]; ok {
+			kafka["error"] = reason
+		}
+		details["checks"] = map[string]interface{}{"kafka": kafka}
+
+		eventLog.mu.Lock()
+		details["events_archived"] = len(eventLog.Events)
+		eventLog.mu.Unlock()
+
+		details["status"] = "healthy"
+		code := http.StatusOK
+		if !healthy {
+			details["status"] = "unhealthy"
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, details)
+	}
+}
+
+// requireToken rejects requests without the bearer token, if one is configured
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"error": "invalid or missing token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listSharesHandler handles GET /api/v1/shares, which lists sharing events newest first.
+// It filters by file_id, user (sharer or recipient), shared_by, shared_with, permission
+// and a from/to date range, and pages with limit and offset.
+func listSharesHandler(eventLog *EventLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseShareQuery(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+
+		events, total := eventLog.queryShares(query)
+
+		log.WithFields(logrus.Fields{
+			"file_id": query.FileID,
+			"user":    query.User,
+			"total":   total,
+		}).Debug("Sharing history queried")
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"events": events,
+			"total":  total,
+			"limit":  query.Limit,
+			"offset": query.Offset,
+		})
+	}
+}
+
+// listEventsHandler handles GET /api/v1/events, which lists file events of every type
+// newest first. It filters by type (repeated or comma-separated), file_id, user_id and a
+// from/to date range, and pages with limit and offset.
+func listEventsHandler(eventLog *EventLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseEventQuery(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+
+		events, total := eventLog.query(query)
+
+		log.WithFields(logrus.Fields{
+			"types":   query.Types,
+			"file_id": query.FileID,
+			"user_id": query.UserID,
+			"total":   total,
+		}).Debug("Event history queried")
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"events": events,
+			"total":  total,
+			"limit":  query.Limit,
+			"offset": query.Offset,
+		})
+	}
+}
+
+// listAlertsHandler handles GET /api/v1/alerts, the admin report of suspicious activity.
+// It lists security alerts newest first, filtered by user_id, rule, severity and a
+// from/to date range and paged with limit and offset, with the number of matching
+// alerts by rule and the rules in force.
+func listAlertsHandler(detector *AnomalyDetector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		query := AlertQuery{
+			UserID:   params.Get("user_id"),
+			Rule:     params.Get("rule"),
+			Severity: params.Get("severity"),
+		}
+
+		var err error
+		if query.From, query.To, err = parseQueryRange(params); err == nil {
+			query.Limit, query.Offset, err = parseQueryPage(params)
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+
+		alerts, total, byRule := detector.query(query)
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"alerts":  alerts,
+			"total":   total,
+			"by_rule": byRule,
+			"rules":   detector.describeRules(),
+			"limit":   query.Limit,
+			"offset":  query.Offset,
+		})
+	}
+}
+
+// parseShareQuery reads a ShareQuery from a request's query parameters. Dates are
+// RFC 3339 times or YYYY-MM-DD days in UTC; a to day includes the whole day.
+func parseShareQuery(r *http.Request) (ShareQuery, error) {
+	params := r.URL.Query()
+	query := ShareQuery{
+		FileID:     params.Get("file_id"),
+		User:       params.Get("user"),
+		SharedBy:   params.Get("shared_by"),
+		SharedWith: params.Get("shared_with"),
+		Permission: params.Get("permission"),
+	}
+
+	var err error
+	if query.From, query.To, err = parseQueryRange(params); err != nil {
+		return query, err
+	}
+	if query.Limit, query.Offset, err = parseQueryPage(params); err != nil {
+		return query, err
+	}
+
+	return query, nil
+}
+
+// parseEventQuery reads an EventQuery from a request's query parameters, with dates as
+// in parseShareQuery
+func parseEventQuery(r *http.Request) (EventQuery, error) {
+	params := r.URL.Query()
+	query := EventQuery{
+		FileID: params.Get("file_id"),
+		UserID: params.Get("user_id"),
+	}
+	for _, value := range params["type"] {
+		for _, eventType := range strings.Split(value, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				query.Types = append(query.Types, eventType)
+			}
+		}
+	}
+
+	var err error
+	if query.From, query.To, err = parseQueryRange(params); err != nil {
+		return query, err
+	}
+	if query.Limit, query.Offset, err = parseQueryPage(params); err != nil {
+		return query, err
+	}
+
+	return query, nil
+}
+
+// parseQueryRange reads the from/to date range of a query
+func parseQueryRange(params url.Values) (from, to time.Time, err error) {
+	if value := params.Get("from"); value != "" {
+		if from, err = parseQueryTime(value, false); err != nil {
+			return from, to, fmt.Errorf("from must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+	}
+	if value := params.Get("to"); value != "" {
+		if to, err = parseQueryTime(value, true); err != nil {
+			return from, to, fmt.Errorf("to must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return from, to, fmt.Errorf("to must be after from")
+	}
+	return from, to, nil
+}
+
+// parseQueryPage reads the limit and offset of a query
+func parseQueryPage(params url.Values) (limit, offset int, err error) {
+	limit = defaultQueryLimit
+	if value := params.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxQueryLimit {
+			return limit, offset, fmt.Errorf("limit must be between 1 and %d", maxQueryLimit)
+		}
+	}
+	if value := params.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return limit, offset, fmt.Errorf("offset must not be negative")
+		}
+	}
+	return limit, offset, nil
+}
+
+// parseQueryTime parses an RFC 3339 time or a YYYY-MM-DD date. A date is the start of
+// the day, or of the next day if endOfDay is set, so that it includes the whole day.
+func parseQueryTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.WithError(err).Warn("Failed to write response")
+	}
+}
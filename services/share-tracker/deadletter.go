@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+)
+
+// errMalformedEvent is returned for messages that aren't valid file events, which are
+// dead-lettered without retrying
+var errMalformedEvent = errors.New("malformed file event")
+
+// Headers of dead-lettered messages, recording where they came from and why they failed
+const (
+	headerOriginalTopic     = "x-original-topic"
+	headerOriginalPartition = "x-original-partition"
+	headerOriginalOffset    = "x-original-offset"
+	headerError             = "x-error"
+	headerAttempts          = "x-attempts"
+	headerFailedAt          = "x-failed-at"
+)
+
+// deadLetterQueue publishes messages that couldn't be processed to a dead-letter topic,
+// unchanged but for headers, so that they can be inspected and replayed
+type deadLetterQueue struct {
+	writer *kafka.Writer
+}
+
+func newDeadLetterQueue(brokers []string, topic string) *deadLetterQueue {
+	return &deadLetterQueue{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Topic:                  topic,
+			Balancer:               &kafka.LeastBytes{},
+			MaxAttempts:            3,
+			BatchTimeout:           10 * time.Millisecond,
+			WriteTimeout:           10 * time.Second,
+			RequiredAcks:           kafka.RequireOne,
+			AllowAutoTopicCreation: true,
+		},
+	}
+}
+
+// publish sends a message that failed with procErr after attempts tries to the
+// dead-letter topic
+func (q *deadLetterQueue) publish(ctx context.Context, msg kafka.Message, procErr error, attempts int) error {
+	headers := append([]kafka.Header{}, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: headerOriginalTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: headerOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: headerOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: headerError, Value: []byte(procErr.Error())},
+		kafka.Header{Key: headerAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: headerFailedAt, Value: []byte(time.Now().Format(time.RFC3339))},
+	)
+
+	return q.writer.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
+
+func (q *deadLetterQueue) Close() error {
+	return q.writer.Close()
+}
+
+// handleMessage processes a message, retrying failures up to maxRetries times with
+// backoff unless the message is malformed or written with a newer schema than this
+// service reads. Messages that still fail are dead-lettered.
+// It reports whether the message was processed.
+func handleMessage(ctx context.Context, msg kafka.Message, eventLog *EventLog, detector *AnomalyDetector, dlq *deadLetterQueue, maxRetries int) bool {
+	messagesConsumedTotal.Inc()
+
+	attempts := 0
+	var err error
+retry:
+	for {
+		attempts++
+		if err = processMessage(msg, eventLog, detector); err == nil {
+			return true
+		}
+		if errors.Is(err, errMalformedEvent) || errors.Is(err, events.ErrUnsupportedVersion) || attempts > maxRetries {
+			break
+		}
+
+		backoff := time.Duration(1<<(attempts-1)) * time.Second
+		log.WithError(err).WithFields(logrus.Fields{
+			"offset":  msg.Offset,
+			"attempt": attempts,
+			"backoff": backoff,
+		}).Warn("Failed to process message, retrying")
+		processingRetriesTotal.Inc()
+
+		select {
+		case <-ctx.Done():
+			// Messages are committed as they are read, so dead-letter the message rather
+			// than lose it
+			break retry
+		case <-time.After(backoff):
+		}
+	}
+
+	reason := "processing"
+	if errors.Is(err, errMalformedEvent) {
+		reason = "malformed"
+	} else if errors.Is(err, events.ErrUnsupportedVersion) {
+		reason = "unsupported_version"
+	}
+	messagesFailedTotal.WithLabelValues(reason).Inc()
+
+	fields := logrus.Fields{
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+		"attempts":  attempts,
+	}
+	log.WithError(err).WithFields(fields).Error("Failed to process message, sending it to the dead-letter topic")
+
+	// Dead-letter the message even while shutting down, so that it isn't lost
+	dlqCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 15*time.Second)
+	defer cancel()
+
+	if dlqErr := dlq.publish(dlqCtx, msg, err, attempts); dlqErr != nil {
+		deadLetteredTotal.WithLabelValues("error").Inc()
+		// Log the message itself, the only record of it left
+		fields["message"] = string(msg.Value)
+		log.WithError(dlqErr).WithFields(fields).Error("Failed to send message to the dead-letter topic")
+		return false
+	}
+	deadLetteredTotal.WithLabelValues("success").Inc()
+	return false
+}
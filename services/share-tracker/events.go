@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+)
+
+// Event types of the archive
+const (
+	EventFileShared         = events.TypeFileShared
+	EventFileUploaded       = events.TypeFileUploaded
+	EventFileDeleted        = events.TypeFileDeleted
+	EventFileDownloaded     = events.TypeFileDownloaded
+	EventFileVersioned      = events.TypeFileVersioned
+	EventFilePrivacyChanged = events.TypeFilePrivacyChanged
+)
+
+// Event is a file event normalized for the archive, whatever its shape on the topic.
+// Details holds the fields particular to its type, such as the recipient and permission
+// of a share or the size of an upload.
+type Event struct {
+	EventID  string `json:"event_id"`
+	Type     string `json:"type"`
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name,omitempty"`
+	// UserID is the user who acted: the owner for shares, uploads and privacy changes,
+	// and the downloader for downloads
+	UserID    string            `json:"user_id"`
+	Timestamp string            `json:"timestamp"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// ShareEvent is a file sharing event, as listed by the sharing history API
+type ShareEvent struct {
+	FileName     string `json:"file_name"`
+	FileID       string `json:"file_id"`
+	OriginalPath string `json:"original_path"`
+	SharedWith   string `json:"shared_with"`
+	SharedBy     string `json:"shared_by"`
+	Permission   string `json:"permission"`
+	Timestamp    string `json:"timestamp"`
+	ShareID      string `json:"share_id"`
+}
+
+// shareEvent returns a file.shared event as a ShareEvent
+func (e *Event) shareEvent() ShareEvent {
+	return ShareEvent{
+		FileName:     e.FileName,
+		FileID:       e.FileID,
+		OriginalPath: e.Details["original_path"],
+		SharedWith:   e.Details["shared_with"],
+		SharedBy:     e.UserID,
+		Permission:   e.Details["permission"],
+		Timestamp:    e.Timestamp,
+		ShareID:      e.Details["share_id"],
+	}
+}
+
+// archiveEvent converts a file event to an archive event
+func archiveEvent(fe *events.FileEvent) Event {
+	event := Event{
+		EventID:   fe.EventID,
+		Type:      fe.Type,
+		FileID:    fe.FileID,
+		FileName:  fe.FileName,
+		UserID:    fe.UserID,
+		Timestamp: fe.Timestamp.Format(time.RFC3339),
+		Details:   map[string]string{},
+	}
+
+	for key, value := range fe.Metadata {
+		event.Details[key] = value
+	}
+	if fe.Success {
+		event.Details["status"] = "success"
+	} else {
+		event.Details["status"] = "failed"
+		event.Details["error_reason"] = fe.ErrorReason
+	}
+	if fe.TenantID != "" {
+		event.Details["tenant_id"] = fe.TenantID
+	}
+	if fe.OwnerID != "" && fe.OwnerID != fe.UserID {
+		event.Details["owner_id"] = fe.OwnerID
+	}
+	switch fe.Type {
+	case EventFileUploaded, EventFileDeleted, EventFileVersioned:
+		event.Details["file_size"] = strconv.FormatInt(fe.FileSize, 10)
+	}
+	if fe.ContentType != "" {
+		event.Details["content_type"] = fe.ContentType
+	}
+	if fe.Version > 0 {
+		event.Details["version"] = strconv.Itoa(fe.Version)
+	}
+	if fe.Checksum != "" {
+		event.Details["checksum"] = fe.Checksum
+	}
+	if fe.IsPrivate != nil {
+		event.Details["is_private"] = strconv.FormatBool(*fe.IsPrivate)
+	}
+
+	if event.Type == EventFileShared {
+		event.Details["shared_with"] = fe.SharedWith
+		if event.Details["shared_with"] == "" {
+			event.Details["shared_with"] = "link-only"
+		}
+		if fe.SharedWithID != "" {
+			event.Details["shared_with_id"] = fe.SharedWithID
+		}
+		event.Details["permission"] = fe.Permission
+		event.Details["original_path"] = fmt.Sprintf("minio://files/%s", event.FileID)
+		event.Details["share_id"] = fmt.Sprintf("share_%s_%d", event.FileID, time.Now().Unix())
+	}
+	// Events published before event IDs were added
+	if event.EventID == "" {
+		event.EventID = fmt.Sprintf("%s_%s_%d", event.Type, event.FileID, time.Now().UnixNano())
+	}
+	return event
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// exportColumns are the columns of CSV exports; details are exported as JSON
+var exportColumns = []string{"event_id", "type", "file_id", "file_name", "user_id", "timestamp", "details"}
+
+// runExport runs the export command, which writes the archived events matching its
+// filters, oldest first, as CSV, Parquet or NDJSON. It returns the exit code.
+//
+//	share-tracker export -format csv -type file.shared -from 2024-01-01 -o shares.csv
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := flags.String("dir", eventLogDir(), "directory of the event log segments")
+	format := flags.String("format", "csv", "output format: csv, parquet or ndjson")
+	output := flags.String("o", "", "output file (default standard output)")
+	types := flags.String("type", "", "comma-separated event types to export")
+	fileID := flags.String("file-id", "", "only export events of this file")
+	userID := flags.String("user-id", "", "only export events of this user")
+	from := flags.String("from", "", "only export events at or after this RFC 3339 time or YYYY-MM-DD date")
+	to := flags.String("to", "", "only export events before this RFC 3339 time, or up to this YYYY-MM-DD date")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	query := EventQuery{FileID: *fileID, UserID: *userID}
+	for _, eventType := range strings.Split(*types, ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			query.Types = append(query.Types, eventType)
+		}
+	}
+	var err error
+	if *from != "" {
+		if query.From, err = parseQueryTime(*from, false); err != nil {
+			fmt.Fprintln(os.Stderr, "from must be an RFC 3339 time or a YYYY-MM-DD date")
+			return 2
+		}
+	}
+	if *to != "" {
+		if query.To, err = parseQueryTime(*to, true); err != nil {
+			fmt.Fprintln(os.Stderr, "to must be an RFC 3339 time or a YYYY-MM-DD date")
+			return 2
+		}
+	}
+
+	var write func(io.Writer, []Event) error
+	switch *format {
+	case "csv":
+		write = writeCSV
+	case "parquet":
+		write = writeParquet
+	case "ndjson":
+		write = writeNDJSON
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected csv, parquet or ndjson\n", *format)
+		return 2
+	}
+
+	events, err := readEvents(*dir, query)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create output file: %v\n", err)
+			return 1
+		}
+	}
+
+	buffered := bufio.NewWriter(out)
+	err = write(buffered, events)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if *output != "" {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to export events: %v\n", err)
+		return 1
+	}
+
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d events to %s\n", len(events), *output)
+	}
+	return 0
+}
+
+// readEvents reads the events matching query from the segments in dir, oldest first
+func readEvents(dir string, query EventQuery) ([]Event, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, segment := range segments {
+		if events, err = readSegment(segment, events); err != nil {
+			return nil, err
+		}
+	}
+
+	matching := events[:0]
+	for i := range events {
+		if query.matches(&events[i]) {
+			matching = append(matching, events[i])
+		}
+	}
+	return matching, nil
+}
+
+func writeCSV(w io.Writer, events []Event) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(exportColumns); err != nil {
+		return err
+	}
+	for _, event := range events {
+		details, err := detailsJSON(&event)
+		if err != nil {
+			return err
+		}
+		record := []string{event.EventID, event.Type, event.FileID, event.FileName, event.UserID, event.Timestamp, details}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// detailsJSON returns an event's details as JSON, or an empty string if it has none
+func detailsJSON(event *Event) (string, error) {
+	if len(event.Details) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(event.Details)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal details: %w", err)
+	}
+	return string(encoded), nil
+}
+
+func writeNDJSON(w io.Writer, events []Event) error {
+	encoder := json.NewEncoder(w)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
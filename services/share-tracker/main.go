@@ -3,60 +3,36 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
-	"sync"
+	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/events"
+	"github.com/yourusername/distributed-file-sharing/pkg/common/kafkametrics"
 )
 
-// FileEvent represents a Kafka file event
-type FileEvent struct {
-	Type      string            `json:"type"`
-	FileID    string            `json:"file_id"`
-	FileName  string            `json:"file_name"`
-	OwnerID   string            `json:"owner_id"`
-	Metadata  map[string]string `json:"metadata,omitempty"`
-	Timestamp string            `json:"timestamp"`
-}
-
-// ShareEvent represents a file sharing event to be logged
-type ShareEvent struct {
-	FileName     string `json:"file_name"`
-	FileID       string `json:"file_id"`
-	OriginalPath string `json:"original_path"`
-	SharedWith   string `json:"shared_with"`
-	SharedBy     string `json:"shared_by"`
-	Permission   string `json:"permission"`
-	Timestamp    string `json:"timestamp"`
-	ShareID      string `json:"share_id"`
-}
-
-// ShareLog represents the JSON log structure
-type ShareLog struct {
-	SharingEvents []ShareEvent `json:"sharing_events"`
-	Metadata      LogMetadata  `json:"metadata"`
-	mu            sync.Mutex   `json:"-"`
-}
-
-// LogMetadata contains metadata about the log file
-type LogMetadata struct {
-	CreatedAt   string `json:"created_at"`
-	LastUpdated string `json:"last_updated"`
-	TotalEvents int    `json:"total_events"`
-	Description string `json:"description"`
-}
-
 // Config holds the service configuration
 type Config struct {
 	KafkaBrokers []string
 	KafkaTopic   string
+	DLQTopic     string
+	MaxRetries   int
+	LogDir       string
 	LogFilePath  string
-	GroupID      string
+	Rotation     RotationConfig
+	// SecurityTopic carries the alerts of the anomaly rules to the notification service
+	SecurityTopic string
+	AnomalyRules  []AnomalyRule
+	GroupID       string
+	APIPort       string
+	APIToken      string
 }
 
 var log = logrus.New()
@@ -67,6 +43,10 @@ func main() {
 	})
 	log.SetLevel(logrus.InfoLevel)
 
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExport(os.Args[2:]))
+	}
+
 	log.Info("Starting Share Tracker Service...")
 
 	// Configuration from environment variables or defaults
@@ -85,23 +65,71 @@ func main() {
 		groupID = "share-tracker-group"
 	}
 
+	// Messages that can't be processed are sent here rather than dropped
+	dlqTopic := os.Getenv("KAFKA_DLQ_TOPIC")
+	if dlqTopic == "" {
+		dlqTopic = kafkaTopic + "-dlq"
+	}
+
+	maxRetries := envInt("PROCESS_MAX_RETRIES", 3)
+
+	// The single JSON file events were logged to before segments, imported once
 	logFilePath := os.Getenv("LOG_FILE_PATH")
 	if logFilePath == "" {
 		logFilePath = "/app/SharedFiles/shared_files.json"
 	}
 
+	rotation := RotationConfig{
+		MaxBytes: int64(envInt("LOG_ROTATE_MAX_MB", 64)) << 20,
+		MaxAge:   envDuration("LOG_ROTATE_INTERVAL", 24*time.Hour),
+	}
+
+	securityTopic := os.Getenv("KAFKA_SECURITY_EVENTS_TOPIC")
+	if securityTopic == "" {
+		securityTopic = "security-events"
+	}
+
+	anomalyRules := defaultAnomalyRules(
+		envInt("ANOMALY_EXTERNAL_SHARE_THRESHOLD", 100),
+		envInt("ANOMALY_DOWNLOAD_THRESHOLD", 500),
+		envInt("ANOMALY_DELETE_THRESHOLD", 200),
+		envDuration("ANOMALY_WINDOW", 10*time.Minute),
+	)
+
+	apiPort := os.Getenv("SHARE_TRACKER_SERVICE_PORT")
+	if apiPort == "" {
+		apiPort = "8087"
+	}
+
 	config := Config{
-		KafkaBrokers: []string{kafkaBrokers},
-		KafkaTopic:   kafkaTopic,
-		LogFilePath:  logFilePath,
-		GroupID:      groupID,
+		KafkaBrokers:  []string{kafkaBrokers},
+		KafkaTopic:    kafkaTopic,
+		DLQTopic:      dlqTopic,
+		MaxRetries:    maxRetries,
+		LogDir:        eventLogDir(),
+		LogFilePath:   logFilePath,
+		Rotation:      rotation,
+		SecurityTopic: securityTopic,
+		AnomalyRules:  anomalyRules,
+		GroupID:       groupID,
+		APIPort:       apiPort,
+		// Callers of the event history API must present this token, if set
+		APIToken: os.Getenv("SHARE_TRACKER_API_TOKEN"),
 	}
 
-	// Initialize share log
-	shareLog, err := loadShareLog(config.LogFilePath)
+	// Initialize event log
+	eventLog, err := loadEventLog(config.LogDir, config.LogFilePath, config.Rotation)
 	if err != nil {
-		log.WithError(err).Fatal("Failed to load share log")
+		log.WithError(err).Fatal("Failed to load event log")
 	}
+	defer eventLog.Close()
+
+	// Initialize anomaly detection
+	detector, err := newAnomalyDetector(config.AnomalyRules, filepath.Join(config.LogDir, "alerts.ndjson"), config.KafkaBrokers, config.SecurityTopic)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load security alerts")
+	}
+	defer detector.Close()
 
 	// Create Kafka reader
 	reader := kafka.NewReader(kafka.ReaderConfig{
@@ -115,10 +143,14 @@ func main() {
 	})
 	defer reader.Close()
 
+	dlq := newDeadLetterQueue(config.KafkaBrokers, config.DLQTopic)
+	defer dlq.Close()
+
 	log.WithFields(logrus.Fields{
-		"brokers": config.KafkaBrokers,
-		"topic":   config.KafkaTopic,
-		"group":   config.GroupID,
+		"brokers":   config.KafkaBrokers,
+		"topic":     config.KafkaTopic,
+		"dlq_topic": config.DLQTopic,
+		"group":     config.GroupID,
 	}).Info("Connected to Kafka")
 
 	// Context for graceful shutdown
@@ -135,9 +167,21 @@ func main() {
 		cancel()
 	}()
 
+	// Serve the event history over HTTP
+	if config.APIToken == "" {
+		log.Warn("SHARE_TRACKER_API_TOKEN is not set, the event history API is unauthenticated")
+	}
+	status := newConsumerStatus()
+	go runAPIServer(ctx, newAPIServer(":"+config.APIPort, config.APIToken, eventLog, detector, status))
+
+	// Expose the stats of the reader and of the dead-letter and alert writers in the metrics
+	go kafkametrics.WatchReader(ctx, "share-tracker", reader)
+	go kafkametrics.WatchWriter(ctx, "share-tracker", dlq.writer)
+	go kafkametrics.WatchWriter(ctx, "share-tracker", detector.writer)
+
 	// Start consuming messages
-	log.Info("Share Tracker is ready and listening for file sharing events...")
-	log.Info("Waiting for file sharing events from Kafka...")
+	log.Info("Share Tracker is ready and listening for file events...")
+	log.Info("Waiting for file events from Kafka...")
 
 	lastStatusLog := time.Now()
 	messageCount := 0
@@ -155,6 +199,7 @@ func main() {
 
 			if err != nil {
 				if err == context.DeadlineExceeded || err == context.Canceled {
+					status.readSucceeded()
 					// Log status every 5 minutes to show service is alive
 					if time.Since(lastStatusLog) > 5*time.Minute {
 						log.WithFields(logrus.Fields{
@@ -166,147 +211,115 @@ func main() {
 					continue
 				}
 				// Only log real errors (not timeouts)
+				status.readFailed(err)
 				log.WithError(err).Error("Kafka connection error, retrying...")
 				time.Sleep(5 * time.Second)
 				continue
 			}
 
-			// Process message
-			if err := processMessage(msg, shareLog, config.LogFilePath); err != nil {
-				log.WithError(err).Error("Failed to process message")
-			} else {
+			status.readSucceeded()
+
+			// Process message, dead-lettering it if it keeps failing
+			processed := handleMessage(ctx, msg, eventLog, detector, dlq, config.MaxRetries)
+			status.messageHandled(processed)
+			if processed {
 				messageCount++
 			}
 		}
 	}
 }
 
-func processMessage(msg kafka.Message, shareLog *ShareLog, logFilePath string) error {
-	// Parse Kafka message
-	var event FileEvent
-	if err := json.Unmarshal(msg.Value, &event); err != nil {
-		return fmt.Errorf("failed to unmarshal event: %w", err)
+// eventLogDir returns the directory of the event log segments
+func eventLogDir() string {
+	if dir := os.Getenv("EVENT_LOG_DIR"); dir != "" {
+		return dir
 	}
+	return "/app/SharedFiles/events"
+}
 
-	// Only process file.shared events
-	if event.Type != "file.shared" {
-		return nil
+// envInt returns an environment variable as a non-negative integer, or fallback if it is
+// unset or invalid
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
 	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.WithField("value", value).Warnf("Invalid %s, using %d", name, fallback)
+		return fallback
+	}
+	return n
+}
 
-	log.WithFields(logrus.Fields{
-		"event_type": event.Type,
-		"file_id":    event.FileID,
-		"file_name":  event.FileName,
-	}).Info("Processing file sharing event")
-
-	// Extract metadata
-	sharedWith := event.Metadata["shared_with"]
-	permission := event.Metadata["permission"]
-	if sharedWith == "" {
-		sharedWith = "link-only"
+// envDuration returns an environment variable as a non-negative duration, or fallback if
+// it is unset or invalid
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
 	}
-	if permission == "" {
-		permission = "READ"
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.WithField("value", value).Warnf("Invalid %s, using %s", name, fallback)
+		return fallback
 	}
+	return d
+}
 
-	// Create share event
-	shareEvent := ShareEvent{
-		FileName:     event.FileName,
-		FileID:       event.FileID,
-		OriginalPath: fmt.Sprintf("minio://files/%s", event.FileID),
-		SharedWith:   sharedWith,
-		SharedBy:     event.OwnerID,
-		Permission:   permission,
-		Timestamp:    event.Timestamp,
-		ShareID:      fmt.Sprintf("share_%s_%d", event.FileID, time.Now().Unix()),
+func processMessage(msg kafka.Message, eventLog *EventLog, detector *AnomalyDetector) error {
+	// Parse Kafka message
+	fileEvent, err := events.Decode(msg.Value)
+	if err != nil {
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errMalformedEvent, err)
 	}
+	event := archiveEvent(fileEvent)
+
+	log.WithFields(logrus.Fields{
+		"event_type": event.Type,
+		"file_id":    event.FileID,
+		"file_name":  event.FileName,
+	}).Info("Processing file event")
 
 	// Add to log
-	if err := shareLog.addEvent(shareEvent, logFilePath); err != nil {
+	added, err := eventLog.addEvent(event)
+	if err != nil {
 		return fmt.Errorf("failed to add event to log: %w", err)
 	}
+	if !added {
+		log.WithField("event_id", event.EventID).Debug("File event already logged")
+		return nil
+	}
+	messagesProcessedTotal.WithLabelValues(event.Type).Inc()
+
+	// Check the user's recent activity for suspicious patterns
+	detector.observe(&event)
 
 	// Output confirmation
 	confirmation := map[string]interface{}{
-		"status":      "success",
-		"file_name":   shareEvent.FileName,
-		"shared_with": shareEvent.SharedWith,
-		"share_id":    shareEvent.ShareID,
-		"timestamp":   shareEvent.Timestamp,
+		"status":     "success",
+		"event_id":   event.EventID,
+		"event_type": event.Type,
+		"file_name":  event.FileName,
+		"user_id":    event.UserID,
+		"timestamp":  event.Timestamp,
+	}
+	if event.Type == EventFileShared {
+		confirmation["shared_with"] = event.Details["shared_with"]
+		confirmation["share_id"] = event.Details["share_id"]
 	}
 
 	confirmJSON, _ := json.MarshalIndent(confirmation, "", "  ")
 	fmt.Println(string(confirmJSON))
 
 	log.WithFields(logrus.Fields{
-		"file_name":   shareEvent.FileName,
-		"shared_with": shareEvent.SharedWith,
-		"share_id":    shareEvent.ShareID,
-	}).Info("File sharing event logged successfully")
-
-	return nil
-}
-
-func loadShareLog(filePath string) (*ShareLog, error) {
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		// Create new log
-		shareLog := &ShareLog{
-			SharingEvents: []ShareEvent{},
-			Metadata: LogMetadata{
-				CreatedAt:   time.Now().Format(time.RFC3339),
-				LastUpdated: time.Now().Format(time.RFC3339),
-				TotalEvents: 0,
-				Description: "Log of all file sharing events in the distributed file-sharing platform",
-			},
-		}
-
-		// Save initial log
-		if err := saveShareLog(shareLog, filePath); err != nil {
-			return nil, err
-		}
-
-		return shareLog, nil
-	}
-
-	// Load existing log
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read log file: %w", err)
-	}
-
-	var shareLog ShareLog
-	if err := json.Unmarshal(data, &shareLog); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal log: %w", err)
-	}
-
-	return &shareLog, nil
-}
-
-func saveShareLog(shareLog *ShareLog, filePath string) error {
-	data, err := json.MarshalIndent(shareLog, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal log: %w", err)
-	}
-
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write log file: %w", err)
-	}
+		"event_id":   event.EventID,
+		"event_type": event.Type,
+		"file_name":  event.FileName,
+	}).Info("File event logged successfully")
 
 	return nil
 }
-
-func (sl *ShareLog) addEvent(event ShareEvent, filePath string) error {
-	sl.mu.Lock()
-	defer sl.mu.Unlock()
-
-	// Add event to list
-	sl.SharingEvents = append(sl.SharingEvents, event)
-
-	// Update metadata
-	sl.Metadata.LastUpdated = time.Now().Format(time.RFC3339)
-	sl.Metadata.TotalEvents = len(sl.SharingEvents)
-
-	// Save to file
-	return saveShareLog(sl, filePath)
-}
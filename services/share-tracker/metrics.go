@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	messagesConsumedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "share_tracker_messages_consumed_total",
+		Help: "Total number of messages read from the file events topic",
+	})
+	messagesProcessedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "share_tracker_messages_processed_total",
+		Help: "Total number of file events archived",
+	}, []string{"event_type"})
+	messagesFailedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "share_tracker_messages_failed_total",
+		Help: "Total number of messages that couldn't be processed, by reason",
+	}, []string{"reason"})
+	processingRetriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "share_tracker_processing_retries_total",
+		Help: "Total number of retries of messages whose processing failed",
+	})
+	deadLetteredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "share_tracker_dead_lettered_total",
+		Help: "Total number of messages sent to the dead-letter topic, by result",
+	}, []string{"result"})
+	securityAlertsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "share_tracker_security_alerts_total",
+		Help: "Total number of security alerts raised, by rule and severity",
+	}, []string{"rule", "severity"})
+)
+
+// kafkaUnhealthyAfter is how long reads from Kafka must have been failing before the
+// service reports itself unhealthy
+const kafkaUnhealthyAfter = time.Minute
+
+// consumerStatus tracks the consumer for the health endpoint
+type consumerStatus struct {
+	mu                sync.Mutex
+	startedAt         time.Time
+	lastMessageAt     time.Time
+	failingSince      time.Time
+	lastError         string
+	messagesProcessed int
+	messagesFailed    int
+}
+
+func newConsumerStatus() *consumerStatus {
+	return &consumerStatus{startedAt: time.Now()}
+}
+
+// readSucceeded records that Kafka was reachable, with or without a message
+func (s *consumerStatus) readSucceeded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failingSince = time.Time{}
+	s.lastError = ""
+}
+
+// readFailed records a failed read from Kafka
+func (s *consumerStatus) readFailed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failingSince.IsZero() {
+		s.failingSince = time.Now()
+	}
+	s.lastError = err.Error()
+}
+
+// messageHandled records a message that was processed, or failed to be
+func (s *consumerStatus) messageHandled(processed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastMessageAt = time.Now()
+	if processed {
+		s.messagesProcessed++
+	} else {
+		s.messagesFailed++
+	}
+}
+
+// health reports whether the consumer is healthy, with details for the health endpoint
+func (s *consumerStatus) health() (bool, map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	healthy := s.failingSince.IsZero() || time.Since(s.failingSince) < kafkaUnhealthyAfter
+	details := map[string]interface{}{
+		"uptime_seconds":     int(time.Since(s.startedAt).Seconds()),
+		"messages_processed": s.messagesProcessed,
+		"messages_failed":    s.messagesFailed,
+		"kafka_connected":    s.failingSince.IsZero(),
+	}
+	if !s.lastMessageAt.IsZero() {
+		details["last_message_at"] = s.lastMessageAt.Format(time.RFC3339)
+	}
+	if s.lastError != "" {
+		details["kafka_error"] = s.lastError
+	}
+	return healthy, details
+}
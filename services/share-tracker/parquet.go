@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// A minimal Parquet writer for exports: one row group, one uncompressed PLAIN-encoded
+// data page per column, with the file metadata in Thrift's compact protocol. See
+// https://github.com/apache/parquet-format for the format.
+
+// Parquet physical types, repetitions, converted types and encodings
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetColumn is a column of an export, with its values as they are written to its page
+type parquetColumn struct {
+	name      string
+	typ       int32
+	optional  bool
+	converted int32
+
+	values    []byte
+	defLevels []bool
+}
+
+// writeParquet writes events as a Parquet file. Timestamps are stored in milliseconds
+// and are null if they can't be parsed; details are stored as JSON.
+func writeParquet(w io.Writer, events []Event) error {
+	columns := []*parquetColumn{
+		{name: "event_id", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "type", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "file_id", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "file_name", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "user_id", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "timestamp", typ: parquetInt64, optional: true, converted: parquetTimestampMillis},
+		{name: "details", typ: parquetByteArray, converted: parquetUTF8},
+	}
+
+	for _, event := range events {
+		details, err := detailsJSON(&event)
+		if err != nil {
+			return err
+		}
+
+		for i, value := range []string{event.EventID, event.Type, event.FileID, event.FileName, event.UserID} {
+			columns[i].appendString(value)
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, event.Timestamp); err == nil {
+			columns[5].appendInt64(ts.UnixMilli())
+		} else {
+			columns[5].appendNull()
+		}
+		columns[6].appendString(details)
+	}
+
+	out := &countingWriter{w: w}
+	if _, err := out.Write(parquetMagic); err != nil {
+		return err
+	}
+
+	// Write each column's page, recording where it starts and how long it is
+	offsets := make([]int64, len(columns))
+	sizes := make([]int64, len(columns))
+	for i, column := range columns {
+		data := column.pageData()
+
+		header := newThriftCompact()
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.beginStruct(5)
+		header.i32(1, int32(len(events)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.endStruct()
+
+		offsets[i] = out.n
+		if _, err := out.Write(header.finish()); err != nil {
+			return err
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+		sizes[i] = out.n - offsets[i]
+	}
+
+	footer := newThriftCompact()
+	footer.i32(1, 1)
+	footer.list(2, thriftStruct, len(columns)+1)
+	footer.beginElement()
+	footer.binary(4, []byte("schema"))
+	footer.i32(5, int32(len(columns)))
+	footer.endStruct()
+	for _, column := range columns {
+		footer.beginElement()
+		footer.i32(1, column.typ)
+		if column.optional {
+			footer.i32(3, parquetOptional)
+		} else {
+			footer.i32(3, parquetRequired)
+		}
+		footer.binary(4, []byte(column.name))
+		footer.i32(6, column.converted)
+		footer.endStruct()
+	}
+	footer.i64(3, int64(len(events)))
+
+	if len(events) == 0 {
+		footer.list(4, thriftStruct, 0)
+	} else {
+		var totalSize int64
+		footer.list(4, thriftStruct, 1)
+		footer.beginElement()
+		footer.list(1, thriftStruct, len(columns))
+		for i, column := range columns {
+			footer.beginElement()
+			footer.i64(2, offsets[i])
+			footer.beginStruct(3)
+			footer.i32(1, column.typ)
+			footer.list(2, thriftI32, 2)
+			footer.element(parquetPlain)
+			footer.element(parquetRLE)
+			footer.list(3, thriftBinary, 1)
+			footer.elementBinary([]byte(column.name))
+			footer.i32(4, 0) // UNCOMPRESSED
+			footer.i64(5, int64(len(events)))
+			footer.i64(6, sizes[i])
+			footer.i64(7, sizes[i])
+			footer.i64(9, offsets[i])
+			footer.endStruct()
+			footer.endStruct()
+			totalSize += sizes[i]
+		}
+		footer.i64(2, totalSize)
+		footer.i64(3, int64(len(events)))
+		footer.endStruct()
+	}
+	footer.binary(6, []byte("share-tracker"))
+
+	metadata := footer.finish()
+	if _, err := out.Write(metadata); err != nil {
+		return err
+	}
+	if _, err := out.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(metadata)))); err != nil {
+		return err
+	}
+	_, err := out.Write(parquetMagic)
+	return err
+}
+
+func (c *parquetColumn) appendString(value string) {
+	c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(value)))
+	c.values = append(c.values, value...)
+	c.defLevels = append(c.defLevels, true)
+}
+
+func (c *parquetColumn) appendInt64(value int64) {
+	c.values = binary.LittleEndian.AppendUint64(c.values, uint64(value))
+	c.defLevels = append(c.defLevels, true)
+}
+
+func (c *parquetColumn) appendNull() {
+	c.defLevels = append(c.defLevels, false)
+}
+
+// pageData returns the data of the column's page: the definition levels of an optional
+// column, RLE-encoded, followed by its values
+func (c *parquetColumn) pageData() []byte {
+	if !c.optional {
+		return c.values
+	}
+
+	// Encode the levels as runs of equal values, each a varint of the run length
+	// shifted left once, followed by the level in a byte
+	var levels []byte
+	for i := 0; i < len(c.defLevels); {
+		run := 1
+		for i+run < len(c.defLevels) && c.defLevels[i+run] == c.defLevels[i] {
+			run++
+		}
+		levels = binary.AppendUvarint(levels, uint64(run)<<1)
+		if c.defLevels[i] {
+			levels = append(levels, 1)
+		} else {
+			levels = append(levels, 0)
+		}
+		i += run
+	}
+
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	data = append(data, levels...)
+	return append(data, c.values...)
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftCompact encodes a Thrift struct in the compact protocol, as Parquet's metadata is
+type thriftCompact struct {
+	buf []byte
+	// lastIDs holds the last field ID written in each struct being written, which
+	// field headers are encoded relative to
+	lastIDs []int16
+}
+
+func newThriftCompact() *thriftCompact {
+	return &thriftCompact{lastIDs: []int16{0}}
+}
+
+func (t *thriftCompact) field(id int16, typ byte) {
+	last := &t.lastIDs[len(t.lastIDs)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendUvarint(t.buf, zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftCompact) i32(id int16, value int32) {
+	t.field(id, thriftI32)
+	t.buf = binary.AppendUvarint(t.buf, zigzag(int64(value)))
+}
+
+func (t *thriftCompact) i64(id int16, value int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendUvarint(t.buf, zigzag(value))
+}
+
+func (t *thriftCompact) binary(id int16, value []byte) {
+	t.field(id, thriftBinary)
+	t.elementBinary(value)
+}
+
+func (t *thriftCompact) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.lastIDs = append(t.lastIDs, 0)
+}
+
+func (t *thriftCompact) endStruct() {
+	t.buf = append(t.buf, 0)
+	t.lastIDs = t.lastIDs[:len(t.lastIDs)-1]
+}
+
+// list writes the header of a list of size elements of elemType, which are written next
+func (t *thriftCompact) list(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xf0|elemType)
+		t.buf = binary.AppendUvarint(t.buf, uint64(size))
+	}
+}
+
+// beginElement begins a struct element of a list, ended by endStruct
+func (t *thriftCompact) beginElement() {
+	t.lastIDs = append(t.lastIDs, 0)
+}
+
+// element writes an i32 element of a list
+func (t *thriftCompact) element(value int32) {
+	t.buf = binary.AppendUvarint(t.buf, zigzag(int64(value)))
+}
+
+// elementBinary writes a binary element of a list
+func (t *thriftCompact) elementBinary(value []byte) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(value)))
+	t.buf = append(t.buf, value...)
+}
+
+// finish ends the struct and returns its encoding
+func (t *thriftCompact) finish() []byte {
+	return append(t.buf, 0)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+// countingWriter counts the bytes written through it, for the offsets of pages
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultStatsDays is the number of days activity statistics cover by default
+	defaultStatsDays = 30
+	// maxStatsDays bounds the number of days activity statistics cover
+	maxStatsDays = 366
+	// tenantHeader names the tenant whose activity is counted
+	tenantHeader = "X-Tenant-ID"
+)
+
+// DailyActivity counts the successful file events of a UTC day
+type DailyActivity struct {
+	Date          string `json:"date"`
+	Uploads       int    `json:"uploads"`
+	UploadedBytes int64  `json:"uploaded_bytes"`
+	Downloads     int    `json:"downloads"`
+	Shares        int    `json:"shares"`
+	Deletions     int    `json:"deletions"`
+}
+
+// dailyActivity counts the successful events of every day in [from, to), oldest first.
+// With byTenant set only the events of tenantID are counted; events without a tenant
+// belong to the default tenant.
+func (el *EventLog) dailyActivity(from, to time.Time, tenantID string, byTenant bool) []DailyActivity {
+	from = from.UTC().Truncate(24 * time.Hour)
+	days := []DailyActivity{}
+	index := make(map[string]int)
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		index[date] = len(days)
+		days = append(days, DailyActivity{Date: date})
+	}
+
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	for i := range el.Events {
+		event := &el.Events[i]
+		if event.Details["status"] != "success" || (byTenant && event.Details["tenant_id"] != tenantID) {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339Nano, event.Timestamp)
+		if err != nil || ts.Before(from) || !ts.Before(to) {
+			continue
+		}
+		day := &days[index[ts.UTC().Format("2006-01-02")]]
+
+		switch event.Type {
+		case EventFileUploaded:
+			day.Uploads++
+			size, _ := strconv.ParseInt(event.Details["file_size"], 10, 64)
+			day.UploadedBytes += size
+		case EventFileDownloaded:
+			day.Downloads++
+		case EventFileShared:
+			day.Shares++
+		case EventFileDeleted:
+			day.Deletions++
+		}
+	}
+	return days
+}
+
+// dailyStatsHandler handles GET /api/v1/stats/daily, the uploads, downloads, shares and
+// deletions per UTC day of the admin analytics, between the from and to dates (by
+// default the last 30 days). It counts every tenant, or the tenant in X-Tenant-ID.
+func dailyStatsHandler(eventLog *EventLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseQueryRange(r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		if to.IsZero() {
+			to = time.Now().UTC()
+		}
+		if from.IsZero() {
+			from = to.AddDate(0, 0, -defaultStatsDays)
+		}
+		if to.Sub(from) > maxStatsDays*24*time.Hour {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": "range must not span more than " + strconv.Itoa(maxStatsDays) + " days",
+			})
+			return
+		}
+
+		values, byTenant := r.Header[http.CanonicalHeaderKey(tenantHeader)]
+		tenantID := ""
+		if byTenant && len(values) > 0 {
+			tenantID = values[0]
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"days": eventLog.dailyActivity(from, to, tenantID, byTenant),
+			"from": from,
+			"to":   to,
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	segmentPrefix     = "events-"
+	segmentSuffix     = ".ndjson"
+	segmentTimeLayout = "20060102T150405.000000000Z"
+)
+
+// RotationConfig sets when the active segment of the event log is closed and a new one
+// started. Zero values don't rotate.
+type RotationConfig struct {
+	MaxBytes int64
+	MaxAge   time.Duration
+}
+
+// segmentStore stores events as NDJSON, one event per line, in append-only segment files
+// named after the time they were started, so that they sort in the order they were written
+type segmentStore struct {
+	dir      string
+	rotation RotationConfig
+
+	active        *os.File
+	activeSize    int64
+	activeStarted time.Time
+	// partialLine is set when the active segment ends without a newline, after a crash
+	// or a failed write, so that the next event starts a line of its own
+	partialLine bool
+}
+
+// openSegmentStore opens the segments in dir, creating it if needed, and returns the
+// events they hold in the order they were written
+func openSegmentStore(dir string, rotation RotationConfig) (*segmentStore, []Event, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create event log directory: %w", err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := []Event{}
+	for _, segment := range segments {
+		if events, err = readSegment(segment, events); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	store := &segmentStore{dir: dir, rotation: rotation}
+	if len(segments) > 0 {
+		// Keep appending to the latest segment, unless it is due to be rotated
+		latest := segments[len(segments)-1]
+		info, err := os.Stat(latest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to stat segment: %w", err)
+		}
+		started, _ := segmentStartTime(latest)
+		if !store.due(info.Size(), started) {
+			if err := store.openActive(latest, info.Size(), started); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return store, events, nil
+}
+
+// listSegments returns the paths of the segments in dir, oldest first
+func listSegments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log directory: %w", err)
+	}
+
+	var segments []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		segments = append(segments, filepath.Join(dir, name))
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// readSegment appends the events of a segment to events. A line that can't be parsed,
+// such as one cut short by a crash, is skipped.
+func readSegment(path string, events []Event) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.WithError(err).WithFields(logrus.Fields{
+				"segment": filepath.Base(path),
+				"line":    line,
+			}).Warn("Skipping unreadable event log line")
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read segment %s: %w", filepath.Base(path), err)
+	}
+	return events, nil
+}
+
+// segmentStartTime returns when a segment was started, from its name
+func segmentStartTime(path string) (time.Time, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), segmentPrefix), segmentSuffix)
+	return time.Parse(segmentTimeLayout, name)
+}
+
+// due reports whether a segment of the given size, started at started, is to be rotated
+func (s *segmentStore) due(size int64, started time.Time) bool {
+	if s.rotation.MaxBytes > 0 && size >= s.rotation.MaxBytes {
+		return true
+	}
+	return s.rotation.MaxAge > 0 && !started.IsZero() && time.Since(started) >= s.rotation.MaxAge
+}
+
+func (s *segmentStore) openActive(path string, size int64, started time.Time) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	s.active = file
+	s.activeSize = size
+	s.activeStarted = started
+	s.partialLine = false
+
+	if size > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, size-1); err == nil && last[0] != '\n' {
+			s.partialLine = true
+		}
+	}
+	return nil
+}
+
+// rotate closes the active segment, if any, and starts a new one
+func (s *segmentStore) rotate() error {
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			return fmt.Errorf("failed to close segment: %w", err)
+		}
+		log.WithField("segment", filepath.Base(s.active.Name())).Info("Rotated event log segment")
+		s.active = nil
+	}
+
+	started := time.Now().UTC()
+	path := filepath.Join(s.dir, segmentPrefix+started.Format(segmentTimeLayout)+segmentSuffix)
+	return s.openActive(path, 0, started)
+}
+
+// append writes events to the active segment, rotating it first if it is due
+func (s *segmentStore) append(events ...Event) error {
+	if s.active == nil || s.due(s.activeSize, s.activeStarted) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var buf []byte
+	if s.partialLine {
+		buf = append(buf, '\n')
+	}
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	n, err := s.active.Write(buf)
+	s.activeSize += int64(n)
+	if err != nil {
+		s.partialLine = n > 0
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	s.partialLine = false
+	return nil
+}
+
+func (s *segmentStore) Close() error {
+	if s.active == nil {
+		return nil
+	}
+	return s.active.Close()
+}
+
+// EventLog is the archive of file events. It keeps every event in memory for queries and
+// appends new ones to a segmentStore. Events are in the order they were received.
+type EventLog struct {
+	Events []Event
+
+	mu    sync.Mutex
+	seen  map[string]bool
+	store *segmentStore
+}
+
+// legacyEventLog is the single JSON file events were logged to before segments, holding
+// either all events or, earlier still, only share events
+type legacyEventLog struct {
+	Events        []Event      `json:"events"`
+	SharingEvents []ShareEvent `json:"sharing_events"`
+}
+
+// loadEventLog opens the event log in dir. If dir holds no events yet and legacyPath
+// holds a legacy log, its events are imported and it is renamed with a .migrated suffix.
+func loadEventLog(dir, legacyPath string, rotation RotationConfig) (*EventLog, error) {
+	store, events, err := openSegmentStore(dir, rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 && legacyPath != "" {
+		imported, err := readLegacyEventLog(legacyPath)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		if len(imported) > 0 {
+			if err := store.append(imported...); err != nil {
+				store.Close()
+				return nil, err
+			}
+			if err := os.Rename(legacyPath, legacyPath+".migrated"); err != nil {
+				log.WithError(err).Warn("Failed to rename migrated legacy event log")
+			}
+			log.WithField("events", len(imported)).Info("Migrated legacy event log to segments")
+			events = imported
+		}
+	}
+
+	eventLog := &EventLog{
+		Events: events,
+		seen:   make(map[string]bool, len(events)),
+		store:  store,
+	}
+	for _, event := range events {
+		eventLog.seen[event.EventID] = true
+	}
+	return eventLog, nil
+}
+
+// readLegacyEventLog returns the events of a legacy log, or none if there is none
+func readLegacyEventLog(path string) ([]Event, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy log file: %w", err)
+	}
+
+	var legacy legacyEventLog
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal legacy log: %w", err)
+	}
+
+	events := make([]Event, 0, len(legacy.SharingEvents)+len(legacy.Events))
+	for _, share := range legacy.SharingEvents {
+		events = append(events, Event{
+			EventID:   share.ShareID,
+			Type:      EventFileShared,
+			FileID:    share.FileID,
+			FileName:  share.FileName,
+			UserID:    share.SharedBy,
+			Timestamp: share.Timestamp,
+			Details: map[string]string{
+				"shared_with":   share.SharedWith,
+				"permission":    share.Permission,
+				"original_path": share.OriginalPath,
+				"share_id":      share.ShareID,
+			},
+		})
+	}
+	return append(events, legacy.Events...), nil
+}
+
+// addEvent archives an event. It reports false for events already archived, which
+// Kafka redelivers after a restart.
+func (el *EventLog) addEvent(event Event) (bool, error) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	if el.seen[event.EventID] {
+		return false, nil
+	}
+
+	// Write the event before keeping it, so that a failed write can be retried
+	if err := el.store.append(event); err != nil {
+		return false, err
+	}
+	el.Events = append(el.Events, event)
+	el.seen[event.EventID] = true
+	return true, nil
+}
+
+func (el *EventLog) Close() error {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	return el.store.Close()
+}
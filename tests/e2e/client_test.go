@@ -0,0 +1,138 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// client calls the API gateway as a user
+type client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func newClient(baseURL string) *client {
+	return &client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// apiError is a response with an unexpected status
+type apiError struct {
+	Method string
+	Path   string
+	Status int
+	Body   string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s: status %d: %s", e.Method, e.Path, e.Status, e.Body)
+}
+
+// do sends body, if any, as JSON with token as the bearer token, and decodes the JSON
+// response into a map. Responses other than 2xx are returned as *apiError.
+func (c *client) do(ctx context.Context, method, path, token string, body interface{}) (map[string]interface{}, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &apiError{Method: method, Path: path, Status: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+
+	result := make(map[string]interface{})
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("%s %s: invalid JSON response: %w", method, path, err)
+		}
+	}
+	return result, nil
+}
+
+// put uploads content to a presigned URL
+func (c *client) put(ctx context.Context, url, contentType string, content []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return &apiError{Method: http.MethodPut, Path: "presigned upload URL", Status: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return nil
+}
+
+// field returns a field of a JSON object by its proto name. The gRPC gateways write
+// lowerCamelCase names and the REST handlers snake_case ones, so both are looked up.
+func field(object map[string]interface{}, name string) interface{} {
+	if value, ok := object[name]; ok {
+		return value
+	}
+	return object[camelCase(name)]
+}
+
+// stringField returns a string field of a JSON object, or "" if it is missing
+func stringField(object map[string]interface{}, name string) string {
+	value, _ := field(object, name).(string)
+	return value
+}
+
+// objectField returns an object field of a JSON object, or nil if it is missing
+func objectField(object map[string]interface{}, name string) map[string]interface{} {
+	value, _ := field(object, name).(map[string]interface{})
+	return value
+}
+
+// camelCase converts a snake_case name to lowerCamelCase
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,9 @@
+// Package e2e holds the end-to-end tests of the platform, which run the flows of its
+// users through the API gateway: register, upload, complete, share, notify and delete.
+//
+// The tests are behind the e2e build tag. They boot MongoDB, Redis, Kafka, MinIO,
+// Cassandra and the services in throwaway Docker containers on random ports, and remove
+// them afterwards:
+//
+//	go test -tags e2e -timeout 30m .
+package e2e
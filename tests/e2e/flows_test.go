@@ -0,0 +1,273 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// pollInterval is how often eventually consistent results, such as notifications
+	// created from Kafka events, are checked
+	pollInterval = time.Second
+	// eventTimeout bounds the wait for results of events
+	eventTimeout = 30 * time.Second
+)
+
+// password is the password of the users the flows register
+const password = "E2e-Flow-Passw0rd!"
+
+// user is a user registered by the flows
+type user struct {
+	email string
+	id    string
+	token string
+}
+
+// flows runs the end-to-end flows, each step building on the previous ones: an owner
+// uploads a file and shares it with a recipient, who is notified, then deletes it
+type flows struct {
+	client *client
+	// users is the auth-service's users collection, in which the flows verify the email
+	// addresses of the users they register
+	users *mongo.Collection
+
+	owner     user
+	recipient user
+	fileID    string
+	fileName  string
+	content   []byte
+	uploadURL string
+}
+
+// step is a step of the flows
+type step struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// TestFlows runs the steps of the flows in order. A failed step stops the flows, as the
+// later steps build on it.
+func TestFlows(t *testing.T) {
+	f := &flows{
+		client: newClient(platform.gatewayURL),
+		users:  platform.mongo.Database(database).Collection("users"),
+	}
+	ctx := context.Background()
+
+	for _, s := range f.steps() {
+		if !t.Run(s.name, func(t *testing.T) {
+			if err := s.run(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}) {
+			t.FailNow()
+		}
+	}
+}
+
+func (f *flows) steps() []step {
+	return []step{
+		{name: "register", run: f.register},
+		{name: "upload", run: f.upload},
+		{name: "complete", run: f.complete},
+		{name: "share", run: f.share},
+		{name: "notify", run: f.notify},
+		{name: "delete", run: f.delete},
+	}
+}
+
+// register registers the owner and the recipient, verifies their email addresses, which
+// sharing requires, and logs them in
+func (f *flows) register(ctx context.Context) error {
+	run := time.Now().UnixNano()
+	var err error
+	if f.owner, err = f.registerUser(ctx, fmt.Sprintf("e2e-owner-%d@example.com", run), "E2E Owner"); err != nil {
+		return err
+	}
+	f.recipient, err = f.registerUser(ctx, fmt.Sprintf("e2e-recipient-%d@example.com", run), "E2E Recipient")
+	return err
+}
+
+func (f *flows) registerUser(ctx context.Context, email, fullName string) (user, error) {
+	if _, err := f.client.do(ctx, http.MethodPost, "/api/v1/auth/register", "", map[string]string{
+		"email":     email,
+		"password":  password,
+		"full_name": fullName,
+	}); err != nil {
+		return user{}, fmt.Errorf("failed to register %s: %w", email, err)
+	}
+
+	// The verification email isn't delivered, so the address is verified directly
+	result, err := f.users.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{
+		"email_verified":    true,
+		"email_verified_at": time.Now(),
+	}})
+	if err != nil {
+		return user{}, fmt.Errorf("failed to verify %s: %w", email, err)
+	}
+	if result.MatchedCount == 0 {
+		return user{}, fmt.Errorf("registered user %s not found", email)
+	}
+
+	resp, err := f.client.do(ctx, http.MethodPost, "/api/v1/auth/login", "", map[string]string{
+		"email":    email,
+		"password": password,
+	})
+	if err != nil {
+		return user{}, fmt.Errorf("failed to log in %s: %w", email, err)
+	}
+
+	u := user{
+		email: email,
+		id:    stringField(objectField(resp, "user"), "user_id"),
+		token: stringField(resp, "access_token"),
+	}
+	if u.id == "" || u.token == "" {
+		return user{}, fmt.Errorf("login of %s returned no user ID or access token", email)
+	}
+	return u, nil
+}
+
+// upload starts an upload as the owner and puts the content to the presigned URL
+func (f *flows) upload(ctx context.Context) error {
+	f.fileName = fmt.Sprintf("e2e-%d.txt", time.Now().UnixNano())
+	f.content = []byte("end-to-end test file " + f.fileName + "\n")
+
+	resp, err := f.client.do(ctx, http.MethodPost, "/api/v1/files/upload", f.owner.token, map[string]interface{}{
+		"name":      f.fileName,
+		"size":      len(f.content),
+		"mime_type": "text/plain",
+	})
+	if err != nil {
+		return err
+	}
+
+	f.fileID = stringField(resp, "file_id")
+	f.uploadURL = stringField(resp, "upload_url")
+	if f.fileID == "" || f.uploadURL == "" {
+		return errors.New("upload returned no file ID or upload URL")
+	}
+
+	return f.client.put(ctx, f.uploadURL, "text/plain", f.content)
+}
+
+// complete completes the upload with the content's checksum, which the file-service
+// compares with the stored object's
+func (f *flows) complete(ctx context.Context) error {
+	sum := md5.Sum(f.content)
+	resp, err := f.client.do(ctx, http.MethodPost, "/api/v1/files/"+f.fileID+"/complete", f.owner.token, map[string]string{
+		"checksum": hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return err
+	}
+
+	if status := stringField(objectField(resp, "file"), "status"); status != "FILE_STATUS_AVAILABLE" {
+		return fmt.Errorf("completed file has status %q", status)
+	}
+	return nil
+}
+
+// share shares the file with the recipient, who then sees it among the files shared
+// with them
+func (f *flows) share(ctx context.Context) error {
+	if _, err := f.client.do(ctx, http.MethodPost, "/api/v1/files/"+f.fileID+"/share", f.owner.token, map[string]interface{}{
+		"shared_with_emails": []string{f.recipient.email},
+		"permission":         "PERMISSION_READ",
+	}); err != nil {
+		return err
+	}
+
+	resp, err := f.client.do(ctx, http.MethodGet, "/api/v1/files/shared", f.recipient.token, nil)
+	if err != nil {
+		return err
+	}
+	files, _ := field(resp, "files").([]interface{})
+	for _, file := range files {
+		if object, ok := file.(map[string]interface{}); ok && stringField(object, "file_id") == f.fileID {
+			return nil
+		}
+	}
+	return errors.New("shared file is not listed among the recipient's shared files")
+}
+
+// notify waits for the recipient's notification of the share, created by the
+// notification-service from the file-service's Kafka event
+func (f *flows) notify(ctx context.Context) error {
+	return f.eventually(ctx, func() error {
+		resp, err := f.client.do(ctx, http.MethodGet, "/api/v1/notifications/?limit=50", f.recipient.token, nil)
+		if err != nil {
+			return err
+		}
+
+		notifications, _ := resp["notifications"].([]interface{})
+		for _, notification := range notifications {
+			object, ok := notification.(map[string]interface{})
+			if !ok || stringField(object, "event_type") != "file.shared" {
+				continue
+			}
+			// The notification names the file in its text or metadata
+			data, _ := json.Marshal(object)
+			if strings.Contains(string(data), f.fileName) || strings.Contains(string(data), f.fileID) {
+				return nil
+			}
+		}
+		return errors.New("no file.shared notification for the file yet")
+	})
+}
+
+// delete deletes the file as the owner and waits for it to be gone
+func (f *flows) delete(ctx context.Context) error {
+	if _, err := f.client.do(ctx, http.MethodDelete, "/api/v1/files/"+f.fileID, f.owner.token, nil); err != nil {
+		return err
+	}
+
+	return f.eventually(ctx, func() error {
+		resp, err := f.client.do(ctx, http.MethodGet, "/api/v1/files/"+f.fileID, f.owner.token, nil)
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if status := stringField(objectField(resp, "file"), "status"); status != "FILE_STATUS_DELETED" {
+			return fmt.Errorf("file still has status %q", status)
+		}
+		return nil
+	})
+}
+
+// eventually retries check until it succeeds or the event timeout passes, returning its
+// last error
+func (f *flows) eventually(ctx context.Context, check func() error) error {
+	ctx, cancel := context.WithTimeout(ctx, eventTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
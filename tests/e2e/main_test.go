@@ -0,0 +1,40 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+)
+
+// platform is the platform booted for the tests
+var platform *testPlatform
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	ctx := context.Background()
+
+	p, err := startPlatform(ctx)
+	if p != nil {
+		defer p.stop()
+	}
+	if err != nil {
+		log.Printf("Failed to boot the platform: %v", err)
+		if p != nil {
+			p.dumpLogs()
+		}
+		return 1
+	}
+	platform = p
+
+	code := m.Run()
+	if code != 0 {
+		p.dumpLogs()
+	}
+	return code
+}
@@ -0,0 +1,455 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// containerTTL is how long Docker keeps the containers if the tests die before
+	// removing them
+	containerTTL = 30 * 60
+	// readyTimeout bounds the wait for each dependency and service to be ready
+	readyTimeout = 5 * time.Minute
+
+	// The secrets and credentials of the booted platform, which only protect its
+	// throwaway containers
+	jwtSecret          = "e2e-jwt-secret"
+	serviceTokenSecret = "e2e-service-token-secret"
+	minioUser          = "e2e-minio"
+	minioPassword      = "e2e-minio-password"
+	database           = "file_sharing"
+)
+
+// serviceSecrets are the secrets the services authenticate to each other with
+var serviceSecrets = map[string]string{
+	"api-gateway":          "e2e-api-gateway-secret",
+	"file-service":         "e2e-file-service-secret",
+	"notification-service": "e2e-notification-service-secret",
+	"billing-service":      "e2e-billing-service-secret",
+}
+
+// testPlatform is the platform booted for the tests: the dependencies and services,
+// in containers on a network of their own, which publish their ports on random host
+// ports.
+type testPlatform struct {
+	pool    *dockertest.Pool
+	network *dockertest.Network
+	// prefix names the containers of this run, which reach each other by name
+	prefix     string
+	repoRoot   string
+	containers []namedContainer
+
+	// minioPort is the host port of MinIO, which presigned URLs point at
+	minioPort  string
+	gatewayURL string
+	mongo      *mongo.Client
+}
+
+type namedContainer struct {
+	name     string
+	resource *dockertest.Resource
+}
+
+// startPlatform boots the dependencies and services. The returned platform, if any,
+// must be stopped even on error.
+func startPlatform(ctx context.Context) (*testPlatform, error) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	pool.MaxWait = readyTimeout
+	if err := pool.Client.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+
+	repoRoot, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	p := &testPlatform{pool: pool, prefix: "dfs-e2e-" + hex.EncodeToString(suffix), repoRoot: repoRoot}
+
+	if p.network, err = pool.CreateNetwork(p.prefix); err != nil {
+		return nil, fmt.Errorf("failed to create network: %w", err)
+	}
+	if err := p.startDependencies(ctx); err != nil {
+		return p, err
+	}
+	if err := p.startServices(); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// host returns the name a container is reached by on the platform's network
+func (p *testPlatform) host(name string) string {
+	return p.prefix + "-" + name
+}
+
+// startDependencies starts MongoDB, Redis, Kafka, MinIO and Cassandra and waits for them
+// to be ready
+func (p *testPlatform) startDependencies(ctx context.Context) error {
+	mongoDB, err := p.run("mongodb", &dockertest.RunOptions{
+		Repository:   "mongo",
+		Tag:          "7.0",
+		ExposedPorts: []string{"27017/tcp"},
+	})
+	if err != nil {
+		return err
+	}
+	mongoURI := "mongodb://localhost:" + mongoDB.GetPort("27017/tcp")
+	if err := p.wait("mongodb", func() error {
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+		if err != nil {
+			return err
+		}
+		if err := client.Ping(ctx, nil); err != nil {
+			client.Disconnect(ctx)
+			return err
+		}
+		p.mongo = client
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	redis, err := p.run("redis", &dockertest.RunOptions{Repository: "redis", Tag: "7-alpine"})
+	if err != nil {
+		return err
+	}
+	if err := p.wait("redis", command(redis, "redis-cli", "ping")); err != nil {
+		return err
+	}
+
+	if _, err := p.run("zookeeper", &dockertest.RunOptions{
+		Repository: "confluentinc/cp-zookeeper",
+		Tag:        "7.5.0",
+		Env:        []string{"ZOOKEEPER_CLIENT_PORT=2181", "ZOOKEEPER_TICK_TIME=2000"},
+	}); err != nil {
+		return err
+	}
+	kafka, err := p.run("kafka", &dockertest.RunOptions{
+		Repository: "confluentinc/cp-kafka",
+		Tag:        "7.5.0",
+		Env: []string{
+			"KAFKA_BROKER_ID=1",
+			"KAFKA_ZOOKEEPER_CONNECT=" + p.host("zookeeper") + ":2181",
+			"KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://" + p.host("kafka") + ":9092",
+			"KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR=1",
+			"KAFKA_AUTO_CREATE_TOPICS_ENABLE=true",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := p.wait("kafka", command(kafka, "kafka-broker-api-versions", "--bootstrap-server", "localhost:9092")); err != nil {
+		return err
+	}
+
+	minio, err := p.run("minio", &dockertest.RunOptions{
+		Repository:   "minio/minio",
+		Tag:          "latest",
+		Cmd:          []string{"server", "/data", "--address", ":9000"},
+		Env:          []string{"MINIO_ROOT_USER=" + minioUser, "MINIO_ROOT_PASSWORD=" + minioPassword},
+		ExposedPorts: []string{"9000/tcp"},
+	})
+	if err != nil {
+		return err
+	}
+	p.minioPort = minio.GetPort("9000/tcp")
+	if err := p.wait("minio", probe("http://localhost:"+p.minioPort+"/minio/health/live")); err != nil {
+		return err
+	}
+
+	cassandra, err := p.run("cassandra", &dockertest.RunOptions{
+		Repository: "cassandra",
+		Tag:        "4.1",
+		Env:        []string{"MAX_HEAP_SIZE=512M", "HEAP_NEWSIZE=128M"},
+		Mounts:     []string{filepath.Join(p.repoRoot, "services/file-service/docker/cassandra/init.cql") + ":/init.cql:ro"},
+	})
+	if err != nil {
+		return err
+	}
+	// The schema is created as soon as Cassandra accepts it
+	return p.wait("cassandra", command(cassandra, "cqlsh", "-f", "/init.cql"))
+}
+
+// startServices builds and starts the services and waits for them to be ready
+func (p *testPlatform) startServices() error {
+	mongoURI := "mongodb://" + p.host("mongodb") + ":27017"
+	redisAddr := p.host("redis") + ":6379"
+	kafkaBrokers := p.host("kafka") + ":9092"
+	grpcAddr := func(service string, port int) string {
+		return fmt.Sprintf("%s:%d", p.host(service), port)
+	}
+	common := func(service string) []string {
+		env := []string{
+			"ENVIRONMENT=development",
+			"LOG_LEVEL=debug",
+			"MONGO_URI=" + mongoURI,
+			"MONGO_DATABASE=" + database,
+			"KAFKA_BROKERS=" + kafkaBrokers,
+			"JWT_SECRET=" + jwtSecret,
+			"SERVICE_AUTH_ENABLED=true",
+			"SERVICE_TOKEN_SECRET=" + serviceTokenSecret,
+		}
+		if secret, ok := serviceSecrets[service]; ok {
+			env = append(env, "SERVICE_CLIENT_ID="+service, "SERVICE_CLIENT_SECRET="+secret)
+		}
+		return env
+	}
+
+	var clients []string
+	for id, secret := range serviceSecrets {
+		clients = append(clients, id+":"+secret)
+	}
+
+	services := []struct {
+		name string
+		port string
+		env  []string
+	}{
+		{
+			name: "auth-service",
+			port: "8081",
+			env: append(common("auth-service"),
+				"AUTH_SERVICE_PORT=8081",
+				"AUTH_GRPC_PORT=50051",
+				"AUTH_SERVICE_HOST=0.0.0.0",
+				"SERVICE_CLIENTS="+strings.Join(clients, ","),
+				"NOTIFICATION_SERVICE_GRPC="+grpcAddr("notification-service", 50054),
+				"FILE_SERVICE_GRPC="+grpcAddr("file-service", 50052),
+				"REDIS_ENABLED=true",
+				"REDIS_ADDR="+redisAddr,
+			),
+		},
+		{
+			name: "file-service",
+			port: "8082",
+			env: append(common("file-service"),
+				"FILE_SERVICE_PORT=8082",
+				"FILE_GRPC_PORT=50052",
+				"FILE_SERVICE_HOST=0.0.0.0",
+				"STORAGE_TYPE=minio",
+				"MINIO_ENDPOINT="+p.host("minio")+":9000",
+				// Presigned URLs are used by the tests, from the host
+				"MINIO_EXTERNAL_ENDPOINT=localhost:"+p.minioPort,
+				"MINIO_ACCESS_KEY="+minioUser,
+				"MINIO_SECRET_KEY="+minioPassword,
+				"MINIO_BUCKET=file-sharing",
+				"MINIO_USE_SSL=false",
+				"AUTH_SERVICE_GRPC="+grpcAddr("auth-service", 50051),
+				"BILLING_SERVICE_GRPC="+grpcAddr("billing-service", 50055),
+				"REDIS_ENABLED=true",
+				"REDIS_ADDR="+redisAddr,
+				"CASSANDRA_HOSTS="+p.host("cassandra"),
+				"CASSANDRA_PORT=9042",
+				"CASSANDRA_KEYSPACE=file_service",
+				"CASSANDRA_CONSISTENCY=ONE",
+			),
+		},
+		{
+			name: "notification-service",
+			port: "8084",
+			env: append(common("notification-service"),
+				"NOTIFICATION_SERVICE_PORT=8084",
+				"NOTIFICATION_WEBSOCKET_PORT=8085",
+				"NOTIFICATION_METRICS_PORT=9095",
+				"NOTIFICATION_GRPC_PORT=50054",
+				"NOTIFICATION_SERVICE_HOST=0.0.0.0",
+				"REDIS_ENABLED=true",
+				"REDIS_ADDR="+redisAddr,
+				"REDIS_URI="+redisAddr,
+				"KAFKA_GROUP_ID=notification-service",
+				"AUTH_SERVICE_GRPC="+grpcAddr("auth-service", 50051),
+				"BILLING_SERVICE_GRPC="+grpcAddr("billing-service", 50055),
+			),
+		},
+		{
+			name: "billing-service",
+			port: "8086",
+			env: append(common("billing-service"),
+				"BILLING_SERVICE_PORT=8086",
+				"BILLING_GRPC_PORT=50055",
+				"BILLING_SERVICE_HOST=0.0.0.0",
+				"KAFKA_GROUP_ID=billing-service",
+				"FILE_SERVICE_GRPC="+grpcAddr("file-service", 50052),
+				"AUTH_SERVICE_GRPC="+grpcAddr("auth-service", 50051),
+				"NOTIFICATION_SERVICE_GRPC="+grpcAddr("notification-service", 50054),
+			),
+		},
+		{
+			name: "api-gateway",
+			port: "8080",
+			env: append(common("api-gateway"),
+				"GATEWAY_PORT=8080",
+				"AUTH_SERVICE_GRPC="+grpcAddr("auth-service", 50051),
+				"FILE_SERVICE_GRPC="+grpcAddr("file-service", 50052),
+				"NOTIFICATION_SERVICE_GRPC="+grpcAddr("notification-service", 50054),
+				"BILLING_SERVICE_GRPC="+grpcAddr("billing-service", 50055),
+				"AUTH_SERVICE_REST_URL=http://"+p.host("auth-service")+":8081",
+				"FILE_SERVICE_REST_URL=http://"+p.host("file-service")+":8082",
+				"NOTIFICATION_SERVICE_REST_URL=http://"+p.host("notification-service")+":8084",
+				"BILLING_SERVICE_REST_URL=http://"+p.host("billing-service")+":8086",
+				"REDIS_ENABLED=true",
+				"REDIS_ADDR="+redisAddr,
+			),
+		},
+	}
+
+	// The services are started together, as they call each other, then waited for
+	ports := make(map[string]string)
+	for _, s := range services {
+		resource, err := p.build(s.name, &dockertest.RunOptions{
+			Env:          s.env,
+			ExposedPorts: []string{s.port + "/tcp"},
+		})
+		if err != nil {
+			return err
+		}
+		ports[s.name] = resource.GetPort(s.port + "/tcp")
+	}
+	for _, s := range services {
+		if err := p.wait(s.name, probe("http://localhost:"+ports[s.name]+"/ready")); err != nil {
+			return err
+		}
+	}
+
+	p.gatewayURL = "http://localhost:" + ports["api-gateway"]
+	return nil
+}
+
+// run starts a container from an image on the platform's network
+func (p *testPlatform) run(name string, opts *dockertest.RunOptions) (*dockertest.Resource, error) {
+	log.Printf("Starting %s", name)
+	opts.Name = p.host(name)
+	opts.Hostname = p.host(name)
+	opts.Networks = []*dockertest.Network{p.network}
+
+	resource, err := p.pool.RunWithOptions(opts, func(config *docker.HostConfig) {
+		config.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	p.containers = append(p.containers, namedContainer{name: name, resource: resource})
+
+	if err := resource.Expire(containerTTL); err != nil {
+		return nil, fmt.Errorf("failed to set the expiry of %s: %w", name, err)
+	}
+	return resource, nil
+}
+
+// build builds the image of a service from its Dockerfile, as docker-compose.yml does,
+// and starts it on the platform's network
+func (p *testPlatform) build(service string, opts *dockertest.RunOptions) (*dockertest.Resource, error) {
+	log.Printf("Building %s", service)
+	image := "dfs-e2e/" + service
+	if err := p.pool.Client.BuildImage(docker.BuildImageOptions{
+		Name:         image + ":latest",
+		Dockerfile:   filepath.Join("services", service, "Dockerfile"),
+		ContextDir:   p.repoRoot,
+		OutputStream: io.Discard,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to build %s: %w", service, err)
+	}
+
+	opts.Repository = image
+	opts.Tag = "latest"
+	return p.run(service, opts)
+}
+
+// wait retries ready until it succeeds or the ready timeout passes
+func (p *testPlatform) wait(name string, ready func() error) error {
+	log.Printf("Waiting for %s", name)
+	if err := p.pool.Retry(ready); err != nil {
+		return fmt.Errorf("%s is not ready: %w", name, err)
+	}
+	return nil
+}
+
+// command returns a readiness check running a command in a container
+func command(resource *dockertest.Resource, cmd ...string) func() error {
+	return func() error {
+		code, err := resource.Exec(cmd, dockertest.ExecOptions{})
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("%s exited with %d", cmd[0], code)
+		}
+		return nil
+	}
+}
+
+// probe returns a readiness check expecting 200 from url
+func probe(url string) func() error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return func() error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// dumpLogs writes the last lines of the services' logs, to tell why the tests failed
+func (p *testPlatform) dumpLogs() {
+	for _, c := range p.containers {
+		if !strings.HasSuffix(c.name, "-service") && c.name != "api-gateway" {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "==== %s\n", c.name)
+		p.pool.Client.Logs(docker.LogsOptions{
+			Container:    c.resource.Container.ID,
+			OutputStream: os.Stderr,
+			ErrorStream:  os.Stderr,
+			Stdout:       true,
+			Stderr:       true,
+			Tail:         "100",
+		})
+	}
+}
+
+// stop removes the containers and the network
+func (p *testPlatform) stop() {
+	if p.mongo != nil {
+		p.mongo.Disconnect(context.Background())
+	}
+	for i := len(p.containers) - 1; i >= 0; i-- {
+		if err := p.pool.Purge(p.containers[i].resource); err != nil {
+			log.Printf("Failed to remove %s: %v", p.containers[i].name, err)
+		}
+	}
+	if p.network != nil {
+		if err := p.network.Close(); err != nil {
+			log.Printf("Failed to remove network %s: %v", p.prefix, err)
+		}
+	}
+}